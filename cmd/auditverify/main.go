@@ -0,0 +1,13 @@
+// Command auditverify is nsm audit verify, kept for scripts that run it
+// with go run ./cmd/auditverify.
+package main
+
+import (
+	"os"
+
+	"nexsign.mini/nsm/internal/auditverify"
+)
+
+func main() {
+	os.Exit(auditverify.Main(os.Args[1:]))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"nexsign.mini/nsm/internal/auditverify"
+	"nexsign.mini/nsm/internal/config"
+	"nexsign.mini/nsm/internal/deployer"
+	"nexsign.mini/nsm/internal/docgen"
+)
+
+// command runs an nsm command with the arguments after its name and
+// returns the exit code.
+type command struct {
+	run     func(args []string) int
+	summary string
+}
+
+// commands returns the commands of the binary by name. It is a function
+// rather than a variable, as serve and help refer back to it for usage.
+func commands() map[string]command {
+	return map[string]command{
+		"serve": {func(args []string) int {
+			serve(args)
+			return 0
+		}, "Run the node: dashboard, API and background jobs (the default)"},
+		"deploy": {func(args []string) int {
+			deployer.Main(args)
+			return 0
+		}, "Build and copy nsm to hosts over SSH, or package a signed release"},
+		"docgen": {docgen.Main, "Generate the API reference page from the handler comments"},
+		"config": {runConfigCommand, "Check config.json files: config validate <file>..."},
+		"audit":  {runAuditCommand, "Check an exported audit bundle: audit verify <bundle.json>"},
+		"help": {func([]string) int {
+			printUsage()
+			return 0
+		}, "Show this list"},
+	}
+}
+
+// newFlagSet returns the flags of a command, with usage naming the command
+// and its arguments.
+func newFlagSet(name, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: nsm %s %s\n", name, synopsis)
+		fs.PrintDefaults()
+		if name == "serve" {
+			fmt.Fprintln(os.Stderr)
+			printUsage()
+		}
+	}
+	return fs
+}
+
+func printUsage() {
+	list := commands()
+	names := make([]string, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "usage: nsm [command] [flags]\n\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, list[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun nsm <command> -h for the flags of a command.")
+}
+
+// runConfigCommand runs nsm config <subcommand>. validate parses each file
+// as the node would at startup, for deployers to check a rendered
+// config.json before starting with it.
+func runConfigCommand(args []string) int {
+	if len(args) < 2 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "usage: nsm config validate <config.json>...")
+		return 2
+	}
+	code := 0
+	for _, path := range args[1:] {
+		cfg, err := config.Load(path, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			code = 1
+			continue
+		}
+		fmt.Printf("%s: OK (port %d, data_dir %q, enable_actions %t)\n", path, cfg.Port, cfg.DataDir, cfg.EnableActions)
+	}
+	return code
+}
+
+// runAuditCommand runs nsm audit verify.
+func runAuditCommand(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: nsm audit verify <bundle.json>")
+		return 2
+	}
+	return auditverify.Main(args[1:])
+}
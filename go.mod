@@ -8,6 +8,8 @@ require (
 	github.com/bytesparadise/libasciidoc v0.8.0
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.1
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	gopkg.in/yaml.v2 v2.4.0
 	modernc.org/sqlite v1.40.0
 )
 
@@ -31,7 +33,6 @@ require (
 	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/tools v0.36.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 	modernc.org/libc v1.66.10 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
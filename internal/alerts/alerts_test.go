@@ -0,0 +1,434 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		ok   bool
+	}{
+		{"offline", Rule{Condition: "Offline", ForMinutes: 5, Channels: []string{"webhook"}}, true},
+		{"disk default", Rule{Condition: ConditionDiskUsage, Channels: []string{"mqtt"}}, true},
+		{"unknown condition", Rule{Condition: "on_fire", Channels: []string{"webhook"}}, false},
+		{"no channels", Rule{Condition: ConditionOffline}, false},
+		{"email without recipients", Rule{Condition: ConditionOffline, Channels: []string{"email"}}, false},
+		{"bad recipient", Rule{Condition: ConditionOffline, Channels: []string{"email"}, Recipients: []string{"nope"}}, false},
+		{"bad threshold", Rule{Condition: ConditionDiskUsage, Threshold: 150, Channels: []string{"webhook"}}, false},
+		{"content expiry", Rule{Condition: ConditionContentExpiry, Threshold: 7, Channels: []string{"webhook"}}, true},
+		{"script", Rule{Condition: ConditionScript, Script: `len(hosts) > 3`, Preset: "Fallback", Channels: []string{"webhook"}}, true},
+		{"bad script", Rule{Condition: ConditionScript, Script: `len(hosts) >`, Channels: []string{"webhook"}}, false},
+		{"preset without script", Rule{Condition: ConditionOffline, Preset: "Fallback", Channels: []string{"webhook"}}, false},
+	}
+	for _, tt := range tests {
+		err := tt.rule.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+
+	r := Rule{Condition: ConditionDiskUsage, Channels: []string{"mqtt"}}
+	r.Validate()
+	if r.Threshold != DefaultDiskThreshold || r.ID == "" || r.Name != ConditionDiskUsage {
+		t.Errorf("expected defaults to be filled in, got %+v", r)
+	}
+}
+
+func TestEngineCheck(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+	}))
+	defer srv.Close()
+	store.PutSetting(notify.WebhookSettingKey, notify.WebhookConfig{URL: srv.URL})
+
+	store.ReplaceAll([]types.Host{
+		{ID: "scoreboard", Nickname: "Scoreboard", IPAddress: "192.168.1.20", Status: types.StatusHealthy, CMSStatus: types.CMSOnline, AssetCount: 3},
+		{ID: "meeting", IPAddress: "192.168.1.21", Status: types.StatusHealthy, CMSStatus: types.CMSOnline},
+	})
+	now := time.Now().UTC()
+	store.PutPeer(hosts.Peer{NodeID: "scoreboard", PublicKey: "key", BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now, DiskPercent: 95})
+
+	if _, err := SaveRules(store, []Rule{
+		{ID: "offline", Enabled: true, Condition: ConditionOffline, ForMinutes: 5, Hosts: []string{"scoreboard"}, Channels: []string{"webhook"}},
+		{ID: "empty", Enabled: true, Condition: ConditionNoAssets, Channels: []string{"webhook"}},
+		{ID: "disk", Enabled: true, Condition: ConditionDiskUsage, Channels: []string{"webhook"}},
+		{ID: "off", Condition: ConditionCMSOffline, Channels: []string{"webhook"}},
+	}); err != nil {
+		t.Fatalf("SaveRules: %v", err)
+	}
+
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(now)
+	if len(events) != 2 {
+		t.Fatalf("expected no_assets and disk alerts, got %+v", events)
+	}
+	for _, ev := range events {
+		if ev.Status != StatusFiring || (ev.RuleID == "empty") != (ev.HostID == "meeting") {
+			t.Errorf("unexpected event %+v", ev)
+		}
+	}
+
+	// Checking again does not re-send.
+	engine.Check(now.Add(10 * time.Second))
+	if len(events) != 2 {
+		t.Fatalf("expected no new events, got %+v", events[2:])
+	}
+
+	// The scoreboard goes silent; it only alerts once five minutes have
+	// passed since its last heartbeat, and its disk alert resolves.
+	events = nil
+	engine.Check(now.Add(3 * time.Minute))
+	if len(events) != 1 || events[0].RuleID != "disk" || events[0].Status != StatusResolved {
+		t.Fatalf("expected the disk alert to resolve, got %+v", events)
+	}
+	engine.Check(now.Add(6 * time.Minute))
+	if len(events) != 2 || events[1].RuleID != "offline" || events[1].Status != StatusFiring {
+		t.Fatalf("expected the offline alert to fire, got %+v", events)
+	}
+
+	active, err := LoadAlerts(store)
+	if err != nil {
+		t.Fatalf("LoadAlerts: %v", err)
+	}
+	if len(active) != 2 || !active[0].Firing || active[0].Host == "" {
+		t.Errorf("unexpected active alerts: %+v", active)
+	}
+}
+
+func TestEvaluateContentExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionContentExpiry, Threshold: 3}
+	host := types.Host{Health: types.HealthOnline, CMSStatus: types.CMSOnline, AssetCount: 2}
+
+	tests := []struct {
+		name    string
+		end     time.Time
+		holds   bool
+		expired bool
+	}{
+		{"unknown", time.Time{}, false, false},
+		{"next week", now.Add(7 * 24 * time.Hour), false, false},
+		{"over the weekend", now.Add(2 * 24 * time.Hour), true, false},
+		{"already expired", now.Add(-time.Hour), true, true},
+	}
+	for _, tt := range tests {
+		host.ContentExpiresAt = tt.end
+		since, _, holds := evaluate(rule, host, hosts.Peer{}, false, reports{}, now)
+		if holds != tt.holds || !since.IsZero() != tt.expired {
+			t.Errorf("%s: got holds=%v since=%v", tt.name, holds, since)
+		}
+	}
+}
+
+func TestEvaluateTimeSync(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionTimeSync}
+	peer := hosts.Peer{BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+
+	tests := []struct {
+		name  string
+		state string
+		holds bool
+	}{
+		{"synced", types.TimeSyncSynced, false},
+		{"unsynced", types.TimeSyncUnsynced, true},
+		{"unknown", "", false},
+	}
+	for _, tt := range tests {
+		peer.TimeSync = tt.state
+		if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{}, now); holds != tt.holds {
+			t.Errorf("%s: got holds=%v", tt.name, holds)
+		}
+	}
+
+	// An offline host is reported by the offline rule instead.
+	peer.TimeSync = types.TimeSyncUnsynced
+	if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{}, now.Add(time.Hour)); holds {
+		t.Error("expected no time_sync alert for an offline host")
+	}
+}
+
+func TestEvaluateThrottled(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionThrottled}
+	peer := hosts.Peer{BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+
+	tests := []struct {
+		name  string
+		bits  *uint32
+		holds bool
+	}{
+		{"not a pi", nil, false},
+		{"fine", ptr(uint32(0)), false},
+		{"throttled earlier", ptr(uint32(0x50000)), false},
+		{"under-voltage", ptr(uint32(0x50005)), true},
+		{"hot", ptr(uint32(0x80008)), true},
+	}
+	for _, tt := range tests {
+		peer.Throttled = tt.bits
+		_, message, holds := evaluate(rule, types.Host{}, peer, true, reports{}, now)
+		if holds != tt.holds {
+			t.Errorf("%s: got holds=%v (%s)", tt.name, holds, message)
+		}
+	}
+
+	peer.Throttled = ptr(uint32(0x5))
+	if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{}, now.Add(time.Hour)); holds {
+		t.Error("expected no throttled alert for an offline host")
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestEvaluateCardWear(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionCardWear, Threshold: DefaultCardThreshold}
+	peer := hosts.Peer{BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+
+	tests := []struct {
+		name  string
+		card  *hosts.CardHealth
+		holds bool
+	}{
+		{"not reported", nil, false},
+		{"healthy", &hosts.CardHealth{LifeUsed: 30, PreEOL: hosts.PreEOLNormal}, false},
+		{"worn", &hosts.CardHealth{LifeUsed: 80}, true},
+		{"filesystem errors", &hosts.CardHealth{FSErrors: 4}, true},
+		{"read-only", &hosts.CardHealth{ReadOnly: true}, true},
+	}
+	for _, tt := range tests {
+		if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{card: tt.card}, now); holds != tt.holds {
+			t.Errorf("%s: got holds=%v", tt.name, holds)
+		}
+	}
+
+	if err := (&Rule{Name: "x", Condition: ConditionCardWear, Threshold: 120}).Validate(); err == nil {
+		t.Error("expected a threshold over 100 to be rejected")
+	}
+}
+
+func TestEvaluateWeakWiFi(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionWeakWiFi, Threshold: DefaultWiFiThreshold}
+	peer := hosts.Peer{BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+
+	sample := func(dbm int) hosts.WiFi {
+		return hosts.WiFi{SSID: "Lobby", BSSID: "aa:bb:cc:dd:ee:ff", Channel: 6, SignalDBM: dbm}
+	}
+	tests := []struct {
+		name    string
+		samples []hosts.WiFi
+		holds   bool
+	}{
+		{"ethernet", nil, false},
+		{"strong", []hosts.WiFi{sample(-55), sample(-58), sample(-60)}, false},
+		{"one dip", []hosts.WiFi{sample(-55), sample(-85), sample(-58)}, false},
+		{"weak", []hosts.WiFi{sample(-74), sample(-78), sample(-71)}, true},
+		{"too few samples", []hosts.WiFi{sample(-80)}, false},
+	}
+	for _, tt := range tests {
+		var r reports
+		if tt.samples != nil {
+			sum := hosts.SummarizeWiFi(tt.samples)
+			r.wifi = &sum
+		}
+		if _, message, holds := evaluate(rule, types.Host{}, peer, true, r, now); holds != tt.holds {
+			t.Errorf("%s: got holds=%v (%s)", tt.name, holds, message)
+		}
+	}
+
+	if err := (&Rule{Name: "x", Condition: ConditionWeakWiFi, Threshold: 70}).Validate(); err == nil {
+		t.Error("expected a positive threshold to be rejected")
+	}
+}
+
+func TestEvaluateViewerCrashLoop(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rule := Rule{Condition: ConditionViewerCrashLoop}
+	peer := hosts.Peer{BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+
+	if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{}, now); holds {
+		t.Error("expected no alert for a host without the watchdog")
+	}
+	ok := hosts.Viewer{State: hosts.ViewerOK, Process: "anthias-viewer", Restarts: 1, Window: 10}
+	if _, _, holds := evaluate(rule, types.Host{}, peer, true, reports{viewer: &ok}, now); holds {
+		t.Error("expected no alert for a viewer that restarted once")
+	}
+	looping := hosts.Viewer{State: hosts.ViewerCrashLoop, Process: "anthias-viewer", Restarts: 4, Window: 10,
+		Since: now.Add(-3 * time.Minute), Logs: "Starting viewer\nQt: failed to create EGL display", Fallback: true}
+	since, message, holds := evaluate(rule, types.Host{}, peer, true, reports{viewer: &looping}, now)
+	if !holds || !since.Equal(looping.Since) || !strings.Contains(message, "4 times in 10 minutes") ||
+		!strings.Contains(message, "fallback") || !strings.HasSuffix(message, "Last output: Qt: failed to create EGL display") {
+		t.Errorf("expected a crash loop alert with the last output, got %v, %v, %q", holds, since, message)
+	}
+}
+
+func TestRuleActiveHours(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2026, 3, 1, hour, 30, 0, 0, time.UTC) }
+	tests := []struct {
+		from, to, hour int
+		want           bool
+	}{
+		{0, 0, 3, true},
+		{9, 17, 8, false},
+		{9, 17, 9, true},
+		{9, 17, 17, false},
+		{22, 6, 23, true},
+		{22, 6, 5, true},
+		{22, 6, 12, false},
+	}
+	for _, tt := range tests {
+		if got := (Rule{ActiveFrom: tt.from, ActiveTo: tt.to}).ActiveAt(at(tt.hour)); got != tt.want {
+			t.Errorf("%d-%d at %d: got %v, want %v", tt.from, tt.to, tt.hour, got, tt.want)
+		}
+	}
+
+	// The window is on the host's clock: 11:00 UTC is 20:00 in Tokyo, so a
+	// 9-to-5 rule holds its alert until the next morning there.
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+	}))
+	defer srv.Close()
+	store.PutSetting(notify.WebhookSettingKey, notify.WebhookConfig{URL: srv.URL})
+	store.ReplaceAll([]types.Host{{ID: "tokyo", IPAddress: "192.168.1.30", Status: types.StatusHealthy, CMSStatus: types.CMSOnline, Timezone: "Asia/Tokyo"}})
+	SaveRules(store, []Rule{{ID: "empty", Enabled: true, Condition: ConditionNoAssets, ActiveFrom: 9, ActiveTo: 17, Channels: []string{"webhook"}}})
+
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(time.Date(2026, 3, 1, 11, 0, 0, 0, time.UTC))
+	if len(events) != 0 {
+		t.Fatalf("expected no alert outside the window, got %+v", events)
+	}
+	engine.Check(time.Date(2026, 3, 2, 1, 0, 0, 0, time.UTC))
+	if len(events) != 1 || events[0].HostID != "tokyo" {
+		t.Errorf("expected alert at 10:00 Tokyo time, got %+v", events)
+	}
+}
+
+func TestScriptRule(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+	}))
+	defer srv.Close()
+	store.PutSetting(notify.WebhookSettingKey, notify.WebhookConfig{URL: srv.URL})
+
+	bar := types.Host{ID: "bar", Nickname: "Bar", IPAddress: "192.168.1.30"}
+	store.ReplaceAll([]types.Host{bar})
+	if _, err := store.SaveSnapshot("Fallback", ""); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	store.ReplaceAll([]types.Host{
+		{ID: "l1", Nickname: "Lobby 1", IPAddress: "192.168.1.20"},
+		{ID: "l2", Nickname: "Lobby 2", IPAddress: "192.168.1.21"},
+		{ID: "l3", Nickname: "Lobby 3", IPAddress: "192.168.1.22"},
+		bar,
+	})
+	now := time.Now().UTC()
+	for _, id := range []string{"l1", "l2", "l3", "bar"} {
+		store.PutPeer(hosts.Peer{NodeID: id, PublicKey: "key", BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now})
+	}
+
+	lobby := `[h for h in hosts if h.health == "offline" and match(h.nickname, "lobby*")]`
+	rule := Rule{ID: "lobby", Enabled: true, Condition: ConditionScript, Preset: "Fallback", Channels: []string{"webhook"},
+		Script: "len(" + lobby + ") >= 3"}
+	if _, err := SaveRules(store, []Rule{rule}); err != nil {
+		t.Fatalf("SaveRules: %v", err)
+	}
+
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(now)
+	if len(events) != 0 {
+		t.Fatalf("expected no alert while the lobby is up, got %+v", events)
+	}
+
+	later := now.Add(10 * time.Minute)
+	rule.Script = `", ".join([h.name for h in ` + lobby + `])`
+	if holds, msg, err := TestScript(store, rule, later); err != nil || !holds || msg != "Lobby 1, Lobby 2, Lobby 3" {
+		t.Errorf("TestScript = %v, %q, %v", holds, msg, err)
+	}
+
+	// Every screen has gone silent; the rule fires once for the fleet and
+	// restores the fallback preset, after which it no longer holds.
+	engine.Check(later)
+	if len(events) != 1 || events[0].HostID != FleetHostID || events[0].Status != StatusFiring {
+		t.Fatalf("expected one fleet alert, got %+v", events)
+	}
+	if list := store.GetAll(); len(list) != 1 || list[0].ID != "bar" {
+		t.Errorf("expected the fallback preset restored, got %+v", list)
+	}
+	engine.Check(later.Add(time.Minute))
+	if len(events) != 2 || events[1].Status != StatusResolved {
+		t.Errorf("expected the alert to resolve, got %+v", events)
+	}
+}
+
+func TestEngineOpsgenie(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	store.PutSetting(notify.OpsgenieSettingKey, notify.OpsgenieConfig{APIKey: "key", URL: srv.URL})
+	SaveRules(store, []Rule{{ID: "offline", Enabled: true, Condition: ConditionOffline, Channels: []string{"opsgenie"}}})
+
+	store.ReplaceAll([]types.Host{{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable}})
+	now := time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC)
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(now)
+	list, _ := LoadAlerts(store)
+	if len(paths) != 1 || paths[0] != "/v2/alerts" || len(list) != 1 {
+		t.Fatalf("expected an Opsgenie alert opened, got %v", paths)
+	}
+
+	// The screen recovers, and the Opsgenie alert closes.
+	store.ReplaceAll([]types.Host{{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusHealthy}})
+	engine.Check(now.Add(time.Minute))
+	if len(paths) != 2 || paths[1] != "/v2/alerts/"+list[0].ID+"/close" {
+		t.Errorf("expected the Opsgenie alert closed, got %v", paths)
+	}
+}
@@ -0,0 +1,511 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// StateSettingKey holds the conditions currently matching, so a restart
+// neither re-sends alerts nor forgets how long a condition has held.
+const StateSettingKey = "alerts.state"
+
+// Alert is a rule matching one host.
+type Alert struct {
+	ID        string    `json:"id"` // Stays the same while the condition holds; acknowledgements refer to it
+	RuleID    string    `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	HostID    string    `json:"host_id"`
+	Host      string    `json:"host"` // Display name at the time of the last check
+	Condition string    `json:"condition"`
+	Message   string    `json:"message"`
+	Since     time.Time `json:"since"`  // When the condition started holding
+	Firing    bool      `json:"firing"` // Held for the rule's duration and was sent
+	FiredAt   time.Time `json:"fired_at,omitzero"`
+	Digest    bool      `json:"digest,omitempty"` // Fired in a quiet window and went to the digest instead
+
+	// Filled in from the alert's escalation when listed; not kept in state.
+	AckedBy   string    `json:"acked_by,omitempty"`
+	AckedAt   time.Time `json:"acked_at,omitzero"`
+	Escalated int       `json:"escalated,omitempty"` // Escalation steps notified so far
+}
+
+// Event is what channels receive when an alert fires, escalates or
+// resolves.
+type Event struct {
+	Status string `json:"status"`         // firing, escalated or resolved
+	Step   int    `json:"step,omitempty"` // For escalated: the policy step notified, from 1
+	Alert
+}
+
+// Event statuses.
+const (
+	StatusFiring    = "firing"
+	StatusEscalated = "escalated"
+	StatusResolved  = "resolved"
+)
+
+// LoadAlerts returns every condition currently matching, firing first.
+func LoadAlerts(store *hosts.Store) ([]Alert, error) {
+	state, err := loadState(store)
+	if err != nil {
+		return nil, err
+	}
+	open, err := store.OpenEscalations()
+	if err != nil {
+		return nil, err
+	}
+	escalations := make(map[string]hosts.Escalation, len(open))
+	for _, esc := range open {
+		escalations[esc.AlertID] = esc
+	}
+	out := make([]Alert, 0, len(state))
+	for _, a := range state {
+		if esc, ok := escalations[a.ID]; ok && a.ID != "" {
+			a.AckedBy, a.AckedAt, a.Escalated = esc.AckedBy, esc.AckedAt, esc.Step
+		}
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Firing != out[j].Firing {
+			return out[i].Firing
+		}
+		return out[i].Since.Before(out[j].Since)
+	})
+	return out, nil
+}
+
+func loadState(store hosts.SettingStore) (map[string]*Alert, error) {
+	state := make(map[string]*Alert)
+	if _, err := store.GetSetting(StateSettingKey, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Engine checks the rules against the host list on a fixed interval.
+type Engine struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+
+	scriptErrors map[string]string // Last error of each script rule, by rule ID, so each is logged once
+}
+
+// NewEngine creates an engine that checks the rules every 30 seconds.
+func NewEngine(store *hosts.Store, lg *logger.Logger) *Engine {
+	return &Engine{
+		store:        store,
+		logger:       lg,
+		interval:     30 * time.Second,
+		scriptErrors: make(map[string]string),
+	}
+}
+
+// Run checks the rules until the process exits.
+func (e *Engine) Run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		e.Check(time.Now().UTC())
+	}
+}
+
+// Check evaluates every rule once, sends alerts that have held long enough
+// and resolutions for those that stopped matching.
+func (e *Engine) Check(now time.Time) {
+	rules, err := LoadRules(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load rules: %v", err))
+		return
+	}
+	state, err := loadState(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load state: %v", err))
+		return
+	}
+
+	peers := make(map[string]hosts.Peer)
+	if list, err := e.store.ListPeers(); err == nil {
+		for _, p := range list {
+			peers[p.NodeID] = p
+		}
+	}
+
+	cards, err := e.store.LatestCardHealth()
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load card health: %v", err))
+	}
+	wifi, err := e.store.WiFiHistory(now.Add(-WiFiWindow))
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load Wi-Fi history: %v", err))
+	}
+	quiet, err := LoadQuiet(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load quiet hours: %v", err))
+	}
+
+	hostList := e.store.GetAll()
+	next := make(map[string]*Alert)
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Condition == ConditionScript {
+			e.checkScript(rule, hostList, peers, quiet, state, next, now)
+			continue
+		}
+		for _, host := range hostList {
+			if !rule.AppliesTo(host.ID) {
+				continue
+			}
+			key := rule.ID + "/" + host.ID
+			prev := state[key]
+
+			// Outside the rule's hours nothing new fires and nothing
+			// resolves; what was pending or firing carries over to when
+			// the window opens again.
+			if !rule.ActiveAt(host.InZone(now)) {
+				if prev != nil {
+					next[key] = prev
+				}
+				continue
+			}
+
+			peer, ok := peers[host.ID]
+			var r reports
+			if c, found := cards[host.ID]; found {
+				r.card = &c
+			}
+			if samples, found := wifi[host.ID]; found {
+				sum := hosts.SummarizeWiFi(samples)
+				r.wifi = &sum
+			}
+			if v, found := e.store.ViewerOf(host.ID, now); found {
+				r.viewer = &v
+			}
+			since, message, holds := evaluate(rule, host, peer, ok, r, now)
+			if !holds {
+				if prev != nil && prev.Firing {
+					e.resolve(rule, prev, now)
+				}
+				continue
+			}
+
+			next[key] = e.hold(rule, prev, &Alert{
+				RuleID:    rule.ID,
+				RuleName:  rule.Name,
+				HostID:    host.ID,
+				Host:      displayName(host),
+				Condition: rule.Condition,
+				Message:   message,
+				Since:     since,
+			}, quiet.ActionAt(host.ID, now, host.InZone(now)), now)
+		}
+	}
+	e.escalate(rules, next, now)
+	e.sendDigest(quiet, now)
+
+	// Conditions whose rule or host has gone are dropped without a
+	// resolution; there is nothing left to resolve against.
+	if err := e.store.PutSetting(StateSettingKey, next); err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to save state: %v", err))
+	}
+}
+
+// hold carries over what prev knew about a, a rule that holds at now, and
+// fires it once it has held for the rule's duration. quiet is what a quiet
+// window covering the alert does with it, if any: a suppressed alert waits
+// for the window to end, and one for the digest is held for it, then sent
+// if it still holds once the window ends.
+func (e *Engine) hold(rule Rule, prev, a *Alert, quiet string, now time.Time) *Alert {
+	if prev != nil {
+		a.ID, a.Firing, a.FiredAt, a.Digest = prev.ID, prev.Firing, prev.FiredAt, prev.Digest
+		if a.Since.IsZero() {
+			a.Since = prev.Since
+		}
+	}
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	if a.Since.IsZero() {
+		a.Since = now
+	}
+	if a.Digest && quiet == "" {
+		a.Digest = false
+		e.send(rule, Event{Status: StatusFiring, Alert: *a})
+		e.openEscalation(rule, *a, now)
+	}
+	if !a.Firing && quiet != QuietSuppress && now.Sub(a.Since) >= time.Duration(rule.ForMinutes)*time.Minute {
+		a.Firing, a.FiredAt = true, now
+		e.recordIncident(*a, hosts.IncidentAlertFired, now)
+		if quiet == QuietDigest {
+			a.Digest = true
+			e.holdForDigest(*a)
+		} else {
+			e.send(rule, Event{Status: StatusFiring, Alert: *a})
+			e.openEscalation(rule, *a, now)
+		}
+		if rule.Preset != "" {
+			e.restore(rule)
+		}
+	}
+	return a
+}
+
+// recordIncident adds a firing or resolving to its host's incident. Script
+// rules, which are about the fleet, have none.
+func (e *Engine) recordIncident(a Alert, kind string, now time.Time) {
+	if a.HostID == FleetHostID {
+		return
+	}
+	ev := hosts.IncidentEvent{At: now, Kind: kind, Detail: a.RuleName + ": " + a.Message}
+	if _, _, err := e.store.RecordIncidentEvent(a.HostID, a.RuleName+" on "+a.Host, ev); err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to record incident for %q on %s: %v", a.RuleName, a.Host, err))
+	}
+}
+
+// reports are what a host's heartbeats say about its hardware and links,
+// beyond its peer state. Each is nil if the host has not reported it.
+type reports struct {
+	card   *hosts.CardHealth  // Last card health sample
+	wifi   *hosts.WiFiSummary // Wi-Fi over the last WiFiWindow
+	viewer *hosts.Viewer      // What the host's watchdog last found of its viewer
+}
+
+// evaluate reports whether rule matches host at now. since is when the
+// condition began if the host's own data says so, and zero otherwise.
+func evaluate(rule Rule, host types.Host, peer hosts.Peer, hasPeer bool, r reports, now time.Time) (since time.Time, message string, holds bool) {
+	health := host.Health
+	if hasPeer {
+		health = types.DetermineHealth(peer.Liveness(), now, types.DefaultHealthThresholds())
+	}
+	// Maintenance silences every rule for the host.
+	if health == types.HealthMaintenance {
+		return time.Time{}, "", false
+	}
+	offline := health == types.HealthOffline
+
+	switch rule.Condition {
+	case ConditionOffline:
+		if !offline {
+			return time.Time{}, "", false
+		}
+		if hasPeer && !peer.LastSeen.IsZero() {
+			return peer.LastSeen, "Offline since last heartbeat at " + localTime(host, peer.LastSeen), true
+		}
+		return time.Time{}, "Offline", true
+	case ConditionNoAssets:
+		cms, assets := content(host)
+		return time.Time{}, "CMS is online but has no assets", !offline && cms == types.CMSOnline && assets == 0
+	case ConditionCMSOffline:
+		cms, _ := content(host)
+		return time.Time{}, "NSM is up but the Anthias CMS is offline", !offline && cms == types.CMSOffline
+	case ConditionContentExpiry:
+		cms, _ := content(host)
+		end := host.ContentExpiresAt
+		if offline || cms != types.CMSOnline || end.IsZero() || end.After(now.Add(time.Duration(rule.Threshold)*24*time.Hour)) {
+			return time.Time{}, "", false
+		}
+		if !end.After(now) {
+			return end, "All content expired at " + localTime(host, end) + "; the screen is blank", true
+		}
+		return time.Time{}, "Playlist runs empty at " + localTime(host, end), true
+	case ConditionDiskUsage:
+		if offline || !hasPeer || peer.DiskPercent < rule.Threshold {
+			return time.Time{}, "", false
+		}
+		return time.Time{}, fmt.Sprintf("Disk %d%% full (threshold %d%%)", peer.DiskPercent, rule.Threshold), true
+	case ConditionTimeSync:
+		// Hosts that report no state are not counted as unsynced.
+		return time.Time{}, "Clock is not synced to NTP", !offline && hasPeer && peer.TimeSync == types.TimeSyncUnsynced
+	case ConditionCardWear:
+		if offline || r.card == nil {
+			return time.Time{}, "", false
+		}
+		problems := r.card.Problems(rule.Threshold)
+		if len(problems) == 0 {
+			return time.Time{}, "", false
+		}
+		return time.Time{}, "Boot card failing or worn: " + strings.Join(problems, ", ") + "; replace it before it fails", true
+	case ConditionThrottled:
+		// Throttling does not stop playback, so without this rule it shows
+		// only as stuttering video.
+		if offline || !hasPeer || peer.Throttled == nil {
+			return time.Time{}, "", false
+		}
+		flags, _ := types.ThrottleFlags(*peer.Throttled)
+		if len(flags) == 0 {
+			return time.Time{}, "", false
+		}
+		return time.Time{}, "Pi is throttling (" + types.DescribeThrottle(flags) + "); video may stutter. Check the power supply and cooling", true
+	case ConditionWeakWiFi:
+		// A single bad reading is noise; the average over the window is
+		// what drops the link.
+		if offline || r.wifi == nil || r.wifi.Samples < minWiFiSamples || r.wifi.AvgSignalDBM > rule.Threshold {
+			return time.Time{}, "", false
+		}
+		w := r.wifi.Latest
+		return time.Time{}, fmt.Sprintf("Wi-Fi signal weak: %d dBm on average over the last hour (threshold %d dBm), on %q channel %d, %d reconnects",
+			r.wifi.AvgSignalDBM, rule.Threshold, w.SSID, w.Channel, r.wifi.Reconnects), true
+	case ConditionViewerCrashLoop:
+		// Only hosts with the watchdog enabled report their viewer.
+		if offline || r.viewer == nil || r.viewer.State != hosts.ViewerCrashLoop {
+			return time.Time{}, "", false
+		}
+		message := r.viewer.Summary() + "; the screen may be frozen or blank"
+		if r.viewer.Fallback {
+			message += " (showing the fallback image)"
+		}
+		if line := lastLine(r.viewer.Logs); line != "" {
+			message += ". Last output: " + line
+		}
+		return r.viewer.Since, message, true
+	}
+	return time.Time{}, "", false
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	return strings.TrimSpace(s[strings.LastIndex(s, "\n")+1:])
+}
+
+// localTime formats t on the host's clock, with its zone, for messages.
+func localTime(host types.Host, t time.Time) string {
+	return host.InZone(t).Format("2006-01-02 15:04 MST")
+}
+
+// content returns the CMS status and asset count seen over the path NSM
+// uses to reach host.
+func content(host types.Host) (types.AnthiasCMSStatus, int) {
+	if hosts.SelectPath(host).Network == hosts.NetworkVPN {
+		return host.CMSStatusVPN, host.AssetCountVPN
+	}
+	return host.CMSStatus, host.AssetCount
+}
+
+func displayName(h types.Host) string {
+	switch {
+	case h.Nickname != "":
+		return h.Nickname
+	case h.Hostname != "":
+		return h.Hostname
+	}
+	return h.IPAddress
+}
+
+// send delivers ev to each of the rule's channels.
+func (e *Engine) send(rule Rule, ev Event) {
+	e.notify(rule.Channels, rule.Recipients, ev)
+}
+
+// notify delivers ev to each of channels. Failures are logged and not
+// retried, so a broken channel cannot hold up the others.
+func (e *Engine) notify(channels, recipients []string, ev Event) {
+	subject := fmt.Sprintf("[NSM] %s: %s on %s", strings.ToUpper(ev.Status), ev.RuleName, ev.Host)
+	if ev.Step > 0 {
+		subject = fmt.Sprintf("[NSM] %s (step %d): %s on %s", strings.ToUpper(ev.Status), ev.Step, ev.RuleName, ev.Host)
+	}
+	for _, ch := range channels {
+		var err error
+		switch ch {
+		case ChannelEmail:
+			err = e.sendEmail(recipients, subject, ev)
+		case ChannelWebhook:
+			err = e.sendWebhook(ev)
+		case ChannelMQTT:
+			err = e.sendMQTT(ev)
+		case ChannelPagerDuty:
+			err = e.sendPagerDuty(subject, ev)
+		case ChannelOpsgenie:
+			err = e.sendOpsgenie(ev)
+		}
+		if err != nil {
+			e.logger.Error(fmt.Sprintf("Alerts: failed to send %q via %s: %v", subject, ch, err))
+		}
+	}
+	e.logger.Info(fmt.Sprintf("Alerts: %s", subject))
+}
+
+func (e *Engine) sendEmail(to []string, subject string, ev Event) error {
+	cfg, err := notify.LoadSMTP(e.store)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("%s\n\nRule: %s\nHost: %s (%s)\nSince: %s\n",
+		ev.Message, ev.RuleName, ev.Host, ev.HostID, ev.Since.Format(time.RFC1123))
+	return notify.NewMailer(cfg).Send(notify.Message{To: to, Subject: subject, Body: body})
+}
+
+func (e *Engine) sendWebhook(ev Event) error {
+	cfg, err := notify.LoadWebhook(e.store)
+	if err != nil {
+		return err
+	}
+	return notify.PostWebhook(cfg, ev)
+}
+
+func (e *Engine) sendMQTT(ev Event) error {
+	cfg, err := notify.LoadMQTT(e.store)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return notify.Publish(cfg, strings.TrimSuffix(cfg.Topic, "/")+"/alerts/"+ev.HostID, payload)
+}
+
+func (e *Engine) sendPagerDuty(summary string, ev Event) error {
+	cfg, err := notify.LoadPagerDuty(e.store)
+	if err != nil {
+		return err
+	}
+	action := notify.PagerDutyTrigger
+	if ev.Status == StatusResolved {
+		action = notify.PagerDutyResolve
+	}
+	return notify.SendPagerDuty(cfg, notify.PagerDutyEvent{Action: action, DedupKey: incidentKey(ev), HostID: ev.HostID, Summary: summary, Source: ev.Host, Details: ev})
+}
+
+func (e *Engine) sendOpsgenie(ev Event) error {
+	cfg, err := notify.LoadOpsgenie(e.store)
+	if err != nil {
+		return err
+	}
+	if ev.Status == StatusResolved {
+		return notify.CloseOpsgenieAlert(cfg, incidentKey(ev))
+	}
+	return notify.CreateOpsgenieAlert(cfg, notify.OpsgenieAlert{
+		Alias:       incidentKey(ev),
+		HostID:      ev.HostID,
+		Message:     fmt.Sprintf("%s on %s", ev.RuleName, ev.Host),
+		Description: ev.Message,
+		Details: map[string]string{
+			"status":    ev.Status,
+			"rule":      ev.RuleName,
+			"condition": ev.Condition,
+			"host_id":   ev.HostID,
+			"since":     ev.Since.Format(time.RFC3339),
+		},
+	})
+}
+
+// incidentKey identifies ev's alert in PagerDuty and Opsgenie, so an alert
+// is one incident however many steps notify it, and resolving closes it.
+func incidentKey(ev Event) string {
+	if ev.ID == "" {
+		return ev.RuleID + "/" + ev.HostID
+	}
+	return ev.ID
+}
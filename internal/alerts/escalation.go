@@ -0,0 +1,197 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// EscalationsSettingKey holds the escalation policies.
+const EscalationsSettingKey = "alerts.escalations"
+
+// Policy widens who hears of an alert nobody acknowledges: the rule's own
+// channels are notified when it fires, then each step's once the alert has
+// gone unacknowledged for the step's AfterMinutes.
+type Policy struct {
+	Name  string `json:"name"`
+	Steps []Step `json:"steps"`
+}
+
+// Step is one level of an escalation policy.
+type Step struct {
+	AfterMinutes int      `json:"after_minutes"` // Minutes after the alert was sent
+	Channels     []string `json:"channels"`
+	Recipients   []string `json:"recipients,omitempty"` // Addresses for the email channel
+}
+
+// Validate normalises p and rejects unusable values.
+func (p *Policy) Validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("a name is required")
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("at least one step is required")
+	}
+	after := 0
+	for i := range p.Steps {
+		s := &p.Steps[i]
+		if s.AfterMinutes <= after {
+			return fmt.Errorf("step %d: after_minutes must be more than the step before's (%d)", i+1, after)
+		}
+		after = s.AfterMinutes
+		if err := validateChannels(s.Channels, s.Recipients); err != nil {
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// LoadPolicies returns the escalation policies.
+func LoadPolicies(store hosts.SettingStore) ([]Policy, error) {
+	policies := []Policy{}
+	if _, err := store.GetSetting(EscalationsSettingKey, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+// SavePolicies validates and stores the full policy list, replacing the old
+// one. Policies that rules still use cannot be removed.
+func SavePolicies(store hosts.SettingStore, policies []Policy) ([]Policy, error) {
+	for i := range policies {
+		if err := policies[i].Validate(); err != nil {
+			return nil, fmt.Errorf("policy %d: %w", i+1, err)
+		}
+		if findPolicy(policies[:i], policies[i].Name) != nil {
+			return nil, fmt.Errorf("policy %d: duplicate name %q", i+1, policies[i].Name)
+		}
+	}
+	rules, err := LoadRules(store)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if r.Escalation != "" && findPolicy(policies, r.Escalation) == nil {
+			return nil, fmt.Errorf("policy %q is used by rule %q", r.Escalation, r.Name)
+		}
+	}
+	return policies, store.PutSetting(EscalationsSettingKey, policies)
+}
+
+func findPolicy(policies []Policy, name string) *Policy {
+	for i := range policies {
+		if policies[i].Name == name {
+			return &policies[i]
+		}
+	}
+	return nil
+}
+
+// openEscalation records that a has just been sent to the rule's channels,
+// so it can be acknowledged and, if the rule has a policy, escalated.
+func (e *Engine) openEscalation(rule Rule, a Alert, now time.Time) {
+	err := e.store.OpenEscalation(hosts.Escalation{AlertID: a.ID, RuleID: a.RuleID, HostID: a.HostID, Policy: rule.Escalation, SentAt: now})
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to record %q on %s for escalation: %v", a.RuleName, a.Host, err))
+	}
+}
+
+// escalate notifies the steps that firing alerts nobody has acknowledged
+// have become due for at now. Escalations whose alert is gone from firing,
+// with its rule or host, are closed without a resolution, and the alert no
+// longer holds the host's incident open.
+func (e *Engine) escalate(rules []Rule, firing map[string]*Alert, now time.Time) {
+	open, err := e.store.OpenEscalations()
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load escalations: %v", err))
+		return
+	}
+	if len(open) == 0 {
+		return
+	}
+	policies, err := LoadPolicies(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to load escalation policies: %v", err))
+		return
+	}
+	byID := make(map[string]*Alert, len(firing))
+	for _, a := range firing {
+		if a.Firing && a.ID != "" {
+			byID[a.ID] = a
+		}
+	}
+
+	for _, esc := range open {
+		a := byID[esc.AlertID]
+		if a == nil {
+			e.store.ResolveEscalation(esc.AlertID, now)
+			e.recordIncident(Alert{RuleID: esc.RuleID, RuleName: esc.RuleID, HostID: esc.HostID, Host: esc.HostID,
+				Message: "dropped with its rule or host"}, hosts.IncidentAlertResolved, now)
+			continue
+		}
+		if esc.Policy == "" || !esc.AckedAt.IsZero() {
+			continue
+		}
+		policy := findPolicy(policies, esc.Policy)
+		if policy == nil {
+			continue
+		}
+		step := esc.Step
+		for step < len(policy.Steps) && now.Sub(esc.SentAt) >= time.Duration(policy.Steps[step].AfterMinutes)*time.Minute {
+			s := policy.Steps[step]
+			step++
+			e.notify(s.Channels, s.Recipients, Event{Status: StatusEscalated, Step: step, Alert: *a})
+		}
+		if step != esc.Step {
+			if err := e.store.Escalate(esc.AlertID, step, now); err != nil {
+				e.logger.Warning(fmt.Sprintf("Alerts: failed to record escalation of %q on %s: %v", a.RuleName, a.Host, err))
+			}
+		}
+	}
+}
+
+// resolveEscalation closes the escalation of prev, which has stopped
+// holding, and returns the channels and recipients its steps notified, so
+// they hear of the resolution too.
+func (e *Engine) resolveEscalation(prev *Alert, now time.Time) (channels, recipients []string) {
+	if prev.ID == "" {
+		return nil, nil
+	}
+	esc, found, err := e.store.GetEscalation(prev.ID)
+	if err != nil || !found {
+		return nil, nil
+	}
+	if err := e.store.ResolveEscalation(prev.ID, now); err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to close escalation of %q on %s: %v", prev.RuleName, prev.Host, err))
+	}
+	if esc.Step == 0 {
+		return nil, nil
+	}
+	policies, err := LoadPolicies(e.store)
+	if err != nil {
+		return nil, nil
+	}
+	policy := findPolicy(policies, esc.Policy)
+	if policy == nil {
+		return nil, nil
+	}
+	for _, s := range policy.Steps[:min(esc.Step, len(policy.Steps))] {
+		channels = union(channels, s.Channels)
+		recipients = union(recipients, s.Recipients)
+	}
+	return channels, recipients
+}
+
+func union(a, b []string) []string {
+	for _, v := range b {
+		if !slices.Contains(a, v) {
+			a = append(a, v)
+		}
+	}
+	return a
+}
@@ -0,0 +1,147 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	p := Policy{Name: " On-call ", Steps: []Step{
+		{AfterMinutes: 30, Channels: []string{"Email"}, Recipients: []string{"Manager <manager@example.com>"}},
+		{AfterMinutes: 120, Channels: []string{"pagerduty"}},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if p.Name != "On-call" || p.Steps[0].Channels[0] != "email" || p.Steps[0].Recipients[0] != "manager@example.com" {
+		t.Errorf("not normalised: %+v", p)
+	}
+
+	for _, bad := range []Policy{
+		{Name: "none"},
+		{Steps: []Step{{AfterMinutes: 30, Channels: []string{"webhook"}}}},
+		{Name: "at once", Steps: []Step{{AfterMinutes: 0, Channels: []string{"webhook"}}}},
+		{Name: "backwards", Steps: []Step{{AfterMinutes: 60, Channels: []string{"webhook"}}, {AfterMinutes: 30, Channels: []string{"webhook"}}}},
+		{Name: "nowhere", Steps: []Step{{AfterMinutes: 30}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestEngineEscalation(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var events []Event
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+	}))
+	defer webhook.Close()
+	store.PutSetting(notify.WebhookSettingKey, notify.WebhookConfig{URL: webhook.URL})
+
+	type incident struct{ action, key string }
+	var incidents []incident
+	pd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev struct {
+			Action string `json:"event_action"`
+			Key    string `json:"dedup_key"`
+		}
+		json.NewDecoder(r.Body).Decode(&ev)
+		incidents = append(incidents, incident{ev.Action, ev.Key})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pd.Close()
+	store.PutSetting(notify.PagerDutySettingKey, notify.PagerDutyConfig{RoutingKey: "key", URL: pd.URL})
+
+	if _, err := SaveRules(store, []Rule{{ID: "offline", Enabled: true, Condition: ConditionOffline, Channels: []string{"webhook"}, Escalation: "on-call"}}); err == nil {
+		t.Fatal("expected a rule naming an unknown policy to be rejected")
+	}
+	if _, err := SavePolicies(store, []Policy{{Name: "on-call", Steps: []Step{
+		{AfterMinutes: 30, Channels: []string{"webhook"}},
+		{AfterMinutes: 120, Channels: []string{"pagerduty"}},
+	}}}); err != nil {
+		t.Fatalf("SavePolicies: %v", err)
+	}
+	if _, err := SaveRules(store, []Rule{{ID: "offline", Enabled: true, Condition: ConditionOffline, Channels: []string{"webhook"}, Escalation: "on-call"}}); err != nil {
+		t.Fatalf("SaveRules: %v", err)
+	}
+	if _, err := SavePolicies(store, []Policy{}); err == nil {
+		t.Error("expected removing a policy in use to be rejected")
+	}
+
+	store.ReplaceAll([]types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable},
+		{ID: "hall", IPAddress: "192.168.1.21", Status: types.StatusUnreachable},
+	})
+	now := time.Date(2026, 3, 3, 9, 0, 0, 0, time.UTC)
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(now)
+	if len(events) != 2 || events[0].ID == "" || events[0].ID == events[1].ID {
+		t.Fatalf("expected both alerts sent with their own IDs, got %+v", events)
+	}
+	ids := map[string]string{events[0].HostID: events[0].ID, events[1].HostID: events[1].ID}
+
+	// Someone takes the lobby; nobody answers for the hall.
+	if _, err := store.AckAlert(ids["lobby"], "alice", now.Add(10*time.Minute)); err != nil {
+		t.Fatalf("AckAlert: %v", err)
+	}
+	if _, err := store.AckAlert("unknown", "alice", now); err != hosts.ErrAlertNotFound {
+		t.Errorf("expected ErrAlertNotFound, got %v", err)
+	}
+
+	events = nil
+	engine.Check(now.Add(29 * time.Minute))
+	if len(events) != 0 {
+		t.Fatalf("expected nothing before the first step is due, got %+v", events)
+	}
+	engine.Check(now.Add(30 * time.Minute))
+	if len(events) != 1 || events[0].HostID != "hall" || events[0].Status != StatusEscalated || events[0].Step != 1 {
+		t.Fatalf("expected the hall escalated to step 1, got %+v", events)
+	}
+	engine.Check(now.Add(time.Hour))
+	if len(events) != 1 || len(incidents) != 0 {
+		t.Fatalf("expected no step sent twice, got %+v, %+v", events, incidents)
+	}
+	engine.Check(now.Add(2 * time.Hour))
+	if len(incidents) != 1 || incidents[0] != (incident{notify.PagerDutyTrigger, ids["hall"]}) {
+		t.Fatalf("expected a PagerDuty incident for the hall, got %+v", incidents)
+	}
+
+	list, _ := LoadAlerts(store)
+	for _, a := range list {
+		if a.HostID == "lobby" && (a.AckedBy != "alice" || a.Escalated != 0) || a.HostID == "hall" && (a.AckedBy != "" || a.Escalated != 2) {
+			t.Errorf("unexpected alert %+v", a)
+		}
+	}
+
+	// The hall comes back: every channel it reached hears, and the
+	// incident is resolved.
+	store.ReplaceAll([]types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable},
+		{ID: "hall", IPAddress: "192.168.1.21", Status: types.StatusHealthy},
+	})
+	events = nil
+	engine.Check(now.Add(3 * time.Hour))
+	if len(events) != 1 || events[0].Status != StatusResolved || len(incidents) != 2 || incidents[1] != (incident{notify.PagerDutyResolve, ids["hall"]}) {
+		t.Fatalf("expected the hall resolved once on the webhook and in PagerDuty, got %+v, %+v", events, incidents)
+	}
+	if _, err := store.AckAlert(ids["hall"], "bob", now.Add(3*time.Hour)); err != hosts.ErrAlertNotFound {
+		t.Errorf("expected a resolved alert not to be acknowledged, got %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// QuietSettingKey holds the quiet hours and maintenance windows.
+const QuietSettingKey = "alerts.quiet"
+
+// DigestSettingKey holds the alerts waiting for the next digest.
+const DigestSettingKey = "alerts.digest"
+
+// What a window does with alerts that fire in it.
+const (
+	QuietSuppress = "suppress" // Nothing is sent; an alert still holding when the window ends fires then
+	QuietDigest   = "digest"   // The alert goes in the next daily digest; if it still holds when the window ends, it is sent then
+)
+
+// DefaultDigestHour is when the digest is sent if no hour is set.
+const DefaultDigestHour = 8
+
+// Window keeps alerts for a site from paging anyone: every day or on some
+// days between two hours, or once between two times for planned work.
+type Window struct {
+	Name   string    `json:"name"`
+	Hosts  []string  `json:"hosts,omitempty"` // Host IDs of the site; empty covers every host and script rules
+	From   int       `json:"from"`            // Hour quiet hours start, on each host's clock (this node's for script rules)
+	To     int       `json:"to"`              // Hour they end; equal to From means all day
+	Days   []string  `json:"days,omitempty"`  // Days quiet hours start on, e.g. ["sat", "sun"]; empty is every day
+	Start  time.Time `json:"start,omitzero"`  // Start of a maintenance window, which replaces the hours and days
+	End    time.Time `json:"end,omitzero"`    // End of the maintenance window
+	Action string    `json:"action"`          // QuietSuppress or QuietDigest
+}
+
+// Covers reports whether the window holds for hostID at now, which is
+// local on the host's clock.
+func (w Window) Covers(hostID string, now, local time.Time) bool {
+	if len(w.Hosts) > 0 && !slices.Contains(w.Hosts, hostID) {
+		return false
+	}
+	if !w.Start.IsZero() {
+		return !now.Before(w.Start) && now.Before(w.End)
+	}
+	if !inHours(w.From, w.To, local.Hour()) {
+		return false
+	}
+	if len(w.Days) == 0 {
+		return true
+	}
+	// Hours past midnight belong to the day the window started.
+	started := local
+	if w.From > w.To && local.Hour() < w.To {
+		started = local.AddDate(0, 0, -1)
+	}
+	return slices.Contains(w.Days, types.DayName(started.Weekday()))
+}
+
+// Quiet is when alerts are held back, and where held alerts go.
+type Quiet struct {
+	Windows    []Window `json:"windows"`
+	DigestHour int      `json:"digest_hour"`                 // Hour on this node's clock the digest is emailed
+	Recipients []string `json:"digest_recipients,omitempty"` // Who gets the digest; needed when a window uses it
+}
+
+// ActionAt returns what the windows covering hostID at now do with an
+// alert that fires, or "" if none does. Suppressing wins over the digest.
+func (q Quiet) ActionAt(hostID string, now, local time.Time) string {
+	action := ""
+	for _, w := range q.Windows {
+		if !w.Covers(hostID, now, local) {
+			continue
+		}
+		if w.Action == QuietSuppress {
+			return QuietSuppress
+		}
+		action = w.Action
+	}
+	return action
+}
+
+// Validate normalises q and rejects unusable values.
+func (q *Quiet) Validate() error {
+	digest := false
+	for i := range q.Windows {
+		w := &q.Windows[i]
+		w.Name = strings.TrimSpace(w.Name)
+		if w.Name == "" {
+			return fmt.Errorf("window %d: a name is required", i+1)
+		}
+		w.Action = strings.ToLower(strings.TrimSpace(w.Action))
+		if w.Action == "" {
+			w.Action = QuietSuppress
+		}
+		if w.Action != QuietSuppress && w.Action != QuietDigest {
+			return fmt.Errorf("window %q: unknown action %q (use suppress or digest)", w.Name, w.Action)
+		}
+		digest = digest || w.Action == QuietDigest
+		if w.Start.IsZero() != w.End.IsZero() {
+			return fmt.Errorf("window %q: a maintenance window needs both start and end", w.Name)
+		}
+		if !w.Start.IsZero() {
+			if !w.End.After(w.Start) {
+				return fmt.Errorf("window %q: end must be after start", w.Name)
+			}
+			w.Start, w.End = w.Start.UTC(), w.End.UTC()
+			w.From, w.To, w.Days = 0, 0, nil
+			continue
+		}
+		if w.From < 0 || w.From > 23 || w.To < 0 || w.To > 23 {
+			return fmt.Errorf("window %q: from and to must be hours between 0 and 23", w.Name)
+		}
+		for j, d := range w.Days {
+			name, ok := types.ParseDay(d)
+			if !ok {
+				return fmt.Errorf("window %q: unknown day %q", w.Name, d)
+			}
+			w.Days[j] = name
+		}
+	}
+
+	if q.DigestHour < 0 || q.DigestHour > 23 {
+		return errors.New("digest_hour must be between 0 and 23")
+	}
+	if digest && len(q.Recipients) == 0 {
+		return errors.New("windows that use the digest need digest_recipients")
+	}
+	for i, rcpt := range q.Recipients {
+		addr, err := mail.ParseAddress(strings.TrimSpace(rcpt))
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", rcpt)
+		}
+		q.Recipients[i] = addr.Address
+	}
+	return nil
+}
+
+// LoadQuiet returns the quiet hours and maintenance windows.
+func LoadQuiet(store hosts.SettingStore) (Quiet, error) {
+	q := Quiet{Windows: []Window{}, DigestHour: DefaultDigestHour}
+	if _, err := store.GetSetting(QuietSettingKey, &q); err != nil {
+		return Quiet{}, err
+	}
+	return q, nil
+}
+
+// SaveQuiet validates and stores the quiet hours and maintenance windows.
+func SaveQuiet(store hosts.SettingStore, q Quiet) (Quiet, error) {
+	if q.Windows == nil {
+		q.Windows = []Window{}
+	}
+	if err := q.Validate(); err != nil {
+		return Quiet{}, err
+	}
+	return q, store.PutSetting(QuietSettingKey, q)
+}
+
+// Digest is the alerts that fired in quiet windows since the last digest.
+type Digest struct {
+	LastSent time.Time     `json:"last_sent,omitzero"`
+	Entries  []DigestEntry `json:"entries"`
+}
+
+// DigestEntry is an alert held for the digest.
+type DigestEntry struct {
+	Alert
+	ResolvedAt time.Time `json:"resolved_at,omitzero"` // Zero while it still holds
+}
+
+// LoadDigest returns the alerts waiting for the next digest.
+func LoadDigest(store hosts.SettingStore) (Digest, error) {
+	d := Digest{Entries: []DigestEntry{}}
+	if _, err := store.GetSetting(DigestSettingKey, &d); err != nil {
+		return Digest{}, err
+	}
+	return d, nil
+}
+
+// holdForDigest adds a, which has just fired in a digest window, to the
+// next digest.
+func (e *Engine) holdForDigest(a Alert) {
+	d, err := LoadDigest(e.store)
+	if err == nil {
+		d.Entries = append(d.Entries, DigestEntry{Alert: a})
+		err = e.store.PutSetting(DigestSettingKey, d)
+	}
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to hold %q on %s for the digest: %v", a.RuleName, a.Host, err))
+	}
+}
+
+// resolve reports that prev, a firing alert, has stopped holding at now:
+// to the rule's channels and any escalation steps notified, or in the
+// digest it went to.
+func (e *Engine) resolve(rule Rule, prev *Alert, now time.Time) {
+	e.recordIncident(*prev, hosts.IncidentAlertResolved, now)
+	if !prev.Digest {
+		channels, recipients := e.resolveEscalation(prev, now)
+		e.notify(union(slices.Clone(rule.Channels), channels), union(slices.Clone(rule.Recipients), recipients), Event{Status: StatusResolved, Alert: *prev})
+		return
+	}
+	d, err := LoadDigest(e.store)
+	if err != nil {
+		return
+	}
+	for i, entry := range d.Entries {
+		if entry.RuleID == prev.RuleID && entry.HostID == prev.HostID && entry.FiredAt.Equal(prev.FiredAt) {
+			d.Entries[i].ResolvedAt = now
+		}
+	}
+	e.store.PutSetting(DigestSettingKey, d)
+}
+
+// sendDigest emails the held alerts once a day, at the digest hour. A
+// digest that fails to send is kept for the next day's.
+func (e *Engine) sendDigest(q Quiet, now time.Time) {
+	local := now.Local()
+	if local.Hour() != q.DigestHour || len(q.Recipients) == 0 {
+		return
+	}
+	d, err := LoadDigest(e.store)
+	if err != nil || sameDay(d.LastSent.Local(), local) {
+		return
+	}
+	d.LastSent = now
+	if len(d.Entries) > 0 {
+		subject := fmt.Sprintf("[NSM] Digest: %d alerts in quiet hours", len(d.Entries))
+		if err := e.sendDigestEmail(q.Recipients, subject, d.Entries); err != nil {
+			e.logger.Error(fmt.Sprintf("Alerts: failed to send %q: %v", subject, err))
+		} else {
+			e.logger.Info("Alerts: " + subject)
+			d.Entries = []DigestEntry{}
+		}
+	}
+	if err := e.store.PutSetting(DigestSettingKey, d); err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to save digest: %v", err))
+	}
+}
+
+func (e *Engine) sendDigestEmail(to []string, subject string, entries []DigestEntry) error {
+	cfg, err := notify.LoadSMTP(e.store)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("These alerts fired during quiet hours or maintenance windows and were not sent at the time.\n\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "- %s on %s: %s\n  Fired %s", entry.RuleName, entry.Host, entry.Message, entry.FiredAt.Local().Format(time.RFC1123))
+		if entry.ResolvedAt.IsZero() {
+			b.WriteString(", still holding\n")
+		} else {
+			fmt.Fprintf(&b, ", resolved %s\n", entry.ResolvedAt.Local().Format(time.RFC1123))
+		}
+	}
+	return notify.NewMailer(cfg).Send(notify.Message{To: to, Subject: subject, Body: b.String()})
+}
+
+func inHours(from, to, hour int) bool {
+	switch {
+	case from == to:
+		return true
+	case from < to:
+		return hour >= from && hour < to
+	default:
+		return hour >= from || hour < to
+	}
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,149 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestWindowCovers(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 30, 0, 0, berlin) } // 2 March is a Monday
+	nights := Window{From: 22, To: 6, Hosts: []string{"lobby"}}
+	weekend := Window{From: 22, To: 6, Days: []string{"fri", "sat"}}
+	works := Window{Start: at(3, 9).UTC(), End: at(3, 12).UTC()}
+
+	tests := []struct {
+		name   string
+		window Window
+		host   string
+		local  time.Time
+		covers bool
+	}{
+		{"night", nights, "lobby", at(3, 2), true},
+		{"day", nights, "lobby", at(3, 9), false},
+		{"another site", nights, "hall", at(3, 2), false},
+		{"friday night", weekend, "hall", at(6, 23), true},
+		{"early saturday", weekend, "hall", at(7, 3), true},
+		{"early monday", weekend, "hall", at(9, 3), false},
+		{"during works", works, "hall", at(3, 10), true},
+		{"after works", works, "hall", at(3, 12), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.Covers(tt.host, tt.local.UTC(), tt.local); got != tt.covers {
+			t.Errorf("%s: got %v", tt.name, got)
+		}
+	}
+
+	q := Quiet{Windows: []Window{{Name: "a", Action: QuietDigest}, {Name: "b", Action: QuietSuppress, Hosts: []string{"lobby"}}}}
+	if got := q.ActionAt("lobby", at(3, 9), at(3, 9)); got != QuietSuppress {
+		t.Errorf("expected suppressing to win, got %q", got)
+	}
+	if got := q.ActionAt("hall", at(3, 9), at(3, 9)); got != QuietDigest {
+		t.Errorf("expected the digest, got %q", got)
+	}
+}
+
+func TestQuietValidate(t *testing.T) {
+	bad := []Quiet{
+		{Windows: []Window{{From: 22, To: 6}}},
+		{Windows: []Window{{Name: "x", From: 24}}},
+		{Windows: []Window{{Name: "x", Days: []string{"someday"}}}},
+		{Windows: []Window{{Name: "x", Action: "page"}}},
+		{Windows: []Window{{Name: "x", Start: time.Now()}}},
+		{Windows: []Window{{Name: "x", Action: QuietDigest}}},
+	}
+	for i, q := range bad {
+		if err := q.Validate(); err == nil {
+			t.Errorf("case %d: expected %+v to be rejected", i, q)
+		}
+	}
+	q := Quiet{Windows: []Window{{Name: "Weekends", Days: []string{" Saturday", "SUN"}}}, DigestHour: 8}
+	if err := q.Validate(); err != nil || q.Windows[0].Action != QuietSuppress || q.Windows[0].Days[0] != "sat" || q.Windows[0].Days[1] != "sun" {
+		t.Errorf("expected normalised days and suppress, got %+v, %v", q, err)
+	}
+}
+
+func TestEngineQuietHours(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var events []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		events = append(events, ev)
+	}))
+	defer srv.Close()
+	store.PutSetting(notify.WebhookSettingKey, notify.WebhookConfig{URL: srv.URL})
+
+	store.ReplaceAll([]types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable, Timezone: "Europe/Berlin"},
+		{ID: "hall", IPAddress: "192.168.1.21", Status: types.StatusUnreachable, Timezone: "Europe/Berlin"},
+	})
+	SaveRules(store, []Rule{{ID: "offline", Enabled: true, Condition: ConditionOffline, Channels: []string{"webhook"}}})
+
+	// 03:00 in Berlin: the lobby is powered down for the night, and the
+	// hall is under planned works, which go to the digest.
+	now := time.Date(2026, 3, 3, 2, 0, 0, 0, time.UTC)
+	if _, err := SaveQuiet(store, Quiet{Windows: []Window{
+		{Name: "Lobby nights", Hosts: []string{"lobby"}, From: 22, To: 6},
+		{Name: "Hall works", Hosts: []string{"hall"}, Start: now.Add(-time.Hour), End: now.Add(2 * time.Hour), Action: QuietDigest},
+	}, DigestHour: 8, Recipients: []string{"ops@example.com"}}); err != nil {
+		t.Fatalf("SaveQuiet: %v", err)
+	}
+
+	engine := NewEngine(store, logger.New(10))
+	engine.Check(now)
+	if len(events) != 0 {
+		t.Fatalf("expected nothing sent in quiet hours, got %+v", events)
+	}
+	d, _ := LoadDigest(store)
+	if len(d.Entries) != 1 || d.Entries[0].HostID != "hall" || !d.Entries[0].ResolvedAt.IsZero() {
+		t.Fatalf("expected the hall held for the digest, got %+v", d.Entries)
+	}
+
+	// The hall comes back during the works: the digest says so, and
+	// nothing is sent.
+	store.ReplaceAll([]types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable, Timezone: "Europe/Berlin"},
+		{ID: "hall", IPAddress: "192.168.1.21", Status: types.StatusHealthy, Timezone: "Europe/Berlin"},
+	})
+	engine.Check(now.Add(time.Hour))
+	if d, _ := LoadDigest(store); len(events) != 0 || len(d.Entries) != 1 || d.Entries[0].ResolvedAt.IsZero() {
+		t.Fatalf("expected the digest entry resolved and nothing sent, got %+v, %+v", d.Entries, events)
+	}
+
+	// The hall goes down again during the works. An alert held for the
+	// digest that still holds after its window is sent then.
+	store.ReplaceAll([]types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Status: types.StatusUnreachable, Timezone: "Europe/Berlin"},
+		{ID: "hall", IPAddress: "192.168.1.21", Status: types.StatusUnreachable, Timezone: "Europe/Berlin"},
+	})
+	engine.Check(now.Add(90 * time.Minute))
+	if len(events) != 0 {
+		t.Fatalf("expected nothing sent during the works, got %+v", events)
+	}
+	engine.Check(now.Add(150 * time.Minute))
+	if len(events) != 1 || events[0].HostID != "hall" || events[0].Status != StatusFiring || events[0].Digest {
+		t.Fatalf("expected the hall alert sent once the works end, got %+v", events)
+	}
+
+	// The lobby is still offline at 08:00, after its quiet hours.
+	events = nil
+	engine.Check(now.Add(5 * time.Hour))
+	if len(events) != 1 || events[0].HostID != "lobby" || events[0].Status != StatusFiring {
+		t.Errorf("expected the lobby alert once its quiet hours end, got %+v", events)
+	}
+}
@@ -0,0 +1,226 @@
+// Package alerts evaluates operator-defined rules against the host list and
+// notifies the configured channels when a rule starts or stops matching.
+// Rules and alert state are stored as settings, so they survive restarts
+// and are shared by the API and the background engine.
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/script"
+)
+
+// RulesSettingKey is the settings key holding the rule list.
+const RulesSettingKey = "alerts.rules"
+
+// Conditions a rule can watch for.
+const (
+	ConditionOffline         = "offline"           // No heartbeat, or failing health checks
+	ConditionNoAssets        = "no_assets"         // CMS online but the playlist is empty
+	ConditionCMSOffline      = "cms_offline"       // NSM answers but the Anthias CMS does not
+	ConditionDiskUsage       = "disk_usage"        // Root filesystem at or above Threshold percent
+	ConditionContentExpiry   = "content_expiry"    // Playlist runs empty within Threshold days
+	ConditionTimeSync        = "time_sync"         // Host reports its clock is not synced to NTP
+	ConditionCardWear        = "card_wear"         // SD card or eMMC shows errors, or Threshold percent of its rated life used
+	ConditionThrottled       = "throttled"         // Pi firmware reports under-voltage or is throttling for heat
+	ConditionWeakWiFi        = "weak_wifi"         // Wi-Fi signal averaged Threshold dBm or weaker over the last hour
+	ConditionViewerCrashLoop = "viewer_crash_loop" // The host's watchdog finds its viewer restarting again and again
+	ConditionScript          = "script"            // Script returns true or a message; judged once for the whole fleet
+)
+
+// Notification channels.
+const (
+	ChannelEmail     = "email"
+	ChannelWebhook   = "webhook"
+	ChannelMQTT      = "mqtt"
+	ChannelPagerDuty = "pagerduty" // Opens a PagerDuty incident, resolved with the alert
+	ChannelOpsgenie  = "opsgenie"  // Opens an Opsgenie alert, closed with the alert
+)
+
+var channelNames = []string{ChannelEmail, ChannelWebhook, ChannelMQTT, ChannelPagerDuty, ChannelOpsgenie}
+
+// Thresholds used by rules that do not set one.
+const (
+	DefaultDiskThreshold    = 90  // Percent
+	DefaultContentThreshold = 3   // Days
+	DefaultCardThreshold    = 80  // Percent of rated life
+	DefaultWiFiThreshold    = -70 // dBm
+)
+
+// WiFiWindow is how far back weak_wifi averages the signal, so a rule
+// matches a chronically weak link rather than a passing dip.
+const WiFiWindow = time.Hour
+
+// minWiFiSamples is how many connected samples the window needs before
+// weak_wifi judges it. Unchanged links are sampled every 5 minutes.
+const minWiFiSamples = 3
+
+// Rule raises an alert for every host in scope once Condition has held for
+// ForMinutes. A script rule raises a single alert for the fleet instead.
+type Rule struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Enabled    bool     `json:"enabled"`
+	Condition  string   `json:"condition"`
+	Threshold  int      `json:"threshold,omitempty"`   // Percent for disk_usage and card_wear, days for content_expiry, dBm for weak_wifi
+	ForMinutes int      `json:"for_minutes"`           // How long the condition must hold before alerting
+	Hosts      []string `json:"hosts,omitempty"`       // Host IDs; empty applies the rule to every host
+	Channels   []string `json:"channels"`              // email, webhook, mqtt, pagerduty and/or opsgenie
+	Recipients []string `json:"recipients,omitempty"`  // Addresses for the email channel
+	ActiveFrom int      `json:"active_from,omitempty"` // Hour the rule starts alerting, on each host's clock (this node's for script)
+	ActiveTo   int      `json:"active_to,omitempty"`   // Hour it stops; equal to ActiveFrom means all day
+	Script     string   `json:"script,omitempty"`      // For script: Starlark script over the hosts in scope (see package script)
+	Preset     string   `json:"preset,omitempty"`      // For script: preset restored when the alert fires
+	Escalation string   `json:"escalation,omitempty"`  // Escalation policy notified while nobody acknowledges the alert
+}
+
+// ActiveAt reports whether the rule may alert at local, a time on the
+// host's own clock. Windows may wrap past midnight, e.g. 22 to 6.
+func (r Rule) ActiveAt(local time.Time) bool {
+	return inHours(r.ActiveFrom, r.ActiveTo, local.Hour())
+}
+
+// AppliesTo reports whether hostID is in the rule's scope.
+func (r Rule) AppliesTo(hostID string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	for _, id := range r.Hosts {
+		if id == hostID {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate normalises r and rejects unusable values. Rules without an ID
+// are given one.
+func (r *Rule) Validate() error {
+	r.Condition = strings.ToLower(strings.TrimSpace(r.Condition))
+	switch r.Condition {
+	case ConditionOffline, ConditionNoAssets, ConditionCMSOffline, ConditionTimeSync, ConditionThrottled, ConditionViewerCrashLoop:
+		r.Threshold = 0
+	case ConditionDiskUsage:
+		if r.Threshold == 0 {
+			r.Threshold = DefaultDiskThreshold
+		}
+		if r.Threshold < 1 || r.Threshold > 100 {
+			return errors.New("disk_usage threshold must be between 1 and 100")
+		}
+	case ConditionCardWear:
+		if r.Threshold == 0 {
+			r.Threshold = DefaultCardThreshold
+		}
+		if r.Threshold < 1 || r.Threshold > 100 {
+			return errors.New("card_wear threshold must be between 1 and 100")
+		}
+	case ConditionWeakWiFi:
+		if r.Threshold == 0 {
+			r.Threshold = DefaultWiFiThreshold
+		}
+		if r.Threshold < -100 || r.Threshold > -30 {
+			return errors.New("weak_wifi threshold must be between -100 and -30 dBm")
+		}
+	case ConditionContentExpiry:
+		if r.Threshold == 0 {
+			r.Threshold = DefaultContentThreshold
+		}
+		if r.Threshold < 1 || r.Threshold > 365 {
+			return errors.New("content_expiry threshold must be between 1 and 365 days")
+		}
+	case ConditionScript:
+		r.Threshold = 0
+		if _, err := script.Compile(r.Script, script.FleetNames...); err != nil {
+			return fmt.Errorf("script: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown condition %q (use offline, no_assets, cms_offline, disk_usage, content_expiry, time_sync, card_wear, throttled, weak_wifi, viewer_crash_loop or script)", r.Condition)
+	}
+	if r.Condition != ConditionScript {
+		r.Script = ""
+		if r.Preset != "" {
+			return errors.New("only script rules can restore a preset")
+		}
+	}
+	if r.ForMinutes < 0 {
+		return errors.New("for_minutes cannot be negative")
+	}
+	if r.ActiveFrom < 0 || r.ActiveFrom > 23 || r.ActiveTo < 0 || r.ActiveTo > 23 {
+		return errors.New("active_from and active_to must be hours between 0 and 23")
+	}
+
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		r.Name = r.Condition
+	}
+	if r.ID == "" {
+		r.ID = uuid.New().String()
+	}
+
+	r.Escalation = strings.TrimSpace(r.Escalation)
+	return validateChannels(r.Channels, r.Recipients)
+}
+
+// validateChannels normalises channels and the email recipients, and
+// rejects unknown or incomplete ones.
+func validateChannels(channels, recipients []string) error {
+	if len(channels) == 0 {
+		return errors.New("at least one channel is required")
+	}
+	for i, c := range channels {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if !slices.Contains(channelNames, c) {
+			return fmt.Errorf("unknown channel %q (use email, webhook, mqtt, pagerduty or opsgenie)", c)
+		}
+		channels[i] = c
+		if c == ChannelEmail && len(recipients) == 0 {
+			return errors.New("the email channel needs at least one recipient")
+		}
+	}
+	for i, rcpt := range recipients {
+		addr, err := mail.ParseAddress(strings.TrimSpace(rcpt))
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", rcpt)
+		}
+		recipients[i] = addr.Address
+	}
+	return nil
+}
+
+// LoadRules returns the configured rules.
+func LoadRules(store hosts.SettingStore) ([]Rule, error) {
+	rules := []Rule{}
+	if _, err := store.GetSetting(RulesSettingKey, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// SaveRules validates and stores the full rule list, replacing the old one.
+func SaveRules(store hosts.SettingStore, rules []Rule) ([]Rule, error) {
+	policies, err := LoadPolicies(store)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if p := rules[i].Escalation; p != "" && findPolicy(policies, p) == nil {
+			return nil, fmt.Errorf("rule %d: unknown escalation policy %q", i+1, p)
+		}
+		if seen[rules[i].ID] {
+			return nil, fmt.Errorf("rule %d: duplicate id %q", i+1, rules[i].ID)
+		}
+		seen[rules[i].ID] = true
+	}
+	return rules, store.PutSetting(RulesSettingKey, rules)
+}
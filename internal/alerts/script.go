@@ -0,0 +1,105 @@
+package alerts
+
+import (
+	"fmt"
+	"time"
+
+	"nexsign.mini/nsm/internal/hooks"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/script"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// FleetHostID is the host ID of alerts raised by script rules, which
+// judge the fleet as a whole.
+const FleetHostID = "fleet"
+
+// AuditPresetRestored is the audit action recorded when a firing script
+// rule restores its preset.
+const AuditPresetRestored = "alerts.preset_restored"
+
+// TestScript runs rule's script against the fleet as it is at now, so a
+// script can be tried before it is saved.
+func TestScript(store *hosts.Store, rule Rule, now time.Time) (holds bool, message string, err error) {
+	peers := make(map[string]hosts.Peer)
+	if list, err := store.ListPeers(); err == nil {
+		for _, p := range list {
+			peers[p.NodeID] = p
+		}
+	}
+	return runScript(rule, store.GetAll(), peers, now)
+}
+
+func runScript(rule Rule, hostList []types.Host, peers map[string]hosts.Peer, now time.Time) (bool, string, error) {
+	prog, err := script.Compile(rule.Script, script.FleetNames...)
+	if err != nil {
+		return false, "", err
+	}
+	var scoped []types.Host
+	for _, host := range hostList {
+		if rule.AppliesTo(host.ID) {
+			scoped = append(scoped, host)
+		}
+	}
+	return prog.Result(script.Fleet(scoped, peers, now))
+}
+
+// checkScript judges a script rule once for the whole fleet and records
+// its alert in next. A script that fails keeps its alert as it was, so a
+// bad script neither fires nor resolves anything.
+func (e *Engine) checkScript(rule Rule, hostList []types.Host, peers map[string]hosts.Peer, quiet Quiet, state, next map[string]*Alert, now time.Time) {
+	key := rule.ID + "/" + FleetHostID
+	prev := state[key]
+	if !rule.ActiveAt(now.Local()) {
+		if prev != nil {
+			next[key] = prev
+		}
+		return
+	}
+
+	holds, message, err := runScript(rule, hostList, peers, now)
+	if err != nil {
+		if e.scriptErrors[rule.ID] != err.Error() {
+			e.logger.Warning(fmt.Sprintf("Alerts: script of rule %q failed: %v", rule.Name, err))
+		}
+		e.scriptErrors[rule.ID] = err.Error()
+		if prev != nil {
+			next[key] = prev
+		}
+		return
+	}
+	delete(e.scriptErrors, rule.ID)
+
+	if !holds {
+		if prev != nil && prev.Firing {
+			e.resolve(rule, prev, now)
+		}
+		return
+	}
+	if message == "" {
+		message = "Script matched"
+	}
+	next[key] = e.hold(rule, prev, &Alert{
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		HostID:    FleetHostID,
+		Host:      FleetHostID,
+		Condition: rule.Condition,
+		Message:   message,
+	}, quiet.ActionAt(FleetHostID, now, now.Local()), now)
+}
+
+// restore restores the preset of a rule that has just fired.
+func (e *Engine) restore(rule Rule) {
+	snap, err := e.store.RestoreSnapshot(rule.Preset)
+	if err != nil {
+		e.logger.Error(fmt.Sprintf("Alerts: rule %q failed to restore preset %q: %v", rule.Name, rule.Preset, err))
+		return
+	}
+	e.logger.Info(fmt.Sprintf("Alerts: rule %q restored preset %q (%d hosts)", rule.Name, snap.Name, snap.HostCount))
+	if err := e.store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem, Action: AuditPresetRestored,
+		Target: snap.Name, Detail: "rule " + rule.Name}); err != nil {
+		e.logger.Warning(fmt.Sprintf("Alerts: failed to write audit entry: %v", err))
+	}
+	hooks.Fire(e.store, e.logger, hooks.Event{Event: hooks.EventPresetApplied, Preset: snap.Name, Source: "alert:" + rule.Name})
+}
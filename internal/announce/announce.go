@@ -0,0 +1,227 @@
+// Package announce signs and checks host announcements, which nodes send
+// each other when a host is added or edited. An announcement is signed by
+// the sending node's key, like a heartbeat. Announcements from nodes whose
+// key is not pinned yet are quarantined for an admin to approve, and no
+// sender may change the identity of a node other than itself.
+package announce
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"time"
+
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Path is the endpoint announcements are posted to.
+const Path = "/api/hosts/announce"
+
+// MaxSkew is how far an announcement's send time may be from the
+// receiver's clock.
+const MaxSkew = 5 * time.Minute
+
+// AuditQuarantined is the audit action recorded when an announcement is
+// held for approval.
+const AuditQuarantined = "host.announce_quarantined"
+
+var (
+	ErrBadSignature   = errors.New("announcement signature is invalid")
+	ErrKeyMismatch    = errors.New("announcement signed by a different key than the one pinned for the sender")
+	ErrClockSkew      = errors.New("announcement send time is too far from this node's clock")
+	ErrIdentityChange = errors.New("announcement changes the identity of another node")
+	ErrQuarantined    = errors.New("announcement quarantined pending approval")
+)
+
+// Announcement is the signed content of an announcement.
+type Announcement struct {
+	SenderID  string     `json:"sender_id"`
+	PublicKey string     `json:"public_key"` // Base64 Ed25519 key that signed the envelope
+	SentAt    time.Time  `json:"sent_at"`
+	Host      types.Host `json:"host"`
+}
+
+// Envelope carries an announcement and the signature over its exact bytes.
+type Envelope struct {
+	Announcement json.RawMessage `json:"announcement"`
+	Signature    string          `json:"signature"`
+}
+
+// Seal encodes and signs an announcement of host from senderID.
+func Seal(senderID string, host types.Host, id *identity.Identity) ([]byte, error) {
+	raw, err := json.Marshal(Announcement{
+		SenderID:  senderID,
+		PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey()),
+		SentAt:    time.Now().UTC(),
+		Host:      host,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Announcement: raw,
+		Signature:    base64.StdEncoding.EncodeToString(id.Sign(raw)),
+	})
+}
+
+// Open decodes an envelope and checks that it was signed by the key it
+// names. A bare host, as sent by nodes before announcements were signed,
+// is returned with an empty SenderID and no error.
+func Open(data []byte) (Announcement, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Announcement{}, fmt.Errorf("decode announcement: %w", err)
+	}
+	if env.Announcement == nil {
+		var host types.Host
+		if err := json.Unmarshal(data, &host); err != nil {
+			return Announcement{}, fmt.Errorf("decode announcement: %w", err)
+		}
+		return Announcement{Host: host}, nil
+	}
+
+	var a Announcement
+	if err := json.Unmarshal(env.Announcement, &a); err != nil {
+		return Announcement{}, fmt.Errorf("decode announcement: %w", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(a.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Announcement{}, ErrBadSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || !ed25519.Verify(pub, env.Announcement, sig) {
+		return Announcement{}, ErrBadSignature
+	}
+	if a.SenderID == "" {
+		return Announcement{}, errors.New("announcement has no sender ID")
+	}
+	return a, nil
+}
+
+// idPattern matches host IDs: UUIDs, and the names older nodes used.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,63}$`)
+
+// Limits on free-text fields, well above anything typed in the dashboard.
+const (
+	maxNicknameLen = 128
+	maxNotesLen    = 4096
+)
+
+// Validate checks that an announced host is well formed.
+func Validate(h types.Host) error {
+	switch {
+	case !idPattern.MatchString(h.ID):
+		return fmt.Errorf("invalid host ID %q", h.ID)
+	case !hosts.ValidAddress(h.IPAddress):
+		return fmt.Errorf("invalid IP address %q", h.IPAddress)
+	case h.VPNIPAddress != "" && !hosts.ValidAddress(h.VPNIPAddress):
+		return fmt.Errorf("invalid VPN address %q", h.VPNIPAddress)
+	case h.Hostname != "" && !hosts.ValidAddress(h.Hostname):
+		return fmt.Errorf("invalid hostname %q", h.Hostname)
+	case len(h.Nickname) > maxNicknameLen:
+		return errors.New("nickname is too long")
+	case len(h.Notes) > maxNotesLen:
+		return errors.New("notes are too long")
+	case !hosts.ValidPathPreference(h.PathPreference):
+		return fmt.Errorf("invalid path preference %q", h.PathPreference)
+	case !cms.Valid(h.CMS):
+		return fmt.Errorf("unknown CMS %q", h.CMS)
+	}
+	for _, u := range []string{h.DashboardURL, h.DashboardURLVPN} {
+		if u == "" {
+			continue
+		}
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid dashboard URL %q", u)
+		}
+	}
+	return nil
+}
+
+// Accept checks an announcement received from remoteAddr and returns it
+// for the caller to apply. It must be well formed, and may only change
+// the address or hostname of a node that sends heartbeats if that node
+// sent it. Announcements that are unsigned or from a sender whose key is
+// not pinned by a heartbeat are quarantined, and ErrQuarantined returned.
+func Accept(store *hosts.Store, data []byte, remoteAddr string, now time.Time) (Announcement, error) {
+	a, err := Open(data)
+	if err != nil {
+		return Announcement{}, err
+	}
+	if err := Validate(a.Host); err != nil {
+		return Announcement{}, err
+	}
+
+	hold := func(reason string) (Announcement, error) {
+		q := hosts.Quarantined{SenderID: a.SenderID, SenderKey: a.PublicKey, RemoteAddr: remoteAddr,
+			Reason: reason, Host: a.Host, ReceivedAt: now}
+		if err := Quarantine(store, q); err != nil {
+			return Announcement{}, err
+		}
+		return a, ErrQuarantined
+	}
+
+	if a.SenderID == "" {
+		return hold("unsigned")
+	}
+	if skew := now.Sub(a.SentAt); skew > MaxSkew || skew < -MaxSkew {
+		return Announcement{}, ErrClockSkew
+	}
+	sender, err := store.GetPeer(a.SenderID)
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		return hold("unknown sender")
+	case err != nil:
+		return Announcement{}, err
+	case sender.PublicKey != a.PublicKey:
+		return Announcement{}, ErrKeyMismatch
+	}
+
+	if err := CheckIdentity(store, a.SenderID, a.Host); err != nil {
+		return Announcement{}, err
+	}
+	return a, nil
+}
+
+// Quarantine holds q for an admin to approve and writes it to the audit
+// log. RemoteAddr may carry a port, which is dropped.
+func Quarantine(store *hosts.Store, q hosts.Quarantined) error {
+	if host, _, err := net.SplitHostPort(q.RemoteAddr); err == nil {
+		q.RemoteAddr = host
+	}
+	if err := store.Quarantine(q); err != nil {
+		return err
+	}
+	store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem, Action: AuditQuarantined,
+		Target: q.Host.ID, Detail: fmt.Sprintf("%s from %s", q.Reason, q.RemoteAddr), RemoteAddr: q.RemoteAddr})
+	return nil
+}
+
+// CheckIdentity returns ErrIdentityChange if host is a node that sends
+// heartbeats, senderID is another node, and host changes its address or
+// hostname. Only a node itself knows where it is and what it is called.
+func CheckIdentity(store *hosts.Store, senderID string, host types.Host) error {
+	if host.ID == senderID {
+		return nil
+	}
+	existing, err := store.GetByID(host.ID)
+	if err != nil {
+		return nil // A new host; there is no identity to change
+	}
+	if _, err := store.GetPeer(host.ID); err != nil {
+		return nil // Not a node, so its record is the operators' to edit
+	}
+	if host.IPAddress != existing.IPAddress || host.Hostname != existing.Hostname {
+		return fmt.Errorf("%w: %s would change from %s (%s) to %s (%s)", ErrIdentityChange,
+			host.ID, existing.IPAddress, existing.Hostname, host.IPAddress, host.Hostname)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package announce
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newIdentity(t *testing.T) *identity.Identity {
+	t.Helper()
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	return id
+}
+
+func TestAccept(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	sender, other := newIdentity(t), newIdentity(t)
+	now := time.Now().UTC()
+	store.ReplaceAll([]types.Host{
+		{ID: "node-a", IPAddress: "192.168.1.20", Hostname: "lobby-pi"},
+		{ID: "node-b", IPAddress: "192.168.1.30", Hostname: "bar-pi"},
+		{ID: "tv-1", IPAddress: "192.168.1.40"},
+	})
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(sender.PublicKey()), LastSeen: now})
+	store.PutPeer(hosts.Peer{NodeID: "node-b", PublicKey: base64.StdEncoding.EncodeToString(other.PublicKey()), LastSeen: now})
+
+	seal := func(senderID string, h types.Host, id *identity.Identity) []byte {
+		data, err := Seal(senderID, h, id)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		return data
+	}
+
+	// A node may announce its own move, and edits to hosts that are not nodes.
+	for _, h := range []types.Host{
+		{ID: "node-a", IPAddress: "192.168.1.21", Hostname: "lobby-pi"},
+		{ID: "tv-1", IPAddress: "192.168.1.41", Nickname: "Foyer TV"},
+	} {
+		if _, err := Accept(store, seal("node-a", h, sender), "192.168.1.20:5000", now); err != nil {
+			t.Errorf("Accept(%s): %v", h.ID, err)
+		}
+	}
+
+	legacy, _ := json.Marshal(types.Host{ID: "tv-2", IPAddress: "192.168.1.50"})
+	tampered := map[string]json.RawMessage{}
+	json.Unmarshal(seal("node-a", types.Host{ID: "tv-1", IPAddress: "192.168.1.41"}, sender), &tampered)
+	tampered["announcement"] = json.RawMessage(`{"sender_id":"node-b",` + string(tampered["announcement"])[1:])
+	forged, _ := json.Marshal(tampered)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"another node's address", seal("node-a", types.Host{ID: "node-b", IPAddress: "192.168.1.99", Hostname: "bar-pi"}, sender), ErrIdentityChange},
+		{"another node's hostname", seal("node-a", types.Host{ID: "node-b", IPAddress: "192.168.1.30", Hostname: "evil"}, sender), ErrIdentityChange},
+		{"tampered", forged, ErrBadSignature},
+		{"other key", seal("node-a", types.Host{ID: "tv-1", IPAddress: "192.168.1.41"}, other), ErrKeyMismatch},
+		{"unknown sender", seal("node-z", types.Host{ID: "tv-3", IPAddress: "192.168.1.60"}, newIdentity(t)), ErrQuarantined},
+		{"unsigned", legacy, ErrQuarantined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Accept(store, tt.data, "192.168.1.77:5000", now); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := Accept(store, seal("node-a", types.Host{ID: "tv-1", IPAddress: "not an address!"}, sender), "192.168.1.20:5000", now); err == nil {
+		t.Error("expected an invalid host to be rejected")
+	}
+
+	held, err := store.ListQuarantine()
+	if err != nil {
+		t.Fatalf("ListQuarantine: %v", err)
+	}
+	if len(held) != 2 || held[0].Reason != "unsigned" || held[1].SenderID != "node-z" || held[1].RemoteAddr != "192.168.1.77" {
+		t.Errorf("unexpected quarantine %+v", held)
+	}
+	if h, _ := store.GetByID("tv-2"); h != nil {
+		t.Error("a quarantined host was added")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := types.Host{ID: "3f2b9c1e-5d4a-4c3b-9a8f-7e6d5c4b3a21", IPAddress: "display-3.lan", DashboardURL: "http://display-3.lan:8080"}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	for name, h := range map[string]types.Host{
+		"no ID":         {IPAddress: "192.168.1.20"},
+		"bad ID":        {ID: "<script>", IPAddress: "192.168.1.20"},
+		"bad VPN":       {ID: "a", IPAddress: "192.168.1.20", VPNIPAddress: "100.64.0.300"},
+		"bad path":      {ID: "a", IPAddress: "192.168.1.20", PathPreference: "carrier-pigeon"},
+		"script URL":    {ID: "a", IPAddress: "192.168.1.20", DashboardURL: "javascript:alert(1)"},
+		"long nickname": {ID: "a", IPAddress: "192.168.1.20", Nickname: string(make([]byte, maxNicknameLen+1))},
+	} {
+		if err := Validate(h); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// FuzzOpen feeds Open and Validate what a compromised or broken peer might
+// send. Neither may panic, a signed announcement must verify, and a host
+// that passes Validate must be safe to store and link to.
+func FuzzOpen(f *testing.F) {
+	id, err := identity.Generate()
+	if err != nil {
+		f.Fatalf("Generate: %v", err)
+	}
+	valid, err := Seal("node-a", types.Host{ID: "tv-1", IPAddress: "192.168.1.40", Nickname: "Lobby"}, id)
+	if err != nil {
+		f.Fatalf("Seal: %v", err)
+	}
+	f.Add(valid)
+	for _, seed := range []string{``, `null`, `[]`, `{}`, `{"announcement": null}`,
+		`{"id": "tv-1", "ip_address": "192.168.1.40", "dashboard_url": "javascript:alert(1)"}`,
+		`{"id": "tv-1", "ip_address": "192.168.1.40", "versions": {"vector": {"a": -1}}}`,
+		`{"announcement": {"sender_id": "node-a", "public_key": "AAAA"}, "signature": "AAAA"}`} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		a, err := Open(data)
+		if err != nil {
+			return
+		}
+		if a.SenderID != "" {
+			var env Envelope
+			json.Unmarshal(data, &env)
+			pub, _ := base64.StdEncoding.DecodeString(a.PublicKey)
+			sig, _ := base64.StdEncoding.DecodeString(env.Signature)
+			if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, env.Announcement, sig) {
+				t.Errorf("Open accepted an announcement without a valid signature: %s", data)
+			}
+		}
+		if Validate(a.Host) != nil {
+			return
+		}
+		h := a.Host
+		if !idPattern.MatchString(h.ID) || !hosts.ValidAddress(h.IPAddress) || len(h.Notes) > maxNotesLen {
+			t.Errorf("Validate accepted %+v", h)
+		}
+		for _, u := range []string{h.DashboardURL, h.DashboardURLVPN} {
+			if u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+				t.Errorf("Validate accepted dashboard URL %q", u)
+			}
+		}
+	})
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue()
+	now := time.Now()
+	q.Add("peer", types.Host{ID: "a", Nickname: "old"}, "peer unreachable", now)
+	q.Add("peer", types.Host{ID: "b"}, "peer unreachable", now)
+	q.Add("peer", types.Host{ID: "a", Nickname: "new"}, "peer unreachable", now)
+	if got := q.Peers(); got["peer"] != 2 {
+		t.Fatalf("expected one announcement per host, got %v", got)
+	}
+
+	due, expired := q.Take("peer", now)
+	if expired != 0 || len(due) != 2 || due[0].Host.ID != "b" || due[1].Host.Nickname != "new" {
+		t.Fatalf("unexpected queue %+v", due)
+	}
+	if len(q.Peers()) != 0 {
+		t.Error("expected Take to empty the peer's queue")
+	}
+
+	// A newer announcement queued during the retry is kept over the old one.
+	q.Add("peer", types.Host{ID: "b", Nickname: "newer"}, "timeout", now)
+	if !q.Retry("peer", due[0], "timeout", now) {
+		t.Error("expected a retry")
+	}
+	q.Requeue("peer", due[1])
+	due, _ = q.Take("peer", now)
+	if len(due) != 2 || due[0].Host.ID != "a" || due[1].Host.Nickname != "newer" {
+		t.Errorf("unexpected queue after retry %+v", due)
+	}
+
+	p := Pending{Host: types.Host{ID: "c"}, QueuedAt: now, Attempts: MaxAttempts - 1}
+	if q.Retry("peer", p, "timeout", now) {
+		t.Error("expected an announcement out of attempts to be dropped")
+	}
+	q.Add("peer", types.Host{ID: "d"}, "peer unreachable", now.Add(-MaxAge-time.Minute))
+	if due, expired := q.Take("peer", now); len(due) != 0 || expired != 1 {
+		t.Errorf("expected an expired announcement, got %+v (%d expired)", due, expired)
+	}
+
+	for i := range MaxPending + 5 {
+		q.Add("peer", types.Host{ID: string(rune('A' + i))}, "peer unreachable", now)
+	}
+	if got := q.Peers()["peer"]; got != MaxPending {
+		t.Errorf("expected at most %d pending, got %d", MaxPending, got)
+	}
+	q.Delivered("peer", string(rune('A'+MaxPending+4)))
+	if n := q.Drop("peer"); n != MaxPending-1 {
+		t.Errorf("expected Delivered to forget one, got %d left", n)
+	}
+}
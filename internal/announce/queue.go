@@ -0,0 +1,137 @@
+package announce
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Queue limits: an announcement is given up after MaxAttempts failed
+// deliveries or once it is older than MaxAge, and a peer holds at most
+// MaxPending announcements, dropping the oldest first.
+const (
+	MaxAttempts = 10
+	MaxAge      = 24 * time.Hour
+	MaxPending  = 100
+)
+
+// Pending is an announcement of Host waiting to be delivered to a peer.
+// It is signed again when sent, so it never fails the receiver's MaxSkew
+// check however long it waited.
+type Pending struct {
+	Host      types.Host
+	QueuedAt  time.Time
+	Attempts  int    // Failed deliveries so far
+	LastError string // Why the last delivery failed
+}
+
+// Queue holds announcements that could not be delivered, by peer host ID,
+// until the peer can be reached again. Only the latest announcement of
+// each host is kept for a peer. It is safe for concurrent use.
+type Queue struct {
+	mu      sync.Mutex
+	pending map[string][]Pending
+}
+
+// NewQueue returns an empty queue.
+func NewQueue() *Queue {
+	return &Queue{pending: make(map[string][]Pending)}
+}
+
+// Add queues an announcement of host for peerID after a failed or skipped
+// delivery, replacing any older one of the same host.
+func (q *Queue) Add(peerID string, host types.Host, reason string, now time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := slices.DeleteFunc(q.pending[peerID], func(p Pending) bool { return p.Host.ID == host.ID })
+	list = append(list, Pending{Host: host, QueuedAt: now, LastError: reason})
+	if len(list) > MaxPending {
+		list = list[len(list)-MaxPending:]
+	}
+	q.pending[peerID] = list
+}
+
+// Retry puts back an announcement taken from the queue whose delivery
+// failed again. It returns false if the announcement has used up its
+// attempts or expired and was dropped instead.
+func (q *Queue) Retry(peerID string, p Pending, reason string, now time.Time) bool {
+	p.Attempts++
+	p.LastError = reason
+	if p.Attempts >= MaxAttempts || now.Sub(p.QueuedAt) > MaxAge {
+		return false
+	}
+	q.Requeue(peerID, p)
+	return true
+}
+
+// Requeue puts back announcements taken from the queue without trying
+// them, ahead of those queued since. An announcement of a host queued
+// since is newer, and is kept instead.
+func (q *Queue) Requeue(peerID string, list ...Pending) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	current := q.pending[peerID]
+	list = slices.DeleteFunc(slices.Clone(list), func(p Pending) bool {
+		return slices.ContainsFunc(current, func(newer Pending) bool { return newer.Host.ID == p.Host.ID })
+	})
+	list = append(list, current...)
+	if len(list) > MaxPending {
+		list = list[len(list)-MaxPending:]
+	}
+	if len(list) > 0 {
+		q.pending[peerID] = list
+	}
+}
+
+// Take removes and returns the announcements queued for peerID, oldest
+// first, along with how many were dropped for being older than MaxAge.
+func (q *Queue) Take(peerID string, now time.Time) (due []Pending, expired int) {
+	q.mu.Lock()
+	list := q.pending[peerID]
+	delete(q.pending, peerID)
+	q.mu.Unlock()
+	for _, p := range list {
+		if now.Sub(p.QueuedAt) > MaxAge {
+			expired++
+			continue
+		}
+		due = append(due, p)
+	}
+	return due, expired
+}
+
+// Delivered forgets a queued announcement of hostID to peerID, after a
+// newer one reached the peer.
+func (q *Queue) Delivered(peerID, hostID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	list := slices.DeleteFunc(q.pending[peerID], func(p Pending) bool { return p.Host.ID == hostID })
+	if len(list) == 0 {
+		delete(q.pending, peerID)
+		return
+	}
+	q.pending[peerID] = list
+}
+
+// Drop discards everything queued for peerID, for a peer that was removed.
+func (q *Queue) Drop(peerID string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.pending[peerID])
+	delete(q.pending, peerID)
+	return n
+}
+
+// Peers returns the IDs of the peers with queued announcements and how
+// many each has.
+func (q *Queue) Peers() map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make(map[string]int, len(q.pending))
+	for id, list := range q.pending {
+		out[id] = len(list)
+	}
+	return out
+}
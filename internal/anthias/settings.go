@@ -0,0 +1,109 @@
+package anthias
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Audio outputs Anthias can play sound through.
+const (
+	AudioHDMI  = "hdmi"
+	AudioLocal = "local" // The 3.5 mm jack
+)
+
+// MaxDuration is the longest default duration accepted, in seconds.
+const MaxDuration = 24 * 60 * 60
+
+// DeviceSettings are the player settings of an Anthias device, in the
+// shape of its /api/v2/device_settings endpoint. Unset fields are left
+// alone by an update. Display rotation and resolution are not among them:
+// Anthias takes those from the Pi's boot configuration.
+type DeviceSettings struct {
+	PlayerName               *string `json:"player_name,omitempty"`
+	AudioOutput              *string `json:"audio_output,omitempty"`               // hdmi or local
+	DefaultDuration          *int    `json:"default_duration,omitempty"`           // Seconds an image or web page shows for
+	DefaultStreamingDuration *int    `json:"default_streaming_duration,omitempty"` // Seconds a stream plays for
+	ShufflePlaylist          *bool   `json:"shuffle_playlist,omitempty"`
+	ShowSplash               *bool   `json:"show_splash,omitempty"` // Splash page with the device address at boot
+	Use24HourClock           *bool   `json:"use_24_hour_clock,omitempty"`
+	DateFormat               *string `json:"date_format,omitempty"` // e.g. mm/dd/yyyy
+}
+
+// Empty reports whether no setting is set.
+func (s DeviceSettings) Empty() bool {
+	return s == DeviceSettings{}
+}
+
+// Validate normalises s and rejects values Anthias would not accept.
+func (s *DeviceSettings) Validate() error {
+	if s.AudioOutput != nil {
+		out := strings.ToLower(strings.TrimSpace(*s.AudioOutput))
+		if out != AudioHDMI && out != AudioLocal {
+			return fmt.Errorf("audio_output must be %s or %s", AudioHDMI, AudioLocal)
+		}
+		s.AudioOutput = &out
+	}
+	for name, d := range map[string]*int{"default_duration": s.DefaultDuration, "default_streaming_duration": s.DefaultStreamingDuration} {
+		if d != nil && (*d < 1 || *d > MaxDuration) {
+			return fmt.Errorf("%s must be 1 to %d seconds", name, MaxDuration)
+		}
+	}
+	if s.PlayerName != nil {
+		name := strings.TrimSpace(*s.PlayerName)
+		if len(name) > 64 {
+			return errors.New("player_name must be at most 64 characters")
+		}
+		s.PlayerName = &name
+	}
+	return nil
+}
+
+// FetchSettings reads the device settings of the Anthias instance at
+// addr. A non-empty username sends basic auth.
+func FetchSettings(client *http.Client, addr, username, password string) (DeviceSettings, error) {
+	return settingsRequest(client, http.MethodGet, addr, nil, username, password)
+}
+
+// UpdateSettings changes the set fields of s on the Anthias instance at
+// addr and returns its settings afterwards.
+func UpdateSettings(client *http.Client, addr string, s DeviceSettings, username, password string) (DeviceSettings, error) {
+	body, err := json.Marshal(s)
+	if err != nil {
+		return DeviceSettings{}, err
+	}
+	return settingsRequest(client, http.MethodPatch, addr, body, username, password)
+}
+
+func settingsRequest(client *http.Client, method, addr string, body []byte, username, password string) (DeviceSettings, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("http://%s/api/v2/device_settings", addr), bytes.NewReader(body))
+	if err != nil {
+		return DeviceSettings{}, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return DeviceSettings{}, fmt.Errorf("device settings: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return DeviceSettings{}, errors.New("device settings: this Anthias version has no settings API")
+	case resp.StatusCode != http.StatusOK:
+		return DeviceSettings{}, fmt.Errorf("device settings: status %d", resp.StatusCode)
+	}
+
+	var out DeviceSettings
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return DeviceSettings{}, fmt.Errorf("decode device settings: %w", err)
+	}
+	return out, nil
+}
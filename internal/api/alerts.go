@@ -0,0 +1,365 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/alerts"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/notify"
+)
+
+// @Title: Alert Rules
+// @Route: GET|POST /api/alerts/rules
+// @Description: Get or replace the alert rules (condition offline|no_assets|cms_offline|disk_usage|content_expiry|time_sync|card_wear|throttled|weak_wifi|viewer_crash_loop|script, for_minutes, active_from/active_to hours on the host clock, hosts, channels email|webhook|mqtt|pagerduty|opsgenie, escalation naming a policy from /api/alerts/escalations). A script rule judges its Starlark script over the hosts in scope once for the whole fleet and may restore preset when it fires
+// @Response: [{"id": "...", "name": "Scoreboard offline", "enabled": true, "condition": "offline", "for_minutes": 5, "hosts": ["..."], "channels": ["webhook"]}]
+func (s *Service) HandleAlertRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := alerts.LoadRules(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, rules)
+	case http.MethodPost:
+		var rules []alerts.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if rules == nil {
+			rules = []alerts.Rule{}
+		}
+
+		rules, err := alerts.SaveRules(s.store, rules)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated alert rules (%d rules)", len(rules)))
+		s.writeJSON(w, http.StatusOK, rules)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Test Alert Script
+// @Route: POST /api/alerts/rules/test
+// @Description: Run the script of a rule against the fleet as it is now without saving it; body {"script": "...", "hosts": ["..."]}. Answers whether it holds and its message, or 400 with the error of a script that does not compile or fails
+// @Response: {"holds": true, "message": "3 Lobby screens offline"}
+func (s *Service) HandleAlertScriptTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var rule alerts.Rule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	holds, message, err := alerts.TestScript(s.store, rule, time.Now().UTC())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "script: "+err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{"holds": holds, "message": message})
+}
+
+// @Title: Quiet Hours
+// @Route: GET|POST /api/alerts/quiet
+// @Description: Get or replace the quiet hours and maintenance windows during which alerts are not sent: {"windows": [{"name", "hosts", "from", "to", "days", "start", "end", "action"}], "digest_hour": 8, "digest_recipients": [...]}. A window covers the listed hosts, or every host and script rule, from hour from to hour to on each host's clock, on the listed days (sun..sat) or every day, or once from start to end. action suppress holds alerts until the window ends; digest emails them in a daily digest at digest_hour on this node's clock instead. The answer includes the alerts waiting for the next digest
+// @Response: {"quiet": {"windows": [{"name": "Lobby nights", "hosts": ["..."], "from": 22, "to": 6, "action": "suppress"}], "digest_hour": 8, "digest_recipients": ["ops@example.com"]}, "digest": {"last_sent": "...", "entries": [{"rule_name": "offline", "host": "Hall", "message": "Offline", "fired_at": "...", "resolved_at": "..."}]}}
+func (s *Service) HandleAlertQuiet(w http.ResponseWriter, r *http.Request) {
+	var q alerts.Quiet
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		q, err = alerts.LoadQuiet(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case http.MethodPost:
+		q.DigestHour = alerts.DefaultDigestHour
+		if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if q, err = alerts.SaveQuiet(s.store, q); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated quiet hours (%d windows)", len(q.Windows)))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	digest, err := alerts.LoadDigest(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{"quiet": q, "digest": digest})
+}
+
+// @Title: Escalation Policies
+// @Route: GET|POST /api/alerts/escalations
+// @Description: Get or replace the escalation policies rules refer to by name: [{"name", "steps": [{"after_minutes", "channels", "recipients"}]}]. Once a rule's alert has been sent to its own channels, each step's channels are notified when the alert has gone unacknowledged for the step's after_minutes. Policies rules use cannot be removed
+// @Response: [{"name": "Lobby on-call", "steps": [{"after_minutes": 30, "channels": ["email"], "recipients": ["manager@example.com"]}, {"after_minutes": 120, "channels": ["pagerduty"]}]}]
+func (s *Service) HandleAlertEscalations(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		policies, err := alerts.LoadPolicies(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, policies)
+	case http.MethodPost:
+		var policies []alerts.Policy
+		if err := json.NewDecoder(r.Body).Decode(&policies); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if policies == nil {
+			policies = []alerts.Policy{}
+		}
+
+		policies, err := alerts.SavePolicies(s.store, policies)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated escalation policies (%d policies)", len(policies)))
+		s.writeJSON(w, http.StatusOK, policies)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Acknowledge Alert
+// @Route: POST /api/alerts/{id}/ack
+// @Description: Acknowledge a firing alert by the id from /api/alerts, so its escalation policy notifies no further steps. The resolution is still sent. Acknowledging twice keeps the first acknowledgement; 404 if the alert was not sent or has resolved
+// @Response: {"alert_id": "...", "rule_id": "...", "host_id": "...", "policy": "Lobby on-call", "sent_at": "...", "step": 1, "acked_by": "admin", "acked_at": "..."}
+func (s *Service) HandleAlertAck(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/alerts/"), "/")
+	if id == "" || action != "ack" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	by := "anonymous"
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		by = u.Username
+	}
+	esc, err := s.store.AckAlert(id, by, time.Now().UTC())
+	if errors.Is(err, hosts.ErrAlertNotFound) {
+		s.writeError(w, http.StatusNotFound, "Alert not found; it may not have been sent yet or has resolved")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	auth.AnnotateAudit(r, id, fmt.Sprintf("rule %s on host %s", esc.RuleID, esc.HostID))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Alert %s acknowledged by %s", id, esc.AckedBy))
+	s.writeJSON(w, http.StatusOK, esc)
+}
+
+// @Title: List Alerts
+// @Route: GET /api/alerts
+// @Description: List rule conditions currently matching; firing alerts have held for the rule's duration and were sent, or held for the digest if digest is set. Sent alerts show who acknowledged them and how many escalation steps were notified
+// @Response: {"alerts": [{"id": "...", "rule_id": "...", "rule_name": "...", "host_id": "...", "host": "...", "condition": "offline", "message": "...", "since": "...", "firing": true}]}
+func (s *Service) HandleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := alerts.LoadAlerts(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{"alerts": list})
+}
+
+// @Title: Webhook Settings
+// @Route: GET|POST /api/settings/webhook
+// @Description: Get or update the webhook that receives alerts as JSON (secret is masked on read)
+// @Response: {"url": "https://...", "secret": "********"}
+func (s *Service) HandleWebhookSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notify.LoadWebhook(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg notify.WebhookConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored secret when the client echoes back the mask.
+		if cfg.Secret == "" || cfg.Secret == cfg.Masked().Secret {
+			current, err := notify.LoadWebhook(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.Secret = current.Secret
+		}
+
+		if err := s.store.PutSetting(notify.WebhookSettingKey, cfg); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), "API: Updated webhook settings")
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: PagerDuty Settings
+// @Route: GET|POST /api/settings/pagerduty
+// @Description: Get or update the PagerDuty Events API v2 integrations the pagerduty channel opens incidents in. services route the incidents of the listed hosts (fleet for script rules) to their own service's routing key; other hosts use routing_key. Keys are masked on read; url overrides the Events API endpoint
+// @Response: {"routing_key": "********", "services": [{"name": "Lobby", "hosts": ["..."], "routing_key": "********"}]}
+func (s *Service) HandlePagerDutySettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notify.LoadPagerDuty(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg notify.PagerDutyConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored keys when the client echoes back the mask.
+		current, err := notify.LoadPagerDuty(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cfg.Unmask(current)
+		if err := cfg.Validate(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := s.store.PutSetting(notify.PagerDutySettingKey, cfg); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), "API: Updated PagerDuty settings")
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Opsgenie Settings
+// @Route: GET|POST /api/settings/opsgenie
+// @Description: Get or update the Opsgenie API integration the opsgenie channel opens alerts in. teams route the alerts of the listed hosts (fleet for script rules) to their own responder team; other hosts go to team, or to the integration's default if it is empty. The API key is masked on read; url selects another instance, e.g. https://api.eu.opsgenie.com
+// @Response: {"api_key": "********", "url": "https://api.eu.opsgenie.com", "team": "Digital Signage", "teams": [{"team": "Retail", "hosts": ["..."]}]}
+func (s *Service) HandleOpsgenieSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notify.LoadOpsgenie(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg notify.OpsgenieConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored key when the client echoes back the mask.
+		if cfg.APIKey == "" || cfg.APIKey == cfg.Masked().APIKey {
+			current, err := notify.LoadOpsgenie(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.APIKey = current.APIKey
+		}
+		if err := cfg.Validate(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if err := s.store.PutSetting(notify.OpsgenieSettingKey, cfg); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), "API: Updated Opsgenie settings")
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: MQTT Settings
+// @Route: GET|POST /api/settings/mqtt
+// @Description: Get or update the MQTT broker that receives alerts (password is masked on read)
+// @Response: {"broker": "mqtt.local:1883", "topic": "nsm", "username": "...", "password": "********"}
+func (s *Service) HandleMQTTSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notify.LoadMQTT(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg notify.MQTTConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored password when the client echoes back the mask.
+		if cfg.Password == "" || cfg.Password == cfg.Masked().Password {
+			current, err := notify.LoadMQTT(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.Password = current.Password
+		}
+
+		if err := s.store.PutSetting(notify.MQTTSettingKey, cfg); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated MQTT settings (%s)", cfg.Broker))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
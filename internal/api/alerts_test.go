@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/alerts"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleAlertRules(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleAlertRules(w, httptest.NewRequest(http.MethodPost, "/api/alerts/rules", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`[{"name": "Scoreboard offline", "enabled": true, "condition": "offline", "for_minutes": 5, "channels": ["webhook"]}]`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleAlertRules(w, httptest.NewRequest(http.MethodGet, "/api/alerts/rules", nil))
+	var rules []alerts.Rule
+	json.NewDecoder(w.Body).Decode(&rules)
+	if len(rules) != 1 || rules[0].ID == "" || rules[0].ForMinutes != 5 {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+
+	if w := post(`[{"condition": "offline", "channels": ["pager"]}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown channel, got %d", w.Code)
+	}
+}
+
+func TestHandleAlertQuiet(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleAlertQuiet(w, httptest.NewRequest(http.MethodPost, "/api/alerts/quiet", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"windows": [{"name": "Nights", "from": 22, "to": 6, "action": "digest"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a digest without recipients, got %d", w.Code)
+	}
+	w := post(`{"windows": [{"name": "Nights", "from": 22, "to": 6, "days": ["Friday"], "action": "digest"}], "digest_hour": 7, "digest_recipients": ["ops@example.com"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleAlertQuiet(w, httptest.NewRequest(http.MethodGet, "/api/alerts/quiet", nil))
+	var resp struct {
+		Quiet  alerts.Quiet  `json:"quiet"`
+		Digest alerts.Digest `json:"digest"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Quiet.Windows) != 1 || resp.Quiet.Windows[0].Days[0] != "fri" || resp.Quiet.DigestHour != 7 || resp.Digest.Entries == nil {
+		t.Errorf("unexpected quiet hours: %+v", resp)
+	}
+}
+
+func TestHandleAlertAck(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.OpenEscalation(hosts.Escalation{AlertID: "a1", RuleID: "offline", HostID: "lobby", SentAt: time.Now()})
+	ack := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		svc.HandleAlertAck(w, req.WithContext(auth.WithUser(req.Context(), types.User{Username: "alice"})))
+		return w
+	}
+
+	w := ack("/api/alerts/a1/ack")
+	var esc hosts.Escalation
+	json.NewDecoder(w.Body).Decode(&esc)
+	if w.Code != http.StatusOK || esc.AckedBy != "alice" || esc.AckedAt.IsZero() {
+		t.Fatalf("expected the alert acknowledged by alice, got %d: %+v", w.Code, esc)
+	}
+	if w := ack("/api/alerts/a2/ack"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown alert, got %d", w.Code)
+	}
+	if w := ack("/api/alerts/a1/mute"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown action, got %d", w.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// @Title: API Keys
+// @Route: GET|POST /api/keys
+// @Description: List API keys, or create one with a name, role (viewer|operator|admin), and optional expiry in days; the key is only shown once
+// @Response: {"key": "nsm_...", "id": "...", "name": "ci", "prefix": "nsm_AbCdEf", "role": "operator", "expires_at": "..."}
+func (s *Service) HandleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := s.store.ListAPIKeys()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, keys)
+	case http.MethodPost:
+		var req struct {
+			Name          string     `json:"name"`
+			Role          types.Role `json:"role"`
+			ExpiresInDays int        `json:"expires_in_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Role == "" {
+			req.Role = types.RoleViewer
+		}
+		if req.ExpiresInDays < 0 {
+			s.writeError(w, http.StatusBadRequest, "expires_in_days must not be negative")
+			return
+		}
+
+		ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+		key, k, err := s.auth.CreateAPIKey(req.Name, req.Role, ttl, currentUsername(r))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		auth.AnnotateAudit(r, k.Prefix, fmt.Sprintf("created %s key %q", k.Role, k.Name))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created %s API key %q (%s)", k.Role, k.Name, k.Prefix))
+		s.writeJSON(w, http.StatusCreated, struct {
+			Key string `json:"key"`
+			hosts.APIKey
+		}{key, k})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Revoke API Key
+// @Route: POST /api/keys/revoke?id=...
+// @Description: Permanently disable an API key; it stays listed as revoked
+// @Response: {"id": "...", "name": "ci", "revoked": true, ...}
+func (s *Service) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	k, err := s.store.RevokeAPIKey(id)
+	if errors.Is(err, hosts.ErrAPIKeyNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	auth.AnnotateAudit(r, k.Prefix, fmt.Sprintf("revoked key %q", k.Name))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Revoked API key %q (%s)", k.Name, k.Prefix))
+	s.writeJSON(w, http.StatusOK, k)
+}
+
+// @Title: Audit Log
+// @Route: GET /api/audit?actor=...&action=...&limit=100
+// @Description: List audit entries newest first; action matches by prefix (e.g. "POST /api/hosts" or "auth.")
+// @Response: [{"id": 1, "time": "...", "actor": "admin", "actor_type": "user", "action": "POST /api/hosts/reboot", "target": "id=...", "detail": "status 200", "remote_addr": "..."}]
+func (s *Service) HandleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	query := hosts.AuditQuery{
+		Actor:  q.Get("actor"),
+		Action: q.Get("action"),
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > 1000 {
+			s.writeError(w, http.StatusBadRequest, "limit must be between 1 and 1000")
+			return
+		}
+		query.Limit = limit
+	}
+
+	entries, err := s.store.ListAudit(query)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+// @Title: Export Audit Log
+// @Route: GET /api/audit/export?since=...&until=...
+// @Description: Download a signed, verifiable bundle of audit entries (RFC 3339 bounds, both optional); check it with the auditverify tool or POST /api/audit/verify
+// @Response: {"node_id": "...", "public_key": "...", "fingerprint": "...", "exported_at": "...", "entries": [...], "signature": "..."}
+func (s *Service) HandleAuditExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := s.auth.Identity()
+	if id == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "node identity key is unavailable")
+		return
+	}
+
+	var since, until time.Time
+	for name, dst := range map[string]*time.Time{"since": &since, "until": &until} {
+		if v := r.URL.Query().Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Sprintf("%s must be an RFC 3339 time", name))
+				return
+			}
+			*dst = t
+		}
+	}
+
+	entries, err := s.store.AuditRange(since, until)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	bundle := hosts.AuditBundle{
+		PublicKey:   base64.StdEncoding.EncodeToString(id.PublicKey()),
+		Fingerprint: id.Fingerprint(),
+		ExportedAt:  time.Now().UTC(),
+		Entries:     entries,
+	}
+	if local, err := s.anthias.GetMetadata(); err == nil && local != nil {
+		bundle.NodeID = local.ID
+	}
+	bundle.Signature = base64.StdEncoding.EncodeToString(id.Sign(bundle.SigningInput()))
+
+	filename := fmt.Sprintf("nsm-audit-%s.json", bundle.ExportedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	s.writeJSON(w, http.StatusOK, bundle)
+}
+
+// @Title: Verify Audit Export
+// @Route: POST /api/audit/verify
+// @Description: Check an exported audit bundle's hashes, chain links, and signatures
+// @Response: {"valid": true, "entries": 120, "unsigned": 0, "first_id": 1, "last_id": 120, "fingerprint": "...", "this_node": true}
+func (s *Service) HandleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var bundle hosts.AuditBundle
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<20)).Decode(&bundle); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	result, err := bundle.Verify()
+	resp := map[string]interface{}{
+		"valid":       err == nil,
+		"entries":     result.Entries,
+		"unsigned":    result.Unsigned,
+		"first_id":    result.FirstID,
+		"last_id":     result.LastID,
+		"fingerprint": bundle.Fingerprint,
+	}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	if id := s.auth.Identity(); id != nil {
+		resp["this_node"] = bundle.PublicKey == base64.StdEncoding.EncodeToString(id.PublicKey())
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+func TestHandleAPIKeys(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/keys",
+		bytes.NewBufferString(`{"name":"dashboard","role":"viewer","expires_in_days":30}`))
+	w := httptest.NewRecorder()
+	svc.HandleAPIKeys(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created struct {
+		Key string `json:"key"`
+		ID  string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if created.Key == "" || created.ID == "" {
+		t.Fatalf("Expected key and id in response, got %+v", created)
+	}
+
+	// Listing never includes the secret.
+	w = httptest.NewRecorder()
+	svc.HandleAPIKeys(w, httptest.NewRequest(http.MethodGet, "/api/keys", nil))
+	if bytes.Contains(w.Body.Bytes(), []byte(created.Key)) {
+		t.Errorf("Expected key list not to contain the secret")
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleRevokeAPIKey(w, httptest.NewRequest(http.MethodPost, "/api/keys/revoke?id="+created.ID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 on revoke, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleRevokeAPIKey(w, httptest.NewRequest(http.MethodPost, "/api/keys/revoke?id=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown key, got %d", w.Code)
+	}
+
+	keys, _ := store.ListAPIKeys()
+	if len(keys) != 1 || !keys[0].Revoked {
+		t.Errorf("Expected one revoked key, got %+v", keys)
+	}
+}
+
+func TestHandleAudit(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, action := range []string{"auth.login", "POST /api/hosts/reboot", "auth.logout"} {
+		if err := store.AppendAudit(hosts.AuditEntry{Actor: "admin", ActorType: hosts.ActorUser, Action: action}); err != nil {
+			t.Fatalf("AppendAudit: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleAudit(w, httptest.NewRequest(http.MethodGet, "/api/audit?action=auth.", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var entries []hosts.AuditEntry
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 2 || entries[0].Action != "auth.logout" {
+		t.Errorf("Expected 2 auth entries newest first, got %+v", entries)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleAudit(w, httptest.NewRequest(http.MethodGet, "/api/audit?limit=0", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid limit, got %d", w.Code)
+	}
+}
+
+func TestHandleAuditExportAndVerify(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	if err := store.AppendAudit(hosts.AuditEntry{Actor: "admin", ActorType: hosts.ActorUser, Action: "POST /api/hosts/reboot"}); err != nil {
+		t.Fatalf("AppendAudit: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleAuditExport(w, httptest.NewRequest(http.MethodGet, "/api/audit/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	exported := w.Body.Bytes()
+
+	var bundle hosts.AuditBundle
+	if err := json.Unmarshal(exported, &bundle); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	if bundle.NodeID != "test-id" || len(bundle.Entries) != 1 {
+		t.Errorf("Unexpected bundle: %+v", bundle)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleAuditVerify(w, httptest.NewRequest(http.MethodPost, "/api/audit/verify", bytes.NewReader(exported)))
+	var result map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["valid"] != true || result["this_node"] != true {
+		t.Errorf("Expected exported bundle to verify, got %v", result)
+	}
+
+	tampered := bytes.Replace(exported, []byte(`"actor":"admin"`), []byte(`"actor":"guest"`), 1)
+	w = httptest.NewRecorder()
+	svc.HandleAuditVerify(w, httptest.NewRequest(http.MethodPost, "/api/audit/verify", bytes.NewReader(tampered)))
+	result = nil
+	json.NewDecoder(w.Body).Decode(&result)
+	if result["valid"] != false {
+		t.Errorf("Expected tampered bundle to fail, got %v", result)
+	}
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// maxApprovalBody bounds the body kept with a held request. Database and
+// host list uploads are the largest.
+const maxApprovalBody = 16 << 20
+
+// AuditApprovalExpired is the audit action for a held request nobody
+// approved in time. Requests, approvals and rejections are audited as the
+// requests that carry them.
+const AuditApprovalExpired = "approval.expired"
+
+var (
+	errApprovalNotFound = errors.New("no pending request with that ID")
+	errApprovalSelf     = errors.New("a request must be approved by someone other than the requester")
+	errApprovalKey      = errors.New("approvals need a signed-in user")
+	errApprovalRole     = errors.New("insufficient permissions for the held request")
+)
+
+// Approval is a destructive request held until a second user approves it.
+type Approval struct {
+	ID          string    `json:"id"`
+	Action      string    `json:"action"`
+	Request     string    `json:"request"` // Method, path and query, e.g. "POST /api/backups/restore?file=..."
+	RequestedBy string    `json:"requested_by"`
+	RequestedAt time.Time `json:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	requesterID string     // The requester, or the user who created their API key
+	role        types.Role // The role the held request needs
+	method      string
+	url         string
+	header      http.Header
+	body        []byte
+	handler     http.HandlerFunc
+}
+
+// approvalQueue holds the requests waiting for approval. They are kept in
+// memory only, so a restart drops them and they must be requested again.
+type approvalQueue struct {
+	mu      sync.Mutex
+	pending map[string]*Approval
+}
+
+func (q *approvalQueue) add(a *Approval) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending == nil {
+		q.pending = make(map[string]*Approval)
+	}
+	q.pending[a.ID] = a
+}
+
+// take removes and returns the request id if check allows it, and leaves
+// it pending otherwise.
+func (q *approvalQueue) take(id string, check func(*Approval) error) (*Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a, ok := q.pending[id]
+	if !ok {
+		return nil, errApprovalNotFound
+	}
+	if err := check(a); err != nil {
+		return nil, err
+	}
+	delete(q.pending, id)
+	return a, nil
+}
+
+// expire drops and returns the requests whose window closed before now.
+func (q *approvalQueue) expire(now time.Time) []*Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var out []*Approval
+	for id, a := range q.pending {
+		if !now.Before(a.ExpiresAt) {
+			out = append(out, a)
+			delete(q.pending, id)
+		}
+	}
+	return out
+}
+
+func (q *approvalQueue) list() []Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := []Approval{}
+	for _, a := range q.pending {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].RequestedAt.Before(out[j].RequestedAt) })
+	return out
+}
+
+// approvedKey marks a request run after its approval, so it is not held
+// a second time.
+type approvedKey struct{}
+
+// holdForApproval holds r when the two-person rule covers action, answering
+// 202 with the pending approval, and reports whether it did.
+func (s *Service) holdForApproval(w http.ResponseWriter, r *http.Request, action string, handler http.HandlerFunc) bool {
+	cfg, held, err := s.approvalRule(r.Context(), action)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	if !held {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxApprovalBody+1))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return true
+	}
+	if len(body) > maxApprovalBody {
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("requests held for approval are limited to %d MB", maxApprovalBody>>20))
+		return true
+	}
+	a := s.hold(r.Context(), cfg, action, auth.RequiredRole(r), r.Method, r.URL.RequestURI(), r.Header.Clone(), body, handler)
+	auth.AnnotateAudit(r, r.URL.RawQuery, "held for approval "+a.ID)
+	s.writeJSON(w, http.StatusAccepted, a)
+	return true
+}
+
+// approvalRule returns the two-person rule and whether it holds the
+// request ctx belongs to for action. Only signed-in users' requests are
+// held: in open mode there is nobody to tell apart, and requests forwarded
+// by peers were held on the node they were made on.
+func (s *Service) approvalRule(ctx context.Context, action string) (auth.ApprovalConfig, bool, error) {
+	if ctx.Value(approvedKey{}) != nil {
+		return auth.ApprovalConfig{}, false, nil
+	}
+	u, ok := auth.UserFromContext(ctx)
+	if !ok || u.Provider == auth.ProviderPeer {
+		return auth.ApprovalConfig{}, false, nil
+	}
+	cfg, err := s.auth.LoadApprovals()
+	if err != nil {
+		return cfg, false, err
+	}
+	return cfg, cfg.Requires(action), nil
+}
+
+// hold queues a request held for approval. Once approved, handler runs it
+// as method to uri with header and body, needing role of the approver.
+func (s *Service) hold(ctx context.Context, cfg auth.ApprovalConfig, action string, role types.Role, method, uri string, header http.Header, body []byte, handler http.HandlerFunc) *Approval {
+	s.expireApprovals()
+	u, _ := auth.UserFromContext(ctx)
+	now := time.Now().UTC()
+	a := &Approval{
+		ID:          uuid.New().String(),
+		Action:      action,
+		Request:     method + " " + uri,
+		RequestedBy: u.Username,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(time.Duration(cfg.WindowMinutes) * time.Minute),
+		requesterID: s.auth.OwnerID(u),
+		role:        role,
+		method:      method,
+		url:         uri,
+		header:      header,
+		body:        body,
+		handler:     handler,
+	}
+	s.approvals.add(a)
+	s.logger.InfoContext(ctx, fmt.Sprintf("API: %s asked to %s (%s); waiting for a second user to approve", u.Username, action, a.Request))
+	return a
+}
+
+// canDecide checks that u may approve or reject a: a signed-in user other
+// than the requester, whose role allows the held request. The requester
+// may still reject their own request to withdraw it.
+func (s *Service) canDecide(u types.User, a *Approval, withdraw bool) error {
+	if withdraw && s.auth.OwnerID(u) == a.requesterID {
+		return nil
+	}
+	switch {
+	case u.Provider == auth.ProviderAPIKey || u.Provider == auth.ProviderPeer:
+		return errApprovalKey
+	case s.auth.OwnerID(u) == a.requesterID:
+		return errApprovalSelf
+	case !u.Role.Allows(a.role):
+		return errApprovalRole
+	}
+	return nil
+}
+
+// expireApprovals drops the requests nobody approved in time, writing each
+// to the audit log.
+func (s *Service) expireApprovals() {
+	for _, a := range s.approvals.expire(time.Now()) {
+		s.logger.Warning(fmt.Sprintf("API: Request to %s by %s expired without approval", a.Action, a.RequestedBy))
+		s.store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem, Action: AuditApprovalExpired,
+			Target: a.Request, Detail: fmt.Sprintf("%s requested by %s", a.ID, a.RequestedBy)})
+	}
+}
+
+// @Title: Pending Approvals
+// @Route: GET /api/approvals
+// @Description: Destructive requests held by the two-person rule, oldest first, until another user approves or rejects them or they expire
+// @Response: [{"id": "...", "action": "restore", "request": "POST /api/backups/restore?file=hosts-2026-03-01.db", "requested_by": "alice", "requested_at": "...", "expires_at": "..."}]
+func (s *Service) HandleApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.expireApprovals()
+	s.writeJSON(w, http.StatusOK, s.approvals.list())
+}
+
+// @Title: Approve Request
+// @Route: POST /api/approvals/approve?id=...
+// @Description: Approve a held request, which then runs and answers as it would have without the two-person rule. The approver must be a signed-in user other than the requester, or the user who created the requester's API key, with a role that may make the request; API keys cannot approve
+// @Response: The response of the approved request
+func (s *Service) HandleApprove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		s.writeError(w, http.StatusForbidden, errApprovalKey.Error())
+		return
+	}
+
+	s.expireApprovals()
+	a, err := s.approvals.take(r.URL.Query().Get("id"), func(a *Approval) error { return s.canDecide(u, a, false) })
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		s.writeError(w, http.StatusNotFound, err.Error()+" (it may have expired)")
+		return
+	case err != nil:
+		s.writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	req, err := http.NewRequestWithContext(context.WithValue(r.Context(), approvedKey{}, a.ID), a.method, a.url, bytes.NewReader(a.body))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	req.Header = a.header
+	req.RemoteAddr = r.RemoteAddr
+
+	auth.AnnotateAudit(r, a.Request, fmt.Sprintf("approved %s requested by %s", a.ID, a.RequestedBy))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: %s approved the request by %s to %s", u.Username, a.RequestedBy, a.Action))
+	a.handler(w, req)
+}
+
+// @Title: Reject Request
+// @Route: POST /api/approvals/reject?id=...
+// @Description: Reject a held request so it never runs. Only users who could approve it may reject it, except that the requester may withdraw their own request this way
+// @Response: 204 No Content
+func (s *Service) HandleReject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		s.writeError(w, http.StatusForbidden, errApprovalKey.Error())
+		return
+	}
+
+	a, err := s.approvals.take(r.URL.Query().Get("id"), func(a *Approval) error { return s.canDecide(u, a, true) })
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		s.writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	auth.AnnotateAudit(r, a.Request, fmt.Sprintf("rejected %s requested by %s", a.ID, a.RequestedBy))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: %s rejected the request by %s to %s", u.Username, a.RequestedBy, a.Action))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Approval Settings
+// @Route: GET|POST /api/settings/approvals
+// @Description: Get or update the two-person rule: actions lists the destructive actions one user requests and another must approve (reboot, import, restore; empty for none), and window_minutes how long a request waits for its approval (default 15, at most 1440). Held requests are answered 202 with the pending approval
+// @Response: {"actions": ["import", "restore"], "window_minutes": 15}
+func (s *Service) HandleApprovalSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := s.auth.LoadApprovals()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		var cfg auth.ApprovalConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		cfg, err := s.auth.SaveApprovals(cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		actions := "none"
+		if len(cfg.Actions) > 0 {
+			actions = strings.Join(cfg.Actions, ", ")
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated approval settings (approval needed for %s, %d minute window)", actions, cfg.WindowMinutes))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestTwoPersonImport(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "old", IPAddress: "192.168.1.1"})
+
+	as := func(r *http.Request, id string) *http.Request {
+		return r.WithContext(auth.WithUser(r.Context(), types.User{ID: id, Username: id, Role: types.RoleOperator}))
+	}
+	upload := func() *Approval {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/hosts/import/upload?format=json",
+			strings.NewReader(`[{"id": "new", "ip_address": "192.168.1.2"}]`))
+		w := httptest.NewRecorder()
+		svc.HandleImportUpload(w, as(req, "alice"))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected the import held with 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var a Approval
+		json.NewDecoder(w.Body).Decode(&a)
+		return &a
+	}
+	approve := func(id, by string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/approvals/approve?id="+id, nil)
+		w := httptest.NewRecorder()
+		svc.HandleApprove(w, as(req, by))
+		return w.Code
+	}
+
+	if _, err := svc.auth.SaveApprovals(auth.ApprovalConfig{Actions: []string{auth.ApprovalImport}}); err != nil {
+		t.Fatalf("SaveApprovals: %v", err)
+	}
+
+	a := upload()
+	if a.RequestedBy != "alice" || a.Action != auth.ApprovalImport {
+		t.Errorf("Unexpected approval %+v", a)
+	}
+	if _, err := store.GetByID("old"); err != nil {
+		t.Fatal("Expected the host list unchanged while the import waits")
+	}
+	if code := approve(a.ID, "alice"); code != http.StatusForbidden {
+		t.Errorf("Expected the requester refused with 403, got %d", code)
+	}
+	if code := approve(a.ID, "bob"); code != http.StatusNoContent {
+		t.Fatalf("Expected the approved import to answer 204, got %d", code)
+	}
+	if _, err := store.GetByID("new"); err != nil {
+		t.Error("Expected the host list replaced once approved")
+	}
+	if code := approve(a.ID, "bob"); code != http.StatusNotFound {
+		t.Errorf("Expected an approved request gone, got %d", code)
+	}
+
+	// A request nobody approves in time expires.
+	a = upload()
+	svc.approvals.pending[a.ID].ExpiresAt = time.Now().Add(-time.Second)
+	if code := approve(a.ID, "bob"); code != http.StatusNotFound {
+		t.Errorf("Expected an expired request gone, got %d", code)
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: AuditApprovalExpired})
+	if len(entries) != 1 {
+		t.Errorf("Expected the expiry audited, got %d entries", len(entries))
+	}
+
+	// Requests are not held in open mode.
+	req := httptest.NewRequest(http.MethodPost, "/api/hosts/import/upload?format=json", strings.NewReader(`[]`))
+	w := httptest.NewRecorder()
+	svc.HandleImportUpload(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected an anonymous import to run, got %d", w.Code)
+	}
+}
+
+func TestApprovalByKeyOwner(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "old", IPAddress: "192.168.1.1"})
+
+	alice, _ := svc.auth.CreateUser("alice", "", "alice-password", types.RoleOperator)
+	bob, _ := svc.auth.CreateUser("bob", "", "bob-password", types.RoleOperator)
+	viewer, _ := svc.auth.CreateUser("carol", "", "carol-password", types.RoleViewer)
+	_, k, err := svc.auth.CreateAPIKey("ci", types.RoleOperator, 0, "alice")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	key := types.User{ID: k.ID, Username: "key:ci", Role: types.RoleOperator, Provider: auth.ProviderAPIKey}
+	if _, err := svc.auth.SaveApprovals(auth.ApprovalConfig{Actions: []string{auth.ApprovalImport}}); err != nil {
+		t.Fatalf("SaveApprovals: %v", err)
+	}
+
+	upload := func() *Approval {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/hosts/import/upload?format=json",
+			strings.NewReader(`[{"id": "new", "ip_address": "192.168.1.2"}]`))
+		w := httptest.NewRecorder()
+		svc.HandleImportUpload(w, req.WithContext(auth.WithUser(req.Context(), key)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected the import held with 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var a Approval
+		json.NewDecoder(w.Body).Decode(&a)
+		return &a
+	}
+	decide := func(handler http.HandlerFunc, path, id string, u types.User) int {
+		req := httptest.NewRequest(http.MethodPost, path+"?id="+id, nil)
+		w := httptest.NewRecorder()
+		handler(w, req.WithContext(auth.WithUser(req.Context(), u)))
+		return w.Code
+	}
+
+	// The key's creator cannot approve what they asked for through it.
+	a := upload()
+	if code := decide(svc.HandleApprove, "/api/approvals/approve", a.ID, alice); code != http.StatusForbidden {
+		t.Errorf("Expected the key's creator refused with 403, got %d", code)
+	}
+	if code := decide(svc.HandleApprove, "/api/approvals/approve", a.ID, viewer); code != http.StatusForbidden {
+		t.Errorf("Expected a viewer refused with 403, got %d", code)
+	}
+	if code := decide(svc.HandleReject, "/api/approvals/reject", a.ID, viewer); code != http.StatusForbidden {
+		t.Errorf("Expected a viewer unable to reject, got %d", code)
+	}
+	if code := decide(svc.HandleApprove, "/api/approvals/approve", a.ID, bob); code != http.StatusNoContent {
+		t.Fatalf("Expected another operator to approve, got %d", code)
+	}
+
+	// The requester may withdraw their own request, whether through the
+	// key or signed in.
+	a = upload()
+	if code := decide(svc.HandleReject, "/api/approvals/reject", a.ID, alice); code != http.StatusNoContent {
+		t.Errorf("Expected the key's creator to withdraw the request, got %d", code)
+	}
+	a = upload()
+	other := types.User{ID: "other-key", Username: "key:other", Role: types.RoleAdmin, Provider: auth.ProviderAPIKey}
+	if code := decide(svc.HandleReject, "/api/approvals/reject", a.ID, other); code != http.StatusForbidden {
+		t.Errorf("Expected another API key unable to reject, got %d", code)
+	}
+	if code := decide(svc.HandleReject, "/api/approvals/reject", a.ID, key); code != http.StatusNoContent {
+		t.Errorf("Expected the key to withdraw its own request, got %d", code)
+	}
+}
+
+func TestApprovalConfigValidate(t *testing.T) {
+	cfg := auth.ApprovalConfig{Actions: []string{auth.ApprovalRestore}}
+	if err := cfg.Validate(); err != nil || cfg.WindowMinutes != auth.DefaultApprovalWindow {
+		t.Errorf("Expected the default window, got %+v (%v)", cfg, err)
+	}
+	for _, bad := range []auth.ApprovalConfig{
+		{Actions: []string{"delete"}},
+		{WindowMinutes: 2000},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Expected %+v rejected", bad)
+		}
+	}
+}
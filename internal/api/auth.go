@@ -0,0 +1,593 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// @Title: Auth Status
+// @Route: GET /api/auth/status
+// @Description: Report whether accounts are enabled and who is signed in
+// @Response: {"auth_enabled": true, "replication": false, "oidc_enabled": false, "oidc_label": "", "user": {...}}
+func (s *Service) HandleAuthStatus(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{
+		"auth_enabled": s.auth.Enabled(),
+		"replication":  s.auth.ReplicationEnabled(),
+		"oidc_enabled": false,
+	}
+	if cfg, ok := s.auth.OIDCEnabled(); ok {
+		resp["oidc_enabled"] = true
+		resp["oidc_label"] = cfg.ButtonLabel
+	}
+	if u, ok := s.auth.Authenticate(r); ok {
+		resp["user"] = u.Public()
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// @Title: Create First Admin
+// @Route: POST /api/auth/bootstrap
+// @Description: Create the first admin account while no users exist, enabling login
+// @Response: {"id": "...", "username": "...", "role": "admin"}
+func (s *Service) HandleAuthBootstrap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	u, err := s.auth.Bootstrap(req.Username, req.Email, req.Password)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, auth.ErrAlreadyInitialized) {
+			status = http.StatusConflict
+		}
+		s.writeError(w, status, err.Error())
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created first admin account %q; login is now required", u.Username))
+	s.startSession(w, r, req.Username, req.Password)
+}
+
+// @Title: Login
+// @Route: POST /api/auth/login
+// @Description: Sign in with username and password; sets the session cookie
+// @Response: {"id": "...", "username": "...", "role": "...", "prefs": {...}}
+func (s *Service) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	s.startSession(w, r, req.Username, req.Password)
+}
+
+func (s *Service) startSession(w http.ResponseWriter, r *http.Request, username, password string) {
+	token, u, err := s.auth.Login(username, password)
+	if err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Failed login for %q from %s", username, r.RemoteAddr))
+		s.auth.Audit(r, types.User{}, "auth.login_failed", username, "")
+		s.writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	s.auth.Audit(r, u, "auth.login", u.Username, "")
+	setSessionCookie(w, r, token)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: User %q signed in", u.Username))
+	s.writeJSON(w, http.StatusOK, u.Public())
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int((7 * 24 * time.Hour).Seconds()),
+	})
+}
+
+// @Title: Logout
+// @Route: POST /api/auth/logout
+// @Description: End the current session
+// @Response: 204 No Content
+func (s *Service) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if c, err := r.Cookie(auth.SessionCookie); err == nil {
+		if u, ok := s.auth.Authenticate(r); ok {
+			s.auth.Audit(r, u, "auth.logout", u.Username, "")
+		}
+		s.auth.Logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.SessionCookie,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Current User
+// @Route: GET|POST /api/auth/me
+// @Description: Get the signed-in user, or update their preferences (theme, default_view, site_scope, table)
+// @Response: {"id": "...", "username": "...", "role": "...", "prefs": {"theme": "dark", "default_view": "home"}}
+func (s *Service) HandleMe(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, http.StatusOK, u.Public())
+	case http.MethodPost:
+		var prefs types.UserPrefs
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		switch prefs.Theme {
+		case "", "dark", "light":
+		default:
+			s.writeError(w, http.StatusBadRequest, "theme must be dark or light")
+			return
+		}
+		switch prefs.DefaultView {
+		case "", "home", "advanced", "api", "docs":
+		default:
+			s.writeError(w, http.StatusBadRequest, "default_view must be home, advanced, api, or docs")
+			return
+		}
+		if err := prefs.Table.Validate(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		updated, err := s.auth.UpdatePrefs(u.ID, prefs)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, updated.Public())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Host Table Preferences
+// @Route: GET|POST /api/auth/me/table
+// @Description: Get or replace the host table preferences of the signed-in user, leaving their other preferences as they are. columns lists the shown columns (name, lan_ip, vpn_ip, nsm_dash, anthias_dash, notes, actions; empty for all), density is comfortable, compact or large, and refresh_seconds batches host list updates (0 for live, else 5 to 3600)
+// @Response: {"columns": ["name", "lan_ip", "notes"], "density": "large", "refresh_seconds": 30}
+func (s *Service) HandleMeTable(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, http.StatusOK, u.Prefs.Table)
+	case http.MethodPost:
+		var table types.TablePrefs
+		if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if err := table.Validate(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		prefs := u.Prefs
+		prefs.Table = table
+		updated, err := s.auth.UpdatePrefs(u.ID, prefs)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, updated.Prefs.Table)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Change Password
+// @Route: POST /api/auth/password
+// @Description: Change the signed-in user's password
+// @Response: 204 No Content
+func (s *Service) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		s.writeError(w, http.StatusUnauthorized, "not signed in")
+		return
+	}
+
+	var req struct {
+		Current string `json:"current_password"`
+		New     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := s.auth.ChangePassword(u.ID, req.Current, req.New); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: User %q changed their password", u.Username))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: List or Create Users
+// @Route: GET|POST /api/users
+// @Description: List accounts, or create one directly with a password (admin only)
+// @Response: [{"id": "...", "username": "...", "email": "...", "role": "...", "disabled": false}]
+func (s *Service) HandleUsers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := s.store.ListUsers(false)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range users {
+			users[i] = users[i].Public()
+		}
+		s.writeJSON(w, http.StatusOK, users)
+	case http.MethodPost:
+		var req struct {
+			Username string     `json:"username"`
+			Email    string     `json:"email"`
+			Password string     `json:"password"`
+			Role     types.Role `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		u, err := s.auth.CreateUser(req.Username, req.Email, req.Password, req.Role)
+		if err != nil {
+			s.writeUserError(w, err)
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created user %q (%s)", u.Username, u.Role))
+		s.writeJSON(w, http.StatusCreated, u.Public())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Update User
+// @Route: POST /api/users/update?id=...
+// @Description: Change a user's email, role, or disabled flag (admin only)
+// @Response: {"id": "...", "username": "...", "role": "...", "disabled": false}
+func (s *Service) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	var req struct {
+		Email    *string     `json:"email"`
+		Role     *types.Role `json:"role"`
+		Disabled *bool       `json:"disabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if req.Role != nil && !req.Role.Valid() {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid role %q", *req.Role))
+		return
+	}
+	if me, ok := auth.UserFromContext(r.Context()); ok && me.ID == id {
+		if (req.Role != nil && *req.Role != types.RoleAdmin) || (req.Disabled != nil && *req.Disabled) {
+			s.writeError(w, http.StatusBadRequest, "admins cannot demote or disable themselves")
+			return
+		}
+	}
+
+	u, err := s.auth.UpdateUser(id, func(u *types.User) {
+		if req.Email != nil {
+			u.Email = *req.Email
+		}
+		if req.Role != nil {
+			u.Role = *req.Role
+		}
+		if req.Disabled != nil {
+			u.Disabled = *req.Disabled
+		}
+	})
+	if err != nil {
+		s.writeUserError(w, err)
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated user %q", u.Username))
+	s.writeJSON(w, http.StatusOK, u.Public())
+}
+
+// @Title: Delete User
+// @Route: DELETE|POST /api/users/delete?id=...
+// @Description: Delete an account on every node (admin only)
+// @Response: 204 No Content
+func (s *Service) HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+	if me, ok := auth.UserFromContext(r.Context()); ok && me.ID == id {
+		s.writeError(w, http.StatusBadRequest, "admins cannot delete themselves")
+		return
+	}
+
+	if err := s.auth.DeleteUser(id); err != nil {
+		s.writeUserError(w, err)
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Deleted user %s", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Password Reset Link
+// @Route: POST /api/users/reset?id=...
+// @Description: Issue a one-hour password reset link for a user (admin only)
+// @Response: {"url": "...", "expires_at": "..."}
+func (s *Service) HandleCreateReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	token, expires, err := s.auth.CreateReset(id, currentUsername(r))
+	if err != nil {
+		s.writeUserError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":        loginURL(r, "reset", token),
+		"expires_at": expires,
+	})
+}
+
+// @Title: Reset Password
+// @Route: POST /api/auth/reset
+// @Description: Set a new password using a reset token
+// @Response: 204 No Content
+func (s *Service) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := s.auth.ResetPassword(req.Token, req.Password); err != nil {
+		s.writeUserError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: List or Create Invites
+// @Route: GET|POST /api/auth/invites
+// @Description: List pending invitations, or create a 72-hour invitation link for an email and role (admin only)
+// @Response: {"url": "...", "email": "...", "role": "...", "expires_at": "..."}
+func (s *Service) HandleInvites(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := s.store.ListTokens(hosts.TokenInvite)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		type invite struct {
+			Email     string     `json:"email"`
+			Role      types.Role `json:"role"`
+			CreatedBy string     `json:"created_by"`
+			ExpiresAt time.Time  `json:"expires_at"`
+		}
+		invites := make([]invite, 0, len(tokens))
+		for _, t := range tokens {
+			invites = append(invites, invite{Email: t.Email, Role: t.Role, CreatedBy: t.CreatedBy, ExpiresAt: t.ExpiresAt})
+		}
+		s.writeJSON(w, http.StatusOK, invites)
+	case http.MethodPost:
+		var req struct {
+			Email string     `json:"email"`
+			Role  types.Role `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if req.Role == "" {
+			req.Role = types.RoleViewer
+		}
+
+		token, expires, err := s.auth.CreateInvite(req.Email, req.Role, currentUsername(r))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created %s invite for %s", req.Role, req.Email))
+		s.writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"url":        loginURL(r, "invite", token),
+			"email":      req.Email,
+			"role":       req.Role,
+			"expires_at": expires,
+		})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Accept Invite
+// @Route: POST /api/auth/invite/accept
+// @Description: Create an account from an invitation token and sign in
+// @Response: {"id": "...", "username": "...", "role": "..."}
+func (s *Service) HandleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	u, err := s.auth.AcceptInvite(req.Token, req.Username, req.Password)
+	if err != nil {
+		s.writeUserError(w, err)
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: User %q accepted an invite (%s)", u.Username, u.Role))
+	s.startSession(w, r, req.Username, req.Password)
+}
+
+// @Title: Sync Users
+// @Route: POST /api/users/sync
+// @Description: Receive replicated user records from a peer (requires X-NSM-Signature HMAC with the cluster secret)
+// @Response: 204 No Content
+func (s *Service) HandleSyncUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 4<<20))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read body")
+		return
+	}
+	if !s.auth.VerifySignature(body, r.Header.Get(auth.SignatureHeader)) {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected user sync from %s (bad or missing signature)", r.RemoteAddr))
+		s.writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	var users []types.User
+	if err := json.Unmarshal(body, &users); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	changed, err := s.auth.MergeUsers(users)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if changed > 0 {
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Merged %d user records from peer %s", changed, r.RemoteAddr))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, hosts.ErrUserNotFound):
+		s.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, hosts.ErrUserExists):
+		s.writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, hosts.ErrTokenNotFound):
+		s.writeError(w, http.StatusGone, err.Error())
+	default:
+		s.writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func currentUsername(r *http.Request) string {
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		return u.Username
+	}
+	return ""
+}
+
+// loginURL builds a link to the login page carrying an invite or reset
+// token, using the host the admin reached this node on.
+func loginURL(r *http.Request, param, token string) string {
+	return fmt.Sprintf("%s/login?%s=%s", baseURL(r), param, url.QueryEscape(token))
+}
+
+// baseURL returns the scheme and host the client used to reach this node.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
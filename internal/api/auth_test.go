@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleAuthBootstrap(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	body := `{"username":"admin","password":"admin-password"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/bootstrap", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	svc.HandleAuthBootstrap(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.SessionCookie {
+			session = c
+		}
+	}
+	if session == nil || session.Value == "" {
+		t.Fatalf("Expected session cookie to be set")
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("password")) {
+		t.Errorf("Expected response not to include the password hash: %s", w.Body.String())
+	}
+
+	// A second bootstrap must be refused.
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/bootstrap", bytes.NewBufferString(body))
+	w = httptest.NewRecorder()
+	svc.HandleAuthBootstrap(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for second bootstrap, got %d", w.Code)
+	}
+
+	// Wrong password is rejected.
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login",
+		bytes.NewBufferString(`{"username":"admin","password":"nope-nope"}`))
+	w = httptest.NewRecorder()
+	svc.HandleLogin(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for bad password, got %d", w.Code)
+	}
+}
+
+func TestHandleSyncUsers_RejectsBadSignature(t *testing.T) {
+	t.Setenv("NSM_CLUSTER_SECRET", "shared-secret")
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	payload := []byte(`[{"id":"u1","username":"intruder","role":"admin"}]`)
+	req := httptest.NewRequest(http.MethodPost, "/api/users/sync", bytes.NewReader(payload))
+	req.Header.Set(auth.SignatureHeader, "deadbeef")
+	w := httptest.NewRecorder()
+	svc.HandleSyncUsers(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for bad signature, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/users/sync", bytes.NewReader(payload))
+	req.Header.Set(auth.SignatureHeader, svc.Auth().Sign(payload))
+	w = httptest.NewRecorder()
+	svc.HandleSyncUsers(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 for signed sync, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleMeTable(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	u, err := svc.Auth().CreateUser("wall", "", "wall-password", types.RoleViewer)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u, _ = svc.Auth().UpdatePrefs(u.ID, types.UserPrefs{Theme: "light"})
+	as := func(r *http.Request) *http.Request {
+		return r.WithContext(auth.WithUser(r.Context(), u))
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleMeTable(w, as(httptest.NewRequest(http.MethodPost, "/api/auth/me/table",
+		bytes.NewBufferString(`{"columns": ["name", "notes"], "density": "large", "refresh_seconds": 30}`))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	saved, err := store.GetUser(u.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if saved.Prefs.Theme != "light" || saved.Prefs.Table.Density != "large" || len(saved.Prefs.Table.Columns) != 2 {
+		t.Errorf("Expected table prefs stored beside the theme, got %+v", saved.Prefs)
+	}
+
+	for _, body := range []string{
+		`{"columns": ["uptime"]}`,
+		`{"density": "tiny"}`,
+		`{"refresh_seconds": 1}`,
+	} {
+		w = httptest.NewRecorder()
+		svc.HandleMeTable(w, as(httptest.NewRequest(http.MethodPost, "/api/auth/me/table", bytes.NewBufferString(body))))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleMeTable(w, httptest.NewRequest(http.MethodGet, "/api/auth/me/table", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 when not signed in, got %d", w.Code)
+	}
+}
@@ -2,21 +2,29 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"nexsign.mini/nsm/internal/announce"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/bandwidth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/tracing"
 	"nexsign.mini/nsm/internal/types"
 )
 
 // @Title: Export Internal Backup
 // @Route: POST /api/hosts/export/internal
-// @Description: Create internal backup of host list
+// @Description: Create internal backup of host list. A node whose store is kept in memory answers 409
 // @Response: {"status": "ok", "path": "..."}
 func (s *Service) HandleExportInternal(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -25,13 +33,17 @@ func (s *Service) HandleExportInternal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	backupPath, err := s.store.BackupCurrent(100) // Keep up to 100 backups
+	if errors.Is(err, hosts.ErrInMemory) {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
 	if err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to create internal backup: %v", err))
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to create internal backup: %v", err))
 		s.writeError(w, http.StatusInternalServerError, "Failed to save internal backup")
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Created internal backup at: %s", backupPath))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created internal backup at: %s", backupPath))
 	s.writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
 		"path":   backupPath,
@@ -39,40 +51,49 @@ func (s *Service) HandleExportInternal(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Title: Download Host List
-// @Route: GET /api/hosts/export/download
-// @Description: Download host list as JSON file
-// @Response: application/json file download
+// @Route: GET /api/hosts/export/download?format=json|yaml|csv
+// @Description: Download host list as a JSON (default), YAML, or CSV file
+// @Response: File download in the requested format
 func (s *Service) HandleExportDownload(w http.ResponseWriter, r *http.Request) {
+	format, err := hostFormat(r.URL.Query().Get("format"), "")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	allHosts := s.store.GetAll()
-	
-	hostListJSON, err := json.MarshalIndent(allHosts, "", "  ")
+
+	hostList, err := encodeHosts(allHosts, format)
 	if err != nil {
 		http.Error(w, "Failed to marshal host list", http.StatusInternalServerError)
 		return
 	}
 
-	filename := fmt.Sprintf("nsm-hosts-%s.json", time.Now().Format("2006-01-02"))
-	w.Header().Set("Content-Type", "application/json")
+	filename := fmt.Sprintf("nsm-hosts-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", formatContentType(format))
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	w.Write(hostListJSON)
-	s.logger.Info(fmt.Sprintf("API: Served host list download: %s", filename))
+	w.Write(hostList)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Served host list download: %s", filename))
 }
 
 // @Title: Import Internal Backup
 // @Route: GET|POST /api/hosts/import/internal
-// @Description: Restore from most recent internal backup
+// @Description: Restore from most recent internal backup. A node whose store is kept in memory answers 409
 // @Response: {"status": "ok", "source": "..."}
 func (s *Service) HandleImportInternal(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.holdForApproval(w, r, auth.ApprovalImport, s.HandleImportInternal) {
+		return
+	}
 
 	// Find the most recent backup
 	backupDir := "backups"
 	entries, err := os.ReadDir(backupDir)
 	if err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to read backup directory: %v", err))
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to read backup directory: %v", err))
 		http.Error(w, "No backups found", http.StatusNotFound)
 		return
 	}
@@ -113,13 +134,18 @@ func (s *Service) HandleImportInternal(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fullPath := filepath.Join(backupDir, latestBackup)
-	if err := s.store.RestoreFrom(fullPath); err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to restore from %s: %v", fullPath, err))
+	err = s.store.RestoreFrom(fullPath)
+	if errors.Is(err, hosts.ErrInMemory) {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to restore from %s: %v", fullPath, err))
 		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Restore failed: %v", err))
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Restored host list from %s", fullPath))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Restored host list from %s", fullPath))
 	s.writeJSON(w, http.StatusOK, map[string]string{
 		"status": "ok",
 		"source": latestBackup,
@@ -127,34 +153,48 @@ func (s *Service) HandleImportInternal(w http.ResponseWriter, r *http.Request) {
 }
 
 // @Title: Upload Host List
-// @Route: POST /api/hosts/import/upload
-// @Description: Upload and restore from JSON file
+// @Route: POST /api/hosts/import/upload?format=json|yaml|csv
+// @Description: Upload and restore from a JSON, YAML, or CSV file (format also inferred from Content-Type)
 // @Response: 204 No Content
 func (s *Service) HandleImportUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.holdForApproval(w, r, auth.ApprovalImport, s.HandleImportUpload) {
+		return
+	}
 
-	var hosts []types.Host
-	if err := json.NewDecoder(r.Body).Decode(&hosts); err != nil {
-		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+	format, err := hostFormat(r.URL.Query().Get("format"), r.Header.Get("Content-Type"))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hosts, err := decodeHosts(r.Body, format)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := s.store.ReplaceAll(hosts); err != nil {
+	_, sp := tracing.Start(r.Context(), "store.ReplaceAll", tracing.Internal)
+	sp.SetAttr("hosts.count", len(hosts))
+	err = s.store.ReplaceAll(hosts)
+	sp.SetError(err)
+	sp.End()
+	if err != nil {
 		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to replace hosts: %v", err))
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Imported %d hosts from upload", len(hosts)))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Imported %d hosts from %s upload", len(hosts), format))
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // @Title: List Backups
 // @Route: GET /api/backups/list
-// @Description: List all available backup files
-// @Response: [{"filename": "...", "timestamp": "...", "size": ...}]
+// @Description: List all available backup files, newest first, with the number of hosts in each database backup
+// @Response: [{"filename": "hosts-1767225600.db", "timestamp": "...", "size": 98304, "host_count": 42}]
 func (s *Service) HandleBackupsList(w http.ResponseWriter, r *http.Request) {
 	backupDir := "backups"
 	entries, err := os.ReadDir(backupDir)
@@ -167,6 +207,7 @@ func (s *Service) HandleBackupsList(w http.ResponseWriter, r *http.Request) {
 		Filename  string    `json:"filename"`
 		Timestamp time.Time `json:"timestamp"`
 		Size      int64     `json:"size"`
+		HostCount *int      `json:"host_count,omitempty"` // Unset for files that cannot be read
 	}
 
 	var backups []BackupFile
@@ -184,29 +225,172 @@ func (s *Service) HandleBackupsList(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 
-		backups = append(backups, BackupFile{
+		b := BackupFile{
 			Filename:  name,
 			Timestamp: info.ModTime(),
 			Size:      info.Size(),
-		})
+		}
+		if n, err := hosts.CountBackupHosts(filepath.Join(backupDir, name)); err == nil {
+			b.HostCount = &n
+		}
+		backups = append(backups, b)
 	}
 
-	// Sort by timestamp desc
-	// (Skipping sort implementation for brevity, client can sort)
-	
-	s.logger.Info("API: List backups")
+	slices.SortFunc(backups, func(a, b BackupFile) int { return b.Timestamp.Compare(a.Timestamp) })
+
+	s.logger.InfoContext(r.Context(), "API: List backups")
 	s.writeJSON(w, http.StatusOK, backups)
 }
 
+// @Title: Download Database
+// @Route: GET /api/backups/download
+// @Description: Download a consistent copy of the node database (hosts.db) with every table, streamed from a temporary file rather than held in memory. Content-Length is set so clients can show progress. The copy includes password hashes and sealed credentials, so only admins may download it
+// @Response: File download (application/vnd.sqlite3)
+func (s *Service) HandleBackupDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	export, err := s.store.OpenExport()
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to export database: %v", err))
+		s.writeError(w, http.StatusInternalServerError, "Failed to export database")
+		return
+	}
+	defer export.Close()
+
+	filename := fmt.Sprintf("nsm-hosts-%s.db", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Content-Length", fmt.Sprint(export.Size()))
+
+	start := time.Now()
+	auth.AnnotateAudit(r, filename, fmt.Sprintf("%d bytes", export.Size()))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Streaming database download %s (%d bytes)", filename, export.Size()))
+	n, err := io.Copy(w, export)
+	if err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Database download %s stopped after %d of %d bytes: %v", filename, n, export.Size(), err))
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Served database download %s in %s", filename, time.Since(start).Round(time.Millisecond)))
+}
+
+// @Title: Preview Backup
+// @Route: GET /api/backups/preview?file=...
+// @Description: List the hosts in a backup file without restoring it, to check a backup before restoring it. The file is opened read-only
+// @Response: {"filename": "hosts-1767225600.db", "timestamp": "...", "size": 98304, "host_count": 1, "hosts": [{"id": "...", "nickname": "Lobby", "hostname": "lobby-pi", "ip_address": "192.168.1.20", "status": "healthy", "last_checked": "..."}]}
+func (s *Service) HandleBackupPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filename := filepath.Base(r.URL.Query().Get("file"))
+	if filename == "." || filename == "/" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'file' parameter")
+		return
+	}
+	fullPath := filepath.Join("backups", filename)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Backup not found")
+		return
+	}
+
+	list, err := hosts.ReadBackup(fullPath)
+	if err != nil {
+		if errors.Is(err, hosts.ErrInvalidSnapshot) {
+			s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, struct {
+		Filename  string             `json:"filename"`
+		Timestamp time.Time          `json:"timestamp"`
+		Size      int64              `json:"size"`
+		HostCount int                `json:"host_count"`
+		Hosts     []hosts.BackupHost `json:"hosts"`
+	}{filename, info.ModTime(), info.Size(), len(list), list})
+}
+
+// maxDatabaseUpload bounds an uploaded database.
+const maxDatabaseUpload = 256 << 20
+
+// @Title: Upload Database
+// @Route: POST /api/backups/upload
+// @Description: Replace the node database with an uploaded .db file, such as one from GET /api/backups/download or the backups directory of another node. Send it as the multipart field file or as the raw body. It must be an intact SQLite database with a host list, of at most 256 MB. The current database is moved into backups first. Only admins may upload, as the database holds users and settings too. A node whose store is kept in memory answers 409
+// @Response: {"status": "ok", "backup": "/opt/nsm/backups/hosts-1767225600.db"}
+func (s *Service) HandleDatabaseUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.holdForApproval(w, r, auth.ApprovalRestore, s.HandleDatabaseUpload) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDatabaseUpload)
+	var body io.Reader = r.Body
+	name := "request body"
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid multipart body")
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, "Missing 'file' field")
+				return
+			}
+			if part.FormName() == "file" {
+				body, name = part, part.FileName()
+				break
+			}
+		}
+	}
+
+	backupPath, err := s.store.ImportSnapshot(body, 100) // Keep up to 100 backups, as internal backups do
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		s.writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Database uploads are limited to %d MB", maxDatabaseUpload>>20))
+		return
+	case errors.Is(err, hosts.ErrInvalidSnapshot):
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, hosts.ErrInMemory):
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to import uploaded database: %v", err))
+		s.writeError(w, http.StatusInternalServerError, "Import failed")
+		return
+	}
+
+	auth.AnnotateAudit(r, name, "previous database saved as "+filepath.Base(backupPath))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Imported uploaded database %s (previous database saved to %s)", name, backupPath))
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"status": "ok",
+		"backup": backupPath,
+	})
+}
+
 // @Title: Restore Backup
 // @Route: POST /api/backups/restore?file=...
-// @Description: Restore from a specific backup file
+// @Description: Restore from a specific backup file. A node whose store is kept in memory answers 409
 // @Response: 204 No Content
 func (s *Service) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.holdForApproval(w, r, auth.ApprovalRestore, s.HandleRestoreBackup) {
+		return
+	}
 
 	filename := r.URL.Query().Get("file")
 	if filename == "" {
@@ -218,13 +402,18 @@ func (s *Service) HandleRestoreBackup(w http.ResponseWriter, r *http.Request) {
 	filename = filepath.Base(filename)
 	fullPath := filepath.Join("backups", filename)
 
-	if err := s.store.RestoreFrom(fullPath); err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to restore backup %s: %v", filename, err))
+	err := s.store.RestoreFrom(fullPath)
+	if errors.Is(err, hosts.ErrInMemory) {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to restore backup %s: %v", filename, err))
 		s.writeError(w, http.StatusInternalServerError, "Restore failed")
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Restored backup: %s", filename))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Restored backup: %s", filename))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -247,7 +436,8 @@ func (s *Service) HandleProxyAnthias(w http.ResponseWriter, r *http.Request) {
 		targetPath = "/" + targetPath
 	}
 	
-	targetURL := fmt.Sprintf("http://%s%s", targetIP, targetPath)
+	// Fall back to the VPN path when the LAN path is down
+	targetURL := fmt.Sprintf("http://%s%s", s.store.ResolveAddress(targetIP), targetPath)
 	
 	// Create proxy request
 	proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
@@ -262,10 +452,17 @@ func (s *Service) HandleProxyAnthias(w http.ResponseWriter, r *http.Request) {
 		if k == "Host" || k == "Content-Length" {
 			continue
 		}
+		// Never forward dashboard credentials to the device
+		if k == "Cookie" || k == "Authorization" || k == auth.CSRFHeader {
+			continue
+		}
 		proxyReq.Header[k] = v
 	}
+	if user, pass, ok := s.anthiasBasicAuth(targetIP); ok {
+		proxyReq.SetBasicAuth(user, pass)
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := s.bandwidth.Client(bandwidth.OpProxy, 10*time.Second)
 	resp, err := client.Do(proxyReq)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Proxy error: %v", err), http.StatusBadGateway)
@@ -286,14 +483,14 @@ func (s *Service) HandleProxyAnthias(w http.ResponseWriter, r *http.Request) {
 	// Let's log only if it's NOT a GET, or maybe just debug level if we had it.
 	// Since we only have Info/Warning/Error, let's log non-GETs.
 	if r.Method != http.MethodGet {
-		s.logger.Info(fmt.Sprintf("Proxied %s request to %s", r.Method, targetIP))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Proxied %s request to %s", r.Method, targetIP))
 	}
 }
 
 // @Title: Receive Hosts
 // @Route: POST /api/hosts/receive
-// @Description: Receive pushed host list from another host
-// @Response: 204 No Content
+// @Description: Receive pushed host list from another host. The push must be signed by a node whose key this node pinned from its heartbeats; other pushes, from older versions, unknown nodes or anyone else, are quarantined host by host like announcements and answered 202. With merge=true each host is merged; otherwise the list is replaced, except that hosts edited here while no peer was reachable are merged and kept. No host may change another node's address or hostname
+// @Response: 204 No Content, or 202 {"status": "quarantined", "hosts": 3}
 func (s *Service) HandleReceiveHosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -305,6 +502,25 @@ func (s *Service) HandleReceiveHosts(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
+	for _, h := range receivedHosts {
+		if err := announce.Validate(h); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	peer, ok := auth.PeerFromContext(r.Context())
+	if !ok {
+		s.quarantinePush(w, r, receivedHosts)
+		return
+	}
+	for _, h := range receivedHosts {
+		if err := announce.CheckIdentity(s.store, peer.NodeID, h); err != nil {
+			s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected host list from %s: %v", peer.NodeID, err))
+			s.writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
 
 	shouldMerge := r.URL.Query().Get("merge") == "true"
 
@@ -314,26 +530,44 @@ func (s *Service) HandleReceiveHosts(w http.ResponseWriter, r *http.Request) {
 			// If we receive a host, we should probably check its health from our perspective
 			// rather than trusting the sender blindly, but for now we accept the data
 			// and maybe trigger a check.
-			if err := s.store.Upsert(h); err != nil {
-				s.logger.Error(fmt.Sprintf("Failed to merge host %s: %v", h.IPAddress, err))
+			if err := s.mergeHost(r.Context(), h, peer.NodeID); err != nil {
+				s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to merge host %s: %v", h.IPAddress, err))
 			}
 		}
-		s.logger.Info(fmt.Sprintf("API: Merged %d hosts from peer", len(receivedHosts)))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Merged %d hosts from peer", len(receivedHosts)))
 	} else {
-		// Replace all logic
-		if err := s.store.ReplaceAll(receivedHosts); err != nil {
+		// Replace all logic, keeping hosts edited here while isolated
+		conflicts, err := s.store.ReplaceFromPeer(receivedHosts)
+		if err != nil {
 			s.writeError(w, http.StatusInternalServerError, "Failed to replace hosts")
 			return
 		}
-		s.logger.Info(fmt.Sprintf("API: Replaced host list with %d hosts from peer", len(receivedHosts)))
+		s.reportConflicts(conflicts, peer.NodeID)
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Replaced host list with %d hosts from peer", len(receivedHosts)))
 	}
+	s.store.RecordReceive(peer.NodeID, time.Now())
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// quarantinePush holds each host of a list pushed without a peer's
+// signature for an admin to approve, as announcements are held.
+func (s *Service) quarantinePush(w http.ResponseWriter, r *http.Request, list []types.Host) {
+	now := time.Now().UTC()
+	for _, h := range list {
+		q := hosts.Quarantined{RemoteAddr: r.RemoteAddr, Reason: "unsigned host list", Host: h, ReceivedAt: now}
+		if err := announce.Quarantine(s.store, q); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Quarantined host list of %d hosts from %s", len(list), r.RemoteAddr))
+	s.writeJSON(w, http.StatusAccepted, map[string]any{"status": "quarantined", "hosts": len(list)})
+}
+
 // @Title: Push Hosts
 // @Route: POST /api/hosts/push
-// @Description: Push current host list to all other hosts
+// @Description: Push current host list to all other hosts, or to the IPs in targets, or to the hosts in a saved view ({"view": "..."})
 // @Response: 204 No Content
 func (s *Service) HandlePushHosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -344,6 +578,7 @@ func (s *Service) HandlePushHosts(w http.ResponseWriter, r *http.Request) {
 	// Optional: list of specific targets
 	var req struct {
 		Targets []string `json:"targets"`
+		View    string   `json:"view"`
 	}
 	json.NewDecoder(r.Body).Decode(&req) // Ignore error, optional
 
@@ -352,7 +587,18 @@ func (s *Service) HandlePushHosts(w http.ResponseWriter, r *http.Request) {
 	
 	// Filter targets
 	var targets []string
-	if len(req.Targets) > 0 {
+	if req.View != "" {
+		ids, status, err := s.viewTargets(r, req.View)
+		if err != nil {
+			s.writeError(w, status, err.Error())
+			return
+		}
+		for _, h := range allHosts {
+			if slices.Contains(ids, h.ID) && h.IPAddress != "127.0.0.1" && h.IPAddress != myIP {
+				targets = append(targets, h.IPAddress)
+			}
+		}
+	} else if len(req.Targets) > 0 {
 		targets = req.Targets
 	} else {
 		for _, h := range allHosts {
@@ -363,26 +609,49 @@ func (s *Service) HandlePushHosts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func() {
-		s.logger.Info(fmt.Sprintf("API: Pushing host list to %d targets...", len(targets)))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Pushing host list to %d targets...", len(targets)))
 		
 		payload, _ := json.Marshal(allHosts)
-		client := http.Client{Timeout: 5 * time.Second}
+		client := s.bandwidth.Client(bandwidth.OpSync, 5*time.Second)
 
 		for _, target := range targets {
-			url := fmt.Sprintf("http://%s:8080/api/hosts/receive", target)
-			resp, err := client.Post(url, "application/json", bytes.NewBuffer(payload))
-			if err != nil {
-				s.logger.Error(fmt.Sprintf("Failed to push to %s: %v", target, err))
-			} else {
-				resp.Body.Close()
+			if err := s.pushHostList(client, target, payload); err != nil {
+				s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to push to %s: %v", target, err))
 			}
 		}
-		s.logger.Info("API: Push complete")
+		s.logger.InfoContext(r.Context(), "API: Push complete")
 	}()
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// pushHostList replaces the host list of the host at target with payload,
+// recording the outcome for the sync status if target is in the list.
+func (s *Service) pushHostList(client *http.Client, target string, payload []byte) error {
+	url := fmt.Sprintf("http://%s:8080/api/hosts/receive", s.store.ResolveAddress(target))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.auth.PeerSigner().Sign(req, payload)
+	resp, err := client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNoContent:
+		case http.StatusAccepted:
+			err = errors.New("quarantined; the host has not pinned this node's key from a heartbeat yet")
+		default:
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+	}
+	if h, ok := s.hostAt(target); ok {
+		s.store.RecordPush(h.ID, time.Now(), err)
+	}
+	return err
+}
+
 // @Title: Reboot Host
 // @Route: POST /api/hosts/reboot
 // @Description: Reboot a host (forwarded if not local)
@@ -392,6 +661,9 @@ func (s *Service) HandleRebootHost(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.holdForApproval(w, r, auth.ApprovalReboot, s.HandleRebootHost) {
+		return
+	}
 
 	var req struct {
 		TargetIP string `json:"target_ip"`
@@ -400,6 +672,7 @@ func (s *Service) HandleRebootHost(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
+	auth.AnnotateAudit(r, req.TargetIP, "reboot")
 
 	// If target is us (or empty/localhost), reboot us
 	// Otherwise forward
@@ -414,11 +687,10 @@ func (s *Service) HandleRebootHost(w http.ResponseWriter, r *http.Request) {
 	// Forwarding logic
 	if req.TargetIP != "" && req.TargetIP != "127.0.0.1" && req.TargetIP != os.Getenv("NSM_HOST_IP") {
 		// Forward
-		url := fmt.Sprintf("http://%s:8080/api/hosts/reboot", req.TargetIP)
+		url := fmt.Sprintf("http://%s:8080/api/hosts/reboot", s.store.ResolveAddress(req.TargetIP))
 		// ...
-		s.logger.Info(fmt.Sprintf("Forwarding reboot request to %s", req.TargetIP))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Forwarding reboot request to %s", req.TargetIP))
 		// Actually perform the request
-		client := http.Client{Timeout: 5 * time.Second}
 		// We need to send the request to the target, but target expects the same body?
 		// Or maybe target checks if it's local.
 		// Let's just send empty body if target checks "is this me?"
@@ -427,7 +699,7 @@ func (s *Service) HandleRebootHost(w http.ResponseWriter, r *http.Request) {
 		
 		// Re-marshal
 		body, _ := json.Marshal(req)
-		resp, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+		resp, err := s.postForward(r.Context(), url, body, 5*time.Second)
 		if err != nil {
 			s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to forward: %v", err))
 			return
@@ -437,30 +709,20 @@ func (s *Service) HandleRebootHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Local reboot
-	s.logger.Info("API: Rebooting system...")
-	// exec.Command("reboot").Run() // Dangerous to auto-run in dev
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// @Title: Upgrade Host
-// @Route: POST /api/hosts/upgrade
-// @Description: Run package upgrade on a host (forwarded if not local)
-// @Response: 204 No Content
-func (s *Service) HandleUpgradeHost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	// Similar to reboot...
-	s.logger.Info("System upgrade requested")
+	// Local reboot. Answer first: the reboot takes this server down.
+	s.logger.InfoContext(r.Context(), "API: Rebooting system...")
 	w.WriteHeader(http.StatusNoContent)
+	go func() {
+		time.Sleep(rebootDelay)
+		if out, err := runUpgradeCommand(context.Background(), rebootCommand); err != nil {
+			s.logger.ErrorContext(r.Context(), fmt.Sprintf("API: Reboot failed: %v: %s", err, lastLine(string(out))))
+		}
+	}()
 }
 
 // @Title: Announce Host
 // @Route: POST /api/hosts/announce
-// @Description: Announce presence to a peer
+// @Description: Announce a host to a peer, signed by the sending node. Announcements that are unsigned or from a node whose key is not pinned by a heartbeat are quarantined for approval (202); no node may change another node's address or hostname
 // @Response: 204 No Content
 func (s *Service) HandleAnnounceHost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -468,44 +730,68 @@ func (s *Service) HandleAnnounceHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var host types.Host
-	if err := json.NewDecoder(r.Body).Decode(&host); err != nil {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxAnnouncementSize))
+	if err != nil {
 		s.writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	if host.ID == "" || host.IPAddress == "" {
-		s.writeError(w, http.StatusBadRequest, "Host ID and IP address are required")
+	a, err := announce.Accept(s.store, data, r.RemoteAddr, time.Now().UTC())
+	switch {
+	case errors.Is(err, announce.ErrQuarantined):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Quarantined announcement of %s (ID: %s) from %s", a.Host.IPAddress, a.Host.ID, r.RemoteAddr))
+		s.writeJSON(w, http.StatusAccepted, map[string]string{"status": "quarantined"})
+		return
+	case errors.Is(err, announce.ErrBadSignature), errors.Is(err, announce.ErrKeyMismatch), errors.Is(err, announce.ErrIdentityChange):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected announcement from %s: %v", r.RemoteAddr, err))
+		s.writeError(w, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		s.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := s.store.Upsert(host); err != nil {
-		s.logger.Error(fmt.Sprintf("Failed to upsert announced host: %v", err))
+	// A node announcing itself is alive, and if at a new address it has
+	// moved, e.g. to a new DHCP lease.
+	if a.Host.ID == a.SenderID {
+		s.store.ResetBackoff(a.Host.ID)
+		s.followHost(a.Host.ID, a.Host.IPAddress, "announcement")
+	}
+
+	if err := s.mergeHost(r.Context(), a.Host, a.SenderID); err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to upsert announced host: %v", err))
 		s.writeError(w, http.StatusInternalServerError, "Failed to upsert host")
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Received host announcement: %s (ID: %s)", host.IPAddress, host.ID))
+	s.store.RecordReceive(a.SenderID, time.Now())
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Received host announcement: %s (ID: %s) from %s", a.Host.IPAddress, a.Host.ID, a.SenderID))
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// @Title: Lock Host
-// @Route: POST /api/hosts/lock
-// @Description: Lock a host for editing
-// @Response: 204 No Content
-func (s *Service) HandleLockHost(w http.ResponseWriter, r *http.Request) {
-	// This requires access to s.editLocks which was in Server.
-	// We might need to move editLocks to Service or Store.
-	// For now, stubbing.
-	s.logger.Info("API: Lock host requested (handled by web server)")
-	w.WriteHeader(http.StatusNoContent)
+// mergeHost applies a host record received from a peer (from), keeping
+// the newest edit of each field. Fields both sides edited concurrently are
+// logged and written to the audit log.
+func (s *Service) mergeHost(ctx context.Context, h types.Host, from string) error {
+	_, sp := tracing.Start(ctx, "store.Merge", tracing.Internal)
+	defer sp.End()
+	sp.SetAttr("host.id", h.ID)
+	sp.SetAttr("peer.id", from)
+	conflicts, err := s.store.Merge(h)
+	sp.SetAttr("merge.conflicts", len(conflicts))
+	sp.SetError(err)
+	s.reportConflicts(conflicts, from)
+	return err
 }
 
-// @Title: Unlock Host
-// @Route: POST /api/hosts/unlock
-// @Description: Unlock a host
-// @Response: 204 No Content
-func (s *Service) HandleUnlockHost(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("API: Unlock host requested (handled by web server)")
-	w.WriteHeader(http.StatusNoContent)
+// reportConflicts logs concurrent edits found merging hosts received from
+// a peer and writes them to the audit log.
+func (s *Service) reportConflicts(conflicts []hosts.FieldConflict, from string) {
+	for _, c := range conflicts {
+		detail := fmt.Sprintf("%s edited on %s and %s: kept %q, dropped %q (received from %s)",
+			c.Field, c.KeptBy, c.LostBy, c.Kept, c.Lost, from)
+		s.logger.Warning(fmt.Sprintf("API: Concurrent edits to host %s: %s", c.HostID, detail))
+		s.store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem,
+			Action: hosts.AuditMergeConflict, Target: c.HostID, Detail: detail})
+	}
 }
@@ -1,12 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
 )
 
 func TestHandleBackupsList(t *testing.T) {
@@ -50,6 +59,71 @@ func TestHandleBackupsList(t *testing.T) {
 	}
 }
 
+func TestHandleBackupPreview(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	store.Add(types.Host{ID: "b", IPAddress: "192.168.1.10", Nickname: "Cafe"})
+
+	backupDir := "backups"
+	os.MkdirAll(backupDir, 0755)
+	defer os.RemoveAll(backupDir)
+	export, err := store.OpenExport()
+	if err != nil {
+		t.Fatalf("OpenExport: %v", err)
+	}
+	out, _ := os.Create(filepath.Join(backupDir, "hosts-1767225600.db"))
+	io.Copy(out, export)
+	out.Close()
+	export.Close()
+	os.WriteFile(filepath.Join(backupDir, "hosts-1767225601.json"), []byte("[]"), 0644)
+
+	w := httptest.NewRecorder()
+	svc.HandleBackupsList(w, httptest.NewRequest(http.MethodGet, "/api/backups/list", nil))
+	var list []struct {
+		Filename  string `json:"filename"`
+		HostCount *int   `json:"host_count"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	for _, b := range list {
+		switch b.Filename {
+		case "hosts-1767225600.db":
+			if b.HostCount == nil || *b.HostCount != 2 {
+				t.Errorf("Expected 2 hosts counted in the database backup, got %v", b.HostCount)
+			}
+		case "hosts-1767225601.json":
+			if b.HostCount != nil {
+				t.Errorf("Expected no count for a JSON backup, got %d", *b.HostCount)
+			}
+		}
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleBackupPreview(w, httptest.NewRequest(http.MethodGet, "/api/backups/preview?file=../backups/hosts-1767225600.db", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var preview struct {
+		HostCount int `json:"host_count"`
+		Hosts     []struct {
+			Nickname  string `json:"nickname"`
+			IPAddress string `json:"ip_address"`
+		} `json:"hosts"`
+	}
+	json.NewDecoder(w.Body).Decode(&preview)
+	if preview.HostCount != 2 || preview.Hosts[0].Nickname != "Cafe" || preview.Hosts[1].IPAddress != "192.168.1.20" {
+		t.Errorf("Expected both hosts by IP, got %+v", preview)
+	}
+
+	for file, want := range map[string]int{"hosts-1767225601.json": http.StatusUnprocessableEntity, "missing.db": http.StatusNotFound} {
+		w = httptest.NewRecorder()
+		svc.HandleBackupPreview(w, httptest.NewRequest(http.MethodGet, "/api/backups/preview?file="+file, nil))
+		if w.Code != want {
+			t.Errorf("Expected %d for %s, got %d", want, file, w.Code)
+		}
+	}
+}
+
 func TestHandleExportInternal(t *testing.T) {
 	svc, _, cleanup := setupTest(t)
 	defer cleanup()
@@ -88,3 +162,214 @@ func TestHandleExportDownload(t *testing.T) {
 		t.Errorf("Expected Content-Type application/json, got %s", resp.Header.Get("Content-Type"))
 	}
 }
+
+func TestHandleBackupDownload(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleBackupDownload(w, httptest.NewRequest(http.MethodGet, "/api/backups/download", nil))
+	resp := w.Result()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status OK, got %v", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Length"); got != strconv.Itoa(w.Body.Len()) {
+		t.Errorf("Expected Content-Length %d, got %s", w.Body.Len(), got)
+	}
+	if !strings.HasPrefix(w.Body.String(), "SQLite format 3\x00") {
+		t.Errorf("Expected a SQLite database, got %q", w.Body.String()[:min(16, w.Body.Len())])
+	}
+}
+
+func TestHandleDatabaseUpload(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "old", IPAddress: "192.168.1.1"})
+
+	// Another node's database, as downloaded from it.
+	other, _, otherCleanup := setupTest(t)
+	defer otherCleanup()
+	other.store.Add(types.Host{ID: "new", IPAddress: "192.168.1.2"})
+	download := httptest.NewRecorder()
+	other.HandleBackupDownload(download, httptest.NewRequest(http.MethodGet, "/api/backups/download", nil))
+
+	upload := func(body io.Reader, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/backups/upload", body)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		svc.HandleDatabaseUpload(w, req)
+		return w
+	}
+
+	if w := upload(strings.NewReader("not a database"), "application/octet-stream"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected garbage refused with 400, got %d", w.Code)
+	}
+	if _, err := store.GetByID("old"); err != nil {
+		t.Fatal("Expected the database untouched after a refused upload")
+	}
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("file", "nsm-hosts.db")
+	part.Write(download.Body.Bytes())
+	mw.Close()
+	w := upload(&form, mw.FormDataContentType())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the upload imported, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if _, err := os.Stat(resp["backup"]); err != nil {
+		t.Errorf("Expected the previous database backed up: %v", err)
+	}
+	if _, err := store.GetByID("new"); err != nil {
+		t.Error("Expected the uploaded host list")
+	}
+	if _, err := store.GetByID("old"); err == nil {
+		t.Error("Expected the old host list replaced")
+	}
+}
+
+func TestHandleExportDownload_Formats(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{Nickname: "Lobby", IPAddress: "192.168.1.50", Status: types.StatusHealthy})
+
+	tests := []struct {
+		format      string
+		contentType string
+		contains    string
+	}{
+		{"yaml", "application/yaml", "ip_address: 192.168.1.50"},
+		{"csv", "text/csv; charset=utf-8", "192.168.1.50"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/hosts/export/download?format="+tt.format, nil)
+		w := httptest.NewRecorder()
+
+		svc.HandleExportDownload(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: Expected status OK, got %v", tt.format, resp.Status)
+		}
+		if got := resp.Header.Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: Expected Content-Type %s, got %s", tt.format, tt.contentType, got)
+		}
+		if disp := resp.Header.Get("Content-Disposition"); !strings.Contains(disp, "."+tt.format) {
+			t.Errorf("%s: Expected .%s filename, got %s", tt.format, tt.format, disp)
+		}
+		if !strings.Contains(w.Body.String(), tt.contains) {
+			t.Errorf("%s: Expected body to contain %q, got %s", tt.format, tt.contains, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/hosts/export/download?format=xml", nil)
+	w := httptest.NewRecorder()
+	svc.HandleExportDownload(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unsupported format, got %d", w.Code)
+	}
+}
+
+func TestHandleImportUpload_Formats(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{Nickname: "Lobby", IPAddress: "192.168.1.50", Status: types.StatusHealthy})
+	store.Add(types.Host{Nickname: "Cafe", IPAddress: "192.168.1.51", Status: types.StatusUnreachable})
+
+	for _, format := range []string{"yaml", "csv"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/hosts/export/download?format="+format, nil)
+		w := httptest.NewRecorder()
+		svc.HandleExportDownload(w, req)
+		exported := w.Body.String()
+
+		store.ReplaceAll([]types.Host{})
+
+		req = httptest.NewRequest(http.MethodPost, "/api/hosts/import/upload?format="+format, strings.NewReader(exported))
+		w = httptest.NewRecorder()
+		svc.HandleImportUpload(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%s: Expected status 204, got %d: %s", format, w.Code, w.Body.String())
+		}
+
+		hostList := store.GetAll()
+		if len(hostList) != 2 {
+			t.Fatalf("%s: Expected 2 hosts after import, got %d", format, len(hostList))
+		}
+		found := false
+		for _, h := range hostList {
+			if h.IPAddress == "192.168.1.51" && h.Nickname == "Cafe" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s: Expected Cafe host to survive round-trip, got %+v", format, hostList)
+		}
+	}
+}
+
+func TestHandleImportUpload_CSVContentType(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	body := "nickname,ip_address,notes\nLobby,192.168.1.60,front desk\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/hosts/import/upload", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	w := httptest.NewRecorder()
+
+	svc.HandleImportUpload(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	hostList := store.GetAll()
+	if len(hostList) != 1 || hostList[0].IPAddress != "192.168.1.60" {
+		t.Errorf("Expected imported host 192.168.1.60, got %+v", hostList)
+	}
+}
+
+func TestHandleReceiveHosts(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+
+	receive := func(peer *hosts.Peer, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/hosts/receive", strings.NewReader(body))
+		req.RemoteAddr = "192.168.1.77:40000"
+		if peer != nil {
+			req = req.WithContext(auth.WithPeer(req.Context(), *peer))
+		}
+		w := httptest.NewRecorder()
+		svc.HandleReceiveHosts(w, req)
+		return w
+	}
+
+	// Without a peer's signature the list is held, not applied.
+	w := receive(nil, `[{"id": "cafe", "ip_address": "192.168.1.21"}]`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(store.GetAll()) != 1 {
+		t.Errorf("expected the host list unchanged, got %+v", store.GetAll())
+	}
+	held, _ := store.ListQuarantine()
+	if len(held) != 1 || held[0].Host.ID != "cafe" || held[0].RemoteAddr != "192.168.1.77" {
+		t.Errorf("expected the pushed host quarantined, got %+v", held)
+	}
+
+	peer := &hosts.Peer{NodeID: "node-a"}
+	if w := receive(peer, `[{"id": "cafe", "ip_address": "not an address"}]`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed host, got %d", w.Code)
+	}
+	if w := receive(peer, `[{"id": "cafe", "ip_address": "192.168.1.21"}]`); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if list := store.GetAll(); len(list) != 1 || list[0].ID != "cafe" {
+		t.Errorf("expected the list replaced by the peer's, got %+v", list)
+	}
+}
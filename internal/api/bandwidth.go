@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/bandwidth"
+)
+
+// @Title: Bandwidth Limits
+// @Route: GET|POST /api/settings/bandwidth
+// @Description: Get or update limits in kbit/s for transfers NSM starts (global_kbps, and limits_kbps by operation: cache|sync|proxy); 0 or absent is unlimited
+// @Response: {"global_kbps": 20000, "limits_kbps": {"cache": 8000}}
+func (s *Service) HandleBandwidthSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := bandwidth.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		var cfg bandwidth.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		cfg, err := bandwidth.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.bandwidth.Apply(cfg)
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated bandwidth limits (global %d kbit/s, %d per-operation)", cfg.GlobalKbps, len(cfg.Limits)))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Bandwidth Usage
+// @Route: GET /api/bandwidth
+// @Description: Traffic of each limited operation since NSM started, its current rate and limit, and the total
+// @Response: [{"op": "cache", "bytes": 52428800, "bytes_per_sec": 1000000, "limit_kbps": 8000}, {"op": "total", "bytes": 52431000, "bytes_per_sec": 1000000, "limit_kbps": 20000}]
+func (s *Service) HandleBandwidthUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.bandwidth.Usage())
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/bandwidth"
+)
+
+func TestHandleBandwidthSettings(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleBandwidthSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/bandwidth",
+		strings.NewReader(`{"global_kbps": 20000, "limits_kbps": {"cache": 8000}}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The new limits apply at once.
+	w = httptest.NewRecorder()
+	svc.HandleBandwidthUsage(w, httptest.NewRequest(http.MethodGet, "/api/bandwidth", nil))
+	var usage []bandwidth.Usage
+	json.NewDecoder(w.Body).Decode(&usage)
+	if len(usage) == 0 || usage[0].Op != bandwidth.OpCache || usage[0].LimitKbps != 8000 || usage[len(usage)-1].LimitKbps != 20000 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleBandwidthSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/bandwidth",
+		strings.NewReader(`{"limits_kbps": {"upgrade": 100}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown operation, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleBandwidthSettings(w, httptest.NewRequest(http.MethodGet, "/api/settings/bandwidth", nil))
+	var cfg bandwidth.Config
+	json.NewDecoder(w.Body).Decode(&cfg)
+	if cfg.GlobalKbps != 20000 || cfg.Limits[bandwidth.OpCache] != 8000 {
+		t.Errorf("expected saved limits, got %+v", cfg)
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/buddy"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: Backup Buddy Settings
+// @Route: GET|POST /api/settings/backup-buddies
+// @Description: Get or set backup exchange. When enabled, this node ships a snapshot of its database daily at hour to each of up to two buddies, given by host ID, which must send heartbeats. accept lets peers ship their snapshots here; keep is how many are held per peer and quota_mb bounds them all, the oldest being removed first
+// @Response: {"enabled": true, "buddies": ["..."], "hour": 3, "accept": true, "quota_mb": 200, "keep": 3}
+func (s *Service) HandleBackupBuddySettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := buddy.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		cfg := buddy.DefaultConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		for _, id := range cfg.Buddies {
+			if _, err := s.store.GetByID(id); err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown buddy %q", id))
+				return
+			}
+		}
+
+		cfg, err := buddy.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated backup buddy settings (enabled=%v, %d buddies, accept=%v, %d MB)", cfg.Enabled, len(cfg.Buddies), cfg.Accept, cfg.QuotaMB))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// peerBackups is the answer of HandlePeerBackups.
+type peerBackups struct {
+	Held       []buddy.Held               `json:"held"`
+	UsedBytes  int64                      `json:"used_bytes"`
+	QuotaBytes int64                      `json:"quota_bytes"`
+	Shipped    map[string]*buddy.Shipment `json:"shipped"`
+}
+
+// @Title: Peer Backups
+// @Route: GET /api/backups/peers
+// @Description: List the snapshots this node holds for peers, newest first, with the space they use against the quota, and how this node last shipped its own snapshot to each buddy, by host ID
+// @Response: {"held": [{"node_id": "...", "hostname": "lobby", "file": "hosts-1767225600.db", "size": 98304, "sent_at": "..."}], "used_bytes": 98304, "quota_bytes": 209715200, "shipped": {"...": {"due": "...", "sent_at": "...", "size": 98304, "attempt_at": "..."}}}
+func (s *Service) HandlePeerBackups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, err := buddy.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	held, err := buddy.List(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	shipped, err := buddy.LoadState(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := peerBackups{Held: held, QuotaBytes: int64(cfg.QuotaMB) << 20, Shipped: shipped}
+	for _, h := range held {
+		resp.UsedBytes += h.Size
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// @Title: Download Peer Backup
+// @Route: GET /api/backups/peers/download?node=...&file=...
+// @Description: Download a snapshot held for a peer, to recover a node that was lost. Upload it to the replacement node with /api/backups/upload. The snapshot includes the password hashes of the peer, so only admins may download it
+// @Response: File download (application/vnd.sqlite3)
+func (s *Service) HandlePeerBackupDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	node, file := r.URL.Query().Get("node"), r.URL.Query().Get("file")
+	path, err := buddy.HeldPath(s.store, node, file)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Peer backup not found")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Peer backup not found")
+		return
+	}
+	defer f.Close()
+
+	auth.AnnotateAudit(r, node, file)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Serving peer backup %s of %s", file, node))
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"nsm-%s-%s\"", node, file))
+	http.ServeContent(w, r, file, time.Time{}, f)
+}
+
+// @Title: Receive Peer Backup
+// @Route: POST /api/peers/backups/receive
+// @Description: Accept a database snapshot shipped by a buddy. The body is the database; the X-NSM-Backup header carries its size and SHA-256, signed by the key a heartbeat pinned for the sender. Answers 507 when this node does not hold backups for peers or the snapshot exceeds its quota
+// @Response: 204 No Content
+func (s *Service) HandleReceivePeerBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	m, err := buddy.Verify(s.store, r.Header.Get(buddy.Header), time.Now().UTC())
+	switch {
+	case err == nil:
+	case errors.Is(err, buddy.ErrBadSignature), errors.Is(err, buddy.ErrUnknownSender):
+		s.writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	case errors.Is(err, buddy.ErrKeyMismatch):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected peer backup from %s: %v", r.RemoteAddr, err))
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, buddy.ErrClockSkew):
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cfg, err := buddy.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	held, err := buddy.Receive(s.store, cfg, m, http.MaxBytesReader(w, r.Body, buddy.MaxSize))
+	switch {
+	case err == nil:
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Holding backup %s (%d bytes) for peer %s", held.File, held.Size, m.Hostname))
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, buddy.ErrNotAccepting), errors.Is(err, buddy.ErrOverQuota):
+		s.writeError(w, http.StatusInsufficientStorage, err.Error())
+	case errors.Is(err, buddy.ErrMismatch), errors.Is(err, hosts.ErrInvalidSnapshot):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected peer backup from %s: %v", m.Hostname, err))
+		s.writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("API: Failed to hold backup for peer %s: %v", m.Hostname, err))
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
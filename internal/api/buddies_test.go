@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/buddy"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func TestHandlePeerBackups(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := store.OpenExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(snap)
+	snap.Close()
+	sum := sha256.Sum256(data)
+
+	send := func() int {
+		header, err := buddy.Seal(buddy.Manifest{SenderID: "node-a", Hostname: "lobby", SentAt: time.Now().UTC(),
+			Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest(http.MethodPost, buddy.Path, bytes.NewReader(data))
+		r.Header.Set(buddy.Header, header)
+		w := httptest.NewRecorder()
+		svc.HandleReceivePeerBackup(w, r)
+		return w.Code
+	}
+
+	if code := send(); code != http.StatusUnauthorized {
+		t.Fatalf("expected a sender without a pinned key refused, got %d", code)
+	}
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey())})
+	if code := send(); code != http.StatusNoContent {
+		t.Fatalf("expected the backup accepted, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandlePeerBackups(w, httptest.NewRequest(http.MethodGet, "/api/backups/peers", nil))
+	var resp peerBackups
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Held) != 1 || resp.Held[0].NodeID != "node-a" || resp.UsedBytes != int64(len(data)) || resp.QuotaBytes != 200<<20 {
+		t.Fatalf("unexpected listing %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandlePeerBackupDownload(w, httptest.NewRequest(http.MethodGet, "/api/backups/peers/download?node=node-a&file="+resp.Held[0].File, nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Errorf("expected the held backup downloaded, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	w = httptest.NewRecorder()
+	svc.HandlePeerBackupDownload(w, httptest.NewRequest(http.MethodGet, "/api/backups/peers/download?node=node-a&file=../../hosts.db", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected a path outside the peer backups refused, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleBackupBuddySettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/backup-buddies",
+		strings.NewReader(`{"enabled": true, "buddies": ["missing"], "hour": 3, "accept": false}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown buddy refused, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleBackupBuddySettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/backup-buddies",
+		strings.NewReader(`{"accept": false}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected settings saved, got %d: %s", w.Code, w.Body.String())
+	}
+	if code := send(); code != http.StatusInsufficientStorage {
+		t.Errorf("expected backups refused when not accepting, got %d", code)
+	}
+}
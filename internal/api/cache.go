@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"nexsign.mini/nsm/internal/cache"
+)
+
+// @Title: Cached Asset
+// @Route: GET /cache?url=...
+// @Description: Serve an asset from this node's cache, fetching it from the origin on first use; only hosts in the list may use it
+// @Response: The asset, with X-Cache: HIT or MISS
+func (s *Service) HandleCacheFetch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := cache.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !cfg.Enabled || s.cache == nil {
+		s.writeError(w, http.StatusNotFound, "Asset cache is disabled")
+		return
+	}
+	if !s.isFleetClient(r.RemoteAddr) {
+		s.writeError(w, http.StatusForbidden, "Only hosts in the host list may use the cache")
+		return
+	}
+
+	url := r.URL.Query().Get("url")
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		s.writeError(w, http.StatusBadRequest, "'url' must be an http or https URL")
+		return
+	}
+
+	path, entry, hit, err := s.cache.Get(url, cfg)
+	if errors.Is(err, cache.ErrTooLarge) {
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to fetch %s: %v", url, err))
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Cached copy disappeared; try again")
+		return
+	}
+	defer f.Close()
+
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	http.ServeContent(w, r, "", entry.FetchedAt, f)
+}
+
+// isFleetClient reports whether addr is this node or one of the hosts in
+// the list, by LAN or VPN address.
+func (s *Service) isFleetClient(remoteAddr string) bool {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.IsLoopback() {
+		return true
+	}
+	for _, h := range s.store.GetAll() {
+		if h.IPAddress == ip || h.VPNIPAddress == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// @Title: Cache Contents
+// @Route: GET /api/cache
+// @Description: List assets in this node's cache with their size and use
+// @Response: {"config": {"enabled": true, "max_mb": 1024, "ttl_minutes": 1440}, "total_bytes": 0, "entries": [{"url": "...", "size": 0, "hits": 0, "fetched_at": "...", "last_used": "..."}]}
+func (s *Service) HandleCacheList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := cache.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	entries, total := []cache.Entry{}, int64(0)
+	if s.cache != nil {
+		entries, total = s.cache.List()
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"config":      cfg,
+		"total_bytes": total,
+		"entries":     entries,
+	})
+}
+
+// @Title: Purge Cache
+// @Route: POST /api/cache/purge?url=...
+// @Description: Remove one asset from the cache, or every asset if url is omitted
+// @Response: {"purged": 1}
+func (s *Service) HandleCachePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.cache == nil {
+		s.writeError(w, http.StatusServiceUnavailable, "Asset cache is unavailable")
+		return
+	}
+
+	url := r.URL.Query().Get("url")
+	n := s.cache.Purge(url)
+	if url == "" {
+		url = "all assets"
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Purged %s from cache (%d removed)", url, n))
+	s.writeJSON(w, http.StatusOK, map[string]int{"purged": n})
+}
+
+// @Title: Cache Settings
+// @Route: GET|POST /api/settings/cache
+// @Description: Get or update the asset cache (enabled, max_mb, ttl_minutes)
+// @Response: {"enabled": true, "max_mb": 1024, "ttl_minutes": 1440}
+func (s *Service) HandleCacheSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := cache.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		cfg := cache.DefaultConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		cfg, err := cache.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated cache settings (enabled=%v, %d MB)", cfg.Enabled, cfg.MaxMB))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/cache"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleCacheFetch(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("menu"))
+	}))
+	defer origin.Close()
+
+	fetch := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/cache?url="+origin.URL+"/menu.png", nil)
+		req.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		svc.HandleCacheFetch(w, req)
+		return w
+	}
+
+	if w := fetch("192.168.1.20:5000"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 while disabled, got %d", w.Code)
+	}
+
+	cfg := cache.DefaultConfig()
+	cfg.Enabled = true
+	cache.SaveConfig(store, cfg)
+
+	if w := fetch("192.168.1.20:5000"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a client outside the host list, got %d", w.Code)
+	}
+
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20"})
+	w := fetch("192.168.1.20:5000")
+	if w.Code != http.StatusOK || w.Body.String() != "menu" || w.Header().Get("X-Cache") != "MISS" {
+		t.Fatalf("expected a miss serving the asset, got %d %q %s", w.Code, w.Body.String(), w.Header().Get("X-Cache"))
+	}
+	if w := fetch("192.168.1.20:5000"); w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected a hit, got %s", w.Header().Get("X-Cache"))
+	}
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/calendar"
+)
+
+// @Title: Calendar Feeds
+// @Route: GET|POST /api/settings/calendars
+// @Description: Get or replace the iCalendar feeds that restore presets (enabled, default_preset, feeds with name, url and mappings of event category to preset). An empty category matches every event; the default preset is restored between bookings
+// @Response: {"enabled": true, "default_preset": "normal", "feeds": [{"name": "Boardroom", "url": "https://rooms.example.com/boardroom.ics", "mappings": [{"category": "Meeting", "preset": "meeting"}]}]}
+func (s *Service) HandleCalendarSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := calendar.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		var cfg calendar.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		for _, preset := range cfg.Presets() {
+			if _, err := s.store.GetSnapshot(preset); err != nil {
+				s.writeSnapshotError(w, err)
+				return
+			}
+		}
+
+		cfg, err := calendar.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated calendar feeds (%d feeds, enabled=%v)", len(cfg.Feeds), cfg.Enabled))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Calendar Status
+// @Route: GET /api/calendars/status
+// @Description: Show the preset the calendar feeds last restored and for which booking, the next bookings within a week, and the last fetch of each feed
+// @Response: {"preset": "meeting", "booking": {"feed": "Boardroom", "preset": "meeting", "uid": "...", "summary": "Board meeting", "start": "...", "end": "..."}, "applied_at": "...", "feeds": [{"name": "Boardroom", "fetched_at": "...", "events": 12}], "upcoming": []}
+func (s *Service) HandleCalendarStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	state, err := calendar.LoadState(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/calendar"
+)
+
+func TestHandleCalendarSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	if _, err := store.SaveSnapshot("meeting", ""); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleCalendarSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/calendars", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"enabled": true, "feeds": [{"name": "Boardroom", "url": "webcal://rooms.example.com/boardroom.ics", "mappings": [{"preset": "meeting"}]}]}`); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if cfg, _ := calendar.LoadConfig(store); !cfg.Enabled || len(cfg.Feeds) != 1 {
+		t.Errorf("unexpected stored config %+v", cfg)
+	}
+
+	if w := post(`{"enabled": true, "default_preset": "missing", "feeds": []}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing preset, got %d", w.Code)
+	}
+	if w := post(`{"enabled": true, "feeds": [{"name": "Boardroom", "url": "ftp://rooms.example.com/a.ics", "mappings": [{"preset": "meeting"}]}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unsupported URL, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleCalendarStatus(w, httptest.NewRequest(http.MethodGet, "/api/calendars/status", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
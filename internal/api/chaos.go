@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/chaos"
+)
+
+// SetChaos enables the fault injection API with the faults of in. Without
+// it, /api/debug/faults answers 404.
+func (s *Service) SetChaos(in *chaos.Injector) {
+	s.chaos = in
+}
+
+// faultsResponse is what /api/debug/faults answers with.
+type faultsResponse struct {
+	Faults chaos.Faults `json:"faults"`
+	Stats  chaos.Stats  `json:"stats"`
+}
+
+// @Title: Fault Injection
+// @Route: GET|POST /api/debug/faults
+// @Description: Get or set the faults this node suffers, for testing how the fleet copes with lossy links and partitions. Only available when NSM was started with -chaos. drop_percent fails that share of requests to peers, delay_ms and store_delay_ms slow requests to peers and host list changes, partition cuts off the listed peer addresses both ways, bus_down sends peer requests over HTTP and refuses bus connections, and seconds clears the faults after that long. POST {} clears them
+// @Response: {"faults": {"drop_percent": 30, "delay_ms": 200, "store_delay_ms": 0, "partition": ["192.168.1.30"], "bus_down": false, "seconds": 600, "until": "..."}, "stats": {"dropped": 12, "partitioned": 40, "delayed": 180, "bus_refused": 0}}
+func (s *Service) HandleFaults(w http.ResponseWriter, r *http.Request) {
+	if s.chaos == nil {
+		s.writeError(w, http.StatusNotFound, "fault injection is off; start nsm with -chaos to use it")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, http.StatusOK, faultsResponse{Faults: s.chaos.Faults(), Stats: s.chaos.Stats()})
+	case http.MethodPost:
+		var f chaos.Faults
+		if err := json.NewDecoder(r.Body).Decode(&f); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		f, err := s.chaos.Set(f)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		detail := fmt.Sprintf("drop %d%%, delay %dms, store delay %dms, partition [%s], bus down %v",
+			f.DropPercent, f.DelayMS, f.StoreDelayMS, strings.Join(f.Partition, ", "), f.BusDown)
+		if f.Seconds > 0 {
+			detail += fmt.Sprintf(", for %ds", f.Seconds)
+		}
+		auth.AnnotateAudit(r, "faults", detail)
+		s.logger.WarningContext(r.Context(), "API: Injected faults: "+detail)
+		s.writeJSON(w, http.StatusOK, faultsResponse{Faults: f, Stats: s.chaos.Stats()})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
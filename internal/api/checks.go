@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: Health-Check Settings
+// @Route: GET|POST /api/settings/health-checks
+// @Description: Get or update the per-probe timeout (timeout_ms, default 3000) and the probes to skip (disabled: version|health|anthias), globally and per host ID under hosts; a host's disabled list replaces the global one
+// @Response: {"timeout_ms": 5000, "hosts": {"host-id": {"timeout_ms": 10000, "disabled": ["anthias"]}}}
+func (s *Service) HandleCheckSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := s.store.CheckConfig()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		var cfg hosts.CheckConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		cfg, err := s.store.SaveCheckConfig(cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated health-check settings (timeout %d ms, %d disabled probes, %d host overrides)", cfg.TimeoutMS, len(cfg.Disabled), len(cfg.Hosts)))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+func TestHandleCheckSettings(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleCheckSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/health-checks",
+		strings.NewReader(`{"timeout_ms": 5000, "hosts": {"test-id": {"disabled": ["anthias"]}}}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleCheckSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/health-checks",
+		strings.NewReader(`{"disabled": ["ping"]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown probe, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleCheckSettings(w, httptest.NewRequest(http.MethodGet, "/api/settings/health-checks", nil))
+	var cfg hosts.CheckConfig
+	json.NewDecoder(w.Body).Decode(&cfg)
+	if cfg.TimeoutMS != 5000 || len(cfg.Hosts["test-id"].Disabled) != 1 {
+		t.Errorf("expected saved settings, got %+v", cfg)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// timeSyncCommands are tried in order until one succeeds. chrony can step
+// the clock at once; systemd-timesyncd syncs when it starts, so restarting
+// it is the closest equivalent.
+var timeSyncCommands = [][]string{
+	{"chronyc", "-a", "makestep"},
+	{"systemctl", "restart", "systemd-timesyncd"},
+}
+
+// @Title: Force Time Sync
+// @Route: POST /api/hosts/time-sync
+// @Description: Step a host's clock from NTP now (chrony, else systemd-timesyncd); body {"target_ip": "..."}, forwarded if not local
+// @Response: {"command": "chronyc -a makestep", "output": "200 OK", "time": "2026-01-02T15:04:05Z"}
+func (s *Service) HandleTimeSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TargetIP string `json:"target_ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// Like reboot, the node that owns the clock does the work.
+	if req.TargetIP != "" && req.TargetIP != "127.0.0.1" && req.TargetIP != os.Getenv("NSM_HOST_IP") {
+		url := fmt.Sprintf("http://%s:8080/api/hosts/time-sync", s.store.ResolveAddress(req.TargetIP))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Forwarding time sync request to %s", req.TargetIP))
+		body, _ := json.Marshal(req)
+		resp, err := s.postForward(r.Context(), url, body, 15*time.Second)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to forward: %v", err))
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	var failures []string
+	for _, args := range timeSyncCommands {
+		command := strings.Join(args, " ")
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", command, err))
+			continue
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Forced time sync with %s", command))
+		s.writeJSON(w, http.StatusOK, map[string]string{
+			"command": command,
+			"output":  strings.TrimSpace(string(out)),
+			"time":    time.Now().UTC().Format(time.RFC3339),
+		})
+		return
+	}
+	s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Time sync failed: %s", strings.Join(failures, "; ")))
+	s.writeError(w, http.StatusInternalServerError, "Time sync failed: "+strings.Join(failures, "; "))
+}
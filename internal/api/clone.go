@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// maxCloneCount bounds one bulk clone to a /24's worth of hosts.
+const maxCloneCount = 254
+
+// trailingNumber finds the number a nickname ends with, as in "Lobby 3".
+var trailingNumber = regexp.MustCompile(`^(.*?)(\d+)$`)
+
+// @Title: Clone Host
+// @Route: POST /api/hosts/clone
+// @Description: Add hosts with a source host's notes, timezone and path preference; give ip_address for one, or start_ip and count for consecutive addresses. nickname may use {n} (numbered from first) and {ip}; left out, it continues the source's numbering
+// @Response: [{"id": "...", "nickname": "Lobby 4", "ip_address": "192.168.1.54", "notes": "...", "timezone": "Europe/London"}]
+func (s *Service) HandleCloneHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		SourceID  string  `json:"source_id"`
+		IPAddress string  `json:"ip_address"`
+		StartIP   string  `json:"start_ip"`
+		Count     int     `json:"count"`
+		Nickname  *string `json:"nickname"`
+		First     int     `json:"first"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	source, err := s.store.GetByID(req.SourceID)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Source host not found")
+		return
+	}
+
+	var ips []string
+	switch {
+	case req.IPAddress != "" && req.StartIP != "":
+		s.writeError(w, http.StatusBadRequest, "Give ip_address or start_ip, not both")
+		return
+	case req.IPAddress != "":
+		if !hosts.ValidAddress(req.IPAddress) {
+			s.writeError(w, http.StatusBadRequest, "ip_address is not a valid IPv4 address or DNS name")
+			return
+		}
+		ips = []string{req.IPAddress}
+	case req.StartIP != "":
+		if ips, err = sequentialIPs(req.StartIP, req.Count); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		s.writeError(w, http.StatusBadRequest, "ip_address or start_ip is required")
+		return
+	}
+	for _, ip := range ips {
+		if _, err := s.store.GetByIP(ip); err == nil {
+			s.writeError(w, http.StatusConflict, fmt.Sprintf("%s is already in the host list", ip))
+			return
+		}
+	}
+
+	pattern, first := clonePattern(source.Nickname)
+	if req.Nickname != nil {
+		pattern, first = *req.Nickname, 1
+	}
+	if req.First != 0 {
+		first = req.First
+	}
+
+	created := make([]types.Host, 0, len(ips))
+	for i, ip := range ips {
+		h := types.Host{
+			ID:             uuid.New().String(),
+			Nickname:       expandNickname(pattern, first+i, ip),
+			IPAddress:      ip,
+			Notes:          source.Notes,
+			Timezone:       source.Timezone,
+			CMS:            source.CMS,
+			PathPreference: source.PathPreference,
+			Status:         types.StatusUnreachable,
+			CMSStatus:      types.CMSUnknown,
+		}
+		if err := s.store.Add(h); err != nil {
+			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add %s after adding %d: %v", ip, len(created), err))
+			return
+		}
+		created = append(created, h)
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Cloned %s to %d new host(s)", source.IPAddress, len(created)))
+
+	// Checking many new hosts, most not yet powered up, takes a while, so
+	// it happens after the response. CheckHosts keeps edits made to the
+	// clones meanwhile and skips any deleted.
+	ids := make([]string, len(created))
+	for i, h := range created {
+		ids[i] = h.ID
+	}
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		s.store.CheckHosts(ids)
+		s.logger.InfoContext(ctx, fmt.Sprintf("API: Checked %d cloned host(s)", len(ids)))
+	}()
+
+	s.writeJSON(w, http.StatusCreated, created)
+}
+
+// clonePattern turns a source nickname into a pattern that continues its
+// numbering: "Lobby 3" gives "Lobby {n}" from 4, and "Lobby" gives
+// "Lobby {n}" from 2, the source being the first.
+func clonePattern(nickname string) (string, int) {
+	if nickname == "" {
+		return "", 1
+	}
+	if m := trailingNumber.FindStringSubmatch(nickname); m != nil {
+		if n, err := strconv.Atoi(m[2]); err == nil {
+			return m[1] + "{n}", n + 1
+		}
+	}
+	return nickname + " {n}", 2
+}
+
+func expandNickname(pattern string, n int, ip string) string {
+	return strings.NewReplacer("{n}", strconv.Itoa(n), "{ip}", ip).Replace(pattern)
+}
+
+// sequentialIPs returns count consecutive IPv4 addresses from start. None
+// may end in .0 or .255, which are rarely hosts on a venue network.
+func sequentialIPs(start string, count int) ([]string, error) {
+	ip := net.ParseIP(start).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("start_ip must be an IPv4 address")
+	}
+	if count < 1 || count > maxCloneCount {
+		return nil, fmt.Errorf("count must be between 1 and %d", maxCloneCount)
+	}
+
+	base := binary.BigEndian.Uint32(ip)
+	ips := make([]string, count)
+	for i := range ips {
+		next := make(net.IP, 4)
+		binary.BigEndian.PutUint32(next, base+uint32(i))
+		if next[3] == 0 || next[3] == 255 {
+			return nil, fmt.Errorf("range from %s would include %s", start, next)
+		}
+		ips[i] = next.String()
+	}
+	return ips, nil
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestClonePattern(t *testing.T) {
+	cases := []struct {
+		nickname, pattern string
+		first             int
+	}{
+		{"Lobby 3", "Lobby {n}", 4},
+		{"Lobby", "Lobby {n}", 2},
+		{"Screen-07", "Screen-{n}", 8},
+		{"", "", 1},
+	}
+	for _, c := range cases {
+		pattern, first := clonePattern(c.nickname)
+		if pattern != c.pattern || first != c.first {
+			t.Errorf("clonePattern(%q) = %q, %d; want %q, %d", c.nickname, pattern, first, c.pattern, c.first)
+		}
+	}
+}
+
+func TestSequentialIPs(t *testing.T) {
+	ips, err := sequentialIPs("192.168.1.253", 2)
+	if err != nil || strings.Join(ips, ",") != "192.168.1.253,192.168.1.254" {
+		t.Errorf("unexpected %v, %v", ips, err)
+	}
+	if _, err := sequentialIPs("192.168.1.254", 2); err == nil {
+		t.Error("expected an error for a range including .255")
+	}
+	if _, err := sequentialIPs("192.168.1.10", 0); err == nil {
+		t.Error("expected an error for a count of 0")
+	}
+	if _, err := sequentialIPs("fe80::1", 1); err == nil {
+		t.Error("expected an error for an IPv6 start")
+	}
+}
+
+func TestHandleCloneHost(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	source := types.Host{ID: "src", Nickname: "Lobby 3", IPAddress: "192.0.2.3", Notes: "Portrait, by the lifts", Timezone: "Europe/London"}
+	if err := store.Add(source); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleCloneHost(w, httptest.NewRequest(http.MethodPost, "/api/hosts/clone", strings.NewReader(body)))
+		return w
+	}
+
+	w := clone(`{"source_id": "src", "start_ip": "192.0.2.4", "count": 2}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created []types.Host
+	json.NewDecoder(w.Body).Decode(&created)
+	if len(created) != 2 || created[0].Nickname != "Lobby 4" || created[1].Nickname != "Lobby 5" || created[1].IPAddress != "192.0.2.5" {
+		t.Fatalf("unexpected hosts %+v", created)
+	}
+	stored, err := store.GetByIP("192.0.2.5")
+	if err != nil || stored.Notes != source.Notes || stored.Timezone != source.Timezone {
+		t.Errorf("expected the source's notes and timezone, got %+v (%v)", stored, err)
+	}
+
+	w = clone(`{"source_id": "src", "ip_address": "192.0.2.20", "nickname": "Bar ({ip})"}`)
+	created = nil
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusCreated || len(created) != 1 || created[0].Nickname != "Bar (192.0.2.20)" {
+		t.Errorf("unexpected response %d %+v", w.Code, created)
+	}
+
+	if w := clone(`{"source_id": "src", "ip_address": "192.0.2.4"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an existing IP, got %d", w.Code)
+	}
+	if w := clone(`{"source_id": "missing", "ip_address": "192.0.2.30"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing source, got %d", w.Code)
+	}
+	if w := clone(`{"source_id": "src"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without an IP, got %d", w.Code)
+	}
+}
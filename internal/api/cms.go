@@ -0,0 +1,46 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/vault"
+)
+
+// readAssets reads the asset list of host from the CMS it runs, over the
+// path in use and with its stored login, if any.
+func (s *Service) readAssets(host types.Host, timeout time.Duration) ([]playlist.Asset, error) {
+	username, password := s.cmsLogin(host)
+	assets, _, err := cms.New(host.CMS, &http.Client{Timeout: timeout}, username, password).Assets(hosts.SelectPath(host).Address, cms.Validators{})
+	return assets, err
+}
+
+// cmsLogin returns the stored login for the CMS host runs, or empty
+// strings if there is none.
+func (s *Service) cmsLogin(host types.Host) (username, password string) {
+	kind := vault.KindAnthiasBasic
+	if host.CMS == types.CMSPiSignage {
+		kind = vault.KindPiSignageBasic
+	}
+	username, password, err := s.vault.Open(host.ID, kind)
+	if err != nil && !errors.Is(err, hosts.ErrCredentialNotFound) {
+		s.logger.Warning(fmt.Sprintf("API: Cannot use %s credential for %s: %v", kind, host.IPAddress, err))
+	}
+	return username, password
+}
+
+// requireAnthias answers 409 and returns false unless host runs Anthias,
+// the only CMS NSM changes.
+func (s *Service) requireAnthias(w http.ResponseWriter, host types.Host) bool {
+	if host.CMS == types.CMSAnthias {
+		return true
+	}
+	s.writeError(w, http.StatusConflict, fmt.Sprintf("%s runs %s; NSM only changes Anthias hosts", hostName(host), host.CMS.Name()))
+	return false
+}
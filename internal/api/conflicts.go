@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: Host Conflicts
+// @Route: GET /api/conflicts
+// @Description: Inconsistencies in the host list: two hosts with one IP (ip), a node whose heartbeats come from an IP other than its record's (id), and two hosts with one hostname (hostname), each with the actions that resolve it
+// @Response: [{"key": "ip:192.168.1.20", "kind": "ip", "value": "192.168.1.20", "message": "2 hosts have the IP 192.168.1.20", "hosts": [{"id": "...", "nickname": "Lobby", "ip_address": "192.168.1.20"}], "actions": ["keep"]}]
+func (s *Service) HandleConflicts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	conflicts, err := s.store.Conflicts()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to check for conflicts: %v", err))
+		return
+	}
+	s.writeJSON(w, http.StatusOK, conflicts)
+}
+
+// @Title: Resolve Conflict
+// @Route: POST /api/conflicts/resolve?key=...&action=...&host_id=...
+// @Description: Resolve a conflict from /api/conflicts. action=keep keeps host_id and deletes the conflict's other hosts; action=readdress moves the node to the address its heartbeats come from, replacing any host listed there
+// @Response: 204 No Content
+func (s *Service) HandleResolveConflict(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	key, action, hostID := q.Get("key"), hosts.ConflictAction(q.Get("action")), q.Get("host_id")
+	if key == "" || action == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'key' or 'action' query parameter")
+		return
+	}
+
+	err := s.store.ResolveConflict(key, action, hostID)
+	switch {
+	case errors.Is(err, hosts.ErrConflictNotFound):
+		s.writeError(w, http.StatusNotFound, "Conflict not found; it may already be resolved")
+		return
+	case errors.Is(err, hosts.ErrInvalidResolution):
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to resolve conflict: %v", err))
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Resolved conflict %s with %s", key, action))
+	w.WriteHeader(http.StatusNoContent)
+}
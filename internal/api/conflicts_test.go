@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleConflicts(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "old", IPAddress: "192.0.2.10", Hostname: "lobby-pi"})
+	store.Add(types.Host{ID: "new", IPAddress: "192.0.2.11", Hostname: "lobby-pi"})
+
+	w := httptest.NewRecorder()
+	svc.HandleConflicts(w, httptest.NewRequest(http.MethodGet, "/api/conflicts", nil))
+	var conflicts []hosts.Conflict
+	json.NewDecoder(w.Body).Decode(&conflicts)
+	if len(conflicts) != 1 || conflicts[0].Key != "hostname:lobby-pi" || len(conflicts[0].Hosts) != 2 {
+		t.Fatalf("unexpected conflicts %+v", conflicts)
+	}
+
+	resolve := func(query string) int {
+		w := httptest.NewRecorder()
+		svc.HandleResolveConflict(w, httptest.NewRequest(http.MethodPost, "/api/conflicts/resolve?"+query, nil))
+		return w.Code
+	}
+	if code := resolve("key=hostname:lobby-pi&action=readdress"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an action that does not apply, got %d", code)
+	}
+	if code := resolve("key=hostname:lobby-pi&action=keep&host_id=new"); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if _, err := store.GetByID("old"); err == nil {
+		t.Error("expected the other host to be deleted")
+	}
+	if code := resolve("key=hostname:lobby-pi&action=keep&host_id=new"); code != http.StatusNotFound {
+		t.Errorf("expected 404 once resolved, got %d", code)
+	}
+}
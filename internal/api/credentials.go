@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/vault"
+)
+
+// @Title: Host Credentials
+// @Route: GET|POST /api/credentials?host_id=...
+// @Description: List a host's credentials (never the secrets), or attach one: {"kind": "anthias_basic|pisignage_basic|ssh_password|ssh_key", "username": "...", "secret": "..."}
+// @Response: [{"host_id": "...", "kind": "anthias_basic", "username": "admin", "created_at": "...", "updated_at": "..."}]
+func (s *Service) HandleCredentials(w http.ResponseWriter, r *http.Request) {
+	hostID := r.URL.Query().Get("host_id")
+
+	switch r.Method {
+	case http.MethodGet:
+		creds, err := s.store.ListCredentials(hostID)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, creds)
+	case http.MethodPost:
+		if hostID == "" {
+			s.writeError(w, http.StatusBadRequest, "Missing 'host_id' query parameter")
+			return
+		}
+		host, err := s.store.GetByID(hostID)
+		if err != nil || host == nil {
+			s.writeError(w, http.StatusNotFound, "host not found")
+			return
+		}
+
+		var req struct {
+			Kind     string `json:"kind"`
+			Username string `json:"username"`
+			Secret   string `json:"secret"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		c, err := s.vault.Put(hostID, req.Kind, req.Username, req.Secret)
+		if errors.Is(err, vault.ErrUnavailable) {
+			s.writeError(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		auth.AnnotateAudit(r, host.IPAddress, fmt.Sprintf("set %s credential", c.Kind))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Stored %s credential for %s", c.Kind, host.IPAddress))
+		s.writeJSON(w, http.StatusOK, c)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Delete Host Credential
+// @Route: POST /api/credentials/delete?host_id=...&kind=...
+// @Description: Remove a credential from a host
+// @Response: 204 No Content
+func (s *Service) HandleDeleteCredential(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hostID, kind := r.URL.Query().Get("host_id"), r.URL.Query().Get("kind")
+	if hostID == "" || kind == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'host_id' or 'kind' query parameter")
+		return
+	}
+
+	if err := s.store.DeleteCredential(hostID, kind); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, hosts.ErrCredentialNotFound) {
+			status = http.StatusNotFound
+		}
+		s.writeError(w, status, err.Error())
+		return
+	}
+
+	auth.AnnotateAudit(r, hostID, fmt.Sprintf("removed %s credential", kind))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Removed %s credential for host %s", kind, hostID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// anthiasBasicAuth returns the stored Anthias login for the host at addr
+// (an IP with an optional port), if any.
+func (s *Service) anthiasBasicAuth(addr string) (username, password string, ok bool) {
+	ip := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		ip = h
+	}
+	host, err := s.store.GetByIP(ip)
+	if err != nil || host == nil {
+		return "", "", false
+	}
+
+	username, password, err = s.vault.Open(host.ID, vault.KindAnthiasBasic)
+	if err != nil {
+		if !errors.Is(err, hosts.ErrCredentialNotFound) {
+			s.logger.Warning(fmt.Sprintf("API: Cannot use Anthias credential for %s: %v", ip, err))
+		}
+		return "", "", false
+	}
+	return username, password, true
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleCredentials(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	// A fake Anthias device that requires basic auth.
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "s3cret!" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer device.Close()
+	addr := device.Listener.Addr().String()
+
+	store.Add(types.Host{Nickname: "Lobby", IPAddress: "127.0.0.1"})
+	host, err := store.GetByIP("127.0.0.1")
+	if err != nil {
+		t.Fatalf("GetByIP: %v", err)
+	}
+
+	body := `{"kind":"anthias_basic","username":"admin","secret":"s3cret!"}`
+	w := httptest.NewRecorder()
+	svc.HandleCredentials(w, httptest.NewRequest(http.MethodPost, "/api/credentials?host_id="+host.ID, bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("s3cret!")) {
+		t.Errorf("Expected response not to contain the secret")
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleCredentials(w, httptest.NewRequest(http.MethodGet, "/api/credentials?host_id="+host.ID, nil))
+	if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte("s3cret!")) {
+		t.Errorf("Expected list without secrets, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The proxy logs in to the device with the stored credential.
+	q := url.Values{"ip": {addr}, "path": {"/api/v2/info"}}
+	w = httptest.NewRecorder()
+	svc.HandleProxyAnthias(w, httptest.NewRequest(http.MethodGet, "/api/proxy/anthias?"+q.Encode(), nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected proxied request to authenticate, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleCredentials(w, httptest.NewRequest(http.MethodPost, "/api/credentials?host_id=missing", bytes.NewBufferString(body)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown host, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleDeleteCredential(w, httptest.NewRequest(http.MethodPost, "/api/credentials/delete?host_id="+host.ID+"&kind=anthias_basic", nil))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204 on delete, got %d", w.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/anthias"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/bandwidth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// @Title: Device Settings
+// @Route: GET|POST /api/hosts/device-settings?id=...
+// @Description: Get or change the Anthias player settings of a host: player_name, audio_output (hdmi|local), default_duration and default_streaming_duration in seconds, shuffle_playlist, show_splash, use_24_hour_clock and date_format. POST changes only the fields given and answers the settings afterwards. Display rotation and resolution are not Anthias settings
+// @Response: {"player_name": "Lobby 1", "audio_output": "hdmi", "default_duration": 10, "default_streaming_duration": 300, "shuffle_playlist": false, "show_splash": true}
+func (s *Service) HandleDeviceSettings(w http.ResponseWriter, r *http.Request) {
+	host, err := s.store.GetByID(r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	if !s.requireAnthias(w, *host) {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := s.deviceSettings(*host, nil)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, settings)
+	case http.MethodPost:
+		var req anthias.DeviceSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if err := req.Validate(); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Empty() {
+			s.writeError(w, http.StatusBadRequest, "No settings given")
+			return
+		}
+		settings, err := s.deviceSettings(*host, &req)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		auth.AnnotateAudit(r, host.IPAddress, "device settings")
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Changed device settings of %s", host.IPAddress))
+		s.writeJSON(w, http.StatusOK, settings)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// deviceSettingsResult is the outcome of a bulk change on one host.
+type deviceSettingsResult struct {
+	HostID   string                  `json:"host_id"`
+	Host     string                  `json:"host"`
+	Settings *anthias.DeviceSettings `json:"settings,omitempty"`
+	Error    string                  `json:"error,omitempty"`
+}
+
+// @Title: Bulk Device Settings
+// @Route: POST /api/hosts/device-settings/bulk
+// @Description: Change the same Anthias player settings on several hosts at once; body {"hosts": ["id", ...], "nickname": "Lobby*", "settings": {...}}. hosts lists host IDs and nickname is a glob pattern matched ignoring case; hosts matching either are changed. Each host is reported separately, so one unreachable screen does not stop the rest
+// @Response: {"results": [{"host_id": "...", "host": "Lobby 1", "settings": {"audio_output": "local", "...": "..."}}, {"host_id": "...", "host": "Lobby 2", "error": "device settings: status 401"}], "failed": 1}
+func (s *Service) HandleBulkDeviceSettings(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Hosts    []string               `json:"hosts"`
+		Nickname string                 `json:"nickname"`
+		Settings anthias.DeviceSettings `json:"settings"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := req.Settings.Validate(); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Settings.Empty() {
+		s.writeError(w, http.StatusBadRequest, "No settings given")
+		return
+	}
+	pattern := strings.ToLower(strings.TrimSpace(req.Nickname))
+	if _, err := path.Match(pattern, ""); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid nickname pattern %q", req.Nickname))
+		return
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range req.Hosts {
+		wanted[id] = true
+	}
+	var targets []types.Host
+	for _, h := range s.store.GetAll() {
+		matched, _ := path.Match(pattern, strings.ToLower(h.Nickname))
+		if wanted[h.ID] || (pattern != "" && matched) {
+			targets = append(targets, h)
+		}
+	}
+	if len(targets) == 0 {
+		s.writeError(w, http.StatusBadRequest, "No hosts match")
+		return
+	}
+
+	results := make([]deviceSettingsResult, len(targets))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for i, h := range targets {
+		wg.Add(1)
+		go func(i int, h types.Host) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			res := deviceSettingsResult{HostID: h.ID, Host: hostName(h)}
+			settings, err := s.deviceSettings(h, &req.Settings)
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Settings = &settings
+			}
+			results[i] = res
+		}(i, h)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+			s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Device settings of %s failed: %s", res.Host, res.Error))
+		}
+	}
+	auth.AnnotateAudit(r, fmt.Sprintf("%d hosts", len(targets)), fmt.Sprintf("device settings, %d failed", failed))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Changed device settings of %d hosts (%d failed)", len(targets)-failed, failed))
+	s.writeJSON(w, http.StatusOK, map[string]any{"results": results, "failed": failed})
+}
+
+// deviceSettings reads the Anthias settings of host, first changing them
+// to change if it is not nil.
+func (s *Service) deviceSettings(host types.Host, change *anthias.DeviceSettings) (anthias.DeviceSettings, error) {
+	if host.CMS != types.CMSAnthias {
+		return anthias.DeviceSettings{}, fmt.Errorf("host runs %s, not Anthias", host.CMS.Name())
+	}
+	addr := hosts.SelectPath(host).Address
+	user, pass, _ := s.anthiasBasicAuth(host.IPAddress)
+	client := s.bandwidth.Client(bandwidth.OpProxy, 10*time.Second)
+	if change != nil {
+		return anthias.UpdateSettings(client, addr, *change, user, pass)
+	}
+	return anthias.FetchSettings(client, addr, user, pass)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleDeviceSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	// A fake Anthias device keeps its settings in a map.
+	settings := map[string]any{"player_name": "Lobby 1", "audio_output": "hdmi", "default_duration": 10}
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/device_settings" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			json.NewDecoder(r.Body).Decode(&settings)
+		}
+		json.NewEncoder(w).Encode(settings)
+	}))
+	defer device.Close()
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	store.Add(types.Host{Nickname: "Lobby 1", IPAddress: device.Listener.Addr().String()})
+	store.Add(types.Host{Nickname: "Lobby 2", IPAddress: gone.Listener.Addr().String()})
+	store.Add(types.Host{Nickname: "Bar", IPAddress: "192.168.1.30"})
+	lobby, _ := store.GetByIP(device.Listener.Addr().String())
+
+	w := httptest.NewRecorder()
+	svc.HandleDeviceSettings(w, httptest.NewRequest(http.MethodGet, "/api/hosts/device-settings?id="+lobby.ID, nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"audio_output":"hdmi"`)) {
+		t.Fatalf("Expected the device settings, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleDeviceSettings(w, httptest.NewRequest(http.MethodPost, "/api/hosts/device-settings?id="+lobby.ID, bytes.NewBufferString(`{"audio_output":"aux"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown audio output, got %d", w.Code)
+	}
+
+	body := `{"nickname":"lobby*","settings":{"audio_output":"Local","default_duration":20}}`
+	w = httptest.NewRecorder()
+	svc.HandleBulkDeviceSettings(w, httptest.NewRequest(http.MethodPost, "/api/hosts/device-settings/bulk", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Results []deviceSettingsResult `json:"results"`
+		Failed  int                    `json:"failed"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Results) != 2 || resp.Failed != 1 {
+		t.Fatalf("Expected both Lobby hosts tried and one failed, got %+v", resp)
+	}
+	if settings["audio_output"] != "local" || settings["default_duration"] != float64(20) || settings["player_name"] != "Lobby 1" {
+		t.Errorf("Expected only the given settings changed, got %v", settings)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleBulkDeviceSettings(w, httptest.NewRequest(http.MethodPost, "/api/hosts/device-settings/bulk", bytes.NewBufferString(`{"nickname":"kiosk*","settings":{"show_splash":false}}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when no host matches, got %d", w.Code)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/google/uuid"
 	"nexsign.mini/nsm/internal/discovery"
 	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/snmp"
 	"nexsign.mini/nsm/internal/types"
 )
 
@@ -37,17 +39,22 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 	port := 8080 
 
 	go func() {
-		s.logger.Info("API: Starting network discovery scan...")
+		s.logger.InfoContext(r.Context(), "API: Starting network discovery scan...")
 		scanner := discovery.NewScanner(port, overrideIP, s.logger)
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
 		results, err := scanner.Scan(ctx)
 		if err != nil {
-			s.logger.Error(fmt.Sprintf("Discovery scan failed: %v", err))
+			s.logger.ErrorContext(r.Context(), fmt.Sprintf("Discovery scan failed: %v", err))
 			return
 		}
 
+		sw, err := snmp.LoadConfig(s.store)
+		if err != nil {
+			s.logger.WarningContext(r.Context(), fmt.Sprintf("Discovery: switch settings unavailable, skipping port lookups: %v", err))
+		}
+
 		count := 0
 		var wg sync.WaitGroup
 
@@ -71,7 +78,17 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 					remoteHost.CMSStatus = types.CMSUnknown
 					remoteHost.NSMStatus = "NSM Offline"
 					remoteHost.AssetCount = 0
-					
+
+					s.followHost(remoteHost.ID, host.IP, "discovery")
+					if existing, err := s.store.GetByID(remoteHost.ID); err == nil {
+						if hosts.IsHostname(existing.IPAddress) {
+							remoteHost.IPAddress = existing.IPAddress
+							remoteHost.DashboardURL = existing.DashboardURL
+						}
+						// A node cannot see its own MAC in the ARP table; keep ours.
+						remoteHost.MACAddress = existing.MACAddress
+						remoteHost.SwitchPort = existing.SwitchPort
+					}
 					hostToSave = remoteHost
 					isNew = true 
 				}
@@ -95,12 +112,9 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 
 				// Check if we already have this host
 				if remoteID != "" {
+					s.followHost(remoteID, host.IP, "discovery")
 					if existing, err := s.store.GetByID(remoteID); err == nil {
 						hostToSave = *existing
-						if hostToSave.IPAddress != host.IP {
-							hostToSave.IPAddress = host.IP
-							hostToSave.DashboardURL = fmt.Sprintf("http://%s:%d", host.IP, host.Port)
-						}
 					}
 				}
 				
@@ -133,28 +147,32 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 
 			// Handle stale entries (same IP, different ID)
 			if oldHost, err := s.store.GetByIP(host.IP); err == nil && oldHost.ID != hostToSave.ID {
-				s.logger.Warning(fmt.Sprintf("Replacing stale host %s (ID: %s) with discovered ID %s", oldHost.IPAddress, oldHost.ID, hostToSave.ID))
-				s.store.Delete(oldHost.IPAddress)
+				s.logger.WarningContext(r.Context(), fmt.Sprintf("Replacing stale host %s (ID: %s) with discovered ID %s", oldHost.IPAddress, oldHost.ID, hostToSave.ID))
+				s.store.DeleteByID(oldHost.ID)
 			}
 
 			// Upsert the host immediately so it appears in the list
 			if err := s.store.Upsert(hostToSave); err != nil {
-				s.logger.Error(fmt.Sprintf("Failed to upsert discovered host: %v", err))
+				s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to upsert discovered host: %v", err))
 				continue
 			}
 
 			if isNew {
 				count++
-				s.logger.Info(fmt.Sprintf("Discovered/Updated host: %s (ID: %s)", host.IP, hostToSave.ID))
+				s.logger.InfoContext(r.Context(), fmt.Sprintf("Discovered/Updated host: %s (ID: %s)", host.IP, hostToSave.ID))
 			}
 
 			// Trigger health check for EVERY discovered host
 			wg.Add(1)
 			go func(h types.Host) {
 				defer wg.Done()
-				hosts.CheckHealth(&h)
+				s.store.CheckHealth(&h)
+				// The check has reached the host, so its ARP entry is fresh.
+				if err := s.locateHost(&h, sw); err != nil && !errors.Is(err, discovery.ErrNoMAC) {
+					s.logger.WarningContext(r.Context(), fmt.Sprintf("Discovery: could not locate %s: %v", h.IPAddress, err))
+				}
 				if err := s.store.Upsert(h); err != nil {
-					s.logger.Error(fmt.Sprintf("Error updating health for %s: %v", h.IPAddress, err))
+					s.logger.ErrorContext(r.Context(), fmt.Sprintf("Error updating health for %s: %v", h.IPAddress, err))
 				}
 			}(hostToSave)
 
@@ -167,7 +185,15 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 						}
 						hosts := []types.Host{*local}
 						body, _ := json.Marshal(hosts)
-						http.Post(fmt.Sprintf("http://%s:8080/api/hosts/receive?merge=true", targetIP), "application/json", bytes.NewBuffer(body))
+						req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s:8080/api/hosts/receive?merge=true", targetIP), bytes.NewReader(body))
+						if err != nil {
+							return
+						}
+						req.Header.Set("Content-Type", "application/json")
+						s.auth.PeerSigner().Sign(req, body)
+						if resp, err := http.DefaultClient.Do(req); err == nil {
+							resp.Body.Close()
+						}
 					}
 				}(host.IP)
 			}
@@ -180,13 +206,13 @@ func (s *Service) HandleDiscoveryScan(w http.ResponseWriter, r *http.Request) {
 		if local, err := s.anthias.GetMetadata(); err == nil {
 			if stored, err := s.store.GetByID(local.ID); err == nil {
 				updated := *stored
-				hosts.CheckHealth(&updated)
+				s.store.CheckHealth(&updated)
 				s.store.Upsert(updated)
-				s.logger.Info("Local host health check complete.")
+				s.logger.InfoContext(r.Context(), "Local host health check complete.")
 			}
 		}
 
-		s.logger.Info(fmt.Sprintf("Discovery scan complete. Processed %d hosts.", count))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Discovery scan complete. Processed %d hosts.", count))
 	}()
 
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/requestid"
+)
+
+// displayPowerCommands are tried in order until one succeeds. HDMI-CEC
+// puts the TV itself in standby; vcgencmd only blanks the Pi's output, for
+// screens without CEC.
+var displayPowerCommands = map[string][][]string{
+	"on": {
+		{"cec-ctl", "--playback", "--to", "0", "--image-view-on"},
+		{"vcgencmd", "display_power", "1"},
+	},
+	"off": {
+		{"cec-ctl", "--playback", "--to", "0", "--standby"},
+		{"vcgencmd", "display_power", "0"},
+	},
+}
+
+// @Title: Display Power
+// @Route: POST /api/hosts/display-power
+// @Description: Turn a host's screen on or off over HDMI-CEC, else with vcgencmd; body {"target_ip": "...", "power": "on|off"}, forwarded if not local
+// @Response: {"power": "off", "command": "cec-ctl --playback --to 0 --standby", "output": "..."}
+func (s *Service) HandleDisplayPower(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TargetIP string `json:"target_ip"`
+		Power    string `json:"power"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if _, ok := displayPowerCommands[req.Power]; !ok {
+		s.writeError(w, http.StatusBadRequest, "power must be on or off")
+		return
+	}
+
+	// The node the screen is plugged into does the work.
+	if !isLocalTarget(req.TargetIP) {
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Forwarding display power %s request to %s", req.Power, req.TargetIP))
+		resp, err := s.forwardDisplayPower(r.Context(), req.TargetIP, req.Power)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to forward: %v", err))
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	command, out, err := s.setDisplayPower(req.Power)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"power":   req.Power,
+		"command": command,
+		"output":  out,
+	})
+}
+
+// isLocalTarget reports whether a target_ip names this node.
+func isLocalTarget(ip string) bool {
+	return ip == "" || ip == "127.0.0.1" || ip == os.Getenv("NSM_HOST_IP")
+}
+
+// postForward posts a JSON body to a request forwarded to the node at
+// url. It goes out with the request ID in ctx, so the node logs it under
+// the same ID, and signed by this node, so the node admits it as an
+// operator's.
+func (s *Service) postForward(ctx context.Context, url string, body []byte, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	s.auth.PeerSigner().Sign(req, body)
+	client := http.Client{Timeout: timeout}
+	return client.Do(req)
+}
+
+// forwardDisplayPower asks the node at ip to turn its screen on or off.
+// The forwarded request names no target, so the receiving node acts on
+// itself.
+func (s *Service) forwardDisplayPower(ctx context.Context, ip, power string) (*http.Response, error) {
+	url := fmt.Sprintf("http://%s:8080/api/hosts/display-power", s.store.ResolveAddress(ip))
+	body, _ := json.Marshal(map[string]string{"power": power})
+	return s.postForward(ctx, url, body, 15*time.Second)
+}
+
+// setDisplayPower turns this node's screen on or off, returning the
+// command that worked and its output.
+func (s *Service) setDisplayPower(power string) (string, string, error) {
+	var failures []string
+	for _, args := range displayPowerCommands[power] {
+		command := strings.Join(args, " ")
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", command, err))
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("API: Turned display %s with %s", power, command))
+		return command, strings.TrimSpace(string(out)), nil
+	}
+	s.logger.Warning(fmt.Sprintf("API: Display power %s failed: %s", power, strings.Join(failures, "; ")))
+	return "", "", fmt.Errorf("display power failed: %s", strings.Join(failures, "; "))
+}
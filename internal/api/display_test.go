@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func TestHandleDisplayPower(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	saved := displayPowerCommands
+	defer func() { displayPowerCommands = saved }()
+	displayPowerCommands = map[string][][]string{
+		"on":  {{"false"}, {"echo", "display_power=1"}},
+		"off": {{"false"}},
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleDisplayPower(w, httptest.NewRequest(http.MethodPost, "/api/hosts/display-power", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"power": "on"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]string
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["command"] != "echo display_power=1" || resp["output"] != "display_power=1" {
+		t.Errorf("expected the first command that worked, got %v", resp)
+	}
+
+	if w := post(`{"power": "off"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when every command fails, got %d", w.Code)
+	}
+	if w := post(`{"power": "standby"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown power state, got %d", w.Code)
+	}
+}
+
+func TestForwardedRequestWithAuth(t *testing.T) {
+	sender, senderStore, cleanup := setupTest(t)
+	defer cleanup()
+	senderStore.SetNodeID("node-a")
+
+	target, targetStore, cleanup2 := setupTest(t)
+	defer cleanup2()
+	if _, err := target.Auth().Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+
+	saved := displayPowerCommands
+	defer func() { displayPowerCommands = saved }()
+	displayPowerCommands = map[string][][]string{"off": {{"echo", "display_power=0"}}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/hosts/display-power", target.HandleDisplayPower)
+	srv := httptest.NewServer(target.Auth().Middleware(mux))
+	defer srv.Close()
+
+	forward := func() int {
+		resp, err := sender.postForward(context.Background(), srv.URL+"/api/hosts/display-power", []byte(`{"power": "off"}`), 5*time.Second)
+		if err != nil {
+			t.Fatalf("postForward: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// The target has not heard the sender's heartbeats, so it does not
+	// know its key.
+	if status := forward(); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 from a node that has not pinned the sender, got %d", status)
+	}
+	targetStore.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(sender.Auth().Identity().PublicKey())})
+	if status := forward(); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 until an admin confirms the sender's key, got %d", status)
+	}
+	if _, err := targetStore.TrustPeer("node-a", identity.Fingerprint(sender.Auth().Identity().PublicKey()), "admin", time.Now()); err != nil {
+		t.Fatalf("TrustPeer: %v", err)
+	}
+	if status := forward(); status != http.StatusOK {
+		t.Fatalf("expected the forwarded request admitted, got %d", status)
+	}
+
+	entries, _ := targetStore.ListAudit(hosts.AuditQuery{Action: "POST /api/hosts/display-power"})
+	if len(entries) != 1 || entries[0].Actor != "node:node-a" || entries[0].ActorType != hosts.ActorPeer {
+		t.Errorf("expected the request audited as the peer, got %+v", entries)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/hosts/display-power", "application/json", strings.NewReader(`{"power": "off"}`))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unsigned request, got %d", resp.StatusCode)
+	}
+}
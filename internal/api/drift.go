@@ -0,0 +1,194 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// hostDrift is a drifted host as the API shows it.
+type hostDrift struct {
+	hosts.AssetDrift
+	Host string `json:"host"`
+}
+
+// @Title: Asset Drift
+// @Route: GET /api/hosts/assets/drift?id=...
+// @Description: List hosts whose asset list no longer matches their baseline, the list NSM last applied or an operator adopted, as when someone edits the playlist in the CMS dashboard. With id, answer that host with its baseline and the list last read from it
+// @Response: {"drifted": [{"host_id": "...", "host": "Lobby 1", "since": "...", "detail": "4 assets (was 3); added: Happy hour", "added": ["Happy hour"]}]}
+func (s *Service) HandleAssetDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if id := r.URL.Query().Get("id"); id != "" {
+		host, err := s.store.GetByID(id)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, "Host not found")
+			return
+		}
+		baselines, err := s.store.AssetBaselines()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp := map[string]any{"host_id": host.ID, "host": hostName(*host)}
+		if b, ok := baselines[host.ID]; ok {
+			resp["baseline"] = b
+		}
+		if current, ok := s.store.CachedAssets(host.ID); ok {
+			resp["current"] = current
+		}
+		if d, ok := s.store.Drift(host.ID); ok {
+			resp["drift"] = hostDrift{AssetDrift: d, Host: hostName(*host)}
+		}
+		s.writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	names := make(map[string]string)
+	for _, h := range s.store.GetAll() {
+		names[h.ID] = hostName(h)
+	}
+	drifted := []hostDrift{}
+	for _, d := range s.store.Drifts() {
+		if name, ok := names[d.HostID]; ok {
+			drifted = append(drifted, hostDrift{AssetDrift: d, Host: name})
+		}
+	}
+	sort.Slice(drifted, func(i, j int) bool { return drifted[i].Since.Before(drifted[j].Since) })
+	s.writeJSON(w, http.StatusOK, map[string]any{"drifted": drifted})
+}
+
+// @Title: Adopt Assets
+// @Route: POST /api/hosts/assets/adopt?id=...
+// @Description: Accept the asset list of a host as it is now as its new baseline, ending any drift
+// @Response: {"host_id": "...", "assets": 4}
+func (s *Service) HandleAdoptAssets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	host, err := s.store.GetByID(r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	addr := hosts.SelectPath(*host).Address
+	current, err := s.readAssets(*host, 5*time.Second)
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not read playlist from %s: %v", addr, err))
+		return
+	}
+	if err := s.setBaseline(*host, current, hosts.BaselineAdopted); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	auth.AnnotateAudit(r, host.ID, fmt.Sprintf("adopted %d assets", len(current)))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Adopted the asset list of %s as its baseline (%d assets)", host.IPAddress, len(current)))
+	s.writeJSON(w, http.StatusOK, map[string]any{"host_id": host.ID, "assets": len(current)})
+}
+
+// @Title: Reapply Assets
+// @Route: POST /api/hosts/assets/reapply?id=...&force=true
+// @Description: Put a host's asset baseline back on its Anthias, undoing changes made in the Anthias dashboard. Assets not in the baseline are deleted, changed ones restored and missing ones added again. Only Anthias hosts can be re-applied. The baseline is validated first, as by POST /api/playlists/validate; an empty baseline, one with invalid assets or one where nothing would play is refused with 422 and the report, unless force is true
+// @Response: {"host_id": "...", "assets": 3}
+func (s *Service) HandleReapplyAssets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	host, err := s.store.GetByID(r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	if !s.requireAnthias(w, *host) {
+		return
+	}
+	baselines, err := s.store.AssetBaselines()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	baseline, ok := baselines[host.ID]
+	if !ok {
+		s.writeError(w, http.StatusConflict, "The host has no asset baseline yet")
+		return
+	}
+	if r.URL.Query().Get("force") != "true" {
+		report := playlist.NewValidator().Validate(baseline.Assets)
+		if problem := baselineProblem(baseline.Assets, report); problem != "" {
+			s.writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": problem + "; pass force=true to apply it anyway", "report": report})
+			return
+		}
+	}
+
+	addr := hosts.SelectPath(*host).Address
+	user, pass := s.cmsLogin(*host)
+	client := &http.Client{Timeout: 10 * time.Second}
+	player := cms.New(host.CMS, client, user, pass)
+	current, _, err := player.Assets(addr, cms.Validators{})
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not read playlist from %s: %v", addr, err))
+		return
+	}
+	if err := playlist.Apply(client, addr, current, baseline.Assets, user, pass); err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Reapplying assets to %s failed: %v", host.IPAddress, err))
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not reapply assets to %s: %v", addr, err))
+		return
+	}
+
+	// Assets added again have new IDs, so the list read back becomes the
+	// baseline.
+	applied, _, err := player.Assets(addr, cms.Validators{})
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not read playlist from %s: %v", addr, err))
+		return
+	}
+	if err := s.setBaseline(*host, applied, hosts.BaselineReapplied); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	auth.AnnotateAudit(r, host.ID, fmt.Sprintf("reapplied %d assets", len(applied)))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Reapplied the asset baseline of %s (%d assets)", host.IPAddress, len(applied)))
+	s.writeJSON(w, http.StatusOK, map[string]any{"host_id": host.ID, "assets": len(applied)})
+}
+
+// baselineProblem says why assets, validated in report, should not be put
+// on a player, or returns "" if they can be.
+func baselineProblem(assets []playlist.Asset, report playlist.Report) string {
+	switch {
+	case len(assets) == 0:
+		return "the baseline has no assets"
+	case report.Valid < len(assets):
+		return fmt.Sprintf("%d of %d baseline assets are invalid", len(assets)-report.Valid, len(assets))
+	case report.Blank:
+		return "nothing in the baseline would play"
+	}
+	return ""
+}
+
+// setBaseline records assets, just read from host, and makes them its
+// baseline.
+func (s *Service) setBaseline(host types.Host, assets []playlist.Asset, source string) error {
+	now := time.Now()
+	s.store.RecordAssets(host.ID, assets, now)
+	return s.store.SetAssetBaseline(host.ID, assets, source, now)
+}
+
+// hostName names a host for people: its nickname, else its address.
+func hostName(h types.Host) string {
+	if h.Nickname != "" {
+		return h.Nickname
+	}
+	return h.IPAddress
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/vault"
+)
+
+func TestHandleReapplyAssets(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	// A fake Anthias device with an asset list edited in its dashboard.
+	var mu sync.Mutex
+	assets := map[string]map[string]any{
+		"a1": {"asset_id": "a1", "name": "Welcome!", "uri": "https://example.com/welcome", "is_enabled": 1},
+		"a2": {"asset_id": "a2", "name": "Happy hour", "uri": "https://example.com/hh", "is_enabled": 1},
+	}
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/welcome" {
+			return // The asset's content, probed by validation
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "s3cret!" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/api/v1.2/assets/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/assets":
+			list := []map[string]any{}
+			for _, a := range assets {
+				list = append(list, a)
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.Method == http.MethodDelete:
+			delete(assets, id)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPut:
+			var a map[string]any
+			json.NewDecoder(r.Body).Decode(&a)
+			a["asset_id"] = id
+			assets[id] = a
+			json.NewEncoder(w).Encode(a)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer device.Close()
+
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: device.Listener.Addr().String()})
+	if _, err := svc.vault.Put("lobby", vault.KindAnthiasBasic, "admin", "s3cret!"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// A baseline that would not play is refused unless forced.
+	broken := playlist.Asset{ID: "a1", Name: "Welcome", URI: device.URL + "/welcome", IsEnabled: playlist.Enabled(true)}
+	if err := store.SetAssetBaseline("lobby", []playlist.Asset{broken}, hosts.BaselineAdopted, time.Now()); err != nil {
+		t.Fatalf("SetAssetBaseline: %v", err)
+	}
+	w := httptest.NewRecorder()
+	svc.HandleReapplyAssets(w, httptest.NewRequest(http.MethodPost, "/api/hosts/assets/reapply?id=lobby", nil))
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "force=true") {
+		t.Fatalf("Expected an invalid baseline refused with 422, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(assets) != 2 {
+		t.Fatalf("Expected the device untouched, got %v", assets)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleReapplyAssets(w, httptest.NewRequest(http.MethodPost, "/api/hosts/assets/reapply?id=lobby&force=true", nil))
+	if w.Code != http.StatusOK || len(assets) != 1 {
+		t.Fatalf("Expected a forced reapply to go ahead, got %d: %s", w.Code, w.Body.String())
+	}
+
+	welcome := broken
+	welcome.MimeType, welcome.Duration = "webpage", 10
+	if err := store.SetAssetBaseline("lobby", []playlist.Asset{welcome}, hosts.BaselineAdopted, time.Now()); err != nil {
+		t.Fatalf("SetAssetBaseline: %v", err)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleReapplyAssets(w, httptest.NewRequest(http.MethodPost, "/api/hosts/assets/reapply?id=lobby", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(assets) != 1 || assets["a1"]["name"] != "Welcome" {
+		t.Errorf("Expected the baseline back on the device, got %v", assets)
+	}
+	if _, drifted := store.Drift("lobby"); drifted {
+		t.Error("Expected no drift after reapplying")
+	}
+
+	// Adopting takes the device's list as it is.
+	mu.Lock()
+	assets["a3"] = map[string]any{"asset_id": "a3", "name": "Lunch menu", "is_enabled": 1}
+	mu.Unlock()
+	w = httptest.NewRecorder()
+	svc.HandleAdoptAssets(w, httptest.NewRequest(http.MethodPost, "/api/hosts/assets/adopt?id=lobby", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if baselines, _ := store.AssetBaselines(); len(baselines["lobby"].Assets) != 2 || baselines["lobby"].Source != hosts.BaselineAdopted {
+		t.Errorf("Expected the adopted list as the baseline, got %+v", baselines["lobby"])
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleAssetDrift(w, httptest.NewRequest(http.MethodGet, "/api/hosts/assets/drift", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"drifted":[]`) {
+		t.Errorf("Expected no drifted hosts, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// encryptionStatus is the answer of HandleEncryptionSettings.
+type encryptionStatus struct {
+	hosts.EncryptionStatus
+	KeyFile         string `json:"key_file"`
+	KeyFingerprint  string `json:"key_fingerprint,omitempty"`
+	KeyWithDatabase bool   `json:"key_with_database"` // A stolen disk carries the key beside what it seals
+}
+
+// @Title: Settings Encryption
+// @Route: GET|POST /api/settings/encryption
+// @Description: Get or set encryption at rest of settings, where SMTP, MQTT, webhook, OIDC and other integration secrets are kept, and of host notes, snapshots, users' emails and password hashes, invitation emails and audit details and addresses. Values are sealed with AES-256-GCM under a key derived from the node identity key at key_file, which is identity.key next to hosts.db unless NSM_IDENTITY_KEY names another path; key_with_database is true while it is next to hosts.db. Keep a copy of that file: without it encrypted values cannot be read. unopened counts encrypted values the loaded key cannot open, e.g. after the key file was replaced. Host credentials are always encrypted
+// @Response: {"enabled": true, "key_loaded": true, "sealed": 112, "unopened": 0, "key_file": "/media/key/identity.key", "key_fingerprint": "...", "key_with_database": false}
+func (s *Service) HandleEncryptionSettings(w http.ResponseWriter, r *http.Request) {
+	var st hosts.EncryptionStatus
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		st, err = s.store.Encryption()
+	case http.MethodPost:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		st, err = s.store.SetEncryption(req.Enabled)
+		if errors.Is(err, hosts.ErrNoSealer) {
+			s.writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err == nil {
+			auth.AnnotateAudit(r, hosts.EncryptionSettingKey, fmt.Sprintf("enabled=%t", st.Enabled))
+			s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated settings encryption (enabled=%t, %d settings encrypted)", st.Enabled, st.Sealed))
+			if st.Enabled && s.auth.KeyWithDatabase() {
+				s.logger.WarningContext(r.Context(), "API: The node key is stored beside the database; set NSM_IDENTITY_KEY to keep it off the data disk")
+			}
+			if st.Unopened > 0 {
+				s.logger.WarningContext(r.Context(), fmt.Sprintf("API: %d encrypted settings do not open with the loaded node key", st.Unopened))
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	resp := encryptionStatus{EncryptionStatus: st, KeyFile: s.auth.KeyFile(), KeyWithDatabase: s.auth.KeyWithDatabase()}
+	if id := s.auth.Identity(); id != nil {
+		resp.KeyFingerprint = id.Fingerprint()
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
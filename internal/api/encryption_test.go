@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+)
+
+func TestHandleEncryptionSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	if err := svc.auth.SaveSecurity(auth.SecurityConfig{HSTS: true}); err != nil {
+		t.Fatalf("SaveSecurity: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleEncryptionSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/encryption", strings.NewReader(`{"enabled": true}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var st encryptionStatus
+	json.NewDecoder(w.Body).Decode(&st)
+	if !st.Enabled || !st.KeyLoaded || st.Sealed == 0 || st.KeyFile != svc.auth.KeyFile() || st.KeyFingerprint == "" || !st.KeyWithDatabase {
+		t.Errorf("Unexpected status %+v", st)
+	}
+
+	// Settings still read and write as before.
+	if cfg, err := svc.auth.LoadSecurity(); err != nil || !cfg.HSTS {
+		t.Errorf("Expected the encrypted security settings to load, got %+v (%v)", cfg, err)
+	}
+	var hsts bool
+	if _, err := store.GetSetting(auth.SecuritySettingKey, &struct {
+		HSTS *bool `json:"hsts"`
+	}{&hsts}); err != nil || !hsts {
+		t.Errorf("Expected the store to open the setting, got %t (%v)", hsts, err)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleEncryptionSettings(w, httptest.NewRequest(http.MethodPut, "/api/settings/encryption", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/flags"
+)
+
+// flagState is a flag as the API shows it: its definition, whether it is
+// on for this node and which hosts of the list the settings turn it on for.
+type flagState struct {
+	flags.Definition
+	Here  bool     `json:"here"`
+	Hosts []string `json:"hosts"`
+}
+
+// flagStates evaluates cfg for this node and every host in the list.
+func (s *Service) flagStates(cfg flags.Config) []flagState {
+	self := ""
+	if h, err := s.anthias.GetMetadata(); err == nil {
+		self = h.ID
+	}
+	all := s.store.GetAll()
+	out := make([]flagState, 0, len(flags.Known))
+	for _, def := range flags.Known {
+		st := flagState{Definition: def, Hosts: []string{}}
+		if self != "" {
+			st.Here = cfg.Enabled(def.Name, self)
+		} else {
+			st.Here = def.Default
+		}
+		for _, h := range all {
+			if cfg.Enabled(def.Name, h.ID) {
+				st.Hosts = append(st.Hosts, h.ID)
+			}
+		}
+		slices.Sort(st.Hosts)
+		out = append(out, st)
+	}
+	return out
+}
+
+// @Title: Feature Flags
+// @Route: GET|POST /api/flags
+// @Description: Get or replace the feature flag rules of this node, which turn risky subsystems on for part of the fleet: {"rules": {"peer_bus": {"hosts": ["id"], "except": ["id"], "percent": 25}}}. A flag is on for the hosts listed, off for those excepted and on for the given share of the rest, picked by hashing the flag and host ID. Flags without a rule take their default. Rules are not replicated; save the same rules on every node to roll a flag out. The answer lists each flag, whether it is on for this node and the hosts it is on for
+// @Response: {"config": {"rules": {"peer_bus": {"percent": 25}}}, "flags": [{"name": "peer_bus", "description": "...", "default": true, "here": false, "hosts": ["host-1"]}]}
+func (s *Service) HandleFlags(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := flags.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]any{"config": cfg, "flags": s.flagStates(cfg)})
+	case http.MethodPost:
+		var req flags.Config
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		cfg, err := flags.SaveConfig(s.store, req)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var rules []string
+		for name, rule := range cfg.Rules {
+			rules = append(rules, fmt.Sprintf("%s %d%%", name, rule.Percent))
+		}
+		slices.Sort(rules)
+		detail := "defaults"
+		if len(rules) > 0 {
+			detail = strings.Join(rules, ", ")
+		}
+		auth.AnnotateAudit(r, "flags", detail)
+		s.logger.InfoContext(r.Context(), "API: Feature flags saved ("+detail+")")
+		s.writeJSON(w, http.StatusOK, map[string]any{"config": cfg, "flags": s.flagStates(cfg)})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
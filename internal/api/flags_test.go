@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleFlags(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "kiosk-1", Nickname: "Kiosk 1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "kiosk-2", Nickname: "Kiosk 2", IPAddress: "192.168.1.21"})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleFlags(w, httptest.NewRequest(http.MethodPost, "/api/flags", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"rules": {"consensus": {"percent": 10}}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown flag, got %d", w.Code)
+	}
+	w := post(`{"rules": {"peer_bus": {"hosts": ["kiosk-2"], "percent": 0}}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleFlags(w, httptest.NewRequest(http.MethodGet, "/api/flags", nil))
+	var resp struct {
+		Flags []struct {
+			Name  string   `json:"name"`
+			Hosts []string `json:"hosts"`
+		} `json:"flags"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Flags) == 0 || resp.Flags[0].Name != "peer_bus" || strings.Join(resp.Flags[0].Hosts, ",") != "kiosk-2" {
+		t.Errorf("expected peer_bus on for kiosk-2 only, got %+v", resp.Flags)
+	}
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Host list interchange formats supported by export and import.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatCSV  = "csv"
+)
+
+// hostFormat resolves the interchange format for a request. An explicit
+// ?format= parameter wins; otherwise the Content-Type header is consulted and
+// JSON is assumed.
+func hostFormat(queryFormat, contentType string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(queryFormat)) {
+	case "":
+		// Fall back to the Content-Type header below.
+	case formatJSON:
+		return formatJSON, nil
+	case formatYAML, "yml":
+		return formatYAML, nil
+	case formatCSV:
+		return formatCSV, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (use json, yaml, or csv)", queryFormat)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return formatYAML, nil
+	case "text/csv":
+		return formatCSV, nil
+	}
+	return formatJSON, nil
+}
+
+// formatContentType returns the MIME type used when serving a format.
+func formatContentType(format string) string {
+	switch format {
+	case formatYAML:
+		return "application/yaml"
+	case formatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// encodeHosts renders a host list in the requested format. YAML and CSV use
+// the same field names as the JSON API so files can be converted freely.
+func encodeHosts(hostList []types.Host, format string) ([]byte, error) {
+	if hostList == nil {
+		hostList = []types.Host{}
+	}
+
+	switch format {
+	case formatYAML:
+		// Round-trip through JSON so YAML keys match the JSON tags and keep
+		// the struct field order.
+		data, err := json.Marshal(hostList)
+		if err != nil {
+			return nil, err
+		}
+		var ordered []yaml.MapSlice
+		if err := yaml.Unmarshal(data, &ordered); err != nil {
+			return nil, err
+		}
+		return yaml.Marshal(ordered)
+	case formatCSV:
+		return encodeHostsCSV(hostList)
+	default:
+		return json.MarshalIndent(hostList, "", "  ")
+	}
+}
+
+// decodeHosts parses a host list in the given format.
+func decodeHosts(r io.Reader, format string) ([]types.Host, error) {
+	var hostList []types.Host
+
+	switch format {
+	case formatYAML:
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var raw []map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+		for i := range raw {
+			raw[i] = normalizeYAML(raw[i]).(map[string]interface{})
+		}
+		data, err = json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &hostList); err != nil {
+			return nil, fmt.Errorf("invalid host record: %w", err)
+		}
+	case formatCSV:
+		return decodeHostsCSV(r)
+	default:
+		if err := json.NewDecoder(r).Decode(&hostList); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+
+	return hostList, nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values produced by
+// yaml.v2 into map[string]interface{} so they can be re-encoded as JSON.
+func normalizeYAML(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = normalizeYAML(item)
+		}
+		return out
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = normalizeYAML(item)
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeYAML(item)
+		}
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return val
+	}
+}
+
+// csvField describes one Host struct field exposed as a CSV column.
+type csvField struct {
+	name  string
+	index int
+}
+
+// hostCSVFields lists the Host fields in declaration order, keyed by their
+// JSON names. Nested values are written as embedded JSON.
+func hostCSVFields() []csvField {
+	t := reflect.TypeOf(types.Host{})
+	fields := make([]csvField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, csvField{name: name, index: i})
+	}
+	return fields
+}
+
+func encodeHostsCSV(hostList []types.Host) ([]byte, error) {
+	fields := hostCSVFields()
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := make([]string, len(fields))
+	for i, f := range fields {
+		header[i] = f.name
+	}
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for _, h := range hostList {
+		v := reflect.ValueOf(h)
+		record := make([]string, len(fields))
+		for i, f := range fields {
+			cell, err := csvCell(v.Field(f.index))
+			if err != nil {
+				return nil, fmt.Errorf("encode %s: %w", f.name, err)
+			}
+			record[i] = cell
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvCell(v reflect.Value) (string, error) {
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return "", nil
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	default:
+		if v.IsZero() {
+			return "", nil
+		}
+		data, err := json.Marshal(v.Interface())
+		return string(data), err
+	}
+}
+
+// decodeHostsCSV reads a CSV file whose header row names Host JSON fields.
+// Unknown columns are ignored so spreadsheets can carry extra notes.
+func decodeHostsCSV(r io.Reader) ([]types.Host, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return []types.Host{}, nil
+		}
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	byName := make(map[string]csvField)
+	for _, f := range hostCSVFields() {
+		byName[f.name] = f
+	}
+
+	columns := make([]*csvField, len(header))
+	hasAddress := false
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if f, ok := byName[name]; ok {
+			columns[i] = &f
+			if name == "ip_address" || name == "vpn_ip_address" {
+				hasAddress = true
+			}
+		}
+	}
+	if !hasAddress {
+		return nil, fmt.Errorf("CSV header must include ip_address or vpn_ip_address")
+	}
+
+	hostList := []types.Host{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var h types.Host
+		v := reflect.ValueOf(&h).Elem()
+		for i, cell := range record {
+			if i >= len(columns) || columns[i] == nil {
+				continue
+			}
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			if err := setCSVCell(v.Field(columns[i].index), cell); err != nil {
+				return nil, fmt.Errorf("line %d, column %s: %w", line, columns[i].name, err)
+			}
+		}
+		hostList = append(hostList, h)
+	}
+
+	return hostList, nil
+}
+
+func setCSVCell(field reflect.Value, cell string) error {
+	if _, ok := field.Interface().(time.Time); ok {
+		t, err := time.Parse(time.RFC3339, cell)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(cell)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(cell, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(cell, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return json.Unmarshal([]byte(cell), field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/gitexport"
+)
+
+// @Title: Git Export Settings
+// @Route: GET|POST /api/settings/git-export
+// @Description: Get or set the export of fleet state to Git. When enabled, this node commits YAML files of the host list, presets and reboot, report and calendar schedules every interval_minutes and pushes them to branch of remote. For https remotes token is sent as the password of user x-access-token; ssh remotes use the keys of the user NSM runs as. The token is masked on read
+// @Response: {"enabled": true, "remote": "https://git.example.com/venue/fleet.git", "branch": "main", "token": "********", "interval_minutes": 60, "author_name": "nexSign mini", "author_email": "nsm@localhost"}
+func (s *Service) HandleGitExportSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := gitexport.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		cfg := gitexport.DefaultConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored token when the client echoes back the mask.
+		if cfg.Token == cfg.Masked().Token && cfg.Token != "" {
+			current, err := gitexport.LoadConfig(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.Token = current.Token
+		}
+
+		cfg, err := gitexport.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated Git export settings (enabled=%v, branch %s)", cfg.Enabled, cfg.Branch))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Git Export Run
+// @Route: GET|POST /api/settings/git-export/run
+// @Description: GET returns the last export: when it ran, the commit on the remote after it, when it last found changes, and why it failed if it did. POST exports now, whether or not the scheduled export is enabled, and answers the same. A failed export answers 502
+// @Response: {"last_run_at": "...", "commit": "3f2c...", "changed_at": "...", "error": ""}
+func (s *Service) HandleGitExportRun(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		st, err := gitexport.LoadState(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, st)
+	case http.MethodPost:
+		cfg, err := gitexport.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if cfg.Remote == "" {
+			s.writeError(w, http.StatusConflict, "No Git remote configured")
+			return
+		}
+		st, err := gitexport.Export(s.store, cfg, time.Now())
+		auth.AnnotateAudit(r, gitexport.SettingKey, "branch="+cfg.Branch)
+		switch {
+		case errors.Is(err, gitexport.ErrNoGit):
+			s.writeError(w, http.StatusConflict, err.Error())
+		case err != nil:
+			s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Git export failed: %v", err))
+			s.writeJSON(w, http.StatusBadGateway, st)
+		default:
+			s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Exported fleet state to Git (%s)", st.Commit))
+			s.writeJSON(w, http.StatusOK, st)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
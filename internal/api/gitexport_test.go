@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/gitexport"
+)
+
+func TestHandleGitExportSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleGitExportSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/git-export", strings.NewReader(body)))
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleGitExportRun(w, httptest.NewRequest(http.MethodPost, "/api/settings/git-export/run", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected an export without a remote refused, got %d", w.Code)
+	}
+
+	if w := post(`{"enabled": true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a remote required, got %d", w.Code)
+	}
+	w = post(`{"enabled": true, "remote": "https://git.example.com/venue/fleet.git", "token": "secret"}`)
+	var cfg gitexport.Config
+	json.NewDecoder(w.Body).Decode(&cfg)
+	if w.Code != http.StatusOK || cfg.Token != "********" || cfg.Branch != "main" || cfg.IntervalMinutes != 60 {
+		t.Fatalf("expected the settings saved with defaults and the token masked, got %d %+v", w.Code, cfg)
+	}
+
+	// Echoing the mask keeps the stored token.
+	post(`{"enabled": false, "remote": "https://git.example.com/venue/fleet.git", "token": "********"}`)
+	if stored, _ := gitexport.LoadConfig(store); stored.Token != "secret" || stored.Enabled {
+		t.Errorf("expected the stored token kept, got %+v", stored)
+	}
+}
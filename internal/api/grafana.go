@@ -0,0 +1,362 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Grafana reads these endpoints through its simple JSON datasource
+// (grafana-simple-json-datasource, or the JSON plugin that replaced it).
+// Series targets are a metric of hosts.Metrics, for one series per host,
+// or "metric:host id" for one host. The "hosts" target is a table.
+
+// grafanaHostsTarget is the table of hosts.
+const grafanaHostsTarget = "hosts"
+
+// Annotation queries.
+const (
+	grafanaReboots  = "reboots"
+	grafanaDowntime = "downtime"
+	grafanaAssets   = "assets"
+)
+
+// grafanaRange is the time range of a query.
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// grafanaQuery is the body Grafana posts to /query.
+type grafanaQuery struct {
+	Range   grafanaRange `json:"range"`
+	Targets []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"` // timeserie or table
+	} `json:"targets"`
+}
+
+// grafanaAnnotationQuery is the body Grafana posts to /annotations.
+type grafanaAnnotationQuery struct {
+	Range      grafanaRange `json:"range"`
+	Annotation struct {
+		Name  string `json:"name"`
+		Query string `json:"query"` // reboots, downtime or assets, optionally ":host id"; empty for all
+	} `json:"annotation"`
+}
+
+// grafanaAnnotation is one event on a Grafana graph. TimeEnd makes it a
+// region.
+type grafanaAnnotation struct {
+	Annotation any      `json:"annotation"`
+	Time       int64    `json:"time"`
+	TimeEnd    int64    `json:"timeEnd,omitempty"`
+	IsRegion   bool     `json:"isRegion,omitempty"`
+	Title      string   `json:"title"`
+	Text       string   `json:"text"`
+	Tags       []string `json:"tags"`
+}
+
+// grafanaTarget splits a target into its name and host ID.
+func grafanaTarget(target string) (name, hostID string) {
+	name, hostID, _ = strings.Cut(strings.TrimSpace(target), ":")
+	return name, hostID
+}
+
+// grafanaRangeOrDefault fills in the last day for a missing range.
+func grafanaRangeOrDefault(rg grafanaRange, now time.Time) grafanaRange {
+	if rg.To.IsZero() || rg.To.After(now) {
+		rg.To = now
+	}
+	if rg.From.IsZero() || !rg.From.Before(rg.To) {
+		rg.From = rg.To.Add(-24 * time.Hour)
+	}
+	return rg
+}
+
+// @Title: Grafana Datasource
+// @Route: GET /api/grafana
+// @Description: Connection test of the Grafana simple JSON datasource. Point the datasource at /api/grafana with an API key in an "Authorization: Bearer" header
+// @Response: {"status": "ok"}
+func (s *Service) HandleGrafana(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// @Title: Grafana Search
+// @Route: POST /api/grafana/search
+// @Description: The targets Grafana offers in its query editor: each metric for every host, each metric for one host as "metric:host id", and the hosts table. {"target": "lat"} keeps those containing the text
+// @Response: [{"text": "latency_ms", "value": "latency_ms"}, {"text": "latency_ms: Lobby 1", "value": "latency_ms:3f2b9c1e-..."}, {"text": "hosts (table)", "value": "hosts"}]
+func (s *Service) HandleGrafanaSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		req.Target = "" // Older plugins post an empty body
+	}
+
+	type option struct {
+		Text  string `json:"text"`
+		Value string `json:"value"`
+	}
+	hostList := s.store.GetAll()
+	out := []option{}
+	add := func(text, value string) {
+		if req.Target == "" || strings.Contains(strings.ToLower(text), strings.ToLower(req.Target)) {
+			out = append(out, option{Text: text, Value: value})
+		}
+	}
+	for _, metric := range hosts.Metrics {
+		add(metric, metric)
+		for _, h := range hostList {
+			add(metric+": "+hostName(h), metric+":"+h.ID)
+		}
+	}
+	add(grafanaHostsTarget+" (table)", grafanaHostsTarget)
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// @Title: Grafana Query
+// @Route: POST /api/grafana/query
+// @Description: Series and tables for Grafana panels, from the stored host metrics. Points are the averages of the buckets covering the range, at the finest step kept that far back. The hosts table lists each host with its status, health and uptime since the start of the range
+// @Response: [{"target": "latency_ms: Lobby 1", "datapoints": [[3.1, 1767225600000]]}, {"type": "table", "columns": [{"text": "Host", "type": "string"}], "rows": [["Lobby 1", "192.168.1.20", "healthy", "online", 99.5]]}]
+func (s *Service) HandleGrafanaQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	now := time.Now()
+	rg := grafanaRangeOrDefault(req.Range, now)
+
+	hostList := s.store.GetAll()
+	names := make(map[string]string, len(hostList))
+	for _, h := range hostList {
+		names[h.ID] = hostName(h)
+	}
+
+	out := []any{}
+	for _, t := range req.Targets {
+		name, hostID := grafanaTarget(t.Target)
+		if name == grafanaHostsTarget {
+			table, err := s.grafanaHostsTable(hostList, rg, now)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			out = append(out, table)
+			continue
+		}
+		if !hosts.ValidMetric(name) {
+			s.writeError(w, http.StatusBadRequest, "unknown target "+t.Target)
+			return
+		}
+		history, err := s.store.MetricHistory(name, rg.From, now)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		ids := make([]string, 0, len(history))
+		for id := range history {
+			if hostID == "" || id == hostID {
+				ids = append(ids, id)
+			}
+		}
+		slices.SortFunc(ids, func(a, b string) int { return strings.Compare(names[a], names[b]) })
+		for _, id := range ids {
+			label, ok := names[id]
+			if !ok {
+				continue // Deleted since
+			}
+			points := [][2]float64{}
+			for _, p := range history[id] {
+				if p.At.After(rg.To) {
+					break
+				}
+				points = append(points, [2]float64{p.Avg, float64(p.At.UnixMilli())})
+			}
+			out = append(out, map[string]any{"target": name + ": " + label, "datapoints": points})
+		}
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// grafanaHostsTable lists the hosts with their uptime over rg.
+func (s *Service) grafanaHostsTable(hostList []types.Host, rg grafanaRange, now time.Time) (map[string]any, error) {
+	uptime, err := s.store.Uptime(rg.From, now)
+	if err != nil {
+		return nil, err
+	}
+	rows := [][]any{}
+	for _, h := range hostList {
+		var up any
+		if v, ok := uptime[h.ID]; ok {
+			up = v
+		}
+		rows = append(rows, []any{hostName(h), h.IPAddress, string(h.Status), string(h.Health), up})
+	}
+	return map[string]any{
+		"type": "table",
+		"columns": []map[string]string{
+			{"text": "Host", "type": "string"},
+			{"text": "IP address", "type": "string"},
+			{"text": "Status", "type": "string"},
+			{"text": "Health", "type": "string"},
+			{"text": "Uptime %", "type": "number"},
+		},
+		"rows": rows,
+	}, nil
+}
+
+// @Title: Grafana Annotations
+// @Route: POST /api/grafana/annotations
+// @Description: Events for Grafana graphs in the range. The annotation query picks reboots (OS boots from heartbeats, with how the boot before ended), downtime (regions where a host was down, from the up metric) or assets (asset list changes); add ":host id" for one host. An empty query gives all three
+// @Response: [{"annotation": {...}, "time": 1767225600000, "title": "Lobby 1 rebooted", "text": "unexpected shutdown", "tags": ["reboot", "Lobby 1"]}, {"annotation": {...}, "time": 1767225600000, "timeEnd": 1767226500000, "isRegion": true, "title": "Lobby 1 down", "text": "Down for 40% of the time", "tags": ["downtime", "Lobby 1"]}]
+func (s *Service) HandleGrafanaAnnotations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req grafanaAnnotationQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	now := time.Now()
+	rg := grafanaRangeOrDefault(req.Range, now)
+	kind, hostID := grafanaTarget(req.Annotation.Query)
+	switch kind {
+	case "", grafanaReboots, grafanaDowntime, grafanaAssets:
+	default:
+		s.writeError(w, http.StatusBadRequest, "unknown annotation query "+req.Annotation.Query+" (use reboots, downtime or assets)")
+		return
+	}
+
+	names := make(map[string]string)
+	for _, h := range s.store.GetAll() {
+		names[h.ID] = hostName(h)
+	}
+	wanted := func(id string) bool {
+		_, known := names[id]
+		return known && (hostID == "" || id == hostID)
+	}
+	out := []grafanaAnnotation{}
+	add := func(a grafanaAnnotation) {
+		a.Annotation = req.Annotation
+		out = append(out, a)
+	}
+
+	if kind == "" || kind == grafanaReboots {
+		reboots, err := s.store.ListReboots(hostID, rg.From)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, e := range reboots {
+			at := e.BootedAt
+			if at.IsZero() {
+				at = e.RecordedAt
+			}
+			if !wanted(e.NodeID) || at.Before(rg.From) || at.After(rg.To) {
+				continue
+			}
+			text := "Booted"
+			if e.Shutdown != "" {
+				text = e.Shutdown + " shutdown before this boot"
+			}
+			add(grafanaAnnotation{Time: at.UnixMilli(), Title: names[e.NodeID] + " rebooted", Text: text,
+				Tags: []string{"reboot", names[e.NodeID]}})
+		}
+	}
+
+	if kind == "" || kind == grafanaDowntime {
+		history, err := s.store.MetricHistory(hosts.MetricUp, rg.From, now)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		step := hosts.MetricStep(rg.From, now)
+		for id, points := range history {
+			if !wanted(id) {
+				continue
+			}
+			for _, d := range downRegions(points, step) {
+				if d.end.Before(rg.From) || d.start.After(rg.To) {
+					continue
+				}
+				add(grafanaAnnotation{Time: d.start.UnixMilli(), TimeEnd: d.end.UnixMilli(), IsRegion: true,
+					Title: names[id] + " down", Text: d.text(), Tags: []string{"downtime", names[id]}})
+			}
+		}
+	}
+
+	if kind == "" || kind == grafanaAssets {
+		entries, err := s.store.AuditRange(rg.From, rg.To)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, e := range entries {
+			if e.Action != hosts.AuditAssetsChanged || !wanted(e.Target) {
+				continue
+			}
+			add(grafanaAnnotation{Time: e.Time.UnixMilli(), Title: names[e.Target] + " assets changed", Text: e.Detail,
+				Tags: []string{"assets", names[e.Target]}})
+		}
+	}
+
+	slices.SortStableFunc(out, func(a, b grafanaAnnotation) int { return cmp.Compare(a.Time, b.Time) })
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// downRegion is a run of buckets in which a host was down at least once.
+type downRegion struct {
+	start, end time.Time
+	up, count  float64 // Samples up and taken in the run
+}
+
+func (d downRegion) text() string {
+	if d.up == 0 {
+		return "Down throughout"
+	}
+	return fmt.Sprintf("Down for %.0f%% of the time", (d.count-d.up)/d.count*100)
+}
+
+// downRegions joins the consecutive buckets of points, step apart, in
+// which the up metric was below 1.
+func downRegions(points []hosts.MetricPoint, step time.Duration) []downRegion {
+	var out []downRegion
+	for _, p := range points {
+		if p.Avg >= 1 {
+			continue
+		}
+		up, count := p.Avg*float64(p.Count), float64(p.Count)
+		if n := len(out); n > 0 && !out[n-1].end.Before(p.At) {
+			out[n-1].end = p.At.Add(step)
+			out[n-1].up += up
+			out[n-1].count += count
+			continue
+		}
+		out = append(out, downRegion{start: p.At, end: p.At.Add(step), up: up, count: count})
+	}
+	return out
+}
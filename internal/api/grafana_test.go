@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestGrafanaDatasource(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "kiosk", Nickname: "Lobby", IPAddress: "192.168.1.20"})
+	now := time.Now().UTC().Truncate(time.Minute)
+	for i, up := range []float64{1, 0, 0, 1} {
+		store.RecordMetrics("kiosk", map[string]float64{hosts.MetricUp: up, hosts.MetricLatency: 2}, now.Add(time.Duration(i-4)*time.Minute))
+	}
+
+	post := func(h http.HandlerFunc, body string, v any) int {
+		w := httptest.NewRecorder()
+		h(w, httptest.NewRequest(http.MethodPost, "/api/grafana", strings.NewReader(body)))
+		if v != nil {
+			json.Unmarshal(w.Body.Bytes(), v)
+		}
+		return w.Code
+	}
+	rg := `"range": {"from": "` + now.Add(-time.Hour).Format(time.RFC3339) + `", "to": "` + now.Format(time.RFC3339) + `"}`
+
+	var options []struct{ Text, Value string }
+	post(svc.HandleGrafanaSearch, `{"target": "latency"}`, &options)
+	if len(options) != 2 || options[1].Text != "latency_ms: Lobby" || options[1].Value != "latency_ms:kiosk" {
+		t.Errorf("expected the latency targets, got %+v", options)
+	}
+
+	var series []struct {
+		Target     string       `json:"target"`
+		Datapoints [][2]float64 `json:"datapoints"`
+		Type       string       `json:"type"`
+		Rows       [][]any      `json:"rows"`
+	}
+	if code := post(svc.HandleGrafanaQuery, `{`+rg+`, "targets": [{"target": "cpu"}]}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown target, got %d", code)
+	}
+	post(svc.HandleGrafanaQuery, `{`+rg+`, "targets": [{"target": "up:kiosk"}, {"target": "hosts", "type": "table"}]}`, &series)
+	if len(series) != 2 || series[0].Target != "up: Lobby" || len(series[0].Datapoints) != 4 || series[0].Datapoints[1][0] != 0 {
+		t.Fatalf("expected the up series and the hosts table, got %+v", series)
+	}
+	if series[1].Type != "table" || len(series[1].Rows) != 1 || series[1].Rows[0][4] != 50.0 {
+		t.Errorf("expected Lobby at 50%% uptime, got %+v", series[1])
+	}
+
+	var annotations []grafanaAnnotation
+	post(svc.HandleGrafanaAnnotations, `{`+rg+`, "annotation": {"name": "Down", "query": "downtime"}}`, &annotations)
+	if len(annotations) != 1 || !annotations[0].IsRegion || annotations[0].TimeEnd-annotations[0].Time != 2*60*1000 || annotations[0].Title != "Lobby down" {
+		t.Errorf("expected one two-minute downtime region, got %+v", annotations)
+	}
+	if code := post(svc.HandleGrafanaAnnotations, `{"annotation": {"query": "weather"}}`, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown annotation query, got %d", code)
+	}
+}
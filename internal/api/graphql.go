@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/graphql"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/media"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// graphQLSchema describes hosts, events (the audit log), presets
+// (configuration snapshots) and transcode jobs for /api/graphql. Hosts
+// carry their cached Anthias assets and network quality history, so
+// integrators can fetch a host with its history and assets in one request.
+func (s *Service) graphQLSchema() *graphql.Schema {
+	asset := graphql.Struct("Asset", playlist.Asset{})
+	sample := graphql.Struct("QualitySample", hosts.QualitySample{})
+
+	host := graphql.Struct("Host", types.Host{})
+	host.Fields["assets"] = &graphql.Field{Type: asset, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+		assets, _ := s.store.CachedAssets(source.(types.Host).ID)
+		return assets, nil
+	}}
+	host.Fields["quality"] = &graphql.Field{Type: sample, Args: []string{"network"}, Resolve: func(_ context.Context, source any, args graphql.Args) (any, error) {
+		network, err := args.String("network")
+		if err != nil {
+			return nil, err
+		}
+		switch hosts.Network(network) {
+		case "":
+			network = string(hosts.NetworkLAN)
+		case hosts.NetworkLAN, hosts.NetworkVPN:
+		default:
+			return nil, fmt.Errorf("network must be lan or vpn")
+		}
+		return s.store.QualityHistory(source.(types.Host).ID, hosts.Network(network)), nil
+	}}
+
+	preset := graphql.Struct("Preset", hosts.Snapshot{})
+	preset.Fields["hosts"] = &graphql.Field{Type: host, Resolve: func(_ context.Context, source any, _ graphql.Args) (any, error) {
+		snap := source.(hosts.Snapshot)
+		if snap.Hosts == nil {
+			full, err := s.store.GetSnapshot(snap.Name)
+			if err != nil {
+				return nil, err
+			}
+			snap.Hosts = full.Hosts
+		}
+		return snap.Hosts, nil
+	}}
+
+	event := graphql.Struct("Event", hosts.AuditEntry{})
+	job := graphql.Struct("Job", media.Job{})
+
+	return &graphql.Schema{Query: &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"hosts": {Type: host, Args: []string{"query", "health", "view"}, Resolve: s.resolveHosts},
+		"host": {Type: host, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			id, err := args.String("id")
+			if err != nil {
+				return nil, err
+			}
+			h, err := s.store.GetByID(id)
+			if err != nil {
+				return nil, nil
+			}
+			return *h, nil
+		}},
+		"events": {Type: event, Args: []string{"text", "actor", "action", "limit"}, Resolve: s.resolveEvents},
+		"presets": {Type: preset, Resolve: func(context.Context, any, graphql.Args) (any, error) {
+			return s.store.ListSnapshots()
+		}},
+		"preset": {Type: preset, Args: []string{"name"}, Resolve: func(_ context.Context, _ any, args graphql.Args) (any, error) {
+			name, err := args.String("name")
+			if err != nil {
+				return nil, err
+			}
+			snap, err := s.store.GetSnapshot(name)
+			if errors.Is(err, hosts.ErrSnapshotNotFound) {
+				return nil, nil
+			}
+			return snap, err
+		}},
+		"jobs": {Type: job, Resolve: func(context.Context, any, graphql.Args) (any, error) {
+			if s.media == nil {
+				return []media.Job{}, nil
+			}
+			return s.media.List(), nil
+		}},
+	}}}
+}
+
+// resolveHosts filters hosts as saved views do: by text, health, or the
+// caller's saved view.
+func (s *Service) resolveHosts(ctx context.Context, _ any, args graphql.Args) (any, error) {
+	query, err := args.String("query")
+	if err != nil {
+		return nil, err
+	}
+	health, err := args.String("health")
+	if err != nil {
+		return nil, err
+	}
+	name, err := args.String("view")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.filterHosts(ctx, query, health, name)
+}
+
+// resolveEvents returns audit log entries, newest first. As in search, the
+// audit log is for admins; everyone has it in open mode.
+func (s *Service) resolveEvents(ctx context.Context, _ any, args graphql.Args) (any, error) {
+	if u, ok := auth.UserFromContext(ctx); ok && !u.Role.Allows(types.RoleAdmin) {
+		return nil, errors.New("events are only available to admins")
+	}
+	var q hosts.AuditQuery
+	var err error
+	if q.Text, err = args.String("text"); err != nil {
+		return nil, err
+	}
+	if q.Actor, err = args.String("actor"); err != nil {
+		return nil, err
+	}
+	if q.Action, err = args.String("action"); err != nil {
+		return nil, err
+	}
+	if q.Limit, err = args.Int("limit", 50); err != nil {
+		return nil, err
+	}
+	if q.Limit < 1 || q.Limit > 1000 {
+		return nil, errors.New("limit must be between 1 and 1000")
+	}
+	return s.store.ListAudit(q)
+}
+
+// @Title: GraphQL
+// @Route: GET|POST /api/graphql
+// @Description: Run a read-only GraphQL query over hosts (with assets and quality history), events (the audit log; admins only), presets and jobs. POST {"query": "...", "variables": {...}}, or GET with query and variables parameters. Any signed-in user may query; fragments, directives and introspection are not supported
+// @Response: {"data": {"host": {"nickname": "Lobby", "health": "online", "assets": [{"name": "Menu"}], "quality": [{"at": "...", "latency_ms": 4.2}]}}}
+func (s *Service) HandleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				s.writeError(w, http.StatusBadRequest, "variables must be a JSON object")
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing query")
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.graphQLSchema().Do(r.Context(), req))
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleGraphQL(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "10.1.0.20"})
+	store.Add(types.Host{ID: "gym", Nickname: "Gym", IPAddress: "10.2.0.5"})
+	if _, err := store.SaveSnapshot("event-mode", "Stage screens"); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+
+	query := func(r *http.Request) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		svc.HandleGraphQL(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return strings.TrimSpace(w.Body.String())
+	}
+	post := func(body string) *http.Request {
+		return httptest.NewRequest(http.MethodPost, "/api/graphql", strings.NewReader(body))
+	}
+
+	got := query(post(`{"query": "query ($q: String) { hosts(query: $q) { nickname ip_address assets { name } quality { latency_ms } } }", "variables": {"q": "gym"}}`))
+	if want := `{"data":{"hosts":[{"nickname":"Gym","ip_address":"10.2.0.5","assets":[],"quality":[]}]}}`; got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+
+	got = query(httptest.NewRequest(http.MethodGet, `/api/graphql?query={presets{name+host_count+hosts{id}}}`, nil))
+	if !strings.Contains(got, `"name":"event-mode","host_count":2,"hosts":[{"id":`) {
+		t.Errorf("expected the preset with its hosts, got %s", got)
+	}
+
+	got = query(post(`{"query": "{ host(id: \"nope\") { id } jobs { id } }"}`))
+	if want := `{"data":{"host":null,"jobs":[]}}`; got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+
+	// Events follow the audit log's access rule.
+	viewer := post(`{"query": "{ events { action } }"}`)
+	viewer = viewer.WithContext(auth.WithUser(viewer.Context(), types.User{ID: "v", Role: types.RoleViewer}))
+	if got := query(viewer); !strings.Contains(got, "only available to admins") || !strings.Contains(got, `"events":null`) {
+		t.Errorf("expected events to be refused for a viewer, got %s", got)
+	}
+
+	if got := query(post(`{"query": "{ hosts { password } }"}`)); !strings.Contains(got, `"data":null`) {
+		t.Errorf("expected an unknown field to be rejected, got %s", got)
+	}
+}
@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/grpc"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/media"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// GRPCService is the name of the gRPC service in nsm.proto.
+const GRPCService = "nsm.v1.NSM"
+
+// watchInterval is how often WatchHealth looks for health changes. Health
+// is computed on read from heartbeats, so it has to be polled.
+var watchInterval = time.Second
+
+// GRPCHandler serves the gRPC API described in nsm.proto, under the
+// "/nsm.v1.NSM/" path prefix. The methods share the REST handlers' logic
+// and are guarded by the same middleware.
+func (s *Service) GRPCHandler() http.Handler {
+	srv := grpc.NewServer(GRPCService)
+	srv.Unary("ListHosts", s.grpcListHosts)
+	srv.Unary("GetHost", s.grpcGetHost)
+	srv.Unary("CheckHosts", s.grpcCheckHosts)
+	srv.Unary("ListPresets", s.grpcListPresets)
+	srv.Unary("RestorePreset", s.grpcRestorePreset)
+	srv.Unary("ListJobs", s.grpcListJobs)
+	srv.Stream("WatchHealth", s.grpcWatchHealth)
+	return srv
+}
+
+func (s *Service) grpcListHosts(ctx context.Context, req grpc.Fields) (*grpc.Message, error) {
+	list, err := s.filterHosts(ctx, req.String(1), req.String(2), req.String(3))
+	if err != nil {
+		return nil, grpcError(err, grpc.InvalidArgument)
+	}
+	var resp grpc.Message
+	for _, h := range list {
+		resp.Message(1, hostMessage(h))
+	}
+	return &resp, nil
+}
+
+func (s *Service) grpcGetHost(_ context.Context, req grpc.Fields) (*grpc.Message, error) {
+	h, err := s.store.GetByID(req.String(1))
+	if err != nil {
+		return nil, grpc.Errorf(grpc.NotFound, "host not found")
+	}
+	return hostMessage(*h), nil
+}
+
+func (s *Service) grpcCheckHosts(ctx context.Context, req grpc.Fields) (*grpc.Message, error) {
+	ids := req.Strings(1)
+	if view := req.String(2); view != "" {
+		list, err := s.filterHosts(ctx, "", "", view)
+		if err != nil {
+			return nil, grpcError(err, grpc.InvalidArgument)
+		}
+		ids = []string{}
+		for _, h := range list {
+			ids = append(ids, h.ID)
+		}
+	}
+
+	count := len(ids)
+	if ids == nil {
+		count = len(s.store.GetAll())
+	}
+	go func() {
+		s.logger.Info(fmt.Sprintf("API: Starting health check of %d hosts over gRPC...", count))
+		s.store.CheckHosts(ids)
+		s.logger.Info("Manual health check complete")
+	}()
+
+	var resp grpc.Message
+	resp.Int(1, int64(count))
+	return &resp, nil
+}
+
+func (s *Service) grpcListPresets(context.Context, grpc.Fields) (*grpc.Message, error) {
+	snaps, err := s.store.ListSnapshots()
+	if err != nil {
+		return nil, grpcError(err, grpc.Internal)
+	}
+	var resp grpc.Message
+	for _, snap := range snaps {
+		resp.Message(1, presetMessage(snap))
+	}
+	return &resp, nil
+}
+
+func (s *Service) grpcRestorePreset(ctx context.Context, req grpc.Fields) (*grpc.Message, error) {
+	name := req.String(1)
+	if name == "" {
+		return nil, grpc.Errorf(grpc.InvalidArgument, "missing name")
+	}
+	// Held restores are approved over REST, where they run as the
+	// equivalent POST /api/snapshots/restore.
+	cfg, held, err := s.approvalRule(ctx, auth.ApprovalRestore)
+	if err != nil {
+		return nil, grpcError(err, grpc.Internal)
+	}
+	if held {
+		a := s.hold(ctx, cfg, auth.ApprovalRestore, types.RoleOperator, http.MethodPost,
+			"/api/snapshots/restore?name="+url.QueryEscape(name), http.Header{}, nil, s.HandleRestoreSnapshot)
+		return nil, grpc.Errorf(grpc.FailedPrecondition, "held for approval %s; another user must approve it at POST /api/approvals/approve?id=%s", a.ID, a.ID)
+	}
+	snap, err := s.store.RestoreSnapshot(name)
+	if err != nil {
+		return nil, grpcError(err, grpc.Internal)
+	}
+	s.logger.Info(fmt.Sprintf("API: Restored snapshot %q (%d hosts) over gRPC", snap.Name, snap.HostCount))
+	s.presetApplied(snap.Name, "grpc")
+	return presetMessage(snap), nil
+}
+
+func (s *Service) grpcListJobs(context.Context, grpc.Fields) (*grpc.Message, error) {
+	var resp grpc.Message
+	if s.media == nil {
+		return &resp, nil
+	}
+	for _, j := range s.media.List() {
+		resp.Message(1, jobMessage(j))
+	}
+	return &resp, nil
+}
+
+// grpcWatchHealth sends every watched host, then each host whose health
+// differs from what was last sent, until the client goes away.
+func (s *Service) grpcWatchHealth(ctx context.Context, req grpc.Fields, send func(*grpc.Message) error) error {
+	ids := req.Strings(1)
+	sent := make(map[string]types.HealthStatus)
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		for _, h := range s.store.GetAll() {
+			if len(ids) > 0 && !slices.Contains(ids, h.ID) {
+				continue
+			}
+			prev, seen := sent[h.ID]
+			if seen && prev == h.Health {
+				continue
+			}
+			var event grpc.Message
+			event.Message(1, hostMessage(h))
+			event.String(2, string(prev))
+			if err := send(&event); err != nil {
+				return err
+			}
+			sent[h.ID] = h.Health
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// grpcError reports missing snapshots and views as NotFound, and other
+// errors with code.
+func grpcError(err error, code grpc.Code) error {
+	if errors.Is(err, hosts.ErrSnapshotNotFound) || errors.Is(err, hosts.ErrViewNotFound) {
+		code = grpc.NotFound
+	}
+	return grpc.Errorf(code, "%v", err)
+}
+
+// The messages below follow nsm.proto.
+
+func hostMessage(h types.Host) *grpc.Message {
+	var m grpc.Message
+	m.String(1, h.ID)
+	m.String(2, h.Nickname)
+	m.String(3, h.IPAddress)
+	m.String(4, h.VPNIPAddress)
+	m.String(5, h.Hostname)
+	m.String(6, h.Notes)
+	m.String(7, string(h.Status))
+	m.String(8, string(h.StatusVPN))
+	m.String(9, string(h.Health))
+	m.Time(10, h.LastSeen)
+	m.Time(11, h.LastChecked)
+	m.String(12, h.NSMVersion)
+	m.String(13, h.AnthiasVersion)
+	m.Int(14, int64(h.AssetCount))
+	m.Double(15, h.LatencyMS)
+	m.Int(16, int64(h.LossPercent))
+	m.String(17, h.DashboardURL)
+	m.Time(18, h.ContentExpiresAt)
+	m.String(19, h.Timezone)
+	m.String(20, string(h.CMS))
+	return &m
+}
+
+func presetMessage(snap hosts.Snapshot) *grpc.Message {
+	var m grpc.Message
+	m.String(1, snap.Name)
+	m.String(2, snap.Description)
+	m.Time(3, snap.CreatedAt)
+	m.Int(4, int64(snap.HostCount))
+	return &m
+}
+
+func jobMessage(j media.Job) *grpc.Message {
+	var m grpc.Message
+	m.String(1, j.ID)
+	m.String(2, j.Name)
+	m.String(3, j.Profile)
+	m.String(4, j.Status)
+	m.Double(5, j.Progress)
+	m.String(6, j.Error)
+	m.Int(7, j.InputSize)
+	m.Int(8, j.OutputSize)
+	m.Time(9, j.CreatedAt)
+	m.Time(10, j.StartedAt)
+	m.Time(11, j.FinishedAt)
+	return &m
+}
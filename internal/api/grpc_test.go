@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/grpc"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// grpcCall posts req over cleartext HTTP/2, as gRPC clients do, and
+// returns the response messages and status.
+func grpcCall(t *testing.T, ctx context.Context, url, method string, req *grpc.Message, want int) []grpc.Fields {
+	t.Helper()
+	body := make([]byte, 5, 5+len(req.Bytes()))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(req.Bytes())))
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, url+"/"+GRPCService+"/"+method, bytes.NewReader(append(body, req.Bytes()...)))
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("TE", "trailers")
+
+	transport := &http.Transport{Protocols: new(http.Protocols)}
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	resp, err := (&http.Client{Transport: transport}).Do(r)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var msgs []grpc.Fields
+	for {
+		var prefix [5]byte
+		if _, err := io.ReadFull(resp.Body, prefix[:]); err != nil {
+			break
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		io.ReadFull(resp.Body, msg)
+		f, err := grpc.Decode(msg)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		msgs = append(msgs, f)
+		if want < 0 && len(msgs) == -want {
+			return msgs // Enough of a stream
+		}
+	}
+	if got := resp.Trailer.Get("Grpc-Status"); got != strconv.Itoa(want) {
+		t.Fatalf("%s: expected status %d, got %q (%s)", method, want, got, resp.Trailer.Get("Grpc-Message"))
+	}
+	return msgs
+}
+
+func TestGRPC(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "10.1.0.20"})
+	store.Add(types.Host{ID: "gym", Nickname: "Gym", IPAddress: "10.2.0.5"})
+	if _, err := store.SaveSnapshot("event-mode", ""); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(svc.GRPCHandler())
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+	ctx := context.Background()
+
+	var req grpc.Message
+	req.String(1, "10.1")
+	msgs := grpcCall(t, ctx, ts.URL, "ListHosts", &req, 0)
+	if len(msgs) != 1 || len(msgs[0][1]) != 1 {
+		t.Fatalf("expected one host, got %v", msgs)
+	}
+	host, _ := grpc.Decode(msgs[0][1][0].([]byte))
+	if host.String(1) != "lobby" || host.String(3) != "10.1.0.20" {
+		t.Errorf("unexpected host %v", host)
+	}
+
+	req = grpc.Message{}
+	req.String(1, "nope")
+	grpcCall(t, ctx, ts.URL, "GetHost", &req, int(grpc.NotFound))
+	grpcCall(t, ctx, ts.URL, "RestorePreset", &req, int(grpc.NotFound))
+
+	req = grpc.Message{}
+	req.String(2, "sideways")
+	grpcCall(t, ctx, ts.URL, "ListHosts", &req, int(grpc.InvalidArgument))
+
+	req = grpc.Message{}
+	req.String(1, "event-mode")
+	msgs = grpcCall(t, ctx, ts.URL, "RestorePreset", &req, 0)
+	if len(msgs) != 1 || msgs[0].String(1) != "event-mode" || msgs[0].Int(4) != 2 {
+		t.Errorf("unexpected preset %v", msgs)
+	}
+
+	// The stream starts with every watched host.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req = grpc.Message{}
+	req.String(1, "gym")
+	msgs = grpcCall(t, ctx, ts.URL, "WatchHealth", &req, -1)
+	host, _ = grpc.Decode(msgs[0][1][0].([]byte))
+	if host.String(1) != "gym" || msgs[0].String(2) != "" {
+		t.Errorf("unexpected first event %v", msgs[0])
+	}
+}
+
+func TestGRPCRestoreHeld(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "lobby", IPAddress: "10.1.0.20"})
+	if _, err := store.SaveSnapshot("event-mode", ""); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	store.Add(types.Host{ID: "gym", IPAddress: "10.2.0.5"})
+	alice, _ := svc.auth.CreateUser("alice", "", "alice-password", types.RoleOperator)
+	bob, _ := svc.auth.CreateUser("bob", "", "bob-password", types.RoleOperator)
+	if _, err := svc.auth.SaveApprovals(auth.ApprovalConfig{Actions: []string{auth.ApprovalRestore}}); err != nil {
+		t.Fatalf("SaveApprovals: %v", err)
+	}
+
+	grpcHandler := svc.GRPCHandler()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grpcHandler.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), alice)))
+	}))
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	defer ts.Close()
+
+	var req grpc.Message
+	req.String(1, "event-mode")
+	grpcCall(t, context.Background(), ts.URL, "RestorePreset", &req, int(grpc.FailedPrecondition))
+	if n := len(store.GetAll()); n != 2 {
+		t.Fatalf("Expected the restore held, got %d hosts", n)
+	}
+	pending := svc.approvals.list()
+	if len(pending) != 1 || pending[0].Action != auth.ApprovalRestore || pending[0].RequestedBy != "alice" {
+		t.Fatalf("Expected alice's restore pending, got %+v", pending)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/approvals/approve?id="+pending[0].ID, nil)
+	w := httptest.NewRecorder()
+	svc.HandleApprove(w, r.WithContext(auth.WithUser(r.Context(), bob)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the approved restore to run, got %d: %s", w.Code, w.Body.String())
+	}
+	if list := store.GetAll(); len(list) != 1 || list[0].ID != "lobby" {
+		t.Errorf("Expected the preset restored, got %+v", list)
+	}
+}
@@ -20,8 +20,8 @@ func (s *Service) HandleHealth(w http.ResponseWriter, r *http.Request) {
 
 // @Title: Get Version
 // @Route: GET /api/version
-// @Description: Returns NSM version and node ID
-// @Response: {"version": "...", "status": "ok", "id": "..."}
+// @Description: Returns NSM version, node ID and the node's clock (UTC), which peers use to detect clock skew
+// @Response: {"version": "...", "status": "ok", "id": "...", "time": "2026-01-02T15:04:05.123Z"}
 func (s *Service) HandleVersion(w http.ResponseWriter, r *http.Request) {
 	hostname, _ := os.Hostname()
 	
@@ -31,6 +31,7 @@ func (s *Service) HandleVersion(w http.ResponseWriter, r *http.Request) {
 		"hostname": hostname,
 		"go_ver":   runtime.Version(),
 		"os_arch":  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		"time":     time.Now().UTC().Format(time.RFC3339Nano),
 	}
 
 	if meta, err := s.anthias.GetMetadata(); err == nil {
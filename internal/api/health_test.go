@@ -1,8 +1,10 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -74,3 +76,48 @@ func TestHandleCheckHost_NotFound(t *testing.T) {
 		t.Errorf("Expected status NotFound, got %v", resp.Status)
 	}
 }
+
+func TestHandleVersionReportsTime(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleVersion(w, httptest.NewRequest(http.MethodGet, "/api/version", nil))
+
+	var body struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if d := time.Since(body.Time); d < 0 || d > time.Minute {
+		t.Errorf("expected the current time, got %v", body.Time)
+	}
+}
+
+func TestHandleTimeSyncLocal(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	saved := timeSyncCommands
+	defer func() { timeSyncCommands = saved }()
+	timeSyncCommands = [][]string{{"false"}, {"echo", "synced"}}
+
+	w := httptest.NewRecorder()
+	svc.HandleTimeSync(w, httptest.NewRequest(http.MethodPost, "/api/hosts/time-sync", strings.NewReader(`{"target_ip": "127.0.0.1"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+	if body["command"] != "echo synced" || body["output"] != "synced" {
+		t.Errorf("expected the fallback command to run, got %v", body)
+	}
+
+	timeSyncCommands = [][]string{{"false"}}
+	w = httptest.NewRecorder()
+	svc.HandleTimeSync(w, httptest.NewRequest(http.MethodPost, "/api/hosts/time-sync", strings.NewReader(`{}`)))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when every command fails, got %d", w.Code)
+	}
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// maxHeartbeatSize bounds the body of an unauthenticated heartbeat. The
+// sender's links take about 150 bytes per host, so this fits a fleet of
+// a few hundred.
+const maxHeartbeatSize = 64 << 10
+
+// @Title: Receive Heartbeat
+// @Route: POST /api/heartbeat
+// @Description: Accept a signed heartbeat from another NSM node in the host list
+// @Response: 204 No Content
+func (s *Service) HandleHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxHeartbeatSize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read heartbeat")
+		return
+	}
+
+	peer, err := heartbeat.Accept(s.store, data, r.RemoteAddr, time.Now().UTC())
+	switch {
+	case err == nil:
+		s.store.ResetBackoff(peer.NodeID)
+		s.followLease(peer)
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, heartbeat.ErrUnknownNode):
+		s.writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, heartbeat.ErrBadSignature):
+		s.writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, heartbeat.ErrKeyMismatch):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected heartbeat from %s: %v", r.RemoteAddr, err))
+		s.writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, heartbeat.ErrReplay), errors.Is(err, heartbeat.ErrClockSkew):
+		s.writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// followLease re-homes a node whose signed heartbeats come from a new
+// address on its subnet, as after a new DHCP lease. The first heartbeat
+// from a node only pins its key, so it proves nothing yet; an address on
+// another subnet is more likely NAT than a move and is left for the
+// conflicts list.
+func (s *Service) followLease(peer hosts.Peer) {
+	if !peer.FirstSeen.Before(peer.LastSeen) {
+		return
+	}
+	host, err := s.store.GetByID(peer.NodeID)
+	if err != nil || peer.Address == host.IPAddress || peer.Address == host.VPNIPAddress ||
+		!hosts.SameSubnet(host.IPAddress, peer.Address) {
+		return
+	}
+	s.followHost(peer.NodeID, peer.Address, "heartbeat")
+}
+
+// followHost moves a known host to ip, logging the change. Hosts listed
+// by DNS name stay as they are: the name follows the lease by itself.
+func (s *Service) followHost(id, ip, via string) {
+	host, err := s.store.GetByID(id)
+	if err != nil || host.IPAddress == ip || hosts.IsHostname(host.IPAddress) {
+		return
+	}
+	moved, err := s.store.Rehome(id, ip, via)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("API: %s (%s) seen at %s by %s but not moved: %v", host.Nickname, host.IPAddress, ip, via, err))
+		return
+	}
+	if moved {
+		s.logger.Info(fmt.Sprintf("API: %s moved from %s to %s (%s)", host.Nickname, host.IPAddress, ip, via))
+	}
+}
+
+// peerHealth is a peer's heartbeat state with its computed health and the
+// fingerprint of its pinned key, for an admin to compare before trusting it.
+type peerHealth struct {
+	hosts.Peer
+	Fingerprint string             `json:"fingerprint,omitempty"`
+	Health      types.HealthStatus `json:"health"`
+}
+
+// @Title: List Peers
+// @Route: GET /api/peers
+// @Description: List NSM nodes this node has received heartbeats from, with their health
+// @Response: {"thresholds": {"interval_seconds": 10, ...}, "peers": [{"node_id": "...", "hostname": "...", "last_seen": "...", "trusted_by": "admin", "fingerprint": "...", "health": "online"}]}
+func (s *Service) HandlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	peers, err := s.store.ListPeers()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	thresholds := types.DefaultHealthThresholds()
+	now := time.Now()
+	out := make([]peerHealth, 0, len(peers))
+	for _, p := range peers {
+		ph := peerHealth{Peer: p, Health: types.DetermineHealth(p.Liveness(), now, thresholds)}
+		if pub, err := base64.StdEncoding.DecodeString(p.PublicKey); err == nil && len(pub) == ed25519.PublicKeySize {
+			ph.Fingerprint = identity.Fingerprint(pub)
+		}
+		out = append(out, ph)
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"thresholds": map[string]float64{
+			"interval_seconds":       thresholds.Interval.Seconds(),
+			"degraded_after_seconds": thresholds.DegradedAfter.Seconds(),
+			"offline_after_seconds":  thresholds.OfflineAfter.Seconds(),
+			"startup_grace_seconds":  thresholds.StartupGrace.Seconds(),
+		},
+		"peers": out,
+	})
+}
+
+// @Title: Forget Peer
+// @Route: POST /api/peers/forget?id=...
+// @Description: Drop a peer's heartbeat state and pinned key, e.g. after it was reinstalled with a new identity
+// @Response: 204 No Content
+func (s *Service) HandleForgetPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	if err := s.store.DeletePeer(id); err != nil {
+		if errors.Is(err, hosts.ErrPeerNotFound) {
+			s.writeError(w, http.StatusNotFound, "Peer not found")
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.peerLogs.Forget(id)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Forgot peer %s", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Trust Peer
+// @Route: POST /api/peers/trust?id=...&fingerprint=...
+// @Description: Confirm a peer's pinned key after comparing its fingerprint with the key_fingerprint the peer shows, so requests it signs act as an operator
+// @Response: {"node_id": "...", "trusted_by": "admin", "trusted_at": "..."}
+func (s *Service) HandleTrustPeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if id == "" || fingerprint == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' or 'fingerprint' query parameter")
+		return
+	}
+
+	by := "anonymous"
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		by = u.Username
+	}
+	peer, err := s.store.TrustPeer(id, fingerprint, by, time.Now())
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		s.writeError(w, http.StatusNotFound, "Peer not found")
+		return
+	case errors.Is(err, hosts.ErrFingerprintMismatch):
+		s.writeError(w, http.StatusConflict, "Fingerprint does not match the key this node pinned for the peer; check it on the peer, or forget the peer if it was reinstalled")
+		return
+	case err != nil:
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	auth.AnnotateAudit(r, id, "trusted key "+fingerprint)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: %s trusted peer %s (%s)", by, id, fingerprint))
+	s.writeJSON(w, http.StatusOK, peer)
+}
+
+// @Title: Maintenance Mode
+// @Route: GET|POST /api/maintenance
+// @Description: Show or set whether this node reports maintenance in its heartbeats
+// @Response: {"enabled": true}
+func (s *Service) HandleMaintenance(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var enabled bool
+		if _, err := s.store.GetSetting(heartbeat.MaintenanceSettingKey, &enabled); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]bool{"enabled": enabled})
+	case http.MethodPost:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		if err := s.store.PutSetting(heartbeat.MaintenanceSettingKey, req.Enabled); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		state := "off"
+		if req.Enabled {
+			state = "on"
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Maintenance mode %s", state))
+		s.writeJSON(w, http.StatusOK, map[string]bool{"enabled": req.Enabled})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleMaintenance(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	do := func(method, body string) (int, bool) {
+		w := httptest.NewRecorder()
+		svc.HandleMaintenance(w, httptest.NewRequest(method, "/api/maintenance", strings.NewReader(body)))
+		var resp struct {
+			Enabled bool `json:"enabled"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp.Enabled
+	}
+
+	if code, enabled := do(http.MethodGet, ""); code != http.StatusOK || enabled {
+		t.Fatalf("expected maintenance off by default, got %d %v", code, enabled)
+	}
+	if code, enabled := do(http.MethodPost, `{"enabled": true}`); code != http.StatusOK || !enabled {
+		t.Fatalf("expected maintenance on, got %d %v", code, enabled)
+	}
+	if _, enabled := do(http.MethodGet, ""); !enabled {
+		t.Error("expected maintenance setting to persist")
+	}
+	if code, _ := do(http.MethodPost, `not json`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid body, got %d", code)
+	}
+}
+
+func TestHandleTrustPeer(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	id, _ := identity.Generate()
+	other, _ := identity.Generate()
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey()), LastSeen: time.Now()})
+
+	w := httptest.NewRecorder()
+	svc.HandlePeers(w, httptest.NewRequest(http.MethodGet, "/api/peers", nil))
+	var list struct {
+		Peers []struct {
+			NodeID      string `json:"node_id"`
+			Fingerprint string `json:"fingerprint"`
+			TrustedBy   string `json:"trusted_by"`
+		} `json:"peers"`
+	}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list.Peers) != 1 || list.Peers[0].Fingerprint != identity.Fingerprint(id.PublicKey()) || list.Peers[0].TrustedBy != "" {
+		t.Fatalf("expected the untrusted peer listed with its fingerprint, got %+v", list.Peers)
+	}
+
+	trust := func(query string) int {
+		w := httptest.NewRecorder()
+		svc.HandleTrustPeer(w, httptest.NewRequest(http.MethodPost, "/api/peers/trust?"+query, nil))
+		return w.Code
+	}
+	if code := trust("id=node-a"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a fingerprint, got %d", code)
+	}
+	if code := trust("id=gone&fingerprint=" + identity.Fingerprint(id.PublicKey())); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown peer, got %d", code)
+	}
+	if code := trust("id=node-a&fingerprint=" + identity.Fingerprint(other.PublicKey())); code != http.StatusConflict {
+		t.Errorf("expected 409 for another key's fingerprint, got %d", code)
+	}
+	if peer, _ := store.GetPeer("node-a"); peer.Trusted() {
+		t.Fatal("expected the peer left untrusted")
+	}
+	if code := trust("id=node-a&fingerprint=" + identity.Fingerprint(id.PublicKey())); code != http.StatusOK {
+		t.Fatalf("expected the peer trusted, got %d", code)
+	}
+	if peer, _ := store.GetPeer("node-a"); !peer.Trusted() {
+		t.Error("expected the confirmation stored")
+	}
+}
+
+func TestHandleHeartbeatFollowsLease(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "node-a", Nickname: "Foyer", Notes: "Above the door", IPAddress: "192.168.1.20"})
+	// The display after its new lease, added again by a scan.
+	store.Add(types.Host{ID: "placeholder", Nickname: "Discovered Host", IPAddress: "192.168.1.45"})
+
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	booted := time.Now().UTC().Add(-time.Hour)
+	send := func(seq uint64, from string) int {
+		data, err := heartbeat.Seal(heartbeat.Beat{NodeID: "node-a", BootedAt: booted, SentAt: time.Now().UTC(), Seq: seq}, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, heartbeat.Path, bytes.NewReader(data))
+		req.RemoteAddr = from
+		w := httptest.NewRecorder()
+		svc.HandleHeartbeat(w, req)
+		return w.Code
+	}
+
+	// The first heartbeat only pins the key.
+	if code := send(1, "192.168.1.45:40000"); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if h, _ := store.GetByID("node-a"); h.IPAddress != "192.168.1.20" {
+		t.Fatalf("expected no move on the first heartbeat, got %s", h.IPAddress)
+	}
+
+	send(2, "192.168.1.45:40000")
+	h, err := store.GetByID("node-a")
+	if err != nil || h.IPAddress != "192.168.1.45" || h.Notes != "Above the door" {
+		t.Fatalf("expected node-a at its new address with its notes, got %+v (%v)", h, err)
+	}
+	if _, err := store.GetByID("placeholder"); err == nil {
+		t.Error("expected the placeholder record to be replaced")
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: hosts.AuditIPChanged})
+	if len(entries) != 1 || entries[0].Target != "node-a" {
+		t.Errorf("expected one IP change event, got %+v", entries)
+	}
+
+	// Another subnet is more likely NAT than a new lease.
+	send(3, "10.0.0.5:40000")
+	if h, _ := store.GetByID("node-a"); h.IPAddress != "192.168.1.45" {
+		t.Errorf("expected no move across subnets, got %s", h.IPAddress)
+	}
+}
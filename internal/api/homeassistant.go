@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/homeassistant"
+)
+
+// @Title: Home Assistant Settings
+// @Route: GET|POST /api/settings/home-assistant
+// @Description: Get or update the Home Assistant bridge (enabled, discovery_prefix, api_key). It publishes each display over MQTT discovery to the broker in the MQTT settings, with a power switch and a current asset sensor. The API key is masked in responses and kept when sent back masked or empty
+// @Response: {"enabled": true, "discovery_prefix": "homeassistant", "api_key": "********"}
+func (s *Service) HandleHomeAssistantSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := homeassistant.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg homeassistant.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		cfg, err := homeassistant.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated Home Assistant settings (enabled %t, prefix %q)", cfg.Enabled, cfg.DiscoveryPrefix))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
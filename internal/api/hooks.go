@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hooks"
+)
+
+// hookSettings is the body of the hook settings endpoint.
+type hookSettings struct {
+	Hooks  []hooks.Hook            `json:"hooks"`
+	Events []string                `json:"events,omitempty"` // What hooks can subscribe to; ignored on write
+	Dir    string                  `json:"dir,omitempty"`    // Where executables go; ignored on write
+	State  map[string]hooks.Result `json:"state,omitempty"`  // Last run of each hook; ignored on write
+}
+
+// @Title: Hook Settings
+// @Route: GET|POST /api/settings/hooks
+// @Description: Get or replace the hooks run on fleet events: host_added, host_offline, host_online, preset_applied and upgrade_finished. A hook either runs command, an executable installed by hand in dir on this node, with the event as JSON on standard input and NSM_EVENT set, or posts the event to url, signed in X-NSM-Signature when secret is set. Each run is stopped after timeout_seconds (default 10, at most 300). state holds the last run of each hook. Secrets are masked on read
+// @Response: {"hooks": [{"name": "relay", "enabled": true, "events": ["host_offline"], "command": "relay.sh", "timeout_seconds": 10}], "events": ["host_added", "..."], "dir": "/home/nsm/nsm-app/hooks", "state": {"relay": {"event": "host_offline", "at": "...", "duration_ms": 120}}}
+func (s *Service) HandleHookSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := hooks.Load(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		st, err := hooks.LoadState(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, hookSettings{Hooks: maskHooks(list), Events: hooks.Events, Dir: hooks.Dir(s.store), State: st})
+	case http.MethodPost:
+		var req hookSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		current, err := hooks.Load(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Keep a stored secret when the client echoes back the mask.
+		for i, h := range req.Hooks {
+			if h.Secret == "" || h.Secret != h.Masked().Secret {
+				continue
+			}
+			req.Hooks[i].Secret = ""
+			for _, c := range current {
+				if c.Name == h.Name {
+					req.Hooks[i].Secret = c.Secret
+				}
+			}
+		}
+
+		list, err := hooks.Save(s.store, req.Hooks)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		auth.AnnotateAudit(r, hooks.SettingKey, fmt.Sprintf("%d hooks", len(list)))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated hooks (%d configured)", len(list)))
+		s.writeJSON(w, http.StatusOK, hookSettings{Hooks: maskHooks(list)})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Test Hook
+// @Route: POST /api/settings/hooks/test
+// @Description: Run a configured hook now with a test event, whether or not it is enabled, and wait for it to finish; body {"name": "relay"}. A hook that fails or times out answers 502 with the error
+// @Response: {"event": "test", "at": "...", "duration_ms": 120, "error": ""}
+func (s *Service) HandleHookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	list, err := hooks.Load(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, h := range list {
+		if h.Name != req.Name {
+			continue
+		}
+		res := hooks.Run(s.store, h, hooks.Event{Event: hooks.EventTest})
+		auth.AnnotateAudit(r, h.Name, "test")
+		if res.Error != "" {
+			s.writeJSON(w, http.StatusBadGateway, res)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, res)
+		return
+	}
+	s.writeError(w, http.StatusNotFound, fmt.Sprintf("No hook named %q", req.Name))
+}
+
+func maskHooks(list []hooks.Hook) []hooks.Hook {
+	out := make([]hooks.Hook, len(list))
+	for i, h := range list {
+		out[i] = h.Masked()
+	}
+	return out
+}
+
+// presetApplied runs the hooks for a preset restored by source.
+func (s *Service) presetApplied(preset, source string) {
+	hooks.Fire(s.store, s.logger, hooks.Event{Event: hooks.EventPresetApplied, Preset: preset, Source: source})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hooks"
+)
+
+func TestHandleHookSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleHookSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/hooks", strings.NewReader(body)))
+		return w
+	}
+	if w := post(`{"hooks": [{"name": "x", "events": ["host_added"], "command": "/bin/sh"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a command outside the hooks directory refused, got %d", w.Code)
+	}
+	if w := post(`{"hooks": [{"name": "crm", "enabled": true, "events": ["preset_applied"], "url": "http://127.0.0.1:1/", "secret": "s3cret"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("expected hooks saved, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleHookSettings(w, httptest.NewRequest(http.MethodGet, "/api/settings/hooks", nil))
+	var got hookSettings
+	json.NewDecoder(w.Body).Decode(&got)
+	if len(got.Hooks) != 1 || got.Hooks[0].Secret != "********" || got.Dir != hooks.Dir(store) || len(got.Events) == 0 {
+		t.Fatalf("unexpected settings %+v", got)
+	}
+
+	// Echoing the mask back keeps the secret.
+	body, _ := json.Marshal(hookSettings{Hooks: got.Hooks})
+	post(string(body))
+	if list, _ := hooks.Load(store); list[0].Secret != "s3cret" {
+		t.Errorf("expected the stored secret kept, got %q", list[0].Secret)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleHookTest(w, httptest.NewRequest(http.MethodPost, "/api/settings/hooks/test", strings.NewReader(`{"name": "missing"}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown hook reported, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleHookTest(w, httptest.NewRequest(http.MethodPost, "/api/settings/hooks/test", strings.NewReader(`{"name": "crm"}`)))
+	var res hooks.Result
+	json.NewDecoder(w.Body).Decode(&res)
+	if w.Code != http.StatusBadGateway || res.Event != hooks.EventTest || res.Error == "" {
+		t.Errorf("expected an unreachable hook reported as 502, got %d %+v", w.Code, res)
+	}
+}
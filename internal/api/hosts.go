@@ -1,33 +1,72 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/alerts"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/cms"
 	"nexsign.mini/nsm/internal/hosts"
 	"nexsign.mini/nsm/internal/types"
 )
 
 // @Title: Get All Hosts
 // @Route: GET /api/hosts
-// @Description: Get all hosts in the fleet
-// @Response: Array of Host objects
+// @Description: Get all hosts in the fleet (supports ETag/If-None-Match)
+// @Response: Array of Host objects, or 304 Not Modified
 func (s *Service) HandleHosts(w http.ResponseWriter, r *http.Request) {
-	// s.logger.Info("Retrieving all hosts") // Too noisy for polling?
-	// The user said "especially the api endpoints".
-	// Let's log it but maybe we can filter it out in the UI if it's too much.
-	// Actually, HandleHosts is polled by the UI? No, UI uses SSE.
-	// So this is likely manual or external.
-	s.logger.Info("API: Get all hosts")
-	s.writeJSON(w, http.StatusOK, s.store.GetAll())
+	// The dashboard uses SSE, so callers here are external pollers. Answer
+	// conditional requests with 304 so unchanged lists cost a header only.
+	// There is no Last-Modified: health and last-seen are derived from
+	// heartbeats and the clock on every read, so the list can change
+	// without a write to the store.
+	body, err := json.Marshal(s.store.GetAll())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to encode host list")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:16]))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if etagMatches(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), "API: Get all hosts")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(body, '\n'))
+}
+
+// etagMatches reports whether the request's If-None-Match names etag.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
 }
 
 // @Title: Add Host
 // @Route: POST /api/hosts/add
-// @Description: Add a new host to the fleet
+// @Description: Add a new host to the fleet; cms optionally names the CMS its player runs, anthias (the default) or pisignage
 // @Response: 204 No Content
 func (s *Service) HandleAddHost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -40,6 +79,7 @@ func (s *Service) HandleAddHost(w http.ResponseWriter, r *http.Request) {
 		IPAddress   string `json:"ip_address"`
 		VPNIPAddress string `json:"vpn_ip_address"`
 		Notes       string `json:"notes"`
+		CMS         string `json:"cms"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -52,6 +92,11 @@ func (s *Service) HandleAddHost(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusBadRequest, "At least one IP address is required")
 		return
 	}
+	kind, ok := cms.Parse(req.CMS)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, "cms must be anthias or pisignage")
+		return
+	}
 
 	newHost := types.Host{
 		ID:           uuid.New().String(),
@@ -59,6 +104,7 @@ func (s *Service) HandleAddHost(w http.ResponseWriter, r *http.Request) {
 		IPAddress:    req.IPAddress,
 		VPNIPAddress: req.VPNIPAddress,
 		Notes:        req.Notes,
+		CMS:          kind,
 		Status:       types.StatusUnreachable,
 		StatusVPN:    types.StatusUnreachable, // Default
 		CMSStatus:    types.CMSUnknown,
@@ -66,14 +112,14 @@ func (s *Service) HandleAddHost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Initial health check
-	hosts.CheckHealth(&newHost)
+	s.store.CheckHealth(&newHost)
 
 	if err := s.store.Add(newHost); err != nil {
 		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add host: %v", err))
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("Added new host: %s (%s)", req.Nickname, req.IPAddress))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("Added new host: %s (%s)", req.Nickname, req.IPAddress))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -119,14 +165,14 @@ func (s *Service) HandleUpdateHost(w http.ResponseWriter, r *http.Request) {
 	host.Notes = req.Notes
 
 	// Re-check health if IPs changed
-	hosts.CheckHealth(host)
+	s.store.CheckHealth(host)
 
 	if err := s.store.Upsert(*host); err != nil {
 		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update host: %v", err))
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("Updated host: %s", host.ID))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("Updated host: %s", host.ID))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -151,13 +197,13 @@ func (s *Service) HandleDeleteHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Deleted host: %s", ip))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Deleted host: %s", ip))
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // @Title: Set Primary Host
 // @Route: POST /api/hosts/set-primary?id=...
-// @Description: Set a host as primary and remove duplicates
+// @Description: Set a host as primary and remove the other hosts with its hostname; same as keeping it in its hostname conflict
 // @Response: 204 No Content
 func (s *Service) HandleSetPrimaryHost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -177,23 +223,173 @@ func (s *Service) HandleSetPrimaryHost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find duplicates by hostname
-	allHosts := s.store.GetAll()
-	count := 0
-	for _, h := range allHosts {
-		if h.Hostname == primary.Hostname && h.ID != primary.ID {
-			s.store.Delete(h.IPAddress)
-			count++
-		}
+	// Equivalent to keeping it in its hostname conflict; having none is fine.
+	err = s.store.ResolveConflict(string(hosts.ConflictHostname)+":"+primary.Hostname, hosts.ActionKeep, primary.ID)
+	if err != nil && !errors.Is(err, hosts.ErrConflictNotFound) {
+		s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to remove duplicates: %v", err))
+		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Set %s as primary for %s, removed %d duplicates", primary.IPAddress, primary.Hostname, count))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Set %s as primary for %s", primary.IPAddress, primary.Hostname))
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// @Title: Host Path
+// @Route: GET|POST /api/hosts/path?id=...&path=...
+// @Description: Show the LAN or VPN path used to reach a host, or (POST) pin it to one network
+// @Response: {"preference": "auto", "path": {"network": "vpn", "address": "100.64.0.2", "status": "healthy", "forced": false}}
+func (s *Service) HandleHostPath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	host, err := s.store.GetByID(id)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		pref := types.PathPreference(strings.ToLower(strings.TrimSpace(r.URL.Query().Get("path"))))
+		if pref == "auto" {
+			pref = types.PathAuto
+		}
+		if !hosts.ValidPathPreference(pref) {
+			s.writeError(w, http.StatusBadRequest, "path must be auto, lan or vpn")
+			return
+		}
+		if pref == types.PathVPN && host.VPNIPAddress == "" {
+			s.writeError(w, http.StatusBadRequest, "Host has no VPN IP address")
+			return
+		}
+		if err := s.store.Update(host.IPAddress, func(h *types.Host) { h.PathPreference = pref }); err != nil {
+			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update host: %v", err))
+			return
+		}
+		host.PathPreference = pref
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Path for %s set to %s", host.IPAddress, displayPreference(pref)))
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"preference": displayPreference(host.PathPreference),
+		"path":       hosts.SelectPath(*host),
+	})
+}
+
+func displayPreference(p types.PathPreference) string {
+	if p == types.PathAuto {
+		return "auto"
+	}
+	return string(p)
+}
+
+// @Title: Host Timezone
+// @Route: GET|POST /api/hosts/timezone?id=...&tz=...
+// @Description: Show a host's timezone and local time, or (POST) set it to an IANA name; an empty tz uses this node's timezone
+// @Response: {"timezone": "America/New_York", "local_time": "2026-03-01T09:05:00-05:00", "offset": "-05:00"}
+func (s *Service) HandleHostTimezone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	host, err := s.store.GetByID(id)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		tz := strings.TrimSpace(r.URL.Query().Get("tz"))
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				s.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unknown timezone %q", tz))
+				return
+			}
+		}
+		if err := s.store.Update(host.IPAddress, func(h *types.Host) { h.Timezone = tz }); err != nil {
+			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update host: %v", err))
+			return
+		}
+		host.Timezone = tz
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Timezone for %s set to %s", host.IPAddress, host.Location()))
+	}
+
+	now := host.InZone(time.Now())
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"timezone":   host.Timezone,
+		"local_time": now.Format(time.RFC3339),
+		"offset":     now.Format("-07:00"),
+	})
+}
+
+// @Title: Host CMS
+// @Route: GET|POST /api/hosts/cms?id=...&cms=...
+// @Description: Show which CMS the player of a host runs, or (POST) set it: anthias (the default, also for Screenly OSE) or pisignage. Health checks, asset counts and drift then read that CMS
+// @Response: {"cms": "pisignage", "name": "piSignage", "dashboard_url": "http://192.168.1.50:8000"}
+func (s *Service) HandleHostCMS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+		return
+	}
+
+	host, err := s.store.GetByID(id)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		kind, ok := cms.Parse(r.URL.Query().Get("cms"))
+		if !ok {
+			s.writeError(w, http.StatusBadRequest, "cms must be anthias or pisignage")
+			return
+		}
+		if err := s.store.Update(host.IPAddress, func(h *types.Host) { h.CMS = kind }); err != nil {
+			s.writeError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update host: %v", err))
+			return
+		}
+		host.CMS = kind
+		auth.AnnotateAudit(r, host.ID, "cms "+kind.Name())
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: CMS for %s set to %s", host.IPAddress, kind.Name()))
+	}
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"cms":           displayCMS(host.CMS),
+		"name":          host.CMS.Name(),
+		"dashboard_url": cms.DashboardURL(host.CMS, hosts.SelectPath(*host).Address),
+	})
+}
+
+func displayCMS(k types.CMSKind) string {
+	if k == types.CMSAnthias {
+		return "anthias"
+	}
+	return string(k)
+}
+
 // @Title: Check All Hosts
-// @Route: POST /api/hosts/check
-// @Description: Trigger health check on all hosts
+// @Route: POST /api/hosts/check?view=...
+// @Description: Trigger health check on all hosts, or with view, on the hosts in that saved view
 // @Response: 204 No Content
 func (s *Service) HandleCheckHosts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -201,10 +397,25 @@ func (s *Service) HandleCheckHosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if name := r.URL.Query().Get("view"); name != "" {
+		ids, status, err := s.viewTargets(r, name)
+		if err != nil {
+			s.writeError(w, status, err.Error())
+			return
+		}
+		go func() {
+			s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Starting manual health check of %d hosts in view %q...", len(ids), name))
+			s.store.CheckHosts(ids)
+			s.logger.InfoContext(r.Context(), "Manual health check complete")
+		}()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	go func() {
-		s.logger.Info("API: Starting manual health check of all hosts...")
+		s.logger.InfoContext(r.Context(), "API: Starting manual health check of all hosts...")
 		s.store.CheckAllHosts()
-		s.logger.Info("Manual health check complete")
+		s.logger.InfoContext(r.Context(), "Manual health check complete")
 	}()
 
 	w.WriteHeader(http.StatusNoContent)
@@ -233,13 +444,266 @@ func (s *Service) HandleCheckHost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	go func(h types.Host) {
-		s.logger.Info(fmt.Sprintf("API: Checking health for %s...", h.IPAddress))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Checking health for %s...", h.IPAddress))
 		updated := h
-		hosts.CheckHealth(&updated)
+		s.store.CheckHealth(&updated)
 		if err := s.store.Upsert(updated); err != nil {
-			s.logger.Error(fmt.Sprintf("Error updating health for %s: %v", h.IPAddress, err))
+			s.logger.ErrorContext(r.Context(), fmt.Sprintf("Error updating health for %s: %v", h.IPAddress, err))
 		}
 	}(*host)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// @Title: Network Quality
+// @Route: GET /api/hosts/quality?id=...&network=...
+// @Description: Latency and packet loss from this node to each host, measured during health checks; with id, that host's samples (oldest first) as well, optionally for one network (lan|vpn)
+// @Response: {"host_id": "...", "summary": {"lan": {"samples": 42, "avg_latency_ms": 3.1, "max_latency_ms": 48.2, "avg_loss_percent": 0.5}}, "samples": [{"at": "...", "network": "lan", "latency_ms": 2.8, "loss_percent": 0}]}
+func (s *Service) HandleHostQuality(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summaries := func(id string) map[hosts.Network]hosts.QualitySummary {
+		out := make(map[hosts.Network]hosts.QualitySummary)
+		for _, n := range []hosts.Network{hosts.NetworkLAN, hosts.NetworkVPN} {
+			if samples := s.store.QualityHistory(id, n); len(samples) > 0 {
+				out[n] = hosts.Summarize(samples)
+			}
+		}
+		return out
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		type hostQuality struct {
+			HostID    string                                 `json:"host_id"`
+			IPAddress string                                 `json:"ip_address"`
+			Summary   map[hosts.Network]hosts.QualitySummary `json:"summary"`
+		}
+		out := []hostQuality{}
+		for _, h := range s.store.GetAll() {
+			out = append(out, hostQuality{HostID: h.ID, IPAddress: h.IPAddress, Summary: summaries(h.ID)})
+		}
+		s.writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	if _, err := s.store.GetByID(id); err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	network := hosts.Network(strings.ToLower(r.URL.Query().Get("network")))
+	if network != "" && network != hosts.NetworkLAN && network != hosts.NetworkVPN {
+		s.writeError(w, http.StatusBadRequest, "network must be lan or vpn")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"host_id": id,
+		"summary": summaries(id),
+		"samples": s.store.QualityHistory(id, network),
+	})
+}
+
+// @Title: SD Card Health
+// @Route: GET /api/hosts/card-health?id=...
+// @Description: Wear and filesystem errors of the SD card or eMMC each host boots from, as reported in heartbeats, with the problems an alert would name; with id, that host's samples (oldest first) as well
+// @Response: {"host_id": "...", "latest": {"at": "...", "life_used": 30, "pre_eol": "normal", "fs_errors": 0}, "problems": [], "samples": [{"at": "...", "life_used": 20, "pre_eol": "normal", "fs_errors": 0}]}
+func (s *Service) HandleHostCardHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type hostCard struct {
+		HostID    string             `json:"host_id"`
+		IPAddress string             `json:"ip_address,omitempty"`
+		Latest    *hosts.CardHealth  `json:"latest"`
+		Problems  []string           `json:"problems"`
+		Samples   []hosts.CardHealth `json:"samples,omitempty"`
+	}
+	entry := func(h types.Host, card hosts.CardHealth, ok bool) hostCard {
+		out := hostCard{HostID: h.ID, IPAddress: h.IPAddress, Problems: []string{}}
+		if ok {
+			out.Latest = &card
+			if p := card.Problems(alerts.DefaultCardThreshold); p != nil {
+				out.Problems = p
+			}
+		}
+		return out
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		latest, err := s.store.LatestCardHealth()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		out := []hostCard{}
+		for _, h := range s.store.GetAll() {
+			card, ok := latest[h.ID]
+			out = append(out, entry(h, card, ok))
+		}
+		s.writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	host, err := s.store.GetByID(id)
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	samples, err := s.store.CardHealthHistory(id)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var last hosts.CardHealth
+	if len(samples) > 0 {
+		last = samples[len(samples)-1]
+	}
+	out := entry(*host, last, len(samples) > 0)
+	out.Samples = samples
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// @Title: Wi-Fi Signal
+// @Route: GET /api/hosts/wifi?id=...&hours=24
+// @Description: Wi-Fi link of each wireless host over the last hours (1-168, default 24), from heartbeats: the latest reading with its network, access point and channel, the average and weakest signal, and reconnects and roams in the period. summary is null for hosts on Ethernet; with id, only that host and its samples, oldest first
+// @Response: [{"host_id": "...", "ip_address": "...", "summary": {"latest": {"at": "...", "interface": "wlan0", "ssid": "Lobby", "bssid": "...", "freq_mhz": 2437, "channel": 6, "signal_dbm": -71, "reconnects": 4, "roams": 0}, "samples": 288, "avg_signal_dbm": -69, "min_signal_dbm": -80, "reconnects": 2, "roams": 0}}]
+func (s *Service) HandleHostWiFi(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hours := 24
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 168 {
+			s.writeError(w, http.StatusBadRequest, "hours must be between 1 and 168")
+			return
+		}
+		hours = n
+	}
+	hostList := s.store.GetAll()
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		host, err := s.store.GetByID(id)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, "Host not found")
+			return
+		}
+		hostList = []types.Host{*host}
+	}
+
+	history, err := s.store.WiFiHistory(time.Now().UTC().Add(-time.Duration(hours) * time.Hour))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type hostWiFi struct {
+		HostID    string             `json:"host_id"`
+		IPAddress string             `json:"ip_address"`
+		Summary   *hosts.WiFiSummary `json:"summary"`
+		Samples   []hosts.WiFi       `json:"samples,omitempty"`
+	}
+	out := []hostWiFi{}
+	for _, h := range hostList {
+		entry := hostWiFi{HostID: h.ID, IPAddress: h.IPAddress}
+		if samples, ok := history[h.ID]; ok {
+			sum := hosts.SummarizeWiFi(samples)
+			entry.Summary = &sum
+			if id != "" {
+				entry.Samples = samples
+			}
+		}
+		out = append(out, entry)
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// @Title: Reboot History
+// @Route: GET /api/hosts/reboots?id=...&days=30
+// @Description: OS boots of each host over the last days (1-365, default 30), from heartbeats, and how the boot before each ended (clean or unexpected, e.g. power loss). Hosts are listed with the most unexpected reboots first; with id, only that host
+// @Response: {"since": "...", "hosts": [{"host_id": "...", "ip_address": "...", "boots": 3, "unexpected": 2, "under_voltage": 1, "last_unexpected": "..."}], "events": [{"node_id": "...", "boot_id": "...", "booted_at": "...", "shutdown": "unexpected", "evidence": "journal", "last_seen": "...", "downtime_seconds": 95, "recorded_at": "..."}]}
+func (s *Service) HandleHostReboots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			s.writeError(w, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+	hostList := s.store.GetAll()
+	id := r.URL.Query().Get("id")
+	if id != "" {
+		host, err := s.store.GetByID(id)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, "Host not found")
+			return
+		}
+		hostList = []types.Host{*host}
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	reboots, err := s.store.ListReboots(id, since)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	type hostReboots struct {
+		HostID         string    `json:"host_id"`
+		IPAddress      string    `json:"ip_address"`
+		Boots          int       `json:"boots"`
+		Unexpected     int       `json:"unexpected"`
+		UnderVoltage   int       `json:"under_voltage"` // Boots after which the previous one had logged under-voltage
+		LastUnexpected time.Time `json:"last_unexpected,omitzero"`
+	}
+	type event struct {
+		hosts.RebootEvent
+		DowntimeSeconds int64 `json:"downtime_seconds,omitempty"`
+	}
+	byID := make(map[string]*hostReboots)
+	summary := make([]hostReboots, len(hostList))
+	for i, h := range hostList {
+		summary[i] = hostReboots{HostID: h.ID, IPAddress: h.IPAddress}
+		byID[h.ID] = &summary[i]
+	}
+	events := []event{}
+	for _, e := range reboots {
+		events = append(events, event{RebootEvent: e, DowntimeSeconds: int64(e.Downtime().Seconds())})
+		sum, ok := byID[e.NodeID]
+		if !ok {
+			continue
+		}
+		sum.Boots++
+		if e.UnderVoltage {
+			sum.UnderVoltage++
+		}
+		if e.Shutdown == hosts.ShutdownUnexpected {
+			sum.Unexpected++
+			if e.RecordedAt.After(sum.LastUnexpected) {
+				sum.LastUnexpected = e.RecordedAt
+			}
+		}
+	}
+	sort.SliceStable(summary, func(i, j int) bool { return summary[i].Unexpected > summary[j].Unexpected })
+
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"since":  since,
+		"hosts":  summary,
+		"events": events,
+	})
+}
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"nexsign.mini/nsm/internal/hosts"
 	"nexsign.mini/nsm/internal/types"
 )
 
@@ -90,3 +92,354 @@ func TestHandleAddHost_InvalidInput(t *testing.T) {
 		t.Errorf("Expected status BadRequest, got %v", resp.Status)
 	}
 }
+
+func TestHandleHosts_ConditionalGet(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "1", IPAddress: "192.168.1.1", Nickname: "Host 1"})
+
+	w := httptest.NewRecorder()
+	svc.HandleHosts(w, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+
+	etag := w.Result().Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("Expected ETag header on host list")
+	}
+	if w.Result().Header.Get("Last-Modified") != "" {
+		t.Errorf("Expected no Last-Modified header, as health changes without writes")
+	}
+
+	// If-Modified-Since alone is not trusted to mean unchanged.
+	req := httptest.NewRequest(http.MethodGet, "/api/hosts", nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	svc.HandleHosts(w, req)
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 without an ETag, got %v", w.Result().Status)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/hosts", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	svc.HandleHosts(w, req)
+
+	if w.Result().StatusCode != http.StatusNotModified {
+		t.Fatalf("Expected 304 for matching ETag, got %v", w.Result().Status)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body on 304, got %d bytes", w.Body.Len())
+	}
+
+	// Changing the list must invalidate the ETag.
+	store.Add(types.Host{ID: "2", IPAddress: "192.168.1.2", Nickname: "Host 2"})
+
+	req = httptest.NewRequest(http.MethodGet, "/api/hosts", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	svc.HandleHosts(w, req)
+
+	if w.Result().StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 after host list changed, got %v", w.Result().Status)
+	}
+	if w.Result().Header.Get("ETag") == etag {
+		t.Errorf("Expected a new ETag after host list changed")
+	}
+}
+
+func TestHandleHostPath(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "1", IPAddress: "192.168.1.1", VPNIPAddress: "100.64.0.1", Status: types.StatusUnreachable, StatusVPN: types.StatusHealthy})
+	store.Add(types.Host{ID: "2", IPAddress: "192.168.1.2"})
+
+	get := func(method, query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostPath(w, httptest.NewRequest(method, "/api/hosts/path?"+query, nil))
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := get(http.MethodGet, "id=1")
+	if code != http.StatusOK || body["preference"] != "auto" || body["path"].(map[string]any)["network"] != "vpn" {
+		t.Fatalf("expected automatic VPN path, got %d %v", code, body)
+	}
+
+	code, body = get(http.MethodPost, "id=1&path=lan")
+	if code != http.StatusOK || body["path"].(map[string]any)["address"] != "192.168.1.1" {
+		t.Fatalf("expected LAN override, got %d %v", code, body)
+	}
+	if h, _ := store.GetByID("1"); h.PathPreference != types.PathLAN {
+		t.Errorf("expected preference to be stored, got %q", h.PathPreference)
+	}
+
+	if code, _ := get(http.MethodPost, "id=2&path=vpn"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 forcing VPN without a VPN IP, got %d", code)
+	}
+	if code, _ := get(http.MethodPost, "id=1&path=wifi"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown path, got %d", code)
+	}
+}
+
+func TestHandleHostTimezone(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	checked := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	store.Add(types.Host{ID: "1", IPAddress: "192.168.1.1", LastChecked: checked})
+
+	get := func(method, query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostTimezone(w, httptest.NewRequest(method, "/api/hosts/timezone?"+query, nil))
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := get(http.MethodPost, "id=1&tz=America/New_York")
+	if code != http.StatusOK || body["timezone"] != "America/New_York" {
+		t.Fatalf("expected timezone to be set, got %d %v", code, body)
+	}
+	if off := body["offset"]; off != "-05:00" && off != "-04:00" {
+		t.Errorf("expected a New York offset, got %v", off)
+	}
+
+	// Host timestamps come back on the site's clock.
+	h, _ := store.GetByID("1")
+	if h.Timezone != "America/New_York" || !h.LastChecked.Equal(checked) || h.LastChecked.Hour() != 9 {
+		t.Errorf("expected last check at 09:00 New York time, got %v", h.LastChecked)
+	}
+
+	if code, _ := get(http.MethodPost, "id=1&tz=Moon/Base"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown timezone, got %d", code)
+	}
+	if code, _ := get(http.MethodGet, "id=missing"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown host, got %d", code)
+	}
+}
+
+func TestHandleHostCMS(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	// A piSignage player with its default login.
+	player := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/playlists" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"success": true, "data": [{"name": "default", "assets": [{"filename": "welcome.jpg", "duration": 10}]}]}`))
+	}))
+	defer player.Close()
+	store.Add(types.Host{ID: "1", IPAddress: player.Listener.Addr().String()})
+
+	get := func(method, query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostCMS(w, httptest.NewRequest(method, "/api/hosts/cms?"+query, nil))
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	if code, body := get(http.MethodGet, "id=1"); code != http.StatusOK || body["cms"] != "anthias" {
+		t.Fatalf("expected Anthias by default, got %d %v", code, body)
+	}
+	if code, body := get(http.MethodPost, "id=1&cms=pisignage"); code != http.StatusOK || body["name"] != "piSignage" {
+		t.Fatalf("expected piSignage to be set, got %d %v", code, body)
+	}
+	if code, _ := get(http.MethodPost, "id=1&cms=xibo"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown CMS, got %d", code)
+	}
+
+	// Playlist reads go to the player; changes are refused.
+	w := httptest.NewRecorder()
+	svc.HandleValidatePlaylist(w, httptest.NewRequest(http.MethodGet, "/api/playlists/validate?id=1", nil))
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("welcome.jpg")) {
+		t.Errorf("expected the piSignage playlist, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	svc.HandleReapplyAssets(w, httptest.NewRequest(http.MethodPost, "/api/hosts/assets/reapply?id=1", nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 re-applying to a piSignage host, got %d", w.Code)
+	}
+}
+
+func TestHandleHostQuality(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "q1", IPAddress: "127.0.0.1"})
+	h, _ := store.GetByID("q1")
+	store.CheckHealth(h)
+
+	get := func(query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostQuality(w, httptest.NewRequest(http.MethodGet, "/api/hosts/quality?"+query, nil))
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := get("id=q1")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	samples, _ := body["samples"].([]any)
+	summary, _ := body["summary"].(map[string]any)
+	if len(samples) != 1 || summary["lan"] == nil {
+		t.Errorf("expected one LAN sample from the health check, got %v", body)
+	}
+
+	if code, body := get("id=q1&network=vpn"); code != http.StatusOK || len(body["samples"].([]any)) != 0 {
+		t.Errorf("expected no VPN samples, got %d %v", code, body)
+	}
+	if code, _ := get("id=q1&network=wifi"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown network, got %d", code)
+	}
+	if code, _ := get("id=missing"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown host, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleHostQuality(w, httptest.NewRequest(http.MethodGet, "/api/hosts/quality", nil))
+	var all []map[string]any
+	json.NewDecoder(w.Body).Decode(&all)
+	if len(all) != 1 || all[0]["host_id"] != "q1" {
+		t.Errorf("expected a summary for every host, got %v", all)
+	}
+}
+
+func TestHandleHostCardHealth(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "c1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "c2", IPAddress: "192.168.1.21"})
+	now := time.Now().UTC()
+	store.RecordCardHealth("c1", hosts.CardHealth{LifeUsed: 50}, now.Add(-48*time.Hour))
+	store.RecordCardHealth("c1", hosts.CardHealth{LifeUsed: 90, FSErrors: 2}, now)
+
+	w := httptest.NewRecorder()
+	svc.HandleHostCardHealth(w, httptest.NewRequest(http.MethodGet, "/api/hosts/card-health?id=c1", nil))
+	var one struct {
+		Latest   *hosts.CardHealth  `json:"latest"`
+		Problems []string           `json:"problems"`
+		Samples  []hosts.CardHealth `json:"samples"`
+	}
+	json.NewDecoder(w.Body).Decode(&one)
+	if w.Code != http.StatusOK || len(one.Samples) != 2 || one.Latest == nil || one.Latest.LifeUsed != 90 || len(one.Problems) != 2 {
+		t.Errorf("unexpected response %d: %+v", w.Code, one)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleHostCardHealth(w, httptest.NewRequest(http.MethodGet, "/api/hosts/card-health", nil))
+	var all []map[string]any
+	json.NewDecoder(w.Body).Decode(&all)
+	if len(all) != 2 {
+		t.Fatalf("expected an entry for every host, got %v", all)
+	}
+	for _, h := range all {
+		if h["host_id"] == "c2" && h["latest"] != nil {
+			t.Errorf("expected no card data for c2, got %v", h)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleHostCardHealth(w, httptest.NewRequest(http.MethodGet, "/api/hosts/card-health?id=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown host, got %d", w.Code)
+	}
+}
+
+func TestHandleHostReboots(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "r1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "r2", IPAddress: "192.168.1.21"})
+	now := time.Now().UTC()
+	store.RecordBoot("r1", hosts.BootReport{BootID: "a", Shutdown: hosts.ShutdownClean}, time.Time{}, now.Add(-48*time.Hour))
+	store.RecordBoot("r2", hosts.BootReport{BootID: "b", BootedAt: now.Add(-2 * time.Hour), Shutdown: hosts.ShutdownUnexpected, UnderVoltage: true}, now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+	store.RecordBoot("r2", hosts.BootReport{BootID: "c", Shutdown: hosts.ShutdownUnexpected}, time.Time{}, now.Add(-40*24*time.Hour))
+
+	get := func(query string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostReboots(w, httptest.NewRequest(http.MethodGet, "/api/hosts/reboots?"+query, nil))
+		var body map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := get("")
+	list, _ := body["hosts"].([]any)
+	events, _ := body["events"].([]any)
+	if code != http.StatusOK || len(list) != 2 || len(events) != 2 {
+		t.Fatalf("expected both hosts and the last 30 days of boots, got %d %v", code, body)
+	}
+	first := list[0].(map[string]any)
+	if first["host_id"] != "r2" || first["unexpected"] != 1.0 || first["under_voltage"] != 1.0 {
+		t.Errorf("expected r2 first with one unexpected reboot, got %v", first)
+	}
+	if events[0].(map[string]any)["downtime_seconds"] != 3600.0 {
+		t.Errorf("expected an hour of downtime, got %v", events[0])
+	}
+
+	if _, body := get("id=r2&days=60"); len(body["events"].([]any)) != 2 {
+		t.Errorf("expected both of r2's boots over 60 days, got %v", body)
+	}
+	if code, _ := get("days=0"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for days=0, got %d", code)
+	}
+	if code, _ := get("id=missing"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown host, got %d", code)
+	}
+}
+
+func TestHandleHostWiFi(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "w1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "e1", IPAddress: "192.168.1.21"})
+	now := time.Now().UTC()
+	link := hosts.WiFi{Interface: "wlan0", SSID: "Lobby", BSSID: "aa:bb:cc:dd:ee:ff", FreqMHz: 2437, SignalDBM: -72}
+	store.RecordWiFi("w1", link, now.Add(-30*time.Hour))
+	store.RecordWiFi("w1", link, now.Add(-2*time.Hour))
+	link.SignalDBM, link.Reconnects = -80, 1
+	store.RecordWiFi("w1", link, now.Add(-time.Hour))
+
+	get := func(query string) (int, []map[string]any) {
+		w := httptest.NewRecorder()
+		svc.HandleHostWiFi(w, httptest.NewRequest(http.MethodGet, "/api/hosts/wifi?"+query, nil))
+		var body []map[string]any
+		json.NewDecoder(w.Body).Decode(&body)
+		return w.Code, body
+	}
+
+	code, body := get("")
+	if code != http.StatusOK || len(body) != 2 {
+		t.Fatalf("expected both hosts, got %d %v", code, body)
+	}
+	for _, h := range body {
+		sum, _ := h["summary"].(map[string]any)
+		switch h["host_id"] {
+		case "w1":
+			if sum["samples"] != 2.0 || sum["avg_signal_dbm"] != -76.0 || sum["reconnects"] != 1.0 {
+				t.Errorf("expected the last day of w1 summarized, got %v", sum)
+			}
+		case "e1":
+			if sum != nil {
+				t.Errorf("expected no summary for a wired host, got %v", sum)
+			}
+		}
+	}
+
+	if _, body := get("id=w1&hours=48"); len(body) != 1 || len(body[0]["samples"].([]any)) != 3 {
+		t.Errorf("expected w1's three samples over 48 hours, got %v", body)
+	}
+	if code, _ := get("hours=200"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for hours=200, got %d", code)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: Incidents
+// @Route: GET /api/incidents?host_id=...&status=open&days=30&limit=100
+// @Description: Incidents opened over the last days (1-365, default 30), newest first. An incident opens when a host goes offline or an alert fires for it, and resolves once the host is back and its alerts have resolved. status filters to open or resolved ones; host_id to one host. duration_seconds runs until now while open. The timelines are in /api/incidents/{id}
+// @Response: {"incidents": [{"id": "...", "host_id": "...", "title": "Lobby went offline", "status": "resolved", "opened_at": "...", "resolved_at": "...", "duration_seconds": 420}]}
+func (s *Service) HandleIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	days := 30
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 365 {
+			s.writeError(w, http.StatusBadRequest, "days must be between 1 and 365")
+			return
+		}
+		days = n
+	}
+	status := q.Get("status")
+	if status != "" && status != hosts.IncidentOpen && status != hosts.IncidentResolved {
+		s.writeError(w, http.StatusBadRequest, "status must be open or resolved")
+		return
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	now := time.Now().UTC()
+	list, err := s.store.ListIncidents(hosts.IncidentQuery{
+		HostID: q.Get("host_id"),
+		Status: status,
+		Since:  now.AddDate(0, 0, -days),
+		Limit:  min(limit, 1000),
+	}, now)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{"incidents": list})
+}
+
+// @Title: Incident Timeline
+// @Route: GET /api/incidents/{id}
+// @Description: An incident with its timeline, oldest first: the host going offline (offline) and coming back (online), alerts firing and resolving (alert_fired, alert_resolved), the end of the incident (closed), and from two minutes before it opened until it closed, audit entries about the host such as an operator's reboot (audit, with actor) and the host's boots (reboot)
+// @Response: {"id": "...", "host_id": "...", "title": "Lobby went offline", "status": "resolved", "opened_at": "...", "resolved_at": "...", "duration_seconds": 420, "timeline": [{"at": "...", "kind": "offline", "detail": "No heartbeat or failing health checks"}, {"at": "...", "kind": "alert_fired", "detail": "Lobby offline: Offline since ..."}, {"at": "...", "kind": "audit", "detail": "POST /api/hosts/reboot: reboot; status 204", "actor": "alice"}, {"at": "...", "kind": "reboot", "detail": "Booted after a clean shutdown"}, {"at": "...", "kind": "online", "detail": "Back; health is online"}, {"at": "...", "kind": "alert_resolved", "detail": "..."}, {"at": "...", "kind": "closed"}]}
+func (s *Service) HandleIncident(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/incidents/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	inc, err := s.store.GetIncident(id, time.Now().UTC())
+	if errors.Is(err, hosts.ErrIncidentNotFound) {
+		s.writeError(w, http.StatusNotFound, "Incident not found")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, inc)
+}
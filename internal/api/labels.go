@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/label"
+)
+
+// @Title: Host Label
+// @Route: GET /api/hosts/{id}/label?format=png|pdf
+// @Description: Printable 4 x 3 inch label for the back of a screen, with QR codes that open the host NSM dashboard and its Anthias dashboard
+// @Response: PNG image (the default) or PDF file
+func (s *Service) HandleHostLabel(w http.ResponseWriter, r *http.Request) {
+	host, err := s.store.GetByID(r.PathValue("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "png"
+	}
+	if format != "png" && format != "pdf" {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q (use png or pdf)", format))
+		return
+	}
+
+	title := host.Nickname
+	if title == "" {
+		title = host.Hostname
+	}
+	if title == "" {
+		title = host.IPAddress
+	}
+	nsmURL := host.DashboardURL
+	if nsmURL == "" {
+		nsmURL = fmt.Sprintf("http://%s:8080", host.IPAddress)
+	}
+	l, err := label.New(title, host.IPAddress,
+		label.Link{Caption: "NSM", URL: nsmURL},
+		label.Link{Caption: "Anthias", URL: fmt.Sprintf("http://%s/", host.IPAddress)})
+	if err != nil {
+		s.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	var (
+		data        []byte
+		contentType string
+	)
+	switch format {
+	case "png":
+		data, err = l.PNG()
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "Failed to render label")
+			return
+		}
+		contentType = "image/png"
+	case "pdf":
+		data = l.PDF()
+		contentType = "application/pdf"
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Label for host %s (%s)", title, format))
+	filename := fmt.Sprintf("nsm-label-%s.%s", host.IPAddress, format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", filename))
+	w.Write(data)
+}
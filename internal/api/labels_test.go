@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleHostLabel(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "192.168.1.20"})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/hosts/{id}/label", svc.HandleHostLabel)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get("/api/hosts/lobby/label")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %s", ct)
+	}
+	if _, err := png.Decode(bytes.NewReader(w.Body.Bytes())); err != nil {
+		t.Errorf("Expected a PNG body: %v", err)
+	}
+
+	w = get("/api/hosts/lobby/label?format=pdf")
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "application/pdf" {
+		t.Fatalf("Expected a PDF, got %d %s", w.Code, ct)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"(Lobby) Tj", "(http://192.168.1.20:8080) Tj", "(http://192.168.1.20/) Tj"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in the PDF", want)
+		}
+	}
+
+	if w := get("/api/hosts/lobby/label?format=svg"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+	if w := get("/api/hosts/nobody/label"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown host, got %d", w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"nexsign.mini/nsm/internal/media"
+)
+
+// maxMediaUpload bounds a single video upload.
+const maxMediaUpload = 4 << 30
+
+// @Title: Transcode Video
+// @Route: POST /api/media/transcode?profile=1080p|720p&name=...
+// @Description: Upload a video (multipart field "file", or the raw body with name) and queue it for conversion to Pi-friendly H.264
+// @Response: 202 {"id": "...", "name": "promo.mov", "profile": "1080p", "status": "queued", "progress": 0}
+func (s *Service) HandleMediaTranscode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.media == nil || !s.media.Available() {
+		s.writeError(w, http.StatusServiceUnavailable, media.ErrUnavailable.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaUpload)
+	name := r.URL.Query().Get("name")
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid multipart upload")
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				s.writeError(w, http.StatusBadRequest, "Missing 'file' field")
+				return
+			}
+			if part.FormName() == "file" {
+				if name == "" {
+					name = part.FileName()
+				}
+				body = part
+				break
+			}
+		}
+	}
+	if name == "" {
+		name = "upload"
+	}
+
+	job, err := s.media.Submit(name, r.URL.Query().Get("profile"), body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Queued %s for transcoding to %s", job.Name, job.Profile))
+	s.writeJSON(w, http.StatusAccepted, job)
+}
+
+// @Title: Transcode Jobs
+// @Route: GET /api/media/jobs
+// @Description: List transcode jobs with their progress, and whether ffmpeg is available on this node
+// @Response: {"available": true, "profiles": {...}, "jobs": [{"id": "...", "status": "running", "progress": 0.42, "url": "/media/<id>.mp4"}]}
+func (s *Service) HandleMediaJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobs := []mediaJob{}
+	if s.media != nil {
+		for _, j := range s.media.List() {
+			jobs = append(jobs, withMediaURL(j))
+		}
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"available": s.media != nil && s.media.Available(),
+		"profiles":  media.Profiles,
+		"jobs":      jobs,
+	})
+}
+
+// mediaJob is a job with the URL its output is served at once done.
+type mediaJob struct {
+	media.Job
+	URL string `json:"url,omitempty"`
+}
+
+func withMediaURL(j media.Job) mediaJob {
+	out := mediaJob{Job: j}
+	if j.Status == media.StatusDone {
+		out.URL = "/media/" + j.ID + ".mp4"
+	}
+	return out
+}
+
+// @Title: Transcode Job
+// @Route: GET /api/media/jobs/get?id=...
+// @Description: Get one transcode job
+// @Response: {"id": "...", "status": "done", "progress": 1, "url": "/media/<id>.mp4"}
+func (s *Service) HandleMediaJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.media == nil {
+		s.writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	job, err := s.media.Get(r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, withMediaURL(job))
+}
+
+// @Title: Delete Transcode Job
+// @Route: POST /api/media/jobs/delete?id=...
+// @Description: Delete a finished or failed job and its video
+// @Response: 204 No Content
+func (s *Service) HandleDeleteMediaJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.media == nil {
+		s.writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if err := s.media.Delete(id); err != nil {
+		if errors.Is(err, media.ErrJobNotFound) {
+			s.writeError(w, http.StatusNotFound, "Job not found")
+			return
+		}
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Deleted transcode job %s", id))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Transcoded Video
+// @Route: GET /media/<id>.mp4
+// @Description: Serve a finished transcode for use as an Anthias video asset; only hosts in the list may fetch it
+// @Response: video/mp4
+func (s *Service) HandleMediaFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.isFleetClient(r.RemoteAddr) {
+		s.writeError(w, http.StatusForbidden, "Only hosts in the host list may fetch media")
+		return
+	}
+	if s.media == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/media/"), ".mp4")
+	job, err := s.media.Get(id)
+	if err != nil || job.Status != media.StatusDone {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(s.media.OutputPath(job.ID))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "video/mp4")
+	http.ServeContent(w, r, "", job.FinishedAt, f)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: Host Metrics
+// @Route: GET /api/hosts/metrics?id=...&metric=up&hours=24
+// @Description: A host's metrics over the last hours (1-17520, default 24), sampled every minute and kept at coarser steps as they age: 1 minute for a day, 15 minutes for 14 days, an hour for 90 days and a day for two years. Each point is a bucket with the count, average, minimum and maximum of its samples. metric is up, latency_ms, loss_percent or disk_percent; without it, all are returned. uptime_percent is the average of up over the period
+// @Response: {"host_id": "...", "since": "...", "step_seconds": 60, "uptime_percent": 99.3, "metrics": {"up": [{"at": "...", "count": 1, "avg": 1, "min": 1, "max": 1}], "latency_ms": [...]}}
+func (s *Service) HandleHostMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if _, err := s.store.GetByID(id); err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	names := hosts.Metrics
+	if metric := r.URL.Query().Get("metric"); metric != "" {
+		if !hosts.ValidMetric(metric) {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown metric %q (use %s)", metric, strings.Join(hosts.Metrics, ", ")))
+			return
+		}
+		names = []string{metric}
+	}
+	hours := 24
+	if v := r.URL.Query().Get("hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > int(hosts.MetricRetention.Hours()) {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("hours must be between 1 and %d", int(hosts.MetricRetention.Hours())))
+			return
+		}
+		hours = n
+	}
+
+	now := time.Now().UTC()
+	since := now.Add(-time.Duration(hours) * time.Hour)
+	series := make(map[string][]hosts.MetricPoint, len(names))
+	for _, name := range names {
+		points, err := s.store.MetricSeries(id, name, since, now)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		series[name] = points
+	}
+	resp := map[string]any{
+		"host_id":      id,
+		"since":        since,
+		"step_seconds": int(hosts.MetricStep(since, now).Seconds()),
+		"metrics":      series,
+	}
+	if uptime, err := s.store.Uptime(since, now); err == nil {
+		if up, ok := uptime[id]; ok {
+			resp["uptime_percent"] = up
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleHostMetrics(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "kiosk", IPAddress: "192.168.1.20"})
+	now := time.Now()
+	store.RecordMetrics("kiosk", map[string]float64{hosts.MetricUp: 1}, now.Add(-2*time.Minute))
+	store.RecordMetrics("kiosk", map[string]float64{hosts.MetricUp: 0}, now.Add(-time.Minute))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleHostMetrics(w, httptest.NewRequest(http.MethodGet, "/api/hosts/metrics?"+query, nil))
+		return w
+	}
+	for query, code := range map[string]int{
+		"id=missing":             http.StatusNotFound,
+		"id=kiosk&metric=cpu":    http.StatusBadRequest,
+		"id=kiosk&hours=0":       http.StatusBadRequest,
+		"id=kiosk&hours=1000000": http.StatusBadRequest,
+	} {
+		if w := get(query); w.Code != code {
+			t.Errorf("%s: expected %d, got %d", query, code, w.Code)
+		}
+	}
+
+	w := get("id=kiosk&metric=up&hours=1")
+	var resp struct {
+		StepSeconds   int                            `json:"step_seconds"`
+		UptimePercent float64                        `json:"uptime_percent"`
+		Metrics       map[string][]hosts.MetricPoint `json:"metrics"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StepSeconds != 60 || len(resp.Metrics["up"]) != 2 || resp.UptimePercent != 50 {
+		t.Errorf("expected two one-minute points at 50%% uptime, got %+v", resp)
+	}
+}
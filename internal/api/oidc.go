@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// oidcStateCookie carries the state and nonce between the redirect to the
+// identity provider and the callback.
+const oidcStateCookie = "nsm_oidc"
+
+// @Title: SSO Settings
+// @Route: GET|POST /api/settings/oidc
+// @Description: Get or update the OpenID Connect single sign-on configuration (issuer, client, role mappings; client secret is masked on read)
+// @Response: {"enabled": true, "issuer": "...", "client_id": "...", "client_secret": "********", "role_claim": "groups", "role_mappings": {"nsm-admins": "admin"}, "default_role": "viewer"}
+func (s *Service) HandleOIDCSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := auth.LoadOIDC(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		cfg := auth.DefaultOIDCConfig()
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored secret when the client echoes back the mask.
+		if cfg.ClientSecret == "" || cfg.ClientSecret == cfg.Masked().ClientSecret {
+			current, err := auth.LoadOIDC(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.ClientSecret = current.ClientSecret
+		}
+
+		if err := s.auth.SaveOIDC(cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated SSO settings (enabled=%t, issuer %s)", cfg.Enabled, cfg.Issuer))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: SSO Login
+// @Route: GET /api/auth/oidc/login
+// @Description: Redirect the browser to the identity provider to sign in
+// @Response: 302 Found
+func (s *Service) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	authURL, state, nonce, err := s.auth.OIDCAuthURL(oidcCallbackURL(r))
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("API: SSO login failed: %v", err))
+		redirectLoginError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state + "." + nonce,
+		Path:     "/api/auth/oidc/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// @Title: SSO Callback
+// @Route: GET /api/auth/oidc/callback
+// @Description: Identity provider redirect target; verifies the ID token, maps claims to a role, and starts a session
+// @Response: 303 See Other (to the dashboard, or /login?error=... on failure)
+func (s *Service) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc/", MaxAge: -1})
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		redirectLoginError(w, r, fmt.Errorf("%s %s", e, q.Get("error_description")))
+		return
+	}
+
+	c, err := r.Cookie(oidcStateCookie)
+	state, nonce, ok := strings.Cut(valueOf(c, err), ".")
+	if !ok || state == "" || q.Get("state") != state {
+		redirectLoginError(w, r, fmt.Errorf("sign-in expired, please try again"))
+		return
+	}
+
+	token, u, err := s.auth.OIDCCallback(q.Get("code"), oidcCallbackURL(r), nonce)
+	if err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: SSO sign-in from %s rejected: %v", r.RemoteAddr, err))
+		s.auth.Audit(r, types.User{}, "auth.sso_login_failed", "", err.Error())
+		redirectLoginError(w, r, err)
+		return
+	}
+
+	s.auth.Audit(r, u, "auth.sso_login", u.Username, "")
+	setSessionCookie(w, r, token)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: User %q signed in via SSO", u.Username))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func oidcCallbackURL(r *http.Request) string {
+	return baseURL(r) + "/api/auth/oidc/callback"
+}
+
+func redirectLoginError(w http.ResponseWriter, r *http.Request, err error) {
+	http.Redirect(w, r, "/login?error="+url.QueryEscape(err.Error()), http.StatusSeeOther)
+}
+
+func valueOf(c *http.Cookie, err error) string {
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
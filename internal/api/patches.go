@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/patching"
+)
+
+// upgradeCommands run in order for an OS upgrade. No one is there to
+// answer dpkg's questions, so changed config files are kept.
+var upgradeCommands = [][]string{
+	{"apt-get", "update"},
+	{"apt-get", "-y", "-o", "Dpkg::Options::=--force-confdef", "-o", "Dpkg::Options::=--force-confold", "full-upgrade"},
+}
+
+// rebootCommand restarts the node, on request or after an upgrade that
+// needs it.
+var rebootCommand = []string{"systemctl", "reboot"}
+
+// rebootDelay gives the response to a reboot request time to reach the
+// caller before the node goes down.
+const rebootDelay = time.Second
+
+// upgradeTimeout bounds a whole upgrade. A run older than this that never
+// finished, such as one cut short by a power cut, no longer blocks the next.
+const upgradeTimeout = time.Hour
+
+// rebootRequiredFile is left by Debian packages whose update needs a reboot.
+var rebootRequiredFile = "/run/reboot-required"
+
+// runUpgradeCommand runs one upgrade command; tests replace it.
+var runUpgradeCommand = func(ctx context.Context, args []string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	return cmd.CombinedOutput()
+}
+
+// errUpgradeRunning is returned when an upgrade is requested while one is
+// running on this node.
+var errUpgradeRunning = errors.New("an upgrade is already running on this node")
+
+// upgradeMu serializes starting upgrades on this node.
+var upgradeMu sync.Mutex
+
+// @Title: Upgrade Host
+// @Route: POST /api/hosts/upgrade
+// @Description: Start an OS upgrade (apt-get update and full-upgrade) on a host, rebooting afterwards if reboot is set and an update needs it; body {"target_ip": "...", "reboot": false}, forwarded if not local. Progress shows in /api/patches
+// @Response: 202 {"state": "running", "started_at": "...", "reboot": false}
+func (s *Service) HandleUpgradeHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		TargetIP string `json:"target_ip"`
+		Reboot   bool   `json:"reboot"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	// Like reboot, the node being upgraded does the work. The forwarded
+	// request names no target, so the receiving node acts on itself.
+	if !isLocalTarget(req.TargetIP) {
+		url := fmt.Sprintf("http://%s:8080/api/hosts/upgrade", s.store.ResolveAddress(req.TargetIP))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("Forwarding upgrade request to %s", req.TargetIP))
+		body, _ := json.Marshal(map[string]bool{"reboot": req.Reboot})
+		resp, err := s.postForward(r.Context(), url, body, 15*time.Second)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to forward: %v", err))
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	run, err := s.startUpgrade(req.Reboot, time.Now().UTC())
+	if errors.Is(err, errUpgradeRunning) {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusAccepted, run)
+}
+
+// startUpgrade records a new upgrade run on this node and starts it in the
+// background. Heartbeats report the run, so every node sees it finish.
+func (s *Service) startUpgrade(reboot bool, now time.Time) (hosts.UpgradeRun, error) {
+	upgradeMu.Lock()
+	defer upgradeMu.Unlock()
+
+	var last hosts.UpgradeRun
+	if ok, err := s.store.GetSetting(heartbeat.UpgradeSettingKey, &last); err != nil {
+		return hosts.UpgradeRun{}, err
+	} else if ok && last.State == hosts.UpgradeRunning && now.Sub(last.StartedAt) < upgradeTimeout {
+		return hosts.UpgradeRun{}, errUpgradeRunning
+	}
+
+	run := hosts.UpgradeRun{State: hosts.UpgradeRunning, StartedAt: now, Reboot: reboot}
+	if err := s.store.PutSetting(heartbeat.UpgradeSettingKey, run); err != nil {
+		return hosts.UpgradeRun{}, err
+	}
+	s.logger.Info("API: Starting OS upgrade")
+	go s.runUpgrade(run)
+	return run, nil
+}
+
+// runUpgrade runs the upgrade commands and records the outcome, then
+// reboots if run asks for it and an update needs it.
+func (s *Service) runUpgrade(run hosts.UpgradeRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), upgradeTimeout)
+	defer cancel()
+
+	run.State = hosts.UpgradeSucceeded
+	for _, args := range upgradeCommands {
+		out, err := runUpgradeCommand(ctx, args)
+		if err != nil {
+			run.State = hosts.UpgradeFailed
+			run.Error = fmt.Sprintf("%s: %v", strings.Join(args, " "), err)
+			if tail := lastLine(string(out)); tail != "" {
+				run.Error += ": " + tail
+			}
+			break
+		}
+	}
+	run.FinishedAt = time.Now().UTC()
+
+	upgradeMu.Lock()
+	err := s.store.PutSetting(heartbeat.UpgradeSettingKey, run)
+	upgradeMu.Unlock()
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("API: Failed to record OS upgrade result: %v", err))
+	}
+	if run.State == hosts.UpgradeFailed {
+		s.logger.Error(fmt.Sprintf("API: OS upgrade failed: %s", run.Error))
+		return
+	}
+	s.logger.Info("API: OS upgrade finished")
+
+	if _, err := os.Stat(rebootRequiredFile); err != nil || !run.Reboot {
+		return
+	}
+	s.logger.Info("API: Rebooting to finish the OS upgrade")
+	if out, err := runUpgradeCommand(context.Background(), rebootCommand); err != nil {
+		s.logger.Error(fmt.Sprintf("API: Reboot after upgrade failed: %v: %s", err, lastLine(string(out))))
+	}
+}
+
+// lastLine returns the last non-empty line of command output, which for
+// apt is usually the error.
+func lastLine(out string) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// @Title: Patch Status
+// @Route: GET /api/patches
+// @Description: Pending OS updates (security updates counted separately), whether a reboot is required, and the last upgrade of every host, as reported in heartbeats. status is null for hosts that have not reported
+// @Response: [{"host_id": "...", "ip_address": "...", "status": {"pending": 12, "security": 3, "reboot_required": true, "checked_at": "...", "upgrade": {"state": "succeeded", "started_at": "...", "finished_at": "..."}}}]
+func (s *Service) HandlePatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := s.store.ListPatchStatus()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	type hostPatches struct {
+		HostID    string             `json:"host_id"`
+		IPAddress string             `json:"ip_address"`
+		Status    *hosts.PatchStatus `json:"status"`
+	}
+	out := []hostPatches{}
+	for _, h := range s.store.GetAll() {
+		entry := hostPatches{HostID: h.ID, IPAddress: h.IPAddress}
+		if p, ok := status[h.ID]; ok {
+			entry.Status = &p
+		}
+		out = append(out, entry)
+	}
+	s.writeJSON(w, http.StatusOK, out)
+}
+
+// @Title: Patch Rollout
+// @Route: GET|POST /api/patches/rollout
+// @Description: Show the current or last staged OS upgrade, or start one. POST takes hosts (IDs, in upgrade order) or view (a saved view), defaulting to every host, plus batch_size (hosts at once, default 1), window_from/window_to (hours on each host clock when upgrades may start) and reboot. The rollout halts at the first failed upgrade
+// @Response: {"batch_size": 2, "window_from": 2, "window_to": 5, "reboot": true, "state": "running", "created_at": "...", "steps": [{"host_id": "...", "state": "done", "started_at": "...", "finished_at": "..."}]}
+func (s *Service) HandlePatchRollout(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rollout, err := patching.Load(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, rollout)
+
+	case http.MethodPost:
+		var req struct {
+			patching.Rollout
+			Hosts []string `json:"hosts"`
+			View  string   `json:"view"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		ids := req.Hosts
+		if req.View != "" {
+			var status int
+			var err error
+			if ids, status, err = s.viewTargets(r, req.View); err != nil {
+				s.writeError(w, status, err.Error())
+				return
+			}
+		} else if len(ids) == 0 {
+			for _, h := range s.store.GetAll() {
+				ids = append(ids, h.ID)
+			}
+		}
+		if u, ok := auth.UserFromContext(r.Context()); ok {
+			req.CreatedBy = u.Username
+		}
+
+		rollout, err := patching.Start(s.store, req.Rollout, ids, time.Now())
+		if errors.Is(err, patching.ErrRolloutRunning) {
+			s.writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Started OS upgrade rollout of %d hosts, %d at a time", len(rollout.Steps), rollout.BatchSize))
+		s.writeJSON(w, http.StatusCreated, rollout)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Cancel Patch Rollout
+// @Route: POST /api/patches/rollout/cancel
+// @Description: Stop the running rollout; upgrades already started finish on their hosts
+// @Response: {"state": "cancelled", "steps": [...]}
+func (s *Service) HandleCancelPatchRollout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rollout, err := patching.Cancel(s.store, time.Now())
+	if err != nil {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), "API: Cancelled OS upgrade rollout")
+	s.writeJSON(w, http.StatusOK, rollout)
+}
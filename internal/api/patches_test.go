@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/patching"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleUpgradeHost(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	var mu sync.Mutex
+	var ran []string
+	release := make(chan struct{})
+	saved := runUpgradeCommand
+	defer func() { runUpgradeCommand = saved }()
+	runUpgradeCommand = func(ctx context.Context, args []string) ([]byte, error) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		ran = append(ran, strings.Join(args, " "))
+		if strings.HasSuffix(args[len(args)-1], "full-upgrade") {
+			return []byte("Reading package lists...\nE: Could not get lock /var/lib/dpkg/lock-frontend\n"), errors.New("exit status 100")
+		}
+		return nil, nil
+	}
+
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleUpgradeHost(w, httptest.NewRequest(http.MethodPost, "/api/hosts/upgrade", strings.NewReader(`{"reboot": true}`)))
+		return w
+	}
+
+	if w := post(); w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post(); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 while an upgrade runs, got %d", w.Code)
+	}
+	close(release)
+
+	var run hosts.UpgradeRun
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		store.GetSetting(heartbeat.UpgradeSettingKey, &run)
+		if run.State != hosts.UpgradeRunning {
+			break
+		}
+	}
+	if run.State != hosts.UpgradeFailed || !strings.Contains(run.Error, "Could not get lock") || !run.Reboot {
+		t.Errorf("expected the failed run recorded, got %+v", run)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ran) != 2 || ran[0] != "apt-get update" {
+		t.Errorf("expected update then upgrade and no reboot, got %v", ran)
+	}
+}
+
+func TestHandlePatches(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "p1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "p2", IPAddress: "192.168.1.21"})
+	store.PutPatchStatus("p1", hosts.PatchStatus{Pending: 5, Security: 1}, time.Now())
+
+	w := httptest.NewRecorder()
+	svc.HandlePatches(w, httptest.NewRequest(http.MethodGet, "/api/patches", nil))
+	var out []struct {
+		HostID string             `json:"host_id"`
+		Status *hosts.PatchStatus `json:"status"`
+	}
+	json.NewDecoder(w.Body).Decode(&out)
+	if w.Code != http.StatusOK || len(out) != 2 {
+		t.Fatalf("expected both hosts, got %d %+v", w.Code, out)
+	}
+	for _, h := range out {
+		if (h.HostID == "p1") != (h.Status != nil) {
+			t.Errorf("unexpected status for %s: %+v", h.HostID, h.Status)
+		}
+	}
+}
+
+func TestHandlePatchRollout(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "r1", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "r2", IPAddress: "192.168.1.21"})
+
+	do := func(method, path, body string) (int, patching.Rollout) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if path == "/api/patches/rollout/cancel" {
+			svc.HandleCancelPatchRollout(w, r)
+		} else {
+			svc.HandlePatchRollout(w, r)
+		}
+		var out patching.Rollout
+		json.NewDecoder(w.Body).Decode(&out)
+		return w.Code, out
+	}
+
+	code, r := do(http.MethodPost, "/api/patches/rollout", `{"batch_size": 2, "window_from": 2, "window_to": 5, "reboot": true}`)
+	if code != http.StatusCreated || len(r.Steps) != 2 || r.State != patching.RolloutRunning || !r.Reboot {
+		t.Fatalf("expected a rollout of every host, got %d %+v", code, r)
+	}
+	if code, _ := do(http.MethodPost, "/api/patches/rollout", `{"hosts": ["r1"]}`); code != http.StatusConflict {
+		t.Errorf("expected 409 while a rollout runs, got %d", code)
+	}
+	if code, r := do(http.MethodGet, "/api/patches/rollout", ""); code != http.StatusOK || r.WindowTo != 5 {
+		t.Errorf("expected the rollout back, got %d %+v", code, r)
+	}
+	if code, r := do(http.MethodPost, "/api/patches/rollout/cancel", ""); code != http.StatusOK || r.State != patching.RolloutCancelled {
+		t.Errorf("expected the rollout cancelled, got %d %+v", code, r)
+	}
+	if code, _ := do(http.MethodPost, "/api/patches/rollout", `{"hosts": ["missing"]}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown host, got %d", code)
+	}
+}
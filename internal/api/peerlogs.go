@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"nexsign.mini/nsm/internal/peerlog"
+)
+
+// maxLogBatchSize bounds the body of a forwarded log batch.
+const maxLogBatchSize = 256 << 10
+
+// @Title: Receive Peer Logs
+// @Route: POST /api/peers/logs/receive
+// @Description: Accept a signed batch of warnings and errors forwarded by a peer whose key a heartbeat pinned
+// @Response: 204 No Content
+func (s *Service) HandleReceivePeerLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxLogBatchSize))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read log batch")
+		return
+	}
+
+	batch, err := peerlog.Accept(s.store, data, time.Now().UTC())
+	switch {
+	case err == nil:
+		s.peerLogs.Add(batch)
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, peerlog.ErrBadSignature), errors.Is(err, peerlog.ErrUnknownSender):
+		s.writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, peerlog.ErrKeyMismatch):
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected log batch from %s: %v", r.RemoteAddr, err))
+		s.writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, peerlog.ErrClockSkew):
+		s.writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// @Title: Peer Logs
+// @Route: GET /api/peers/logs?node=...&request=...
+// @Description: Warnings and errors forwarded by peers, newest first. Lists the latest 100 from each peer since this node started, or from the node ID in node. With request, lists only the messages logged for that request ID, this node's own included
+// @Response: [{"node_id": "...", "hostname": "lobby", "timestamp": "...", "level": "warning", "text": "Heartbeat: 192.168.1.30 (192.168.1.30) not accepting heartbeats: status 409", "request_id": "..."}]
+func (s *Service) HandlePeerLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	entries := s.peerLogs.List(r.URL.Query().Get("node"))
+	if id := r.URL.Query().Get("request"); id != "" {
+		entries = s.requestLog(entries, id)
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+// requestLog keeps the entries logged for request id and adds this node's
+// own messages for it, of every level, newest first.
+func (s *Service) requestLog(entries []peerlog.Entry, id string) []peerlog.Entry {
+	out := []peerlog.Entry{}
+	for _, e := range entries {
+		if e.RequestID == id {
+			out = append(out, e)
+		}
+	}
+	var self peerlog.Entry
+	if local, err := s.anthias.GetMetadata(); err == nil {
+		self.NodeID, self.Hostname = local.ID, local.Hostname
+	}
+	for _, m := range s.logger.GetAll() {
+		if m.RequestID == id {
+			self.Message = m
+			out = append(out, self)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b peerlog.Entry) int { return b.Timestamp.Compare(a.Timestamp) })
+	return out
+}
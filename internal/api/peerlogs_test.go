@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerlog"
+	"nexsign.mini/nsm/internal/requestid"
+)
+
+func TestHandlePeerLogs(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(sender string) int {
+		body, err := peerlog.Seal(peerlog.Batch{SenderID: sender, Hostname: "lobby", SentAt: time.Now().UTC(),
+			Messages: []logger.Message{{Timestamp: time.Now(), Level: "error", Text: "Disk full", RequestID: "3f2a9c"}}}, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		svc.HandleReceivePeerLogs(w, httptest.NewRequest(http.MethodPost, peerlog.Path, bytes.NewReader(body)))
+		return w.Code
+	}
+
+	if code := send("node-a"); code != http.StatusUnauthorized {
+		t.Fatalf("expected a sender without a pinned key refused, got %d", code)
+	}
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey())})
+	if code := send("node-a"); code != http.StatusNoContent {
+		t.Fatalf("expected the batch accepted, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandlePeerLogs(w, httptest.NewRequest(http.MethodGet, "/api/peers/logs?node=node-a", nil))
+	var entries []peerlog.Entry
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 1 || entries[0].Text != "Disk full" || entries[0].Hostname != "lobby" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+
+	// A request is followed across this node and its peers.
+	ctx := requestid.With(context.Background(), "3f2a9c")
+	svc.logger.InfoContext(ctx, "API: Rebooting system...")
+	svc.logger.Info("API: Unrelated")
+	w = httptest.NewRecorder()
+	svc.HandlePeerLogs(w, httptest.NewRequest(http.MethodGet, "/api/peers/logs?request=3f2a9c", nil))
+	entries = nil
+	json.NewDecoder(w.Body).Decode(&entries)
+	if len(entries) != 2 || entries[0].Text != "API: Rebooting system..." || entries[1].NodeID != "node-a" {
+		t.Errorf("expected the local message and node-a's, newest first, got %+v", entries)
+	}
+
+	// Another node signing as node-a is refused.
+	other, _ := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	id = other
+	if code := send("node-a"); code != http.StatusConflict {
+		t.Errorf("expected a different key refused, got %d", code)
+	}
+}
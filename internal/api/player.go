@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/player"
+)
+
+// SetPlayer sets the built-in player whose state the player endpoints
+// report. Without it they report an idle player.
+func (s *Service) SetPlayer(p *player.Player) {
+	s.player = p
+}
+
+// playerStatus returns what the built-in player is doing.
+func (s *Service) playerStatus() hosts.Playback {
+	if s.player == nil {
+		return hosts.Playback{State: hosts.PlaybackIdle}
+	}
+	return s.player.Status()
+}
+
+// @Title: Player
+// @Route: GET|POST /api/player
+// @Description: Get or replace the settings of the built-in player of this node, for kiosks without Anthias: {"enabled": true, "assets": [...], "mirror": "host id", "browser": "...", "video": "...", "display": ":0", "duration": 10}. assets are played in order in the shape of an Anthias asset list; mirror plays the asset baseline of another host instead. The answer includes what the player is showing
+// @Response: {"config": {"enabled": true, "assets": [{"name": "Welcome", "uri": "https://example.com/welcome", "mimetype": "webpage", "duration": 15}], "browser": "chromium-browser --kiosk ...", "video": "mpv --fs ...", "duration": 10}, "status": {"state": "playing", "asset": "Welcome", "mimetype": "webpage", "index": 1, "count": 1, "started_at": "...", "until": "..."}}
+func (s *Service) HandlePlayer(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := player.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, map[string]any{"config": cfg, "status": s.playerStatus()})
+	case http.MethodPost:
+		var req player.Config
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		cfg, err := player.SaveConfig(s.store, req)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		state := "off"
+		if cfg.Enabled {
+			state = fmt.Sprintf("on, %d assets", len(cfg.Assets))
+			if cfg.Mirror != "" {
+				state = "on, mirroring " + cfg.Mirror
+			}
+		}
+		auth.AnnotateAudit(r, "player", state)
+		s.logger.InfoContext(r.Context(), "API: Player settings saved ("+state+")")
+		s.writeJSON(w, http.StatusOK, map[string]any{"config": cfg, "status": s.playerStatus()})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Player Now
+// @Route: GET /api/player/now
+// @Description: What the player page should show now, polled by the page itself. Needs no login, like widget pages
+// @Response: {"state": "playing", "asset": {"name": "Welcome", "uri": "https://example.com/welcome", "mimetype": "webpage", "duration": 15}, "until": "..."}
+func (s *Service) HandlePlayerNow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.player == nil {
+		s.writeJSON(w, http.StatusOK, player.Item{State: hosts.PlaybackIdle})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	s.writeJSON(w, http.StatusOK, s.player.Now())
+}
+
+// @Title: Player Page
+// @Route: GET /player
+// @Description: The full-screen page the kiosk browser of the built-in player shows. It shows web pages and images and stays black under the video player
+// @Response: HTML page
+func (s *Service) HandlePlayerPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	player.WritePage(w)
+}
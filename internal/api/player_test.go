@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlePlayer(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandlePlayer(w, httptest.NewRequest(http.MethodPost, "/api/player", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"enabled": true, "mirror": "missing"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown mirror host, got %d", w.Code)
+	}
+	w := post(`{"enabled": true, "assets": [{"name": "Welcome", "uri": "https://example.com/welcome", "mimetype": "webpage"}]}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"state":"idle"`) || !strings.Contains(w.Body.String(), "chromium-browser") {
+		t.Fatalf("expected the saved settings with defaults, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without a running player the page is told to show nothing.
+	w = httptest.NewRecorder()
+	svc.HandlePlayerNow(w, httptest.NewRequest(http.MethodGet, "/api/player/now", nil))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"state":"idle"}` {
+		t.Errorf("expected an idle player, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandlePlayerPage(w, httptest.NewRequest(http.MethodGet, "/player", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/player/now") {
+		t.Errorf("expected the player page, got %d", w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+)
+
+// @Title: Validate Playlist
+// @Route: GET|POST /api/playlists/validate?id=...
+// @Description: Dry-run check that each asset can play and that something will; GET checks the current playlist of a host, read from its CMS, POST checks {"assets": [...]}
+// @Response: {"assets": [{"name": "...", "uri": "...", "valid": true, "playable": true}], "valid": 3, "playable": 2, "blank": false}
+func (s *Service) HandleValidatePlaylist(w http.ResponseWriter, r *http.Request) {
+	var assets []playlist.Asset
+	switch r.Method {
+	case http.MethodGet:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			s.writeError(w, http.StatusBadRequest, "Missing 'id' query parameter")
+			return
+		}
+		host, err := s.store.GetByID(id)
+		if err != nil {
+			s.writeError(w, http.StatusNotFound, "Host not found")
+			return
+		}
+		path := hosts.SelectPath(*host)
+		assets, err = s.readAssets(*host, 5*time.Second)
+		if err != nil {
+			s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not read playlist from %s: %v", path.Address, err))
+			return
+		}
+	case http.MethodPost:
+		var req struct {
+			Assets []playlist.Asset `json:"assets"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		assets = req.Assets
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, playlist.NewValidator().Validate(assets))
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// publicStatus is the fleet health without host details: no names,
+// addresses or counts, only shares of the fleet.
+type publicStatus struct {
+	AvailablePercent float64                        `json:"available_percent"` // Hosts that are not offline
+	Health           map[types.HealthStatus]float64 `json:"health"`            // Percent of hosts by health
+	UpdatedAt        time.Time                      `json:"updated_at"`
+}
+
+func fleetPublicStatus(list []types.Host) publicStatus {
+	status := publicStatus{Health: map[types.HealthStatus]float64{}, UpdatedAt: time.Now().UTC()}
+	if len(list) == 0 {
+		return status
+	}
+	counts := make(map[types.HealthStatus]int)
+	for _, h := range list {
+		health := h.Health
+		if health == "" {
+			health = types.HealthOffline
+		}
+		counts[health]++
+	}
+	percent := func(n int) float64 {
+		return math.Round(1000*float64(n)/float64(len(list))) / 10
+	}
+	for health, n := range counts {
+		status.Health[health] = percent(n)
+	}
+	status.AvailablePercent = percent(len(list) - counts[types.HealthOffline])
+	return status
+}
+
+// @Title: Public Status
+// @Route: GET /api/public/status?token=...
+// @Description: Anonymized fleet health for customer-facing status pages: the percent of hosts available and by health, without host details. Off unless enabled in /api/settings/public-status; then open to the token or allowed IPs
+// @Response: {"available_percent": 91.7, "health": {"online": 83.3, "degraded": 8.3, "offline": 8.3}, "updated_at": "..."}
+func (s *Service) HandlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.auth.PublicStatusAllows(r) {
+		s.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	// Status pages may fetch this from the browser.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	s.writeJSON(w, http.StatusOK, fleetPublicStatus(s.store.GetAll()))
+}
+
+// @Title: Public Status Settings
+// @Route: GET|POST /api/settings/public-status
+// @Description: Get or update access to /api/public/status. allowed_ips lists IPs or CIDRs admitted without a token; with require_token the token also admits callers, and rotate_token issues a new one. With neither, anyone may read it
+// @Response: {"enabled": true, "token": "...", "allowed_ips": ["203.0.113.0/24"], "url": "/api/public/status?token=..."}
+func (s *Service) HandlePublicStatusSettings(w http.ResponseWriter, r *http.Request) {
+	var cfg auth.PublicStatusConfig
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if cfg, err = s.auth.LoadPublicStatus(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case http.MethodPost:
+		var req struct {
+			Enabled      bool     `json:"enabled"`
+			AllowedIPs   []string `json:"allowed_ips"`
+			RequireToken bool     `json:"require_token"`
+			RotateToken  bool     `json:"rotate_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		var err error
+		if cfg, err = s.auth.SavePublicStatus(req.Enabled, req.AllowedIPs, req.RequireToken, req.RotateToken); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated public status access (enabled=%t, token=%t, %d allowed IPs)",
+			cfg.Enabled, cfg.Token != "", len(cfg.AllowedIPs)))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link := "/api/public/status"
+	if cfg.Token != "" {
+		link += "?token=" + url.QueryEscape(cfg.Token)
+	}
+	s.writeJSON(w, http.StatusOK, struct {
+		auth.PublicStatusConfig
+		URL string `json:"url"`
+	}{cfg, link})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandlePublicStatus(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "a", Nickname: "Lobby", IPAddress: "10.1.0.20"})
+	store.Add(types.Host{ID: "b", Nickname: "Cafe", IPAddress: "10.1.0.21"})
+
+	get := func(path, remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote + ":40000"
+		w := httptest.NewRecorder()
+		svc.HandlePublicStatus(w, req)
+		return w
+	}
+
+	if w := get("/api/public/status", "203.0.113.5"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 until enabled, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandlePublicStatusSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/public-status",
+		strings.NewReader(`{"enabled": true, "allowed_ips": ["203.0.113.0/24"], "require_token": true}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var cfg struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(w.Body).Decode(&cfg)
+
+	w = get("/api/public/status", "203.0.113.5")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected an allowed IP to get the status, got %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "Lobby") || strings.Contains(body, "10.1.0.20") {
+		t.Errorf("expected no host details, got %s", body)
+	}
+	var status publicStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.AvailablePercent != 0 || status.Health[types.HealthOffline] != 100 {
+		t.Errorf("expected both hosts offline, got %+v", status)
+	}
+
+	if w := get("/api/public/status", "198.51.100.7"); w.Code != http.StatusNotFound {
+		t.Errorf("expected other IPs to be refused, got %d", w.Code)
+	}
+	if w := get("/api/public/status?token="+cfg.Token, "198.51.100.7"); w.Code != http.StatusOK {
+		t.Errorf("expected the token to be accepted, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandlePublicStatusSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/public-status",
+		strings.NewReader(`{"enabled": true, "allowed_ips": ["not-an-ip"]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad allowlist entry, got %d", w.Code)
+	}
+}
+
+func TestFleetPublicStatus(t *testing.T) {
+	status := fleetPublicStatus([]types.Host{
+		{Health: types.HealthOnline}, {Health: types.HealthOnline}, {Health: types.HealthDegraded},
+	})
+	if status.AvailablePercent != 100 || status.Health[types.HealthOnline] != 66.7 || status.Health[types.HealthDegraded] != 33.3 {
+		t.Errorf("unexpected percentages: %+v", status)
+	}
+}
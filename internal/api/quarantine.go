@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"nexsign.mini/nsm/internal/announce"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// maxAnnouncementSize bounds the body of an unauthenticated announcement.
+const maxAnnouncementSize = 64 << 10
+
+// @Title: List Quarantined Announcements
+// @Route: GET /api/hosts/quarantine
+// @Description: Host announcements held for approval because they were unsigned or their sender's key is not pinned, newest first
+// @Response: [{"id": 3, "sender_id": "...", "sender_key": "...", "remote_addr": "192.168.1.77", "reason": "unknown sender", "host": {...}, "received_at": "..."}]
+func (s *Service) HandleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list, err := s.store.ListQuarantine()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, list)
+}
+
+// @Title: Approve Quarantined Announcement
+// @Route: POST /api/hosts/quarantine/approve?id=<id>
+// @Description: Apply a held announcement to the host list. It is checked again, so it still may not change another node's address or hostname
+// @Response: Host object
+func (s *Service) HandleApproveQuarantined(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.takeQuarantined(w, r)
+	if !ok {
+		return
+	}
+
+	if err := announce.Validate(q.Host); err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := announce.CheckIdentity(s.store, q.SenderID, q.Host); err != nil {
+		s.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := s.mergeHost(r.Context(), q.Host, q.SenderID); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	auth.AnnotateAudit(r, q.Host.ID, fmt.Sprintf("approved announcement of %s from %s", q.Host.IPAddress, q.RemoteAddr))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Approved quarantined announcement of %s (ID: %s)", q.Host.IPAddress, q.Host.ID))
+	s.writeJSON(w, http.StatusOK, q.Host)
+}
+
+// @Title: Reject Quarantined Announcement
+// @Route: POST /api/hosts/quarantine/reject?id=<id>
+// @Description: Drop a held announcement
+// @Response: 204 No Content
+func (s *Service) HandleRejectQuarantined(w http.ResponseWriter, r *http.Request) {
+	q, ok := s.takeQuarantined(w, r)
+	if !ok {
+		return
+	}
+	auth.AnnotateAudit(r, q.Host.ID, fmt.Sprintf("rejected announcement of %s from %s", q.Host.IPAddress, q.RemoteAddr))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// takeQuarantined removes the entry named by the id parameter, writing an
+// error response if there is none.
+func (s *Service) takeQuarantined(w http.ResponseWriter, r *http.Request) (hosts.Quarantined, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return hosts.Quarantined{}, false
+	}
+	id, err := strconv.ParseInt(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "A numeric id is required")
+		return hosts.Quarantined{}, false
+	}
+	q, err := s.store.TakeQuarantined(id)
+	if errors.Is(err, hosts.ErrQuarantineNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return hosts.Quarantined{}, false
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return hosts.Quarantined{}, false
+	}
+	return q, true
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestAnnouncementQuarantine(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	announce := func(h types.Host) int {
+		body, _ := json.Marshal(h)
+		w := httptest.NewRecorder()
+		svc.HandleAnnounceHost(w, httptest.NewRequest(http.MethodPost, "/api/hosts/announce", bytes.NewReader(body)))
+		return w.Code
+	}
+	// Unsigned announcements, as older nodes send, are held.
+	if code := announce(types.Host{ID: "tv-1", IPAddress: "192.168.1.40", Nickname: "Foyer"}); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if code := announce(types.Host{ID: "tv-2", IPAddress: "192.168.1.41"}); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	if code := announce(types.Host{ID: "tv-3", IPAddress: "not an address!"}); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid host, got %d", code)
+	}
+	if len(store.GetAll()) != 0 {
+		t.Fatal("expected nothing applied before approval")
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleQuarantine(w, httptest.NewRequest(http.MethodGet, "/api/hosts/quarantine", nil))
+	var held []hosts.Quarantined
+	json.NewDecoder(w.Body).Decode(&held)
+	if len(held) != 2 || held[1].Host.ID != "tv-1" {
+		t.Fatalf("unexpected quarantine %+v", held)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleApproveQuarantined(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/hosts/quarantine/approve?id=%d", held[1].ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if h, err := store.GetByID("tv-1"); err != nil || h.Nickname != "Foyer" {
+		t.Errorf("expected tv-1 applied, got %+v (%v)", h, err)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleRejectQuarantined(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/hosts/quarantine/reject?id=%d", held[0].ID), nil))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("reject: expected 204, got %d", w.Code)
+	}
+	if _, err := store.GetByID("tv-2"); err == nil {
+		t.Error("a rejected host was added")
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleRejectQuarantined(w, httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/hosts/quarantine/reject?id=%d", held[0].ID), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an entry already taken, got %d", w.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"nexsign.mini/nsm/internal/rebooting"
+)
+
+// @Title: Reboot Schedules
+// @Route: GET|POST /api/reboots/schedules
+// @Description: Get or replace the scheduled reboots of this node. Each schedule has name, enabled, hosts (IDs) or view (a saved view whose filter picks the hosts when the reboot is due), at (HH:MM on each host clock), days (mon...sun, empty for daily), window_minutes (default 60) and script (a Starlark condition that also sees host). Reboots wait while the host is locked for editing, a calendar booking is on or the script does not hold, and are skipped if the window closes first
+// @Response: [{"id": "...", "name": "Nightly", "enabled": true, "filter": {"subnets": ["10.1.0.0/16"]}, "view": "Building A", "at": "04:00", "window_minutes": 60}]
+func (s *Service) HandleRebootSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := rebooting.LoadSchedules(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var list []rebooting.Schedule
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if list == nil {
+			list = []rebooting.Schedule{}
+		}
+		// Views belong to the user who saved them, so the filter is copied
+		// into the schedule rather than looked up when it runs.
+		for i := range list {
+			sched := &list[i]
+			if sched.View == "" || sched.Filter != nil {
+				continue
+			}
+			v, status, err := s.savedView(r, sched.View)
+			if err != nil {
+				s.writeError(w, status, err.Error())
+				return
+			}
+			sched.Filter = &v.Filter
+		}
+
+		list, err := rebooting.SaveSchedules(s.store, list)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated reboot schedules (%d schedules)", len(list)))
+		s.writeJSON(w, http.StatusOK, list)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Scheduled Reboot Status
+// @Route: GET /api/reboots/status
+// @Description: The last scheduled reboot of each host and schedule: waiting (held back or unreachable, with the reason), rebooting, done once the host reports a new boot, skipped when the window closed first, or failed when it did not come back
+// @Response: [{"schedule_id": "...", "host_id": "...", "due": "...", "state": "skipped", "reason": "host was being edited", "finished_at": "..."}]
+func (s *Service) HandleRebootStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := rebooting.LoadState(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out := []rebooting.Run{}
+	for _, run := range state {
+		out = append(out, *run)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Due.After(out[j].Due) })
+	s.writeJSON(w, http.StatusOK, out)
+}
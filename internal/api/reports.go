@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/reports"
+)
+
+// @Title: SMTP Settings
+// @Route: GET|POST /api/settings/smtp
+// @Description: Get or update the outbound mail server used by reports and alerts (password is masked on read)
+// @Response: {"host": "...", "port": 587, "username": "...", "password": "********", "from": "..."}
+func (s *Service) HandleSMTPSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := notify.LoadSMTP(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg notify.SMTPConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored password when the client echoes back the mask.
+		if cfg.Password == "" || cfg.Password == cfg.Masked().Password {
+			current, err := notify.LoadSMTP(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.Password = current.Password
+		}
+
+		if err := s.store.PutSetting(notify.SMTPSettingKey, cfg); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated SMTP settings (%s)", cfg.Host))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Report Schedule
+// @Route: GET|POST /api/reports/config
+// @Description: Get or update the scheduled fleet report (frequency weekly|monthly, hour, timezone, recipients, formats csv|pdf)
+// @Response: {"enabled": true, "frequency": "weekly", "hour": 8, "recipients": [...], "formats": ["pdf", "csv"]}
+func (s *Service) HandleReportConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := reports.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg)
+	case http.MethodPost:
+		var cfg reports.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		cfg, err := reports.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated report schedule (%s, enabled=%v)", cfg.Frequency, cfg.Enabled))
+		s.writeJSON(w, http.StatusOK, cfg)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Download Report
+// @Route: GET /api/reports/download?format=pdf|csv&days=7
+// @Description: Download the current fleet summary report, with each host's uptime over the last days (1-730, default 7)
+// @Response: PDF or CSV file download
+func (s *Service) HandleReportDownload(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = reports.FormatPDF
+	}
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 730 {
+			s.writeError(w, http.StatusBadRequest, "days must be between 1 and 730")
+			return
+		}
+		days = n
+	}
+
+	now := time.Now()
+	summary, err := reports.Fleet(s.store, now.AddDate(0, 0, -days), now)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var (
+		data        []byte
+		contentType string
+	)
+	switch format {
+	case reports.FormatPDF:
+		data = reports.RenderPDF(summary)
+		contentType = "application/pdf"
+	case reports.FormatCSV:
+		data, err = reports.RenderCSV(summary)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "Failed to render report")
+			return
+		}
+		contentType = "text/csv; charset=utf-8"
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q (use pdf or csv)", format))
+		return
+	}
+
+	filename := fmt.Sprintf("nsm-report-%s.%s", now.Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Write(data)
+}
+
+// @Title: Hardware Inventory
+// @Route: GET /api/inventory?format=json|csv
+// @Description: Board model, serial number, OS, kernel, RAM and SD card size of every host, as reported in its heartbeats
+// @Response: {"generated_at": "...", "total": 12, "unreported": 1, "by_model": {"Raspberry Pi 4 Model B Rev 1.4": 8}, "hosts": [{"id": "...", "name": "Lobby", "ip_address": "...", "model": "...", "serial": "...", "os": "...", "kernel": "...", "ram_bytes": 4294967296, "sd_card_bytes": 31914983424, "reported_at": "..."}]}
+func (s *Service) HandleInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	inventory, err := s.store.ListInventory()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	report := reports.BuildInventory(s.store.GetAll(), inventory, now)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		s.writeJSON(w, http.StatusOK, report)
+	case reports.FormatCSV:
+		data, err := reports.RenderInventoryCSV(report)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, "Failed to render inventory")
+			return
+		}
+		filename := fmt.Sprintf("nsm-inventory-%s.csv", now.Format("2006-01-02"))
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+		w.Write(data)
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported format %q (use json or csv)", format))
+	}
+}
+
+// @Title: Send Report Now
+// @Route: POST /api/reports/send
+// @Description: Email the fleet report to the configured recipients immediately
+// @Response: {"status": "ok", "recipients": 0}
+func (s *Service) HandleReportSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg, err := reports.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := reports.Send(s.store, cfg, time.Now()); err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to send report: %v", err))
+		s.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Sent fleet report to %d recipients", len(cfg.Recipients)))
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "ok",
+		"recipients": len(cfg.Recipients),
+	})
+}
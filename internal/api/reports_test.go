@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/reports"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleReportDownload(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/reports/download?format=pdf", nil)
+	w := httptest.NewRecorder()
+	svc.HandleReportDownload(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("Expected Content-Type application/pdf, got %s", ct)
+	}
+	if !strings.HasPrefix(w.Body.String(), "%PDF-") {
+		t.Errorf("Expected PDF body")
+	}
+}
+
+func TestHandleSMTPSettings_MasksPassword(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	body := `{"host": "smtp.example.com", "port": 587, "username": "nsm", "password": "secret", "from": "nsm@example.com"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/settings/smtp", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	svc.HandleSMTPSettings(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Saving again with the mask must keep the original password.
+	body = `{"host": "smtp.example.com", "port": 587, "username": "nsm", "password": "********", "from": "nsm@example.com"}`
+	req = httptest.NewRequest(http.MethodPost, "/api/settings/smtp", strings.NewReader(body))
+	svc.HandleSMTPSettings(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/settings/smtp", nil)
+	w = httptest.NewRecorder()
+	svc.HandleSMTPSettings(w, req)
+
+	var cfg map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&cfg); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if cfg["password"] != "********" {
+		t.Errorf("Expected masked password, got %v", cfg["password"])
+	}
+
+	var stored struct {
+		Password string `json:"password"`
+	}
+	svc.store.GetSetting("smtp", &stored)
+	if stored.Password != "secret" {
+		t.Errorf("Expected stored password to be preserved, got %q", stored.Password)
+	}
+}
+
+func TestHandleInventory(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", Nickname: "Cafe", IPAddress: "192.168.1.21"})
+	store.PutInventory("lobby", hosts.Inventory{Model: "Raspberry Pi 5 Model B Rev 1.0", Serial: "abc123", RAMBytes: 8 << 30}, time.Now())
+
+	w := httptest.NewRecorder()
+	svc.HandleInventory(w, httptest.NewRequest(http.MethodGet, "/api/inventory", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status OK, got %d: %s", w.Code, w.Body.String())
+	}
+	var report reports.InventoryReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if report.Total != 2 || report.Unreported != 1 || report.ByModel["Raspberry Pi 5 Model B Rev 1.0"] != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleInventory(w, httptest.NewRequest(http.MethodGet, "/api/inventory?format=csv", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Expected CSV, got %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "Lobby,192.168.1.20,lobby,Raspberry Pi 5 Model B Rev 1.0,abc123,,,8192,,") {
+		t.Errorf("Expected the Lobby row, got:\n%s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleInventory(w, httptest.NewRequest(http.MethodGet, "/api/inventory?format=pdf", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", w.Code)
+	}
+}
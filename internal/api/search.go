@@ -0,0 +1,185 @@
+package api
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Search result types, in the order results are returned.
+const (
+	ResultHost   = "host"
+	ResultPreset = "preset"
+	ResultEvent  = "event"
+	ResultDoc    = "doc"
+)
+
+// Limits on results per type.
+const (
+	defaultSearchLimit = 5
+	maxSearchLimit     = 50
+)
+
+// SearchResult is one match from /api/search.
+type SearchResult struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`               // Host ID, snapshot name, audit entry ID, or doc file
+	Title  string `json:"title"`            // Host label, snapshot name, audit action, or section title
+	Detail string `json:"detail,omitempty"` // Context for the match
+	Field  string `json:"field,omitempty"`  // The host field that matched
+}
+
+// @Title: Search
+// @Route: GET /api/search?q=...&limit=5
+// @Description: Search hosts (nickname, hostname, IPs, MAC, notes), presets (configuration snapshots), events (the audit log; admins only) and the docs in one call, ignoring case. Returns up to limit results of each type (default 5, at most 50), hosts first; prefix matches sort ahead of others
+// @Response: [{"type": "host", "id": "...", "title": "Lobby", "detail": "192.168.1.50 · healthy", "field": "nickname"}, {"type": "doc", "id": "api.adoc", "title": "Fleet Topology", "detail": "Each node reports which hosts it can reach..."}]
+func (s *Service) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'q' query parameter")
+		return
+	}
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			s.writeError(w, http.StatusBadRequest, "limit must be between 1 and 50")
+			return
+		}
+		limit = n
+	}
+
+	results := searchHosts(s.store.GetAll(), q, limit)
+
+	snapshots, err := s.store.ListSnapshots()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	results = append(results, searchSnapshots(snapshots, q, limit)...)
+
+	// The audit log is for admins; everyone has it in open mode.
+	if u, ok := auth.UserFromContext(r.Context()); !ok || u.Role.Allows(types.RoleAdmin) {
+		entries, err := s.store.ListAudit(hosts.AuditQuery{Text: q, Limit: limit})
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, e := range entries {
+			detail := e.Time.Local().Format("2006-01-02 15:04") + " by " + e.Actor
+			if e.Target != "" {
+				detail += " · " + e.Target
+			}
+			if e.Detail != "" {
+				detail += " · " + e.Detail
+			}
+			results = append(results, SearchResult{Type: ResultEvent, ID: strconv.FormatInt(e.ID, 10), Title: e.Action, Detail: detail})
+		}
+	}
+
+	if s.docs != nil {
+		sections, err := s.docs.Search(q, limit)
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "API: docs not searched: "+err.Error())
+		}
+		for _, sec := range sections {
+			results = append(results, SearchResult{Type: ResultDoc, ID: sec.Doc, Title: sec.Title, Detail: sec.Excerpt})
+		}
+	}
+
+	s.writeJSON(w, http.StatusOK, results)
+}
+
+// match ranks how text matches the lower-case query: 0 for a prefix,
+// 1 elsewhere, -1 not at all.
+func match(text, query string) int {
+	switch i := strings.Index(strings.ToLower(text), query); {
+	case i == 0:
+		return 0
+	case i > 0:
+		return 1
+	}
+	return -1
+}
+
+type rankedResult struct {
+	SearchResult
+	rank int
+}
+
+// best sorts ranked results, prefix matches first and then by title, and
+// keeps up to limit.
+func best(ranked []rankedResult, limit int) []SearchResult {
+	slices.SortStableFunc(ranked, func(a, b rankedResult) int {
+		return cmp.Or(cmp.Compare(a.rank, b.rank), strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)))
+	})
+	results := []SearchResult{}
+	for _, r := range ranked[:min(limit, len(ranked))] {
+		results = append(results, r.SearchResult)
+	}
+	return results
+}
+
+func searchHosts(list []types.Host, q string, limit int) []SearchResult {
+	q = strings.ToLower(q)
+	var ranked []rankedResult
+	for _, h := range list {
+		fields := []struct{ name, value string }{
+			{"nickname", h.Nickname},
+			{"hostname", h.Hostname},
+			{"ip_address", h.IPAddress},
+			{"vpn_ip_address", h.VPNIPAddress},
+			{"mac_address", h.MACAddress},
+			{"notes", h.Notes},
+		}
+		// Report the field that matches best, the first one on a tie.
+		rank, field := -1, ""
+		for _, f := range fields {
+			if r := match(f.value, q); r >= 0 && (rank < 0 || r < rank) {
+				rank, field = r, f.name
+			}
+		}
+		if rank < 0 {
+			continue
+		}
+		ranked = append(ranked, rankedResult{SearchResult{
+			Type:   ResultHost,
+			ID:     h.ID,
+			Title:  cmp.Or(h.Nickname, h.Hostname, h.IPAddress),
+			Detail: h.IPAddress + " · " + string(h.Status),
+			Field:  field,
+		}, rank})
+	}
+	return best(ranked, limit)
+}
+
+func searchSnapshots(list []hosts.Snapshot, q string, limit int) []SearchResult {
+	q = strings.ToLower(q)
+	var ranked []rankedResult
+	for _, snap := range list {
+		rank := match(snap.Name, q)
+		if rank < 0 {
+			if rank = match(snap.Description, q); rank < 0 {
+				continue
+			}
+			rank = 1
+		}
+		detail := strconv.Itoa(snap.HostCount) + " hosts"
+		if snap.Description != "" {
+			detail = snap.Description + " · " + detail
+		}
+		ranked = append(ranked, rankedResult{SearchResult{Type: ResultPreset, ID: snap.Name, Title: snap.Name, Detail: detail}, rank})
+	}
+	return best(ranked, limit)
+}
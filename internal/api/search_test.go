@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/docs"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleSearch(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "192.168.1.50", Notes: "Left of reception"})
+	store.Add(types.Host{ID: "cafe", Nickname: "Cafe menu", Hostname: "cafe-lobby", IPAddress: "192.168.1.51"})
+	store.Add(types.Host{ID: "gym", Nickname: "Gym", IPAddress: "192.168.1.52"})
+	store.SaveSnapshot("lobby-event", "Lobby takeover")
+	store.AppendAudit(hosts.AuditEntry{Actor: "admin", ActorType: hosts.ActorUser, Action: "POST /api/hosts/update", Target: "lobby"})
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "guide.adoc"), []byte("= Guide\n\n== Screens\n\nPut one in the lobby.\n\n----\nlobby example\n----\n\n== Lobby Setup\n\nSteps.\n"), 0644)
+	svc.SetDocs(docs.NewService(dir))
+
+	search := func(r *http.Request) []SearchResult {
+		t.Helper()
+		w := httptest.NewRecorder()
+		svc.HandleSearch(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var results []SearchResult
+		json.NewDecoder(w.Body).Decode(&results)
+		return results
+	}
+
+	results := search(httptest.NewRequest(http.MethodGet, "/api/search?q=LOBBY", nil))
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Type+":"+r.Title)
+	}
+	// Prefix matches first; the doc title match before the text match.
+	want := []string{"host:Lobby", "host:Cafe menu", "preset:lobby-event", "event:POST /api/hosts/update", "doc:Lobby Setup", "doc:Screens"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	if results[1].Field != "hostname" {
+		t.Errorf("expected the hostname to match for the cafe, got %q", results[1].Field)
+	}
+
+	// Events are left out for users who cannot read the audit log.
+	r := httptest.NewRequest(http.MethodGet, "/api/search?q=lobby&limit=1", nil)
+	r = r.WithContext(auth.WithUser(r.Context(), types.User{Username: "op", Role: types.RoleOperator}))
+	for _, res := range search(r) {
+		if res.Type == ResultEvent {
+			t.Errorf("expected no events for an operator, got %+v", res)
+		}
+		if res.Type == ResultHost && res.ID != "lobby" {
+			t.Errorf("expected only the best host with limit=1, got %+v", res)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleSearch(w, httptest.NewRequest(http.MethodGet, "/api/search", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a query, got %d", w.Code)
+	}
+}
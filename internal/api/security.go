@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+)
+
+// @Title: Security Header Settings
+// @Route: GET|POST /api/settings/security
+// @Description: Get or update the Content-Security-Policy (empty for the default, "off" to disable), report-only mode, and HSTS
+// @Response: {"content_security_policy": "", "csp_report_only": false, "hsts": false, "effective_policy": "default-src 'self'; ..."}
+func (s *Service) HandleSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	var cfg auth.SecurityConfig
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if cfg, err = s.auth.LoadSecurity(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if err := s.auth.SaveSecurity(cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated security headers (CSP report-only=%t, HSTS=%t)", cfg.CSPReportOnly, cfg.HSTS))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, struct {
+		auth.SecurityConfig
+		EffectivePolicy string `json:"effective_policy"`
+	}{cfg, cfg.Policy()})
+}
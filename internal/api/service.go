@@ -2,11 +2,28 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"path/filepath"
 
+	"nexsign.mini/nsm/internal/announce"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/bandwidth"
+	"nexsign.mini/nsm/internal/cache"
+	"nexsign.mini/nsm/internal/chaos"
+	"nexsign.mini/nsm/internal/docs"
 	"nexsign.mini/nsm/internal/hosts"
 	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/media"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/peerlog"
+	"nexsign.mini/nsm/internal/player"
+	"nexsign.mini/nsm/internal/requestid"
+	"nexsign.mini/nsm/internal/tailscale"
 	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/vault"
+	"nexsign.mini/nsm/internal/watchdog"
+	"nexsign.mini/nsm/internal/widgets"
 )
 
 // AnthiasProvider defines the interface for interacting with Anthias
@@ -16,18 +33,99 @@ type AnthiasProvider interface {
 
 // Service handles API requests
 type Service struct {
-	store   *hosts.Store
-	anthias AnthiasProvider
-	logger  *logger.Logger
+	store     *hosts.Store
+	anthias   AnthiasProvider
+	logger    *logger.Logger
+	auth      *auth.Service
+	vault     *vault.Vault
+	tailscale *tailscale.Client
+	cache     *cache.Cache
+	media     *media.Transcoder
+	widgets   *widgets.Sources
+	bandwidth *bandwidth.Manager
+	docs      *docs.Service
+	peerQueue *announce.Queue
+	peerBus   *peerbus.Pool
+	peerLogs  *peerlog.Buffer
+	approvals approvalQueue
+	chaos     *chaos.Injector    // nil unless started with -chaos
+	player    *player.Player     // nil until SetPlayer
+	watchdog  *watchdog.Watchdog // nil until SetWatchdog
 }
 
 // NewService creates a new API service
 func NewService(store *hosts.Store, anthias AnthiasProvider, logger *logger.Logger) *Service {
-	return &Service{
-		store:   store,
-		anthias: anthias,
-		logger:  logger,
+	s := &Service{
+		store:     store,
+		anthias:   anthias,
+		logger:    logger,
+		auth:      auth.NewService(store, logger),
+		tailscale: tailscale.NewClient(),
+		widgets:   widgets.NewSources(),
+		bandwidth: bandwidth.New(),
+		peerQueue: announce.NewQueue(),
+		peerBus:   peerbus.NewPool(),
+		peerLogs:  peerlog.NewBuffer(),
 	}
+	s.peerBus.SetSigner(s.auth.PeerSigner())
+
+	if cfg, err := bandwidth.LoadConfig(store); err == nil {
+		s.bandwidth.Apply(cfg)
+	} else {
+		logger.Error(fmt.Sprintf("API: bandwidth limits not loaded: %v", err))
+	}
+	if cfg, err := store.CheckConfig(); err == nil {
+		s.store.ApplyCheckConfig(cfg)
+	} else {
+		logger.Error(fmt.Sprintf("API: health-check settings not loaded: %v", err))
+	}
+
+	v, err := vault.New(store, s.auth.Identity())
+	if err != nil {
+		logger.Error(fmt.Sprintf("API: credentials vault disabled: %v", err))
+		v, _ = vault.New(store, nil)
+	}
+	s.vault = v
+
+	c, err := cache.New(filepath.Join(store.Dir(), "asset-cache"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("API: asset cache disabled: %v", err))
+	} else {
+		c.SetTransport(s.bandwidth.Transport(bandwidth.OpCache, nil))
+	}
+	s.cache = c
+
+	t, err := media.NewTranscoder(filepath.Join(store.Dir(), "media"))
+	if err != nil {
+		logger.Error(fmt.Sprintf("API: video transcoding disabled: %v", err))
+	}
+	s.media = t
+	return s
+}
+
+// Auth returns the account service used for login and access control
+func (s *Service) Auth() *auth.Service {
+	return s.auth
+}
+
+// Bandwidth returns the limiter for transfers NSM starts itself
+func (s *Service) Bandwidth() *bandwidth.Manager {
+	return s.bandwidth
+}
+
+// PeerQueue returns the announcements waiting for peers that missed them
+func (s *Service) PeerQueue() *announce.Queue {
+	return s.peerQueue
+}
+
+// PeerBus returns the connections requests to peers are posted over
+func (s *Service) PeerBus() *peerbus.Pool {
+	return s.peerBus
+}
+
+// SetDocs sets the documentation searched by /api/search
+func (s *Service) SetDocs(d *docs.Service) {
+	s.docs = d
 }
 
 // writeJSON writes a JSON response
@@ -37,7 +135,12 @@ func (s *Service) writeJSON(w http.ResponseWriter, status int, data interface{})
 	json.NewEncoder(w).Encode(data)
 }
 
-// writeError writes a JSON error response
+// writeError writes a JSON error response, with the request ID to look
+// the request up in the logs by
 func (s *Service) writeError(w http.ResponseWriter, status int, message string) {
-	s.writeJSON(w, status, map[string]string{"error": message})
+	body := map[string]string{"error": message}
+	if id := w.Header().Get(requestid.Header); id != "" {
+		body["request_id"] = id
+	}
+	s.writeJSON(w, status, body)
 }
@@ -22,7 +22,7 @@ func (m *MockAnthias) GetMetadata() (*types.Host, error) {
 // setupTest creates a temporary store and service for testing
 func setupTest(t *testing.T) (*Service, *hosts.Store, func()) {
 	// Create a temporary file for the database
-	tmpDB, err := os.CreateTemp("", "hosts-test-*.db")
+	tmpDB, err := os.CreateTemp(t.TempDir(), "hosts-test-*.db")
 	if err != nil {
 		t.Fatalf("Failed to create temp db: %v", err)
 	}
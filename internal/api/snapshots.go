@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// @Title: List or Save Snapshots
+// @Route: GET|POST /api/snapshots
+// @Description: List named configuration snapshots, or save the current configuration under a name
+// @Response: [{"name": "...", "description": "...", "created_at": "...", "host_count": 0}] or the saved snapshot
+func (s *Service) HandleSnapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshots, err := s.store.ListSnapshots()
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to list snapshots: %v", err))
+			s.writeError(w, http.StatusInternalServerError, "Failed to list snapshots")
+			return
+		}
+		s.writeJSON(w, http.StatusOK, snapshots)
+	case http.MethodPost:
+		var req struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		snap, err := s.store.SaveSnapshot(req.Name, req.Description)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Saved snapshot %q with %d hosts", snap.Name, snap.HostCount))
+		snap.Hosts = nil
+		s.writeJSON(w, http.StatusCreated, snap)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Get Snapshot
+// @Route: GET /api/snapshots/get?name=...
+// @Description: Get a named snapshot including its host list
+// @Response: {"name": "...", "created_at": "...", "host_count": 0, "hosts": [...]}
+func (s *Service) HandleGetSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+
+	snap, err := s.store.GetSnapshot(name)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, snap)
+}
+
+// @Title: Diff Snapshot
+// @Route: GET /api/snapshots/diff?name=...
+// @Description: Compare a snapshot with the current host list (added, removed, and changed hosts)
+// @Response: {"snapshot": "...", "added": [...], "removed": [...], "changed": [{"id": "...", "ip_address": "...", "fields": [...]}]}
+func (s *Service) HandleDiffSnapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+
+	diff, err := s.store.DiffSnapshot(name)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, diff)
+}
+
+// @Title: Restore Snapshot
+// @Route: POST /api/snapshots/restore?name=...
+// @Description: Replace the current host list with a named snapshot
+// @Response: {"status": "ok", "snapshot": "...", "host_count": 0}
+func (s *Service) HandleRestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.holdForApproval(w, r, auth.ApprovalRestore, s.HandleRestoreSnapshot) {
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+
+	snap, err := s.store.RestoreSnapshot(name)
+	if err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Restored snapshot %q (%d hosts)", snap.Name, snap.HostCount))
+	s.presetApplied(snap.Name, "api")
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":     "ok",
+		"snapshot":   snap.Name,
+		"host_count": snap.HostCount,
+	})
+}
+
+// @Title: Delete Snapshot
+// @Route: DELETE|POST /api/snapshots/delete?name=...
+// @Description: Delete a named snapshot
+// @Response: 204 No Content
+func (s *Service) HandleDeleteSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+
+	if err := s.store.DeleteSnapshot(name); err != nil {
+		s.writeSnapshotError(w, err)
+		return
+	}
+
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Deleted snapshot %q", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Service) writeSnapshotError(w http.ResponseWriter, err error) {
+	if errors.Is(err, hosts.ErrSnapshotNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	s.logger.Error(fmt.Sprintf("Snapshot operation failed: %v", err))
+	s.writeError(w, http.StatusInternalServerError, err.Error())
+}
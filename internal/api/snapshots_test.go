@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleSnapshots(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "1", IPAddress: "192.168.1.1", Nickname: "Host 1"})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/snapshots", strings.NewReader(`{"name": "event-mode"}`))
+	w := httptest.NewRecorder()
+	svc.HandleSnapshots(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/snapshots", nil)
+	w = httptest.NewRecorder()
+	svc.HandleSnapshots(w, req)
+
+	var snapshots []struct {
+		Name      string `json:"name"`
+		HostCount int    `json:"host_count"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&snapshots); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "event-mode" || snapshots[0].HostCount != 1 {
+		t.Errorf("Expected one event-mode snapshot with 1 host, got %+v", snapshots)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/snapshots", strings.NewReader(`{"name": ""}`))
+	w = httptest.NewRecorder()
+	svc.HandleSnapshots(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty name, got %d", w.Code)
+	}
+}
+
+func TestHandleRestoreSnapshot_NotFound(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/snapshots/restore?name=missing", nil)
+	w := httptest.NewRecorder()
+	svc.HandleRestoreSnapshot(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/snmp"
+)
+
+// @Title: SNMP Agent Settings
+// @Route: GET|POST /api/settings/snmp-agent
+// @Description: Get or update the optional SNMP agent exposing fleet health to network monitoring (enabled, port, community, users, base_oid). The community enables SNMPv2c; users are SNMPv3 users with sha or sha256 authentication and optional aes privacy. Secrets are masked in responses and kept when sent back masked or empty. Changes apply within 10 seconds
+// @Response: {"enabled": true, "port": 161, "community": "********", "users": [{"name": "nms", "auth_protocol": "sha256", "auth_password": "********", "priv_protocol": "aes", "priv_password": "********"}], "base_oid": "1.3.6.1.4.1.8072.9999.9999.1"}
+func (s *Service) HandleSNMPAgentSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := snmp.LoadAgentConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg snmp.AgentConfig
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep stored secrets the client echoes back masked.
+		current, err := snmp.LoadAgentConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		cfg.Unmask(current)
+
+		cfg, err = snmp.SaveAgentConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated SNMP agent settings (enabled %t, port %d, %d v3 users)", cfg.Enabled, cfg.Port, len(cfg.Users)))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/snmp"
+)
+
+func TestHandleSNMPAgentSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleSNMPAgentSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/snmp-agent", strings.NewReader(body)))
+		return w
+	}
+
+	w := post(`{"enabled": true, "port": 1161, "community": "facilities", "users": [{"name": "nms", "auth_protocol": "sha256", "auth_password": "maplesyrup"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp snmp.AgentConfig
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Community == "facilities" || resp.Users[0].AuthPassword == "maplesyrup" || resp.BaseOID != snmp.DefaultBaseOID {
+		t.Errorf("expected masked secrets and the default base OID, got %+v", resp)
+	}
+
+	// Sending the masks back keeps the stored secrets.
+	body, _ := json.Marshal(resp)
+	if w := post(string(body)); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if cfg, _ := snmp.LoadAgentConfig(store); cfg.Community != "facilities" || cfg.Users[0].AuthPassword != "maplesyrup" {
+		t.Errorf("unexpected stored config %+v", cfg)
+	}
+
+	for _, body := range []string{
+		`{"enabled": true}`,
+		`{"enabled": true, "community": "facilities", "port": 70000}`,
+		`{"enabled": true, "users": [{"name": "nms", "auth_protocol": "md5", "auth_password": "maplesyrup"}]}`,
+	} {
+		if w := post(body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"nexsign.mini/nsm/internal/auth"
+)
+
+// @Title: Status Board Settings
+// @Route: GET|POST /api/settings/status-board
+// @Description: Get or update access to the read-only /status-board for wall displays without a session. With require_token the board needs the token in its URL; rotate_token issues a new one
+// @Response: {"enabled": true, "token": "...", "url": "/status-board?token=..."}
+func (s *Service) HandleStatusBoardSettings(w http.ResponseWriter, r *http.Request) {
+	var cfg auth.StatusBoardConfig
+	switch r.Method {
+	case http.MethodGet:
+		var err error
+		if cfg, err = s.auth.LoadStatusBoard(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	case http.MethodPost:
+		var req struct {
+			Enabled      bool `json:"enabled"`
+			RequireToken bool `json:"require_token"`
+			RotateToken  bool `json:"rotate_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		var err error
+		if cfg, err = s.auth.SaveStatusBoard(req.Enabled, req.RequireToken, req.RotateToken); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated status board access (enabled=%t, token=%t)", cfg.Enabled, cfg.Token != ""))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link := "/status-board"
+	if cfg.Token != "" {
+		link += "?token=" + url.QueryEscape(cfg.Token)
+	}
+	s.writeJSON(w, http.StatusOK, struct {
+		auth.StatusBoardConfig
+		URL string `json:"url"`
+	}{cfg, link})
+}
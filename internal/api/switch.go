@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/discovery"
+	"nexsign.mini/nsm/internal/snmp"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// @Title: Switch Settings
+// @Route: GET|POST /api/settings/switch
+// @Description: Get or update the SNMPv2c switch asked which port each display's MAC is on (address, community). An empty address turns port lookups off; the community is masked in responses and kept when sent back masked or empty
+// @Response: {"address": "192.168.1.2", "community": "********"}
+func (s *Service) HandleSwitchSettings(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := snmp.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	case http.MethodPost:
+		var cfg snmp.Config
+		if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		// Keep the stored community when the client echoes back the mask.
+		if cfg.Community == "" || cfg.Community == cfg.Masked().Community {
+			current, err := snmp.LoadConfig(s.store)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			cfg.Community = current.Community
+		}
+
+		cfg, err := snmp.SaveConfig(s.store, cfg)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated switch settings (address %q)", cfg.Address))
+		s.writeJSON(w, http.StatusOK, cfg.Masked())
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Locate Host
+// @Route: POST /api/hosts/locate?id=<host-id>
+// @Description: Read the host's MAC from this node's ARP table and, when a switch is configured, look up the port it is on. The ARP entry exists once this node has reached the host, e.g. after a scan or health check
+// @Response: {"id": "...", "mac_address": "b8:27:eb:01:02:03", "switch_port": "Gi1/0/14 on 192.168.1.2", ...}
+func (s *Service) HandleLocateHost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host, err := s.store.GetByID(r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	sw, err := snmp.LoadConfig(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := s.locateHost(host, sw); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, discovery.ErrNoMAC) || errors.Is(err, snmp.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		s.writeError(w, status, err.Error())
+		return
+	}
+	if err := s.store.Upsert(*host); err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, host)
+}
+
+// locateHost sets the MAC address of host from the ARP table and, when a
+// switch is configured, the port it was learned on. Fields it cannot
+// refresh keep their last value, so a display that is briefly off still
+// shows where it was plugged in.
+func (s *Service) locateHost(host *types.Host, sw snmp.Config) error {
+	ip, _ := s.store.Resolve(host.IPAddress)
+	mac, err := discovery.LookupMAC(ip)
+	if err != nil {
+		return err
+	}
+	if mac != host.MACAddress {
+		host.MACAddress = mac
+		host.SwitchPort = "" // Whatever was on the old port, it is not this
+	}
+	if !sw.Enabled() {
+		return nil
+	}
+	port, err := snmp.LocatePort(sw, mac)
+	if err != nil {
+		return fmt.Errorf("switch lookup for %s: %w", mac, err)
+	}
+	host.SwitchPort = port
+	return nil
+}
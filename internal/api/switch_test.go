@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/snmp"
+)
+
+func TestHandleSwitchSettings(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleSwitchSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/switch",
+		strings.NewReader(`{"address": "192.168.1.2", "community": "venue-ro"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp snmp.Config
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Community == "venue-ro" {
+		t.Error("expected the community to be masked")
+	}
+
+	// Sending the mask back keeps the stored community.
+	w = httptest.NewRecorder()
+	svc.HandleSwitchSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/switch",
+		strings.NewReader(`{"address": "192.168.1.3", "community": "`+resp.Community+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if cfg, _ := snmp.LoadConfig(store); cfg.Address != "192.168.1.3" || cfg.Community != "venue-ro" {
+		t.Errorf("unexpected stored config %+v", cfg)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleSwitchSettings(w, httptest.NewRequest(http.MethodPost, "/api/settings/switch",
+		strings.NewReader(`{"address": "not a switch"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid address, got %d", w.Code)
+	}
+}
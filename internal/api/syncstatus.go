@@ -0,0 +1,234 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/bandwidth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Peer sync states in /api/fleet/sync-status.
+const (
+	SyncInSync   = "in_sync"  // The peer reported the same list and nothing is queued for it
+	SyncPending  = "pending"  // Announcements are queued for the peer
+	SyncDiverged = "diverged" // The peer reported a different list
+	SyncUnknown  = "unknown"  // The peer has not reported its list; older versions do not
+)
+
+// PeerSync is the sync state of one peer.
+type PeerSync struct {
+	hosts.SyncRecord
+	Name        string             `json:"name"`
+	Address     string             `json:"address"`
+	Health      types.HealthStatus `json:"health,omitempty"`
+	Pending     int                `json:"pending"`                // Announcements queued for the peer
+	Bus         bool               `json:"bus"`                    // Requests to the peer go over an open bus connection
+	HostCount   int                `json:"host_count,omitempty"`   // Hosts in the peer's list at its last heartbeat
+	HostsDigest string             `json:"hosts_digest,omitempty"` // hosts.ListDigest of that list
+	ReportedAt  time.Time          `json:"reported_at,omitzero"`   // When the peer last reported its list
+	State       string             `json:"state"`
+	Divergence  string             `json:"divergence,omitempty"` // How the peer's list differs
+}
+
+// SyncStatus is this node's list and the sync state of each peer.
+type SyncStatus struct {
+	HostCount    int        `json:"host_count"`
+	HostsDigest  string     `json:"hosts_digest"`
+	Isolated     bool       `json:"isolated"`      // No peer was reachable at the last check
+	OfflineEdits int        `json:"offline_edits"` // Hosts edited while isolated, not yet replayed to peers
+	Peers        []PeerSync `json:"peers"`
+}
+
+// syncStatus compares the list each peer last reported with this node's.
+// Peers are the nodes that send heartbeats, and any host with queued
+// announcements.
+func (s *Service) syncStatus() (SyncStatus, error) {
+	local, err := s.anthias.GetMetadata()
+	if err != nil {
+		return SyncStatus{}, fmt.Errorf("failed to get local metadata: %w", err)
+	}
+	peers, err := s.store.ListPeers()
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	records, err := s.store.SyncRecords()
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	edits, err := s.store.OfflineEdits()
+	if err != nil {
+		return SyncStatus{}, err
+	}
+	pending := s.peerQueue.Peers()
+	connected := s.peerBus.Connected()
+	reported := make(map[string]hosts.Peer, len(peers))
+	for _, p := range peers {
+		reported[p.NodeID] = p
+	}
+
+	list := s.store.GetAll()
+	status := SyncStatus{
+		HostCount:    len(list),
+		HostsDigest:  hosts.ListDigest(list),
+		Isolated:     s.store.Isolated(),
+		OfflineEdits: len(edits),
+		Peers:        []PeerSync{},
+	}
+	for _, h := range list {
+		p, isPeer := reported[h.ID]
+		if h.ID == local.ID || (!isPeer && pending[h.ID] == 0) {
+			continue
+		}
+		ps := PeerSync{
+			SyncRecord:  records[h.ID],
+			Name:        h.Nickname,
+			Address:     hosts.SelectPath(h).Address,
+			Health:      h.Health,
+			Pending:     pending[h.ID],
+			HostCount:   p.HostCount,
+			HostsDigest: p.HostsDigest,
+		}
+		ps.HostID = h.ID
+		ps.Bus = slices.Contains(connected, net.JoinHostPort(ps.Address, peerbus.DefaultPort))
+		if ps.Name == "" {
+			ps.Name = h.Hostname
+		}
+		if p.HostsDigest != "" {
+			ps.ReportedAt = p.LastSeen
+		}
+		switch {
+		case p.HostsDigest != "" && p.HostsDigest != status.HostsDigest:
+			ps.State = SyncDiverged
+			if p.HostCount != status.HostCount {
+				ps.Divergence = fmt.Sprintf("peer has %d hosts, this node %d", p.HostCount, status.HostCount)
+			} else {
+				ps.Divergence = "same number of hosts, but they differ"
+			}
+		case ps.Pending > 0:
+			ps.State = SyncPending
+		case p.HostsDigest == "":
+			ps.State = SyncUnknown
+		default:
+			ps.State = SyncInSync
+		}
+		status.Peers = append(status.Peers, ps)
+	}
+	return status, nil
+}
+
+// @Title: Fleet Sync Status
+// @Route: GET /api/fleet/sync-status
+// @Description: Per peer, when host list updates last reached it and last came from it, how many announcements are queued for it, and whether the host list it last reported matches this node (state in_sync, pending, diverged or unknown). isolated is true while no peer is reachable, and offline_edits counts hosts edited meanwhile that are not yet replayed to peers. bus is true for peers connected over the peer bus
+// @Response: {"host_count": 12, "hosts_digest": "9f2c41d07a3be815", "isolated": false, "offline_edits": 0, "peers": [{"host_id": "...", "name": "Lobby", "address": "192.168.1.20", "health": "online", "last_push_at": "...", "last_received_at": "...", "pending": 0, "bus": true, "host_count": 11, "hosts_digest": "03d9a7c2e41f6b80", "reported_at": "...", "state": "diverged", "divergence": "peer has 11 hosts, this node 12"}]}
+func (s *Service) HandleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := s.syncStatus()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
+
+// SyncResult is the outcome of a full sync to one peer.
+type SyncResult struct {
+	HostID  string `json:"host_id"`
+	Address string `json:"address"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// @Title: Force Full Sync
+// @Route: POST /api/fleet/sync
+// @Description: Replace the host list of peers with this node's and wait for the result. Lists the host IDs in peers, or every peer in the sync status that is not in sync. Queued announcements for a peer that took the list are dropped
+// @Response: {"results": [{"host_id": "...", "address": "192.168.1.20", "ok": true}]}
+func (s *Service) HandleForceSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		Peers []string `json:"peers"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+	}
+
+	status, err := s.syncStatus()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var targets []PeerSync
+	for _, p := range status.Peers {
+		if len(req.Peers) > 0 && slices.Contains(req.Peers, p.HostID) || len(req.Peers) == 0 && p.State != SyncInSync {
+			targets = append(targets, p)
+		}
+	}
+	if len(req.Peers) > 0 && len(targets) != len(req.Peers) {
+		s.writeError(w, http.StatusNotFound, "Unknown peer; see /api/fleet/sync-status")
+		return
+	}
+
+	payload, err := json.Marshal(s.store.GetAll())
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	client := s.bandwidth.Client(bandwidth.OpSync, 5*time.Second)
+	results := make([]SyncResult, len(targets))
+	var wg sync.WaitGroup
+	for i, p := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = SyncResult{HostID: p.HostID, Address: p.Address, OK: true}
+			if err := s.pushHostList(client, p.Address, payload); err != nil {
+				results[i].OK, results[i].Error = false, err.Error()
+				return
+			}
+			s.peerQueue.Drop(p.HostID)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, res := range results {
+		if !res.OK {
+			failed++
+		}
+	}
+	auth.AnnotateAudit(r, "fleet", fmt.Sprintf("full sync to %d peers, %d failed", len(results), failed))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Full sync to %d peers, %d failed", len(results), failed))
+	s.writeJSON(w, http.StatusOK, map[string][]SyncResult{"results": results})
+}
+
+// hostAt returns the host in the list at addr, by LAN, VPN or resolved
+// address.
+func (s *Service) hostAt(addr string) (types.Host, bool) {
+	ip := addr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		ip = host
+	}
+	for _, h := range s.store.GetAll() {
+		if h.IPAddress == ip || h.VPNIPAddress == ip || h.ResolvedIP == ip || h.ResolvedVPNIP == ip {
+			return h, true
+		}
+	}
+	return types.Host{}, false
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleSyncStatus(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	for _, h := range []types.Host{
+		{ID: "test-id", IPAddress: "127.0.0.1"},
+		{ID: "a", Nickname: "Lobby", IPAddress: "192.168.1.20"},
+		{ID: "b", Nickname: "Gym", IPAddress: "192.168.1.21"},
+		{ID: "c", Nickname: "Cafe", IPAddress: "192.168.1.22"},
+		{ID: "d", Nickname: "Screen", IPAddress: "192.168.1.23"},
+	} {
+		if err := store.Add(h); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	now := time.Now()
+	digest := hosts.ListDigest(store.GetAll())
+	store.PutPeer(hosts.Peer{NodeID: "test-id", PublicKey: "k0", LastSeen: now})
+	store.PutPeer(hosts.Peer{NodeID: "a", PublicKey: "k1", LastSeen: now, HostCount: 5, HostsDigest: digest})
+	store.PutPeer(hosts.Peer{NodeID: "b", PublicKey: "k2", LastSeen: now, HostCount: 4, HostsDigest: "0123456789abcdef"})
+	svc.PeerQueue().Add("c", types.Host{ID: "a"}, "peer unreachable", now)
+	store.RecordPush("a", now, nil)
+	store.RecordReceive("a", now)
+
+	w := httptest.NewRecorder()
+	svc.HandleSyncStatus(w, httptest.NewRequest(http.MethodGet, "/api/fleet/sync-status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var status SyncStatus
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.HostCount != 5 || status.HostsDigest != digest || len(status.Peers) != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	states := make(map[string]PeerSync)
+	for _, p := range status.Peers {
+		states[p.HostID] = p
+	}
+	if a := states["a"]; a.State != SyncInSync || a.LastPushAt.IsZero() || a.LastReceivedAt.IsZero() {
+		t.Errorf("a: unexpected %+v", a)
+	}
+	if b := states["b"]; b.State != SyncDiverged || b.Divergence != "peer has 4 hosts, this node 5" {
+		t.Errorf("b: unexpected %+v", b)
+	}
+	if c := states["c"]; c.State != SyncPending || c.Pending != 1 {
+		t.Errorf("c: unexpected %+v", c)
+	}
+
+	// Changing the list makes every reported digest stale.
+	store.Add(types.Host{ID: "e", IPAddress: "192.168.1.24"})
+	w = httptest.NewRecorder()
+	svc.HandleSyncStatus(w, httptest.NewRequest(http.MethodGet, "/api/fleet/sync-status", nil))
+	json.NewDecoder(w.Body).Decode(&status)
+	for _, p := range status.Peers {
+		if p.HostID == "a" && p.State != SyncDiverged {
+			t.Errorf("expected a to diverge after a change, got %s", p.State)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleForceSync(w, httptest.NewRequest(http.MethodPost, "/api/fleet/sync", strings.NewReader(`{"peers": ["d"]}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a host that is not a peer, got %d", w.Code)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/tailscale"
+)
+
+// tailnetPeer is a tailnet node annotated with the host it was matched to.
+type tailnetPeer struct {
+	tailscale.Peer
+	HostID   string `json:"host_id,omitempty"`
+	HostIP   string `json:"host_ip,omitempty"`
+	Nickname string `json:"nickname,omitempty"`
+}
+
+// @Title: Tailscale Status
+// @Route: GET /api/tailscale/status
+// @Description: Returns the local tailscaled state and tailnet peers, each matched to a host by VPN IP or hostname
+// @Response: {"available": true, "backend_state": "Running", "self": {...}, "peers": [{"hostname": "...", "ips": ["100.x.y.z"], "online": true, "host_id": "..."}]}
+func (s *Service) HandleTailscaleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	st, err := s.tailscale.Status(ctx)
+	if errors.Is(err, tailscale.ErrUnavailable) {
+		s.writeJSON(w, http.StatusOK, map[string]any{"available": false})
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	all := s.store.GetAll()
+	match := func(p tailscale.Peer) tailnetPeer {
+		out := tailnetPeer{Peer: p}
+		for _, h := range all {
+			byIP := h.VPNIPAddress != "" && h.VPNIPAddress == p.IPv4()
+			if byIP || (h.VPNIPAddress == "" && isSamePeer(st, h.Hostname, p)) {
+				out.HostID, out.HostIP, out.Nickname = h.ID, h.IPAddress, h.Nickname
+				break
+			}
+		}
+		return out
+	}
+
+	peers := make([]tailnetPeer, 0, len(st.Peers))
+	for _, p := range st.Peers {
+		peers = append(peers, match(p))
+	}
+	s.writeJSON(w, http.StatusOK, map[string]any{
+		"available":     true,
+		"backend_state": st.BackendState,
+		"self":          match(st.Self),
+		"peers":         peers,
+	})
+}
+
+func isSamePeer(st *tailscale.Status, hostname string, p tailscale.Peer) bool {
+	found, ok := st.Find(hostname)
+	return ok && found.IPv4() == p.IPv4()
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+)
+
+// @Title: Fleet Topology
+// @Route: GET /api/fleet/topology
+// @Description: Which node reaches which over the LAN and VPN, and which network each node hears the others' heartbeats on. This node's links are current; other nodes' links are as of their last heartbeat (reported_at). findings lists likely reasons nodes are not syncing
+// @Response: {"nodes": [{"id": "...", "label": "Lobby", "ip_address": "192.168.1.20", "health": "online", "local": true}], "links": [{"from": "...", "to": "...", "lan": "healthy", "vpn": "unreachable", "heard": "lan"}], "findings": ["Bar reaches Lobby, but not the other way round"]}
+func (s *Service) HandleFleetTopology(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	local, err := s.anthias.GetMetadata()
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to get local metadata")
+		return
+	}
+	topo, err := s.store.Topology(local.ID)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, topo)
+}
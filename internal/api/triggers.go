@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/triggers"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// @Title: Webhook Triggers
+// @Route: GET|POST /api/settings/triggers
+// @Description: List inbound webhook triggers, or create or update one (name, description, action restore_preset|check_hosts|display_power, preset, hosts, power on|off). A new trigger gets a token, shown only once with its URL; updating a trigger keeps its token
+// @Response: {"name": "conference", "action": "restore_preset", "preset": "conference", "token_prefix": "nsmt_AbCdEf", "token": "nsmt_...", "url": "http://nsm.local:8080/api/triggers/conference", ...}
+func (s *Service) HandleTriggers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := triggers.List(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range list {
+			list[i] = list[i].Public()
+		}
+		s.writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var t triggers.Trigger
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if t.Action == triggers.ActionRestorePreset {
+			if _, err := s.store.GetSnapshot(t.Preset); err != nil {
+				s.writeSnapshotError(w, err)
+				return
+			}
+		}
+
+		t, token, err := triggers.Save(s.store, t, currentUsername(r))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		resp := struct {
+			triggers.Trigger
+			Token string `json:"token,omitempty"`
+			URL   string `json:"url"`
+		}{t.Public(), token, baseURL(r) + "/api/triggers/" + t.Name}
+
+		if token == "" {
+			auth.AnnotateAudit(r, t.Name, "updated trigger")
+			s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated trigger %q (%s)", t.Name, t.Action))
+			s.writeJSON(w, http.StatusOK, resp)
+			return
+		}
+		auth.AnnotateAudit(r, t.Name, fmt.Sprintf("created trigger (%s)", t.TokenPrefix))
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Created trigger %q (%s)", t.Name, t.Action))
+		s.writeJSON(w, http.StatusCreated, resp)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Delete Webhook Trigger
+// @Route: POST /api/settings/triggers/delete?name=...
+// @Description: Delete a trigger; its URL stops working at once
+// @Response: 204 No Content
+func (s *Service) HandleDeleteTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	err := triggers.Delete(s.store, name)
+	if errors.Is(err, triggers.ErrNotFound) {
+		s.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Deleted trigger %q", name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: Fire Webhook Trigger
+// @Route: POST /api/triggers/<name>
+// @Description: Run the action of a trigger, for Zapier, IFTTT, calendars and other services that call webhooks. Send the trigger token as "Authorization: Bearer nsmt_...", in an X-NSM-Token header, or as ?token=...; no session or API key is needed. The request body is ignored
+// @Response: {"trigger": "conference", "action": "restore_preset", "result": "restored preset conference (4 hosts)"}
+func (s *Service) HandleFireTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/triggers/")
+	token := r.Header.Get("X-NSM-Token")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+
+	principal := types.User{Username: name, Provider: auth.ProviderTrigger}
+	t, err := triggers.Authenticate(s.store, name, token)
+	if errors.Is(err, triggers.ErrNotFound) || errors.Is(err, triggers.ErrDenied) {
+		// The same answer for both, so names cannot be probed.
+		s.auth.Audit(r, types.User{}, "trigger.denied", name, "")
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Rejected trigger %q from %s", name, r.RemoteAddr))
+		s.writeError(w, http.StatusUnauthorized, "invalid trigger or token")
+		return
+	}
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result, err := s.runTrigger(t)
+	if err != nil {
+		result = "failed: " + err.Error()
+	}
+	triggers.RecordFired(s.store, t.Name, time.Now(), result)
+	s.auth.Audit(r, principal, "trigger.fire", t.Name, result)
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Trigger %q %s", t.Name, result))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, hosts.ErrSnapshotNotFound) {
+			status = http.StatusNotFound
+		}
+		s.writeError(w, status, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, map[string]string{
+		"trigger": t.Name,
+		"action":  t.Action,
+		"result":  result,
+	})
+}
+
+// runTrigger carries out t's action and describes what it did. Health
+// checks and display power run in the background.
+func (s *Service) runTrigger(t triggers.Trigger) (string, error) {
+	switch t.Action {
+	case triggers.ActionRestorePreset:
+		snap, err := s.store.RestoreSnapshot(t.Preset)
+		if err != nil {
+			return "", err
+		}
+		s.presetApplied(snap.Name, "trigger:"+t.Name)
+		return fmt.Sprintf("restored preset %s (%d hosts)", snap.Name, snap.HostCount), nil
+	case triggers.ActionCheckHosts:
+		targets, err := s.triggerHosts(t)
+		if err != nil {
+			return "", err
+		}
+		ids := make([]string, len(targets))
+		for i, h := range targets {
+			ids[i] = h.ID
+		}
+		go s.store.CheckHosts(ids)
+		return fmt.Sprintf("checking %d hosts", len(ids)), nil
+	case triggers.ActionDisplayPower:
+		targets, err := s.triggerHosts(t)
+		if err != nil {
+			return "", err
+		}
+		for _, h := range targets {
+			go s.triggerDisplayPower(h, t.Power)
+		}
+		return fmt.Sprintf("turning %d displays %s", len(targets), t.Power), nil
+	}
+	return "", fmt.Errorf("unknown action %q", t.Action)
+}
+
+// triggerHosts returns the hosts t names that still exist, or every host
+// when it names none.
+func (s *Service) triggerHosts(t triggers.Trigger) ([]types.Host, error) {
+	if len(t.Hosts) == 0 {
+		return s.store.GetAll(), nil
+	}
+	var out []types.Host
+	for _, id := range t.Hosts {
+		if h, err := s.store.GetByID(id); err == nil {
+			out = append(out, *h)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("none of the trigger's hosts exist any more")
+	}
+	return out, nil
+}
+
+func (s *Service) triggerDisplayPower(h types.Host, power string) {
+	if isLocalTarget(h.IPAddress) {
+		s.setDisplayPower(power)
+		return
+	}
+	resp, err := s.forwardDisplayPower(context.Background(), h.IPAddress, power)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("API: Display power %s for %s failed: %v", power, h.IPAddress, err))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		s.logger.Warning(fmt.Sprintf("API: Display power %s for %s returned status %d", power, h.IPAddress, resp.StatusCode))
+	}
+}
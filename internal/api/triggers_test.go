@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleTriggers(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "1", IPAddress: "192.168.1.1", Nickname: "Lobby"})
+	if _, err := store.SaveSnapshot("conference", ""); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	store.Add(types.Host{ID: "2", IPAddress: "192.168.1.2", Nickname: "Gym"})
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleTriggers(w, httptest.NewRequest(http.MethodPost, "/api/settings/triggers", strings.NewReader(body)))
+		return w
+	}
+	if w := create(`{"name": "lobby", "action": "restore_preset", "preset": "missing"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing preset, got %d", w.Code)
+	}
+	w := create(`{"name": "lobby", "action": "restore_preset", "preset": "conference"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Token     string `json:"token"`
+		URL       string `json:"url"`
+		TokenHash string `json:"token_hash"`
+	}
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.Token == "" || created.TokenHash != "" || !strings.HasSuffix(created.URL, "/api/triggers/lobby") {
+		t.Fatalf("unexpected response %+v", created)
+	}
+
+	fire := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		svc.HandleFireTrigger(w, req)
+		return w
+	}
+	for _, tt := range []struct{ path, token string }{
+		{"/api/triggers/lobby", ""},
+		{"/api/triggers/lobby", "nsmt_wrong"},
+		{"/api/triggers/other", created.Token},
+	} {
+		if w := fire(tt.path, tt.token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s with %q: expected 401, got %d", tt.path, tt.token, w.Code)
+		}
+	}
+
+	if w := fire("/api/triggers/lobby?token="+created.Token, ""); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if n := len(store.GetAll()); n != 1 {
+		t.Errorf("expected the preset's single host after firing, got %d", n)
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: "trigger.fire"})
+	if len(entries) != 1 || entries[0].ActorType != hosts.ActorTrigger || entries[0].Actor != "lobby" {
+		t.Errorf("expected the firing to be audited, got %+v", entries)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleTriggers(w, httptest.NewRequest(http.MethodGet, "/api/settings/triggers", nil))
+	if body := w.Body.String(); !strings.Contains(body, "restored preset conference") || strings.Contains(body, "token_hash") {
+		t.Errorf("expected the last result without the token hash, got %s", body)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// viewOwner returns the ID views are saved under for the request's user,
+// or "" in open mode.
+func viewOwner(ctx context.Context) string {
+	if u, ok := auth.UserFromContext(ctx); ok {
+		return u.ID
+	}
+	return ""
+}
+
+// @Title: Saved Views
+// @Route: GET|POST /api/views
+// @Description: List the saved host list views of the signed-in user, or save one (replacing the view of the same name). filter has query (nickname, hostname, IPs, notes), health (online|degraded|offline|starting|maintenance) and subnets (CIDRs); sort is name|ip|health
+// @Response: [{"name": "Building A, unhealthy", "filter": {"subnets": ["10.1.0.0/16"], "health": ["degraded", "offline"]}, "sort": "health", "updated_at": "..."}]
+func (s *Service) HandleViews(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		views, err := s.store.ListViews(viewOwner(r.Context()))
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, views)
+	case http.MethodPost:
+		var v hosts.View
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		v, err := s.store.SaveView(viewOwner(r.Context()), v)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		auth.AnnotateAudit(r, v.Name, "")
+		s.writeJSON(w, http.StatusOK, v)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Delete Saved View
+// @Route: POST /api/views/delete?name=...
+// @Description: Delete a saved view of the signed-in user
+// @Response: 204 No Content
+func (s *Service) HandleDeleteView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		s.writeError(w, http.StatusBadRequest, "Missing 'name' query parameter")
+		return
+	}
+	if err := s.store.DeleteView(viewOwner(r.Context()), name); err != nil {
+		if errors.Is(err, hosts.ErrViewNotFound) {
+			s.writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Title: View Hosts
+// @Route: GET /api/views/hosts?name=...
+// @Description: The hosts a saved view selects, in its order. Without name, the view is given by query, health and subnet (comma-separated), sort and desc=true
+// @Response: [{"id": "...", "nickname": "Lobby", "ip_address": "10.1.0.20", "health": "offline"}]
+func (s *Service) HandleViewHosts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v, status, err := s.viewFromRequest(r)
+	if err != nil {
+		s.writeError(w, status, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, v.Apply(s.store.GetAll()))
+}
+
+// viewFromRequest reads the view named by the name query parameter, or
+// builds an unsaved one from the other parameters.
+func (s *Service) viewFromRequest(r *http.Request) (hosts.View, int, error) {
+	q := r.URL.Query()
+	if name := q.Get("name"); name != "" {
+		return s.savedView(r, name)
+	}
+
+	v := hosts.View{
+		Name:   "unsaved",
+		Filter: hosts.ViewFilter{Query: q.Get("query"), Subnets: splitList(q.Get("subnet"))},
+		Sort:   q.Get("sort"),
+		Desc:   q.Get("desc") == "true",
+	}
+	for _, h := range splitList(q.Get("health")) {
+		v.Filter.Health = append(v.Filter.Health, types.HealthStatus(h))
+	}
+	if err := v.Validate(); err != nil {
+		return hosts.View{}, http.StatusBadRequest, err
+	}
+	return v, http.StatusOK, nil
+}
+
+// savedView returns the user's saved view name, with the HTTP status to
+// report if there is none.
+func (s *Service) savedView(r *http.Request, name string) (hosts.View, int, error) {
+	v, err := s.store.GetView(viewOwner(r.Context()), name)
+	switch {
+	case errors.Is(err, hosts.ErrViewNotFound):
+		return hosts.View{}, http.StatusNotFound, fmt.Errorf("no saved view %q", name)
+	case err != nil:
+		return hosts.View{}, http.StatusInternalServerError, err
+	}
+	return v, http.StatusOK, nil
+}
+
+// viewTargets returns the IDs of the hosts in the user's saved view name,
+// for fleet actions that accept a view as their target.
+func (s *Service) viewTargets(r *http.Request, name string) ([]string, int, error) {
+	v, status, err := s.savedView(r, name)
+	if err != nil {
+		return nil, status, err
+	}
+	ids := []string{}
+	for _, h := range v.Apply(s.store.GetAll()) {
+		ids = append(ids, h.ID)
+	}
+	return ids, http.StatusOK, nil
+}
+
+// filterHosts returns the hosts matching query and health or, with view,
+// those the user's saved view selects, for APIs that take the filters as
+// arguments rather than query parameters.
+func (s *Service) filterHosts(ctx context.Context, query, health, view string) ([]types.Host, error) {
+	v := hosts.View{Name: "unsaved", Filter: hosts.ViewFilter{Query: query}}
+	if view != "" {
+		var err error
+		if v, err = s.store.GetView(viewOwner(ctx), view); err != nil {
+			return nil, fmt.Errorf("no saved view %q: %w", view, err)
+		}
+	}
+	if health != "" {
+		v.Filter.Health = []types.HealthStatus{types.HealthStatus(health)}
+	}
+	if err := v.Validate(); err != nil {
+		return nil, err
+	}
+	return v.Apply(s.store.GetAll()), nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleViews(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	store.Add(types.Host{ID: "lobby", Nickname: "Lobby", IPAddress: "10.1.0.20"})
+	store.Add(types.Host{ID: "gym", Nickname: "Gym", IPAddress: "10.2.0.5"})
+
+	alice := func(r *http.Request) *http.Request {
+		return r.WithContext(auth.WithUser(r.Context(), types.User{ID: "alice", Username: "alice", Role: types.RoleViewer}))
+	}
+
+	w := httptest.NewRecorder()
+	svc.HandleViews(w, alice(httptest.NewRequest(http.MethodPost, "/api/views",
+		strings.NewReader(`{"name": "Building A", "filter": {"subnets": ["10.1.0.0/16"]}}`))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleViews(w, alice(httptest.NewRequest(http.MethodPost, "/api/views", strings.NewReader(`{"name": "Bad", "sort": "uptime"}`))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown sort, got %d", w.Code)
+	}
+
+	viewHosts := func(r *http.Request) []types.Host {
+		t.Helper()
+		w := httptest.NewRecorder()
+		svc.HandleViewHosts(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var hosts []types.Host
+		json.NewDecoder(w.Body).Decode(&hosts)
+		return hosts
+	}
+	if got := viewHosts(alice(httptest.NewRequest(http.MethodGet, "/api/views/hosts?name=Building+A", nil))); len(got) != 1 || got[0].ID != "lobby" {
+		t.Errorf("expected the lobby only, got %+v", got)
+	}
+	if got := viewHosts(httptest.NewRequest(http.MethodGet, "/api/views/hosts?query=gym", nil)); len(got) != 1 || got[0].ID != "gym" {
+		t.Errorf("expected an unsaved view to match the gym, got %+v", got)
+	}
+
+	// Views belong to their user, in open mode too.
+	w = httptest.NewRecorder()
+	svc.HandleViews(w, httptest.NewRequest(http.MethodGet, "/api/views", nil))
+	if strings.TrimSpace(w.Body.String()) != "[]" {
+		t.Errorf("expected no views in open mode, got %s", w.Body.String())
+	}
+
+	// A view is a target for fleet actions.
+	ids, _, err := svc.viewTargets(alice(httptest.NewRequest(http.MethodPost, "/api/hosts/check?view=Building+A", nil)), "Building A")
+	if err != nil || len(ids) != 1 || ids[0] != "lobby" {
+		t.Errorf("expected the lobby as the target, got %v (%v)", ids, err)
+	}
+	w = httptest.NewRecorder()
+	svc.HandleCheckHosts(w, httptest.NewRequest(http.MethodPost, "/api/hosts/check?view=Building+A", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another user's view, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleDeleteView(w, alice(httptest.NewRequest(http.MethodPost, "/api/views/delete?name=Building+A", nil)))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", w.Code)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/watchdog"
+)
+
+// SetWatchdog sets the Anthias watchdog whose state the watchdog endpoint
+// reports. Without it the watchdog is reported off.
+func (s *Service) SetWatchdog(w *watchdog.Watchdog) {
+	s.watchdog = w
+}
+
+// watchdogState returns the watchdog settings, what it last found, and
+// its recent restarts and viewer crash loops.
+func (s *Service) watchdogState(cfg watchdog.Config) map[string]any {
+	status := watchdog.Status{State: watchdog.StateOff}
+	if s.watchdog != nil {
+		status = s.watchdog.Status()
+	}
+	restarts, _ := s.store.ListAudit(hosts.AuditQuery{Action: watchdog.AuditRestarted, Limit: 20})
+	loops, _ := s.store.ListAudit(hosts.AuditQuery{Action: watchdog.AuditViewerCrashLoop, Limit: 20})
+	return map[string]any{"config": cfg, "status": status, "restarts": restarts, "crash_loops": loops}
+}
+
+// @Title: Anthias Watchdog
+// @Route: GET|POST /api/watchdog
+// @Description: Get or replace the settings of this node's Anthias watchdog: {"enabled": true, "check_url": "...", "failures": 3, "command": "...", "cooldown_minutes": 15, "max_restarts": 3, "viewer": "anthias-viewer", "crash_loop_restarts": 3, "crash_loop_minutes": 10, "fallback_image": "...", "fallback_command": "...", "display": ":0"}. Once the node has been up for five minutes, the watchdog checks check_url every minute and runs command after failures failed checks in a row, at most max_restarts times until the CMS answers again. It also counts restarts of the viewer container, or of the built-in player's browser while it runs, and reports a crash loop with the viewer's last output once crash_loop_restarts fall within crash_loop_minutes, showing fallback_image if set. The answer includes what it last found and its recent restarts and crash loops from the audit log
+// @Response: {"config": {"enabled": true, "check_url": "http://127.0.0.1/api/v2/info", "failures": 3, "command": "docker compose -f /home/pi/screenly/docker-compose.yml restart", "cooldown_minutes": 15, "max_restarts": 3}, "status": {"state": "ok", "failures": 0, "restarts": 0, "last_check": "...", "viewer": {"state": "crash_loop", "process": "anthias-viewer", "restarts": 4, "window_minutes": 10, "since": "...", "logs": "...", "fallback": true}}, "restarts": [{"time": "...", "action": "host.anthias_restarted", "target": "...", "detail": "CMS down for 3 checks (...); ran docker compose -f /home/pi/screenly/docker-compose.yml restart"}], "crash_loops": [...]}
+func (s *Service) HandleWatchdog(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, err := watchdog.LoadConfig(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, s.watchdogState(cfg))
+	case http.MethodPost:
+		var req watchdog.Config
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		cfg, err := watchdog.SaveConfig(s.store, req)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		state := "off"
+		if cfg.Enabled {
+			state = fmt.Sprintf("on, restart after %d failed checks", cfg.Failures)
+		}
+		auth.AnnotateAudit(r, "watchdog", state)
+		s.logger.InfoContext(r.Context(), "API: Watchdog settings saved ("+state+")")
+		s.writeJSON(w, http.StatusOK, s.watchdogState(cfg))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
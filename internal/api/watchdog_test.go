@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleWatchdog(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		svc.HandleWatchdog(w, httptest.NewRequest(http.MethodPost, "/api/watchdog", strings.NewReader(body)))
+		return w
+	}
+
+	if w := post(`{"enabled": true, "check_url": "127.0.0.1/api/v2/info"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a check URL without a scheme, got %d", w.Code)
+	}
+	w := post(`{"enabled": true, "failures": 5}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"failures":5`) || !strings.Contains(w.Body.String(), "docker compose -f /home/pi/screenly/docker-compose.yml restart") {
+		t.Fatalf("expected the saved settings with defaults, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Without a running watchdog it is reported off.
+	w = httptest.NewRecorder()
+	svc.HandleWatchdog(w, httptest.NewRequest(http.MethodGet, "/api/watchdog", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"state":"off"`) || !strings.Contains(w.Body.String(), `"enabled":true`) {
+		t.Errorf("expected the settings and an off watchdog, got %d: %s", w.Code, w.Body.String())
+	}
+}
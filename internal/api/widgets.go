@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/widgets"
+)
+
+// defaultWidgetDuration is how long a published widget stays on screen in
+// the Anthias rotation, in seconds.
+const defaultWidgetDuration = 30
+
+// @Title: Widgets
+// @Route: GET|POST /api/widgets
+// @Description: Get or replace the signage widgets NSM renders (kind text|rss|weather|clock|menu); each is served at /widgets/<id>
+// @Response: [{"id": "...", "name": "Lobby news", "kind": "rss", "feed_url": "https://...", "max_items": 10, "refresh_minutes": 10}]
+func (s *Service) HandleWidgets(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := widgets.Load(s.store)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		var list []widgets.Widget
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			s.writeError(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+		if list == nil {
+			list = []widgets.Widget{}
+		}
+
+		list, err := widgets.Save(s.store, list)
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated widgets (%d widgets)", len(list)))
+		s.writeJSON(w, http.StatusOK, list)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// @Title: Widget Page
+// @Route: GET /widgets/<id>
+// @Description: Render a widget as a full-screen HTML page for use as an Anthias web asset
+// @Response: text/html
+func (s *Service) HandleWidgetPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/widgets/")
+	widget, ok, err := widgets.Get(s.store, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := s.widgets.Render(&page, widget, time.Now()); err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Widget %s (%s): %v", widget.Name, widget.ID, err))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.Copy(w, &page)
+}
+
+// @Title: Publish Widget
+// @Route: POST /api/widgets/publish?id=...&host=...
+// @Description: Add a widget to a host's Anthias playlist as a web asset; body {"duration": 30, "base_url": "http://<nsm-ip>:8080"} is optional
+// @Response: {"asset_id": "...", "name": "...", "uri": "http://<nsm-ip>:8080/widgets/<id>", "mimetype": "webpage", "duration": 30}
+func (s *Service) HandleWidgetPublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	widget, ok, err := widgets.Get(s.store, r.URL.Query().Get("id"))
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "Widget not found")
+		return
+	}
+	host, err := s.store.GetByID(r.URL.Query().Get("host"))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Host not found")
+		return
+	}
+	if !s.requireAnthias(w, *host) {
+		return
+	}
+
+	var req struct {
+		Duration int    `json:"duration"`
+		BaseURL  string `json:"base_url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Duration == 0 {
+		req.Duration = defaultWidgetDuration
+	}
+	if req.Duration < 1 {
+		s.writeError(w, http.StatusBadRequest, "duration must be positive")
+		return
+	}
+	if req.BaseURL == "" {
+		self, err := s.anthias.GetMetadata()
+		if err != nil || self.IPAddress == "" {
+			s.writeError(w, http.StatusBadRequest, "Cannot tell this node's address; set base_url")
+			return
+		}
+		req.BaseURL = fmt.Sprintf("http://%s:8080", self.IPAddress)
+	}
+	if !strings.HasPrefix(req.BaseURL, "http://") && !strings.HasPrefix(req.BaseURL, "https://") {
+		s.writeError(w, http.StatusBadRequest, "base_url must be an http or https URL")
+		return
+	}
+
+	asset := playlist.Asset{
+		Name:     widget.Name,
+		URI:      strings.TrimSuffix(req.BaseURL, "/") + "/widgets/" + widget.ID,
+		MimeType: "webpage",
+		Duration: playlist.Seconds(req.Duration),
+	}
+	path := hosts.SelectPath(*host)
+	user, pass, _ := s.anthiasBasicAuth(host.IPAddress)
+	created, err := playlist.Create(&http.Client{Timeout: 10 * time.Second}, path.Address, asset, user, pass)
+	if err != nil {
+		s.writeError(w, http.StatusBadGateway, fmt.Sprintf("Could not add widget to %s: %v", path.Address, err))
+		return
+	}
+	if err := s.store.AddToAssetBaseline(host.ID, created, time.Now()); err != nil {
+		s.logger.WarningContext(r.Context(), fmt.Sprintf("API: Failed to add widget %s to the asset baseline of %s: %v", widget.Name, host.IPAddress, err))
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Published widget %s to %s", widget.Name, host.IPAddress))
+	s.writeJSON(w, http.StatusOK, created)
+}
+
+// @Title: Upload Menu CSV
+// @Route: POST /api/widgets/csv?id=...
+// @Description: Replace a menu widget's items with an uploaded CSV (multipart field "file", or the raw body); screens pick it up on their next reload
+// @Response: {"id": "...", "kind": "menu", "csv": "section,name,price\n...", "theme": "classic"}
+func (s *Service) HandleWidgetCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, widgets.MaxCSVLength+(64<<10))
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, "Missing 'file' field")
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read upload")
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	list, err := widgets.Load(s.store)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	i := -1
+	for j := range list {
+		if list[j].ID == id {
+			i = j
+		}
+	}
+	if i < 0 {
+		s.writeError(w, http.StatusNotFound, "Widget not found")
+		return
+	}
+	if list[i].Kind != widgets.KindMenu {
+		s.writeError(w, http.StatusBadRequest, "Only menu widgets take a CSV")
+		return
+	}
+
+	list[i].CSV = string(data)
+	list, err = widgets.Save(s.store, list)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated menu %s from upload (%d bytes)", list[i].Name, len(data)))
+	s.writeJSON(w, http.StatusOK, list[i])
+}
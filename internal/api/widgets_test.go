@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHandleWidgets(t *testing.T) {
+	svc, store, cleanup := setupTest(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	svc.HandleWidgets(w, httptest.NewRequest(http.MethodPost, "/api/widgets", bytes.NewBufferString(`[{"kind":"weather"}]`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a widget without a location, got %d", w.Code)
+	}
+
+	body := `[{"id":"welcome","kind":"text","title":"Welcome <guests>","text":"Doors open at 9"}]`
+	w = httptest.NewRecorder()
+	svc.HandleWidgets(w, httptest.NewRequest(http.MethodPost, "/api/widgets", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleWidgetPage(w, httptest.NewRequest(http.MethodGet, "/widgets/welcome", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Welcome &lt;guests&gt;") {
+		t.Errorf("Expected rendered page, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	svc.HandleWidgetPage(w, httptest.NewRequest(http.MethodGet, "/widgets/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown widget, got %d", w.Code)
+	}
+
+	// A fake Anthias device records the asset it is given.
+	var created map[string]any
+	device := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1.2/assets" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&created)
+		created["asset_id"] = "abc123"
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(created)
+	}))
+	defer device.Close()
+
+	store.Add(types.Host{Nickname: "Lobby", IPAddress: device.Listener.Addr().String()})
+	host, err := store.GetByIP(device.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("GetByIP: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleWidgetPublish(w, httptest.NewRequest(http.MethodPost, "/api/widgets/publish?id=welcome&host="+host.ID, bytes.NewBufferString(`{"duration":15}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if created["uri"] != "http://127.0.0.1:8080/widgets/welcome" || created["mimetype"] != "webpage" || created["duration"] != float64(15) {
+		t.Errorf("Unexpected asset sent to Anthias: %v", created)
+	}
+	if !strings.Contains(w.Body.String(), `"asset_id":"abc123"`) {
+		t.Errorf("Expected created asset in response, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleWidgetPublish(w, httptest.NewRequest(http.MethodPost, "/api/widgets/publish?id=welcome&host=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown host, got %d", w.Code)
+	}
+}
+
+func TestHandleWidgetCSV(t *testing.T) {
+	svc, _, cleanup := setupTest(t)
+	defer cleanup()
+
+	body := `[{"id":"menu","kind":"menu","csv":"name,price\nTea,2"},{"id":"clock","kind":"clock"}]`
+	w := httptest.NewRecorder()
+	svc.HandleWidgets(w, httptest.NewRequest(http.MethodPost, "/api/widgets", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	svc.HandleWidgetCSV(w, httptest.NewRequest(http.MethodPost, "/api/widgets/csv?id=menu", bytes.NewBufferString("name,price\nFlat white,3.2\n")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	svc.HandleWidgetPage(w, httptest.NewRequest(http.MethodGet, "/widgets/menu", nil))
+	if !strings.Contains(w.Body.String(), "Flat white") || strings.Contains(w.Body.String(), "Tea") {
+		t.Errorf("Expected page to show the uploaded menu, got %s", w.Body.String())
+	}
+
+	tests := []struct {
+		name, id, csv string
+		want          int
+	}{
+		{"no name column", "menu", "price\n3\n", http.StatusBadRequest},
+		{"not a menu", "clock", "name\nTea\n", http.StatusBadRequest},
+		{"unknown widget", "missing", "name\nTea\n", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		w = httptest.NewRecorder()
+		svc.HandleWidgetCSV(w, httptest.NewRequest(http.MethodPost, "/api/widgets/csv?id="+tt.id, bytes.NewBufferString(tt.csv)))
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
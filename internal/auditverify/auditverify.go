@@ -0,0 +1,50 @@
+// Package auditverify checks an audit bundle exported from
+// /api/audit/export without needing access to the node that produced it.
+//
+//	nsm audit verify nsm-audit-2026-10-16.json
+package auditverify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// Main verifies the bundle named by args and returns the exit code: 0 when
+// it verifies, 1 when it does not and 2 when it cannot be read.
+func Main(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: nsm audit verify <bundle.json>")
+		return 2
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read bundle: %v\n", err)
+		return 2
+	}
+
+	var bundle hosts.AuditBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fmt.Fprintf(os.Stderr, "decode bundle: %v\n", err)
+		return 2
+	}
+
+	result, err := bundle.Verify()
+	fmt.Printf("Node:        %s\n", bundle.NodeID)
+	fmt.Printf("Key:         %s\n", bundle.Fingerprint)
+	fmt.Printf("Exported at: %s\n", bundle.ExportedAt.Format("2006-01-02 15:04:05 MST"))
+	if err != nil {
+		fmt.Printf("INVALID: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("OK: %d entries (IDs %d-%d) verified", result.Entries, result.FirstID, result.LastID)
+	if result.Unsigned > 0 {
+		fmt.Printf(", %d recorded before signing was enabled", result.Unsigned)
+	}
+	fmt.Println()
+	return 0
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+)
+
+// ApprovalSettingKey is the settings key for the two-person rule.
+const ApprovalSettingKey = "approvals"
+
+// Actions the two-person rule can cover.
+const (
+	ApprovalReboot  = "reboot"  // POST /api/hosts/reboot
+	ApprovalImport  = "import"  // Replacing the host list from an upload or the latest backup
+	ApprovalRestore = "restore" // Restoring a backup file or a snapshot
+)
+
+// ApprovalActions lists the actions in the order the settings show them.
+var ApprovalActions = []string{ApprovalReboot, ApprovalImport, ApprovalRestore}
+
+// DefaultApprovalWindow is how long a held request waits for its approval,
+// in minutes, when the settings do not say.
+const DefaultApprovalWindow = 15
+
+// ApprovalConfig selects the destructive actions that one user requests
+// and a second must approve before they run.
+type ApprovalConfig struct {
+	Actions       []string `json:"actions"`
+	WindowMinutes int      `json:"window_minutes,omitempty"`
+}
+
+// Validate rejects unknown actions and windows outside 1 minute to a day.
+func (c *ApprovalConfig) Validate() error {
+	for _, action := range c.Actions {
+		if !slices.Contains(ApprovalActions, action) {
+			return fmt.Errorf("unknown action %q (want %v)", action, ApprovalActions)
+		}
+	}
+	if c.WindowMinutes == 0 {
+		c.WindowMinutes = DefaultApprovalWindow
+	}
+	if c.WindowMinutes < 1 || c.WindowMinutes > 24*60 {
+		return fmt.Errorf("window_minutes must be between 1 and 1440")
+	}
+	return nil
+}
+
+// Requires reports whether action needs a second user's approval.
+func (c ApprovalConfig) Requires(action string) bool {
+	return slices.Contains(c.Actions, action)
+}
+
+// LoadApprovals reads the two-person rule settings. None are required
+// until an admin picks some.
+func (a *Service) LoadApprovals() (ApprovalConfig, error) {
+	cfg := ApprovalConfig{Actions: []string{}, WindowMinutes: DefaultApprovalWindow}
+	if _, err := a.store.GetSetting(ApprovalSettingKey, &cfg); err != nil {
+		return ApprovalConfig{}, err
+	}
+	return cfg, nil
+}
+
+// SaveApprovals stores the two-person rule settings.
+func (a *Service) SaveApprovals(cfg ApprovalConfig) (ApprovalConfig, error) {
+	if err := cfg.Validate(); err != nil {
+		return ApprovalConfig{}, err
+	}
+	if cfg.Actions == nil {
+		cfg.Actions = []string{}
+	}
+	if err := a.store.PutSetting(ApprovalSettingKey, cfg); err != nil {
+		return ApprovalConfig{}, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// auditNote lets a handler describe the request the middleware is about to
+// record, e.g. which host was rebooted or which key was created.
+type auditNote struct {
+	target string
+	detail string
+}
+
+type auditNoteKey struct{}
+
+// AnnotateAudit sets the target and detail of the audit entry recorded for
+// this request. It is a no-op for requests that are not audited.
+func AnnotateAudit(r *http.Request, target, detail string) {
+	if note, ok := r.Context().Value(auditNoteKey{}).(*auditNote); ok {
+		note.target = target
+		note.detail = detail
+	}
+}
+
+func withAuditNote(ctx context.Context) (context.Context, *auditNote) {
+	note := &auditNote{}
+	return context.WithValue(ctx, auditNoteKey{}, note), note
+}
+
+// ProviderTrigger marks the principal of an inbound webhook trigger, whose
+// username is the trigger's name.
+const ProviderTrigger = "trigger"
+
+// Audit appends an entry attributed to u, or to an anonymous caller when u
+// is the zero User (open mode or failed logins).
+func (a *Service) Audit(r *http.Request, u types.User, action, target, detail string) {
+	entry := hosts.AuditEntry{
+		Actor:      u.Username,
+		ActorType:  hosts.ActorUser,
+		Action:     action,
+		Target:     target,
+		Detail:     detail,
+		RemoteAddr: remoteIP(r),
+	}
+	switch {
+	case u.Provider == ProviderAPIKey:
+		entry.ActorType = hosts.ActorAPIKey
+	case u.Provider == ProviderTrigger:
+		entry.ActorType = hosts.ActorTrigger
+	case u.Provider == ProviderPeer:
+		entry.ActorType = hosts.ActorPeer
+	case u.Username == "":
+		entry.Actor = "anonymous"
+		entry.ActorType = hosts.ActorAnonymous
+	}
+
+	if err := a.store.AppendAudit(entry); err != nil {
+		a.logger.Error(fmt.Sprintf("Auth: failed to write audit entry: %v", err))
+	}
+}
+
+// statusRecorder captures the response status for the audit entry. Only
+// state-changing requests are wrapped, so SSE streams and websocket upgrades
+// see the original writer.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
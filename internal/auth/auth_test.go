@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newTestService(t *testing.T) (*Service, *hosts.Store) {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return NewService(store, logger.New(50)), store
+}
+
+func TestPasswordHashing(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !VerifyPassword(hash, "correct horse") {
+		t.Errorf("expected password to verify")
+	}
+	if VerifyPassword(hash, "wrong horse") {
+		t.Errorf("expected wrong password to fail")
+	}
+	if _, err := HashPassword("short"); err != ErrWeakPassword {
+		t.Errorf("expected ErrWeakPassword, got %v", err)
+	}
+}
+
+func TestMiddlewareRoles(t *testing.T) {
+	svc, _ := newTestService(t)
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Open mode: no users yet.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/hosts/add", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected open access without users, got %d", w.Code)
+	}
+
+	if _, err := svc.Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	if _, err := svc.CreateUser("viewer", "", "viewer-password", types.RoleViewer); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without session, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/hosts/announce", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected peer endpoint to stay public, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/triggers/lobby", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected triggers to check their own tokens, got %d", w.Code)
+	}
+
+	token, _, err := svc.Login("viewer", "viewer-password")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/hosts", http.StatusOK},
+		{http.MethodPost, "/api/hosts/add", http.StatusForbidden},
+		{http.MethodGet, "/api/users", http.StatusForbidden},
+		{http.MethodPost, "/api/auth/me", http.StatusOK},
+		{http.MethodPost, "/api/graphql", http.StatusOK},
+		{http.MethodPost, "/nsm.v1.NSM/ListHosts", http.StatusOK},
+		{http.MethodPost, "/nsm.v1.NSM/RestorePreset", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+		req.Header.Set(CSRFHeader, CSRFToken(token))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as viewer: expected %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestMiddlewarePeers(t *testing.T) {
+	svc, store := newTestService(t)
+	var gotPeer string
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPeer = ""
+		if p, ok := PeerFromContext(r.Context()); ok {
+			gotPeer = p.NodeID
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	if _, err := svc.Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+
+	id, _ := identity.Generate()
+	signer := peerauth.NewSigner(id, func() string { return "node-a" })
+	post := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		signer.Sign(req, []byte(`{}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Public endpoints check their senders themselves, so a node whose key
+	// is not pinned yet still gets its first heartbeat through.
+	if code := post("/api/heartbeat"); code != http.StatusOK || gotPeer != "" {
+		t.Errorf("expected an unpinned sender passed to a public endpoint as unknown, got %d, %q", code, gotPeer)
+	}
+	if code := post("/api/hosts/lock"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 from an unpinned sender, got %d", code)
+	}
+
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey())})
+	if code := post("/api/hosts/lock"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 from a pinned key no admin has confirmed, got %d", code)
+	}
+	if _, err := store.TrustPeer("node-a", identity.Fingerprint(id.PublicKey()), "admin", time.Now()); err != nil {
+		t.Fatalf("TrustPeer: %v", err)
+	}
+	if code := post("/api/hosts/lock"); code != http.StatusOK || gotPeer != "node-a" {
+		t.Errorf("expected the peer admitted, got %d, %q", code, gotPeer)
+	}
+	if code := post("/api/hosts/receive"); code != http.StatusOK || gotPeer != "node-a" {
+		t.Errorf("expected the peer named to a public endpoint, got %d, %q", code, gotPeer)
+	}
+	if code := post("/api/settings/approvals"); code != http.StatusForbidden {
+		t.Errorf("expected peers kept out of settings, got %d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/hosts/lock", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected edit locks to need a session, got %d", w.Code)
+	}
+}
+
+func TestMiddlewareCSRF(t *testing.T) {
+	svc, _ := newTestService(t)
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if _, err := svc.Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	token, _, err := svc.Login("admin", "admin-password")
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// A page load hands the browser its CSRF token.
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var csrf string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CSRFCookie {
+			csrf = c.Value
+		}
+	}
+	if csrf != CSRFToken(token) {
+		t.Fatalf("expected CSRF cookie to be set, got %q", csrf)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		origin string
+		want   int
+	}{
+		{"valid token", csrf, "", http.StatusOK},
+		{"same origin", csrf, "http://example.com", http.StatusOK},
+		{"missing token", "", "", http.StatusForbidden},
+		{"wrong token", "forged", "", http.StatusForbidden},
+		{"cross origin", csrf, "http://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/hosts/reboot", nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+		if tt.header != "" {
+			req.Header.Set(CSRFHeader, tt.header)
+		}
+		if tt.origin != "" {
+			req.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+
+	// Bearer tokens are not sent automatically by browsers, so they need
+	// no CSRF token.
+	req = httptest.NewRequest(http.MethodPost, "/api/hosts/reboot", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected bearer request without CSRF token to pass, got %d", w.Code)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	svc, _ := newTestService(t)
+	handler := svc.SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := w.Header().Get("Content-Security-Policy"); got != DefaultCSP {
+		t.Errorf("expected default CSP, got %q", got)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected nosniff header")
+	}
+
+	if err := svc.SaveSecurity(SecurityConfig{ContentSecurityPolicy: "default-src 'self'", CSPReportOnly: true}); err != nil {
+		t.Fatalf("SaveSecurity: %v", err)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Header().Get("Content-Security-Policy") != "" || w.Header().Get("Content-Security-Policy-Report-Only") != "default-src 'self'" {
+		t.Errorf("expected custom report-only policy, got %v", w.Header())
+	}
+
+	if err := svc.SaveSecurity(SecurityConfig{ContentSecurityPolicy: "default-src 'self'\r\nX-Injected: 1"}); err == nil {
+		t.Errorf("expected multi-line policy to be rejected")
+	}
+}
+
+func TestStatusBoardAccess(t *testing.T) {
+	svc, _ := newTestService(t)
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	if _, err := svc.Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	if code := get("/status-board"); code != http.StatusSeeOther {
+		t.Errorf("expected a redirect to login while the board is off, got %d", code)
+	}
+
+	cfg, err := svc.SaveStatusBoard(true, true, false)
+	if err != nil || cfg.Token == "" {
+		t.Fatalf("SaveStatusBoard: %+v, %v", cfg, err)
+	}
+	if code := get("/status-board/stream?token=" + cfg.Token); code != http.StatusOK {
+		t.Errorf("expected the token to open the board, got %d", code)
+	}
+	if code := get("/status-board/stream?token=wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong token to be refused, got %d", code)
+	}
+	if code := get("/api/hosts?token=" + cfg.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected the token to open the board only, got %d", code)
+	}
+
+	kept, _ := svc.SaveStatusBoard(true, true, false)
+	rotated, _ := svc.SaveStatusBoard(true, true, true)
+	if kept.Token != cfg.Token || rotated.Token == cfg.Token {
+		t.Errorf("expected the token to change only when rotated")
+	}
+
+	if _, err := svc.SaveStatusBoard(true, false, false); err != nil {
+		t.Fatalf("SaveStatusBoard: %v", err)
+	}
+	if code := get("/status-board"); code != http.StatusOK {
+		t.Errorf("expected a public board without a token, got %d", code)
+	}
+}
+
+func TestInviteAndReset(t *testing.T) {
+	svc, store := newTestService(t)
+
+	token, _, err := svc.CreateInvite("ops@example.com", types.RoleOperator, "admin")
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	u, err := svc.AcceptInvite(token, "ops", "operator-password")
+	if err != nil {
+		t.Fatalf("AcceptInvite: %v", err)
+	}
+	if u.Role != types.RoleOperator || u.Email != "ops@example.com" {
+		t.Fatalf("unexpected invited user: %+v", u)
+	}
+	if _, err := svc.AcceptInvite(token, "ops2", "operator-password"); err == nil {
+		t.Fatalf("expected invite to be single use")
+	}
+
+	reset, _, err := svc.CreateReset(u.ID, "admin")
+	if err != nil {
+		t.Fatalf("CreateReset: %v", err)
+	}
+	if err := svc.ResetPassword(reset, "new-operator-password"); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, _, err := svc.Login("ops", "new-operator-password"); err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+
+	// Replicated records only win when newer.
+	stale := u
+	stale.Role = types.RoleAdmin
+	stale.UpdatedAt = u.UpdatedAt.Add(-time.Hour)
+	if changed, _ := store.MergeUser(stale); changed {
+		t.Errorf("expected stale peer record to be ignored")
+	}
+	fresh := stale
+	fresh.UpdatedAt = time.Now().Add(time.Minute)
+	if changed, _ := store.MergeUser(fresh); !changed {
+		t.Errorf("expected newer peer record to apply")
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	svc, store := newTestService(t)
+	if _, err := svc.Bootstrap("admin", "", "admin-password"); err != nil {
+		t.Fatalf("Bootstrap: %v", err)
+	}
+	handler := svc.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	key, k, err := svc.CreateAPIKey("ci", types.RoleOperator, 24*time.Hour, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, APIKeyPrefix) || !strings.HasPrefix(key, k.Prefix) {
+		t.Fatalf("unexpected key %q with prefix %q", key, k.Prefix)
+	}
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := do(http.MethodPost, "/api/hosts/reboot?id=h1"); code != http.StatusOK {
+		t.Fatalf("expected operator key to reboot, got %d", code)
+	}
+	if code := do(http.MethodGet, "/api/keys"); code != http.StatusForbidden {
+		t.Errorf("expected operator key to be refused key management, got %d", code)
+	}
+
+	keys, err := store.ListAPIKeys()
+	if err != nil || len(keys) != 1 || keys[0].LastUsedAt.IsZero() {
+		t.Fatalf("expected last-used to be tracked, got %+v (%v)", keys, err)
+	}
+
+	entries, err := store.ListAudit(hosts.AuditQuery{Actor: "key:ci"})
+	if err != nil {
+		t.Fatalf("ListAudit: %v", err)
+	}
+	var sawUse, sawReboot bool
+	for _, e := range entries {
+		sawUse = sawUse || e.Action == "api_key.use"
+		sawReboot = sawReboot || (e.Action == "POST /api/hosts/reboot" && e.Target == "id=h1" && e.ActorType == hosts.ActorAPIKey)
+	}
+	if !sawUse || !sawReboot {
+		t.Errorf("expected key usage and reboot in audit log, got %+v", entries)
+	}
+
+	if _, err := store.RevokeAPIKey(k.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if code := do(http.MethodGet, "/api/hosts"); code != http.StatusUnauthorized {
+		t.Errorf("expected revoked key to be rejected, got %d", code)
+	}
+}
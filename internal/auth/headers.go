@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// SecuritySettingKey is the settings key for response security headers.
+const SecuritySettingKey = "security"
+
+// DefaultCSP allows the dashboard's own scripts (Datastar evaluates
+// expressions, and the Tailwind build injects styles, hence the unsafe-*
+// sources), websockets back to this node, asset previews and framed Anthias
+// dashboards from any host. The dashboard itself may only be framed by
+// this node.
+const DefaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' 'unsafe-eval'; " +
+	"style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data: http: https:; " +
+	"media-src 'self' http: https:; " +
+	"connect-src 'self' ws: wss:; " +
+	"frame-src 'self' http: https:; " +
+	"frame-ancestors 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'"
+
+// SecurityConfig controls the security headers sent with every response.
+type SecurityConfig struct {
+	// ContentSecurityPolicy replaces DefaultCSP when set; "off" sends no
+	// policy at all.
+	ContentSecurityPolicy string `json:"content_security_policy,omitempty"`
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only,
+	// for trying out a stricter policy without breaking the dashboard.
+	CSPReportOnly bool `json:"csp_report_only,omitempty"`
+	// HSTS adds Strict-Transport-Security on HTTPS responses.
+	HSTS bool `json:"hsts,omitempty"`
+}
+
+// Policy returns the effective Content-Security-Policy, or "" when off.
+func (c SecurityConfig) Policy() string {
+	switch strings.TrimSpace(c.ContentSecurityPolicy) {
+	case "":
+		return DefaultCSP
+	case "off":
+		return ""
+	default:
+		return strings.TrimSpace(c.ContentSecurityPolicy)
+	}
+}
+
+// Validate rejects policies that could not be sent as a header value.
+func (c SecurityConfig) Validate() error {
+	if strings.ContainsAny(c.ContentSecurityPolicy, "\r\n") {
+		return errors.New("content_security_policy must be a single line")
+	}
+	return nil
+}
+
+// LoadSecurity reads the security header settings.
+func (a *Service) LoadSecurity() (SecurityConfig, error) {
+	if cfg := a.security.Load(); cfg != nil {
+		return *cfg, nil
+	}
+	var cfg SecurityConfig
+	if _, err := a.store.GetSetting(SecuritySettingKey, &cfg); err != nil {
+		return SecurityConfig{}, err
+	}
+	a.security.Store(&cfg)
+	return cfg, nil
+}
+
+// SaveSecurity stores the security header settings and applies them to
+// subsequent responses.
+func (a *Service) SaveSecurity(cfg SecurityConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := a.store.PutSetting(SecuritySettingKey, cfg); err != nil {
+		return err
+	}
+	a.security.Store(&cfg)
+	return nil
+}
+
+// SecurityHeaders adds anti-sniffing, referrer, framing, and CSP headers
+// to every response.
+func (a *Service) SecurityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg, err := a.LoadSecurity()
+		if err != nil {
+			cfg = SecurityConfig{}
+		}
+
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "SAMEORIGIN")
+		h.Set("Referrer-Policy", "same-origin")
+		if policy := cfg.Policy(); policy != "" {
+			if cfg.CSPReportOnly {
+				h.Set("Content-Security-Policy-Report-Only", policy)
+			} else {
+				h.Set("Content-Security-Policy", policy)
+			}
+		}
+		if cfg.HSTS && r.TLS != nil {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
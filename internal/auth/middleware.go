@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+type contextKey struct{}
+
+// UserFromContext returns the authenticated user for a request. It reports
+// false in open mode (no users configured) and on public endpoints.
+func UserFromContext(ctx context.Context) (types.User, bool) {
+	u, ok := ctx.Value(contextKey{}).(types.User)
+	return u, ok
+}
+
+// WithUser returns a context carrying u, for handlers and tests.
+func WithUser(ctx context.Context, u types.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, u)
+}
+
+// publicPaths are reachable without a session: the login flow, static
+// assets, and the endpoints peers and players call. isPublic also admits
+// everything under /static/, /media/, /widgets/ and /api/triggers/; the
+// media handler itself only serves hosts in the list, widget pages show
+// nothing the screens do not, and triggers check their own tokens.
+var publicPaths = map[string]bool{
+	"/login":                     true,
+	"/api/auth/login":            true,
+	"/api/auth/logout":           true,
+	"/api/auth/status":           true,
+	"/api/auth/bootstrap":        true,
+	"/api/auth/invite/accept":    true,
+	"/api/auth/reset":            true,
+	"/api/auth/oidc/login":       true,
+	"/api/auth/oidc/callback":    true,
+	"/api/users/sync":            true, // Authenticated by cluster HMAC
+	"/api/health":                true,
+	"/api/version":               true,
+	"/api/host/local":            true,
+	"/api/hosts/announce":        true, // Signed by the sender's node key; unknown senders are quarantined
+	"/api/hosts/receive":         true, // Hosts from unsigned or unknown senders are quarantined
+	"/api/heartbeat":             true, // Authenticated by the sender's pinned node key
+	"/api/peers/bus":             true, // Each request it carries is checked as if posted directly
+	"/api/peers/logs/receive":    true, // Authenticated by the sender's pinned node key
+	"/api/peers/backups/receive": true, // Authenticated by the sender's pinned node key
+	"/cache":                     true, // Limited to hosts in the host list
+	"/sw.js":                     true, // The service worker; the pages it caches are checked as usual
+	"/api/public/status":         true, // Opt-in; the handler checks the token or IP allowlist
+	"/player":                    true, // The built-in player page, which shows what the screen does
+	"/api/player/now":            true,
+}
+
+// adminPrefixes require the admin role for every method.
+var adminPrefixes = []string{
+	"/api/users",
+	"/api/auth/invites",
+	"/api/settings/",
+	"/api/keys",
+	"/api/audit",
+	"/api/credentials",
+	"/api/peers/forget",
+	"/api/peers/trust",
+	"/api/hosts/quarantine",
+	"/api/debug/",
+	"/api/flags",
+	"/api/backups/download", // The whole database, password hashes included
+	"/api/backups/upload",   // Replaces users and settings too
+	"/api/backups/peers",    // Peer databases, password hashes included
+}
+
+// selfServicePaths are available to any signed-in user regardless of role.
+var selfServicePaths = map[string]bool{
+	"/api/auth/me":       true,
+	"/api/auth/me/table": true,
+	"/api/auth/password": true,
+	"/api/views":         true, // Saved views are the user's own
+	"/api/views/delete":  true,
+}
+
+// unauditedPaths change state too often and too little to audit: edit
+// locks are taken and released around every edit, which is audited itself.
+var unauditedPaths = map[string]bool{
+	"/api/hosts/lock":   true,
+	"/api/hosts/unlock": true,
+}
+
+// readOnlyPaths take POST bodies but change nothing, so any signed-in user
+// may post to them and they are not audited.
+var readOnlyPaths = map[string]bool{
+	"/api/graphql":             true, // Queries only
+	"/api/alerts/rules/test":   true, // Runs a script without saving it
+	"/api/grafana/search":      true, // Grafana datasource queries
+	"/api/grafana/query":       true,
+	"/api/grafana/annotations": true,
+	"/nsm.v1.NSM/ListHosts":    true, // gRPC methods that only read
+	"/nsm.v1.NSM/GetHost":      true,
+	"/nsm.v1.NSM/ListPresets":  true,
+	"/nsm.v1.NSM/ListJobs":     true,
+	"/nsm.v1.NSM/WatchHealth":  true,
+}
+
+func isPublic(path string) bool {
+	return publicPaths[path] || strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, "/media/") ||
+		strings.HasPrefix(path, "/widgets/") || strings.HasPrefix(path, "/api/triggers/")
+}
+
+// RequiredRole returns the minimum role for a request: admin for account
+// and settings management, operator for anything that changes state, and
+// viewer for reads.
+func RequiredRole(r *http.Request) types.Role {
+	if selfServicePaths[r.URL.Path] || readOnlyPaths[r.URL.Path] {
+		return types.RoleViewer
+	}
+	for _, prefix := range adminPrefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return types.RoleAdmin
+		}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return types.RoleViewer
+	default:
+		return types.RoleOperator
+	}
+}
+
+// Middleware enforces sessions and roles once at least one user exists.
+// The status board is also open to wall displays when its settings allow.
+// Browsers are redirected to the login page; API and view requests get a
+// JSON 401 or 403. State-changing requests from other sites are refused,
+// and cookie sessions must present their CSRF token. Requests signed by a
+// peer's node key act as an operator once an admin has confirmed the key,
+// whether or not users exist.
+// Every state-changing request that passes the checks is written to the
+// audit log, attributed to the user, API key or peer.
+func (a *Service) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isMutating(r.Method) && !sameOrigin(r) {
+			writeAuthError(w, http.StatusForbidden, "cross-origin request blocked")
+			return
+		}
+		r, peer, signed, err := a.authenticatePeer(r)
+		if isPublic(r.URL.Path) {
+			// Public endpoints check their senders themselves; a peer
+			// whose key is not pinned yet must still get its first
+			// heartbeat through.
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err != nil {
+			a.logger.Warning(fmt.Sprintf("Auth: rejected peer request %s %s from %s: %v", r.Method, r.URL.Path, remoteIP(r), err))
+			writeAuthError(w, http.StatusUnauthorized, "peer signature rejected: "+err.Error())
+			return
+		}
+		if signed {
+			if !peer.Role.Allows(RequiredRole(r)) {
+				writeAuthError(w, http.StatusForbidden, "insufficient permissions")
+				return
+			}
+			a.serveAudited(next, w, r, peer)
+			return
+		}
+		if !a.Enabled() {
+			a.serveAudited(next, w, r, types.User{})
+			return
+		}
+		if statusBoardPaths[r.URL.Path] && r.Method == http.MethodGet && a.statusBoardAllows(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		u, ok := a.Authenticate(r)
+		if !ok {
+			if r.URL.Path == "/" || r.URL.Path == "/status-board" {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
+				return
+			}
+			writeAuthError(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+
+		if !checkCSRF(w, r) {
+			writeAuthError(w, http.StatusForbidden, "missing or invalid CSRF token")
+			return
+		}
+
+		if !u.Role.Allows(RequiredRole(r)) {
+			writeAuthError(w, http.StatusForbidden, "insufficient permissions")
+			return
+		}
+
+		a.serveAudited(next, w, r.WithContext(WithUser(r.Context(), u)), u)
+	})
+}
+
+// serveAudited runs next and records state-changing requests.
+func (a *Service) serveAudited(next http.Handler, w http.ResponseWriter, r *http.Request, u types.User) {
+	if !isMutating(r.Method) || readOnlyPaths[r.URL.Path] || unauditedPaths[r.URL.Path] {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, note := withAuditNote(r.Context())
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	next.ServeHTTP(rec, r.WithContext(ctx))
+
+	target := note.target
+	if target == "" {
+		target = r.URL.RawQuery
+	}
+	detail := fmt.Sprintf("status %d", rec.status)
+	if note.detail != "" {
+		detail = note.detail + "; " + detail
+	}
+	a.Audit(r, u, r.Method+" "+r.URL.Path, target, detail)
+}
+
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
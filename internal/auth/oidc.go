@@ -0,0 +1,501 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// OIDCSettingKey is the settings key holding the single sign-on
+// configuration.
+const OIDCSettingKey = "oidc"
+
+// ProviderOIDC marks users provisioned through single sign-on.
+const ProviderOIDC = "oidc"
+
+// jwksTTL bounds how long provider signing keys are cached before they are
+// fetched again, so key rotation is picked up without a restart.
+const jwksTTL = time.Hour
+
+var (
+	// ErrOIDCDisabled is returned when single sign-on is not configured.
+	ErrOIDCDisabled = errors.New("single sign-on is not enabled")
+	// ErrOIDCNoRole is returned when the ID token maps to no NSM role and
+	// no default role is configured.
+	ErrOIDCNoRole = errors.New("your account has no role assigned for this dashboard")
+)
+
+// OIDCConfig configures the OpenID Connect relying party. Any provider that
+// publishes a discovery document works, e.g. Azure AD
+// (https://login.microsoftonline.com/<tenant>/v2.0), Keycloak
+// (https://<host>/realms/<realm>), or Google (https://accounts.google.com).
+type OIDCConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// RedirectURL overrides the callback URL registered with the provider.
+	// By default it is derived from the request host.
+	RedirectURL string   `json:"redirect_url,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	// UsernameClaim names the claim used as the NSM username; it falls back
+	// to email and then sub.
+	UsernameClaim string `json:"username_claim,omitempty"`
+	// RoleClaim is the claim holding groups or roles. Dotted paths reach
+	// nested claims, e.g. "realm_access.roles" for Keycloak.
+	RoleClaim string `json:"role_claim,omitempty"`
+	// RoleMappings maps claim values to NSM roles. When several match, the
+	// highest role wins.
+	RoleMappings map[string]types.Role `json:"role_mappings,omitempty"`
+	// DefaultRole applies when no mapping matches. Empty denies sign-in.
+	DefaultRole types.Role `json:"default_role,omitempty"`
+	ButtonLabel string     `json:"button_label,omitempty"`
+}
+
+// DefaultOIDCConfig returns a disabled configuration with standard scopes.
+func DefaultOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		Scopes:        []string{"openid", "profile", "email"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		ButtonLabel:   "Sign in with SSO",
+	}
+}
+
+// Validate checks that an enabled configuration is complete.
+func (c OIDCConfig) Validate() error {
+	for value, role := range c.RoleMappings {
+		if !role.Valid() {
+			return fmt.Errorf("invalid role %q for %q", role, value)
+		}
+	}
+	if c.DefaultRole != "" && !c.DefaultRole.Valid() {
+		return fmt.Errorf("invalid default role %q", c.DefaultRole)
+	}
+	if !c.Enabled {
+		return nil
+	}
+	if u, err := url.Parse(c.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("issuer must be an absolute URL")
+	}
+	if c.ClientID == "" {
+		return errors.New("client_id is required")
+	}
+	return nil
+}
+
+// Masked returns a copy safe to return from the API.
+func (c OIDCConfig) Masked() OIDCConfig {
+	if c.ClientSecret != "" {
+		c.ClientSecret = "********"
+	}
+	return c
+}
+
+// LoadOIDC reads the single sign-on configuration, filling in defaults.
+func LoadOIDC(store hosts.SettingStore) (OIDCConfig, error) {
+	cfg := DefaultOIDCConfig()
+	if _, err := store.GetSetting(OIDCSettingKey, &cfg); err != nil {
+		return OIDCConfig{}, err
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = DefaultOIDCConfig().Scopes
+	}
+	return cfg, nil
+}
+
+// SaveOIDC validates and stores the single sign-on configuration.
+func (a *Service) SaveOIDC(cfg OIDCConfig) error {
+	cfg.Issuer = strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/")
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if err := a.store.PutSetting(OIDCSettingKey, cfg); err != nil {
+		return err
+	}
+
+	// Force rediscovery in case the issuer changed.
+	a.oidcMu.Lock()
+	a.oidcCache = nil
+	a.oidcMu.Unlock()
+	return nil
+}
+
+// OIDCEnabled reports whether single sign-on is configured and switched on.
+func (a *Service) OIDCEnabled() (OIDCConfig, bool) {
+	cfg, err := LoadOIDC(a.store)
+	if err != nil || !cfg.Enabled {
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// oidcProvider is the cached discovery document and signing keys.
+type oidcProvider struct {
+	issuer        string
+	authEndpoint  string
+	tokenEndpoint string
+	jwksURI       string
+	authMethods   []string
+	keys          map[string]*rsa.PublicKey
+	keysFetched   time.Time
+}
+
+// provider returns discovery metadata for the configured issuer, fetching
+// it on first use.
+func (a *Service) provider(cfg OIDCConfig) (*oidcProvider, error) {
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+
+	if a.oidcCache != nil && a.oidcCache.issuer == cfg.Issuer {
+		return a.oidcCache, nil
+	}
+
+	var doc struct {
+		Issuer        string   `json:"issuer"`
+		AuthEndpoint  string   `json:"authorization_endpoint"`
+		TokenEndpoint string   `json:"token_endpoint"`
+		JWKSURI       string   `json:"jwks_uri"`
+		AuthMethods   []string `json:"token_endpoint_auth_methods_supported"`
+	}
+	if err := a.getJSON(cfg.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("discover %s: %w", cfg.Issuer, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer", doc.Issuer)
+	}
+	if doc.AuthEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+
+	a.oidcCache = &oidcProvider{
+		issuer:        cfg.Issuer,
+		authEndpoint:  doc.AuthEndpoint,
+		tokenEndpoint: doc.TokenEndpoint,
+		jwksURI:       doc.JWKSURI,
+		authMethods:   doc.AuthMethods,
+	}
+	return a.oidcCache, nil
+}
+
+// signingKey returns the provider key with the given ID, refreshing the
+// JWKS when the key is unknown or the cache is stale.
+func (a *Service) signingKey(p *oidcProvider, kid string) (*rsa.PublicKey, error) {
+	a.oidcMu.Lock()
+	defer a.oidcMu.Unlock()
+
+	if key, ok := p.keys[kid]; ok && time.Since(p.keysFetched) < jwksTTL {
+		return key, nil
+	}
+
+	resp, err := a.client.Get(p.jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		// Providers with a single key may omit kid from tokens.
+		if kid == "" && len(keys) == 1 {
+			for _, k := range keys {
+				return k, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// OIDCAuthURL returns the provider URL to send the browser to, along with
+// the state and nonce the caller must keep for the callback.
+func (a *Service) OIDCAuthURL(redirectURL string) (authURL, state, nonce string, err error) {
+	cfg, ok := a.OIDCEnabled()
+	if !ok {
+		return "", "", "", ErrOIDCDisabled
+	}
+	p, err := a.provider(cfg)
+	if err != nil {
+		return "", "", "", err
+	}
+	if state, err = NewToken(); err != nil {
+		return "", "", "", err
+	}
+	if nonce, err = NewToken(); err != nil {
+		return "", "", "", err
+	}
+
+	q := url.Values{
+		"response_type": {"code"},
+		"client_id":     {cfg.ClientID},
+		"redirect_uri":  {a.redirectURL(cfg, redirectURL)},
+		"scope":         {strings.Join(cfg.Scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	sep := "?"
+	if strings.Contains(p.authEndpoint, "?") {
+		sep = "&"
+	}
+	return p.authEndpoint + sep + q.Encode(), state, nonce, nil
+}
+
+// OIDCCallback completes a sign-in: it exchanges the authorization code,
+// verifies the ID token, provisions or updates the matching user with the
+// role mapped from its claims, and starts a session.
+func (a *Service) OIDCCallback(code, redirectURL, nonce string) (string, types.User, error) {
+	cfg, ok := a.OIDCEnabled()
+	if !ok {
+		return "", types.User{}, ErrOIDCDisabled
+	}
+	p, err := a.provider(cfg)
+	if err != nil {
+		return "", types.User{}, err
+	}
+
+	idToken, err := a.exchangeCode(cfg, p, code, a.redirectURL(cfg, redirectURL))
+	if err != nil {
+		return "", types.User{}, err
+	}
+	claims, err := a.verifyIDToken(cfg, p, idToken, nonce)
+	if err != nil {
+		return "", types.User{}, err
+	}
+
+	u, err := a.provisionOIDCUser(cfg, claims)
+	if err != nil {
+		return "", types.User{}, err
+	}
+	return a.openSession(u)
+}
+
+func (a *Service) redirectURL(cfg OIDCConfig, fallback string) string {
+	if cfg.RedirectURL != "" {
+		return cfg.RedirectURL
+	}
+	return fallback
+}
+
+func (a *Service) exchangeCode(cfg OIDCConfig, p *oidcProvider, code, redirectURL string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURL},
+		"client_id":    {cfg.ClientID},
+	}
+	// client_secret_basic is the spec default; use the form body only when
+	// the provider says it accepts it.
+	usePost := slices.Contains(p.authMethods, "client_secret_post")
+	if usePost {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !usePost && cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("token exchange: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token exchange: %s %s", body.Error, body.Description)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token exchange: no id_token in response")
+	}
+	return body.IDToken, nil
+}
+
+func (a *Service) verifyIDToken(cfg OIDCConfig, p *oidcProvider, token, nonce string) (map[string]any, error) {
+	kid, claims, signed, sig, err := parseJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	key, err := a.signingKey(p, kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyRS256(key, signed, sig); err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimRight(iss, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("unexpected token issuer %q", iss)
+	}
+	if !slices.Contains(claimValues(claims, "aud"), cfg.ClientID) {
+		return nil, errors.New("ID token was not issued for this client")
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Now().Add(-time.Minute).After(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if got, _ := claims["nonce"].(string); nonce == "" || got != nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+	return claims, nil
+}
+
+// provisionOIDCUser finds or creates the user for a verified identity. The
+// identity provider is authoritative for role and email, so both are
+// refreshed on every sign-in.
+func (a *Service) provisionOIDCUser(cfg OIDCConfig, claims map[string]any) (types.User, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return types.User{}, errors.New("ID token has no subject")
+	}
+	externalID := cfg.Issuer + "|" + sub
+
+	role := mapRole(cfg, claimValues(claims, cfg.RoleClaim))
+	if role == "" {
+		return types.User{}, ErrOIDCNoRole
+	}
+	email, _ := claims["email"].(string)
+
+	u, err := a.store.GetUserByExternalID(ProviderOIDC, externalID)
+	if errors.Is(err, hosts.ErrUserNotFound) {
+		username := firstClaim(claims, cfg.UsernameClaim, "email", "sub")
+		u, err = a.store.AddUser(types.User{
+			Username:   username,
+			Email:      email,
+			Role:       role,
+			Provider:   ProviderOIDC,
+			ExternalID: externalID,
+		})
+		if errors.Is(err, hosts.ErrUserExists) {
+			// Never attach an SSO identity to an existing local account by
+			// name alone.
+			return types.User{}, fmt.Errorf("username %q is already used by another account", username)
+		}
+		if err != nil {
+			return types.User{}, err
+		}
+		a.logger.Info(fmt.Sprintf("Auth: Provisioned SSO user %q as %s", u.Username, u.Role))
+		a.Replicate()
+		return u, nil
+	}
+	if err != nil {
+		return types.User{}, err
+	}
+	if u.Disabled {
+		return types.User{}, ErrInvalidCredentials
+	}
+
+	if u.Role != role || u.Email != email {
+		u, err = a.store.UpdateUser(u.ID, func(u *types.User) {
+			u.Role = role
+			u.Email = email
+		})
+		if err != nil {
+			return types.User{}, err
+		}
+		a.Replicate()
+	}
+	return u, nil
+}
+
+// mapRole returns the highest role mapped from the given claim values, or
+// the default role when none match.
+func mapRole(cfg OIDCConfig, values []string) types.Role {
+	var best types.Role
+	for _, v := range values {
+		role, ok := cfg.RoleMappings[v]
+		if ok && (best == "" || role.Allows(best)) {
+			best = role
+		}
+	}
+	if best == "" {
+		return cfg.DefaultRole
+	}
+	return best
+}
+
+// claimValues reads a string or string-array claim. Dotted names walk into
+// nested objects.
+func claimValues(claims map[string]any, name string) []string {
+	if name == "" {
+		return nil
+	}
+	var v any = claims
+	for _, part := range strings.Split(name, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		out := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func firstClaim(claims map[string]any, names ...string) string {
+	for _, name := range names {
+		if values := claimValues(claims, name); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func (a *Service) getJSON(url string, v any) error {
+	resp, err := a.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
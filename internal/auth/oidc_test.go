@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// fakeIdP is a minimal OpenID provider that issues RS256 ID tokens with the
+// claims set by the test.
+type fakeIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	idp := &fakeIdP{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, ok := r.BasicAuth(); !ok || id != "nsm" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t)})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *fakeIdP) sign(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1", "typ": "JWT"})
+	payload, _ := json.Marshal(idp.claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDCSignIn(t *testing.T) {
+	svc, _ := newTestService(t)
+	idp := newFakeIdP(t)
+
+	cfg := DefaultOIDCConfig()
+	cfg.Enabled = true
+	cfg.Issuer = idp.URL
+	cfg.ClientID = "nsm"
+	cfg.ClientSecret = "s3cret"
+	cfg.RoleClaim = "realm_access.roles"
+	cfg.RoleMappings = map[string]types.Role{"nsm-ops": types.RoleOperator, "nsm-admins": types.RoleAdmin}
+	if err := svc.SaveOIDC(cfg); err != nil {
+		t.Fatalf("SaveOIDC: %v", err)
+	}
+
+	authURL, _, nonce, err := svc.OIDCAuthURL("http://nsm.local/api/auth/oidc/callback")
+	if err != nil {
+		t.Fatalf("OIDCAuthURL: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	if u.Query().Get("nonce") != nonce || u.Query().Get("client_id") != "nsm" {
+		t.Errorf("unexpected authorization URL %s", authURL)
+	}
+
+	idp.claims = map[string]any{
+		"iss":                idp.URL,
+		"aud":                "nsm",
+		"sub":                "abc-123",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "jdoe",
+		"email":              "jdoe@example.com",
+		"realm_access":       map[string]any{"roles": []string{"nsm-ops", "nsm-admins"}},
+	}
+	token, user, err := svc.OIDCCallback("code", "http://nsm.local/api/auth/oidc/callback", nonce)
+	if err != nil {
+		t.Fatalf("OIDCCallback: %v", err)
+	}
+	if token == "" || user.Username != "jdoe" || user.Role != types.RoleAdmin || user.Provider != ProviderOIDC {
+		t.Fatalf("unexpected SSO user: %+v", user)
+	}
+
+	// Role follows the identity provider on the next sign-in.
+	idp.claims["realm_access"] = map[string]any{"roles": []string{"nsm-ops"}}
+	_, again, err := svc.OIDCCallback("code", "http://nsm.local/api/auth/oidc/callback", nonce)
+	if err != nil {
+		t.Fatalf("second OIDCCallback: %v", err)
+	}
+	if again.ID != user.ID || again.Role != types.RoleOperator {
+		t.Errorf("expected same user demoted to operator, got %+v", again)
+	}
+
+	// SSO accounts have no local password.
+	if _, _, err := svc.Login("jdoe", ""); err != ErrInvalidCredentials {
+		t.Errorf("expected local login to fail for SSO user, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(map[string]any)
+		nonce  string
+	}{
+		{"wrong nonce", func(c map[string]any) {}, "other"},
+		{"wrong audience", func(c map[string]any) { c["aud"] = "someone-else" }, nonce},
+		{"expired", func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, nonce},
+		{"no role", func(c map[string]any) { c["realm_access"] = map[string]any{"roles": []string{"guests"}} }, nonce},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := map[string]any{}
+			for k, v := range idp.claims {
+				claims[k] = v
+			}
+			tt.mutate(claims)
+			saved := idp.claims
+			idp.claims = claims
+			defer func() { idp.claims = saved }()
+
+			if _, _, err := svc.OIDCCallback("code", "http://nsm.local/api/auth/oidc/callback", tt.nonce); err == nil {
+				t.Errorf("expected sign-in to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ProviderPeer marks the principal of a request signed by another node,
+// whose username is "node:" and the node ID.
+const ProviderPeer = "peer"
+
+type peerContextKey struct{}
+
+// PeerFromContext returns the node that signed a request with its pinned
+// key. It reports false for requests from browsers and API keys.
+func PeerFromContext(ctx context.Context) (hosts.Peer, bool) {
+	p, ok := ctx.Value(peerContextKey{}).(hosts.Peer)
+	return p, ok
+}
+
+// WithPeer returns a context carrying p, for handlers and tests.
+func WithPeer(ctx context.Context, p hosts.Peer) context.Context {
+	return context.WithValue(ctx, peerContextKey{}, p)
+}
+
+// PeerSigner returns the signer for requests this node makes of its
+// peers. Requests go unsigned while the node key or ID is unknown.
+func (a *Service) PeerSigner() *peerauth.Signer {
+	return a.signer
+}
+
+// peerPrincipal represents a peer whose key an admin confirmed as a user.
+// Peers act as operators: they forward what an operator asked of them, and
+// never manage accounts or settings.
+func peerPrincipal(p hosts.Peer) types.User {
+	return types.User{
+		ID:       "node:" + p.NodeID,
+		Username: "node:" + p.NodeID,
+		Role:     types.RoleOperator,
+		Provider: ProviderPeer,
+	}
+}
+
+// authenticatePeer checks the peer signature on r. It returns r with the
+// peer in its context, or r unchanged and ok false if it carries no
+// signature; err is set for one that does not check out. The body is read
+// to check it and left for the handler to read again.
+func (a *Service) authenticatePeer(r *http.Request) (_ *http.Request, _ types.User, ok bool, err error) {
+	value := r.Header.Get(peerauth.Header)
+	if value == "" {
+		return r, types.User{}, false, nil
+	}
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(r.Body, peerauth.MaxBody+1))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil {
+			return r, types.User{}, false, err
+		}
+		if len(body) > peerauth.MaxBody {
+			return r, types.User{}, false, fmt.Errorf("signed requests are limited to %d MB", peerauth.MaxBody>>20)
+		}
+	}
+	peer, err := a.peers.Verify(value, r.Method, r.URL.RequestURI(), body, time.Now())
+	if err != nil {
+		return r, types.User{}, false, err
+	}
+	u := peerPrincipal(peer)
+	ctx := WithUser(WithPeer(r.Context(), peer), u)
+	return r.WithContext(ctx), u, true, nil
+}
@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// PublicStatusSettingKey is the settings key for the public status JSON.
+const PublicStatusSettingKey = "public_status"
+
+// PublicStatusConfig opens /api/public/status, the anonymized fleet health
+// for customer-facing status pages. It is off by default.
+type PublicStatusConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token, when set, admits callers giving it as ?token=.
+	Token string `json:"token,omitempty"`
+	// AllowedIPs admits callers from these IPs or CIDRs.
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// Validate rejects allowlist entries that are not IPs or CIDRs.
+func (c PublicStatusConfig) Validate() error {
+	for _, entry := range c.AllowedIPs {
+		if _, err := parseAllowed(entry); err != nil {
+			return fmt.Errorf("invalid allowed IP %q: use an IP or CIDR, e.g. 203.0.113.0/24", entry)
+		}
+	}
+	return nil
+}
+
+func parseAllowed(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		return netip.ParsePrefix(entry)
+	}
+	ip, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// LoadPublicStatus reads the public status settings.
+func (a *Service) LoadPublicStatus() (PublicStatusConfig, error) {
+	var cfg PublicStatusConfig
+	_, err := a.store.GetSetting(PublicStatusSettingKey, &cfg)
+	return cfg, err
+}
+
+// SavePublicStatus stores the public status settings. The token is kept,
+// issued or cleared as for the status board (see SaveStatusBoard).
+func (a *Service) SavePublicStatus(enabled bool, allowedIPs []string, requireToken, rotate bool) (PublicStatusConfig, error) {
+	cfg, err := a.LoadPublicStatus()
+	if err != nil {
+		return PublicStatusConfig{}, err
+	}
+	cfg.Enabled = enabled
+	cfg.AllowedIPs = allowedIPs
+	if err := cfg.Validate(); err != nil {
+		return PublicStatusConfig{}, err
+	}
+	switch {
+	case !requireToken:
+		cfg.Token = ""
+	case rotate || cfg.Token == "":
+		if cfg.Token, err = NewToken(); err != nil {
+			return PublicStatusConfig{}, err
+		}
+	}
+	if err := a.store.PutSetting(PublicStatusSettingKey, cfg); err != nil {
+		return PublicStatusConfig{}, err
+	}
+	return cfg, nil
+}
+
+// PublicStatusAllows reports whether r may read the public status: it is
+// enabled, and r has the token or comes from an allowed IP. Without either
+// configured, anyone may.
+func (a *Service) PublicStatusAllows(r *http.Request) bool {
+	cfg, err := a.LoadPublicStatus()
+	if err != nil || !cfg.Enabled {
+		return false
+	}
+	if cfg.Token == "" && len(cfg.AllowedIPs) == 0 {
+		return true
+	}
+	if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(cfg.Token)) == 1 {
+		return true
+	}
+	ip, err := netip.ParseAddr(remoteIP(r))
+	if err != nil {
+		return false
+	}
+	for _, entry := range cfg.AllowedIPs {
+		if prefix, err := parseAllowed(entry); err == nil && prefix.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// SignatureHeader carries the HMAC of a user sync payload.
+const SignatureHeader = "X-NSM-Signature"
+
+// ReplicationEnabled reports whether a cluster secret is configured.
+func (a *Service) ReplicationEnabled() bool {
+	return a.syncSecret != ""
+}
+
+// Sign returns the hex HMAC-SHA256 of body under the cluster secret.
+func (a *Service) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(a.syncSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a sync payload signature. Without a cluster secret
+// nothing verifies, so user records are never accepted from the network.
+func (a *Service) VerifySignature(body []byte, signature string) bool {
+	if !a.ReplicationEnabled() {
+		return false
+	}
+	want, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(a.syncSecret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// MergeUsers applies user records received from a peer and returns how many
+// changed locally.
+func (a *Service) MergeUsers(users []types.User) (int, error) {
+	changed := 0
+	for _, u := range users {
+		ok, err := a.store.MergeUser(u)
+		if err != nil {
+			return changed, fmt.Errorf("merge user %s: %w", u.Username, err)
+		}
+		if ok {
+			changed++
+			if u.Deleted || u.Disabled {
+				a.store.DeleteUserTokens(u.ID)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// Replicate pushes the full user table, including tombstones, to online
+// peers. Peers keep whichever copy of each record is newest, so repeated or
+// out-of-order pushes converge.
+func (a *Service) Replicate() {
+	if !a.ReplicationEnabled() {
+		return
+	}
+
+	users, err := a.store.ListUsers(true)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("Auth: failed to load users for replication: %v", err))
+		return
+	}
+	body, err := json.Marshal(users)
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("Auth: failed to encode users for replication: %v", err))
+		return
+	}
+	signature := a.Sign(body)
+
+	myIP := os.Getenv("NSM_HOST_IP")
+	for _, peer := range a.store.GetAll() {
+		path := hosts.SelectPath(peer)
+		if !path.Healthy() || peer.IPAddress == "" ||
+			peer.IPAddress == "127.0.0.1" || peer.IPAddress == myIP {
+			continue
+		}
+
+		go func(targetIP string) {
+			url := fmt.Sprintf("http://%s:8080/api/users/sync", targetIP)
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(SignatureHeader, signature)
+
+			resp, err := a.client.Do(req)
+			if err != nil {
+				a.logger.Warning(fmt.Sprintf("Auth: failed to replicate users to %s: %v", targetIP, err))
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				a.logger.Warning(fmt.Sprintf("Auth: peer %s rejected user replication (status %d)", targetIP, resp.StatusCode))
+			}
+		}(path.Address)
+	}
+}
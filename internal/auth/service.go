@@ -0,0 +1,361 @@
+// Package auth implements dashboard accounts: local users with roles,
+// sessions, invitation links, password resets, per-user preferences, and
+// optional OpenID Connect single sign-on.
+// User records replicate between peers so an account works on every node.
+// While no users exist the dashboard stays open, matching the behaviour of
+// earlier releases.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/vault"
+)
+
+// SessionCookie is the name of the dashboard session cookie.
+const SessionCookie = "nsm_session"
+
+// Token lifetimes.
+const (
+	sessionTTL = 7 * 24 * time.Hour
+	inviteTTL  = 72 * time.Hour
+	resetTTL   = time.Hour
+)
+
+var (
+	// ErrInvalidCredentials is returned for a failed login.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrAlreadyInitialized is returned when bootstrapping after users exist.
+	ErrAlreadyInitialized = errors.New("users already exist")
+)
+
+// Service manages users and sessions on top of the host store.
+type Service struct {
+	store      *hosts.Store
+	logger     *logger.Logger
+	syncSecret string
+	client     *http.Client
+	identity   *identity.Identity
+	keyFile    string // Where identity was loaded from
+	signer     *peerauth.Signer
+	peers      *peerauth.Verifier
+
+	oidcMu    sync.Mutex
+	oidcCache *oidcProvider
+
+	// security caches the header settings so responses avoid a database
+	// read.
+	security atomic.Pointer[SecurityConfig]
+}
+
+// NewService creates the auth service. User replication between peers is
+// enabled when NSM_CLUSTER_SECRET is set to the same value on every node.
+// The node identity key is loaded (or created) next to the database, or at
+// NSM_IDENTITY_KEY when set, and used to sign the audit log and requests
+// to peers, and to encrypt settings and sensitive fields. While encryption
+// is on, a missing key is not replaced, so a key kept on removable media
+// that is not plugged in leaves the sealed data unreadable rather than
+// minting a key that cannot open it.
+func NewService(store *hosts.Store, lg *logger.Logger) *Service {
+	a := &Service{
+		store:      store,
+		logger:     lg,
+		syncSecret: os.Getenv("NSM_CLUSTER_SECRET"),
+		client:     &http.Client{Timeout: 5 * time.Second},
+		keyFile:    os.Getenv("NSM_IDENTITY_KEY"),
+		peers:      peerauth.NewVerifier(store),
+	}
+
+	if a.keyFile == "" {
+		a.keyFile = filepath.Join(store.Dir(), identity.DefaultKeyFile)
+	}
+	load := identity.LoadOrCreate
+	if encrypted, err := store.Encrypted(); err == nil && encrypted {
+		load = identity.Load
+	}
+	id, err := load(a.keyFile)
+	if err != nil {
+		lg.Error(fmt.Sprintf("Auth: node identity unavailable, audit entries will be unsigned: %v", err))
+		return a
+	}
+	a.identity = id
+	a.signer = peerauth.NewSigner(id, store.NodeID)
+	store.SetAuditSigner(id)
+	if sealer, err := vault.NewSealer(id, "settings"); err != nil {
+		lg.Error(fmt.Sprintf("Auth: settings encryption unavailable: %v", err))
+	} else {
+		store.SetSealer(sealer)
+	}
+	return a
+}
+
+// Identity returns the node signing key, or nil if it could not be loaded.
+func (a *Service) Identity() *identity.Identity {
+	return a.identity
+}
+
+// KeyFile returns the path of the node identity key.
+func (a *Service) KeyFile() string {
+	return a.keyFile
+}
+
+// KeyWithDatabase reports whether the node identity key is kept in the
+// database directory, so that whoever has a copy of the directory, or the
+// disk it is on, has the key too.
+func (a *Service) KeyWithDatabase() bool {
+	rel, err := filepath.Rel(a.store.Dir(), a.keyFile)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
+
+// Enabled reports whether authentication is enforced, i.e. at least one
+// user exists.
+func (a *Service) Enabled() bool {
+	n, err := a.store.CountUsers()
+	if err != nil {
+		// Fail closed: a database error must not open the dashboard.
+		return true
+	}
+	return n > 0
+}
+
+// Bootstrap creates the first admin account. It fails once any user exists.
+func (a *Service) Bootstrap(username, email, password string) (types.User, error) {
+	if a.Enabled() {
+		return types.User{}, ErrAlreadyInitialized
+	}
+	return a.CreateUser(username, email, password, types.RoleAdmin)
+}
+
+// CreateUser adds a local account and replicates it to peers.
+func (a *Service) CreateUser(username, email, password string, role types.Role) (types.User, error) {
+	if !role.Valid() {
+		return types.User{}, fmt.Errorf("invalid role %q", role)
+	}
+	hash, err := HashPassword(password)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	u, err := a.store.AddUser(types.User{
+		Username:     username,
+		Email:        strings.TrimSpace(email),
+		PasswordHash: hash,
+		Role:         role,
+	})
+	if err != nil {
+		return types.User{}, err
+	}
+
+	a.Replicate()
+	return u, nil
+}
+
+// UpdateUser applies an admin change (email, role, disabled) and
+// replicates it. Disabling a user revokes their sessions. Callers validate
+// the new role before updating.
+func (a *Service) UpdateUser(id string, updater func(*types.User)) (types.User, error) {
+	u, err := a.store.UpdateUser(id, updater)
+	if err != nil {
+		return types.User{}, err
+	}
+	if u.Disabled {
+		if err := a.store.DeleteUserTokens(id); err != nil {
+			return types.User{}, err
+		}
+	}
+
+	a.Replicate()
+	return u, nil
+}
+
+// DeleteUser removes an account everywhere.
+func (a *Service) DeleteUser(id string) error {
+	if _, err := a.store.DeleteUser(id); err != nil {
+		return err
+	}
+	a.Replicate()
+	return nil
+}
+
+// Login checks credentials and starts a session, returning the session
+// token to place in the cookie.
+func (a *Service) Login(username, password string) (string, types.User, error) {
+	u, err := a.store.GetUserByUsername(username)
+	if err != nil || u.Disabled || !VerifyPassword(u.PasswordHash, password) {
+		return "", types.User{}, ErrInvalidCredentials
+	}
+
+	return a.openSession(u)
+}
+
+// openSession issues a session token for an authenticated user.
+func (a *Service) openSession(u types.User) (string, types.User, error) {
+	token, err := a.newToken(hosts.AuthToken{
+		Kind:      hosts.TokenSession,
+		UserID:    u.ID,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	})
+	if err != nil {
+		return "", types.User{}, err
+	}
+	return token, u, nil
+}
+
+// Logout ends a session.
+func (a *Service) Logout(token string) error {
+	return a.store.DeleteToken(HashToken(token))
+}
+
+// Authenticate resolves the user for a request from the session cookie or
+// an "Authorization: Bearer" header carrying a session token or API key.
+func (a *Service) Authenticate(r *http.Request) (types.User, bool) {
+	token := ""
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		token = c.Value
+	} else if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		token = strings.TrimPrefix(h, "Bearer ")
+	}
+	if token == "" {
+		return types.User{}, false
+	}
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return a.authenticateAPIKey(token, r)
+	}
+
+	t, err := a.store.GetToken(HashToken(token), hosts.TokenSession)
+	if err != nil {
+		return types.User{}, false
+	}
+	u, err := a.store.GetUser(t.UserID)
+	if err != nil || u.Disabled {
+		return types.User{}, false
+	}
+	return u, true
+}
+
+// ChangePassword updates a user's own password after checking the current
+// one.
+func (a *Service) ChangePassword(userID, current, next string) error {
+	u, err := a.store.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if !VerifyPassword(u.PasswordHash, current) {
+		return ErrInvalidCredentials
+	}
+	return a.setPassword(userID, next)
+}
+
+// UpdatePrefs stores a user's dashboard preferences.
+func (a *Service) UpdatePrefs(userID string, prefs types.UserPrefs) (types.User, error) {
+	u, err := a.store.UpdateUser(userID, func(u *types.User) {
+		u.Prefs = prefs
+	})
+	if err != nil {
+		return types.User{}, err
+	}
+	a.Replicate()
+	return u, nil
+}
+
+// CreateInvite issues an invitation link token for a new account.
+func (a *Service) CreateInvite(email string, role types.Role, createdBy string) (string, time.Time, error) {
+	if !role.Valid() {
+		return "", time.Time{}, fmt.Errorf("invalid role %q", role)
+	}
+	expires := time.Now().Add(inviteTTL)
+	token, err := a.newToken(hosts.AuthToken{
+		Kind:      hosts.TokenInvite,
+		Email:     strings.TrimSpace(email),
+		Role:      role,
+		CreatedBy: createdBy,
+		ExpiresAt: expires,
+	})
+	return token, expires, err
+}
+
+// AcceptInvite creates the invited account. Invites are single use.
+func (a *Service) AcceptInvite(token, username, password string) (types.User, error) {
+	hash := HashToken(token)
+	invite, err := a.store.GetToken(hash, hosts.TokenInvite)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	u, err := a.CreateUser(username, invite.Email, password, invite.Role)
+	if err != nil {
+		return types.User{}, err
+	}
+	if err := a.store.DeleteToken(hash); err != nil {
+		a.logger.Warning(fmt.Sprintf("Auth: failed to remove used invite: %v", err))
+	}
+	return u, nil
+}
+
+// CreateReset issues a password reset token for a user.
+func (a *Service) CreateReset(userID, createdBy string) (string, time.Time, error) {
+	if _, err := a.store.GetUser(userID); err != nil {
+		return "", time.Time{}, err
+	}
+	expires := time.Now().Add(resetTTL)
+	token, err := a.newToken(hosts.AuthToken{
+		Kind:      hosts.TokenReset,
+		UserID:    userID,
+		CreatedBy: createdBy,
+		ExpiresAt: expires,
+	})
+	return token, expires, err
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere.
+func (a *Service) ResetPassword(token, password string) error {
+	hash := HashToken(token)
+	reset, err := a.store.GetToken(hash, hosts.TokenReset)
+	if err != nil {
+		return err
+	}
+	if err := a.setPassword(reset.UserID, password); err != nil {
+		return err
+	}
+	return a.store.DeleteUserTokens(reset.UserID)
+}
+
+func (a *Service) setPassword(userID, password string) error {
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := a.store.UpdateUser(userID, func(u *types.User) {
+		u.PasswordHash = hash
+	}); err != nil {
+		return err
+	}
+	a.Replicate()
+	return nil
+}
+
+func (a *Service) newToken(t hosts.AuthToken) (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	t.Hash = HashToken(token)
+	if err := a.store.CreateToken(t); err != nil {
+		return "", err
+	}
+	return token, nil
+}
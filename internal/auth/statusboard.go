@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// StatusBoardSettingKey is the settings key for status board access.
+const StatusBoardSettingKey = "status_board"
+
+// StatusBoardConfig opens the read-only status board to wall displays that
+// cannot sign in. Signed-in users can always view the board.
+type StatusBoardConfig struct {
+	// Enabled serves the board without a session.
+	Enabled bool `json:"enabled"`
+	// Token must then be given as ?token=; empty makes the board public.
+	Token string `json:"token,omitempty"`
+}
+
+// statusBoardPaths are the board page and its update stream.
+var statusBoardPaths = map[string]bool{
+	"/status-board":        true,
+	"/status-board/stream": true,
+}
+
+// LoadStatusBoard reads the status board access settings.
+func (a *Service) LoadStatusBoard() (StatusBoardConfig, error) {
+	var cfg StatusBoardConfig
+	_, err := a.store.GetSetting(StatusBoardSettingKey, &cfg)
+	return cfg, err
+}
+
+// SaveStatusBoard stores the status board access settings. With
+// requireToken, the board keeps its token unless rotate is set or it has
+// none yet, in which case a new one is issued.
+func (a *Service) SaveStatusBoard(enabled, requireToken, rotate bool) (StatusBoardConfig, error) {
+	cfg, err := a.LoadStatusBoard()
+	if err != nil {
+		return StatusBoardConfig{}, err
+	}
+	cfg.Enabled = enabled
+	switch {
+	case !requireToken:
+		cfg.Token = ""
+	case rotate || cfg.Token == "":
+		if cfg.Token, err = NewToken(); err != nil {
+			return StatusBoardConfig{}, err
+		}
+	}
+	if err := a.store.PutSetting(StatusBoardSettingKey, cfg); err != nil {
+		return StatusBoardConfig{}, err
+	}
+	return cfg, nil
+}
+
+// statusBoardAllows reports whether r may view the board without a
+// session.
+func (a *Service) statusBoardAllows(r *http.Request) bool {
+	cfg, err := a.LoadStatusBoard()
+	if err != nil || !cfg.Enabled {
+		return false
+	}
+	if cfg.Token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(cfg.Token)) == 1
+}
@@ -0,0 +1,293 @@
+// Package bandwidth limits the transfers NSM starts itself, so that filling
+// the asset cache or pushing to peers cannot saturate a venue's Wi-Fi and
+// starve the screens. There is one global limit and one per operation; a
+// transfer waits for both. Limits are stored as a setting and applied
+// without a restart.
+package bandwidth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SettingKey is the settings key holding the Config.
+const SettingKey = "bandwidth"
+
+// Op names a kind of transfer.
+type Op string
+
+// Operations that can be limited.
+const (
+	OpCache Op = "cache" // Origin downloads that fill the asset cache
+	OpSync  Op = "sync"  // Host list pushes to peers
+	OpProxy Op = "proxy" // Requests proxied to Anthias, including asset uploads
+)
+
+// Ops lists every operation, in display order.
+var Ops = []Op{OpCache, OpSync, OpProxy}
+
+// chunkSize bounds how much one Read passes before waiting, so a slow limit
+// sends a steady trickle rather than bursts.
+const chunkSize = 16 << 10
+
+// Config holds the limits in kilobits per second; 0 means unlimited.
+type Config struct {
+	GlobalKbps int        `json:"global_kbps"`
+	Limits     map[Op]int `json:"limits_kbps,omitempty"` // By operation
+}
+
+// Validate rejects unusable values.
+func (c *Config) Validate() error {
+	if c.GlobalKbps < 0 {
+		return errors.New("global_kbps cannot be negative")
+	}
+	for op, kbps := range c.Limits {
+		if !validOp(op) {
+			return fmt.Errorf("unknown operation %q (use cache, sync or proxy)", op)
+		}
+		if kbps < 0 {
+			return fmt.Errorf("%s limit cannot be negative", op)
+		}
+		if kbps == 0 {
+			delete(c.Limits, op)
+		}
+	}
+	return nil
+}
+
+func validOp(op Op) bool {
+	for _, o := range Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadConfig reads the limits; none are set by default.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	var cfg Config
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the limits.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// limiter is a token bucket. Callers take what they used and sleep off any
+// debt, so concurrent transfers share the rate between them.
+type limiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second; 0 means unlimited
+	tokens float64
+	last   time.Time
+}
+
+func (l *limiter) setKbps(kbps int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = float64(kbps) * 1000 / 8
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// wait blocks until n bytes fit within the rate.
+func (l *limiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	// Allow a quarter second of burst, and at least one chunk.
+	burst := max(l.rate/4, chunkSize)
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, burst)
+	l.last = now
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+// meterWindow is how many seconds the current rate is averaged over.
+const meterWindow = 5
+
+// meter counts bytes, in one-second buckets for the current rate.
+type meter struct {
+	mu      sync.Mutex
+	total   int64
+	buckets [meterWindow + 1]int64
+	seconds [meterWindow + 1]int64 // Unix second each bucket holds
+}
+
+func (m *meter) add(n int, now time.Time) {
+	sec := now.Unix()
+	i := sec % int64(len(m.buckets))
+	m.mu.Lock()
+	m.total += int64(n)
+	if m.seconds[i] != sec {
+		m.seconds[i], m.buckets[i] = sec, 0
+	}
+	m.buckets[i] += int64(n)
+	m.mu.Unlock()
+}
+
+// read returns the total and the mean rate over the last meterWindow full
+// seconds.
+func (m *meter) read(now time.Time) (int64, int64) {
+	sec := now.Unix()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var recent int64
+	for i, s := range m.seconds {
+		if s < sec && s >= sec-meterWindow {
+			recent += m.buckets[i]
+		}
+	}
+	return m.total, recent / meterWindow
+}
+
+// Usage is the traffic of one operation since NSM started.
+type Usage struct {
+	Op          Op    `json:"op"`
+	Bytes       int64 `json:"bytes"`         // Total transferred
+	BytesPerSec int64 `json:"bytes_per_sec"` // Averaged over the last few seconds
+	LimitKbps   int   `json:"limit_kbps"`    // 0 if unlimited
+}
+
+type opState struct {
+	limiter
+	meter
+	kbps int
+}
+
+// Manager applies the limits and meters traffic.
+type Manager struct {
+	global     limiter
+	globalKbps int
+	ops        map[Op]*opState
+	mu         sync.Mutex // Guards the kbps fields
+}
+
+// New creates a manager with no limits.
+func New() *Manager {
+	m := &Manager{ops: make(map[Op]*opState)}
+	for _, op := range Ops {
+		m.ops[op] = &opState{}
+	}
+	return m
+}
+
+// Apply replaces the limits. Transfers in progress pick them up on their
+// next read.
+func (m *Manager) Apply(cfg Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.globalKbps = cfg.GlobalKbps
+	m.global.setKbps(cfg.GlobalKbps)
+	for op, st := range m.ops {
+		st.kbps = cfg.Limits[op]
+		st.setKbps(st.kbps)
+	}
+}
+
+// Usage returns the traffic of each operation, followed by their sum with
+// the global limit under Op "total".
+func (m *Manager) Usage() []Usage {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Usage, 0, len(m.ops)+1)
+	total := Usage{Op: "total", LimitKbps: m.globalKbps}
+	for _, op := range Ops {
+		st := m.ops[op]
+		bytes, rate := st.meter.read(now)
+		out = append(out, Usage{Op: op, Bytes: bytes, BytesPerSec: rate, LimitKbps: st.kbps})
+		total.Bytes += bytes
+		total.BytesPerSec += rate
+	}
+	return append(out, total)
+}
+
+// Reader limits and meters reads from r as traffic of op.
+func (m *Manager) Reader(op Op, r io.Reader) io.Reader {
+	st, ok := m.ops[op]
+	if !ok {
+		return r
+	}
+	return &reader{r: r, m: m, st: st}
+}
+
+type reader struct {
+	r  io.Reader
+	m  *Manager
+	st *opState
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.st.meter.add(n, time.Now())
+		r.st.limiter.wait(n)
+		r.m.global.wait(n)
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Transport wraps base (http.DefaultTransport if nil) so that request and
+// response bodies count as traffic of op.
+func (m *Manager) Transport(op Op, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{m: m, op: op, base: base}
+}
+
+type transport struct {
+	m    *Manager
+	op   Op
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = readCloser{t.m.Reader(t.op, req.Body), req.Body}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = readCloser{t.m.Reader(t.op, resp.Body), resp.Body}
+	return resp, nil
+}
+
+// Client returns an HTTP client whose transfers count as op.
+func (m *Manager) Client(op Op, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: m.Transport(op, nil)}
+}
@@ -0,0 +1,98 @@
+package bandwidth
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := Config{GlobalKbps: 10000, Limits: map[Op]int{OpCache: 2000, OpSync: 0}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, ok := cfg.Limits[OpSync]; ok {
+		t.Error("expected a zero limit to be dropped")
+	}
+
+	for _, bad := range []Config{
+		{GlobalKbps: -1},
+		{Limits: map[Op]int{"upgrade": 100}},
+		{Limits: map[Op]int{OpProxy: -5}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+}
+
+func TestReaderLimits(t *testing.T) {
+	m := New()
+	m.Apply(Config{Limits: map[Op]int{OpCache: 800}}) // 100 KB/s
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, m.Reader(OpCache, bytes.NewReader(make([]byte, 64<<10))))
+	if err != nil || n != 64<<10 {
+		t.Fatalf("copy: %d, %v", n, err)
+	}
+	if d := time.Since(start); d < 500*time.Millisecond || d > 3*time.Second {
+		t.Errorf("64 KB at 100 KB/s took %v", d)
+	}
+
+	// Unlimited operations are not held up.
+	start = time.Now()
+	io.Copy(io.Discard, m.Reader(OpSync, bytes.NewReader(make([]byte, 1<<20))))
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("unlimited copy took %v", d)
+	}
+
+	usage := m.Usage()
+	if len(usage) != len(Ops)+1 || usage[0].Op != OpCache || usage[0].Bytes != 64<<10 || usage[0].LimitKbps != 800 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+	if total := usage[len(usage)-1]; total.Op != "total" || total.Bytes != 64<<10+1<<20 {
+		t.Errorf("unexpected total %+v", total)
+	}
+}
+
+func TestMeterRate(t *testing.T) {
+	var m meter
+	now := time.Unix(1000, 0)
+	for i := range 5 {
+		m.add(1000, now.Add(time.Duration(i)*time.Second))
+	}
+	// The current second is still filling and is left out.
+	m.add(99999, now.Add(5*time.Second))
+	if total, rate := m.read(now.Add(5 * time.Second)); total != 104999 || rate != 1000 {
+		t.Errorf("got total %d rate %d", total, rate)
+	}
+	if _, rate := m.read(now.Add(time.Minute)); rate != 0 {
+		t.Errorf("expected old traffic to drop out of the rate, got %d", rate)
+	}
+}
+
+func TestTransportCountsBothDirections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(strings.Repeat("x", 300)))
+	}))
+	defer srv.Close()
+
+	m := New()
+	resp, err := m.Client(OpProxy, 5*time.Second).Post(srv.URL, "text/plain", strings.NewReader(strings.Repeat("y", 200)))
+	if err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	for _, u := range m.Usage() {
+		if u.Op == OpProxy && u.Bytes != 500 {
+			t.Errorf("expected 500 bytes of proxy traffic, got %d", u.Bytes)
+		}
+	}
+}
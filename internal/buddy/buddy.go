@@ -0,0 +1,197 @@
+// Package buddy exchanges nightly database snapshots between nodes, so
+// losing one device never loses the fleet configuration. Each node ships
+// its snapshot to one or two designated peers, its buddies, and keeps the
+// snapshots its peers ship to it within a storage quota. Snapshots are
+// signed by the sending node's key, like heartbeats, and accepted only
+// from nodes whose key a heartbeat has pinned.
+package buddy
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Path is the endpoint snapshots are posted to. The body is the database
+// itself; the signed Manifest travels in Header.
+const (
+	Path   = "/api/peers/backups/receive"
+	Header = "X-NSM-Backup"
+)
+
+// Settings keys used for backup exchange.
+const (
+	ConfigSettingKey = "backup_buddies"
+	StateSettingKey  = "backup_buddies.state"
+)
+
+// Limits: a node ships to at most MaxBuddies peers, and accepts snapshots
+// of at most MaxSize bytes sent within MaxSkew of its clock.
+const (
+	MaxBuddies = 2
+	MaxSize    = 256 << 20
+	MaxSkew    = 5 * time.Minute
+)
+
+var (
+	ErrBadSignature  = errors.New("backup signature is invalid")
+	ErrUnknownSender = errors.New("backup from a node that has not sent a heartbeat")
+	ErrKeyMismatch   = errors.New("backup signed by a different key than the one pinned for the sender")
+	ErrClockSkew     = errors.New("backup send time is too far from this node's clock")
+	ErrNotAccepting  = errors.New("this node does not hold backups for peers")
+	ErrOverQuota     = errors.New("backup is larger than the space for peer backups")
+	ErrMismatch      = errors.New("backup does not match its signed size and checksum")
+)
+
+// Config controls backup exchange. Buddies are the host IDs of the peers
+// this node ships its snapshot to, daily at Hour. Accept, QuotaMB and
+// Keep govern the snapshots peers ship to this node.
+type Config struct {
+	Enabled bool     `json:"enabled"` // Ship this node's snapshot
+	Buddies []string `json:"buddies"`
+	Hour    int      `json:"hour"`
+	Accept  bool     `json:"accept"`   // Hold snapshots shipped by peers
+	QuotaMB int      `json:"quota_mb"` // Total size of snapshots held for peers
+	Keep    int      `json:"keep"`     // Snapshots held per peer
+}
+
+// DefaultConfig is used until an operator saves backup exchange settings.
+func DefaultConfig() Config {
+	return Config{Buddies: []string{}, Hour: 3, Accept: true, QuotaMB: 200, Keep: 3}
+}
+
+// Validate normalises cfg and rejects unusable values.
+func (c *Config) Validate() error {
+	var buddies []string
+	for _, id := range c.Buddies {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(buddies, id) {
+			buddies = append(buddies, id)
+		}
+	}
+	if len(buddies) > MaxBuddies {
+		return fmt.Errorf("at most %d buddies", MaxBuddies)
+	}
+	if c.Enabled && len(buddies) == 0 {
+		return errors.New("at least one buddy is required when backup exchange is enabled")
+	}
+	c.Buddies = append([]string{}, buddies...)
+	if c.Hour < 0 || c.Hour > 23 {
+		return errors.New("hour must be between 0 and 23")
+	}
+	if c.QuotaMB < 1 {
+		return errors.New("quota_mb must be at least 1")
+	}
+	if c.Keep < 1 {
+		return errors.New("keep must be at least 1")
+	}
+	return nil
+}
+
+func (c Config) quotaBytes() int64 {
+	return int64(c.QuotaMB) << 20
+}
+
+// LoadConfig reads the backup exchange settings, falling back to
+// DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(ConfigSettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the backup exchange settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(ConfigSettingKey, cfg)
+}
+
+// Manifest is the signed description of a shipped snapshot.
+type Manifest struct {
+	SenderID  string    `json:"sender_id"`
+	Hostname  string    `json:"hostname,omitempty"`
+	PublicKey string    `json:"public_key"` // Base64 Ed25519 key that signed the envelope
+	SentAt    time.Time `json:"sent_at"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"` // Hex digest of the database
+}
+
+// Envelope carries a manifest and the signature over its exact bytes.
+type Envelope struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Signature string          `json:"signature"`
+}
+
+// Seal encodes and signs a manifest with the node key, as the value of
+// Header.
+func Seal(m Manifest, id *identity.Identity) (string, error) {
+	m.PublicKey = base64.StdEncoding.EncodeToString(id.PublicKey())
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	env, err := json.Marshal(Envelope{
+		Manifest:  raw,
+		Signature: base64.StdEncoding.EncodeToString(id.Sign(raw)),
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(env), nil
+}
+
+// Verify checks the Header value of a shipped snapshot and returns its
+// manifest. It must be signed by the key pinned for the sender and
+// recently sent.
+func Verify(store *hosts.Store, header string, now time.Time) (Manifest, error) {
+	data, err := base64.StdEncoding.DecodeString(header)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("decode backup manifest: %w", err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Manifest{}, fmt.Errorf("decode backup manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(env.Manifest, &m); err != nil {
+		return Manifest{}, fmt.Errorf("decode backup manifest: %w", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(m.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Manifest{}, ErrBadSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || !ed25519.Verify(pub, env.Manifest, sig) {
+		return Manifest{}, ErrBadSignature
+	}
+	if skew := now.Sub(m.SentAt); skew > MaxSkew || skew < -MaxSkew {
+		return Manifest{}, ErrClockSkew
+	}
+
+	sender, err := store.GetPeer(m.SenderID)
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		return Manifest{}, ErrUnknownSender
+	case err != nil:
+		return Manifest{}, err
+	case sender.PublicKey != m.PublicKey:
+		return Manifest{}, ErrKeyMismatch
+	}
+	if _, err := hex.DecodeString(m.SHA256); err != nil || len(m.SHA256) != sha256.Size*2 || m.Size <= 0 {
+		return Manifest{}, ErrMismatch
+	}
+	return m, nil
+}
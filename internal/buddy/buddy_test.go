@@ -0,0 +1,182 @@
+package buddy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+type localHost struct{ id string }
+
+func (l localHost) GetMetadata() (*types.Host, error) {
+	return &types.Host{ID: l.id, Hostname: l.id}, nil
+}
+
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newStore(t *testing.T) *hosts.Store {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// TestShipAndReceive ships a snapshot from node-a to its buddy node-b over
+// a fake transport that hands it to the buddy's Verify and Receive.
+func TestShipAndReceive(t *testing.T) {
+	a, b := newStore(t), newStore(t)
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Add(types.Host{ID: "node-b", IPAddress: "192.168.1.21", Status: types.StatusHealthy})
+	b.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey())})
+	if _, err := SaveConfig(a, Config{Enabled: true, Buddies: []string{"node-b"}, Hour: 3, QuotaMB: 1, Keep: 1}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	now := time.Date(2026, 10, 17, 3, 30, 0, 0, time.Local)
+	var posts int
+	var received Held
+	sender := NewSender(a, id, localHost{"node-a"}, logger.New(100))
+	sender.post = func(addr, manifest string, body io.Reader, size int64) error {
+		posts++
+		if addr != "192.168.1.21" {
+			t.Errorf("expected the buddy's address, got %s", addr)
+		}
+		m, err := Verify(b, manifest, now)
+		if err != nil {
+			return err
+		}
+		received, err = Receive(b, DefaultConfig(), m, body)
+		return err
+	}
+
+	sender.Check(now)
+	sender.Check(now.Add(time.Minute))
+	sender.Check(now.Add(23 * time.Hour)) // Before the next day's hour
+	if posts != 1 {
+		t.Fatalf("expected one shipment a day, got %d", posts)
+	}
+	state, _ := LoadState(a)
+	if ship := state["node-b"]; ship == nil || ship.Error != "" || ship.Size == 0 {
+		t.Fatalf("expected a successful shipment recorded, got %+v", ship)
+	}
+
+	held, err := List(b)
+	if err != nil || len(held) != 1 || held[0] != (Held{NodeID: "node-a", File: received.File, Size: received.Size, SentAt: received.SentAt}) {
+		t.Fatalf("expected the snapshot held, got %+v (%v)", held, err)
+	}
+	path, err := HeldPath(b, "node-a", held[0].File)
+	if err != nil {
+		t.Fatalf("HeldPath: %v", err)
+	}
+	if n, err := hosts.CountBackupHosts(path); err != nil || n != 1 {
+		t.Errorf("expected the sender's host list in the snapshot, got %d (%v)", n, err)
+	}
+	if _, err := HeldPath(b, "node-a", "../hosts.db"); err == nil {
+		t.Error("expected a path outside the peer's directory refused")
+	}
+
+	// A failed shipment is retried after RetryInterval, not every minute.
+	sender.post = func(string, string, io.Reader, int64) error { return errors.New("connection refused") }
+	next := now.AddDate(0, 0, 1)
+	sender.Check(next)
+	sender.Check(next.Add(time.Minute))
+	state, _ = LoadState(a)
+	if ship := state["node-b"]; ship == nil || ship.Error == "" || !ship.Due.Equal(dueSince(DefaultConfig(), now)) {
+		t.Fatalf("expected the failure recorded against yesterday's shipment, got %+v", ship)
+	}
+	posts = 0
+	sender.post = func(string, string, io.Reader, int64) error { posts++; return nil }
+	sender.Check(next.Add(RetryInterval - time.Minute))
+	sender.Check(next.Add(RetryInterval))
+	if posts != 1 {
+		t.Errorf("expected one retry after %s, got %d", RetryInterval, posts)
+	}
+}
+
+func TestReceiveQuota(t *testing.T) {
+	store := newStore(t)
+	src := newStore(t)
+	snap, err := src.OpenExport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	data, _ := io.ReadAll(snap)
+
+	sent := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC)
+	receive := func(cfg Config, node string, at time.Time, body string) error {
+		m := Manifest{SenderID: node, SentAt: at, Size: int64(len(body)), SHA256: digest(body)}
+		_, err := Receive(store, cfg, m, strings.NewReader(body))
+		return err
+	}
+
+	cfg := DefaultConfig()
+	for i := range 4 {
+		if err := receive(cfg, "node-a", sent.AddDate(0, 0, i), string(data)); err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+	}
+	if err := receive(cfg, "node-c", sent, string(data)); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	held, _ := List(store)
+	if len(held) != cfg.Keep+1 || !held[0].SentAt.Equal(sent.AddDate(0, 0, 3)) {
+		t.Fatalf("expected the latest %d of node-a and one of node-c, got %+v", cfg.Keep, held)
+	}
+
+	// Shrinking the quota drops the oldest snapshots, of any peer.
+	cfg.QuotaMB = 1
+	fit := int((1 << 20) / int64(len(data)))
+	for i := range fit {
+		if err := receive(cfg, "node-d", sent.AddDate(0, 0, 10+i), string(data)); err != nil {
+			t.Fatalf("Receive: %v", err)
+		}
+	}
+	held, _ = List(store)
+	var total int64
+	for _, h := range held {
+		total += h.Size
+	}
+	if total > 1<<20 || held[0].NodeID != "node-d" {
+		t.Errorf("expected the held snapshots within 1 MB, got %d bytes in %+v", total, held)
+	}
+
+	if err := receive(cfg, "node-a", sent, "not a database"); !errors.Is(err, hosts.ErrInvalidSnapshot) {
+		t.Errorf("expected a file that is not a database refused, got %v", err)
+	}
+	m := Manifest{SenderID: "node-a", SentAt: sent, Size: int64(len(data)), SHA256: digest("other")}
+	if _, err := Receive(store, cfg, m, strings.NewReader(string(data))); !errors.Is(err, ErrMismatch) {
+		t.Errorf("expected a checksum mismatch refused, got %v", err)
+	}
+	m.Size = 2 << 20
+	if _, err := Receive(store, cfg, m, strings.NewReader(string(data))); !errors.Is(err, ErrOverQuota) {
+		t.Errorf("expected a snapshot over the quota refused, got %v", err)
+	}
+	cfg.Accept = false
+	if err := receive(cfg, "node-a", sent, string(data)); !errors.Is(err, ErrNotAccepting) {
+		t.Errorf("expected snapshots refused when not accepting, got %v", err)
+	}
+	if err := receive(DefaultConfig(), "../node-a", sent, string(data)); err == nil {
+		t.Error("expected a sender ID that is not a plain name refused")
+	}
+}
@@ -0,0 +1,214 @@
+package buddy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// Held describes a snapshot this node holds for a peer.
+type Held struct {
+	NodeID   string    `json:"node_id"`
+	Hostname string    `json:"hostname,omitempty"`
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Dir returns the directory holding snapshots shipped by peers, one
+// subdirectory per sending node.
+func Dir(store *hosts.Store) string {
+	return filepath.Join(store.Dir(), "backups", "peers")
+}
+
+// validNodeID reports whether id is safe to use as a directory name.
+func validNodeID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// fileName names a held snapshot after its send time.
+func fileName(sentAt time.Time) string {
+	return fmt.Sprintf("hosts-%d.db", sentAt.Unix())
+}
+
+// sentAt parses the send time back from a held snapshot's name.
+func sentAt(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, "hosts-")
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, ".db")
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0).UTC(), true
+}
+
+// Receive keeps the snapshot described by m, read from body, then prunes
+// the sender's older snapshots past cfg.Keep and the oldest of all held
+// snapshots until they fit cfg.QuotaMB.
+func Receive(store *hosts.Store, cfg Config, m Manifest, body io.Reader) (Held, error) {
+	if !cfg.Accept {
+		return Held{}, ErrNotAccepting
+	}
+	if !validNodeID(m.SenderID) {
+		return Held{}, fmt.Errorf("invalid sender ID %q", m.SenderID)
+	}
+	if m.Size > cfg.quotaBytes() || m.Size > MaxSize {
+		return Held{}, ErrOverQuota
+	}
+
+	dir := filepath.Join(Dir(store), m.SenderID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return Held{}, fmt.Errorf("create peer backup directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".receive-*.tmp")
+	if err != nil {
+		return Held{}, fmt.Errorf("create peer backup: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	sum := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, sum), io.LimitReader(body, m.Size+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Held{}, fmt.Errorf("write peer backup: %w", err)
+	}
+	if n != m.Size || hex.EncodeToString(sum.Sum(nil)) != m.SHA256 {
+		return Held{}, ErrMismatch
+	}
+	if err := hosts.ValidateSnapshot(tmp.Name()); err != nil {
+		return Held{}, err
+	}
+
+	name := fileName(m.SentAt)
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return Held{}, fmt.Errorf("store peer backup: %w", err)
+	}
+	held := Held{NodeID: m.SenderID, Hostname: m.Hostname, File: name, Size: n, SentAt: m.SentAt.UTC()}
+	if err := prune(store, cfg, held); err != nil {
+		return held, err
+	}
+	return held, nil
+}
+
+// prune removes the sender's snapshots past cfg.Keep, then the oldest held
+// snapshots of any peer until the total fits the quota. kept, the snapshot
+// just received, is never removed.
+func prune(store *hosts.Store, cfg Config, kept Held) error {
+	list, err := List(store)
+	if err != nil {
+		return err
+	}
+	var total int64
+	var rest []Held
+	perNode := make(map[string]int)
+	for _, h := range list { // Newest first
+		if h.NodeID == kept.NodeID && h.File == kept.File {
+			total += h.Size
+			perNode[h.NodeID]++
+			continue
+		}
+		if perNode[h.NodeID] >= cfg.Keep {
+			if err := remove(store, h); err != nil {
+				return err
+			}
+			continue
+		}
+		perNode[h.NodeID]++
+		total += h.Size
+		rest = append(rest, h)
+	}
+	for i := len(rest) - 1; i >= 0 && total > cfg.quotaBytes(); i-- {
+		if err := remove(store, rest[i]); err != nil {
+			return err
+		}
+		total -= rest[i].Size
+	}
+	return nil
+}
+
+func remove(store *hosts.Store, h Held) error {
+	if err := os.Remove(filepath.Join(Dir(store), h.NodeID, h.File)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("prune peer backup: %w", err)
+	}
+	return nil
+}
+
+// List returns the snapshots held for peers, newest first. Hostnames come
+// from the host list.
+func List(store *hosts.Store) ([]Held, error) {
+	list := []Held{}
+	nodes, err := os.ReadDir(Dir(store))
+	if errors.Is(err, os.ErrNotExist) {
+		return list, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list peer backups: %w", err)
+	}
+	for _, node := range nodes {
+		if !node.IsDir() || !validNodeID(node.Name()) {
+			continue
+		}
+		var hostname string
+		if h, err := store.GetByID(node.Name()); err == nil {
+			hostname = h.Hostname
+		}
+		files, err := os.ReadDir(filepath.Join(Dir(store), node.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("list peer backups: %w", err)
+		}
+		for _, f := range files {
+			at, ok := sentAt(f.Name())
+			info, err := f.Info()
+			if !ok || err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			list = append(list, Held{NodeID: node.Name(), Hostname: hostname, File: f.Name(), Size: info.Size(), SentAt: at})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].SentAt.Equal(list[j].SentAt) {
+			return list[i].SentAt.After(list[j].SentAt)
+		}
+		return list[i].NodeID < list[j].NodeID
+	})
+	return list, nil
+}
+
+// HeldPath returns the path of a snapshot held for node, or an error
+// wrapping os.ErrNotExist if there is none by that name.
+func HeldPath(store *hosts.Store, node, file string) (string, error) {
+	if _, ok := sentAt(file); !ok || !validNodeID(node) || filepath.Base(file) != file {
+		return "", fmt.Errorf("peer backup %s/%s: %w", node, file, os.ErrNotExist)
+	}
+	path := filepath.Join(Dir(store), node, file)
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("peer backup %s/%s: %w", node, file, os.ErrNotExist)
+	}
+	return path, nil
+}
@@ -0,0 +1,226 @@
+package buddy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// RetryInterval is how long a failed shipment waits before it is tried
+// again, until the next day's snapshot is due.
+const RetryInterval = 30 * time.Minute
+
+// LocalProvider identifies the node shipping its snapshot.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// Shipment records the latest snapshot shipped to a buddy.
+type Shipment struct {
+	Due       time.Time `json:"due"`                 // Daily run the snapshot was shipped for
+	SentAt    time.Time `json:"sent_at,omitzero"`    // Last successful shipment
+	Size      int64     `json:"size,omitempty"`      // Of the last successful shipment
+	AttemptAt time.Time `json:"attempt_at,omitzero"` // Last attempt, successful or not
+	Error     string    `json:"error,omitempty"`     // Why the last attempt failed
+}
+
+// LoadState returns the latest shipment to each buddy, by host ID.
+func LoadState(store hosts.SettingStore) (map[string]*Shipment, error) {
+	state := make(map[string]*Shipment)
+	if _, err := store.GetSetting(StateSettingKey, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Sender ships this node's snapshot to its buddies once a day.
+type Sender struct {
+	store    *hosts.Store
+	id       *identity.Identity
+	local    LocalProvider
+	logger   *logger.Logger
+	interval time.Duration
+	post     func(addr, manifest string, body io.Reader, size int64) error
+}
+
+// NewSender creates a sender that checks every minute whether a snapshot
+// is due and posts it to each buddy's Path.
+func NewSender(store *hosts.Store, id *identity.Identity, local LocalProvider, lg *logger.Logger) *Sender {
+	return &Sender{store: store, id: id, local: local, logger: lg, interval: time.Minute, post: postBackup}
+}
+
+// Run ships snapshots until the process exits. Without a node identity
+// there is nothing to sign with, so it does not run.
+func (s *Sender) Run() {
+	if s.id == nil {
+		return
+	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		s.Check(time.Now())
+	}
+}
+
+// Check ships the day's snapshot to the buddies that have not had it, once
+// cfg.Hour has passed; a new buddy gets one straight away. A failed
+// shipment is retried after RetryInterval.
+func (s *Sender) Check(now time.Time) {
+	cfg, err := LoadConfig(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Backup exchange: failed to load settings: %v", err))
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+	state, err := LoadState(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Backup exchange: failed to load state: %v", err))
+		return
+	}
+
+	due := dueSince(cfg, now)
+	var pending []string
+	for _, buddy := range cfg.Buddies {
+		ship := state[buddy]
+		if ship != nil && (!ship.Due.Before(due) || now.Sub(ship.AttemptAt) < RetryInterval) {
+			continue
+		}
+		pending = append(pending, buddy)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	next := make(map[string]*Shipment, len(cfg.Buddies))
+	for _, buddy := range cfg.Buddies {
+		next[buddy] = state[buddy]
+	}
+	for buddy, ship := range s.Ship(pending, now) {
+		if ship.Error == "" {
+			ship.Due = due
+		} else if prev := state[buddy]; prev != nil {
+			ship.Due, ship.SentAt, ship.Size = prev.Due, prev.SentAt, prev.Size
+		}
+		next[buddy] = ship
+	}
+	// Shipments to removed buddies are dropped.
+	if err := s.store.PutSetting(StateSettingKey, next); err != nil {
+		s.logger.Warning(fmt.Sprintf("Backup exchange: failed to save state: %v", err))
+	}
+}
+
+// Ship sends a fresh snapshot to each of the buddies and reports how each
+// shipment went.
+func (s *Sender) Ship(buddies []string, now time.Time) map[string]*Shipment {
+	out := make(map[string]*Shipment, len(buddies))
+	fail := func(err error) map[string]*Shipment {
+		for _, buddy := range buddies {
+			out[buddy] = &Shipment{AttemptAt: now.UTC(), Error: err.Error()}
+		}
+		s.logger.Warning(fmt.Sprintf("Backup exchange: failed to prepare snapshot: %v", err))
+		return out
+	}
+
+	self, err := s.local.GetMetadata()
+	if err != nil {
+		return fail(err)
+	}
+	hostname := self.Hostname
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hostname = h
+	}
+	snap, err := s.store.OpenExport()
+	if err != nil {
+		return fail(err)
+	}
+	defer snap.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, snap); err != nil {
+		return fail(err)
+	}
+	manifest := Manifest{SenderID: self.ID, Hostname: hostname, SentAt: now.UTC(), Size: snap.Size(), SHA256: hex.EncodeToString(sum.Sum(nil))}
+	header, err := Seal(manifest, s.id)
+	if err != nil {
+		return fail(err)
+	}
+
+	for _, buddy := range buddies {
+		ship := &Shipment{AttemptAt: now.UTC()}
+		out[buddy] = ship
+		err := s.shipTo(buddy, self.ID, header, snap)
+		if err != nil {
+			ship.Error = err.Error()
+			s.logger.Warning(fmt.Sprintf("Backup exchange: failed to ship snapshot to %s: %v", buddy, err))
+			continue
+		}
+		ship.SentAt, ship.Size = now.UTC(), snap.Size()
+		s.logger.Info(fmt.Sprintf("Backup exchange: shipped snapshot (%d bytes) to %s", snap.Size(), buddy))
+	}
+	return out
+}
+
+func (s *Sender) shipTo(buddy, selfID, header string, snap *hosts.Export) error {
+	if buddy == selfID {
+		return fmt.Errorf("a node cannot be its own buddy")
+	}
+	peer, err := s.store.GetByID(buddy)
+	if err != nil {
+		return err
+	}
+	path := hosts.SelectPath(*peer)
+	if !path.Healthy() {
+		return fmt.Errorf("%s is not reachable", path.Address)
+	}
+	if _, err := snap.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.post(path.Address, header, snap, snap.Size())
+}
+
+// dueSince returns the most recent daily shipping time at or before now.
+func dueSince(cfg Config, now time.Time) time.Time {
+	due := time.Date(now.Year(), now.Month(), now.Day(), cfg.Hour, 0, 0, 0, now.Location())
+	if now.Before(due) {
+		due = due.AddDate(0, 0, -1)
+	}
+	return due
+}
+
+// postBackup streams a snapshot to a buddy's API. Snapshots are too large
+// for the peer bus, so they go over plain HTTP. body is not closed: the
+// same snapshot goes to each buddy.
+func postBackup(addr, manifest string, body io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPost, "http://"+net.JoinHostPort(addr, peerbus.DefaultPort)+Path, io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/vnd.sqlite3")
+	req.Header.Set(Header, manifest)
+	client := http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
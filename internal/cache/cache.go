@@ -0,0 +1,351 @@
+// Package cache keeps local copies of web and video assets so that the
+// displays at a venue fetch each one over the uplink once. Anthias assets
+// are pointed at /cache?url=... on an NSM node, which serves the stored
+// copy and re-fetches it from the origin once it is older than the TTL.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SettingKey is the settings key holding the cache Config.
+const SettingKey = "cache"
+
+// ErrTooLarge is returned for assets bigger than the whole cache; they are
+// better fetched from the origin directly.
+var ErrTooLarge = errors.New("asset is larger than the cache")
+
+// Config controls the cache.
+type Config struct {
+	Enabled    bool `json:"enabled"`
+	MaxMB      int  `json:"max_mb"`      // Total size of stored assets
+	TTLMinutes int  `json:"ttl_minutes"` // Age after which a copy is revalidated with the origin
+}
+
+// DefaultConfig is used until an operator saves cache settings.
+func DefaultConfig() Config {
+	return Config{MaxMB: 1024, TTLMinutes: 24 * 60}
+}
+
+// Validate rejects unusable values.
+func (c *Config) Validate() error {
+	if c.MaxMB < 1 {
+		return errors.New("max_mb must be at least 1")
+	}
+	if c.TTLMinutes < 1 {
+		return errors.New("ttl_minutes must be at least 1")
+	}
+	return nil
+}
+
+func (c Config) maxBytes() int64 {
+	return int64(c.MaxMB) << 20
+}
+
+func (c Config) ttl() time.Duration {
+	return time.Duration(c.TTLMinutes) * time.Minute
+}
+
+// LoadConfig reads the cache settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the cache settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// Entry describes a stored asset.
+type Entry struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"` // Last fetched or revalidated
+	LastUsed     time.Time `json:"last_used"`
+	Hits         int64     `json:"hits"`
+}
+
+// Cache stores assets as files in a directory, one data file and one JSON
+// metadata file per URL. The least recently used assets are evicted when
+// the total size goes over the limit.
+type Cache struct {
+	dir    string
+	client *http.Client
+
+	mu       sync.Mutex
+	entries  map[string]*Entry
+	inflight map[string]chan struct{}
+}
+
+// New opens the cache in dir, creating it if needed.
+func New(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+	c := &Cache{
+		dir:      dir,
+		client:   &http.Client{Timeout: 10 * time.Minute},
+		entries:  make(map[string]*Entry),
+		inflight: make(map[string]chan struct{}),
+	}
+
+	metas, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, meta := range metas {
+		data, err := os.ReadFile(meta)
+		if err != nil {
+			continue
+		}
+		var e Entry
+		key := strings.TrimSuffix(filepath.Base(meta), ".json")
+		if json.Unmarshal(data, &e) != nil || key != keyFor(e.URL) {
+			continue
+		}
+		if _, err := os.Stat(c.dataPath(key)); err != nil {
+			continue
+		}
+		c.entries[key] = &e
+	}
+	return c, nil
+}
+
+// SetTransport sends origin fetches through rt, e.g. a bandwidth limiter.
+func (c *Cache) SetTransport(rt http.RoundTripper) {
+	c.client.Transport = rt
+}
+
+func keyFor(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) dataPath(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+func (c *Cache) metaPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the stored copy of url, fetching or revalidating it first if
+// needed. hit reports whether the origin was not contacted. If the origin
+// cannot be reached, a stale copy is returned rather than an error.
+func (c *Cache) Get(url string, cfg Config) (path string, e Entry, hit bool, err error) {
+	key := keyFor(url)
+	now := time.Now().UTC()
+
+	c.mu.Lock()
+	for {
+		ch, busy := c.inflight[key]
+		if !busy {
+			break
+		}
+		c.mu.Unlock()
+		<-ch
+		c.mu.Lock()
+	}
+
+	cur := c.entries[key]
+	if cur != nil && now.Sub(cur.FetchedAt) < cfg.ttl() {
+		cur.LastUsed = now
+		cur.Hits++
+		e = *cur
+		c.mu.Unlock()
+		return c.dataPath(key), e, true, nil
+	}
+
+	done := make(chan struct{})
+	c.inflight[key] = done
+	var prev Entry
+	if cur != nil {
+		prev = *cur
+	}
+	c.mu.Unlock()
+
+	fetched, err := c.fetch(key, url, prev, cfg.maxBytes())
+
+	c.mu.Lock()
+	defer func() {
+		delete(c.inflight, key)
+		close(done)
+		c.mu.Unlock()
+	}()
+
+	if err != nil {
+		if cur != nil && !errors.Is(err, ErrTooLarge) {
+			cur.LastUsed = now
+			cur.Hits++
+			return c.dataPath(key), *cur, true, nil
+		}
+		return "", Entry{}, false, err
+	}
+
+	fetched.LastUsed = now
+	fetched.Hits = prev.Hits + 1
+	c.entries[key] = &fetched
+	c.writeMeta(key, fetched)
+	c.evictLocked(cfg.maxBytes())
+	return c.dataPath(key), fetched, false, nil
+}
+
+// fetch downloads url, or revalidates prev when it has validators.
+func (c *Cache) fetch(key, url string, prev Entry, maxBytes int64) (Entry, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return Entry{}, err
+	}
+	if prev.URL != "" {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer resp.Body.Close()
+
+	now := time.Now().UTC()
+	if resp.StatusCode == http.StatusNotModified && prev.URL != "" {
+		prev.FetchedAt = now
+		return prev, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Entry{}, fmt.Errorf("origin returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes {
+		return Entry{}, ErrTooLarge
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "fetch-*")
+	if err != nil {
+		return Entry{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(resp.Body, maxBytes+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Entry{}, fmt.Errorf("download: %w", err)
+	}
+	if n > maxBytes {
+		return Entry{}, ErrTooLarge
+	}
+	if err := os.Rename(tmp.Name(), c.dataPath(key)); err != nil {
+		return Entry{}, err
+	}
+
+	return Entry{
+		URL:          url,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Size:         n,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    now,
+	}, nil
+}
+
+func (c *Cache) writeMeta(key string, e Entry) {
+	if data, err := json.Marshal(e); err == nil {
+		os.WriteFile(c.metaPath(key), data, 0o600)
+	}
+}
+
+// evictLocked removes the least recently used assets until the total fits
+// in maxBytes. The caller holds c.mu.
+func (c *Cache) evictLocked(maxBytes int64) {
+	var total int64
+	keys := make([]string, 0, len(c.entries))
+	for key, e := range c.entries {
+		total += e.Size
+		keys = append(keys, key)
+	}
+	if total <= maxBytes {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].LastUsed.Before(c.entries[keys[j]].LastUsed)
+	})
+	for _, key := range keys {
+		if total <= maxBytes {
+			break
+		}
+		if _, busy := c.inflight[key]; busy {
+			continue
+		}
+		total -= c.entries[key].Size
+		c.removeLocked(key)
+	}
+}
+
+func (c *Cache) removeLocked(key string) {
+	delete(c.entries, key)
+	os.Remove(c.dataPath(key))
+	os.Remove(c.metaPath(key))
+}
+
+// Purge removes url from the cache, or everything if url is empty, and
+// returns how many assets were removed.
+func (c *Cache) Purge(url string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if url != "" {
+		key := keyFor(url)
+		if _, ok := c.entries[key]; !ok {
+			return 0
+		}
+		c.removeLocked(key)
+		return 1
+	}
+	n := len(c.entries)
+	for key := range c.entries {
+		c.removeLocked(key)
+	}
+	return n
+}
+
+// List returns the stored assets, most recently used first, and their total
+// size.
+func (c *Cache) List() ([]Entry, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	out := make([]Entry, 0, len(c.entries))
+	for _, e := range c.entries {
+		out = append(out, *e)
+		total += e.Size
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LastUsed.After(out[j].LastUsed) })
+	return out, total
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte(strings.Repeat("x", 600<<10)))
+	}))
+	defer srv.Close()
+
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	cfg := Config{Enabled: true, MaxMB: 1, TTLMinutes: 60}
+
+	path, e, hit, err := c.Get(srv.URL+"/a.png", cfg)
+	if err != nil || hit || e.ContentType != "image/png" || e.Size != 600<<10 {
+		t.Fatalf("first Get: hit=%v entry=%+v err=%v", hit, e, err)
+	}
+	if data, _ := os.ReadFile(path); len(data) != 600<<10 {
+		t.Errorf("expected the asset on disk, got %d bytes", len(data))
+	}
+
+	if _, _, hit, _ := c.Get(srv.URL+"/a.png", cfg); !hit || fetches.Load() != 1 {
+		t.Errorf("expected a hit without contacting the origin, got hit=%v after %d fetches", hit, fetches.Load())
+	}
+
+	// Once stale, the copy is revalidated rather than downloaded again.
+	c.entries[keyFor(srv.URL+"/a.png")].FetchedAt = time.Now().Add(-2 * time.Hour)
+	if _, e, _, err := c.Get(srv.URL+"/a.png", cfg); err != nil || fetches.Load() != 2 || time.Since(e.FetchedAt) > time.Minute {
+		t.Errorf("expected revalidation, got entry=%+v err=%v", e, err)
+	}
+
+	// A second asset pushes the total over 1 MB and evicts the first.
+	if _, _, _, err := c.Get(srv.URL+"/b.png", cfg); err != nil {
+		t.Fatalf("Get b: %v", err)
+	}
+	entries, total := c.List()
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].URL, "/b.png") || total != 600<<10 {
+		t.Errorf("expected only b to remain, got %+v", entries)
+	}
+
+	// Entries survive reopening the cache.
+	reopened, err := New(c.dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if entries, _ := reopened.List(); len(entries) != 1 {
+		t.Errorf("expected 1 entry after reopening, got %d", len(entries))
+	}
+
+	if n := c.Purge(srv.URL + "/b.png"); n != 1 {
+		t.Errorf("expected to purge 1 asset, got %d", n)
+	}
+	if entries, _ := c.List(); len(entries) != 0 {
+		t.Errorf("expected an empty cache after purging, got %+v", entries)
+	}
+}
+
+func TestGetTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 2<<20))
+	}))
+	defer srv.Close()
+
+	c, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, _, _, err := c.Get(srv.URL, Config{MaxMB: 1, TTLMinutes: 60}); err != ErrTooLarge {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package calendar
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+const feed = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"SUMMARY:Team stand-up\\, daily\r\n" +
+	"CATEGORIES:Internal\r\n" +
+	"DTSTART;TZID=America/New_York:20261012T090000\r\n" +
+	"DURATION:PT30M\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=FR,MO,WE;COUNT=5\r\n" +
+	"EXDATE;TZID=America/New_York:20261014T090000\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT5M\r\n" +
+	"SUMMARY:Not an event\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup\r\n" +
+	"RECURRENCE-ID;TZID=America/New_York:20261016T090000\r\n" +
+	"SUMMARY:Team stand-up (moved)\r\n" +
+	"CATEGORIES:Internal\r\n" +
+	"DTSTART:20261016T150000Z\r\n" +
+	"DTEND:20261016T153000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:offsite\r\n" +
+	"SUMMARY:Off\r\n" +
+	" site\r\n" +
+	"DTSTART;VALUE=DATE:20261020\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:cancelled\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART:20261013T150000Z\r\n" +
+	"DTEND:20261013T160000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestOccurrences(t *testing.T) {
+	events, err := parse(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	got := occurrences(events, from, from.AddDate(0, 1, 0))
+
+	var summary []string
+	for _, e := range got {
+		summary = append(summary, e.Start.UTC().Format("Jan 2 15:04")+" "+e.Summary)
+	}
+	// The series runs Mon 12, Wed 14 (excluded), Fri 16 (moved), Mon 19
+	// and Wed 21: five occurrences counting the excluded one.
+	want := []string{
+		"Oct 12 13:00 Team stand-up, daily",
+		"Oct 16 15:00 Team stand-up (moved)",
+		"Oct 19 13:00 Team stand-up, daily",
+		"Oct 20 " + time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local).UTC().Format("15:04") + " Offsite",
+		"Oct 21 13:00 Team stand-up, daily",
+	}
+	if fmt.Sprint(summary) != fmt.Sprint(want) {
+		t.Errorf("got %q\nwant %q", summary, want)
+	}
+	if got[0].End.Sub(got[0].Start) != 30*time.Minute || got[3].End.Sub(got[3].Start) != 24*time.Hour {
+		t.Errorf("unexpected durations %v and %v", got[0].End.Sub(got[0].Start), got[3].End.Sub(got[3].Start))
+	}
+
+	if _, err := parse(strings.NewReader("<html>")); err != ErrNotCalendar {
+		t.Errorf("expected ErrNotCalendar, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "1", IPAddress: "10.0.0.1"})
+	store.SaveSnapshot("normal", "")
+	store.Add(types.Host{ID: "2", IPAddress: "10.0.0.2"})
+	store.SaveSnapshot("meeting", "")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\n"+
+			"BEGIN:VEVENT\r\nUID:board\r\nSUMMARY:Board meeting\r\nCATEGORIES:Meeting,Board\r\n"+
+			"DTSTART:20261016T100000Z\r\nDTEND:20261016T110000Z\r\nEND:VEVENT\r\n"+
+			"BEGIN:VEVENT\r\nUID:lunch\r\nSUMMARY:Lunch\r\nCATEGORIES:Social\r\n"+
+			"DTSTART:20261016T120000Z\r\nDTEND:20261016T130000Z\r\nEND:VEVENT\r\n"+
+			"END:VCALENDAR\r\n")
+	}))
+	defer srv.Close()
+	if _, err := SaveConfig(store, Config{
+		Enabled:       true,
+		DefaultPreset: "normal",
+		Feeds:         []Feed{{Name: "Room 1", URL: srv.URL, Mappings: []Mapping{{Category: "meeting", Preset: "meeting"}}}},
+	}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	s := NewScheduler(store, logger.New(10))
+	check := func(at string, wantHosts int, wantPreset string) {
+		t.Helper()
+		now, _ := time.Parse(time.RFC3339, at)
+		s.Check(now)
+		state, _ := LoadState(store)
+		if n := len(store.GetAll()); n != wantHosts || state.Preset != wantPreset {
+			t.Errorf("%s: got %d hosts and preset %q, want %d and %q", at, n, state.Preset, wantHosts, wantPreset)
+		}
+	}
+	check("2026-10-16T09:00:00Z", 1, "normal")
+	state, _ := LoadState(store)
+	if len(state.Upcoming) != 1 || state.Upcoming[0].Summary != "Board meeting" || state.Feeds[0].Events != 2 {
+		t.Errorf("expected the board meeting upcoming, got %+v", state)
+	}
+
+	check("2026-10-16T10:00:00Z", 2, "meeting")
+	// A change made during the booking is left alone until it ends.
+	store.DeleteByID("2")
+	check("2026-10-16T10:30:00Z", 1, "meeting")
+	check("2026-10-16T11:00:00Z", 1, "normal")
+	check("2026-10-16T12:30:00Z", 1, "normal") // Lunch is not mapped
+
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: AuditPresetRestored})
+	if len(entries) != 3 {
+		t.Errorf("expected 3 restores to be audited, got %d", len(entries))
+	}
+}
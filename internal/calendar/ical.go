@@ -0,0 +1,397 @@
+package calendar
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one occurrence of a calendar event.
+type Event struct {
+	UID        string    `json:"uid"`
+	Summary    string    `json:"summary"`
+	Categories []string  `json:"categories,omitempty"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+}
+
+// vevent is a VEVENT as read from a feed: its first occurrence and how it
+// repeats.
+type vevent struct {
+	Event
+	rule         *rrule
+	exdates      map[int64]bool // Unix start times of skipped occurrences
+	recurrenceID time.Time      // Set on an edited occurrence of a repeating event
+	cancelled    bool
+}
+
+// rrule is the part of an RFC 5545 recurrence rule that booking systems
+// use: daily, weekly on given days, or monthly on the start's day.
+type rrule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+// maxSteps bounds the expansion of a rule, for feeds with long-running
+// daily events.
+const maxSteps = 100000
+
+// ErrNotCalendar is returned for a document that is not an iCalendar.
+var ErrNotCalendar = errors.New("not an iCalendar feed")
+
+// parse reads the events of an iCalendar document. Events it cannot read
+// are skipped, so one odd entry does not hide the rest of a room's
+// bookings.
+func parse(r io.Reader) ([]vevent, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, ErrNotCalendar
+	}
+
+	var events []vevent
+	var cur *vevent
+	var duration time.Duration
+	var allDay bool
+	depth := 0 // Components nested in the event, such as VALARM
+	for _, line := range lines {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			cur, duration, allDay, depth = &vevent{exdates: make(map[int64]bool)}, 0, false, 0
+			continue
+		case cur == nil:
+			continue
+		case name == "BEGIN":
+			depth++
+			continue
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if cur.End.IsZero() {
+				cur.End = cur.Start.Add(duration)
+				if duration == 0 && allDay {
+					cur.End = cur.Start.AddDate(0, 0, 1)
+				}
+			}
+			if !cur.Start.IsZero() && !cur.End.Before(cur.Start) {
+				events = append(events, *cur)
+			}
+			cur = nil
+			continue
+		case name == "END":
+			depth--
+			continue
+		case depth > 0:
+			continue
+		}
+
+		switch name {
+		case "UID":
+			cur.UID = value
+		case "SUMMARY":
+			cur.Summary = unescape(value)
+		case "CATEGORIES":
+			for _, c := range splitList(value) {
+				if c = strings.TrimSpace(unescape(c)); c != "" {
+					cur.Categories = append(cur.Categories, c)
+				}
+			}
+		case "STATUS":
+			cur.cancelled = strings.EqualFold(value, "CANCELLED")
+		case "DTSTART":
+			cur.Start, _ = parseTime(value, params)
+			allDay = len(value) == 8
+		case "DTEND":
+			cur.End, _ = parseTime(value, params)
+		case "DURATION":
+			duration, _ = parseDuration(value)
+		case "RRULE":
+			cur.rule, _ = parseRule(value)
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				if t, err := parseTime(v, params); err == nil {
+					cur.exdates[t.Unix()] = true
+				}
+			}
+		case "RECURRENCE-ID":
+			cur.recurrenceID, _ = parseTime(value, params)
+		}
+	}
+
+	// An edited occurrence replaces the one its series would have had.
+	for _, e := range events {
+		if e.recurrenceID.IsZero() {
+			continue
+		}
+		for i := range events {
+			if events[i].UID == e.UID && events[i].recurrenceID.IsZero() {
+				events[i].exdates[e.recurrenceID.Unix()] = true
+			}
+		}
+	}
+	return events, nil
+}
+
+// occurrences returns the occurrences of events that overlap [from, to),
+// sorted by start.
+func occurrences(events []vevent, from, to time.Time) []Event {
+	var out []Event
+	for _, e := range events {
+		if e.cancelled {
+			continue
+		}
+		length := e.End.Sub(e.Start)
+		e.each(to, func(start time.Time) {
+			if start.Add(length).After(from) && !e.exdates[start.Unix()] {
+				occ := e.Event
+				occ.Start, occ.End = start, start.Add(length)
+				out = append(out, occ)
+			}
+		})
+	}
+	slices.SortStableFunc(out, func(a, b Event) int { return a.Start.Compare(b.Start) })
+	return out
+}
+
+// each calls fn with the start of every occurrence of e that begins before
+// to.
+func (e vevent) each(to time.Time, fn func(time.Time)) {
+	r := e.rule
+	if r == nil {
+		if e.Start.Before(to) {
+			fn(e.Start)
+		}
+		return
+	}
+
+	n := 0
+	emit := func(t time.Time) bool {
+		if t.Before(e.Start) {
+			return true
+		}
+		if !t.Before(to) || (!r.until.IsZero() && t.After(r.until)) || (r.count > 0 && n >= r.count) {
+			return false
+		}
+		n++
+		fn(t)
+		return true
+	}
+	for step := 0; step < maxSteps; step++ {
+		switch r.freq {
+		case "DAILY":
+			if !emit(e.Start.AddDate(0, 0, step*r.interval)) {
+				return
+			}
+		case "WEEKLY":
+			days := r.byDay
+			if len(days) == 0 {
+				days = []time.Weekday{e.Start.Weekday()}
+			}
+			// Weeks start on Monday, as RFC 5545 assumes by default.
+			monday := e.Start.AddDate(0, 0, -((int(e.Start.Weekday())+6)%7)+7*step*r.interval)
+			for _, d := range days {
+				if !emit(monday.AddDate(0, 0, (int(d)+6)%7)) {
+					return
+				}
+			}
+		case "MONTHLY":
+			t := e.Start.AddDate(0, step*r.interval, 0)
+			if t.Day() != e.Start.Day() {
+				continue // No such day this month, e.g. the 31st
+			}
+			if !emit(t) {
+				return
+			}
+		default:
+			emit(e.Start)
+			return
+		}
+	}
+}
+
+// unfold reads content lines, joining those continued on the next line
+// with a leading space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(lines) == 0 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, sc.Err()
+}
+
+// splitProperty splits "NAME;PARAM=VALUE:value". Parameter values may be
+// quoted, and quoted values may contain colons.
+func splitProperty(line string) (string, map[string]string, string) {
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseTime reads a DATE-TIME in UTC, in its TZID, or floating in local
+// time, or a DATE at local midnight. Zone names Go does not know, such as
+// Windows names from Exchange, are read as local time.
+func parseTime(value string, params map[string]string) (time.Time, error) {
+	loc := time.Local
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	switch {
+	case len(value) == 8:
+		return time.ParseInLocation("20060102", value, time.Local)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse("20060102T150405Z", value)
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+// parseDuration reads a DURATION such as PT1H30M, P1D or P2W.
+func parseDuration(value string) (time.Duration, error) {
+	v, ok := strings.CutPrefix(strings.TrimPrefix(value, "+"), "P")
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var d time.Duration
+	inTime := false
+	num := ""
+	for _, c := range v {
+		switch {
+		case c >= '0' && c <= '9':
+			num += string(c)
+		case c == 'T':
+			inTime = true
+		default:
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			num = ""
+			unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}[c]
+			if inTime {
+				unit = map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}[c]
+			}
+			if unit == 0 {
+				return 0, fmt.Errorf("invalid duration %q", value)
+			}
+			d += time.Duration(n) * unit
+		}
+	}
+	return d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseRule reads an RRULE. Rules it cannot expand, such as yearly ones or
+// BYDAY with a position, are an error, and the event is read as a single
+// occurrence.
+func parseRule(value string) (*rrule, error) {
+	r := &rrule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(v)
+			if r.interval < 1 {
+				err = fmt.Errorf("invalid interval %q", v)
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(v)
+		case "UNTIL":
+			r.until, err = parseTime(v, nil)
+			if len(v) == 8 {
+				r.until = r.until.AddDate(0, 0, 1).Add(-time.Second) // Through that day
+			}
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY %q", v)
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", k)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY":
+	default:
+		return nil, fmt.Errorf("unsupported frequency %q", r.freq)
+	}
+	if len(r.byDay) > 0 && r.freq != "WEEKLY" {
+		return nil, fmt.Errorf("unsupported BYDAY for %s", r.freq)
+	}
+	// In week order, so expansion can stop at the first day past the end.
+	slices.SortFunc(r.byDay, func(a, b time.Weekday) int { return (int(a)+6)%7 - (int(b)+6)%7 })
+	return r, nil
+}
+
+// splitList splits a comma-separated value, leaving escaped commas.
+func splitList(value string) []string {
+	var out []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			out = append(out, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, value[start:])
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
@@ -0,0 +1,332 @@
+// Package calendar restores presets from external iCalendar feeds, such as
+// those of room booking systems, so meeting-room displays show the right
+// content while a room is booked.
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hooks"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+)
+
+// Settings keys of the feeds and of the scheduler's state.
+const (
+	SettingKey      = "calendars"
+	StateSettingKey = "calendars.state"
+)
+
+// AuditPresetRestored is the audit action recorded when an event start or
+// end restores a preset.
+const AuditPresetRestored = "calendar.preset_restored"
+
+// Mapping picks the preset for events with a category.
+type Mapping struct {
+	Category string `json:"category"` // Matched against the event's CATEGORIES ignoring case; empty matches every event
+	Preset   string `json:"preset"`
+}
+
+// Feed is a subscribed iCalendar feed.
+type Feed struct {
+	Name     string    `json:"name"`
+	URL      string    `json:"url"` // http, https or webcal
+	Mappings []Mapping `json:"mappings"`
+}
+
+// Config lists the feeds. It is off by default.
+type Config struct {
+	Enabled       bool   `json:"enabled"`
+	Feeds         []Feed `json:"feeds"`
+	DefaultPreset string `json:"default_preset,omitempty"` // Restored while no mapped event is on; empty leaves the host list alone
+}
+
+// Validate normalizes c and checks each feed.
+func (c *Config) Validate() error {
+	if c.Feeds == nil {
+		c.Feeds = []Feed{}
+	}
+	names := make(map[string]bool)
+	for i := range c.Feeds {
+		f := &c.Feeds[i]
+		f.Name = strings.TrimSpace(f.Name)
+		if f.Name == "" {
+			return fmt.Errorf("feed %d: name is required", i+1)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("duplicate feed %q", f.Name)
+		}
+		names[f.Name] = true
+		u, err := url.Parse(strings.TrimSpace(f.URL))
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") {
+			return fmt.Errorf("feed %q: url must be an http, https or webcal URL", f.Name)
+		}
+		f.URL = u.String()
+		if len(f.Mappings) == 0 {
+			return fmt.Errorf("feed %q: add at least one category mapping", f.Name)
+		}
+		for j := range f.Mappings {
+			m := &f.Mappings[j]
+			m.Category = strings.TrimSpace(m.Category)
+			if m.Preset == "" {
+				return fmt.Errorf("feed %q: mapping %d has no preset", f.Name, j+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Presets returns every preset c refers to, for checking they exist.
+func (c Config) Presets() []string {
+	var out []string
+	if c.DefaultPreset != "" {
+		out = append(out, c.DefaultPreset)
+	}
+	for _, f := range c.Feeds {
+		for _, m := range f.Mappings {
+			out = append(out, m.Preset)
+		}
+	}
+	return out
+}
+
+// match returns the preset of the first mapping matching e.
+func (f Feed) match(e Event) (string, bool) {
+	for _, m := range f.Mappings {
+		if m.Category == "" || slices.ContainsFunc(e.Categories, func(c string) bool { return strings.EqualFold(c, m.Category) }) {
+			return m.Preset, true
+		}
+	}
+	return "", false
+}
+
+// LoadConfig reads the feed settings.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := Config{Feeds: []Feed{}}
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the feed settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// Booking is an event occurrence that maps to a preset.
+type Booking struct {
+	Feed   string `json:"feed"`
+	Preset string `json:"preset"`
+	Event
+}
+
+// FeedStatus reports the last fetch of a feed.
+type FeedStatus struct {
+	Name      string    `json:"name"`
+	FetchedAt time.Time `json:"fetched_at,omitzero"`
+	Events    int       `json:"events"` // Events in the feed, before mapping
+	Error     string    `json:"error,omitempty"`
+}
+
+// State is what the scheduler last did and sees coming.
+type State struct {
+	Preset    string       `json:"preset,omitempty"`  // Last preset restored
+	Booking   *Booking     `json:"booking,omitempty"` // The booking that chose it; nil for the default preset
+	AppliedAt time.Time    `json:"applied_at,omitzero"`
+	Error     string       `json:"error,omitempty"` // Why the last restore failed
+	Feeds     []FeedStatus `json:"feeds"`
+	Upcoming  []Booking    `json:"upcoming"` // The next bookings, within a week
+}
+
+// LoadState returns the scheduler's state.
+func LoadState(store hosts.SettingStore) (State, error) {
+	state := State{Feeds: []FeedStatus{}, Upcoming: []Booking{}}
+	if _, err := store.GetSetting(StateSettingKey, &state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// key identifies what chose the preset, so it is restored once per
+// booking rather than on every tick.
+func (s State) key() string {
+	if s.Booking == nil {
+		return "default:" + s.Preset
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d", s.Booking.Feed, s.Booking.UID, s.Booking.Start.Unix())
+}
+
+// feedCache holds a feed's last good events.
+type feedCache struct {
+	url       string
+	events    []vevent
+	fetchedAt time.Time
+	err       error
+}
+
+// Scheduler polls the feeds and restores the preset of the booking that
+// is on, or the default preset between bookings.
+type Scheduler struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	client   *http.Client
+	interval time.Duration // How often bookings are checked
+	refresh  time.Duration // How often feeds are fetched
+	feeds    map[string]*feedCache
+}
+
+// NewScheduler creates a scheduler that checks bookings every minute and
+// fetches feeds every 5 minutes.
+func NewScheduler(store *hosts.Store, lg *logger.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		logger:   lg,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		interval: time.Minute,
+		refresh:  5 * time.Minute,
+		feeds:    make(map[string]*feedCache),
+	}
+}
+
+// Run checks the bookings until the process exits.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		s.Check(time.Now())
+	}
+}
+
+// Check refreshes stale feeds and restores the preset that should be on
+// at now, if it changed.
+func (s *Scheduler) Check(now time.Time) {
+	cfg, err := LoadConfig(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Calendar: failed to load settings: %v", err))
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+	state, err := LoadState(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Calendar: failed to load state: %v", err))
+		return
+	}
+
+	var bookings []Booking
+	state.Feeds = []FeedStatus{}
+	for _, f := range cfg.Feeds {
+		c := s.fetch(f, now)
+		status := FeedStatus{Name: f.Name, FetchedAt: c.fetchedAt, Events: len(c.events)}
+		if c.err != nil {
+			status.Error = c.err.Error()
+		}
+		state.Feeds = append(state.Feeds, status)
+		for _, e := range occurrences(c.events, now, now.AddDate(0, 0, 7)) {
+			if preset, ok := f.match(e); ok {
+				bookings = append(bookings, Booking{Feed: f.Name, Preset: preset, Event: e})
+			}
+		}
+	}
+	slices.SortStableFunc(bookings, func(a, b Booking) int { return a.Start.Compare(b.Start) })
+
+	// The booking that started last wins when bookings overlap.
+	want := State{Preset: cfg.DefaultPreset}
+	state.Upcoming = []Booking{}
+	for _, b := range bookings {
+		if !b.Start.After(now) {
+			want.Booking = &b
+			want.Preset = b.Preset
+		} else if len(state.Upcoming) < 10 {
+			state.Upcoming = append(state.Upcoming, b)
+		}
+	}
+
+	if want.Preset != "" && want.key() != state.key() {
+		if err := s.restore(want); err != nil {
+			if err.Error() != state.Error {
+				s.logger.Error(fmt.Sprintf("Calendar: failed to restore preset %q: %v", want.Preset, err))
+			}
+			state.Error = err.Error()
+		} else {
+			state.Preset, state.Booking, state.AppliedAt, state.Error = want.Preset, want.Booking, now.UTC(), ""
+		}
+	}
+	if err := s.store.PutSetting(StateSettingKey, state); err != nil {
+		s.logger.Warning(fmt.Sprintf("Calendar: failed to save state: %v", err))
+	}
+}
+
+func (s *Scheduler) restore(want State) error {
+	snap, err := s.store.RestoreSnapshot(want.Preset)
+	if err != nil {
+		return err
+	}
+	reason := "no booking"
+	if b := want.Booking; b != nil {
+		reason = fmt.Sprintf("%q in %s until %s", b.Summary, b.Feed, b.End.Local().Format("15:04"))
+	}
+	s.logger.Info(fmt.Sprintf("Calendar: restored preset %q (%d hosts) for %s", snap.Name, snap.HostCount, reason))
+	if err := s.store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem, Action: AuditPresetRestored,
+		Target: snap.Name, Detail: reason}); err != nil {
+		s.logger.Warning(fmt.Sprintf("Calendar: failed to write audit entry: %v", err))
+	}
+	hooks.Fire(s.store, s.logger, hooks.Event{Event: hooks.EventPresetApplied, Preset: snap.Name, Source: "calendar"})
+	return nil
+}
+
+// fetch returns the cached events of f, fetching them again when they
+// are older than the refresh interval. After a failed fetch the last good
+// events are kept, so a booking system outage does not end bookings.
+func (s *Scheduler) fetch(f Feed, now time.Time) *feedCache {
+	c := s.feeds[f.Name]
+	if c != nil && c.url == f.URL && now.Sub(c.fetchedAt) < s.refresh && c.err == nil {
+		return c
+	}
+	if c == nil || c.url != f.URL {
+		c = &feedCache{url: f.URL}
+		s.feeds[f.Name] = c
+	}
+
+	events, err := s.download(f.URL)
+	if err != nil {
+		if c.err == nil || c.err.Error() != err.Error() {
+			s.logger.Warning(fmt.Sprintf("Calendar: failed to fetch %s: %v", f.Name, err))
+		}
+		c.err = err
+		return c
+	}
+	c.events, c.fetchedAt, c.err = events, now, nil
+	return c
+}
+
+func (s *Scheduler) download(feedURL string) ([]vevent, error) {
+	if rest, ok := strings.CutPrefix(feedURL, "webcal://"); ok {
+		feedURL = "https://" + rest
+	}
+	resp, err := s.client.Get(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
+	}
+	events, err := parse(resp.Body)
+	if errors.Is(err, ErrNotCalendar) {
+		return nil, fmt.Errorf("%w (check the URL)", err)
+	}
+	return events, err
+}
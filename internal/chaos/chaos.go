@@ -0,0 +1,236 @@
+// Package chaos injects faults into a running node, so that retry queues,
+// heartbeats, offline edits and the peer bus can be tried under lossy
+// links and network partitions. Faults are only available when NSM is
+// started with -chaos, and are held in memory: a restart clears them.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/peerbus"
+)
+
+// Errors returned for requests a fault stopped.
+var (
+	ErrDropped     = errors.New("chaos: request dropped")
+	ErrPartitioned = errors.New("chaos: peer is partitioned")
+)
+
+// Limits on faults, so a typo cannot stall a node for good.
+const (
+	maxDelay    = time.Minute
+	maxDuration = 24 * time.Hour
+)
+
+// Faults are the faults a node suffers.
+type Faults struct {
+	DropPercent  int       `json:"drop_percent"`      // Of requests to peers, failed as if lost on the network
+	DelayMS      int       `json:"delay_ms"`          // Added to each request to a peer
+	StoreDelayMS int       `json:"store_delay_ms"`    // Added to each change to the host list
+	Partition    []string  `json:"partition"`         // Peer addresses cut off in both directions
+	BusDown      bool      `json:"bus_down"`          // Send peer requests over HTTP and refuse bus connections
+	Seconds      int       `json:"seconds,omitempty"` // Clear the faults after this long; 0 keeps them until cleared
+	Until        time.Time `json:"until,omitzero"`    // When they clear, set from Seconds
+}
+
+// Validate checks f's limits and sets Until from Seconds.
+func (f *Faults) Validate(now time.Time) error {
+	switch {
+	case f.DropPercent < 0 || f.DropPercent > 100:
+		return errors.New("drop_percent must be between 0 and 100")
+	case f.DelayMS < 0 || time.Duration(f.DelayMS)*time.Millisecond > maxDelay:
+		return fmt.Errorf("delay_ms must be between 0 and %d", maxDelay.Milliseconds())
+	case f.StoreDelayMS < 0 || time.Duration(f.StoreDelayMS)*time.Millisecond > maxDelay:
+		return fmt.Errorf("store_delay_ms must be between 0 and %d", maxDelay.Milliseconds())
+	case f.Seconds < 0 || time.Duration(f.Seconds)*time.Second > maxDuration:
+		return fmt.Errorf("seconds must be between 0 and %d", int(maxDuration.Seconds()))
+	}
+	for _, addr := range f.Partition {
+		if !hosts.ValidAddress(addr) {
+			return fmt.Errorf("invalid partition address %q", addr)
+		}
+		if ip := net.ParseIP(addr); ip != nil && ip.IsLoopback() || addr == "localhost" {
+			return errors.New("the partition cannot include this node")
+		}
+	}
+	if f.Partition == nil {
+		f.Partition = []string{}
+	}
+	f.Until = time.Time{}
+	if f.Seconds > 0 {
+		f.Until = now.Add(time.Duration(f.Seconds) * time.Second)
+	}
+	return nil
+}
+
+// Stats count what the faults did since the node started.
+type Stats struct {
+	Dropped     int64 `json:"dropped"`     // Requests to peers dropped at random
+	Partitioned int64 `json:"partitioned"` // Requests to and from partitioned peers refused
+	Delayed     int64 `json:"delayed"`     // Requests to peers delayed
+	BusRefused  int64 `json:"bus_refused"` // Bus requests and connections sent to HTTP or refused
+}
+
+// Injector applies the current faults. It is safe for concurrent use.
+type Injector struct {
+	mu     sync.Mutex
+	faults Faults
+	rand   *rand.Rand
+
+	dropped, partitioned, delayed, busRefused atomic.Int64
+}
+
+// New returns an injector with no faults.
+func New() *Injector {
+	return &Injector{
+		faults: Faults{Partition: []string{}},
+		rand:   rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+	}
+}
+
+// Faults returns the faults in force, clearing them first if their time
+// is up.
+func (in *Injector) Faults() Faults {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.current(time.Now())
+}
+
+// current returns the faults in force at now. The caller holds mu.
+func (in *Injector) current(now time.Time) Faults {
+	if !in.faults.Until.IsZero() && !now.Before(in.faults.Until) {
+		in.faults = Faults{Partition: []string{}}
+	}
+	return in.faults
+}
+
+// Set replaces the faults, returning them as stored.
+func (in *Injector) Set(f Faults) (Faults, error) {
+	if err := f.Validate(time.Now()); err != nil {
+		return Faults{}, err
+	}
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.faults = f
+	return f, nil
+}
+
+// Stats returns what the faults have done so far.
+func (in *Injector) Stats() Stats {
+	return Stats{Dropped: in.dropped.Load(), Partitioned: in.partitioned.Load(),
+		Delayed: in.delayed.Load(), BusRefused: in.busRefused.Load()}
+}
+
+// Peer decides the fate of a request to the peer at addr, a host and
+// port: it waits out the delay, then fails the request if the peer is
+// partitioned or the request is dropped.
+func (in *Injector) Peer(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	in.mu.Lock()
+	f := in.current(time.Now())
+	drop := f.DropPercent > 0 && in.rand.IntN(100) < f.DropPercent
+	in.mu.Unlock()
+
+	if f.DelayMS > 0 {
+		in.delayed.Add(1)
+		time.Sleep(time.Duration(f.DelayMS) * time.Millisecond)
+	}
+	if slices.Contains(f.Partition, host) {
+		in.partitioned.Add(1)
+		return ErrPartitioned
+	}
+	if drop {
+		in.dropped.Add(1)
+		return ErrDropped
+	}
+	return nil
+}
+
+// Bus is Peer for requests sent over the peer bus. While the bus is down
+// it returns peerbus.ErrNoBus, so the request goes over HTTP, where Peer
+// is applied by Transport.
+func (in *Injector) Bus(addr string) error {
+	if in.Faults().BusDown {
+		in.busRefused.Add(1)
+		return peerbus.ErrNoBus
+	}
+	return in.Peer(addr)
+}
+
+// StoreDelay returns how much longer each change to the host list takes.
+func (in *Injector) StoreDelay() time.Duration {
+	return time.Duration(in.Faults().StoreDelayMS) * time.Millisecond
+}
+
+// Transport wraps base so that Peer is applied to requests to other
+// machines on the peer port, and partitions to any request.
+func (in *Injector) Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{in: in, base: base}
+}
+
+type transport struct {
+	in   *Injector
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		if port == peerbus.DefaultPort {
+			if err := t.in.Peer(net.JoinHostPort(host, port)); err != nil {
+				return nil, err
+			}
+		} else if slices.Contains(t.in.Faults().Partition, host) {
+			t.in.partitioned.Add(1)
+			return nil, ErrPartitioned
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// busKey marks requests that arrived over the peer bus, whose context is
+// that of the bus connection.
+type busKey struct{}
+
+// Middleware drops requests from partitioned peers without an answer, as a
+// cut link would. While the bus is down it refuses new bus connections and
+// drops those open at their next request, so peers fall back to HTTP. It
+// must also wrap the handler the bus dispatches to.
+func (in *Injector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := in.Faults()
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err == nil && slices.Contains(f.Partition, host) {
+			in.partitioned.Add(1)
+			panic(http.ErrAbortHandler)
+		}
+		switch {
+		case r.Context().Value(busKey{}) != nil:
+			if f.BusDown {
+				in.busRefused.Add(1)
+				panic(http.ErrAbortHandler)
+			}
+		case r.URL.Path == peerbus.Path:
+			if f.BusDown {
+				in.busRefused.Add(1)
+				http.Error(w, "Peer bus is down for fault injection", http.StatusServiceUnavailable)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), busKey{}, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
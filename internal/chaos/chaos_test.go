@@ -0,0 +1,154 @@
+package chaos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"nexsign.mini/nsm/internal/peerbus"
+)
+
+func TestFaults(t *testing.T) {
+	in := New()
+	if err := in.Peer("192.168.1.30:8080"); err != nil {
+		t.Fatalf("Expected no faults at first, got %v", err)
+	}
+
+	if _, err := in.Set(Faults{DropPercent: 100}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := in.Peer("192.168.1.30:8080"); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected the request dropped, got %v", err)
+	}
+
+	in.Set(Faults{Partition: []string{"192.168.1.30"}, Seconds: 60})
+	if err := in.Peer("192.168.1.30:8080"); !errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected the peer partitioned, got %v", err)
+	}
+	if err := in.Peer("192.168.1.40:8080"); err != nil {
+		t.Errorf("Expected other peers reachable, got %v", err)
+	}
+	if got := in.Stats(); got.Dropped != 1 || got.Partitioned != 1 {
+		t.Errorf("Unexpected stats %+v", got)
+	}
+
+	// Faults clear themselves once their time is up.
+	in.mu.Lock()
+	in.faults.Until = time.Now().Add(-time.Second)
+	in.mu.Unlock()
+	if f := in.Faults(); len(f.Partition) != 0 || !f.Until.IsZero() {
+		t.Errorf("Expected the faults cleared, got %+v", f)
+	}
+
+	for _, bad := range []Faults{{DropPercent: 101}, {DelayMS: -1}, {StoreDelayMS: 120000},
+		{Partition: []string{"127.0.0.1"}}, {Partition: []string{"not an address"}}, {Seconds: -5}} {
+		if _, err := in.Set(bad); err == nil {
+			t.Errorf("Expected %+v rejected", bad)
+		}
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTransport(t *testing.T) {
+	in := New()
+	var sent []string
+	client := &http.Client{Transport: in.Transport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		sent = append(sent, r.URL.Host)
+		return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody, Request: r}, nil
+	}))}
+	get := func(url string) error {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	in.Set(Faults{DropPercent: 100, Partition: []string{"192.168.1.30"}})
+	if err := get("http://192.168.1.40:8080/api/health"); !errors.Is(err, ErrDropped) {
+		t.Errorf("Expected a peer request dropped, got %v", err)
+	}
+	if err := get("http://192.168.1.30:443/"); !errors.Is(err, ErrPartitioned) {
+		t.Errorf("Expected any request to a partitioned peer refused, got %v", err)
+	}
+	for _, url := range []string{"http://localhost:8080/", "http://127.0.0.1:8080/", "https://hooks.example.com/nsm"} {
+		if err := get(url); err != nil {
+			t.Errorf("Expected %s untouched, got %v", url, err)
+		}
+	}
+	if len(sent) != 3 {
+		t.Errorf("Expected only the untouched requests sent, got %v", sent)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	in := New()
+	var mu sync.Mutex
+	var handled []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		handled = append(handled, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := in.Middleware(mux)
+	mux.Handle(peerbus.Path, peerbus.NewServer(handler))
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	// The sender's own faults send its requests over HTTP while the bus is down.
+	sender := New()
+	pool := peerbus.NewPool()
+	pool.SetFault(sender.Bus)
+	sender.Set(Faults{BusDown: true})
+	if status, err := pool.Post(addr, "/api/heartbeat", []byte("1"), time.Second); err != nil || status != http.StatusNoContent {
+		t.Fatalf("Post: status %d, %v", status, err)
+	}
+	if len(pool.Connected()) != 0 || len(handled) != 1 {
+		t.Errorf("Expected the post sent over HTTP, got connections %v and %v handled", pool.Connected(), handled)
+	}
+
+	// The receiver refuses new bus connections while its bus is down...
+	in.Set(Faults{BusDown: true})
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + peerbus.Path + "?session=test"
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the bus refused with 503, got %v", err)
+	}
+
+	// ...drops those already open at their next request...
+	aborted := func(r *http.Request) (aborted bool) {
+		defer func() { aborted = recover() == http.ErrAbortHandler }()
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		return false
+	}
+	overBus := httptest.NewRequest(http.MethodPost, "/api/heartbeat", strings.NewReader("2"))
+	overBus = overBus.WithContext(context.WithValue(overBus.Context(), busKey{}, true))
+	if !aborted(overBus) {
+		t.Error("Expected a request over an open bus connection dropped")
+	}
+
+	// ...and drops requests from partitioned peers without an answer.
+	in.Set(Faults{Partition: []string{"192.168.1.30"}})
+	fromPeer := httptest.NewRequest(http.MethodPost, "/api/heartbeat", strings.NewReader("3"))
+	fromPeer.RemoteAddr = "192.168.1.30:40000"
+	if !aborted(fromPeer) {
+		t.Error("Expected a request from a partitioned peer dropped")
+	}
+	if len(handled) != 1 {
+		t.Errorf("Expected nothing more handled, got %v", handled)
+	}
+}
@@ -0,0 +1,74 @@
+package cms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// anthias reads Anthias, and Screenly OSE from before its rename, through
+// its HTTP API on port 80.
+type anthias struct {
+	client             *http.Client
+	username, password string
+}
+
+func (c *anthias) Kind() types.CMSKind { return types.CMSAnthias }
+
+// Ping asks /api/v2/info, which older releases lack.
+func (c *anthias) Ping(addr string) error {
+	resp, err := c.get(fmt.Sprintf("http://%s/api/v2/info", addr), nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("info returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Assets reads /api/v1/assets, conditionally when since has validators.
+func (c *anthias) Assets(addr string, since Validators) ([]playlist.Asset, Validators, error) {
+	header := make(http.Header)
+	if since.ETag != "" {
+		header.Set("If-None-Match", since.ETag)
+	}
+	if since.LastModified != "" {
+		header.Set("If-Modified-Since", since.LastModified)
+	}
+	resp, err := c.get(fmt.Sprintf("http://%s/api/v1/assets?format=json", addr), header)
+	if err != nil {
+		return nil, since, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && since != (Validators{}) {
+		return nil, since, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, since, fmt.Errorf("asset list returned status %d", resp.StatusCode)
+	}
+
+	var assets []playlist.Asset
+	if err := json.NewDecoder(resp.Body).Decode(&assets); err != nil {
+		return nil, since, ErrUndecodable
+	}
+	return assets, Validators{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+func (c *anthias) get(url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.client.Do(req)
+}
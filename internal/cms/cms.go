@@ -0,0 +1,89 @@
+// Package cms reads the content management system a host's player runs,
+// so fleets that mix Anthias and other players, or move between them, are
+// watched from one dashboard. Each backend answers whether its CMS is up
+// and what is on its playlist, in the shape of an Anthias asset list.
+package cms
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+var (
+	// ErrNotModified is returned by Assets when the list has not changed
+	// since the read its validators came from.
+	ErrNotModified = errors.New("asset list not modified")
+	// ErrUndecodable means the CMS answered but its asset list could not
+	// be read.
+	ErrUndecodable = errors.New("undecodable asset list")
+)
+
+// Validators identify the asset list a client last read, so the next read
+// can be conditional. Backends that do not support this leave them empty.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// Client reads the CMS of one kind.
+type Client interface {
+	// Kind returns the CMS the client reads.
+	Kind() types.CMSKind
+	// Ping returns nil when the CMS at addr answers its status endpoint.
+	// Older releases without one may still answer Assets.
+	Ping(addr string) error
+	// Assets reads the playlist of the CMS at addr. Given the validators
+	// of the last read it may return ErrNotModified.
+	Assets(addr string, since Validators) ([]playlist.Asset, Validators, error)
+}
+
+// Kinds lists the CMS kinds NSM can read.
+var Kinds = []types.CMSKind{types.CMSAnthias, types.CMSPiSignage}
+
+// Valid reports whether kind is a CMS NSM can read.
+func Valid(kind types.CMSKind) bool {
+	return slices.Contains(Kinds, kind)
+}
+
+// Parse reads a CMS kind as people write it: "anthias" or an empty string
+// for Anthias (or "screenly", its old name), "pisignage" for piSignage,
+// ignoring case.
+func Parse(s string) (types.CMSKind, bool) {
+	kind := types.CMSKind(strings.ToLower(strings.TrimSpace(s)))
+	if kind == "anthias" || kind == "screenly" {
+		kind = types.CMSAnthias
+	}
+	return kind, Valid(kind)
+}
+
+// New returns a client for kind that calls out with client. A non-empty
+// username sends basic auth. Unknown kinds are read as Anthias.
+func New(kind types.CMSKind, client *http.Client, username, password string) Client {
+	switch kind {
+	case types.CMSPiSignage:
+		return &piSignage{client: client, username: username, password: password}
+	}
+	return &anthias{client: client, username: username, password: password}
+}
+
+// DashboardURL returns the address of the web UI of the CMS of kind at addr.
+func DashboardURL(kind types.CMSKind, addr string) string {
+	if kind == types.CMSPiSignage {
+		return "http://" + withPort(addr, piSignagePort)
+	}
+	return "http://" + addr
+}
+
+// withPort adds port to addr unless it has one.
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, port)
+}
@@ -0,0 +1,103 @@
+package cms
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestAnthiasAssets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2/info":
+			w.Write([]byte(`{}`))
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(`[{"asset_id": "a1", "name": "Welcome", "is_enabled": 1}]`))
+		}
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	c := New(types.CMSAnthias, srv.Client(), "", "")
+
+	if err := c.Ping(addr); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	assets, v, err := c.Assets(addr, Validators{})
+	if err != nil || len(assets) != 1 || v.ETag != `"v1"` {
+		t.Fatalf("Assets = %v, %+v, %v", assets, v, err)
+	}
+	if _, _, err := c.Assets(addr, v); !errors.Is(err, ErrNotModified) {
+		t.Errorf("expected ErrNotModified for a conditional read, got %v", err)
+	}
+}
+
+func TestPiSignageAssets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "pi" || pass != "pi" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/settings":
+			w.Write([]byte(`{"success": true, "data": {}}`))
+		case "/api/playlists":
+			w.Write([]byte(`{"success": true, "data": [
+				{"name": "default", "assets": [
+					{"filename": "welcome.jpg", "duration": 10, "selected": true},
+					{"filename": "promo.mp4", "duration": "30", "selected": false}
+				]},
+				{"name": "lunch", "assets": [{"filename": "menu.link", "duration": 20}]}
+			]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	c := New(types.CMSPiSignage, srv.Client(), "", "")
+	if err := c.Ping(addr); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	assets, _, err := c.Assets(addr, Validators{})
+	if err != nil || len(assets) != 3 {
+		t.Fatalf("Assets = %v, %v", assets, err)
+	}
+	if a := assets[1]; a.ID != "default/promo.mp4" || a.MimeType != "video" || a.Duration != 30 || a.IsEnabled.True() {
+		t.Errorf("unexpected promo asset %+v", a)
+	}
+	if a := assets[2]; a.MimeType != "webpage" || !a.IsEnabled.True() {
+		t.Errorf("expected an enabled web page, got %+v", a)
+	}
+
+	// A player whose login was changed is up, but its playlist is not
+	// readable with the default one.
+	c = New(types.CMSPiSignage, srv.Client(), "admin", "secret")
+	if err := c.Ping(addr); err != nil {
+		t.Errorf("expected a player refusing the login to be up, got %v", err)
+	}
+	if _, _, err := c.Assets(addr, Validators{}); err == nil {
+		t.Error("expected reading with the wrong login to fail")
+	}
+}
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]types.CMSKind{"": types.CMSAnthias, "Anthias": types.CMSAnthias, "screenly": types.CMSAnthias, " piSignage ": types.CMSPiSignage} {
+		if got, ok := Parse(in); !ok || got != want {
+			t.Errorf("Parse(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := Parse("xibo"); ok {
+		t.Error("expected xibo to be unknown")
+	}
+	if got := DashboardURL(types.CMSPiSignage, "192.168.1.50"); got != "http://192.168.1.50:8000" {
+		t.Errorf("DashboardURL = %q", got)
+	}
+}
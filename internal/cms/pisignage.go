@@ -0,0 +1,121 @@
+package cms
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// piSignagePort is where a piSignage player serves its web UI and API.
+const piSignagePort = "8000"
+
+// piSignageLogin is the login a piSignage player ships with, used when no
+// other is given.
+const piSignageUser, piSignagePassword = "pi", "pi"
+
+// piSignage reads a piSignage player through the web API it serves for
+// local management.
+type piSignage struct {
+	client             *http.Client
+	username, password string
+}
+
+func (c *piSignage) Kind() types.CMSKind { return types.CMSPiSignage }
+
+// Ping asks /api/settings. A player that refuses the login still answers,
+// so it counts as up.
+func (c *piSignage) Ping(addr string) error {
+	resp, err := c.get(addr, "/api/settings")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("settings returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// piSignagePlaylists is the answer of /api/playlists.
+type piSignagePlaylists struct {
+	Success bool `json:"success"`
+	Data    []struct {
+		Name   string `json:"name"`
+		Assets []struct {
+			Filename string           `json:"filename"`
+			Duration playlist.Seconds `json:"duration"`
+			Selected *bool            `json:"selected"`
+		} `json:"assets"`
+	} `json:"data"`
+}
+
+// Assets reads every playlist on the player. Each entry becomes an asset
+// named after its file, with the playlist and file as its ID; an entry
+// that is not selected is disabled. The player sends no validators, so
+// every read is a full one.
+func (c *piSignage) Assets(addr string, _ Validators) ([]playlist.Asset, Validators, error) {
+	resp, err := c.get(addr, "/api/playlists")
+	if err != nil {
+		return nil, Validators{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, Validators{}, fmt.Errorf("playlists returned status %d", resp.StatusCode)
+	}
+
+	var body piSignagePlaylists
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || !body.Success {
+		return nil, Validators{}, ErrUndecodable
+	}
+	assets := []playlist.Asset{}
+	for _, p := range body.Data {
+		for _, a := range p.Assets {
+			if a.Filename == "" {
+				continue
+			}
+			assets = append(assets, playlist.Asset{
+				ID:        p.Name + "/" + a.Filename,
+				Name:      a.Filename,
+				MimeType:  piSignageType(a.Filename),
+				Duration:  a.Duration,
+				IsEnabled: playlist.Enabled(a.Selected == nil || *a.Selected),
+			})
+		}
+	}
+	return assets, Validators{}, nil
+}
+
+// piSignageType maps a piSignage file name to an Anthias asset type by its
+// extension. piSignage stores web pages and streams as small files of
+// their own.
+func piSignageType(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp":
+		return "image"
+	case ".mp4", ".mov", ".mkv", ".webm", ".avi", ".m4v":
+		return "video"
+	case ".link", ".weblink", ".html", ".htm", ".zip":
+		return "webpage"
+	case ".stream", ".tv", ".radio":
+		return "streaming"
+	}
+	return ""
+}
+
+func (c *piSignage) get(addr, endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+withPort(addr, piSignagePort)+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	user, pass := c.username, c.password
+	if user == "" {
+		user, pass = piSignageUser, piSignagePassword
+	}
+	req.SetBasicAuth(user, pass)
+	return c.client.Do(req)
+}
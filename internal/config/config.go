@@ -0,0 +1,105 @@
+// Package config reads the optional config.json a node is started with.
+// It holds the settings that differ between hosts and must be known before
+// the host store opens; everything else is kept in the store and set
+// through the API.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// DefaultFile is read from the working directory when no other file is
+// named.
+const DefaultFile = "config.json"
+
+// Config is the contents of config.json. Fields left out keep their
+// defaults.
+type Config struct {
+	Port          int    `json:"port"`           // Dashboard and API port; the PORT environment variable overrides it
+	DataDir       string `json:"data_dir"`       // Directory of hosts.db and its backups; the working directory when empty
+	EnableActions bool   `json:"enable_actions"` // Whether this node reboots, upgrades and powers displays of hosts
+	OTLPEndpoint  string `json:"otlp_endpoint"`  // OpenTelemetry collector traces are exported to, such as http://collector:4318; tracing is off when empty
+	Store         string `json:"store"`          // Where the node keeps its database: sqlite (the default) or memory, which keeps nothing across restarts
+}
+
+// Default returns the settings of a node without a config.json.
+func Default() Config {
+	return Config{Port: 8080, EnableActions: true}
+}
+
+// Validate rejects unusable values.
+func (c Config) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port %d is out of range 1-65535", c.Port)
+	}
+	if c.DataDir != "" && filepath.Clean(c.DataDir) != c.DataDir {
+		return fmt.Errorf("data_dir %q is not a clean path (want %q)", c.DataDir, filepath.Clean(c.DataDir))
+	}
+	if c.Store != "" && !slices.Contains(hosts.Backends, c.Store) {
+		return fmt.Errorf("store %q is not one of %s", c.Store, strings.Join(hosts.Backends, ", "))
+	}
+	if c.OTLPEndpoint != "" {
+		u, err := url.Parse(c.OTLPEndpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("otlp_endpoint %q is not an http or https URL", c.OTLPEndpoint)
+		}
+		if strings.HasSuffix(u.Path, "/") || strings.HasSuffix(u.Path, "/v1/traces") {
+			return fmt.Errorf("otlp_endpoint %q should be the collector's base URL, without /v1/traces or a trailing slash", c.OTLPEndpoint)
+		}
+	}
+	return nil
+}
+
+// DBFile returns the path of hosts.db, for hosts.Open.
+func (c Config) DBFile() string {
+	if c.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(c.DataDir, "hosts.db")
+}
+
+// Parse reads a config.json over the defaults and validates it. Unknown
+// keys are refused, so a misspelt setting is not silently ignored.
+func Parse(data []byte) (Config, error) {
+	cfg := Default()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return Config{}, errors.New("invalid JSON: data after the top-level object")
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Load reads the file at path. A missing file gives the defaults when
+// optional is set, so nodes run without one.
+func Load(path string, optional bool) (Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && optional {
+		return Default(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
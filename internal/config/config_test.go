@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`{"port": 9090, "data_dir": "/var/lib/nsm"}`))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Port != 9090 || cfg.DBFile() != "/var/lib/nsm/hosts.db" || !cfg.EnableActions {
+		t.Errorf("expected the file over the defaults, got %+v", cfg)
+	}
+	if cfg, err := Parse([]byte(`{"otlp_endpoint": "http://collector:4318"}`)); err != nil || cfg.OTLPEndpoint != "http://collector:4318" {
+		t.Errorf("expected the collector URL kept, got %+v (%v)", cfg, err)
+	}
+	if cfg, err := Parse([]byte(`{"store": "memory"}`)); err != nil || cfg.Store != "memory" {
+		t.Errorf("expected the memory store kept, got %+v (%v)", cfg, err)
+	}
+
+	for name, data := range map[string]string{
+		"unknown key":    `{"prot": 9090}`,
+		"port":           `{"port": 70000}`,
+		"unclean path":   `{"data_dir": "/var/lib/nsm/"}`,
+		"trailing data":  `{"port": 9090} {}`,
+		"wrong type":     `{"enable_actions": "no"}`,
+		"not an object":  `[]`,
+		"truncated JSON": `{"port": 9090`,
+		"otlp scheme":    `{"otlp_endpoint": "collector:4318"}`,
+		"otlp path":      `{"otlp_endpoint": "http://collector:4318/v1/traces"}`,
+		"store":          `{"store": "postgres"}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected %s refused", name, data)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if cfg, err := Load(path, true); err != nil || cfg != Default() {
+		t.Errorf("expected the defaults without a file, got %+v (%v)", cfg, err)
+	}
+	if _, err := Load(path, false); err == nil {
+		t.Error("expected a named file required")
+	}
+	os.WriteFile(path, []byte(`{"enable_actions": false}`), 0644)
+	if cfg, err := Load(path, true); err != nil || cfg.EnableActions || cfg.Port != 8080 {
+		t.Errorf("expected actions disabled, got %+v (%v)", cfg, err)
+	}
+}
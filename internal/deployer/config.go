@@ -0,0 +1,94 @@
+package deployer
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+
+	"nexsign.mini/nsm/internal/config"
+)
+
+// inventory holds the template variables of each host. JSON is valid YAML,
+// so either works.
+type inventory struct {
+	Defaults map[string]any            `yaml:"defaults"` // For every host
+	Hosts    map[string]map[string]any `yaml:"hosts"`    // By host, over the defaults
+}
+
+// hostConfig is the config.json rendered for one host.
+type hostConfig struct {
+	path string // Local file pushed as config.json
+	port int    // Where the host will serve its API
+}
+
+func loadInventory(path string) (inventory, error) {
+	var inv inventory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return inv, err
+	}
+	if err := yaml.UnmarshalStrict(data, &inv); err != nil {
+		return inv, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return inv, nil
+}
+
+// hosts lists the hosts of the inventory, sorted.
+func (inv inventory) hosts() []string {
+	return slices.Sorted(maps.Keys(inv.Hosts))
+}
+
+// vars returns the variables for host: the defaults, the host's own and
+// host, its address.
+func (inv inventory) vars(host string) map[string]any {
+	vars := maps.Clone(inv.Defaults)
+	if vars == nil {
+		vars = make(map[string]any)
+	}
+	maps.Copy(vars, inv.Hosts[host])
+	vars["host"] = host
+	return vars
+}
+
+// parseConfigTemplate reads a config.json template. A variable no host
+// defines is an error rather than an empty value. json quotes a value, for
+// strings such as data_dir.
+func parseConfigTemplate(path string) (*template.Template, error) {
+	return template.New(filepath.Base(path)).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		}}).
+		ParseFiles(path)
+}
+
+// renderConfigs renders the template for each host into dir and checks
+// each result as the node will, so a bad value stops the run before any
+// host is touched.
+func renderConfigs(tmpl *template.Template, inv inventory, hostList []string, dir string) (map[string]hostConfig, error) {
+	out := make(map[string]hostConfig, len(hostList))
+	for _, host := range hostList {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, inv.vars(host)); err != nil {
+			return nil, fmt.Errorf("%s: render: %w", host, err)
+		}
+		cfg, err := config.Parse([]byte(b.String()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: rendered config: %w", host, err)
+		}
+		path := filepath.Join(dir, strings.ReplaceAll(host, string(filepath.Separator), "_")+".json")
+		if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+			return nil, err
+		}
+		out[host] = hostConfig{path: path, port: cfg.Port}
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package deployer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderConfigs(t *testing.T) {
+	dir := t.TempDir()
+	tmpl, err := parseConfigTemplate(filepath.Join("..", "..", "deploy", "config.json.tmpl"))
+	if err != nil {
+		t.Fatalf("parseConfigTemplate: %v", err)
+	}
+	inv, err := loadInventory(filepath.Join("..", "..", "deploy", "inventory.yaml.sample"))
+	if err != nil {
+		t.Fatalf("loadInventory: %v", err)
+	}
+	if hosts := inv.hosts(); len(hosts) != 4 || hosts[0] != "192.168.10.135" {
+		t.Fatalf("expected the sample's hosts sorted, got %v", hosts)
+	}
+
+	configs, err := renderConfigs(tmpl, inv, []string{"192.168.10.174", "192.168.10.135", "192.168.10.211", "10.0.0.9"}, dir)
+	if err != nil {
+		t.Fatalf("renderConfigs: %v", err)
+	}
+	if configs["192.168.10.174"].port != 8081 || configs["10.0.0.9"].port != 8080 {
+		t.Errorf("expected the host's port over the default, got %+v", configs)
+	}
+	data, _ := os.ReadFile(configs["192.168.10.135"].path)
+	if !strings.Contains(string(data), `"data_dir": "/var/lib/nsm"`) {
+		t.Errorf("expected data_dir quoted, got:\n%s", data)
+	}
+	data, _ = os.ReadFile(configs["192.168.10.211"].path)
+	if !strings.Contains(string(data), `"enable_actions": false`) {
+		t.Errorf("expected actions disabled, got:\n%s", data)
+	}
+
+	// A value the node would refuse stops the run.
+	inv.Hosts["192.168.10.174"]["port"] = 80800
+	if _, err := renderConfigs(tmpl, inv, []string{"192.168.10.174"}, dir); err == nil || !strings.Contains(err.Error(), "192.168.10.174") {
+		t.Errorf("expected an out-of-range port refused, got %v", err)
+	}
+	// So does a variable no host defines.
+	delete(inv.Defaults, "data_dir")
+	if _, err := renderConfigs(tmpl, inv, []string{"10.0.0.9"}, dir); err == nil {
+		t.Error("expected a missing variable refused")
+	}
+}
@@ -0,0 +1,558 @@
+// Package deployer builds nsm and copies it to hosts over SSH, or packages
+// it as a signed release. It runs as nsm deploy from the repository root.
+package deployer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/docgen"
+	"nexsign.mini/nsm/internal/types"
+)
+
+var (
+	defaultHosts = []string{
+		"192.168.10.147",
+		"192.168.10.174",
+		"192.168.10.135",
+		"192.168.10.211",
+	}
+)
+
+type hostResult struct {
+	host     string
+	duration time.Duration
+	err      error
+}
+
+// deployOptions are the settings shared by every host in a run.
+type deployOptions struct {
+	keyPath       string
+	binaryPath    string
+	webDir        string
+	remoteDir     string
+	apiKey        string                // Bearer token for the backup request, needed once a node has users
+	healthTimeout time.Duration         // How long a new binary may take to answer /api/health
+	configs       map[string]hostConfig // Rendered config.json by host; nil leaves the hosts' own
+}
+
+// port returns the port host serves its API on once deployed.
+func (o deployOptions) port(host string) int {
+	if c, ok := o.configs[host]; ok {
+		return c.port
+	}
+	return 8080
+}
+
+// Main runs nsm deploy with args. It exits the process on failure.
+func Main(args []string) {
+	var (
+		hostsFlag    string
+		keyFlag      string
+		binaryFlag   string
+		remoteDir    string
+		parallelFlag int
+		skipBuild    bool
+		apiKeyFlag   string
+		healthFlag   time.Duration
+		packageFlag  bool
+		outFlag      string
+		osFlag       string
+		archFlag     string
+		versionFlag  string
+		signKeyFlag  string
+		publishFlag  string
+		templateFlag string
+		invFlag      string
+	)
+
+	homeDir, _ := os.UserHomeDir()
+	fs := flag.NewFlagSet("deploy", flag.ExitOnError)
+
+	fs.StringVar(&hostsFlag, "hosts", "all", "Comma-separated list of hosts or 'all'")
+	fs.StringVar(&keyFlag, "key", filepath.Join(homeDir, ".ssh", "nsm-vbox.key"), "Path to SSH private key")
+	fs.StringVar(&binaryFlag, "binary", "nsm", "Path for the compiled binary")
+	fs.StringVar(&remoteDir, "remote-dir", "/home/nsm/nsm-app", "Remote deployment directory")
+	fs.IntVar(&parallelFlag, "parallel", 2, "Number of hosts to deploy concurrently")
+	fs.BoolVar(&skipBuild, "skip-build", false, "Skip rebuilding the binary before deployment")
+	fs.StringVar(&apiKeyFlag, "api-key", os.Getenv("NSM_API_KEY"), "API key for the pre-deploy backup request (default $NSM_API_KEY)")
+	fs.DurationVar(&healthFlag, "health-timeout", 30*time.Second, "How long the new binary may take to pass its health check before it is rolled back")
+	fs.BoolVar(&packageFlag, "package", false, "Package a signed release tarball instead of deploying")
+	fs.StringVar(&outFlag, "out", "dist", "Directory for the release tarball and release.json")
+	fs.StringVar(&osFlag, "os", "linux", "Target operating system of the release")
+	fs.StringVar(&archFlag, "arch", runtime.GOARCH, "Target architecture of the release, e.g. arm64 for Raspberry Pi")
+	fs.StringVar(&versionFlag, "version", types.Version, "Version stamped into the binary")
+	fs.StringVar(&signKeyFlag, "sign-key", "release.key", "Ed25519 key that signs releases; created if missing")
+	fs.StringVar(&publishFlag, "publish", "", "Copy the release to this directory or rsync destination (host:/path/)")
+	fs.StringVar(&templateFlag, "config-template", "", "Render config.json for each host from this text/template and push it with the binary")
+	fs.StringVar(&invFlag, "inventory", "", "YAML or JSON file of template variables: defaults, and hosts by address")
+	fs.Parse(args)
+
+	if packageFlag {
+		if err := ensureToolExists("go"); err != nil {
+			log.Fatalf("go toolchain not available: %v", err)
+		}
+		if publishFlag != "" {
+			if err := ensureToolExists("rsync"); err != nil {
+				log.Fatalf("rsync not available: %v", err)
+			}
+		}
+		if err := generateDocs(); err != nil {
+			log.Fatalf("generate docs: %v", err)
+		}
+		webDir, err := filepath.Abs(filepath.Join("internal", "web"))
+		if err != nil {
+			log.Fatalf("resolve template directory: %v", err)
+		}
+		tarball, err := packageRelease(outFlag, webDir, signKeyFlag, osFlag, archFlag, versionFlag)
+		if err != nil {
+			log.Fatalf("package release: %v", err)
+		}
+		if publishFlag != "" {
+			if err := publishRelease(tarball, publishFlag, keyFlag); err != nil {
+				log.Fatalf("publish release: %v", err)
+			}
+		}
+		return
+	}
+
+	var inv inventory
+	if invFlag != "" {
+		if templateFlag == "" {
+			log.Fatal("--inventory needs --config-template")
+		}
+		var err error
+		if inv, err = loadInventory(invFlag); err != nil {
+			log.Fatalf("load inventory: %v", err)
+		}
+	}
+
+	hostList, err := resolveHosts(hostsFlag)
+	if err != nil {
+		log.Fatalf("resolve hosts: %v", err)
+	}
+	if (hostsFlag == "" || hostsFlag == "all") && len(inv.Hosts) > 0 {
+		hostList = inv.hosts()
+	}
+	if len(hostList) == 0 {
+		log.Fatal("no hosts specified")
+	}
+	if parallelFlag < 1 {
+		parallelFlag = 1
+	}
+	if parallelFlag > len(hostList) {
+		parallelFlag = len(hostList)
+	}
+
+	if err := ensureToolExists("rsync"); err != nil {
+		log.Fatalf("rsync not available: %v", err)
+	}
+	if err := ensureToolExists("go"); err != nil {
+		log.Fatalf("go toolchain not available: %v", err)
+	}
+	if err := ensureFileExists(keyFlag); err != nil {
+		log.Fatalf("ssh key not accessible: %v", err)
+	}
+
+	// Render every host's config before touching any host.
+	var configs map[string]hostConfig
+	if templateFlag != "" {
+		tmpl, err := parseConfigTemplate(templateFlag)
+		if err != nil {
+			log.Fatalf("parse config template: %v", err)
+		}
+		dir, err := os.MkdirTemp("", "nsm-config-*")
+		if err != nil {
+			log.Fatalf("create config directory: %v", err)
+		}
+		defer os.RemoveAll(dir)
+		if configs, err = renderConfigs(tmpl, inv, hostList, dir); err != nil {
+			log.Fatalf("render config: %v", err)
+		}
+		log.Printf("Rendered config.json for %d host(s) from %s", len(configs), templateFlag)
+	}
+
+	binaryPath, err := filepath.Abs(binaryFlag)
+	if err != nil {
+		log.Fatalf("determine binary path: %v", err)
+	}
+
+	if !skipBuild {
+		if err := generateDocs(); err != nil {
+			log.Fatalf("generate docs: %v", err)
+		}
+		if err := buildBinary(binaryPath); err != nil {
+			log.Fatalf("build binary: %v", err)
+		}
+	} else {
+		log.Printf("Skipping build step (requested via --skip-build)")
+	}
+
+	opts := deployOptions{
+		keyPath:       keyFlag,
+		binaryPath:    binaryPath,
+		remoteDir:     remoteDir,
+		apiKey:        apiKeyFlag,
+		healthTimeout: healthFlag,
+		configs:       configs,
+	}
+	results := runDeployments(hostList, opts, parallelFlag)
+
+	var failed int
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			log.Printf("[%s] ❌ deployment failed after %s: %v", r.host, r.duration.Truncate(time.Millisecond), r.err)
+		} else {
+			log.Printf("[%s] ✅ deployment completed in %s", r.host, r.duration.Truncate(time.Millisecond))
+		}
+	}
+
+	if failed > 0 {
+		log.Fatalf("deployment failed on %d host(s)", failed)
+	}
+}
+
+func resolveHosts(flagValue string) ([]string, error) {
+	if flagValue == "" || flagValue == "all" {
+		return append([]string{}, defaultHosts...), nil
+	}
+
+	parts := strings.Split(flagValue, ",")
+	var hosts []string
+	for _, p := range parts {
+		h := strings.TrimSpace(p)
+		if h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts, nil
+}
+
+func ensureToolExists(name string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("required tool %q not found in PATH", name)
+	}
+	return nil
+}
+
+func ensureFileExists(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func buildBinary(binaryPath string) error {
+	log.Printf("Building NSM binary -> %s", binaryPath)
+	cmd := exec.Command("go", "build", "-ldflags", ldflags(types.Version, time.Now().UTC().Format(time.RFC3339)), "-o", binaryPath, ".")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runDeployments(hosts []string, opts deployOptions, parallel int) []hostResult {
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, parallel)
+		results  = make([]hostResult, len(hosts))
+		rsyncDir = filepath.Join("internal", "web")
+	)
+
+	absDir, err := filepath.Abs(rsyncDir)
+	if err != nil {
+		log.Fatalf("resolve template directory: %v", err)
+	}
+	opts.webDir = absDir
+
+	for idx, host := range hosts {
+		wg.Add(1)
+		go func(i int, h string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			err := deployHost(h, opts)
+			results[i] = hostResult{
+				host:     h,
+				duration: time.Since(start),
+				err:      err,
+			}
+		}(idx, host)
+	}
+
+	wg.Wait()
+	return results
+}
+
+func deployHost(host string, opts deployOptions) error {
+	logPrefix := fmt.Sprintf("[%s]", host)
+	log.Printf("%s Starting deployment", logPrefix)
+
+	remoteUser := "nsm"
+	sshTarget := fmt.Sprintf("%s@%s", remoteUser, host)
+	keyPath, remoteDir := opts.keyPath, opts.remoteDir
+
+	// Back up the database while the old binary still serves it. A node
+	// that is down, or refuses the request, is backed up by copying
+	// hosts.db once it is stopped.
+	backedUp := true
+	if path, err := requestBackup(host, opts.port(host), opts.apiKey); err != nil {
+		log.Printf("%s Backup through the API failed (%v); hosts.db will be copied once NSM is stopped", logPrefix, err)
+		backedUp = false
+	} else {
+		log.Printf("%s Backed up the database to %s", logPrefix, path)
+	}
+
+	// Ensure remote directory structure exists and stop existing binary.
+	if err := stopRemoteBinary(sshTarget, keyPath); err != nil {
+		return fmt.Errorf("stop remote binary: %w", err)
+	}
+
+	if !backedUp {
+		copyCmd := fmt.Sprintf("cd %s 2>/dev/null || exit 0; if [ -f hosts.db ]; then mkdir -p backups && cp -p hosts.db backups/hosts-$(date +%%s).db; fi", remoteDir)
+		if err := sshRun(sshTarget, keyPath, copyCmd, 60*time.Second); err != nil {
+			return fmt.Errorf("back up hosts.db: %w", err)
+		}
+	}
+
+	// Clean up database to force fresh start, but try to preserve identity
+	cleanCmd := fmt.Sprintf("mkdir -p %[1]s/internal/web/static", remoteDir)
+	if err := sshRun(sshTarget, keyPath, cleanCmd, 20*time.Second); err != nil {
+		return fmt.Errorf("clean remote directories: %w", err)
+	}
+
+	// Keep the running binary, and its config when we replace it, to roll
+	// back to.
+	keepCmd := fmt.Sprintf("cd %s && if [ -f nsm ]; then cp -p nsm nsm.prev; fi", remoteDir)
+	if _, ok := opts.configs[host]; ok {
+		keepCmd += " && rm -f config.json.prev && if [ -f config.json ]; then cp -p config.json config.json.prev; fi"
+	}
+	if err := sshRun(sshTarget, keyPath, keepCmd, 20*time.Second); err != nil {
+		return fmt.Errorf("keep previous binary: %w", err)
+	}
+
+	// Push binary via rsync.
+	if err := rsyncCopy(opts.binaryPath, fmt.Sprintf("%s:%s/", sshTarget, remoteDir), keyPath); err != nil {
+		return fmt.Errorf("rsync binary: %w", err)
+	}
+
+	// Push templates and static assets.
+	if err := rsyncCopy(opts.webDir+"/", fmt.Sprintf("%s:%s/internal/web/", sshTarget, remoteDir), keyPath); err != nil {
+		return fmt.Errorf("rsync templates: %w", err)
+	}
+
+	if err := sshRun(sshTarget, keyPath, fmt.Sprintf("chmod +x %s/nsm", remoteDir), 5*time.Second); err != nil {
+		return fmt.Errorf("set executable bit: %w", err)
+	}
+
+	err := pushConfig(host, sshTarget, opts)
+	if err == nil {
+		err = startAndVerify(host, sshTarget, opts)
+	}
+	if err == nil {
+		log.Printf("%s Deployment succeeded", logPrefix)
+		return nil
+	}
+
+	// Fetch log to debug startup failure
+	log.Printf("%s New binary failed: %v. Fetching nsm.log...", logPrefix, err)
+	logCmd := fmt.Sprintf("tail -n 50 %s/nsm.log", remoteDir)
+	if logErr := sshRun(sshTarget, keyPath, logCmd, 5*time.Second); logErr != nil {
+		log.Printf("%s Failed to fetch log: %v", logPrefix, logErr)
+	}
+	if rbErr := rollback(host, sshTarget, opts); rbErr != nil {
+		return fmt.Errorf("%w; rollback failed: %v", err, rbErr)
+	}
+	return fmt.Errorf("%w; rolled back to the previous binary", err)
+}
+
+// pushConfig copies the host's rendered config.json, if any, and has the
+// new binary check it before it is started with it.
+func pushConfig(host, sshTarget string, opts deployOptions) error {
+	c, ok := opts.configs[host]
+	if !ok {
+		return nil
+	}
+	if err := rsyncCopy(c.path, fmt.Sprintf("%s:%s/config.json", sshTarget, opts.remoteDir), opts.keyPath); err != nil {
+		return fmt.Errorf("rsync config: %w", err)
+	}
+	validateCmd := fmt.Sprintf("cd %s && ./nsm config validate config.json", opts.remoteDir)
+	if err := sshRun(sshTarget, opts.keyPath, validateCmd, 10*time.Second); err != nil {
+		return fmt.Errorf("validate config: %w", err)
+	}
+	return nil
+}
+
+// startAndVerify launches the binary and waits for it to pass its health
+// check.
+func startAndVerify(host, sshTarget string, opts deployOptions) error {
+	startCmd := fmt.Sprintf("cd %s && setsid -f nohup ./nsm > nsm.log 2>&1 < /dev/null", opts.remoteDir)
+	if err := sshRun(sshTarget, opts.keyPath, startCmd, 30*time.Second); err != nil {
+		return fmt.Errorf("start remote binary: %w", err)
+	}
+
+	// Give the process a moment to start, then verify.
+	time.Sleep(2 * time.Second)
+	if err := sshRun(sshTarget, opts.keyPath, "pgrep -f 'nsm$'", 5*time.Second); err != nil {
+		return fmt.Errorf("verify process running: %w", err)
+	}
+	if err := waitHealthy(host, opts.port(host), opts.healthTimeout); err != nil {
+		return fmt.Errorf("health check: %w", err)
+	}
+	return nil
+}
+
+// rollback stops the new binary, restores nsm.prev, and the config it ran
+// with if we replaced it, and starts it again.
+func rollback(host, sshTarget string, opts deployOptions) error {
+	log.Printf("[%s] Rolling back to the previous binary", host)
+	if err := stopRemoteBinary(sshTarget, opts.keyPath); err != nil {
+		return fmt.Errorf("stop new binary: %w", err)
+	}
+	restoreCmd := fmt.Sprintf("cd %s && [ -f nsm.prev ] && cp -p nsm.prev nsm", opts.remoteDir)
+	if _, ok := opts.configs[host]; ok {
+		restoreCmd += " && if [ -f config.json.prev ]; then cp -p config.json.prev config.json; else rm -f config.json; fi"
+	}
+	if err := sshRun(sshTarget, opts.keyPath, restoreCmd, 20*time.Second); err != nil {
+		return fmt.Errorf("no previous binary to restore: %w", err)
+	}
+	if err := startAndVerify(host, sshTarget, opts); err != nil {
+		return fmt.Errorf("previous binary: %w", err)
+	}
+	return nil
+}
+
+// requestBackup asks the running node for an internal backup and returns
+// the path it was written to.
+func requestBackup(host string, port int, apiKey string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s:%d/api/hosts/export/internal", host, port), nil)
+	if err != nil {
+		return "", err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	client := http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var out struct {
+		Path string `json:"path"`
+	}
+	json.Unmarshal(body, &out)
+	return out.Path, nil
+}
+
+// waitHealthy polls /api/health until it answers 200 or timeout passes.
+func waitHealthy(host string, port int, timeout time.Duration) error {
+	client := http.Client{Timeout: 3 * time.Second}
+	url := fmt.Sprintf("http://%s:%d/api/health", host, port)
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not healthy after %s: %w", url, timeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func sshRun(target, keyPath, remoteCmd string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	args := []string{
+		"-i", keyPath,
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=no",
+		target,
+		remoteCmd,
+	}
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("ssh command timed out: %s", remoteCmd)
+		}
+		return fmt.Errorf("ssh error (%s): %v | output: %s", remoteCmd, err, strings.TrimSpace(output.String()))
+	}
+	if out := strings.TrimSpace(output.String()); out != "" {
+		log.Printf("[%s] %s", target, out)
+	}
+	return nil
+}
+
+func rsyncCopy(src, dest, keyPath string) error {
+	args := []string{
+		"-az",
+		"--delete",
+		"--exclude=identity.id",
+		"--exclude=identity.key",
+		"--exclude=hosts.db",
+		"--exclude=hosts.json",
+		"-e", fmt.Sprintf("ssh -i %s -o BatchMode=yes -o StrictHostKeyChecking=no", keyPath),
+		src,
+		dest,
+	}
+
+	cmd := exec.Command("rsync", args...)
+	var output strings.Builder
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("rsync output: %s | err: %w", strings.TrimSpace(output.String()), err)
+	}
+
+	if out := strings.TrimSpace(output.String()); out != "" {
+		log.Printf("[rsync] %s", out)
+	}
+	return nil
+}
+
+func stopRemoteBinary(target, keyPath string) error {
+	stopCmd := "pgrep -f 'nsm$' >/dev/null && pkill -TERM 'nsm$' || true"
+	if err := sshRun(target, keyPath, stopCmd, 15*time.Second); err != nil {
+		return err
+	}
+
+	waitCmd := "count=0; while pgrep -f 'nsm$' >/dev/null; do if [ \"$count\" -ge 15 ]; then exit 1; fi; count=$((count+1)); sleep 1; done"
+	return sshRun(target, keyPath, waitCmd, 20*time.Second)
+}
+
+func generateDocs() error {
+	log.Println("Generating API documentation...")
+	return docgen.Generate(docgen.DefaultSource, docgen.DefaultOutput)
+}
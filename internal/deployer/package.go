@@ -0,0 +1,269 @@
+package deployer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Release describes a packaged build. It is signed and published next to
+// the tarball as release.json, for nodes to check an update against.
+type Release struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	File      string `json:"file"`   // Tarball name
+	Size      int64  `json:"size"`   // Of the tarball
+	SHA256    string `json:"sha256"` // Of the tarball
+	PublicKey string `json:"public_key"`
+}
+
+// ReleaseEnvelope carries a release and the signature over its exact
+// bytes, like signed heartbeats.
+type ReleaseEnvelope struct {
+	Release   json.RawMessage `json:"release"`
+	Signature string          `json:"signature"`
+}
+
+// ldflags stamps the version and build time into the binary.
+func ldflags(version, buildTime string) string {
+	return fmt.Sprintf("-s -w -X nexsign.mini/nsm/internal/types.Version=%s -X nexsign.mini/nsm/internal/types.BuildTime=%s", version, buildTime)
+}
+
+// buildRelease cross-compiles the binary for goos/goarch with the version
+// stamped in.
+func buildRelease(binaryPath, goos, goarch, version, buildTime string) error {
+	log.Printf("Building NSM %s for %s/%s -> %s", version, goos, goarch, binaryPath)
+	cmd := exec.Command("go", "build", "-trimpath", "-ldflags", ldflags(version, buildTime), "-o", binaryPath, ".")
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// packageRelease builds a release into outDir: a tarball with the binary,
+// the web assets, SHA256SUMS listing each of them and SHA256SUMS.sig, plus
+// release.json describing the tarball, signed with the key at keyPath.
+func packageRelease(outDir, webDir, keyPath, goos, goarch, version string) (string, error) {
+	key, err := identity.LoadOrCreate(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("load release key: %w", err)
+	}
+	log.Printf("Signing with release key %s (%s)", keyPath, key.Fingerprint())
+
+	stage, err := os.MkdirTemp("", "nsm-release-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(stage)
+
+	buildTime := time.Now().UTC().Format(time.RFC3339)
+	if err := buildRelease(filepath.Join(stage, "nsm"), goos, goarch, version, buildTime); err != nil {
+		return "", fmt.Errorf("build: %w", err)
+	}
+	if err := copyTree(webDir, filepath.Join(stage, "internal", "web")); err != nil {
+		return "", fmt.Errorf("copy web assets: %w", err)
+	}
+	sums, err := checksums(stage)
+	if err != nil {
+		return "", fmt.Errorf("checksum: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(stage, "SHA256SUMS"), sums, 0644); err != nil {
+		return "", err
+	}
+	sig := base64.StdEncoding.EncodeToString(key.Sign(sums)) + "\n"
+	if err := os.WriteFile(filepath.Join(stage, "SHA256SUMS.sig"), []byte(sig), 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("nsm-%s-%s-%s.tar.gz", version, goos, goarch)
+	tarball := filepath.Join(outDir, name)
+	size, digest, err := writeTarball(stage, tarball)
+	if err != nil {
+		return "", fmt.Errorf("write %s: %w", name, err)
+	}
+
+	raw, err := json.Marshal(Release{
+		Version:   version,
+		BuildTime: buildTime,
+		OS:        goos,
+		Arch:      goarch,
+		File:      name,
+		Size:      size,
+		SHA256:    digest,
+		PublicKey: base64.StdEncoding.EncodeToString(key.PublicKey()),
+	})
+	if err != nil {
+		return "", err
+	}
+	env, err := json.Marshal(ReleaseEnvelope{Release: raw, Signature: base64.StdEncoding.EncodeToString(key.Sign(raw))})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "release.json"), append(env, '\n'), 0644); err != nil {
+		return "", err
+	}
+	log.Printf("Packaged %s (%d bytes, sha256 %s)", tarball, size, digest)
+	return tarball, nil
+}
+
+// publishRelease copies the tarball and release.json to dest, any rsync
+// destination. release.json goes last, so nodes never see it name a
+// tarball that is not there yet.
+func publishRelease(tarball, dest, keyPath string) error {
+	log.Printf("Publishing %s to %s", filepath.Base(tarball), dest)
+	if err := rsyncPublish(tarball, dest, keyPath); err != nil {
+		return err
+	}
+	return rsyncPublish(filepath.Join(filepath.Dir(tarball), "release.json"), dest, keyPath)
+}
+
+func rsyncPublish(src, dest, keyPath string) error {
+	args := []string{"-t", "--chmod=F644"}
+	if strings.Contains(dest, ":") {
+		args = append(args, "-e", fmt.Sprintf("ssh -i %s -o BatchMode=yes -o StrictHostKeyChecking=no", keyPath))
+	}
+	out, err := exec.Command("rsync", append(args, src, dest)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rsync output: %s | err: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// checksums lists the SHA-256 of every file under dir, in the format of
+// sha256sum, sorted by path.
+func checksums(dir string) ([]byte, error) {
+	var lines []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		lines = append(lines, fmt.Sprintf("%s  %s", hex.EncodeToString(h.Sum(nil)), filepath.ToSlash(rel)))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i][66:] < lines[j][66:] })
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// copyTree copies the regular files under src to dst.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// writeTarball writes the files under dir to a gzipped tarball at path and
+// returns its size and SHA-256.
+func writeTarball(dir, path string) (int64, string, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, h))
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = io.Copy(tw, in)
+		return err
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, "", err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, "", err
+	}
+	return info.Size(), hex.EncodeToString(h.Sum(nil)), nil
+}
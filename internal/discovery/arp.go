@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// arpTable is the kernel's neighbour table. NSM runs on Linux; elsewhere
+// it is missing and MACs are simply not collected.
+var arpTable = "/proc/net/arp"
+
+// ErrNoMAC is returned when the ARP table has no complete entry for an IP.
+var ErrNoMAC = errors.New("no ARP entry")
+
+// ReadARP returns the MAC address of each IP in this node's ARP table.
+// Incomplete entries, which the kernel keeps while it waits for a reply,
+// are left out.
+func ReadARP() (map[string]string, error) {
+	f, err := os.Open(arpTable)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// IP address  HW type  Flags  HW address  Mask  Device
+	macs := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[2] == "0x0" {
+			continue
+		}
+		mac, err := net.ParseMAC(fields[3])
+		if err != nil || mac.String() == "00:00:00:00:00:00" {
+			continue
+		}
+		macs[fields[0]] = mac.String()
+	}
+	return macs, scanner.Err()
+}
+
+// LookupMAC returns the MAC address of ip from the ARP table. An entry
+// exists once this node has exchanged packets with ip, e.g. after a scan
+// or health check reached it.
+func LookupMAC(ip string) (string, error) {
+	macs, err := ReadARP()
+	if err != nil {
+		return "", err
+	}
+	mac, ok := macs[ip]
+	if !ok {
+		return "", ErrNoMAC
+	}
+	return mac, nil
+}
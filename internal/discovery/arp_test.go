@@ -0,0 +1,28 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadARP(t *testing.T) {
+	arpTable = filepath.Join(t.TempDir(), "arp")
+	defer func() { arpTable = "/proc/net/arp" }()
+	os.WriteFile(arpTable, []byte(`IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.20     0x1         0x2         b8:27:eb:01:02:03     *        eth0
+192.168.1.21     0x1         0x0         00:00:00:00:00:00     *        eth0
+192.168.1.1      0x1         0x2         DC:A6:32:AA:BB:CC     *        eth0
+`), 0o644)
+
+	macs, err := ReadARP()
+	if err != nil {
+		t.Fatalf("ReadARP: %v", err)
+	}
+	if len(macs) != 2 || macs["192.168.1.20"] != "b8:27:eb:01:02:03" || macs["192.168.1.1"] != "dc:a6:32:aa:bb:cc" {
+		t.Errorf("unexpected table %v", macs)
+	}
+	if _, err := LookupMAC("192.168.1.21"); err != ErrNoMAC {
+		t.Errorf("expected ErrNoMAC for an incomplete entry, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package docs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Section is a titled part of a document that matched a search.
+type Section struct {
+	Doc     string `json:"doc"`
+	Title   string `json:"title"`
+	Excerpt string `json:"excerpt,omitempty"`
+}
+
+// excerptLen bounds the text shown around a match, in bytes.
+const excerptLen = 160
+
+// Search returns up to limit sections whose title or text contains query,
+// ignoring case. Title matches come first, then sections in document order.
+func (s *Service) Search(query string, limit int) ([]Section, error) {
+	names, err := s.ListDocs()
+	if err != nil {
+		return nil, err
+	}
+
+	query = strings.ToLower(query)
+	var byTitle, byText []Section
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(s.docsDir, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, sec := range splitSections(string(data)) {
+			switch {
+			case strings.Contains(strings.ToLower(sec.title), query):
+				byTitle = append(byTitle, Section{Doc: name, Title: sec.title, Excerpt: excerpt(sec.body, "")})
+			case strings.Contains(strings.ToLower(sec.body), query):
+				byText = append(byText, Section{Doc: name, Title: sec.title, Excerpt: excerpt(sec.body, query)})
+			}
+		}
+	}
+
+	results := append(byTitle, byText...)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+type section struct {
+	title string
+	body  string
+}
+
+// splitSections splits AsciiDoc source at its section titles ("== Title"
+// and deeper). Text before the first section is left out, as is the
+// content of listing blocks, so that examples do not match.
+func splitSections(src string) []section {
+	var sections []section
+	var body strings.Builder
+	inListing := false
+	flush := func() {
+		if len(sections) > 0 {
+			sections[len(sections)-1].body = strings.Join(strings.Fields(body.String()), " ")
+		}
+		body.Reset()
+	}
+	for _, line := range strings.Split(src, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "----" {
+			inListing = !inListing
+			continue
+		}
+		if inListing {
+			continue
+		}
+		if strings.HasPrefix(line, "==") {
+			if title, ok := strings.CutPrefix(strings.TrimLeft(line, "="), " "); ok {
+				flush()
+				sections = append(sections, section{title: strings.TrimSpace(title)})
+				continue
+			}
+		}
+		if strings.HasPrefix(line, "[") || strings.HasPrefix(line, "|===") {
+			continue // Block attributes and table delimiters
+		}
+		body.WriteString(line)
+		body.WriteByte('\n')
+	}
+	flush()
+	return sections
+}
+
+// excerpt returns up to excerptLen bytes of text around the first match of
+// query, or from the start when query is empty.
+func excerpt(text, query string) string {
+	start := 0
+	if query != "" {
+		if i := strings.Index(strings.ToLower(text), query); i > excerptLen/4 {
+			start = i - excerptLen/4
+		}
+	}
+	if i := strings.IndexByte(text[start:], ' '); start > 0 && i >= 0 {
+		start += i + 1 // Begin on a word
+	}
+	end := min(start+excerptLen, len(text))
+	if i := strings.LastIndexByte(text[start:end], ' '); end < len(text) && i > 0 {
+		end = start + i // End on a word
+	}
+	out := strings.TrimSpace(text[start:end])
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(text) {
+		out += "…"
+	}
+	return out
+}
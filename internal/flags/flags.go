@@ -0,0 +1,179 @@
+// Package flags turns risky subsystems on for some nodes only, so a new
+// capability can be tried on a few hosts of a production fleet before all
+// of them. A flag is on for the hosts named for it, off for those excluded
+// and, for the rest, on for a fixed share picked by hashing the flag and
+// host ID. Settings are not replicated: each node reads its own, so the
+// same settings saved on every node turn a flag on for the same hosts.
+package flags
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ConfigSettingKey holds this node's flag settings.
+const ConfigSettingKey = "flags"
+
+// Flags that can be set.
+const (
+	PeerBus = "peer_bus" // Post to peers over the WebSocket bus instead of an HTTP request each
+)
+
+// Definition describes a flag.
+type Definition struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"` // Whether the flag is on for hosts without a rule
+}
+
+// Known lists the flags in the order the API shows them. Subsystems add
+// theirs here.
+var Known = []Definition{
+	{Name: PeerBus, Description: "Post announcements, heartbeats and logs to peers over one WebSocket each", Default: true},
+}
+
+// Lookup returns the definition of name.
+func Lookup(name string) (Definition, bool) {
+	for _, d := range Known {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// Rule sets a flag for part of the fleet. Hosts and Except name host IDs.
+type Rule struct {
+	Hosts   []string `json:"hosts,omitempty"`  // On for these whatever Percent is
+	Except  []string `json:"except,omitempty"` // Off for these whatever Percent is
+	Percent int      `json:"percent"`          // Share of the other hosts it is on for, 0-100
+}
+
+// Config holds a rule for each flag set; flags without one take their
+// default.
+type Config struct {
+	Rules map[string]Rule `json:"rules"`
+}
+
+// DefaultConfig is used until an operator saves flag settings.
+func DefaultConfig() Config {
+	return Config{Rules: map[string]Rule{}}
+}
+
+// Validate normalises c and rejects unknown flags and unusable values.
+func (c *Config) Validate() error {
+	if c.Rules == nil {
+		c.Rules = map[string]Rule{}
+	}
+	for name, rule := range c.Rules {
+		if _, ok := Lookup(name); !ok {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return fmt.Errorf("%s: percent must be between 0 and 100", name)
+		}
+		rule.Hosts = cleanIDs(rule.Hosts)
+		rule.Except = cleanIDs(rule.Except)
+		for _, id := range rule.Hosts {
+			if slices.Contains(rule.Except, id) {
+				return fmt.Errorf("%s: host %q is both included and excepted", name, id)
+			}
+		}
+		c.Rules[name] = rule
+	}
+	return nil
+}
+
+func cleanIDs(ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if id = strings.TrimSpace(id); id != "" && !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Bucket places hostID in 0-99 for name. Raising a flag's percent keeps
+// the hosts it was already on for.
+func Bucket(name, hostID string) int {
+	sum := sha256.Sum256([]byte(name + "/" + hostID))
+	return int(binary.BigEndian.Uint32(sum[:4]) % 100)
+}
+
+// Enabled reports whether name is on for hostID.
+func (c Config) Enabled(name, hostID string) bool {
+	rule, ok := c.Rules[name]
+	if !ok {
+		def, _ := Lookup(name)
+		return def.Default
+	}
+	if slices.Contains(rule.Except, hostID) {
+		return false
+	}
+	if slices.Contains(rule.Hosts, hostID) {
+		return true
+	}
+	return Bucket(name, hostID) < rule.Percent
+}
+
+// LoadConfig reads the flag settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(ConfigSettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = map[string]Rule{}
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the flag settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(ConfigSettingKey, cfg)
+}
+
+// LocalProvider identifies the node flags are read for.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// Set answers whether a flag is on for this node, reading the settings on
+// each call so a change applies without a restart.
+type Set struct {
+	store  *hosts.Store
+	local  LocalProvider
+	logger *logger.Logger
+}
+
+// New creates a set for the node local describes.
+func New(store *hosts.Store, local LocalProvider, lg *logger.Logger) *Set {
+	return &Set{store: store, local: local, logger: lg}
+}
+
+// On reports whether name is on for this node. It gives the flag's
+// default while the settings or the node ID cannot be read.
+func (s *Set) On(name string) bool {
+	def, _ := Lookup(name)
+	cfg, err := LoadConfig(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Flags: %v; %s keeps its default", err, name))
+		return def.Default
+	}
+	self, err := s.local.GetMetadata()
+	if err != nil {
+		return def.Default
+	}
+	return cfg.Enabled(name, self.ID)
+}
@@ -0,0 +1,58 @@
+package flags
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEnabled(t *testing.T) {
+	cfg := DefaultConfig()
+	if !cfg.Enabled(PeerBus, "host-1") {
+		t.Error("expected a flag without a rule to take its default")
+	}
+
+	cfg.Rules[PeerBus] = Rule{Hosts: []string{" host-1 ", "host-1"}, Except: []string{"host-2"}, Percent: 100}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if got := cfg.Rules[PeerBus].Hosts; len(got) != 1 || got[0] != "host-1" {
+		t.Errorf("expected host IDs trimmed and deduplicated, got %v", got)
+	}
+	if !cfg.Enabled(PeerBus, "host-1") || cfg.Enabled(PeerBus, "host-2") || !cfg.Enabled(PeerBus, "host-3") {
+		t.Error("expected listed hosts on, excepted hosts off and the rest at 100%")
+	}
+
+	// A share of the fleet, and raising it keeps the hosts already on.
+	on := func(percent int) map[string]bool {
+		c := Config{Rules: map[string]Rule{PeerBus: {Percent: percent}}}
+		out := map[string]bool{}
+		for i := range 1000 {
+			if id := fmt.Sprintf("host-%d", i); c.Enabled(PeerBus, id) {
+				out[id] = true
+			}
+		}
+		return out
+	}
+	quarter, half := on(25), on(50)
+	if len(quarter) < 200 || len(quarter) > 300 {
+		t.Errorf("expected about 250 of 1000 hosts at 25%%, got %d", len(quarter))
+	}
+	for id := range quarter {
+		if !half[id] {
+			t.Fatalf("expected %s to stay on at 50%%", id)
+		}
+	}
+	if len(on(0)) != 0 {
+		t.Error("expected no host at 0%")
+	}
+
+	for name, bad := range map[string]Config{
+		"unknown flag": {Rules: map[string]Rule{"consensus": {}}},
+		"percent":      {Rules: map[string]Rule{PeerBus: {Percent: 101}}},
+		"both lists":   {Rules: map[string]Rule{PeerBus: {Hosts: []string{"a"}, Except: []string{"a"}}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("%s: expected %+v refused", name, bad)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package gitexport
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"nexsign.mini/nsm/internal/calendar"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/rebooting"
+	"nexsign.mini/nsm/internal/reports"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// managed are the files and directories the exporter owns in the working
+// copy. They are rewritten on each export; anything else is left alone.
+var managed = []string{"hosts.yaml", "presets", "schedules"}
+
+// Host holds the fields of a host an operator manages. Health and other
+// measured fields change on every check, so they are left out to keep the
+// history to real changes.
+type Host struct {
+	ID             string               `json:"id"`
+	Nickname       string               `json:"nickname"`
+	IPAddress      string               `json:"ip_address"`
+	VPNIPAddress   string               `json:"vpn_ip_address,omitempty"`
+	Hostname       string               `json:"hostname,omitempty"`
+	Notes          string               `json:"notes,omitempty"`
+	PathPreference types.PathPreference `json:"path_preference,omitempty"`
+	Timezone       string               `json:"timezone,omitempty"`
+	CMS            types.CMSKind        `json:"cms,omitempty"`
+	MACAddress     string               `json:"mac_address,omitempty"`
+}
+
+func exportHosts(list []types.Host) []Host {
+	out := make([]Host, 0, len(list))
+	for _, h := range list {
+		out = append(out, Host{
+			ID:             h.ID,
+			Nickname:       h.Nickname,
+			IPAddress:      h.IPAddress,
+			VPNIPAddress:   h.VPNIPAddress,
+			Hostname:       h.Hostname,
+			Notes:          h.Notes,
+			PathPreference: h.PathPreference,
+			Timezone:       h.Timezone,
+			CMS:            h.CMS,
+			MACAddress:     h.MACAddress,
+		})
+	}
+	return out
+}
+
+// preset is the file written for each saved preset.
+type preset struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Hosts       []Host    `json:"hosts"`
+}
+
+// Dump returns the files describing the fleet, by path relative to the
+// repository root: the host list, each preset, and the reboot, report and
+// calendar schedules. Calendar feed URLs are left out, as private
+// calendar links carry their own access token.
+func Dump(store *hosts.Store) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	add := func(path string, v any) error {
+		data, err := toYAML(v)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", path, err)
+		}
+		files[path] = data
+		return nil
+	}
+
+	if err := add("hosts.yaml", map[string]any{"hosts": exportHosts(store.GetAll())}); err != nil {
+		return nil, err
+	}
+
+	snaps, err := store.ListSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	for _, snap := range snaps {
+		name := fileName(snap.Name)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", fileName(snap.Name), i)
+		}
+		used[name] = true
+		p := preset{Name: snap.Name, Description: snap.Description, CreatedAt: snap.CreatedAt.UTC(), Hosts: exportHosts(snap.Hosts)}
+		if err := add(filepath.Join("presets", name+".yaml"), p); err != nil {
+			return nil, err
+		}
+	}
+
+	reboots, err := rebooting.LoadSchedules(store)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(filepath.Join("schedules", "reboots.yaml"), map[string]any{"schedules": reboots}); err != nil {
+		return nil, err
+	}
+	report, err := reports.LoadConfig(store)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(filepath.Join("schedules", "reports.yaml"), report); err != nil {
+		return nil, err
+	}
+	cal, err := calendar.LoadConfig(store)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cal.Feeds {
+		cal.Feeds[i].URL = ""
+	}
+	if err := add(filepath.Join("schedules", "calendars.yaml"), cal); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// write replaces the managed files in dir with files.
+func write(dir string, files map[string][]byte) error {
+	for _, name := range managed {
+		if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	for path, data := range files {
+		full := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(full, data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toYAML renders v as YAML with the keys of its JSON encoding, in field
+// order.
+func toYAML(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ordered yaml.MapSlice
+	if err := yaml.Unmarshal(data, &ordered); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(ordered)
+}
+
+// fileName turns a preset name into a file name: lower case, with runs of
+// anything but letters and digits as a single dash.
+func fileName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	out := strings.TrimSuffix(b.String(), "-")
+	if out == "" {
+		out = "preset"
+	}
+	return out
+}
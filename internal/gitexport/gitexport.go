@@ -0,0 +1,305 @@
+// Package gitexport commits YAML dumps of the fleet state (hosts, presets
+// and schedules) to a Git repository and pushes them to a remote, so
+// operators get the history of every change, can review changes as they
+// would code, and can rebuild a node from the repository. It runs the git
+// binary, so git must be installed on the node.
+package gitexport
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+)
+
+// Settings keys used by the exporter.
+const (
+	SettingKey      = "git_export"
+	StateSettingKey = "git_export.state"
+)
+
+// ErrNoGit is returned when the git binary is not installed.
+var ErrNoGit = errors.New("git is not installed on this node")
+
+// Config controls the export. Remote is any URL git can push to. For
+// https remotes, Token is sent as the password of user x-access-token,
+// which GitHub, GitLab and Gitea accept; ssh remotes use the keys of the
+// user NSM runs as.
+type Config struct {
+	Enabled         bool   `json:"enabled"`
+	Remote          string `json:"remote"`
+	Branch          string `json:"branch"`
+	Token           string `json:"token,omitempty"`
+	IntervalMinutes int    `json:"interval_minutes"`
+	AuthorName      string `json:"author_name"`
+	AuthorEmail     string `json:"author_email"`
+}
+
+// DefaultConfig is used until an operator saves export settings.
+func DefaultConfig() Config {
+	return Config{Branch: "main", IntervalMinutes: 60, AuthorName: "nexSign mini", AuthorEmail: "nsm@localhost"}
+}
+
+// Validate normalises cfg and rejects unusable values.
+func (c *Config) Validate() error {
+	c.Remote = strings.TrimSpace(c.Remote)
+	c.Branch = strings.TrimSpace(c.Branch)
+	if c.Enabled && c.Remote == "" {
+		return errors.New("remote is required when the export is enabled")
+	}
+	if strings.HasPrefix(c.Remote, "-") {
+		return errors.New("invalid remote")
+	}
+	if c.Branch == "" {
+		c.Branch = "main"
+	}
+	if strings.HasPrefix(c.Branch, "-") || strings.ContainsAny(c.Branch, " ~^:?*[\\") || strings.Contains(c.Branch, "..") {
+		return fmt.Errorf("invalid branch %q", c.Branch)
+	}
+	if c.IntervalMinutes < 5 {
+		return errors.New("interval_minutes must be at least 5")
+	}
+	if strings.TrimSpace(c.AuthorName) == "" || strings.TrimSpace(c.AuthorEmail) == "" {
+		return errors.New("author_name and author_email are required")
+	}
+	return nil
+}
+
+// Masked returns a copy safe to return from the API.
+func (c Config) Masked() Config {
+	if c.Token != "" {
+		c.Token = "********"
+	}
+	return c
+}
+
+// LoadConfig reads the export settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the export settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// State records the last export.
+type State struct {
+	LastRunAt time.Time `json:"last_run_at,omitzero"`
+	Commit    string    `json:"commit,omitempty"`    // Commit on the remote after the last successful export
+	ChangedAt time.Time `json:"changed_at,omitzero"` // Last export that found changes to commit
+	Error     string    `json:"error,omitempty"`     // Why the last export failed
+}
+
+// LoadState returns the last export.
+func LoadState(store hosts.SettingStore) (State, error) {
+	var st State
+	if _, err := store.GetSetting(StateSettingKey, &st); err != nil {
+		return State{}, err
+	}
+	return st, nil
+}
+
+// Dir returns the working copy the exporter commits in.
+func Dir(store *hosts.Store) string {
+	return filepath.Join(store.Dir(), "git-export")
+}
+
+// exportMu keeps scheduled and manual exports from sharing the working
+// copy.
+var exportMu sync.Mutex
+
+// Export writes the current dump into the working copy on top of the
+// remote branch, commits it if anything changed and pushes it. The result
+// is saved as the State.
+func Export(store *hosts.Store, cfg Config, now time.Time) (State, error) {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+
+	st, err := LoadState(store)
+	if err != nil {
+		return State{}, err
+	}
+	st.LastRunAt = now.UTC()
+	changed, commit, err := export(store, cfg, now)
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Commit = commit
+		if changed {
+			st.ChangedAt = now.UTC()
+		}
+	}
+	if perr := store.PutSetting(StateSettingKey, st); perr != nil && err == nil {
+		err = perr
+	}
+	return st, err
+}
+
+func export(store *hosts.Store, cfg Config, now time.Time) (bool, string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return false, "", ErrNoGit
+	}
+	files, err := Dump(store)
+	if err != nil {
+		return false, "", err
+	}
+	g := repo{dir: Dir(store), env: cfg.env()}
+
+	if _, err := os.Stat(filepath.Join(g.dir, ".git")); err != nil {
+		if err := os.MkdirAll(g.dir, 0700); err != nil {
+			return false, "", err
+		}
+		if _, err := g.run("init", "-q"); err != nil {
+			return false, "", err
+		}
+	}
+	if _, err := g.run("symbolic-ref", "HEAD", "refs/heads/"+cfg.Branch); err != nil {
+		return false, "", err
+	}
+	// Start from the remote branch, so commits made elsewhere are kept. A
+	// new remote has no branch to fetch yet.
+	if _, err := g.run("fetch", "-q", "--", cfg.Remote, cfg.Branch); err == nil {
+		if _, err := g.run("reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+			return false, "", err
+		}
+	} else if !strings.Contains(err.Error(), "couldn't find remote ref") {
+		return false, "", err
+	}
+
+	if err := write(g.dir, files); err != nil {
+		return false, "", fmt.Errorf("write export: %w", err)
+	}
+	if _, err := g.run("add", "-A", "--", "."); err != nil {
+		return false, "", err
+	}
+	status, err := g.run("status", "--porcelain")
+	if err != nil {
+		return false, "", err
+	}
+	changed := strings.TrimSpace(status) != ""
+	if changed {
+		hostname, _ := os.Hostname()
+		msg := fmt.Sprintf("Fleet state from %s at %s", hostname, now.UTC().Format(time.RFC3339))
+		if _, err := g.run("commit", "-q", "-m", msg); err != nil {
+			return false, "", err
+		}
+		if _, err := g.run("push", "-q", "--", cfg.Remote, "HEAD:refs/heads/"+cfg.Branch); err != nil {
+			return false, "", err
+		}
+	}
+	commit, err := g.run("rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		// Nothing to export into an empty remote has no commit yet.
+		return changed, "", nil
+	}
+	return changed, strings.TrimSpace(commit), nil
+}
+
+// env passes the author and, for https remotes, the token to git through
+// the environment, where other users cannot read them.
+func (c Config) env() []string {
+	env := []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_AUTHOR_NAME=" + c.AuthorName, "GIT_AUTHOR_EMAIL=" + c.AuthorEmail,
+		"GIT_COMMITTER_NAME=" + c.AuthorName, "GIT_COMMITTER_EMAIL=" + c.AuthorEmail,
+	}
+	if u, err := url.Parse(c.Remote); err == nil && u.Scheme == "https" && c.Token != "" {
+		basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + c.Token))
+		env = append(env, "GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+basic)
+	}
+	return env
+}
+
+// repo runs git in a working copy.
+type repo struct {
+	dir string
+	env []string
+}
+
+func (g repo) run(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = g.dir
+	cmd.Env = append(os.Environ(), g.env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+// Exporter runs the export every cfg.IntervalMinutes while it is enabled.
+type Exporter struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+}
+
+// NewExporter creates an exporter that checks every minute whether an
+// export is due.
+func NewExporter(store *hosts.Store, lg *logger.Logger) *Exporter {
+	return &Exporter{store: store, logger: lg, interval: time.Minute}
+}
+
+// Run exports until the process exits.
+func (e *Exporter) Run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		e.Check(time.Now())
+	}
+}
+
+// Check exports if the export is enabled and the interval has passed
+// since the last run.
+func (e *Exporter) Check(now time.Time) {
+	cfg, err := LoadConfig(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Git export: failed to load settings: %v", err))
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+	st, err := LoadState(e.store)
+	if err != nil {
+		e.logger.Warning(fmt.Sprintf("Git export: failed to load state: %v", err))
+		return
+	}
+	if now.Sub(st.LastRunAt) < time.Duration(cfg.IntervalMinutes)*time.Minute {
+		return
+	}
+	st, err = Export(e.store, cfg, now)
+	switch {
+	case err != nil:
+		e.logger.Warning(fmt.Sprintf("Git export: %v", err))
+	case st.ChangedAt.Equal(now.UTC()):
+		e.logger.Info(fmt.Sprintf("Git export: pushed %s to %s", shortCommit(st.Commit), cfg.Branch))
+	}
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
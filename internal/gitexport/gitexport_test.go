@@ -0,0 +1,123 @@
+package gitexport
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/rebooting"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestExport(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	remote := filepath.Join(t.TempDir(), "fleet.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", remote).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+	log := func() []string {
+		out, err := exec.Command("git", "-C", remote, "log", "--format=%an|%s", "main").CombinedOutput()
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(out)), "\n")
+	}
+	show := func(path string) string {
+		out, _ := exec.Command("git", "-C", remote, "show", "main:"+path).CombinedOutput()
+		return string(out)
+	}
+
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20", Nickname: "Lobby", Status: types.StatusHealthy})
+	if _, err := store.SaveSnapshot("Event Mode", "Doors open"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rebooting.SaveSchedules(store, []rebooting.Schedule{{Name: "Nightly", Hosts: []string{"a"}, At: "04:00"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Remote = remote
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	st, err := Export(store, cfg, now)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if commits := log(); len(commits) != 1 || !strings.HasPrefix(commits[0], "nexSign mini|Fleet state from") {
+		t.Fatalf("expected one commit on the remote, got %q", commits)
+	}
+	if st.Commit == "" || !st.ChangedAt.Equal(now) || st.Error != "" {
+		t.Errorf("unexpected state %+v", st)
+	}
+	hostsYAML := show("hosts.yaml")
+	if !strings.Contains(hostsYAML, "nickname: Lobby") || strings.Contains(hostsYAML, "status") {
+		t.Errorf("expected the host's configuration without its health, got:\n%s", hostsYAML)
+	}
+	if p := show("presets/event-mode.yaml"); !strings.HasPrefix(p, "name: Event Mode\ndescription: Doors open\n") {
+		t.Errorf("expected the preset with its fields in order, got:\n%s", p)
+	}
+	if s := show("schedules/reboots.yaml"); !strings.Contains(s, "name: Nightly") {
+		t.Errorf("expected the reboot schedule, got:\n%s", s)
+	}
+
+	// Nothing changed: nothing to commit. Health changes do not count.
+	store.Update("192.168.1.20", func(h *types.Host) { h.Status = types.StatusUnreachable })
+	if _, err := Export(store, cfg, now.Add(time.Hour)); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if commits := log(); len(commits) != 1 {
+		t.Fatalf("expected no commit without changes, got %q", commits)
+	}
+
+	// A deleted preset is removed from the repository.
+	store.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Front door" })
+	store.DeleteSnapshot("Event Mode")
+	if _, err := Export(store, cfg, now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if commits := log(); len(commits) != 2 {
+		t.Fatalf("expected a second commit, got %q", commits)
+	}
+	if !strings.Contains(show("hosts.yaml"), "nickname: Front door") || !strings.Contains(show("presets/event-mode.yaml"), "does not exist") {
+		t.Error("expected the rename committed and the preset removed")
+	}
+
+	cfg.Remote = filepath.Join(t.TempDir(), "missing.git")
+	if st, err := Export(store, cfg, now.Add(3*time.Hour)); err == nil || st.Error == "" {
+		t.Errorf("expected an unreachable remote recorded as an error, got %+v", st)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Enabled = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a remote required when enabled")
+	}
+	cfg.Remote = "--upload-pack=touch /tmp/x"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a remote that looks like an option refused")
+	}
+	cfg.Remote = "https://git.example.com/venue/fleet.git"
+	cfg.Branch = "main..x"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an invalid branch refused")
+	}
+	cfg.Branch = ""
+	if err := cfg.Validate(); err != nil || cfg.Branch != "main" {
+		t.Errorf("expected the default branch, got %q (%v)", cfg.Branch, err)
+	}
+	cfg.Token = "secret"
+	if env := strings.Join(cfg.env(), "\n"); !strings.Contains(env, "GIT_CONFIG_VALUE_0=Authorization: Basic ") || strings.Contains(env, "secret") {
+		t.Errorf("expected the token passed as an encoded header, got %q", env)
+	}
+}
@@ -0,0 +1,321 @@
+// Package graphql runs read-only GraphQL queries against a schema of Go
+// resolvers. It implements the subset integrators need to fetch exactly
+// the fields they want in one request: queries with variables, aliases,
+// arguments and nested selections. There is no introspection; the schema
+// is described in the docs.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Resolver returns the value of a field of source, which is the value the
+// parent field resolved to (nil at the root).
+type Resolver func(ctx context.Context, source any, args Args) (any, error)
+
+// Field is a field of an Object.
+type Field struct {
+	// Type is the object the field resolves to, or to a slice of; nil for
+	// scalars, which are returned as their JSON encoding.
+	Type *Object
+	// Args are the argument names the field accepts.
+	Args []string
+	// Resolve computes the value.
+	Resolve Resolver
+}
+
+// Object is an object type: a name and its fields.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Struct returns an object with a scalar field for each JSON-tagged field
+// of sample's struct type, read from the source struct (or pointer to one).
+// Callers add fields that need resolving themselves.
+func Struct(name string, sample any) *Object {
+	obj := &Object{Name: name, Fields: make(map[string]*Field)}
+	t := reflect.TypeOf(sample)
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if tag == "-" || tag == "" || !sf.IsExported() {
+			continue
+		}
+		index := sf.Index
+		obj.Fields[tag] = &Field{Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+			v := reflect.ValueOf(source)
+			if v.Kind() == reflect.Pointer {
+				if v.IsNil() {
+					return nil, nil
+				}
+				v = v.Elem()
+			}
+			return v.FieldByIndex(index).Interface(), nil
+		}}
+	}
+	return obj
+}
+
+// Schema is the root query type.
+type Schema struct {
+	Query *Object
+}
+
+// Request is a query as posted by clients.
+type Request struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+}
+
+// Error is a query or field error. Path locates a field error in the
+// result.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Response is the result of a query. Data is nil when the query could not
+// run at all.
+type Response struct {
+	Data   any     `json:"data"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Do runs the query in req. Invalid queries get only errors; a field that
+// fails resolves to null with an error naming its path, and the rest of
+// the result is still returned.
+func (s *Schema) Do(ctx context.Context, req Request) Response {
+	ops, err := parse(req.Query)
+	if err != nil {
+		return errorResponse(err)
+	}
+	op, err := selectOperation(ops, req.OperationName)
+	if err != nil {
+		return errorResponse(err)
+	}
+	vars, err := coerceVariables(op.variables, req.Variables)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err := validate(s.Query, op.selection); err != nil {
+		return errorResponse(err)
+	}
+
+	e := &executor{vars: vars}
+	data := e.object(ctx, s.Query, nil, op.selection, nil)
+	return Response{Data: data, Errors: e.errors}
+}
+
+func errorResponse(err error) Response {
+	return Response{Errors: []Error{{Message: err.Error()}}}
+}
+
+func selectOperation(ops []operation, name string) (operation, error) {
+	if name == "" {
+		if len(ops) > 1 {
+			return operation{}, fmt.Errorf("operationName is required when the query has several operations")
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return operation{}, fmt.Errorf("unknown operation %q", name)
+}
+
+func coerceVariables(defs []variableDef, given map[string]any) (map[string]any, error) {
+	vars := make(map[string]any, len(defs))
+	for _, d := range defs {
+		v, ok := given[d.name]
+		if !ok || v == nil {
+			v = d.def
+		}
+		if v == nil && d.required {
+			return nil, fmt.Errorf("variable $%s is required", d.name)
+		}
+		vars[d.name] = v
+	}
+	return vars, nil
+}
+
+// validate checks that every selected field exists with the arguments
+// given, and that objects, and only objects, have selections.
+func validate(obj *Object, selection []field) error {
+	for _, f := range selection {
+		if f.name == "__typename" {
+			continue
+		}
+		def, ok := obj.Fields[f.name]
+		if !ok {
+			return fmt.Errorf("line %d, column %d: cannot query field %q on type %s", f.line, f.col, f.name, obj.Name)
+		}
+		for arg := range f.args {
+			if !slices.Contains(def.Args, arg) {
+				return fmt.Errorf("line %d, column %d: unknown argument %q on field %s.%s", f.line, f.col, arg, obj.Name, f.name)
+			}
+		}
+		switch {
+		case def.Type != nil && f.selection == nil:
+			return fmt.Errorf("line %d, column %d: field %s.%s of type %s needs a selection of subfields", f.line, f.col, obj.Name, f.name, def.Type.Name)
+		case def.Type == nil && f.selection != nil:
+			return fmt.Errorf("line %d, column %d: field %s.%s has no subfields", f.line, f.col, obj.Name, f.name)
+		case def.Type != nil:
+			if err := validate(def.Type, f.selection); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type executor struct {
+	vars   map[string]any
+	errors []Error
+}
+
+func (e *executor) object(ctx context.Context, obj *Object, source any, selection []field, path []any) *ordered {
+	out := &ordered{}
+	for _, f := range selection {
+		fieldPath := append(append([]any{}, path...), f.alias)
+		if f.name == "__typename" {
+			out.set(f.alias, obj.Name)
+			continue
+		}
+		def := obj.Fields[f.name]
+		v, err := def.Resolve(ctx, source, e.args(f.args))
+		if err != nil {
+			e.errors = append(e.errors, Error{Message: err.Error(), Path: fieldPath})
+			out.set(f.alias, nil)
+			continue
+		}
+		if def.Type != nil {
+			v = e.complete(ctx, def.Type, v, f.selection, fieldPath)
+		}
+		out.set(f.alias, v)
+	}
+	return out
+}
+
+// complete resolves the selection on v, an object or a slice of objects.
+func (e *executor) complete(ctx context.Context, obj *Object, v any, selection []field, path []any) any {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return nil
+	}
+	if rv.Kind() != reflect.Slice {
+		return e.object(ctx, obj, v, selection, path)
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = e.object(ctx, obj, rv.Index(i).Interface(), selection, append(append([]any{}, path...), i))
+	}
+	return list
+}
+
+// args replaces variable references with their values.
+func (e *executor) args(raw map[string]any) Args {
+	args := make(Args, len(raw))
+	for k, v := range raw {
+		args[k] = e.resolve(v)
+	}
+	return args
+}
+
+func (e *executor) resolve(v any) any {
+	switch v := v.(type) {
+	case variable:
+		return e.vars[string(v)]
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = e.resolve(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = e.resolve(item)
+		}
+		return out
+	}
+	return v
+}
+
+// Args are a field's argument values.
+type Args map[string]any
+
+// String returns the string argument name, or "" when it is absent.
+func (a Args) String(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+}
+
+// Int returns the integer argument name, or def when it is absent.
+// Variables arrive from JSON as floats, so whole floats are accepted.
+func (a Args) Int(name string, def int) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return v, nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %q must be an integer", name)
+}
+
+// ordered is a JSON object that keeps its keys in selection order, as
+// GraphQL results do.
+type ordered struct {
+	keys []string
+	vals []any
+}
+
+func (o *ordered) set(key string, v any) {
+	for i, k := range o.keys {
+		if k == key {
+			o.vals[i] = v
+			return
+		}
+	}
+	o.keys = append(o.keys, key)
+	o.vals = append(o.vals, v)
+}
+
+func (o *ordered) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(o.vals[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
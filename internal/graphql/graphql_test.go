@@ -0,0 +1,106 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testHost struct {
+	ID       string `json:"id"`
+	Nickname string `json:"nickname"`
+	Secret   string `json:"-"`
+}
+
+func testSchema() *Schema {
+	hosts := []testHost{{ID: "a", Nickname: "Lobby"}, {ID: "b", Nickname: "Cafe"}}
+	host := Struct("Host", testHost{})
+	host.Fields["tags"] = &Field{Resolve: func(_ context.Context, source any, _ Args) (any, error) {
+		if source.(testHost).ID == "b" {
+			return nil, errors.New("tags unavailable")
+		}
+		return []string{"front"}, nil
+	}}
+	return &Schema{Query: &Object{Name: "Query", Fields: map[string]*Field{
+		"hosts": {Type: host, Args: []string{"limit"}, Resolve: func(_ context.Context, _ any, args Args) (any, error) {
+			limit, err := args.Int("limit", len(hosts))
+			if err != nil {
+				return nil, err
+			}
+			return hosts[:min(limit, len(hosts))], nil
+		}},
+		"host": {Type: host, Args: []string{"id"}, Resolve: func(_ context.Context, _ any, args Args) (any, error) {
+			id, err := args.String("id")
+			for _, h := range hosts {
+				if h.ID == id {
+					return h, err
+				}
+			}
+			return nil, err
+		}},
+	}}}
+}
+
+func run(t *testing.T, req Request) string {
+	t.Helper()
+	data, err := json.Marshal(testSchema().Do(context.Background(), req))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"selection order and aliases", Request{Query: `{ hosts(limit: 1) { name: nickname id } }`},
+			`{"data":{"hosts":[{"name":"Lobby","id":"a"}]}}`},
+		{"variables", Request{Query: `query One($id: String!) { host(id: $id) { __typename nickname } }`, Variables: map[string]any{"id": "b"}},
+			`{"data":{"host":{"__typename":"Host","nickname":"Cafe"}}}`},
+		{"default variable", Request{Query: `query ($n: Int = 1) { hosts(limit: $n) { id } }`},
+			`{"data":{"hosts":[{"id":"a"}]}}`},
+		{"null object", Request{Query: `{ host(id: "zzz") { id } }`},
+			`{"data":{"host":null}}`},
+		{"field error", Request{Query: `{ hosts { id tags } }`},
+			`{"data":{"hosts":[{"id":"a","tags":["front"]},{"id":"b","tags":null}]},"errors":[{"message":"tags unavailable","path":["hosts",1,"tags"]}]}`},
+		{"named operation", Request{Query: `query A { hosts { id } } query B { host(id: "a") { id } }`, OperationName: "B"},
+			`{"data":{"host":{"id":"a"}}}`},
+	}
+	for _, tt := range tests {
+		if got := run(t, tt.req); got != tt.want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDoRejects(t *testing.T) {
+	tests := map[string]string{
+		`{ hosts { secret } }`:                              `cannot query field "secret" on type Host`,
+		`{ hosts }`:                                         "needs a selection of subfields",
+		`{ hosts { id { x } } }`:                            "has no subfields",
+		`{ hosts(first: 2) { id } }`:                        `unknown argument "first"`,
+		`mutation { reboot }`:                               "mutations are not supported",
+		`{ hosts { ...f } }`:                                "fragments are not supported",
+		`{ hosts { id }`:                                    "end of query",
+		`query ($id: String!) { host(id: $id) { id } }`:     "variable $id is required",
+		`query A { hosts { id } } query B { hosts { id } }`: "operationName is required",
+		`{ hosts(limit: "two") { id } }`:                    "", // A field error, not a rejection
+	}
+	for query, want := range tests {
+		resp := testSchema().Do(context.Background(), Request{Query: query})
+		if want == "" {
+			if resp.Data == nil || len(resp.Errors) != 1 {
+				t.Errorf("%s: expected data and a field error, got %+v", query, resp)
+			}
+			continue
+		}
+		if resp.Data != nil || len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, want) {
+			t.Errorf("%s: expected only the error %q, got %+v", query, want, resp)
+		}
+	}
+}
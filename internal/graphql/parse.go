@@ -0,0 +1,408 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// operation is a parsed query. Only the parts of the language NSM needs
+// are supported: queries with variables, aliases, arguments and nested
+// selections. Fragments, directives and mutations are rejected.
+type operation struct {
+	name      string
+	variables []variableDef
+	selection []field
+}
+
+type variableDef struct {
+	name     string
+	required bool
+	def      any // Default value, nil if none
+}
+
+type field struct {
+	alias     string // Result key; the field name when there is no alias
+	name      string
+	args      map[string]any // Values, with variable for $references
+	selection []field
+	line, col int
+}
+
+// variable is a $reference in an argument, resolved at execution.
+type variable string
+
+type token struct {
+	kind      tokenKind
+	text      string
+	line, col int
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+// lex splits a query into tokens, dropping whitespace, commas and
+// comments.
+func lex(src string) ([]token, error) {
+	var toks []token
+	line, lineStart := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		col := i - lineStart + 1
+		switch {
+		case c == '\n':
+			line, lineStart = line+1, i+1
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "..."):
+			toks = append(toks, token{tokPunct, "...", line, col})
+			i += 3
+		case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c), line, col})
+			i++
+		case c == '_' || isLetter(c):
+			j := i
+			for j < len(src) && (src[j] == '_' || isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			toks = append(toks, token{tokName, src[i:j], line, col})
+			i = j
+		case c == '-' || isDigit(c):
+			j, kind := i+1, tokInt
+			for j < len(src) && (isDigit(src[j]) || strings.IndexByte(".eE+-", src[j]) >= 0) {
+				if strings.IndexByte(".eE", src[j]) >= 0 {
+					kind = tokFloat
+				}
+				j++
+			}
+			toks = append(toks, token{kind, src[i:j], line, col})
+			i = j
+		case c == '"':
+			if strings.HasPrefix(src[i:], `"""`) {
+				return nil, fmt.Errorf("line %d, column %d: block strings are not supported", line, col)
+			}
+			j := i + 1
+			for j < len(src) && src[j] != '"' && src[j] != '\n' {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(src) || src[j] != '"' {
+				return nil, fmt.Errorf("line %d, column %d: unterminated string", line, col)
+			}
+			s, err := strconv.Unquote(src[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d, column %d: invalid string", line, col)
+			}
+			toks = append(toks, token{tokString, s, line, col})
+			i = j + 1
+		default:
+			return nil, fmt.Errorf("line %d, column %d: unexpected character %q", line, col, c)
+		}
+	}
+	return append(toks, token{kind: tokEOF, line: line}), nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isDigit(c byte) bool  { return c >= '0' && c <= '9' }
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(punct string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == punct
+}
+
+func (p *parser) expect(punct string) error {
+	if t := p.next(); t.kind != tokPunct || t.text != punct {
+		return p.errorf(t, "expected %q", punct)
+	}
+	return nil
+}
+
+func (p *parser) name() (token, error) {
+	t := p.next()
+	if t.kind != tokName {
+		return t, p.errorf(t, "expected a name")
+	}
+	return t, nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	found := t.text
+	if t.kind == tokEOF {
+		found = "end of query"
+	}
+	return fmt.Errorf("line %d, column %d: %s, found %q", t.line, t.col, fmt.Sprintf(format, args...), found)
+}
+
+// parse reads the operations of a query document.
+func parse(src string) ([]operation, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	var ops []operation
+	for p.peek().kind != tokEOF {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("the query has no operations")
+	}
+	return ops, nil
+}
+
+func (p *parser) operation() (operation, error) {
+	var op operation
+	if p.is("{") {
+		sel, err := p.selectionSet()
+		op.selection = sel
+		return op, err
+	}
+	t, err := p.name()
+	if err != nil {
+		return op, err
+	}
+	switch t.text {
+	case "query":
+	case "mutation", "subscription":
+		return op, fmt.Errorf("line %d, column %d: %ss are not supported; the API is read-only", t.line, t.col, t.text)
+	case "fragment":
+		return op, fmt.Errorf("line %d, column %d: fragments are not supported", t.line, t.col)
+	default:
+		return op, p.errorf(t, "expected query")
+	}
+	if p.peek().kind == tokName {
+		op.name = p.next().text
+	}
+	if p.is("(") {
+		if op.variables, err = p.variableDefs(); err != nil {
+			return op, err
+		}
+	}
+	if p.is("@") {
+		return op, p.errorf(p.peek(), "directives are not supported")
+	}
+	op.selection, err = p.selectionSet()
+	return op, err
+}
+
+func (p *parser) variableDefs() ([]variableDef, error) {
+	p.next() // (
+	var defs []variableDef
+	for !p.is(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		required, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		def := variableDef{name: name.text, required: required}
+		if p.is("=") {
+			p.next()
+			if def.def, err = p.value(true); err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	p.next() // )
+	return defs, nil
+}
+
+// typeRef skips a variable type, reporting whether it is non-null. Types
+// are not checked: arguments are coerced where they are used.
+func (p *parser) typeRef() (bool, error) {
+	if p.is("[") {
+		p.next()
+		if _, err := p.typeRef(); err != nil {
+			return false, err
+		}
+		if err := p.expect("]"); err != nil {
+			return false, err
+		}
+	} else if _, err := p.name(); err != nil {
+		return false, err
+	}
+	if p.is("!") {
+		p.next()
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *parser) selectionSet() ([]field, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var fields []field
+	for !p.is("}") {
+		if p.is("...") {
+			return nil, p.errorf(p.peek(), "fragments are not supported")
+		}
+		f, err := p.field()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, f)
+	}
+	p.next() // }
+	if len(fields) == 0 {
+		return nil, p.errorf(p.toks[p.pos-1], "expected at least one field")
+	}
+	return fields, nil
+}
+
+func (p *parser) field() (field, error) {
+	t, err := p.name()
+	if err != nil {
+		return field{}, err
+	}
+	f := field{alias: t.text, name: t.text, line: t.line, col: t.col}
+	if p.is(":") {
+		p.next()
+		n, err := p.name()
+		if err != nil {
+			return f, err
+		}
+		f.name = n.text
+	}
+	if p.is("(") {
+		p.next()
+		f.args = make(map[string]any)
+		for !p.is(")") {
+			n, err := p.name()
+			if err != nil {
+				return f, err
+			}
+			if err := p.expect(":"); err != nil {
+				return f, err
+			}
+			if f.args[n.text], err = p.value(false); err != nil {
+				return f, err
+			}
+		}
+		p.next() // )
+	}
+	if p.is("@") {
+		return f, p.errorf(p.peek(), "directives are not supported")
+	}
+	if p.is("{") {
+		if f.selection, err = p.selectionSet(); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// value reads an argument value. Enum values are kept as strings. const
+// values, for variable defaults, may not reference variables.
+func (p *parser) value(isConst bool) (any, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		n, err := strconv.Atoi(t.text)
+		if err != nil {
+			return nil, p.errorf(t, "invalid integer")
+		}
+		return n, nil
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number")
+		}
+		return f, nil
+	case tokString:
+		return t.text, nil
+	case tokName:
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.text, nil
+	case tokPunct:
+		switch t.text {
+		case "$":
+			if isConst {
+				return nil, p.errorf(t, "variables are not allowed here")
+			}
+			n, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return variable(n.text), nil
+		case "[":
+			list := []any{}
+			for !p.is("]") {
+				v, err := p.value(isConst)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			p.next()
+			return list, nil
+		case "{":
+			obj := map[string]any{}
+			for !p.is("}") {
+				n, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[n.text], err = p.value(isConst); err != nil {
+					return nil, err
+				}
+			}
+			p.next()
+			return obj, nil
+		}
+	}
+	return nil, p.errorf(t, "expected a value")
+}
@@ -0,0 +1,186 @@
+// Package grpc serves gRPC services over plain net/http. It implements
+// the wire protocol for unary and server-streaming calls with protobuf
+// messages, which are built and read by hand with Message and Fields.
+// Compression and client or bidirectional streaming are not supported.
+//
+// gRPC needs HTTP/2: the server must allow unencrypted HTTP/2 (see
+// http.Protocols) unless it is behind TLS.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Code is a gRPC status code.
+type Code int
+
+// Status codes returned by handlers.
+const (
+	OK                 Code = 0
+	Canceled           Code = 1
+	Unknown            Code = 2
+	InvalidArgument    Code = 3
+	NotFound           Code = 5
+	PermissionDenied   Code = 7
+	ResourceExhausted  Code = 8
+	FailedPrecondition Code = 9
+	Unimplemented      Code = 12
+	Internal           Code = 13
+	Unavailable        Code = 14
+)
+
+// maxMessage caps request messages; requests here are a few fields.
+const maxMessage = 1 << 20
+
+// Status is an error with a gRPC status code. Other errors returned by
+// handlers are sent as Unknown.
+type Status struct {
+	Code    Code
+	Message string
+}
+
+func (s *Status) Error() string {
+	return fmt.Sprintf("grpc: code %d: %s", s.Code, s.Message)
+}
+
+// Errorf returns a Status error.
+func Errorf(code Code, format string, args ...any) error {
+	return &Status{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// UnaryHandler answers a call with one response message.
+type UnaryHandler func(ctx context.Context, req Fields) (*Message, error)
+
+// StreamHandler answers a call by sending messages until it returns. ctx
+// is canceled when the client goes away.
+type StreamHandler func(ctx context.Context, req Fields, send func(*Message) error) error
+
+// Server serves the methods of one service. It is an http.Handler for the
+// paths under Prefix.
+type Server struct {
+	service string
+	unary   map[string]UnaryHandler
+	stream  map[string]StreamHandler
+}
+
+// NewServer returns a server for the fully qualified service name, such as
+// "nsm.v1.NSM".
+func NewServer(service string) *Server {
+	return &Server{service: service, unary: make(map[string]UnaryHandler), stream: make(map[string]StreamHandler)}
+}
+
+// Prefix is the path prefix of the service's methods.
+func (s *Server) Prefix() string {
+	return "/" + s.service + "/"
+}
+
+// Path is the path of a method.
+func (s *Server) Path(method string) string {
+	return s.Prefix() + method
+}
+
+// Unary registers a unary method.
+func (s *Server) Unary(method string, h UnaryHandler) {
+	s.unary[method] = h
+}
+
+// Stream registers a server-streaming method.
+func (s *Server) Stream(method string, h StreamHandler) {
+	s.stream[method] = h
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		http.Error(w, "Unsupported content type; use application/grpc", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	finish := func(err error) {
+		st := &Status{Code: OK}
+		if err != nil && !errors.As(err, &st) {
+			st = &Status{Code: Unknown, Message: err.Error()}
+		}
+		if r.Context().Err() != nil && st.Code == Unknown {
+			st = &Status{Code: Canceled, Message: "the client canceled the call"}
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code)))
+		if st.Message != "" {
+			w.Header().Set("Grpc-Message", url.PathEscape(st.Message))
+		}
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, s.Prefix())
+	unary, isUnary := s.unary[method]
+	stream, isStream := s.stream[method]
+	if !strings.HasPrefix(r.URL.Path, s.Prefix()) || !isUnary && !isStream {
+		finish(Errorf(Unimplemented, "unknown method %s", r.URL.Path))
+		return
+	}
+
+	req, err := readMessage(r.Body)
+	if err != nil {
+		finish(err)
+		return
+	}
+	if isUnary {
+		resp, err := unary(r.Context(), req)
+		if err == nil {
+			err = writeMessage(w, resp)
+		}
+		finish(err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	finish(stream(r.Context(), req, func(m *Message) error {
+		if err := writeMessage(w, m); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}))
+}
+
+// readMessage reads the one length-prefixed message of a request.
+func readMessage(r io.Reader) (Fields, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, Errorf(InvalidArgument, "missing request message")
+	}
+	if prefix[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessage {
+		return nil, Errorf(ResourceExhausted, "request message too large")
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, Errorf(InvalidArgument, "truncated request message")
+	}
+	f, err := Decode(body)
+	if err != nil {
+		return nil, Errorf(InvalidArgument, "%v", err)
+	}
+	return f, nil
+}
+
+func writeMessage(w io.Writer, m *Message) error {
+	frame := make([]byte, 5, 5+len(m.buf))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(m.buf)))
+	_, err := w.Write(append(frame, m.buf...))
+	return err
+}
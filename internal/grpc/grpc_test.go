@@ -0,0 +1,122 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func frame(m *Message) *bytes.Reader {
+	b := make([]byte, 5, 5+len(m.Bytes()))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(m.Bytes())))
+	return bytes.NewReader(append(b, m.Bytes()...))
+}
+
+func TestMessage(t *testing.T) {
+	var sub Message
+	sub.String(1, "lobby")
+	var m Message
+	m.String(1, "héllo")
+	m.String(2, "")
+	m.Int(3, 300)
+	m.Bool(4, true)
+	m.Double(5, 1.5)
+	m.Message(6, &sub)
+	m.Message(6, &Message{})
+	m.String(7, "a")
+	m.String(7, "b")
+	m.Time(8, time.Unix(1700000000, 5))
+
+	f, err := Decode(m.Bytes())
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if f.String(1) != "héllo" || f.Int(3) != 300 || !f.Bool(4) {
+		t.Errorf("scalars decoded wrong: %v", f)
+	}
+	if _, ok := f[2]; ok {
+		t.Errorf("expected the empty string to be left out")
+	}
+	if len(f[6]) != 2 {
+		t.Errorf("expected both embedded messages, got %d", len(f[6]))
+	}
+	if got := f.Strings(7); len(got) != 2 || got[1] != "b" {
+		t.Errorf("expected repeated strings, got %v", got)
+	}
+
+	// Known encoding: field 3 = 300 is 0x18 0xac 0x02.
+	if !bytes.Contains(m.Bytes(), []byte{0x18, 0xac, 0x02}) {
+		t.Errorf("unexpected varint encoding: %x", m.Bytes())
+	}
+
+	for _, bad := range [][]byte{{0x0a, 0x05, 'a'}, {0x08}, {0x00, 0x01}, {0x0b}} {
+		if _, err := Decode(bad); !errors.Is(err, ErrMalformed) {
+			t.Errorf("Decode(%x): expected ErrMalformed, got %v", bad, err)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	srv := NewServer("test.v1.Echo")
+	srv.Unary("Echo", func(_ context.Context, req Fields) (*Message, error) {
+		if req.String(1) == "" {
+			return nil, Errorf(InvalidArgument, "missing text")
+		}
+		var resp Message
+		resp.String(1, req.String(1))
+		return &resp, nil
+	})
+	srv.Stream("Count", func(_ context.Context, req Fields, send func(*Message) error) error {
+		for i := range req.Int(1) {
+			var m Message
+			m.Int(1, i+1)
+			if err := send(&m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	call := func(method string, req *Message) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, srv.Path(method), frame(req))
+		r.Header.Set("Content-Type", "application/grpc")
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	var req Message
+	req.String(1, "hi")
+	resp := call("Echo", &req)
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Fatalf("expected OK, got status %q", resp.Trailer.Get("Grpc-Status"))
+	}
+	body := new(bytes.Buffer)
+	body.ReadFrom(resp.Body)
+	if want := []byte{0, 0, 0, 0, 4, 0x0a, 2, 'h', 'i'}; !bytes.Equal(body.Bytes(), want) {
+		t.Errorf("got frame %x, want %x", body.Bytes(), want)
+	}
+
+	resp = call("Echo", &Message{})
+	if resp.Trailer.Get("Grpc-Status") != "3" || resp.Trailer.Get("Grpc-Message") != "missing%20text" {
+		t.Errorf("expected InvalidArgument, got %v", resp.Trailer)
+	}
+
+	req = Message{}
+	req.Int(1, 3)
+	resp = call("Count", &req)
+	body.Reset()
+	body.ReadFrom(resp.Body)
+	if resp.Trailer.Get("Grpc-Status") != "0" || body.Len() != 3*7 {
+		t.Errorf("expected three messages, got %d bytes and %v", body.Len(), resp.Trailer)
+	}
+
+	if resp := call("Nope", &req); resp.Trailer.Get("Grpc-Status") != "12" {
+		t.Errorf("expected Unimplemented, got %v", resp.Trailer)
+	}
+}
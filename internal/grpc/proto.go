@@ -0,0 +1,174 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// ErrMalformed is returned for messages that are not valid protobuf.
+var ErrMalformed = errors.New("grpc: malformed message")
+
+// Message builds a protobuf message. Fields are written in the order they
+// are added; as in proto3, scalar fields with zero values are left out.
+type Message struct {
+	buf []byte
+}
+
+func (m *Message) tag(num, wire int) {
+	m.buf = binary.AppendUvarint(m.buf, uint64(num)<<3|uint64(wire))
+}
+
+// String adds a string field.
+func (m *Message) String(num int, v string) {
+	if v == "" {
+		return
+	}
+	m.tag(num, wireBytes)
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(v)))
+	m.buf = append(m.buf, v...)
+}
+
+// Int adds an int32 or int64 field.
+func (m *Message) Int(num int, v int64) {
+	if v == 0 {
+		return
+	}
+	m.tag(num, wireVarint)
+	m.buf = binary.AppendUvarint(m.buf, uint64(v))
+}
+
+// Bool adds a bool field.
+func (m *Message) Bool(num int, v bool) {
+	if v {
+		m.Int(num, 1)
+	}
+}
+
+// Double adds a double field.
+func (m *Message) Double(num int, v float64) {
+	if v == 0 {
+		return
+	}
+	m.tag(num, wireFixed64)
+	m.buf = binary.LittleEndian.AppendUint64(m.buf, math.Float64bits(v))
+}
+
+// Message adds an embedded message field. It is always written, so empty
+// elements of repeated fields are kept.
+func (m *Message) Message(num int, v *Message) {
+	m.tag(num, wireBytes)
+	m.buf = binary.AppendUvarint(m.buf, uint64(len(v.buf)))
+	m.buf = append(m.buf, v.buf...)
+}
+
+// Time adds a google.protobuf.Timestamp field, left out for the zero time.
+func (m *Message) Time(num int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	var ts Message
+	ts.Int(1, t.Unix())
+	ts.Int(2, int64(t.Nanosecond()))
+	m.Message(num, &ts)
+}
+
+// Bytes returns the encoded message.
+func (m *Message) Bytes() []byte {
+	return m.buf
+}
+
+// Fields is a decoded message: the raw values of each field number, in
+// the order they appeared. Varints and fixed-width values are uint64;
+// length-delimited values are []byte.
+type Fields map[int][]any
+
+// Decode splits a message into its fields.
+func Decode(b []byte) (Fields, error) {
+	f := make(Fields)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 || key>>3 == 0 {
+			return nil, ErrMalformed
+		}
+		b = b[n:]
+		num := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, ErrMalformed
+			}
+			f[num] = append(f[num], v)
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, ErrMalformed
+			}
+			f[num] = append(f[num], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, ErrMalformed
+			}
+			f[num] = append(f[num], uint64(binary.LittleEndian.Uint32(b)))
+			b = b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, ErrMalformed
+			}
+			f[num] = append(f[num], b[n:n+int(size)])
+			b = b[n+int(size):]
+		default:
+			return nil, ErrMalformed
+		}
+	}
+	return f, nil
+}
+
+// String returns the last value of a string field, or "".
+func (f Fields) String(num int) string {
+	if v, ok := f.last(num).([]byte); ok {
+		return string(v)
+	}
+	return ""
+}
+
+// Strings returns every value of a repeated string field.
+func (f Fields) Strings(num int) []string {
+	var out []string
+	for _, v := range f[num] {
+		if b, ok := v.([]byte); ok {
+			out = append(out, string(b))
+		}
+	}
+	return out
+}
+
+// Int returns the last value of an int32 or int64 field, or 0.
+func (f Fields) Int(num int) int64 {
+	v, _ := f.last(num).(uint64)
+	return int64(v)
+}
+
+// Bool returns the last value of a bool field, or false.
+func (f Fields) Bool(num int) bool {
+	return f.Int(num) != 0
+}
+
+func (f Fields) last(num int) any {
+	if vals := f[num]; len(vals) > 0 {
+		return vals[len(vals)-1]
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// BootSettingKey holds this node's bootMarker.
+const BootSettingKey = "boot"
+
+// bootMarker is what NSM remembers of the OS boot it last ran in. If the
+// OS reboots without NSM being stopped first, the power went or the
+// system crashed.
+type bootMarker struct {
+	BootID    string           `json:"boot_id"`
+	StoppedAt time.Time        `json:"stopped_at,omitzero"` // When NSM was last stopped cleanly in that boot
+	Report    hosts.BootReport `json:"report"`
+}
+
+// cleanShutdownMarkers are lines systemd logs at the very end of an
+// orderly shutdown or reboot.
+var cleanShutdownMarkers = []string{
+	"Journal stopped",
+	"systemd-shutdown",
+	"Reached target System Power Off",
+	"Reached target System Reboot",
+	"Reached target System Halt",
+	"Reached target Power-Off",
+	"Reached target Reboot",
+	"Reached target Halt",
+}
+
+// bootReport works out how this OS boot started, once per boot: restarts
+// of NSM within the same boot reuse the first answer.
+func bootReport(store hosts.SettingStore, root string) hosts.BootReport {
+	var marker bootMarker
+	store.GetSetting(BootSettingKey, &marker)
+
+	id, bootedAt := readBootID(root)
+	if id == "" {
+		return hosts.BootReport{}
+	}
+	if marker.BootID == id {
+		store.PutSetting(BootSettingKey, bootMarker{BootID: id, Report: marker.Report})
+		return marker.Report
+	}
+
+	report := hosts.BootReport{BootID: id, BootedAt: bootedAt}
+	if shutdown, underVoltage, ok := previousBootFromJournal(); ok {
+		report.Shutdown, report.Evidence, report.UnderVoltage = shutdown, "journal", underVoltage
+	} else if marker.BootID != "" {
+		report.Shutdown, report.Evidence = hosts.ShutdownUnexpected, "nsm"
+		if !marker.StoppedAt.IsZero() {
+			report.Shutdown = hosts.ShutdownClean
+		}
+	}
+	store.PutSetting(BootSettingKey, bootMarker{BootID: id, Report: report})
+	return report
+}
+
+// MarkStopped records that NSM is stopping cleanly, as it does when the OS
+// shuts down, so the next boot is not reported as unexpected.
+func MarkStopped(store hosts.SettingStore) error {
+	var marker bootMarker
+	if ok, err := store.GetSetting(BootSettingKey, &marker); err != nil || !ok {
+		return err
+	}
+	marker.StoppedAt = time.Now().UTC()
+	return store.PutSetting(BootSettingKey, marker)
+}
+
+// readBootID returns the kernel's ID for this boot and when it booted, or
+// an empty ID where Linux does not expose them.
+func readBootID(root string) (string, time.Time) {
+	data, err := os.ReadFile(filepath.Join(root, "proc/sys/kernel/random/boot_id"))
+	if err != nil {
+		return "", time.Time{}
+	}
+	stat, _ := os.ReadFile(filepath.Join(root, "proc/stat"))
+	return strings.TrimSpace(string(data)), parseBootTime(string(stat))
+}
+
+// parseBootTime returns the "btime" line of /proc/stat, the boot time in
+// seconds since the epoch.
+func parseBootTime(stat string) time.Time {
+	sc := bufio.NewScanner(strings.NewReader(stat))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "btime "); ok {
+			if secs, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return time.Unix(secs, 0).UTC()
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// previousBootFromJournal reads the end of the previous boot's journal.
+// It needs a persistent journal; without one, or without journalctl, ok
+// is false.
+func previousBootFromJournal() (shutdown string, underVoltage bool, ok bool) {
+	tail, err := runCommand("journalctl", "-b", "-1", "-n", "100", "-o", "cat", "-q", "--no-pager")
+	if err != nil || strings.TrimSpace(string(tail)) == "" {
+		return "", false, false
+	}
+	shutdown = hosts.ShutdownUnexpected
+	for _, m := range cleanShutdownMarkers {
+		if strings.Contains(string(tail), m) {
+			shutdown = hosts.ShutdownClean
+			break
+		}
+	}
+
+	// The Pi's firmware reports a weak supply to the kernel, which logs it
+	// as "Under-voltage detected!" or, on newer kernels, "Undervoltage
+	// detected!".
+	if kernel, err := runCommand("journalctl", "-b", "-1", "-k", "-o", "cat", "-q", "--no-pager"); err == nil {
+		log := strings.ToLower(string(kernel))
+		underVoltage = strings.Contains(log, "under-voltage detected") || strings.Contains(log, "undervoltage detected")
+	}
+	return shutdown, underVoltage, true
+}
@@ -0,0 +1,101 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// cardHealthInterval is how long a card health reading is reused. Wear
+// moves slowly, but a card going read-only should show within minutes.
+const cardHealthInterval = 5 * time.Minute
+
+// cardDevice is the block device Raspberry Pis boot from: the SD card, or
+// the eMMC of a CM4.
+const cardDevice = "mmcblk0"
+
+// cardHealthState caches the node's last card health reading. Like
+// timeSyncState, only SendAll uses it.
+type cardHealthState struct {
+	card *hosts.CardHealth
+	read time.Time
+}
+
+func (c *cardHealthState) get() *hosts.CardHealth {
+	if time.Since(c.read) >= cardHealthInterval {
+		c.card = readCardHealth("/")
+		c.read = time.Now()
+	}
+	return c.card
+}
+
+// readCardHealth reads the boot card's wear indicators and the root
+// filesystem's error count from the files Linux exposes under root. It
+// returns nil on nodes without the card, such as PCs.
+func readCardHealth(root string) *hosts.CardHealth {
+	read := func(path string) (string, bool) {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		return strings.TrimSpace(string(data)), err == nil
+	}
+	if _, err := os.Stat(filepath.Join(root, "sys/block", cardDevice)); err != nil {
+		return nil
+	}
+
+	var c hosts.CardHealth
+	// eMMC only: two wear estimates, for the two kinds of memory cell, in
+	// tenths of rated life, e.g. "0x02 0x01". The worse one counts.
+	if v, ok := read("sys/block/" + cardDevice + "/device/life_time"); ok {
+		for _, f := range strings.Fields(v) {
+			if n, err := strconv.ParseInt(f, 0, 0); err == nil && n >= 1 && n <= 11 {
+				c.LifeUsed = max(c.LifeUsed, int(n)*10)
+			}
+		}
+	}
+	if v, ok := read("sys/block/" + cardDevice + "/device/pre_eol_info"); ok {
+		switch n, _ := strconv.ParseInt(v, 0, 0); n {
+		case 1:
+			c.PreEOL = hosts.PreEOLNormal
+		case 2:
+			c.PreEOL = hosts.PreEOLWarning
+		case 3:
+			c.PreEOL = hosts.PreEOLUrgent
+		}
+	}
+
+	mounts, _ := read("proc/mounts")
+	dev, readOnly := rootMount(mounts)
+	c.ReadOnly = readOnly
+	if dev == "root" {
+		dev = cardDevice + "p2" // Raspberry Pi OS mounts /dev/root; the root partition is the second
+	}
+	if v, ok := read("sys/fs/ext4/" + dev + "/errors_count"); ok {
+		c.FSErrors, _ = strconv.Atoi(v)
+	}
+	return &c
+}
+
+// rootMount finds the filesystem mounted at / in /proc/mounts, returning
+// its device name without /dev/ and whether it is mounted read-only.
+func rootMount(mounts string) (dev string, readOnly bool) {
+	sc := bufio.NewScanner(strings.NewReader(mounts))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 4 || f[1] != "/" || f[0] == "rootfs" {
+			continue
+		}
+		// A later mount over / hides the earlier one, so keep looking.
+		dev = strings.TrimPrefix(f[0], "/dev/")
+		readOnly = false
+		for _, opt := range strings.Split(f[3], ",") {
+			if opt == "ro" {
+				readOnly = true
+			}
+		}
+	}
+	return dev, readOnly
+}
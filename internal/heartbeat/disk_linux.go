@@ -0,0 +1,19 @@
+package heartbeat
+
+import "syscall"
+
+// diskPercent returns how full the filesystem holding path is, rounded up,
+// or 0 if it cannot be read.
+func diskPercent(path string) int {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil || st.Blocks == 0 {
+		return 0
+	}
+	// Like df, leave blocks reserved for root out of the total.
+	used := st.Blocks - st.Bfree
+	total := used + st.Bavail
+	if total == 0 {
+		return 0
+	}
+	return int((used*100 + total - 1) / total)
+}
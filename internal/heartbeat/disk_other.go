@@ -0,0 +1,9 @@
+//go:build !linux
+
+package heartbeat
+
+// diskPercent is only implemented on Linux, where NSM runs alongside
+// Anthias.
+func diskPercent(path string) int {
+	return 0
+}
@@ -0,0 +1,197 @@
+// Package heartbeat implements the liveness protocol between NSM nodes.
+// Every node POSTs a small signed heartbeat to each known host every few
+// seconds; receivers record when they last heard from each peer, and
+// types.DetermineHealth turns that into online, degraded, or offline.
+package heartbeat
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Path is the endpoint heartbeats are posted to.
+const Path = "/api/heartbeat"
+
+// MaxSkew is how far a heartbeat's send time may be from the receiver's
+// clock before it is rejected as stale or forged.
+const MaxSkew = 5 * time.Minute
+
+var (
+	ErrBadSignature = errors.New("heartbeat signature is invalid")
+	ErrUnknownNode  = errors.New("heartbeat from a node that is not in the host list")
+	ErrKeyMismatch  = errors.New("heartbeat signed by a different key than the one pinned for this node")
+	ErrReplay       = errors.New("heartbeat is older than one already accepted")
+	ErrClockSkew    = errors.New("heartbeat send time is too far from this node's clock")
+)
+
+// Beat is the signed content of a heartbeat.
+type Beat struct {
+	NodeID      string       `json:"node_id"`
+	Hostname    string       `json:"hostname"`
+	Version     string       `json:"version"`
+	PublicKey   string       `json:"public_key"` // Base64 Ed25519 key that signed the envelope
+	BootedAt    time.Time    `json:"booted_at"`
+	SentAt      time.Time    `json:"sent_at"`
+	Seq         uint64       `json:"seq"` // Increases with every heartbeat since BootedAt
+	Maintenance bool         `json:"maintenance,omitempty"`
+	DiskPercent int          `json:"disk_percent,omitempty"` // Root filesystem usage, 0 if unknown
+	TimeSync    string       `json:"time_sync,omitempty"`    // NTP state, types.TimeSyncSynced or TimeSyncUnsynced; empty if unknown
+	Stratum     int          `json:"stratum,omitempty"`      // NTP stratum, 0 if unknown
+	Throttled   *uint32      `json:"throttled,omitempty"`    // "vcgencmd get_throttled" bits; nil off a Pi
+	Links       []hosts.Link `json:"links,omitempty"`        // The sender's view of the other hosts, for the fleet topology
+	HostCount   int          `json:"host_count,omitempty"`   // Hosts in the sender's list, for the sync status
+	HostsDigest string       `json:"hosts_digest,omitempty"` // hosts.ListDigest of the sender's list
+
+	Inventory *hosts.Inventory   `json:"inventory,omitempty"` // The sender's hardware; nil from older versions
+	Card      *hosts.CardHealth  `json:"card,omitempty"`      // The sender's boot card; nil without one or from older versions
+	WiFi      *hosts.WiFi        `json:"wifi,omitempty"`      // The sender's wireless link; nil on Ethernet or from older versions
+	Patches   *hosts.PatchStatus `json:"patches,omitempty"`   // The sender's OS updates; nil from older versions
+	Boot      *hosts.BootReport  `json:"boot,omitempty"`      // How the sender's OS boot started; nil where unknown or from older versions
+	Playback  *hosts.Playback    `json:"playback,omitempty"`  // The sender's built-in player; nil when it has not run
+	Viewer    *hosts.Viewer      `json:"viewer,omitempty"`    // What the sender's watchdog found of its viewer; nil when off
+}
+
+// Envelope carries a beat and the signature over its exact bytes.
+type Envelope struct {
+	Beat      json.RawMessage `json:"beat"`
+	Signature string          `json:"signature"`
+}
+
+// Seal encodes and signs a beat with the node key.
+func Seal(b Beat, id *identity.Identity) ([]byte, error) {
+	b.PublicKey = base64.StdEncoding.EncodeToString(id.PublicKey())
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Beat:      raw,
+		Signature: base64.StdEncoding.EncodeToString(id.Sign(raw)),
+	})
+}
+
+// Open decodes an envelope and checks that the beat was signed by the key
+// it names. Whether that key belongs to the node is up to the caller.
+func Open(data []byte) (Beat, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Beat{}, fmt.Errorf("decode heartbeat: %w", err)
+	}
+	var b Beat
+	if err := json.Unmarshal(env.Beat, &b); err != nil {
+		return Beat{}, fmt.Errorf("decode heartbeat: %w", err)
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(b.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Beat{}, ErrBadSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || !ed25519.Verify(pub, env.Beat, sig) {
+		return Beat{}, ErrBadSignature
+	}
+	if b.NodeID == "" {
+		return Beat{}, errors.New("heartbeat has no node ID")
+	}
+	return b, nil
+}
+
+// Accept verifies a heartbeat received from remoteAddr and records it.
+// Only nodes in the host list are accepted. The first accepted heartbeat
+// pins the node's key; later ones must use the same key and must be newer
+// than the last one accepted.
+func Accept(store *hosts.Store, data []byte, remoteAddr string, now time.Time) (hosts.Peer, error) {
+	b, err := Open(data)
+	if err != nil {
+		return hosts.Peer{}, err
+	}
+	if _, err := store.GetByID(b.NodeID); err != nil {
+		return hosts.Peer{}, ErrUnknownNode
+	}
+	if skew := now.Sub(b.SentAt); skew > MaxSkew || skew < -MaxSkew {
+		return hosts.Peer{}, ErrClockSkew
+	}
+
+	prev, err := store.GetPeer(b.NodeID)
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		prev = hosts.Peer{NodeID: b.NodeID, PublicKey: b.PublicKey, FirstSeen: now}
+	case err != nil:
+		return hosts.Peer{}, err
+	case prev.PublicKey != b.PublicKey:
+		return hosts.Peer{}, ErrKeyMismatch
+	case b.BootedAt.Before(prev.BootedAt),
+		b.BootedAt.Equal(prev.BootedAt) && b.Seq <= prev.Seq:
+		return hosts.Peer{}, ErrReplay
+	}
+
+	addr := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		addr = host
+	}
+
+	p := prev
+	p.Hostname = b.Hostname
+	p.Address = addr
+	p.Version = b.Version
+	p.BootedAt = b.BootedAt
+	p.SentAt = b.SentAt
+	p.Seq = b.Seq
+	p.Maintenance = b.Maintenance
+	p.DiskPercent = b.DiskPercent
+	p.TimeSync = b.TimeSync
+	p.Stratum = b.Stratum
+	p.Throttled = b.Throttled
+	p.HostCount = b.HostCount
+	p.HostsDigest = b.HostsDigest
+	p.Links = nil
+	for _, l := range b.Links {
+		if l.From == b.NodeID { // A node only speaks for itself
+			p.Links = append(p.Links, l)
+		}
+	}
+	p.LastSeen = now
+	if err := store.PutPeer(p); err != nil {
+		return hosts.Peer{}, err
+	}
+	if b.Inventory != nil {
+		if err := store.PutInventory(b.NodeID, *b.Inventory, now); err != nil {
+			return hosts.Peer{}, err
+		}
+	}
+	if b.Card != nil {
+		if err := store.RecordCardHealth(b.NodeID, *b.Card, now); err != nil {
+			return hosts.Peer{}, err
+		}
+	}
+	if b.WiFi != nil {
+		if err := store.RecordWiFi(b.NodeID, *b.WiFi, now); err != nil {
+			return hosts.Peer{}, err
+		}
+	}
+	if b.Patches != nil {
+		if err := store.PutPatchStatus(b.NodeID, *b.Patches, now); err != nil {
+			return hosts.Peer{}, err
+		}
+	}
+	if b.Boot != nil {
+		if _, err := store.RecordBoot(b.NodeID, *b.Boot, prev.LastSeen, now); err != nil {
+			return hosts.Peer{}, err
+		}
+	}
+	if b.Playback != nil {
+		store.RecordPlayback(b.NodeID, *b.Playback, now)
+	}
+	if b.Viewer != nil {
+		store.RecordViewer(b.NodeID, *b.Viewer, now)
+	}
+	return p, nil
+}
@@ -0,0 +1,521 @@
+package heartbeat
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newIdentity(t *testing.T) *identity.Identity {
+	t.Helper()
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	return id
+}
+
+func TestAccept(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "node-a", IPAddress: "192.168.1.20"})
+
+	id := newIdentity(t)
+	now := time.Now().UTC()
+	booted := now.Add(-time.Hour)
+	beat := func(seq uint64) Beat {
+		return Beat{NodeID: "node-a", Hostname: "lobby-pi", Version: types.Version, BootedAt: booted, SentAt: now, Seq: seq}
+	}
+	seal := func(b Beat, id *identity.Identity) []byte {
+		data, err := Seal(b, id)
+		if err != nil {
+			t.Fatalf("Seal: %v", err)
+		}
+		return data
+	}
+
+	peer, err := Accept(store, seal(beat(1), id), "192.168.1.20:51234", now)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if peer.Address != "192.168.1.20" || peer.Hostname != "lobby-pi" || !peer.LastSeen.Equal(now) {
+		t.Errorf("unexpected peer state: %+v", peer)
+	}
+	if got := types.DetermineHealth(peer.Liveness(), now.Add(5*time.Second), types.DefaultHealthThresholds()); got != types.HealthOnline {
+		t.Errorf("expected online, got %s", got)
+	}
+
+	tampered := map[string]json.RawMessage{}
+	json.Unmarshal(seal(beat(2), id), &tampered)
+	tampered["beat"] = json.RawMessage(`{"node_id":"node-a","seq":3,` + string(tampered["beat"])[1:])
+	forged, _ := json.Marshal(tampered)
+
+	unknown := beat(2)
+	unknown.NodeID = "stranger"
+	skewed := beat(2)
+	skewed.SentAt = now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"replayed", seal(beat(1), id), ErrReplay},
+		{"tampered", forged, ErrBadSignature},
+		{"other key", seal(beat(2), newIdentity(t)), ErrKeyMismatch},
+		{"not a host", seal(unknown, id), ErrUnknownNode},
+		{"clock skew", seal(skewed, id), ErrClockSkew},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Accept(store, tt.data, "192.168.1.20:51234", now); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// A node's links are kept, but not links it claims for other nodes.
+	withLinks := beat(2)
+	withLinks.Links = []hosts.Link{{From: "node-a", To: "node-b", LAN: types.StatusHealthy}, {From: "node-b", To: "node-a"}}
+	if _, err := Accept(store, seal(withLinks, id), "100.64.0.2:40000", now.Add(10*time.Second)); err != nil {
+		t.Fatalf("Accept next beat: %v", err)
+	}
+	if p, _ := store.GetPeer("node-a"); len(p.Links) != 1 || p.Links[0].To != "node-b" {
+		t.Errorf("expected only node-a's own link, got %+v", p.Links)
+	}
+
+	// A restart resets the sequence but moves BootedAt forward.
+	restarted := beat(1)
+	restarted.BootedAt = now
+	peer, err = Accept(store, seal(restarted, id), "192.168.1.20:51234", now.Add(20*time.Second))
+	if err != nil {
+		t.Fatalf("Accept after restart: %v", err)
+	}
+	if got := types.DetermineHealth(peer.Liveness(), now.Add(20*time.Second), types.DefaultHealthThresholds()); got != types.HealthStarting {
+		t.Errorf("expected starting after restart, got %s", got)
+	}
+
+	// Forgetting the peer unpins its key.
+	if err := store.DeletePeer("node-a"); err != nil {
+		t.Fatalf("DeletePeer: %v", err)
+	}
+	if _, err := Accept(store, seal(beat(1), newIdentity(t)), "192.168.1.20:51234", now); err != nil {
+		t.Errorf("expected new key to be accepted after forgetting, got %v", err)
+	}
+}
+
+// FuzzOpen feeds Open what a compromised or broken peer might send. Open
+// must not panic, and whatever it accepts must carry a valid signature over
+// the exact bytes it decoded.
+func FuzzOpen(f *testing.F) {
+	id, err := identity.Generate()
+	if err != nil {
+		f.Fatalf("Generate: %v", err)
+	}
+	valid, err := Seal(Beat{NodeID: "node-a", Hostname: "lobby-pi", Seq: 1, SentAt: time.Now().UTC()}, id)
+	if err != nil {
+		f.Fatalf("Seal: %v", err)
+	}
+	f.Add(valid)
+	for _, seed := range []string{``, `null`, `[]`, `{}`, `{"beat": null, "signature": ""}`,
+		`{"beat": {"node_id": "node-a", "public_key": "AAAA"}, "signature": "AAAA"}`,
+		`{"beat": "node-a", "signature": 1}`, `{"beat": {"links": [{}], "throttled": -1}}`} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b, err := Open(data)
+		if err != nil {
+			return
+		}
+		if b.NodeID == "" {
+			t.Error("Open accepted a heartbeat without a node ID")
+		}
+		var env Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			t.Fatalf("Open accepted an envelope that does not decode: %v", err)
+		}
+		pub, _ := base64.StdEncoding.DecodeString(b.PublicKey)
+		sig, _ := base64.StdEncoding.DecodeString(env.Signature)
+		if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, env.Beat, sig) {
+			t.Errorf("Open accepted a beat without a valid signature: %s", data)
+		}
+	})
+}
+
+// FuzzOpenTampered changes a byte of a signed beat. Open must accept the
+// beat only if it is unchanged.
+func FuzzOpenTampered(f *testing.F) {
+	id, err := identity.Generate()
+	if err != nil {
+		f.Fatalf("Generate: %v", err)
+	}
+	throttled := uint32(0x50005)
+	data, err := Seal(Beat{NodeID: "node-a", Hostname: "lobby-pi", Seq: 7, SentAt: time.Now().UTC(),
+		DiskPercent: 42, Throttled: &throttled}, id)
+	if err != nil {
+		f.Fatalf("Seal: %v", err)
+	}
+	var env Envelope
+	json.Unmarshal(data, &env)
+	f.Add(uint(0), byte('['))
+	f.Add(uint(12), byte('b'))
+	f.Add(uint(len(env.Beat)-2), byte('8'))
+
+	f.Fuzz(func(t *testing.T, pos uint, c byte) {
+		raw := bytes.Clone(env.Beat)
+		raw[pos%uint(len(raw))] = c
+		tampered := fmt.Appendf(nil, `{"beat": %s, "signature": %q}`, raw, env.Signature)
+		_, err := Open(tampered)
+		if changed := !bytes.Equal(raw, env.Beat); changed && err == nil {
+			t.Errorf("Open accepted a tampered beat: %s", raw)
+		} else if !changed && err != nil {
+			t.Errorf("Open rejected the signed beat: %v", err)
+		}
+	})
+}
+
+func TestReadTimeSync(t *testing.T) {
+	saved := runCommand
+	defer func() { runCommand = saved }()
+
+	tests := []struct {
+		name    string
+		outputs map[string]string // By command name; missing commands fail
+		state   string
+		stratum int
+	}{
+		{"chrony synced", map[string]string{
+			"chronyc": "C0A80101,192.168.1.1,3,1772366400.1,-0.000012,0.000003,0.000020,-12.3,0.001,0.02,0.012,0.0005,64.5,Normal\n",
+		}, types.TimeSyncSynced, 3},
+		{"chrony without a source", map[string]string{
+			"chronyc": "00000000,,0,0.000000000,0.000000000,0.000000000,0.000000000,0.000,0.000,0.000,1.000000000,1.000000000,0.0,Not synchronised\n",
+		}, types.TimeSyncUnsynced, 0},
+		{"timesyncd", map[string]string{
+			"timedatectl": "yes\n",
+		}, types.TimeSyncSynced, 0},
+		{"timesyncd unsynced", map[string]string{
+			"timedatectl": "no\n",
+		}, types.TimeSyncUnsynced, 0},
+		{"neither", map[string]string{}, "", 0},
+	}
+	for _, tt := range tests {
+		runCommand = func(name string, args ...string) ([]byte, error) {
+			out, ok := tt.outputs[name]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return []byte(out), nil
+		}
+		if state, stratum := readTimeSync(); state != tt.state || stratum != tt.stratum {
+			t.Errorf("%s: got %q stratum %d, want %q stratum %d", tt.name, state, stratum, tt.state, tt.stratum)
+		}
+	}
+
+	status := "       Server: 192.168.1.1 (pool.ntp.org)\n      Stratum: 2\n    Reference: C0248F97\n"
+	if got := parseTimesyncStratum(status); got != 2 {
+		t.Errorf("parseTimesyncStratum = %d, want 2", got)
+	}
+}
+
+func TestReadThrottled(t *testing.T) {
+	saved := runCommand
+	defer func() { runCommand = saved }()
+
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		return []byte("throttled=0x50005\n"), nil
+	}
+	if bits := readThrottled(); bits == nil || *bits != 0x50005 {
+		t.Errorf("readThrottled = %v, want 0x50005", bits)
+	}
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		return nil, errors.New("not found")
+	}
+	if bits := readThrottled(); bits != nil {
+		t.Errorf("expected nil without vcgencmd, got %d", *bits)
+	}
+	if _, ok := parseThrottled("VCHI initialization failed"); ok {
+		t.Error("expected an error message rejected")
+	}
+}
+
+func TestReadWiFi(t *testing.T) {
+	saved := runCommand
+	defer func() { runCommand = saved }()
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "proc/net"), 0o755)
+	os.WriteFile(filepath.Join(root, "proc/net/wireless"), []byte(
+		"Inter-| sta-|   Quality        |   Discarded packets               | Missed | WE\n"+
+			" face | tus | link level noise |  nwid  crypt   frag  retry   misc | beacon | 22\n"+
+			" wlan0: 0000   39.  -71.  -256        0      0      0      0     12        0\n"), 0o644)
+
+	link := "Connected to aa:bb:cc:dd:ee:01 (on wlan0)\n\tSSID: Lobby\n\tfreq: 2437.0\n\tRX: 1234 bytes (10 packets)\n\tsignal: -71 dBm\n"
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		return []byte(link), nil
+	}
+	w := readWiFi(root)
+	if w == nil || w.Interface != "wlan0" || w.SSID != "Lobby" || w.BSSID != "aa:bb:cc:dd:ee:01" || w.Channel != 6 || w.SignalDBM != -71 {
+		t.Fatalf("unexpected reading %+v", w)
+	}
+	if readWiFi(t.TempDir()) != nil {
+		t.Error("expected nil without wireless interfaces")
+	}
+
+	// The state counts drops and moves between readings.
+	var c wifiState
+	if c.update(&hosts.WiFi{Interface: "wlan0"}) != nil {
+		t.Error("expected nothing reported before the first connection")
+	}
+	c.update(&hosts.WiFi{BSSID: "ap1"})
+	c.update(&hosts.WiFi{})
+	c.update(&hosts.WiFi{BSSID: "ap1"})
+	got := c.update(&hosts.WiFi{BSSID: "ap2"})
+	if got == nil || got.Reconnects != 1 || got.Roams != 1 {
+		t.Errorf("expected one reconnect and one roam, got %+v", got)
+	}
+}
+
+func TestReadInventory(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"proc/device-tree/model":    "Raspberry Pi 4 Model B Rev 1.4\x00",
+		"proc/cpuinfo":              "processor\t: 0\nHardware\t: BCM2835\nSerial\t\t: 10000000a1b2c3d4\nModel\t\t: Raspberry Pi 4 Model B Rev 1.4\n",
+		"etc/os-release":            "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nNAME=\"Debian GNU/Linux\"\nVERSION_ID=\"12\"\n",
+		"proc/sys/kernel/osrelease": "6.6.31+rpt-rpi-v8\n",
+		"proc/meminfo":              "MemTotal:        3884376 kB\nMemFree:          812344 kB\n",
+		"sys/block/mmcblk0/size":    "62333952\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := hosts.Inventory{
+		Model:       "Raspberry Pi 4 Model B Rev 1.4",
+		Serial:      "10000000a1b2c3d4",
+		OS:          "Debian GNU/Linux 12 (bookworm)",
+		Kernel:      "6.6.31+rpt-rpi-v8",
+		RAMBytes:    3884376 * 1024,
+		SDCardBytes: 62333952 * 512,
+	}
+	if got := readInventory(root); got != want {
+		t.Errorf("readInventory:\n got %+v\nwant %+v", got, want)
+	}
+
+	// Without the device tree and block device, as on a PC, the rest is
+	// still reported.
+	os.RemoveAll(filepath.Join(root, "proc/device-tree"))
+	os.RemoveAll(filepath.Join(root, "sys"))
+	got := readInventory(root)
+	if got.Model != "" || got.SDCardBytes != 0 || got.Serial != want.Serial || got.OS != want.OS {
+		t.Errorf("expected a partial inventory, got %+v", got)
+	}
+}
+
+func TestAcceptStoresInventory(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "node-a", IPAddress: "192.168.1.20"})
+
+	now := time.Now().UTC()
+	id := newIdentity(t)
+	inv := hosts.Inventory{Model: "Raspberry Pi 5 Model B Rev 1.0", RAMBytes: 8 << 30}
+	data, err := Seal(Beat{NodeID: "node-a", BootedAt: now, SentAt: now, Seq: 1, Inventory: &inv}, id)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if _, err := Accept(store, data, "192.168.1.20:51234", now); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	got, err := store.GetInventory("node-a")
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if got.Model != inv.Model || got.RAMBytes != inv.RAMBytes || !got.ReportedAt.Equal(now) {
+		t.Errorf("unexpected inventory: %+v", got)
+	}
+	patches := hosts.PatchStatus{Pending: 4, RebootRequired: true}
+	data, err = Seal(Beat{NodeID: "node-a", BootedAt: now, SentAt: now, Seq: 2, Patches: &patches}, id)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if _, err := Accept(store, data, "192.168.1.20:51234", now); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	if got, err := store.GetPatchStatus("node-a"); err != nil || got.Pending != 4 || !got.RebootRequired {
+		t.Errorf("unexpected patch status: %+v, %v", got, err)
+	}
+	// A node back from a reboot reports its new boot; the receiver notes
+	// when it last heard from the node before.
+	later := now.Add(3 * time.Minute)
+	boot := hosts.BootReport{BootID: "b2", BootedAt: later.Add(-time.Minute), Shutdown: hosts.ShutdownUnexpected, Evidence: "journal"}
+	data, err = Seal(Beat{NodeID: "node-a", BootedAt: later, SentAt: later, Seq: 1, Boot: &boot}, id)
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if _, err := Accept(store, data, "192.168.1.20:51234", later); err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	events, err := store.ListReboots("node-a", time.Time{})
+	if err != nil || len(events) != 1 || !events[0].LastSeen.Equal(now) || events[0].Downtime() != 2*time.Minute {
+		t.Errorf("unexpected reboots: %+v, %v", events, err)
+	}
+}
+
+func TestReadCardHealth(t *testing.T) {
+	root := t.TempDir()
+	if got := readCardHealth(root); got != nil {
+		t.Fatalf("expected nil without a card, got %+v", got)
+	}
+
+	files := map[string]string{
+		"sys/block/mmcblk0/size":                "62333952\n",
+		"sys/block/mmcblk0/device/life_time":    "0x02 0x04\n",
+		"sys/block/mmcblk0/device/pre_eol_info": "0x02\n",
+		"proc/mounts":                           "/dev/root / ext4 rw,noatime 0 0\n/dev/mmcblk0p1 /boot/firmware vfat rw 0 0\n/dev/root / ext4 ro,noatime 0 0\n",
+		"sys/fs/ext4/mmcblk0p2/errors_count":    "3\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := hosts.CardHealth{LifeUsed: 40, PreEOL: hosts.PreEOLWarning, FSErrors: 3, ReadOnly: true}
+	if got := readCardHealth(root); got == nil || *got != want {
+		t.Errorf("readCardHealth:\n got %+v\nwant %+v", got, want)
+	}
+
+	// An SD card has no wear indicators; errors are all it reports.
+	os.RemoveAll(filepath.Join(root, "sys/block/mmcblk0/device"))
+	want = hosts.CardHealth{FSErrors: 3, ReadOnly: true}
+	if got := readCardHealth(root); got == nil || *got != want {
+		t.Errorf("readCardHealth without eMMC:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestReadPatchStatus(t *testing.T) {
+	saved := runCommand
+	defer func() { runCommand = saved }()
+
+	simulated := `Reading package lists...
+Building dependency tree...
+Calculating upgrade...
+The following packages will be upgraded:
+  libssl3 openssl raspi-firmware
+3 upgraded, 0 newly installed, 0 to remove and 0 not upgraded.
+Inst libssl3 [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [arm64])
+Inst openssl [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [arm64])
+Inst raspi-firmware [1:1.20240306-1] (1:1.20240529-1 Raspberry Pi Foundation:stable [all])
+Conf libssl3 (3.0.11-1~deb12u2 Debian-Security:12/stable-security [arm64])
+`
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		if name != "apt-get" {
+			return nil, errors.New("not found")
+		}
+		return []byte(simulated), nil
+	}
+
+	root := t.TempDir()
+	got := readPatchStatus(root)
+	if got.Pending != 3 || got.Security != 2 || got.RebootRequired || got.CheckedAt.IsZero() {
+		t.Errorf("unexpected status: %+v", got)
+	}
+
+	os.MkdirAll(filepath.Join(root, "run"), 0o755)
+	os.WriteFile(filepath.Join(root, "run/reboot-required"), []byte("*** System restart required ***\n"), 0o644)
+	runCommand = func(name string, args ...string) ([]byte, error) { return nil, errors.New("not found") }
+	got = readPatchStatus(root)
+	if got.Pending != 0 || !got.RebootRequired || !got.CheckedAt.IsZero() {
+		t.Errorf("expected only the reboot flag without apt, got %+v", got)
+	}
+}
+
+func TestBootReport(t *testing.T) {
+	saved := runCommand
+	defer func() { runCommand = saved }()
+
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	root := t.TempDir()
+	boot := func(id string) {
+		os.MkdirAll(filepath.Join(root, "proc/sys/kernel/random"), 0o755)
+		os.WriteFile(filepath.Join(root, "proc/sys/kernel/random/boot_id"), []byte(id+"\n"), 0o644)
+		os.WriteFile(filepath.Join(root, "proc/stat"), []byte("cpu  2255 34 2290 22625563 6290 127 456\nbtime 1772355600\nprocesses 2401\n"), 0o644)
+	}
+	journal := map[string]string{} // "tail" of the previous boot, or its "kernel" log
+	runCommand = func(name string, args ...string) ([]byte, error) {
+		key := "tail"
+		if slices.Contains(args, "-k") {
+			key = "kernel"
+		}
+		out, ok := journal[key]
+		if name != "journalctl" || !ok {
+			return nil, errors.New("not found")
+		}
+		return []byte(out), nil
+	}
+
+	// The journal shows the previous boot stopping mid-stream, with a weak supply.
+	boot("b1")
+	journal["tail"] = "Started session-12.scope - Session 12 of User pi.\n"
+	journal["kernel"] = "hwmon hwmon1: Undervoltage detected!\n"
+	got := bootReport(store, root)
+	want := hosts.BootReport{BootID: "b1", BootedAt: time.Unix(1772355600, 0).UTC(), Shutdown: hosts.ShutdownUnexpected, Evidence: "journal", UnderVoltage: true}
+	if got != want {
+		t.Fatalf("bootReport:\n got %+v\nwant %+v", got, want)
+	}
+
+	// NSM restarting in the same boot reports the same boot.
+	delete(journal, "tail")
+	if got := bootReport(store, root); got != want {
+		t.Errorf("expected the first report reused, got %+v", got)
+	}
+
+	// Without a persistent journal, NSM's own marker decides.
+	MarkStopped(store)
+	boot("b2")
+	if got := bootReport(store, root); got.Shutdown != hosts.ShutdownClean || got.Evidence != "nsm" {
+		t.Errorf("expected a clean shutdown after MarkStopped, got %+v", got)
+	}
+	boot("b3")
+	if got := bootReport(store, root); got.Shutdown != hosts.ShutdownUnexpected || got.Evidence != "nsm" {
+		t.Errorf("expected an unexpected shutdown without MarkStopped, got %+v", got)
+	}
+
+	journal["tail"] = "Stopped target graphical.target.\nReached target System Reboot.\nJournal stopped\n"
+	journal["kernel"] = ""
+	boot("b4")
+	if got := bootReport(store, root); got.Shutdown != hosts.ShutdownClean || got.UnderVoltage {
+		t.Errorf("expected a clean reboot from the journal, got %+v", got)
+	}
+}
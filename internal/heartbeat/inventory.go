@@ -0,0 +1,102 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// inventoryInterval is how long a hardware reading is reused. Only the OS
+// and kernel change, and only on upgrades.
+const inventoryInterval = time.Hour
+
+// inventoryState caches the node's last hardware reading. Like
+// timeSyncState, only SendAll uses it.
+type inventoryState struct {
+	inv  hosts.Inventory
+	read time.Time
+}
+
+func (c *inventoryState) get() hosts.Inventory {
+	if time.Since(c.read) >= inventoryInterval {
+		c.inv = readInventory("/")
+		c.read = time.Now()
+	}
+	return c.inv
+}
+
+// readInventory reads the node's hardware from the files Linux and the
+// Raspberry Pi firmware expose under root. Anything unreadable is left
+// empty, so other boards and operating systems report what they can.
+func readInventory(root string) hosts.Inventory {
+	read := func(path string) string {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		if err != nil {
+			return ""
+		}
+		// Device tree strings end in a NUL.
+		return strings.TrimSpace(strings.TrimRight(string(data), "\x00"))
+	}
+
+	inv := hosts.Inventory{
+		Model:  read("proc/device-tree/model"),
+		Serial: read("proc/device-tree/serial-number"),
+		OS:     parseOSRelease(read("etc/os-release")),
+		Kernel: read("proc/sys/kernel/osrelease"),
+	}
+	if inv.Serial == "" {
+		inv.Serial = parseCPUInfoSerial(read("proc/cpuinfo"))
+	}
+	inv.RAMBytes = parseMemTotal(read("proc/meminfo"))
+	if sectors, err := strconv.ParseInt(read("sys/block/mmcblk0/size"), 10, 64); err == nil {
+		inv.SDCardBytes = sectors * 512 // The kernel counts 512-byte sectors whatever the card's block size
+	}
+	return inv
+}
+
+// parseOSRelease returns PRETTY_NAME from an os-release file.
+func parseOSRelease(data string) string {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "PRETTY_NAME="); ok {
+			if u, err := strconv.Unquote(v); err == nil {
+				return u
+			}
+			return strings.Trim(v, `"'`)
+		}
+	}
+	return ""
+}
+
+// parseCPUInfoSerial finds the "Serial" line older Pi kernels put in
+// /proc/cpuinfo.
+func parseCPUInfoSerial(data string) string {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if ok && strings.TrimSpace(key) == "Serial" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// parseMemTotal returns MemTotal from /proc/meminfo in bytes, or 0.
+func parseMemTotal(data string) int64 {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "MemTotal:"); ok {
+			kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(v), " kB"), 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
@@ -0,0 +1,73 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// UpgradeSettingKey holds this node's last OS upgrade, a hosts.UpgradeRun,
+// which heartbeats report alongside the pending updates.
+const UpgradeSettingKey = "upgrade"
+
+// patchInterval is how long a pending update count is reused. apt only
+// learns of new updates when its package lists are refreshed, usually by
+// the daily apt timer.
+const patchInterval = 30 * time.Minute
+
+// patchState caches the node's last pending update reading. Like
+// timeSyncState, only SendAll uses it.
+type patchState struct {
+	status hosts.PatchStatus
+	read   time.Time
+}
+
+// get returns the node's update state with run as its last upgrade. A
+// finished upgrade changes what is pending, so it forces a new reading.
+func (c *patchState) get(run *hosts.UpgradeRun) hosts.PatchStatus {
+	if time.Since(c.read) >= patchInterval || (run != nil && run.FinishedAt.After(c.read)) {
+		c.status = readPatchStatus("/")
+		c.read = time.Now()
+	}
+	status := c.status
+	status.Upgrade = run
+	return status
+}
+
+// readPatchStatus asks apt which packages a full upgrade would install and
+// checks the flag file Debian's packages leave when they need a reboot.
+// Without apt, as on other distributions, only the reboot flag is read.
+func readPatchStatus(root string) hosts.PatchStatus {
+	var status hosts.PatchStatus
+	if out, err := runCommand("apt-get", "-s", "-o", "Debug::NoLocking=1", "full-upgrade"); err == nil {
+		status.Pending, status.Security = parseAptSimulation(string(out))
+		status.CheckedAt = time.Now().UTC()
+	}
+	if _, err := os.Stat(filepath.Join(root, "run/reboot-required")); err == nil {
+		status.RebootRequired = true
+	}
+	return status
+}
+
+// parseAptSimulation counts the "Inst" lines of a simulated upgrade, and
+// those whose new version comes from a security suite, e.g.
+//
+//	Inst libssl3 [3.0.11-1~deb12u1] (3.0.11-1~deb12u2 Debian-Security:12/stable-security [arm64])
+func parseAptSimulation(out string) (pending, security int) {
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		pending++
+		if strings.Contains(line, "-security") || strings.Contains(line, "Debian-Security:") {
+			security++
+		}
+	}
+	return pending, security
+}
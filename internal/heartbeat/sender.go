@@ -0,0 +1,240 @@
+package heartbeat
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// MaintenanceSettingKey holds whether this node reports maintenance mode in
+// its heartbeats.
+const MaintenanceSettingKey = "maintenance"
+
+// LocalProvider identifies the node sending heartbeats.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// Sender posts a heartbeat to every other host on a fixed interval.
+type Sender struct {
+	store    *hosts.Store
+	id       *identity.Identity
+	local    LocalProvider
+	logger   *logger.Logger
+	interval time.Duration
+	bus      *peerbus.Pool
+	bootedAt time.Time
+	seq      uint64
+	clock    timeSyncState
+	throttle throttleState
+	hardware inventoryState
+	card     cardHealthState
+	wifi     wifiState
+	patches  patchState
+	boot     *hosts.BootReport // Worked out on the first round
+
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+// NewSender creates a sender using the default heartbeat interval, which
+// posts over bus.
+func NewSender(store *hosts.Store, id *identity.Identity, local LocalProvider, lg *logger.Logger, bus *peerbus.Pool) *Sender {
+	interval := types.DefaultHealthThresholds().Interval
+	return &Sender{
+		store:    store,
+		id:       id,
+		local:    local,
+		logger:   lg,
+		interval: interval,
+		bus:      bus,
+		bootedAt: time.Now().UTC(),
+		failing:  make(map[string]bool),
+	}
+}
+
+// Run sends a round of heartbeats every interval until the process exits.
+// Each round also refreshes host health, so peers going silent show up
+// without waiting for another change. Without a node identity there is
+// nothing to sign with, so only the refresh runs.
+func (s *Sender) Run() {
+	if s.id == nil {
+		s.logger.Warning("Heartbeat: node identity unavailable, not sending heartbeats")
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.id != nil {
+			s.SendAll()
+		}
+		s.store.RefreshHealth()
+	}
+}
+
+// SendAll sends one round of heartbeats and waits for it to finish.
+func (s *Sender) SendAll() {
+	self, err := s.local.GetMetadata()
+	if err != nil {
+		return
+	}
+	hostname := self.Hostname
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hostname = h
+	}
+
+	var maintenance bool
+	s.store.GetSetting(MaintenanceSettingKey, &maintenance)
+
+	s.seq++
+	list := s.store.GetAll()
+	beat := Beat{
+		NodeID:      self.ID,
+		Hostname:    hostname,
+		Version:     types.Version,
+		BootedAt:    s.bootedAt,
+		SentAt:      time.Now().UTC(),
+		Seq:         s.seq,
+		Maintenance: maintenance,
+		DiskPercent: diskPercent("/"),
+		Links:       s.store.Links(self.ID),
+		HostCount:   len(list),
+		HostsDigest: hosts.ListDigest(list),
+	}
+	beat.TimeSync, beat.Stratum = s.clock.get()
+	beat.Throttled = s.throttle.get()
+	inv := s.hardware.get()
+	beat.Inventory = &inv
+	beat.Card = s.card.get()
+	beat.WiFi = s.wifi.get()
+	var run *hosts.UpgradeRun
+	var last hosts.UpgradeRun
+	if ok, _ := s.store.GetSetting(UpgradeSettingKey, &last); ok {
+		run = &last
+	}
+	patches := s.patches.get(run)
+	beat.Patches = &patches
+	if s.boot == nil {
+		report := bootReport(s.store, "/")
+		s.boot = &report
+	}
+	if s.boot.BootID != "" {
+		beat.Boot = s.boot
+	}
+	if p, ok := s.store.PlaybackOf(self.ID, beat.SentAt); ok {
+		beat.Playback = &p
+	}
+	if v, ok := s.store.ViewerOf(self.ID, beat.SentAt); ok {
+		beat.Viewer = &v
+	}
+	body, err := Seal(beat, s.id)
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Heartbeat: failed to seal: %v", err))
+		return
+	}
+	s.recordSelf(beat)
+
+	myIP := os.Getenv("NSM_HOST_IP")
+	var wg sync.WaitGroup
+	for _, peer := range list {
+		if peer.ID == self.ID || peer.IPAddress == "" ||
+			peer.IPAddress == "127.0.0.1" || peer.IPAddress == myIP || peer.Simulated() {
+			continue
+		}
+		wg.Add(1)
+		go func(peer types.Host) {
+			defer wg.Done()
+			s.send(peer, body)
+		}(peer)
+	}
+	wg.Wait()
+}
+
+// recordSelf stores this node's own heartbeat so the local host's health is
+// computed the same way as everyone else's.
+func (s *Sender) recordSelf(b Beat) {
+	p, err := s.store.GetPeer(b.NodeID)
+	if err != nil {
+		p = hosts.Peer{NodeID: b.NodeID, FirstSeen: b.SentAt}
+	}
+	lastSeen := p.LastSeen
+	p.PublicKey = base64.StdEncoding.EncodeToString(s.id.PublicKey())
+	p.Hostname = b.Hostname
+	p.Address = ""
+	p.Version = b.Version
+	p.BootedAt = b.BootedAt
+	p.SentAt = b.SentAt
+	p.Seq = b.Seq
+	p.Maintenance = b.Maintenance
+	p.DiskPercent = b.DiskPercent
+	p.TimeSync = b.TimeSync
+	p.Stratum = b.Stratum
+	p.Throttled = b.Throttled
+	p.LastSeen = b.SentAt
+	if err := s.store.PutPeer(p); err != nil {
+		s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own heartbeat: %v", err))
+	}
+	if b.Inventory != nil {
+		if err := s.store.PutInventory(b.NodeID, *b.Inventory, b.SentAt); err != nil {
+			s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own inventory: %v", err))
+		}
+	}
+	if b.Card != nil {
+		if err := s.store.RecordCardHealth(b.NodeID, *b.Card, b.SentAt); err != nil {
+			s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own card health: %v", err))
+		}
+	}
+	if b.WiFi != nil {
+		if err := s.store.RecordWiFi(b.NodeID, *b.WiFi, b.SentAt); err != nil {
+			s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own Wi-Fi: %v", err))
+		}
+	}
+	if b.Patches != nil {
+		if err := s.store.PutPatchStatus(b.NodeID, *b.Patches, b.SentAt); err != nil {
+			s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own patch status: %v", err))
+		}
+	}
+	if b.Boot != nil {
+		recorded, err := s.store.RecordBoot(b.NodeID, *b.Boot, lastSeen, b.SentAt)
+		if err != nil {
+			s.logger.Warning(fmt.Sprintf("Heartbeat: failed to record own boot: %v", err))
+		} else if recorded && b.Boot.Shutdown == hosts.ShutdownUnexpected {
+			s.logger.Warning("Heartbeat: previous boot ended without a clean shutdown, from power loss or a crash")
+		}
+	}
+}
+
+func (s *Sender) send(peer types.Host, body []byte) {
+	addr := hosts.SelectPath(peer).Address
+
+	var failure string
+	status, err := s.bus.Post(addr, Path, body, s.interval/2)
+	if err != nil {
+		failure = err.Error()
+	} else if status != http.StatusNoContent {
+		failure = fmt.Sprintf("status %d", status)
+	}
+
+	// Log transitions only; a dead peer would otherwise log every interval.
+	s.mu.Lock()
+	wasFailing := s.failing[peer.ID]
+	s.failing[peer.ID] = failure != ""
+	s.mu.Unlock()
+
+	switch {
+	case failure != "" && !wasFailing:
+		s.logger.Warning(fmt.Sprintf("Heartbeat: %s (%s) not accepting heartbeats: %s", peer.IPAddress, addr, failure))
+	case failure == "" && wasFailing:
+		s.logger.Info(fmt.Sprintf("Heartbeat: %s (%s) accepting heartbeats again", peer.IPAddress, addr))
+	}
+}
@@ -0,0 +1,54 @@
+package heartbeat
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// throttleInterval is how long a throttle reading is reused. The firmware
+// keeps the since-boot bits, so a short spell between readings still
+// shows up.
+const throttleInterval = time.Minute
+
+// throttleState caches the node's last "vcgencmd get_throttled" reading.
+// Like timeSyncState, only SendAll uses it.
+type throttleState struct {
+	bits *uint32
+	read time.Time
+}
+
+func (c *throttleState) get() *uint32 {
+	if time.Since(c.read) >= throttleInterval {
+		c.bits = readThrottled()
+		c.read = time.Now()
+	}
+	return c.bits
+}
+
+// readThrottled asks the Pi firmware whether it is throttling the node. It
+// returns nil where vcgencmd is missing, as on anything but a Pi.
+func readThrottled() *uint32 {
+	out, err := runCommand("vcgencmd", "get_throttled")
+	if err != nil {
+		return nil
+	}
+	bits, ok := parseThrottled(string(out))
+	if !ok {
+		return nil
+	}
+	return &bits
+}
+
+// parseThrottled reads vcgencmd's "throttled=0x50005" answer.
+func parseThrottled(out string) (uint32, bool) {
+	v, ok := strings.CutPrefix(strings.TrimSpace(out), "throttled=")
+	if !ok {
+		return 0, false
+	}
+	bits, err := strconv.ParseUint(v, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(bits), true
+}
@@ -0,0 +1,95 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// timeSyncInterval is how long an NTP reading is reused. Heartbeats go out
+// every few seconds and sync state changes slowly, so there is no point
+// running chronyc for each one.
+const timeSyncInterval = time.Minute
+
+// runCommand runs a command and returns its output; tests replace it.
+var runCommand = func(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).Output()
+}
+
+// timeSyncState caches the node's last NTP reading. Only SendAll uses it,
+// one round at a time, so it needs no lock.
+type timeSyncState struct {
+	state   string
+	stratum int
+	read    time.Time
+}
+
+func (c *timeSyncState) get() (string, int) {
+	if time.Since(c.read) >= timeSyncInterval {
+		c.state, c.stratum = readTimeSync()
+		c.read = time.Now()
+	}
+	return c.state, c.stratum
+}
+
+// readTimeSync asks chrony for the node's NTP state and falls back to
+// systemd (timedatectl), which covers systemd-timesyncd. It returns an
+// empty state if neither answers.
+func readTimeSync() (string, int) {
+	if out, err := runCommand("chronyc", "-c", "tracking"); err == nil {
+		if state, stratum, ok := parseChronyTracking(string(out)); ok {
+			return state, stratum
+		}
+	}
+
+	out, err := runCommand("timedatectl", "show", "-p", "NTPSynchronized", "--value")
+	if err != nil {
+		return "", 0
+	}
+	switch strings.TrimSpace(string(out)) {
+	case "yes":
+		stratum := 0
+		if out, err := runCommand("timedatectl", "timesync-status"); err == nil {
+			stratum = parseTimesyncStratum(string(out))
+		}
+		return types.TimeSyncSynced, stratum
+	case "no":
+		return types.TimeSyncUnsynced, 0
+	}
+	return "", 0
+}
+
+// parseChronyTracking reads the CSV output of "chronyc -c tracking", whose
+// third field is the stratum and last is the leap status. chrony reports
+// "Not synchronised" until it has a usable source.
+func parseChronyTracking(out string) (state string, stratum int, ok bool) {
+	fields := strings.Split(strings.TrimSpace(out), ",")
+	if len(fields) < 14 {
+		return "", 0, false
+	}
+	stratum, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return "", 0, false
+	}
+	if stratum == 0 || fields[len(fields)-1] == "Not synchronised" {
+		return types.TimeSyncUnsynced, 0, true
+	}
+	return types.TimeSyncSynced, stratum, true
+}
+
+// parseTimesyncStratum finds the "Stratum:" line of "timedatectl
+// timesync-status", or returns 0.
+func parseTimesyncStratum(out string) int {
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "Stratum:"); ok {
+			n, _ := strconv.Atoi(strings.TrimSpace(v))
+			return n
+		}
+	}
+	return 0
+}
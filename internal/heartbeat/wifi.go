@@ -0,0 +1,128 @@
+package heartbeat
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// wifiInterval is how long a Wi-Fi reading is reused. Drops shorter than
+// this between two readings are not counted.
+const wifiInterval = 30 * time.Second
+
+// wifiState caches the node's last Wi-Fi reading and counts the times the
+// link dropped or moved between readings. Like timeSyncState, only SendAll
+// uses it.
+type wifiState struct {
+	wifi       *hosts.WiFi
+	read       time.Time
+	seen       bool   // Connected at some reading since NSM started
+	bssid      string // Access point at the last reading; empty if disconnected
+	reconnects int
+	roams      int
+}
+
+func (c *wifiState) get() *hosts.WiFi {
+	if time.Since(c.read) >= wifiInterval {
+		c.wifi = c.update(readWiFi("/"))
+		c.read = time.Now()
+	}
+	return c.wifi
+}
+
+// update counts the change from the last reading to w and returns w with
+// the counts, or nil if the node has not used Wi-Fi since NSM started, as
+// on Ethernet.
+func (c *wifiState) update(w *hosts.WiFi) *hosts.WiFi {
+	if w == nil {
+		return nil
+	}
+	switch {
+	case !w.Connected():
+	case !c.seen:
+		c.seen = true
+	case c.bssid == "":
+		c.reconnects++
+	case c.bssid != w.BSSID:
+		c.roams++
+	}
+	if !c.seen {
+		return nil
+	}
+	c.bssid = w.BSSID
+	w.Reconnects, w.Roams = c.reconnects, c.roams
+	return w
+}
+
+// readWiFi reads the link of the first wireless interface Linux lists
+// under root, using iw. It returns nil without one, or without iw.
+func readWiFi(root string) *hosts.WiFi {
+	data, err := os.ReadFile(filepath.Join(root, "proc/net/wireless"))
+	if err != nil {
+		return nil
+	}
+	iface := wirelessInterface(string(data))
+	if iface == "" {
+		return nil
+	}
+	out, err := runCommand("iw", "dev", iface, "link")
+	if err != nil {
+		return nil
+	}
+	w := parseIWLink(string(out))
+	w.Interface = iface
+	return &w
+}
+
+// wirelessInterface returns the first interface in /proc/net/wireless,
+// whose first two lines are headers.
+func wirelessInterface(data string) string {
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for i := 0; sc.Scan(); i++ {
+		if i < 2 {
+			continue
+		}
+		if name, _, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// parseIWLink reads "iw dev <interface> link", which starts "Connected to
+// <bssid> (on wlan0)" followed by indented "key: value" lines, or says
+// "Not connected."
+func parseIWLink(out string) hosts.WiFi {
+	var w hosts.WiFi
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if v, ok := strings.CutPrefix(line, "Connected to "); ok {
+			w.BSSID, _, _ = strings.Cut(v, " ")
+			continue
+		}
+		key, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch key {
+		case "SSID":
+			w.SSID = v
+		case "freq":
+			// Newer iw prints fractions, e.g. "5180.0".
+			whole, _, _ := strings.Cut(v, ".")
+			w.FreqMHz, _ = strconv.Atoi(whole)
+			w.Channel = hosts.WiFiChannel(w.FreqMHz)
+		case "signal":
+			num, _, _ := strings.Cut(v, " ")
+			w.SignalDBM, _ = strconv.Atoi(num)
+		}
+	}
+	return w
+}
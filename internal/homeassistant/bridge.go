@@ -0,0 +1,280 @@
+package homeassistant
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// message is an MQTT message received on a subscription.
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// Bridge keeps Home Assistant's view of the displays current and carries
+// out its power commands.
+type Bridge struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+	client   *http.Client
+	signer   *peerauth.Signer
+
+	session  *notify.MQTTSession
+	key      string // Settings the session was opened with
+	topics   topics
+	apiKey   string
+	messages chan message
+	lost     chan *notify.MQTTSession
+	sent     map[string]string // Retained payloads last sent, by topic
+	shown    map[string]bool   // Hosts with discovery messages out
+	lastErr  string
+}
+
+// NewBridge creates a bridge that refreshes Home Assistant every 30
+// seconds and signs power commands with signer.
+func NewBridge(store *hosts.Store, lg *logger.Logger, signer *peerauth.Signer) *Bridge {
+	return &Bridge{
+		store:    store,
+		logger:   lg,
+		interval: 30 * time.Second,
+		client:   &http.Client{Timeout: 15 * time.Second},
+		signer:   signer,
+		messages: make(chan message, 16),
+		lost:     make(chan *notify.MQTTSession, 1),
+	}
+}
+
+// Run publishes the displays while the settings enable the bridge, until
+// the process exits.
+func (b *Bridge) Run() {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	b.Sync()
+	for {
+		select {
+		case <-ticker.C:
+			b.Sync()
+		case m := <-b.messages:
+			b.handle(m)
+		case s := <-b.lost:
+			if s == b.session {
+				b.logger.Warning("Home Assistant: lost the MQTT connection; reconnecting")
+				b.session = nil
+				b.Sync()
+			}
+		}
+	}
+}
+
+// Sync connects, disconnects or reconnects as the settings require, and
+// publishes every display's discovery messages and state that changed.
+func (b *Bridge) Sync() {
+	cfg, err := LoadConfig(b.store)
+	if err != nil {
+		b.logger.Warning(fmt.Sprintf("Home Assistant: failed to load settings: %v", err))
+		return
+	}
+	mq, err := notify.LoadMQTT(b.store)
+	if err != nil {
+		b.logger.Warning(fmt.Sprintf("Home Assistant: failed to load MQTT settings: %v", err))
+		return
+	}
+	if !cfg.Enabled || !mq.Configured() {
+		b.disconnect()
+		return
+	}
+	b.apiKey = cfg.APIKey
+
+	key := strings.Join([]string{mq.Broker, mq.Username, mq.Password, mq.Topic, cfg.DiscoveryPrefix}, "\x00")
+	if b.session != nil && key != b.key {
+		b.disconnect()
+	}
+	if b.session == nil {
+		if err := b.connect(mq, cfg, key); err != nil {
+			if msg := err.Error(); msg != b.lastErr {
+				b.logger.Warning(fmt.Sprintf("Home Assistant: %v", err))
+				b.lastErr = msg
+			}
+			return
+		}
+	}
+
+	list := b.store.GetAll()
+	present := make(map[string]bool)
+	for _, h := range list {
+		present[h.ID] = true
+		for topic, payload := range b.topics.discovery(h) {
+			b.publish(topic, string(payload))
+		}
+		b.shown[h.ID] = true
+		state := available(h)
+		b.publish(b.topics.availability(h.ID), state)
+		if state == online {
+			if name, err := b.currentAsset(h); err == nil {
+				b.publish(b.topics.asset(h.ID), name)
+			}
+		}
+	}
+	for id := range b.shown {
+		if present[id] {
+			continue
+		}
+		for _, topic := range b.topics.retired(id) {
+			b.publish(topic, "")
+		}
+		delete(b.shown, id)
+	}
+}
+
+func (b *Bridge) connect(mq notify.MQTTConfig, cfg Config, key string) error {
+	t := topics{base: mq.Topic + "/ha", prefix: cfg.DiscoveryPrefix}
+	mq.ClientID = "" // Alerts may be connected under the configured ID
+	s, err := notify.DialMQTT(mq, &notify.MQTTWill{Topic: t.status(), Payload: []byte(offline), Retain: true})
+	if err != nil {
+		return err
+	}
+	if err := s.Subscribe(t.powerSetFilter(), t.homeAssistantStatus()); err != nil {
+		s.Close()
+		return err
+	}
+	if err := s.Publish(t.status(), []byte(online), true); err != nil {
+		s.Close()
+		return err
+	}
+	go func() {
+		s.Receive(func(topic string, payload []byte) {
+			b.messages <- message{topic, payload}
+		})
+		b.lost <- s
+	}()
+
+	b.session, b.key, b.topics, b.lastErr = s, key, t, ""
+	b.sent, b.shown = make(map[string]string), make(map[string]bool)
+	b.logger.Info(fmt.Sprintf("Home Assistant: connected to MQTT broker %s", mq.Broker))
+	return nil
+}
+
+// disconnect marks the bridge offline and closes the session, if any.
+func (b *Bridge) disconnect() {
+	if b.session == nil {
+		return
+	}
+	b.session.Publish(b.topics.status(), []byte(offline), true)
+	b.session.Close()
+	b.session = nil
+	b.logger.Info("Home Assistant: disconnected")
+}
+
+// publish sends a retained payload unless it was the last one sent to
+// topic.
+func (b *Bridge) publish(topic, payload string) {
+	if prev, ok := b.sent[topic]; ok && prev == payload {
+		return
+	}
+	if err := b.session.Publish(topic, []byte(payload), true); err != nil {
+		return // Receive notices the broken connection
+	}
+	b.sent[topic] = payload
+}
+
+// handle acts on a message from Home Assistant.
+func (b *Bridge) handle(m message) {
+	if b.session == nil {
+		return
+	}
+	if m.topic == b.topics.homeAssistantStatus() {
+		if string(m.payload) == online {
+			// Home Assistant restarted; send everything again.
+			b.sent = make(map[string]string)
+			b.Sync()
+		}
+		return
+	}
+	id, ok := b.topics.hostID(m.topic)
+	if !ok {
+		return
+	}
+	h, err := b.store.GetByID(id)
+	if err != nil {
+		return
+	}
+	var power string
+	switch string(m.payload) {
+	case powerOn:
+		power = "on"
+	case powerOff:
+		power = "off"
+	default:
+		return
+	}
+
+	s, topic, apiKey := b.session, b.topics.power(id), b.apiKey
+	go func() {
+		if err := b.setPower(*h, power, apiKey); err != nil {
+			b.logger.Warning(fmt.Sprintf("Home Assistant: failed to turn %s %s: %v", displayName(*h), power, err))
+			return
+		}
+		b.logger.Info(fmt.Sprintf("Home Assistant: turned %s %s", displayName(*h), power))
+		s.Publish(topic, m.payload, true)
+	}()
+}
+
+// setPower asks the node h runs on to turn its screen on or off.
+func (b *Bridge) setPower(h types.Host, power, apiKey string) error {
+	body, _ := json.Marshal(map[string]string{"power": power})
+	url := fmt.Sprintf("http://%s:8080/api/hosts/display-power", b.store.ResolveAddress(h.IPAddress))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	b.signer.Sign(req, body)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("node returned status %d %s", resp.StatusCode, e.Error)
+	}
+	return nil
+}
+
+// currentAsset asks h's Anthias which asset is on screen.
+func (b *Bridge) currentAsset(h types.Host) (string, error) {
+	url := fmt.Sprintf("http://%s/api/v1/viewer_current_asset", b.store.ResolveAddress(h.IPAddress))
+	resp, err := b.client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("current asset returned status %d", resp.StatusCode)
+	}
+	var asset struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&asset); err != nil {
+		return "", err
+	}
+	return asset.Name, nil
+}
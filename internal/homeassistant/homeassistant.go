@@ -0,0 +1,215 @@
+// Package homeassistant publishes each display to Home Assistant through
+// MQTT discovery, so venues that run everything from Home Assistant can
+// see their screens there and switch them on and off.
+package homeassistant
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// SettingKey is the settings key holding the Config.
+const SettingKey = "home_assistant"
+
+// DefaultDiscoveryPrefix is the topic prefix Home Assistant watches for
+// discovery messages unless configured otherwise.
+const DefaultDiscoveryPrefix = "homeassistant"
+
+const maskedKey = "********"
+
+// Config controls the Home Assistant bridge. Messages go to the broker in
+// the MQTT settings. It is off by default.
+type Config struct {
+	Enabled         bool   `json:"enabled"`
+	DiscoveryPrefix string `json:"discovery_prefix,omitempty"` // DefaultDiscoveryPrefix if empty
+	APIKey          string `json:"api_key,omitempty"`          // Operator API key for power commands to nodes that require sign-in and have not pinned this node's key
+}
+
+// Validate fills in defaults and rejects unusable values.
+func (c *Config) Validate() error {
+	if c.DiscoveryPrefix == "" {
+		c.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if strings.ContainsAny(c.DiscoveryPrefix, "+#") || strings.HasPrefix(c.DiscoveryPrefix, "/") || strings.HasSuffix(c.DiscoveryPrefix, "/") {
+		return errors.New("discovery_prefix must be a topic without wildcards or leading or trailing slashes")
+	}
+	return nil
+}
+
+// Masked returns a copy safe to return from the API.
+func (c Config) Masked() Config {
+	if c.APIKey != "" {
+		c.APIKey = maskedKey
+	}
+	return c
+}
+
+// LoadConfig reads the bridge settings.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	var cfg Config
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// SaveConfig validates and stores the bridge settings. An API key sent
+// back masked or empty keeps the stored one.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if cfg.APIKey == "" || cfg.APIKey == maskedKey {
+		current, err := LoadConfig(store)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.APIKey = current.APIKey
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// Payloads of the availability and power topics.
+const (
+	online   = "online"
+	offline  = "offline"
+	powerOn  = "ON"
+	powerOff = "OFF"
+)
+
+// topics lays out the bridge's topics. State lives below base, the MQTT
+// topic from the settings followed by /ha; discovery messages go below
+// prefix.
+type topics struct {
+	base, prefix string
+}
+
+// status carries the bridge's own availability, and is its will.
+func (t topics) status() string { return t.base + "/status" }
+
+func (t topics) availability(id string) string { return t.base + "/" + id + "/availability" }
+func (t topics) asset(id string) string        { return t.base + "/" + id + "/asset" }
+func (t topics) power(id string) string        { return t.base + "/" + id + "/power" }
+func (t topics) powerSet(id string) string     { return t.power(id) + "/set" }
+
+// powerSetFilter matches the power command topics of every display.
+func (t topics) powerSetFilter() string { return t.base + "/+/power/set" }
+
+// homeAssistantStatus is where Home Assistant announces it has started,
+// after which discovery messages are sent again.
+func (t topics) homeAssistantStatus() string { return t.prefix + "/status" }
+
+// Discovery topics of a display's entities.
+func (t topics) powerConfig(id string) string {
+	return t.prefix + "/switch/nsm_" + id + "/power/config"
+}
+func (t topics) assetConfig(id string) string {
+	return t.prefix + "/sensor/nsm_" + id + "/asset/config"
+}
+
+// hostID returns the display a power command topic is for.
+func (t topics) hostID(powerSet string) (string, bool) {
+	rest, ok := strings.CutPrefix(powerSet, t.base+"/")
+	if !ok {
+		return "", false
+	}
+	id, ok := strings.CutSuffix(rest, "/power/set")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+type device struct {
+	Identifiers      []string `json:"identifiers"`
+	Name             string   `json:"name"`
+	Manufacturer     string   `json:"manufacturer"`
+	Model            string   `json:"model"`
+	SWVersion        string   `json:"sw_version,omitempty"`
+	ConfigurationURL string   `json:"configuration_url,omitempty"`
+}
+
+type availability struct {
+	Topic string `json:"topic"`
+}
+
+// entity is a discovery message; see Home Assistant's MQTT integration.
+type entity struct {
+	Name             string         `json:"name"`
+	UniqueID         string         `json:"unique_id"`
+	StateTopic       string         `json:"state_topic"`
+	CommandTopic     string         `json:"command_topic,omitempty"`
+	Availability     []availability `json:"availability"`
+	AvailabilityMode string         `json:"availability_mode"`
+	Icon             string         `json:"icon,omitempty"`
+	Device           device         `json:"device"`
+}
+
+// discovery returns the discovery messages for h by topic: a power switch
+// and a sensor showing the current asset. Both are unavailable while the
+// display is offline or the bridge is down.
+func (t topics) discovery(h types.Host) map[string][]byte {
+	dev := device{
+		Identifiers:      []string{"nsm_" + h.ID},
+		Name:             displayName(h),
+		Manufacturer:     "nexSign mini",
+		Model:            "Anthias display",
+		SWVersion:        h.NSMVersion,
+		ConfigurationURL: h.DashboardURL,
+	}
+	avail := []availability{{Topic: t.status()}, {Topic: t.availability(h.ID)}}
+
+	power := entity{
+		Name:         "Power",
+		UniqueID:     "nsm_" + h.ID + "_power",
+		StateTopic:   t.power(h.ID),
+		CommandTopic: t.powerSet(h.ID),
+		Icon:         "mdi:television",
+	}
+	asset := entity{
+		Name:       "Current asset",
+		UniqueID:   "nsm_" + h.ID + "_asset",
+		StateTopic: t.asset(h.ID),
+		Icon:       "mdi:play-box-outline",
+	}
+	out := make(map[string][]byte)
+	for topic, e := range map[string]entity{t.powerConfig(h.ID): power, t.assetConfig(h.ID): asset} {
+		e.Availability, e.AvailabilityMode, e.Device = avail, "all", dev
+		out[topic], _ = json.Marshal(e)
+	}
+	return out
+}
+
+// retired returns the topics to clear when h leaves the host list: an
+// empty discovery message removes an entity from Home Assistant.
+func (t topics) retired(id string) []string {
+	return []string{
+		t.powerConfig(id),
+		t.assetConfig(id),
+		t.availability(id),
+		t.asset(id),
+		t.power(id),
+	}
+}
+
+func displayName(h types.Host) string {
+	switch {
+	case h.Nickname != "":
+		return h.Nickname
+	case h.Hostname != "":
+		return h.Hostname
+	}
+	return h.IPAddress
+}
+
+// available reports whether h is heartbeating.
+func available(h types.Host) string {
+	if h.Health == types.HealthOffline || h.Health == "" {
+		return offline
+	}
+	return online
+}
@@ -0,0 +1,153 @@
+package homeassistant
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestDiscovery(t *testing.T) {
+	tp := topics{base: "nsm/ha", prefix: "homeassistant"}
+	h := types.Host{ID: "abc", Hostname: "lobby-pi", NSMVersion: "0.2.0", DashboardURL: "http://10.0.0.5:8080"}
+	msgs := tp.discovery(h)
+
+	var power entity
+	if err := json.Unmarshal(msgs["homeassistant/switch/nsm_abc/power/config"], &power); err != nil {
+		t.Fatalf("power switch: %v", err)
+	}
+	if power.CommandTopic != "nsm/ha/abc/power/set" || power.StateTopic != "nsm/ha/abc/power" || power.Device.Name != "lobby-pi" {
+		t.Errorf("unexpected power switch %+v", power)
+	}
+	if len(power.Availability) != 2 || power.Availability[1].Topic != "nsm/ha/abc/availability" || power.AvailabilityMode != "all" {
+		t.Errorf("unexpected availability %+v", power.Availability)
+	}
+	var asset entity
+	if err := json.Unmarshal(msgs["homeassistant/sensor/nsm_abc/asset/config"], &asset); err != nil {
+		t.Fatalf("asset sensor: %v", err)
+	}
+	if asset.StateTopic != "nsm/ha/abc/asset" || asset.Device.Identifiers[0] != power.Device.Identifiers[0] {
+		t.Errorf("unexpected asset sensor %+v", asset)
+	}
+
+	for topic, want := range map[string]string{"nsm/ha/abc/power/set": "abc", "nsm/ha/abc/power": "", "nsm/other/abc/power/set": ""} {
+		if id, _ := tp.hostID(topic); id != want {
+			t.Errorf("hostID(%q) = %q, want %q", topic, id, want)
+		}
+	}
+}
+
+func TestSaveConfig(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := SaveConfig(store, Config{Enabled: true, APIKey: "nsm_secret"}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	cfg, err := SaveConfig(store, Config{Enabled: true, APIKey: maskedKey, DiscoveryPrefix: "ha"})
+	if err != nil || cfg.APIKey != "nsm_secret" || cfg.DiscoveryPrefix != "ha" {
+		t.Errorf("expected the stored key to be kept, got %+v (%v)", cfg, err)
+	}
+	if _, err := SaveConfig(store, Config{DiscoveryPrefix: "ha/#"}); err == nil {
+		t.Error("expected a wildcard prefix to be refused")
+	}
+}
+
+// fakeBroker accepts one client and returns the retained messages it
+// publishes, by topic, once it disconnects.
+func fakeBroker(t *testing.T) (string, <-chan map[string]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan map[string]string, 1)
+	go func() {
+		retained := make(map[string]string)
+		defer func() { out <- retained }()
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			header, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			var n, shift int
+			for {
+				b, _ := r.ReadByte()
+				n |= int(b&0x7f) << shift
+				shift += 7
+				if b&0x80 == 0 {
+					break
+				}
+			}
+			body := make([]byte, n)
+			io.ReadFull(r, body)
+			switch header >> 4 {
+			case 1:
+				conn.Write([]byte{0x20, 2, 0, 0})
+			case 3:
+				l := int(binary.BigEndian.Uint16(body))
+				if header&1 != 0 {
+					retained[string(body[2:2+l])] = string(body[2+l:])
+				}
+			case 14:
+				return
+			}
+		}
+	}()
+	return ln.Addr().String(), out
+}
+
+func TestSync(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "a", Nickname: "Lobby", IPAddress: "10.0.0.1"})
+	store.Add(types.Host{ID: "b", Nickname: "Gym", IPAddress: "10.0.0.2"})
+
+	addr, published := fakeBroker(t)
+	store.PutSetting(notify.MQTTSettingKey, notify.MQTTConfig{Broker: addr, Topic: "nsm"})
+	store.PutSetting(SettingKey, Config{Enabled: true})
+
+	b := NewBridge(store, logger.New(10), nil)
+	b.Sync()
+	if b.session == nil {
+		t.Fatal("expected the bridge to connect")
+	}
+	store.Delete("10.0.0.2")
+	b.Sync()
+	store.PutSetting(SettingKey, Config{})
+	b.Sync()
+
+	got := <-published
+	for topic, want := range map[string]string{
+		"nsm/ha/status":                           offline,
+		"nsm/ha/a/availability":                   offline, // No heartbeats yet
+		"homeassistant/switch/nsm_b/power/config": "",      // Removed with the host
+	} {
+		if got[topic] != want {
+			t.Errorf("%s: got %q, want %q", topic, got[topic], want)
+		}
+	}
+	if got["homeassistant/switch/nsm_a/power/config"] == "" {
+		t.Error("expected a discovery message for the remaining host")
+	}
+}
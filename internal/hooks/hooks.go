@@ -0,0 +1,309 @@
+// Package hooks runs site-specific automations on fleet events: a host was
+// added, went offline or came back, a preset was applied or an OS upgrade
+// finished. A hook is either an executable in the node's hooks directory,
+// which gets the event as JSON on standard input, or a URL the event is
+// posted to. Executables must be installed on the node by hand; the API can
+// only choose among them, so an API key cannot run arbitrary commands.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Settings keys used by hooks.
+const (
+	SettingKey      = "hooks"
+	StateSettingKey = "hooks.state"
+)
+
+// Events a hook can subscribe to.
+const (
+	EventHostAdded       = "host_added"
+	EventHostOffline     = "host_offline"
+	EventHostOnline      = "host_online" // Back after host_offline
+	EventPresetApplied   = "preset_applied"
+	EventUpgradeFinished = "upgrade_finished"
+	EventTest            = "test" // Sent by the test endpoint only
+)
+
+// Events lists the events hooks can subscribe to.
+var Events = []string{EventHostAdded, EventHostOffline, EventHostOnline, EventPresetApplied, EventUpgradeFinished}
+
+// EventHeader names the event on posted hooks.
+const EventHeader = "X-NSM-Event"
+
+// Timeouts of a hook run, in seconds.
+const (
+	DefaultTimeout = 10
+	MaxTimeout     = 300
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Hook runs Command or posts to URL when one of Events happens.
+type Hook struct {
+	Name           string   `json:"name"`
+	Enabled        bool     `json:"enabled"`
+	Events         []string `json:"events"`
+	Command        string   `json:"command,omitempty"` // File name in the hooks directory
+	URL            string   `json:"url,omitempty"`
+	Secret         string   `json:"secret,omitempty"` // Signs posted events like the alert webhook
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// Validate normalises h and checks it names one known target.
+func (h *Hook) Validate() error {
+	h.Name = strings.ToLower(strings.TrimSpace(h.Name))
+	h.Command = strings.TrimSpace(h.Command)
+	h.URL = strings.TrimSpace(h.URL)
+	if !validName.MatchString(h.Name) {
+		return fmt.Errorf("invalid hook name %q (lower case letters, digits, - and _)", h.Name)
+	}
+	if len(h.Events) == 0 {
+		return fmt.Errorf("hook %s: at least one event is required", h.Name)
+	}
+	for _, ev := range h.Events {
+		if !slices.Contains(Events, ev) {
+			return fmt.Errorf("hook %s: unknown event %q (want %v)", h.Name, ev, Events)
+		}
+	}
+	switch {
+	case (h.Command == "") == (h.URL == ""):
+		return fmt.Errorf("hook %s: set either command or url", h.Name)
+	case h.Command != "" && (h.Command != filepath.Base(h.Command) || strings.HasPrefix(h.Command, ".")):
+		return fmt.Errorf("hook %s: command must be a file name in the hooks directory", h.Name)
+	case h.URL != "":
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("hook %s: url must be an http or https URL", h.Name)
+		}
+	}
+	if h.TimeoutSeconds == 0 {
+		h.TimeoutSeconds = DefaultTimeout
+	}
+	if h.TimeoutSeconds < 1 || h.TimeoutSeconds > MaxTimeout {
+		return fmt.Errorf("hook %s: timeout_seconds must be 1 to %d", h.Name, MaxTimeout)
+	}
+	return nil
+}
+
+// Masked returns a copy safe to return from the API.
+func (h Hook) Masked() Hook {
+	if h.Secret != "" {
+		h.Secret = "********"
+	}
+	return h
+}
+
+// Load returns the configured hooks.
+func Load(store hosts.SettingStore) ([]Hook, error) {
+	list := []Hook{}
+	if _, err := store.GetSetting(SettingKey, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Save validates and stores list, replacing the configured hooks.
+func Save(store hosts.SettingStore, list []Hook) ([]Hook, error) {
+	seen := make(map[string]bool)
+	for i := range list {
+		if err := list[i].Validate(); err != nil {
+			return nil, err
+		}
+		if seen[list[i].Name] {
+			return nil, fmt.Errorf("duplicate hook name %q", list[i].Name)
+		}
+		seen[list[i].Name] = true
+	}
+	if list == nil {
+		list = []Hook{}
+	}
+	return list, store.PutSetting(SettingKey, list)
+}
+
+// Dir returns the directory hook executables are installed in.
+func Dir(store *hosts.Store) string {
+	return filepath.Join(store.Dir(), "hooks")
+}
+
+// Host identifies the host an event is about.
+type Host struct {
+	ID        string `json:"id"`
+	Nickname  string `json:"nickname,omitempty"`
+	IPAddress string `json:"ip_address"`
+	Hostname  string `json:"hostname,omitempty"`
+}
+
+// HostOf returns the identifying fields of h.
+func HostOf(h types.Host) *Host {
+	return &Host{ID: h.ID, Nickname: h.Nickname, IPAddress: h.IPAddress, Hostname: h.Hostname}
+}
+
+// Event is the payload hooks receive.
+type Event struct {
+	Event   string            `json:"event"`
+	At      time.Time         `json:"at"`
+	Node    string            `json:"node"`              // Hostname of the node running the hook
+	Host    *Host             `json:"host,omitempty"`    // For host and upgrade events
+	Preset  string            `json:"preset,omitempty"`  // For preset_applied
+	Source  string            `json:"source,omitempty"`  // What applied the preset: api, grpc, calendar, trigger:<name> or alert:<name>
+	Upgrade *hosts.UpgradeRun `json:"upgrade,omitempty"` // For upgrade_finished
+}
+
+// Result is the last run of a hook.
+type Result struct {
+	Event      string    `json:"event"`
+	At         time.Time `json:"at"`
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// LoadState returns the last run of each hook, by name.
+func LoadState(store hosts.SettingStore) (map[string]Result, error) {
+	st := make(map[string]Result)
+	if _, err := store.GetSetting(StateSettingKey, &st); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// stateMu serialises updates of the state, as hooks finish concurrently.
+var stateMu sync.Mutex
+
+func record(store hosts.SettingStore, name string, res Result) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	st, err := LoadState(store)
+	if err != nil {
+		return err
+	}
+	st[name] = res
+	return store.PutSetting(StateSettingKey, st)
+}
+
+// Fire runs every enabled hook subscribed to ev in the background. It
+// returns at once; failures are logged and recorded in the state.
+func Fire(store *hosts.Store, lg *logger.Logger, ev Event) {
+	list, err := Load(store)
+	if err != nil {
+		lg.Warning(fmt.Sprintf("Hooks: failed to load hooks: %v", err))
+		return
+	}
+	for _, h := range list {
+		if !h.Enabled || !slices.Contains(h.Events, ev.Event) {
+			continue
+		}
+		go func(h Hook) {
+			if res := Run(store, h, ev); res.Error != "" {
+				lg.Warning(fmt.Sprintf("Hooks: %s on %s: %s", h.Name, ev.Event, res.Error))
+			}
+		}(h)
+	}
+}
+
+// Run runs h for ev, waits for it to finish and records the result.
+func Run(store *hosts.Store, h Hook, ev Event) Result {
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	if ev.Node == "" {
+		ev.Node, _ = os.Hostname()
+	}
+	start := time.Now()
+	err := run(Dir(store), h, ev)
+	res := Result{Event: ev.Event, At: ev.At, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	record(store, h.Name, res)
+	return res
+}
+
+func run(dir string, h Hook, ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	timeout := time.Duration(h.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = DefaultTimeout * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if h.URL != "" {
+		return post(ctx, h, ev.Event, payload)
+	}
+	cmd := exec.CommandContext(ctx, filepath.Join(dir, h.Command))
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "NSM_EVENT="+ev.Event, "NSM_HOOK="+h.Name)
+	// Children the hook left running may hold its output open; stop
+	// waiting for them soon after the hook itself is killed.
+	cmd.WaitDelay = time.Second
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if tail := strings.TrimSpace(string(out)); tail != "" {
+			return fmt.Errorf("%v: %s", err, lastLine(tail))
+		}
+		return err
+	}
+	return nil
+}
+
+// post sends the event to h.URL. Any 2xx response counts as delivered.
+func post(ctx context.Context, h Hook, event string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(payload)
+		req.Header.Set(notify.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("timed out after %ds", h.TimeoutSeconds)
+		}
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func lastLine(out string) string {
+	lines := strings.Split(out, "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
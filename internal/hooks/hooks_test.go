@@ -0,0 +1,154 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newStore(t *testing.T) *hosts.Store {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		hook Hook
+		ok   bool
+	}{
+		{"command", Hook{Name: "Relay", Events: []string{EventHostOffline}, Command: "relay.sh"}, true},
+		{"url", Hook{Name: "crm", Events: []string{EventPresetApplied}, URL: "https://example.com/nsm"}, true},
+		{"both", Hook{Name: "x", Events: []string{EventHostAdded}, Command: "a", URL: "https://example.com"}, false},
+		{"neither", Hook{Name: "x", Events: []string{EventHostAdded}}, false},
+		{"path", Hook{Name: "x", Events: []string{EventHostAdded}, Command: "../../bin/sh"}, false},
+		{"absolute", Hook{Name: "x", Events: []string{EventHostAdded}, Command: "/bin/sh"}, false},
+		{"hidden", Hook{Name: "x", Events: []string{EventHostAdded}, Command: ".."}, false},
+		{"scheme", Hook{Name: "x", Events: []string{EventHostAdded}, URL: "file:///etc/passwd"}, false},
+		{"no events", Hook{Name: "x", Command: "a"}, false},
+		{"unknown event", Hook{Name: "x", Events: []string{"host_melted"}, Command: "a"}, false},
+		{"test event", Hook{Name: "x", Events: []string{EventTest}, Command: "a"}, false},
+		{"timeout", Hook{Name: "x", Events: []string{EventHostAdded}, Command: "a", TimeoutSeconds: 3600}, false},
+	}
+	for _, tt := range tests {
+		err := tt.hook.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+	}
+
+	h := Hook{Name: " Relay ", Events: []string{EventHostAdded}, Command: "relay.sh"}
+	h.Validate()
+	if h.Name != "relay" || h.TimeoutSeconds != DefaultTimeout {
+		t.Errorf("expected the name lowered and the default timeout, got %+v", h)
+	}
+	if _, err := Save(newStore(t), []Hook{h, h}); err == nil {
+		t.Error("expected duplicate names refused")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	store := newStore(t)
+	dir := Dir(store)
+	os.MkdirAll(dir, 0755)
+	script := "#!/bin/sh\ncat > \"$NSM_HOOK.json\"\necho \"$NSM_EVENT\" >> \"$NSM_HOOK.json\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "record.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "fail.sh"), []byte("#!/bin/sh\necho 'relay unreachable' >&2\nexit 3\n"), 0755)
+	os.WriteFile(filepath.Join(dir, "slow.sh"), []byte("#!/bin/sh\nsleep 5\n"), 0755)
+
+	ev := Event{Event: EventPresetApplied, Preset: "Event Mode", Source: "api"}
+	res := Run(store, Hook{Name: "record", Command: "record.sh", TimeoutSeconds: 5}, ev)
+	if res.Error != "" {
+		t.Fatalf("Run: %s", res.Error)
+	}
+	out, _ := os.ReadFile(filepath.Join(dir, "record.json"))
+	if !strings.Contains(string(out), `"preset":"Event Mode"`) || !strings.HasSuffix(string(out), "preset_applied\n") {
+		t.Errorf("expected the event on stdin and in NSM_EVENT, got %s", out)
+	}
+
+	if res := Run(store, Hook{Name: "fail", Command: "fail.sh", TimeoutSeconds: 5}, ev); !strings.Contains(res.Error, "relay unreachable") {
+		t.Errorf("expected the command's output in the error, got %q", res.Error)
+	}
+	start := time.Now()
+	if res := Run(store, Hook{Name: "slow", Command: "slow.sh", TimeoutSeconds: 1}, ev); !strings.Contains(res.Error, "timed out") || time.Since(start) > 4*time.Second {
+		t.Errorf("expected the hook stopped at its timeout, got %q after %s", res.Error, time.Since(start))
+	}
+
+	st, err := LoadState(store)
+	if err != nil || len(st) != 3 || st["record"].Error != "" || st["fail"].Error == "" {
+		t.Errorf("expected each run recorded, got %+v (%v)", st, err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	store := newStore(t)
+	events := make(chan Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		json.NewDecoder(r.Body).Decode(&ev)
+		if r.Header.Get(EventHeader) != ev.Event || r.Header.Get(notify.SignatureHeader) == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- ev
+	}))
+	defer srv.Close()
+	if _, err := Save(store, []Hook{{Name: "crm", Enabled: true, URL: srv.URL, Secret: "s",
+		Events: []string{EventHostAdded, EventUpgradeFinished}}}); err != nil {
+		t.Fatal(err)
+	}
+	next := func() *Event {
+		select {
+		case ev := <-events:
+			return &ev
+		case <-time.After(2 * time.Second):
+			return nil
+		}
+	}
+
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	w := NewWatcher(store, logger.New(100))
+	now := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	w.Check(now)
+	if ev := next(); ev != nil {
+		t.Fatalf("expected the first check to fire nothing, got %+v", ev)
+	}
+
+	store.Add(types.Host{ID: "b", IPAddress: "192.168.1.21", Nickname: "Bar"})
+	store.PutPatchStatus("a", hosts.PatchStatus{Upgrade: &hosts.UpgradeRun{State: hosts.UpgradeSucceeded,
+		StartedAt: now, FinishedAt: now.Add(time.Minute)}}, now)
+	w.Check(now.Add(time.Minute))
+	got := map[string]string{}
+	for range 2 {
+		ev := next()
+		if ev == nil {
+			t.Fatalf("expected two events, got %v", got)
+		}
+		got[ev.Event] = ev.Host.ID
+	}
+	if got[EventHostAdded] != "b" || got[EventUpgradeFinished] != "a" {
+		t.Errorf("expected b added and a upgraded, got %v", got)
+	}
+
+	w.Check(now.Add(2 * time.Minute))
+	if ev := next(); ev != nil {
+		t.Errorf("expected nothing new, got %+v", ev)
+	}
+}
@@ -0,0 +1,114 @@
+package hooks
+
+import (
+	"fmt"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Watcher fires the host and upgrade events by comparing the host list,
+// host health and upgrade runs with what it saw on its previous check. It
+// covers hosts added on any node, by any path, the same way. A host going
+// offline and coming back is also recorded in the host's incident.
+type Watcher struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+
+	primed   bool
+	health   map[string]types.HealthStatus // By host ID
+	upgrades map[string]time.Time          // Finish time of the last upgrade run, by node ID
+}
+
+// NewWatcher creates a watcher that checks every 15 seconds.
+func NewWatcher(store *hosts.Store, lg *logger.Logger) *Watcher {
+	return &Watcher{store: store, logger: lg, interval: 15 * time.Second}
+}
+
+// Run checks until the process exits.
+func (w *Watcher) Run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		w.Check(time.Now().UTC())
+	}
+}
+
+// Check fires an event for each change since the previous check. The first
+// check only records the fleet as it is, so a restart does not announce
+// every host again.
+func (w *Watcher) Check(now time.Time) {
+	peers := make(map[string]hosts.Peer)
+	if list, err := w.store.ListPeers(); err == nil {
+		for _, p := range list {
+			peers[p.NodeID] = p
+		}
+	}
+	patches, err := w.store.ListPatchStatus()
+	if err != nil {
+		w.logger.Warning(fmt.Sprintf("Hooks: failed to load upgrade runs: %v", err))
+		return
+	}
+
+	health := make(map[string]types.HealthStatus)
+	byID := make(map[string]types.Host)
+	var events []Event
+	for _, host := range w.store.GetAll() {
+		byID[host.ID] = host
+		h := host.Health
+		if peer, ok := peers[host.ID]; ok {
+			h = types.DetermineHealth(peer.Liveness(), now, types.DefaultHealthThresholds())
+		}
+		health[host.ID] = h
+
+		prev, known := w.health[host.ID]
+		switch {
+		case !w.primed:
+		case !known:
+			events = append(events, Event{Event: EventHostAdded, At: now, Host: HostOf(host)})
+		case h == types.HealthOffline && prev != types.HealthOffline && prev != "":
+			events = append(events, Event{Event: EventHostOffline, At: now, Host: HostOf(host)})
+			w.recordIncident(host, hosts.IncidentEvent{At: now, Kind: hosts.IncidentOffline, Detail: "No heartbeat or failing health checks"})
+		case prev == types.HealthOffline && h != types.HealthOffline && h != "":
+			events = append(events, Event{Event: EventHostOnline, At: now, Host: HostOf(host)})
+			w.recordIncident(host, hosts.IncidentEvent{At: now, Kind: hosts.IncidentOnline, Detail: "Back; health is " + string(h)})
+		}
+	}
+
+	upgrades := make(map[string]time.Time)
+	for id, p := range patches {
+		if p.Upgrade == nil || p.Upgrade.State == hosts.UpgradeRunning || p.Upgrade.FinishedAt.IsZero() {
+			continue
+		}
+		upgrades[id] = p.Upgrade.FinishedAt
+		if !w.primed || w.upgrades[id].Equal(p.Upgrade.FinishedAt) {
+			continue
+		}
+		ev := Event{Event: EventUpgradeFinished, At: now, Upgrade: p.Upgrade}
+		if host, ok := byID[id]; ok {
+			ev.Host = HostOf(host)
+		} else {
+			ev.Host = &Host{ID: id}
+		}
+		events = append(events, ev)
+	}
+
+	w.health, w.upgrades, w.primed = health, upgrades, true
+	for _, ev := range events {
+		Fire(w.store, w.logger, ev)
+	}
+}
+
+func (w *Watcher) recordIncident(host types.Host, ev hosts.IncidentEvent) {
+	name := host.Nickname
+	if name == "" {
+		name = host.IPAddress
+	}
+	if _, _, err := w.store.RecordIncidentEvent(host.ID, name+" went offline", ev); err != nil {
+		w.logger.Warning(fmt.Sprintf("Hooks: failed to record incident for %s: %v", name, err))
+	}
+}
@@ -0,0 +1,154 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrAPIKeyNotFound is returned for unknown, revoked, or expired API keys.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// APIKey is a long-lived credential for integrations. Only the SHA-256 of
+// the key is stored; Prefix is kept so admins can tell keys apart.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Role       types.Role `json:"role"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at,omitzero"`
+	LastUsedAt time.Time  `json:"last_used_at,omitzero"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	Revoked    bool       `json:"revoked,omitempty"`
+}
+
+// Expired reports whether the key has passed its expiry time.
+func (k APIKey) Expired() bool {
+	return !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt)
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, role, created_by, created_at, expires_at, last_used_at, last_used_ip, revoked`
+
+// CreateAPIKey stores a new API key, assigning an ID and creation time.
+func (s *Store) CreateAPIKey(k APIKey) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k.ID = uuid.New().String()
+	k.CreatedAt = time.Now().UTC()
+	_, err := s.db.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.Name, k.Prefix, k.Hash, string(k.Role), k.CreatedBy, formatTime(k.CreatedAt),
+		formatTime(k.ExpiresAt), nil, "", 0)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("create API key: %w", err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys returns all keys, including revoked and expired ones, newest
+// first.
+func (s *Store) ListAPIKeys() ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKey returns a key by ID, revoked and expired keys included.
+func (s *Store) GetAPIKey(id string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+// GetAPIKeyByHash returns an active key by the hash of its secret.
+func (s *Store) GetAPIKeyByHash(hash string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, err := scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = ?`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	if k.Revoked || k.Expired() {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, nil
+}
+
+// TouchAPIKey records when and from where a key was last used.
+func (s *Store) TouchAPIKey(id, ip string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, formatTime(at), ip, id); err != nil {
+		return fmt.Errorf("update API key usage: %w", err)
+	}
+	return nil
+}
+
+// RevokeAPIKey disables a key permanently. Revoked keys stay listed so
+// their history remains visible.
+func (s *Store) RevokeAPIKey(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`UPDATE api_keys SET revoked = 1 WHERE id = ?`, id)
+	if err != nil {
+		return APIKey{}, fmt.Errorf("revoke API key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+}
+
+func scanAPIKey(scanner interface{ Scan(dest ...any) error }) (APIKey, error) {
+	var (
+		k                                APIKey
+		role                             string
+		createdBy, lastUsedIP            sql.NullString
+		createdAt, expiresAt, lastUsedAt sql.NullString
+		revoked                          int
+	)
+	if err := scanner.Scan(&k.ID, &k.Name, &k.Prefix, &k.Hash, &role, &createdBy, &createdAt, &expiresAt, &lastUsedAt, &lastUsedIP, &revoked); err != nil {
+		return APIKey{}, err
+	}
+	k.Role = types.Role(role)
+	k.CreatedBy = createdBy.String
+	k.CreatedAt = parseTime(createdAt.String)
+	k.ExpiresAt = parseTime(expiresAt.String)
+	k.LastUsedAt = parseTime(lastUsedAt.String)
+	k.LastUsedIP = lastUsedIP.String
+	k.Revoked = revoked != 0
+	return k, nil
+}
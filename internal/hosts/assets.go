@@ -0,0 +1,190 @@
+package hosts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/playlist"
+)
+
+// AuditAssetsChanged is the audit action recorded when a host's asset list
+// changes between two checks.
+const AuditAssetsChanged = "host.assets_changed"
+
+// assetList is the last asset list read from a host's CMS, with the
+// validators to ask for it conditionally next time.
+type assetList struct {
+	validators cms.Validators
+	hash       string
+	assets     []playlist.Asset
+}
+
+// assetCache holds each host's asset list by host ID. The LAN and VPN
+// checks reach the same Anthias, so they share an entry. It is kept in
+// memory: after a restart the first read of each host sets a new baseline.
+type assetCache struct {
+	mu     sync.Mutex
+	byHost map[string]assetList
+}
+
+// AssetChange is a difference between two asset lists read from a host.
+// Assets are named by their name, or ID when they have none.
+type AssetChange struct {
+	HostID   string
+	At       time.Time
+	Count    int // Assets now
+	Previous int // Assets before
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// fetchAssets reads the asset list of the CMS at ip through c, for the
+// host with id. When the last read left validators, such as an Anthias
+// ETag, the request is conditional and an unchanged list comes from the
+// cache.
+func (s *Store) fetchAssets(c cms.Client, id, ip string) ([]playlist.Asset, error) {
+	cached, haveCached := s.cachedAssets(id)
+	assets, validators, err := c.Assets(ip, cached.validators)
+	if errors.Is(err, cms.ErrNotModified) && haveCached {
+		return cached.assets, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cacheAssets(id, validators, assets, time.Now())
+	return assets, nil
+}
+
+func (s *Store) cachedAssets(id string) (assetList, bool) {
+	if id == "" {
+		return assetList{}, false
+	}
+	s.assets.mu.Lock()
+	defer s.assets.mu.Unlock()
+	list, ok := s.assets.byHost[id]
+	return list, ok
+}
+
+// CachedAssets returns the asset list last read from the host with id, and
+// false before the first read since NSM started.
+func (s *Store) CachedAssets(id string) ([]playlist.Asset, bool) {
+	list, ok := s.cachedAssets(id)
+	return list.assets, ok
+}
+
+// RecordAssets stores assets as the list just read from the host with id
+// by something other than a health check, such as a re-apply, so change
+// and drift tracking see it at once.
+func (s *Store) RecordAssets(id string, assets []playlist.Asset, at time.Time) {
+	s.cacheAssets(id, cms.Validators{}, assets, at)
+}
+
+// cacheAssets stores the list read from the host with id. When it differs
+// from the one before, the change is written to the audit log first, so a
+// change that cannot be written is found again on the next read. The list
+// is then compared with the host's baseline.
+func (s *Store) cacheAssets(id string, validators cms.Validators, assets []playlist.Asset, at time.Time) {
+	if id == "" {
+		return
+	}
+	list := assetList{
+		validators: validators,
+		hash:       hashAssets(assets),
+		assets:     assets,
+	}
+
+	prev, ok := s.cachedAssets(id)
+	if ok && prev.hash != list.hash {
+		change := diffAssets(prev.assets, assets)
+		change.HostID, change.At = id, at
+		if err := s.logAssetChange(change); err != nil {
+			return
+		}
+	}
+
+	s.assets.mu.Lock()
+	s.assets.byHost[id] = list
+	s.assets.mu.Unlock()
+
+	if !ok || prev.hash != list.hash {
+		s.compareBaseline(id, assets, at)
+	}
+}
+
+// hashAssets identifies a list by its content, regardless of order.
+func hashAssets(assets []playlist.Asset) string {
+	sorted := slices.Clone(assets)
+	slices.SortFunc(sorted, func(a, b playlist.Asset) int { return strings.Compare(a.ID, b.ID) })
+	data, _ := json.Marshal(sorted)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func diffAssets(before, after []playlist.Asset) AssetChange {
+	change := AssetChange{Count: len(after), Previous: len(before)}
+	old := make(map[string]playlist.Asset, len(before))
+	for _, a := range before {
+		old[a.ID] = a
+	}
+	for _, a := range after {
+		prev, ok := old[a.ID]
+		switch {
+		case !ok:
+			change.Added = append(change.Added, assetLabel(a))
+		case !prev.Equal(a):
+			change.Modified = append(change.Modified, assetLabel(a))
+		}
+		delete(old, a.ID)
+	}
+	for _, a := range before {
+		if _, ok := old[a.ID]; ok {
+			change.Removed = append(change.Removed, assetLabel(a))
+		}
+	}
+	return change
+}
+
+func assetLabel(a playlist.Asset) string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return a.ID
+}
+
+// Detail summarises the change for the audit log, e.g.
+// "12 assets (was 11); added: Lunch menu".
+func (c AssetChange) Detail() string {
+	parts := []string{fmt.Sprintf("%d assets (was %d)", c.Count, c.Previous)}
+	for _, group := range []struct {
+		verb  string
+		names []string
+	}{{"added", c.Added}, {"removed", c.Removed}, {"changed", c.Modified}} {
+		if len(group.names) > 0 {
+			parts = append(parts, group.verb+": "+listNames(group.names, 5))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// listNames joins up to limit names and counts the rest.
+func listNames(names []string, limit int) string {
+	if len(names) <= limit {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:limit], ", "), len(names)-limit)
+}
+
+// logAssetChange records c in the audit log.
+func (s *Store) logAssetChange(c AssetChange) error {
+	return s.AppendAudit(AuditEntry{Time: c.At.UTC(), Actor: "nsm", ActorType: ActorSystem, Action: AuditAssetsChanged,
+		Target: c.HostID, Detail: c.Detail()})
+}
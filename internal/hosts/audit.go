@@ -0,0 +1,331 @@
+package hosts
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Audit actor types.
+const (
+	ActorUser      = "user"
+	ActorAPIKey    = "api_key"
+	ActorAnonymous = "anonymous"
+	ActorSystem    = "system"
+	ActorTrigger   = "trigger" // An inbound webhook, named by its trigger
+	ActorPeer      = "peer"    // Another node, for requests it signed with its node key
+)
+
+// AuditEntry records who did what, and from where. Entries form a hash
+// chain: each carries the hash of the previous entry and a signature of its
+// own hash by the node identity, so edits, deletions, and reordering are
+// detectable in an export.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Time       time.Time `json:"time"`
+	Actor      string    `json:"actor"`
+	ActorType  string    `json:"actor_type"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	PrevHash   string    `json:"prev_hash,omitempty"`
+	Hash       string    `json:"hash,omitempty"`
+	Signature  string    `json:"signature,omitempty"`
+}
+
+// AuditSigner signs audit entry hashes. *identity.Identity implements it.
+type AuditSigner interface {
+	Sign(msg []byte) []byte
+}
+
+// SetAuditSigner sets the key used to sign new audit entries. Without one,
+// entries are still chained but unsigned.
+func (s *Store) SetAuditSigner(signer AuditSigner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditSigner = signer
+}
+
+// computeHash returns the hex SHA-256 of the entry's canonical encoding,
+// which covers every field except Hash and Signature.
+func (e AuditEntry) computeHash() string {
+	canonical, _ := json.Marshal(struct {
+		ID         int64  `json:"id"`
+		Time       string `json:"time"`
+		Actor      string `json:"actor"`
+		ActorType  string `json:"actor_type"`
+		Action     string `json:"action"`
+		Target     string `json:"target"`
+		Detail     string `json:"detail"`
+		RemoteAddr string `json:"remote_addr"`
+		PrevHash   string `json:"prev_hash"`
+	}{e.ID, e.Time.UTC().Format(time.RFC3339Nano), e.Actor, e.ActorType, e.Action, e.Target, e.Detail, e.RemoteAddr, e.PrevHash})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditQuery filters ListAudit. Zero values match everything; Limit
+// defaults to 100.
+type AuditQuery struct {
+	Actor  string
+	Action string
+	Text   string // Found anywhere in the actor, action, target or detail, ignoring case
+	Since  time.Time
+	Limit  int
+}
+
+// AppendAudit adds an entry to the end of the audit chain.
+func (s *Store) AppendAudit(e AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	var prevHash sql.NullString
+	err := s.db.QueryRow(`SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1`).Scan(&e.ID, &prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("read audit chain head: %w", err)
+	}
+	e.ID++
+	e.PrevHash = prevHash.String
+	e.Hash = e.computeHash()
+	if s.auditSigner != nil {
+		e.Signature = base64.StdEncoding.EncodeToString(s.auditSigner.Sign([]byte(e.Hash)))
+	}
+
+	// The hash covers the plain entry, so the chain verifies once opened.
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	key := strconv.FormatInt(e.ID, 10)
+	detail, err := seal.seal(fieldAuditDetail, key, e.Detail)
+	if err != nil {
+		return err
+	}
+	remoteAddr, err := seal.seal(fieldAuditAddr, key, e.RemoteAddr)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT INTO audit_log (id, at, actor, actor_type, action, target, detail, remote_addr, prev_hash, hash, signature)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, formatTime(e.Time), e.Actor, e.ActorType, e.Action, e.Target, detail, remoteAddr,
+		e.PrevHash, e.Hash, e.Signature)
+	if err != nil {
+		return fmt.Errorf("append audit entry: %w", err)
+	}
+	return nil
+}
+
+const auditColumns = `id, at, actor, actor_type, action, target, detail, remote_addr, prev_hash, hash, signature`
+
+// ListAudit returns matching audit entries, newest first. While
+// encryption is on, details are sealed, so Text is matched here rather
+// than in SQL.
+func (s *Store) ListAudit(q AuditQuery) ([]AuditEntry, error) {
+	s.mu.RLock()
+	encrypted, err := s.encryptedLocked()
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE 1 = 1`
+	var args []any
+	if q.Actor != "" {
+		query += ` AND actor = ?`
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		query += ` AND action LIKE ?`
+		args = append(args, q.Action+"%")
+	}
+	if q.Text != "" && !encrypted {
+		query += ` AND instr(lower(actor || ' ' || action || ' ' || target || ' ' || detail), lower(?)) > 0`
+		args = append(args, q.Text)
+	}
+	if !q.Since.IsZero() {
+		query += ` AND at >= ?`
+		args = append(args, formatTime(q.Since))
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	query += ` ORDER BY id DESC`
+	if q.Text == "" || !encrypted {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	entries, err := s.queryAudit(query, args...)
+	if err != nil || q.Text == "" || !encrypted {
+		return entries, err
+	}
+	text := strings.ToLower(q.Text)
+	matched := []AuditEntry{}
+	for _, e := range entries {
+		if strings.Contains(strings.ToLower(e.Actor+" "+e.Action+" "+e.Target+" "+e.Detail), text) {
+			matched = append(matched, e)
+			if len(matched) == q.Limit {
+				break
+			}
+		}
+	}
+	return matched, nil
+}
+
+// AuditRange returns every entry recorded in [since, until), oldest first,
+// for export. Zero times leave that end open. Filters are not offered here
+// because verification needs a contiguous run of the chain.
+func (s *Store) AuditRange(since, until time.Time) ([]AuditEntry, error) {
+	query := `SELECT ` + auditColumns + ` FROM audit_log WHERE 1 = 1`
+	var args []any
+	if !since.IsZero() {
+		query += ` AND at >= ?`
+		args = append(args, formatTime(since))
+	}
+	if !until.IsZero() {
+		query += ` AND at < ?`
+		args = append(args, formatTime(until))
+	}
+	query += ` ORDER BY id`
+
+	return s.queryAudit(query, args...)
+}
+
+func (s *Store) queryAudit(query string, args ...any) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var (
+			e                          AuditEntry
+			at                         string
+			target, detail, remoteAddr sql.NullString
+			prevHash, hash, signature  sql.NullString
+		)
+		if err := rows.Scan(&e.ID, &at, &e.Actor, &e.ActorType, &e.Action, &target, &detail, &remoteAddr, &prevHash, &hash, &signature); err != nil {
+			return nil, err
+		}
+		e.Time = parseTime(at)
+		e.Target = target.String
+		key := strconv.FormatInt(e.ID, 10)
+		e.Detail, _ = openField(s.sealer, fieldAuditDetail, key, detail.String)
+		e.RemoteAddr, _ = openField(s.sealer, fieldAuditAddr, key, remoteAddr.String)
+		e.PrevHash = prevHash.String
+		e.Hash = hash.String
+		e.Signature = signature.String
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// AuditBundle is a self-contained, verifiable export of part of the audit
+// chain. Signature covers the node ID, export time, and the hash of the
+// last entry, so dropping entries from the end is also detected.
+type AuditBundle struct {
+	NodeID      string       `json:"node_id,omitempty"`
+	PublicKey   string       `json:"public_key"`
+	Fingerprint string       `json:"fingerprint"`
+	ExportedAt  time.Time    `json:"exported_at"`
+	Entries     []AuditEntry `json:"entries"`
+	Signature   string       `json:"signature"`
+}
+
+// SigningInput returns the bytes signed for the bundle as a whole.
+func (b AuditBundle) SigningInput() []byte {
+	var headID int64
+	var headHash string
+	if n := len(b.Entries); n > 0 {
+		headID, headHash = b.Entries[n-1].ID, b.Entries[n-1].Hash
+	}
+	return fmt.Appendf(nil, "nsm-audit-export|%s|%s|%d|%s",
+		b.NodeID, b.ExportedAt.UTC().Format(time.RFC3339Nano), headID, headHash)
+}
+
+// AuditVerification summarises a successful bundle check.
+type AuditVerification struct {
+	Entries  int   `json:"entries"`
+	Unsigned int   `json:"unsigned"` // Entries recorded before chaining existed
+	FirstID  int64 `json:"first_id"`
+	LastID   int64 `json:"last_id"`
+}
+
+// Verify checks every entry hash, signature, and chain link, and the bundle
+// signature. Entries from before chaining was introduced carry no hash;
+// they are tolerated only at the start of the bundle and counted as
+// unsigned.
+func (b AuditBundle) Verify() (AuditVerification, error) {
+	var result AuditVerification
+
+	raw, err := base64.StdEncoding.DecodeString(b.PublicKey)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return result, errors.New("invalid public key")
+	}
+	pub := ed25519.PublicKey(raw)
+	if b.Fingerprint != identity.Fingerprint(pub) {
+		return result, errors.New("fingerprint does not match public key")
+	}
+
+	var prev *AuditEntry
+	for i := range b.Entries {
+		e := b.Entries[i]
+		if prev != nil && e.ID != prev.ID+1 {
+			return result, fmt.Errorf("entries missing between %d and %d", prev.ID, e.ID)
+		}
+
+		if e.Hash == "" {
+			if prev != nil && prev.Hash != "" {
+				return result, fmt.Errorf("entry %d is not chained", e.ID)
+			}
+			result.Unsigned++
+			prev = &b.Entries[i]
+			continue
+		}
+
+		if e.computeHash() != e.Hash {
+			return result, fmt.Errorf("entry %d has been modified", e.ID)
+		}
+		if prev != nil && e.PrevHash != prev.Hash {
+			return result, fmt.Errorf("entry %d does not follow entry %d", e.ID, prev.ID)
+		}
+		sig, err := base64.StdEncoding.DecodeString(e.Signature)
+		if err != nil || !ed25519.Verify(pub, []byte(e.Hash), sig) {
+			return result, fmt.Errorf("entry %d has an invalid signature", e.ID)
+		}
+		prev = &b.Entries[i]
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(b.Signature)
+	if err != nil || !ed25519.Verify(pub, b.SigningInput(), sig) {
+		return result, errors.New("bundle signature is invalid")
+	}
+
+	result.Entries = len(b.Entries)
+	if result.Entries > 0 {
+		result.FirstID = b.Entries[0].ID
+		result.LastID = b.Entries[result.Entries-1].ID
+	}
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package hosts
+
+import (
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// HostStore is the host list as the store persists it: reads, edits and
+// change notification, without the health checks and caches a Store also
+// keeps. Components that need nothing else of the store take a HostStore.
+//
+// Implementations are safe for concurrent use, stamp field versions on
+// local edits, and signal Updates after every change.
+type HostStore interface {
+	// Updates receives a value whenever the host list changes.
+	Updates() <-chan struct{}
+	// LastModified reports when the host list last changed.
+	LastModified() time.Time
+
+	// GetAll returns all hosts ordered by IP address.
+	GetAll() []types.Host
+	// GetByID and GetByIP return one host, or an error if there is none.
+	GetByID(id string) (*types.Host, error)
+	GetByIP(ip string) (*types.Host, error)
+
+	// Add inserts a new host, giving it an ID if it has none.
+	Add(host types.Host) error
+	// Update applies updater to the host at ip.
+	Update(ip string, updater func(*types.Host)) error
+	// Upsert inserts or replaces a host by ID.
+	Upsert(host types.Host) error
+	// Delete removes the hosts at ip, DeleteByID one host.
+	Delete(ip string) error
+	DeleteByID(id string) error
+	// ReplaceAll replaces the whole host list at once.
+	ReplaceAll(hosts []types.Host) error
+}
+
+// SettingStore is the store's settings: JSON values by key. The packages
+// that load and save their configuration there take a SettingStore.
+type SettingStore interface {
+	// GetSetting decodes the value under key into v, reporting false if
+	// the key was never set.
+	GetSetting(key string, v any) (bool, error)
+	// PutSetting stores v under key.
+	PutSetting(key string, v any) error
+}
+
+var (
+	_ HostStore    = (*Store)(nil)
+	_ SettingStore = (*Store)(nil)
+)
@@ -0,0 +1,82 @@
+package hosts
+
+import (
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Backoff for hosts that fail health checks. Each failed check in a row
+// doubles the time the sweep leaves a host alone, so a dead IP stops
+// costing a full dial timeout on every sweep.
+const (
+	backoffBase = 30 * time.Second
+	backoffMax  = 15 * time.Minute
+)
+
+// failureState counts a host's failed checks in a row.
+type failureState struct {
+	failures int
+	next     time.Time // Sweeps skip the host until then
+}
+
+// failureLog is this node's own view, like network quality, kept in
+// memory only; after a restart every host is checked again.
+type failureLog struct {
+	mu      sync.Mutex
+	entries map[string]failureState
+}
+
+// backoffDelay is how long to wait after n failed checks in a row.
+func backoffDelay(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	d := backoffBase
+	for i := 1; i < n && d < backoffMax; i++ {
+		d *= 2
+	}
+	return min(d, backoffMax)
+}
+
+// record counts a check that could not reach host on any network as a
+// failure, and clears the count otherwise.
+func (l *failureLog) record(host *types.Host, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if reachable(host.Status) || reachable(host.StatusVPN) {
+		delete(l.entries, host.ID)
+		return
+	}
+	st := l.entries[host.ID]
+	st.failures++
+	st.next = at.Add(backoffDelay(st.failures))
+	l.entries[host.ID] = st
+}
+
+// due reports whether a sweep at now should check the host.
+func (l *failureLog) due(hostID string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !now.Before(l.entries[hostID].next)
+}
+
+// ResetBackoff has the next sweep check a host again. It is called when
+// the host shows signs of life another way, e.g. a heartbeat or an
+// announcement.
+func (s *Store) ResetBackoff(hostID string) {
+	s.failures.mu.Lock()
+	defer s.failures.mu.Unlock()
+	delete(s.failures.entries, hostID)
+}
+
+// apply sets a host's failed-check count and when the sweep checks it
+// next. It runs on every host read.
+func (l *failureLog) apply(host *types.Host) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.entries[host.ID]
+	host.FailedChecks = st.failures
+	host.NextCheckAt = st.next
+}
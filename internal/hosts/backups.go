@@ -0,0 +1,112 @@
+package hosts
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupHost is a host as recorded in a backup, for previewing it before a
+// restore.
+type BackupHost struct {
+	ID           string    `json:"id,omitempty"`
+	Nickname     string    `json:"nickname"`
+	Hostname     string    `json:"hostname"`
+	IPAddress    string    `json:"ip_address"`
+	VPNIPAddress string    `json:"vpn_ip_address,omitempty"`
+	Status       string    `json:"status"`
+	LastChecked  time.Time `json:"last_checked,omitzero"`
+}
+
+// backupColumns are the host columns a preview shows. Backups from older
+// releases may lack some of them.
+var backupColumns = []string{"id", "nickname", "hostname", "ip_address", "vpn_ip_address", "status", "last_checked"}
+
+// openReadOnly opens the SQLite database at path without writing to it or
+// beside it, as a database that is not in use.
+func openReadOnly(path string) (*sql.DB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 16)
+	_, err = io.ReadFull(f, header)
+	f.Close()
+	if err != nil || string(header) != "SQLite format 3\x00" {
+		return nil, fmt.Errorf("%w: not a SQLite database", ErrInvalidSnapshot)
+	}
+	db, err := sql.Open("sqlite", "file:"+filepath.Clean(path)+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", filepath.Base(path), err)
+	}
+	return db, nil
+}
+
+// CountBackupHosts returns how many hosts the backup database at path holds.
+func CountBackupHosts(path string) (int, error) {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM hosts`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	return n, nil
+}
+
+// ReadBackup returns the hosts in the backup database at path, ordered by
+// IP address, without restoring it. The file is opened read-only.
+func ReadBackup(path string) ([]BackupHost, error) {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	present := make(map[string]bool)
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('hosts')`)
+	if err != nil {
+		return nil, fmt.Errorf("read backup columns: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil {
+			present[name] = true
+		}
+	}
+	rows.Close()
+	if len(present) == 0 {
+		return nil, fmt.Errorf("%w: no host list", ErrInvalidSnapshot)
+	}
+
+	exprs := make([]string, len(backupColumns))
+	for i, col := range backupColumns {
+		exprs[i] = "''"
+		if present[col] {
+			exprs[i] = "COALESCE(" + col + ", '')"
+		}
+	}
+	rows, err = db.Query(`SELECT ` + strings.Join(exprs, ", ") + ` FROM hosts ORDER BY ip_address`)
+	if err != nil {
+		return nil, fmt.Errorf("read backup hosts: %w", err)
+	}
+	defer rows.Close()
+
+	list := []BackupHost{}
+	for rows.Next() {
+		var h BackupHost
+		var lastChecked string
+		if err := rows.Scan(&h.ID, &h.Nickname, &h.Hostname, &h.IPAddress, &h.VPNIPAddress, &h.Status, &lastChecked); err != nil {
+			return nil, fmt.Errorf("read backup hosts: %w", err)
+		}
+		h.LastChecked = parseTime(lastChecked)
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,147 @@
+package hosts
+
+import (
+	"fmt"
+	"time"
+)
+
+// eMMC pre-EOL states: how much of the reserved blocks that replace worn
+// ones is used up.
+const (
+	PreEOLNormal  = "normal"
+	PreEOLWarning = "warning" // 80% of the reserved blocks used
+	PreEOLUrgent  = "urgent"  // 90% used
+)
+
+// cardSampleInterval is how often an unchanged reading is sampled, so the
+// trend shows the card was still being watched.
+const cardSampleInterval = 24 * time.Hour
+
+// cardHistoryLimit is how long card health samples are kept.
+const cardHistoryLimit = 365 * 24 * time.Hour
+
+// CardHealth is the state of the SD card or eMMC a node boots from, as the
+// node reports it in its heartbeats. SD cards do not report wear, so their
+// health shows only through filesystem errors and a read-only root.
+type CardHealth struct {
+	At       time.Time `json:"at,omitzero"`         // When the receiver sampled it
+	LifeUsed int       `json:"life_used,omitempty"` // eMMC estimate of rated life used, in percent in steps of 10; 110 once exceeded, 0 if unknown
+	PreEOL   string    `json:"pre_eol,omitempty"`   // eMMC reserved block state (PreEOLNormal ...), empty if unknown
+	FSErrors int       `json:"fs_errors"`           // Errors ext4 has recorded on the root filesystem since it was last checked
+	ReadOnly bool      `json:"read_only,omitempty"` // The root filesystem is mounted read-only, as ext4 does after errors
+}
+
+// same reports whether c and o are the same reading, ignoring when they
+// were taken.
+func (c CardHealth) same(o CardHealth) bool {
+	c.At, o.At = time.Time{}, time.Time{}
+	return c == o
+}
+
+// Problems lists the signs that the card is failing or wearing out, with
+// lifeThreshold the percent of rated life used that counts as worn.
+func (c CardHealth) Problems(lifeThreshold int) []string {
+	var out []string
+	if c.ReadOnly {
+		out = append(out, "root filesystem is read-only")
+	}
+	if c.FSErrors > 0 {
+		out = append(out, fmt.Sprintf("%d filesystem errors", c.FSErrors))
+	}
+	switch c.PreEOL {
+	case PreEOLWarning, PreEOLUrgent:
+		out = append(out, "reserved blocks "+c.PreEOL)
+	}
+	if c.LifeUsed > 100 {
+		out = append(out, "rated life exceeded")
+	} else if c.LifeUsed >= lifeThreshold && lifeThreshold > 0 {
+		out = append(out, fmt.Sprintf("up to %d%% of rated life used", c.LifeUsed))
+	}
+	return out
+}
+
+const cardHealthColumns = `at, life_used, pre_eol, fs_errors, read_only`
+
+// sortableTime formats times with a fixed width, so they sort as text.
+func sortableTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000000Z")
+}
+
+// RecordCardHealth adds c, reported by nodeID at now, to the node's trend
+// when it differs from the last sample or that sample is a day old.
+func (s *Store) RecordCardHealth(nodeID string, c CardHealth, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c.At = now
+	var last CardHealth
+	var at string
+	err := s.db.QueryRow(`SELECT `+cardHealthColumns+` FROM card_health WHERE node_id = ? ORDER BY at DESC LIMIT 1`, nodeID).
+		Scan(&at, &last.LifeUsed, &last.PreEOL, &last.FSErrors, &last.ReadOnly)
+	if err == nil && c.same(last) && now.Sub(parseTime(at)) < cardSampleInterval {
+		return nil
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO card_health (node_id, `+cardHealthColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		nodeID, sortableTime(now), c.LifeUsed, c.PreEOL, c.FSErrors, c.ReadOnly); err != nil {
+		return fmt.Errorf("record card health: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM card_health WHERE node_id = ? AND at < ?`, nodeID, sortableTime(now.Add(-cardHistoryLimit))); err != nil {
+		return fmt.Errorf("prune card health: %w", err)
+	}
+	return nil
+}
+
+// CardHealthHistory returns nodeID's card health samples, oldest first.
+func (s *Store) CardHealthHistory(nodeID string) ([]CardHealth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT `+cardHealthColumns+` FROM card_health WHERE node_id = ? ORDER BY at`, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("list card health: %w", err)
+	}
+	defer rows.Close()
+
+	out := []CardHealth{}
+	for rows.Next() {
+		var (
+			c  CardHealth
+			at string
+		)
+		if err := rows.Scan(&at, &c.LifeUsed, &c.PreEOL, &c.FSErrors, &c.ReadOnly); err != nil {
+			return nil, err
+		}
+		c.At = parseTime(at)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// LatestCardHealth returns the last card health sample of every node that
+// has reported one, by node ID.
+func (s *Store) LatestCardHealth() (map[string]CardHealth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT node_id, ` + cardHealthColumns + ` FROM card_health c
+		WHERE at = (SELECT MAX(at) FROM card_health WHERE node_id = c.node_id)`)
+	if err != nil {
+		return nil, fmt.Errorf("list card health: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]CardHealth)
+	for rows.Next() {
+		var (
+			id, at string
+			c      CardHealth
+		)
+		if err := rows.Scan(&id, &at, &c.LifeUsed, &c.PreEOL, &c.FSErrors, &c.ReadOnly); err != nil {
+			return nil, err
+		}
+		c.At = parseTime(at)
+		out[id] = c
+	}
+	return out, rows.Err()
+}
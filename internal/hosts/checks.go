@@ -0,0 +1,156 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CheckSettingKey is the settings key holding the CheckConfig.
+const CheckSettingKey = "health_checks"
+
+// Probe names an optional part of a health check. The TCP connect to port
+// 8080 always runs, as reachability is judged by it.
+type Probe string
+
+// Probes that can be turned off.
+const (
+	ProbeVersion Probe = "version" // GET /api/version: NSM version, hostname and clock
+	ProbeHealth  Probe = "health"  // GET /api/health
+	ProbeAnthias Probe = "anthias" // Anthias CMS info and asset list on port 80
+)
+
+// Probes lists every optional probe, in the order a check runs them.
+var Probes = []Probe{ProbeAnthias, ProbeVersion, ProbeHealth}
+
+// DefaultCheckTimeout bounds each probe unless configured otherwise.
+const DefaultCheckTimeout = 3 * time.Second
+
+// Limits on a configured timeout.
+const (
+	minCheckTimeoutMS = 100
+	maxCheckTimeoutMS = 60_000
+)
+
+// ProbeSet is how a host is checked.
+type ProbeSet struct {
+	TimeoutMS int     `json:"timeout_ms,omitempty"` // Per probe; 0 uses the global timeout, or DefaultCheckTimeout
+	Disabled  []Probe `json:"disabled,omitempty"`   // For a host, replaces the global list when present, even if empty
+}
+
+// CheckConfig holds the global probe set and per-host overrides, keyed by
+// host ID.
+type CheckConfig struct {
+	ProbeSet
+	Hosts map[string]ProbeSet `json:"hosts,omitempty"`
+}
+
+// Validate rejects unusable values.
+func (c *CheckConfig) Validate() error {
+	if err := c.ProbeSet.validate(); err != nil {
+		return err
+	}
+	for id, p := range c.Hosts {
+		if id == "" {
+			return errors.New("host override without a host ID")
+		}
+		if err := p.validate(); err != nil {
+			return fmt.Errorf("host %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (p ProbeSet) validate() error {
+	if p.TimeoutMS != 0 && (p.TimeoutMS < minCheckTimeoutMS || p.TimeoutMS > maxCheckTimeoutMS) {
+		return fmt.Errorf("timeout_ms must be between %d and %d", minCheckTimeoutMS, maxCheckTimeoutMS)
+	}
+	for _, probe := range p.Disabled {
+		if !validProbe(probe) {
+			return fmt.Errorf("unknown probe %q (use version, health or anthias)", probe)
+		}
+	}
+	return nil
+}
+
+func validProbe(p Probe) bool {
+	for _, known := range Probes {
+		if known == p {
+			return true
+		}
+	}
+	return false
+}
+
+// probePlan is the resolved probe set for one host.
+type probePlan struct {
+	timeout  time.Duration
+	disabled map[Probe]bool
+}
+
+func (p probePlan) enabled(probe Probe) bool {
+	return !p.disabled[probe]
+}
+
+// activeChecks is the configuration health checks run with, applied on
+// load and save so checks need not read it from the database each time.
+type activeChecks struct {
+	mu  sync.RWMutex
+	cfg CheckConfig
+}
+
+// ApplyCheckConfig makes cfg the configuration for checks from now on.
+func (s *Store) ApplyCheckConfig(cfg CheckConfig) {
+	s.checks.mu.Lock()
+	defer s.checks.mu.Unlock()
+	s.checks.cfg = cfg
+}
+
+// planFor resolves how to check the host with id.
+func (s *Store) planFor(id string) probePlan {
+	s.checks.mu.RLock()
+	defer s.checks.mu.RUnlock()
+
+	set := s.checks.cfg.ProbeSet
+	if override, ok := s.checks.cfg.Hosts[id]; ok {
+		if override.TimeoutMS != 0 {
+			set.TimeoutMS = override.TimeoutMS
+		}
+		if override.Disabled != nil {
+			set.Disabled = override.Disabled
+		}
+	}
+
+	plan := probePlan{timeout: DefaultCheckTimeout, disabled: make(map[Probe]bool)}
+	if set.TimeoutMS != 0 {
+		plan.timeout = time.Duration(set.TimeoutMS) * time.Millisecond
+	}
+	for _, p := range set.Disabled {
+		plan.disabled[p] = true
+	}
+	return plan
+}
+
+// CheckConfig reads the health-check configuration; every probe runs with
+// DefaultCheckTimeout by default.
+func (s *Store) CheckConfig() (CheckConfig, error) {
+	var cfg CheckConfig
+	if _, err := s.GetSetting(CheckSettingKey, &cfg); err != nil {
+		return CheckConfig{}, err
+	}
+	return cfg, nil
+}
+
+// SaveCheckConfig validates, stores and applies the health-check
+// configuration.
+func (s *Store) SaveCheckConfig(cfg CheckConfig) (CheckConfig, error) {
+	if err := cfg.Validate(); err != nil {
+		return CheckConfig{}, err
+	}
+	if err := s.PutSetting(CheckSettingKey, cfg); err != nil {
+		return CheckConfig{}, err
+	}
+	s.ApplyCheckConfig(cfg)
+	return cfg, nil
+}
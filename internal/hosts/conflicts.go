@@ -0,0 +1,220 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrConflictNotFound is returned when resolving a conflict that no longer
+// exists, typically because it was already resolved.
+var ErrConflictNotFound = errors.New("conflict not found")
+
+// ErrInvalidResolution is returned when an action does not apply to a
+// conflict.
+var ErrInvalidResolution = errors.New("invalid resolution")
+
+// ConflictKind names what two host records disagree about.
+type ConflictKind string
+
+const (
+	ConflictIP       ConflictKind = "ip"       // Two hosts claim one LAN IP, directly or through a DNS name
+	ConflictID       ConflictKind = "id"       // A node's heartbeats come from an IP other than its record's
+	ConflictHostname ConflictKind = "hostname" // Two hosts report one hostname
+)
+
+// ConflictAction is a way of resolving a conflict.
+type ConflictAction string
+
+const (
+	// ActionKeep keeps one host of the conflict and deletes the others.
+	ActionKeep ConflictAction = "keep"
+	// ActionReaddress moves a host to the address its heartbeats come from,
+	// replacing any other record there, as discovery does for stale hosts.
+	ActionReaddress ConflictAction = "readdress"
+)
+
+// conflictPeerMaxAge is how recent a heartbeat must be for its address to
+// count. An older one says nothing about where the node is now.
+const conflictPeerMaxAge = time.Hour
+
+// ConflictHost identifies a host taking part in a conflict.
+type ConflictHost struct {
+	ID           string `json:"id"`
+	Nickname     string `json:"nickname,omitempty"`
+	Hostname     string `json:"hostname,omitempty"`
+	IPAddress    string `json:"ip_address"`
+	VPNIPAddress string `json:"vpn_ip_address,omitempty"`
+}
+
+// Conflict is one inconsistency in the host list.
+type Conflict struct {
+	Key     string           `json:"key"` // Kind and Value, stable for as long as the conflict lasts
+	Kind    ConflictKind     `json:"kind"`
+	Value   string           `json:"value"`             // The IP, node ID or hostname in contention
+	Address string           `json:"address,omitempty"` // For ID conflicts, where the heartbeats come from
+	Message string           `json:"message"`
+	Hosts   []ConflictHost   `json:"hosts"`
+	Actions []ConflictAction `json:"actions"`
+}
+
+// Involves reports whether the host with id takes part in c.
+func (c Conflict) Involves(id string) bool {
+	return slices.ContainsFunc(c.Hosts, func(h ConflictHost) bool { return h.ID == id })
+}
+
+// CanKeep reports whether c can be resolved by keeping one of its hosts.
+func (c Conflict) CanKeep() bool {
+	return slices.Contains(c.Actions, ActionKeep)
+}
+
+func conflictHost(h types.Host) ConflictHost {
+	return ConflictHost{ID: h.ID, Nickname: h.Nickname, Hostname: h.Hostname, IPAddress: h.IPAddress, VPNIPAddress: h.VPNIPAddress}
+}
+
+// namedHostname reports whether a hostname identifies a machine. Nodes that
+// could not read theirs report one of the placeholders.
+func namedHostname(name string) bool {
+	return name != "" && name != "localhost" && name != "unknown"
+}
+
+// FindConflicts checks a host list against the heartbeat state of its
+// nodes, ordered by kind and value.
+func FindConflicts(list []types.Host, peers []Peer, now time.Time) []Conflict {
+	out := []Conflict{}
+
+	byIP := make(map[string][]types.Host)
+	byName := make(map[string][]types.Host)
+	byID := make(map[string]types.Host)
+	for _, h := range list {
+		byIP[h.IPAddress] = append(byIP[h.IPAddress], h)
+		// A host listed by name also claims the IP the name resolves to.
+		if h.ResolvedIP != "" && h.ResolvedIP != h.IPAddress {
+			byIP[h.ResolvedIP] = append(byIP[h.ResolvedIP], h)
+		}
+		if namedHostname(h.Hostname) {
+			byName[h.Hostname] = append(byName[h.Hostname], h)
+		}
+		byID[h.ID] = h
+	}
+
+	group := func(kind ConflictKind, value, message string, hs []types.Host) {
+		c := Conflict{Key: string(kind) + ":" + value, Kind: kind, Value: value, Message: message, Actions: []ConflictAction{ActionKeep}}
+		for _, h := range hs {
+			c.Hosts = append(c.Hosts, conflictHost(h))
+		}
+		out = append(out, c)
+	}
+	for ip, hs := range byIP {
+		if ip != "" && len(hs) > 1 {
+			group(ConflictIP, ip, fmt.Sprintf("%d hosts have the IP %s", len(hs), ip), hs)
+		}
+	}
+	for name, hs := range byName {
+		if len(hs) > 1 {
+			group(ConflictHostname, name, fmt.Sprintf("%d hosts report the hostname %s", len(hs), name), hs)
+		}
+	}
+
+	for _, p := range peers {
+		h, ok := byID[p.NodeID]
+		if !ok || p.Address == "" || now.Sub(p.LastSeen) > conflictPeerMaxAge {
+			continue
+		}
+		if ip := net.ParseIP(p.Address); ip == nil || ip.IsLoopback() {
+			continue
+		}
+		if p.Address == h.IPAddress || p.Address == h.VPNIPAddress ||
+			p.Address == h.ResolvedIP || p.Address == h.ResolvedVPNIP {
+			continue
+		}
+		c := Conflict{
+			Key:     string(ConflictID) + ":" + p.NodeID,
+			Kind:    ConflictID,
+			Value:   p.NodeID,
+			Address: p.Address,
+			Message: fmt.Sprintf("%s is listed at %s but its heartbeats come from %s", displayName(h), h.IPAddress, p.Address),
+			Hosts:   []ConflictHost{conflictHost(h)},
+			Actions: []ConflictAction{ActionReaddress},
+		}
+		for _, other := range byIP[p.Address] {
+			c.Hosts = append(c.Hosts, conflictHost(other))
+		}
+		if len(c.Hosts) > 1 {
+			c.Message += ", where another host is listed"
+		}
+		out = append(out, c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind > out[j].Kind // ip, then id, then hostname
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+func displayName(h types.Host) string {
+	if h.Nickname != "" {
+		return h.Nickname
+	}
+	if h.Hostname != "" {
+		return h.Hostname
+	}
+	return h.ID
+}
+
+// Conflicts returns the conflicts in the host list.
+func (s *Store) Conflicts() ([]Conflict, error) {
+	peers, err := s.ListPeers()
+	if err != nil {
+		return nil, err
+	}
+	return FindConflicts(s.GetAll(), peers, time.Now()), nil
+}
+
+// ResolveConflict applies action to the conflict with key. Keep needs the
+// ID of the host to keep; readdress moves the conflict's node.
+func (s *Store) ResolveConflict(key string, action ConflictAction, hostID string) error {
+	conflicts, err := s.Conflicts()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(conflicts, func(c Conflict) bool { return c.Key == key })
+	if i < 0 {
+		return ErrConflictNotFound
+	}
+	c := conflicts[i]
+	if !slices.Contains(c.Actions, action) {
+		return fmt.Errorf("%w: %s conflicts cannot be resolved with %q", ErrInvalidResolution, c.Kind, action)
+	}
+
+	switch action {
+	case ActionKeep:
+		if !c.Involves(hostID) {
+			return fmt.Errorf("%w: host %q is not part of this conflict", ErrInvalidResolution, hostID)
+		}
+		for _, h := range c.Hosts {
+			if h.ID != hostID {
+				if err := s.DeleteByID(h.ID); err != nil {
+					return err
+				}
+			}
+		}
+	case ActionReaddress:
+		for _, h := range c.Hosts[1:] {
+			if err := s.DeleteByID(h.ID); err != nil {
+				return err
+			}
+		}
+		_, err := s.Rehome(c.Value, c.Address, "conflict resolution")
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCredentialNotFound is returned when a host has no credential of the
+// requested kind.
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// Credential is a secret attached to a host. The store only ever sees the
+// sealed form; sealing and opening happen in the vault package.
+type Credential struct {
+	HostID    string    `json:"host_id"`
+	Kind      string    `json:"kind"`
+	Username  string    `json:"username,omitempty"`
+	Sealed    []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PutCredential inserts or replaces a host credential.
+func (s *Store) PutCredential(c Credential) (Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var created sql.NullString
+	err := s.db.QueryRow(`SELECT created_at FROM host_credentials WHERE host_id = ? AND kind = ?`, c.HostID, c.Kind).Scan(&created)
+	switch {
+	case err == nil:
+		c.CreatedAt = parseTime(created.String)
+	case errors.Is(err, sql.ErrNoRows):
+		c.CreatedAt = now
+	default:
+		return Credential{}, fmt.Errorf("read credential: %w", err)
+	}
+	c.UpdatedAt = now
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO host_credentials (host_id, kind, username, sealed, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		c.HostID, c.Kind, c.Username, c.Sealed, formatTime(c.CreatedAt), formatTime(c.UpdatedAt))
+	if err != nil {
+		return Credential{}, fmt.Errorf("write credential: %w", err)
+	}
+	return c, nil
+}
+
+// GetCredential returns one credential of a host.
+func (s *Store) GetCredential(hostID, kind string) (Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, err := scanCredential(s.db.QueryRow(`SELECT host_id, kind, username, sealed, created_at, updated_at
+		FROM host_credentials WHERE host_id = ? AND kind = ?`, hostID, kind))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Credential{}, ErrCredentialNotFound
+	}
+	return c, err
+}
+
+// ListCredentials returns the credentials of a host, or of every host when
+// hostID is empty.
+func (s *Store) ListCredentials(hostID string) ([]Credential, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `SELECT host_id, kind, username, sealed, created_at, updated_at FROM host_credentials`
+	var args []any
+	if hostID != "" {
+		query += ` WHERE host_id = ?`
+		args = append(args, hostID)
+	}
+	query += ` ORDER BY host_id, kind`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list credentials: %w", err)
+	}
+	defer rows.Close()
+
+	creds := []Credential{}
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// DeleteCredential removes one credential of a host.
+func (s *Store) DeleteCredential(hostID, kind string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`DELETE FROM host_credentials WHERE host_id = ? AND kind = ?`, hostID, kind)
+	if err != nil {
+		return fmt.Errorf("delete credential: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+func scanCredential(scanner interface{ Scan(dest ...any) error }) (Credential, error) {
+	var (
+		c                    Credential
+		username             sql.NullString
+		createdAt, updatedAt sql.NullString
+	)
+	if err := scanner.Scan(&c.HostID, &c.Kind, &username, &c.Sealed, &createdAt, &updatedAt); err != nil {
+		return Credential{}, err
+	}
+	c.Username = username.String
+	c.CreatedAt = parseTime(createdAt.String)
+	c.UpdatedAt = parseTime(updatedAt.String)
+	return c, nil
+}
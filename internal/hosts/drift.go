@@ -0,0 +1,179 @@
+package hosts
+
+import (
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/playlist"
+)
+
+// AssetBaselinesSettingKey holds each host's asset baseline, by host ID.
+const AssetBaselinesSettingKey = "assets.baselines"
+
+// AuditAssetsDrifted is the audit action recorded when a host's asset list
+// stops matching its baseline, as when someone edits the playlist in the
+// Anthias dashboard instead of through NSM.
+const AuditAssetsDrifted = "host.assets_drifted"
+
+// Sources of an asset baseline.
+const (
+	BaselineFirstRead = "first_read" // The first list NSM read from the host
+	BaselineAdopted   = "adopted"    // An operator accepted the host's list as it was
+	BaselineReapplied = "reapplied"  // NSM put the baseline back on the host
+	BaselineNSM       = "nsm"        // NSM changed the list itself, e.g. published a widget
+)
+
+// AssetBaseline is the asset list a host is meant to have: the last one NSM
+// applied or an operator adopted.
+type AssetBaseline struct {
+	Assets []playlist.Asset `json:"assets"`
+	SetAt  time.Time        `json:"set_at"`
+	Source string           `json:"source"`
+}
+
+// AssetDrift is how a host's asset list differs from its baseline.
+type AssetDrift struct {
+	HostID   string    `json:"host_id"`
+	Since    time.Time `json:"since"` // When NSM first read a list that differed
+	Detail   string    `json:"detail"`
+	Added    []string  `json:"added,omitempty"`
+	Removed  []string  `json:"removed,omitempty"`
+	Modified []string  `json:"modified,omitempty"`
+	hash     string    // Of the drifted list, so an unchanged drift keeps its Since
+}
+
+// driftLog holds the hosts whose last read list differs from their
+// baseline, by host ID. Like the asset lists it is kept in memory, and the
+// first read of each host after a restart fills it in again.
+type driftLog struct {
+	mu     sync.Mutex
+	byHost map[string]AssetDrift
+}
+
+// AssetBaselines returns the stored baselines by host ID.
+func (s *Store) AssetBaselines() (map[string]AssetBaseline, error) {
+	baselines := make(map[string]AssetBaseline)
+	if _, err := s.GetSetting(AssetBaselinesSettingKey, &baselines); err != nil {
+		return nil, err
+	}
+	return baselines, nil
+}
+
+// SetAssetBaseline makes assets the baseline of the host with id and
+// compares the host's last read list with it again. Baselines of hosts no
+// longer in the list are dropped.
+func (s *Store) SetAssetBaseline(id string, assets []playlist.Asset, source string, at time.Time) error {
+	s.baselineMu.Lock()
+	err := s.putBaseline(id, func(AssetBaseline, bool) AssetBaseline {
+		return AssetBaseline{Assets: assets, SetAt: at.UTC(), Source: source}
+	})
+	s.baselineMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if current, ok := s.CachedAssets(id); ok {
+		s.compareBaseline(id, current, at)
+	}
+	return nil
+}
+
+// AddToAssetBaseline adds an asset NSM put on the host with id to its
+// baseline, so NSM's own change is not taken for drift.
+func (s *Store) AddToAssetBaseline(id string, a playlist.Asset, at time.Time) error {
+	s.baselineMu.Lock()
+	defer s.baselineMu.Unlock()
+	return s.putBaseline(id, func(b AssetBaseline, ok bool) AssetBaseline {
+		if !ok {
+			return b
+		}
+		b.Assets = append(b.Assets, a)
+		b.SetAt, b.Source = at.UTC(), BaselineNSM
+		return b
+	})
+}
+
+// putBaseline replaces the baseline of id with what update returns for the
+// stored one. The caller holds s.baselineMu.
+func (s *Store) putBaseline(id string, update func(AssetBaseline, bool) AssetBaseline) error {
+	baselines, err := s.AssetBaselines()
+	if err != nil {
+		return err
+	}
+	prev, ok := baselines[id]
+	next := update(prev, ok)
+	if next.Source == "" {
+		return nil
+	}
+	baselines[id] = next
+	known := make(map[string]bool)
+	for _, h := range s.GetAll() {
+		known[h.ID] = true
+	}
+	for hostID := range baselines {
+		if !known[hostID] && hostID != id {
+			delete(baselines, hostID)
+		}
+	}
+	return s.PutSetting(AssetBaselinesSettingKey, baselines)
+}
+
+// compareBaseline compares assets, just read from the host with id, with
+// its baseline. A host without one takes assets as its baseline. A new
+// drift is recorded in the audit log.
+func (s *Store) compareBaseline(id string, assets []playlist.Asset, at time.Time) {
+	baselines, err := s.AssetBaselines()
+	if err != nil {
+		return
+	}
+	baseline, ok := baselines[id]
+	if !ok {
+		s.SetAssetBaseline(id, assets, BaselineFirstRead, at)
+		return
+	}
+
+	hash := hashAssets(assets)
+	s.drift.mu.Lock()
+	prev, drifted := s.drift.byHost[id]
+	if hash == hashAssets(baseline.Assets) {
+		delete(s.drift.byHost, id)
+		s.drift.mu.Unlock()
+		return
+	}
+	if drifted && prev.hash == hash {
+		s.drift.mu.Unlock()
+		return
+	}
+	change := diffAssets(baseline.Assets, assets)
+	d := AssetDrift{HostID: id, Since: at.UTC(), Detail: change.Detail(),
+		Added: change.Added, Removed: change.Removed, Modified: change.Modified, hash: hash}
+	if drifted {
+		d.Since = prev.Since
+	}
+	s.drift.byHost[id] = d
+	s.drift.mu.Unlock()
+
+	if !drifted {
+		s.AppendAudit(AuditEntry{Time: at.UTC(), Actor: "nsm", ActorType: ActorSystem, Action: AuditAssetsDrifted,
+			Target: id, Detail: d.Detail})
+	}
+}
+
+// Drift returns how the host with id differs from its baseline, and false
+// if its last read list matches it.
+func (s *Store) Drift(id string) (AssetDrift, bool) {
+	s.drift.mu.Lock()
+	defer s.drift.mu.Unlock()
+	d, ok := s.drift.byHost[id]
+	return d, ok
+}
+
+// Drifts returns every host that differs from its baseline.
+func (s *Store) Drifts() []AssetDrift {
+	s.drift.mu.Lock()
+	defer s.drift.mu.Unlock()
+	out := make([]AssetDrift, 0, len(s.drift.byHost))
+	for _, d := range s.drift.byHost {
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,385 @@
+package hosts
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// EncryptionSettingKey holds whether settings and the other sensitive
+// fields are encrypted. It is the one setting never encrypted itself.
+const EncryptionSettingKey = "encryption"
+
+// sealedPrefix marks an encrypted value. JSON never starts with it.
+const sealedPrefix = "sealed:"
+
+// sealedField is a column encryption seals besides the settings. Each
+// value is bound to its column and to the key of its row.
+type sealedField struct{ table, column, key string }
+
+// The fields sealed when encryption is on. Session, invitation, reset and
+// API key tokens are stored only as hashes, so of auth_tokens only the
+// email of an invitation or reset needs sealing.
+var (
+	fieldHostNotes    = sealedField{"hosts", "notes", "id"}
+	fieldSnapshotData = sealedField{"snapshots", "data", "name"} // Copies of the host list
+	fieldUserEmail    = sealedField{"users", "email", "id"}
+	fieldUserPassword = sealedField{"users", "password_hash", "id"}
+	fieldTokenEmail   = sealedField{"auth_tokens", "email", "token_hash"}
+	fieldAuditDetail  = sealedField{"audit_log", "detail", "id"}
+	fieldAuditAddr    = sealedField{"audit_log", "remote_addr", "id"}
+
+	sealedFields = []sealedField{fieldHostNotes, fieldSnapshotData, fieldUserEmail, fieldUserPassword,
+		fieldTokenEmail, fieldAuditDetail, fieldAuditAddr}
+)
+
+var (
+	// ErrNoSealer is returned when settings are encrypted but no key to
+	// seal or open them was loaded.
+	ErrNoSealer = errors.New("settings are encrypted but the node identity key is not loaded")
+	// ErrWrongKey is returned when an encrypted value does not open with
+	// the loaded key, e.g. because identity.key was replaced.
+	ErrWrongKey = errors.New("value was encrypted with a different node identity key")
+)
+
+// Sealer encrypts values at rest with a key private to this node.
+// additional binds a sealed value to where it is stored.
+type Sealer interface {
+	Seal(plain, additional []byte) ([]byte, error)
+	Open(sealed, additional []byte) ([]byte, error)
+}
+
+// EncryptionStatus describes the encryption of settings and sensitive
+// fields at rest.
+type EncryptionStatus struct {
+	Enabled   bool `json:"enabled"`
+	KeyLoaded bool `json:"key_loaded"` // The node identity key is available
+	Sealed    int  `json:"sealed"`     // Values stored encrypted
+	Unopened  int  `json:"unopened"`   // Encrypted values the loaded key cannot open
+}
+
+type encryptionState struct {
+	Enabled   bool      `json:"enabled"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetSealer sets the key that encrypts settings and sensitive fields.
+// Without one, encrypted values cannot be read or written.
+func (s *Store) SetSealer(sealer Sealer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sealer = sealer
+}
+
+// Encryption reports whether settings and sensitive fields are encrypted
+// and whether the loaded key opens them.
+func (s *Store) Encryption() (EncryptionStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	enabled, err := s.encryptedLocked()
+	if err != nil {
+		return EncryptionStatus{}, err
+	}
+	st := EncryptionStatus{Enabled: enabled, KeyLoaded: s.sealer != nil}
+	values, err := s.settingsLocked()
+	if err != nil {
+		return EncryptionStatus{}, err
+	}
+	for key, raw := range values {
+		if !strings.HasPrefix(raw, sealedPrefix) {
+			continue
+		}
+		st.Sealed++
+		if _, err := s.openLocked(key, raw); err != nil {
+			st.Unopened++
+		}
+	}
+	for _, field := range sealedFields {
+		values, err := s.fieldValuesLocked(field)
+		if err != nil {
+			return EncryptionStatus{}, err
+		}
+		for key, raw := range values {
+			if !strings.HasPrefix(raw, sealedPrefix) {
+				continue
+			}
+			st.Sealed++
+			if _, err := openField(s.sealer, field, key, raw); err != nil {
+				st.Unopened++
+			}
+		}
+	}
+	return st, nil
+}
+
+// Encrypted reports whether encryption is on, without the counts of
+// Encryption.
+func (s *Store) Encrypted() (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.encryptedLocked()
+}
+
+// SetEncryption turns encryption of settings and sensitive fields on or
+// off, rewriting every stored value in the new form. Turning it off needs
+// the key that sealed them; values it cannot open are left as they are and
+// reported.
+func (s *Store) SetEncryption(enabled bool) (EncryptionStatus, error) {
+	s.mu.Lock()
+	if enabled && s.sealer == nil {
+		s.mu.Unlock()
+		return EncryptionStatus{}, ErrNoSealer
+	}
+	err := s.rewriteLocked(enabled)
+	s.mu.Unlock()
+	if err != nil {
+		return EncryptionStatus{}, err
+	}
+	return s.Encryption()
+}
+
+func (s *Store) rewriteLocked(enabled bool) error {
+	values, err := s.settingsLocked()
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin settings encryption: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := formatTime(time.Now())
+	for key, raw := range values {
+		plain, err := s.openLocked(key, raw)
+		if err != nil {
+			if errors.Is(err, ErrWrongKey) || errors.Is(err, ErrNoSealer) {
+				continue
+			}
+			return err
+		}
+		value := plain
+		if enabled {
+			if value, err = s.sealLocked(key, plain); err != nil {
+				return err
+			}
+		}
+		if value == raw {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE settings SET value = ?, updated_at = ? WHERE key = ?`, value, now, key); err != nil {
+			return fmt.Errorf("rewrite setting %s: %w", key, err)
+		}
+	}
+
+	seal := fieldSealer{sealer: s.sealer, enabled: enabled}
+	for _, field := range sealedFields {
+		values, err := s.fieldValuesLocked(field)
+		if err != nil {
+			return err
+		}
+		for key, raw := range values {
+			plain, err := openField(s.sealer, field, key, raw)
+			if err != nil {
+				continue
+			}
+			value, err := seal.seal(field, key, plain)
+			if err != nil {
+				return err
+			}
+			if value == raw {
+				continue
+			}
+			if _, err := tx.Exec(`UPDATE `+field.table+` SET `+field.column+` = ? WHERE `+field.key+` = ?`, value, key); err != nil {
+				return fmt.Errorf("rewrite %s.%s: %w", field.table, field.column, err)
+			}
+		}
+	}
+
+	state, _ := json.Marshal(encryptionState{Enabled: enabled, UpdatedAt: time.Now().UTC()})
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO settings (key, value, updated_at) VALUES (?, ?, ?)`,
+		EncryptionSettingKey, string(state), now); err != nil {
+		return fmt.Errorf("write setting %s: %w", EncryptionSettingKey, err)
+	}
+	return tx.Commit()
+}
+
+// settingsLocked returns every stored setting but the encryption state, as
+// stored.
+func (s *Store) settingsLocked() (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT key, value FROM settings WHERE key != ?`, EncryptionSettingKey)
+	if err != nil {
+		return nil, fmt.Errorf("read settings: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("read settings: %w", err)
+		}
+		out[key] = value
+	}
+	return out, rows.Err()
+}
+
+// fieldValuesLocked returns the non-empty values of field, as stored, by
+// the key of their row.
+func (s *Store) fieldValuesLocked(field sealedField) (map[string]string, error) {
+	rows, err := s.db.Query(`SELECT ` + field.key + `, ` + field.column + ` FROM ` + field.table +
+		` WHERE ` + field.column + ` IS NOT NULL AND ` + field.column + ` != ''`)
+	if err != nil {
+		return nil, fmt.Errorf("read %s.%s: %w", field.table, field.column, err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("read %s.%s: %w", field.table, field.column, err)
+		}
+		out[key] = value
+	}
+	return out, rows.Err()
+}
+
+// encryptedLocked reports whether new values are to be encrypted.
+func (s *Store) encryptedLocked() (bool, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, EncryptionSettingKey).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read setting %s: %w", EncryptionSettingKey, err)
+	}
+	var st encryptionState
+	if err := json.Unmarshal([]byte(raw), &st); err != nil {
+		return false, fmt.Errorf("decode setting %s: %w", EncryptionSettingKey, err)
+	}
+	return st.Enabled, nil
+}
+
+// sealLocked encrypts the setting value plain stored under key.
+func (s *Store) sealLocked(key, plain string) (string, error) {
+	if s.sealer == nil {
+		return "", ErrNoSealer
+	}
+	sealed, err := s.sealer.Seal([]byte(plain), settingAD(key))
+	if err != nil {
+		return "", fmt.Errorf("encrypt setting %s: %w", key, err)
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openLocked returns the plain value of a setting as stored, which may or
+// may not be encrypted.
+func (s *Store) openLocked(key, raw string) (string, error) {
+	encoded, ok := strings.CutPrefix(raw, sealedPrefix)
+	if !ok {
+		return raw, nil
+	}
+	if s.sealer == nil {
+		return "", ErrNoSealer
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decode setting %s: %w", key, err)
+	}
+	plain, err := s.sealer.Open(sealed, settingAD(key))
+	if err != nil {
+		return "", ErrWrongKey
+	}
+	return string(plain), nil
+}
+
+// settingAD binds an encrypted value to its key, so a value copied to
+// another key fails to open.
+func settingAD(key string) []byte {
+	return []byte("nsm-setting|" + key)
+}
+
+// fieldSealer seals the sensitive fields of the rows one write stores.
+type fieldSealer struct {
+	sealer  Sealer
+	enabled bool
+}
+
+// fieldSealerLocked returns the sealer of the next write, which seals
+// fields when encryption is on.
+func (s *Store) fieldSealerLocked() (fieldSealer, error) {
+	enabled, err := s.encryptedLocked()
+	if err != nil {
+		return fieldSealer{}, err
+	}
+	if enabled && s.sealer == nil {
+		return fieldSealer{}, ErrNoSealer
+	}
+	return fieldSealer{sealer: s.sealer, enabled: enabled}, nil
+}
+
+// seal returns plain as stored in field of the row with key. Empty values
+// are stored as they are.
+func (f fieldSealer) seal(field sealedField, key, plain string) (string, error) {
+	if !f.enabled || plain == "" {
+		return plain, nil
+	}
+	sealed, err := f.sealer.Seal([]byte(plain), field.additional(key))
+	if err != nil {
+		return "", fmt.Errorf("encrypt %s.%s: %w", field.table, field.column, err)
+	}
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// hostArgs returns hostToArgs of h with its sensitive fields sealed.
+func (f fieldSealer) hostArgs(h types.Host) ([]any, error) {
+	notes, err := f.seal(fieldHostNotes, h.ID, h.Notes)
+	if err != nil {
+		return nil, err
+	}
+	h.Notes = notes
+	return hostToArgs(h), nil
+}
+
+// openField returns the plain value of field as stored in the row with
+// key, which may or may not be encrypted. A value that does not open is
+// returned as stored with the error, so callers that can show it sealed
+// need not fail.
+func openField(sealer Sealer, field sealedField, key, raw string) (string, error) {
+	encoded, ok := strings.CutPrefix(raw, sealedPrefix)
+	if !ok {
+		return raw, nil
+	}
+	if sealer == nil {
+		return raw, ErrNoSealer
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return raw, nil // Not sealed after all, e.g. notes that start with "sealed:"
+	}
+	plain, err := sealer.Open(sealed, field.additional(key))
+	if err != nil {
+		return raw, ErrWrongKey
+	}
+	return string(plain), nil
+}
+
+// openHost opens the sensitive fields of h as read from the hosts table.
+func openHost(sealer Sealer, h *types.Host) {
+	h.Notes, _ = openField(sealer, fieldHostNotes, h.ID, h.Notes)
+}
+
+// additional binds a sealed value to its field and row, so a value copied
+// elsewhere fails to open.
+func (f sealedField) additional(key string) []byte {
+	return []byte("nsm-field|" + f.table + "." + f.column + "|" + key)
+}
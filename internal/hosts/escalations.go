@@ -0,0 +1,142 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAlertNotFound is returned when acknowledging an alert that was never
+// sent or has already resolved.
+var ErrAlertNotFound = errors.New("alert not found")
+
+// escalationHistoryLimit is how long resolved alerts' escalations are kept.
+const escalationHistoryLimit = 30 * 24 * time.Hour
+
+// Escalation tracks a sent alert: how far up its escalation policy it has
+// gone and who acknowledged it.
+type Escalation struct {
+	AlertID     string    `json:"alert_id"`
+	RuleID      string    `json:"rule_id"`
+	HostID      string    `json:"host_id"`
+	Policy      string    `json:"policy,omitempty"` // Escalation policy of the rule; empty if it has none
+	SentAt      time.Time `json:"sent_at"`          // When the rule's channels were notified; steps count from here
+	Step        int       `json:"step"`             // Policy steps notified so far
+	EscalatedAt time.Time `json:"escalated_at,omitzero"`
+	AckedBy     string    `json:"acked_by,omitempty"`
+	AckedAt     time.Time `json:"acked_at,omitzero"` // Zero until acknowledged; no further steps are notified after
+	ResolvedAt  time.Time `json:"resolved_at,omitzero"`
+}
+
+const escalationColumns = `alert_id, rule_id, host_id, policy, sent_at, step, escalated_at, acked_by, acked_at, resolved_at`
+
+// OpenEscalation records e, an alert that has just been sent. An alert
+// already recorded is left as it is.
+func (s *Store) OpenEscalation(e Escalation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO alert_escalations (alert_id, rule_id, host_id, policy, sent_at) VALUES (?, ?, ?, ?, ?)`,
+		e.AlertID, e.RuleID, e.HostID, e.Policy, formatTime(e.SentAt))
+	if err != nil {
+		return fmt.Errorf("open escalation: %w", err)
+	}
+	return nil
+}
+
+// Escalate records that the alert has been escalated through step at now.
+func (s *Store) Escalate(alertID string, step int, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`UPDATE alert_escalations SET step = ?, escalated_at = ? WHERE alert_id = ?`,
+		step, formatTime(now), alertID); err != nil {
+		return fmt.Errorf("escalate alert: %w", err)
+	}
+	return nil
+}
+
+// AckAlert records that user acknowledged the alert at now, unless someone
+// already has, and returns its escalation.
+func (s *Store) AckAlert(alertID, user string, now time.Time) (Escalation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`UPDATE alert_escalations SET acked_by = ?, acked_at = ?
+		WHERE alert_id = ? AND acked_at IS NULL AND resolved_at IS NULL`, user, formatTime(now), alertID); err != nil {
+		return Escalation{}, fmt.Errorf("acknowledge alert: %w", err)
+	}
+	list, err := s.queryEscalations(`WHERE alert_id = ? AND resolved_at IS NULL`, alertID)
+	if err != nil {
+		return Escalation{}, err
+	}
+	if len(list) == 0 {
+		return Escalation{}, ErrAlertNotFound
+	}
+	return list[0], nil
+}
+
+// ResolveEscalation records that the alert resolved at now, and drops
+// escalations resolved more than escalationHistoryLimit ago.
+func (s *Store) ResolveEscalation(alertID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`UPDATE alert_escalations SET resolved_at = ? WHERE alert_id = ? AND resolved_at IS NULL`,
+		sortableTime(now), alertID); err != nil {
+		return fmt.Errorf("resolve escalation: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM alert_escalations WHERE resolved_at < ?`, sortableTime(now.Add(-escalationHistoryLimit))); err != nil {
+		return fmt.Errorf("prune escalations: %w", err)
+	}
+	return nil
+}
+
+// GetEscalation returns the escalation of the alert, resolved or not.
+func (s *Store) GetEscalation(alertID string) (Escalation, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, err := s.queryEscalations(`WHERE alert_id = ?`, alertID)
+	if err != nil || len(list) == 0 {
+		return Escalation{}, false, err
+	}
+	return list[0], true, nil
+}
+
+// OpenEscalations returns the escalations of alerts that have not resolved,
+// oldest first.
+func (s *Store) OpenEscalations() ([]Escalation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.queryEscalations(`WHERE resolved_at IS NULL ORDER BY sent_at`)
+}
+
+// queryEscalations selects escalations matching where. The caller holds mu.
+func (s *Store) queryEscalations(where string, args ...any) ([]Escalation, error) {
+	rows, err := s.db.Query(`SELECT `+escalationColumns+` FROM alert_escalations `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list escalations: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Escalation{}
+	for rows.Next() {
+		var (
+			e                               Escalation
+			sentAt                          string
+			escalatedAt, ackedAt, resolveAt sql.NullString
+		)
+		if err := rows.Scan(&e.AlertID, &e.RuleID, &e.HostID, &e.Policy, &sentAt, &e.Step, &escalatedAt, &e.AckedBy, &ackedAt, &resolveAt); err != nil {
+			return nil, err
+		}
+		e.SentAt = parseTime(sentAt)
+		e.EscalatedAt = parseTime(escalatedAt.String)
+		e.AckedAt = parseTime(ackedAt.String)
+		e.ResolvedAt = parseTime(resolveAt.String)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
@@ -2,23 +2,32 @@
 package hosts
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/playlist"
 	"nexsign.mini/nsm/internal/types"
 )
 
 // CheckHealth performs a health check on a host and returns its status
-// It also checks the Anthias CMS status by querying the /api/v1/assets endpoint
-func CheckHealth(host *types.Host) types.HostStatus {
-	host.Status = checkNetwork(host, host.IPAddress, false)
+// It also checks the status of the host's CMS, Anthias unless set otherwise
+// Simulated hosts keep the status the simulator gave them.
+func (s *Store) CheckHealth(host *types.Host) types.HostStatus {
+	if host.Simulated() {
+		return host.Status
+	}
+	host.Status = s.checkNetwork(host, host.IPAddress, false)
 
 	if host.VPNIPAddress != "" {
-		host.StatusVPN = checkNetwork(host, host.VPNIPAddress, true)
+		host.StatusVPN = s.checkNetwork(host, host.VPNIPAddress, true)
 	} else {
 		host.StatusVPN = ""
 		host.NSMStatusVPN = ""
@@ -28,19 +37,34 @@ func CheckHealth(host *types.Host) types.HostStatus {
 		host.DashboardURLVPN = ""
 		host.LastCheckedVPN = time.Time{}
 	}
+	s.failures.record(host, time.Now())
 
 	return host.Status
 }
 
-func checkNetwork(host *types.Host, ip string, isVPN bool) types.HostStatus {
+func (s *Store) checkNetwork(host *types.Host, addr string, isVPN bool) types.HostStatus {
 	now := time.Now()
 
 	dashboardURL := ""
-	if ip != "" {
-		dashboardURL = fmt.Sprintf("http://%s:8080", ip)
+	if addr != "" {
+		dashboardURL = fmt.Sprintf("http://%s:8080", addr)
 	}
 
-	cmsStatus, assetCount := checkAnthiasCMSByIP(ip)
+	// Hosts listed by DNS name are checked at the IP it resolves to, so
+	// every probe hits the same machine without a lookup of its own. A
+	// name that has never resolved leaves ip empty: unreachable.
+	ip, _ := s.Resolve(addr)
+	plan := s.planFor(host.ID)
+
+	cmsStatus, assetCount, expiresAt := types.CMSNotChecked, 0, time.Time{}
+	if plan.enabled(ProbeAnthias) {
+		cmsStatus, assetCount, expiresAt = s.checkCMS(host, ip, plan.timeout)
+	}
+
+	// Both paths reach the same Anthias; prefer what the LAN reported.
+	if cmsStatus == types.CMSOnline && (!isVPN || host.CMSStatus != types.CMSOnline) {
+		host.ContentExpiresAt = expiresAt
+	}
 
 	status := types.StatusUnreachable
 	nsmStatusText := "NSM Offline"
@@ -51,11 +75,17 @@ func checkNetwork(host *types.Host, ip string, isVPN bool) types.HostStatus {
 		return status
 	}
 
-	timeout := 3 * time.Second
+	timeout := plan.timeout
 	nsmAddress := fmt.Sprintf("%s:8080", ip)
+	network := NetworkLAN
+	if isVPN {
+		network = NetworkVPN
+	}
 
+	dialStart := time.Now()
 	conn, err := net.DialTimeout("tcp", nsmAddress, timeout)
 	if err != nil {
+		s.quality.add(host.ID, QualitySample{At: now, Network: network, LossPercent: 100})
 		if opErr, ok := err.(*net.OpError); ok {
 			if _, ok := opErr.Err.(*net.DNSError); ok {
 				status = types.StatusUnreachable
@@ -70,30 +100,51 @@ func checkNetwork(host *types.Host, ip string, isVPN bool) types.HostStatus {
 		return status
 	}
 	conn.Close()
+	latency, loss := probeQuality(nsmAddress, time.Since(dialStart))
+	s.quality.add(host.ID, QualitySample{At: now, Network: network, LatencyMS: latency, LossPercent: loss})
 
 	status = types.StatusUnhealthy
 
 	client := &http.Client{Timeout: timeout}
 	versionURL := fmt.Sprintf("http://%s:8080/api/version", ip)
 
-	versionResp, err := client.Get(versionURL)
-	if err == nil {
-		defer versionResp.Body.Close()
-		if versionResp.StatusCode == http.StatusOK {
-			var versionData struct {
-				Version  string `json:"version"`
-				Hostname string `json:"hostname"`
-			}
-			if err := json.NewDecoder(versionResp.Body).Decode(&versionData); err == nil {
-				if versionData.Version != "" {
-					nsmVersion = versionData.Version
-					if compareVersions(versionData.Version, types.Version) < 0 {
-						status = types.StatusStale
-						nsmStatusText = "NSM Online (Update Required)"
-					}
+	// The LAN check clears the last clock reading so a host that stops
+	// reporting its time is not flagged forever; the VPN check only fills
+	// in when the LAN could not measure.
+	if !isVPN {
+		host.ClockSkewMS = 0
+		host.ClockCheckedAt = time.Time{}
+	}
+
+	versionOK := false
+	sent := time.Now()
+	if plan.enabled(ProbeVersion) {
+		versionResp, err := client.Get(versionURL)
+		if err == nil {
+			defer versionResp.Body.Close()
+			if versionResp.StatusCode == http.StatusOK {
+				versionOK = true
+				var versionData struct {
+					Version  string    `json:"version"`
+					Hostname string    `json:"hostname"`
+					Time     time.Time `json:"time"`
 				}
-				if versionData.Hostname != "" {
-					host.Hostname = versionData.Hostname
+				if err := json.NewDecoder(versionResp.Body).Decode(&versionData); err == nil {
+					if !versionData.Time.IsZero() && host.ClockCheckedAt.IsZero() {
+						received := time.Now()
+						host.ClockSkewMS = clockSkew(sent, received, versionData.Time).Milliseconds()
+						host.ClockCheckedAt = received
+					}
+					if versionData.Version != "" {
+						nsmVersion = versionData.Version
+						if compareVersions(versionData.Version, types.Version) < 0 {
+							status = types.StatusStale
+							nsmStatusText = "NSM Online (Update Required)"
+						}
+					}
+					if versionData.Hostname != "" {
+						host.Hostname = versionData.Hostname
+					}
 				}
 			}
 		}
@@ -103,16 +154,22 @@ func checkNetwork(host *types.Host, ip string, isVPN bool) types.HostStatus {
 		nsmStatusText = "NSM Unhealthy"
 	}
 
-	healthURL := fmt.Sprintf("http://%s:8080/api/health", ip)
-	resp, err := client.Get(healthURL)
-	if err == nil {
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			if status != types.StatusStale {
-				status = types.StatusHealthy
-				nsmStatusText = "NSM Online"
+	if plan.enabled(ProbeHealth) {
+		healthURL := fmt.Sprintf("http://%s:8080/api/health", ip)
+		resp, err := client.Get(healthURL)
+		if err == nil {
+			defer resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				if status != types.StatusStale {
+					status = types.StatusHealthy
+					nsmStatusText = "NSM Online"
+				}
 			}
 		}
+	} else if status != types.StatusStale && (versionOK || !plan.enabled(ProbeVersion)) {
+		// Without the health probe, the last probe that ran decides.
+		status = types.StatusHealthy
+		nsmStatusText = "NSM Online"
 	}
 
 	if status == types.StatusUnhealthy && nsmStatusText == "NSM Unhealthy" {
@@ -124,6 +181,13 @@ func checkNetwork(host *types.Host, ip string, isVPN bool) types.HostStatus {
 	return status
 }
 
+// clockSkew estimates how far the remote clock is ahead of ours, assuming
+// the remote read its clock halfway through the request.
+func clockSkew(sent, received, remote time.Time) time.Duration {
+	mid := sent.Add(received.Sub(sent) / 2)
+	return remote.Sub(mid)
+}
+
 func applyNetworkResults(host *types.Host, isVPN bool, status types.HostStatus, cmsStatus types.AnthiasCMSStatus, assetCount int, nsmStatus string, nsmVersion string, dashboardURL string, checkedAt time.Time) {
 	if isVPN {
 		host.StatusVPN = status
@@ -144,60 +208,55 @@ func applyNetworkResults(host *types.Host, isVPN bool, status types.HostStatus,
 	}
 }
 
-// checkAnthiasCMSByIP checks CMS availability for a specific IP address.
-func checkAnthiasCMSByIP(ip string) (types.AnthiasCMSStatus, int) {
+// checkCMS checks the CMS of host at a specific IP address, through the
+// backend its CMS setting picks. When the asset list can be read it also
+// returns the number of assets and when the playlist runs empty (see
+// contentEnd).
+func (s *Store) checkCMS(host *types.Host, ip string, timeout time.Duration) (types.AnthiasCMSStatus, int, time.Time) {
 	if ip == "" {
-		return types.CMSUnknown, 0
+		return types.CMSUnknown, 0, time.Time{}
 	}
 
-	timeout := 3 * time.Second
-	client := &http.Client{Timeout: timeout}
-	
-	// Primary health check using /api/v2/info
-	infoURL := fmt.Sprintf("http://%s/api/v2/info", ip)
-	resp, err := client.Get(infoURL)
-	
-	// If v2 works, we are online
-	if err == nil && resp.StatusCode == http.StatusOK {
-		resp.Body.Close()
-		
-		// Try to get asset count (best effort)
-		assetCount := 0
-		assetsURL := fmt.Sprintf("http://%s/api/v1/assets?format=json", ip)
-		respAssets, err := client.Get(assetsURL)
-		if err == nil {
-			defer respAssets.Body.Close()
-			if respAssets.StatusCode == http.StatusOK {
-				var assets []interface{}
-				if json.NewDecoder(respAssets.Body).Decode(&assets) == nil {
-					assetCount = len(assets)
-				}
-			}
-		}
-		return types.CMSOnline, assetCount
+	c := cms.New(host.CMS, &http.Client{Timeout: timeout}, "", "")
+
+	// If the status endpoint answers, we are online and the asset list is
+	// best effort.
+	if err := c.Ping(ip); err == nil {
+		assets, _ := s.fetchAssets(c, host.ID, ip)
+		return types.CMSOnline, len(assets), contentEnd(assets)
 	}
-	
+
+	// Fallback for older versions: a readable asset list is also Online.
+	assets, err := s.fetchAssets(c, host.ID, ip)
 	if err == nil {
-		resp.Body.Close()
+		return types.CMSOnline, len(assets), contentEnd(assets)
+	}
+	if errors.Is(err, cms.ErrUndecodable) {
+		// Even if decode fails, if we got 200 OK, it's online
+		return types.CMSOnline, 0, time.Time{}
 	}
 
-	// Fallback: Try /api/v1/assets directly (for older versions)
-	// If this works, it's also Online
-	assetsURL := fmt.Sprintf("http://%s/api/v1/assets?format=json", ip)
-	resp, err = client.Get(assetsURL)
-	if err == nil {
-		defer resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			var assets []interface{}
-			if json.NewDecoder(resp.Body).Decode(&assets) == nil {
-				return types.CMSOnline, len(assets)
-			}
-			// Even if decode fails, if we got 200 OK, it's online
-			return types.CMSOnline, 0
+	return types.CMSOffline, 0, time.Time{}
+}
+
+// contentEnd returns when the last enabled asset ends, which is when the
+// playlist runs empty. It is zero when there are no enabled assets or one of
+// them has no readable end date, since then nothing is known to run out.
+func contentEnd(assets []playlist.Asset) time.Time {
+	var end time.Time
+	for _, a := range assets {
+		if !a.IsEnabled.True() {
+			continue
+		}
+		t, ok := playlist.ParseDate(a.EndDate)
+		if !ok {
+			return time.Time{}
+		}
+		if t.After(end) {
+			end = t
 		}
 	}
-
-	return types.CMSOffline, 0
+	return end
 }
 
 // compareVersions compares two semantic version strings
@@ -232,13 +291,68 @@ func compareVersions(v1, v2 string) int {
 	return 0
 }
 
-// CheckAllHosts checks health of all hosts and updates their status
+// CheckAllHosts checks health of all hosts and updates their status.
+// Hosts backing off after failed checks keep their last result until due.
 func (s *Store) CheckAllHosts() {
+	s.CheckHosts(nil)
+}
+
+// CheckHosts is CheckAllHosts for the hosts with the given IDs; nil means
+// every host.
+func (s *Store) CheckHosts(ids []string) {
 	hosts := s.GetAll()
 
+	now := time.Now()
 	for i := range hosts {
-		CheckHealth(&hosts[i])
+		if ids != nil && !slices.Contains(ids, hosts[i].ID) {
+			continue
+		}
+		if !s.failures.due(hosts[i].ID, now) {
+			continue
+		}
+		s.CheckHealth(&hosts[i])
 	}
 
-	s.ReplaceAll(hosts)
+	s.saveChecks(hosts)
+}
+
+// saveChecks writes the results of health checks on hosts. Checks take a
+// while, so edits made meanwhile are kept: hosts deleted since are not
+// brought back, and each host keeps its stored replicated fields.
+func (s *Store) saveChecks(hosts []types.Host) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin save checks: %w", err)
+	}
+	defer tx.Rollback()
+	for _, h := range hosts {
+		stored, err := scanHost(tx.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE id = ?`, h.ID))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		openHost(s.sealer, &stored)
+		copyReplicated(&h, stored)
+		args, err := seal.hostArgs(h)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(hostUpdate, append(args[1:], h.ID)...); err != nil {
+			return fmt.Errorf("save check of %s: %w", h.IPAddress, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit save checks: %w", err)
+	}
+	s.notify()
+	return nil
 }
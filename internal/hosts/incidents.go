@@ -0,0 +1,334 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrIncidentNotFound is returned for an incident ID that is not recorded.
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// incidentHistoryLimit is how long resolved incidents are kept.
+const incidentHistoryLimit = 365 * 24 * time.Hour
+
+// incidentLead is how long before an incident opened its timeline starts.
+// A host is only found offline a minute or more after its last heartbeat,
+// so what took it down, such as an operator's reboot, comes first.
+const incidentLead = 2 * time.Minute
+
+// Incident statuses.
+const (
+	IncidentOpen     = "open"
+	IncidentResolved = "resolved"
+)
+
+// Kinds of incident event. Offline and alert_fired open an incident if the
+// host has none open; the incident resolves once the host is back online
+// and every alert that fired in it has resolved.
+const (
+	IncidentOffline       = "offline"        // The host went offline
+	IncidentOnline        = "online"         // The host came back
+	IncidentAlertFired    = "alert_fired"    // An alert rule fired for the host
+	IncidentAlertResolved = "alert_resolved" // An alert that fired resolved
+	IncidentClosed        = "closed"         // Nothing holds any more; the incident is over
+	IncidentAudit         = "audit"          // Something done to the host, from the audit log
+	IncidentReboot        = "reboot"         // The host booted, from its reboot history
+)
+
+// Incident groups what happened to a host from the moment something went
+// wrong until it was all right again.
+type Incident struct {
+	ID         string          `json:"id"`
+	HostID     string          `json:"host_id"`
+	Title      string          `json:"title"` // What opened it, e.g. "Lobby went offline"
+	Status     string          `json:"status"`
+	OpenedAt   time.Time       `json:"opened_at"`
+	ResolvedAt time.Time       `json:"resolved_at,omitzero"`
+	Duration   int64           `json:"duration_seconds"` // Until it resolved, or until now while open
+	Timeline   []IncidentEvent `json:"timeline,omitempty"`
+}
+
+// IncidentEvent is one entry in an incident's timeline.
+type IncidentEvent struct {
+	At     time.Time `json:"at"`
+	Kind   string    `json:"kind"`
+	Detail string    `json:"detail,omitempty"`
+	Actor  string    `json:"actor,omitempty"` // Who did it, for audit entries
+}
+
+// IncidentQuery filters ListIncidents. Zero values match everything; Limit
+// defaults to 100.
+type IncidentQuery struct {
+	HostID string
+	Status string // IncidentOpen or IncidentResolved
+	Since  time.Time
+	Limit  int
+}
+
+const incidentColumns = `id, host_id, title, opened_at, resolved_at`
+
+// RecordIncidentEvent adds ev to the host's open incident. An offline or
+// alert_fired event opens one titled title if none is open; other events
+// for a host without one are dropped. It returns the incident, or false if
+// ev was dropped.
+func (s *Store) RecordIncidentEvent(hostID, title string, ev IncidentEvent) (Incident, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		inc             Incident
+		offline, alerts int
+		opened          string
+	)
+	err := s.db.QueryRow(`SELECT id, title, opened_at, offline, alerts FROM incidents WHERE host_id = ? AND resolved_at IS NULL`,
+		hostID).Scan(&inc.ID, &inc.Title, &opened, &offline, &alerts)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if ev.Kind != IncidentOffline && ev.Kind != IncidentAlertFired {
+			return Incident{}, false, nil
+		}
+		inc = Incident{ID: uuid.New().String(), Title: title, OpenedAt: ev.At}
+		if _, err := s.db.Exec(`INSERT INTO incidents (id, host_id, title, opened_at) VALUES (?, ?, ?, ?)`,
+			inc.ID, hostID, title, sortableTime(ev.At)); err != nil {
+			return Incident{}, false, fmt.Errorf("open incident: %w", err)
+		}
+	case err != nil:
+		return Incident{}, false, fmt.Errorf("find open incident: %w", err)
+	default:
+		inc.OpenedAt = parseTime(opened)
+	}
+	inc.HostID, inc.Status = hostID, IncidentOpen
+
+	switch ev.Kind {
+	case IncidentOffline:
+		offline = 1
+	case IncidentOnline:
+		offline = 0
+	case IncidentAlertFired:
+		alerts++
+	case IncidentAlertResolved:
+		alerts = max(alerts-1, 0)
+	}
+	if _, err := s.db.Exec(`INSERT INTO incident_events (incident_id, at, kind, detail) VALUES (?, ?, ?, ?)`,
+		inc.ID, sortableTime(ev.At), ev.Kind, ev.Detail); err != nil {
+		return Incident{}, false, fmt.Errorf("record incident event: %w", err)
+	}
+
+	var resolved any
+	if offline == 0 && alerts == 0 {
+		inc.Status, inc.ResolvedAt, resolved = IncidentResolved, ev.At, sortableTime(ev.At)
+		if _, err := s.db.Exec(`INSERT INTO incident_events (incident_id, at, kind) VALUES (?, ?, ?)`,
+			inc.ID, sortableTime(ev.At), IncidentClosed); err != nil {
+			return Incident{}, false, fmt.Errorf("record incident event: %w", err)
+		}
+	}
+	if _, err := s.db.Exec(`UPDATE incidents SET offline = ?, alerts = ?, resolved_at = ? WHERE id = ?`,
+		offline, alerts, resolved, inc.ID); err != nil {
+		return Incident{}, false, fmt.Errorf("update incident: %w", err)
+	}
+	if resolved != nil {
+		if err := s.pruneIncidents(ev.At); err != nil {
+			return inc, true, err
+		}
+	}
+	inc.Duration = incidentDuration(inc, ev.At)
+	return inc, true, nil
+}
+
+// pruneIncidents drops incidents resolved more than incidentHistoryLimit
+// before now. The caller holds mu.
+func (s *Store) pruneIncidents(now time.Time) error {
+	cutoff := sortableTime(now.Add(-incidentHistoryLimit))
+	if _, err := s.db.Exec(`DELETE FROM incident_events WHERE incident_id IN (SELECT id FROM incidents WHERE resolved_at < ?)`, cutoff); err != nil {
+		return fmt.Errorf("prune incidents: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM incidents WHERE resolved_at < ?`, cutoff); err != nil {
+		return fmt.Errorf("prune incidents: %w", err)
+	}
+	return nil
+}
+
+// ListIncidents returns matching incidents without their timelines, newest
+// first. now sets the duration of open ones.
+func (s *Store) ListIncidents(q IncidentQuery, now time.Time) ([]Incident, error) {
+	query := `SELECT ` + incidentColumns + ` FROM incidents WHERE 1 = 1`
+	var args []any
+	if q.HostID != "" {
+		query += ` AND host_id = ?`
+		args = append(args, q.HostID)
+	}
+	switch q.Status {
+	case IncidentOpen:
+		query += ` AND resolved_at IS NULL`
+	case IncidentResolved:
+		query += ` AND resolved_at IS NOT NULL`
+	}
+	if !q.Since.IsZero() {
+		query += ` AND opened_at >= ?`
+		args = append(args, sortableTime(q.Since))
+	}
+	if q.Limit <= 0 {
+		q.Limit = 100
+	}
+	query += ` ORDER BY opened_at DESC LIMIT ?`
+	args = append(args, q.Limit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queryIncidents(now, query, args...)
+}
+
+// GetIncident returns the incident with its timeline: the events recorded
+// for it, with the host's audit entries and boots while it was open, oldest
+// first.
+func (s *Store) GetIncident(id string, now time.Time) (Incident, error) {
+	s.mu.RLock()
+	list, err := s.queryIncidents(now, `SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, id)
+	if err != nil || len(list) == 0 {
+		s.mu.RUnlock()
+		if err == nil {
+			err = ErrIncidentNotFound
+		}
+		return Incident{}, err
+	}
+	inc := list[0]
+	inc.Timeline, err = s.incidentEvents(id)
+	s.mu.RUnlock()
+	if err != nil {
+		return Incident{}, err
+	}
+
+	until := inc.ResolvedAt
+	if until.IsZero() {
+		until = now
+	}
+	from, to := inc.OpenedAt.Add(-incidentLead), until.Add(time.Second)
+
+	var host types.Host
+	if h, err := s.GetByID(inc.HostID); err == nil {
+		host = *h
+	} else {
+		host.ID = inc.HostID
+	}
+	audit, err := s.AuditRange(from, to)
+	if err != nil {
+		return Incident{}, err
+	}
+	for _, e := range audit {
+		if auditConcerns(e, host) {
+			inc.Timeline = append(inc.Timeline, IncidentEvent{At: e.Time, Kind: IncidentAudit, Detail: auditSummary(e), Actor: e.Actor})
+		}
+	}
+	boots, err := s.ListReboots(inc.HostID, from)
+	if err != nil {
+		return Incident{}, err
+	}
+	for _, b := range boots {
+		if b.RecordedAt.Before(to) {
+			inc.Timeline = append(inc.Timeline, IncidentEvent{At: b.RecordedAt, Kind: IncidentReboot, Detail: bootSummary(b)})
+		}
+	}
+	slices.SortStableFunc(inc.Timeline, func(a, b IncidentEvent) int { return a.At.Compare(b.At) })
+	return inc, nil
+}
+
+// queryIncidents runs query, which selects incidentColumns. The caller
+// holds mu.
+func (s *Store) queryIncidents(now time.Time, query string, args ...any) ([]Incident, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list incidents: %w", err)
+	}
+	defer rows.Close()
+
+	out := []Incident{}
+	for rows.Next() {
+		var (
+			inc      Incident
+			opened   string
+			resolved sql.NullString
+		)
+		if err := rows.Scan(&inc.ID, &inc.HostID, &inc.Title, &opened, &resolved); err != nil {
+			return nil, err
+		}
+		inc.OpenedAt = parseTime(opened)
+		inc.ResolvedAt = parseTime(resolved.String)
+		inc.Status = IncidentOpen
+		if !inc.ResolvedAt.IsZero() {
+			inc.Status = IncidentResolved
+		}
+		inc.Duration = incidentDuration(inc, now)
+		out = append(out, inc)
+	}
+	return out, rows.Err()
+}
+
+// incidentEvents returns the events recorded for the incident. The caller
+// holds mu.
+func (s *Store) incidentEvents(id string) ([]IncidentEvent, error) {
+	rows, err := s.db.Query(`SELECT at, kind, detail FROM incident_events WHERE incident_id = ? ORDER BY rowid`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list incident events: %w", err)
+	}
+	defer rows.Close()
+
+	out := []IncidentEvent{}
+	for rows.Next() {
+		var (
+			ev IncidentEvent
+			at string
+		)
+		if err := rows.Scan(&at, &ev.Kind, &ev.Detail); err != nil {
+			return nil, err
+		}
+		ev.At = parseTime(at)
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+func incidentDuration(inc Incident, now time.Time) int64 {
+	end := inc.ResolvedAt
+	if end.IsZero() {
+		end = now
+	}
+	return int64(end.Sub(inc.OpenedAt).Seconds())
+}
+
+// auditConcerns reports whether e was done to host. Entries name hosts by
+// ID or address, or in the query string of the request.
+func auditConcerns(e AuditEntry, host types.Host) bool {
+	for _, v := range []string{host.ID, host.IPAddress, host.VPNIPAddress} {
+		if v == "" {
+			continue
+		}
+		if e.Target == v || strings.Contains(e.Target, "="+v) {
+			return true
+		}
+	}
+	return false
+}
+
+func auditSummary(e AuditEntry) string {
+	if e.Detail == "" {
+		return e.Action
+	}
+	return e.Action + ": " + e.Detail
+}
+
+func bootSummary(b RebootEvent) string {
+	switch b.Shutdown {
+	case ShutdownClean:
+		return "Booted after a clean shutdown"
+	case ShutdownUnexpected:
+		return "Booted after an unexpected shutdown"
+	}
+	return "Booted"
+}
@@ -0,0 +1,92 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInventoryNotFound is returned for a node that has not reported its
+// hardware.
+var ErrInventoryNotFound = errors.New("no inventory for node")
+
+// Inventory is the hardware and OS a node reports in its heartbeats, for
+// asset management. Empty fields were not readable on the node.
+type Inventory struct {
+	Model       string    `json:"model,omitempty"`  // Board model from the device tree, e.g. "Raspberry Pi 4 Model B Rev 1.4"
+	Serial      string    `json:"serial,omitempty"` // Board serial number
+	OS          string    `json:"os,omitempty"`     // PRETTY_NAME from os-release
+	Kernel      string    `json:"kernel,omitempty"`
+	RAMBytes    int64     `json:"ram_bytes,omitempty"`
+	SDCardBytes int64     `json:"sd_card_bytes,omitempty"` // Size of mmcblk0: the SD card, or the eMMC of a CM4
+	ReportedAt  time.Time `json:"reported_at,omitzero"`    // When the receiver last heard it; set by PutInventory
+}
+
+const inventoryColumns = `node_id, model, serial, os, kernel, ram_bytes, sd_card_bytes, reported_at`
+
+// PutInventory records the hardware nodeID reported at now.
+func (s *Store) PutInventory(nodeID string, inv Inventory, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO inventory (`+inventoryColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		nodeID, inv.Model, inv.Serial, inv.OS, inv.Kernel, inv.RAMBytes, inv.SDCardBytes, formatTime(now))
+	if err != nil {
+		return fmt.Errorf("write inventory: %w", err)
+	}
+	return nil
+}
+
+// GetInventory returns the hardware nodeID last reported.
+func (s *Store) GetInventory(nodeID string) (Inventory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, inv, err := scanInventory(s.db.QueryRow(`SELECT `+inventoryColumns+` FROM inventory WHERE node_id = ?`, nodeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Inventory{}, ErrInventoryNotFound
+	}
+	return inv, err
+}
+
+// ListInventory returns the hardware every node has reported, by node ID.
+func (s *Store) ListInventory() (map[string]Inventory, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT ` + inventoryColumns + ` FROM inventory`)
+	if err != nil {
+		return nil, fmt.Errorf("list inventory: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]Inventory)
+	for rows.Next() {
+		id, inv, err := scanInventory(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = inv
+	}
+	return out, rows.Err()
+}
+
+func scanInventory(scanner interface{ Scan(dest ...any) error }) (string, Inventory, error) {
+	var (
+		id                        string
+		inv                       Inventory
+		model, serial, os, kernel sql.NullString
+		reportedAt                sql.NullString
+	)
+	if err := scanner.Scan(&id, &model, &serial, &os, &kernel, &inv.RAMBytes, &inv.SDCardBytes, &reportedAt); err != nil {
+		return "", Inventory{}, err
+	}
+	inv.Model = model.String
+	inv.Serial = serial.String
+	inv.OS = os.String
+	inv.Kernel = kernel.String
+	inv.ReportedAt = parseTime(reportedAt.String)
+	return id, inv, nil
+}
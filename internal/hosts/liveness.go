@@ -0,0 +1,96 @@
+package hosts
+
+import (
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// applyHealth sets on host what this node has observed of it in memory,
+// such as its resolved IPs, backoff, drift and network quality, then its
+// health with applyLiveness. It runs on every host read.
+func (s *Store) applyHealth(host *types.Host, peer Peer, ok bool, now time.Time) {
+	s.names.apply(host)
+	s.failures.apply(host)
+	host.AssetDrift = ""
+	if d, found := s.Drift(host.ID); found {
+		host.AssetDrift = d.Detail
+	}
+	host.Playing = ""
+	if p, found := s.PlaybackOf(host.ID, now); found {
+		host.Playing = p.Summary()
+	}
+	host.ViewerProblem = ""
+	if v, found := s.ViewerOf(host.ID, now); found {
+		host.ViewerProblem = v.Summary()
+	}
+	host.LatencyMS, host.LossPercent = 0, 0
+	if q, found := s.quality.latest(host.ID, SelectPath(*host).Network); found {
+		host.LatencyMS, host.LossPercent = q.LatencyMS, q.LossPercent
+	}
+	applyLiveness(host, peer, ok, now)
+}
+
+// applyLiveness sets Health and LastSeen on host from its heartbeat state.
+// Hosts that have never sent a heartbeat, such as nodes running an older
+// NSM, fall back to the result of their last LAN or VPN check. It also
+// moves timestamps into the host's timezone.
+func applyLiveness(host *types.Host, peer Peer, ok bool, now time.Time) {
+	defer host.Localize()
+	if ok {
+		host.LastSeen = peer.LastSeen
+		host.TimeSync = peer.TimeSync
+		host.Stratum = peer.Stratum
+		host.Throttled, host.ThrottledSince = nil, nil
+		if peer.Throttled != nil {
+			host.Throttled, host.ThrottledSince = types.ThrottleFlags(*peer.Throttled)
+		}
+		host.Health = types.DetermineHealth(peer.Liveness(), now, types.DefaultHealthThresholds())
+		return
+	}
+	host.LastSeen = time.Time{}
+	host.TimeSync = ""
+	host.Stratum = 0
+	host.Throttled, host.ThrottledSince = nil, nil
+	host.Health = types.HealthFromStatus(SelectPath(*host).Status)
+}
+
+// peersLocked returns heartbeat state by node ID. The caller holds s.mu.
+func (s *Store) peersLocked() map[string]Peer {
+	peers := make(map[string]Peer)
+	rows, err := s.db.Query(`SELECT ` + peerColumns + ` FROM peers`)
+	if err != nil {
+		return peers
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if p, err := scanPeer(rows); err == nil {
+			peers[p.NodeID] = p
+		}
+	}
+	return peers
+}
+
+// RefreshHealth recomputes every host's health and signals an update when
+// any of them changed. Health drifts with time alone as heartbeats stop
+// arriving, so this must be called periodically for watchers to see it.
+func (s *Store) RefreshHealth() {
+	current := make(map[string]types.HealthStatus)
+	for _, h := range s.GetAll() {
+		current[h.ID] = h.Health
+	}
+
+	s.healthMu.Lock()
+	changed := len(current) != len(s.lastHealth)
+	for id, health := range current {
+		if s.lastHealth[id] != health {
+			changed = true
+		}
+	}
+	s.lastHealth = current
+	s.healthMu.Unlock()
+
+	if changed {
+		s.notify()
+	}
+}
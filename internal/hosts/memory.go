@@ -0,0 +1,45 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Backends a node can keep its database in, named by the store setting of
+// its config.json. Both are the SQLite Store; they differ only in whether
+// the database is a file.
+const (
+	BackendSQLite = "sqlite" // A SQLite file in the data directory, with backups beside it
+	BackendMemory = "memory" // A SQLite database in memory; nothing survives a restart
+)
+
+// Backends lists the backends Open accepts.
+var Backends = []string{BackendSQLite, BackendMemory}
+
+// ErrInMemory is returned for backups, restores and imports of a store
+// kept in memory, which has no database file to copy or replace.
+var ErrInMemory = errors.New("the store is kept in memory and has no database file")
+
+// Open opens the store of the named backend, BackendSQLite when empty.
+// path names the database file. A store in memory writes nothing there;
+// path only places Dir, where other node-local files are kept.
+//
+// In memory, the node runs as it does from a file, with heartbeats,
+// settings and the audit log, until it stops. That suits embedded
+// deployments with read-only root filesystems, which learn their hosts
+// again from their peers, and tests.
+func Open(backend, path string) (*Store, error) {
+	switch backend {
+	case "", BackendSQLite:
+		return NewStore(path)
+	case BackendMemory:
+		return newStore(path, true)
+	}
+	return nil, fmt.Errorf("unknown store backend %q (want %s)", backend, strings.Join(Backends, " or "))
+}
+
+// NewMemoryStore returns an empty store kept in memory.
+func NewMemoryStore() (*Store, error) {
+	return Open(BackendMemory, "")
+}
@@ -0,0 +1,236 @@
+package hosts
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Metrics sampled for each host every MetricInterval.
+const (
+	MetricUp      = "up"           // 1 while the host is online, degraded, starting or in maintenance; 0 while offline
+	MetricLatency = "latency_ms"   // TCP connect time at the last health check; not sampled before the first
+	MetricLoss    = "loss_percent" // Share of that check's probes that failed
+	MetricDisk    = "disk_percent" // Root filesystem usage from the host's heartbeats; not sampled without them
+)
+
+// Metrics lists the metric names in the order the API shows them.
+var Metrics = []string{MetricUp, MetricLatency, MetricLoss, MetricDisk}
+
+// ValidMetric reports whether name is one of Metrics.
+func ValidMetric(name string) bool {
+	return slices.Contains(Metrics, name)
+}
+
+// MetricInterval is how often RunMetrics samples the hosts.
+const MetricInterval = time.Minute
+
+// metricTier is one resolution metrics are kept at. Each sample is added
+// to a bucket of every tier, so coarser tiers need no rollup job and the
+// table stays bounded at a few thousand rows per host and metric.
+type metricTier struct {
+	step time.Duration
+	keep time.Duration
+}
+
+// metricTiers run from finest to coarsest.
+var metricTiers = []metricTier{
+	{step: time.Minute, keep: 24 * time.Hour},
+	{step: 15 * time.Minute, keep: 14 * 24 * time.Hour},
+	{step: time.Hour, keep: 90 * 24 * time.Hour},
+	{step: 24 * time.Hour, keep: 2 * 365 * 24 * time.Hour},
+}
+
+// MetricRetention is how far back the coarsest tier reaches.
+var MetricRetention = metricTiers[len(metricTiers)-1].keep
+
+// MetricPoint is a bucket of samples of one metric.
+type MetricPoint struct {
+	At    time.Time `json:"at"` // Start of the bucket
+	Count int       `json:"count"`
+	Avg   float64   `json:"avg"`
+	Min   float64   `json:"min"`
+	Max   float64   `json:"max"`
+}
+
+// MetricStep returns the bucket size of the finest tier that still holds
+// samples from since, at now.
+func MetricStep(since, now time.Time) time.Duration {
+	for _, t := range metricTiers {
+		if !since.Before(now.Add(-t.keep)) {
+			return t.step
+		}
+	}
+	return metricTiers[len(metricTiers)-1].step
+}
+
+// RecordMetrics adds one sample of each of values, taken from nodeID at
+// now, to every tier.
+func (s *Store) RecordMetrics(nodeID string, values map[string]float64, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("record metrics: %w", err)
+	}
+	defer tx.Rollback()
+	for metric, v := range values {
+		for _, t := range metricTiers {
+			if _, err := tx.Exec(`INSERT INTO metrics (node_id, metric, step, at, count, sum, min, max)
+				VALUES (?, ?, ?, ?, 1, ?, ?, ?)
+				ON CONFLICT(node_id, metric, step, at) DO UPDATE SET count = count + 1, sum = sum + excluded.sum,
+					min = MIN(min, excluded.min), max = MAX(max, excluded.max)`,
+				nodeID, metric, int64(t.step.Seconds()), sortableTime(now.Truncate(t.step)), v, v, v); err != nil {
+				return fmt.Errorf("record metrics: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// PruneMetrics drops the buckets each tier no longer keeps at now.
+func (s *Store) PruneMetrics(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range metricTiers {
+		if _, err := s.db.Exec(`DELETE FROM metrics WHERE step = ? AND at < ?`,
+			int64(t.step.Seconds()), sortableTime(now.Add(-t.keep).Truncate(t.step))); err != nil {
+			return fmt.Errorf("prune metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// MetricSeries returns the buckets of metric for nodeID from since, oldest
+// first, at the finest tier that reaches back that far.
+func (s *Store) MetricSeries(nodeID, metric string, since, now time.Time) ([]MetricPoint, error) {
+	history, err := s.metricHistory(nodeID, metric, since, now)
+	if err != nil {
+		return nil, err
+	}
+	if points, ok := history[nodeID]; ok {
+		return points, nil
+	}
+	return []MetricPoint{}, nil
+}
+
+// MetricHistory returns the buckets of metric from since for every host,
+// oldest first, by node ID.
+func (s *Store) MetricHistory(metric string, since, now time.Time) (map[string][]MetricPoint, error) {
+	return s.metricHistory("", metric, since, now)
+}
+
+// metricHistory lists the buckets of metric for nodeID, or every node if
+// it is empty.
+func (s *Store) metricHistory(nodeID, metric string, since, now time.Time) (map[string][]MetricPoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	step := MetricStep(since, now)
+	rows, err := s.db.Query(`SELECT node_id, at, count, sum, min, max FROM metrics
+		WHERE (? = '' OR node_id = ?) AND metric = ? AND step = ? AND at >= ? ORDER BY node_id, at`,
+		nodeID, nodeID, metric, int64(step.Seconds()), sortableTime(since.Truncate(step)))
+	if err != nil {
+		return nil, fmt.Errorf("list metrics: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string][]MetricPoint)
+	for rows.Next() {
+		var (
+			id, at string
+			p      MetricPoint
+			sum    float64
+		)
+		if err := rows.Scan(&id, &at, &p.Count, &sum, &p.Min, &p.Max); err != nil {
+			return nil, err
+		}
+		p.At = parseTime(at)
+		if p.Count > 0 {
+			p.Avg = sum / float64(p.Count)
+		}
+		out[id] = append(out[id], p)
+	}
+	return out, rows.Err()
+}
+
+// Uptime returns the share of samples, 0-100, each host was up in since,
+// by node ID. Hosts without samples in the period are left out.
+func (s *Store) Uptime(since, now time.Time) (map[string]float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	step := MetricStep(since, now)
+	rows, err := s.db.Query(`SELECT node_id, SUM(sum), SUM(count) FROM metrics
+		WHERE metric = ? AND step = ? AND at >= ? GROUP BY node_id`,
+		MetricUp, int64(step.Seconds()), sortableTime(since.Truncate(step)))
+	if err != nil {
+		return nil, fmt.Errorf("uptime: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]float64)
+	for rows.Next() {
+		var (
+			id        string
+			up, count float64
+		)
+		if err := rows.Scan(&id, &up, &count); err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			out[id] = up / count * 100
+		}
+	}
+	return out, rows.Err()
+}
+
+// hostMetrics returns the metrics sampled from h, with peer its heartbeat
+// state if it sends any.
+func hostMetrics(h types.Host, peer Peer, hasPeer bool) map[string]float64 {
+	values := map[string]float64{MetricUp: 0}
+	if h.Health != types.HealthOffline {
+		values[MetricUp] = 1
+	}
+	if h.LatencyMS > 0 || h.LossPercent > 0 {
+		values[MetricLatency] = h.LatencyMS
+		values[MetricLoss] = float64(h.LossPercent)
+	}
+	if hasPeer && peer.DiskPercent > 0 {
+		values[MetricDisk] = float64(peer.DiskPercent)
+	}
+	return values
+}
+
+// SampleMetrics records the metrics of every host at now.
+func (s *Store) SampleMetrics(now time.Time) error {
+	s.mu.RLock()
+	peers := s.peersLocked()
+	s.mu.RUnlock()
+	for _, h := range s.GetAll() {
+		peer, ok := peers[h.ID]
+		if err := s.RecordMetrics(h.ID, hostMetrics(h, peer, ok), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunMetrics samples the hosts every MetricInterval and prunes old buckets
+// hourly, until the process exits.
+func (s *Store) RunMetrics() {
+	ticker := time.NewTicker(MetricInterval)
+	defer ticker.Stop()
+	var pruned time.Time
+	for now := range ticker.C {
+		s.SampleMetrics(now)
+		if now.Sub(pruned) >= time.Hour {
+			s.PruneMetrics(now)
+			pruned = now
+		}
+	}
+}
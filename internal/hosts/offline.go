@@ -0,0 +1,179 @@
+package hosts
+
+import (
+	"fmt"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// OfflineEdit is a host edited on this node while it could reach no peer,
+// waiting to be replayed to peers.
+type OfflineEdit struct {
+	HostID   string    `json:"host_id"`
+	EditedAt time.Time `json:"edited_at"` // The latest edit
+}
+
+// SetIsolated records whether this node can reach none of its peers.
+// While it can't, hosts edited locally are buffered in the database, so
+// the edits reach peers once it can again, even across a restart.
+func (s *Store) SetIsolated(isolated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.isolated = isolated
+}
+
+// Isolated reports whether the node was last found unable to reach any peer.
+func (s *Store) Isolated() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.isolated
+}
+
+// bufferEdit records a local edit of hostID while the node is isolated.
+// The caller holds s.mu.
+func (s *Store) bufferEdit(hostID string, edited bool) error {
+	if !edited || !s.isolated {
+		return nil
+	}
+	_, err := s.db.Exec(`INSERT INTO offline_edits (host_id, edited_at) VALUES (?, ?)
+		ON CONFLICT(host_id) DO UPDATE SET edited_at = excluded.edited_at`,
+		hostID, formatTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("buffer offline edit: %w", err)
+	}
+	return nil
+}
+
+// OfflineEdits returns the hosts edited while isolated that have not been
+// replayed yet, oldest edit first.
+func (s *Store) OfflineEdits() ([]OfflineEdit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offlineEditsLocked()
+}
+
+func (s *Store) offlineEditsLocked() ([]OfflineEdit, error) {
+	rows, err := s.db.Query(`SELECT host_id, edited_at FROM offline_edits ORDER BY edited_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list offline edits: %w", err)
+	}
+	defer rows.Close()
+
+	var out []OfflineEdit
+	for rows.Next() {
+		var (
+			e        OfflineEdit
+			editedAt string
+		)
+		if err := rows.Scan(&e.HostID, &editedAt); err != nil {
+			return nil, err
+		}
+		e.EditedAt = parseTime(editedAt)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// ClearOfflineEdit forgets a buffered edit once it has been replayed. The
+// host stays buffered if it was edited again since e was read.
+func (s *Store) ClearOfflineEdit(e OfflineEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.db.Exec(`DELETE FROM offline_edits WHERE host_id = ? AND edited_at = ?`,
+		e.HostID, formatTime(e.EditedAt)); err != nil {
+		return fmt.Errorf("clear offline edit: %w", err)
+	}
+	return nil
+}
+
+// ReplaceFromPeer replaces the host list with one pushed by a peer. Hosts
+// with buffered offline edits are merged with the peer's copy instead, so
+// the edits the peer has not seen survive, and are kept if the peer's list
+// lacks them. Other hosts take the peer's copy with its versions; they
+// are not stamped as local edits.
+func (s *Store) ReplaceFromPeer(list []types.Host) ([]FieldConflict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[string]types.Host)
+	rows, err := s.db.Query(`SELECT ` + hostColumns + ` FROM hosts`)
+	if err != nil {
+		return nil, fmt.Errorf("list hosts: %w", err)
+	}
+	for rows.Next() {
+		h, err := scanHost(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		openHost(s.sealer, &h)
+		current[h.ID] = h
+	}
+	rows.Close()
+	edits, err := s.offlineEditsLocked()
+	if err != nil {
+		return nil, err
+	}
+	buffered := make(map[string]bool, len(edits))
+	for _, e := range edits {
+		buffered[e.HostID] = true
+	}
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin replace: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM hosts`); err != nil {
+		return nil, fmt.Errorf("truncate hosts: %w", err)
+	}
+
+	var conflicts []FieldConflict
+	for _, host := range list {
+		if host.ID == "" {
+			continue // Peers always send IDs; there is nothing to merge by
+		}
+		local, exists := current[host.ID]
+		switch {
+		case exists && buffered[host.ID]:
+			var c []FieldConflict
+			host, c = mergeHost(local, host)
+			conflicts = append(conflicts, c...)
+		case exists:
+			stamp(&local, &host, "")
+		default:
+			stamp(nil, &host, "")
+		}
+		delete(current, host.ID)
+		args, err := seal.hostArgs(host)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(hostInsert, args...); err != nil {
+			return nil, fmt.Errorf("insert host during replace: %w", err)
+		}
+	}
+	for id, local := range current {
+		if !buffered[id] {
+			continue
+		}
+		args, err := seal.hostArgs(local)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(hostInsert, args...); err != nil {
+			return nil, fmt.Errorf("keep offline edit of %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit replace: %w", err)
+	}
+	s.notify()
+	return conflicts, nil
+}
@@ -0,0 +1,117 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPatchStatusNotFound is returned for a node that has not reported its
+// OS updates.
+var ErrPatchStatusNotFound = errors.New("no patch status for node")
+
+// Upgrade run states.
+const (
+	UpgradeRunning   = "running"
+	UpgradeSucceeded = "succeeded"
+	UpgradeFailed    = "failed"
+)
+
+// UpgradeRun is the last OS upgrade a node ran.
+type UpgradeRun struct {
+	State      string    `json:"state"` // UpgradeRunning, UpgradeSucceeded or UpgradeFailed
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Error      string    `json:"error,omitempty"`
+	Reboot     bool      `json:"reboot,omitempty"` // Reboot afterwards if the upgrade requires it
+}
+
+// PatchStatus is the OS update state a node reports in its heartbeats.
+type PatchStatus struct {
+	Pending        int         `json:"pending"`                   // Packages apt would upgrade
+	Security       int         `json:"security"`                  // Of those, the ones from a security suite
+	RebootRequired bool        `json:"reboot_required,omitempty"` // An installed update needs a reboot to take effect
+	CheckedAt      time.Time   `json:"checked_at,omitzero"`       // When the node last asked apt; zero if apt is unavailable
+	Upgrade        *UpgradeRun `json:"upgrade,omitempty"`         // The node's last upgrade, if any
+	ReportedAt     time.Time   `json:"reported_at,omitzero"`      // When the receiver last heard it; set by PutPatchStatus
+}
+
+const patchColumns = `node_id, pending, security, reboot_required, checked_at,
+	upgrade_state, upgrade_started, upgrade_finished, upgrade_error, upgrade_reboot, reported_at`
+
+// PutPatchStatus records the OS update state nodeID reported at now.
+func (s *Store) PutPatchStatus(nodeID string, p PatchStatus, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var run UpgradeRun
+	if p.Upgrade != nil {
+		run = *p.Upgrade
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO patch_status (`+patchColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nodeID, p.Pending, p.Security, p.RebootRequired, formatTime(p.CheckedAt),
+		run.State, formatTime(run.StartedAt), formatTime(run.FinishedAt), run.Error, run.Reboot,
+		formatTime(now))
+	if err != nil {
+		return fmt.Errorf("write patch status: %w", err)
+	}
+	return nil
+}
+
+// GetPatchStatus returns the OS update state nodeID last reported.
+func (s *Store) GetPatchStatus(nodeID string) (PatchStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, p, err := scanPatchStatus(s.db.QueryRow(`SELECT `+patchColumns+` FROM patch_status WHERE node_id = ?`, nodeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return PatchStatus{}, ErrPatchStatusNotFound
+	}
+	return p, err
+}
+
+// ListPatchStatus returns the OS update state of every node that has
+// reported one, by node ID.
+func (s *Store) ListPatchStatus() (map[string]PatchStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT ` + patchColumns + ` FROM patch_status`)
+	if err != nil {
+		return nil, fmt.Errorf("list patch status: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]PatchStatus)
+	for rows.Next() {
+		id, p, err := scanPatchStatus(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = p
+	}
+	return out, rows.Err()
+}
+
+func scanPatchStatus(scanner interface{ Scan(dest ...any) error }) (string, PatchStatus, error) {
+	var (
+		id                                  string
+		p                                   PatchStatus
+		run                                 UpgradeRun
+		checkedAt, started, finished, repAt sql.NullString
+	)
+	if err := scanner.Scan(&id, &p.Pending, &p.Security, &p.RebootRequired, &checkedAt,
+		&run.State, &started, &finished, &run.Error, &run.Reboot, &repAt); err != nil {
+		return "", PatchStatus{}, err
+	}
+	p.CheckedAt = parseTime(checkedAt.String)
+	p.ReportedAt = parseTime(repAt.String)
+	if run.State != "" {
+		run.StartedAt = parseTime(started.String)
+		run.FinishedAt = parseTime(finished.String)
+		p.Upgrade = &run
+	}
+	return id, p, nil
+}
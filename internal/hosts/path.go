@@ -0,0 +1,97 @@
+package hosts
+
+import (
+	"net"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Network names the route used to reach a host.
+type Network string
+
+const (
+	NetworkLAN Network = "lan"
+	NetworkVPN Network = "vpn"
+)
+
+// Path is the route outbound calls to a host should take.
+type Path struct {
+	Network Network          `json:"network"`
+	Address string           `json:"address"`
+	Status  types.HostStatus `json:"status"` // Last health check result on this network
+	Forced  bool             `json:"forced"` // Chosen by the host's path preference rather than reachability
+}
+
+// Healthy reports whether the last check on this path found NSM healthy.
+func (p Path) Healthy() bool {
+	return p.Status == types.StatusHealthy
+}
+
+// SelectPath picks the route to host. A LAN or VPN preference on the host
+// wins. Otherwise the LAN is used unless the last LAN check could not reach
+// the host while the VPN check could.
+func SelectPath(host types.Host) Path {
+	lan := Path{Network: NetworkLAN, Address: host.IPAddress, Status: host.Status}
+	if host.VPNIPAddress == "" {
+		return lan
+	}
+	vpn := Path{Network: NetworkVPN, Address: host.VPNIPAddress, Status: host.StatusVPN}
+
+	switch host.PathPreference {
+	case types.PathLAN:
+		lan.Forced = true
+		return lan
+	case types.PathVPN:
+		vpn.Forced = true
+		return vpn
+	}
+
+	if !reachable(host.Status) && reachable(host.StatusVPN) {
+		return vpn
+	}
+	return lan
+}
+
+// PreferredAddress returns the address outbound calls to host should use.
+func PreferredAddress(host types.Host) string {
+	return SelectPath(host).Address
+}
+
+// ValidPathPreference reports whether p is a preference SelectPath knows.
+func ValidPathPreference(p types.PathPreference) bool {
+	switch p {
+	case types.PathAuto, types.PathLAN, types.PathVPN:
+		return true
+	}
+	return false
+}
+
+// reachable reports whether a check got as far as a TCP connection.
+func reachable(status types.HostStatus) bool {
+	switch status {
+	case types.StatusHealthy, types.StatusStale, types.StatusUnhealthy:
+		return true
+	}
+	return false
+}
+
+// ResolveAddress maps a host's LAN address, optionally with a port, to the
+// address that currently reaches it. Unknown addresses are returned as is.
+func (s *Store) ResolveAddress(addr string) string {
+	ip, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		ip, port = addr, ""
+	}
+	host, err := s.GetByIP(ip)
+	if err != nil {
+		return addr
+	}
+	preferred := PreferredAddress(*host)
+	if preferred == ip {
+		return addr
+	}
+	if port != "" {
+		return net.JoinHostPort(preferred, port)
+	}
+	return preferred
+}
@@ -0,0 +1,220 @@
+package hosts
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/types"
+)
+
+var (
+	// ErrPeerNotFound is returned when no heartbeat has been accepted from a node.
+	ErrPeerNotFound = errors.New("peer not found")
+	// ErrFingerprintMismatch is returned when a key confirmed by its
+	// fingerprint is not the one pinned.
+	ErrFingerprintMismatch = errors.New("fingerprint does not match the pinned key")
+)
+
+// Peer is the heartbeat state of another NSM node. PublicKey is pinned on
+// the first accepted heartbeat; later heartbeats must be signed by the same
+// key until the peer is forgotten. The key signs requests to this node only
+// once an admin has confirmed it (see Trusted).
+type Peer struct {
+	NodeID      string    `json:"node_id"`
+	PublicKey   string    `json:"public_key"`
+	Hostname    string    `json:"hostname,omitempty"`
+	Address     string    `json:"address,omitempty"` // Source address of the last heartbeat
+	Version     string    `json:"version,omitempty"`
+	BootedAt    time.Time `json:"booted_at,omitzero"`
+	SentAt      time.Time `json:"sent_at,omitzero"`
+	Seq         uint64    `json:"seq"`
+	Maintenance bool      `json:"maintenance,omitempty"`
+	FirstSeen   time.Time `json:"first_seen,omitzero"`
+	LastSeen    time.Time `json:"last_seen,omitzero"`
+	DiskPercent int       `json:"disk_percent,omitempty"` // Root filesystem usage reported by the peer
+	TimeSync    string    `json:"time_sync,omitempty"`    // NTP state reported by the peer (types.TimeSyncSynced or TimeSyncUnsynced)
+	Stratum     int       `json:"stratum,omitempty"`      // NTP stratum reported by the peer, 0 if unknown
+	Throttled   *uint32   `json:"throttled,omitempty"`    // Raw "vcgencmd get_throttled" bits reported by the peer; nil off a Pi
+	Links       []Link    `json:"links,omitempty"`        // The peer's view of the other hosts, from its last heartbeat
+	HostCount   int       `json:"host_count,omitempty"`   // Hosts in the peer's list at its last heartbeat
+	HostsDigest string    `json:"hosts_digest,omitempty"` // ListDigest of the peer's list at its last heartbeat; empty from older versions
+	TrustedBy   string    `json:"trusted_by,omitempty"`   // Admin who confirmed the pinned key; see TrustPeer
+	TrustedAt   time.Time `json:"trusted_at,omitzero"`
+}
+
+// Trusted reports whether an admin has confirmed the peer's pinned key.
+// Heartbeats pin a key on first use, so only a confirmed key may sign
+// requests that act on this node.
+func (p Peer) Trusted() bool {
+	return !p.TrustedAt.IsZero()
+}
+
+// Liveness returns the inputs DetermineHealth needs.
+func (p Peer) Liveness() types.Liveness {
+	return types.Liveness{
+		LastSeen:    p.LastSeen,
+		BootedAt:    p.BootedAt,
+		SentAt:      p.SentAt,
+		Maintenance: p.Maintenance,
+	}
+}
+
+const peerColumns = `node_id, public_key, hostname, address, version, booted_at, sent_at, seq, maintenance, first_seen, last_seen, disk_percent, time_sync, stratum, throttled, links, host_count, hosts_digest, trusted_by, trusted_at`
+
+// PutPeer records a peer's latest heartbeat. A stored confirmation of the
+// peer's key is kept while the key stays the same, whatever p says, so a
+// heartbeat cannot undo a TrustPeer it raced with.
+func (s *Store) PutPeer(p Peer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.FirstSeen.IsZero() {
+		p.FirstSeen = p.LastSeen
+	}
+	var links []byte
+	if len(p.Links) > 0 {
+		var err error
+		if links, err = json.Marshal(p.Links); err != nil {
+			return fmt.Errorf("encode peer links: %w", err)
+		}
+	}
+	_, err := s.db.Exec(`INSERT INTO peers (`+peerColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (node_id) DO UPDATE SET
+			hostname = excluded.hostname, address = excluded.address, version = excluded.version,
+			booted_at = excluded.booted_at, sent_at = excluded.sent_at, seq = excluded.seq,
+			maintenance = excluded.maintenance, first_seen = excluded.first_seen, last_seen = excluded.last_seen,
+			disk_percent = excluded.disk_percent, time_sync = excluded.time_sync, stratum = excluded.stratum,
+			throttled = excluded.throttled, links = excluded.links, host_count = excluded.host_count,
+			hosts_digest = excluded.hosts_digest,
+			trusted_by = CASE WHEN public_key = excluded.public_key THEN trusted_by ELSE excluded.trusted_by END,
+			trusted_at = CASE WHEN public_key = excluded.public_key THEN trusted_at ELSE excluded.trusted_at END,
+			public_key = excluded.public_key`,
+		p.NodeID, p.PublicKey, p.Hostname, p.Address, p.Version,
+		formatTime(p.BootedAt), formatTime(p.SentAt), int64(p.Seq), p.Maintenance,
+		formatTime(p.FirstSeen), formatTime(p.LastSeen), p.DiskPercent, p.TimeSync, p.Stratum, p.Throttled, string(links), p.HostCount, p.HostsDigest,
+		p.TrustedBy, formatTime(p.TrustedAt))
+	if err != nil {
+		return fmt.Errorf("write peer: %w", err)
+	}
+	return nil
+}
+
+// GetPeer returns the heartbeat state of one node.
+func (s *Store) GetPeer(nodeID string) (Peer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getPeerLocked(nodeID)
+}
+
+func (s *Store) getPeerLocked(nodeID string) (Peer, error) {
+	p, err := scanPeer(s.db.QueryRow(`SELECT `+peerColumns+` FROM peers WHERE node_id = ?`, nodeID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Peer{}, ErrPeerNotFound
+	}
+	return p, err
+}
+
+// ListPeers returns every node a heartbeat has been accepted from.
+func (s *Store) ListPeers() ([]Peer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT ` + peerColumns + ` FROM peers ORDER BY hostname, node_id`)
+	if err != nil {
+		return nil, fmt.Errorf("list peers: %w", err)
+	}
+	defer rows.Close()
+
+	peers := []Peer{}
+	for rows.Next() {
+		p, err := scanPeer(rows)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, p)
+	}
+	return peers, rows.Err()
+}
+
+// TrustPeer records that by confirmed the pinned key of a node, whose
+// fingerprint (see identity.Fingerprint) the admin compared with the one
+// the node itself shows. It fails with ErrFingerprintMismatch if the
+// pinned key is another.
+func (s *Store) TrustPeer(nodeID, fingerprint, by string, now time.Time) (Peer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := s.getPeerLocked(nodeID)
+	if err != nil {
+		return Peer{}, err
+	}
+	pub, err := base64.StdEncoding.DecodeString(p.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize || identity.Fingerprint(pub) != strings.TrimSpace(fingerprint) {
+		return Peer{}, ErrFingerprintMismatch
+	}
+	p.TrustedBy, p.TrustedAt = by, now.UTC()
+	if _, err := s.db.Exec(`UPDATE peers SET trusted_by = ?, trusted_at = ? WHERE node_id = ? AND public_key = ?`,
+		p.TrustedBy, formatTime(p.TrustedAt), p.NodeID, p.PublicKey); err != nil {
+		return Peer{}, fmt.Errorf("trust peer: %w", err)
+	}
+	return p, nil
+}
+
+// DeletePeer forgets a node, unpinning its key.
+func (s *Store) DeletePeer(nodeID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`DELETE FROM peers WHERE node_id = ?`, nodeID)
+	if err != nil {
+		return fmt.Errorf("delete peer: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPeerNotFound
+	}
+	return nil
+}
+
+func scanPeer(scanner interface{ Scan(dest ...any) error }) (Peer, error) {
+	var (
+		p                                     Peer
+		hostname, address, version, timeSync  sql.NullString
+		links, hostsDigest, trustedBy         sql.NullString
+		bootedAt, sentAt, firstSeen, lastSeen sql.NullString
+		trustedAt                             sql.NullString
+		seq                                   int64
+		throttled                             sql.NullInt64
+	)
+	if err := scanner.Scan(&p.NodeID, &p.PublicKey, &hostname, &address, &version,
+		&bootedAt, &sentAt, &seq, &p.Maintenance, &firstSeen, &lastSeen, &p.DiskPercent, &timeSync, &p.Stratum, &throttled, &links, &p.HostCount, &hostsDigest, &trustedBy, &trustedAt); err != nil {
+		return Peer{}, err
+	}
+	p.Hostname = hostname.String
+	p.Address = address.String
+	p.Version = version.String
+	p.TimeSync = timeSync.String
+	p.HostsDigest = hostsDigest.String
+	p.TrustedBy = trustedBy.String
+	p.TrustedAt = parseTime(trustedAt.String)
+	p.BootedAt = parseTime(bootedAt.String)
+	p.SentAt = parseTime(sentAt.String)
+	p.Seq = uint64(seq)
+	if throttled.Valid {
+		bits := uint32(throttled.Int64)
+		p.Throttled = &bits
+	}
+	p.FirstSeen = parseTime(firstSeen.String)
+	p.LastSeen = parseTime(lastSeen.String)
+	if links.String != "" {
+		json.Unmarshal([]byte(links.String), &p.Links)
+	}
+	return p, nil
+}
@@ -0,0 +1,71 @@
+package hosts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Playback states of a node's built-in player.
+const (
+	PlaybackIdle    = "idle"    // The player is off or has nothing to play
+	PlaybackPlaying = "playing" // An asset is on screen
+	PlaybackError   = "error"   // The browser or video player could not start
+)
+
+// playbackTTL is how long a reported playback state holds. Nodes report it
+// in every heartbeat, so an older one is from a node that went quiet.
+const playbackTTL = 2 * time.Minute
+
+// Playback is what a node's built-in player is showing, as it reports in
+// its heartbeats.
+type Playback struct {
+	State      string    `json:"state"` // PlaybackIdle, PlaybackPlaying or PlaybackError
+	Asset      string    `json:"asset,omitempty"`
+	MimeType   string    `json:"mimetype,omitempty"`
+	Index      int       `json:"index,omitempty"` // Of Asset in the playlist, from 1
+	Count      int       `json:"count,omitempty"` // Assets in the playlist that can play now
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	Until      time.Time `json:"until,omitzero"` // Zero while a video plays to its end
+	Error      string    `json:"error,omitempty"`
+	ReportedAt time.Time `json:"reported_at,omitzero"` // When the receiver last heard it; set by RecordPlayback
+}
+
+// Summary describes p in a few words, e.g. "Welcome (2/5)".
+func (p Playback) Summary() string {
+	switch p.State {
+	case PlaybackPlaying:
+		return fmt.Sprintf("%s (%d/%d)", p.Asset, p.Index, p.Count)
+	case PlaybackError:
+		return "Player error: " + p.Error
+	}
+	return ""
+}
+
+// playbackLog holds the last playback state of each node, by node ID.
+// Like heartbeat details that change every few seconds, it is kept in
+// memory.
+type playbackLog struct {
+	mu     sync.Mutex
+	byNode map[string]Playback
+}
+
+// RecordPlayback stores the playback state nodeID reported at now.
+func (s *Store) RecordPlayback(nodeID string, p Playback, now time.Time) {
+	p.ReportedAt = now.UTC()
+	s.playbacks.mu.Lock()
+	defer s.playbacks.mu.Unlock()
+	s.playbacks.byNode[nodeID] = p
+}
+
+// PlaybackOf returns the playback state nodeID last reported, and false if
+// it has not reported one lately.
+func (s *Store) PlaybackOf(nodeID string, now time.Time) (Playback, bool) {
+	s.playbacks.mu.Lock()
+	defer s.playbacks.mu.Unlock()
+	p, ok := s.playbacks.byNode[nodeID]
+	if !ok || now.Sub(p.ReportedAt) > playbackTTL {
+		return Playback{}, false
+	}
+	return p, true
+}
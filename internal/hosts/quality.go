@@ -0,0 +1,152 @@
+package hosts
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Probing and history limits for network quality.
+const (
+	QualityProbes     = 5           // TCP connects per health check, including the reachability check
+	qualityTimeout    = time.Second // Per probe; a SYN retransmit takes about this long, so it counts as lost
+	MaxQualitySamples = 120         // Per host and network
+	qualityMaxAge     = 7 * 24 * time.Hour
+)
+
+// QualitySample is one health check's view of the network path from this
+// node to a host. Latency is the mean TCP connect time to NSM over the
+// probes that answered, so it needs no raw sockets; loss is the share that
+// did not.
+type QualitySample struct {
+	At          time.Time `json:"at"`
+	Network     Network   `json:"network"`
+	LatencyMS   float64   `json:"latency_ms"`
+	LossPercent int       `json:"loss_percent"`
+}
+
+// QualitySummary condenses a host's recent samples on one network.
+type QualitySummary struct {
+	Samples        int     `json:"samples"`
+	AvgLatencyMS   float64 `json:"avg_latency_ms"`
+	MaxLatencyMS   float64 `json:"max_latency_ms"`
+	AvgLossPercent float64 `json:"avg_loss_percent"`
+}
+
+// qualityLog keeps recent samples in memory by host ID. They describe this
+// node's own view of the network, so they are not stored or replicated,
+// and a restart starts the history afresh.
+type qualityLog struct {
+	mu      sync.Mutex
+	samples map[string][]QualitySample
+}
+
+func (q *qualityLog) add(hostID string, s QualitySample) {
+	if hostID == "" {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Drop samples past qualityMaxAge, then the oldest on s.Network until
+	// there is room for s.
+	list := q.samples[hostID]
+	cutoff := s.At.Add(-qualityMaxAge)
+	same := 0
+	for _, old := range list {
+		if old.Network == s.Network && !old.At.Before(cutoff) {
+			same++
+		}
+	}
+	kept := list[:0]
+	for _, old := range list {
+		if old.At.Before(cutoff) {
+			continue
+		}
+		if old.Network == s.Network && same >= MaxQualitySamples {
+			same--
+			continue
+		}
+		kept = append(kept, old)
+	}
+	q.samples[hostID] = append(kept, s)
+}
+
+// QualityHistory returns the samples recorded for a host, oldest first,
+// optionally limited to one network.
+func (s *Store) QualityHistory(hostID string, network Network) []QualitySample {
+	s.quality.mu.Lock()
+	defer s.quality.mu.Unlock()
+
+	out := []QualitySample{}
+	for _, q := range s.quality.samples[hostID] {
+		if network == "" || q.Network == network {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// forget drops a host's history, e.g. when it is deleted.
+func (q *qualityLog) forget(hostID string) {
+	q.mu.Lock()
+	delete(q.samples, hostID)
+	q.mu.Unlock()
+}
+
+// latest returns the most recent sample for a host on a network.
+func (q *qualityLog) latest(hostID string, network Network) (QualitySample, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := q.samples[hostID]
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Network == network {
+			return list[i], true
+		}
+	}
+	return QualitySample{}, false
+}
+
+// Summarize averages samples. Latency only counts samples where some probe
+// answered.
+func Summarize(samples []QualitySample) QualitySummary {
+	var sum QualitySummary
+	var latencySum, lossSum float64
+	answered := 0
+	for _, s := range samples {
+		lossSum += float64(s.LossPercent)
+		if s.LossPercent < 100 {
+			answered++
+			latencySum += s.LatencyMS
+			sum.MaxLatencyMS = max(sum.MaxLatencyMS, s.LatencyMS)
+		}
+	}
+	sum.Samples = len(samples)
+	if answered > 0 {
+		sum.AvgLatencyMS = latencySum / float64(answered)
+	}
+	if len(samples) > 0 {
+		sum.AvgLossPercent = lossSum / float64(len(samples))
+	}
+	return sum
+}
+
+// probeQuality makes the remaining QualityProbes connects to addr after a
+// first one that took first, and returns the mean connect time in
+// milliseconds of those that succeeded and the percentage that failed.
+func probeQuality(addr string, first time.Duration) (float64, int) {
+	total, ok := first, 1
+	for i := 1; i < QualityProbes; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, qualityTimeout)
+		if err != nil {
+			continue
+		}
+		total += time.Since(start)
+		ok++
+		conn.Close()
+	}
+	latency := float64(total.Microseconds()) / 1000 / float64(ok)
+	return latency, (QualityProbes - ok) * 100 / QualityProbes
+}
@@ -0,0 +1,126 @@
+package hosts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrQuarantineNotFound is returned for an unknown quarantine entry.
+var ErrQuarantineNotFound = errors.New("quarantined announcement not found")
+
+// maxQuarantine bounds the quarantine, so an unknown sender cannot fill
+// the database. The oldest entries are dropped first.
+const maxQuarantine = 200
+
+// Quarantined is a host announcement held until an admin approves or
+// rejects it, because its sender is not a known node.
+type Quarantined struct {
+	ID         int64      `json:"id"`
+	SenderID   string     `json:"sender_id,omitempty"`  // Empty for unsigned announcements
+	SenderKey  string     `json:"sender_key,omitempty"` // Base64 Ed25519 key the announcement was signed with
+	RemoteAddr string     `json:"remote_addr"`
+	Reason     string     `json:"reason"`
+	Host       types.Host `json:"host"`
+	ReceivedAt time.Time  `json:"received_at"`
+}
+
+// Quarantine holds an announcement. A newer announcement of the same host
+// from the same sender replaces the one held.
+func (s *Store) Quarantine(q Quarantined) error {
+	data, err := json.Marshal(q.Host)
+	if err != nil {
+		return fmt.Errorf("encode quarantined host: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM quarantine WHERE sender_id = ? AND host_id = ?`, q.SenderID, q.Host.ID); err != nil {
+		return fmt.Errorf("replace quarantined announcement: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO quarantine (sender_id, sender_key, remote_addr, reason, host_id, host, received_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		q.SenderID, q.SenderKey, q.RemoteAddr, q.Reason, q.Host.ID, string(data), formatTime(q.ReceivedAt)); err != nil {
+		return fmt.Errorf("quarantine announcement: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM quarantine WHERE id NOT IN
+		(SELECT id FROM quarantine ORDER BY id DESC LIMIT ?)`, maxQuarantine); err != nil {
+		return fmt.Errorf("trim quarantine: %w", err)
+	}
+	return tx.Commit()
+}
+
+// ListQuarantine returns the held announcements, newest first.
+func (s *Store) ListQuarantine() ([]Quarantined, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT id, sender_id, sender_key, remote_addr, reason, host, received_at
+		FROM quarantine ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	list := []Quarantined{}
+	for rows.Next() {
+		q, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, q)
+	}
+	return list, rows.Err()
+}
+
+// TakeQuarantined removes a held announcement and returns it, for the
+// caller to apply or drop.
+func (s *Store) TakeQuarantined(id int64) (Quarantined, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := scanQuarantined(s.db.QueryRow(`SELECT id, sender_id, sender_key, remote_addr, reason, host, received_at
+		FROM quarantine WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Quarantined{}, ErrQuarantineNotFound
+	}
+	if err != nil {
+		return Quarantined{}, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM quarantine WHERE id = ?`, id); err != nil {
+		return Quarantined{}, fmt.Errorf("remove quarantined announcement: %w", err)
+	}
+	return q, nil
+}
+
+func scanQuarantined(scanner interface{ Scan(dest ...any) error }) (Quarantined, error) {
+	var (
+		q                                 Quarantined
+		senderID, senderKey, addr, reason sql.NullString
+		receivedAt                        sql.NullString
+		host                              string
+	)
+	if err := scanner.Scan(&q.ID, &senderID, &senderKey, &addr, &reason, &host, &receivedAt); err != nil {
+		return Quarantined{}, err
+	}
+	if err := json.Unmarshal([]byte(host), &q.Host); err != nil {
+		return Quarantined{}, fmt.Errorf("decode quarantined host: %w", err)
+	}
+	q.SenderID = senderID.String
+	q.SenderKey = senderKey.String
+	q.RemoteAddr = addr.String
+	q.Reason = reason.String
+	q.ReceivedAt = parseTime(receivedAt.String)
+	return q, nil
+}
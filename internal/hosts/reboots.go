@@ -0,0 +1,101 @@
+package hosts
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// How a node's previous boot ended.
+const (
+	ShutdownClean      = "clean"
+	ShutdownUnexpected = "unexpected" // Power loss, a crash or a watchdog reset
+)
+
+// rebootHistoryLimit is how long reboot events are kept.
+const rebootHistoryLimit = 365 * 24 * time.Hour
+
+// BootReport is how a node's current OS boot started, as the node reports
+// it in its heartbeats.
+type BootReport struct {
+	BootID       string    `json:"boot_id"`                 // The kernel's boot ID, new on every OS boot
+	BootedAt     time.Time `json:"booted_at"`               // When the OS booted, by the node's clock
+	Shutdown     string    `json:"shutdown,omitempty"`      // How the previous boot ended (ShutdownClean ...); empty if unknown
+	Evidence     string    `json:"evidence,omitempty"`      // What Shutdown is based on: "journal" or "nsm"
+	UnderVoltage bool      `json:"under_voltage,omitempty"` // The previous boot's kernel log reported under-voltage
+}
+
+// RebootEvent is a boot of a node, recorded when its first heartbeat from
+// that boot arrived.
+type RebootEvent struct {
+	NodeID string `json:"node_id"`
+	BootReport
+	LastSeen   time.Time `json:"last_seen,omitzero"` // Last heartbeat received from the node before it booted; zero if none
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// Downtime is how long the node was silent across the reboot, or zero if
+// that is unknown.
+func (e RebootEvent) Downtime() time.Duration {
+	if e.LastSeen.IsZero() || e.BootedAt.Before(e.LastSeen) {
+		return 0
+	}
+	return e.BootedAt.Sub(e.LastSeen)
+}
+
+const rebootColumns = `node_id, boot_id, booted_at, shutdown, evidence, under_voltage, last_seen, recorded_at`
+
+// RecordBoot records b, reported by nodeID, unless that boot is already
+// recorded. lastSeen is when the node was last heard from before. It
+// returns whether the boot was new.
+func (s *Store) RecordBoot(nodeID string, b BootReport, lastSeen, now time.Time) (bool, error) {
+	if b.BootID == "" {
+		return false, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`INSERT OR IGNORE INTO reboots (`+rebootColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		nodeID, b.BootID, formatTime(b.BootedAt), b.Shutdown, b.Evidence, b.UnderVoltage, formatTime(lastSeen), sortableTime(now))
+	if err != nil {
+		return false, fmt.Errorf("record reboot: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := s.db.Exec(`DELETE FROM reboots WHERE node_id = ? AND recorded_at < ?`, nodeID, sortableTime(now.Add(-rebootHistoryLimit))); err != nil {
+		return true, fmt.Errorf("prune reboots: %w", err)
+	}
+	return true, nil
+}
+
+// ListReboots returns the boots recorded since since, newest first, for
+// nodeID or, if it is empty, for every node.
+func (s *Store) ListReboots(nodeID string, since time.Time) ([]RebootEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT `+rebootColumns+` FROM reboots
+		WHERE (? = '' OR node_id = ?) AND recorded_at >= ? ORDER BY recorded_at DESC`, nodeID, nodeID, sortableTime(since))
+	if err != nil {
+		return nil, fmt.Errorf("list reboots: %w", err)
+	}
+	defer rows.Close()
+
+	out := []RebootEvent{}
+	for rows.Next() {
+		var (
+			e                  RebootEvent
+			bootedAt, lastSeen sql.NullString
+			recordedAt         string
+		)
+		if err := rows.Scan(&e.NodeID, &e.BootID, &bootedAt, &e.Shutdown, &e.Evidence, &e.UnderVoltage, &lastSeen, &recordedAt); err != nil {
+			return nil, err
+		}
+		e.BootedAt = parseTime(bootedAt.String)
+		e.LastSeen = parseTime(lastSeen.String)
+		e.RecordedAt = parseTime(recordedAt)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
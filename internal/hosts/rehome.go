@@ -0,0 +1,76 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+)
+
+// AuditIPChanged is the audit action recorded when a host is re-homed.
+const AuditIPChanged = "host.ip_changed"
+
+// SameSubnet reports whether two IPv4 addresses share a /24, the range a
+// display's DHCP lease moves within. NSM treats a venue network as a /24
+// elsewhere too, e.g. when choosing peers to push to.
+func SameSubnet(a, b string) bool {
+	ipA, ipB := net.ParseIP(a).To4(), net.ParseIP(b).To4()
+	if ipA == nil || ipB == nil {
+		return false
+	}
+	mask := net.CIDRMask(24, 32)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+// Rehome moves the host with id to ip, where its identity was confirmed
+// by via (e.g. "heartbeat"). The record keeps its ID, so its nickname,
+// notes, credentials, heartbeat state and quality history carry over.
+// Another host listed at ip is deleted if it has never sent a heartbeat,
+// as it is most likely the same display seen as new; if it has, the move is
+// refused and the two show as a conflict. The change is recorded in the
+// audit log. Rehome reports whether the host moved.
+func (s *Store) Rehome(id, ip, via string) (bool, error) {
+	host, err := s.GetByID(id)
+	if err != nil {
+		return false, err
+	}
+	if host.IPAddress == ip {
+		return false, nil
+	}
+
+	peers, err := s.ListPeers()
+	if err != nil {
+		return false, err
+	}
+	var stale []string
+	for _, other := range s.GetAll() {
+		if other.ID == id || other.IPAddress != ip {
+			continue
+		}
+		for _, p := range peers {
+			if p.NodeID == other.ID {
+				return false, fmt.Errorf("%s is held by node %s, which sends its own heartbeats", ip, other.ID)
+			}
+		}
+		stale = append(stale, other.ID)
+	}
+	for _, otherID := range stale {
+		if err := s.DeleteByID(otherID); err != nil {
+			return false, err
+		}
+	}
+
+	old := host.IPAddress
+	host.MoveTo(ip)
+	s.ResetBackoff(id) // Failures were at the old address
+	if err := s.Upsert(*host); err != nil {
+		return false, err
+	}
+
+	detail := fmt.Sprintf("%s -> %s (%s)", old, ip, via)
+	if len(stale) > 0 {
+		detail += fmt.Sprintf(", replaced %d stale record(s)", len(stale))
+	}
+	if err := s.AppendAudit(AuditEntry{Actor: "nsm", ActorType: ActorSystem, Action: AuditIPChanged, Target: id, Detail: detail}); err != nil {
+		return true, err
+	}
+	return true, nil
+}
@@ -0,0 +1,171 @@
+package hosts
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Name resolution for hosts listed by DNS name rather than IP.
+const (
+	ResolveInterval = 5 * time.Minute // How long a lookup is reused before it is repeated
+	resolveTimeout  = 3 * time.Second
+)
+
+// hostnamePattern matches DNS names such as venue-display-03.lan: dot
+// separated labels of letters, digits and inner hyphens.
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*\.?$`)
+
+// IsHostname reports whether a host address is a DNS name, not an IP.
+func IsHostname(addr string) bool {
+	return addr != "" && net.ParseIP(addr) == nil
+}
+
+// numericPattern matches values that can only be meant as an IPv4 address.
+var numericPattern = regexp.MustCompile(`^[0-9.]+$`)
+
+// ValidAddress reports whether addr can be a host address: an IPv4
+// literal or a DNS name. A mistyped IP such as 192.168.1.300 is not taken
+// for a name.
+func ValidAddress(addr string) bool {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.To4() != nil
+	}
+	return len(addr) <= 253 && !numericPattern.MatchString(addr) && hostnamePattern.MatchString(addr)
+}
+
+// resolution is the last lookup of a name. A failed lookup keeps the IP
+// from the last one that succeeded, so a brief DNS outage does not take
+// every named host offline.
+type resolution struct {
+	ip  string
+	err error
+	at  time.Time
+}
+
+// nameCache holds lookups by name. Like network quality, it is this node's
+// own view, kept in memory only.
+type nameCache struct {
+	mu      sync.Mutex
+	entries map[string]resolution
+}
+
+// lookupIP is replaced in tests.
+var lookupIP = func(ctx context.Context, name string) ([]net.IP, error) {
+	return net.DefaultResolver.LookupIP(ctx, "ip", name)
+}
+
+// Resolve returns the IP for a host address. IP literals are returned
+// unchanged; names are looked up at most once per ResolveInterval. When
+// the lookup fails the last IP found is returned along with the error, or
+// "" if there has never been one.
+func (s *Store) Resolve(addr string) (string, error) {
+	if !IsHostname(addr) {
+		return addr, nil
+	}
+	s.names.mu.Lock()
+	r, ok := s.names.entries[addr]
+	s.names.mu.Unlock()
+	if ok && time.Since(r.at) < ResolveInterval {
+		return r.ip, r.err
+	}
+	r = s.names.refresh(addr)
+	return r.ip, r.err
+}
+
+// refresh looks a name up now and caches the result.
+func (c *nameCache) refresh(name string) resolution {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	ips, err := lookupIP(ctx, name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := resolution{ip: c.entries[name].ip, err: err, at: time.Now()}
+	if err == nil && len(ips) > 0 {
+		r.ip = preferIPv4(ips)
+	}
+	c.entries[name] = r
+	return r
+}
+
+// preferIPv4 picks the first IPv4 address, as venue networks rarely route
+// IPv6 to displays, or the first address when there is none.
+func preferIPv4(ips []net.IP) string {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String()
+		}
+	}
+	return ips[0].String()
+}
+
+// cached returns the last lookup of a name without making one.
+func (c *nameCache) cached(name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.entries[name]
+	if !ok {
+		return "", nil
+	}
+	return r.ip, r.err
+}
+
+// apply sets the resolved IPs of a host listed by name from the cache. It
+// runs on every host read, so it never makes a lookup itself.
+func (c *nameCache) apply(host *types.Host) {
+	host.ResolvedIP, host.ResolvedVPNIP, host.ResolveError = "", "", ""
+	for _, a := range []struct {
+		addr     string
+		resolved *string
+	}{{host.IPAddress, &host.ResolvedIP}, {host.VPNIPAddress, &host.ResolvedVPNIP}} {
+		if !IsHostname(a.addr) {
+			continue
+		}
+		ip, err := c.cached(a.addr)
+		*a.resolved = ip
+		if err != nil && host.ResolveError == "" {
+			host.ResolveError = err.Error()
+		}
+	}
+}
+
+// ResolveNames looks up every DNS name in the host list again, signalling
+// an update when any resolves differently. Health checks resolve through
+// the cache, so running this every ResolveInterval keeps lookups off the
+// check path and the displayed IPs current.
+func (s *Store) ResolveNames() {
+	seen := make(map[string]bool)
+	changed := false
+	for _, h := range s.GetAll() {
+		for _, addr := range []string{h.IPAddress, h.VPNIPAddress} {
+			if !IsHostname(addr) || seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			oldIP, oldErr := s.names.cached(addr)
+			r := s.names.refresh(addr)
+			if r.ip != oldIP || (r.err == nil) != (oldErr == nil) {
+				changed = true
+			}
+		}
+	}
+	if changed {
+		s.notify()
+	}
+}
+
+// RunResolver calls ResolveNames every ResolveInterval until the process
+// exits.
+func (s *Store) RunResolver() {
+	ticker := time.NewTicker(ResolveInterval)
+	defer ticker.Stop()
+	for {
+		s.ResolveNames()
+		<-ticker.C
+	}
+}
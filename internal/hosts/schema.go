@@ -0,0 +1,310 @@
+package hosts
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// auxTables holds the schema for tables that live alongside hosts in the same
+// database file. Statements must be idempotent since they run on every open,
+// including after a backup restore.
+var auxTables = []string{
+	`CREATE TABLE IF NOT EXISTS snapshots (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		created_at DATETIME,
+		data TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		email TEXT,
+		password_hash TEXT,
+		role TEXT NOT NULL,
+		prefs TEXT,
+		provider TEXT,
+		external_id TEXT,
+		disabled INTEGER NOT NULL DEFAULT 0,
+		deleted INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME,
+		updated_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS auth_tokens (
+		token_hash TEXT PRIMARY KEY,
+		kind TEXT NOT NULL,
+		user_id TEXT,
+		email TEXT,
+		role TEXT,
+		created_by TEXT,
+		created_at DATETIME,
+		expires_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		role TEXT NOT NULL,
+		created_by TEXT,
+		created_at DATETIME,
+		expires_at DATETIME,
+		last_used_at DATETIME,
+		last_used_ip TEXT,
+		revoked INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		at DATETIME NOT NULL,
+		actor TEXT NOT NULL,
+		actor_type TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target TEXT,
+		detail TEXT,
+		remote_addr TEXT,
+		prev_hash TEXT,
+		hash TEXT,
+		signature TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_log_at ON audit_log(at)`,
+	`CREATE TABLE IF NOT EXISTS host_credentials (
+		host_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		username TEXT,
+		sealed TEXT,
+		created_at DATETIME,
+		updated_at DATETIME,
+		PRIMARY KEY (host_id, kind)
+	)`,
+	`CREATE TABLE IF NOT EXISTS quarantine (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sender_id TEXT,
+		sender_key TEXT,
+		remote_addr TEXT,
+		reason TEXT,
+		host_id TEXT NOT NULL,
+		host TEXT NOT NULL,
+		received_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS saved_views (
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		data TEXT NOT NULL,
+		updated_at DATETIME,
+		PRIMARY KEY (user_id, name)
+	)`,
+	`CREATE TABLE IF NOT EXISTS peers (
+		node_id TEXT PRIMARY KEY,
+		public_key TEXT NOT NULL,
+		hostname TEXT,
+		address TEXT,
+		version TEXT,
+		booted_at DATETIME,
+		sent_at DATETIME,
+		seq INTEGER NOT NULL DEFAULT 0,
+		maintenance INTEGER NOT NULL DEFAULT 0,
+		first_seen DATETIME,
+		last_seen DATETIME,
+		disk_percent INTEGER NOT NULL DEFAULT 0,
+		time_sync TEXT,
+		stratum INTEGER NOT NULL DEFAULT 0,
+		throttled INTEGER,
+		links TEXT,
+		host_count INTEGER NOT NULL DEFAULT 0,
+		hosts_digest TEXT
+	)`,
+	`CREATE TABLE IF NOT EXISTS peer_sync (
+		host_id TEXT PRIMARY KEY,
+		last_push_at DATETIME,
+		last_push_error TEXT,
+		last_push_error_at DATETIME,
+		last_received_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS offline_edits (
+		host_id TEXT PRIMARY KEY,
+		edited_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS inventory (
+		node_id TEXT PRIMARY KEY,
+		model TEXT,
+		serial TEXT,
+		os TEXT,
+		kernel TEXT,
+		ram_bytes INTEGER NOT NULL DEFAULT 0,
+		sd_card_bytes INTEGER NOT NULL DEFAULT 0,
+		reported_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS card_health (
+		node_id TEXT NOT NULL,
+		at DATETIME NOT NULL,
+		life_used INTEGER NOT NULL DEFAULT 0,
+		pre_eol TEXT NOT NULL DEFAULT '',
+		fs_errors INTEGER NOT NULL DEFAULT 0,
+		read_only INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (node_id, at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS patch_status (
+		node_id TEXT PRIMARY KEY,
+		pending INTEGER NOT NULL DEFAULT 0,
+		security INTEGER NOT NULL DEFAULT 0,
+		reboot_required INTEGER NOT NULL DEFAULT 0,
+		checked_at DATETIME,
+		upgrade_state TEXT NOT NULL DEFAULT '',
+		upgrade_started DATETIME,
+		upgrade_finished DATETIME,
+		upgrade_error TEXT NOT NULL DEFAULT '',
+		upgrade_reboot INTEGER NOT NULL DEFAULT 0,
+		reported_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS reboots (
+		node_id TEXT NOT NULL,
+		boot_id TEXT NOT NULL,
+		booted_at DATETIME,
+		shutdown TEXT NOT NULL DEFAULT '',
+		evidence TEXT NOT NULL DEFAULT '',
+		under_voltage INTEGER NOT NULL DEFAULT 0,
+		last_seen DATETIME,
+		recorded_at DATETIME NOT NULL,
+		PRIMARY KEY (node_id, boot_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS wifi (
+		node_id TEXT NOT NULL,
+		at DATETIME NOT NULL,
+		interface TEXT NOT NULL DEFAULT '',
+		ssid TEXT NOT NULL DEFAULT '',
+		bssid TEXT NOT NULL DEFAULT '',
+		freq_mhz INTEGER NOT NULL DEFAULT 0,
+		signal_dbm INTEGER NOT NULL DEFAULT 0,
+		reconnects INTEGER NOT NULL DEFAULT 0,
+		roams INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (node_id, at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS metrics (
+		node_id TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		step INTEGER NOT NULL,
+		at DATETIME NOT NULL,
+		count INTEGER NOT NULL,
+		sum REAL NOT NULL,
+		min REAL NOT NULL,
+		max REAL NOT NULL,
+		PRIMARY KEY (node_id, metric, step, at)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_metrics_step_at ON metrics(step, at)`,
+	`CREATE TABLE IF NOT EXISTS alert_escalations (
+		alert_id TEXT PRIMARY KEY,
+		rule_id TEXT NOT NULL,
+		host_id TEXT NOT NULL,
+		policy TEXT NOT NULL DEFAULT '',
+		sent_at DATETIME NOT NULL,
+		step INTEGER NOT NULL DEFAULT 0,
+		escalated_at DATETIME,
+		acked_by TEXT NOT NULL DEFAULT '',
+		acked_at DATETIME,
+		resolved_at DATETIME
+	)`,
+	`CREATE TABLE IF NOT EXISTS incidents (
+		id TEXT PRIMARY KEY,
+		host_id TEXT NOT NULL,
+		title TEXT NOT NULL,
+		opened_at DATETIME NOT NULL,
+		resolved_at DATETIME,
+		offline INTEGER NOT NULL DEFAULT 0,
+		alerts INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_incidents_opened_at ON incidents(opened_at)`,
+	`CREATE TABLE IF NOT EXISTS incident_events (
+		incident_id TEXT NOT NULL,
+		at DATETIME NOT NULL,
+		kind TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_incident_events_incident ON incident_events(incident_id)`,
+}
+
+// auxColumns lists columns added to existing tables after they first
+// shipped. ensureAuxTables adds any that an older database is missing.
+var auxColumns = []struct {
+	table, column, definition string
+}{
+	{"hosts", "path_preference", "TEXT"},
+	{"hosts", "content_expires_at", "DATETIME"},
+	{"hosts", "timezone", "TEXT"},
+	{"hosts", "clock_skew_ms", "INTEGER"},
+	{"hosts", "clock_checked_at", "DATETIME"},
+	{"hosts", "mac_address", "TEXT"},
+	{"hosts", "switch_port", "TEXT"},
+	{"hosts", "versions", "TEXT"},
+	{"hosts", "cms", "TEXT"},
+	{"peers", "disk_percent", "INTEGER NOT NULL DEFAULT 0"},
+	{"peers", "time_sync", "TEXT"},
+	{"peers", "stratum", "INTEGER NOT NULL DEFAULT 0"},
+	{"peers", "throttled", "INTEGER"},
+	{"peers", "links", "TEXT"},
+	{"peers", "host_count", "INTEGER NOT NULL DEFAULT 0"},
+	{"peers", "hosts_digest", "TEXT"},
+	{"peers", "trusted_by", "TEXT"},
+	{"peers", "trusted_at", "DATETIME"},
+	{"users", "provider", "TEXT"},
+	{"users", "external_id", "TEXT"},
+	{"audit_log", "prev_hash", "TEXT"},
+	{"audit_log", "hash", "TEXT"},
+	{"audit_log", "signature", "TEXT"},
+}
+
+// ensureSchema creates or migrates every table managed by the store.
+func (s *Store) ensureSchema() error {
+	if err := s.ensureHostsTable(); err != nil {
+		return err
+	}
+	return s.ensureAuxTables()
+}
+
+func (s *Store) ensureAuxTables() error {
+	for _, stmt := range auxTables {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return fmt.Errorf("create auxiliary table: %w", err)
+		}
+	}
+
+	for _, col := range auxColumns {
+		exists, err := s.columnExists(col.table, col.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := s.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", col.table, col.column, col.definition)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", col.table, col.column, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) columnExists(table, column string) (bool, error) {
+	rows, err := s.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("inspect %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, fmt.Errorf("inspect %s: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
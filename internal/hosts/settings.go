@@ -0,0 +1,67 @@
+package hosts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetSetting decodes the JSON value stored under key into v. It reports
+// false when the key has never been set, leaving v untouched so callers can
+// pre-populate defaults. Encrypted values are opened first.
+func (s *Store) GetSetting(key string, v any) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var raw string
+	err := s.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read setting %s: %w", key, err)
+	}
+	if key != EncryptionSettingKey {
+		if raw, err = s.openLocked(key, raw); err != nil {
+			return false, fmt.Errorf("read setting %s: %w", key, err)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(raw), v); err != nil {
+		return false, fmt.Errorf("decode setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// PutSetting stores v as JSON under key, replacing any previous value. It
+// is encrypted when settings encryption is on.
+func (s *Store) PutSetting(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode setting %s: %w", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value := string(data)
+	if key != EncryptionSettingKey {
+		encrypted, err := s.encryptedLocked()
+		if err != nil {
+			return err
+		}
+		if encrypted {
+			if value, err = s.sealLocked(key, value); err != nil {
+				return fmt.Errorf("write setting %s: %w", key, err)
+			}
+		}
+	}
+
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO settings (key, value, updated_at) VALUES (?, ?, ?)`,
+		key, value, formatTime(time.Now())); err != nil {
+		return fmt.Errorf("write setting %s: %w", key, err)
+	}
+	return nil
+}
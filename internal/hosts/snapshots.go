@@ -0,0 +1,271 @@
+package hosts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrSnapshotNotFound is returned when a named snapshot does not exist.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// Snapshot is a named copy of the fleet configuration that operators can
+// restore on demand (e.g. "event mode" vs "normal mode"). Unlike automatic
+// backups, snapshots are kept until explicitly deleted.
+type Snapshot struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	HostCount   int          `json:"host_count"`
+	Hosts       []types.Host `json:"hosts,omitempty"`
+}
+
+// snapshotData is the JSON document stored in the snapshots table. New
+// configuration sections are added here as fields so older snapshots still
+// decode.
+type snapshotData struct {
+	Hosts []types.Host `json:"hosts"`
+}
+
+// SnapshotDiff describes how the current configuration differs from a
+// snapshot. Added hosts exist only in the current list, removed hosts only
+// in the snapshot.
+type SnapshotDiff struct {
+	Snapshot string       `json:"snapshot"`
+	Added    []types.Host `json:"added"`
+	Removed  []types.Host `json:"removed"`
+	Changed  []HostChange `json:"changed"`
+}
+
+// HostChange lists configuration fields that differ for a host present in
+// both the snapshot and the current list.
+type HostChange struct {
+	ID        string        `json:"id"`
+	IPAddress string        `json:"ip_address"`
+	Fields    []FieldChange `json:"fields"`
+}
+
+// FieldChange is a single differing field.
+type FieldChange struct {
+	Field    string `json:"field"`
+	Snapshot string `json:"snapshot"`
+	Current  string `json:"current"`
+}
+
+// SaveSnapshot captures the current configuration under name, replacing any
+// existing snapshot with the same name.
+func (s *Store) SaveSnapshot(name, description string) (Snapshot, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Snapshot{}, errors.New("snapshot name is required")
+	}
+
+	hostList := s.GetAll()
+	if hostList == nil {
+		hostList = []types.Host{}
+	}
+
+	data, err := json.Marshal(snapshotData{Hosts: hostList})
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	snap := Snapshot{
+		Name:        name,
+		Description: strings.TrimSpace(description),
+		CreatedAt:   time.Now().UTC(),
+		HostCount:   len(hostList),
+		Hosts:       hostList,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	value, err := seal.seal(fieldSnapshotData, snap.Name, string(data))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO snapshots (name, description, created_at, data)
+		VALUES (?, ?, ?, ?)`, snap.Name, snap.Description, formatTime(snap.CreatedAt), value); err != nil {
+		return Snapshot{}, fmt.Errorf("save snapshot: %w", err)
+	}
+
+	return snap, nil
+}
+
+// ListSnapshots returns all snapshots, newest first, without their host lists.
+func (s *Store) ListSnapshots() ([]Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT name, description, created_at, data FROM snapshots ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []Snapshot{}
+	for rows.Next() {
+		snap, err := scanSnapshot(s.sealer, rows)
+		if err != nil {
+			return nil, err
+		}
+		snap.Hosts = nil
+		snapshots = append(snapshots, snap)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetSnapshot returns a snapshot including its host list.
+func (s *Store) GetSnapshot(name string) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row := s.db.QueryRow(`SELECT name, description, created_at, data FROM snapshots WHERE name = ?`, name)
+	snap, err := scanSnapshot(s.sealer, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return snap, err
+}
+
+// DeleteSnapshot removes a named snapshot.
+func (s *Store) DeleteSnapshot(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`DELETE FROM snapshots WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete snapshot: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return nil
+}
+
+// RestoreSnapshot replaces the current host list with the snapshot contents.
+func (s *Store) RestoreSnapshot(name string) (Snapshot, error) {
+	snap, err := s.GetSnapshot(name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if err := s.ReplaceAll(snap.Hosts); err != nil {
+		return Snapshot{}, err
+	}
+	return snap, nil
+}
+
+// DiffSnapshot compares a snapshot with the current host list. Hosts are
+// matched by ID, falling back to IP address, and only operator-managed
+// fields are compared; health status is expected to drift.
+func (s *Store) DiffSnapshot(name string) (SnapshotDiff, error) {
+	snap, err := s.GetSnapshot(name)
+	if err != nil {
+		return SnapshotDiff{}, err
+	}
+	return diffHosts(snap.Name, snap.Hosts, s.GetAll()), nil
+}
+
+func diffHosts(name string, snapshot, current []types.Host) SnapshotDiff {
+	diff := SnapshotDiff{
+		Snapshot: name,
+		Added:    []types.Host{},
+		Removed:  []types.Host{},
+		Changed:  []HostChange{},
+	}
+
+	byID := make(map[string]int, len(current))
+	byIP := make(map[string]int, len(current))
+	for i, h := range current {
+		if h.ID != "" {
+			byID[h.ID] = i
+		}
+		byIP[h.IPAddress] = i
+	}
+
+	matched := make(map[int]bool, len(current))
+	for _, old := range snapshot {
+		idx, ok := byID[old.ID]
+		if !ok || old.ID == "" {
+			idx, ok = byIP[old.IPAddress]
+		}
+		if !ok || matched[idx] {
+			diff.Removed = append(diff.Removed, old)
+			continue
+		}
+		matched[idx] = true
+
+		if fields := configChanges(old, current[idx]); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, HostChange{
+				ID:        current[idx].ID,
+				IPAddress: current[idx].IPAddress,
+				Fields:    fields,
+			})
+		}
+	}
+
+	for i, h := range current {
+		if !matched[i] {
+			diff.Added = append(diff.Added, h)
+		}
+	}
+
+	return diff
+}
+
+func configChanges(old, cur types.Host) []FieldChange {
+	pairs := []struct {
+		field    string
+		old, cur string
+	}{
+		{"nickname", old.Nickname, cur.Nickname},
+		{"ip_address", old.IPAddress, cur.IPAddress},
+		{"vpn_ip_address", old.VPNIPAddress, cur.VPNIPAddress},
+		{"hostname", old.Hostname, cur.Hostname},
+		{"notes", old.Notes, cur.Notes},
+	}
+
+	var changes []FieldChange
+	for _, p := range pairs {
+		if p.old != p.cur {
+			changes = append(changes, FieldChange{Field: p.field, Snapshot: p.old, Current: p.cur})
+		}
+	}
+	return changes
+}
+
+func scanSnapshot(sealer Sealer, scanner interface{ Scan(dest ...any) error }) (Snapshot, error) {
+	var (
+		snap        Snapshot
+		description sql.NullString
+		createdAt   sql.NullString
+		raw         string
+	)
+	if err := scanner.Scan(&snap.Name, &description, &createdAt, &raw); err != nil {
+		return Snapshot{}, err
+	}
+	snap.Description = description.String
+	snap.CreatedAt = parseTime(createdAt.String)
+	raw, err := openField(sealer, fieldSnapshotData, snap.Name, raw)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("read snapshot %s: %w", snap.Name, err)
+	}
+
+	var data snapshotData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return Snapshot{}, fmt.Errorf("decode snapshot %s: %w", snap.Name, err)
+	}
+	snap.Hosts = data.Hosts
+	snap.HostCount = len(data.Hosts)
+	return snap, nil
+}
@@ -1,6 +1,7 @@
 package hosts
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -13,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -31,13 +33,38 @@ const (
 
 var errNoBackups = errors.New("no host backups available")
 
-// Store manages the host list and persistence to a SQLite database file.
+// Store manages the host list and persistence to a SQLite database file,
+// or to a SQLite database in memory (see Open).
 type Store struct {
 	mu        sync.RWMutex
 	db        *sql.DB
 	file      string
+	memory    string    // Name of the in-memory database; "" for a file
+	keep      *sql.Conn // Keeps the in-memory database from being dropped
 	backupDir string
 	updates   chan struct{}
+	modified  atomic.Int64 // unix nanoseconds of the last host list change
+
+	auditSigner AuditSigner
+	sealer      Sealer // Encrypts settings; see SetSealer
+	nodeID      string // Stamped on local edits; see SetNodeID
+	isolated    bool   // No peer reachable; see SetIsolated
+	writeDelay  func() time.Duration // See SetWriteDelay
+
+	healthMu   sync.Mutex
+	lastHealth map[string]types.HealthStatus
+
+	// What this node has observed of its hosts, kept in memory only: a
+	// restart starts them afresh from new checks and heartbeats.
+	assets     *assetCache
+	failures   *failureLog
+	quality    *qualityLog
+	checks     activeChecks
+	names      *nameCache
+	drift      *driftLog
+	baselineMu sync.Mutex // Serialises updates of the stored asset baselines
+	playbacks  *playbackLog
+	viewers    *viewerLog
 }
 
 type backupInfo struct {
@@ -47,6 +74,12 @@ type backupInfo struct {
 
 // NewStore creates a new host store backed by SQLite.
 func NewStore(filePath string) (*Store, error) {
+	return newStore(filePath, false)
+}
+
+// newStore opens the database at filePath, or a new one in memory beside
+// it.
+func newStore(filePath string, inMemory bool) (*Store, error) {
 	if filePath == "" {
 		filePath = defaultDBFile
 	}
@@ -60,6 +93,26 @@ func NewStore(filePath string) (*Store, error) {
 		file:      absPath,
 		backupDir: filepath.Join(filepath.Dir(absPath), defaultBackupDirName),
 		updates:   make(chan struct{}, 1),
+		assets:    &assetCache{byHost: make(map[string]assetList)},
+		failures:  &failureLog{entries: make(map[string]failureState)},
+		quality:   &qualityLog{samples: make(map[string][]QualitySample)},
+		names:     &nameCache{entries: make(map[string]resolution)},
+		drift:     &driftLog{byHost: make(map[string]AssetDrift)},
+		playbacks: &playbackLog{byNode: make(map[string]Playback)},
+		viewers:   &viewerLog{byNode: make(map[string]Viewer)},
+	}
+	s.modified.Store(time.Now().UnixNano())
+
+	if inMemory {
+		s.memory = "nsm-" + uuid.New().String()
+		if err := s.openDB(); err != nil {
+			return nil, err
+		}
+		if err := s.ensureSchema(); err != nil {
+			_ = s.closeDB()
+			return nil, err
+		}
+		return s, nil
 	}
 
 	if err := os.MkdirAll(s.backupDir, 0o755); err != nil {
@@ -88,7 +141,32 @@ func (s *Store) Updates() <-chan struct{} {
 	return s.updates
 }
 
+// LastModified reports when the host list last changed. Stores that have not
+// seen a change since startup report their creation time.
+func (s *Store) LastModified() time.Time {
+	return time.Unix(0, s.modified.Load())
+}
+
+// Dir returns the directory holding the database, where other node-local
+// files such as the identity key are kept.
+func (s *Store) Dir() string {
+	return filepath.Dir(s.file)
+}
+
+// SetWriteDelay makes every change to the host list take delay longer,
+// holding the store lock as a slow disk would, for fault injection.
+func (s *Store) SetWriteDelay(delay func() time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writeDelay = delay
+}
+
+// notify is called after each change to the host list.
 func (s *Store) notify() {
+	if s.writeDelay != nil {
+		time.Sleep(s.writeDelay())
+	}
+	s.modified.Store(time.Now().UnixNano())
 	select {
 	case s.updates <- struct{}{}:
 	default:
@@ -112,12 +190,16 @@ func (s *Store) tryOpenOrRecover() error {
 }
 
 func (s *Store) openDB() error {
-	if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
+	connStr := fmt.Sprintf("file:%s", filepath.Clean(s.file))
+	if s.memory != "" {
+		// Connections share the database by name. Readers skip the table
+		// locks of the shared cache, which busy_timeout does not wait on;
+		// s.mu already keeps them from reading a half-made change.
+		connStr = fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=read_uncommitted(1)", s.memory)
+	} else if err := os.MkdirAll(filepath.Dir(s.file), 0o755); err != nil {
 		return fmt.Errorf("create db directory: %w", err)
 	}
 
-	connStr := fmt.Sprintf("file:%s", filepath.Clean(s.file))
-
 	db, err := sql.Open("sqlite", connStr)
 	if err != nil {
 		return fmt.Errorf("open sqlite: %w", err)
@@ -133,6 +215,17 @@ func (s *Store) openDB() error {
 		return fmt.Errorf("set busy timeout: %w", err)
 	}
 
+	if s.memory != "" {
+		// The database lives as long as a connection to it is open, so
+		// one is held until Close.
+		keep, err := db.Conn(context.Background())
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("hold in-memory database: %w", err)
+		}
+		s.keep = keep
+	}
+
 	s.db = db
 	return nil
 }
@@ -157,6 +250,10 @@ func (s *Store) closeDB() error {
 	if s.db == nil {
 		return nil
 	}
+	if s.keep != nil {
+		s.keep.Close()
+		s.keep = nil
+	}
 	err := s.db.Close()
 	s.db = nil
 	return err
@@ -202,6 +299,9 @@ func (s *Store) restoreLatestBackup() error {
 
 // RestoreFrom restores the database from a specific backup file.
 func (s *Store) RestoreFrom(path string) error {
+	if s.memory != "" {
+		return ErrInMemory
+	}
 	if err := s.resetDatabaseFiles(); err != nil {
 		return err
 	}
@@ -286,7 +386,7 @@ func copyFile(src, dst string) error {
 	return out.Close()
 }
 
-func (s *Store) ensureSchema() error {
+func (s *Store) ensureHostsTable() error {
 	// Check if 'hosts' table exists
 	var tableExists int
 	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='hosts'").Scan(&tableExists); err != nil {
@@ -319,7 +419,16 @@ func (s *Store) ensureSchema() error {
 			dashboard_url TEXT,
 			dashboard_url_vpn TEXT,
 			last_checked DATETIME,
-			last_checked_vpn DATETIME
+			last_checked_vpn DATETIME,
+			path_preference TEXT,
+			content_expires_at DATETIME,
+			timezone TEXT,
+			clock_skew_ms INTEGER,
+			clock_checked_at DATETIME,
+			mac_address TEXT,
+			switch_port TEXT,
+			versions TEXT,
+			cms TEXT
 		)`)
 		if err != nil {
 			return fmt.Errorf("create table: %w", err)
@@ -380,7 +489,16 @@ func (s *Store) ensureSchema() error {
 			dashboard_url TEXT,
 			dashboard_url_vpn TEXT,
 			last_checked DATETIME,
-			last_checked_vpn DATETIME
+			last_checked_vpn DATETIME,
+			path_preference TEXT,
+			content_expires_at DATETIME,
+			timezone TEXT,
+			clock_skew_ms INTEGER,
+			clock_checked_at DATETIME,
+			mac_address TEXT,
+			switch_port TEXT,
+			versions TEXT,
+			cms TEXT
 		)`); err != nil {
 			return fmt.Errorf("create new table: %w", err)
 		}
@@ -392,13 +510,7 @@ func (s *Store) ensureSchema() error {
 		}
 		defer rows.Close()
 
-		stmt, err := tx.Prepare(`INSERT INTO hosts (
-			id, ip_address, nickname, vpn_ip_address, hostname, notes, status, status_vpn,
-			nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn, anthias_version,
-			anthias_version_vpn, anthias_status, anthias_status_vpn, cms_status,
-			cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-			dashboard_url_vpn, last_checked, last_checked_vpn)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+		stmt, err := tx.Prepare(hostInsert)
 		if err != nil {
 			return fmt.Errorf("prepare insert: %w", err)
 		}
@@ -479,11 +591,8 @@ func (s *Store) migrateLegacyJSON() error {
 // GetAll returns all hosts ordered by IP address.
 func (s *Store) GetAll() []types.Host {
 	s.mu.RLock()
-	rows, err := s.db.Query(`SELECT id, ip_address, nickname, vpn_ip_address, hostname, notes,
-		status, status_vpn, nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn,
-		anthias_version, anthias_version_vpn, anthias_status, anthias_status_vpn,
-		cms_status, cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-		dashboard_url_vpn, last_checked, last_checked_vpn FROM hosts ORDER BY ip_address`)
+	rows, err := s.db.Query(`SELECT `+hostColumns+` FROM hosts ORDER BY ip_address`)
+	sealer := s.sealer
 	s.mu.RUnlock()
 	if err != nil {
 		return []types.Host{}
@@ -496,8 +605,19 @@ func (s *Store) GetAll() []types.Host {
 		if err != nil {
 			continue
 		}
+		openHost(sealer, &host)
 		hosts = append(hosts, host)
 	}
+	rows.Close()
+
+	s.mu.RLock()
+	peers := s.peersLocked()
+	s.mu.RUnlock()
+	now := time.Now()
+	for i := range hosts {
+		peer, ok := peers[hosts[i].ID]
+		s.applyHealth(&hosts[i], peer, ok, now)
+	}
 
 	return hosts
 }
@@ -510,17 +630,22 @@ func (s *Store) Add(host types.Host) error {
 	if host.ID == "" {
 		host.ID = uuid.New().String()
 	}
+	edited := stamp(nil, &host, s.nodeID)
 
-	_, err := s.db.Exec(`INSERT INTO hosts (
-		id, ip_address, nickname, vpn_ip_address, hostname, notes, status, status_vpn,
-		nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn, anthias_version,
-		anthias_version_vpn, anthias_status, anthias_status_vpn, cms_status,
-		cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-		dashboard_url_vpn, last_checked, last_checked_vpn)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, hostToArgs(host)...)
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	args, err := seal.hostArgs(host)
 	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(hostInsert, args...); err != nil {
 		return fmt.Errorf("insert host: %w", err)
 	}
+	if err := s.bufferEdit(host.ID, edited); err != nil {
+		return err
+	}
 	s.notify()
 	return nil
 }
@@ -535,8 +660,10 @@ func (s *Store) Update(ip string, updater func(*types.Host)) error {
 		return err
 	}
 
+	original := host
 	originalIP := host.IPAddress
 	updater(&host)
+	edited := stamp(&original, &host, s.nodeID)
 
 	// If ID is missing (shouldn't happen for existing), generate it
 	if host.ID == "" {
@@ -552,27 +679,20 @@ func (s *Store) Update(ip string, updater func(*types.Host)) error {
 		// Actually, since we are updating the record found by IP, we have its ID.
 	}
 
-	_, err = s.db.Exec(`UPDATE hosts SET
-		ip_address = ?, nickname = ?, vpn_ip_address = ?, hostname = ?, notes = ?,
-		status = ?, status_vpn = ?, nsm_status = ?, nsm_status_vpn = ?,
-		nsm_version = ?, nsm_version_vpn = ?, anthias_version = ?,
-		anthias_version_vpn = ?, anthias_status = ?, anthias_status_vpn = ?,
-		cms_status = ?, cms_status_vpn = ?, asset_count = ?, asset_count_vpn = ?,
-		dashboard_url = ?, dashboard_url_vpn = ?, last_checked = ?,
-		last_checked_vpn = ?
-		WHERE id = ?`,
-		host.IPAddress, host.Nickname, host.VPNIPAddress, host.Hostname, host.Notes,
-		string(host.Status), string(host.StatusVPN), host.NSMStatus, host.NSMStatusVPN,
-		host.NSMVersion, host.NSMVersionVPN, host.AnthiasVersion,
-		host.AnthiasVersionVPN, host.AnthiasStatus, host.AnthiasStatusVPN,
-		string(host.CMSStatus), string(host.CMSStatusVPN), host.AssetCount,
-		host.AssetCountVPN, host.DashboardURL, host.DashboardURLVPN,
-		formatTime(host.LastChecked), formatTime(host.LastCheckedVPN),
-		host.ID)
-
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	args, err := seal.hostArgs(host)
 	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(hostUpdate, append(args[1:], host.ID)...); err != nil {
 		return fmt.Errorf("update host: %w", err)
 	}
+	if err := s.bufferEdit(host.ID, edited); err != nil {
+		return err
+	}
 	s.notify()
 	return nil
 }
@@ -582,6 +702,34 @@ func (s *Store) Delete(ip string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var id string
+	s.db.QueryRow(`SELECT id FROM hosts WHERE ip_address = ?`, ip).Scan(&id)
+
+	if _, err := s.db.Exec(`DELETE FROM host_credentials WHERE host_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host credentials: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM peers WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host peer state: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM inventory WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host inventory: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM card_health WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host card health: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM patch_status WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host patch status: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM reboots WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host reboots: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM wifi WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host wifi: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM metrics WHERE node_id IN (SELECT id FROM hosts WHERE ip_address = ?)`, ip); err != nil {
+		return fmt.Errorf("delete host metrics: %w", err)
+	}
+
 	res, err := s.db.Exec(`DELETE FROM hosts WHERE ip_address = ?`, ip)
 	if err != nil {
 		return fmt.Errorf("delete host: %w", err)
@@ -591,6 +739,53 @@ func (s *Store) Delete(ip string) error {
 	if affected == 0 {
 		return fmt.Errorf("host not found: %s", ip)
 	}
+	if id != "" {
+		s.quality.forget(id)
+	}
+
+	s.notify()
+	return nil
+}
+
+// DeleteByID removes one host by ID. Unlike Delete, it leaves any other
+// host that shares the same IP address.
+func (s *Store) DeleteByID(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`DELETE FROM host_credentials WHERE host_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host credentials: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM peers WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host peer state: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM inventory WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host inventory: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM card_health WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host card health: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM patch_status WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host patch status: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM reboots WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host reboots: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM wifi WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host wifi: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM metrics WHERE node_id = ?`, id); err != nil {
+		return fmt.Errorf("delete host metrics: %w", err)
+	}
+
+	res, err := s.db.Exec(`DELETE FROM hosts WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete host: %w", err)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return fmt.Errorf("host not found: %s", id)
+	}
+	s.quality.forget(id)
 
 	s.notify()
 	return nil
@@ -601,6 +796,21 @@ func (s *Store) ReplaceAll(hosts []types.Host) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	current := make(map[string]types.Host)
+	if rows, err := s.db.Query(`SELECT ` + hostColumns + ` FROM hosts`); err == nil {
+		for rows.Next() {
+			if h, err := scanHost(rows); err == nil {
+				openHost(s.sealer, &h)
+				current[h.ID] = h
+			}
+		}
+		rows.Close()
+	}
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("begin replace: %w", err)
@@ -611,24 +821,31 @@ func (s *Store) ReplaceAll(hosts []types.Host) error {
 		return fmt.Errorf("truncate hosts: %w", err)
 	}
 
-	stmt, err := tx.Prepare(`INSERT INTO hosts (
-		id, ip_address, nickname, vpn_ip_address, hostname, notes, status, status_vpn,
-		nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn, anthias_version,
-		anthias_version_vpn, anthias_status, anthias_status_vpn, cms_status,
-		cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-		dashboard_url_vpn, last_checked, last_checked_vpn)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(hostInsert)
 	if err != nil {
 		tx.Rollback()
 		return fmt.Errorf("prepare replace insert: %w", err)
 	}
 	defer stmt.Close()
 
+	var edited []string
 	for _, host := range hosts {
 		if host.ID == "" {
 			host.ID = uuid.New().String()
 		}
-		if _, err := stmt.Exec(hostToArgs(host)...); err != nil {
+		var old *types.Host
+		if h, ok := current[host.ID]; ok {
+			old = &h
+		}
+		if stamp(old, &host, s.nodeID) {
+			edited = append(edited, host.ID)
+		}
+		args, err := seal.hostArgs(host)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := stmt.Exec(args...); err != nil {
 			tx.Rollback()
 			return fmt.Errorf("insert host during replace: %w", err)
 		}
@@ -637,6 +854,11 @@ func (s *Store) ReplaceAll(hosts []types.Host) error {
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("commit replace: %w", err)
 	}
+	for _, id := range edited {
+		if err := s.bufferEdit(id, true); err != nil {
+			return err
+		}
+	}
 
 	s.notify()
 	return nil
@@ -652,46 +874,42 @@ func (s *Store) Upsert(host types.Host) error {
 	}
 
 	// Check if host exists by ID
-	var exists bool
-	if err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM hosts WHERE id = ?)", host.ID).Scan(&exists); err != nil {
+	old, err := scanHost(s.db.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE id = ?`, host.ID))
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return fmt.Errorf("check existence: %w", err)
 	}
+	openHost(s.sealer, &old)
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
 
+	var edited bool
 	if exists {
+		edited = stamp(&old, &host, s.nodeID)
 		// Update existing
-		_, err := s.db.Exec(`UPDATE hosts SET
-			ip_address = ?, nickname = ?, vpn_ip_address = ?, hostname = ?, notes = ?,
-			status = ?, status_vpn = ?, nsm_status = ?, nsm_status_vpn = ?,
-			nsm_version = ?, nsm_version_vpn = ?, anthias_version = ?,
-			anthias_version_vpn = ?, anthias_status = ?, anthias_status_vpn = ?,
-			cms_status = ?, cms_status_vpn = ?, asset_count = ?, asset_count_vpn = ?,
-			dashboard_url = ?, dashboard_url_vpn = ?, last_checked = ?,
-			last_checked_vpn = ?
-			WHERE id = ?`,
-			host.IPAddress, host.Nickname, host.VPNIPAddress, host.Hostname, host.Notes,
-			string(host.Status), string(host.StatusVPN), host.NSMStatus, host.NSMStatusVPN,
-			host.NSMVersion, host.NSMVersionVPN, host.AnthiasVersion,
-			host.AnthiasVersionVPN, host.AnthiasStatus, host.AnthiasStatusVPN,
-			string(host.CMSStatus), string(host.CMSStatusVPN), host.AssetCount,
-			host.AssetCountVPN, host.DashboardURL, host.DashboardURLVPN,
-			formatTime(host.LastChecked), formatTime(host.LastCheckedVPN),
-			host.ID)
+		args, err := seal.hostArgs(host)
 		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(hostUpdate, append(args[1:], host.ID)...); err != nil {
 			return fmt.Errorf("update host: %w", err)
 		}
 	} else {
 		// Insert new
-		_, err := s.db.Exec(`INSERT INTO hosts (
-			id, ip_address, nickname, vpn_ip_address, hostname, notes, status, status_vpn,
-			nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn, anthias_version,
-			anthias_version_vpn, anthias_status, anthias_status_vpn, cms_status,
-			cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-			dashboard_url_vpn, last_checked, last_checked_vpn)
-			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, hostToArgs(host)...)
+		edited = stamp(nil, &host, s.nodeID)
+		args, err := seal.hostArgs(host)
 		if err != nil {
+			return err
+		}
+		if _, err := s.db.Exec(hostInsert, args...); err != nil {
 			return fmt.Errorf("insert host: %w", err)
 		}
 	}
+	if err := s.bufferEdit(host.ID, edited); err != nil {
+		return err
+	}
 
 	s.notify()
 	return nil
@@ -702,11 +920,7 @@ func (s *Store) GetByID(id string) (*types.Host, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	row := s.db.QueryRow(`SELECT id, ip_address, nickname, vpn_ip_address, hostname, notes,
-		status, status_vpn, nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn,
-		anthias_version, anthias_version_vpn, anthias_status, anthias_status_vpn,
-		cms_status, cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-		dashboard_url_vpn, last_checked, last_checked_vpn FROM hosts WHERE id = ?`, id)
+	row := s.db.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE id = ?`, id)
 
 	host, err := scanHost(row)
 	if err != nil {
@@ -715,20 +929,21 @@ func (s *Store) GetByID(id string) (*types.Host, error) {
 		}
 		return nil, err
 	}
+	openHost(s.sealer, &host)
+	peer, err := s.getPeerLocked(host.ID)
+	s.applyHealth(&host, peer, err == nil, time.Now())
 	return &host, nil
 }
 
 // BackupCurrent writes a snapshot of the database to a timestamped file and
 // prunes old backups beyond maxBackups. Returns the backup path when created.
 func (s *Store) BackupCurrent(maxBackups int) (string, error) {
-	snapshot, err := s.ExportSnapshot()
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return "", nil
-		}
-		return "", err
+	if s.memory != "" {
+		return "", ErrInMemory
+	}
+	if _, err := os.Stat(s.file); errors.Is(err, os.ErrNotExist) {
+		return "", nil
 	}
-
 	if maxBackups <= 0 {
 		maxBackups = defaultMaxBackups
 	}
@@ -756,7 +971,14 @@ func (s *Store) BackupCurrent(maxBackups int) (string, error) {
 		timestamp++
 	}
 
-	if err := os.WriteFile(backupPath, snapshot, 0o600); err != nil {
+	// Vacuum straight into the backup directory, under a name the listing
+	// skips until the copy is complete.
+	tempPath, err := s.vacuumToTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("write backup: %w", err)
+	}
+	if err := os.Rename(tempPath, backupPath); err != nil {
+		os.Remove(tempPath)
 		return "", fmt.Errorf("write backup: %w", err)
 	}
 
@@ -765,45 +987,90 @@ func (s *Store) BackupCurrent(maxBackups int) (string, error) {
 	return backupPath, nil
 }
 
-// ExportSnapshot returns a consistent copy of the current database contents.
-func (s *Store) ExportSnapshot() ([]byte, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Export is a consistent copy of the database, read from a temporary file
+// that Close removes.
+type Export struct {
+	*os.File
+	size int64
+}
 
-	if _, err := os.Stat(s.file); errors.Is(err, os.ErrNotExist) {
+// Size returns the length of the copy in bytes.
+func (e *Export) Size() int64 {
+	return e.size
+}
+
+// Close closes and removes the copy.
+func (e *Export) Close() error {
+	err := e.File.Close()
+	os.Remove(e.Name())
+	return err
+}
+
+// OpenExport returns a consistent copy of the current database contents,
+// to be streamed without holding it in memory. The caller must close it.
+func (s *Store) OpenExport() (*Export, error) {
+	dir := filepath.Dir(s.file)
+	if s.memory != "" {
+		dir = os.TempDir()
+	} else if _, err := os.Stat(s.file); errors.Is(err, os.ErrNotExist) {
 		return nil, os.ErrNotExist
 	}
+	tempPath, err := s.vacuumToTemp(dir, "hosts-export-*.db")
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(tempPath)
+	if err != nil {
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("open export file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return nil, fmt.Errorf("stat export file: %w", err)
+	}
+	return &Export{File: f, size: info.Size()}, nil
+}
 
-	tempFile, err := os.CreateTemp(filepath.Dir(s.file), "hosts-export-*.db")
+// vacuumToTemp writes a consistent copy of the database to a new file in
+// dir named after pattern, readable only by the owner, and returns its path.
+func (s *Store) vacuumToTemp(dir, pattern string) (string, error) {
+	tempFile, err := os.CreateTemp(dir, pattern)
 	if err != nil {
-		return nil, fmt.Errorf("create temp export file: %w", err)
+		return "", fmt.Errorf("create temp export file: %w", err)
 	}
 	tempPath := tempFile.Name()
 	tempFile.Close()
+	// VACUUM INTO refuses to overwrite, even an empty file.
+	os.Remove(tempPath)
 
+	s.mu.Lock()
 	escaped := strings.ReplaceAll(tempPath, "'", "''")
-	if _, err := s.db.Exec(fmt.Sprintf("VACUUM INTO '%s'", escaped)); err != nil {
+	_, err = s.db.Exec(fmt.Sprintf("VACUUM INTO '%s'", escaped))
+	s.mu.Unlock()
+	if err != nil {
 		os.Remove(tempPath)
-		return nil, fmt.Errorf("vacuum into temp file: %w", err)
+		return "", fmt.Errorf("vacuum into temp file: %w", err)
 	}
-
-	data, err := os.ReadFile(tempPath)
-	os.Remove(tempPath)
-	if err != nil {
-		return nil, fmt.Errorf("read export file: %w", err)
+	if err := os.Chmod(tempPath, 0o600); err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("restrict export file: %w", err)
 	}
-
-	return data, nil
+	return tempPath, nil
 }
 
-// ImportSnapshot replaces the current database contents with the provided
-// SQLite database bytes. Returns the backup path if the existing database was
-// moved aside.
-func (s *Store) ImportSnapshot(data []byte, maxBackups int) (string, error) {
-	if len(data) == 0 {
-		return "", errors.New("snapshot data is empty")
-	}
+// ErrInvalidSnapshot is returned for an import that is not an NSM database.
+var ErrInvalidSnapshot = errors.New("not a valid NSM database")
 
+// ImportSnapshot replaces the current database contents with the SQLite
+// database read from r. It is streamed to a temporary file and checked with
+// ValidateSnapshot before anything is replaced. Returns the backup path if
+// the existing database was moved aside.
+func (s *Store) ImportSnapshot(r io.Reader, maxBackups int) (string, error) {
+	if s.memory != "" {
+		return "", ErrInMemory
+	}
 	if maxBackups <= 0 {
 		maxBackups = defaultMaxBackups
 	}
@@ -822,12 +1089,18 @@ func (s *Store) ImportSnapshot(data []byte, maxBackups int) (string, error) {
 	}
 	tempPath := tempFile.Name()
 
-	if _, err := tempFile.Write(data); err != nil {
-		tempFile.Close()
+	_, err = io.Copy(tempFile, r)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		os.Remove(tempPath)
 		return "", fmt.Errorf("write temp import file: %w", err)
 	}
-	tempFile.Close()
+	if err := ValidateSnapshot(tempPath); err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -865,6 +1138,7 @@ func (s *Store) ImportSnapshot(data []byte, maxBackups int) (string, error) {
 	if err := s.ensureSchema(); err != nil {
 		return backupPath, err
 	}
+	s.notify()
 
 	base := filepath.Base(s.file)
 	ext := filepath.Ext(base)
@@ -877,10 +1151,40 @@ func (s *Store) ImportSnapshot(data []byte, maxBackups int) (string, error) {
 	return backupPath, nil
 }
 
+// ValidateSnapshot checks that the file at path is an intact SQLite
+// database with a host list.
+func ValidateSnapshot(path string) error {
+	db, err := openReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%w: integrity check failed: %s", ErrInvalidSnapshot, result)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'hosts'`).Scan(&tables); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+	if tables == 0 {
+		return fmt.Errorf("%w: no host list", ErrInvalidSnapshot)
+	}
+	return nil
+}
+
 // GetByIP returns a specific host by IP address.
 func (s *Store) GetByIP(ip string) (*types.Host, error) {
 	s.mu.RLock()
 	host, err := s.getHostLocked(ip)
+	if err == nil {
+		peer, peerErr := s.getPeerLocked(host.ID)
+		s.applyHealth(&host, peer, peerErr == nil, time.Now())
+	}
 	s.mu.RUnlock()
 	if err != nil {
 		return nil, err
@@ -890,11 +1194,7 @@ func (s *Store) GetByIP(ip string) (*types.Host, error) {
 }
 
 func (s *Store) getHostLocked(ip string) (types.Host, error) {
-	row := s.db.QueryRow(`SELECT id, ip_address, nickname, vpn_ip_address, hostname, notes,
-		status, status_vpn, nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn,
-		anthias_version, anthias_version_vpn, anthias_status, anthias_status_vpn,
-		cms_status, cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
-		dashboard_url_vpn, last_checked, last_checked_vpn FROM hosts WHERE ip_address = ?`, ip)
+	row := s.db.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE ip_address = ?`, ip)
 
 	host, err := scanHost(row)
 	if err != nil {
@@ -903,9 +1203,36 @@ func (s *Store) getHostLocked(ip string) (types.Host, error) {
 		}
 		return types.Host{}, err
 	}
+	openHost(s.sealer, &host)
 	return host, nil
 }
 
+// hostColumns lists the hosts table columns in the order used by hostToArgs
+// and scanHost.
+const hostColumns = `id, ip_address, nickname, vpn_ip_address, hostname, notes,
+		status, status_vpn, nsm_status, nsm_status_vpn, nsm_version, nsm_version_vpn,
+		anthias_version, anthias_version_vpn, anthias_status, anthias_status_vpn,
+		cms_status, cms_status_vpn, asset_count, asset_count_vpn, dashboard_url,
+		dashboard_url_vpn, last_checked, last_checked_vpn, path_preference,
+		content_expires_at, timezone, clock_skew_ms, clock_checked_at,
+		mac_address, switch_port, versions, cms`
+
+const hostInsert = `INSERT INTO hosts (` + hostColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// hostUpdate takes hostToArgs without the leading ID, followed by the ID.
+const hostUpdate = `UPDATE hosts SET
+		ip_address = ?, nickname = ?, vpn_ip_address = ?, hostname = ?, notes = ?,
+		status = ?, status_vpn = ?, nsm_status = ?, nsm_status_vpn = ?,
+		nsm_version = ?, nsm_version_vpn = ?, anthias_version = ?,
+		anthias_version_vpn = ?, anthias_status = ?, anthias_status_vpn = ?,
+		cms_status = ?, cms_status_vpn = ?, asset_count = ?, asset_count_vpn = ?,
+		dashboard_url = ?, dashboard_url_vpn = ?, last_checked = ?,
+		last_checked_vpn = ?, path_preference = ?, content_expires_at = ?,
+		timezone = ?, clock_skew_ms = ?, clock_checked_at = ?, mac_address = ?,
+		switch_port = ?, versions = ?, cms = ?
+		WHERE id = ?`
+
 func hostToArgs(host types.Host) []any {
 	return []any{
 		host.ID,
@@ -932,6 +1259,15 @@ func hostToArgs(host types.Host) []any {
 		host.DashboardURLVPN,
 		formatTime(host.LastChecked),
 		formatTime(host.LastCheckedVPN),
+		string(host.PathPreference),
+		formatTime(host.ContentExpiresAt),
+		host.Timezone,
+		host.ClockSkewMS,
+		formatTime(host.ClockCheckedAt),
+		host.MACAddress,
+		host.SwitchPort,
+		encodeVersions(host.Versions),
+		string(host.CMS),
 	}
 }
 
@@ -948,6 +1284,14 @@ func scanHost(scanner interface{ Scan(dest ...any) error }) (types.Host, error)
 		assetCount, assetCountVPN            sql.NullInt64
 		dashboard, dashboardVPN              sql.NullString
 		lastChecked, lastCheckedVPN          sql.NullString
+		pathPreference                       sql.NullString
+		contentExpiresAt                     sql.NullString
+		timezone                             sql.NullString
+		clockSkew                            sql.NullInt64
+		clockCheckedAt                       sql.NullString
+		mac, switchPort                      sql.NullString
+		versions                             sql.NullString
+		cmsKind                              sql.NullString
 	)
 
 	if err := scanner.Scan(
@@ -957,7 +1301,9 @@ func scanHost(scanner interface{ Scan(dest ...any) error }) (types.Host, error)
 		&nsmVersion, &nsmVersionVPN, &anthiasVersion, &anthiasVersionVPN,
 		&anthiasStatus, &anthiasStatusVPN, &cmsStatus, &cmsStatusVPN,
 		&assetCount, &assetCountVPN, &dashboard, &dashboardVPN,
-		&lastChecked, &lastCheckedVPN,
+		&lastChecked, &lastCheckedVPN, &pathPreference, &contentExpiresAt,
+		&timezone, &clockSkew, &clockCheckedAt, &mac, &switchPort, &versions,
+		&cmsKind,
 	); err != nil {
 		return types.Host{}, err
 	}
@@ -987,11 +1333,33 @@ func scanHost(scanner interface{ Scan(dest ...any) error }) (types.Host, error)
 		DashboardURLVPN:   dashboardVPN.String,
 		LastChecked:       parseTime(lastChecked.String),
 		LastCheckedVPN:    parseTime(lastCheckedVPN.String),
+		PathPreference:    types.PathPreference(pathPreference.String),
+		ContentExpiresAt:  parseTime(contentExpiresAt.String),
+		Timezone:          timezone.String,
+		ClockSkewMS:       clockSkew.Int64,
+		ClockCheckedAt:    parseTime(clockCheckedAt.String),
+		MACAddress:        mac.String,
+		SwitchPort:        switchPort.String,
+		CMS:               types.CMSKind(cmsKind.String),
+	}
+	if versions.String != "" {
+		json.Unmarshal([]byte(versions.String), &host.Versions)
 	}
 
 	return host, nil
 }
 
+func encodeVersions(v types.Versions) any {
+	if v.IsZero() {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(data)
+}
+
 func formatTime(t time.Time) any {
 	if t.IsZero() {
 		return nil
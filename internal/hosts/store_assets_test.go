@@ -0,0 +1,117 @@
+package hosts
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/cms"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestFetchAssetsDetectsChanges(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	bodies := []string{
+		`[{"asset_id": "a1", "name": "Welcome", "is_enabled": 1}]`,
+		`[{"asset_id": "a1", "name": "Welcome", "is_enabled": 0}, {"asset_id": "a2", "name": "Lunch menu", "is_enabled": 1}]`,
+	}
+	var version, full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(bodies[version.Load()]))
+	}))
+	defer srv.Close()
+	ip := strings.TrimPrefix(srv.URL, "http://")
+	client := cms.New(types.CMSAnthias, srv.Client(), "", "")
+
+	for range 2 {
+		if assets, err := store.fetchAssets(client, "screen", ip); err != nil || len(assets) != 1 {
+			t.Fatalf("fetchAssets = %d assets, %v", len(assets), err)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("expected the second read to be conditional, got %d full and %d not modified", full.Load(), notModified.Load())
+	}
+	if entries, _ := store.ListAudit(AuditQuery{Action: AuditAssetsChanged}); len(entries) != 0 {
+		t.Errorf("expected the first list only to set the baseline, got %+v", entries)
+	}
+	if baselines, _ := store.AssetBaselines(); baselines["screen"].Source != BaselineFirstRead {
+		t.Errorf("expected the first list to become the baseline, got %+v", baselines)
+	}
+
+	// The change is in the audit log once the read returns.
+	version.Add(1)
+	if assets, err := store.fetchAssets(client, "screen", ip); err != nil || len(assets) != 2 {
+		t.Fatalf("fetchAssets = %d assets, %v", len(assets), err)
+	}
+	want := "2 assets (was 1); added: Lunch menu; changed: Welcome"
+	entries, _ := store.ListAudit(AuditQuery{Action: AuditAssetsChanged})
+	if len(entries) != 1 || entries[0].Target != "screen" || entries[0].Detail != want {
+		t.Errorf("expected one audit entry for the change, got %+v", entries)
+	}
+}
+
+func TestListNames(t *testing.T) {
+	if got := listNames([]string{"a", "b", "c"}, 2); got != "a, b and 1 more" {
+		t.Errorf("listNames = %q", got)
+	}
+}
+
+func TestAssetDrift(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "drift", IPAddress: "192.168.1.40"})
+	welcome := playlist.Asset{ID: "a1", Name: "Welcome"}
+	menu := playlist.Asset{ID: "a2", Name: "Happy hour"}
+	now := time.Now()
+
+	store.compareBaseline("drift", []playlist.Asset{welcome}, now)
+	if baselines, _ := store.AssetBaselines(); baselines["drift"].Source != BaselineFirstRead {
+		t.Fatalf("expected the first list to become the baseline, got %+v", baselines)
+	}
+	if _, drifted := store.Drift("drift"); drifted {
+		t.Fatal("expected no drift against the first list")
+	}
+
+	// Someone adds an asset in the Anthias dashboard.
+	store.RecordAssets("drift", []playlist.Asset{welcome, menu}, now.Add(time.Minute))
+	store.compareBaseline("drift", []playlist.Asset{welcome, menu}, now.Add(2*time.Minute))
+	d, drifted := store.Drift("drift")
+	if !drifted || d.Detail != "2 assets (was 1); added: Happy hour" || !d.Since.Equal(now.Add(time.Minute).UTC()) {
+		t.Fatalf("expected drift since the first differing read, got %+v", d)
+	}
+	host, _ := store.GetByID("drift")
+	if host.AssetDrift != d.Detail {
+		t.Errorf("expected the host flagged, got %q", host.AssetDrift)
+	}
+	if entries, _ := store.ListAudit(AuditQuery{Action: AuditAssetsDrifted}); len(entries) != 1 || entries[0].Target != "drift" {
+		t.Errorf("expected one audit entry for the drift, got %+v", entries)
+	}
+
+	if err := store.SetAssetBaseline("drift", []playlist.Asset{welcome, menu}, BaselineAdopted, now); err != nil {
+		t.Fatalf("SetAssetBaseline: %v", err)
+	}
+	if _, drifted := store.Drift("drift"); drifted {
+		t.Error("expected adopting the list to end the drift")
+	}
+}
@@ -0,0 +1,89 @@
+package hosts
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func TestAuditChainVerification(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(filepath.Join(dir, "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	id, err := identity.LoadOrCreate(filepath.Join(dir, identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	store.SetAuditSigner(id)
+
+	for _, action := range []string{"auth.login", "POST /api/hosts/reboot", "auth.logout"} {
+		if err := store.AppendAudit(AuditEntry{Actor: "alice", ActorType: ActorUser, Action: action}); err != nil {
+			t.Fatalf("AppendAudit: %v", err)
+		}
+	}
+
+	entries, err := store.AuditRange(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("AuditRange: %v", err)
+	}
+	if len(entries) != 3 || entries[1].PrevHash != entries[0].Hash {
+		t.Fatalf("expected 3 chained entries, got %+v", entries)
+	}
+
+	bundle := func(entries []AuditEntry) AuditBundle {
+		b := AuditBundle{
+			NodeID:      "node-1",
+			PublicKey:   base64.StdEncoding.EncodeToString(id.PublicKey()),
+			Fingerprint: id.Fingerprint(),
+			ExportedAt:  time.Now().UTC(),
+			Entries:     entries,
+		}
+		b.Signature = base64.StdEncoding.EncodeToString(id.Sign(b.SigningInput()))
+		return b
+	}
+
+	result, err := bundle(entries).Verify()
+	if err != nil {
+		t.Fatalf("expected valid bundle, got %v", err)
+	}
+	if result.Entries != 3 || result.FirstID != 1 || result.LastID != 3 {
+		t.Errorf("unexpected verification result %+v", result)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(b *AuditBundle)
+	}{
+		{"edited actor", func(b *AuditBundle) { b.Entries[1].Actor = "mallory" }},
+		{"removed entry", func(b *AuditBundle) { b.Entries = append(b.Entries[:1:1], b.Entries[2]) }},
+		{"truncated tail", func(b *AuditBundle) { b.Entries = b.Entries[:2] }},
+		{"other key", func(b *AuditBundle) {
+			other, _ := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+			b.PublicKey = base64.StdEncoding.EncodeToString(other.PublicKey())
+			b.Fingerprint = other.Fingerprint()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			copied := append([]AuditEntry(nil), entries...)
+			b := bundle(copied)
+			tt.tamper(&b)
+			if _, err := b.Verify(); err == nil {
+				t.Errorf("expected tampered bundle to fail verification")
+			}
+		})
+	}
+
+	// The key survives a restart.
+	again, err := identity.LoadOrCreate(filepath.Join(dir, identity.DefaultKeyFile))
+	if err != nil || again.Fingerprint() != id.Fingerprint() {
+		t.Errorf("expected identity to be reloaded, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package hosts
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// backends returns a fresh store of each kind, with node ID "a".
+func backends(t *testing.T) map[string]HostStore {
+	t.Helper()
+	mem, err := NewMemoryStore()
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	t.Cleanup(func() { mem.Close() })
+	mem.SetNodeID("a")
+	return map[string]HostStore{"sqlite": newNodeStore(t, "a"), "memory": mem}
+}
+
+func TestHostStoreBackends(t *testing.T) {
+	for name, store := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			before := store.LastModified()
+			for _, h := range []types.Host{
+				{ID: "b", IPAddress: "192.168.1.21", Nickname: "Cafe"},
+				{ID: "a", IPAddress: "192.168.1.20", Nickname: "Lobby"},
+			} {
+				if err := store.Add(h); err != nil {
+					t.Fatalf("Add: %v", err)
+				}
+			}
+			select {
+			case <-store.Updates():
+			default:
+				t.Error("Expected an update after Add")
+			}
+			if !store.LastModified().After(before) {
+				t.Error("Expected LastModified to move on")
+			}
+			if err := store.Add(types.Host{IPAddress: "192.168.1.22"}); err != nil {
+				t.Fatalf("Add without ID: %v", err)
+			}
+
+			list := store.GetAll()
+			if len(list) != 3 || list[0].ID != "a" || list[1].ID != "b" || list[2].ID == "" {
+				t.Fatalf("Expected three hosts by IP with IDs, got %+v", list)
+			}
+			if list[0].Health != types.HealthOffline {
+				t.Errorf("Expected a host without checks or heartbeats offline, got %s", list[0].Health)
+			}
+
+			if err := store.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Front door" }); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			h, err := store.GetByIP("192.168.1.20")
+			if err != nil || h.Nickname != "Front door" || h.Versions.Fields["nickname"].Node != "a" {
+				t.Errorf("Expected the edit stamped by a, got %+v (%v)", h, err)
+			}
+			if err := store.Update("10.0.0.1", func(*types.Host) {}); err == nil {
+				t.Error("Expected Update of a missing host to fail")
+			}
+
+			if err := store.Upsert(types.Host{ID: "b", IPAddress: "192.168.1.21", Nickname: "Canteen"}); err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+			if h, _ := store.GetByID("b"); h.Nickname != "Canteen" {
+				t.Errorf("Expected Upsert to replace b, got %q", h.Nickname)
+			}
+
+			if err := store.Delete("192.168.1.22"); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if err := store.DeleteByID("b"); err != nil {
+				t.Fatalf("DeleteByID: %v", err)
+			}
+			if err := store.DeleteByID("b"); err == nil {
+				t.Error("Expected a second DeleteByID to fail")
+			}
+			if _, err := store.GetByID("b"); err == nil {
+				t.Error("Expected b gone")
+			}
+
+			if err := store.ReplaceAll([]types.Host{{ID: "c", IPAddress: "192.168.1.30"}}); err != nil {
+				t.Fatalf("ReplaceAll: %v", err)
+			}
+			if list := store.GetAll(); len(list) != 1 || list[0].ID != "c" {
+				t.Errorf("Expected only c after ReplaceAll, got %+v", list)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open("postgres", ""); err == nil {
+		t.Error("Expected an unknown backend refused")
+	}
+
+	path := filepath.Join(t.TempDir(), "hosts.db")
+	a, err := Open(BackendMemory, path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer a.Close()
+	b, err := Open(BackendMemory, path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer b.Close()
+
+	if err := a.Add(types.Host{ID: "a", IPAddress: "192.168.1.20"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if list := b.GetAll(); len(list) != 0 {
+		t.Errorf("Expected stores in memory kept apart, got %+v", list)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no database file written, got %v", err)
+	}
+	if _, err := a.BackupCurrent(5); !errors.Is(err, ErrInMemory) {
+		t.Errorf("Expected backups refused in memory, got %v", err)
+	}
+}
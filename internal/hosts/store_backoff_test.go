@@ -0,0 +1,62 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{0: 0, 1: backoffBase, 2: 2 * backoffBase, 3: 4 * backoffBase, 20: backoffMax} {
+		if got := backoffDelay(n); got != want {
+			t.Errorf("backoffDelay(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "dead", IPAddress: "192.168.1.250"})
+
+	now := time.Now()
+	dead := types.Host{ID: "dead", Status: types.StatusUnreachable}
+	store.failures.record(&dead, now)
+	store.failures.record(&dead, now)
+	if store.failures.due("dead", now.Add(backoffBase)) {
+		t.Error("expected the host to be skipped after two failures")
+	}
+	if !store.failures.due("dead", now.Add(2*backoffBase)) {
+		t.Error("expected the host to be due once the backoff has passed")
+	}
+	if h, _ := store.GetByID("dead"); h.FailedChecks != 2 || !h.NextCheckAt.Equal(now.Add(2*backoffBase)) {
+		t.Errorf("expected 2 failed checks on read, got %d (next %s)", h.FailedChecks, h.NextCheckAt)
+	}
+
+	// Another store, e.g. one opened by a test or a tool, keeps its own.
+	other, err := NewStore(filepath.Join(t.TempDir(), "other.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer other.Close()
+	if !other.failures.due("dead", now) {
+		t.Error("expected another store not to share the backoff")
+	}
+
+	// A reachable VPN is enough to clear the count.
+	dead.StatusVPN = types.StatusHealthy
+	store.failures.record(&dead, now)
+	if !store.failures.due("dead", now) {
+		t.Error("expected a successful check to clear the backoff")
+	}
+
+	dead.StatusVPN = ""
+	store.failures.record(&dead, now)
+	store.ResetBackoff("dead")
+	if !store.failures.due("dead", now) {
+		t.Error("expected ResetBackoff to make the host due")
+	}
+}
@@ -2,6 +2,7 @@ package hosts
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -102,6 +103,45 @@ func TestBackupCurrentCreatesAndPrunesBackups(t *testing.T) {
 	}
 }
 
+func TestOpenExport(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(filepath.Join(dir, "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	if err := store.Add(types.Host{ID: "a", IPAddress: "192.168.0.1"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	export, err := store.OpenExport()
+	if err != nil {
+		t.Fatalf("OpenExport: %v", err)
+	}
+	copyPath := filepath.Join(dir, "copy.db")
+	out, _ := os.Create(copyPath)
+	n, err := io.Copy(out, export)
+	out.Close()
+	if err != nil || n != export.Size() {
+		t.Fatalf("Expected %d bytes copied, got %d (%v)", export.Size(), n, err)
+	}
+	if err := export.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := os.Stat(export.Name()); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary copy removed, got %v", err)
+	}
+
+	copied, err := NewStore(copyPath)
+	if err != nil {
+		t.Fatalf("NewStore on the copy: %v", err)
+	}
+	defer copied.Close()
+	if _, err := copied.GetByID("a"); err != nil {
+		t.Errorf("Expected the copy to hold host a: %v", err)
+	}
+}
+
 func TestNewStoreRecoversFromCorruptDBWithoutBackups(t *testing.T) {
 	dir := t.TempDir()
 	dbPath := filepath.Join(dir, "hosts.db")
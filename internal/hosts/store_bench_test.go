@@ -0,0 +1,102 @@
+package hosts
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// benchSizes are the fleet sizes the store benchmarks run at: a venue, a
+// large estate, and well past anything deployed today.
+var benchSizes = []int{100, 1000, 10000}
+
+// benchHosts returns n hosts filled in as a running fleet would have them.
+func benchHosts(n int) []types.Host {
+	now := time.Now().UTC()
+	list := make([]types.Host, n)
+	for i := range list {
+		list[i] = types.Host{
+			ID:           fmt.Sprintf("host-%05d", i),
+			Hostname:     fmt.Sprintf("pi-%05d", i),
+			Nickname:     fmt.Sprintf("Screen %d", i),
+			IPAddress:    fmt.Sprintf("10.%d.%d.%d", i/65536, i/256%256, i%256),
+			Notes:        "Ground floor, left of the entrance",
+			Status:       types.StatusHealthy,
+			NSMStatus:    "NSM Online",
+			NSMVersion:   types.Version,
+			CMSStatus:    types.CMSOnline,
+			AssetCount:   12,
+			DashboardURL: fmt.Sprintf("http://10.%d.%d.%d:8080", i/65536, i/256%256, i%256),
+			LastChecked:  now,
+		}
+	}
+	return list
+}
+
+func newBenchStore(b *testing.B, n int) (*Store, []types.Host) {
+	b.Helper()
+	store, err := NewStore(filepath.Join(b.TempDir(), "hosts.db"))
+	if err != nil {
+		b.Fatalf("NewStore: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	list := benchHosts(n)
+	if err := store.ReplaceAll(list); err != nil {
+		b.Fatalf("ReplaceAll: %v", err)
+	}
+	return store, list
+}
+
+func BenchmarkGetAll(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			store, _ := newBenchStore(b, n)
+			for b.Loop() {
+				if got := store.GetAll(); len(got) != n {
+					b.Fatalf("expected %d hosts, got %d", n, len(got))
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUpsert updates one host of the list at a time, as received
+// announcements do.
+func BenchmarkUpsert(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			store, list := newBenchStore(b, n)
+			i := 0
+			for b.Loop() {
+				h := list[i%n]
+				h.AssetCount = i
+				if err := store.Upsert(h); err != nil {
+					b.Fatalf("Upsert: %v", err)
+				}
+				i++
+			}
+		})
+	}
+}
+
+// BenchmarkReplaceAll replaces the whole list, as a received push does,
+// changing one host each time.
+func BenchmarkReplaceAll(b *testing.B) {
+	for _, n := range benchSizes {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			store, list := newBenchStore(b, n)
+			i := 0
+			for b.Loop() {
+				list[i%n].Nickname = fmt.Sprintf("Screen %d", i)
+				if err := store.ReplaceAll(list); err != nil {
+					b.Fatalf("ReplaceAll: %v", err)
+				}
+				i++
+			}
+		})
+	}
+}
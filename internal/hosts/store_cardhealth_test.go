@@ -0,0 +1,72 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestCardHealth(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", IPAddress: "192.168.1.21"})
+
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	store.RecordCardHealth("lobby", CardHealth{LifeUsed: 20}, now)
+	// The same reading an hour later adds nothing; a day later it does.
+	store.RecordCardHealth("lobby", CardHealth{LifeUsed: 20}, now.Add(time.Hour))
+	store.RecordCardHealth("lobby", CardHealth{LifeUsed: 20}, now.Add(25*time.Hour))
+	// A change is recorded at once.
+	store.RecordCardHealth("lobby", CardHealth{LifeUsed: 30, FSErrors: 1}, now.Add(26*time.Hour))
+	store.RecordCardHealth("cafe", CardHealth{ReadOnly: true}, now)
+
+	history, err := store.CardHealthHistory("lobby")
+	if err != nil {
+		t.Fatalf("CardHealthHistory: %v", err)
+	}
+	if len(history) != 3 || !history[0].At.Equal(now) || history[2].FSErrors != 1 {
+		t.Fatalf("expected 3 samples oldest first, got %+v", history)
+	}
+
+	latest, err := store.LatestCardHealth()
+	if err != nil {
+		t.Fatalf("LatestCardHealth: %v", err)
+	}
+	if latest["lobby"].LifeUsed != 30 || !latest["cafe"].ReadOnly {
+		t.Errorf("unexpected latest samples: %+v", latest)
+	}
+
+	// Samples older than a year are pruned.
+	store.RecordCardHealth("lobby", CardHealth{LifeUsed: 40}, now.Add(cardHistoryLimit+26*time.Hour))
+	if history, _ := store.CardHealthHistory("lobby"); len(history) != 2 {
+		t.Errorf("expected old samples pruned, got %+v", history)
+	}
+
+	// Deleting a host forgets its card.
+	if err := store.DeleteByID("cafe"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if latest, _ := store.LatestCardHealth(); len(latest) != 1 {
+		t.Errorf("expected only lobby left, got %+v", latest)
+	}
+}
+
+func TestCardHealthProblems(t *testing.T) {
+	tests := []struct {
+		card CardHealth
+		want int
+	}{
+		{CardHealth{}, 0},
+		{CardHealth{LifeUsed: 70, PreEOL: PreEOLNormal}, 0},
+		{CardHealth{LifeUsed: 80}, 1},
+		{CardHealth{LifeUsed: 110}, 1},
+		{CardHealth{PreEOL: PreEOLUrgent}, 1},
+		{CardHealth{FSErrors: 2, ReadOnly: true}, 2},
+	}
+	for _, tt := range tests {
+		if got := tt.card.Problems(80); len(got) != tt.want {
+			t.Errorf("%+v: got %q, want %d problems", tt.card, got, tt.want)
+		}
+	}
+}
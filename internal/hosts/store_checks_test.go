@@ -0,0 +1,63 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestCheckConfig(t *testing.T) {
+	for _, bad := range []CheckConfig{
+		{ProbeSet: ProbeSet{TimeoutMS: 50}},
+		{ProbeSet: ProbeSet{Disabled: []Probe{"tcp"}}},
+		{Hosts: map[string]ProbeSet{"nsm-only": {TimeoutMS: 120_000}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	if plan := store.planFor("any"); plan.timeout != DefaultCheckTimeout || !plan.enabled(ProbeAnthias) {
+		t.Errorf("expected every probe with the default timeout, got %+v", plan)
+	}
+
+	_, err = store.SaveCheckConfig(CheckConfig{
+		ProbeSet: ProbeSet{TimeoutMS: 5000, Disabled: []Probe{ProbeHealth}},
+		Hosts: map[string]ProbeSet{
+			"nsm-only": {Disabled: []Probe{ProbeAnthias}},
+			"slow":     {TimeoutMS: 10_000},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SaveCheckConfig: %v", err)
+	}
+
+	if plan := store.planFor("other"); plan.timeout != 5*time.Second || plan.enabled(ProbeHealth) || !plan.enabled(ProbeAnthias) {
+		t.Errorf("expected the global settings, got %+v", plan)
+	}
+	// A host's disabled list replaces the global one.
+	if plan := store.planFor("nsm-only"); plan.timeout != 5*time.Second || !plan.enabled(ProbeHealth) || plan.enabled(ProbeAnthias) {
+		t.Errorf("expected the host's probes with the global timeout, got %+v", plan)
+	}
+	if plan := store.planFor("slow"); plan.timeout != 10*time.Second || plan.enabled(ProbeHealth) {
+		t.Errorf("expected the host's timeout with the global probes, got %+v", plan)
+	}
+
+	if cfg, err := store.CheckConfig(); err != nil || cfg.TimeoutMS != 5000 || len(cfg.Hosts) != 2 {
+		t.Errorf("expected the saved settings, got %+v (%v)", cfg, err)
+	}
+
+	host := types.Host{ID: "nsm-only", IPAddress: "127.0.0.1"}
+	store.CheckHealth(&host)
+	if host.CMSStatus != types.CMSNotChecked {
+		t.Errorf("expected the Anthias probe to be skipped, got %q", host.CMSStatus)
+	}
+}
@@ -0,0 +1,56 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestClockSkew(t *testing.T) {
+	sent := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	received := sent.Add(200 * time.Millisecond)
+
+	tests := []struct {
+		name   string
+		remote time.Time
+		want   time.Duration
+	}{
+		{"in step", sent.Add(100 * time.Millisecond), 0},
+		{"ahead", sent.Add(12*time.Second + 100*time.Millisecond), 12 * time.Second},
+		{"behind", sent.Add(-3 * time.Minute), -3*time.Minute - 100*time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := clockSkew(sent, received, tt.remote); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClockSkewStored(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	checked := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20", ClockSkewMS: -90000, ClockCheckedAt: checked})
+
+	h, err := store.GetByID("a")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if h.ClockSkewMS != -90000 || !h.ClockCheckedAt.Equal(checked) {
+		t.Errorf("expected -90000ms at %v, got %dms at %v", checked, h.ClockSkewMS, h.ClockCheckedAt)
+	}
+	if got := h.ClockWarning(); got != "Clock 1m behind" {
+		t.Errorf("ClockWarning() = %q, want %q", got, "Clock 1m behind")
+	}
+
+	h.ClockSkewMS = 4000
+	if got := h.ClockWarning(); got != "" {
+		t.Errorf("4s skew should not warn, got %q", got)
+	}
+}
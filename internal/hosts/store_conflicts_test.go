@@ -0,0 +1,89 @@
+package hosts
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestConflicts(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{
+		{ID: "a", IPAddress: "192.168.1.20", Hostname: "lobby-pi"},
+		{ID: "b", IPAddress: "192.168.1.20", Hostname: "bar-pi"},
+		{ID: "c", IPAddress: "192.168.1.21", Hostname: "lobby-pi"},
+		{ID: "d", IPAddress: "192.168.1.22", Hostname: "localhost"},
+		{ID: "e", IPAddress: "192.168.1.23", Hostname: "localhost"},
+		{ID: "f", IPAddress: "192.168.1.30", Nickname: "Foyer"},
+		{ID: "g", IPAddress: "192.168.1.31"},
+	})
+	now := time.Now().UTC()
+	store.PutPeer(Peer{NodeID: "f", PublicKey: "key", Address: "192.168.1.31", LastSeen: now})
+	// An old heartbeat from elsewhere is not a conflict.
+	store.PutPeer(Peer{NodeID: "g", PublicKey: "key", Address: "192.168.1.99", LastSeen: now.Add(-2 * conflictPeerMaxAge)})
+
+	conflicts, err := store.Conflicts()
+	if err != nil {
+		t.Fatalf("Conflicts: %v", err)
+	}
+	keys := make([]string, len(conflicts))
+	for i, c := range conflicts {
+		keys[i] = c.Key
+	}
+	want := []string{"ip:192.168.1.20", "id:f", "hostname:lobby-pi"}
+	if len(keys) != len(want) {
+		t.Fatalf("got conflicts %v, want %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("got conflicts %v, want %v", keys, want)
+		}
+	}
+	if id := conflicts[1]; id.Address != "192.168.1.31" || len(id.Hosts) != 2 || id.Hosts[1].ID != "g" {
+		t.Errorf("unexpected id conflict %+v", id)
+	}
+
+	if err := store.ResolveConflict("hostname:lobby-pi", ActionReaddress, ""); !errors.Is(err, ErrInvalidResolution) {
+		t.Errorf("expected ErrInvalidResolution, got %v", err)
+	}
+	if err := store.ResolveConflict("ip:192.168.1.20", ActionKeep, "c"); !errors.Is(err, ErrInvalidResolution) {
+		t.Errorf("expected ErrInvalidResolution for a host outside the conflict, got %v", err)
+	}
+
+	// Keeping one of two hosts at an IP leaves the other's neighbours alone.
+	if err := store.ResolveConflict("ip:192.168.1.20", ActionKeep, "b"); err != nil {
+		t.Fatalf("keep: %v", err)
+	}
+	if _, err := store.GetByID("a"); err == nil {
+		t.Error("expected a to be deleted")
+	}
+	if _, err := store.GetByID("b"); err != nil {
+		t.Errorf("expected b to be kept: %v", err)
+	}
+
+	// Readdressing moves f over g's stale record.
+	if err := store.ResolveConflict("id:f", ActionReaddress, ""); err != nil {
+		t.Fatalf("readdress: %v", err)
+	}
+	if h, err := store.GetByID("f"); err != nil || h.IPAddress != "192.168.1.31" || h.Nickname != "Foyer" {
+		t.Errorf("expected f at 192.168.1.31, got %+v (%v)", h, err)
+	}
+	if _, err := store.GetByID("g"); err == nil {
+		t.Error("expected g to be replaced")
+	}
+
+	if conflicts, _ := store.Conflicts(); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts left, got %+v", conflicts)
+	}
+	if err := store.ResolveConflict("id:f", ActionReaddress, ""); !errors.Is(err, ErrConflictNotFound) {
+		t.Errorf("expected ErrConflictNotFound, got %v", err)
+	}
+}
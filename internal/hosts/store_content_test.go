@@ -0,0 +1,60 @@
+package hosts
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestContentEnd(t *testing.T) {
+	decode := func(s string) []playlist.Asset {
+		var assets []playlist.Asset
+		if err := json.Unmarshal([]byte(s), &assets); err != nil {
+			t.Fatalf("decode %s: %v", s, err)
+		}
+		return assets
+	}
+
+	tests := []struct {
+		name   string
+		assets string
+		want   time.Time
+	}{
+		{"latest enabled end", `[
+			{"end_date": "2026-03-01T18:00:00+00:00", "is_enabled": 1},
+			{"end_date": "2026-03-04T09:00:00", "is_enabled": true},
+			{"end_date": "2027-01-01T00:00:00Z", "is_enabled": 0}
+		]`, time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)},
+		{"no enabled assets", `[{"end_date": "2026-03-01T18:00:00Z", "is_enabled": false}]`, time.Time{}},
+		{"unreadable end date", `[{"end_date": "2026-03-01T18:00:00Z"}, {"end_date": ""}]`, time.Time{}},
+		{"empty", `[]`, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := contentEnd(decode(tt.assets)); !got.Equal(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentExpiresAtStored(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	end := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20", ContentExpiresAt: end})
+
+	h, err := store.GetByID("a")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if !h.ContentExpiresAt.Equal(end) {
+		t.Errorf("expected %v, got %v", end, h.ContentExpiresAt)
+	}
+}
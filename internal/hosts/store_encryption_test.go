@@ -0,0 +1,167 @@
+package hosts
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// testSealer seals with AES-GCM under a fixed key and nonce, which is fine
+// for a test and nothing else.
+type testSealer struct{ aead cipher.AEAD }
+
+func newTestSealer(t *testing.T, key byte) *testSealer {
+	t.Helper()
+	block, err := aes.NewCipher(bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, _ := cipher.NewGCM(block)
+	return &testSealer{aead: aead}
+}
+
+func (s *testSealer) Seal(plain, additional []byte) ([]byte, error) {
+	return s.aead.Seal(nil, make([]byte, s.aead.NonceSize()), plain, additional), nil
+}
+
+func (s *testSealer) Open(sealed, additional []byte) ([]byte, error) {
+	return s.aead.Open(nil, make([]byte, s.aead.NonceSize()), sealed, additional)
+}
+
+func rawSetting(t *testing.T, store *Store, key string) string {
+	t.Helper()
+	var raw string
+	if err := store.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&raw); err != nil {
+		t.Fatalf("read %s: %v", key, err)
+	}
+	return raw
+}
+
+func TestSettingsEncryption(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.PutSetting("smtp", map[string]string{"password": "hunter2"})
+
+	if _, err := store.SetEncryption(true); !errors.Is(err, ErrNoSealer) {
+		t.Fatalf("Expected encryption refused without a key, got %v", err)
+	}
+	store.SetSealer(newTestSealer(t, 1))
+	st, err := store.SetEncryption(true)
+	if err != nil || !st.Enabled || st.Sealed != 1 || st.Unopened != 0 {
+		t.Fatalf("Expected the existing setting encrypted, got %+v (%v)", st, err)
+	}
+	store.PutSetting("mqtt", map[string]string{"password": "swordfish"})
+	for _, key := range []string{"smtp", "mqtt"} {
+		if raw := rawSetting(t, store, key); !strings.HasPrefix(raw, sealedPrefix) || strings.Contains(raw, "password") {
+			t.Errorf("Expected %s stored encrypted, got %q", key, raw)
+		}
+	}
+	var got map[string]string
+	if ok, err := store.GetSetting("mqtt", &got); !ok || err != nil || got["password"] != "swordfish" {
+		t.Errorf("Expected mqtt to read back, got %v %v (%v)", ok, got, err)
+	}
+
+	// A replaced key cannot open the settings, and says so.
+	store.SetSealer(newTestSealer(t, 2))
+	if _, err := store.GetSetting("smtp", &got); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected ErrWrongKey with another key, got %v", err)
+	}
+	if st, _ := store.Encryption(); st.Unopened != 2 {
+		t.Errorf("Expected 2 settings unopened, got %+v", st)
+	}
+
+	// A value moved to another key does not open either.
+	store.SetSealer(newTestSealer(t, 1))
+	store.db.Exec(`UPDATE settings SET value = ? WHERE key = 'smtp'`, rawSetting(t, store, "mqtt"))
+	if _, err := store.GetSetting("smtp", &got); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Expected a moved value refused, got %v", err)
+	}
+
+	st, err = store.SetEncryption(false)
+	if err != nil || st.Enabled || st.Sealed != 1 {
+		t.Fatalf("Expected all but the moved value decrypted, got %+v (%v)", st, err)
+	}
+	if raw := rawSetting(t, store, "mqtt"); raw != `{"password":"swordfish"}` {
+		t.Errorf("Expected mqtt stored in the clear again, got %q", raw)
+	}
+}
+
+func rawField(t *testing.T, store *Store, field sealedField, key string) string {
+	t.Helper()
+	var raw string
+	if err := store.db.QueryRow(`SELECT `+field.column+` FROM `+field.table+` WHERE `+field.key+` = ?`, key).Scan(&raw); err != nil {
+		t.Fatalf("read %s.%s: %v", field.table, field.column, err)
+	}
+	return raw
+}
+
+func TestFieldEncryption(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.SetSealer(newTestSealer(t, 1))
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Notes: "Key safe code 4711"})
+	if _, err := store.SetEncryption(true); err != nil {
+		t.Fatalf("SetEncryption: %v", err)
+	}
+
+	store.AddUser(types.User{ID: "u1", Username: "ann", Email: "ann@example.com", PasswordHash: "$2a$10$hash", Role: types.RoleAdmin})
+	store.CreateToken(AuthToken{Hash: "t1", Kind: TokenInvite, Email: "bob@example.com", ExpiresAt: time.Now().Add(time.Hour)})
+	store.AppendAudit(AuditEntry{Actor: "ann", ActorType: ActorUser, Action: "host.updated", Target: "lobby", Detail: "notes changed", RemoteAddr: "10.0.0.5"})
+	store.SaveSnapshot("Before", "")
+
+	for _, tt := range []struct {
+		field     sealedField
+		key, text string
+	}{
+		{fieldHostNotes, "lobby", "4711"},
+		{fieldUserEmail, "u1", "ann@"},
+		{fieldUserPassword, "u1", "$2a$"},
+		{fieldTokenEmail, "t1", "bob@"},
+		{fieldAuditDetail, "1", "notes"},
+		{fieldAuditAddr, "1", "10.0.0.5"},
+		{fieldSnapshotData, "Before", "4711"},
+	} {
+		if raw := rawField(t, store, tt.field, tt.key); !strings.HasPrefix(raw, sealedPrefix) || strings.Contains(raw, tt.text) {
+			t.Errorf("Expected %s.%s stored encrypted, got %q", tt.field.table, tt.field.column, raw)
+		}
+	}
+
+	// Everything reads back in the clear, and the audit chain still verifies.
+	if h := getHost(t, store, "lobby"); h.Notes != "Key safe code 4711" {
+		t.Errorf("Expected the notes to open, got %q", h.Notes)
+	}
+	if u, err := store.GetUserByUsername("ann"); err != nil || u.Email != "ann@example.com" || u.PasswordHash != "$2a$10$hash" {
+		t.Errorf("Expected the user to open, got %+v (%v)", u, err)
+	}
+	if tok, err := store.GetToken("t1", TokenInvite); err != nil || tok.Email != "bob@example.com" {
+		t.Errorf("Expected the invitation to open, got %+v (%v)", tok, err)
+	}
+	if snap, err := store.GetSnapshot("Before"); err != nil || len(snap.Hosts) != 1 || snap.Hosts[0].Notes != "Key safe code 4711" {
+		t.Errorf("Expected the snapshot to open, got %+v (%v)", snap, err)
+	}
+	entries, err := store.ListAudit(AuditQuery{Text: "NOTES"})
+	if err != nil || len(entries) != 1 || entries[0].RemoteAddr != "10.0.0.5" || entries[0].computeHash() != entries[0].Hash {
+		t.Errorf("Expected the audit entry found by its sealed detail, got %+v (%v)", entries, err)
+	}
+
+	// Another key leaves the fields sealed rather than failing reads.
+	store.SetSealer(newTestSealer(t, 2))
+	if h := getHost(t, store, "lobby"); !strings.HasPrefix(h.Notes, sealedPrefix) {
+		t.Errorf("Expected the notes left sealed, got %q", h.Notes)
+	}
+	if st, _ := store.Encryption(); st.Unopened != st.Sealed || st.Sealed < 7 {
+		t.Errorf("Expected every value unopened, got %+v", st)
+	}
+
+	store.SetSealer(newTestSealer(t, 1))
+	if st, err := store.SetEncryption(false); err != nil || st.Sealed != 0 {
+		t.Fatalf("Expected everything decrypted, got %+v (%v)", st, err)
+	}
+	if raw := rawField(t, store, fieldUserEmail, "u1"); raw != "ann@example.com" {
+		t.Errorf("Expected the email stored in the clear again, got %q", raw)
+	}
+}
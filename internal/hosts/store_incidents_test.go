@@ -0,0 +1,75 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestIncidents(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", IPAddress: "192.168.1.21"})
+
+	now := time.Date(2026, 3, 4, 9, 0, 0, 0, time.UTC)
+	if _, recorded, _ := store.RecordIncidentEvent("lobby", "Lobby went offline", IncidentEvent{At: now, Kind: IncidentOnline}); recorded {
+		t.Fatal("expected an online event without an open incident dropped")
+	}
+	inc, recorded, err := store.RecordIncidentEvent("lobby", "Lobby went offline", IncidentEvent{At: now, Kind: IncidentOffline, Detail: "No heartbeat"})
+	if err != nil || !recorded || inc.Status != IncidentOpen {
+		t.Fatalf("RecordIncidentEvent: %+v, %v, %v", inc, recorded, err)
+	}
+	// The offline alert fires; the host coming back does not end the
+	// incident while it is still firing.
+	again, _, _ := store.RecordIncidentEvent("lobby", "Lobby offline on lobby", IncidentEvent{At: now.Add(time.Minute), Kind: IncidentAlertFired})
+	if again.ID != inc.ID || again.Title != "Lobby went offline" {
+		t.Fatalf("expected the alert added to the open incident, got %+v", again)
+	}
+	store.AppendAudit(AuditEntry{Time: now.Add(-time.Minute), Actor: "alice", Action: "POST /api/hosts/reboot", Target: "192.168.1.20", Detail: "reboot"})
+	store.AppendAudit(AuditEntry{Time: now.Add(2 * time.Minute), Actor: "bob", Action: "POST /api/hosts/reboot", Target: "192.168.1.21"})
+	store.RecordBoot("lobby", BootReport{BootID: "b1", BootedAt: now.Add(3 * time.Minute), Shutdown: ShutdownClean}, now.Add(-2*time.Minute), now.Add(4*time.Minute))
+	if back, _, _ := store.RecordIncidentEvent("lobby", "", IncidentEvent{At: now.Add(5 * time.Minute), Kind: IncidentOnline}); back.Status != IncidentOpen {
+		t.Fatalf("expected the incident open while the alert fires, got %+v", back)
+	}
+	done, _, _ := store.RecordIncidentEvent("lobby", "", IncidentEvent{At: now.Add(7 * time.Minute), Kind: IncidentAlertResolved})
+	if done.Status != IncidentResolved || done.Duration != 420 {
+		t.Fatalf("expected the incident resolved after 7 minutes, got %+v", done)
+	}
+
+	store.RecordIncidentEvent("cafe", "Cafe went offline", IncidentEvent{At: now.Add(time.Hour), Kind: IncidentOffline})
+	open, err := store.ListIncidents(IncidentQuery{Status: IncidentOpen}, now.Add(2*time.Hour))
+	if err != nil || len(open) != 1 || open[0].HostID != "cafe" || open[0].Duration != 3600 {
+		t.Fatalf("unexpected open incidents: %+v, %v", open, err)
+	}
+	if all, _ := store.ListIncidents(IncidentQuery{}, now); len(all) != 2 || all[0].HostID != "cafe" {
+		t.Errorf("expected both incidents, newest first, got %+v", all)
+	}
+	if lobby, _ := store.ListIncidents(IncidentQuery{HostID: "lobby", Since: now.Add(time.Minute)}, now); len(lobby) != 0 {
+		t.Errorf("expected none opened since, got %+v", lobby)
+	}
+
+	got, err := store.GetIncident(inc.ID, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetIncident: %v", err)
+	}
+	var kinds []string
+	for _, ev := range got.Timeline {
+		kinds = append(kinds, ev.Kind)
+	}
+	want := []string{IncidentAudit, IncidentOffline, IncidentAlertFired, IncidentReboot, IncidentOnline, IncidentAlertResolved, IncidentClosed}
+	if len(kinds) != len(want) {
+		t.Fatalf("unexpected timeline: %+v", got.Timeline)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("unexpected timeline: %+v", got.Timeline)
+		}
+	}
+	if got.Timeline[0].Actor != "alice" || got.Timeline[3].Detail != "Booted after a clean shutdown" {
+		t.Errorf("unexpected timeline entries: %+v", got.Timeline)
+	}
+	if _, err := store.GetIncident("unknown", now); err != ErrIncidentNotFound {
+		t.Errorf("expected ErrIncidentNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package hosts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestInventory(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", IPAddress: "192.168.1.21"})
+
+	if _, err := store.GetInventory("lobby"); !errors.Is(err, ErrInventoryNotFound) {
+		t.Fatalf("expected ErrInventoryNotFound, got %v", err)
+	}
+
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	store.PutInventory("lobby", Inventory{Model: "Raspberry Pi 4 Model B Rev 1.4", Serial: "10000000a1b2c3d4", RAMBytes: 4 << 30}, now)
+	store.PutInventory("cafe", Inventory{Model: "Raspberry Pi Compute Module 4 Rev 1.0"}, now)
+	store.PutInventory("lobby", Inventory{Model: "Raspberry Pi 4 Model B Rev 1.4", Serial: "10000000a1b2c3d4", RAMBytes: 4 << 30, OS: "Debian GNU/Linux 12 (bookworm)"}, now.Add(time.Minute))
+
+	got, err := store.GetInventory("lobby")
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if got.OS != "Debian GNU/Linux 12 (bookworm)" || got.RAMBytes != 4<<30 || !got.ReportedAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected the latest report, got %+v", got)
+	}
+
+	// Deleting a host forgets its hardware.
+	if err := store.DeleteByID("cafe"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	all, err := store.ListInventory()
+	if err != nil {
+		t.Fatalf("ListInventory: %v", err)
+	}
+	if len(all) != 1 || all["lobby"].Serial != "10000000a1b2c3d4" {
+		t.Errorf("expected only lobby left, got %+v", all)
+	}
+}
@@ -0,0 +1,119 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestHostHealth(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{
+		{ID: "a", IPAddress: "192.168.1.20", Status: types.StatusUnreachable},
+		{ID: "b", IPAddress: "192.168.1.21", Status: types.StatusHealthy},
+		{ID: "c", IPAddress: "192.168.1.22", Status: types.StatusUnhealthy},
+	})
+
+	now := time.Now().UTC()
+	store.PutPeer(Peer{NodeID: "a", PublicKey: "key", BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now})
+
+	want := map[string]types.HealthStatus{
+		"a": types.HealthOnline,   // heartbeat wins over a failed check
+		"b": types.HealthOnline,   // no heartbeat, healthy check
+		"c": types.HealthDegraded, // no heartbeat, unhealthy check
+	}
+	for _, h := range store.GetAll() {
+		if h.Health != want[h.ID] {
+			t.Errorf("GetAll %s: got %s, want %s", h.ID, h.Health, want[h.ID])
+		}
+	}
+
+	h, err := store.GetByID("a")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if h.Health != types.HealthOnline || !h.LastSeen.Equal(now) {
+		t.Errorf("GetByID: got %s last seen %v", h.Health, h.LastSeen)
+	}
+	h, err = store.GetByIP("192.168.1.22")
+	if err != nil {
+		t.Fatalf("GetByIP: %v", err)
+	}
+	if h.Health != types.HealthDegraded || !h.LastSeen.IsZero() {
+		t.Errorf("GetByIP: got %s last seen %v", h.Health, h.LastSeen)
+	}
+}
+
+func TestRefreshHealth(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{{ID: "a", IPAddress: "192.168.1.20"}})
+	now := time.Now().UTC()
+	store.PutPeer(Peer{NodeID: "a", PublicKey: "key", BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now})
+
+	drain := func() bool {
+		select {
+		case <-store.Updates():
+			return true
+		default:
+			return false
+		}
+	}
+
+	drain()
+	store.RefreshHealth()
+	if !drain() {
+		t.Error("expected an update on the first refresh")
+	}
+	store.RefreshHealth()
+	if drain() {
+		t.Error("expected no update when health is unchanged")
+	}
+
+	// The peer goes silent.
+	silent := now.Add(-2 * time.Minute)
+	store.PutPeer(Peer{NodeID: "a", PublicKey: "key", BootedAt: silent.Add(-time.Hour), SentAt: silent, LastSeen: silent})
+	drain()
+	store.RefreshHealth()
+	if !drain() {
+		t.Error("expected an update when the peer went offline")
+	}
+}
+
+func TestHostThrottle(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "b", IPAddress: "192.168.1.21"})
+
+	now := time.Now().UTC()
+	bits := uint32(0x50005) // Under-voltage and throttled now, and since boot
+	store.PutPeer(Peer{NodeID: "a", PublicKey: "key", SentAt: now, LastSeen: now, Throttled: &bits})
+	store.PutPeer(Peer{NodeID: "b", PublicKey: "key", SentAt: now, LastSeen: now})
+
+	if p, _ := store.GetPeer("a"); p.Throttled == nil || *p.Throttled != bits {
+		t.Fatalf("expected throttle bits stored, got %v", p.Throttled)
+	}
+	h, _ := store.GetByID("a")
+	if h.ThrottleWarning() != "Throttled: under-voltage, CPU throttled" || len(h.ThrottledSince) != 2 {
+		t.Errorf("got %q, since boot %v", h.ThrottleWarning(), h.ThrottledSince)
+	}
+
+	// Off a Pi nothing is reported.
+	if p, _ := store.GetPeer("b"); p.Throttled != nil {
+		t.Errorf("expected no throttle bits, got %d", *p.Throttled)
+	}
+	if h, _ := store.GetByID("b"); h.Throttled != nil || h.ThrottleWarning() != "" {
+		t.Errorf("expected no throttling, got %v", h.Throttled)
+	}
+}
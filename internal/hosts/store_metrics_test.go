@@ -0,0 +1,74 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestMetrics(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.10"})
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Two hours of samples a minute apart, down for the first quarter hour.
+	for i := range 120 {
+		up := 1.0
+		if i < 15 {
+			up = 0
+		}
+		if err := store.RecordMetrics("a", map[string]float64{MetricUp: up, MetricLatency: float64(i)}, start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("RecordMetrics: %v", err)
+		}
+	}
+	now := start.Add(2 * time.Hour)
+
+	// Within a day every minute is kept.
+	points, err := store.MetricSeries("a", MetricLatency, now.Add(-3*time.Hour), now)
+	if err != nil || len(points) != 120 || points[5].Avg != 5 {
+		t.Fatalf("expected 120 one-minute points, got %d (%v)", len(points), err)
+	}
+	// Further back, the same samples come in hourly buckets.
+	points, _ = store.MetricSeries("a", MetricLatency, now.Add(-30*24*time.Hour), now)
+	if len(points) != 2 || points[0].Count != 60 || points[0].Min != 0 || points[0].Max != 59 || points[0].Avg != 29.5 {
+		t.Fatalf("expected two hourly buckets, got %+v", points)
+	}
+	if step := MetricStep(now.Add(-7*24*time.Hour), now); step != 15*time.Minute {
+		t.Errorf("expected 15-minute buckets for a week, got %v", step)
+	}
+
+	uptime, err := store.Uptime(now.Add(-7*24*time.Hour), now)
+	if err != nil || uptime["a"] != 87.5 {
+		t.Errorf("expected 87.5%% uptime, got %v (%v)", uptime, err)
+	}
+
+	// A day later the minutes are pruned and the coarser buckets stay.
+	if err := store.PruneMetrics(now.Add(25 * time.Hour)); err != nil {
+		t.Fatalf("PruneMetrics: %v", err)
+	}
+	if points, _ := store.MetricSeries("a", MetricLatency, start, now); len(points) != 0 {
+		t.Errorf("expected the one-minute buckets pruned, got %d", len(points))
+	}
+	if points, _ := store.MetricSeries("a", MetricLatency, now.Add(-30*24*time.Hour), now); len(points) != 2 {
+		t.Errorf("expected the hourly buckets kept, got %d", len(points))
+	}
+
+	// Deleting the host deletes its metrics.
+	store.DeleteByID("a")
+	if history, _ := store.MetricHistory(MetricUp, now.Add(-30*24*time.Hour), now); len(history) != 0 {
+		t.Errorf("expected the metrics deleted with the host, got %v", history)
+	}
+}
+
+func TestHostMetrics(t *testing.T) {
+	h := types.Host{Health: types.HealthOffline}
+	if got := hostMetrics(h, Peer{}, false); len(got) != 1 || got[MetricUp] != 0 {
+		t.Errorf("expected only up=0 for an offline host without checks, got %v", got)
+	}
+	h = types.Host{Health: types.HealthOnline, LatencyMS: 3.5}
+	got := hostMetrics(h, Peer{DiskPercent: 42}, true)
+	if got[MetricUp] != 1 || got[MetricLatency] != 3.5 || got[MetricLoss] != 0 || got[MetricDisk] != 42 {
+		t.Errorf("unexpected metrics %v", got)
+	}
+}
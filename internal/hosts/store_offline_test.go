@@ -0,0 +1,76 @@
+package hosts
+
+import (
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestOfflineEdits(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	if edits, _ := store.OfflineEdits(); len(edits) != 0 {
+		t.Fatalf("expected no buffered edits while connected, got %+v", edits)
+	}
+
+	store.SetIsolated(true)
+	store.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Foyer" })
+	store.Update("192.168.1.20", func(h *types.Host) { h.Status = types.StatusHealthy })
+	edits, err := store.OfflineEdits()
+	if err != nil {
+		t.Fatalf("OfflineEdits: %v", err)
+	}
+	if len(edits) != 1 || edits[0].HostID != "lobby" {
+		t.Fatalf("expected the rename buffered, got %+v", edits)
+	}
+
+	// An edit after the buffer was read keeps the host buffered.
+	store.Update("192.168.1.20", func(h *types.Host) { h.Notes = "By the door" })
+	store.ClearOfflineEdit(edits[0])
+	if edits, _ := store.OfflineEdits(); len(edits) != 1 {
+		t.Fatalf("expected a newer edit to stay buffered, got %+v", edits)
+	}
+	edits, _ = store.OfflineEdits()
+	store.ClearOfflineEdit(edits[0])
+	if edits, _ := store.OfflineEdits(); len(edits) != 0 {
+		t.Errorf("expected the buffer cleared, got %+v", edits)
+	}
+}
+
+func TestReplaceFromPeerKeepsOfflineEdits(t *testing.T) {
+	a, b := newNodeStore(t, "a"), newNodeStore(t, "b")
+	a.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	a.Add(types.Host{ID: "bar", IPAddress: "192.168.1.30", Nickname: "Bar"})
+	for _, h := range a.GetAll() {
+		b.Merge(h)
+	}
+
+	// a is cut off: it renames the lobby and adds a screen, while b renames the bar.
+	a.SetIsolated(true)
+	a.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Foyer" })
+	a.Add(types.Host{ID: "stage", IPAddress: "192.168.1.40", Nickname: "Stage"})
+	b.Update("192.168.1.30", func(h *types.Host) { h.Nickname = "Cafe" })
+
+	conflicts, err := a.ReplaceFromPeer(b.GetAll())
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("ReplaceFromPeer: %v, conflicts %+v", err, conflicts)
+	}
+	if got := getHost(t, a, "lobby").Nickname; got != "Foyer" {
+		t.Errorf("expected the offline rename kept, got %q", got)
+	}
+	if got := getHost(t, a, "bar").Nickname; got != "Cafe" {
+		t.Errorf("expected the peer's rename, got %q", got)
+	}
+	if got := getHost(t, a, "stage").Nickname; got != "Stage" {
+		t.Errorf("expected the host added offline kept, got %q", got)
+	}
+
+	// The peer's copy is not stamped as a local edit, so b still takes a's rename.
+	if fv := getHost(t, a, "bar").Versions.Fields["nickname"]; fv.Node != "b" {
+		t.Errorf("expected the pushed field to keep b's version, got %+v", fv)
+	}
+	b.Merge(getHost(t, a, "lobby"))
+	if got := getHost(t, b, "lobby").Nickname; got != "Foyer" {
+		t.Errorf("expected the replayed rename to reach b, got %q", got)
+	}
+}
@@ -0,0 +1,51 @@
+package hosts
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestPatchStatus(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", IPAddress: "192.168.1.21"})
+
+	if _, err := store.GetPatchStatus("lobby"); !errors.Is(err, ErrPatchStatusNotFound) {
+		t.Fatalf("expected ErrPatchStatusNotFound, got %v", err)
+	}
+
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	run := UpgradeRun{State: UpgradeFailed, StartedAt: now.Add(-time.Hour), FinishedAt: now.Add(-50 * time.Minute), Error: "apt-get update: exit status 100", Reboot: true}
+	store.PutPatchStatus("lobby", PatchStatus{Pending: 12, Security: 3, RebootRequired: true, CheckedAt: now, Upgrade: &run}, now)
+	store.PutPatchStatus("cafe", PatchStatus{}, now)
+
+	got, err := store.GetPatchStatus("lobby")
+	if err != nil {
+		t.Fatalf("GetPatchStatus: %v", err)
+	}
+	if got.Pending != 12 || got.Security != 3 || !got.RebootRequired || !got.CheckedAt.Equal(now) || !got.ReportedAt.Equal(now) {
+		t.Errorf("unexpected status: %+v", got)
+	}
+	if got.Upgrade == nil || *got.Upgrade != run {
+		t.Errorf("expected the upgrade run back, got %+v", got.Upgrade)
+	}
+
+	// A node that has never upgraded reports no run.
+	if got, _ := store.GetPatchStatus("cafe"); got.Upgrade != nil || !got.CheckedAt.IsZero() {
+		t.Errorf("expected no upgrade run, got %+v", got)
+	}
+
+	if err := store.DeleteByID("cafe"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	all, err := store.ListPatchStatus()
+	if err != nil {
+		t.Fatalf("ListPatchStatus: %v", err)
+	}
+	if len(all) != 1 || all["lobby"].Pending != 12 {
+		t.Errorf("expected only lobby left, got %+v", all)
+	}
+}
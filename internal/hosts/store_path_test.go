@@ -0,0 +1,50 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestSelectPath(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{
+		{ID: "a", IPAddress: "192.168.1.20", VPNIPAddress: "100.64.0.2", Status: types.StatusHealthy, StatusVPN: types.StatusHealthy},
+		{ID: "b", IPAddress: "192.168.1.21", VPNIPAddress: "100.64.0.3", Status: types.StatusUnreachable, StatusVPN: types.StatusStale},
+		{ID: "c", IPAddress: "192.168.1.22", VPNIPAddress: "100.64.0.4", Status: types.StatusUnreachable, StatusVPN: types.StatusUnreachable},
+		{ID: "d", IPAddress: "192.168.1.23", VPNIPAddress: "100.64.0.5", Status: types.StatusHealthy, StatusVPN: types.StatusHealthy, PathPreference: types.PathVPN},
+		{ID: "e", IPAddress: "192.168.1.24", VPNIPAddress: "100.64.0.6", Status: types.StatusUnreachable, StatusVPN: types.StatusHealthy, PathPreference: types.PathLAN},
+	})
+
+	tests := []struct {
+		addr, want string
+	}{
+		{"192.168.1.20", "192.168.1.20"},
+		{"192.168.1.21", "100.64.0.3"},
+		{"192.168.1.21:80", "100.64.0.3:80"},
+		{"192.168.1.22", "192.168.1.22"},
+		{"192.168.1.23", "100.64.0.5"},
+		{"192.168.1.24", "192.168.1.24"},
+		{"10.0.0.1", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		if got := store.ResolveAddress(tt.addr); got != tt.want {
+			t.Errorf("ResolveAddress(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+
+	// The preference survives a round trip through the database.
+	pinned, err := store.GetByID("d")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if path := SelectPath(*pinned); path.Network != NetworkVPN || !path.Forced || !path.Healthy() {
+		t.Errorf("expected forced healthy VPN path, got %+v", path)
+	}
+}
@@ -0,0 +1,48 @@
+package hosts
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func TestTrustPeer(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	id, _ := identity.Generate()
+	other, _ := identity.Generate()
+	key := base64.StdEncoding.EncodeToString(id.PublicKey())
+	now := time.Now().UTC().Truncate(time.Second)
+	store.PutPeer(Peer{NodeID: "a", PublicKey: key, LastSeen: now})
+
+	if _, err := store.TrustPeer("gone", identity.Fingerprint(id.PublicKey()), "admin", now); !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("expected ErrPeerNotFound, got %v", err)
+	}
+	if _, err := store.TrustPeer("a", identity.Fingerprint(other.PublicKey()), "admin", now); !errors.Is(err, ErrFingerprintMismatch) {
+		t.Errorf("expected ErrFingerprintMismatch, got %v", err)
+	}
+	peer, err := store.TrustPeer("a", identity.Fingerprint(id.PublicKey()), "admin", now)
+	if err != nil || !peer.Trusted() || peer.TrustedBy != "admin" {
+		t.Fatalf("TrustPeer: %+v, %v", peer, err)
+	}
+
+	// Heartbeats carrying the same key keep the confirmation.
+	store.PutPeer(Peer{NodeID: "a", PublicKey: key, LastSeen: now.Add(time.Minute)})
+	if peer, _ := store.GetPeer("a"); !peer.Trusted() || !peer.TrustedAt.Equal(now) {
+		t.Errorf("expected trust kept across heartbeats, got %+v", peer)
+	}
+
+	// A new key starts over.
+	store.PutPeer(Peer{NodeID: "a", PublicKey: base64.StdEncoding.EncodeToString(other.PublicKey()), LastSeen: now.Add(2 * time.Minute)})
+	if peer, _ := store.GetPeer("a"); peer.Trusted() || peer.TrustedBy != "" {
+		t.Errorf("expected trust dropped with a new key, got %+v", peer)
+	}
+}
@@ -0,0 +1,74 @@
+package hosts
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQualityHistory(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// An old sample ages out; each network keeps its own newest samples.
+	store.quality.add("q", QualitySample{At: start.Add(-8 * 24 * time.Hour), Network: NetworkLAN, LatencyMS: 99})
+	store.quality.add("q", QualitySample{At: start, Network: NetworkVPN, LatencyMS: 40})
+	for i := range MaxQualitySamples + 5 {
+		store.quality.add("q", QualitySample{At: start.Add(time.Duration(i) * time.Minute), Network: NetworkLAN, LatencyMS: float64(i)})
+	}
+
+	lan := store.QualityHistory("q", NetworkLAN)
+	if len(lan) != MaxQualitySamples || lan[0].LatencyMS != 5 {
+		t.Fatalf("expected the newest %d LAN samples from 5, got %d from %v", MaxQualitySamples, len(lan), lan[0].LatencyMS)
+	}
+	if vpn := store.QualityHistory("q", NetworkVPN); len(vpn) != 1 {
+		t.Errorf("expected the VPN sample to be kept, got %v", vpn)
+	}
+	if latest, ok := store.quality.latest("q", NetworkLAN); !ok || latest.LatencyMS != MaxQualitySamples+4 {
+		t.Errorf("latest = %v, %v", latest, ok)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	got := Summarize([]QualitySample{
+		{LatencyMS: 2, LossPercent: 0},
+		{LatencyMS: 6, LossPercent: 20},
+		{LossPercent: 100},
+		{LatencyMS: 4, LossPercent: 0},
+	})
+	want := QualitySummary{Samples: 4, AvgLatencyMS: 4, MaxLatencyMS: 6, AvgLossPercent: 30}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestProbeQuality(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	if _, loss := probeQuality(ln.Addr().String(), time.Millisecond); loss != 0 {
+		t.Errorf("expected no loss, got %d%%", loss)
+	}
+
+	ln.Close()
+	latency, loss := probeQuality(ln.Addr().String(), 10*time.Millisecond)
+	if loss != 80 || latency != 10 {
+		t.Errorf("expected only the first probe to count, got %.1f ms and %d%% loss", latency, loss)
+	}
+}
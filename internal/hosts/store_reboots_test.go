@@ -0,0 +1,50 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestReboots(t *testing.T) {
+	store := newNodeStore(t, "a")
+	store.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20"})
+	store.Add(types.Host{ID: "cafe", IPAddress: "192.168.1.21"})
+
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	boot := BootReport{BootID: "b1", BootedAt: now.Add(-time.Minute), Shutdown: ShutdownUnexpected, Evidence: "journal", UnderVoltage: true}
+	if recorded, err := store.RecordBoot("lobby", boot, now.Add(-5*time.Minute), now); err != nil || !recorded {
+		t.Fatalf("RecordBoot: %v, %v", recorded, err)
+	}
+	// Every heartbeat of the boot carries it; only the first counts.
+	if recorded, _ := store.RecordBoot("lobby", boot, now, now.Add(time.Minute)); recorded {
+		t.Error("expected the same boot recorded once")
+	}
+	store.RecordBoot("lobby", BootReport{BootID: "b2", BootedAt: now.Add(time.Hour), Shutdown: ShutdownClean}, now.Add(59*time.Minute), now.Add(time.Hour))
+	store.RecordBoot("cafe", BootReport{BootID: "c1"}, time.Time{}, now.Add(-time.Minute))
+	if recorded, _ := store.RecordBoot("cafe", BootReport{}, time.Time{}, now); recorded {
+		t.Error("expected a report without a boot ID ignored")
+	}
+
+	events, err := store.ListReboots("lobby", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("ListReboots: %v", err)
+	}
+	if len(events) != 2 || events[0].BootID != "b2" || !events[1].UnderVoltage || events[1].Downtime() != 4*time.Minute {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if all, _ := store.ListReboots("", now.Add(30*time.Minute)); len(all) != 1 {
+		t.Errorf("expected one boot since, got %+v", all)
+	}
+	if all, _ := store.ListReboots("", time.Time{}); len(all) != 3 || all[2].Downtime() != 0 {
+		t.Errorf("expected every boot, got %+v", all)
+	}
+
+	if err := store.DeleteByID("cafe"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if all, _ := store.ListReboots("", time.Time{}); len(all) != 2 {
+		t.Errorf("expected cafe's boots deleted, got %+v", all)
+	}
+}
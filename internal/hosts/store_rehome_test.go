@@ -0,0 +1,62 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestSameSubnet(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"192.168.1.20", "192.168.1.45", true},
+		{"192.168.1.20", "192.168.2.20", false},
+		{"192.168.1.20", "fe80::1", false},
+		{"", "192.168.1.20", false},
+	}
+	for _, c := range cases {
+		if got := SameSubnet(c.a, c.b); got != c.want {
+			t.Errorf("SameSubnet(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestRehome(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{
+		{ID: "a", Nickname: "Foyer", IPAddress: "192.168.1.20", Status: types.StatusHealthy, LastChecked: time.Now()},
+		{ID: "b", Nickname: "Bar", IPAddress: "192.168.1.30"},
+	})
+	store.PutPeer(Peer{NodeID: "b", PublicKey: "key", LastSeen: time.Now()})
+
+	// b sends heartbeats of its own, so a cannot take its address.
+	if moved, err := store.Rehome("a", "192.168.1.30", "heartbeat"); moved || err == nil {
+		t.Errorf("expected the move to be refused, got %v, %v", moved, err)
+	}
+
+	moved, err := store.Rehome("a", "192.168.1.21", "heartbeat")
+	if err != nil || !moved {
+		t.Fatalf("Rehome: %v, %v", moved, err)
+	}
+	h, _ := store.GetByID("a")
+	if h.IPAddress != "192.168.1.21" || h.Nickname != "Foyer" || !h.LastChecked.IsZero() || h.DashboardURL != "http://192.168.1.21:8080" {
+		t.Errorf("unexpected host after move: %+v", h)
+	}
+	if moved, err := store.Rehome("a", "192.168.1.21", "heartbeat"); moved || err != nil {
+		t.Errorf("expected no move to the same address, got %v, %v", moved, err)
+	}
+
+	entries, err := store.ListAudit(AuditQuery{Action: AuditIPChanged})
+	if err != nil || len(entries) != 1 || entries[0].Detail != "192.168.1.20 -> 192.168.1.21 (heartbeat)" || entries[0].ActorType != ActorSystem {
+		t.Errorf("unexpected audit entries %+v (%v)", entries, err)
+	}
+}
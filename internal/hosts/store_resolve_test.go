@@ -0,0 +1,92 @@
+package hosts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestValidAddress(t *testing.T) {
+	cases := map[string]bool{
+		"192.168.1.20":         true,
+		"venue-display-03.lan": true,
+		"display03":            true,
+		"display.example.com.": true,
+		"192.168.1.300":        false,
+		"fe80::1":              false,
+		"-display.lan":         false,
+		"display_03.lan":       false,
+		"":                     false,
+		"display..lan":         false,
+	}
+	for addr, want := range cases {
+		if got := ValidAddress(addr); got != want {
+			t.Errorf("ValidAddress(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	answers := map[string]string{"display-03.lan": "192.168.1.43"}
+	lookups := 0
+	defer func(orig func(context.Context, string) ([]net.IP, error)) { lookupIP = orig }(lookupIP)
+	lookupIP = func(_ context.Context, name string) ([]net.IP, error) {
+		lookups++
+		if ip, ok := answers[name]; ok {
+			return []net.IP{net.ParseIP("fd00::43"), net.ParseIP(ip)}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.ReplaceAll([]types.Host{
+		{ID: "a", IPAddress: "display-03.lan"},
+		{ID: "b", IPAddress: "192.168.1.43"},
+		{ID: "c", IPAddress: "gone.lan"},
+	})
+
+	// Reads never look names up themselves.
+	if h, _ := store.GetByID("a"); h.ResolvedIP != "" || lookups != 0 {
+		t.Fatalf("expected no lookup on read, got %q after %d", h.ResolvedIP, lookups)
+	}
+
+	store.ResolveNames()
+	a, _ := store.GetByID("a")
+	if a.ResolvedIP != "192.168.1.43" || a.ResolveError != "" {
+		t.Errorf("expected the IPv4 answer, got %q (%s)", a.ResolvedIP, a.ResolveError)
+	}
+	if c, _ := store.GetByID("c"); c.ResolvedIP != "" || c.ResolveError == "" {
+		t.Errorf("expected a lookup error for c, got %+v", c)
+	}
+
+	// Lookups are cached between refreshes.
+	before := lookups
+	if ip, err := store.Resolve("display-03.lan"); ip != "192.168.1.43" || err != nil || lookups != before {
+		t.Errorf("expected a cached answer, got %q, %v after %d lookups", ip, err, lookups-before)
+	}
+
+	// A failed lookup keeps the last answer.
+	delete(answers, "display-03.lan")
+	store.ResolveNames()
+	a, _ = store.GetByID("a")
+	if a.ResolvedIP != "192.168.1.43" || a.ResolveError == "" {
+		t.Errorf("expected the last answer with an error, got %q (%s)", a.ResolvedIP, a.ResolveError)
+	}
+	var dnsErr *net.DNSError
+	if _, err := store.Resolve("display-03.lan"); !errors.As(err, &dnsErr) {
+		t.Errorf("expected the DNS error, got %v", err)
+	}
+
+	// A name resolving to an IP already listed is the same host twice.
+	conflicts, _ := store.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Key != "ip:192.168.1.43" {
+		t.Errorf("expected one IP conflict, got %+v", conflicts)
+	}
+}
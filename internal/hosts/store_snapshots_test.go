@@ -0,0 +1,79 @@
+package hosts
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestSnapshotSaveDiffRestore(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	normal := []types.Host{
+		{ID: "a", IPAddress: "192.168.0.1", Nickname: "Lobby"},
+		{ID: "b", IPAddress: "192.168.0.2", Nickname: "Cafe"},
+	}
+	if err := store.ReplaceAll(normal); err != nil {
+		t.Fatalf("ReplaceAll: %v", err)
+	}
+
+	snap, err := store.SaveSnapshot("normal", "weekday layout")
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if snap.HostCount != 2 {
+		t.Fatalf("expected 2 hosts in snapshot, got %d", snap.HostCount)
+	}
+
+	// Switch to "event mode": rename one host, drop one, add one.
+	event := []types.Host{
+		{ID: "a", IPAddress: "192.168.0.1", Nickname: "Main Stage"},
+		{ID: "c", IPAddress: "192.168.0.3", Nickname: "Entrance"},
+	}
+	if err := store.ReplaceAll(event); err != nil {
+		t.Fatalf("ReplaceAll event: %v", err)
+	}
+
+	diff, err := store.DiffSnapshot("normal")
+	if err != nil {
+		t.Fatalf("DiffSnapshot: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != "c" {
+		t.Fatalf("expected host c added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ID != "b" {
+		t.Fatalf("expected host b removed, got %+v", diff.Removed)
+	}
+	if len(diff.Changed) != 1 || diff.Changed[0].Fields[0].Field != "nickname" {
+		t.Fatalf("expected nickname change on host a, got %+v", diff.Changed)
+	}
+
+	if _, err := store.RestoreSnapshot("normal"); err != nil {
+		t.Fatalf("RestoreSnapshot: %v", err)
+	}
+	restored := store.GetAll()
+	if len(restored) != 2 || restored[0].Nickname != "Lobby" || restored[1].Nickname != "Cafe" {
+		t.Fatalf("unexpected hosts after restore: %+v", restored)
+	}
+
+	list, err := store.ListSnapshots()
+	if err != nil {
+		t.Fatalf("ListSnapshots: %v", err)
+	}
+	if len(list) != 1 || list[0].Name != "normal" || list[0].Hosts != nil {
+		t.Fatalf("unexpected snapshot list: %+v", list)
+	}
+
+	if err := store.DeleteSnapshot("normal"); err != nil {
+		t.Fatalf("DeleteSnapshot: %v", err)
+	}
+	if _, err := store.GetSnapshot("normal"); !errors.Is(err, ErrSnapshotNotFound) {
+		t.Fatalf("expected ErrSnapshotNotFound after delete, got %v", err)
+	}
+}
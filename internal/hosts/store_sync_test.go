@@ -0,0 +1,55 @@
+package hosts
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestSyncRecords(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	now := time.Now().UTC()
+	store.RecordPush("lobby", now.Add(-time.Hour), nil)
+	store.RecordPush("lobby", now, errors.New("connection refused"))
+	store.RecordReceive("lobby", now)
+	records, err := store.SyncRecords()
+	if err != nil {
+		t.Fatalf("SyncRecords: %v", err)
+	}
+	r := records["lobby"]
+	if !r.LastPushAt.Equal(now.Add(-time.Hour)) || r.LastPushError != "connection refused" || !r.LastReceivedAt.Equal(now) {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	store.RecordPush("lobby", now, nil)
+	records, _ = store.SyncRecords()
+	if r := records["lobby"]; r.LastPushError != "" || !r.LastPushErrorAt.IsZero() || !r.LastPushAt.Equal(now) {
+		t.Errorf("expected a success to clear the error, got %+v", r)
+	}
+}
+
+func TestListDigest(t *testing.T) {
+	a := []types.Host{
+		{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby", Status: types.StatusHealthy},
+		{ID: "bar", IPAddress: "192.168.1.30"},
+	}
+	b := []types.Host{
+		{ID: "bar", IPAddress: "192.168.1.30", LatencyMS: 4},
+		{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby", Status: types.StatusUnreachable},
+	}
+	if ListDigest(a) != ListDigest(b) {
+		t.Error("expected order and measured fields not to change the digest")
+	}
+	b[1].Nickname = "Foyer"
+	if ListDigest(a) == ListDigest(b) {
+		t.Error("expected a renamed host to change the digest")
+	}
+}
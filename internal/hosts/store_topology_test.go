@@ -0,0 +1,79 @@
+package hosts
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestTopology(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	store.ReplaceAll([]types.Host{
+		{ID: "self", IPAddress: "192.168.1.10", Nickname: "Office", Status: types.StatusHealthy},
+		{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby", Status: types.StatusHealthy},
+		{ID: "bar", IPAddress: "192.168.1.30", VPNIPAddress: "100.64.0.30", Nickname: "Bar",
+			Status: types.StatusUnreachable, StatusVPN: types.StatusHealthy},
+		{ID: "cellar", IPAddress: "192.168.1.40", Nickname: "Cellar", Status: types.StatusUnreachable},
+	})
+	now := time.Now().UTC()
+	store.PutPeer(Peer{NodeID: "lobby", PublicKey: "key", Address: "192.168.1.20", BootedAt: now.Add(-time.Hour), LastSeen: now,
+		Links: []Link{
+			{From: "lobby", To: "self", LAN: types.StatusUnreachable},
+			{From: "lobby", To: "bar", LAN: types.StatusHealthy, Heard: NetworkLAN},
+		}})
+	store.PutPeer(Peer{NodeID: "bar", PublicKey: "key", Address: "100.64.0.30", BootedAt: now.Add(-time.Hour), LastSeen: now,
+		Links: []Link{
+			{From: "bar", To: "self", VPN: types.StatusHealthy},
+			{From: "lobby", To: "cellar", LAN: types.StatusHealthy}, // Not bar's to report
+		}})
+
+	topo, err := store.Topology("self")
+	if err != nil {
+		t.Fatalf("Topology: %v", err)
+	}
+	local := 0
+	for _, n := range topo.Nodes {
+		if n.Local {
+			local++
+		}
+	}
+	if len(topo.Nodes) != 4 || local != 1 {
+		t.Errorf("unexpected nodes %+v", topo.Nodes)
+	}
+	links := make(map[[2]string]Link)
+	for _, l := range topo.Links {
+		links[[2]string{l.From, l.To}] = l
+	}
+	if len(links) != 6 {
+		t.Fatalf("expected 3 own and 3 reported links, got %+v", topo.Links)
+	}
+	if l := links[[2]string{"self", "bar"}]; l.Heard != NetworkVPN || l.VPN != types.StatusHealthy {
+		t.Errorf("expected bar heard over the VPN, got %+v", l)
+	}
+	if l := links[[2]string{"self", "cellar"}]; l.Heard != "" {
+		t.Errorf("expected no heartbeats from cellar, got %+v", l)
+	}
+	if _, ok := links[[2]string{"lobby", "cellar"}]; ok {
+		t.Error("a peer's report about another node's links was kept")
+	}
+
+	want := map[string]bool{
+		"No recent heartbeats from Cellar: it is down, does not list this node, or cannot reach it": true,
+		"Office reaches Lobby, but not the other way round":                                         true,
+	}
+	if len(topo.Findings) != len(want) {
+		t.Fatalf("got findings %q", topo.Findings)
+	}
+	for _, f := range topo.Findings {
+		if !want[f] {
+			t.Errorf("unexpected finding %q", f)
+		}
+	}
+}
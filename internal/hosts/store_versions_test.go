@@ -0,0 +1,188 @@
+package hosts
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newNodeStore(t *testing.T, node string) *Store {
+	t.Helper()
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	store.SetNodeID(node)
+	return store
+}
+
+func getHost(t *testing.T, store *Store, id string) types.Host {
+	t.Helper()
+	h, err := store.GetByID(id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	return *h
+}
+
+func TestMergeTakesUnseenEdits(t *testing.T) {
+	a, b := newNodeStore(t, "a"), newNodeStore(t, "b")
+	if err := a.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := b.Merge(getHost(t, a, "lobby")); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	stale := getHost(t, b, "lobby")
+
+	b.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Foyer" })
+	edited := getHost(t, b, "lobby")
+	if fv := edited.Versions.Fields["nickname"]; fv.Node != "b" || fv.Seq != 1 {
+		t.Fatalf("expected the rename to be stamped by b, got %+v", fv)
+	}
+
+	conflicts, err := a.Merge(edited)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("Merge: %v, conflicts %+v", err, conflicts)
+	}
+	if got := getHost(t, a, "lobby").Nickname; got != "Foyer" {
+		t.Errorf("expected b's rename, got %q", got)
+	}
+
+	// A copy from before the rename must not undo it.
+	a.Merge(stale)
+	if got := getHost(t, a, "lobby").Nickname; got != "Foyer" {
+		t.Errorf("expected a stale copy to be ignored, got %q", got)
+	}
+}
+
+func TestMergeConcurrentEdits(t *testing.T) {
+	a, b := newNodeStore(t, "a"), newNodeStore(t, "b")
+	a.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	b.Merge(getHost(t, a, "lobby"))
+
+	a.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Foyer"; h.Notes = "By the door" })
+	b.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Entrance" })
+	fromA, fromB := getHost(t, a, "lobby"), getHost(t, b, "lobby")
+
+	conflicts, err := a.Merge(fromB)
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	if len(conflicts) != 1 || conflicts[0].Field != "nickname" || conflicts[0].Kept != "Entrance" || conflicts[0].Lost != "Foyer" {
+		t.Fatalf("expected one nickname conflict won by b, got %+v", conflicts)
+	}
+	b.Merge(fromA)
+
+	for name, store := range map[string]*Store{"a": a, "b": b} {
+		h := getHost(t, store, "lobby")
+		if h.Nickname != "Entrance" || h.Notes != "By the door" {
+			t.Errorf("node %s: expected both edits merged, got nickname %q notes %q", name, h.Nickname, h.Notes)
+		}
+	}
+}
+
+func TestMergeUnversioned(t *testing.T) {
+	a := newNodeStore(t, "")
+	a.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Notes: "Old"})
+
+	// Neither side versioned: the peer's copy is taken, as before versions.
+	a.Merge(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Notes: "New"})
+	if got := getHost(t, a, "lobby").Notes; got != "New" {
+		t.Errorf("expected unversioned incoming notes, got %q", got)
+	}
+
+	a.SetNodeID("a")
+	a.Update("192.168.1.20", func(h *types.Host) { h.Notes = "Edited" })
+	a.Merge(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Notes: "From an older node"})
+	if got := getHost(t, a, "lobby").Notes; got != "Edited" {
+		t.Errorf("expected a versioned edit to beat an unversioned copy, got %q", got)
+	}
+}
+
+// editHost applies the edits coded in ops to h as node, one byte per edit:
+// the low bits pick the field and the rest one of a few values, so that
+// concurrent edits sometimes agree.
+func editHost(h types.Host, node string, ops []byte) types.Host {
+	for _, op := range ops {
+		old := h
+		f := replicatedFields[int(op)%len(replicatedFields)]
+		f.set(&h, fmt.Sprintf("v%d", int(op)/len(replicatedFields)%4))
+		stamp(&old, &h, node)
+	}
+	return h
+}
+
+func replicated(h types.Host) map[string]string {
+	out := make(map[string]string)
+	for _, f := range replicatedFields {
+		out[f.name] = f.get(&h)
+	}
+	return out
+}
+
+// FuzzMergeConverges checks the properties peers rely on for any two
+// histories of edits made concurrently on two nodes: merging in either
+// order gives the same host and reports the same conflicts, merging again
+// changes nothing, a stale copy never undoes an edit, and edit counts
+// never go backwards.
+func FuzzMergeConverges(f *testing.F) {
+	f.Add([]byte{}, []byte{})
+	f.Add([]byte{2}, []byte{})
+	f.Add([]byte{2, 3}, []byte{8})
+	f.Add([]byte{2, 8, 14}, []byte{2, 9, 3, 3})
+	f.Add([]byte{0, 1, 2, 3, 4, 5}, []byte{5, 4, 3, 2, 1, 0})
+
+	f.Fuzz(func(t *testing.T, opsA, opsB []byte) {
+		base := types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"}
+		stamp(nil, &base, "a")
+		a, b := editHost(base, "a", opsA), editHost(base, "b", opsB)
+
+		ab, conflictsAB := mergeHost(a, b)
+		ba, conflictsBA := mergeHost(b, a)
+		if !reflect.DeepEqual(replicated(ab), replicated(ba)) || !reflect.DeepEqual(ab.Versions, ba.Versions) {
+			t.Fatalf("merges disagree:\n a+b %v %+v\n b+a %v %+v", replicated(ab), ab.Versions, replicated(ba), ba.Versions)
+		}
+		if len(conflictsAB) != len(conflictsBA) {
+			t.Errorf("expected the same conflicts both ways, got %+v and %+v", conflictsAB, conflictsBA)
+		}
+
+		for name, stale := range map[string]types.Host{"itself": ab, "a": a, "b": b, "base": base} {
+			again, conflicts := mergeHost(ab, stale)
+			if !reflect.DeepEqual(replicated(again), replicated(ab)) || len(conflicts) != 0 {
+				t.Errorf("merging %s again changed %v to %v, conflicts %+v", name, replicated(ab), replicated(again), conflicts)
+			}
+		}
+		for _, side := range []types.Host{a, b} {
+			for node, seq := range side.Versions.Vector {
+				if ab.Versions.Vector[node] < seq {
+					t.Errorf("edit count of %s went back from %d to %d", node, seq, ab.Versions.Vector[node])
+				}
+			}
+		}
+	})
+}
+
+func TestSaveChecksKeepsEdits(t *testing.T) {
+	a := newNodeStore(t, "a")
+	a.Add(types.Host{ID: "lobby", IPAddress: "192.168.1.20", Nickname: "Lobby"})
+	checked := getHost(t, a, "lobby")
+
+	a.Update("192.168.1.20", func(h *types.Host) { h.Nickname = "Foyer" })
+	checked.Status = types.StatusHealthy
+	if err := a.saveChecks([]types.Host{checked, {ID: "deleted", IPAddress: "192.168.1.99"}}); err != nil {
+		t.Fatalf("saveChecks: %v", err)
+	}
+
+	h := getHost(t, a, "lobby")
+	if h.Nickname != "Foyer" || h.Status != types.StatusHealthy {
+		t.Errorf("expected the rename kept and the check saved, got %q %q", h.Nickname, h.Status)
+	}
+	if _, err := a.GetByID("deleted"); err == nil {
+		t.Error("expected a host deleted during the check not to come back")
+	}
+}
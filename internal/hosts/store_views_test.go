@@ -0,0 +1,81 @@
+package hosts
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestViews(t *testing.T) {
+	list := []types.Host{
+		{ID: "a", Nickname: "Lobby", IPAddress: "10.1.0.20", Health: types.HealthOnline},
+		{ID: "b", Nickname: "Cafe", IPAddress: "10.1.0.3", Health: types.HealthOffline, Notes: "Building A"},
+		{ID: "c", Nickname: "Gym", IPAddress: "10.2.0.5", Health: types.HealthDegraded},
+		{ID: "d", Hostname: "spare", IPAddress: "10.1.0.9", VPNIPAddress: "100.64.0.9", Health: types.HealthDegraded},
+	}
+	ids := func(hosts []types.Host) string {
+		var out string
+		for _, h := range hosts {
+			out += h.ID
+		}
+		return out
+	}
+
+	v := View{Name: "Building A, unhealthy", Filter: ViewFilter{
+		Subnets: []string{"10.1.0.0/16"},
+		Health:  []types.HealthStatus{types.HealthDegraded, types.HealthOffline},
+	}, Sort: SortIP}
+	if got := ids(v.Apply(list)); got != "bd" {
+		t.Errorf("expected b and d by IP, got %q", got)
+	}
+	v.Sort, v.Desc = SortHealth, true
+	if got := ids(v.Apply(list)); got != "db" {
+		t.Errorf("expected the offline host last when reversed, got %q", got)
+	}
+	if got := ids(View{Filter: ViewFilter{Query: "building a"}}.Apply(list)); got != "b" {
+		t.Errorf("expected the query to match notes, got %q", got)
+	}
+	if got := ids(View{Filter: ViewFilter{Subnets: []string{"100.64.0.0/10"}}}.Apply(list)); got != "d" {
+		t.Errorf("expected the subnet to match the VPN IP, got %q", got)
+	}
+	if got := ids(View{}.Apply(list)); got != "bcad" {
+		t.Errorf("expected every host by name, got %q", got)
+	}
+
+	for _, bad := range []View{
+		{},
+		{Name: "x", Sort: "uptime"},
+		{Name: "x", Filter: ViewFilter{Subnets: []string{"10.1"}}},
+		{Name: "x", Filter: ViewFilter{Health: []types.HealthStatus{"sad"}}},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", bad)
+		}
+	}
+
+	store, err := NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.SaveView("alice", v); err != nil {
+		t.Fatalf("SaveView: %v", err)
+	}
+	store.SaveView("bob", View{Name: "Mine"})
+	views, err := store.ListViews("alice")
+	if err != nil || len(views) != 1 || views[0].Name != v.Name || len(views[0].Filter.Subnets) != 1 || views[0].UpdatedAt.IsZero() {
+		t.Fatalf("expected alice's view only, got %+v (%v)", views, err)
+	}
+	if _, err := store.GetView("bob", v.Name); !errors.Is(err, ErrViewNotFound) {
+		t.Errorf("expected views to be per user, got %v", err)
+	}
+	if err := store.DeleteView("alice", v.Name); err != nil {
+		t.Fatalf("DeleteView: %v", err)
+	}
+	if err := store.DeleteView("alice", v.Name); !errors.Is(err, ErrViewNotFound) {
+		t.Errorf("expected ErrViewNotFound, got %v", err)
+	}
+}
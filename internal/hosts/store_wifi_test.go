@@ -0,0 +1,71 @@
+package hosts
+
+import (
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestWiFiHistory(t *testing.T) {
+	store := newNodeStore(t, "a")
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	link := WiFi{Interface: "wlan0", SSID: "Lobby", BSSID: "aa:bb:cc:dd:ee:01", FreqMHz: 5180, SignalDBM: -60}
+
+	store.RecordWiFi("a", link, now)
+	store.RecordWiFi("a", link, now.Add(time.Minute)) // Unchanged, within the sample interval
+	link.BSSID = "aa:bb:cc:dd:ee:02"
+	link.Roams = 1
+	store.RecordWiFi("a", link, now.Add(2*time.Minute))
+	store.RecordWiFi("a", link, now.Add(2*time.Minute+wifiSampleInterval))
+
+	history, err := store.WiFiHistory(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("WiFiHistory: %v", err)
+	}
+	got := history["a"]
+	if len(got) != 3 {
+		t.Fatalf("expected 3 samples, got %+v", got)
+	}
+	if got[0].Channel != 36 || got[0].SSID != "Lobby" || !got[0].At.Equal(now) {
+		t.Errorf("unexpected first sample %+v", got[0])
+	}
+
+	// Samples older than the history limit are pruned.
+	store.RecordWiFi("a", link, now.Add(wifiHistoryLimit+time.Hour))
+	history, _ = store.WiFiHistory(time.Time{})
+	if len(history["a"]) != 1 {
+		t.Errorf("expected old samples pruned, got %d", len(history["a"]))
+	}
+
+	// Deleting the host drops its history.
+	store.Add(types.Host{ID: "a", IPAddress: "192.168.1.20"})
+	if err := store.DeleteByID("a"); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if history, _ = store.WiFiHistory(time.Time{}); len(history) != 0 {
+		t.Errorf("expected the history deleted with the host, got %v", history)
+	}
+}
+
+func TestSummarizeWiFi(t *testing.T) {
+	samples := []WiFi{
+		{BSSID: "ap1", SignalDBM: -60, Reconnects: 2},
+		{SignalDBM: 0, Reconnects: 2}, // Disconnected
+		{BSSID: "ap1", SignalDBM: -70, Reconnects: 3},
+		{BSSID: "ap2", SignalDBM: -80, Reconnects: 1, Roams: 1}, // NSM restarted
+	}
+	sum := SummarizeWiFi(samples)
+	if sum.Samples != 3 || sum.AvgSignalDBM != -70 || sum.MinSignalDBM != -80 {
+		t.Errorf("unexpected signal summary %+v", sum)
+	}
+	if sum.Reconnects != 2 || sum.Roams != 1 || sum.Latest.BSSID != "ap2" {
+		t.Errorf("unexpected counts %+v", sum)
+	}
+
+	for freq, want := range map[int]int{2412: 1, 2484: 14, 5745: 149, 5955: 1, 900: 0} {
+		if got := WiFiChannel(freq); got != want {
+			t.Errorf("WiFiChannel(%d) = %d, want %d", freq, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package hosts
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// SyncRecord is when host list updates last went to and came from a peer.
+type SyncRecord struct {
+	HostID          string    `json:"host_id"`
+	LastPushAt      time.Time `json:"last_push_at,omitzero"`       // Last announcement or host list push the peer applied
+	LastPushError   string    `json:"last_push_error,omitempty"`   // Why the last failed push failed
+	LastPushErrorAt time.Time `json:"last_push_error_at,omitzero"` // When it failed; cleared by a later success
+	LastReceivedAt  time.Time `json:"last_received_at,omitzero"`   // Last announcement or host list applied from the peer
+}
+
+// RecordPush records a push of host list updates to hostID, applied if
+// pushErr is nil.
+func (s *Store) RecordPush(hostID string, at time.Time, pushErr error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if pushErr == nil {
+		_, err = s.db.Exec(`INSERT INTO peer_sync (host_id, last_push_at) VALUES (?, ?)
+			ON CONFLICT(host_id) DO UPDATE SET last_push_at = excluded.last_push_at,
+				last_push_error = NULL, last_push_error_at = NULL`,
+			hostID, formatTime(at))
+	} else {
+		_, err = s.db.Exec(`INSERT INTO peer_sync (host_id, last_push_error, last_push_error_at) VALUES (?, ?, ?)
+			ON CONFLICT(host_id) DO UPDATE SET last_push_error = excluded.last_push_error,
+				last_push_error_at = excluded.last_push_error_at`,
+			hostID, pushErr.Error(), formatTime(at))
+	}
+	if err != nil {
+		return fmt.Errorf("record push: %w", err)
+	}
+	return nil
+}
+
+// RecordReceive records host list updates applied from hostID.
+func (s *Store) RecordReceive(hostID string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.db.Exec(`INSERT INTO peer_sync (host_id, last_received_at) VALUES (?, ?)
+		ON CONFLICT(host_id) DO UPDATE SET last_received_at = excluded.last_received_at`,
+		hostID, formatTime(at))
+	if err != nil {
+		return fmt.Errorf("record receive: %w", err)
+	}
+	return nil
+}
+
+// SyncRecords returns the sync record of every host updates were exchanged
+// with, by host ID.
+func (s *Store) SyncRecords() (map[string]SyncRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT host_id, last_push_at, last_push_error, last_push_error_at, last_received_at FROM peer_sync`)
+	if err != nil {
+		return nil, fmt.Errorf("list sync records: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]SyncRecord)
+	for rows.Next() {
+		var (
+			r                                    SyncRecord
+			pushAt, pushErr, pushErrAt, received sql.NullString
+		)
+		if err := rows.Scan(&r.HostID, &pushAt, &pushErr, &pushErrAt, &received); err != nil {
+			return nil, err
+		}
+		r.LastPushAt = parseTime(pushAt.String)
+		r.LastPushError = pushErr.String
+		r.LastPushErrorAt = parseTime(pushErrAt.String)
+		r.LastReceivedAt = parseTime(received.String)
+		out[r.HostID] = r
+	}
+	return out, rows.Err()
+}
+
+// ListDigest returns a short hash of the parts of a host list that nodes
+// replicate: each host's ID and replicated fields (addresses, nickname,
+// notes, path preference and timezone). Health and other fields each node
+// measures for itself are left out, so two nodes with the same list get
+// the same digest.
+func ListDigest(list []types.Host) string {
+	lines := make([]string, 0, len(list))
+	for _, h := range list {
+		parts := []string{h.ID}
+		for _, f := range replicatedFields {
+			parts = append(parts, f.get(&h))
+		}
+		lines = append(lines, strings.Join(parts, "\x1f"))
+	}
+	slices.Sort(lines)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\x1e")))
+	return hex.EncodeToString(sum[:8])
+}
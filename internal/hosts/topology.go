@@ -0,0 +1,182 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Link is one node's view of another: what its health checks found on
+// each network, and which network heartbeats from the other arrive over.
+// Nodes put their own links in every heartbeat, so any node can draw the
+// whole fleet.
+type Link struct {
+	From  string           `json:"from"`
+	To    string           `json:"to"`
+	LAN   types.HostStatus `json:"lan,omitempty"`   // Last LAN health check, empty if never checked
+	VPN   types.HostStatus `json:"vpn,omitempty"`   // Last VPN health check, empty without a VPN address
+	Heard Network          `json:"heard,omitempty"` // Network recent heartbeats from To arrive over, empty if none do
+}
+
+// Reaches reports whether From can reach To's NSM on either network.
+func (l Link) Reaches() bool {
+	return l.LAN == types.StatusHealthy || l.VPN == types.StatusHealthy
+}
+
+// TopologyNode is a host in the topology.
+type TopologyNode struct {
+	ID           string             `json:"id"`
+	Label        string             `json:"label"`
+	IPAddress    string             `json:"ip_address"`
+	VPNIPAddress string             `json:"vpn_ip_address,omitempty"`
+	Health       types.HealthStatus `json:"health"`
+	Local        bool               `json:"local,omitempty"` // The node answering the request
+	ReportedAt   time.Time          `json:"reported_at,omitzero"`
+}
+
+// Topology is the fleet's reachability graph as one node sees it. Links
+// from other nodes are as of their last heartbeat (ReportedAt); a node
+// this one hears nothing from has no outgoing links.
+type Topology struct {
+	Nodes    []TopologyNode `json:"nodes"`
+	Links    []Link         `json:"links"`
+	Findings []string       `json:"findings"` // Likely reasons nodes are not syncing
+}
+
+// Links returns this node's view of every other host in the list.
+func (s *Store) Links(selfID string) []Link {
+	peers, _ := s.ListPeers()
+	byID := make(map[string]Peer, len(peers))
+	for _, p := range peers {
+		byID[p.NodeID] = p
+	}
+
+	var links []Link
+	for _, h := range s.GetAll() {
+		if h.ID == selfID {
+			continue
+		}
+		l := Link{From: selfID, To: h.ID, LAN: h.Status}
+		if h.VPNIPAddress != "" {
+			l.VPN = h.StatusVPN
+		}
+		if p, ok := byID[h.ID]; ok && h.Health != types.HealthOffline {
+			l.Heard = heardOver(h, p.Address)
+		}
+		links = append(links, l)
+	}
+	return links
+}
+
+// heardOver names the network a heartbeat from addr came in on: the VPN
+// if addr is the host's VPN address or in the Tailscale range, else the
+// LAN.
+func heardOver(h types.Host, addr string) Network {
+	if addr != "" && (addr == h.VPNIPAddress || addr == h.ResolvedVPNIP) {
+		return NetworkVPN
+	}
+	if ip := net.ParseIP(addr); ip != nil && tailscaleRange.Contains(ip) {
+		return NetworkVPN
+	}
+	return NetworkLAN
+}
+
+// tailscaleRange is the CGNAT block Tailscale assigns node addresses from.
+var tailscaleRange = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Topology returns every host as a node, this node's links and the links
+// each peer last reported, ordered by node then target.
+func (s *Store) Topology(selfID string) (Topology, error) {
+	peers, err := s.ListPeers()
+	if err != nil {
+		return Topology{}, err
+	}
+	reported := make(map[string]Peer, len(peers))
+	for _, p := range peers {
+		reported[p.NodeID] = p
+	}
+
+	topo := Topology{Nodes: []TopologyNode{}, Links: s.Links(selfID)}
+	known := make(map[string]bool)
+	for _, h := range s.GetAll() {
+		known[h.ID] = true
+		node := TopologyNode{
+			ID:           h.ID,
+			Label:        hostLabel(h),
+			IPAddress:    h.IPAddress,
+			VPNIPAddress: h.VPNIPAddress,
+			Health:       h.Health,
+			Local:        h.ID == selfID,
+		}
+		if p, ok := reported[h.ID]; ok && !node.Local && len(p.Links) > 0 {
+			node.ReportedAt = p.LastSeen
+		}
+		topo.Nodes = append(topo.Nodes, node)
+	}
+
+	for _, p := range peers {
+		if p.NodeID == selfID || !known[p.NodeID] {
+			continue
+		}
+		for _, l := range p.Links {
+			// A peer only speaks for itself, and only about hosts we list.
+			if l.From == p.NodeID && known[l.To] {
+				topo.Links = append(topo.Links, l)
+			}
+		}
+	}
+	sort.SliceStable(topo.Links, func(i, j int) bool {
+		if topo.Links[i].From != topo.Links[j].From {
+			return topo.Links[i].From < topo.Links[j].From
+		}
+		return topo.Links[i].To < topo.Links[j].To
+	})
+	topo.Findings = findings(topo)
+	return topo, nil
+}
+
+// findings points out what keeps nodes from syncing: nodes this one
+// never hears from, and pairs where only one side reaches the other.
+func findings(topo Topology) []string {
+	labels := make(map[string]string, len(topo.Nodes))
+	for _, n := range topo.Nodes {
+		labels[n.ID] = n.Label
+	}
+	out := []string{}
+	for _, n := range topo.Nodes {
+		if !n.Local && n.Health == types.HealthOffline {
+			out = append(out, fmt.Sprintf("No recent heartbeats from %s: it is down, does not list this node, or cannot reach it", n.Label))
+		}
+	}
+
+	links := make(map[[2]string]Link, len(topo.Links))
+	for _, l := range topo.Links {
+		links[[2]string{l.From, l.To}] = l
+	}
+	for _, l := range topo.Links {
+		back, ok := links[[2]string{l.To, l.From}]
+		if !ok || l.From > l.To || l.Reaches() == back.Reaches() {
+			continue // Each pair once, and only when one-sided
+		}
+		from, to := l.From, l.To
+		if back.Reaches() {
+			from, to = to, from
+		}
+		out = append(out, fmt.Sprintf("%s reaches %s, but not the other way round", labels[from], labels[to]))
+	}
+	return out
+}
+
+// hostLabel is the name the dashboard shows for a host.
+func hostLabel(h types.Host) string {
+	switch {
+	case h.Nickname != "":
+		return h.Nickname
+	case h.Hostname != "":
+		return h.Hostname
+	}
+	return h.IPAddress
+}
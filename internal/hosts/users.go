@@ -0,0 +1,420 @@
+package hosts
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/types"
+)
+
+var (
+	// ErrUserNotFound is returned when no matching user exists.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserExists is returned when a username is already taken.
+	ErrUserExists = errors.New("username already exists")
+	// ErrTokenNotFound is returned for unknown or expired auth tokens.
+	ErrTokenNotFound = errors.New("token not found or expired")
+)
+
+// Auth token kinds stored in the auth_tokens table.
+const (
+	TokenSession = "session"
+	TokenInvite  = "invite"
+	TokenReset   = "reset"
+)
+
+// AuthToken is a hashed, expiring credential: a login session, an
+// invitation, or a password reset. Only the SHA-256 of the token is stored.
+type AuthToken struct {
+	Hash      string
+	Kind      string
+	UserID    string
+	Email     string
+	Role      types.Role
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+const userColumns = `id, username, email, password_hash, role, prefs, provider, external_id, disabled, deleted, created_at, updated_at`
+
+// CountUsers returns the number of active (non-deleted) users.
+func (s *Store) CountUsers() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE deleted = 0`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count users: %w", err)
+	}
+	return n, nil
+}
+
+// ListUsers returns users ordered by username. Tombstones are included only
+// when includeDeleted is set, which peer replication needs.
+func (s *Store) ListUsers(includeDeleted bool) ([]types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `SELECT ` + userColumns + ` FROM users`
+	if !includeDeleted {
+		query += ` WHERE deleted = 0`
+	}
+	query += ` ORDER BY username`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []types.User{}
+	for rows.Next() {
+		u, err := scanUser(s.sealer, rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUser returns an active user by ID.
+func (s *Store) GetUser(id string) (types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getUserLocked(`id = ?`, id)
+}
+
+// GetUserByUsername returns an active user by case-insensitive username.
+func (s *Store) GetUserByUsername(username string) (types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getUserLocked(`username = ?`, strings.TrimSpace(username))
+}
+
+func (s *Store) getUserLocked(where string, args ...any) (types.User, error) {
+	row := s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE deleted = 0 AND `+where, args...)
+	u, err := scanUser(s.sealer, row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.User{}, ErrUserNotFound
+	}
+	return u, err
+}
+
+// GetUserByExternalID returns an active user linked to an identity
+// provider account.
+func (s *Store) GetUserByExternalID(provider, externalID string) (types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.getUserLocked(`provider = ? AND external_id = ?`, provider, externalID)
+}
+
+// AddUser inserts a new user, assigning an ID and timestamps when missing.
+// A tombstoned user with the same username is replaced.
+func (s *Store) AddUser(u types.User) (types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u.Username = strings.TrimSpace(u.Username)
+	if u.Username == "" {
+		return types.User{}, errors.New("username is required")
+	}
+
+	row := s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, u.Username)
+	existing, err := scanUser(s.sealer, row)
+	switch {
+	case err == nil && !existing.Deleted:
+		return types.User{}, ErrUserExists
+	case err == nil:
+		if _, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, existing.ID); err != nil {
+			return types.User{}, fmt.Errorf("remove deleted user: %w", err)
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return types.User{}, err
+	}
+
+	now := time.Now().UTC()
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+
+	if err := s.writeUserLocked(u); err != nil {
+		return types.User{}, err
+	}
+	return u, nil
+}
+
+// UpdateUser applies updater to an active user and bumps UpdatedAt so the
+// change wins during peer replication.
+func (s *Store) UpdateUser(id string, updater func(*types.User)) (types.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, err := s.getUserLocked(`id = ?`, id)
+	if err != nil {
+		return types.User{}, err
+	}
+
+	updater(&u)
+	u.ID = id
+	u.UpdatedAt = time.Now().UTC()
+
+	if err := s.writeUserLocked(u); err != nil {
+		return types.User{}, err
+	}
+	return u, nil
+}
+
+// DeleteUser tombstones a user so the deletion replicates to peers, and
+// revokes any outstanding sessions or reset tokens.
+func (s *Store) DeleteUser(id string) (types.User, error) {
+	u, err := s.UpdateUser(id, func(u *types.User) {
+		u.Deleted = true
+		u.PasswordHash = ""
+	})
+	if err != nil {
+		return types.User{}, err
+	}
+	return u, s.DeleteUserTokens(id)
+}
+
+// MergeUser applies a user record received from a peer when it is newer
+// than the local copy (last writer wins). It reports whether the local
+// store changed.
+func (s *Store) MergeUser(u types.User) (bool, error) {
+	if u.ID == "" || u.Username == "" {
+		return false, errors.New("user ID and username are required")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var updated sql.NullString
+	err := s.db.QueryRow(`SELECT updated_at FROM users WHERE id = ?`, u.ID).Scan(&updated)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("read user: %w", err)
+	}
+	if err == nil && !u.UpdatedAt.After(parseTime(updated.String)) {
+		return false, nil
+	}
+
+	// A different local user may hold the username (e.g. created
+	// independently on two nodes); the newer record keeps it.
+	var otherID string
+	var otherUpdated sql.NullString
+	err = s.db.QueryRow(`SELECT id, updated_at FROM users WHERE username = ? AND id != ?`, u.Username, u.ID).Scan(&otherID, &otherUpdated)
+	if err == nil {
+		if !u.UpdatedAt.After(parseTime(otherUpdated.String)) {
+			return false, nil
+		}
+		if _, err := s.db.Exec(`DELETE FROM users WHERE id = ?`, otherID); err != nil {
+			return false, fmt.Errorf("replace conflicting user: %w", err)
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("check username: %w", err)
+	}
+
+	if err := s.writeUserLocked(u); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Store) writeUserLocked(u types.User) error {
+	prefs, err := json.Marshal(u.Prefs)
+	if err != nil {
+		return fmt.Errorf("encode prefs: %w", err)
+	}
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	email, err := seal.seal(fieldUserEmail, u.ID, u.Email)
+	if err != nil {
+		return err
+	}
+	hash, err := seal.seal(fieldUserPassword, u.ID, u.PasswordHash)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`INSERT OR REPLACE INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.ID, u.Username, email, hash, string(u.Role), string(prefs), u.Provider, u.ExternalID,
+		boolToInt(u.Disabled), boolToInt(u.Deleted), formatTime(u.CreatedAt), formatTime(u.UpdatedAt))
+	if err != nil {
+		return fmt.Errorf("write user: %w", err)
+	}
+	return nil
+}
+
+// scanUser reads a user row. A password hash that does not open with
+// sealer is left sealed, so it matches no password.
+func scanUser(sealer Sealer, scanner interface{ Scan(dest ...any) error }) (types.User, error) {
+	var (
+		u                    types.User
+		email, hash, prefs   sql.NullString
+		provider, externalID sql.NullString
+		role                 string
+		disabled, deleted    int
+		createdAt, updatedAt sql.NullString
+	)
+	if err := scanner.Scan(&u.ID, &u.Username, &email, &hash, &role, &prefs, &provider, &externalID, &disabled, &deleted, &createdAt, &updatedAt); err != nil {
+		return types.User{}, err
+	}
+	u.Email, _ = openField(sealer, fieldUserEmail, u.ID, email.String)
+	u.PasswordHash, _ = openField(sealer, fieldUserPassword, u.ID, hash.String)
+	u.Provider = provider.String
+	u.ExternalID = externalID.String
+	u.Role = types.Role(role)
+	u.Disabled = disabled != 0
+	u.Deleted = deleted != 0
+	u.CreatedAt = parseTime(createdAt.String)
+	u.UpdatedAt = parseTime(updatedAt.String)
+	if prefs.String != "" {
+		if err := json.Unmarshal([]byte(prefs.String), &u.Prefs); err != nil {
+			return types.User{}, fmt.Errorf("decode prefs for %s: %w", u.Username, err)
+		}
+	}
+	return u, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// CreateToken stores a hashed auth token.
+func (s *Store) CreateToken(t AuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC()
+	}
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return err
+	}
+	email, err := seal.seal(fieldTokenEmail, t.Hash, t.Email)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO auth_tokens (token_hash, kind, user_id, email, role, created_by, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.Hash, t.Kind, t.UserID, email, string(t.Role), t.CreatedBy, formatTime(t.CreatedAt), formatTime(t.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("create %s token: %w", t.Kind, err)
+	}
+	return nil
+}
+
+// GetToken returns an unexpired token of the given kind.
+func (s *Store) GetToken(hash, kind string) (AuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		t                              AuthToken
+		userID, email, role, createdBy sql.NullString
+		createdAt, expiresAt           sql.NullString
+	)
+	err := s.db.QueryRow(`SELECT token_hash, kind, user_id, email, role, created_by, created_at, expires_at
+		FROM auth_tokens WHERE token_hash = ? AND kind = ?`, hash, kind).
+		Scan(&t.Hash, &t.Kind, &userID, &email, &role, &createdBy, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthToken{}, ErrTokenNotFound
+	}
+	if err != nil {
+		return AuthToken{}, fmt.Errorf("read token: %w", err)
+	}
+
+	t.UserID = userID.String
+	t.Email, _ = openField(s.sealer, fieldTokenEmail, t.Hash, email.String)
+	t.Role = types.Role(role.String)
+	t.CreatedBy = createdBy.String
+	t.CreatedAt = parseTime(createdAt.String)
+	t.ExpiresAt = parseTime(expiresAt.String)
+	if time.Now().After(t.ExpiresAt) {
+		return AuthToken{}, ErrTokenNotFound
+	}
+	return t, nil
+}
+
+// ListTokens returns unexpired tokens of a kind, newest first.
+func (s *Store) ListTokens(kind string) ([]AuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT token_hash, user_id, email, role, created_by, created_at, expires_at
+		FROM auth_tokens WHERE kind = ? AND expires_at > ? ORDER BY created_at DESC`, kind, formatTime(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []AuthToken{}
+	for rows.Next() {
+		var (
+			t                              AuthToken
+			userID, email, role, createdBy sql.NullString
+			createdAt, expiresAt           sql.NullString
+		)
+		if err := rows.Scan(&t.Hash, &userID, &email, &role, &createdBy, &createdAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		t.Kind = kind
+		t.UserID = userID.String
+		t.Email, _ = openField(s.sealer, fieldTokenEmail, t.Hash, email.String)
+		t.Role = types.Role(role.String)
+		t.CreatedBy = createdBy.String
+		t.CreatedAt = parseTime(createdAt.String)
+		t.ExpiresAt = parseTime(expiresAt.String)
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken removes a token, e.g. on logout or once an invite is used.
+func (s *Store) DeleteToken(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`DELETE FROM auth_tokens WHERE token_hash = ?`, hash); err != nil {
+		return fmt.Errorf("delete token: %w", err)
+	}
+	return nil
+}
+
+// DeleteUserTokens revokes every session and reset token for a user.
+func (s *Store) DeleteUserTokens(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`DELETE FROM auth_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("delete user tokens: %w", err)
+	}
+	return nil
+}
+
+// PruneExpiredTokens removes expired tokens of every kind.
+func (s *Store) PruneExpiredTokens() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`DELETE FROM auth_tokens WHERE expires_at <= ?`, formatTime(time.Now())); err != nil {
+		return fmt.Errorf("prune tokens: %w", err)
+	}
+	return nil
+}
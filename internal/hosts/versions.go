@@ -0,0 +1,221 @@
+package hosts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// AuditMergeConflict is the audit action recorded when two nodes edited
+// the same field of a host concurrently.
+const AuditMergeConflict = "host.merge_conflict"
+
+// replicatedFields are the host fields operators edit and nodes replicate,
+// by JSON name. Only these are versioned and merged; everything else is
+// measured by each node.
+var replicatedFields = []struct {
+	name string
+	get  func(*types.Host) string
+	set  func(*types.Host, string)
+}{
+	{"ip_address", func(h *types.Host) string { return h.IPAddress }, func(h *types.Host, v string) { h.IPAddress = v }},
+	{"vpn_ip_address", func(h *types.Host) string { return h.VPNIPAddress }, func(h *types.Host, v string) { h.VPNIPAddress = v }},
+	{"nickname", func(h *types.Host) string { return h.Nickname }, func(h *types.Host, v string) { h.Nickname = v }},
+	{"notes", func(h *types.Host) string { return h.Notes }, func(h *types.Host, v string) { h.Notes = v }},
+	{"path_preference", func(h *types.Host) string { return string(h.PathPreference) }, func(h *types.Host, v string) { h.PathPreference = types.PathPreference(v) }},
+	{"timezone", func(h *types.Host) string { return h.Timezone }, func(h *types.Host, v string) { h.Timezone = v }},
+	{"cms", func(h *types.Host) string { return string(h.CMS) }, func(h *types.Host, v string) { h.CMS = types.CMSKind(v) }},
+}
+
+// FieldConflict is a field two nodes edited concurrently to different values.
+// The later edit by Lamport clock is kept; ties go to the higher node ID.
+type FieldConflict struct {
+	HostID string `json:"host_id"`
+	Field  string `json:"field"`
+	Kept   string `json:"kept"`
+	KeptBy string `json:"kept_by"` // Node that made the kept edit
+	Lost   string `json:"lost"`
+	LostBy string `json:"lost_by"`
+}
+
+// SetNodeID sets the node ID this store stamps local edits with. Edits
+// made before it is set are not versioned.
+func (s *Store) SetNodeID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodeID = id
+}
+
+// NodeID returns the node ID set with SetNodeID, or "" before it is set.
+func (s *Store) NodeID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nodeID
+}
+
+// stamp records the replicated fields that changed from old to h as one
+// edit by node, and reports whether there was one. old is nil for a new
+// host. The versions h arrived with are kept, and old's edit counts never
+// go backwards.
+func stamp(old, h *types.Host, node string) bool {
+	v := cloneVersions(h.Versions)
+	if old != nil {
+		if len(v.Fields) == 0 {
+			v.Fields = maps.Clone(old.Versions.Fields)
+		}
+		for n, c := range old.Versions.Vector {
+			v.Vector[n] = max(v.Vector[n], c)
+		}
+	}
+	if v.Fields == nil {
+		v.Fields = make(map[string]types.FieldVersion)
+	}
+
+	var changed []string
+	for _, f := range replicatedFields {
+		value := f.get(h)
+		if old == nil && value == "" || old != nil && f.get(old) == value {
+			continue
+		}
+		changed = append(changed, f.name)
+	}
+	if node != "" && len(changed) > 0 {
+		v.Vector[node]++
+		clock := lamport(v) + 1
+		for _, name := range changed {
+			v.Fields[name] = types.FieldVersion{Node: node, Seq: v.Vector[node], Clock: clock}
+		}
+	}
+	if len(v.Vector) == 0 && len(v.Fields) == 0 {
+		v = types.Versions{}
+	}
+	h.Versions = v
+	return node != "" && len(changed) > 0
+}
+
+// mergeHost combines a copy of a host received from a peer with the local
+// one. Each replicated field takes the edit the other side has not seen;
+// if both sides edited it, the later edit wins and, if the values differ,
+// a FieldConflict is returned. Fields neither side has versioned, as from
+// nodes that predate versions, take the incoming value. Other fields come
+// from incoming, as they did before versions.
+func mergeHost(local, incoming types.Host) (types.Host, []FieldConflict) {
+	merged := incoming
+	v := cloneVersions(local.Versions)
+	for n, c := range incoming.Versions.Vector {
+		v.Vector[n] = max(v.Vector[n], c)
+	}
+	if v.Fields == nil {
+		v.Fields = make(map[string]types.FieldVersion)
+	}
+
+	var conflicts []FieldConflict
+	for _, f := range replicatedFields {
+		lo, loOK := local.Versions.Fields[f.name]
+		in, inOK := incoming.Versions.Fields[f.name]
+		if !loOK && !inOK {
+			continue // Unversioned on both sides: incoming, as before
+		}
+		inNew := inOK && in.Seq > local.Versions.Vector[in.Node]
+		loNew := loOK && lo.Seq > incoming.Versions.Vector[lo.Node]
+		switch {
+		case inNew && !loNew:
+			v.Fields[f.name] = in
+		case inNew && loNew && later(in, lo):
+			if f.get(&local) != f.get(&incoming) {
+				conflicts = append(conflicts, FieldConflict{HostID: local.ID, Field: f.name,
+					Kept: f.get(&incoming), KeptBy: in.Node, Lost: f.get(&local), LostBy: lo.Node})
+			}
+			v.Fields[f.name] = in
+		case inNew && loNew:
+			if f.get(&local) != f.get(&incoming) {
+				conflicts = append(conflicts, FieldConflict{HostID: local.ID, Field: f.name,
+					Kept: f.get(&local), KeptBy: lo.Node, Lost: f.get(&incoming), LostBy: in.Node})
+			}
+			f.set(&merged, f.get(&local))
+		default:
+			// Incoming has nothing local has not seen.
+			f.set(&merged, f.get(&local))
+		}
+	}
+	if len(v.Vector) == 0 && len(v.Fields) == 0 {
+		v = types.Versions{}
+	}
+	merged.Versions = v
+	return merged, conflicts
+}
+
+// Merge applies a copy of a host received from a peer, merging it with
+// the local one if there is one, and returns any conflicting edits.
+func (s *Store) Merge(host types.Host) ([]FieldConflict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seal, err := s.fieldSealerLocked()
+	if err != nil {
+		return nil, err
+	}
+	local, err := scanHost(s.db.QueryRow(`SELECT `+hostColumns+` FROM hosts WHERE id = ?`, host.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		args, err := seal.hostArgs(host)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.db.Exec(hostInsert, args...); err != nil {
+			return nil, fmt.Errorf("insert host: %w", err)
+		}
+		s.notify()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	openHost(s.sealer, &local)
+
+	merged, conflicts := mergeHost(local, host)
+	args, err := seal.hostArgs(merged)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(hostUpdate, append(args[1:], merged.ID)...); err != nil {
+		return nil, fmt.Errorf("update host: %w", err)
+	}
+	s.notify()
+	return conflicts, nil
+}
+
+// later reports whether edit a comes after b in Lamport order.
+func later(a, b types.FieldVersion) bool {
+	if a.Clock != b.Clock {
+		return a.Clock > b.Clock
+	}
+	return a.Node > b.Node
+}
+
+// lamport returns the latest Lamport time of any edit in v.
+func lamport(v types.Versions) uint64 {
+	var clock uint64
+	for _, f := range v.Fields {
+		clock = max(clock, f.Clock)
+	}
+	return clock
+}
+
+// copyReplicated sets h's replicated fields and versions from src.
+func copyReplicated(h *types.Host, src types.Host) {
+	for _, f := range replicatedFields {
+		f.set(h, f.get(&src))
+	}
+	h.Versions = src.Versions
+}
+
+func cloneVersions(v types.Versions) types.Versions {
+	out := types.Versions{Vector: maps.Clone(v.Vector), Fields: maps.Clone(v.Fields)}
+	if out.Vector == nil {
+		out.Vector = make(map[string]uint64)
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package hosts
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Viewer states, as a node's watchdog reports them.
+const (
+	ViewerOK        = "ok"
+	ViewerCrashLoop = "crash_loop" // Restarted again and again within the watchdog's window
+)
+
+// viewerTTL is how long a reported viewer state holds, as for playback.
+const viewerTTL = 2 * time.Minute
+
+// Viewer is how the program that draws a node's screen is doing: the
+// Anthias viewer, or the browser of the built-in player.
+type Viewer struct {
+	State      string    `json:"state"`   // ViewerOK or ViewerCrashLoop
+	Process    string    `json:"process"` // The viewer's container, or "player" for the built-in player
+	Restarts   int       `json:"restarts"`
+	Window     int       `json:"window_minutes"` // Restarts counts those within this many minutes
+	Since      time.Time `json:"since,omitzero"` // When the crash loop was found
+	Logs       string    `json:"logs,omitempty"` // The viewer's last output lines when the crash loop was found
+	Fallback   bool      `json:"fallback,omitempty"`
+	ReportedAt time.Time `json:"reported_at,omitzero"` // When the receiver last heard it; set by RecordViewer
+}
+
+// Summary describes a crash loop in a few words, or returns "".
+func (v Viewer) Summary() string {
+	if v.State != ViewerCrashLoop {
+		return ""
+	}
+	return fmt.Sprintf("%s restarted %d times in %d minutes", v.Process, v.Restarts, v.Window)
+}
+
+// viewerLog holds the last viewer state of each node, by node ID, in
+// memory like playback.
+type viewerLog struct {
+	mu     sync.Mutex
+	byNode map[string]Viewer
+}
+
+// RecordViewer stores the viewer state nodeID reported at now.
+func (s *Store) RecordViewer(nodeID string, v Viewer, now time.Time) {
+	v.ReportedAt = now.UTC()
+	s.viewers.mu.Lock()
+	defer s.viewers.mu.Unlock()
+	s.viewers.byNode[nodeID] = v
+}
+
+// ViewerOf returns the viewer state nodeID last reported, and false if it
+// has not reported one lately.
+func (s *Store) ViewerOf(nodeID string, now time.Time) (Viewer, bool) {
+	s.viewers.mu.Lock()
+	defer s.viewers.mu.Unlock()
+	v, ok := s.viewers.byNode[nodeID]
+	if !ok || now.Sub(v.ReportedAt) > viewerTTL {
+		return Viewer{}, false
+	}
+	return v, true
+}
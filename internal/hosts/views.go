@@ -0,0 +1,244 @@
+package hosts
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// ErrViewNotFound is returned when a user has no saved view by that name.
+var ErrViewNotFound = errors.New("view not found")
+
+// View sorts are by one of these.
+const (
+	SortName   = "name"   // Nickname, else hostname, else IP
+	SortIP     = "ip"     // LAN address, numerically
+	SortHealth = "health" // Offline first
+)
+
+// ViewFilter selects hosts. Empty fields match every host.
+type ViewFilter struct {
+	Query   string               `json:"query,omitempty"`   // Found in the nickname, hostname, IPs or notes, ignoring case
+	Health  []types.HealthStatus `json:"health,omitempty"`  // One of these
+	Subnets []string             `json:"subnets,omitempty"` // CIDRs the LAN or VPN IP is in, e.g. a building's network
+}
+
+// View is a named filter and sort order for the host list, saved per user.
+type View struct {
+	Name      string     `json:"name"`
+	Filter    ViewFilter `json:"filter"`
+	Sort      string     `json:"sort,omitempty"` // SortName by default
+	Desc      bool       `json:"desc,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at,omitzero"`
+}
+
+// Validate rejects views that could not be applied.
+func (v *View) Validate() error {
+	v.Name = strings.TrimSpace(v.Name)
+	if v.Name == "" {
+		return errors.New("view name is required")
+	}
+	if len(v.Name) > 64 {
+		return errors.New("view name is too long")
+	}
+	switch v.Sort {
+	case "", SortName, SortIP, SortHealth:
+	default:
+		return fmt.Errorf("unknown sort %q (use name, ip or health)", v.Sort)
+	}
+	for _, h := range v.Filter.Health {
+		if _, ok := healthOrder[h]; !ok {
+			return fmt.Errorf("unknown health %q", h)
+		}
+	}
+	for _, subnet := range v.Filter.Subnets {
+		if _, err := netip.ParsePrefix(subnet); err != nil {
+			return fmt.Errorf("invalid subnet %q: use CIDR notation, e.g. 10.1.0.0/16", subnet)
+		}
+	}
+	return nil
+}
+
+// healthOrder sorts the hosts that need attention first.
+var healthOrder = map[types.HealthStatus]int{
+	types.HealthOffline:     0,
+	types.HealthDegraded:    1,
+	types.HealthMaintenance: 2,
+	types.HealthStarting:    3,
+	types.HealthOnline:      4,
+}
+
+// Matches reports whether the filter selects h.
+func (f ViewFilter) Matches(h types.Host) bool {
+	if q := strings.ToLower(strings.TrimSpace(f.Query)); q != "" {
+		found := false
+		for _, field := range []string{h.Nickname, h.Hostname, h.IPAddress, h.VPNIPAddress, h.Notes} {
+			if strings.Contains(strings.ToLower(field), q) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Health) > 0 && !slices.Contains(f.Health, h.Health) {
+		return false
+	}
+	if len(f.Subnets) > 0 && !inSubnets(f.Subnets, h.IPAddress, h.ResolvedIP, h.VPNIPAddress, h.ResolvedVPNIP) {
+		return false
+	}
+	return true
+}
+
+func inSubnets(subnets []string, addrs ...string) bool {
+	for _, subnet := range subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ip, err := netip.ParseAddr(a); err == nil && prefix.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply returns the hosts in list that the view selects, in its order.
+func (v View) Apply(list []types.Host) []types.Host {
+	out := []types.Host{}
+	for _, h := range list {
+		if v.Filter.Matches(h) {
+			out = append(out, h)
+		}
+	}
+	slices.SortStableFunc(out, func(a, b types.Host) int {
+		var c int
+		switch v.Sort {
+		case SortIP:
+			c = compareAddrs(a.IPAddress, b.IPAddress)
+		case SortHealth:
+			c = cmp.Compare(healthOrder[a.Health], healthOrder[b.Health])
+		}
+		c = cmp.Or(c, strings.Compare(strings.ToLower(hostName(a)), strings.ToLower(hostName(b))))
+		if v.Desc {
+			return -c
+		}
+		return c
+	})
+	return out
+}
+
+func hostName(h types.Host) string {
+	return cmp.Or(h.Nickname, h.Hostname, h.IPAddress)
+}
+
+// compareAddrs orders IPs numerically, and DNS names after them.
+func compareAddrs(a, b string) int {
+	ipA, errA := netip.ParseAddr(a)
+	ipB, errB := netip.ParseAddr(b)
+	switch {
+	case errA == nil && errB == nil:
+		return ipA.Compare(ipB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// ListViews returns the views saved by the user with userID, by name. In
+// open mode, without accounts, views are saved under an empty user ID.
+func (s *Store) ListViews(userID string) ([]View, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT data, updated_at FROM saved_views WHERE user_id = ? ORDER BY name COLLATE NOCASE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list views: %w", err)
+	}
+	defer rows.Close()
+
+	views := []View{}
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+	return views, rows.Err()
+}
+
+// GetView returns one of the user's saved views.
+func (s *Store) GetView(userID, name string) (View, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, err := scanView(s.db.QueryRow(`SELECT data, updated_at FROM saved_views WHERE user_id = ? AND name = ?`, userID, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return View{}, ErrViewNotFound
+	}
+	return v, err
+}
+
+// SaveView stores v for the user, replacing their view of the same name.
+func (s *Store) SaveView(userID string, v View) (View, error) {
+	if err := v.Validate(); err != nil {
+		return View{}, err
+	}
+	v.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(v)
+	if err != nil {
+		return View{}, fmt.Errorf("encode view: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO saved_views (user_id, name, data, updated_at) VALUES (?, ?, ?, ?)`,
+		userID, v.Name, string(data), formatTime(v.UpdatedAt)); err != nil {
+		return View{}, fmt.Errorf("save view: %w", err)
+	}
+	return v, nil
+}
+
+// DeleteView removes one of the user's saved views.
+func (s *Store) DeleteView(userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, err := s.db.Exec(`DELETE FROM saved_views WHERE user_id = ? AND name = ?`, userID, name)
+	if err != nil {
+		return fmt.Errorf("delete view: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrViewNotFound
+	}
+	return nil
+}
+
+func scanView(row interface{ Scan(...any) error }) (View, error) {
+	var data string
+	var updated sql.NullString
+	if err := row.Scan(&data, &updated); err != nil {
+		return View{}, err
+	}
+	var v View
+	if err := json.Unmarshal([]byte(data), &v); err != nil {
+		return View{}, fmt.Errorf("decode view: %w", err)
+	}
+	v.UpdatedAt = parseTime(updated.String)
+	return v, nil
+}
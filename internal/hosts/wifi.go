@@ -0,0 +1,152 @@
+package hosts
+
+import (
+	"fmt"
+	"time"
+)
+
+// wifiSampleInterval is how often an unchanged Wi-Fi reading is sampled.
+// Signal moves by a few dB all the time, so only a change of network,
+// access point or reconnect count is stored sooner.
+const wifiSampleInterval = 5 * time.Minute
+
+// wifiHistoryLimit is how long Wi-Fi samples are kept.
+const wifiHistoryLimit = 7 * 24 * time.Hour
+
+// WiFi is the wireless link of a node, as the node reports it in its
+// heartbeats. Nodes on Ethernet do not report one.
+type WiFi struct {
+	At         time.Time `json:"at,omitzero"` // When the receiver sampled it
+	Interface  string    `json:"interface"`
+	SSID       string    `json:"ssid,omitempty"`       // Empty while disconnected
+	BSSID      string    `json:"bssid,omitempty"`      // Access point the node is associated with
+	FreqMHz    int       `json:"freq_mhz,omitempty"`   // Centre frequency of the channel
+	Channel    int       `json:"channel,omitempty"`    // From FreqMHz
+	SignalDBM  int       `json:"signal_dbm,omitempty"` // 0 while disconnected
+	Reconnects int       `json:"reconnects"`           // Times the node lost the network and joined it again since NSM started
+	Roams      int       `json:"roams"`                // Times it moved to another access point since NSM started
+}
+
+// Connected reports whether the node was associated with an access point.
+func (w WiFi) Connected() bool {
+	return w.BSSID != ""
+}
+
+// WiFiChannel returns the channel number of a frequency in the 2.4, 5 or
+// 6 GHz band, or 0 if it is in none of them.
+func WiFiChannel(freqMHz int) int {
+	switch {
+	case freqMHz == 2484:
+		return 14
+	case freqMHz >= 2412 && freqMHz <= 2472:
+		return (freqMHz - 2407) / 5
+	case freqMHz >= 5160 && freqMHz <= 5885:
+		return (freqMHz - 5000) / 5
+	case freqMHz >= 5955 && freqMHz <= 7115:
+		return (freqMHz - 5950) / 5
+	}
+	return 0
+}
+
+// WiFiSummary condenses a node's Wi-Fi samples over a period.
+type WiFiSummary struct {
+	Latest       WiFi `json:"latest"`
+	Samples      int  `json:"samples"`        // Samples taken while connected
+	AvgSignalDBM int  `json:"avg_signal_dbm"` // Over the connected samples; 0 if there were none
+	MinSignalDBM int  `json:"min_signal_dbm"`
+	Reconnects   int  `json:"reconnects"` // During the period
+	Roams        int  `json:"roams"`
+}
+
+// SummarizeWiFi summarizes samples, oldest first. The counters restart
+// with NSM, so a count lower than the one before is all new.
+func SummarizeWiFi(samples []WiFi) WiFiSummary {
+	var sum WiFiSummary
+	if len(samples) == 0 {
+		return sum
+	}
+	sum.Latest = samples[len(samples)-1]
+	total := 0
+	for i, w := range samples {
+		if w.Connected() {
+			sum.Samples++
+			total += w.SignalDBM
+			sum.MinSignalDBM = min(sum.MinSignalDBM, w.SignalDBM)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := samples[i-1]
+		sum.Reconnects += increase(prev.Reconnects, w.Reconnects)
+		sum.Roams += increase(prev.Roams, w.Roams)
+	}
+	if sum.Samples > 0 {
+		sum.AvgSignalDBM = total / sum.Samples
+	}
+	return sum
+}
+
+// increase is how much a counter grew from prev to cur, allowing for it
+// having restarted from zero.
+func increase(prev, cur int) int {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+const wifiColumns = `at, interface, ssid, bssid, freq_mhz, signal_dbm, reconnects, roams`
+
+// RecordWiFi adds w, reported by nodeID at now, to the node's history when
+// it changed network, access point or counts, or the last sample is
+// wifiSampleInterval old.
+func (s *Store) RecordWiFi(nodeID string, w WiFi, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last WiFi
+	var at string
+	err := s.db.QueryRow(`SELECT at, ssid, bssid, reconnects, roams FROM wifi WHERE node_id = ? ORDER BY at DESC LIMIT 1`, nodeID).
+		Scan(&at, &last.SSID, &last.BSSID, &last.Reconnects, &last.Roams)
+	if err == nil && now.Sub(parseTime(at)) < wifiSampleInterval &&
+		w.SSID == last.SSID && w.BSSID == last.BSSID && w.Reconnects == last.Reconnects && w.Roams == last.Roams {
+		return nil
+	}
+
+	if _, err := s.db.Exec(`INSERT INTO wifi (node_id, `+wifiColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nodeID, sortableTime(now), w.Interface, w.SSID, w.BSSID, w.FreqMHz, w.SignalDBM, w.Reconnects, w.Roams); err != nil {
+		return fmt.Errorf("record wifi: %w", err)
+	}
+	if _, err := s.db.Exec(`DELETE FROM wifi WHERE node_id = ? AND at < ?`, nodeID, sortableTime(now.Add(-wifiHistoryLimit))); err != nil {
+		return fmt.Errorf("prune wifi: %w", err)
+	}
+	return nil
+}
+
+// WiFiHistory returns the Wi-Fi samples taken since since, oldest first,
+// by node ID.
+func (s *Store) WiFiHistory(since time.Time) (map[string][]WiFi, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.Query(`SELECT node_id, `+wifiColumns+` FROM wifi WHERE at >= ? ORDER BY node_id, at`, sortableTime(since))
+	if err != nil {
+		return nil, fmt.Errorf("list wifi: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string][]WiFi)
+	for rows.Next() {
+		var (
+			id, at string
+			w      WiFi
+		)
+		if err := rows.Scan(&id, &at, &w.Interface, &w.SSID, &w.BSSID, &w.FreqMHz, &w.SignalDBM, &w.Reconnects, &w.Roams); err != nil {
+			return nil, err
+		}
+		w.At = parseTime(at)
+		w.Channel = WiFiChannel(w.FreqMHz)
+		out[id] = append(out[id], w)
+	}
+	return out, rows.Err()
+}
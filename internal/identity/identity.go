@@ -0,0 +1,98 @@
+// Package identity manages the node's long-lived Ed25519 signing key. The
+// key signs audit log entries so exports can be verified later, and keys
+// derived from it seal data that must stay private to this node.
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultKeyFile is the key file name, kept next to hosts.db and
+// identity.id.
+const DefaultKeyFile = "identity.key"
+
+// Identity is a node signing key.
+type Identity struct {
+	key ed25519.PrivateKey
+}
+
+// Load reads the key at path. The error wraps os.ErrNotExist when there is
+// no file.
+func Load(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read identity key: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid identity key in %s", path)
+	}
+	return &Identity{key: ed25519.NewKeyFromSeed(seed)}, nil
+}
+
+// LoadOrCreate reads the key at path, generating and saving a new one when
+// the file does not exist. The file holds the base64 seed and is readable
+// only by the owner.
+func LoadOrCreate(path string) (*Identity, error) {
+	id, err := Load(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return id, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate identity key: %w", err)
+	}
+	seed := base64.StdEncoding.EncodeToString(key.Seed())
+	if err := os.WriteFile(path, []byte(seed+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("save identity key: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// Generate returns a new key that is never saved, for nodes that only
+// exist in memory such as simulated hosts.
+func Generate() (*Identity, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate identity key: %w", err)
+	}
+	return &Identity{key: key}, nil
+}
+
+// PublicKey returns the node's public key.
+func (id *Identity) PublicKey() ed25519.PublicKey {
+	return id.key.Public().(ed25519.PublicKey)
+}
+
+// Fingerprint is a short, stable identifier for the public key, suitable
+// for showing to people comparing keys.
+func (id *Identity) Fingerprint() string {
+	return Fingerprint(id.PublicKey())
+}
+
+// Sign signs msg with the node key.
+func (id *Identity) Sign(msg []byte) []byte {
+	return ed25519.Sign(id.key, msg)
+}
+
+// DeriveKey returns a 32-byte symmetric key for purpose, derived from the
+// node key with HKDF-SHA256. Different purposes yield unrelated keys.
+func (id *Identity) DeriveKey(purpose string) ([]byte, error) {
+	return hkdf.Key(sha256.New, id.key.Seed(), nil, "nsm/"+purpose, 32)
+}
+
+// Fingerprint returns the first 16 hex characters of the SHA-256 of pub.
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,159 @@
+//go:build integration
+
+// Package integration runs several NSM nodes side by side and drives them
+// over HTTP, to catch regressions in the peer protocol that unit tests with
+// a single store cannot see: discovery, host list pushes and announcements,
+// heartbeats, edit lock propagation and staged upgrades.
+//
+// The nodes run from deploy/integration/docker-compose.yml, each container
+// with a data directory of its own. The tests build with the integration
+// tag and need Docker with the compose plugin:
+//
+//	go test -tags integration -v ./internal/integration
+//
+// Set NSM_INTEGRATION_KEEP=1 to leave the nodes running afterwards, and
+// NSM_INTEGRATION_EXTERNAL=1 to test nodes already started by hand.
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// project names the compose project, so a run never touches other
+// containers.
+const project = "nsm-integration"
+
+// composeFile is the topology, relative to this package.
+var composeFile = filepath.Join("..", "..", "deploy", "integration", "docker-compose.yml")
+
+// Node is one NSM instance of the cluster.
+type Node struct {
+	Name string
+	IP   string // On the cluster network, as peers see it
+	Base string // Dashboard URL from the test process
+	ID   string // Filled in once the node is up
+}
+
+// Nodes returns the nodes of the compose topology.
+func Nodes() []*Node {
+	return []*Node{
+		{Name: "node1", IP: "172.28.0.11", Base: "http://127.0.0.1:18081"},
+		{Name: "node2", IP: "172.28.0.12", Base: "http://127.0.0.1:18082"},
+		{Name: "node3", IP: "172.28.0.13", Base: "http://127.0.0.1:18083"},
+	}
+}
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// StartCluster builds and starts the nodes, waits until each answers its
+// health check, and stops and removes them when the test ends.
+func StartCluster(t *testing.T) []*Node {
+	t.Helper()
+	if os.Getenv("NSM_INTEGRATION_EXTERNAL") == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			t.Skip("docker is not installed")
+		}
+		compose(t, "up", "-d", "--build", "--force-recreate", "--renew-anon-volumes")
+		t.Cleanup(func() {
+			if t.Failed() {
+				logs, _ := exec.Command("docker", "compose", "-p", project, "-f", composeFile, "logs", "--no-color").CombinedOutput()
+				t.Logf("node logs:\n%s", logs)
+			}
+			if os.Getenv("NSM_INTEGRATION_KEEP") == "" {
+				compose(t, "down", "-v")
+			}
+		})
+	}
+
+	nodes := Nodes()
+	for _, n := range nodes {
+		Eventually(t, time.Minute, n.Name+" to answer its health check", func() bool {
+			return n.Do(http.MethodGet, "/api/health", nil, nil) == nil
+		})
+		var local types.Host
+		if err := n.Do(http.MethodGet, "/api/host/local", nil, &local); err != nil {
+			t.Fatalf("%s: %v", n.Name, err)
+		}
+		n.ID = local.ID
+	}
+	return nodes
+}
+
+func compose(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("docker", append([]string{"compose", "-p", project, "-f", composeFile}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("docker compose %v: %v\n%s", args, err, out)
+	}
+}
+
+// Do sends a request with body encoded as JSON, unless nil, and decodes the
+// answer into out, unless nil. Answers other than 2xx are errors.
+func (n *Node) Do(method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, n.Base+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, bytes.TrimSpace(data))
+	}
+	if out != nil && len(data) > 0 {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
+
+// Hosts returns the host list of n, keyed by address.
+func (n *Node) Hosts(t *testing.T) map[string]types.Host {
+	t.Helper()
+	var list []types.Host
+	if err := n.Do(http.MethodGet, "/api/hosts", nil, &list); err != nil {
+		t.Fatalf("%s: %v", n.Name, err)
+	}
+	out := make(map[string]types.Host, len(list))
+	for _, h := range list {
+		out[h.IPAddress] = h
+	}
+	return out
+}
+
+// Eventually polls cond every second until it holds, failing the test
+// once timeout has passed.
+func Eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out after %v waiting for %s", timeout, what)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,171 @@
+//go:build integration
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/patching"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// TestPeerProtocol walks a fresh cluster through the life of a fleet. The
+// steps build on each other, so a failure stops the rest.
+func TestPeerProtocol(t *testing.T) {
+	nodes := StartCluster(t)
+	n1, n2, n3 := nodes[0], nodes[1], nodes[2]
+
+	step := func(name string, fn func(t *testing.T)) {
+		if !t.Run(name, fn) {
+			t.FailNow()
+		}
+	}
+
+	step("discovery", func(t *testing.T) {
+		if err := n1.Do(http.MethodPost, "/api/discovery/scan", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		Eventually(t, time.Minute, "node1 to discover the other nodes", func() bool {
+			list := n1.Hosts(t)
+			return list[n2.IP].ID == n2.ID && list[n3.IP].ID == n3.ID
+		})
+	})
+
+	// Nodes that have not heard node1's heartbeats yet hold its list in
+	// quarantine, so an admin approves it there.
+	step("push", func(t *testing.T) {
+		if err := n1.Do(http.MethodPost, "/api/hosts/push", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []*Node{n2, n3} {
+			var held []hosts.Quarantined
+			Eventually(t, 30*time.Second, n.Name+" to quarantine the host list", func() bool {
+				held = nil
+				n.Do(http.MethodGet, "/api/hosts/quarantine", nil, &held)
+				return slices.ContainsFunc(held, func(q hosts.Quarantined) bool { return q.Host.IPAddress == n1.IP })
+			})
+			for _, q := range held {
+				if err := n.Do(http.MethodPost, fmt.Sprintf("/api/hosts/quarantine/approve?id=%d", q.ID), nil, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, ok := n.Hosts(t)[n1.IP]; !ok {
+				t.Fatalf("Expected %s to list node1 once approved", n.Name)
+			}
+		}
+	})
+
+	step("heartbeats", func(t *testing.T) {
+		for _, n := range nodes {
+			Eventually(t, time.Minute, n.Name+" to see its peers online", func() bool {
+				list := n.Hosts(t)
+				for _, peer := range nodes {
+					if peer != n && list[peer.IP].Health != types.HealthOnline {
+						return false
+					}
+				}
+				return true
+			})
+		}
+	})
+
+	// Heartbeats pin the nodes' keys, but their signed requests act as an
+	// operator only once an admin confirms each key by its fingerprint.
+	step("trust", func(t *testing.T) {
+		for _, peer := range nodes {
+			var key struct {
+				Fingerprint string `json:"key_fingerprint"`
+			}
+			if err := peer.Do(http.MethodGet, "/api/settings/encryption", nil, &key); err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range nodes {
+				if n == peer {
+					continue
+				}
+				if err := n.Do(http.MethodPost, fmt.Sprintf("/api/peers/trust?id=%s&fingerprint=%s", peer.ID, key.Fingerprint), nil, nil); err != nil {
+					t.Fatalf("%s trusting %s: %v", n.Name, peer.Name, err)
+				}
+			}
+		}
+	})
+
+	// Announcements from a node whose key is not pinned yet are held back,
+	// so this runs once heartbeats have been exchanged.
+	step("announce", func(t *testing.T) {
+		added := map[string]string{"nickname": "Lobby screen", "ip_address": "172.28.0.50"}
+		if err := n2.Do(http.MethodPost, "/api/hosts/add", added, nil); err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []*Node{n1, n3} {
+			Eventually(t, 30*time.Second, n.Name+" to learn the added host", func() bool {
+				return n.Hosts(t)["172.28.0.50"].Nickname == "Lobby screen"
+			})
+		}
+	})
+
+	step("lock", func(t *testing.T) {
+		type lockResult struct {
+			Success  bool   `json:"success"`
+			LockedBy string `json:"locked_by"`
+		}
+		lock := func(n *Node, editor string) lockResult {
+			var res lockResult
+			if err := n.Do(http.MethodPost, "/api/hosts/lock", map[string]string{"host_id": n3.ID, "editor_id": editor}, &res); err != nil {
+				t.Fatal(err)
+			}
+			return res
+		}
+
+		// Locks are announced to healthy peers only.
+		Eventually(t, time.Minute, "node1 to find node2 healthy", func() bool {
+			return n1.Hosts(t)[n2.IP].Status == types.StatusHealthy
+		})
+		if res := lock(n1, "alice-tab"); !res.Success {
+			t.Fatalf("Expected node1 to grant the lock, got %+v", res)
+		}
+		Eventually(t, 30*time.Second, "node2 to refuse a second editor", func() bool {
+			return lock(n2, "bob-tab").LockedBy == "alice-tab"
+		})
+
+		if err := n1.Do(http.MethodPost, "/api/hosts/unlock", map[string]string{"host_id": n3.ID, "editor_id": "alice-tab"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		Eventually(t, 30*time.Second, "node2 to release the lock", func() bool {
+			return lock(n2, "bob-tab").Success
+		})
+		n2.Do(http.MethodPost, "/api/hosts/unlock", map[string]string{"host_id": n3.ID, "editor_id": "bob-tab"}, nil)
+	})
+
+	// The containers may have no route to a package mirror, so the upgrade
+	// itself may fail; what matters is that node1 reaches node2, follows
+	// the upgrade and records how it ended.
+	step("upgrade", func(t *testing.T) {
+		req := map[string]any{"hosts": []string{n2.ID}, "batch_size": 1}
+		if err := n1.Do(http.MethodPost, "/api/patches/rollout", req, nil); err != nil {
+			t.Fatal(err)
+		}
+		var rollout patching.Rollout
+		Eventually(t, 15*time.Minute, "the rollout to finish", func() bool {
+			if err := n1.Do(http.MethodGet, "/api/patches/rollout", nil, &rollout); err != nil {
+				t.Fatal(err)
+			}
+			return rollout.State != patching.RolloutRunning
+		})
+		if len(rollout.Steps) != 1 || rollout.Steps[0].HostID != n2.ID {
+			t.Fatalf("Expected one step for node2, got %+v", rollout.Steps)
+		}
+		s := rollout.Steps[0]
+		if s.StartedAt.IsZero() || (s.State != patching.StepDone && s.State != patching.StepFailed) {
+			t.Fatalf("Expected node2 upgraded or failed, got %+v", s)
+		}
+		if s.State == patching.StepFailed {
+			t.Logf("Upgrade of node2 failed, as it may without a package mirror: %s", s.Error)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+// Package label renders printable host labels: the host's name and
+// address above QR codes that open its dashboards, sized for a 4 x 3 inch
+// sticker on the back of a screen. Labels come as PNG, for label printers,
+// or as PDF, for office printers.
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+
+	"nexsign.mini/nsm/internal/qr"
+)
+
+// Page size and layout in points, 72 to the inch, measured from the top
+// left. Text uses Courier in the PDF, so widths are known without font
+// metrics: each character is 0.6 of the font size wide.
+const (
+	pageWidth    = 288
+	pageHeight   = 216
+	margin       = 12
+	titleSize    = 14
+	subtitleSize = 9
+	captionSize  = 9
+	urlSize      = 6
+	codeTop      = 48
+	charWidth    = 0.6
+)
+
+// PNGDPI is the resolution PNG labels are rendered at.
+const PNGDPI = 300
+
+// Link is a URL to encode, with a caption saying where it goes.
+type Link struct {
+	Caption string
+	URL     string
+}
+
+// Label is a host label ready to render.
+type Label struct {
+	Title    string
+	Subtitle string
+	Links    []Link
+	codes    []*qr.Code
+}
+
+// New encodes the links of a label. Up to three links fit side by side.
+func New(title, subtitle string, links ...Link) (*Label, error) {
+	if len(links) == 0 || len(links) > 3 {
+		return nil, fmt.Errorf("label: %d links, want 1 to 3", len(links))
+	}
+	l := &Label{Title: title, Subtitle: subtitle, Links: links}
+	for _, link := range links {
+		code, err := qr.Encode(link.URL)
+		if err != nil {
+			return nil, fmt.Errorf("label: %s: %w", link.Caption, err)
+		}
+		l.codes = append(l.codes, code)
+	}
+	return l, nil
+}
+
+// text is a line of text centred on x, with its baseline at y.
+type text struct {
+	x, y, size float64
+	s          string
+}
+
+// block is a QR code with its quiet zone, its top left corner at x, y.
+type block struct {
+	x, y, module float64
+	code         *qr.Code
+}
+
+// layout places the title and subtitle across the top, and a column per
+// link below: the code, its caption, then the URL for typing by hand.
+func (l *Label) layout() ([]text, []block) {
+	texts := []text{
+		{pageWidth / 2, margin + titleSize, titleSize, fit(l.Title, pageWidth-2*margin, titleSize)},
+		{pageWidth / 2, margin + titleSize + 4 + subtitleSize, subtitleSize, fit(l.Subtitle, pageWidth-2*margin, subtitleSize)},
+	}
+	var blocks []block
+
+	n := float64(len(l.codes))
+	column := (pageWidth - (n+1)*margin) / n
+	side := math.Min(column, pageHeight-codeTop-margin-captionSize-urlSize-6)
+	for i, code := range l.codes {
+		left := margin + float64(i)*(column+margin)
+		centre := left + column/2
+		blocks = append(blocks, block{centre - side/2, codeTop, side / float64(code.Size+2*qr.QuietZone), code})
+		texts = append(texts,
+			text{centre, codeTop + side + captionSize, captionSize, fit(l.Links[i].Caption, column, captionSize)},
+			text{centre, codeTop + side + captionSize + 3 + urlSize, urlSize, fit(l.Links[i].URL, column, urlSize)},
+		)
+	}
+	return texts, blocks
+}
+
+// fit makes s printable ASCII and shortens it, with an ellipsis, to fit
+// width points at size.
+func fit(s string, width, size float64) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < 32 || r > 126 {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	s = b.String()
+	if limit := int(width / (charWidth * size)); len(s) > limit && limit > 3 {
+		s = s[:limit-3] + "..."
+	}
+	return s
+}
+
+// PNG renders the label at PNGDPI, black on white.
+func (l *Label) PNG() ([]byte, error) {
+	scale := float64(PNGDPI) / 72
+	img := image.NewPaletted(image.Rect(0, 0, int(pageWidth*scale), int(pageHeight*scale)),
+		color.Palette{color.White, color.Black})
+	fill := func(x0, y0, x1, y1 int) {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	texts, blocks := l.layout()
+	for _, b := range blocks {
+		// Round module edges, not sizes, so modules meet without gaps.
+		edge := func(origin float64, i int) int {
+			return int(math.Round((origin + float64(i+qr.QuietZone)*b.module) * scale))
+		}
+		for y := 0; y < b.code.Size; y++ {
+			for x := 0; x < b.code.Size; x++ {
+				if b.code.Dark(x, y) {
+					fill(edge(b.x, x), edge(b.y, y), edge(b.x, x+1), edge(b.y, y+1))
+				}
+			}
+		}
+	}
+	for _, t := range texts {
+		// Scale the font so a cell is no wider than a Courier character.
+		px := max(1, int(charWidth*t.size*scale/cellWidth))
+		width := len(t.s)*cellWidth*px - px
+		left := int(t.x*scale) - width/2
+		top := int(t.y*scale) - glyphHeight*px
+		for i, r := range t.s {
+			for gy := 0; gy < glyphHeight; gy++ {
+				for gx := 0; gx < glyphWidth; gx++ {
+					if glyphPixel(r, gx, gy) {
+						x := left + (i*cellWidth+gx)*px
+						y := top + gy*px
+						fill(x, y, x+px, y+px)
+					}
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF renders the label as a one-page PDF the size of the label.
+func (l *Label) PDF() []byte {
+	texts, blocks := l.layout()
+
+	var content bytes.Buffer
+	for _, b := range blocks {
+		// One rectangle per run of dark modules keeps the stream small.
+		for y := 0; y < b.code.Size; y++ {
+			for x := 0; x < b.code.Size; {
+				if !b.code.Dark(x, y) {
+					x++
+					continue
+				}
+				run := 1
+				for b.code.Dark(x+run, y) {
+					run++
+				}
+				fmt.Fprintf(&content, "%s %s %s %s re\n",
+					pdfNum(b.x+float64(x+qr.QuietZone)*b.module),
+					pdfNum(pageHeight-b.y-float64(y+qr.QuietZone+1)*b.module),
+					pdfNum(float64(run)*b.module), pdfNum(b.module))
+				x += run
+			}
+		}
+	}
+	content.WriteString("f\n")
+	for _, t := range texts {
+		left := t.x - float64(len(t.s))*charWidth*t.size/2
+		fmt.Fprintf(&content, "BT /F1 %s Tf %s %s Td (%s) Tj ET\n",
+			pdfNum(t.size), pdfNum(left), pdfNum(pageHeight-t.y), pdfEscape(t.s))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [4 0 R] /Count 1 >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents 5 0 R >>",
+			pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfNum formats a coordinate to two decimals, without trailing zeros.
+func pdfNum(f float64) string {
+	s := strings.TrimRight(fmt.Sprintf("%.2f", f), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// pdfEscape escapes string delimiters. fit has already made s ASCII.
+func pdfEscape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+	return r.Replace(s)
+}
@@ -0,0 +1,102 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/qr"
+)
+
+func testLabel(t *testing.T) *Label {
+	t.Helper()
+	l, err := New("Lobby (east)", "192.168.1.20",
+		Link{"NSM", "http://192.168.1.20:8080/?host=lobby"},
+		Link{"Anthias", "http://192.168.1.20/"})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return l
+}
+
+func TestPNG(t *testing.T) {
+	l := testLabel(t)
+	data, err := l.PNG()
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 4*PNGDPI || b.Dy() != 3*PNGDPI {
+		t.Fatalf("expected a 4 x 3 inch image, got %v", b)
+	}
+
+	// Every module of every code must come out the right colour where a
+	// scanner samples it, in the middle.
+	scale := float64(PNGDPI) / 72
+	_, blocks := l.layout()
+	for i, b := range blocks {
+		for y := -qr.QuietZone; y < b.code.Size+qr.QuietZone; y++ {
+			for x := -qr.QuietZone; x < b.code.Size+qr.QuietZone; x++ {
+				px := int(math.Round((b.x + (float64(x+qr.QuietZone)+0.5)*b.module) * scale))
+				py := int(math.Round((b.y + (float64(y+qr.QuietZone)+0.5)*b.module) * scale))
+				r, _, _, _ := img.At(px, py).RGBA()
+				if dark := r == 0; dark != b.code.Dark(x, y) {
+					t.Fatalf("code %d: module %d,%d: expected dark %v", i, x, y, b.code.Dark(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	data := testLabel(t).PDF()
+	out := string(data)
+	for _, want := range []string{
+		"%PDF-1.4\n",
+		"/MediaBox [0 0 288 216]",
+		`(Lobby \(east\)) Tj`,
+		"(192.168.1.20) Tj",
+		"(NSM) Tj",
+		"(http://192.168.1.20/) Tj",
+		" re\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the PDF", want)
+		}
+	}
+
+	// The cross-reference table must point at each object.
+	xref := strings.Index(out, "xref\n")
+	for i := 1; i <= 5; i++ {
+		entry := strings.Index(out[xref:], "\n0000000000 65535 f \n") + xref + len("\n0000000000 65535 f \n") + (i-1)*20
+		var off int
+		fmt.Sscanf(out[entry:entry+10], "%d", &off)
+		if !strings.HasPrefix(out[off:], fmt.Sprintf("%d 0 obj\n", i)) {
+			t.Errorf("xref entry %d points at %q", i, out[off:off+10])
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := fit("Café", 100, 10); got != "Caf?" {
+		t.Errorf("expected non-ASCII replaced, got %q", got)
+	}
+	if got := fit(strings.Repeat("x", 40), 60, 10); got != "xxxxxxx..." {
+		t.Errorf("expected an ellipsis at 10 characters, got %q", got)
+	}
+}
+
+func TestNewLimits(t *testing.T) {
+	if _, err := New("t", "s"); err == nil {
+		t.Error("expected a label without links refused")
+	}
+	if _, err := New("t", "s", Link{"Long", strings.Repeat("x", qr.MaxLen+1)}); err == nil {
+		t.Error("expected a URL too long to encode refused")
+	}
+}
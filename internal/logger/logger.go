@@ -2,15 +2,19 @@
 package logger
 
 import (
+	"context"
 	"sync"
 	"time"
+
+	"nexsign.mini/nsm/internal/requestid"
 )
 
 // Message represents a single log message
 type Message struct {
 	Timestamp time.Time `json:"timestamp"`
 	Text      string    `json:"text"`
-	Level     string    `json:"level"` // info, warning, error
+	Level     string    `json:"level"`                // info, warning, error
+	RequestID string    `json:"request_id,omitempty"` // API request the message was logged for
 }
 
 // Logger manages in-memory log messages
@@ -30,6 +34,11 @@ func New(maxSize int) *Logger {
 
 // Log adds a new message to the logger
 func (l *Logger) Log(level, text string) {
+	l.LogContext(context.Background(), level, text)
+}
+
+// LogContext adds a new message, tagged with the request ID ctx carries
+func (l *Logger) LogContext(ctx context.Context, level, text string) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -37,6 +46,7 @@ func (l *Logger) Log(level, text string) {
 		Timestamp: time.Now(),
 		Text:      text,
 		Level:     level,
+		RequestID: requestid.FromContext(ctx),
 	}
 
 	l.messages = append(l.messages, msg)
@@ -62,6 +72,21 @@ func (l *Logger) Error(text string) {
 	l.Log("error", text)
 }
 
+// InfoContext logs an info-level message for the request in ctx
+func (l *Logger) InfoContext(ctx context.Context, text string) {
+	l.LogContext(ctx, "info", text)
+}
+
+// WarningContext logs a warning-level message for the request in ctx
+func (l *Logger) WarningContext(ctx context.Context, text string) {
+	l.LogContext(ctx, "warning", text)
+}
+
+// ErrorContext logs an error-level message for the request in ctx
+func (l *Logger) ErrorContext(ctx context.Context, text string) {
+	l.LogContext(ctx, "error", text)
+}
+
 // GetRecent returns the most recent n messages (newest first)
 func (l *Logger) GetRecent(n int) []Message {
 	l.mu.RLock()
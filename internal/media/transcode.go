@@ -0,0 +1,374 @@
+// Package media converts uploaded video to H.264 profiles a Raspberry Pi
+// can decode in hardware. Uploads are queued and transcoded one at a time
+// with ffmpeg; the results are served from the NSM node for use as Anthias
+// video assets.
+package media
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnavailable is returned when ffmpeg or ffprobe is not installed.
+var ErrUnavailable = errors.New("ffmpeg is not installed on this node")
+
+// ErrJobNotFound is returned for unknown job IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Profile is an ffmpeg output profile.
+type Profile struct {
+	Name    string `json:"name"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Profile string `json:"h264_profile"`
+	Level   string `json:"h264_level"`
+	Bitrate string `json:"bitrate"`
+}
+
+// Profiles are the supported outputs. 1080p suits the Pi 3 and later;
+// 720p also plays smoothly on older boards.
+var Profiles = map[string]Profile{
+	"1080p": {Name: "1080p", Width: 1920, Height: 1080, Profile: "high", Level: "4.1", Bitrate: "8M"},
+	"720p":  {Name: "720p", Width: 1280, Height: 720, Profile: "main", Level: "3.1", Bitrate: "4M"},
+}
+
+// DefaultProfile is used when an upload does not name one.
+const DefaultProfile = "1080p"
+
+// args returns the ffmpeg arguments that transcode in to out: scaled down
+// (never up) to fit the profile, 30 fps at most, 8-bit 4:2:0, AAC stereo
+// audio and the index at the front of the file so playback starts at once.
+func (p Profile) args(in, out string) []string {
+	scale := fmt.Sprintf("scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2", p.Width, p.Height)
+	return []string{
+		"-hide_banner", "-nostats", "-y",
+		"-i", in,
+		"-vf", scale,
+		"-c:v", "libx264", "-profile:v", p.Profile, "-level:v", p.Level,
+		"-pix_fmt", "yuv420p", "-fpsmax", "30", "-b:v", p.Bitrate, "-maxrate", p.Bitrate, "-bufsize", p.Bitrate,
+		"-c:a", "aac", "-b:a", "128k", "-ac", "2",
+		"-movflags", "+faststart",
+		"-progress", "pipe:1",
+		out,
+	}
+}
+
+// Job is one upload being transcoded.
+type Job struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"` // Original file name
+	Profile    string    `json:"profile"`
+	Status     string    `json:"status"`
+	Progress   float64   `json:"progress"` // 0 to 1
+	Error      string    `json:"error,omitempty"`
+	InputSize  int64     `json:"input_size"`
+	OutputSize int64     `json:"output_size,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+}
+
+// Transcoder queues and runs jobs. Inputs, outputs and job records are kept
+// in one directory.
+type Transcoder struct {
+	dir     string
+	ffmpeg  string
+	ffprobe string
+	queue   chan string
+
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewTranscoder opens the job directory and starts the worker. Jobs that
+// were queued or running when NSM stopped are marked failed.
+func NewTranscoder(dir string) (*Transcoder, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create media dir: %w", err)
+	}
+	t := &Transcoder{
+		dir:   dir,
+		queue: make(chan string, 64),
+		jobs:  make(map[string]*Job),
+	}
+	t.ffmpeg, _ = exec.LookPath("ffmpeg")
+	t.ffprobe, _ = exec.LookPath("ffprobe")
+
+	records, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, rec := range records {
+		data, err := os.ReadFile(rec)
+		if err != nil {
+			continue
+		}
+		var j Job
+		if json.Unmarshal(data, &j) != nil || j.ID == "" {
+			continue
+		}
+		if j.Status == StatusQueued || j.Status == StatusRunning {
+			j.Status = StatusFailed
+			j.Error = "interrupted by restart"
+			os.Remove(t.inputPath(j.ID))
+			t.save(&j)
+		}
+		t.jobs[j.ID] = &j
+	}
+
+	go t.run()
+	return t, nil
+}
+
+// Available reports whether ffmpeg and ffprobe were found.
+func (t *Transcoder) Available() bool {
+	return t.ffmpeg != "" && t.ffprobe != ""
+}
+
+func (t *Transcoder) inputPath(id string) string  { return filepath.Join(t.dir, id+".in") }
+func (t *Transcoder) recordPath(id string) string { return filepath.Join(t.dir, id+".json") }
+
+// OutputPath returns where a finished job's video is stored.
+func (t *Transcoder) OutputPath(id string) string { return filepath.Join(t.dir, id+".mp4") }
+
+// save writes j's record. The caller holds t.mu or owns j exclusively.
+func (t *Transcoder) save(j *Job) {
+	if data, err := json.Marshal(j); err == nil {
+		os.WriteFile(t.recordPath(j.ID), data, 0o600)
+	}
+}
+
+// Submit stores the upload read from r and queues it for transcoding.
+func (t *Transcoder) Submit(name, profile string, r io.Reader) (Job, error) {
+	if !t.Available() {
+		return Job{}, ErrUnavailable
+	}
+	if profile == "" {
+		profile = DefaultProfile
+	}
+	if _, ok := Profiles[profile]; !ok {
+		return Job{}, fmt.Errorf("unknown profile %q (use 1080p or 720p)", profile)
+	}
+
+	j := &Job{
+		ID:        uuid.New().String(),
+		Name:      filepath.Base(name),
+		Profile:   profile,
+		Status:    StatusQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	f, err := os.OpenFile(t.inputPath(j.ID), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return Job{}, fmt.Errorf("store upload: %w", err)
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(t.inputPath(j.ID))
+		return Job{}, fmt.Errorf("store upload: %w", err)
+	}
+	j.InputSize = n
+
+	t.mu.Lock()
+	t.jobs[j.ID] = j
+	t.save(j)
+	out := *j
+	t.mu.Unlock()
+
+	select {
+	case t.queue <- j.ID:
+	default:
+		t.finish(j.ID, errors.New("transcode queue is full"))
+		return Job{}, errors.New("transcode queue is full; try again later")
+	}
+	return out, nil
+}
+
+// Get returns one job.
+func (t *Transcoder) Get(id string) (Job, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, ok := t.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return *j, nil
+}
+
+// List returns every job, newest first.
+func (t *Transcoder) List() []Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]Job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		out = append(out, *j)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].CreatedAt.After(out[k].CreatedAt) })
+	return out
+}
+
+// Delete removes a finished or failed job and its files. Running jobs
+// cannot be deleted.
+func (t *Transcoder) Delete(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, ok := t.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+	if j.Status == StatusQueued || j.Status == StatusRunning {
+		return fmt.Errorf("job is %s", j.Status)
+	}
+	delete(t.jobs, id)
+	os.Remove(t.inputPath(id))
+	os.Remove(t.OutputPath(id))
+	os.Remove(t.recordPath(id))
+	return nil
+}
+
+func (t *Transcoder) run() {
+	for id := range t.queue {
+		t.finish(id, t.transcode(id))
+	}
+}
+
+func (t *Transcoder) update(id string, fn func(j *Job)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if j, ok := t.jobs[id]; ok {
+		fn(j)
+		t.save(j)
+	}
+}
+
+func (t *Transcoder) finish(id string, err error) {
+	os.Remove(t.inputPath(id))
+	t.update(id, func(j *Job) {
+		j.FinishedAt = time.Now().UTC()
+		if err != nil {
+			j.Status = StatusFailed
+			j.Error = err.Error()
+			os.Remove(t.OutputPath(id))
+			return
+		}
+		j.Status = StatusDone
+		j.Progress = 1
+		if info, err := os.Stat(t.OutputPath(id)); err == nil {
+			j.OutputSize = info.Size()
+		}
+	})
+}
+
+func (t *Transcoder) transcode(id string) error {
+	j, err := t.Get(id)
+	if err != nil {
+		return err
+	}
+	in := t.inputPath(id)
+	duration := t.probeDuration(in)
+	if duration <= 0 {
+		return errors.New("not a readable video file")
+	}
+	t.update(id, func(j *Job) {
+		j.Status = StatusRunning
+		j.StartedAt = time.Now().UTC()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.ffmpeg, Profiles[j.Profile].args(in, t.OutputPath(id))...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start ffmpeg: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if p, ok := parseProgress(scanner.Text(), duration); ok {
+			t.update(id, func(j *Job) { j.Progress = p })
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg: %v: %s", err, stderr.String())
+	}
+	return nil
+}
+
+// probeDuration returns the length of the video at path, or 0 if ffprobe
+// cannot read it.
+func (t *Transcoder) probeDuration(path string) time.Duration {
+	out, err := exec.Command(t.ffprobe, "-v", "error", "-select_streams", "v:0",
+		"-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// parseProgress reads one line of ffmpeg's -progress output and returns the
+// fraction of total done.
+func parseProgress(line string, total time.Duration) (float64, bool) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok || (key != "out_time_us" && key != "out_time_ms") || total <= 0 {
+		return 0, false
+	}
+	// Despite its name, out_time_ms is in microseconds too.
+	us, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || us < 0 {
+		return 0, false
+	}
+	p := float64(time.Duration(us)*time.Microsecond) / float64(total)
+	if p > 0.99 {
+		p = 0.99 // 1 is reserved for a finished job
+	}
+	return p, true
+}
+
+// tailBuffer keeps the last few hundred bytes written to it, enough for
+// ffmpeg's final error message.
+type tailBuffer struct {
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > 512 {
+		b.buf = b.buf[len(b.buf)-512:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return strings.TrimSpace(string(b.buf))
+}
@@ -0,0 +1,119 @@
+package media
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTools installs stand-ins for ffprobe, which reports a 10 second
+// video, and ffmpeg, which reports progress and writes its output file.
+// Inputs containing "broken" make ffmpeg fail.
+func fakeTools(t *testing.T, tr *Transcoder) {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, script string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tr.ffprobe = write("ffprobe", "echo 10.0\n")
+	tr.ffmpeg = write("ffmpeg", `for last; do :; done
+if grep -q broken "$5"; then echo "Invalid data found" >&2; exit 1; fi
+echo out_time_us=5000000
+echo progress=continue
+echo video > "$last"
+echo progress=end
+`)
+}
+
+func wait(t *testing.T, tr *Transcoder, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := tr.Get(id)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if j.Status == StatusDone || j.Status == StatusFailed {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestTranscoder(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTranscoder(dir)
+	if err != nil {
+		t.Fatalf("NewTranscoder: %v", err)
+	}
+	fakeTools(t, tr)
+
+	if _, err := tr.Submit("clip.mov", "4k", strings.NewReader("x")); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+
+	job, err := tr.Submit("../clip.mov", "", strings.NewReader("movie"))
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	if job.Name != "clip.mov" || job.Profile != DefaultProfile || job.InputSize != 5 {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	job = wait(t, tr, job.ID)
+	if job.Status != StatusDone || job.Progress != 1 || job.OutputSize == 0 {
+		t.Fatalf("expected a finished job, got %+v", job)
+	}
+	if _, err := os.Stat(tr.inputPath(job.ID)); !os.IsNotExist(err) {
+		t.Error("expected the upload to be removed after transcoding")
+	}
+
+	bad, _ := tr.Submit("bad.mov", "720p", strings.NewReader("broken"))
+	bad = wait(t, tr, bad.ID)
+	if bad.Status != StatusFailed || !strings.Contains(bad.Error, "Invalid data found") {
+		t.Errorf("expected ffmpeg's error, got %+v", bad)
+	}
+
+	// Jobs survive a restart.
+	reopened, err := NewTranscoder(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if jobs := reopened.List(); len(jobs) != 2 {
+		t.Errorf("expected 2 jobs after reopening, got %d", len(jobs))
+	}
+
+	if err := tr.Delete(job.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := os.Stat(tr.OutputPath(job.ID)); !os.IsNotExist(err) {
+		t.Error("expected the output to be removed")
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	tests := []struct {
+		line string
+		want float64
+		ok   bool
+	}{
+		{"out_time_us=2500000", 0.25, true},
+		{"out_time_ms=5000000", 0.5, true},
+		{"out_time_us=12000000", 0.99, true},
+		{"out_time_us=N/A", 0, false},
+		{"frame=120", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseProgress(tt.line, 10*time.Second)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: got %v %v", tt.line, got, ok)
+		}
+	}
+}
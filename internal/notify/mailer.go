@@ -0,0 +1,180 @@
+// Package notify delivers outbound notifications (email, webhooks and MQTT)
+// for alerts and scheduled reports. Channel settings are stored in the host
+// database so every feature that notifies shares one configuration.
+package notify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SMTPSettingKey is the settings key holding the SMTPConfig.
+const SMTPSettingKey = "smtp"
+
+// SMTPConfig describes the outbound mail server. STARTTLS is used
+// automatically when the server advertises it.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+}
+
+// Configured reports whether enough settings exist to send mail.
+func (c SMTPConfig) Configured() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Masked returns a copy safe to return from the API.
+func (c SMTPConfig) Masked() SMTPConfig {
+	if c.Password != "" {
+		c.Password = "********"
+	}
+	return c
+}
+
+// LoadSMTP reads the SMTP settings from the store. Missing settings yield a
+// zero config with the default submission port.
+func LoadSMTP(store hosts.SettingStore) (SMTPConfig, error) {
+	cfg := SMTPConfig{Port: 587}
+	if _, err := store.GetSetting(SMTPSettingKey, &cfg); err != nil {
+		return SMTPConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is an email to send.
+type Message struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Mailer sends email through an SMTP server.
+type Mailer struct {
+	cfg SMTPConfig
+}
+
+// NewMailer creates a mailer for the given settings.
+func NewMailer(cfg SMTPConfig) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Send delivers msg to all recipients.
+func (m *Mailer) Send(msg Message) error {
+	if !m.cfg.Configured() {
+		return errors.New("SMTP is not configured")
+	}
+	if len(msg.To) == 0 {
+		return errors.New("no recipients")
+	}
+
+	body, err := buildMessage(m.cfg.From, msg)
+	if err != nil {
+		return err
+	}
+
+	port := m.cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	if err := smtp.SendMail(addr, auth, m.cfg.From, msg.To, body); err != nil {
+		return fmt.Errorf("send mail via %s: %w", addr, err)
+	}
+	return nil
+}
+
+// buildMessage renders a MIME message. Plain messages are sent as a single
+// text part; attachments switch to multipart/mixed.
+func buildMessage(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(msg.Attachments) == 0 {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		buf.WriteString(msg.Body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"text/plain; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(msg.Body))
+
+	for _, a := range msg.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64Lines(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64Lines encodes data as base64 wrapped at 76 characters per line
+// as required by RFC 2045.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := w.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := w.Write([]byte(encoded + "\r\n"))
+	return err
+}
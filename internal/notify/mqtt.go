@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// MQTTSettingKey is the settings key holding the MQTTConfig.
+const MQTTSettingKey = "mqtt"
+
+// MQTTConfig describes the broker that receives notifications. Messages are
+// published at QoS 0 over plain TCP, one connection per message.
+type MQTTConfig struct {
+	Broker   string `json:"broker"` // host:port, port 1883 if omitted
+	Topic    string `json:"topic"`  // Prefix; alerts publish below it
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Configured reports whether enough settings exist to publish.
+func (c MQTTConfig) Configured() bool {
+	return c.Broker != "" && c.Topic != ""
+}
+
+// Masked returns a copy safe to return from the API.
+func (c MQTTConfig) Masked() MQTTConfig {
+	if c.Password != "" {
+		c.Password = "********"
+	}
+	return c
+}
+
+// LoadMQTT reads the MQTT settings from the store.
+func LoadMQTT(store hosts.SettingStore) (MQTTConfig, error) {
+	cfg := MQTTConfig{Topic: "nsm"}
+	if _, err := store.GetSetting(MQTTSettingKey, &cfg); err != nil {
+		return MQTTConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Publish sends payload to topic using MQTT 3.1.1.
+func Publish(cfg MQTTConfig, topic string, payload []byte) error {
+	if !cfg.Configured() {
+		return errors.New("MQTT is not configured")
+	}
+	conn, err := mqttConnect(cfg, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := conn.Write(mqttPacket(0x30, append(mqttString(topic), payload...))); err != nil {
+		return fmt.Errorf("publish to MQTT: %w", err)
+	}
+	conn.Write(mqttPacket(0xE0, nil))
+	return nil
+}
+
+// mqttConnect opens a connection to the broker and completes the CONNECT
+// handshake, registering will when it is not nil.
+func mqttConnect(cfg MQTTConfig, will *MQTTWill) (net.Conn, error) {
+	addr := cfg.Broker
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "1883")
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("connect to MQTT broker %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("nsm-%d", time.Now().UnixNano())
+	}
+
+	// CONNECT with a clean session and a 60 second keep-alive.
+	var flags byte = 0x02
+	connect := mqttString("MQTT")
+	payloadFields := mqttString(clientID)
+	if will != nil {
+		flags |= 0x04
+		if will.Retain {
+			flags |= 0x20
+		}
+		payloadFields = append(payloadFields, mqttString(will.Topic)...)
+		payloadFields = append(payloadFields, mqttString(string(will.Payload))...)
+	}
+	if cfg.Username != "" {
+		flags |= 0x80
+		payloadFields = append(payloadFields, mqttString(cfg.Username)...)
+		if cfg.Password != "" {
+			flags |= 0x40
+			payloadFields = append(payloadFields, mqttString(cfg.Password)...)
+		}
+	}
+	connect = append(connect, 4, flags, 0, byte(mqttKeepAlive/time.Second))
+	connect = append(connect, payloadFields...)
+	if _, err := conn.Write(mqttPacket(0x10, connect)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("send MQTT connect: %w", err)
+	}
+
+	ack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, ack); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read MQTT connack: %w", err)
+	}
+	if ack[0] != 0x20 || ack[1] != 2 {
+		conn.Close()
+		return nil, errors.New("unexpected reply from MQTT broker")
+	}
+	if ack[3] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("MQTT broker refused connection (code %d)", ack[3])
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// mqttPacket prefixes body with a fixed header and its variable-length
+// remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	pkt := []byte{header}
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		pkt = append(pkt, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(pkt, body...)
+}
+
+// mqttString encodes s with its two-byte length prefix.
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
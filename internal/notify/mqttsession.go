@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// mqttKeepAlive is the keep-alive announced in CONNECT. Sessions ping the
+// broker when they have heard nothing for half of it.
+const mqttKeepAlive = 60 * time.Second
+
+// MQTTWill is the message the broker publishes for a session that goes
+// away without disconnecting.
+type MQTTWill struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// MQTTSession is a long-lived MQTT 3.1.1 connection, for components that
+// subscribe as well as publish. Messages go both ways at QoS 0.
+type MQTTSession struct {
+	conn   net.Conn
+	mu     sync.Mutex // Serializes writes
+	nextID uint16
+}
+
+// DialMQTT connects to the broker in cfg. will, if not nil, is published
+// by the broker should the connection drop.
+func DialMQTT(cfg MQTTConfig, will *MQTTWill) (*MQTTSession, error) {
+	if !cfg.Configured() {
+		return nil, errors.New("MQTT is not configured")
+	}
+	conn, err := mqttConnect(cfg, will)
+	if err != nil {
+		return nil, err
+	}
+	return &MQTTSession{conn: conn}, nil
+}
+
+// Publish sends payload to topic, asking the broker to keep it for new
+// subscribers when retain is set.
+func (s *MQTTSession) Publish(topic string, payload []byte, retain bool) error {
+	var header byte = 0x30
+	if retain {
+		header |= 0x01
+	}
+	if err := s.write(mqttPacket(header, append(mqttString(topic), payload...))); err != nil {
+		return fmt.Errorf("publish to MQTT: %w", err)
+	}
+	return nil
+}
+
+// Subscribe asks for messages on filters, which may hold + and #
+// wildcards. Messages arrive through Receive.
+func (s *MQTTSession) Subscribe(filters ...string) error {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.mu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, f := range filters {
+		body = append(append(body, mqttString(f)...), 0) // QoS 0
+	}
+	if err := s.write(mqttPacket(0x82, body)); err != nil {
+		return fmt.Errorf("subscribe to MQTT: %w", err)
+	}
+	return nil
+}
+
+// Receive calls handle for each message arriving on a subscription, until
+// the connection fails or is closed. It also keeps the connection alive.
+func (s *MQTTSession) Receive(handle func(topic string, payload []byte)) error {
+	r := bufio.NewReader(s.conn)
+	pinged := false
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive / 2))
+		header, body, err := readMQTTPacket(r)
+		var timeout net.Error
+		if errors.As(err, &timeout) && timeout.Timeout() {
+			if pinged {
+				return errors.New("MQTT broker stopped answering")
+			}
+			if err := s.write([]byte{0xC0, 0}); err != nil {
+				return err
+			}
+			pinged = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pinged = false
+
+		if header>>4 != 3 { // Only PUBLISH needs handling; SUBACK and PINGRESP need none
+			continue
+		}
+		if len(body) < 2 {
+			return errors.New("malformed MQTT publish")
+		}
+		n := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+n {
+			return errors.New("malformed MQTT publish")
+		}
+		topic, payload := string(body[2:2+n]), body[2+n:]
+		if qos := header >> 1 & 3; qos > 0 {
+			// Brokers downgrade to the subscription's QoS 0, but answer
+			// anything else so the broker does not resend it.
+			if len(payload) < 2 {
+				return errors.New("malformed MQTT publish")
+			}
+			ack := byte(0x40)
+			if qos == 2 {
+				ack = 0x50
+			}
+			if err := s.write(mqttPacket(ack, payload[:2])); err != nil {
+				return err
+			}
+			payload = payload[2:]
+		}
+		handle(topic, payload)
+	}
+}
+
+// Close disconnects cleanly, so the broker does not publish the will.
+func (s *MQTTSession) Close() error {
+	s.write(mqttPacket(0xE0, nil))
+	return s.conn.Close()
+}
+
+func (s *MQTTSession) write(pkt []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := s.conn.Write(pkt)
+	return err
+}
+
+// readMQTTPacket reads one packet, returning its fixed header byte and
+// what follows the remaining length.
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
@@ -0,0 +1,213 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostWebhook(t *testing.T) {
+	var body []byte
+	var sig string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		sig = r.Header.Get(SignatureHeader)
+	}))
+	defer srv.Close()
+
+	if err := PostWebhook(WebhookConfig{URL: srv.URL, Secret: "s3cret"}, map[string]string{"status": "firing"}); err != nil {
+		t.Fatalf("PostWebhook: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if want := hex.EncodeToString(mac.Sum(nil)); sig != want {
+		t.Errorf("signature %q does not match body %s", sig, body)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 512)
+		n, _ := conn.Read(buf)
+		if n == 0 || buf[0] != 0x10 {
+			return
+		}
+		conn.Write([]byte{0x20, 2, 0, 0})
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	cfg := MQTTConfig{Broker: ln.Addr().String(), Topic: "nsm", Username: "nsm", Password: "pw"}
+	if err := Publish(cfg, "nsm/alerts/a", []byte(`{"status":"firing"}`)); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	want := append(mqttPacket(0x30, append(mqttString("nsm/alerts/a"), `{"status":"firing"}`...)), 0xE0, 0)
+	if got := <-received; !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+func TestMQTTSession(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	type packet struct {
+		header byte
+		body   []byte
+	}
+	received := make(chan packet, 8)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			header, body, err := readMQTTPacket(r)
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- packet{header, body}
+			switch header {
+			case 0x10:
+				conn.Write([]byte{0x20, 2, 0, 0})
+			case 0x82:
+				conn.Write(mqttPacket(0x90, append(body[:2:2], 0)))
+				// A QoS 1 message on the subscription, which needs an ack.
+				conn.Write(mqttPacket(0x32, append(append(mqttString("nsm/ha/a/power/set"), 0, 7), "ON"...)))
+			}
+		}
+	}()
+
+	cfg := MQTTConfig{Broker: ln.Addr().String(), Topic: "nsm"}
+	s, err := DialMQTT(cfg, &MQTTWill{Topic: "nsm/ha/status", Payload: []byte("offline"), Retain: true})
+	if err != nil {
+		t.Fatalf("DialMQTT: %v", err)
+	}
+	if p := <-received; p.body[7]&0x24 != 0x24 || !bytes.Contains(p.body, []byte("nsm/ha/status")) {
+		t.Errorf("expected a retained will in CONNECT, got %x", p.body)
+	}
+
+	if err := s.Subscribe("nsm/ha/+/power/set"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	messages := make(chan string, 1)
+	go s.Receive(func(topic string, payload []byte) { messages <- topic + " " + string(payload) })
+	if got := <-messages; got != "nsm/ha/a/power/set ON" {
+		t.Errorf("got message %q", got)
+	}
+
+	if err := s.Publish("nsm/ha/a/power", []byte("ON"), true); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	s.Close()
+
+	var headers []byte
+	for p := range received {
+		headers = append(headers, p.header)
+	}
+	if want := []byte{0x82, 0x40, 0x31, 0xE0}; !bytes.Equal(headers, want) {
+		t.Errorf("got packets %x, want %x", headers, want)
+	}
+}
+
+func TestSendPagerDuty(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := PagerDutyConfig{RoutingKey: "R0UT1NG", URL: srv.URL}
+	if err := SendPagerDuty(cfg, PagerDutyEvent{Action: PagerDutyTrigger, DedupKey: "a1", Summary: "Lobby offline", Source: "lobby"}); err != nil {
+		t.Fatalf("SendPagerDuty: %v", err)
+	}
+	payload, _ := got["payload"].(map[string]any)
+	if got["routing_key"] != "R0UT1NG" || got["dedup_key"] != "a1" || payload["summary"] != "Lobby offline" {
+		t.Errorf("unexpected event: %v", got)
+	}
+
+	if err := SendPagerDuty(cfg, PagerDutyEvent{Action: PagerDutyResolve, DedupKey: "a1"}); err != nil {
+		t.Fatalf("SendPagerDuty resolve: %v", err)
+	}
+	if got["event_action"] != PagerDutyResolve || got["payload"] != nil {
+		t.Errorf("unexpected resolve event: %v", got)
+	}
+
+	// Hosts a service lists go to that service; others to the default.
+	cfg.Services = []PagerDutyService{{Name: "Lobby", Hosts: []string{"lobby"}, RoutingKey: "L0BBY"}}
+	SendPagerDuty(cfg, PagerDutyEvent{Action: PagerDutyTrigger, DedupKey: "a2", HostID: "lobby"})
+	if got["routing_key"] != "L0BBY" {
+		t.Errorf("expected the lobby service's key, got %v", got["routing_key"])
+	}
+	cfg.RoutingKey = ""
+	if err := SendPagerDuty(cfg, PagerDutyEvent{Action: PagerDutyTrigger, DedupKey: "a3", HostID: "hall"}); err == nil {
+		t.Error("expected an error for a host no service lists without a default key")
+	}
+
+	masked := cfg.Masked()
+	masked.Unmask(cfg)
+	if masked.Services[0].RoutingKey != "L0BBY" || cfg.Masked().Services[0].RoutingKey == "L0BBY" {
+		t.Errorf("masking did not round-trip: %+v", masked)
+	}
+}
+
+func TestOpsgenie(t *testing.T) {
+	type request struct {
+		path, auth string
+		body       map[string]any
+	}
+	var got []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		got = append(got, request{r.URL.RequestURI(), r.Header.Get("Authorization"), body})
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cfg := OpsgenieConfig{APIKey: "k3y", URL: srv.URL + "/", Team: "Signage", Teams: []OpsgenieTeam{{Team: "Retail", Hosts: []string{"shop"}}}}
+	if err := CreateOpsgenieAlert(cfg, OpsgenieAlert{Alias: "a1", HostID: "shop", Message: "Offline on Shop"}); err != nil {
+		t.Fatalf("CreateOpsgenieAlert: %v", err)
+	}
+	if err := CloseOpsgenieAlert(cfg, "a1"); err != nil {
+		t.Fatalf("CloseOpsgenieAlert: %v", err)
+	}
+	if len(got) != 2 || got[0].path != "/v2/alerts" || got[0].auth != "GenieKey k3y" || got[0].body["alias"] != "a1" {
+		t.Fatalf("unexpected requests: %+v", got)
+	}
+	if responders, _ := got[0].body["responders"].([]any); len(responders) != 1 || responders[0].(map[string]any)["name"] != "Retail" {
+		t.Errorf("expected the shop routed to Retail, got %v", got[0].body["responders"])
+	}
+	if got[1].path != "/v2/alerts/a1/close?identifierType=alias" {
+		t.Errorf("unexpected close request %s", got[1].path)
+	}
+}
@@ -0,0 +1,172 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// OpsgenieSettingKey is the settings key holding the OpsgenieConfig.
+const OpsgenieSettingKey = "opsgenie"
+
+// OpsgenieURL is the Opsgenie API of the US instance.
+const OpsgenieURL = "https://api.opsgenie.com"
+
+// Opsgenie limits on alert fields.
+const (
+	opsgenieMessageLen     = 130
+	opsgenieDescriptionLen = 15000
+)
+
+// OpsgenieConfig describes the Opsgenie account that receives alerts.
+type OpsgenieConfig struct {
+	APIKey string         `json:"api_key"`         // Key of an API integration
+	URL    string         `json:"url,omitempty"`   // Overrides OpsgenieURL, e.g. https://api.eu.opsgenie.com
+	Team   string         `json:"team,omitempty"`  // Responder team for hosts no entry in Teams lists; empty leaves it to the integration
+	Teams  []OpsgenieTeam `json:"teams,omitempty"` // Route some hosts' alerts to their own teams
+}
+
+// OpsgenieTeam sends the alerts of a group of hosts to one Opsgenie team.
+type OpsgenieTeam struct {
+	Team  string   `json:"team"`
+	Hosts []string `json:"hosts"` // Host IDs; fleet stands for script rules
+}
+
+// Configured reports whether an API key is set.
+func (c OpsgenieConfig) Configured() bool {
+	return c.APIKey != ""
+}
+
+// TeamFor returns the team of the first entry listing hostID, or the
+// default one.
+func (c OpsgenieConfig) TeamFor(hostID string) string {
+	for _, t := range c.Teams {
+		if slices.Contains(t.Hosts, hostID) {
+			return t.Team
+		}
+	}
+	return c.Team
+}
+
+// Masked returns a copy safe to return from the API.
+func (c OpsgenieConfig) Masked() OpsgenieConfig {
+	if c.APIKey != "" {
+		c.APIKey = mask
+	}
+	return c
+}
+
+// Validate normalises c and rejects incomplete team entries.
+func (c *OpsgenieConfig) Validate() error {
+	c.Team = strings.TrimSpace(c.Team)
+	for i := range c.Teams {
+		t := &c.Teams[i]
+		t.Team = strings.TrimSpace(t.Team)
+		if t.Team == "" {
+			return fmt.Errorf("team %d: a team name is required", i+1)
+		}
+		if len(t.Hosts) == 0 {
+			return fmt.Errorf("team %q: at least one host is required", t.Team)
+		}
+	}
+	return nil
+}
+
+// LoadOpsgenie reads the Opsgenie settings from the store.
+func LoadOpsgenie(store hosts.SettingStore) (OpsgenieConfig, error) {
+	var cfg OpsgenieConfig
+	if _, err := store.GetSetting(OpsgenieSettingKey, &cfg); err != nil {
+		return OpsgenieConfig{}, err
+	}
+	return cfg, nil
+}
+
+// OpsgenieAlert is an alert to open in Opsgenie.
+type OpsgenieAlert struct {
+	Alias       string // Identifies the alert; opening it again adds to its count, and closing uses it
+	HostID      string // Picks the team, see TeamFor
+	Message     string
+	Description string
+	Details     map[string]string
+}
+
+// CreateOpsgenieAlert opens a, for the team of its host.
+func CreateOpsgenieAlert(cfg OpsgenieConfig, a OpsgenieAlert) error {
+	if !cfg.Configured() {
+		return errors.New("Opsgenie is not configured")
+	}
+	payload := map[string]any{
+		"message":     truncate(a.Message, opsgenieMessageLen),
+		"alias":       a.Alias,
+		"description": truncate(a.Description, opsgenieDescriptionLen),
+		"source":      "NSM",
+		"details":     a.Details,
+	}
+	if team := cfg.TeamFor(a.HostID); team != "" {
+		payload["responders"] = []map[string]string{{"name": team, "type": "team"}}
+	}
+	return postJSON("Opsgenie", cfg.apiURL()+"/v2/alerts", cfg.authHeader(), payload)
+}
+
+// CloseOpsgenieAlert closes the alert opened with alias.
+func CloseOpsgenieAlert(cfg OpsgenieConfig, alias string) error {
+	if !cfg.Configured() {
+		return errors.New("Opsgenie is not configured")
+	}
+	u := cfg.apiURL() + "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+	return postJSON("Opsgenie", u, cfg.authHeader(), map[string]string{"source": "NSM"})
+}
+
+func (c OpsgenieConfig) apiURL() string {
+	if c.URL == "" {
+		return OpsgenieURL
+	}
+	return strings.TrimSuffix(c.URL, "/")
+}
+
+func (c OpsgenieConfig) authHeader() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + c.APIKey}
+}
+
+// postJSON posts payload to u with headers. Any 2xx response counts as
+// delivered; service names the receiver in errors.
+func postJSON(service, u string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s request: %w", service, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post to %s: %w", service, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %d", service, resp.StatusCode)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
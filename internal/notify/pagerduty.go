@@ -0,0 +1,157 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// PagerDutySettingKey is the settings key holding the PagerDutyConfig.
+const PagerDutySettingKey = "pagerduty"
+
+// PagerDutyEventsURL is the PagerDuty Events API v2 endpoint.
+const PagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDuty event actions.
+const (
+	PagerDutyTrigger = "trigger"
+	PagerDutyResolve = "resolve"
+)
+
+// mask replaces secrets in configs returned from the API.
+const mask = "********"
+
+// PagerDutyConfig describes the PagerDuty services that receive incidents.
+type PagerDutyConfig struct {
+	RoutingKey string             `json:"routing_key"`        // Integration key of an Events API v2 integration, for hosts no service lists
+	URL        string             `json:"url,omitempty"`      // Overrides PagerDutyEventsURL, e.g. for a proxy
+	Services   []PagerDutyService `json:"services,omitempty"` // Route some hosts' incidents to their own services
+}
+
+// PagerDutyService sends the incidents of a group of hosts to one
+// PagerDuty service.
+type PagerDutyService struct {
+	Name       string   `json:"name"`
+	Hosts      []string `json:"hosts"` // Host IDs; fleet stands for script rules
+	RoutingKey string   `json:"routing_key"`
+}
+
+// Configured reports whether any routing key is set.
+func (c PagerDutyConfig) Configured() bool {
+	return c.RoutingKey != "" || len(c.Services) > 0
+}
+
+// RoutingKeyFor returns the routing key of the first service listing
+// hostID, or the default one.
+func (c PagerDutyConfig) RoutingKeyFor(hostID string) string {
+	for _, svc := range c.Services {
+		if slices.Contains(svc.Hosts, hostID) {
+			return svc.RoutingKey
+		}
+	}
+	return c.RoutingKey
+}
+
+// Masked returns a copy safe to return from the API.
+func (c PagerDutyConfig) Masked() PagerDutyConfig {
+	if c.RoutingKey != "" {
+		c.RoutingKey = mask
+	}
+	c.Services = slices.Clone(c.Services)
+	for i := range c.Services {
+		c.Services[i].RoutingKey = mask
+	}
+	return c
+}
+
+// Unmask puts back the keys of current that c, posted by a client that
+// echoed back the mask, leaves masked or empty. Services are matched by
+// name.
+func (c *PagerDutyConfig) Unmask(current PagerDutyConfig) {
+	if c.RoutingKey == mask {
+		c.RoutingKey = current.RoutingKey
+	}
+	for i := range c.Services {
+		svc := &c.Services[i]
+		if svc.RoutingKey != mask && svc.RoutingKey != "" {
+			continue
+		}
+		svc.RoutingKey = ""
+		for _, old := range current.Services {
+			if old.Name == svc.Name {
+				svc.RoutingKey = old.RoutingKey
+			}
+		}
+	}
+}
+
+// Validate normalises c and rejects incomplete services.
+func (c *PagerDutyConfig) Validate() error {
+	for i := range c.Services {
+		svc := &c.Services[i]
+		svc.Name = strings.TrimSpace(svc.Name)
+		switch {
+		case svc.Name == "":
+			return fmt.Errorf("service %d: a name is required", i+1)
+		case len(svc.Hosts) == 0:
+			return fmt.Errorf("service %q: at least one host is required", svc.Name)
+		case svc.RoutingKey == "":
+			return fmt.Errorf("service %q: a routing key is required", svc.Name)
+		}
+	}
+	return nil
+}
+
+// LoadPagerDuty reads the PagerDuty settings from the store.
+func LoadPagerDuty(store hosts.SettingStore) (PagerDutyConfig, error) {
+	var cfg PagerDutyConfig
+	if _, err := store.GetSetting(PagerDutySettingKey, &cfg); err != nil {
+		return PagerDutyConfig{}, err
+	}
+	return cfg, nil
+}
+
+// PagerDutyEvent opens or resolves an incident. Events with the same
+// DedupKey belong to the same incident.
+type PagerDutyEvent struct {
+	Action   string // PagerDutyTrigger or PagerDutyResolve
+	DedupKey string
+	HostID   string // Picks the service, see RoutingKeyFor
+	Summary  string
+	Source   string // The affected host
+	Details  any    // Shown with the incident
+}
+
+// SendPagerDuty posts ev to the Events API, for the service of its host.
+// Any 2xx response counts as delivered.
+func SendPagerDuty(cfg PagerDutyConfig, ev PagerDutyEvent) error {
+	if !cfg.Configured() {
+		return errors.New("PagerDuty is not configured")
+	}
+	key := cfg.RoutingKeyFor(ev.HostID)
+	if key == "" {
+		return fmt.Errorf("no PagerDuty service for host %s and no default routing key", ev.HostID)
+	}
+	url := cfg.URL
+	if url == "" {
+		url = PagerDutyEventsURL
+	}
+
+	payload := map[string]any{
+		"routing_key":  key,
+		"event_action": ev.Action,
+		"dedup_key":    ev.DedupKey,
+	}
+	if ev.Action == PagerDutyTrigger {
+		payload["payload"] = map[string]any{
+			"summary":        ev.Summary,
+			"source":         ev.Source,
+			"severity":       "critical",
+			"custom_details": ev.Details,
+		}
+	}
+	return postJSON("PagerDuty", url, nil, payload)
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// WebhookSettingKey is the settings key holding the WebhookConfig.
+const WebhookSettingKey = "webhook"
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body when a
+// webhook secret is set.
+const SignatureHeader = "X-NSM-Signature"
+
+// WebhookConfig describes an HTTP endpoint that receives JSON notifications.
+type WebhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// Configured reports whether a webhook URL is set.
+func (c WebhookConfig) Configured() bool {
+	return c.URL != ""
+}
+
+// Masked returns a copy safe to return from the API.
+func (c WebhookConfig) Masked() WebhookConfig {
+	if c.Secret != "" {
+		c.Secret = "********"
+	}
+	return c
+}
+
+// LoadWebhook reads the webhook settings from the store.
+func LoadWebhook(store hosts.SettingStore) (WebhookConfig, error) {
+	var cfg WebhookConfig
+	if _, err := store.GetSetting(WebhookSettingKey, &cfg); err != nil {
+		return WebhookConfig{}, err
+	}
+	return cfg, nil
+}
+
+// PostWebhook sends payload to the webhook as JSON. Any 2xx response counts
+// as delivered.
+func PostWebhook(cfg WebhookConfig, payload any) error {
+	if !cfg.Configured() {
+		return errors.New("webhook is not configured")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
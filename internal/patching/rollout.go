@@ -0,0 +1,326 @@
+// Package patching rolls OS updates out across the fleet in stages. A
+// rollout upgrades a few hosts at a time, each inside its maintenance
+// window on its own clock, and stops at the first host whose upgrade
+// fails so a bad update does not reach the rest of the fleet.
+package patching
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// SettingKey holds the current or last rollout.
+const SettingKey = "patching.rollout"
+
+// Rollout states.
+const (
+	RolloutRunning   = "running"
+	RolloutDone      = "done"
+	RolloutHalted    = "halted" // A host's upgrade failed; the hosts after it were left alone
+	RolloutCancelled = "cancelled"
+)
+
+// Host step states.
+const (
+	StepPending   = "pending"
+	StepUpgrading = "upgrading"
+	StepDone      = "done"
+	StepFailed    = "failed"
+)
+
+// StepTimeout is how long a host may take to report the outcome of its
+// upgrade, reboot included, before the rollout counts it as failed.
+const StepTimeout = 2 * time.Hour
+
+// clockSlack allows for a host's clock being behind the scheduler's when
+// matching the upgrade it reports to the one the rollout started.
+const clockSlack = 5 * time.Minute
+
+// ErrRolloutRunning is returned when starting a rollout while another is
+// still running.
+var ErrRolloutRunning = errors.New("a rollout is already running; cancel it first")
+
+// Step is one host's progress in a rollout.
+type Step struct {
+	HostID     string    `json:"host_id"`
+	State      string    `json:"state"` // StepPending ...
+	StartedAt  time.Time `json:"started_at,omitzero"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Error      string    `json:"error,omitempty"` // Why the upgrade failed, or why the host could not be reached yet
+}
+
+// Rollout upgrades a list of hosts in batches.
+type Rollout struct {
+	BatchSize  int       `json:"batch_size"`            // Hosts upgraded at once
+	WindowFrom int       `json:"window_from,omitempty"` // Hour upgrades may start, on each host's clock
+	WindowTo   int       `json:"window_to,omitempty"`   // Hour they stop starting; equal to WindowFrom means any time
+	Reboot     bool      `json:"reboot,omitempty"`      // Reboot hosts whose updates need it
+	State      string    `json:"state"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	FinishedAt time.Time `json:"finished_at,omitzero"`
+	Steps      []Step    `json:"steps"` // In the order hosts are upgraded
+}
+
+// Validate normalizes r and checks its settings.
+func (r *Rollout) Validate() error {
+	if r.BatchSize == 0 {
+		r.BatchSize = 1
+	}
+	if r.BatchSize < 0 {
+		return errors.New("batch_size must be positive")
+	}
+	if r.WindowFrom < 0 || r.WindowFrom > 23 || r.WindowTo < 0 || r.WindowTo > 23 {
+		return errors.New("window_from and window_to must be hours between 0 and 23")
+	}
+	if len(r.Steps) == 0 {
+		return errors.New("no hosts to upgrade")
+	}
+	return nil
+}
+
+// InWindow reports whether t, on a host's clock, is inside the
+// maintenance window. A window may wrap past midnight.
+func (r Rollout) InWindow(t time.Time) bool {
+	h := t.Hour()
+	switch {
+	case r.WindowFrom == r.WindowTo:
+		return true
+	case r.WindowFrom < r.WindowTo:
+		return h >= r.WindowFrom && h < r.WindowTo
+	default:
+		return h >= r.WindowFrom || h < r.WindowTo
+	}
+}
+
+// Load returns the current or last rollout, or nil if there has been none.
+func Load(store hosts.SettingStore) (*Rollout, error) {
+	var r Rollout
+	ok, err := store.GetSetting(SettingKey, &r)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Start validates r and makes it the current rollout of hostIDs, in that
+// order.
+func Start(store *hosts.Store, r Rollout, hostIDs []string, now time.Time) (Rollout, error) {
+	if cur, err := Load(store); err != nil {
+		return Rollout{}, err
+	} else if cur != nil && cur.State == RolloutRunning {
+		return Rollout{}, ErrRolloutRunning
+	}
+
+	r.Steps = []Step{}
+	seen := make(map[string]bool)
+	for _, id := range hostIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, err := store.GetByID(id); err != nil {
+			return Rollout{}, fmt.Errorf("unknown host %q", id)
+		}
+		r.Steps = append(r.Steps, Step{HostID: id, State: StepPending})
+	}
+	if err := r.Validate(); err != nil {
+		return Rollout{}, err
+	}
+	r.State = RolloutRunning
+	r.CreatedAt = now.UTC()
+	r.FinishedAt = time.Time{}
+	return r, store.PutSetting(SettingKey, r)
+}
+
+// Cancel stops the running rollout. Upgrades already started run to the
+// end on their hosts.
+func Cancel(store hosts.SettingStore, now time.Time) (Rollout, error) {
+	r, err := Load(store)
+	if err != nil {
+		return Rollout{}, err
+	}
+	if r == nil || r.State != RolloutRunning {
+		return Rollout{}, errors.New("no rollout is running")
+	}
+	r.State = RolloutCancelled
+	r.FinishedAt = now.UTC()
+	return *r, store.PutSetting(SettingKey, r)
+}
+
+// Scheduler advances the running rollout.
+type Scheduler struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+	trigger  func(h types.Host, reboot bool) error // Starts the upgrade on a host
+}
+
+// NewScheduler creates a scheduler that checks the rollout every minute
+// and starts upgrades by posting to each host's /api/hosts/upgrade, signed
+// by signer.
+func NewScheduler(store *hosts.Store, lg *logger.Logger, signer *peerauth.Signer) *Scheduler {
+	trigger := func(h types.Host, reboot bool) error { return postUpgrade(h, reboot, signer) }
+	return &Scheduler{store: store, logger: lg, interval: time.Minute, trigger: trigger}
+}
+
+// Run checks the rollout until the process exits.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		s.Check(time.Now())
+	}
+}
+
+// Check records the outcome of upgrades in progress from the hosts'
+// heartbeats, then starts the next batch once the last one has finished.
+func (s *Scheduler) Check(now time.Time) {
+	r, err := Load(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Patching: failed to load rollout: %v", err))
+		return
+	}
+	if r == nil || r.State != RolloutRunning {
+		return
+	}
+	status, err := s.store.ListPatchStatus()
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Patching: failed to load patch status: %v", err))
+		return
+	}
+
+	upgrading := 0
+	for i := range r.Steps {
+		step := &r.Steps[i]
+		if step.State != StepUpgrading {
+			continue
+		}
+		s.settle(r, step, status[step.HostID], now)
+		if step.State == StepUpgrading {
+			upgrading++
+		}
+	}
+
+	if r.State == RolloutRunning && upgrading == 0 {
+		s.startBatch(r, now)
+	}
+
+	remaining, done := 0, 0
+	for _, step := range r.Steps {
+		switch step.State {
+		case StepPending, StepUpgrading:
+			remaining++
+		case StepDone:
+			done++
+		}
+	}
+	if r.State == RolloutRunning && remaining == 0 {
+		r.State = RolloutDone
+		r.FinishedAt = now.UTC()
+		s.logger.Info(fmt.Sprintf("Patching: rollout finished, %d of %d hosts upgraded", done, len(r.Steps)))
+	}
+	if err := s.store.PutSetting(SettingKey, r); err != nil {
+		s.logger.Warning(fmt.Sprintf("Patching: failed to save rollout: %v", err))
+	}
+}
+
+// settle marks step done or failed once its host reports the upgrade the
+// rollout started, halting r on failure.
+func (s *Scheduler) settle(r *Rollout, step *Step, p hosts.PatchStatus, now time.Time) {
+	run := p.Upgrade
+	ours := run != nil && !run.StartedAt.Before(step.StartedAt.Add(-clockSlack))
+	switch {
+	case ours && run.State == hosts.UpgradeFailed:
+		step.Error = run.Error
+	case ours && run.State == hosts.UpgradeSucceeded && !(r.Reboot && p.RebootRequired):
+		step.State = StepDone
+		step.FinishedAt = now.UTC()
+		step.Error = ""
+		return
+	case now.Sub(step.StartedAt) >= StepTimeout:
+		step.Error = fmt.Sprintf("no result after %s", StepTimeout)
+	default:
+		return
+	}
+	step.State = StepFailed
+	step.FinishedAt = now.UTC()
+	r.State = RolloutHalted
+	r.FinishedAt = now.UTC()
+	s.logger.Error(fmt.Sprintf("Patching: upgrade of %s failed, rollout halted: %s", step.HostID, step.Error))
+}
+
+// startBatch starts upgrades on up to BatchSize pending hosts whose
+// window is open. Hosts that cannot be reached stay pending and are tried
+// again on the next check.
+func (s *Scheduler) startBatch(r *Rollout, now time.Time) {
+	started := 0
+	for i := range r.Steps {
+		step := &r.Steps[i]
+		if started == r.BatchSize {
+			return
+		}
+		if step.State != StepPending {
+			continue
+		}
+		h, err := s.store.GetByID(step.HostID)
+		if err != nil {
+			step.State = StepFailed
+			step.Error = "host was removed from the list"
+			continue
+		}
+		if !r.InWindow(h.InZone(now)) {
+			continue
+		}
+		if err := s.trigger(*h, r.Reboot); err != nil {
+			if step.Error != err.Error() {
+				s.logger.Warning(fmt.Sprintf("Patching: failed to start upgrade of %s: %v", h.IPAddress, err))
+			}
+			step.Error = err.Error()
+			continue
+		}
+		s.logger.Info(fmt.Sprintf("Patching: started upgrade of %s", h.IPAddress))
+		step.State = StepUpgrading
+		step.StartedAt = now.UTC()
+		step.Error = ""
+		started++
+	}
+}
+
+// postUpgrade asks the node of h to upgrade itself. The request names no
+// target, so the node acts on itself.
+func postUpgrade(h types.Host, reboot bool, signer *peerauth.Signer) error {
+	url := fmt.Sprintf("http://%s:8080/api/hosts/upgrade", hosts.SelectPath(h).Address)
+	body, _ := json.Marshal(map[string]bool{"reboot": reboot})
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signer.Sign(req, body)
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("status %d %s", resp.StatusCode, strings.TrimSpace(e.Error))
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package patching
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newTestScheduler(t *testing.T, ids ...string) (*Scheduler, *hosts.Store, *[]string) {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for i, id := range ids {
+		store.Add(types.Host{ID: id, IPAddress: "192.168.1." + string(rune('1'+i))})
+	}
+
+	var triggered []string
+	s := NewScheduler(store, logger.New(10), nil)
+	s.trigger = func(h types.Host, reboot bool) error {
+		triggered = append(triggered, h.ID)
+		return nil
+	}
+	return s, store, &triggered
+}
+
+// report records the outcome of an upgrade as the host's heartbeat would.
+func report(store *hosts.Store, id, state string, started time.Time, rebootRequired bool) {
+	store.PutPatchStatus(id, hosts.PatchStatus{
+		RebootRequired: rebootRequired,
+		Upgrade:        &hosts.UpgradeRun{State: state, StartedAt: started, FinishedAt: started.Add(10 * time.Minute)},
+	}, started.Add(10*time.Minute))
+}
+
+func TestRolloutBatches(t *testing.T) {
+	s, store, triggered := newTestScheduler(t, "a", "b", "c")
+	now := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	if _, err := Start(store, Rollout{BatchSize: 2}, []string{"a", "b", "c"}, now); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := Start(store, Rollout{}, []string{"a"}, now); !errors.Is(err, ErrRolloutRunning) {
+		t.Errorf("expected ErrRolloutRunning, got %v", err)
+	}
+
+	s.Check(now)
+	if !slices.Equal(*triggered, []string{"a", "b"}) {
+		t.Fatalf("expected the first batch started, got %v", *triggered)
+	}
+
+	// The next batch waits for the whole first one.
+	report(store, "a", hosts.UpgradeSucceeded, now, false)
+	s.Check(now.Add(15 * time.Minute))
+	if len(*triggered) != 2 {
+		t.Fatalf("expected c to wait for b, got %v", *triggered)
+	}
+	report(store, "b", hosts.UpgradeSucceeded, now, false)
+	s.Check(now.Add(20 * time.Minute))
+	if !slices.Equal(*triggered, []string{"a", "b", "c"}) {
+		t.Fatalf("expected c started, got %v", *triggered)
+	}
+
+	report(store, "c", hosts.UpgradeSucceeded, now.Add(20*time.Minute), false)
+	s.Check(now.Add(40 * time.Minute))
+	r, _ := Load(store)
+	if r.State != RolloutDone || r.Steps[2].State != StepDone {
+		t.Errorf("expected the rollout done, got %+v", r)
+	}
+}
+
+func TestRolloutHaltsOnFailure(t *testing.T) {
+	s, store, triggered := newTestScheduler(t, "a", "b")
+	now := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	Start(store, Rollout{}, []string{"a", "b"}, now)
+
+	s.Check(now)
+	// An upgrade from before the rollout is not the one it started.
+	report(store, "a", hosts.UpgradeFailed, now.Add(-time.Hour), false)
+	s.Check(now.Add(time.Minute))
+	if r, _ := Load(store); r.State != RolloutRunning {
+		t.Fatalf("expected an old failure ignored, got %+v", r)
+	}
+
+	store.PutPatchStatus("a", hosts.PatchStatus{Upgrade: &hosts.UpgradeRun{State: hosts.UpgradeFailed, StartedAt: now, Error: "dpkg was interrupted"}}, now)
+	s.Check(now.Add(2 * time.Minute))
+	r, _ := Load(store)
+	if r.State != RolloutHalted || r.Steps[0].Error != "dpkg was interrupted" || r.Steps[1].State != StepPending {
+		t.Errorf("expected the rollout halted before b, got %+v", r)
+	}
+	s.Check(now.Add(3 * time.Minute))
+	if len(*triggered) != 1 {
+		t.Errorf("expected b left alone, got %v", *triggered)
+	}
+}
+
+func TestRolloutWaitsForRebootAndWindow(t *testing.T) {
+	s, store, triggered := newTestScheduler(t, "a")
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	Start(store, Rollout{WindowFrom: 22, WindowTo: 5, Reboot: true}, []string{"a"}, now)
+
+	s.Check(now)
+	if len(*triggered) != 0 {
+		t.Fatalf("expected nothing started outside the window, got %v", *triggered)
+	}
+
+	night := now.Add(11 * time.Hour)
+	s.Check(night)
+	if len(*triggered) != 1 {
+		t.Fatalf("expected a started at 23:00, got %v", *triggered)
+	}
+
+	// Upgraded but not yet rebooted.
+	report(store, "a", hosts.UpgradeSucceeded, night, true)
+	s.Check(night.Add(15 * time.Minute))
+	if r, _ := Load(store); r.Steps[0].State != StepUpgrading {
+		t.Fatalf("expected a to wait for its reboot, got %+v", r.Steps[0])
+	}
+	report(store, "a", hosts.UpgradeSucceeded, night, false)
+	s.Check(night.Add(20 * time.Minute))
+	if r, _ := Load(store); r.State != RolloutDone {
+		t.Errorf("expected the rollout done after the reboot, got %+v", r)
+	}
+}
+
+func TestRolloutTimeoutAndCancel(t *testing.T) {
+	s, store, _ := newTestScheduler(t, "a", "b")
+	now := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC)
+	Start(store, Rollout{}, []string{"a", "b"}, now)
+
+	s.Check(now)
+	s.Check(now.Add(StepTimeout))
+	r, _ := Load(store)
+	if r.State != RolloutHalted || r.Steps[0].State != StepFailed {
+		t.Fatalf("expected a silent host to halt the rollout, got %+v", r)
+	}
+	if _, err := Cancel(store, now); err == nil {
+		t.Error("expected no running rollout to cancel")
+	}
+
+	Start(store, Rollout{}, []string{"b"}, now)
+	if r, err := Cancel(store, now); err != nil || r.State != RolloutCancelled {
+		t.Errorf("Cancel: %+v, %v", r, err)
+	}
+}
+
+func TestRolloutValidate(t *testing.T) {
+	_, store, _ := newTestScheduler(t, "a")
+	now := time.Now()
+	if _, err := Start(store, Rollout{}, []string{"missing"}, now); err == nil {
+		t.Error("expected an unknown host rejected")
+	}
+	if _, err := Start(store, Rollout{WindowFrom: 24}, []string{"a"}, now); err == nil {
+		t.Error("expected an invalid window rejected")
+	}
+	if _, err := Start(store, Rollout{}, nil, now); err == nil {
+		t.Error("expected an empty rollout rejected")
+	}
+}
@@ -0,0 +1,164 @@
+// Package peerauth signs the requests nodes make of each other, such as
+// forwarded reboots, pushed host lists and edit locks, with the sending
+// node's key, and checks them against the key a heartbeat pinned for the
+// sender. Heartbeats pin a key on first use, so a key signs requests only
+// once an admin has confirmed it (see hosts.Store.TrustPeer). A signed
+// request is then admitted where an operator's would be, so actions
+// forwarded between nodes keep working once accounts are enforced.
+//
+// The signature covers the method, path and query, body, send time and a
+// nonce. Requests sent too far from the receiver's clock, and nonces seen
+// before, are refused, so a captured request cannot be replayed.
+package peerauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Header carries the signature of a request from a peer.
+const Header = "X-NSM-Peer"
+
+// MaxSkew is how far a request's send time may be from the receiver's
+// clock.
+const MaxSkew = 5 * time.Minute
+
+// MaxBody limits the body of a signed request, which the receiver reads
+// whole to check it.
+const MaxBody = 32 << 20
+
+var (
+	ErrMalformed     = errors.New("peer signature is malformed")
+	ErrBadSignature  = errors.New("peer signature is invalid")
+	ErrUnknownSender = errors.New("peer request from a node that has not sent a heartbeat")
+	ErrClockSkew     = errors.New("peer request send time is too far from this node's clock")
+	ErrReplayed      = errors.New("peer request was already received")
+	ErrUntrusted     = errors.New("peer key has not been confirmed by an admin")
+)
+
+// Signer signs requests as this node. A nil Signer, or one whose node ID
+// is not known yet, leaves requests unsigned.
+type Signer struct {
+	id     *identity.Identity
+	nodeID func() string
+}
+
+// NewSigner returns a signer using the node key id and the node ID that
+// nodeID returns when called.
+func NewSigner(id *identity.Identity, nodeID func() string) *Signer {
+	return &Signer{id: id, nodeID: nodeID}
+}
+
+// Value returns the Header value for a request of method to uri, the path
+// with any query, carrying body. It returns "" if s cannot sign.
+func (s *Signer) Value(method, uri string, body []byte) string {
+	if s == nil || s.id == nil {
+		return ""
+	}
+	node := s.nodeID()
+	if node == "" {
+		return ""
+	}
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+	sent := strconv.FormatInt(time.Now().Unix(), 10)
+	n := base64.RawURLEncoding.EncodeToString(nonce)
+	sig := s.id.Sign(message(method, uri, node, sent, n, body))
+	return fmt.Sprintf("node=%s,t=%s,n=%s,s=%s", node, sent, n, base64.RawURLEncoding.EncodeToString(sig))
+}
+
+// Sign signs req, whose body is body.
+func (s *Signer) Sign(req *http.Request, body []byte) {
+	if v := s.Value(req.Method, req.URL.RequestURI(), body); v != "" {
+		req.Header.Set(Header, v)
+	}
+}
+
+func message(method, uri, node, sent, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{"nsm-peer-v1", method, uri, node, sent, nonce, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// Verifier checks signed requests. It remembers the nonces of requests
+// within MaxSkew to refuse replays, and is safe for concurrent use.
+type Verifier struct {
+	store *hosts.Store
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewVerifier returns a verifier trusting the keys pinned in store.
+func NewVerifier(store *hosts.Store) *Verifier {
+	return &Verifier{store: store, seen: make(map[string]time.Time)}
+}
+
+// Verify checks the Header value of a request of method to uri carrying
+// body, and returns the peer that signed it.
+func (v *Verifier) Verify(value, method, uri string, body []byte, now time.Time) (hosts.Peer, error) {
+	fields := make(map[string]string, 4)
+	for _, part := range strings.Split(value, ",") {
+		k, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return hosts.Peer{}, ErrMalformed
+		}
+		fields[k] = val
+	}
+	node, sent, nonce := fields["node"], fields["t"], fields["n"]
+	sig, err := base64.RawURLEncoding.DecodeString(fields["s"])
+	if node == "" || nonce == "" || err != nil {
+		return hosts.Peer{}, ErrMalformed
+	}
+	unix, err := strconv.ParseInt(sent, 10, 64)
+	if err != nil {
+		return hosts.Peer{}, ErrMalformed
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > MaxSkew || skew < -MaxSkew {
+		return hosts.Peer{}, ErrClockSkew
+	}
+
+	peer, err := v.store.GetPeer(node)
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		return hosts.Peer{}, ErrUnknownSender
+	case err != nil:
+		return hosts.Peer{}, err
+	}
+	pub, err := base64.StdEncoding.DecodeString(peer.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return hosts.Peer{}, ErrUnknownSender
+	}
+	if !ed25519.Verify(pub, message(method, uri, node, sent, nonce, body), sig) {
+		return hosts.Peer{}, ErrBadSignature
+	}
+	if !peer.Trusted() {
+		return hosts.Peer{}, ErrUntrusted
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, at := range v.seen {
+		if now.Sub(at) > 2*MaxSkew {
+			delete(v.seen, k)
+		}
+	}
+	key := node + "/" + nonce
+	if _, ok := v.seen[key]; ok {
+		return hosts.Peer{}, ErrReplayed
+	}
+	v.seen[key] = now
+	return peer, nil
+}
@@ -0,0 +1,80 @@
+package peerauth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func TestVerify(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	id, _ := identity.Generate()
+	other, _ := identity.Generate()
+	store.PutPeer(hosts.Peer{NodeID: "node-a", PublicKey: base64.StdEncoding.EncodeToString(id.PublicKey())})
+
+	signer := NewSigner(id, func() string { return "node-a" })
+	verifier := NewVerifier(store)
+	now := time.Now()
+	body := []byte(`{"power": "off"}`)
+
+	// A key pinned by heartbeats alone signs nothing until an admin
+	// confirms it.
+	if _, err := verifier.Verify(signer.Value(http.MethodPost, "/api/hosts/display-power", body), http.MethodPost, "/api/hosts/display-power", body, now); !errors.Is(err, ErrUntrusted) {
+		t.Fatalf("expected an unconfirmed key refused, got %v", err)
+	}
+	if _, err := store.TrustPeer("node-a", identity.Fingerprint(id.PublicKey()), "admin", now); err != nil {
+		t.Fatalf("TrustPeer: %v", err)
+	}
+
+	value := signer.Value(http.MethodPost, "/api/hosts/display-power", body)
+	peer, err := verifier.Verify(value, http.MethodPost, "/api/hosts/display-power", body, now)
+	if err != nil || peer.NodeID != "node-a" {
+		t.Fatalf("Verify: %+v, %v", peer, err)
+	}
+	if _, err := verifier.Verify(value, http.MethodPost, "/api/hosts/display-power", body, now); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected a replay refused, got %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		value, uri string
+		body       []byte
+		now        time.Time
+		want       error
+	}{
+		"other body":  {signer.Value(http.MethodPost, "/api/hosts/reboot", body), "/api/hosts/reboot", []byte(`{"power": "on"}`), now, ErrBadSignature},
+		"other path":  {signer.Value(http.MethodPost, "/api/hosts/reboot", body), "/api/hosts/upgrade", body, now, ErrBadSignature},
+		"other key":   {NewSigner(other, func() string { return "node-a" }).Value(http.MethodPost, "/api/hosts/reboot", body), "/api/hosts/reboot", body, now, ErrBadSignature},
+		"not pinned":  {NewSigner(other, func() string { return "node-b" }).Value(http.MethodPost, "/api/hosts/reboot", body), "/api/hosts/reboot", body, now, ErrUnknownSender},
+		"stale":       {signer.Value(http.MethodPost, "/api/hosts/reboot", body), "/api/hosts/reboot", body, now.Add(MaxSkew + time.Minute), ErrClockSkew},
+		"malformed":   {"node-a", "/api/hosts/reboot", body, now, ErrMalformed},
+		"bad encoded": {strings.Replace(signer.Value(http.MethodPost, "/api/hosts/reboot", body), "s=", "s=!", 1), "/api/hosts/reboot", body, now, ErrMalformed},
+	} {
+		if _, err := verifier.Verify(tc.value, http.MethodPost, tc.uri, tc.body, tc.now); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
+
+func TestSignerWithoutIdentity(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/hosts/reboot", nil)
+	var signer *Signer
+	signer.Sign(req, nil)
+	id, _ := identity.Generate()
+	NewSigner(id, func() string { return "" }).Sign(req, nil)
+	if req.Header.Get(Header) != "" {
+		t.Errorf("expected no signature without a key and node ID, got %q", req.Header.Get(Header))
+	}
+}
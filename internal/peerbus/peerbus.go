@@ -0,0 +1,227 @@
+// Package peerbus carries the requests nodes post to each other, such as
+// announcements, lock events, heartbeats and forwarded logs, over one
+// WebSocket per peer instead of an HTTP request each. Requests on a
+// connection are numbered and handled in order, one at a time, and the
+// peer answers each with the status the HTTP endpoint gave. A sender that
+// reconnects resends the requests still waiting for an answer, and the
+// peer answers those it already handled without handling them again.
+//
+// The peer handles each request as if it had been posted directly, with
+// the same authentication, so the bus grants nothing plain HTTP does not.
+// Requests carry the sender's signature, as they would over HTTP.
+// Peers without the bus, running older versions, are posted to over HTTP.
+package peerbus
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/requestid"
+	"nexsign.mini/nsm/internal/tracing"
+)
+
+// Path is the WebSocket endpoint peers connect to.
+const Path = "/api/peers/bus"
+
+// Connection timing: senders ping an idle connection every PingInterval,
+// and a peer closes a connection silent for twice that.
+const (
+	PingInterval = 30 * time.Second
+	idleTimeout  = 2 * PingInterval
+)
+
+// maxBody limits the body of a request on the bus, as the endpoints it
+// reaches limit theirs.
+const maxBody = 1 << 20
+
+// Frame is one message on the bus: a request, or the reply to the
+// request with the same Seq.
+type Frame struct {
+	Seq    uint64 `json:"seq"`
+	Path   string `json:"path,omitempty"` // Request: the endpoint posted to, with any query
+	Body   []byte `json:"body,omitempty"`
+	Reply  bool   `json:"reply,omitempty"`
+	Status int    `json:"status,omitempty"` // Reply: the HTTP status the endpoint answered with
+	Trace  string `json:"trace,omitempty"`  // Request: the sender's traceparent, if it traces
+
+	RequestID string `json:"request_id,omitempty"` // Request: the ID of the API request it was sent for
+	Peer      string `json:"peer,omitempty"`       // Request: the sender's signature, see peerauth
+}
+
+// replayWindow is how many replies a peer keeps per sender, to answer
+// requests resent after a reconnect.
+const replayWindow = 256
+
+// sessionTTL is how long a peer remembers a sender that has gone away.
+const sessionTTL = time.Hour
+
+// Server answers bus connections, handing each request to handler.
+type Server struct {
+	handler  http.Handler
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is what a peer remembers of one sender across its connections.
+type session struct {
+	mu      sync.Mutex
+	last    uint64           // Highest request handled
+	replies map[uint64]Frame // Recent replies, for resent requests
+	seen    time.Time
+}
+
+// NewServer returns a bus endpoint that hands requests to handler, which
+// should be the node's full handler chain, authentication included.
+func NewServer(handler http.Handler) *Server {
+	return &Server{
+		handler: handler,
+		// Peers send no Origin; browsers always do, so no page can open a bus.
+		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return r.Header.Get("Origin") == "" }},
+		sessions: make(map[string]*session),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if id == "" || len(id) > 64 {
+		http.Error(w, "session required", http.StatusBadRequest)
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // The upgrader has answered
+	}
+	defer conn.Close()
+	conn.SetReadLimit(2 * maxBody)
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(5*time.Second))
+	})
+
+	sess := s.session(id)
+	for {
+		var f Frame
+		if err := conn.ReadJSON(&f); err != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		reply := sess.handle(f, func() Frame { return s.dispatch(r, f) })
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+// session returns the session with id, forgetting those not seen lately.
+func (s *Server) session(id string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for other, sess := range s.sessions {
+		if now.Sub(sess.seen) > sessionTTL {
+			delete(s.sessions, other)
+		}
+	}
+	sess, ok := s.sessions[id]
+	if !ok {
+		sess = &session{replies: make(map[uint64]Frame)}
+		s.sessions[id] = sess
+	}
+	sess.seen = now
+	return sess
+}
+
+// handle runs request f unless it was handled before, and returns its
+// reply. Requests of a session are handled one at a time, even if the
+// sender reconnected while one was running.
+func (sess *session) handle(f Frame, run func() Frame) Frame {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.seen = time.Now()
+	if f.Seq <= sess.last {
+		if reply, ok := sess.replies[f.Seq]; ok {
+			return reply
+		}
+		// Handled too long ago to remember how.
+		return Frame{Seq: f.Seq, Reply: true, Status: http.StatusAlreadyReported}
+	}
+	reply := run()
+	sess.last = f.Seq
+	sess.replies[f.Seq] = reply
+	if len(sess.replies) > replayWindow {
+		for seq := range sess.replies {
+			if seq+replayWindow <= f.Seq {
+				delete(sess.replies, seq)
+			}
+		}
+	}
+	return reply
+}
+
+// dispatch hands request f to the handler as a POST from the connection's
+// remote address.
+func (s *Server) dispatch(r *http.Request, f Frame) Frame {
+	reply := Frame{Seq: f.Seq, Reply: true}
+	if !strings.HasPrefix(f.Path, "/api/") || strings.HasPrefix(f.Path, Path) || len(f.Body) > maxBody {
+		reply.Status = http.StatusBadRequest
+		return reply
+	}
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, f.Path, bytes.NewReader(f.Body))
+	if err != nil {
+		reply.Status = http.StatusBadRequest
+		return reply
+	}
+	req.RemoteAddr = r.RemoteAddr
+	req.Host = r.Host
+	req.Header.Set("Content-Type", "application/json")
+	if f.Trace != "" {
+		req.Header.Set(tracing.Header, f.Trace)
+	}
+	if f.RequestID != "" {
+		req.Header.Set(requestid.Header, f.RequestID)
+	}
+	if f.Peer != "" {
+		req.Header.Set(peerauth.Header, f.Peer)
+	}
+
+	rec := &recorder{header: make(http.Header)}
+	s.handler.ServeHTTP(rec, req)
+	reply.Status = rec.status
+	if reply.Status == 0 {
+		reply.Status = http.StatusOK
+	}
+	if rec.body.Len() <= maxBody {
+		reply.Body = rec.body.Bytes()
+	}
+	return reply
+}
+
+// recorder captures the response to a request from the bus.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header { return r.header }
+
+func (r *recorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(p)
+}
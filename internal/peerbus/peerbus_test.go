@@ -0,0 +1,222 @@
+package peerbus
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/requestid"
+	"nexsign.mini/nsm/internal/tracing"
+)
+
+// recordingHandler answers every post with 204 and remembers the bodies in
+// the order it handled them.
+type recordingHandler struct {
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (h *recordingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	h.mu.Lock()
+	h.bodies = append(h.bodies, r.URL.Path+" "+string(body))
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *recordingHandler) handled() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.bodies...)
+}
+
+func newPeer(t *testing.T, withBus bool) (*httptest.Server, *recordingHandler) {
+	t.Helper()
+	h := &recordingHandler{}
+	mux := http.NewServeMux()
+	mux.Handle("/api/", h)
+	if withBus {
+		mux.Handle(Path, NewServer(mux))
+	}
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, h
+}
+
+func TestPostInOrder(t *testing.T) {
+	srv, h := newPeer(t, true)
+	pool := NewPool()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	for _, body := range []string{"1", "2", "3"} {
+		status, err := pool.Post(addr, "/api/heartbeat", []byte(body), time.Second)
+		if err != nil || status != http.StatusNoContent {
+			t.Fatalf("Post %s: status %d, %v", body, status, err)
+		}
+	}
+	if got := h.handled(); strings.Join(got, ",") != "/api/heartbeat 1,/api/heartbeat 2,/api/heartbeat 3" {
+		t.Errorf("expected the posts handled in order, got %v", got)
+	}
+	if connected := pool.Connected(); len(connected) != 1 || connected[0] != addr {
+		t.Errorf("expected one bus connection to %s, got %v", addr, connected)
+	}
+
+	// Paths outside the API, and the bus itself, are refused.
+	if status, _ := pool.Post(addr, "/", nil, time.Second); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for a path outside the API, got %d", status)
+	}
+	if status, _ := pool.Post(addr, Path, nil, time.Second); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for the bus path, got %d", status)
+	}
+}
+
+func TestPostFallsBackToHTTP(t *testing.T) {
+	srv, h := newPeer(t, false)
+	pool := NewPool()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	status, err := pool.Post(addr, "/api/hosts/lock", []byte("x"), time.Second)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("Post: status %d, %v", status, err)
+	}
+	if got := h.handled(); got[len(got)-1] != "/api/hosts/lock x" {
+		t.Errorf("expected the post delivered over HTTP, got %v", got)
+	}
+	if connected := pool.Connected(); len(connected) != 0 {
+		t.Errorf("expected no bus connection, got %v", connected)
+	}
+}
+
+func TestPostWithBusDisabled(t *testing.T) {
+	srv, h := newPeer(t, true)
+	pool := NewPool()
+	enabled := false
+	pool.SetEnabled(func() bool { return enabled })
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	if status, err := pool.Post(addr, "/api/heartbeat", []byte("1"), time.Second); err != nil || status != http.StatusNoContent {
+		t.Fatalf("Post: status %d, %v", status, err)
+	}
+	if connected := pool.Connected(); len(connected) != 0 || len(h.handled()) != 1 {
+		t.Errorf("expected the post over HTTP without a bus connection, got %v", connected)
+	}
+	enabled = true
+	pool.Post(addr, "/api/heartbeat", []byte("2"), time.Second)
+	if connected := pool.Connected(); len(connected) != 1 {
+		t.Errorf("expected the bus used once enabled, got %v", connected)
+	}
+}
+
+func TestPostCarriesTrace(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	tracing.Enable(collector.URL, "nsm", "test", logger.New(10))
+	defer tracing.Disable()
+
+	traces := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		traces <- r.Header.Get(tracing.Header)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.Handle(Path, NewServer(mux))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	pool := NewPool()
+	if _, err := pool.Post(strings.TrimPrefix(srv.URL, "http://"), "/api/heartbeat", []byte("1"), time.Second); err != nil {
+		t.Fatalf("Post: %v", err)
+	}
+	if len(pool.Connected()) != 1 {
+		t.Fatal("expected the post over the bus")
+	}
+	if tp := <-traces; tp == "" {
+		t.Error("expected the sender's traceparent in the request")
+	} else if _, ok := tracing.ParseTraceparent(tp); !ok {
+		t.Errorf("expected a valid traceparent, got %q", tp)
+	}
+}
+
+func TestPostContextCarriesRequestID(t *testing.T) {
+	ids := make(chan string, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		ids <- r.Header.Get(requestid.Header)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	ctx := requestid.With(context.Background(), "3f2a9c")
+
+	// Over HTTP, then over the bus.
+	pool := NewPool()
+	if _, err := pool.PostContext(ctx, addr, "/api/heartbeat", []byte("1"), time.Second); err != nil {
+		t.Fatalf("PostContext: %v", err)
+	}
+	mux.Handle(Path, NewServer(mux))
+	pool = NewPool()
+	if _, err := pool.PostContext(ctx, addr, "/api/heartbeat", []byte("2"), time.Second); err != nil || len(pool.Connected()) != 1 {
+		t.Fatalf("PostContext over the bus: %v", err)
+	}
+	for range 2 {
+		if id := <-ids; id != "3f2a9c" {
+			t.Errorf("expected the request ID sent on, got %q", id)
+		}
+	}
+}
+
+func TestResentRequestsHandledOnce(t *testing.T) {
+	srv, h := newPeer(t, true)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + Path + "?session=test"
+
+	send := func(frames ...Frame) []Frame {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Dial: %v", err)
+		}
+		defer conn.Close()
+		var replies []Frame
+		for _, f := range frames {
+			if err := conn.WriteJSON(f); err != nil {
+				t.Fatalf("WriteJSON: %v", err)
+			}
+			var reply Frame
+			if err := conn.ReadJSON(&reply); err != nil {
+				t.Fatalf("ReadJSON: %v", err)
+			}
+			replies = append(replies, reply)
+		}
+		return replies
+	}
+
+	send(Frame{Seq: 1, Path: "/api/hosts/announce", Body: []byte("a")})
+	// The sender reconnects and resends 1 along with 2.
+	replies := send(Frame{Seq: 1, Path: "/api/hosts/announce", Body: []byte("a")},
+		Frame{Seq: 2, Path: "/api/hosts/announce", Body: []byte("b")})
+	for _, r := range replies {
+		if !r.Reply || r.Status != http.StatusNoContent {
+			t.Errorf("unexpected reply %+v", r)
+		}
+	}
+	if got := h.handled(); len(got) != 2 {
+		t.Errorf("expected each request handled once, got %v", got)
+	}
+}
+
+func TestBusRefusesBrowsers(t *testing.T) {
+	srv, _ := newPeer(t, true)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + Path + "?session=test"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"http://example.com"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a connection with an Origin refused, got %v", err)
+	}
+}
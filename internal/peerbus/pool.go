@@ -0,0 +1,329 @@
+package peerbus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/requestid"
+	"nexsign.mini/nsm/internal/tracing"
+)
+
+// DefaultPort is the port peers serve the bus and their API on.
+const DefaultPort = "8080"
+
+// FallbackRetry is how long a peer without the bus is posted to over HTTP
+// before trying the bus again, in case it was upgraded.
+const FallbackRetry = 10 * time.Minute
+
+// redialDelay is how long a connection that dropped with requests still
+// waiting rests before it is dialled again to resend them.
+const redialDelay = time.Second
+
+var errTimeout = errors.New("peer did not answer in time")
+
+// Pool holds a bus connection to each peer posted to. It is safe for
+// concurrent use.
+type Pool struct {
+	session string
+	port    string
+
+	fault   func(addr string) error // See SetFault
+	enabled func() bool             // See SetEnabled
+	signer  *peerauth.Signer        // See SetSigner
+
+	mu    sync.Mutex
+	links map[string]*link
+}
+
+// link is the bus connection to one peer. Requests are written under mu,
+// so they reach the peer in the order they were numbered.
+type link struct {
+	pool *Pool
+	addr string // host:port
+
+	mu       sync.Mutex
+	conn     *websocket.Conn
+	seq      uint64
+	waiting  map[uint64]*call // Sent and not yet answered
+	httpOnly time.Time        // The peer has no bus; post over HTTP until then
+}
+
+type call struct {
+	frame Frame
+	done  chan Frame
+}
+
+// NewPool returns a pool with no connections. Peers tell its connections
+// apart from earlier ones by a session ID chosen here.
+func NewPool() *Pool {
+	return &Pool{session: uuid.New().String(), port: DefaultPort, links: make(map[string]*link)}
+}
+
+// Post delivers body to path on the peer at addr, an IP address or
+// host name, and returns the status the peer answered with. It connects to
+// the peer's bus if not connected, and posts over HTTP to peers without
+// one. It gives up after timeout.
+func (p *Pool) Post(addr, path string, body []byte, timeout time.Duration) (int, error) {
+	return p.PostContext(context.Background(), addr, path, body, timeout)
+}
+
+// PostContext is Post on behalf of the request in ctx: the peer handles
+// the post under its request ID and as part of its trace.
+func (p *Pool) PostContext(ctx context.Context, addr, path string, body []byte, timeout time.Duration) (status int, err error) {
+	l := p.link(addr)
+	ctx, sp := tracing.Start(ctx, "peerbus POST "+path, tracing.Client)
+	defer func() {
+		sp.SetAttr("http.response.status_code", status)
+		sp.SetError(err)
+		sp.End()
+	}()
+	sp.SetAttr("server.address", l.addr)
+	sp.SetAttr("url.path", path)
+
+	if p.enabled != nil && !p.enabled() {
+		sp.SetAttr("peerbus.transport", "http")
+		return p.postHTTP(ctx, l.addr, path, body, timeout)
+	}
+	f := Frame{Path: path, Body: body, Trace: tracing.Traceparent(ctx), RequestID: requestid.FromContext(ctx)}
+	f.Peer = p.signer.Value(http.MethodPost, path, body)
+	status, err = l.post(f, timeout)
+	if errors.Is(err, ErrNoBus) {
+		sp.SetAttr("peerbus.transport", "http")
+		return p.postHTTP(ctx, l.addr, path, body, timeout)
+	}
+	sp.SetAttr("peerbus.transport", "bus")
+	return status, err
+}
+
+// SetFault makes every request sent over the bus to addr (host:port) call
+// fault first, which may delay it and fail it with its error, for fault
+// injection. Failing with ErrNoBus sends the request over HTTP instead.
+// Call it before the pool is used.
+func (p *Pool) SetFault(fault func(addr string) error) {
+	p.fault = fault
+}
+
+// SetEnabled makes the pool post over HTTP while enabled reports false,
+// so the bus can be turned off without a restart. Connections already
+// open stay open. Call it before the pool is used.
+func (p *Pool) SetEnabled(enabled func() bool) {
+	p.enabled = enabled
+}
+
+// SetSigner makes the pool sign the requests it posts as this node, so
+// peers admit them where they require an operator. Call it before the pool
+// is used.
+func (p *Pool) SetSigner(signer *peerauth.Signer) {
+	p.signer = signer
+}
+
+// Connected returns the addresses with an open bus connection.
+func (p *Pool) Connected() []string {
+	p.mu.Lock()
+	links := make([]*link, 0, len(p.links))
+	for _, l := range p.links {
+		links = append(links, l)
+	}
+	p.mu.Unlock()
+
+	var out []string
+	for _, l := range links {
+		l.mu.Lock()
+		if l.conn != nil {
+			out = append(out, l.addr)
+		}
+		l.mu.Unlock()
+	}
+	slices.Sort(out)
+	return out
+}
+
+func (p *Pool) link(addr string) *link {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, p.port)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l, ok := p.links[addr]
+	if !ok {
+		l = &link{pool: p, addr: addr, waiting: make(map[uint64]*call)}
+		p.links[addr] = l
+	}
+	return l
+}
+
+func (p *Pool) postHTTP(ctx context.Context, addr, path string, body []byte, timeout time.Duration) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s", addr, path), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	tracing.Inject(ctx, req.Header)
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	p.signer.Sign(req, body)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// ErrNoBus is returned for a peer without a bus. Pool.Post then posts
+// over HTTP instead.
+var ErrNoBus = errors.New("peer has no bus")
+
+// post sends request f, numbering it, and waits for the reply.
+func (l *link) post(f Frame, timeout time.Duration) (int, error) {
+	if l.pool.fault != nil {
+		if err := l.pool.fault(l.addr); err != nil {
+			return 0, err
+		}
+	}
+	l.mu.Lock()
+	if time.Now().Before(l.httpOnly) {
+		l.mu.Unlock()
+		return 0, ErrNoBus
+	}
+	l.seq++
+	f.Seq = l.seq
+	c := &call{frame: f, done: make(chan Frame, 1)}
+	l.waiting[c.frame.Seq] = c
+	err := l.write(c.frame, timeout)
+	l.mu.Unlock()
+	if err != nil {
+		l.forget(c.frame.Seq)
+		return 0, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-c.done:
+		return reply.Status, nil
+	case <-timer.C:
+		l.forget(c.frame.Seq)
+		return 0, errTimeout
+	}
+}
+
+// write sends f, connecting first if need be. A new connection first
+// resends every request still waiting, f among them. The caller holds mu.
+func (l *link) write(f Frame, timeout time.Duration) error {
+	if l.conn == nil {
+		return l.connect(timeout)
+	}
+	l.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if err := l.conn.WriteJSON(f); err != nil {
+		l.conn.Close()
+		l.conn = nil
+		return l.connect(timeout)
+	}
+	return nil
+}
+
+// connect dials the peer and resends the waiting requests in order. The
+// caller holds mu.
+func (l *link) connect(timeout time.Duration) error {
+	u := url.URL{Scheme: "ws", Host: l.addr, Path: Path, RawQuery: url.Values{"session": {l.pool.session}}.Encode()}
+	dialer := websocket.Dialer{HandshakeTimeout: timeout}
+	conn, resp, err := dialer.Dial(u.String(), nil)
+	if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+		l.httpOnly = time.Now().Add(FallbackRetry)
+		return ErrNoBus
+	}
+	if err != nil {
+		return err
+	}
+
+	seqs := make([]uint64, 0, len(l.waiting))
+	for seq := range l.waiting {
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	for _, seq := range seqs {
+		if err := conn.WriteJSON(l.waiting[seq].frame); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(idleTimeout))
+	})
+	l.conn = conn
+	go l.read(conn)
+	go l.keepalive(conn)
+	return nil
+}
+
+// read hands replies to the requests waiting for them until the
+// connection drops. Requests still waiting then are resent on a new
+// connection.
+func (l *link) read(conn *websocket.Conn) {
+	for {
+		var f Frame
+		if err := conn.ReadJSON(&f); err != nil {
+			break
+		}
+		conn.SetReadDeadline(time.Now().Add(idleTimeout))
+		l.mu.Lock()
+		c, ok := l.waiting[f.Seq]
+		delete(l.waiting, f.Seq)
+		l.mu.Unlock()
+		if ok && f.Reply {
+			c.done <- f
+		}
+	}
+	conn.Close()
+
+	l.mu.Lock()
+	if l.conn == conn {
+		l.conn = nil
+	}
+	pending := len(l.waiting) > 0
+	l.mu.Unlock()
+	if pending {
+		time.Sleep(redialDelay)
+		l.mu.Lock()
+		if l.conn == nil && len(l.waiting) > 0 {
+			l.connect(5 * time.Second)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// keepalive pings the peer every PingInterval, so both ends notice a
+// dead connection.
+func (l *link) keepalive(conn *websocket.Conn) {
+	ticker := time.NewTicker(PingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (l *link) forget(seq uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.waiting, seq)
+}
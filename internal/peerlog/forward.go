@@ -0,0 +1,99 @@
+package peerlog
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Interval is how often new warnings and errors are forwarded.
+const Interval = 10 * time.Second
+
+// LocalProvider identifies the node forwarding its log.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// Forwarder sends this node's new warnings and errors to every reachable
+// peer that sends heartbeats.
+type Forwarder struct {
+	store  *hosts.Store
+	id     *identity.Identity
+	local  LocalProvider
+	logger *logger.Logger
+	bus    *peerbus.Pool
+	since  time.Time // Timestamp of the newest message forwarded
+}
+
+// NewForwarder creates a forwarder for the messages logged from now on.
+func NewForwarder(store *hosts.Store, id *identity.Identity, local LocalProvider, lg *logger.Logger, bus *peerbus.Pool) *Forwarder {
+	return &Forwarder{store: store, id: id, local: local, logger: lg, bus: bus, since: time.Now()}
+}
+
+// Run forwards new messages every Interval until the process exits.
+// Without a node identity there is nothing to sign with, so it does not
+// run.
+func (f *Forwarder) Run() {
+	if f.id == nil {
+		return
+	}
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		f.Forward()
+	}
+}
+
+// Forward sends the warnings and errors logged since the last call.
+func (f *Forwarder) Forward() {
+	var msgs []logger.Message
+	for _, m := range f.logger.GetAll() { // Newest first
+		if !m.Timestamp.After(f.since) || len(msgs) == MaxBatch {
+			break
+		}
+		if m.Level == "warning" || m.Level == "error" {
+			msgs = append(msgs, m)
+		}
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	slices.Reverse(msgs)
+	f.since = msgs[len(msgs)-1].Timestamp
+
+	self, err := f.local.GetMetadata()
+	if err != nil {
+		return
+	}
+	hostname := self.Hostname
+	if h, err := os.Hostname(); err == nil && h != "" {
+		hostname = h
+	}
+	body, err := Seal(Batch{SenderID: self.ID, Hostname: hostname, SentAt: time.Now().UTC(), Messages: msgs}, f.id)
+	if err != nil {
+		f.logger.Error(fmt.Sprintf("Log forwarding: failed to seal: %v", err))
+		return
+	}
+
+	peers, err := f.store.ListPeers()
+	if err != nil {
+		return
+	}
+	for _, p := range peers {
+		peer, err := f.store.GetByID(p.NodeID)
+		if p.NodeID == self.ID || err != nil {
+			continue
+		}
+		if path := hosts.SelectPath(*peer); path.Healthy() {
+			// Failures are not logged: the log would be forwarded again.
+			go f.bus.Post(path.Address, Path, body, 5*time.Second)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Package peerlog forwards each node's warnings and errors to its peers,
+// so a problem on any node shows on every node. Batches are signed by the
+// sending node's key, like heartbeats, and accepted only from nodes whose
+// key a heartbeat has pinned. Forwarding is best effort: a peer that
+// cannot be reached misses the batch.
+package peerlog
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+)
+
+// Path is the endpoint batches are posted to.
+const Path = "/api/peers/logs/receive"
+
+// MaxSkew is how far a batch's send time may be from the receiver's clock.
+const MaxSkew = 5 * time.Minute
+
+// Limits: a batch carries at most MaxBatch messages, and a node keeps the
+// latest MaxKept messages from each peer.
+const (
+	MaxBatch = 50
+	MaxKept  = 100
+)
+
+var (
+	ErrBadSignature  = errors.New("log batch signature is invalid")
+	ErrUnknownSender = errors.New("log batch from a node that has not sent a heartbeat")
+	ErrKeyMismatch   = errors.New("log batch signed by a different key than the one pinned for the sender")
+	ErrClockSkew     = errors.New("log batch send time is too far from this node's clock")
+)
+
+// Batch is the signed content of a forwarded batch of log messages.
+type Batch struct {
+	SenderID  string           `json:"sender_id"`
+	Hostname  string           `json:"hostname,omitempty"`
+	PublicKey string           `json:"public_key"` // Base64 Ed25519 key that signed the envelope
+	SentAt    time.Time        `json:"sent_at"`
+	Messages  []logger.Message `json:"messages"`
+}
+
+// Envelope carries a batch and the signature over its exact bytes.
+type Envelope struct {
+	Batch     json.RawMessage `json:"batch"`
+	Signature string          `json:"signature"`
+}
+
+// Seal encodes and signs a batch with the node key.
+func Seal(b Batch, id *identity.Identity) ([]byte, error) {
+	b.PublicKey = base64.StdEncoding.EncodeToString(id.PublicKey())
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{
+		Batch:     raw,
+		Signature: base64.StdEncoding.EncodeToString(id.Sign(raw)),
+	})
+}
+
+// Accept checks a batch and returns it for the caller to keep. It must be
+// signed by the key pinned for the sender and recently sent. Messages
+// past MaxBatch are dropped.
+func Accept(store *hosts.Store, data []byte, now time.Time) (Batch, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Batch{}, fmt.Errorf("decode log batch: %w", err)
+	}
+	var b Batch
+	if err := json.Unmarshal(env.Batch, &b); err != nil {
+		return Batch{}, fmt.Errorf("decode log batch: %w", err)
+	}
+	pub, err := base64.StdEncoding.DecodeString(b.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return Batch{}, ErrBadSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || !ed25519.Verify(pub, env.Batch, sig) {
+		return Batch{}, ErrBadSignature
+	}
+	if skew := now.Sub(b.SentAt); skew > MaxSkew || skew < -MaxSkew {
+		return Batch{}, ErrClockSkew
+	}
+
+	sender, err := store.GetPeer(b.SenderID)
+	switch {
+	case errors.Is(err, hosts.ErrPeerNotFound):
+		return Batch{}, ErrUnknownSender
+	case err != nil:
+		return Batch{}, err
+	case sender.PublicKey != b.PublicKey:
+		return Batch{}, ErrKeyMismatch
+	}
+	if len(b.Messages) > MaxBatch {
+		b.Messages = b.Messages[len(b.Messages)-MaxBatch:]
+	}
+	return b, nil
+}
+
+// Entry is a message forwarded by a peer.
+type Entry struct {
+	NodeID   string `json:"node_id"`
+	Hostname string `json:"hostname,omitempty"`
+	logger.Message
+}
+
+// Buffer keeps the latest messages forwarded by each peer, in memory. It
+// is safe for concurrent use.
+type Buffer struct {
+	mu     sync.Mutex
+	byNode map[string][]Entry
+}
+
+// NewBuffer returns an empty buffer.
+func NewBuffer() *Buffer {
+	return &Buffer{byNode: make(map[string][]Entry)}
+}
+
+// Add keeps the messages of an accepted batch.
+func (b *Buffer) Add(batch Batch) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := b.byNode[batch.SenderID]
+	for _, m := range batch.Messages {
+		list = append(list, Entry{NodeID: batch.SenderID, Hostname: batch.Hostname, Message: m})
+	}
+	if len(list) > MaxKept {
+		list = list[len(list)-MaxKept:]
+	}
+	b.byNode[batch.SenderID] = list
+}
+
+// List returns the messages forwarded by nodeID, or by every peer if
+// nodeID is empty, newest first.
+func (b *Buffer) List(nodeID string) []Entry {
+	b.mu.Lock()
+	out := []Entry{}
+	for id, list := range b.byNode {
+		if nodeID == "" || id == nodeID {
+			out = append(out, list...)
+		}
+	}
+	b.mu.Unlock()
+	slices.SortStableFunc(out, func(a, b Entry) int { return b.Timestamp.Compare(a.Timestamp) })
+	return out
+}
+
+// Forget drops the messages of a peer that was removed.
+func (b *Buffer) Forget(nodeID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.byNode, nodeID)
+}
@@ -0,0 +1,34 @@
+package peerlog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/logger"
+)
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer()
+	now := time.Now()
+	var msgs []logger.Message
+	for i := range MaxKept + 5 {
+		msgs = append(msgs, logger.Message{Timestamp: now.Add(time.Duration(i) * time.Second), Level: "error", Text: fmt.Sprint(i)})
+	}
+	b.Add(Batch{SenderID: "lobby", Messages: msgs})
+	b.Add(Batch{SenderID: "bar", Messages: []logger.Message{{Timestamp: now.Add(time.Hour), Level: "warning", Text: "late"}}})
+
+	lobby := b.List("lobby")
+	if len(lobby) != MaxKept || lobby[0].Text != fmt.Sprint(MaxKept+4) || lobby[len(lobby)-1].Text != "5" {
+		t.Errorf("expected the latest %d messages, newest first, got %d from %q to %q",
+			MaxKept, len(lobby), lobby[0].Text, lobby[len(lobby)-1].Text)
+	}
+	if all := b.List(""); len(all) != MaxKept+1 || all[0].NodeID != "bar" {
+		t.Errorf("expected every peer's messages, newest first, got %d", len(all))
+	}
+
+	b.Forget("lobby")
+	if got := b.List("lobby"); len(got) != 0 {
+		t.Errorf("expected a forgotten peer's messages dropped, got %d", len(got))
+	}
+}
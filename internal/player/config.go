@@ -0,0 +1,102 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/playlist"
+)
+
+// ConfigSettingKey holds this node's player settings. Settings are not
+// replicated, so each node plays its own list.
+const ConfigSettingKey = "player"
+
+// Defaults for settings left empty.
+const (
+	DefaultBrowser  = "chromium-browser --kiosk --noerrdialogs --disable-infobars --incognito --autoplay-policy=no-user-gesture-required"
+	DefaultVideo    = "mpv --fs --ontop --really-quiet --no-terminal"
+	DefaultDuration = 10
+)
+
+// Config is what the player plays and how. Commands are split on spaces;
+// the page or media URI is added as the last argument.
+type Config struct {
+	Enabled  bool             `json:"enabled"`
+	Assets   []playlist.Asset `json:"assets"`            // Played in order, in the shape of an Anthias asset list
+	Mirror   string           `json:"mirror,omitempty"`  // ID of a host whose asset baseline is played instead of Assets
+	Browser  string           `json:"browser"`           // Kiosk browser, opened once on the player page
+	Video    string           `json:"video"`             // Video player, started for each video and stream
+	Display  string           `json:"display,omitempty"` // DISPLAY for both, e.g. ":0"; empty keeps NSM's
+	Duration int              `json:"duration"`          // Seconds for assets without a duration of their own
+}
+
+// DefaultConfig is used until an operator saves player settings.
+func DefaultConfig() Config {
+	return Config{
+		Assets:   []playlist.Asset{},
+		Browser:  DefaultBrowser,
+		Video:    DefaultVideo,
+		Duration: DefaultDuration,
+	}
+}
+
+// Validate normalises c and rejects unusable values.
+func (c *Config) Validate() error {
+	c.Browser = strings.TrimSpace(c.Browser)
+	if c.Browser == "" {
+		c.Browser = DefaultBrowser
+	}
+	c.Video = strings.TrimSpace(c.Video)
+	if c.Video == "" {
+		c.Video = DefaultVideo
+	}
+	c.Display = strings.TrimSpace(c.Display)
+	c.Mirror = strings.TrimSpace(c.Mirror)
+	if c.Duration == 0 {
+		c.Duration = DefaultDuration
+	}
+	if c.Duration < 1 {
+		return errors.New("duration must be positive")
+	}
+	if c.Assets == nil {
+		c.Assets = []playlist.Asset{}
+	}
+	for i := range c.Assets {
+		a := &c.Assets[i]
+		a.MimeType = strings.ToLower(strings.TrimSpace(a.MimeType))
+		if !playlist.MediaTypes[a.MimeType] {
+			return fmt.Errorf("asset %d: media type %q is not supported (use image, video, webpage or streaming)", i+1, a.MimeType)
+		}
+		if strings.TrimSpace(a.URI) == "" {
+			return fmt.Errorf("asset %d: no URI", i+1)
+		}
+		if a.Duration < 0 {
+			return fmt.Errorf("asset %d: duration must not be negative", i+1)
+		}
+	}
+	return nil
+}
+
+// LoadConfig reads the player settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(ConfigSettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the player settings.
+func SaveConfig(store *hosts.Store, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	if cfg.Mirror != "" {
+		if _, err := store.GetByID(cfg.Mirror); err != nil {
+			return Config{}, fmt.Errorf("unknown mirror host %q", cfg.Mirror)
+		}
+	}
+	return cfg, store.PutSetting(ConfigSettingKey, cfg)
+}
@@ -0,0 +1,54 @@
+package player
+
+import "io"
+
+// NowPath is where the player page asks what to show.
+const NowPath = "/api/player/now"
+
+// page asks the node once a second what to show and shows web pages in a
+// frame and images on their own. Videos and streams leave it black, under
+// the video player.
+const page = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>nexSign mini player</title>
+<style>
+html, body { margin: 0; height: 100%; overflow: hidden; background: #000; cursor: none; }
+iframe, img { position: absolute; inset: 0; width: 100%; height: 100%; border: 0; display: none; }
+img { object-fit: contain; }
+</style>
+</head>
+<body>
+<iframe id="web" allow="autoplay; fullscreen"></iframe>
+<img id="image" alt="">
+<script>
+var web = document.getElementById("web"), image = document.getElementById("image"), shown = "";
+function show(item) {
+	var a = item.asset, key = a ? a.mimetype + " " + a.uri : "";
+	if (key === shown) return;
+	shown = key;
+	web.style.display = image.style.display = "none";
+	if (!a) return;
+	if (a.mimetype === "webpage") { web.src = a.uri; web.style.display = "block"; }
+	if (a.mimetype === "image") { image.src = a.uri; image.style.display = "block"; }
+}
+function poll() {
+	fetch("` + NowPath + `", {cache: "no-store"})
+		.then(function (r) { return r.json(); })
+		.then(show)
+		.catch(function () {})
+		.finally(function () { setTimeout(poll, 1000); });
+}
+poll();
+</script>
+</body>
+</html>
+`
+
+// WritePage writes the player page.
+func WritePage(w io.Writer) error {
+	_, err := io.WriteString(w, page)
+	return err
+}
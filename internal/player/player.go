@@ -0,0 +1,356 @@
+// Package player turns a node into a minimal signage player for kiosks
+// without Anthias. It keeps a kiosk browser open on the player page, which
+// shows web pages and images, starts a video player for videos and
+// streams, and rotates through its assets on its own. What it shows is
+// reported in the node's heartbeats.
+package player
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// PagePath is where the web server serves the player page.
+const PagePath = "/player"
+
+// restartDelay is the least time between two starts of the browser, so one
+// that cannot start is not retried every second.
+const restartDelay = 10 * time.Second
+
+// LocalProvider identifies the node the player runs on.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// process is a program the player started.
+type process interface {
+	Exited() bool
+	Stop()
+	Output() string // The end of what it wrote to stdout and stderr
+}
+
+// Item is what the player page should show.
+type Item struct {
+	State string          `json:"state"` // hosts.PlaybackIdle, PlaybackPlaying or PlaybackError
+	Asset *playlist.Asset `json:"asset,omitempty"`
+	Until time.Time       `json:"until,omitzero"`
+}
+
+// Player rotates through the configured assets on this node.
+type Player struct {
+	store   *hosts.Store
+	local   LocalProvider
+	logger  *logger.Logger
+	pageURL string
+	start   func(args []string, display string) (process, error)
+
+	mu             sync.Mutex
+	nodeID         string
+	browser        process
+	browserStarted time.Time
+	browserExits   int    // Since the player was created
+	browserOutput  string // Of the browser that exited last
+	video          process
+	list           string // Hash of the playlist being rotated
+	index          int
+	current        playlist.Asset
+	until          time.Time
+	status         hosts.Playback
+}
+
+// New creates a player whose browser opens the player page of the node
+// serving on port.
+func New(store *hosts.Store, local LocalProvider, lg *logger.Logger, port int) *Player {
+	return &Player{
+		store:   store,
+		local:   local,
+		logger:  lg,
+		pageURL: fmt.Sprintf("http://127.0.0.1:%d%s", port, PagePath),
+		start:   startCommand,
+		status:  hosts.Playback{State: hosts.PlaybackIdle},
+	}
+}
+
+// Run advances the player every second until the process exits.
+func (p *Player) Run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		p.Step(now)
+	}
+}
+
+// Step brings the player up to date at now: it starts or stops the
+// browser, moves on from an asset whose time is up and reports the result.
+func (p *Player) Step(now time.Time) {
+	cfg, err := LoadConfig(p.store)
+	if err != nil {
+		p.logger.Error(fmt.Sprintf("Player: %v", err))
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.report(now)
+
+	if !cfg.Enabled {
+		if p.browser != nil {
+			p.logger.Info("Player: stopped")
+		}
+		p.stopAll()
+		p.status = hosts.Playback{State: hosts.PlaybackIdle}
+		return
+	}
+
+	if p.browser == nil || p.browser.Exited() {
+		if !p.browserStarted.IsZero() && now.Sub(p.browserStarted) < restartDelay {
+			return
+		}
+		if p.browser != nil {
+			p.browserExits++
+			p.browserOutput = p.browser.Output()
+			p.logger.Warning("Player: browser exited, starting it again")
+		}
+		p.browserStarted = now
+		if p.browser, err = p.start(append(strings.Fields(cfg.Browser), p.pageURL), cfg.Display); err != nil {
+			p.browser = nil
+			p.fail(fmt.Sprintf("browser: %v", err))
+			return
+		}
+		p.logger.Info("Player: started browser on " + p.pageURL)
+	}
+
+	assets := p.playable(cfg, now)
+	if len(assets) == 0 {
+		p.stopVideo()
+		p.current, p.until = playlist.Asset{}, time.Time{}
+		p.status = hosts.Playback{State: hosts.PlaybackIdle}
+		return
+	}
+	if list := hashList(assets); list != p.list {
+		p.list, p.index, p.until = list, -1, time.Time{}
+	}
+	if !p.due(now) {
+		return
+	}
+
+	p.index = (p.index + 1) % len(assets)
+	p.current = assets[p.index]
+	p.stopVideo()
+	duration := time.Duration(p.current.Duration) * time.Second
+	if p.current.Duration == 0 {
+		duration = time.Duration(cfg.Duration) * time.Second
+	}
+	p.until = now.Add(duration)
+	p.status = hosts.Playback{State: hosts.PlaybackPlaying, Asset: p.current.Name, MimeType: p.current.MimeType,
+		Index: p.index + 1, Count: len(assets), StartedAt: now.UTC(), Until: p.until.UTC()}
+	if isVideo(p.current) {
+		// Videos without a duration play to their end.
+		if p.current.Duration == 0 {
+			p.until, p.status.Until = time.Time{}, time.Time{}
+		}
+		if p.video, err = p.start(append(strings.Fields(cfg.Video), p.current.URI), cfg.Display); err != nil {
+			p.video = nil
+			p.until = now.Add(duration)
+			p.fail(fmt.Sprintf("video player: %v", err))
+		}
+	}
+}
+
+// due reports whether the current asset has had its time, or its video
+// ended. The caller holds p.mu.
+func (p *Player) due(now time.Time) bool {
+	if p.index < 0 {
+		return true
+	}
+	if p.video != nil && p.video.Exited() {
+		return true
+	}
+	return !p.until.IsZero() && !now.Before(p.until)
+}
+
+// playable returns the assets to rotate through at now: the mirrored
+// host's baseline or the configured list, keeping those that are enabled
+// and scheduled.
+func (p *Player) playable(cfg Config, now time.Time) []playlist.Asset {
+	list := cfg.Assets
+	if cfg.Mirror != "" {
+		baselines, err := p.store.AssetBaselines()
+		if err != nil {
+			p.logger.Warning(fmt.Sprintf("Player: cannot read the baseline to mirror: %v", err))
+		}
+		list = baselines[cfg.Mirror].Assets
+	}
+	var out []playlist.Asset
+	for _, a := range list {
+		if !a.IsEnabled.True() || !playlist.MediaTypes[strings.ToLower(a.MimeType)] || a.URI == "" {
+			continue
+		}
+		if start, ok := playlist.ParseDate(a.StartDate); ok && start.After(now) {
+			continue
+		}
+		if end, ok := playlist.ParseDate(a.EndDate); ok && !end.After(now) {
+			continue
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// fail records an error as the playback state. The caller holds p.mu.
+func (p *Player) fail(msg string) {
+	p.logger.Error("Player: " + msg)
+	p.status = hosts.Playback{State: hosts.PlaybackError, Error: msg}
+}
+
+// report records the playback state for this node's heartbeats. The
+// caller holds p.mu.
+func (p *Player) report(now time.Time) {
+	if p.nodeID == "" {
+		self, err := p.local.GetMetadata()
+		if err != nil {
+			return
+		}
+		p.nodeID = self.ID
+	}
+	p.store.RecordPlayback(p.nodeID, p.status, now)
+}
+
+func (p *Player) stopVideo() {
+	if p.video != nil {
+		p.video.Stop()
+		p.video = nil
+	}
+}
+
+func (p *Player) stopAll() {
+	p.stopVideo()
+	if p.browser != nil {
+		p.browser.Stop()
+		p.browser = nil
+	}
+	p.browserStarted = time.Time{}
+	p.list, p.current, p.until = "", playlist.Asset{}, time.Time{}
+}
+
+// Status returns what the player is doing.
+func (p *Player) Status() hosts.Playback {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// BrowserExits returns how many times the browser has exited since the
+// player was created, and the last output of the one that exited last, for
+// the watchdog. ok is false while the player is off.
+func (p *Player) BrowserExits() (exits int, output string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.browserExits, p.browserOutput, p.browser != nil || !p.browserStarted.IsZero()
+}
+
+// Now returns what the player page should show. The page leaves videos
+// and streams to the video player.
+func (p *Player) Now() Item {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	item := Item{State: p.status.State, Until: p.status.Until}
+	if p.status.State == hosts.PlaybackPlaying {
+		a := p.current
+		item.Asset = &a
+	}
+	return item
+}
+
+func isVideo(a playlist.Asset) bool {
+	mime := strings.ToLower(a.MimeType)
+	return mime == "video" || mime == "streaming"
+}
+
+func hashList(assets []playlist.Asset) string {
+	data, _ := json.Marshal(assets)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// command is a process started with os/exec.
+type command struct {
+	cmd  *exec.Cmd
+	done chan struct{}
+	out  *tail
+}
+
+// tailSize is how much of a process's output is kept.
+const tailSize = 4096
+
+// tail keeps the last tailSize bytes written to it.
+type tail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *tail) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, b...)
+	if len(t.buf) > tailSize {
+		t.buf = t.buf[len(t.buf)-tailSize:]
+	}
+	return len(b), nil
+}
+
+func (t *tail) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
+
+func startCommand(args []string, display string) (process, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	if display != "" {
+		cmd.Env = append(os.Environ(), "DISPLAY="+display)
+	}
+	out := &tail{}
+	cmd.Stdout, cmd.Stderr = out, out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &command{cmd: cmd, done: make(chan struct{}), out: out}
+	go func() {
+		cmd.Wait()
+		close(c.done)
+	}()
+	return c, nil
+}
+
+func (c *command) Exited() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *command) Output() string {
+	return c.out.String()
+}
+
+func (c *command) Stop() {
+	if !c.Exited() {
+		c.cmd.Process.Kill()
+		<-c.done
+	}
+}
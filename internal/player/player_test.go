@@ -0,0 +1,158 @@
+package player
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/playlist"
+	"nexsign.mini/nsm/internal/types"
+)
+
+type fakeLocal struct{}
+
+func (fakeLocal) GetMetadata() (*types.Host, error) { return &types.Host{ID: "kiosk"}, nil }
+
+// fakeProcess stands in for the browser and the video player.
+type fakeProcess struct {
+	args    []string
+	exited  bool
+	stopped bool
+	output  string
+}
+
+func (f *fakeProcess) Exited() bool   { return f.exited || f.stopped }
+func (f *fakeProcess) Stop()          { f.stopped = true }
+func (f *fakeProcess) Output() string { return f.output }
+
+func TestPlayerRotates(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var started []*fakeProcess
+	p := New(store, fakeLocal{}, logger.New(10), 8080)
+	p.start = func(args []string, display string) (process, error) {
+		if args[0] == "missing" {
+			return nil, errors.New("executable file not found")
+		}
+		f := &fakeProcess{args: args}
+		started = append(started, f)
+		return f, nil
+	}
+
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	p.Step(now)
+	if len(started) != 0 || p.Status().State != hosts.PlaybackIdle {
+		t.Fatalf("expected a disabled player to start nothing, got %d processes", len(started))
+	}
+
+	if _, err := SaveConfig(store, Config{Enabled: true, Assets: []playlist.Asset{
+		{Name: "Welcome", URI: "https://example.com/welcome", MimeType: "webpage", Duration: 15, IsEnabled: playlist.Enabled(true)},
+		{Name: "Promo", URI: "https://example.com/promo.mp4", MimeType: "video", IsEnabled: playlist.Enabled(true)},
+		{Name: "Old", URI: "https://example.com/old", MimeType: "webpage", EndDate: "2025-01-01T00:00:00Z"},
+	}}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+
+	p.Step(now)
+	if len(started) != 1 || started[0].args[len(started[0].args)-1] != "http://127.0.0.1:8080/player" {
+		t.Fatalf("expected the browser on the player page, got %+v", started)
+	}
+	if st := p.Status(); st.State != hosts.PlaybackPlaying || st.Asset != "Welcome" || st.Count != 2 {
+		t.Fatalf("expected Welcome of 2 assets, got %+v", st)
+	}
+	if item := p.Now(); item.Asset == nil || item.Asset.URI != "https://example.com/welcome" {
+		t.Errorf("expected the page to show Welcome, got %+v", item)
+	}
+
+	// The video starts when Welcome's time is up and plays to its end.
+	p.Step(now.Add(14 * time.Second))
+	if p.Status().Asset != "Welcome" {
+		t.Fatalf("expected Welcome for 15 seconds, got %+v", p.Status())
+	}
+	p.Step(now.Add(15 * time.Second))
+	if len(started) != 2 || started[1].args[0] != "mpv" || started[1].args[len(started[1].args)-1] != "https://example.com/promo.mp4" {
+		t.Fatalf("expected mpv for the video, got %+v", started)
+	}
+	p.Step(now.Add(time.Hour))
+	if p.Status().Asset != "Promo" {
+		t.Fatalf("expected the video to play to its end, got %+v", p.Status())
+	}
+	started[1].exited = true
+	p.Step(now.Add(time.Hour + time.Second))
+	if st := p.Status(); st.Asset != "Welcome" || st.Index != 1 {
+		t.Errorf("expected Welcome again after the video, got %+v", st)
+	}
+
+	// The state goes out in this node's heartbeats.
+	if pb, ok := store.PlaybackOf("kiosk", now.Add(time.Hour+time.Second)); !ok || pb.Summary() != "Welcome (1/2)" {
+		t.Errorf("expected the playback to be recorded, got %+v, %v", pb, ok)
+	}
+
+	// Disabling stops everything.
+	if _, err := SaveConfig(store, Config{}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	p.Step(now.Add(2 * time.Hour))
+	if !started[0].stopped || p.Status().State != hosts.PlaybackIdle {
+		t.Errorf("expected the browser stopped and the player idle, got %+v", p.Status())
+	}
+
+	// A browser that cannot start is reported.
+	SaveConfig(store, Config{Enabled: true, Browser: "missing"})
+	p.Step(now.Add(3 * time.Hour))
+	if st := p.Status(); st.State != hosts.PlaybackError || !strings.Contains(st.Error, "not found") {
+		t.Errorf("expected a browser error, got %+v", st)
+	}
+}
+
+func TestPlayerCountsBrowserExits(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	var started []*fakeProcess
+	p := New(store, fakeLocal{}, logger.New(10), 8080)
+	p.start = func(args []string, display string) (process, error) {
+		f := &fakeProcess{args: args}
+		started = append(started, f)
+		return f, nil
+	}
+
+	now := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	if _, _, ok := p.BrowserExits(); ok {
+		t.Error("expected no browser to watch while the player is off")
+	}
+	SaveConfig(store, Config{Enabled: true})
+	p.Step(now)
+	started[0].exited, started[0].output = true, "Segmentation fault"
+	p.Step(now.Add(5 * time.Second))
+	if len(started) != 1 {
+		t.Fatalf("expected no restart within the restart delay, got %d starts", len(started))
+	}
+	p.Step(now.Add(10 * time.Second))
+	exits, output, ok := p.BrowserExits()
+	if len(started) != 2 || exits != 1 || output != "Segmentation fault" || !ok {
+		t.Errorf("expected one exit with its output and the browser started again, got %d, %q, %v (%d starts)", exits, output, ok, len(started))
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{Assets: []playlist.Asset{{Name: "Menu", URI: "https://example.com/menu.pdf", MimeType: "pdf"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an unsupported media type to be rejected")
+	}
+	cfg = Config{}
+	if err := cfg.Validate(); err != nil || cfg.Browser != DefaultBrowser || cfg.Duration != DefaultDuration {
+		t.Errorf("expected defaults, got %+v, %v", cfg, err)
+	}
+}
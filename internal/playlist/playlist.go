@@ -0,0 +1,352 @@
+// Package playlist checks a set of Anthias assets before it goes on a
+// screen: that each asset can play, and that at least one will, so a show
+// never leaves a display blank.
+package playlist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MediaTypes are the asset types Anthias can play.
+var MediaTypes = map[string]bool{
+	"image":     true,
+	"video":     true,
+	"webpage":   true,
+	"streaming": true,
+}
+
+// Asset is an entry in an Anthias playlist, in the shape of its
+// /api/v1/assets endpoint.
+type Asset struct {
+	ID        string  `json:"asset_id,omitempty"`
+	Name      string  `json:"name"`
+	URI       string  `json:"uri"`
+	MimeType  string  `json:"mimetype"`
+	Duration  Seconds `json:"duration"`
+	StartDate string  `json:"start_date,omitempty"`
+	EndDate   string  `json:"end_date,omitempty"`
+	IsEnabled Flag    `json:"is_enabled"`
+}
+
+// Seconds is an asset duration. Anthias has sent it as a number and as a
+// string.
+type Seconds int
+
+// UnmarshalJSON accepts 10, 10.5 and "10". Anything else reads as 0 so
+// that one odd asset does not make the whole list unreadable.
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	f, err := strconv.ParseFloat(strings.Trim(string(data), `"`), 64)
+	if err != nil {
+		f = 0
+	}
+	*s = Seconds(f)
+	return nil
+}
+
+// Flag is a boolean Anthias has sent as true/false and as 1/0. A missing
+// flag is true.
+type Flag struct {
+	set, value bool
+}
+
+// UnmarshalJSON accepts true, false, 1 and 0. Anything else reads as unset.
+func (f *Flag) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*f = Flag{set: true, value: true}
+	case "false", "0":
+		*f = Flag{set: true, value: false}
+	default:
+		*f = Flag{}
+	}
+	return nil
+}
+
+// MarshalJSON writes the flag as a boolean.
+func (f Flag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.True())
+}
+
+// True reports the flag's value.
+func (f Flag) True() bool {
+	return !f.set || f.value
+}
+
+// Equal reports whether a and b are the same asset with the same content.
+// A missing is_enabled equals true, as it does once stored and read back.
+func (a Asset) Equal(b Asset) bool {
+	a.IsEnabled, b.IsEnabled = Enabled(a.IsEnabled.True()), Enabled(b.IsEnabled.True())
+	return a == b
+}
+
+// Enabled returns a set flag with value v.
+func Enabled(v bool) Flag {
+	return Flag{set: true, value: v}
+}
+
+// AssetResult is the verdict on one asset.
+type AssetResult struct {
+	Name     string   `json:"name"`
+	URI      string   `json:"uri"`
+	Valid    bool     `json:"valid"`    // No errors; the asset can play
+	Playable bool     `json:"playable"` // Valid, enabled and scheduled now
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Report is the result of a dry-run validation.
+type Report struct {
+	Assets   []AssetResult `json:"assets"`
+	Valid    int           `json:"valid"`
+	Playable int           `json:"playable"`
+	Blank    bool          `json:"blank"` // Nothing would play; the screen would go blank
+}
+
+// Validator checks assets. Remote URIs are probed over HTTP.
+type Validator struct {
+	Client *http.Client
+	Now    func() time.Time
+}
+
+// NewValidator creates a validator that gives each URI five seconds to
+// answer.
+func NewValidator() *Validator {
+	return &Validator{
+		Client: &http.Client{Timeout: 5 * time.Second},
+		Now:    time.Now,
+	}
+}
+
+// Validate checks every asset, probing URIs in parallel.
+func (v *Validator) Validate(assets []Asset) Report {
+	now := v.Now().UTC()
+	results := make([]AssetResult, len(assets))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, 8)
+	for i, a := range assets {
+		wg.Add(1)
+		go func(i int, a Asset) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = v.check(a, now)
+		}(i, a)
+	}
+	wg.Wait()
+
+	report := Report{Assets: results}
+	for _, r := range results {
+		if r.Valid {
+			report.Valid++
+		}
+		if r.Playable {
+			report.Playable++
+		}
+	}
+	report.Blank = report.Playable == 0
+	return report
+}
+
+func (v *Validator) check(a Asset, now time.Time) AssetResult {
+	r := AssetResult{Name: a.Name, URI: a.URI}
+	fail := func(format string, args ...any) { r.Errors = append(r.Errors, fmt.Sprintf(format, args...)) }
+	warn := func(format string, args ...any) { r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...)) }
+
+	mime := strings.ToLower(strings.TrimSpace(a.MimeType))
+	if !MediaTypes[mime] {
+		fail("media type %q is not supported by Anthias (use image, video, webpage or streaming)", a.MimeType)
+	}
+	if a.Duration <= 0 {
+		fail("duration must be greater than 0 seconds")
+	}
+
+	switch uri := strings.TrimSpace(a.URI); {
+	case uri == "":
+		fail("no URI")
+	case strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://"):
+		if err := v.probe(uri); err != nil {
+			fail("URI not reachable: %v", err)
+		}
+	default:
+		// Uploaded files and stream URLs live on the player; only it can
+		// check them.
+		warn("not an HTTP URI; reachability not checked")
+	}
+
+	r.Valid = len(r.Errors) == 0
+	if !r.Valid {
+		return r
+	}
+
+	scheduled := true
+	if start, ok := ParseDate(a.StartDate); ok && start.After(now) {
+		warn("starts %s", start.Format(time.RFC3339))
+		scheduled = false
+	}
+	if end, ok := ParseDate(a.EndDate); ok && !end.After(now) {
+		warn("ended %s", end.Format(time.RFC3339))
+		scheduled = false
+	}
+	if !a.IsEnabled.True() {
+		warn("disabled")
+	}
+	r.Playable = scheduled && a.IsEnabled.True()
+	return r
+}
+
+// probe checks that uri answers with a non-error status. Servers that do
+// not allow HEAD get a GET.
+func (v *Validator) probe(uri string) error {
+	resp, err := v.Client.Head(uri)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = v.Client.Get(uri)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// dateLayouts are the date formats Anthias versions have used.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999",
+	"2006-01-02 15:04:05",
+}
+
+// ParseDate parses an Anthias date. Dates without a zone are UTC.
+func ParseDate(s string) (time.Time, bool) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Create adds a to the playlist of the Anthias instance at addr, enabled
+// and scheduled from now on, and returns the stored asset. Anthias does
+// not probe the URI; the caller is expected to know it is reachable. A
+// non-empty username sends basic auth.
+func Create(client *http.Client, addr string, a Asset, username, password string) (Asset, error) {
+	now := time.Now().UTC()
+	a.StartDate = now.Format(time.RFC3339)
+	a.EndDate = now.AddDate(10, 0, 0).Format(time.RFC3339)
+	a.IsEnabled = Enabled(true)
+	return send(client, http.MethodPost, fmt.Sprintf("http://%s/api/v1.2/assets", addr), a, username, password)
+}
+
+// Apply changes the playlist of the Anthias instance at addr from current
+// to want: assets not in want are deleted, changed ones are put back as
+// they are in want, and missing ones are added again with new IDs. Assets
+// are matched by ID. It stops at the first error.
+func Apply(client *http.Client, addr string, current, want []Asset, username, password string) error {
+	wanted := make(map[string]Asset, len(want))
+	for _, a := range want {
+		wanted[a.ID] = a
+	}
+	have := make(map[string]Asset, len(current))
+	for _, a := range current {
+		have[a.ID] = a
+		if _, ok := wanted[a.ID]; ok {
+			continue
+		}
+		if err := remove(client, addr, a.ID, username, password); err != nil {
+			return err
+		}
+	}
+	for _, a := range want {
+		prev, ok := have[a.ID]
+		var err error
+		switch {
+		case !ok:
+			_, err = send(client, http.MethodPost, fmt.Sprintf("http://%s/api/v1.2/assets", addr), a, username, password)
+		case !prev.Equal(a):
+			_, err = send(client, http.MethodPut, fmt.Sprintf("http://%s/api/v1.2/assets/%s", addr, url.PathEscape(a.ID)), a, username, password)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// send posts or puts a to target and returns the stored asset.
+func send(client *http.Client, method, target string, a Asset, username, password string) (Asset, error) {
+	enabled := 0
+	if a.IsEnabled.True() {
+		enabled = 1
+	}
+	body, err := json.Marshal(map[string]any{
+		"name":             a.Name,
+		"uri":              a.URI,
+		"mimetype":         a.MimeType,
+		"duration":         int(a.Duration),
+		"start_date":       a.StartDate,
+		"end_date":         a.EndDate,
+		"is_enabled":       enabled,
+		"nocache":          0,
+		"play_order":       0,
+		"skip_asset_check": 1,
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+
+	req, err := http.NewRequest(method, target, bytes.NewReader(body))
+	if err != nil {
+		return Asset{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Asset{}, fmt.Errorf("save asset: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return Asset{}, fmt.Errorf("save asset: status %d", resp.StatusCode)
+	}
+
+	var saved Asset
+	if err := json.NewDecoder(resp.Body).Decode(&saved); err != nil {
+		return Asset{}, fmt.Errorf("decode asset: %w", err)
+	}
+	return saved, nil
+}
+
+// remove deletes the asset with id from the Anthias instance at addr.
+func remove(client *http.Client, addr, id, username, password string) error {
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("http://%s/api/v1.2/assets/%s", addr, url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete asset: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("delete asset: status %d", resp.StatusCode)
+	}
+	return nil
+}
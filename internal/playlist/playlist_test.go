@@ -0,0 +1,75 @@
+package playlist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDecodeAsset(t *testing.T) {
+	var assets []Asset
+	data := `[
+		{"name": "a", "duration": "10", "is_enabled": 1},
+		{"name": "b", "duration": 7.5, "is_enabled": false},
+		{"name": "c", "duration": "N/A"}
+	]`
+	if err := json.Unmarshal([]byte(data), &assets); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if assets[0].Duration != 10 || !assets[0].IsEnabled.True() {
+		t.Errorf("a: %+v", assets[0])
+	}
+	if assets[1].Duration != 7 || assets[1].IsEnabled.True() {
+		t.Errorf("b: %+v", assets[1])
+	}
+	if assets[2].Duration != 0 || !assets[2].IsEnabled.True() {
+		t.Errorf("c: %+v", assets[2])
+	}
+}
+
+func TestValidate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing.jpg":
+			http.NotFound(w, r)
+		case "/no-head.html":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	v := NewValidator()
+	v.Now = func() time.Time { return now }
+
+	report := v.Validate([]Asset{
+		{Name: "ok", URI: srv.URL + "/logo.png", MimeType: "image", Duration: 10},
+		{Name: "gone", URI: srv.URL + "/missing.jpg", MimeType: "image", Duration: 10},
+		{Name: "zero", URI: srv.URL + "/logo.png", MimeType: "image"},
+		{Name: "flash", URI: srv.URL + "/logo.swf", MimeType: "flash", Duration: 10},
+		{Name: "expired", URI: srv.URL + "/no-head.html", MimeType: "webpage", Duration: 10, EndDate: "2026-02-28T00:00:00Z"},
+		{Name: "local", URI: "/data/screenly_assets/clip.mp4", MimeType: "video", Duration: 30, IsEnabled: Enabled(false)},
+	})
+
+	want := []struct{ valid, playable bool }{
+		{true, true}, {false, false}, {false, false}, {false, false}, {true, false}, {true, false},
+	}
+	for i, w := range want {
+		got := report.Assets[i]
+		if got.Valid != w.valid || got.Playable != w.playable {
+			t.Errorf("%s: got valid=%v playable=%v (%v)", got.Name, got.Valid, got.Playable, got.Errors)
+		}
+	}
+	if report.Valid != 3 || report.Playable != 1 || report.Blank {
+		t.Errorf("unexpected totals: %+v", report)
+	}
+
+	expired := []Asset{{Name: "old", URI: srv.URL + "/logo.png", MimeType: "image", Duration: 10, EndDate: "2026-01-01 00:00:00"}}
+	if report := v.Validate(expired); !report.Blank {
+		t.Error("expected a playlist with only expired assets to be blank")
+	}
+}
@@ -0,0 +1,467 @@
+// Package qr encodes short text, such as URLs, as QR codes. It implements
+// the parts of ISO/IEC 18004 labels need: byte mode, error correction
+// level M, which survives about 15% of the code being scratched or
+// covered, and versions 1 to 10, up to 213 bytes.
+package qr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLen is the longest text Encode accepts, in bytes.
+const MaxLen = 213
+
+// QuietZone is the light margin, in modules, scanners need around a code.
+const QuietZone = 4
+
+// ErrTooLong is returned for text longer than MaxLen.
+var ErrTooLong = errors.New("qr: text too long")
+
+// Code is an encoded QR code: a square of dark and light modules.
+type Code struct {
+	Size    int // Modules per side
+	modules [][]bool
+}
+
+// Dark reports whether the module at column x, row y is dark. Coordinates
+// outside the code, in the quiet zone, are light.
+func (c *Code) Dark(x, y int) bool {
+	if x < 0 || y < 0 || x >= c.Size || y >= c.Size {
+		return false
+	}
+	return c.modules[y][x]
+}
+
+// Per version 1 to 10 at level M: the total codewords, the error
+// correction codewords per block and the number of blocks.
+var (
+	rawCodewords = [...]int{26, 44, 70, 100, 134, 172, 196, 242, 292, 346}
+	eccPerBlock  = [...]int{10, 16, 26, 18, 24, 16, 18, 22, 22, 26}
+	numBlocks    = [...]int{1, 1, 1, 2, 2, 4, 4, 4, 5, 5}
+)
+
+// alignment lists the alignment pattern centres per version.
+var alignment = [...][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// formatLevelM is level M's error correction bits in the format info.
+const formatLevelM = 0
+
+// Encode returns the smallest code holding text.
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	version := 0
+	for v := 1; v <= len(rawCodewords); v++ {
+		if len(data) <= dataCodewords(v)-headerBytes(v) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d", ErrTooLong, len(data), MaxLen)
+	}
+
+	codewords := interleave(version, dataBits(version, data))
+	best := (*Code)(nil)
+	bestPenalty := 0
+	for mask := 0; mask < 8; mask++ {
+		c := newCode(version)
+		c.drawCodewords(codewords)
+		c.applyMask(mask)
+		c.drawFormat(mask)
+		if p := c.penalty(); best == nil || p < bestPenalty {
+			best, bestPenalty = c.code(), p
+		}
+	}
+	return best, nil
+}
+
+func dataCodewords(version int) int {
+	return rawCodewords[version-1] - eccPerBlock[version-1]*numBlocks[version-1]
+}
+
+// headerBytes is the room the mode and length take, rounded up.
+func headerBytes(version int) int {
+	if version < 10 {
+		return 2 // 4 + 8 bits
+	}
+	return 3 // 4 + 16 bits
+}
+
+// dataBits returns the data codewords: the byte mode header, the text,
+// the terminator and padding.
+func dataBits(version int, data []byte) []byte {
+	var bb bitBuffer
+	bb.append(0b0100, 4)
+	if version < 10 {
+		bb.append(len(data), 8)
+	} else {
+		bb.append(len(data), 16)
+	}
+	for _, b := range data {
+		bb.append(int(b), 8)
+	}
+	capacity := dataCodewords(version) * 8
+	bb.append(0, min(4, capacity-bb.len()))
+	bb.append(0, (8-bb.len()%8)%8)
+	for pad := 0xEC; bb.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bb.append(pad, 8)
+	}
+	return bb.bytes()
+}
+
+// interleave splits data into blocks, adds each block's error correction
+// and interleaves the results as the code stores them.
+func interleave(version int, data []byte) []byte {
+	blocks := numBlocks[version-1]
+	ecc := eccPerBlock[version-1]
+	short := len(data) / blocks
+	numShort := blocks - len(data)%blocks
+	divisor := rsDivisor(ecc)
+
+	var dataBlocks, eccBlocks [][]byte
+	for i, off := 0, 0; i < blocks; i++ {
+		n := short
+		if i >= numShort {
+			n++
+		}
+		block := data[off : off+n]
+		off += n
+		dataBlocks = append(dataBlocks, block)
+		eccBlocks = append(eccBlocks, rsRemainder(block, divisor))
+	}
+
+	var out []byte
+	for i := 0; i <= short; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for _, block := range eccBlocks {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// builder is a code being drawn, with the modules that belong to fixed
+// patterns marked so data and masks leave them alone.
+type builder struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newCode(version int) *builder {
+	size := version*4 + 17
+	b := &builder{version: version, size: size}
+	b.modules = make([][]bool, size)
+	b.function = make([][]bool, size)
+	for i := range b.modules {
+		b.modules[i] = make([]bool, size)
+		b.function[i] = make([]bool, size)
+	}
+
+	for i := 0; i < size; i++ {
+		b.set(6, i, i%2 == 0)
+		b.set(i, 6, i%2 == 0)
+	}
+	b.finder(3, 3)
+	b.finder(size-4, 3)
+	b.finder(3, size-4)
+	pos := alignment[version-1]
+	for i, x := range pos {
+		for j, y := range pos {
+			last := len(pos) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue // Overlaps a finder
+			}
+			b.align(x, y)
+		}
+	}
+	b.drawFormat(0) // Reserve the area; drawn for real once the mask is chosen
+	b.drawVersion()
+	return b
+}
+
+func (b *builder) set(x, y int, dark bool) {
+	b.modules[y][x] = dark
+	b.function[y][x] = true
+}
+
+func (b *builder) finder(cx, cy int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			x, y := cx+dx, cy+dy
+			if x < 0 || y < 0 || x >= b.size || y >= b.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			b.set(x, y, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (b *builder) align(cx, cy int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			b.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormat draws both copies of the format info for mask, and the dark
+// module beside them.
+func (b *builder) drawFormat(mask int) {
+	bits := formatBits(formatLevelM<<3 | mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+	for i := 0; i <= 5; i++ {
+		b.set(8, i, bit(i))
+	}
+	b.set(8, 7, bit(6))
+	b.set(8, 8, bit(7))
+	b.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		b.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		b.set(b.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		b.set(8, b.size-15+i, bit(i))
+	}
+	b.set(8, b.size-8, true)
+}
+
+// formatBits returns the 15 format info bits for the 5 data bits.
+func formatBits(data int) int {
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// drawVersion draws the version info versions 7 and up carry.
+func (b *builder) drawVersion() {
+	if b.version < 7 {
+		return
+	}
+	bits := versionBits(b.version)
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 == 1
+		x, y := b.size-11+i%3, i/3
+		b.set(x, y, dark)
+		b.set(y, x, dark)
+	}
+}
+
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// drawCodewords fills the data area, two columns at a time, in the
+// zigzag the standard lays out, skipping the vertical timing pattern.
+func (b *builder) drawCodewords(data []byte) {
+	i := 0
+	for right := b.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < b.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if upward {
+					y = b.size - 1 - vert
+				}
+				if b.function[y][x] || i >= len(data)*8 {
+					continue // Remainder bits stay light
+				}
+				b.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+func (b *builder) applyMask(mask int) {
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			if !b.function[y][x] && masked(mask, x, y) {
+				b.modules[y][x] = !b.modules[y][x]
+			}
+		}
+	}
+}
+
+func masked(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+// penalty scores how hard the code is to scan; the mask with the lowest
+// score is used. Any mask decodes, so this only needs to be a fair guide.
+func (b *builder) penalty() int {
+	p := 0
+	dark := 0
+	for i := 0; i < b.size; i++ {
+		p += runPenalty(func(j int) bool { return b.modules[i][j] }, b.size)
+		p += runPenalty(func(j int) bool { return b.modules[j][i] }, b.size)
+	}
+	for y := 0; y < b.size; y++ {
+		for x := 0; x < b.size; x++ {
+			if b.modules[y][x] {
+				dark++
+			}
+			if x+1 < b.size && y+1 < b.size {
+				c := b.modules[y][x]
+				if c == b.modules[y][x+1] && c == b.modules[y+1][x] && c == b.modules[y+1][x+1] {
+					p += 3
+				}
+			}
+		}
+	}
+	total := b.size * b.size
+	p += abs(dark*20-total*10) / total * 10
+	return p
+}
+
+// finderLike is the 1:1:3:1:1 pattern scanners look for, with light space
+// on one side.
+var finderLike = [...]bool{true, false, true, true, true, false, true, false, false, false, false}
+
+// runPenalty scores one row or column: long runs of one colour, and
+// stretches that look like a finder.
+func runPenalty(at func(int) bool, n int) int {
+	p := 0
+	run := 1
+	for j := 1; j <= n; j++ {
+		if j < n && at(j) == at(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			p += run - 2
+		}
+		run = 1
+	}
+	for j := 0; j+len(finderLike) <= n; j++ {
+		fwd, back := true, true
+		for k, want := range finderLike {
+			fwd = fwd && at(j+k) == want
+			back = back && at(j+len(finderLike)-1-k) == want
+		}
+		if fwd {
+			p += 40
+		}
+		if back {
+			p += 40
+		}
+	}
+	return p
+}
+
+// code returns the finished code.
+func (b *builder) code() *Code {
+	return &Code{Size: b.size, modules: b.modules}
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of degree n,
+// without its leading term, highest power first.
+func rsDivisor(n int) []byte {
+	result := make([]byte, n)
+	result[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			result[j] = gfMul(result[j], root)
+			if j+1 < n {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords for data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMul(d, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer struct {
+	bits []bool
+}
+
+func (bb *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bb.bits = append(bb.bits, v>>i&1 == 1)
+	}
+}
+
+func (bb *bitBuffer) len() int { return len(bb.bits) }
+
+func (bb *bitBuffer) bytes() []byte {
+	out := make([]byte, len(bb.bits)/8)
+	for i, bit := range bb.bits {
+		if bit {
+			out[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,182 @@
+package qr
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// The worked example from the standard: HELLO WORLD as 1-M.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if got := formatBits(formatLevelM<<3 | 0); got != 0b101010000010010 {
+		t.Errorf("M mask 0: expected 101010000010010, got %015b", got)
+	}
+	if got := formatBits(1<<3 | 0); got != 0b111011111000100 {
+		t.Errorf("L mask 0: expected 111011111000100, got %015b", got)
+	}
+	if got := versionBits(7); got != 0x07C94 {
+		t.Errorf("version 7: expected 0x07C94, got %#05x", got)
+	}
+}
+
+func TestDataBits(t *testing.T) {
+	got := dataBits(1, []byte("a"))
+	want := []byte{0x40, 0x16, 0x10, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC}
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected % x, got % x", want, got)
+	}
+}
+
+func TestEncodeVersions(t *testing.T) {
+	cases := []struct {
+		n    int
+		size int
+	}{
+		{14, 21},  // Version 1 holds 14 bytes at M
+		{15, 25},  // Version 2
+		{107, 45}, // Version 7, with version info
+		{213, 57}, // Version 10, with a 16-bit length
+	}
+	for _, c := range cases {
+		text := strings.Repeat("x", c.n)
+		code, err := Encode(text)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", c.n, err)
+		}
+		if code.Size != c.size {
+			t.Errorf("%d bytes: expected size %d, got %d", c.n, c.size, code.Size)
+		}
+		if got := decode(t, code); got != text {
+			t.Errorf("%d bytes: decoded %q", c.n, got)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("x", MaxLen+1)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestEncodeURL(t *testing.T) {
+	url := "http://192.168.1.20:8080/?host=3f2b9c1e-6a77-4d0e-9a51-2c8e7f4b1d60"
+	code, err := Encode(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decode(t, code); got != url {
+		t.Errorf("expected %q, got %q", url, got)
+	}
+	if code.Dark(-1, 0) || code.Dark(0, code.Size) {
+		t.Error("expected the quiet zone light")
+	}
+	if !code.Dark(0, 0) || !code.Dark(code.Size-1, 0) || !code.Dark(0, code.Size-1) {
+		t.Error("expected finder corners dark")
+	}
+}
+
+// decode reads text back from a code the way a scanner would once it has
+// found the grid: the format info, then the unmasked codewords.
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	version := (c.Size - 17) / 4
+	b := newCode(version)
+
+	format := 0
+	read := func(i, x, y int) {
+		if c.Dark(x, y) {
+			format |= 1 << i
+		}
+	}
+	for i := 0; i <= 5; i++ {
+		read(i, 8, i)
+	}
+	read(6, 8, 7)
+	read(7, 8, 8)
+	read(8, 7, 8)
+	for i := 9; i < 15; i++ {
+		read(i, 14-i, 8)
+	}
+	data := (format ^ 0x5412) >> 10
+	if formatBits(data) != format || data>>3 != formatLevelM {
+		t.Fatalf("bad format info %015b", format)
+	}
+	mask := data & 7
+
+	var bits bitBuffer
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if b.function[y][x] {
+					continue
+				}
+				dark := c.Dark(x, y) != masked(mask, x, y)
+				if dark {
+					bits.append(1, 1)
+				} else {
+					bits.append(0, 1)
+				}
+			}
+		}
+	}
+	codewords := bits.bytes()[:rawCodewords[version-1]]
+
+	// Undo the interleaving, checking each block's error correction.
+	blocks := numBlocks[version-1]
+	ecc := eccPerBlock[version-1]
+	total := dataCodewords(version)
+	short := total / blocks
+	numShort := blocks - total%blocks
+	dataBlocks := make([][]byte, blocks)
+	i := 0
+	for k := 0; k <= short; k++ {
+		for n := range dataBlocks {
+			if k < short || n >= numShort {
+				dataBlocks[n] = append(dataBlocks[n], codewords[i])
+				i++
+			}
+		}
+	}
+	var plain []byte
+	for n, block := range dataBlocks {
+		want := rsRemainder(block, rsDivisor(ecc))
+		for k := range want {
+			if codewords[total+k*blocks+n] != want[k] {
+				t.Fatalf("block %d: error correction does not match", n)
+			}
+		}
+		plain = append(plain, block...)
+	}
+
+	if plain[0]>>4 != 0b0100 {
+		t.Fatalf("expected byte mode, got %04b", plain[0]>>4)
+	}
+	var n, start int
+	if version < 10 {
+		n = int(plain[0]&0x0F)<<4 | int(plain[1]>>4)
+		start = 1
+	} else {
+		n = int(plain[0]&0x0F)<<12 | int(plain[1])<<4 | int(plain[2]>>4)
+		start = 2
+	}
+	out := make([]byte, n)
+	for k := range out {
+		out[k] = plain[start+k]<<4 | plain[start+k+1]>>4
+	}
+	return string(out)
+}
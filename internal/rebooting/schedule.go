@@ -0,0 +1,415 @@
+// Package rebooting reboots hosts on a schedule, such as nightly at 04:00,
+// for venues that restart their players regularly. Each reboot starts
+// inside a window on the host's own clock and is put off while someone is
+// editing the host or a calendar booking is on, so it never cuts into work
+// or an event. A schedule's Starlark script can hold a reboot back on
+// other conditions, such as too much of the fleet being down already.
+package rebooting
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/calendar"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/script"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Settings keys of the schedules and of what the scheduler last did for
+// each host.
+const (
+	SettingKey      = "rebooting.schedules"
+	StateSettingKey = "rebooting.state"
+)
+
+// Audit actions recorded for scheduled reboots.
+const (
+	AuditRebooted = "reboot.scheduled"
+	AuditSkipped  = "reboot.skipped"
+	AuditFailed   = "reboot.failed"
+)
+
+// Run states.
+const (
+	RunWaiting   = "waiting"   // Due, but held back or the host could not be reached; retried until the window closes
+	RunRebooting = "rebooting" // Asked to reboot; waiting for its next boot
+	RunDone      = "done"
+	RunSkipped   = "skipped" // The window closed before the reboot could start
+	RunFailed    = "failed"  // The host did not come back
+)
+
+// DefaultWindow is how long after its time a reboot may start when a
+// schedule does not say.
+const DefaultWindow = 60
+
+// BootTimeout is how long a host may take to report a new boot after it
+// was asked to reboot.
+const BootTimeout = 15 * time.Minute
+
+// Schedule reboots a set of hosts at a time of day.
+type Schedule struct {
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Enabled       bool              `json:"enabled"`
+	Hosts         []string          `json:"hosts,omitempty"`  // Host IDs
+	Filter        *hosts.ViewFilter `json:"filter,omitempty"` // Or the hosts a filter selects when the reboot is due, e.g. a building's subnet
+	View          string            `json:"view,omitempty"`   // Saved view Filter was copied from, for reference
+	At            string            `json:"at"`               // "04:00", on each host's clock
+	Days          []string          `json:"days,omitempty"`   // mon ... sun; empty means every day
+	WindowMinutes int               `json:"window_minutes"`   // How long after At the reboot may still start
+	Script        string            `json:"script,omitempty"` // Starlark condition a reboot waits for; sees host as well as the fleet (see package script)
+}
+
+// Validate normalizes s and checks its settings. Schedules without an ID
+// are given one.
+func (s *Schedule) Validate() error {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(s.Hosts) == 0 && s.Filter == nil {
+		return errors.New("set hosts or a filter")
+	}
+	if _, err := time.Parse("15:04", s.At); err != nil {
+		return errors.New("at must be a time of day such as 04:00")
+	}
+	for i, d := range s.Days {
+		name, ok := types.ParseDay(d)
+		if !ok {
+			return fmt.Errorf("unknown day %q (use mon ... sun)", d)
+		}
+		s.Days[i] = name
+	}
+	if s.WindowMinutes == 0 {
+		s.WindowMinutes = DefaultWindow
+	}
+	if s.WindowMinutes < 1 || s.WindowMinutes > 12*60 {
+		return errors.New("window_minutes must be between 1 and 720")
+	}
+	if s.Script != "" {
+		if _, err := s.compile(); err != nil {
+			return fmt.Errorf("script: %w", err)
+		}
+	}
+	if s.ID == "" {
+		s.ID = uuid.New().String()
+	}
+	return nil
+}
+
+func (s Schedule) compile() (*script.Program, error) {
+	return script.Compile(s.Script, append(slices.Clone(script.FleetNames), script.HostName)...)
+}
+
+// Targets returns the hosts in list the schedule reboots.
+func (s Schedule) Targets(list []types.Host) []types.Host {
+	var out []types.Host
+	for _, h := range list {
+		if slices.Contains(s.Hosts, h.ID) || (s.Filter != nil && s.Filter.Matches(h)) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// LastDue returns the most recent time the schedule was due at or before
+// local, a time on the host's clock, or false if it is never due.
+func (s Schedule) LastDue(local time.Time) (time.Time, bool) {
+	at, err := time.Parse("15:04", s.At)
+	if err != nil {
+		return time.Time{}, false
+	}
+	for d := 0; d <= 7; d++ {
+		day := local.AddDate(0, 0, -d)
+		due := time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, local.Location())
+		if due.After(local) {
+			continue
+		}
+		if len(s.Days) == 0 || slices.Contains(s.Days, types.DayName(due.Weekday())) {
+			return due, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// LoadSchedules returns the stored schedules.
+func LoadSchedules(store hosts.SettingStore) ([]Schedule, error) {
+	list := []Schedule{}
+	if _, err := store.GetSetting(SettingKey, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// SaveSchedules validates and stores the full schedule list, replacing the
+// old one.
+func SaveSchedules(store hosts.SettingStore, list []Schedule) ([]Schedule, error) {
+	seen := make(map[string]bool)
+	for i := range list {
+		if err := list[i].Validate(); err != nil {
+			return nil, fmt.Errorf("schedule %d: %w", i+1, err)
+		}
+		if seen[list[i].ID] {
+			return nil, fmt.Errorf("schedule %d: duplicate id %q", i+1, list[i].ID)
+		}
+		seen[list[i].ID] = true
+	}
+	return list, store.PutSetting(SettingKey, list)
+}
+
+// Run is what the scheduler last did about a schedule for one host.
+type Run struct {
+	ScheduleID  string    `json:"schedule_id"`
+	HostID      string    `json:"host_id"`
+	Due         time.Time `json:"due"` // On the host's clock
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"` // Why it is waiting, was skipped or failed
+	TriggeredAt time.Time `json:"triggered_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+}
+
+// LoadState returns the last run of each schedule and host, keyed by
+// schedule ID and host ID joined by a slash.
+func LoadState(store hosts.SettingStore) (map[string]*Run, error) {
+	state := make(map[string]*Run)
+	if _, err := store.GetSetting(StateSettingKey, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Scheduler starts due reboots and follows them until the host is back.
+type Scheduler struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+	editing  func(hostID string) bool // Whether someone is editing the host
+	trigger  func(h types.Host) error // Asks the host to reboot
+}
+
+// NewScheduler creates a scheduler that checks the schedules every minute
+// and reboots hosts by posting to their /api/hosts/reboot, signed by
+// signer. editing reports the hosts locked for editing on this node's
+// dashboard; it may be nil.
+func NewScheduler(store *hosts.Store, lg *logger.Logger, signer *peerauth.Signer, editing func(hostID string) bool) *Scheduler {
+	if editing == nil {
+		editing = func(string) bool { return false }
+	}
+	trigger := func(h types.Host) error { return postReboot(h, signer) }
+	return &Scheduler{store: store, logger: lg, interval: time.Minute, editing: editing, trigger: trigger}
+}
+
+// Run checks the schedules until the process exits.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		s.Check(time.Now())
+	}
+}
+
+// Check follows reboots in progress, then starts those that are due.
+func (s *Scheduler) Check(now time.Time) {
+	schedules, err := LoadSchedules(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Rebooting: failed to load schedules: %v", err))
+		return
+	}
+	state, err := LoadState(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Rebooting: failed to load state: %v", err))
+		return
+	}
+	booking := activeBooking(s.store, now)
+
+	hostList := s.store.GetAll()
+	var fleet script.Vars
+	next := make(map[string]*Run)
+	for _, sched := range schedules {
+		if !sched.Enabled {
+			continue
+		}
+		var prog *script.Program
+		if sched.Script != "" {
+			if prog, err = sched.compile(); err != nil {
+				s.logger.Warning(fmt.Sprintf("Rebooting: script of %s does not compile: %v", sched.Name, err))
+			}
+			if fleet == nil {
+				fleet = s.fleet(hostList, now)
+			}
+		}
+		for _, h := range sched.Targets(hostList) {
+			key := sched.ID + "/" + h.ID
+			run := state[key]
+			if run != nil && run.State == RunRebooting {
+				s.follow(sched, h, run, now)
+			}
+
+			due, ok := sched.LastDue(h.InZone(now))
+			open := ok && h.InZone(now).Sub(due) < time.Duration(sched.WindowMinutes)*time.Minute
+			switch {
+			case run != nil && run.Due.Equal(due):
+				// Already handled, or waiting since earlier in the window.
+			case open:
+				run = &Run{ScheduleID: sched.ID, HostID: h.ID, Due: due, State: RunWaiting}
+			}
+			if run == nil {
+				continue
+			}
+			if run.State == RunWaiting {
+				if open && run.Due.Equal(due) {
+					s.start(sched, h, run, booking, s.held(sched, prog, fleet, h), now)
+				} else {
+					run.State = RunSkipped
+					run.FinishedAt = now.UTC()
+					s.logger.Warning(fmt.Sprintf("Rebooting: skipped %s reboot of %s: %s", sched.Name, hostLabel(h), run.Reason))
+					s.audit(AuditSkipped, h, sched, run.Reason)
+				}
+			}
+			next[key] = run
+		}
+	}
+
+	// Runs of removed schedules or hosts are dropped.
+	if err := s.store.PutSetting(StateSettingKey, next); err != nil {
+		s.logger.Warning(fmt.Sprintf("Rebooting: failed to save state: %v", err))
+	}
+}
+
+// fleet returns the variables schedule scripts see.
+func (s *Scheduler) fleet(hostList []types.Host, now time.Time) script.Vars {
+	peers := make(map[string]hosts.Peer)
+	if list, err := s.store.ListPeers(); err == nil {
+		for _, p := range list {
+			peers[p.NodeID] = p
+		}
+	}
+	return script.Fleet(hostList, peers, now)
+}
+
+// held runs the schedule's script for h and returns why it holds the
+// reboot back, or "" if the reboot may go ahead. A script that fails holds
+// it back, so a broken script never reboots anything.
+func (s *Scheduler) held(sched Schedule, prog *script.Program, fleet script.Vars, h types.Host) string {
+	switch {
+	case sched.Script == "":
+		return ""
+	case prog == nil:
+		return "script does not compile"
+	}
+	holds, _, err := prog.Result(fleet.WithHost(h.ID))
+	switch {
+	case err != nil:
+		return "script failed: " + err.Error()
+	case !holds:
+		return "script held it back"
+	}
+	return ""
+}
+
+// start reboots h unless something holds it back, leaving run waiting with
+// the reason if so. held is why the schedule's script holds it back, if it
+// does.
+func (s *Scheduler) start(sched Schedule, h types.Host, run *Run, booking, held string, now time.Time) {
+	switch {
+	case s.editing(h.ID):
+		run.Reason = "host was being edited"
+		return
+	case booking != "":
+		run.Reason = "calendar booking " + booking + " was on"
+		return
+	case held != "":
+		run.Reason = held
+		return
+	}
+	if err := s.trigger(h); err != nil {
+		run.Reason = err.Error()
+		return
+	}
+	run.State = RunRebooting
+	run.Reason = ""
+	run.TriggeredAt = now.UTC()
+	s.logger.Info(fmt.Sprintf("Rebooting: rebooting %s for %s", hostLabel(h), sched.Name))
+	s.audit(AuditRebooted, h, sched, "due "+run.Due.Format("2006-01-02 15:04 MST"))
+}
+
+// follow marks run done once h reports a boot after the reboot was asked
+// for, or failed when it takes longer than BootTimeout.
+func (s *Scheduler) follow(sched Schedule, h types.Host, run *Run, now time.Time) {
+	boots, err := s.store.ListReboots(h.ID, run.TriggeredAt)
+	if err != nil {
+		return
+	}
+	if len(boots) > 0 {
+		run.State = RunDone
+		run.FinishedAt = boots[0].RecordedAt
+		s.logger.Info(fmt.Sprintf("Rebooting: %s is back after its %s reboot (%s)", hostLabel(h), sched.Name,
+			boots[0].RecordedAt.Sub(run.TriggeredAt).Round(time.Second)))
+		return
+	}
+	if now.Sub(run.TriggeredAt) < BootTimeout {
+		return
+	}
+	run.State = RunFailed
+	run.Reason = fmt.Sprintf("no new boot reported within %s", BootTimeout)
+	run.FinishedAt = now.UTC()
+	s.logger.Error(fmt.Sprintf("Rebooting: %s did not come back from its %s reboot", hostLabel(h), sched.Name))
+	s.audit(AuditFailed, h, sched, run.Reason)
+}
+
+func (s *Scheduler) audit(action string, h types.Host, sched Schedule, detail string) {
+	if err := s.store.AppendAudit(hosts.AuditEntry{Actor: "nsm", ActorType: hosts.ActorSystem, Action: action,
+		Target: h.ID, Detail: fmt.Sprintf("%s: %s", sched.Name, detail)}); err != nil {
+		s.logger.Warning(fmt.Sprintf("Rebooting: failed to write audit entry: %v", err))
+	}
+}
+
+// activeBooking names the calendar booking on at now, whose preset has
+// taken over the screens, or returns "" if there is none.
+func activeBooking(store *hosts.Store, now time.Time) string {
+	state, err := calendar.LoadState(store)
+	if err != nil || state.Booking == nil || !now.Before(state.Booking.End) {
+		return ""
+	}
+	return fmt.Sprintf("%q", state.Booking.Summary)
+}
+
+func hostLabel(h types.Host) string {
+	if h.Nickname != "" {
+		return h.Nickname
+	}
+	return h.IPAddress
+}
+
+// postReboot asks the node of h to reboot itself. The request names no
+// target, so the node acts on itself.
+func postReboot(h types.Host, signer *peerauth.Signer) error {
+	url := fmt.Sprintf("http://%s:8080/api/hosts/reboot", hosts.SelectPath(h).Address)
+	body := []byte("{}")
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	signer.Sign(req, body)
+	client := http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
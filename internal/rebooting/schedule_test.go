@@ -0,0 +1,174 @@
+package rebooting
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/calendar"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newTestScheduler(t *testing.T, ids ...string) (*Scheduler, *hosts.Store, *[]string, map[string]bool) {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for i, id := range ids {
+		store.Add(types.Host{ID: id, IPAddress: "192.168.1." + string(rune('1'+i))})
+	}
+
+	var triggered []string
+	editing := make(map[string]bool)
+	s := NewScheduler(store, logger.New(10), nil, func(id string) bool { return editing[id] })
+	s.trigger = func(h types.Host) error {
+		triggered = append(triggered, h.ID)
+		return nil
+	}
+	return s, store, &triggered, editing
+}
+
+func save(t *testing.T, store *hosts.Store, list ...Schedule) {
+	t.Helper()
+	if _, err := SaveSchedules(store, list); err != nil {
+		t.Fatalf("SaveSchedules: %v", err)
+	}
+}
+
+func runOf(store *hosts.Store, id string) *Run {
+	state, _ := LoadState(store)
+	for _, run := range state {
+		if run.HostID == id {
+			return run
+		}
+	}
+	return nil
+}
+
+func TestScheduledReboot(t *testing.T) {
+	s, store, triggered, _ := newTestScheduler(t, "a", "b")
+	save(t, store, Schedule{Name: "Nightly", Enabled: true, Hosts: []string{"a"}, At: "04:00"})
+
+	night := time.Date(2026, 3, 2, 3, 59, 0, 0, time.UTC)
+	s.Check(night)
+	if len(*triggered) != 0 {
+		t.Fatalf("expected nothing before 04:00, got %v", *triggered)
+	}
+	s.Check(night.Add(time.Minute))
+	s.Check(night.Add(2 * time.Minute))
+	if !slices.Equal(*triggered, []string{"a"}) {
+		t.Fatalf("expected one reboot of a, got %v", *triggered)
+	}
+	if run := runOf(store, "a"); run == nil || run.State != RunRebooting {
+		t.Fatalf("expected a rebooting, got %+v", run)
+	}
+
+	// The host's next boot completes the run.
+	store.RecordBoot("a", hosts.BootReport{BootID: "next"}, night, night.Add(3*time.Minute))
+	s.Check(night.Add(4 * time.Minute))
+	if run := runOf(store, "a"); run.State != RunDone {
+		t.Errorf("expected the reboot done, got %+v", run)
+	}
+
+	// And it runs again the next night.
+	s.Check(night.Add(24*time.Hour + time.Minute))
+	if len(*triggered) != 2 {
+		t.Errorf("expected a second reboot the next night, got %v", *triggered)
+	}
+}
+
+func TestScheduledRebootWaits(t *testing.T) {
+	s, store, triggered, editing := newTestScheduler(t, "a")
+	save(t, store, Schedule{Name: "Nightly", Enabled: true, Hosts: []string{"a"}, At: "04:00", WindowMinutes: 30})
+	due := time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC)
+
+	editing["a"] = true
+	s.Check(due)
+	if run := runOf(store, "a"); len(*triggered) != 0 || run.State != RunWaiting || run.Reason != "host was being edited" {
+		t.Fatalf("expected the reboot held back, got %v %+v", *triggered, run)
+	}
+	editing["a"] = false
+	store.PutSetting(calendar.StateSettingKey, calendar.State{Booking: &calendar.Booking{
+		Event: calendar.Event{Summary: "Board meeting", Start: due.Add(-time.Hour), End: due.Add(20 * time.Minute)}}})
+	s.Check(due.Add(10 * time.Minute))
+	if len(*triggered) != 0 {
+		t.Fatalf("expected no reboot during a booking, got %v", *triggered)
+	}
+	s.Check(due.Add(20 * time.Minute))
+	if len(*triggered) != 1 {
+		t.Fatalf("expected the reboot once the booking ended, got %v", *triggered)
+	}
+
+	// A reboot held back until the window closes is skipped.
+	editing["a"] = true
+	s.Check(due.Add(24 * time.Hour))
+	s.Check(due.Add(24*time.Hour + 30*time.Minute))
+	if run := runOf(store, "a"); run.State != RunSkipped || len(*triggered) != 1 {
+		t.Errorf("expected the second night skipped, got %+v", run)
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: AuditSkipped})
+	if len(entries) != 1 {
+		t.Errorf("expected the skip audited, got %d entries", len(entries))
+	}
+}
+
+func TestScheduledRebootScript(t *testing.T) {
+	s, store, triggered, _ := newTestScheduler(t, "a", "b")
+	save(t, store, Schedule{Name: "Nightly", Enabled: true, Hosts: []string{"a", "b"}, At: "04:00",
+		Script: `host.id != "b" and len(hosts) == 2`})
+	due := time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC)
+
+	s.Check(due)
+	if !slices.Equal(*triggered, []string{"a"}) {
+		t.Fatalf("expected only a rebooted, got %v", *triggered)
+	}
+	if run := runOf(store, "b"); run == nil || run.State != RunWaiting || run.Reason != "script held it back" {
+		t.Errorf("expected b held back by the script, got %+v", run)
+	}
+}
+
+func TestScheduledRebootFails(t *testing.T) {
+	s, store, _, _ := newTestScheduler(t, "a")
+	save(t, store, Schedule{Name: "Nightly", Enabled: true, Filter: &hosts.ViewFilter{Subnets: []string{"192.168.1.0/24"}}, At: "04:00"})
+	due := time.Date(2026, 3, 2, 4, 0, 0, 0, time.UTC)
+
+	s.Check(due)
+	s.Check(due.Add(BootTimeout))
+	if run := runOf(store, "a"); run == nil || run.State != RunFailed {
+		t.Errorf("expected a host that never came back to fail, got %+v", run)
+	}
+}
+
+func TestScheduleValidate(t *testing.T) {
+	sched := Schedule{Name: "Weekends", Hosts: []string{"a"}, At: "03:30", Days: []string{"Saturday", "SUN"}}
+	if err := sched.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !slices.Equal(sched.Days, []string{"sat", "sun"}) || sched.WindowMinutes != DefaultWindow || sched.ID == "" {
+		t.Errorf("unexpected normalized schedule %+v", sched)
+	}
+
+	// Monday 2 March 2026: the last weekend slot was Sunday morning.
+	due, ok := sched.LastDue(time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	if !ok || !due.Equal(time.Date(2026, 3, 1, 3, 30, 0, 0, time.UTC)) {
+		t.Errorf("LastDue = %v", due)
+	}
+
+	for _, bad := range []Schedule{
+		{Name: "x", Hosts: []string{"a"}, At: "25:00"},
+		{Name: "x", At: "04:00"},
+		{Name: "x", Hosts: []string{"a"}, At: "04:00", Days: []string{"someday"}},
+		{Name: "x", Hosts: []string{"a"}, At: "04:00", WindowMinutes: 1000},
+		{Name: "x", Hosts: []string{"a"}, At: "04:00", Script: `host.health ==`},
+		{Name: "x", Hosts: []string{"a"}, At: "04:00", Script: `hots[0]`},
+	} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("expected %+v rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// InventoryReport lists the hardware of every host, for asset management.
+type InventoryReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Total       int            `json:"total"`
+	Unreported  int            `json:"unreported"` // Hosts that have not sent their hardware, such as older NSM versions
+	ByModel     map[string]int `json:"by_model"`
+	Hosts       []InventoryRow `json:"hosts"`
+}
+
+// InventoryRow is one host's hardware. The inventory fields are empty for
+// hosts that have not reported it.
+type InventoryRow struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IPAddress string `json:"ip_address"`
+	hosts.Inventory
+}
+
+// BuildInventory joins the host list with the hardware the hosts reported.
+// Hosts are listed by name, like the fleet report.
+func BuildInventory(hostList []types.Host, inventory map[string]hosts.Inventory, now time.Time) InventoryReport {
+	report := InventoryReport{
+		GeneratedAt: now,
+		Total:       len(hostList),
+		ByModel:     make(map[string]int),
+		Hosts:       make([]InventoryRow, 0, len(hostList)),
+	}
+
+	for _, h := range hostList {
+		name := h.Nickname
+		if name == "" {
+			name = h.Hostname
+		}
+		if name == "" {
+			name = h.IPAddress
+		}
+
+		inv, ok := inventory[h.ID]
+		if !ok {
+			report.Unreported++
+		} else if inv.Model != "" {
+			report.ByModel[inv.Model]++
+		}
+		report.Hosts = append(report.Hosts, InventoryRow{ID: h.ID, Name: name, IPAddress: h.IPAddress, Inventory: inv})
+	}
+
+	sort.SliceStable(report.Hosts, func(i, j int) bool {
+		return report.Hosts[i].Name < report.Hosts[j].Name
+	})
+	return report
+}
+
+// RenderInventoryCSV writes one row per host, with sizes in whole
+// megabytes so spreadsheets can sum them.
+func RenderInventoryCSV(r InventoryReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"name", "ip_address", "host_id", "model", "serial", "os", "kernel", "ram_mb", "sd_card_mb", "reported_at"})
+	for _, h := range r.Hosts {
+		reportedAt := ""
+		if !h.ReportedAt.IsZero() {
+			reportedAt = h.ReportedAt.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			h.Name,
+			h.IPAddress,
+			h.ID,
+			h.Model,
+			h.Serial,
+			h.OS,
+			h.Kernel,
+			megabytes(h.RAMBytes),
+			megabytes(h.SDCardBytes),
+			reportedAt,
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// megabytes formats a size in MiB, or nothing if it is unknown.
+func megabytes(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n>>20, 10)
+}
@@ -0,0 +1,112 @@
+package reports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestDueSince(t *testing.T) {
+	// Wednesday 2024-05-15 10:00
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+
+	weekly := dueSince(Config{Frequency: Weekly, Hour: 8}, now)
+	if want := time.Date(2024, 5, 13, 8, 0, 0, 0, time.UTC); !weekly.Equal(want) {
+		t.Errorf("weekly: expected %v, got %v", want, weekly)
+	}
+
+	monthly := dueSince(Config{Frequency: Monthly, Hour: 8}, now)
+	if want := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC); !monthly.Equal(want) {
+		t.Errorf("monthly: expected %v, got %v", want, monthly)
+	}
+
+	// Before the send hour on the 1st the previous month is still current.
+	early := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	if got, want := dueSince(Config{Frequency: Monthly, Hour: 8}, early), time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("monthly early: expected %v, got %v", want, got)
+	}
+
+	// The hour is on the site's clock: 08:00 Monday in Tokyo is still
+	// Sunday in UTC.
+	cfg := Config{Frequency: Weekly, Hour: 8, Timezone: "Asia/Tokyo"}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	monday := time.Date(2024, 5, 13, 7, 30, 0, 0, time.UTC)
+	if got, want := dueSince(cfg, monday.In(cfg.Location())), time.Date(2024, 5, 12, 23, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("tokyo: expected %v, got %v", want, got)
+	}
+	if err := (&Config{Frequency: Weekly, Timezone: "Nowhere/Special"}).Validate(); err == nil {
+		t.Error("expected unknown timezone to be rejected")
+	}
+}
+
+func TestRenderReports(t *testing.T) {
+	summary := Build([]types.Host{
+		{Nickname: "Lobby (east)", IPAddress: "192.168.1.10", Status: types.StatusHealthy},
+		{ID: "b", IPAddress: "192.168.1.11", Status: types.StatusUnreachable},
+	}, map[string]float64{"b": 87.5}, time.Now())
+
+	if summary.Total != 2 || summary.Healthy != 1 {
+		t.Fatalf("unexpected summary counts: %+v", summary)
+	}
+
+	csvData, err := RenderCSV(summary)
+	if err != nil {
+		t.Fatalf("RenderCSV: %v", err)
+	}
+	if lines := strings.Count(string(csvData), "\n"); lines != 3 {
+		t.Errorf("expected header plus 2 rows, got %d lines", lines)
+	}
+	if !strings.Contains(string(csvData), ",87.50\n") {
+		t.Errorf("expected the uptime in the CSV, got:\n%s", csvData)
+	}
+	if avg, ok := summary.AvgUptime(); !ok || avg != 87.5 {
+		t.Errorf("expected an average over the hosts with samples, got %v, %v", avg, ok)
+	}
+
+	pdf := RenderPDF(summary)
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Errorf("PDF output missing header or trailer")
+	}
+	if !bytes.Contains(pdf, []byte(`Lobby \(east\)`)) {
+		t.Errorf("expected escaped host name in PDF content")
+	}
+}
+
+func TestInventoryReport(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	report := BuildInventory([]types.Host{
+		{ID: "b", Nickname: "Lobby", IPAddress: "192.168.1.10"},
+		{ID: "a", Nickname: "Cafe", IPAddress: "192.168.1.11"},
+		{ID: "c", IPAddress: "192.168.1.12"},
+	}, map[string]hosts.Inventory{
+		"a": {Model: "Raspberry Pi 4 Model B Rev 1.4", Serial: "10000000a1b2c3d4", RAMBytes: 4 << 30, SDCardBytes: 31914983424, ReportedAt: now},
+		"b": {Model: "Raspberry Pi 4 Model B Rev 1.4", RAMBytes: 2 << 30, ReportedAt: now},
+	}, now)
+
+	if report.Total != 3 || report.Unreported != 1 || report.ByModel["Raspberry Pi 4 Model B Rev 1.4"] != 2 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if report.Hosts[0].Name != "192.168.1.12" || report.Hosts[1].Name != "Cafe" {
+		t.Errorf("expected hosts sorted by name, got %+v", report.Hosts)
+	}
+
+	data, err := RenderInventoryCSV(report)
+	if err != nil {
+		t.Fatalf("RenderInventoryCSV: %v", err)
+	}
+	for _, want := range []string{
+		"name,ip_address,host_id,model,serial,os,kernel,ram_mb,sd_card_mb,reported_at\n",
+		"Cafe,192.168.1.11,a,Raspberry Pi 4 Model B Rev 1.4,10000000a1b2c3d4,,,4096,30436,2026-03-02T09:00:00Z\n",
+		"192.168.1.12,192.168.1.12,c,,,,,,,\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %q in the CSV, got:\n%s", want, data)
+		}
+	}
+}
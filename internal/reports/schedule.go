@@ -0,0 +1,257 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/notify"
+)
+
+// Settings keys used by the report scheduler.
+const (
+	ConfigSettingKey   = "reports"
+	lastSentSettingKey = "reports.last_sent"
+)
+
+// Report frequencies.
+const (
+	Weekly  = "weekly"
+	Monthly = "monthly"
+)
+
+// Attachment formats.
+const (
+	FormatCSV = "csv"
+	FormatPDF = "pdf"
+)
+
+// Config controls scheduled report delivery. Weekly reports go out on
+// Mondays and monthly reports on the 1st, at Hour in Timezone.
+type Config struct {
+	Enabled    bool     `json:"enabled"`
+	Frequency  string   `json:"frequency"`
+	Hour       int      `json:"hour"`
+	Timezone   string   `json:"timezone,omitempty"` // IANA name of the site the report is for; empty uses this node's
+	Recipients []string `json:"recipients"`
+	Formats    []string `json:"formats"`
+}
+
+// DefaultConfig is used until an operator saves report settings.
+func DefaultConfig() Config {
+	return Config{
+		Frequency:  Weekly,
+		Hour:       8,
+		Recipients: []string{},
+		Formats:    []string{FormatPDF, FormatCSV},
+	}
+}
+
+// Validate normalises cfg and rejects unusable values.
+func (c *Config) Validate() error {
+	c.Frequency = strings.ToLower(strings.TrimSpace(c.Frequency))
+	if c.Frequency != Weekly && c.Frequency != Monthly {
+		return fmt.Errorf("frequency must be %q or %q", Weekly, Monthly)
+	}
+	if c.Hour < 0 || c.Hour > 23 {
+		return errors.New("hour must be between 0 and 23")
+	}
+	c.Timezone = strings.TrimSpace(c.Timezone)
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", c.Timezone)
+		}
+	}
+	for i, r := range c.Recipients {
+		addr, err := mail.ParseAddress(strings.TrimSpace(r))
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", r)
+		}
+		c.Recipients[i] = addr.Address
+	}
+	if len(c.Formats) == 0 {
+		c.Formats = []string{FormatPDF}
+	}
+	for i, f := range c.Formats {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != FormatCSV && f != FormatPDF {
+			return fmt.Errorf("unsupported report format %q (use csv or pdf)", f)
+		}
+		c.Formats[i] = f
+	}
+	if c.Enabled && len(c.Recipients) == 0 {
+		return errors.New("at least one recipient is required when reports are enabled")
+	}
+	return nil
+}
+
+// Location returns the timezone reports are scheduled in.
+func (c Config) Location() *time.Location {
+	if c.Timezone != "" {
+		if loc, err := time.LoadLocation(c.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// periodStart returns the start of the period a report sent at now
+// covers: the week or month before it.
+func (c Config) periodStart(now time.Time) time.Time {
+	if c.Frequency == Monthly {
+		return now.AddDate(0, -1, 0)
+	}
+	return now.AddDate(0, 0, -7)
+}
+
+// LoadConfig reads the report settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(ConfigSettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the report settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(ConfigSettingKey, cfg)
+}
+
+// Send renders the current fleet summary and emails it to the configured
+// recipients using the shared SMTP settings.
+func Send(store *hosts.Store, cfg Config, now time.Time) error {
+	if len(cfg.Recipients) == 0 {
+		return errors.New("no report recipients configured")
+	}
+
+	smtpCfg, err := notify.LoadSMTP(store)
+	if err != nil {
+		return err
+	}
+
+	summary, err := Fleet(store, cfg.periodStart(now), now)
+	if err != nil {
+		return err
+	}
+	stamp := now.Format("2006-01-02")
+
+	msg := notify.Message{
+		To:      cfg.Recipients,
+		Subject: fmt.Sprintf("nexSign mini %s report: %d/%d hosts healthy", cfg.Frequency, summary.Healthy, summary.Total),
+		Body:    summary.Text(),
+	}
+	for _, format := range cfg.Formats {
+		switch format {
+		case FormatCSV:
+			data, err := RenderCSV(summary)
+			if err != nil {
+				return fmt.Errorf("render csv: %w", err)
+			}
+			msg.Attachments = append(msg.Attachments, notify.Attachment{
+				Filename:    "nsm-report-" + stamp + ".csv",
+				ContentType: "text/csv; charset=utf-8",
+				Data:        data,
+			})
+		case FormatPDF:
+			msg.Attachments = append(msg.Attachments, notify.Attachment{
+				Filename:    "nsm-report-" + stamp + ".pdf",
+				ContentType: "application/pdf",
+				Data:        RenderPDF(summary),
+			})
+		}
+	}
+
+	return notify.NewMailer(smtpCfg).Send(msg)
+}
+
+// dueSince returns the most recent scheduled send time at or before now.
+func dueSince(cfg Config, now time.Time) time.Time {
+	loc := now.Location()
+	switch cfg.Frequency {
+	case Monthly:
+		due := time.Date(now.Year(), now.Month(), 1, cfg.Hour, 0, 0, 0, loc)
+		if now.Before(due) {
+			due = due.AddDate(0, -1, 0)
+		}
+		return due
+	default:
+		daysSinceMonday := (int(now.Weekday()) + 6) % 7
+		due := time.Date(now.Year(), now.Month(), now.Day()-daysSinceMonday, cfg.Hour, 0, 0, 0, loc)
+		if now.Before(due) {
+			due = due.AddDate(0, 0, -7)
+		}
+		return due
+	}
+}
+
+// Scheduler emails reports when they fall due.
+type Scheduler struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+}
+
+// NewScheduler creates a scheduler that checks for due reports every few
+// minutes.
+func NewScheduler(store *hosts.Store, lg *logger.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		logger:   lg,
+		interval: 5 * time.Minute,
+	}
+}
+
+// Run checks for due reports until the process exits.
+func (s *Scheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.check(time.Now())
+	}
+}
+
+func (s *Scheduler) check(now time.Time) {
+	cfg, err := LoadConfig(s.store)
+	if err != nil {
+		s.logger.Warning(fmt.Sprintf("Reports: failed to load settings: %v", err))
+		return
+	}
+	if !cfg.Enabled {
+		return
+	}
+
+	var lastSent time.Time
+	if _, err := s.store.GetSetting(lastSentSettingKey, &lastSent); err != nil {
+		s.logger.Warning(fmt.Sprintf("Reports: failed to read last send time: %v", err))
+		return
+	}
+	if lastSent.IsZero() {
+		// First check after enabling: start counting from now rather than
+		// sending immediately for a period that has already begun.
+		if err := s.store.PutSetting(lastSentSettingKey, now); err != nil {
+			s.logger.Warning(fmt.Sprintf("Reports: failed to record send time: %v", err))
+		}
+		return
+	}
+	if !lastSent.Before(dueSince(cfg, now.In(cfg.Location()))) {
+		return
+	}
+
+	if err := Send(s.store, cfg, now); err != nil {
+		s.logger.Error(fmt.Sprintf("Reports: failed to send %s report: %v", cfg.Frequency, err))
+		return
+	}
+	if err := s.store.PutSetting(lastSentSettingKey, now); err != nil {
+		s.logger.Warning(fmt.Sprintf("Reports: failed to record send time: %v", err))
+	}
+	s.logger.Info(fmt.Sprintf("Reports: sent %s report to %d recipients", cfg.Frequency, len(cfg.Recipients)))
+}
@@ -0,0 +1,220 @@
+// Package reports renders fleet summaries as CSV and PDF and emails them on
+// a weekly or monthly schedule.
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Summary is a point-in-time overview of the fleet.
+type Summary struct {
+	GeneratedAt time.Time                `json:"generated_at"`
+	UptimeSince time.Time                `json:"uptime_since,omitzero"` // Start of the period uptime covers
+	Total       int                      `json:"total"`
+	Healthy     int                      `json:"healthy"`
+	ByStatus    map[types.HostStatus]int `json:"by_status"`
+	Hosts       []HostRow                `json:"hosts"`
+}
+
+// HostRow is one host line in a report.
+type HostRow struct {
+	Name           string           `json:"name"`
+	IPAddress      string           `json:"ip_address"`
+	Status         types.HostStatus `json:"status"`
+	NSMVersion     string           `json:"nsm_version"`
+	AnthiasVersion string           `json:"anthias_version"`
+	AssetCount     int              `json:"asset_count"`
+	LastChecked    time.Time        `json:"last_checked"`
+	UptimePercent  *float64         `json:"uptime_percent,omitempty"` // Share of the period the host was up; nil without samples
+}
+
+// HealthyPercent returns the share of healthy hosts, 0-100.
+func (s Summary) HealthyPercent() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Healthy) * 100 / float64(s.Total)
+}
+
+// AvgUptime returns the mean uptime of the hosts that have one, and false
+// if none do.
+func (s Summary) AvgUptime() (float64, bool) {
+	total, n := 0.0, 0
+	for _, h := range s.Hosts {
+		if h.UptimePercent != nil {
+			total += *h.UptimePercent
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return total / float64(n), true
+}
+
+// Build summarises hostList, with uptime the share of the report period
+// each host was up, by host ID. Hosts are listed by name so reports read
+// the same way as the dashboard.
+func Build(hostList []types.Host, uptime map[string]float64, now time.Time) Summary {
+	summary := Summary{
+		GeneratedAt: now,
+		Total:       len(hostList),
+		ByStatus:    make(map[types.HostStatus]int),
+		Hosts:       make([]HostRow, 0, len(hostList)),
+	}
+
+	for _, h := range hostList {
+		status := h.Status
+		if status == "" {
+			status = types.StatusUnreachable
+		}
+		summary.ByStatus[status]++
+		if status == types.StatusHealthy {
+			summary.Healthy++
+		}
+
+		name := h.Nickname
+		if name == "" {
+			name = h.Hostname
+		}
+		if name == "" {
+			name = h.IPAddress
+		}
+
+		row := HostRow{
+			Name:           name,
+			IPAddress:      h.IPAddress,
+			Status:         status,
+			NSMVersion:     h.NSMVersion,
+			AnthiasVersion: h.AnthiasVersion,
+			AssetCount:     h.AssetCount,
+			LastChecked:    h.LastChecked,
+		}
+		if up, ok := uptime[h.ID]; ok {
+			row.UptimePercent = &up
+		}
+		summary.Hosts = append(summary.Hosts, row)
+	}
+
+	sort.SliceStable(summary.Hosts, func(i, j int) bool {
+		return summary.Hosts[i].Name < summary.Hosts[j].Name
+	})
+
+	return summary
+}
+
+// Fleet summarises the hosts in store at now, with their uptime since
+// since from the metrics the store samples.
+func Fleet(store *hosts.Store, since, now time.Time) (Summary, error) {
+	uptime, err := store.Uptime(since, now)
+	if err != nil {
+		return Summary{}, err
+	}
+	summary := Build(store.GetAll(), uptime, now)
+	summary.UptimeSince = since
+	return summary, nil
+}
+
+// statusOrder lists statuses in the order they appear in reports.
+var statusOrder = []types.HostStatus{
+	types.StatusHealthy,
+	types.StatusStale,
+	types.StatusUnhealthy,
+	types.StatusConnectionRefused,
+	types.StatusUnreachable,
+}
+
+// lines renders the summary header shared by the PDF and email body.
+func (s Summary) lines() []string {
+	out := []string{
+		"nexSign mini fleet report",
+		"Generated: " + s.GeneratedAt.Format("2006-01-02 15:04 MST"),
+		"",
+		fmt.Sprintf("Hosts: %d    Healthy: %d (%.1f%%)", s.Total, s.Healthy, s.HealthyPercent()),
+	}
+	if avg, ok := s.AvgUptime(); ok {
+		out = append(out, fmt.Sprintf("Uptime since %s: %.2f%% on average", s.UptimeSince.Format("2006-01-02"), avg))
+	}
+	for _, status := range statusOrder {
+		if n := s.ByStatus[status]; n > 0 {
+			out = append(out, fmt.Sprintf("  %-20s %d", status, n))
+		}
+	}
+	return out
+}
+
+// Text renders the summary as a plain-text email body.
+func (s Summary) Text() string {
+	var buf bytes.Buffer
+	for _, line := range s.lines() {
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("\nThe full host list is attached.\n")
+	return buf.String()
+}
+
+// RenderCSV writes one row per host.
+func RenderCSV(s Summary) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"name", "ip_address", "status", "nsm_version", "anthias_version", "asset_count", "last_checked", "uptime_percent"})
+	for _, h := range s.Hosts {
+		lastChecked := ""
+		if !h.LastChecked.IsZero() {
+			lastChecked = h.LastChecked.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			h.Name,
+			h.IPAddress,
+			string(h.Status),
+			h.NSMVersion,
+			h.AnthiasVersion,
+			strconv.Itoa(h.AssetCount),
+			lastChecked,
+			h.uptime("%.2f"),
+		})
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// RenderPDF lays the summary and host table out as a simple text PDF.
+func RenderPDF(s Summary) []byte {
+	lines := s.lines()
+	lines = append(lines, "", fmt.Sprintf("%-24s %-16s %-18s %-10s %-8s %s", "Host", "IP address", "Status", "NSM", "Uptime", "Last checked"))
+	for _, h := range s.Hosts {
+		lastChecked := "never"
+		if !h.LastChecked.IsZero() {
+			lastChecked = h.LastChecked.Format("2006-01-02 15:04")
+		}
+		lines = append(lines, fmt.Sprintf("%-24s %-16s %-18s %-10s %-8s %s",
+			truncate(h.Name, 24), h.IPAddress, h.Status, truncate(h.NSMVersion, 10), h.uptime("%.1f%%"), lastChecked))
+	}
+	return textPDF(lines)
+}
+
+// uptime formats the host's uptime with format, or returns "" without one.
+func (h HostRow) uptime(format string) string {
+	if h.UptimePercent == nil {
+		return ""
+	}
+	return fmt.Sprintf(format, *h.UptimePercent)
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "~"
+}
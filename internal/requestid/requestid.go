@@ -0,0 +1,67 @@
+// Package requestid gives each API request an ID that follows it into the
+// log, its error responses and the requests it makes to peers, so one
+// fleet action can be followed across nodes. A request that arrives with
+// an ID from a peer keeps it.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the ID in requests and responses.
+const Header = "X-Request-ID"
+
+// maxLen bounds IDs accepted from callers.
+const maxLen = 64
+
+type ctxKey struct{}
+
+// New returns a random ID.
+func New() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// With returns ctx carrying id.
+func With(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the ID ctx carries, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Valid reports whether id can be taken from a caller: up to 64 letters,
+// digits, dashes, dots and underscores, so it is safe in logs and HTML.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '.', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware gives each request an ID, the caller's if it sent a valid
+// one, in its context and in the Header of its response.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !Valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(With(r.Context(), id)))
+	})
+}
@@ -0,0 +1,30 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/hosts", nil))
+	if len(seen) != 16 || rec.Header().Get(Header) != seen {
+		t.Errorf("expected a new ID in the context and response, got %q and %q", seen, rec.Header().Get(Header))
+	}
+
+	// A peer's ID is kept; one unsafe to log is replaced.
+	for id, keep := range map[string]bool{"3f2a9c": true, "a b": false, "<script>": false} {
+		req := httptest.NewRequest(http.MethodGet, "/api/hosts", nil)
+		req.Header.Set(Header, id)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if (seen == id) != keep {
+			t.Errorf("%q: expected kept %v, got %q", id, keep, seen)
+		}
+	}
+}
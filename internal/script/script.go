@@ -0,0 +1,239 @@
+// Package script runs Starlark scripts over fleet state, for alert rules
+// and reboot schedules whose conditions are too complex for the built-in
+// settings, such as "three or more Lobby screens are offline during
+// business hours". Starlark is a small dialect of Python designed to be
+// embedded: a script sees only the variables it is given, cannot load
+// other files or reach the network or disk, and each run is capped at
+// MaxSteps, so a script saved through the API can neither touch the node
+// nor hang it.
+//
+// A script is either a single expression, whose value is its result, or a
+// program that assigns result:
+//
+//	len([h for h in hosts if h.health == "offline" and match(h.nickname, "Lobby*")]) >= 3
+//
+//	down = [h.name for h in hosts if h.health == "offline"]
+//	if len(down) >= 3 and hour >= 9 and hour < 17 and weekday in ("mon", "tue", "wed", "thu", "fri"):
+//	    result = "Offline: " + ", ".join(down)
+package script
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Limits on a script.
+const (
+	MaxLength = 4096   // Bytes of source
+	MaxSteps  = 100000 // Starlark execution steps in one run
+)
+
+// FleetNames are the variables every script sees (see Fleet).
+var FleetNames = []string{"hosts", "hour", "minute", "weekday"}
+
+// HostName is the variable of scripts that judge one host, such as a
+// reboot schedule's (see Vars.WithHost).
+const HostName = "host"
+
+// options allow if and for at the top level, so short scripts need no
+// function. while and recursion stay off, so every loop is over a list.
+var options = &syntax.FileOptions{Set: true, TopLevelControl: true, GlobalReassign: true}
+
+// builtins are the functions scripts get beyond the Starlark universe.
+var builtins = starlark.StringDict{
+	"match": starlark.NewBuiltin("match", match),
+}
+
+// Program is a compiled script.
+type Program struct {
+	prog *starlark.Program
+}
+
+// Compile parses src and resolves its names against builtins and the
+// variables in names, so a misspelt variable is reported before the script
+// is saved.
+func Compile(src string, names ...string) (*Program, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, errors.New("script is empty")
+	}
+	if len(src) > MaxLength {
+		return nil, fmt.Errorf("script is longer than %d bytes", MaxLength)
+	}
+	if _, err := syntax.ParseExpr("script", src, 0); err == nil {
+		// The opening parenthesis keeps the expression's line numbers.
+		src = "result = (" + src + "\n)"
+	}
+	predeclared := func(name string) bool {
+		_, ok := builtins[name]
+		for _, n := range names {
+			ok = ok || n == name
+		}
+		return ok
+	}
+	_, prog, err := starlark.SourceProgramOptions(options, "script", src, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	if prog.NumLoads() > 0 {
+		return nil, errors.New("script cannot load other files")
+	}
+	return &Program{prog: prog}, nil
+}
+
+// Run runs the program with vars and returns its result, None if it
+// assigned none.
+func (p *Program) Run(vars Vars) (starlark.Value, error) {
+	thread := &starlark.Thread{Name: "script", Print: func(*starlark.Thread, string) {}}
+	thread.SetMaxExecutionSteps(MaxSteps)
+	predeclared := make(starlark.StringDict, len(vars)+len(builtins))
+	for k, v := range builtins {
+		predeclared[k] = v
+	}
+	for k, v := range vars {
+		predeclared[k] = v
+	}
+	predeclared.Freeze()
+
+	globals, err := p.prog.Init(thread, predeclared)
+	if err != nil {
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) && len(evalErr.CallStack) > 0 {
+			return nil, fmt.Errorf("%s: %s", evalErr.CallStack[len(evalErr.CallStack)-1].Pos, evalErr.Msg)
+		}
+		return nil, err
+	}
+	if v, ok := globals["result"]; ok {
+		return v, nil
+	}
+	return starlark.None, nil
+}
+
+// Result runs the program and reads its result as a condition: True or a
+// non-empty string holds, the string being a message; False, None or an
+// empty string does not.
+func (p *Program) Result(vars Vars) (holds bool, message string, err error) {
+	v, err := p.Run(vars)
+	if err != nil {
+		return false, "", err
+	}
+	switch v := v.(type) {
+	case starlark.Bool:
+		return bool(v), "", nil
+	case starlark.String:
+		return v != "", string(v), nil
+	case starlark.NoneType:
+		return false, "", nil
+	}
+	return false, "", fmt.Errorf("script result is a %s; want True, False or a message", v.Type())
+}
+
+// match reports whether s matches the glob pattern, ignoring case:
+// match(h.nickname, "Lobby*").
+func match(_ *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s, pattern string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &s, &pattern); err != nil {
+		return nil, err
+	}
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(s))
+	if err != nil {
+		return nil, fmt.Errorf("match: invalid pattern %q", pattern)
+	}
+	return starlark.Bool(ok), nil
+}
+
+// Vars are the variables a script runs with.
+type Vars map[string]starlark.Value
+
+// Fleet returns the variables every script sees: hosts, a record of each
+// host in list, and hour, minute and weekday ("mon" ... "sun") on this
+// node's clock at now. peers, by node ID, give the hosts' health and
+// heartbeat details.
+func Fleet(list []types.Host, peers map[string]hosts.Peer, now time.Time) Vars {
+	records := make([]starlark.Value, 0, len(list))
+	for _, h := range list {
+		records = append(records, record(h, peers, now))
+	}
+	local := now.Local()
+	return Vars{
+		"hosts":   starlark.NewList(records),
+		"hour":    starlark.MakeInt(local.Hour()),
+		"minute":  starlark.MakeInt(local.Minute()),
+		"weekday": starlark.String(types.DayName(local.Weekday())),
+	}
+}
+
+// WithHost returns v with host set to the record of the host with id in
+// hosts, or None if it is not there.
+func (v Vars) WithHost(id string) Vars {
+	out := make(Vars, len(v)+1)
+	for k, val := range v {
+		out[k] = val
+	}
+	out[HostName] = starlark.None
+	if list, ok := v["hosts"].(*starlark.List); ok {
+		for i := 0; i < list.Len(); i++ {
+			rec := list.Index(i).(*starlarkstruct.Struct)
+			if got, _ := rec.Attr("id"); got == starlark.String(id) {
+				out[HostName] = rec
+			}
+		}
+	}
+	return out
+}
+
+// record describes h to scripts. Fields are read as h.health and so on.
+func record(h types.Host, peers map[string]hosts.Peer, now time.Time) *starlarkstruct.Struct {
+	health := h.Health
+	lastSeen := -1
+	disk := 0
+	if peer, ok := peers[h.ID]; ok {
+		health = types.DetermineHealth(peer.Liveness(), now, types.DefaultHealthThresholds())
+		if !peer.LastSeen.IsZero() {
+			lastSeen = int(now.Sub(peer.LastSeen).Minutes())
+		}
+		disk = peer.DiskPercent
+	}
+	cms, assets := h.CMSStatus, h.AssetCount
+	if hosts.SelectPath(h).Network == hosts.NetworkVPN {
+		cms, assets = h.CMSStatusVPN, h.AssetCountVPN
+	}
+	name := h.IPAddress
+	switch {
+	case h.Nickname != "":
+		name = h.Nickname
+	case h.Hostname != "":
+		name = h.Hostname
+	}
+	return starlarkstruct.FromStringDict(starlark.String("host"), starlark.StringDict{
+		"id":                starlark.String(h.ID),
+		"name":              starlark.String(name),
+		"nickname":          starlark.String(h.Nickname),
+		"hostname":          starlark.String(h.Hostname),
+		"ip_address":        starlark.String(h.IPAddress),
+		"notes":             starlark.String(h.Notes),
+		"health":            starlark.String(health),
+		"status":            starlark.String(h.Status),
+		"cms_status":        starlark.String(cms),
+		"asset_count":       starlark.MakeInt(assets),
+		"asset_drift":       starlark.String(h.AssetDrift),
+		"nsm_version":       starlark.String(h.NSMVersion),
+		"timezone":          starlark.String(h.Timezone),
+		"local_hour":        starlark.MakeInt(h.InZone(now).Hour()),
+		"time_sync":         starlark.String(h.TimeSync),
+		"latency_ms":        starlark.Float(h.LatencyMS),
+		"loss_percent":      starlark.MakeInt(h.LossPercent),
+		"failed_checks":     starlark.MakeInt(h.FailedChecks),
+		"disk_percent":      starlark.MakeInt(disk),
+		"last_seen_minutes": starlark.MakeInt(lastSeen),
+	})
+}
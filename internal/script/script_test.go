@@ -0,0 +1,137 @@
+package script
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func fleet(t *testing.T) Vars {
+	t.Helper()
+	now := time.Date(2024, 3, 5, 10, 30, 0, 0, time.Local) // A Tuesday
+	list := []types.Host{
+		{ID: "l1", Nickname: "Lobby 1", AssetCount: 3},
+		{ID: "l2", Nickname: "Lobby 2", AssetCount: 3},
+		{ID: "l3", Hostname: "lobby-3", AssetCount: 3},
+		{ID: "bar", Nickname: "Bar", AssetCount: 3},
+		{ID: "l4", Nickname: "Lobby 4", AssetCount: 3},
+	}
+	peers := make(map[string]hosts.Peer)
+	for _, h := range list {
+		peers[h.ID] = hosts.Peer{NodeID: h.ID, BootedAt: now.Add(-2 * time.Hour), SentAt: now.Add(-time.Hour), LastSeen: now.Add(-time.Hour)}
+	}
+	peers["l4"] = hosts.Peer{NodeID: "l4", BootedAt: now.Add(-time.Hour), SentAt: now, LastSeen: now}
+	return Fleet(list, peers, now)
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		src  string
+		want starlark.Value
+	}{
+		{`len([h for h in hosts if h.health == "offline" and match(h.nickname, "lobby*")]) >= 2`, starlark.True},
+		{`hour >= 9 and hour < 17 and weekday in ("mon", "tue", "wed", "thu", "fri")`, starlark.True},
+		{`any([h.name == "Bar" for h in hosts]) and not all([h.health == "offline" for h in hosts])`, starlark.True},
+		{`", ".join([h.name for h in hosts if match(h.name, "Lobby ?") and h.health == "offline"])`, starlark.String("Lobby 1, Lobby 2")},
+		{`[h.name for h in hosts if h.hostname][0]`, starlark.String("lobby-3")},
+		{`len([h for h in hosts if h.asset_count > 3])`, starlark.MakeInt(0)},
+		{"down = [h.name for h in hosts if h.health == \"offline\"]\nif len(down) >= 4:\n    result = \"%d down\" % len(down)", starlark.String("4 down")},
+		{"x = 1 # no result", starlark.None},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src, FleetNames...)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := p.Run(fleet(t))
+		if err != nil {
+			t.Errorf("Run(%q): %v", tt.src, err)
+			continue
+		}
+		if eq, _ := starlark.Equal(got, tt.want); !eq {
+			t.Errorf("Run(%q) = %v; want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	compile := []struct{ src, want string }{
+		{``, "empty"},
+		{strings.Repeat("x", MaxLength+1), "longer than"},
+		{`len(hosts`, "script:1:10: got end of file"},
+		{`exec("rm")`, "undefined: exec"},
+		{`host.name`, "undefined: host"},
+		{`load("os.star", "system")`, "cannot load"},
+		{"while True:\n    pass", "while"},
+	}
+	for _, tt := range compile {
+		if _, err := Compile(tt.src, FleetNames...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v; want %q", tt.src, err, tt.want)
+		}
+	}
+
+	run := []struct{ src, want string }{
+		{`hosts[9].name`, "script:1:16: list index 9 out of range"},
+		{`len([i for i in range(1000000)])`, "too many steps"},
+		{`match("a", "[")`, "invalid pattern"},
+	}
+	for _, tt := range run {
+		p, err := Compile(tt.src, FleetNames...)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		if _, err := p.Run(fleet(t)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Run(%q) error = %v; want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestResult(t *testing.T) {
+	tests := []struct {
+		src     string
+		holds   bool
+		message string
+		err     bool
+	}{
+		{`True`, true, "", false},
+		{`False`, false, "", false},
+		{`None`, false, "", false},
+		{`"Lobby down"`, true, "Lobby down", false},
+		{`""`, false, "", false},
+		{`len(hosts)`, false, "", true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src, FleetNames...)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.src, err)
+		}
+		holds, message, err := p.Result(fleet(t))
+		if holds != tt.holds || message != tt.message || (err != nil) != tt.err {
+			t.Errorf("Result(%q) = %v, %q, %v", tt.src, holds, message, err)
+		}
+	}
+}
+
+func TestWithHost(t *testing.T) {
+	p, err := Compile(`host.health == "online" and host.name == "Lobby 4"`, append(FleetNames, HostName)...)
+	if err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+	vars := fleet(t)
+	if holds, _, err := p.Result(vars.WithHost("l4")); err != nil || !holds {
+		t.Errorf("Result(l4) = %v, %v; want true", holds, err)
+	}
+	if holds, _, err := p.Result(vars.WithHost("l1")); err != nil || holds {
+		t.Errorf("Result(l1) = %v, %v; want false", holds, err)
+	}
+	if _, _, err := p.Result(vars.WithHost("gone")); err == nil {
+		t.Error("expected an error reading a field of a missing host")
+	}
+}
@@ -0,0 +1,240 @@
+// Package simulate runs a fleet of synthetic hosts inside the NSM process,
+// for demos and for trying the dashboard, alerts and schedules without
+// hardware. Each simulated host sends signed heartbeats through the same
+// path as a real node, reports made-up Anthias and health results, and now
+// and then suffers a random incident that clears by itself.
+package simulate
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"time"
+
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// MaxHosts is the most hosts a fleet can simulate, so that their addresses
+// fit in types.SimulatedNetwork with room to spare.
+const MaxHosts = 1000
+
+// Incidents a simulated host can suffer. Each matches an alert condition.
+const (
+	IncidentOffline    = "offline"     // Stops sending heartbeats
+	IncidentCMSOffline = "cms_offline" // Anthias stops answering
+	IncidentNoAssets   = "no_assets"   // The playlist is emptied
+	IncidentDiskFull   = "disk_full"   // Root filesystem at 96%
+	IncidentThrottled  = "throttled"   // Under-voltage and throttling
+	IncidentWeakWiFi   = "weak_wifi"   // Signal drops to about -82 dBm
+	IncidentClock      = "time_sync"   // Loses NTP sync
+	IncidentCrash      = "crash"       // Reboots after losing power
+)
+
+var incidents = []string{IncidentOffline, IncidentCMSOffline, IncidentNoAssets, IncidentDiskFull,
+	IncidentThrottled, IncidentWeakWiFi, IncidentClock, IncidentCrash}
+
+// incidentChance is the chance a healthy host starts an incident on a tick.
+// With the default heartbeat interval, each host has one every half hour
+// or so.
+const incidentChance = 1.0 / 180
+
+// Incidents last between these, except crashes, which are over once the
+// host is back.
+const (
+	minIncident = 2 * time.Minute
+	maxIncident = 10 * time.Minute
+	crashDown   = 30 * time.Second
+)
+
+// sites name the simulated hosts, so views and filters have something to
+// group by.
+var sites = []string{"Lobby", "Cafe", "Reception", "Atrium", "Gym", "Library", "Boardroom", "Canteen"}
+
+// node is one simulated host.
+type node struct {
+	host     types.Host
+	id       *identity.Identity
+	bootedAt time.Time
+	seq      uint64
+	assets   int
+	disk     int
+	signal   int
+	boot     *hosts.BootReport // Sent with the heartbeats of a new boot
+
+	incident string
+	until    time.Time
+}
+
+// Fleet is a set of simulated hosts.
+type Fleet struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+	rand     *rand.Rand
+	chance   float64 // Of an incident per host and tick
+	nodes    []*node
+}
+
+// NewFleet adds n simulated hosts to store, reusing those already there
+// from an earlier run, and returns the fleet that reports for them.
+func NewFleet(store *hosts.Store, lg *logger.Logger, n int) (*Fleet, error) {
+	if n < 1 || n > MaxHosts {
+		return nil, fmt.Errorf("simulated hosts must be between 1 and %d", MaxHosts)
+	}
+	f := &Fleet{
+		store:    store,
+		logger:   lg,
+		interval: types.DefaultHealthThresholds().Interval,
+		rand:     rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+		chance:   incidentChance,
+	}
+
+	now := time.Now().UTC()
+	for i := 1; i <= n; i++ {
+		h := Host(i)
+		if existing, err := store.GetByID(h.ID); err == nil {
+			h = *existing
+		} else if err := store.Add(h); err != nil {
+			return nil, fmt.Errorf("add simulated host %s: %w", h.ID, err)
+		}
+		id, err := identity.Generate()
+		if err != nil {
+			return nil, err
+		}
+		// Pin the new key: keys are not saved, so each run starts afresh.
+		store.DeletePeer(h.ID)
+		f.nodes = append(f.nodes, &node{
+			host:     h,
+			id:       id,
+			bootedAt: now.Add(-time.Duration(f.rand.IntN(30*24)) * time.Hour),
+			assets:   3 + f.rand.IntN(12),
+			disk:     20 + f.rand.IntN(40),
+			signal:   -45 - f.rand.IntN(20),
+		})
+	}
+	return f, nil
+}
+
+// Host returns the i-th simulated host, counting from 1, before any
+// reports.
+func Host(i int) types.Host {
+	base := types.SimulatedNetwork.Addr().As4()
+	ip := netip.AddrFrom4([4]byte{base[0], base[1], byte(i / 250), byte(i%250 + 1)})
+	name := fmt.Sprintf("sim-%03d", i)
+	return types.Host{
+		ID:        name,
+		Hostname:  name,
+		Nickname:  fmt.Sprintf("%s %d", sites[(i-1)%len(sites)], (i-1)/len(sites)+1),
+		IPAddress: ip.String(),
+		Notes:     "Simulated host",
+	}
+}
+
+// Run reports for every simulated host once per heartbeat interval until
+// the process exits.
+func (f *Fleet) Run() {
+	f.logger.Info(fmt.Sprintf("Simulation: running %d simulated hosts", len(f.nodes)))
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	f.Tick(time.Now().UTC())
+	for now := range ticker.C {
+		f.Tick(now.UTC())
+	}
+}
+
+// Tick ends incidents that are over, starts new ones, and sends a heartbeat
+// and check result for each host that is up.
+func (f *Fleet) Tick(now time.Time) {
+	for _, n := range f.nodes {
+		if n.incident != "" && !now.Before(n.until) {
+			f.logger.Info(fmt.Sprintf("Simulation: %s recovered from %s", n.host.Nickname, n.incident))
+			n.incident = ""
+		}
+		if n.incident == "" && f.rand.Float64() < f.chance {
+			f.start(n, incidents[f.rand.IntN(len(incidents))], now)
+		}
+		f.report(n, now)
+	}
+}
+
+// start makes n suffer incident from now, for a random while.
+func (f *Fleet) start(n *node, incident string, now time.Time) {
+	n.incident = incident
+	n.until = now.Add(minIncident + time.Duration(f.rand.Int64N(int64(maxIncident-minIncident))))
+	if incident == IncidentCrash {
+		n.until = now.Add(crashDown)
+		n.bootedAt = n.until
+		n.seq = 0
+		n.boot = &hosts.BootReport{BootID: fmt.Sprintf("%s-%d", n.host.ID, n.until.Unix()), BootedAt: n.until,
+			Shutdown: hosts.ShutdownUnexpected, Evidence: "journal", UnderVoltage: f.rand.IntN(2) == 0}
+	}
+	f.logger.Warning(fmt.Sprintf("Simulation: %s has incident %s until %s", n.host.Nickname, incident, n.until.Format("15:04:05")))
+}
+
+// report sends n's heartbeat through heartbeat.Accept, as if it had
+// arrived over the network, and stores what a health check would have
+// found.
+func (f *Fleet) report(n *node, now time.Time) {
+	down := n.incident == IncidentOffline || n.incident == IncidentCrash
+	f.store.Update(n.host.IPAddress, func(h *types.Host) {
+		h.LastChecked = now
+		h.DashboardURL = ""
+		h.NSMVersion = types.Version
+		switch {
+		case down:
+			h.Status, h.NSMStatus, h.CMSStatus, h.AssetCount = types.StatusUnreachable, "NSM Offline", types.CMSUnknown, 0
+		case n.incident == IncidentCMSOffline:
+			h.Status, h.NSMStatus, h.CMSStatus, h.AssetCount = types.StatusHealthy, "NSM Online", types.CMSOffline, 0
+		case n.incident == IncidentNoAssets:
+			h.Status, h.NSMStatus, h.CMSStatus, h.AssetCount = types.StatusHealthy, "NSM Online", types.CMSOnline, 0
+		default:
+			h.Status, h.NSMStatus, h.CMSStatus, h.AssetCount = types.StatusHealthy, "NSM Online", types.CMSOnline, n.assets
+		}
+	})
+	if down {
+		return
+	}
+
+	n.seq++
+	beat := heartbeat.Beat{
+		NodeID:      n.host.ID,
+		Hostname:    n.host.Hostname,
+		Version:     types.Version,
+		BootedAt:    n.bootedAt,
+		SentAt:      now,
+		Seq:         n.seq,
+		DiskPercent: n.disk + f.rand.IntN(3),
+		TimeSync:    types.TimeSyncSynced,
+		Stratum:     2,
+		Inventory: &hosts.Inventory{Model: "Raspberry Pi 4 Model B Rev 1.5 (simulated)", Serial: n.host.ID,
+			OS: "Raspbian GNU/Linux 12 (bookworm)", RAMBytes: 4 << 30, SDCardBytes: 32 << 30},
+		WiFi: &hosts.WiFi{Interface: "wlan0", SSID: "venue", BSSID: "02:00:00:00:00:01", FreqMHz: 5180,
+			Channel: hosts.WiFiChannel(5180), SignalDBM: n.signal - f.rand.IntN(4)},
+		Boot: n.boot,
+	}
+	var throttled uint32
+	switch n.incident {
+	case IncidentDiskFull:
+		beat.DiskPercent = 96
+	case IncidentThrottled:
+		throttled = 0x50005 // Under-voltage and throttled, now and since boot
+	case IncidentWeakWiFi:
+		beat.WiFi.SignalDBM = -80 - f.rand.IntN(5)
+	case IncidentClock:
+		beat.TimeSync, beat.Stratum = types.TimeSyncUnsynced, 0
+	}
+	beat.Throttled = &throttled
+
+	body, err := heartbeat.Seal(beat, n.id)
+	if err == nil {
+		_, err = heartbeat.Accept(f.store, body, n.host.IPAddress, now)
+	}
+	if err != nil {
+		f.logger.Warning(fmt.Sprintf("Simulation: heartbeat of %s rejected: %v", n.host.ID, err))
+	}
+}
@@ -0,0 +1,107 @@
+package simulate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func newTestFleet(t *testing.T, n int) (*Fleet, *hosts.Store) {
+	t.Helper()
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	f, err := NewFleet(store, logger.New(100), n)
+	if err != nil {
+		t.Fatalf("NewFleet: %v", err)
+	}
+	f.chance = 0
+	return f, store
+}
+
+func health(store *hosts.Store) map[string]types.HealthStatus {
+	out := make(map[string]types.HealthStatus)
+	for _, h := range store.GetAll() {
+		out[h.ID] = h.Health
+	}
+	return out
+}
+
+func TestFleet(t *testing.T) {
+	f, store := newTestFleet(t, 3)
+	list := store.GetAll()
+	if len(list) != 3 {
+		t.Fatalf("Expected 3 simulated hosts, got %d", len(list))
+	}
+	for _, h := range list {
+		if !h.Simulated() {
+			t.Errorf("Expected %s (%s) to be simulated", h.ID, h.IPAddress)
+		}
+	}
+
+	now := time.Now().UTC()
+	f.Tick(now)
+	for id, got := range health(store) {
+		if got != types.HealthOnline {
+			t.Errorf("Expected %s online after its first heartbeat, got %s", id, got)
+		}
+	}
+	h, _ := store.GetByID("sim-001")
+	if h.CMSStatus != types.CMSOnline || h.AssetCount == 0 {
+		t.Errorf("Expected sim-001 to report assets, got %s with %d", h.CMSStatus, h.AssetCount)
+	}
+	if got := store.CheckHealth(h); got != types.StatusHealthy {
+		t.Errorf("Expected a check to keep the simulated status, got %s", got)
+	}
+
+	// An offline host stops sending heartbeats until the incident is over.
+	offline := f.nodes[0]
+	f.start(offline, IncidentOffline, now)
+	f.Tick(now.Add(time.Minute))
+	peer, _ := store.GetPeer("sim-001")
+	if h, _ := store.GetByID("sim-001"); !peer.LastSeen.Equal(now) || h.Status != types.StatusUnreachable {
+		t.Errorf("Expected sim-001 silent and unreachable, last seen %v, status %s", peer.LastSeen, h.Status)
+	}
+	f.Tick(offline.until)
+	if peer, _ := store.GetPeer("sim-001"); !peer.LastSeen.Equal(offline.until) {
+		t.Errorf("Expected sim-001 back once the incident ended, last seen %v", peer.LastSeen)
+	}
+
+	// A crash is recorded as an unexpected reboot.
+	crashed := f.nodes[1]
+	f.start(crashed, IncidentCrash, now)
+	f.Tick(crashed.until)
+	boots, err := store.ListReboots("sim-002", now.Add(-time.Hour))
+	if err != nil || len(boots) != 1 || boots[0].Shutdown != hosts.ShutdownUnexpected {
+		t.Errorf("Expected one unexpected reboot of sim-002, got %+v (%v)", boots, err)
+	}
+}
+
+func TestNewFleetReusesHosts(t *testing.T) {
+	f, store := newTestFleet(t, 2)
+	f.Tick(time.Now().UTC())
+	store.Update(Host(1).IPAddress, func(h *types.Host) { h.Nickname = "Front door" })
+
+	// A restart brings new keys, which must still be accepted.
+	again, err := NewFleet(store, logger.New(100), 2)
+	if err != nil {
+		t.Fatalf("NewFleet: %v", err)
+	}
+	again.chance = 0
+	again.Tick(time.Now().UTC())
+	if len(store.GetAll()) != 2 {
+		t.Errorf("Expected the hosts reused, got %d", len(store.GetAll()))
+	}
+	if h, _ := store.GetByID("sim-001"); h.Nickname != "Front door" || h.Health != types.HealthOnline {
+		t.Errorf("Expected the renamed host kept and online, got %q %s", h.Nickname, h.Health)
+	}
+	if _, err := NewFleet(store, logger.New(100), MaxHosts+1); err == nil {
+		t.Error("Expected too many hosts rejected")
+	}
+}
@@ -0,0 +1,332 @@
+package snmp
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"encoding/binary"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tags the agent handles beyond those the client uses.
+const (
+	tagGetNextRequest = 0xa1
+	tagSetRequest     = 0xa3
+	tagGetBulkRequest = 0xa5
+	tagReport         = 0xa8
+)
+
+// Error statuses in responses.
+const (
+	errStatusNoAccess = 6
+)
+
+// maxBindBytes caps the variable bindings of a response, so GetBulk
+// answers stay well inside one datagram.
+const maxBindBytes = 8000
+
+// MIB returns the variables an agent serves. It is called for each
+// request, so values are current; the order does not matter.
+type MIB func() []Value
+
+// Agent answers SNMP Get, GetNext and GetBulk requests from a MIB, over
+// SNMPv2c with a community and over SNMPv3 with USM users. It is
+// read-only: Set requests are refused.
+type Agent struct {
+	Community string // v2c read community; v2c requests are dropped while empty
+	Users     []User // v3 users
+	MIB       MIB
+
+	// EngineID identifies the agent to v3 clients and Boots counts its
+	// restarts; both must be kept across restarts for v3 clients to
+	// accept it. See LoadEngine.
+	EngineID []byte
+	Boots    int64
+
+	start time.Time
+	once  sync.Once
+	usm   usmState
+}
+
+// Serve answers requests arriving on conn until it is closed.
+func (a *Agent) Serve(conn net.PacketConn) error {
+	a.once.Do(func() { a.start = time.Now() })
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if resp := a.Handle(buf[:n]); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+// Handle answers one request message. It returns nil for messages that
+// get no answer: malformed ones, unknown versions and wrong communities.
+func (a *Agent) Handle(msg []byte) []byte {
+	a.once.Do(func() { a.start = time.Now() })
+
+	tag, body, _, err := readTLV(msg)
+	if err != nil || tag != tagSequence {
+		return nil
+	}
+	tag, v, body, err := readTLV(body)
+	if err != nil || tag != tagInteger {
+		return nil
+	}
+	switch decodeInt(v) {
+	case version2c:
+		return a.handleCommunity(body)
+	case version3:
+		return a.handleUSM(msg, body)
+	}
+	return nil
+}
+
+// Uptime returns the time since the agent started serving, in the
+// hundredths of a second sysUpTime counts.
+func (a *Agent) Uptime() int64 {
+	a.once.Do(func() { a.start = time.Now() })
+	return int64(time.Since(a.start) / (10 * time.Millisecond))
+}
+
+func (a *Agent) handleCommunity(body []byte) []byte {
+	tag, community, body, err := readTLV(body)
+	if err != nil || tag != tagOctetString {
+		return nil
+	}
+	if a.Community == "" || subtle.ConstantTimeCompare(community, []byte(a.Community)) != 1 {
+		return nil
+	}
+	tag, pdu, _, err := readTLV(body)
+	if err != nil {
+		return nil
+	}
+	resp := a.respond(tag, pdu)
+	if resp == nil {
+		return nil
+	}
+	return tlv(tagSequence, concat(
+		tlv(tagInteger, encodeInt(version2c)),
+		tlv(tagOctetString, community),
+		resp,
+	))
+}
+
+// variable is a MIB value with its OID parsed for ordering.
+type variable struct {
+	arcs []uint64
+	Value
+}
+
+// respond answers a request PDU with a Response PDU, or returns nil for
+// PDUs the agent does not answer.
+func (a *Agent) respond(tag byte, pdu []byte) []byte {
+	var ints [3]int64
+	for i := range ints {
+		var v []byte
+		var t byte
+		var err error
+		if t, v, pdu, err = readTLV(pdu); err != nil || t != tagInteger {
+			return nil
+		}
+		ints[i] = decodeInt(v)
+	}
+	reqID := ints[0]
+	t, binds, _, err := readTLV(pdu)
+	if err != nil || t != tagSequence {
+		return nil
+	}
+	var oids [][]uint64
+	var raw [][]byte
+	for len(binds) > 0 {
+		var bind []byte
+		if t, bind, binds, err = readTLV(binds); err != nil || t != tagSequence {
+			return nil
+		}
+		t, oid, _, err := readTLV(bind)
+		if err != nil || t != tagOID {
+			return nil
+		}
+		oids = append(oids, parseArcs(decodeOID(oid)))
+		raw = append(raw, bind)
+	}
+
+	switch tag {
+	case tagGetRequest, tagGetNextRequest, tagGetBulkRequest:
+	case tagSetRequest:
+		var echo []byte
+		for _, b := range raw {
+			echo = append(echo, tlv(tagSequence, b)...)
+		}
+		return responsePDU(reqID, errStatusNoAccess, 1, echo)
+	default:
+		return nil
+	}
+
+	vars := a.variables()
+	var out []byte
+	switch tag {
+	case tagGetRequest:
+		for _, oid := range oids {
+			out = append(out, encodeBind(get(vars, oid))...)
+		}
+	case tagGetNextRequest:
+		for _, oid := range oids {
+			out = append(out, encodeBind(next(vars, oid))...)
+		}
+	case tagGetBulkRequest:
+		nonRepeaters := int(min(max(ints[1], 0), int64(len(oids))))
+		maxRepetitions := int(min(max(ints[2], 0), 1000))
+		for _, oid := range oids[:nonRepeaters] {
+			out = append(out, encodeBind(next(vars, oid))...)
+		}
+		cursors := slices.Clone(oids[nonRepeaters:])
+		for range maxRepetitions {
+			if len(cursors) == 0 {
+				break
+			}
+			var row []byte
+			done := true
+			for i, oid := range cursors {
+				v := next(vars, oid)
+				if v.Type != tagEndOfMibView {
+					done = false
+				}
+				cursors[i] = v.arcs
+				row = append(row, encodeBind(v)...)
+			}
+			if len(out)+len(row) > maxBindBytes && len(out) > 0 {
+				break
+			}
+			out = append(out, row...)
+			if done {
+				break
+			}
+		}
+	}
+	return responsePDU(reqID, 0, 0, out)
+}
+
+func responsePDU(reqID, status, index int64, binds []byte) []byte {
+	return tlv(tagGetResponse, concat(
+		tlv(tagInteger, encodeInt(reqID)),
+		tlv(tagInteger, encodeInt(status)),
+		tlv(tagInteger, encodeInt(index)),
+		tlv(tagSequence, binds),
+	))
+}
+
+// variables returns the MIB sorted by OID.
+func (a *Agent) variables() []variable {
+	var vars []variable
+	if a.MIB != nil {
+		for _, v := range a.MIB() {
+			vars = append(vars, variable{arcs: parseArcs(v.OID), Value: v})
+		}
+	}
+	slices.SortFunc(vars, func(x, y variable) int { return compareArcs(x.arcs, y.arcs) })
+	return vars
+}
+
+// get returns the variable at oid, or noSuchObject.
+func get(vars []variable, oid []uint64) variable {
+	i, found := slices.BinarySearchFunc(vars, oid, func(v variable, oid []uint64) int { return compareArcs(v.arcs, oid) })
+	if found {
+		return vars[i]
+	}
+	return variable{arcs: oid, Value: Value{OID: formatArcs(oid), Type: tagNoSuchObject}}
+}
+
+// next returns the first variable after oid, or endOfMibView.
+func next(vars []variable, oid []uint64) variable {
+	i, found := slices.BinarySearchFunc(vars, oid, func(v variable, oid []uint64) int { return compareArcs(v.arcs, oid) })
+	if found {
+		i++
+	}
+	if i < len(vars) {
+		return vars[i]
+	}
+	return variable{arcs: oid, Value: Value{OID: formatArcs(oid), Type: tagEndOfMibView}}
+}
+
+func encodeBind(v variable) []byte {
+	oid, err := encodeOID(v.OID)
+	if err != nil {
+		oid = []byte{0} // 0.0, for OIDs too short to encode
+	}
+	return tlv(tagSequence, append(tlv(tagOID, oid), encodeValue(v.Value)...))
+}
+
+func encodeValue(v Value) []byte {
+	switch v.Type {
+	case tagInteger:
+		return tlv(tagInteger, encodeInt(v.Int))
+	case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+		return tlv(v.Type, encodeUint(uint64(v.Int)))
+	case tagNull, tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView:
+		return tlv(v.Type, nil)
+	}
+	return tlv(v.Type, v.Bytes)
+}
+
+func encodeUint(v uint64) []byte {
+	b := binary.BigEndian.AppendUint64([]byte{0}, v)
+	for len(b) > 1 && b[0] == 0 && b[1]&0x80 == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// parseArcs splits an OID into its numbers; a malformed OID has none.
+func parseArcs(oid string) []uint64 {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	arcs := make([]uint64, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil
+		}
+		arcs = append(arcs, n)
+	}
+	return arcs
+}
+
+func formatArcs(arcs []uint64) string {
+	parts := make([]string, len(arcs))
+	for i, a := range arcs {
+		parts[i] = strconv.FormatUint(a, 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+func compareArcs(x, y []uint64) int {
+	for i := range min(len(x), len(y)) {
+		if c := cmp.Compare(x[i], y[i]); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(x), len(y))
+}
+
+// Constructors for MIB values.
+
+func integerValue(oid string, n int64) Value { return Value{OID: oid, Type: tagInteger, Int: n} }
+func gaugeValue(oid string, n int64) Value   { return Value{OID: oid, Type: tagGauge32, Int: n} }
+func ticksValue(oid string, n int64) Value   { return Value{OID: oid, Type: tagTimeTicks, Int: n} }
+func counterValue(oid string, n int64) Value { return Value{OID: oid, Type: tagCounter32, Int: n} }
+
+func stringValue(oid, s string) Value {
+	return Value{OID: oid, Type: tagOctetString, Bytes: []byte(s)}
+}
+
+func oidValue(oid, value string) Value {
+	enc, _ := encodeOID(value)
+	return Value{OID: oid, Type: tagOID, Bytes: enc}
+}
@@ -0,0 +1,259 @@
+package snmp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func testAgent() *Agent {
+	return &Agent{
+		Community: "facilities",
+		Users: []User{
+			{Name: "auth", AuthProtocol: AuthSHA, AuthPassword: "maplesyrup"},
+			{Name: "priv", AuthProtocol: AuthSHA256, AuthPassword: "maplesyrup", PrivProtocol: PrivAES, PrivPassword: "pancakes!"},
+		},
+		EngineID: NewEngineID(),
+		Boots:    3,
+		MIB: func() []Value {
+			return []Value{
+				stringValue("1.3.6.1.9.2.1.2.2", "Gym"),
+				gaugeValue("1.3.6.1.9.1.2.0", 2),
+				stringValue("1.3.6.1.9.2.1.2.1", "Lobby"),
+				gaugeValue("1.3.6.1.9.1.3.0", 3000000000),
+			}
+		},
+	}
+}
+
+// pdu builds a request PDU of the given type.
+func pdu(tag byte, reqID, a, b int64, oids ...string) []byte {
+	var binds []byte
+	for _, oid := range oids {
+		enc, _ := encodeOID(oid)
+		binds = append(binds, tlv(tagSequence, append(tlv(tagOID, enc), tlv(tagNull, nil)...))...)
+	}
+	return tlv(tag, concat(
+		tlv(tagInteger, encodeInt(reqID)),
+		tlv(tagInteger, encodeInt(a)),
+		tlv(tagInteger, encodeInt(b)),
+		tlv(tagSequence, binds),
+	))
+}
+
+func v2c(community string, pdu []byte) []byte {
+	return tlv(tagSequence, concat(
+		tlv(tagInteger, encodeInt(version2c)),
+		tlv(tagOctetString, []byte(community)),
+		pdu,
+	))
+}
+
+func oidsOf(values []Value) []string {
+	var out []string
+	for _, v := range values {
+		out = append(out, v.OID)
+	}
+	return out
+}
+
+func TestAgentV2c(t *testing.T) {
+	a := testAgent()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer conn.Close()
+	go a.Serve(conn)
+
+	client := &Client{Address: conn.LocalAddr().String(), Community: "facilities"}
+	values, err := client.Get("1.3.6.1.9.1.2.0", "1.3.6.1.9.1.3.0", "1.3.6.1.9.1.9.0")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if values[0].Int != 2 || values[1].Int != 3000000000 || !values[2].Missing() {
+		t.Errorf("unexpected values %+v", values)
+	}
+
+	if resp := a.Handle(v2c("public", pdu(tagGetRequest, 1, 0, 0, "1.3.6.1.9.1.2.0"))); resp != nil {
+		t.Error("expected a wrong community to be ignored")
+	}
+
+	_, values, err = decodeResponse(a.Handle(v2c("facilities", pdu(tagGetNextRequest, 2, 0, 0, "1.3.6.1.9", "1.3.6.1.9.2.1.2.2"))))
+	if err != nil {
+		t.Fatalf("GetNext: %v", err)
+	}
+	if got := oidsOf(values); got[0] != "1.3.6.1.9.1.2.0" || values[1].Type != tagEndOfMibView {
+		t.Errorf("GetNext: got %v", got)
+	}
+
+	// Walk everything after the counts in one GetBulk.
+	_, values, err = decodeResponse(a.Handle(v2c("facilities", pdu(tagGetBulkRequest, 3, 1, 10, "1.3.6.1.9.1", "1.3.6.1.9.1.3.0"))))
+	if err != nil {
+		t.Fatalf("GetBulk: %v", err)
+	}
+	want := []string{"1.3.6.1.9.1.2.0", "1.3.6.1.9.2.1.2.1", "1.3.6.1.9.2.1.2.2", "1.3.6.1.9.2.1.2.2"}
+	if got := oidsOf(values); len(got) != len(want) || got[2] != want[2] || values[3].Type != tagEndOfMibView {
+		t.Errorf("GetBulk: got %v, want %v", got, want)
+	}
+
+	if _, _, err := decodeResponse(a.Handle(v2c("facilities", pdu(tagSetRequest, 4, 0, 0, "1.3.6.1.9.1.2.0")))); err == nil {
+		t.Error("expected Set to be refused")
+	}
+}
+
+func TestLocalizeKey(t *testing.T) {
+	// RFC 3414, A.3.2.
+	engineID, _ := hex.DecodeString("000000000000000000000002")
+	want, _ := hex.DecodeString("6695febc9288e36282235fc7151f128497b38f3f")
+	if got := localizeKey(User{AuthProtocol: AuthSHA}.hash(), "maplesyrup", engineID); !bytes.Equal(got, want) {
+		t.Errorf("got %x, want %x", got, want)
+	}
+}
+
+// v3Response opens a response to a client of a, returning its flags and
+// the values of its PDU.
+func v3Response(t *testing.T, a *Agent, u *User, msg []byte) (byte, []Value) {
+	t.Helper()
+	_, body, _, _ := readTLV(msg)
+	_, _, body, _ = readTLV(body) // version
+	_, global, body, _ := readTLV(body)
+	_, params, body, _ := readTLV(body)
+	tag, data, _, _ := readTLV(body)
+	for range 2 {
+		_, _, global, _ = readTLV(global)
+	}
+	_, flags, _, _ := readTLV(global)
+	p, err := parseUSMParams(params)
+	if err != nil {
+		t.Fatalf("parseUSMParams: %v", err)
+	}
+
+	if flags[0]&flagAuth != 0 {
+		authKey, _ := a.keys(*u)
+		zeroed := bytes.Clone(msg)
+		off := cap(msg) - cap(p.authParams)
+		clear(zeroed[off : off+len(p.authParams)])
+		if !bytes.Equal(p.authParams, digest(*u, authKey, zeroed)) {
+			t.Fatalf("response digest does not match")
+		}
+	}
+	if tag == tagOctetString {
+		_, privKey := a.keys(*u)
+		_, data, _, _ = readTLV(aesCFB(privKey, p.boots, p.time, p.privParams, data, false))
+	}
+	_, _, data, _ = readTLV(data) // contextEngineID
+	_, _, data, _ = readTLV(data) // contextName
+	if data[0] == tagReport {
+		data = append([]byte{tagGetResponse}, data[1:]...) // Decodes the same
+	}
+	_, values, err := decodeResponse(v2c("", data))
+	if err != nil {
+		t.Fatalf("decodeResponse: %v", err)
+	}
+	return flags[0], values
+}
+
+func TestAgentV3(t *testing.T) {
+	a := testAgent()
+	get := pdu(tagGetRequest, 7, 0, 0, "1.3.6.1.9.1.2.0")
+
+	// Discovery: an empty engine ID gets a report with the agent's.
+	discovery := (&Agent{}).encodeUSM(1, flagReportable, nil, nil, nil, get)
+	flags, values := v3Response(t, a, nil, a.Handle(discovery))
+	if flags != 0 || len(values) != 1 || values[0].OID != usmStatsUnknownEngineIDs {
+		t.Fatalf("expected an unknown engine ID report, got %x %+v", flags, values)
+	}
+
+	// A client that knows the engine, as it does after discovery.
+	client := &Agent{EngineID: a.EngineID, Boots: a.Boots}
+	for _, u := range a.Users {
+		level := byte(flagAuth)
+		if u.PrivPassword != "" {
+			level |= flagPriv
+		}
+		flags, values := v3Response(t, a, &u, a.Handle(client.encodeUSM(2, level|flagReportable, &u, []byte(u.Name), nil, get)))
+		if flags != level || len(values) != 1 || values[0].Int != 2 {
+			t.Errorf("%s: got flags %x and %+v", u.Name, flags, values)
+		}
+	}
+
+	wrong := a.Users[0]
+	wrong.AuthPassword = "wrong password"
+	_, values = v3Response(t, a, nil, a.Handle(client.encodeUSM(3, flagAuth|flagReportable, &wrong, []byte(wrong.Name), nil, get)))
+	if len(values) != 1 || values[0].OID != usmStatsWrongDigests {
+		t.Errorf("expected a wrong digest report, got %+v", values)
+	}
+
+	// The privacy user may not skip encryption.
+	priv := a.Users[1]
+	_, values = v3Response(t, a, nil, a.Handle(client.encodeUSM(4, flagAuth|flagReportable, &priv, []byte(priv.Name), nil, get)))
+	if len(values) != 1 || values[0].OID != usmStatsUnsupportedSecLevels {
+		t.Errorf("expected an unsupported security level report, got %+v", values)
+	}
+
+	stale := &Agent{EngineID: a.EngineID, Boots: a.Boots - 1}
+	flags, values = v3Response(t, a, &a.Users[0], a.Handle(stale.encodeUSM(5, flagAuth|flagReportable, &a.Users[0], []byte("auth"), nil, get)))
+	if flags != flagAuth || len(values) != 1 || values[0].OID != usmStatsNotInTimeWindows {
+		t.Errorf("expected an authenticated time window report, got %x %+v", flags, values)
+	}
+}
+
+func TestFleetMIB(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	store.Add(types.Host{ID: "b", Nickname: "Lobby", IPAddress: "10.0.0.2", Status: types.StatusHealthy})
+	store.Add(types.Host{ID: "a", Nickname: "Gym", IPAddress: "10.0.0.1", Status: types.StatusUnreachable})
+
+	a := &Agent{Community: "facilities"}
+	a.MIB = FleetMIB(store, DefaultBaseOID, a)
+	values := make(map[string]Value)
+	for _, v := range a.MIB() {
+		values[v.OID] = v
+	}
+	checks := map[string]int64{
+		DefaultBaseOID + ".1.2.0":   2, // hostCount
+		DefaultBaseOID + ".1.8.0":   1, // hostsReachable
+		DefaultBaseOID + ".2.1.5.1": 2, // Gym, unreachable
+		DefaultBaseOID + ".2.1.5.2": 1, // Lobby
+		DefaultBaseOID + ".2.1.1.2": 2,
+	}
+	for oid, want := range checks {
+		if got := values[oid].Int; got != want {
+			t.Errorf("%s: got %d, want %d", oid, got, want)
+		}
+	}
+	if got := values[DefaultBaseOID+".2.1.2.1"].String(); got != "Gym" {
+		t.Errorf("expected rows in host ID order, got %q first", got)
+	}
+}
+
+func TestAgentConfig(t *testing.T) {
+	cfg := AgentConfig{Enabled: true}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected an enabled agent without credentials to be refused")
+	}
+	cfg = AgentConfig{Enabled: true, Users: []User{{Name: "nms", AuthProtocol: AuthSHA, AuthPassword: "short"}}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a short password to be refused")
+	}
+
+	current := AgentConfig{Community: "facilities", Users: []User{{Name: "nms", AuthProtocol: AuthSHA, AuthPassword: "maplesyrup"}}}
+	cfg = current.Masked()
+	if cfg.Community == current.Community || cfg.Users[0].AuthPassword == current.Users[0].AuthPassword {
+		t.Fatalf("expected secrets to be masked, got %+v", cfg)
+	}
+	cfg.Unmask(current)
+	if err := cfg.Validate(); err != nil || cfg.Port != DefaultAgentPort || !sameConfig(cfg, AgentConfig{Port: DefaultAgentPort, BaseOID: DefaultBaseOID, Community: "facilities", Users: current.Users}) {
+		t.Errorf("expected the secrets back and defaults filled in, got %+v (%v)", cfg, err)
+	}
+}
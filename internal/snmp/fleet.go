@@ -0,0 +1,288 @@
+package snmp
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// AgentSettingKey is the settings key holding the AgentConfig;
+// engineSettingKey holds the engine ID and boot count.
+const (
+	AgentSettingKey  = "snmp_agent"
+	engineSettingKey = "snmp_engine"
+)
+
+// DefaultBaseOID roots the fleet variables in Net-SNMP's playpen arc,
+// which is set aside for local use. Sites with their own enterprise
+// number can move them with BaseOID.
+const DefaultBaseOID = "1.3.6.1.4.1.8072.9999.9999.1"
+
+// DefaultAgentPort is the standard SNMP port.
+const DefaultAgentPort = 161
+
+// MIB-2 system group variables the agent also serves.
+const (
+	oidSysDescr    = "1.3.6.1.2.1.1.1.0"
+	oidSysObjectID = "1.3.6.1.2.1.1.2.0"
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSysName     = "1.3.6.1.2.1.1.5.0"
+)
+
+// AgentConfig controls the SNMP agent exposing fleet health. It is off by
+// default.
+type AgentConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Port      int    `json:"port,omitempty"`      // UDP port; DefaultAgentPort if zero
+	Community string `json:"community,omitempty"` // v2c read-only community; v2c is off while empty
+	Users     []User `json:"users,omitempty"`     // v3 users
+	BaseOID   string `json:"base_oid,omitempty"`  // Root of the fleet variables; DefaultBaseOID if empty
+}
+
+// Validate fills in defaults and rejects unusable values.
+func (c *AgentConfig) Validate() error {
+	if c.Port == 0 {
+		c.Port = DefaultAgentPort
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.BaseOID == "" {
+		c.BaseOID = DefaultBaseOID
+	}
+	if _, err := encodeOID(c.BaseOID); err != nil || len(parseArcs(c.BaseOID)) < 2 {
+		return fmt.Errorf("invalid base_oid %q", c.BaseOID)
+	}
+	names := make(map[string]bool)
+	for _, u := range c.Users {
+		if err := u.Validate(); err != nil {
+			return err
+		}
+		if names[u.Name] {
+			return fmt.Errorf("duplicate user %s", u.Name)
+		}
+		names[u.Name] = true
+	}
+	if c.Enabled && c.Community == "" && len(c.Users) == 0 {
+		return errors.New("set a community or add a v3 user to enable the agent")
+	}
+	return nil
+}
+
+// Masked returns a copy safe to show, with the community and passwords
+// hidden.
+func (c AgentConfig) Masked() AgentConfig {
+	if c.Community != "" {
+		c.Community = maskedCommunity
+	}
+	c.Users = slices.Clone(c.Users)
+	for i := range c.Users {
+		c.Users[i].AuthPassword = maskedCommunity
+		if c.Users[i].PrivPassword != "" {
+			c.Users[i].PrivPassword = maskedCommunity
+		}
+	}
+	return c
+}
+
+// Unmask restores secrets the client sent back masked or empty from
+// current, the stored settings, matching users by name.
+func (c *AgentConfig) Unmask(current AgentConfig) {
+	if c.Community == maskedCommunity {
+		c.Community = current.Community
+	}
+	for i, u := range c.Users {
+		j := slices.IndexFunc(current.Users, func(old User) bool { return old.Name == u.Name })
+		if j < 0 {
+			continue
+		}
+		if u.AuthPassword == "" || u.AuthPassword == maskedCommunity {
+			c.Users[i].AuthPassword = current.Users[j].AuthPassword
+		}
+		if u.PrivProtocol != "" && (u.PrivPassword == "" || u.PrivPassword == maskedCommunity) {
+			c.Users[i].PrivPassword = current.Users[j].PrivPassword
+		}
+	}
+}
+
+// LoadAgentConfig reads the agent settings.
+func LoadAgentConfig(store hosts.SettingStore) (AgentConfig, error) {
+	var cfg AgentConfig
+	if _, err := store.GetSetting(AgentSettingKey, &cfg); err != nil {
+		return AgentConfig{}, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// SaveAgentConfig validates and stores the agent settings.
+func SaveAgentConfig(store hosts.SettingStore, cfg AgentConfig) (AgentConfig, error) {
+	if err := cfg.Validate(); err != nil {
+		return AgentConfig{}, err
+	}
+	return cfg, store.PutSetting(AgentSettingKey, cfg)
+}
+
+// engineState is kept across restarts, as v3 clients expect.
+type engineState struct {
+	ID    string `json:"id"` // Hex
+	Boots int64  `json:"boots"`
+}
+
+// LoadEngine returns the node's engine ID, created on first use, and
+// counts a boot.
+func LoadEngine(store hosts.SettingStore) ([]byte, int64, error) {
+	var st engineState
+	if _, err := store.GetSetting(engineSettingKey, &st); err != nil {
+		return nil, 0, err
+	}
+	id, err := hex.DecodeString(st.ID)
+	if err != nil || len(id) < 5 {
+		id = NewEngineID()
+		st.ID = hex.EncodeToString(id)
+	}
+	st.Boots++
+	return id, st.Boots, store.PutSetting(engineSettingKey, st)
+}
+
+// FleetMIB serves the fleet's health from store under base, plus the
+// MIB-2 system group for a.
+//
+//	base.1.1.0      nsmVersion       OCTET STRING  this node's NSM version
+//	base.1.2.0      hostCount        Gauge32
+//	base.1.3.0      hostsOnline      Gauge32       by heartbeat health
+//	base.1.4.0      hostsDegraded    Gauge32
+//	base.1.5.0      hostsOffline     Gauge32
+//	base.1.6.0      hostsStarting    Gauge32
+//	base.1.7.0      hostsMaintenance Gauge32
+//	base.1.8.0      hostsReachable   Gauge32
+//	base.2.1.c.i    hostTable        one row per host, i from 1 in host ID order:
+//	                c=1 index, 2 name, 3 address, 4 health, 5 reachable
+//	                (1 true, 2 false), 6 NSM version, 7 latency in ms, 8 ID
+func FleetMIB(store hosts.HostStore, base string, a *Agent) MIB {
+	return func() []Value {
+		sysName, _ := os.Hostname()
+		vars := []Value{
+			stringValue(oidSysDescr, "nexSign mini "+types.Version),
+			oidValue(oidSysObjectID, base),
+			ticksValue(oidSysUpTime, a.Uptime()),
+			stringValue(oidSysName, sysName),
+			stringValue(base+".1.1.0", types.Version),
+		}
+
+		list := store.GetAll()
+		slices.SortFunc(list, func(x, y types.Host) int { return strings.Compare(x.ID, y.ID) })
+		counts := make(map[types.HealthStatus]int64)
+		var reachable int64
+		for i, h := range list {
+			index := strconv.Itoa(i + 1)
+			counts[h.Health]++
+			up := int64(2)
+			if Reachable(h) {
+				up = 1
+				reachable++
+			}
+			name := h.Nickname
+			if name == "" {
+				name = h.Hostname
+			}
+			col := func(c int) string { return fmt.Sprintf("%s.2.1.%d.%s", base, c, index) }
+			vars = append(vars,
+				integerValue(col(1), int64(i+1)),
+				stringValue(col(2), name),
+				stringValue(col(3), h.IPAddress),
+				stringValue(col(4), string(h.Health)),
+				integerValue(col(5), up),
+				stringValue(col(6), h.NSMVersion),
+				gaugeValue(col(7), int64(h.LatencyMS)),
+				stringValue(col(8), h.ID),
+			)
+		}
+
+		vars = append(vars, gaugeValue(base+".1.2.0", int64(len(list))))
+		for i, health := range []types.HealthStatus{types.HealthOnline, types.HealthDegraded, types.HealthOffline, types.HealthStarting, types.HealthMaintenance} {
+			vars = append(vars, gaugeValue(fmt.Sprintf("%s.1.%d.0", base, i+3), counts[health]))
+		}
+		return append(vars, gaugeValue(base+".1.8.0", reachable))
+	}
+}
+
+// Reachable reports whether the last health check reached the host over
+// the LAN or the VPN, even if NSM or Anthias did not answer properly.
+func Reachable(h types.Host) bool {
+	up := func(s types.HostStatus) bool { return s != "" && s != types.StatusUnreachable }
+	return up(h.Status) || up(h.StatusVPN)
+}
+
+// FleetAgent runs the SNMP agent while its settings enable it.
+type FleetAgent struct {
+	store    *hosts.Store
+	logger   *logger.Logger
+	interval time.Duration
+}
+
+// NewFleetAgent returns an agent runner that picks up settings changes
+// within 10 seconds.
+func NewFleetAgent(store *hosts.Store, lg *logger.Logger) *FleetAgent {
+	return &FleetAgent{store: store, logger: lg, interval: 10 * time.Second}
+}
+
+// Run serves the agent, restarting it when its settings change.
+func (f *FleetAgent) Run() {
+	var (
+		current AgentConfig
+		conn    net.PacketConn
+	)
+	engineID, boots, err := LoadEngine(f.store)
+	if err != nil {
+		f.logger.Error(fmt.Sprintf("SNMP agent: engine state not saved: %v", err))
+	}
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for first := true; ; <-ticker.C {
+		cfg, err := LoadAgentConfig(f.store)
+		if err != nil {
+			f.logger.Warning(fmt.Sprintf("SNMP agent: failed to load settings: %v", err))
+			continue
+		}
+		if !cfg.Enabled {
+			cfg = AgentConfig{}
+		}
+		if !first && sameConfig(cfg, current) {
+			continue
+		}
+		first, current = false, cfg
+		if conn != nil {
+			conn.Close()
+			conn = nil
+			f.logger.Info("SNMP agent stopped")
+		}
+		if !cfg.Enabled {
+			continue
+		}
+
+		conn, err = net.ListenPacket("udp", fmt.Sprintf(":%d", cfg.Port))
+		if err != nil {
+			f.logger.Error(fmt.Sprintf("SNMP agent: cannot listen on UDP port %d: %v", cfg.Port, err))
+			continue
+		}
+		a := &Agent{Community: cfg.Community, Users: cfg.Users, EngineID: engineID, Boots: boots}
+		a.MIB = FleetMIB(f.store, cfg.BaseOID, a)
+		go a.Serve(conn)
+		f.logger.Info(fmt.Sprintf("SNMP agent listening on UDP port %d (v2c %t, %d v3 users)", cfg.Port, cfg.Community != "", len(cfg.Users)))
+	}
+}
+
+func sameConfig(a, b AgentConfig) bool {
+	return a.Enabled == b.Enabled && a.Port == b.Port && a.Community == b.Community &&
+		a.BaseOID == b.BaseOID && slices.Equal(a.Users, b.Users)
+}
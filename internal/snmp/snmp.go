@@ -0,0 +1,327 @@
+// Package snmp is a minimal SNMPv2c client, enough to ask a managed switch
+// which port a MAC address was learned on. It only sends GetRequests, so
+// it needs read-only community access and nothing else.
+package snmp
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BER tags used by SNMPv2c.
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagIPAddress      = 0x40
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagTimeTicks      = 0x43
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+	tagGetRequest     = 0xa0
+	tagGetResponse    = 0xa2
+)
+
+const version2c = 1
+
+// ErrMalformed is returned for responses that are not valid SNMP.
+var ErrMalformed = errors.New("snmp: malformed response")
+
+// Value is one variable binding from a response.
+type Value struct {
+	OID   string
+	Type  byte
+	Int   int64  // INTEGER, counters, gauges and time ticks
+	Bytes []byte // OCTET STRING, IpAddress
+}
+
+// Missing reports whether the agent has no value for the OID.
+func (v Value) Missing() bool {
+	switch v.Type {
+	case tagNoSuchObject, tagNoSuchInstance, tagEndOfMibView, tagNull:
+		return true
+	}
+	return false
+}
+
+// String returns an OCTET STRING as text.
+func (v Value) String() string {
+	return string(v.Bytes)
+}
+
+// Client sends requests to one agent.
+type Client struct {
+	Address   string // host or host:port; port 161 if omitted
+	Community string
+	Timeout   time.Duration // Per attempt; 2 seconds if zero
+	Retries   int           // Extra attempts after a timeout
+}
+
+// Get fetches the values of oids in one request.
+func (c *Client) Get(oids ...string) ([]Value, error) {
+	addr := c.Address
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "161")
+	}
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 2 * time.Second
+	}
+
+	var idBytes [4]byte
+	rand.Read(idBytes[:])
+	reqID := int64(binary.BigEndian.Uint32(idBytes[:]) & 0x7fffffff)
+	msg, err := encodeGet(c.Community, reqID, oids)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 65535)
+	for attempt := 0; ; attempt++ {
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() && attempt < c.Retries {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("snmp: no response from %s: %w", addr, err)
+		}
+		id, values, err := decodeResponse(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if id != reqID {
+			continue // A late reply to an earlier attempt
+		}
+		return values, nil
+	}
+}
+
+func encodeGet(community string, reqID int64, oids []string) ([]byte, error) {
+	var binds []byte
+	for _, oid := range oids {
+		enc, err := encodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, tlv(tagSequence, append(tlv(tagOID, enc), tlv(tagNull, nil)...))...)
+	}
+	pdu := concat(
+		tlv(tagInteger, encodeInt(reqID)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagSequence, binds),
+	)
+	return tlv(tagSequence, concat(
+		tlv(tagInteger, encodeInt(version2c)),
+		tlv(tagOctetString, []byte(community)),
+		tlv(tagGetRequest, pdu),
+	)), nil
+}
+
+func decodeResponse(b []byte) (int64, []Value, error) {
+	tag, msg, _, err := readTLV(b)
+	if err != nil || tag != tagSequence {
+		return 0, nil, ErrMalformed
+	}
+	var fields [3][]byte
+	var tags [3]byte
+	for i := range fields {
+		if tags[i], fields[i], msg, err = readTLV(msg); err != nil {
+			return 0, nil, ErrMalformed
+		}
+	}
+	if tags[2] != tagGetResponse {
+		return 0, nil, ErrMalformed
+	}
+
+	pdu := fields[2]
+	var ints [3]int64
+	for i := range ints {
+		var v []byte
+		if tag, v, pdu, err = readTLV(pdu); err != nil || tag != tagInteger {
+			return 0, nil, ErrMalformed
+		}
+		ints[i] = decodeInt(v)
+	}
+	if ints[1] != 0 {
+		return ints[0], nil, fmt.Errorf("snmp: agent returned error status %d for binding %d", ints[1], ints[2])
+	}
+
+	tag, binds, _, err := readTLV(pdu)
+	if err != nil || tag != tagSequence {
+		return 0, nil, ErrMalformed
+	}
+	var values []Value
+	for len(binds) > 0 {
+		var bind []byte
+		if tag, bind, binds, err = readTLV(binds); err != nil || tag != tagSequence {
+			return 0, nil, ErrMalformed
+		}
+		tag, oid, rest, err := readTLV(bind)
+		if err != nil || tag != tagOID {
+			return 0, nil, ErrMalformed
+		}
+		vtag, raw, _, err := readTLV(rest)
+		if err != nil {
+			return 0, nil, ErrMalformed
+		}
+		v := Value{OID: decodeOID(oid), Type: vtag}
+		switch vtag {
+		case tagInteger:
+			v.Int = decodeInt(raw)
+		case tagCounter32, tagGauge32, tagTimeTicks, tagCounter64:
+			v.Int = int64(decodeUint(raw))
+		default:
+			v.Bytes = raw
+		}
+		values = append(values, v)
+	}
+	return ints[0], values, nil
+}
+
+// tlv encodes one BER element.
+func tlv(tag byte, value []byte) []byte {
+	n := len(value)
+	var length []byte
+	switch {
+	case n < 0x80:
+		length = []byte{byte(n)}
+	case n <= 0xff:
+		length = []byte{0x81, byte(n)}
+	default:
+		length = []byte{0x82, byte(n >> 8), byte(n)}
+	}
+	return concat([]byte{tag}, length, value)
+}
+
+// readTLV splits the first BER element off b.
+func readTLV(b []byte) (tag byte, value, rest []byte, err error) {
+	if len(b) < 2 {
+		return 0, nil, nil, ErrMalformed
+	}
+	tag, n, b := b[0], int(b[1]), b[2:]
+	if n&0x80 != 0 {
+		size := n & 0x7f
+		if size == 0 || size > 2 || len(b) < size {
+			return 0, nil, nil, ErrMalformed
+		}
+		n = 0
+		for _, c := range b[:size] {
+			n = n<<8 | int(c)
+		}
+		b = b[size:]
+	}
+	if len(b) < n {
+		return 0, nil, nil, ErrMalformed
+	}
+	return tag, b[:n], b[n:], nil
+}
+
+func encodeInt(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	// Drop leading bytes that only repeat the sign.
+	for len(b) > 1 && ((b[0] == 0 && b[1]&0x80 == 0) || (b[0] == 0xff && b[1]&0x80 != 0)) {
+		b = b[1:]
+	}
+	return b
+}
+
+func decodeInt(b []byte) int64 {
+	var v int64
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		v = -1
+	}
+	for _, c := range b {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func decodeUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func encodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("snmp: invalid OID %q", oid)
+	}
+	arcs := make([]uint64, len(parts))
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("snmp: invalid OID %q", oid)
+		}
+		arcs[i] = n
+	}
+	out := appendBase128(nil, arcs[0]*40+arcs[1])
+	for _, a := range arcs[2:] {
+		out = appendBase128(out, a)
+	}
+	return out, nil
+}
+
+func appendBase128(b []byte, v uint64) []byte {
+	var tmp [10]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7f) | 0x80
+	}
+	return append(b, tmp[i:]...)
+}
+
+func decodeOID(b []byte) string {
+	var arcs []string
+	var v uint64
+	for _, c := range b {
+		v = v<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			continue
+		}
+		if len(arcs) == 0 {
+			first := min(v/40, 2)
+			arcs = append(arcs, strconv.FormatUint(first, 10), strconv.FormatUint(v-first*40, 10))
+		} else {
+			arcs = append(arcs, strconv.FormatUint(v, 10))
+		}
+		v = 0
+	}
+	return strings.Join(arcs, ".")
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
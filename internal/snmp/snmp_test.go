@@ -0,0 +1,132 @@
+package snmp
+
+import (
+	"net"
+	"testing"
+)
+
+// fakeAgent answers GetRequests from values, keyed by OID. OIDs it does
+// not know come back as noSuchInstance.
+func fakeAgent(t *testing.T, community string, values map[string][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, msg, _, _ := readTLV(buf[:n])
+			_, _, msg, _ = readTLV(msg) // version
+			_, comm, msg, _ := readTLV(msg)
+			if string(comm) != community {
+				continue // Agents ignore a wrong community
+			}
+			_, pdu, _, _ := readTLV(msg)
+			_, reqID, pdu, _ := readTLV(pdu)
+			_, _, pdu, _ = readTLV(pdu)
+			_, _, pdu, _ = readTLV(pdu)
+			_, binds, _, _ := readTLV(pdu)
+
+			var out []byte
+			for len(binds) > 0 {
+				var bind []byte
+				_, bind, binds, _ = readTLV(binds)
+				_, oid, _, _ := readTLV(bind)
+				value, ok := values[decodeOID(oid)]
+				if !ok {
+					value = tlv(tagNoSuchInstance, nil)
+				}
+				out = append(out, tlv(tagSequence, concat(tlv(tagOID, oid), value))...)
+			}
+			resp := tlv(tagSequence, concat(
+				tlv(tagInteger, encodeInt(version2c)),
+				tlv(tagOctetString, comm),
+				tlv(tagGetResponse, concat(
+					tlv(tagInteger, reqID),
+					tlv(tagInteger, encodeInt(0)),
+					tlv(tagInteger, encodeInt(0)),
+					tlv(tagSequence, out),
+				)),
+			))
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestEncoding(t *testing.T) {
+	for _, oid := range []string{"1.3.6.1.2.1.17.4.3.1.2.184.39.235.1.2.255", "1.3.6.1.2.1.31.1.1.1.1.10101"} {
+		enc, err := encodeOID(oid)
+		if err != nil {
+			t.Fatalf("encodeOID(%s): %v", oid, err)
+		}
+		if got := decodeOID(enc); got != oid {
+			t.Errorf("OID round trip: got %s, want %s", got, oid)
+		}
+	}
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -129, 1<<31 - 1} {
+		if got := decodeInt(encodeInt(n)); got != n {
+			t.Errorf("integer round trip: got %d, want %d", got, n)
+		}
+	}
+	if _, err := encodeOID("not.an.oid"); err == nil {
+		t.Error("expected an error for an invalid OID")
+	}
+}
+
+func TestLocatePort(t *testing.T) {
+	addr := fakeAgent(t, "venue", map[string][]byte{
+		oidFdbPort + ".184.39.235.1.2.3": tlv(tagInteger, encodeInt(14)),
+		oidBasePortIndex + ".14":         tlv(tagInteger, encodeInt(10114)),
+		oidIfName + ".10114":             tlv(tagOctetString, []byte("Gi1/0/14")),
+		oidFdbPort + ".184.39.235.1.2.4": tlv(tagInteger, encodeInt(2)),
+		oidBasePortIndex + ".2":          tlv(tagInteger, encodeInt(2)),
+		oidIfDescr + ".2":                tlv(tagOctetString, []byte("Port 2")),
+	})
+	cfg := Config{Address: addr, Community: "venue"}
+
+	port, err := LocatePort(cfg, "b8:27:eb:01:02:03")
+	if err != nil {
+		t.Fatalf("LocatePort: %v", err)
+	}
+	if want := "Gi1/0/14 on " + addr; port != want {
+		t.Errorf("got %q, want %q", port, want)
+	}
+
+	// Without ifName the description is used.
+	if port, err := LocatePort(cfg, "b8:27:eb:01:02:04"); err != nil || port != "Port 2 on "+addr {
+		t.Errorf("got %q (%v), want the ifDescr", port, err)
+	}
+
+	if _, err := LocatePort(cfg, "b8:27:eb:09:09:09"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tc := range []struct {
+		cfg Config
+		ok  bool
+	}{
+		{Config{}, true},
+		{Config{Address: "192.168.1.2", Community: "public"}, true},
+		{Config{Address: "core-switch.lan:1161", Community: "public"}, true},
+		{Config{Address: "192.168.1.2"}, false},
+		{Config{Address: "192.168.1.300", Community: "public"}, false},
+		{Config{Address: "192.168.1.2:0", Community: "public"}, false},
+	} {
+		if err := tc.cfg.Validate(); (err == nil) != tc.ok {
+			t.Errorf("Validate(%+v) = %v, want ok=%t", tc.cfg, err, tc.ok)
+		}
+	}
+	if m := (Config{Address: "192.168.1.2", Community: "secret"}).Masked(); m.Community == "secret" {
+		t.Error("expected the community to be masked")
+	}
+}
@@ -0,0 +1,138 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SettingKey is the settings key holding the switch Config.
+const SettingKey = "switch"
+
+// maskedCommunity replaces the community in API responses.
+const maskedCommunity = "********"
+
+// ErrNotFound is returned when the switch has not learned a MAC address.
+var ErrNotFound = errors.New("MAC address not in the switch's forwarding table")
+
+// OIDs from BRIDGE-MIB and IF-MIB used to find a MAC's port.
+const (
+	oidFdbPort       = "1.3.6.1.2.1.17.4.3.1.2" // dot1dTpFdbPort, indexed by MAC
+	oidBasePortIndex = "1.3.6.1.2.1.17.1.4.1.2" // dot1dBasePortIfIndex
+	oidIfName        = "1.3.6.1.2.1.31.1.1.1.1" // ifName, e.g. Gi1/0/14
+	oidIfDescr       = "1.3.6.1.2.1.2.2.1.2"    // ifDescr, for switches without ifName
+)
+
+// Config names the switch the displays are cabled to. Port lookups are off
+// while Address is empty.
+type Config struct {
+	Address   string `json:"address"` // IP or name, optionally with :port
+	Community string `json:"community"`
+}
+
+// Enabled reports whether a switch is configured.
+func (c Config) Enabled() bool {
+	return c.Address != ""
+}
+
+// Validate rejects unusable values.
+func (c *Config) Validate() error {
+	c.Address = strings.TrimSpace(c.Address)
+	if c.Address == "" {
+		return nil
+	}
+	host := c.Address
+	if h, port, err := net.SplitHostPort(c.Address); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid port %q", port)
+		}
+		host = h
+	}
+	if !hosts.ValidAddress(host) {
+		return fmt.Errorf("invalid switch address %q", c.Address)
+	}
+	if c.Community == "" {
+		return errors.New("community is required")
+	}
+	return nil
+}
+
+// Masked returns a copy safe to show, with the community hidden.
+func (c Config) Masked() Config {
+	if c.Community != "" {
+		c.Community = maskedCommunity
+	}
+	return c
+}
+
+// LoadConfig reads the switch settings; none is configured by default.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	var cfg Config
+	if _, err := store.GetSetting(SettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the switch settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(SettingKey, cfg)
+}
+
+// LocatePort asks the switch which port it learned mac on, returning the
+// interface name and the switch, e.g. "Gi1/0/14 on 192.168.1.2". It reads
+// the BRIDGE-MIB forwarding table, which most switches fill from the
+// default VLAN only; a MAC learned elsewhere is reported as ErrNotFound.
+func LocatePort(cfg Config, mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+	index := make([]string, len(hw))
+	for i, b := range hw {
+		index[i] = strconv.Itoa(int(b))
+	}
+	client := &Client{Address: cfg.Address, Community: cfg.Community, Timeout: 2 * time.Second, Retries: 1}
+
+	port, err := getInt(client, oidFdbPort+"."+strings.Join(index, "."))
+	if err != nil {
+		return "", err
+	}
+	ifIndex, err := getInt(client, fmt.Sprintf("%s.%d", oidBasePortIndex, port))
+	if err != nil {
+		return "", err
+	}
+
+	values, err := client.Get(fmt.Sprintf("%s.%d", oidIfName, ifIndex), fmt.Sprintf("%s.%d", oidIfDescr, ifIndex))
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("port %d", port)
+	for _, v := range values {
+		if !v.Missing() && v.String() != "" {
+			name = v.String()
+			break
+		}
+	}
+	return fmt.Sprintf("%s on %s", name, cfg.Address), nil
+}
+
+// getInt fetches one integer value.
+func getInt(client *Client, oid string) (int64, error) {
+	values, err := client.Get(oid)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 1 || values[0].Missing() {
+		return 0, ErrNotFound
+	}
+	return values[0].Int, nil
+}
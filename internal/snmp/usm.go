@@ -0,0 +1,431 @@
+package snmp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"sync"
+)
+
+const version3 = 3
+
+// Authentication and privacy protocols for v3 users.
+const (
+	AuthSHA    = "sha"    // HMAC-SHA-96 (RFC 3414)
+	AuthSHA256 = "sha256" // HMAC-192-SHA-256 (RFC 7860)
+	PrivAES    = "aes"    // AES-128-CFB (RFC 3826)
+)
+
+// USM constants.
+const (
+	securityModelUSM = 3
+	flagAuth         = 0x01
+	flagPriv         = 0x02
+	flagReportable   = 0x04
+	timeWindow       = 150 // Seconds a request's engine time may be off
+	maxMessageSize   = 65507
+)
+
+// usmStats* are the counters sent in Report PDUs (SNMP-USER-BASED-SM-MIB).
+const (
+	usmStatsUnsupportedSecLevels = "1.3.6.1.6.3.15.1.1.1.0"
+	usmStatsNotInTimeWindows     = "1.3.6.1.6.3.15.1.1.2.0"
+	usmStatsUnknownUserNames     = "1.3.6.1.6.3.15.1.1.3.0"
+	usmStatsUnknownEngineIDs     = "1.3.6.1.6.3.15.1.1.4.0"
+	usmStatsWrongDigests         = "1.3.6.1.6.3.15.1.1.5.0"
+	usmStatsDecryptionErrors     = "1.3.6.1.6.3.15.1.1.6.0"
+)
+
+// User is an SNMPv3 user. Requests from users must be authenticated, and
+// encrypted too when the user has a PrivPassword.
+type User struct {
+	Name         string `json:"name"`
+	AuthProtocol string `json:"auth_protocol"` // sha or sha256
+	AuthPassword string `json:"auth_password"`
+	PrivProtocol string `json:"priv_protocol,omitempty"` // aes, or empty for no privacy
+	PrivPassword string `json:"priv_password,omitempty"`
+}
+
+// Validate rejects unusable users.
+func (u User) Validate() error {
+	if u.Name == "" || len(u.Name) > 32 {
+		return errors.New("user name must be 1 to 32 characters")
+	}
+	if u.AuthProtocol != AuthSHA && u.AuthProtocol != AuthSHA256 {
+		return fmt.Errorf("user %s: auth_protocol must be sha or sha256", u.Name)
+	}
+	if len(u.AuthPassword) < 8 {
+		return fmt.Errorf("user %s: auth_password must be at least 8 characters", u.Name)
+	}
+	switch u.PrivProtocol {
+	case "":
+		if u.PrivPassword != "" {
+			return fmt.Errorf("user %s: set priv_protocol to aes to use priv_password", u.Name)
+		}
+	case PrivAES:
+		if len(u.PrivPassword) < 8 {
+			return fmt.Errorf("user %s: priv_password must be at least 8 characters", u.Name)
+		}
+	default:
+		return fmt.Errorf("user %s: priv_protocol must be aes or empty", u.Name)
+	}
+	return nil
+}
+
+func (u User) hash() func() hash.Hash {
+	if u.AuthProtocol == AuthSHA256 {
+		return sha256.New
+	}
+	return sha1.New
+}
+
+// digestLen is the length of the truncated HMAC in authParams.
+func (u User) digestLen() int {
+	if u.AuthProtocol == AuthSHA256 {
+		return 24
+	}
+	return 12
+}
+
+// localizeKey turns a password into a key for one engine (RFC 3414 A.2).
+func localizeKey(h func() hash.Hash, password string, engineID []byte) []byte {
+	d := h()
+	buf := make([]byte, 64)
+	for i := 0; i < 1<<20; i += len(buf) {
+		for j := range buf {
+			buf[j] = password[(i+j)%len(password)]
+		}
+		d.Write(buf)
+	}
+	ku := d.Sum(nil)
+	d.Reset()
+	d.Write(ku)
+	d.Write(engineID)
+	d.Write(ku)
+	return d.Sum(nil)
+}
+
+// usmState holds the localized keys of the users and the report counters.
+type usmState struct {
+	mu    sync.Mutex
+	keys  map[User][2][]byte // Auth and privacy keys
+	stats map[string]int64
+}
+
+func (a *Agent) keys(u User) (auth, priv []byte) {
+	a.usm.mu.Lock()
+	defer a.usm.mu.Unlock()
+	if k, ok := a.usm.keys[u]; ok {
+		return k[0], k[1]
+	}
+	auth = localizeKey(u.hash(), u.AuthPassword, a.EngineID)
+	if u.PrivPassword != "" {
+		priv = localizeKey(u.hash(), u.PrivPassword, a.EngineID)[:16]
+	}
+	if a.usm.keys == nil {
+		a.usm.keys = make(map[User][2][]byte)
+	}
+	a.usm.keys[u] = [2][]byte{auth, priv}
+	return auth, priv
+}
+
+func (a *Agent) count(stat string) int64 {
+	a.usm.mu.Lock()
+	defer a.usm.mu.Unlock()
+	if a.usm.stats == nil {
+		a.usm.stats = make(map[string]int64)
+	}
+	a.usm.stats[stat]++
+	return a.usm.stats[stat]
+}
+
+func (a *Agent) engineTime() int64 {
+	return a.Uptime() / 100
+}
+
+// usmParams are a message's msgSecurityParameters.
+type usmParams struct {
+	engineID   []byte
+	boots      int64
+	time       int64
+	user       []byte
+	authParams []byte
+	privParams []byte
+}
+
+// handleUSM answers a v3 message. raw is the whole message, which the
+// digest covers; body follows the version.
+func (a *Agent) handleUSM(raw, body []byte) []byte {
+	var parts [3][]byte
+	var tags [3]byte
+	var err error
+	for i := range parts {
+		if tags[i], parts[i], body, err = readTLV(body); err != nil {
+			return nil
+		}
+	}
+	if tags[0] != tagSequence || tags[1] != tagOctetString {
+		return nil
+	}
+
+	// msgGlobalData: msgID, msgMaxSize, msgFlags, msgSecurityModel.
+	global := parts[0]
+	var msgID, model int64
+	var flags byte
+	for i := range 4 {
+		var tag byte
+		var v []byte
+		if tag, v, global, err = readTLV(global); err != nil {
+			return nil
+		}
+		switch i {
+		case 0:
+			msgID = decodeInt(v)
+		case 2:
+			if tag != tagOctetString || len(v) != 1 {
+				return nil
+			}
+			flags = v[0]
+		case 3:
+			model = decodeInt(v)
+		}
+	}
+	if model != securityModelUSM || flags&(flagAuth|flagPriv) == flagPriv {
+		return nil
+	}
+
+	p, err := parseUSMParams(parts[1])
+	if err != nil {
+		return nil
+	}
+	reportable := flags&flagReportable != 0
+	report := func(stat string, u *User) []byte {
+		if !reportable {
+			return nil
+		}
+		return a.report(msgID, requestID(parts[2], tags[2]), p.user, stat, u)
+	}
+
+	if !bytes.Equal(p.engineID, a.EngineID) {
+		return report(usmStatsUnknownEngineIDs, nil) // Discovery
+	}
+	var user User
+	var found bool
+	for _, u := range a.Users {
+		if u.Name == string(p.user) {
+			user, found = u, true
+		}
+	}
+	if !found {
+		return report(usmStatsUnknownUserNames, nil)
+	}
+	if flags&flagAuth == 0 || (flags&flagPriv != 0) != (user.PrivPassword != "") {
+		return report(usmStatsUnsupportedSecLevels, nil)
+	}
+
+	authKey, privKey := a.keys(user)
+	if len(p.authParams) != user.digestLen() {
+		return report(usmStatsWrongDigests, nil)
+	}
+	// The digest is computed with authParams zeroed; it is a slice of raw.
+	zeroed := bytes.Clone(raw)
+	off := cap(raw) - cap(p.authParams)
+	clear(zeroed[off : off+len(p.authParams)])
+	if !hmac.Equal(p.authParams, digest(user, authKey, zeroed)) {
+		return report(usmStatsWrongDigests, nil)
+	}
+	if p.boots != a.Boots || abs(p.time-a.engineTime()) > timeWindow {
+		return report(usmStatsNotInTimeWindows, &user)
+	}
+
+	scoped := parts[2]
+	if flags&flagPriv != 0 {
+		if tags[2] != tagOctetString || len(p.privParams) != 8 {
+			return report(usmStatsDecryptionErrors, nil)
+		}
+		scoped = aesCFB(privKey, p.boots, p.time, p.privParams, scoped, false)
+		var tag byte
+		if tag, scoped, _, err = readTLV(scoped); err != nil || tag != tagSequence {
+			return report(usmStatsDecryptionErrors, nil)
+		}
+	} else if tags[2] != tagSequence {
+		return nil
+	}
+
+	// ScopedPDU: contextEngineID, contextName, PDU.
+	var ctxName, pdu []byte
+	var tag byte
+	if tag, _, scoped, err = readTLV(scoped); err != nil || tag != tagOctetString {
+		return nil
+	}
+	if tag, ctxName, scoped, err = readTLV(scoped); err != nil || tag != tagOctetString {
+		return nil
+	}
+	if tag, pdu, _, err = readTLV(scoped); err != nil {
+		return nil
+	}
+	resp := a.respond(tag, pdu)
+	if resp == nil {
+		return nil
+	}
+	return a.encodeUSM(msgID, flags&(flagAuth|flagPriv), &user, p.user, ctxName, resp)
+}
+
+// report answers with a Report PDU carrying the counter for stat. Reports
+// are authenticated when u is set.
+func (a *Agent) report(msgID, reqID int64, userName []byte, stat string, u *User) []byte {
+	pdu := tlv(tagReport, concat(
+		tlv(tagInteger, encodeInt(reqID)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagInteger, encodeInt(0)),
+		tlv(tagSequence, encodeBind(variable{Value: counterValue(stat, a.count(stat))})),
+	))
+	var flags byte
+	if u != nil {
+		flags = flagAuth
+	}
+	return a.encodeUSM(msgID, flags, u, userName, nil, pdu)
+}
+
+// encodeUSM wraps pdu in a v3 message from this engine, encrypted and
+// authenticated as flags ask with u's keys.
+func (a *Agent) encodeUSM(msgID int64, flags byte, u *User, userName, ctxName, pdu []byte) []byte {
+	engineTime := a.engineTime()
+	data := tlv(tagSequence, concat(
+		tlv(tagOctetString, a.EngineID),
+		tlv(tagOctetString, ctxName),
+		pdu,
+	))
+
+	var authKey, privKey, authParams, privParams []byte
+	if flags&flagAuth != 0 {
+		authKey, privKey = a.keys(*u)
+		authParams = make([]byte, u.digestLen())
+	}
+	if flags&flagPriv != 0 {
+		privParams = make([]byte, 8)
+		rand.Read(privParams)
+		data = tlv(tagOctetString, aesCFB(privKey, a.Boots, engineTime, privParams, data, true))
+	}
+
+	encode := func() []byte {
+		params := tlv(tagSequence, concat(
+			tlv(tagOctetString, a.EngineID),
+			tlv(tagInteger, encodeInt(a.Boots)),
+			tlv(tagInteger, encodeInt(engineTime)),
+			tlv(tagOctetString, userName),
+			tlv(tagOctetString, authParams),
+			tlv(tagOctetString, privParams),
+		))
+		return tlv(tagSequence, concat(
+			tlv(tagInteger, encodeInt(version3)),
+			tlv(tagSequence, concat(
+				tlv(tagInteger, encodeInt(msgID)),
+				tlv(tagInteger, encodeInt(maxMessageSize)),
+				tlv(tagOctetString, []byte{flags}),
+				tlv(tagInteger, encodeInt(securityModelUSM)),
+			)),
+			tlv(tagOctetString, params),
+			data,
+		))
+	}
+	msg := encode()
+	if flags&flagAuth != 0 {
+		authParams = digest(*u, authKey, msg)
+		msg = encode()
+	}
+	return msg
+}
+
+func parseUSMParams(b []byte) (usmParams, error) {
+	tag, b, _, err := readTLV(b)
+	if err != nil || tag != tagSequence {
+		return usmParams{}, ErrMalformed
+	}
+	var fields [6][]byte
+	for i := range fields {
+		if _, fields[i], b, err = readTLV(b); err != nil {
+			return usmParams{}, ErrMalformed
+		}
+	}
+	return usmParams{
+		engineID:   fields[0],
+		boots:      decodeInt(fields[1]),
+		time:       decodeInt(fields[2]),
+		user:       fields[3],
+		authParams: fields[4],
+		privParams: fields[5],
+	}, nil
+}
+
+// requestID reads the request ID of a plaintext scoped PDU, for reports;
+// it is 0 when the PDU is encrypted or malformed.
+func requestID(scoped []byte, tag byte) int64 {
+	if tag != tagSequence {
+		return 0
+	}
+	for range 2 {
+		if _, _, scoped, _ = readTLV(scoped); scoped == nil {
+			return 0
+		}
+	}
+	_, pdu, _, err := readTLV(scoped)
+	if err != nil {
+		return 0
+	}
+	_, id, _, err := readTLV(pdu)
+	if err != nil {
+		return 0
+	}
+	return decodeInt(id)
+}
+
+func digest(u User, key, msg []byte) []byte {
+	mac := hmac.New(u.hash(), key)
+	mac.Write(msg)
+	return mac.Sum(nil)[:u.digestLen()]
+}
+
+// aesCFB encrypts or decrypts with the RFC 3826 IV: the engine boots and
+// time, then the salt from privParams. The message digest authenticates
+// the ciphertext, which CFB alone does not.
+func aesCFB(key []byte, boots, engineTime int64, salt, data []byte, encrypt bool) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	iv := binary.BigEndian.AppendUint32(nil, uint32(boots))
+	iv = binary.BigEndian.AppendUint32(iv, uint32(engineTime))
+	iv = append(iv, salt...)
+	out := make([]byte, len(data))
+	if encrypt {
+		cipher.NewCFBEncrypter(block, iv).XORKeyStream(out, data)
+	} else {
+		cipher.NewCFBDecrypter(block, iv).XORKeyStream(out, data)
+	}
+	return out
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// NewEngineID returns a random engine ID in the RFC 3411 format for
+// locally assigned octets.
+func NewEngineID() []byte {
+	id := []byte{0x80, 0x00, 0x1f, 0x88, 0x05} // Net-SNMP enterprise, random octets
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return append(id, suffix...)
+}
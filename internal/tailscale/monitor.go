@@ -0,0 +1,115 @@
+package tailscale
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// Monitor keeps the host list in step with the tailnet: hosts without a VPN
+// IP get one when a tailnet node with the same hostname appears, and hosts
+// whose tailnet peer has disconnected are marked unreachable over VPN
+// without waiting for the next health check to time out.
+type Monitor struct {
+	store     hosts.HostStore
+	client    *Client
+	logger    *logger.Logger
+	interval  time.Duration
+	available bool
+}
+
+// NewMonitor creates a monitor that polls tailscaled every 30 seconds.
+func NewMonitor(store hosts.HostStore, client *Client, lg *logger.Logger) *Monitor {
+	return &Monitor{
+		store:    store,
+		client:   client,
+		logger:   lg,
+		interval: 30 * time.Second,
+	}
+}
+
+// Run polls tailscaled until the process exits. Nodes without Tailscale
+// simply never find the socket, which is logged once at startup.
+func (m *Monitor) Run() {
+	if err := m.Sync(); errors.Is(err, ErrUnavailable) {
+		m.logger.Info("Tailscale: tailscaled not found, VPN addresses must be entered manually")
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.Sync()
+	}
+}
+
+// Sync applies the current tailnet status to every stored host.
+func (m *Monitor) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	st, err := m.client.Status(ctx)
+	if err != nil {
+		if m.available {
+			m.logger.Warning(fmt.Sprintf("Tailscale: lost contact with tailscaled: %v", err))
+			m.available = false
+		}
+		return err
+	}
+	if !m.available {
+		m.logger.Info(fmt.Sprintf("Tailscale: connected to tailscaled (%s)", st.BackendState))
+		m.available = true
+	}
+	if !st.Running() {
+		return nil
+	}
+
+	for _, host := range m.store.GetAll() {
+		probe := host
+		if !Apply(&probe, st) {
+			continue
+		}
+		if err := m.store.Update(host.IPAddress, func(h *types.Host) { Apply(h, st) }); err != nil {
+			m.logger.Warning(fmt.Sprintf("Tailscale: failed to update %s: %v", host.IPAddress, err))
+			continue
+		}
+		if host.VPNIPAddress == "" && probe.VPNIPAddress != "" {
+			m.logger.Info(fmt.Sprintf("Tailscale: %s is reachable on the tailnet at %s", host.IPAddress, probe.VPNIPAddress))
+		}
+	}
+	return nil
+}
+
+// Apply updates host from the tailnet status and reports whether anything
+// changed. A VPN IP entered by an operator is never replaced.
+func Apply(host *types.Host, st *Status) bool {
+	changed := false
+
+	if host.VPNIPAddress == "" {
+		peer, ok := st.Find(host.Hostname)
+		if !ok || peer.IPv4() == "" || peer.IPv4() == host.IPAddress {
+			return false
+		}
+		host.VPNIPAddress = peer.IPv4()
+		host.DashboardURLVPN = fmt.Sprintf("http://%s:8080", host.VPNIPAddress)
+		host.StatusVPN = types.StatusUnreachable
+		host.NSMStatusVPN = "NSM Offline"
+		host.CMSStatusVPN = types.CMSUnknown
+		changed = true
+	}
+
+	peer, ok := st.FindIP(host.VPNIPAddress)
+	if ok && !peer.Online && host.StatusVPN != types.StatusUnreachable {
+		host.StatusVPN = types.StatusUnreachable
+		host.NSMStatusVPN = "NSM Offline"
+		host.CMSStatusVPN = types.CMSUnknown
+		host.LastCheckedVPN = time.Now()
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,202 @@
+// Package tailscale reads the local tailscaled status so NSM can learn each
+// host's tailnet address and whether the peer is connected without the
+// operator typing VPN IPs by hand.
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSocket is where tailscaled listens for LocalAPI requests on Linux.
+// NSM_TAILSCALE_SOCKET overrides it, e.g. for a userspace tailscaled.
+const DefaultSocket = "/var/run/tailscale/tailscaled.sock"
+
+// ErrUnavailable is returned when no tailscaled is listening on the socket.
+var ErrUnavailable = errors.New("tailscaled is not running")
+
+// Peer is a node on the tailnet, including this node itself.
+type Peer struct {
+	HostName string    `json:"hostname"`
+	DNSName  string    `json:"dns_name,omitempty"`
+	OS       string    `json:"os,omitempty"`
+	IPs      []string  `json:"ips"`
+	Online   bool      `json:"online"`
+	Direct   bool      `json:"direct"`          // Traffic flows peer-to-peer rather than via a DERP relay
+	Relay    string    `json:"relay,omitempty"` // Home DERP region of the peer
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+// IPv4 returns the peer's tailnet IPv4 address, or its first address when it
+// has none.
+func (p Peer) IPv4() string {
+	for _, ip := range p.IPs {
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+			return ip
+		}
+	}
+	if len(p.IPs) > 0 {
+		return p.IPs[0]
+	}
+	return ""
+}
+
+// Status is the part of the tailscaled status NSM cares about.
+type Status struct {
+	BackendState string `json:"backend_state"`
+	Self         Peer   `json:"self"`
+	Peers        []Peer `json:"peers"`
+}
+
+// Running reports whether the node is logged in and connected to the tailnet.
+func (s *Status) Running() bool {
+	return s != nil && s.BackendState == "Running"
+}
+
+// Find returns the tailnet node whose hostname matches, checking this node
+// first. Both the OS hostname and the first label of the MagicDNS name are
+// compared, case-insensitively.
+func (s *Status) Find(hostname string) (Peer, bool) {
+	hostname = strings.ToLower(strings.TrimSpace(hostname))
+	if s == nil || hostname == "" || hostname == "localhost" || hostname == "unknown" {
+		return Peer{}, false
+	}
+	for _, p := range append([]Peer{s.Self}, s.Peers...) {
+		if strings.ToLower(p.HostName) == hostname || dnsLabel(p.DNSName) == hostname {
+			return p, true
+		}
+	}
+	return Peer{}, false
+}
+
+// FindIP returns the tailnet node that owns ip.
+func (s *Status) FindIP(ip string) (Peer, bool) {
+	if s == nil || ip == "" {
+		return Peer{}, false
+	}
+	for _, p := range append([]Peer{s.Self}, s.Peers...) {
+		for _, addr := range p.IPs {
+			if addr == ip {
+				return p, true
+			}
+		}
+	}
+	return Peer{}, false
+}
+
+func dnsLabel(name string) string {
+	label, _, _ := strings.Cut(strings.ToLower(name), ".")
+	return label
+}
+
+// Client talks to tailscaled's LocalAPI over its unix socket.
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// NewClient returns a client for the default socket, or NSM_TAILSCALE_SOCKET
+// when set.
+func NewClient() *Client {
+	socket := os.Getenv("NSM_TAILSCALE_SOCKET")
+	if socket == "" {
+		socket = DefaultSocket
+	}
+	return NewClientWithSocket(socket)
+}
+
+// NewClientWithSocket returns a client for the given socket path.
+func NewClientWithSocket(socket string) *Client {
+	dialer := &net.Dialer{Timeout: 2 * time.Second}
+	return &Client{
+		socket: socket,
+		http: &http.Client{
+			Timeout: 5 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// rawPeer mirrors the ipnstate.PeerStatus fields returned by tailscaled.
+type rawPeer struct {
+	HostName     string
+	DNSName      string
+	OS           string
+	TailscaleIPs []string
+	Online       bool
+	Relay        string
+	CurAddr      string
+	LastSeen     time.Time
+}
+
+func (p rawPeer) peer() Peer {
+	lastSeen := p.LastSeen
+	if lastSeen.Year() <= 1 {
+		lastSeen = time.Time{}
+	}
+	return Peer{
+		HostName: p.HostName,
+		DNSName:  strings.TrimSuffix(p.DNSName, "."),
+		OS:       p.OS,
+		IPs:      p.TailscaleIPs,
+		Online:   p.Online,
+		Direct:   p.CurAddr != "",
+		Relay:    p.Relay,
+		LastSeen: lastSeen,
+	}
+}
+
+// Status fetches the current tailnet status. It returns ErrUnavailable when
+// tailscaled is not installed or not running.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://local-tailscaled.sock/localapi/v0/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, ErrUnavailable
+		}
+		return nil, fmt.Errorf("query tailscaled at %s: %w", c.socket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("query tailscaled: status %d", resp.StatusCode)
+	}
+
+	var raw struct {
+		BackendState string
+		Self         *rawPeer
+		Peer         map[string]rawPeer
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode tailscaled status: %w", err)
+	}
+
+	st := &Status{BackendState: raw.BackendState, Peers: []Peer{}}
+	if raw.Self != nil {
+		st.Self = raw.Self.peer()
+		st.Self.Online = st.Running()
+	}
+	for _, p := range raw.Peer {
+		st.Peers = append(st.Peers, p.peer())
+	}
+	sort.Slice(st.Peers, func(i, j int) bool {
+		return strings.ToLower(st.Peers[i].HostName) < strings.ToLower(st.Peers[j].HostName)
+	})
+	return st, nil
+}
@@ -0,0 +1,135 @@
+package tailscale
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// fakeTailscaled serves a LocalAPI status document on a unix socket and
+// returns a client for it.
+func fakeTailscaled(t *testing.T, status map[string]any) *Client {
+	t.Helper()
+	// Unix socket paths are limited to ~100 bytes, which t.TempDir can exceed.
+	dir, err := os.MkdirTemp("", "nsm-ts")
+	if err != nil {
+		t.Fatalf("MkdirTemp: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "tailscaled.sock")
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/localapi/v0/status" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	return NewClientWithSocket(socket)
+}
+
+func testStatus() map[string]any {
+	return map[string]any{
+		"BackendState": "Running",
+		"Self": map[string]any{
+			"HostName":     "nsm-hq",
+			"DNSName":      "nsm-hq.tail1234.ts.net.",
+			"TailscaleIPs": []string{"100.64.0.1", "fd7a:115c:a1e0::1"},
+			"Online":       true,
+		},
+		"Peer": map[string]any{
+			"nodekey:aa": map[string]any{
+				"HostName":     "lobby-pi",
+				"DNSName":      "lobby-pi.tail1234.ts.net.",
+				"TailscaleIPs": []string{"fd7a:115c:a1e0::2", "100.64.0.2"},
+				"Online":       true,
+				"CurAddr":      "192.168.1.20:41641",
+			},
+			"nodekey:bb": map[string]any{
+				"HostName":     "raspberrypi",
+				"DNSName":      "cafe-screen.tail1234.ts.net.",
+				"TailscaleIPs": []string{"100.64.0.3"},
+				"Online":       false,
+				"Relay":        "fra",
+			},
+		},
+	}
+}
+
+func TestClientStatus(t *testing.T) {
+	client := fakeTailscaled(t, testStatus())
+
+	st, err := client.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if !st.Running() || st.Self.IPv4() != "100.64.0.1" || len(st.Peers) != 2 {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	lobby, ok := st.Find("LOBBY-PI")
+	if !ok || lobby.IPv4() != "100.64.0.2" || !lobby.Direct || !lobby.Online {
+		t.Errorf("expected lobby-pi online and direct, got %+v ok=%v", lobby, ok)
+	}
+	// MagicDNS names match when the OS hostname is generic.
+	if cafe, ok := st.Find("cafe-screen"); !ok || cafe.Online || cafe.Relay != "fra" {
+		t.Errorf("expected cafe-screen offline via fra, got %+v ok=%v", cafe, ok)
+	}
+	if _, ok := st.Find("localhost"); ok {
+		t.Errorf("localhost must never match a tailnet node")
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	client := NewClientWithSocket(filepath.Join(t.TempDir(), "missing.sock"))
+	if _, err := client.Status(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestMonitorSync(t *testing.T) {
+	store, err := hosts.NewMemoryStore()
+	if err != nil {
+		t.Fatalf("NewMemoryStore: %v", err)
+	}
+	defer store.Close()
+	store.ReplaceAll([]types.Host{
+		{ID: "a", IPAddress: "192.168.1.20", Hostname: "lobby-pi"},
+		{ID: "b", IPAddress: "192.168.1.21", Hostname: "cafe-screen", VPNIPAddress: "100.64.0.3", StatusVPN: types.StatusHealthy},
+		{ID: "c", IPAddress: "192.168.1.22", Hostname: "lobby-pi-2", VPNIPAddress: "100.99.0.9"},
+	})
+
+	m := NewMonitor(store, fakeTailscaled(t, testStatus()), logger.New(10))
+	if err := m.Sync(); err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+
+	lobby, _ := store.GetByID("a")
+	if lobby.VPNIPAddress != "100.64.0.2" || lobby.DashboardURLVPN != "http://100.64.0.2:8080" {
+		t.Errorf("expected VPN IP to be filled in, got %+v", lobby)
+	}
+	cafe, _ := store.GetByID("b")
+	if cafe.StatusVPN != types.StatusUnreachable {
+		t.Errorf("expected offline peer to be marked unreachable, got %q", cafe.StatusVPN)
+	}
+	manual, _ := store.GetByID("c")
+	if manual.VPNIPAddress != "100.99.0.9" {
+		t.Errorf("manual VPN IP must not be replaced, got %q", manual.VPNIPAddress)
+	}
+}
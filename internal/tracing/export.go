@@ -0,0 +1,226 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/logger"
+)
+
+// Export tuning. Spans beyond maxQueued between flushes are dropped, so a
+// collector that is down costs memory only up to that bound.
+const (
+	flushInterval = 5 * time.Second
+	flushBatch    = 256
+	maxQueued     = 2048
+)
+
+// Exporter sends ended spans to an OTLP/HTTP collector in batches.
+type Exporter struct {
+	url      string
+	service  string
+	instance string
+	client   *http.Client
+	logger   *logger.Logger
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	kick    chan struct{}
+}
+
+// NewExporter creates an exporter posting to endpoint, the collector's
+// base URL such as http://collector:4318. Spans carry service and
+// instance as their service.name and service.instance.id.
+func NewExporter(endpoint, service, instance string, lg *logger.Logger) *Exporter {
+	return &Exporter{
+		url:      endpoint + "/v1/traces",
+		service:  service,
+		instance: instance,
+		// The collector is reached directly; its requests are not traced.
+		client: &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}},
+		logger: lg,
+		kick:   make(chan struct{}, 1),
+	}
+}
+
+// Enable starts recording spans and exporting them to endpoint. It returns
+// the exporter so the caller can flush it on shutdown.
+func Enable(endpoint, service, instance string, lg *logger.Logger) *Exporter {
+	ex := NewExporter(endpoint, service, instance, lg)
+	go ex.run()
+	tracer.Store(ex)
+	return ex
+}
+
+// Disable stops recording spans. Spans already started still export.
+func Disable() {
+	tracer.Store(nil)
+}
+
+func (e *Exporter) enqueue(sp *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueued {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, sp)
+	if len(e.queue) >= flushBatch {
+		select {
+		case e.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *Exporter) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.kick:
+		}
+		if err := e.Flush(); err != nil {
+			e.logger.Warning(fmt.Sprintf("Tracing: %v", err))
+		}
+	}
+}
+
+// Flush exports the queued spans now.
+func (e *Exporter) Flush() error {
+	e.mu.Lock()
+	spans, dropped := e.queue, e.dropped
+	e.queue, e.dropped = nil, 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		e.logger.Warning(fmt.Sprintf("Tracing: dropped %d spans while the collector was behind", dropped))
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return fmt.Errorf("encode spans: %w", err)
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("export %d spans: %w", len(spans), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("export %d spans: collector returned %s", len(spans), resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding of an export request; only the fields nsm fills.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttr `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID      string     `json:"traceId"`
+		SpanID       string     `json:"spanId"`
+		ParentSpanID string     `json:"parentSpanId,omitempty"`
+		Name         string     `json:"name"`
+		Kind         Kind       `json:"kind"`
+		Start        string     `json:"startTimeUnixNano"`
+		End          string     `json:"endTimeUnixNano"`
+		Attributes   []otlpAttr `json:"attributes,omitempty"`
+		Status       otlpStatus `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 2 for an error
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttr struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		String *string  `json:"stringValue,omitempty"`
+		Bool   *bool    `json:"boolValue,omitempty"`
+		Int    *string  `json:"intValue,omitempty"` // int64 is a string in OTLP JSON
+		Double *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+func (e *Exporter) encode(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, sp := range spans {
+		s := otlpSpan{
+			TraceID:    hex.EncodeToString(sp.sc.TraceID[:]),
+			SpanID:     hex.EncodeToString(sp.sc.SpanID[:]),
+			Name:       sp.name,
+			Kind:       sp.kind,
+			Start:      strconv.FormatInt(sp.start.UnixNano(), 10),
+			End:        strconv.FormatInt(sp.end.UnixNano(), 10),
+			Attributes: attrs(sp.attrs),
+		}
+		if sp.parent != [8]byte{} {
+			s.ParentSpanID = hex.EncodeToString(sp.parent[:])
+		}
+		if sp.errMsg != "" {
+			s.Status = otlpStatus{Code: 2, Message: sp.errMsg}
+		}
+		out = append(out, s)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: attrs(map[string]any{
+			"service.name":        e.service,
+			"service.instance.id": e.instance,
+		})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "nexsign.mini/nsm/internal/tracing"}, Spans: out}},
+	}}}
+}
+
+func attrs(m map[string]any) []otlpAttr {
+	out := make([]otlpAttr, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		var val otlpValue
+		switch v := m[k].(type) {
+		case string:
+			val.String = &v
+		case bool:
+			val.Bool = &v
+		case int:
+			s := strconv.Itoa(v)
+			val.Int = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			val.Int = &s
+		case float64:
+			val.Double = &v
+		default:
+			s := fmt.Sprint(v)
+			val.String = &s
+		}
+		out = append(out, otlpAttr{Key: k, Value: val})
+	}
+	return out
+}
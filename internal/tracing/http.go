@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"nexsign.mini/nsm/internal/requestid"
+)
+
+// Inject sets the traceparent header of h from the span in ctx.
+func Inject(ctx context.Context, h http.Header) {
+	if tp := Traceparent(ctx); tp != "" {
+		h.Set(Header, tp)
+	}
+}
+
+// Traceparent returns the traceparent header value for the span in ctx,
+// or "" if there is none.
+func Traceparent(ctx context.Context) string {
+	if sp := FromContext(ctx); sp != nil {
+		return sp.sc.Traceparent()
+	}
+	return ""
+}
+
+// Extract returns ctx carrying the parent named by the traceparent header
+// of h, if it has a usable one.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	if sc, ok := ParseTraceparent(h.Get(Header)); ok {
+		return withRemote(ctx, sc)
+	}
+	return ctx
+}
+
+// Handler wraps next so each request is a server span, continuing the
+// trace of the caller if it sent one. WebSocket upgrades and event
+// streams are left alone: they last as long as the connection.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !Enabled() || strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, sp := Start(Extract(r.Context(), r.Header), r.Method+" "+r.URL.Path, Server)
+		defer sp.End()
+		sp.SetAttr("http.request.method", r.Method)
+		sp.SetAttr("url.path", r.URL.Path)
+		sp.SetAttr("client.address", r.RemoteAddr)
+		if id := requestid.FromContext(r.Context()); id != "" {
+			sp.SetAttr("nsm.request_id", id)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		sp.SetAttr("http.response.status_code", rec.status)
+		if rec.status >= 500 {
+			sp.SetError(fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status)))
+		}
+	})
+}
+
+// statusRecorder remembers the status a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Transport wraps base so each request is a client span, a child of the
+// span in its context if any, whose traceparent goes to the server.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return roundTripper{base: base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !Enabled() {
+		return t.base.RoundTrip(req)
+	}
+	ctx, sp := Start(req.Context(), req.Method+" "+req.URL.Path, Client)
+	defer sp.End()
+	sp.SetAttr("http.request.method", req.Method)
+	sp.SetAttr("server.address", req.URL.Host)
+	sp.SetAttr("url.path", req.URL.Path)
+
+	// A RoundTripper must not modify the caller's request.
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		sp.SetError(err)
+		return nil, err
+	}
+	sp.SetAttr("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		sp.SetError(fmt.Errorf("%s", resp.Status))
+	}
+	return resp, nil
+}
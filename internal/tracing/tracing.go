@@ -0,0 +1,171 @@
+// Package tracing records traces of requests across nodes and exports them
+// to an OpenTelemetry collector over OTLP/HTTP, in its JSON encoding. Trace
+// context travels between nodes in the W3C traceparent header, and in the
+// frames of the peer bus, so a push from one node and its handling on the
+// next show up as one trace.
+//
+// Tracing is off until Enable is called; until then Start returns a nil
+// span, and every method of a nil span does nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Header is the W3C trace context header.
+const Header = "traceparent"
+
+// Kind is the OpenTelemetry span kind.
+type Kind int
+
+// Span kinds, numbered as in OTLP.
+const (
+	Internal Kind = 1
+	Server   Kind = 2
+	Client   Kind = 3
+)
+
+// tracer is the exporter spans go to; nil while tracing is off.
+var tracer atomic.Pointer[Exporter]
+
+// Enabled reports whether spans are recorded.
+func Enabled() bool {
+	return tracer.Load() != nil
+}
+
+// SpanContext identifies a span within its trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// Valid reports whether sc has non-zero IDs.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent encodes sc as a traceparent header value, always sampled.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-01"
+}
+
+// ParseTraceparent decodes a traceparent header value. Unsampled parents
+// are refused, so callers that did not want a trace do not get one.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || flags[0]&1 == 0 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	return sc, sc.Valid()
+}
+
+// Span is one timed operation.
+type Span struct {
+	exporter *Exporter
+	sc       SpanContext
+	parent   [8]byte
+	name     string
+	kind     Kind
+	start    time.Time
+	end      time.Time
+	attrs    map[string]any
+	errMsg   string
+	ended    atomic.Bool
+}
+
+type ctxKey struct{}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	sp, _ := ctx.Value(ctxKey{}).(*Span)
+	return sp
+}
+
+// remoteKey carries a parent received from another node.
+type remoteKey struct{}
+
+// withRemote returns ctx carrying a parent span from another node.
+func withRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start begins a span named name as a child of the span in ctx, or of a
+// parent received from another node, or as the root of a new trace. The
+// returned context carries the span. The span is nil while tracing is off.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	ex := tracer.Load()
+	if ex == nil {
+		return ctx, nil
+	}
+	sp := &Span{exporter: ex, name: name, kind: kind, start: time.Now()}
+	if parent := FromContext(ctx); parent != nil {
+		sp.sc.TraceID, sp.parent = parent.sc.TraceID, parent.sc.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		sp.sc.TraceID, sp.parent = remote.TraceID, remote.SpanID
+	} else {
+		rand.Read(sp.sc.TraceID[:])
+	}
+	rand.Read(sp.sc.SpanID[:])
+	return context.WithValue(ctx, ctxKey{}, sp), sp
+}
+
+// Context returns the IDs of sp, or a zero SpanContext for a nil span.
+func (sp *Span) Context() SpanContext {
+	if sp == nil {
+		return SpanContext{}
+	}
+	return sp.sc
+}
+
+// SetAttr records an attribute: a string, bool, integer or float.
+func (sp *Span) SetAttr(key string, value any) {
+	if sp == nil || sp.ended.Load() {
+		return
+	}
+	if sp.attrs == nil {
+		sp.attrs = make(map[string]any)
+	}
+	sp.attrs[key] = value
+}
+
+// SetError marks the span failed with err, if err is not nil.
+func (sp *Span) SetError(err error) {
+	if sp == nil || err == nil || sp.ended.Load() {
+		return
+	}
+	sp.errMsg = err.Error()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (sp *Span) End() {
+	if sp == nil || sp.ended.Swap(true) {
+		return
+	}
+	sp.end = time.Now()
+	sp.exporter.enqueue(sp)
+}
+
+// String describes sp for logs.
+func (sp *Span) String() string {
+	if sp == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s trace=%x span=%x", sp.name, sp.sc.TraceID, sp.sc.SpanID)
+}
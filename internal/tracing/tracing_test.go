@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"nexsign.mini/nsm/internal/logger"
+)
+
+func TestTraceparent(t *testing.T) {
+	sc := SpanContext{TraceID: [16]byte{1, 2, 3}, SpanID: [8]byte{4, 5, 6}}
+	if got, ok := ParseTraceparent(sc.Traceparent()); !ok || got != sc {
+		t.Errorf("expected %s to round trip, got %+v, %v", sc.Traceparent(), got, ok)
+	}
+	for _, v := range []string{
+		"",
+		"00-0102030000000000000000000000000-0405060000000000-01",  // Short trace ID
+		"00-00000000000000000000000000000000-0405060000000000-01", // Zero trace ID
+		"00-01020300000000000000000000000000-0405060000000000-00", // Not sampled
+		"ff-01020300000000000000000000000000-0405060000000000-01", // Invalid version
+		"00-0102030000000000000000000000000g-0405060000000000-01",
+	} {
+		if _, ok := ParseTraceparent(v); ok {
+			t.Errorf("expected %q refused", v)
+		}
+	}
+}
+
+func TestSpansWithoutTracing(t *testing.T) {
+	ctx, sp := Start(context.Background(), "off", Internal)
+	sp.SetAttr("key", "value")
+	sp.End()
+	if sp != nil || Traceparent(ctx) != "" {
+		t.Errorf("expected no span while tracing is off, got %v", sp)
+	}
+}
+
+func TestTraceAcrossNodes(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		exported otlpRequest
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected export to %s", r.URL.Path)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := json.NewDecoder(r.Body).Decode(&exported); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+	}))
+	defer collector.Close()
+	ex := Enable(collector.URL, "nsm", "node-a", logger.New(10))
+	defer Disable()
+
+	var handled SpanContext
+	peer := httptest.NewServer(Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = FromContext(r.Context()).Context()
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	defer peer.Close()
+
+	ctx, parent := Start(context.Background(), "announce", Internal)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, peer.URL+"/api/hosts/announce", nil)
+	client := &http.Client{Transport: Transport(http.DefaultTransport)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+	if req.Header.Get(Header) != "" {
+		t.Error("expected the caller's request left unchanged")
+	}
+	if handled.TraceID != parent.Context().TraceID {
+		t.Fatalf("expected the peer to continue trace %x, got %x", parent.Context().TraceID, handled.TraceID)
+	}
+
+	if err := ex.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exported.ResourceSpans) != 1 || len(exported.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("expected one resource and scope, got %+v", exported)
+	}
+	spans := map[Kind]otlpSpan{}
+	for _, s := range exported.ResourceSpans[0].ScopeSpans[0].Spans {
+		spans[s.Kind] = s
+	}
+	server, clientSpan, root := spans[Server], spans[Client], spans[Internal]
+	if len(spans) != 3 || server.ParentSpanID != clientSpan.SpanID || clientSpan.ParentSpanID != root.SpanID || root.ParentSpanID != "" {
+		t.Errorf("expected announce > client > server spans, got %+v", spans)
+	}
+	if server.Name != "POST /api/hosts/announce" || server.TraceID != root.TraceID {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	found := false
+	for _, a := range server.Attributes {
+		if a.Key == "http.response.status_code" && a.Value.Int != nil && *a.Value.Int == "202" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the status recorded, got %+v", server.Attributes)
+	}
+}
@@ -0,0 +1,176 @@
+// Package triggers maps inbound webhooks to fleet actions, so services
+// such as Zapier, IFTTT or a calendar can, for example, switch the lobby
+// displays to the "conference" preset. Each trigger has its own token.
+package triggers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SettingKey is the settings key holding the trigger list.
+const SettingKey = "triggers"
+
+// TokenPrefix marks trigger tokens, which are not API keys.
+const TokenPrefix = "nsmt_"
+
+// Actions a trigger can run.
+const (
+	ActionRestorePreset = "restore_preset" // Replace the host list with Preset
+	ActionCheckHosts    = "check_hosts"    // Health check Hosts, or all hosts
+	ActionDisplayPower  = "display_power"  // Turn the screens of Hosts, or all hosts, Power on or off
+)
+
+// ErrNotFound is returned for an unknown trigger name, and ErrDenied for a
+// wrong token.
+var (
+	ErrNotFound = errors.New("trigger not found")
+	ErrDenied   = errors.New("invalid trigger token")
+)
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Trigger is an inbound webhook, fired by POST /api/triggers/<name>.
+type Trigger struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Action      string   `json:"action"`
+	Preset      string   `json:"preset,omitempty"` // For restore_preset
+	Hosts       []string `json:"hosts,omitempty"`  // Host IDs for check_hosts and display_power; empty means all
+	Power       string   `json:"power,omitempty"`  // on or off, for display_power
+
+	TokenPrefix string    `json:"token_prefix"`         // First characters of the token, to tell them apart
+	TokenHash   string    `json:"token_hash,omitempty"` // Cleared by Public
+	CreatedAt   time.Time `json:"created_at"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	LastFiredAt time.Time `json:"last_fired_at,omitzero"`
+	LastResult  string    `json:"last_result,omitempty"`
+}
+
+// Validate normalizes t and checks that its action is complete.
+func (t *Trigger) Validate() error {
+	t.Name = strings.ToLower(strings.TrimSpace(t.Name))
+	if !validName.MatchString(t.Name) {
+		return fmt.Errorf("invalid name %q: use up to 64 lowercase letters, digits, - and _", t.Name)
+	}
+	t.Action = strings.ToLower(strings.TrimSpace(t.Action))
+	switch t.Action {
+	case ActionRestorePreset:
+		if t.Preset == "" {
+			return errors.New("restore_preset needs a preset")
+		}
+		t.Hosts, t.Power = nil, ""
+	case ActionCheckHosts:
+		t.Preset, t.Power = "", ""
+	case ActionDisplayPower:
+		if t.Power != "on" && t.Power != "off" {
+			return errors.New("display_power needs power on or off")
+		}
+		t.Preset = ""
+	default:
+		return fmt.Errorf("unknown action %q", t.Action)
+	}
+	return nil
+}
+
+// Public returns a copy without the token hash.
+func (t Trigger) Public() Trigger {
+	t.TokenHash = ""
+	return t
+}
+
+// List returns the configured triggers.
+func List(store hosts.SettingStore) ([]Trigger, error) {
+	list := []Trigger{}
+	if _, err := store.GetSetting(SettingKey, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Save validates t and stores it. A new trigger gets a token, which is
+// returned once; an existing one keeps its token and history, so the
+// URLs given out keep working when its action changes.
+func Save(store hosts.SettingStore, t Trigger, createdBy string) (Trigger, string, error) {
+	if err := t.Validate(); err != nil {
+		return Trigger{}, "", err
+	}
+	list, err := List(store)
+	if err != nil {
+		return Trigger{}, "", err
+	}
+
+	var token string
+	i := slices.IndexFunc(list, func(old Trigger) bool { return old.Name == t.Name })
+	if i >= 0 {
+		old := list[i]
+		t.TokenPrefix, t.TokenHash = old.TokenPrefix, old.TokenHash
+		t.CreatedAt, t.CreatedBy = old.CreatedAt, old.CreatedBy
+		t.LastFiredAt, t.LastResult = old.LastFiredAt, old.LastResult
+		list[i] = t
+	} else {
+		secret, err := auth.NewToken()
+		if err != nil {
+			return Trigger{}, "", err
+		}
+		token = TokenPrefix + secret
+		t.TokenPrefix = token[:len(TokenPrefix)+6]
+		t.TokenHash = auth.HashToken(token)
+		t.CreatedAt, t.CreatedBy = time.Now().UTC(), createdBy
+		t.LastFiredAt, t.LastResult = time.Time{}, ""
+		list = append(list, t)
+	}
+	return t, token, store.PutSetting(SettingKey, list)
+}
+
+// Delete removes the trigger with name, which stops its URL working.
+func Delete(store hosts.SettingStore, name string) error {
+	list, err := List(store)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(list, func(t Trigger) bool { return t.Name == name })
+	if i < 0 {
+		return ErrNotFound
+	}
+	return store.PutSetting(SettingKey, slices.Delete(list, i, i+1))
+}
+
+// Authenticate returns the trigger with name if token is its token.
+func Authenticate(store *hosts.Store, name, token string) (Trigger, error) {
+	list, err := List(store)
+	if err != nil {
+		return Trigger{}, err
+	}
+	i := slices.IndexFunc(list, func(t Trigger) bool { return t.Name == name })
+	if i < 0 {
+		return Trigger{}, ErrNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashToken(token)), []byte(list[i].TokenHash)) != 1 {
+		return Trigger{}, ErrDenied
+	}
+	return list[i], nil
+}
+
+// RecordFired notes when the trigger with name last ran and what came of
+// it.
+func RecordFired(store hosts.SettingStore, name string, at time.Time, result string) error {
+	list, err := List(store)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(list, func(t Trigger) bool { return t.Name == name })
+	if i < 0 {
+		return ErrNotFound
+	}
+	list[i].LastFiredAt, list[i].LastResult = at.UTC(), result
+	return store.PutSetting(SettingKey, list)
+}
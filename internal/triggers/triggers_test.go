@@ -0,0 +1,70 @@
+package triggers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		t    Trigger
+		ok   bool
+	}{
+		{"preset", Trigger{Name: "Conference", Action: ActionRestorePreset, Preset: "conference"}, true},
+		{"preset missing", Trigger{Name: "conference", Action: ActionRestorePreset}, false},
+		{"check", Trigger{Name: "check-all", Action: ActionCheckHosts}, true},
+		{"power", Trigger{Name: "screens_off", Action: ActionDisplayPower, Power: "off"}, true},
+		{"power missing", Trigger{Name: "screens", Action: ActionDisplayPower}, false},
+		{"bad name", Trigger{Name: "a/b", Action: ActionCheckHosts}, false},
+		{"unknown action", Trigger{Name: "reboot", Action: "reboot"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.t.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v, want ok %t", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestSaveAndAuthenticate(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	saved, token, err := Save(store, Trigger{Name: "lobby", Action: ActionRestorePreset, Preset: "conference"}, "admin")
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if !strings.HasPrefix(token, TokenPrefix) || !strings.HasPrefix(token, saved.TokenPrefix) {
+		t.Fatalf("unexpected token %q for prefix %q", token, saved.TokenPrefix)
+	}
+
+	// Changing the action keeps the token.
+	if _, again, err := Save(store, Trigger{Name: "lobby", Action: ActionDisplayPower, Power: "off"}, "admin"); err != nil || again != "" {
+		t.Fatalf("expected an update without a new token, got %q (%v)", again, err)
+	}
+	got, err := Authenticate(store, "lobby", token)
+	if err != nil || got.Action != ActionDisplayPower || got.CreatedBy != "admin" {
+		t.Errorf("Authenticate: got %+v (%v)", got, err)
+	}
+	if _, err := Authenticate(store, "lobby", "nsmt_wrong"); !errors.Is(err, ErrDenied) {
+		t.Errorf("expected ErrDenied for a wrong token, got %v", err)
+	}
+
+	if err := RecordFired(store, "lobby", time.Now(), "turning 2 displays off"); err != nil {
+		t.Fatalf("RecordFired: %v", err)
+	}
+	if err := Delete(store, "lobby"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := Authenticate(store, "lobby", token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
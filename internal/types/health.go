@@ -0,0 +1,80 @@
+package types
+
+import "time"
+
+// HealthStatus is a peer's liveness as judged from its heartbeats, as
+// opposed to HostStatus, which records the result of an HTTP health check.
+type HealthStatus string
+
+const (
+	HealthOnline      HealthStatus = "online"      // Heartbeats arriving on time
+	HealthDegraded    HealthStatus = "degraded"    // Recent heartbeats missed
+	HealthOffline     HealthStatus = "offline"     // No heartbeat for OfflineAfter, or never heard from
+	HealthStarting    HealthStatus = "starting"    // Heartbeating, but NSM started less than StartupGrace ago
+	HealthMaintenance HealthStatus = "maintenance" // Peer reports it is in maintenance mode
+)
+
+// HealthThresholds control how heartbeat age maps to a HealthStatus.
+type HealthThresholds struct {
+	Interval      time.Duration `json:"interval"`       // How often peers send heartbeats
+	DegradedAfter time.Duration `json:"degraded_after"` // Heartbeat age at which a peer is degraded
+	OfflineAfter  time.Duration `json:"offline_after"`  // Heartbeat age at which a peer is offline
+	StartupGrace  time.Duration `json:"startup_grace"`  // Uptime below which a peer is starting
+}
+
+// DefaultHealthThresholds returns thresholds for a 10 second heartbeat: a
+// peer is degraded after two missed beats and offline after a minute.
+func DefaultHealthThresholds() HealthThresholds {
+	return HealthThresholds{
+		Interval:      10 * time.Second,
+		DegradedAfter: 25 * time.Second,
+		OfflineAfter:  60 * time.Second,
+		StartupGrace:  60 * time.Second,
+	}
+}
+
+// Liveness is what a node knows about a peer from its last heartbeat.
+type Liveness struct {
+	LastSeen    time.Time // When the last heartbeat arrived, by the receiver's clock
+	BootedAt    time.Time // When the peer's NSM process started, by the peer's clock
+	SentAt      time.Time // When the peer sent the last heartbeat, by the peer's clock
+	Maintenance bool      // The peer reported maintenance mode
+}
+
+// DetermineHealth classifies a peer at time now. Maintenance wins over
+// everything but silence: a peer in maintenance that stops heartbeating is
+// still offline.
+func DetermineHealth(l Liveness, now time.Time, t HealthThresholds) HealthStatus {
+	if l.LastSeen.IsZero() {
+		return HealthOffline
+	}
+
+	age := now.Sub(l.LastSeen)
+	switch {
+	case age >= t.OfflineAfter:
+		return HealthOffline
+	case l.Maintenance:
+		return HealthMaintenance
+	case age >= t.DegradedAfter:
+		return HealthDegraded
+	}
+
+	// Uptime is measured on the peer's clock so skew between nodes does not
+	// matter.
+	if !l.BootedAt.IsZero() && !l.SentAt.IsZero() && l.SentAt.Sub(l.BootedAt) < t.StartupGrace {
+		return HealthStarting
+	}
+	return HealthOnline
+}
+
+// HealthFromStatus maps the result of an HTTP health check to a
+// HealthStatus, for hosts that have never sent a heartbeat.
+func HealthFromStatus(s HostStatus) HealthStatus {
+	switch s {
+	case StatusHealthy, StatusStale:
+		return HealthOnline
+	case StatusUnhealthy:
+		return HealthDegraded
+	}
+	return HealthOffline
+}
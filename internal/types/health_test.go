@@ -0,0 +1,31 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDetermineHealth(t *testing.T) {
+	th := DefaultHealthThresholds()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	booted := now.Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		l    Liveness
+		want HealthStatus
+	}{
+		{"never seen", Liveness{}, HealthOffline},
+		{"fresh", Liveness{LastSeen: now.Add(-5 * time.Second), BootedAt: booted, SentAt: now}, HealthOnline},
+		{"missed beats", Liveness{LastSeen: now.Add(-30 * time.Second), BootedAt: booted, SentAt: now}, HealthDegraded},
+		{"silent", Liveness{LastSeen: now.Add(-2 * time.Minute), BootedAt: booted, SentAt: now}, HealthOffline},
+		{"just booted", Liveness{LastSeen: now, BootedAt: now.Add(-10 * time.Second), SentAt: now}, HealthStarting},
+		{"maintenance", Liveness{LastSeen: now.Add(-30 * time.Second), Maintenance: true}, HealthMaintenance},
+		{"maintenance but silent", Liveness{LastSeen: now.Add(-time.Hour), Maintenance: true}, HealthOffline},
+	}
+	for _, tt := range tests {
+		if got := DetermineHealth(tt.l, now, th); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -4,11 +4,15 @@
 package types
 
 import (
+	"fmt"
+	"net/netip"
+	"strings"
 	"time"
 )
 
-// Version is the current version of NSM
-const Version = "0.2.0"
+// Version is the current version of NSM. Release builds may set it via
+// -ldflags.
+var Version = "0.2.0"
 
 // BuildTime is set at build time via -ldflags
 var BuildTime = "dev"
@@ -31,8 +35,42 @@ const (
 	CMSOnline  AnthiasCMSStatus = "CMS Online"
 	CMSOffline AnthiasCMSStatus = "CMS Offline"
 	CMSUnknown AnthiasCMSStatus = "CMS Unknown"
+	// CMSNotChecked is reported for hosts whose Anthias probe is turned
+	// off, such as nodes that only run NSM.
+	CMSNotChecked AnthiasCMSStatus = "CMS Not Checked"
 )
 
+// PathPreference overrides how this node reaches a host that has both a LAN
+// and a VPN address.
+type PathPreference string
+
+const (
+	PathAuto PathPreference = ""    // Use the LAN unless only the VPN is reachable
+	PathLAN  PathPreference = "lan" // Always use the LAN address
+	PathVPN  PathPreference = "vpn" // Always use the VPN address when one is set
+)
+
+// CMSKind is the content management system a host's player runs. NSM
+// reads the status and asset list of each; only Anthias can be changed
+// from NSM.
+type CMSKind string
+
+const (
+	CMSAnthias   CMSKind = ""          // Anthias, including Screenly OSE from before its rename
+	CMSPiSignage CMSKind = "pisignage" // A piSignage player, through its local web API
+)
+
+// Name returns the CMS name as shown to people.
+func (k CMSKind) Name() string {
+	switch k {
+	case CMSAnthias:
+		return "Anthias"
+	case CMSPiSignage:
+		return "piSignage"
+	}
+	return string(k)
+}
+
 // Host represents a single Anthias digital signage host on the network.
 // Hosts are identified by IP address and managed manually via the dashboard.
 type Host struct {
@@ -60,4 +98,237 @@ type Host struct {
 	DashboardURLVPN   string           `json:"dashboard_url_vpn,omitempty"`   // URL to host's NSM dashboard over VPN
 	LastChecked       time.Time        `json:"last_checked"`                  // Last time LAN status was checked
 	LastCheckedVPN    time.Time        `json:"last_checked_vpn,omitempty"`    // Last time VPN status was checked
+	PathPreference    PathPreference   `json:"path_preference,omitempty"`     // Optional: force outbound calls over the LAN or VPN
+	CMS               CMSKind          `json:"cms,omitempty"`                 // Optional: CMS the player runs; empty is Anthias
+	ContentExpiresAt  time.Time        `json:"content_expires_at,omitzero"`   // When the last enabled asset ends and the playlist runs empty
+	AssetDrift        string           `json:"asset_drift,omitempty"`         // How the asset list differs from the host's baseline, e.g. "added: Lunch menu"; computed on read
+	Playing           string           `json:"playing,omitempty"`             // What the host's built-in player shows, e.g. "Welcome (2/5)"; computed on read
+	ViewerProblem     string           `json:"viewer_problem,omitempty"`      // Set while the viewer crash-loops, e.g. "anthias-viewer restarted 4 times in 10 minutes"; computed on read
+	Timezone          string           `json:"timezone,omitempty"`            // Optional: IANA timezone of the screen's site; empty uses this node's
+	ClockSkewMS       int64            `json:"clock_skew_ms,omitempty"`       // Host clock minus this node's at the last check; positive is ahead
+	ClockCheckedAt    time.Time        `json:"clock_checked_at,omitzero"`     // When ClockSkewMS was measured; zero if the host does not report its time
+	MACAddress        string           `json:"mac_address,omitempty"`         // From this node's ARP table during discovery
+	SwitchPort        string           `json:"switch_port,omitempty"`         // Switch port the MAC was last seen on, e.g. "Gi1/0/14 on 192.168.1.2"
+	Health            HealthStatus     `json:"health"`                        // Liveness from heartbeats; computed on read, not stored
+	LastSeen          time.Time        `json:"last_seen,omitzero"`            // Last heartbeat received from the host; computed on read
+	TimeSync          string           `json:"time_sync,omitempty"`           // NTP state from the host's heartbeats (see TimeSyncSynced); computed on read
+	Stratum           int              `json:"stratum,omitempty"`             // NTP stratum the host reported, 0 if unknown; computed on read
+	Throttled         []string         `json:"throttled,omitempty"`           // Pi firmware throttle flags holding at the last heartbeat (see ThrottleFlags); computed on read
+	ThrottledSince    []string         `json:"throttled_since,omitempty"`     // Flags that have held at some point since the host booted; computed on read
+	LatencyMS         float64          `json:"latency_ms,omitempty"`          // TCP connect time from this node at the last check, on the path in use; computed on read
+	LossPercent       int              `json:"loss_percent,omitempty"`        // Share of that check's probes that failed; computed on read
+	ResolvedIP        string           `json:"resolved_ip,omitempty"`         // When IPAddress is a DNS name, the IP it last resolved to; computed on read
+	ResolvedVPNIP     string           `json:"resolved_vpn_ip,omitempty"`     // Likewise for VPNIPAddress
+	ResolveError      string           `json:"resolve_error,omitempty"`       // Why the last lookup of either name failed; computed on read
+	FailedChecks      int              `json:"failed_checks,omitempty"`       // Health checks in a row that reached neither network; computed on read
+	NextCheckAt       time.Time        `json:"next_check_at,omitzero"`        // Sweeps skip the host until then after failed checks; computed on read
+	Versions          Versions         `json:"versions,omitzero"`             // Edits to the fields nodes replicate, for merging concurrent edits
+}
+
+// Versions records which edits a host record includes, so nodes merging a
+// record keep the newest change to each replicated field and can tell
+// concurrent edits from stale copies. Vector counts each node's edits to
+// the record; Fields holds the edit that last set each field.
+type Versions struct {
+	Vector map[string]uint64       `json:"vector,omitempty"` // Node ID -> edits by that node
+	Fields map[string]FieldVersion `json:"fields,omitempty"` // Field JSON name -> its last edit
+}
+
+// IsZero reports whether no edits are recorded, as for hosts from nodes
+// that predate versions.
+func (v Versions) IsZero() bool {
+	return len(v.Vector) == 0 && len(v.Fields) == 0
+}
+
+// FieldVersion identifies the edit that last set a field.
+type FieldVersion struct {
+	Node  string `json:"node"`  // Node that made the edit
+	Seq   uint64 `json:"seq"`   // The node's edit count, in Vector, after the edit
+	Clock uint64 `json:"clock"` // Lamport time of the edit; orders concurrent edits
+}
+
+// Location returns the host's timezone, or this node's when none is set or
+// the name is unknown.
+func (h Host) Location() *time.Location {
+	if h.Timezone != "" {
+		if loc, err := time.LoadLocation(h.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// InZone returns t on the host's local clock.
+func (h Host) InZone(t time.Time) time.Time {
+	return t.In(h.Location())
+}
+
+// Localize moves the host's timestamps into its timezone so that the API
+// and dashboard show them as the site sees them. It does nothing for hosts
+// without a timezone.
+func (h *Host) Localize() {
+	if h.Timezone == "" {
+		return
+	}
+	loc := h.Location()
+	for _, t := range []*time.Time{&h.LastChecked, &h.LastCheckedVPN, &h.ContentExpiresAt, &h.LastSeen, &h.ClockCheckedAt, &h.NextCheckAt} {
+		if !t.IsZero() {
+			*t = t.In(loc)
+		}
+	}
+}
+
+// MoveTo sets the host's LAN IP. When the IP changes, the results of
+// checks at the old one are cleared, as they describe another machine.
+func (h *Host) MoveTo(ip string) {
+	h.DashboardURL = fmt.Sprintf("http://%s:8080", ip)
+	if ip == h.IPAddress {
+		return
+	}
+	h.IPAddress = ip
+	h.Status = StatusUnreachable
+	h.NSMStatus = "NSM Offline"
+	h.NSMVersion = "unknown"
+	h.CMSStatus = CMSUnknown
+	h.AssetCount = 0
+	h.ContentExpiresAt = time.Time{}
+	h.LastChecked = time.Time{}
+	h.ClockCheckedAt = time.Time{}
+}
+
+// SimulatedNetwork holds the addresses of simulated hosts (nsm -simulate).
+// It is the benchmarking range of RFC 2544, which is never routed, so no
+// real host is mistaken for one.
+var SimulatedNetwork = netip.MustParsePrefix("198.18.0.0/15")
+
+// Simulated reports whether the host is simulated. Simulated hosts are
+// never probed or sent heartbeats; the simulator reports for them.
+func (h Host) Simulated() bool {
+	addr, err := netip.ParseAddr(h.IPAddress)
+	return err == nil && SimulatedNetwork.Contains(addr)
+}
+
+// ContentWarningWindow is how far ahead the dashboard warns that a host's
+// playlist is about to run empty.
+const ContentWarningWindow = 3 * 24 * time.Hour
+
+// ContentWarning describes when the host's playlist runs empty, or returns
+// "" if that is unknown or further away than ContentWarningWindow.
+func (h Host) ContentWarning() string {
+	return h.contentWarning(time.Now())
+}
+
+func (h Host) contentWarning(now time.Time) string {
+	if h.ContentExpiresAt.IsZero() {
+		return ""
+	}
+	left := h.ContentExpiresAt.Sub(now)
+	switch {
+	case left <= 0:
+		return "All content expired"
+	case left > ContentWarningWindow:
+		return ""
+	case left < time.Hour:
+		return "Content ends in under an hour"
+	case left < 48*time.Hour:
+		return fmt.Sprintf("Content ends in %dh", int(left.Hours()))
+	}
+	return fmt.Sprintf("Content ends in %dd", int(left.Hours()/24))
+}
+
+// ClockSkewThreshold is how far a host's clock may drift from this node's
+// before the dashboard flags it. Schedules and content start and end times
+// are kept to the minute, so a few seconds is harmless.
+const ClockSkewThreshold = 5 * time.Second
+
+// ClockSkew is how far the host's clock was ahead of this node's at the
+// last check; negative means behind.
+func (h Host) ClockSkew() time.Duration {
+	return time.Duration(h.ClockSkewMS) * time.Millisecond
+}
+
+// ClockWarning describes the host's clock skew, or returns "" if it is
+// unknown or within ClockSkewThreshold.
+func (h Host) ClockWarning() string {
+	skew := h.ClockSkew()
+	if h.ClockCheckedAt.IsZero() || (skew < ClockSkewThreshold && skew > -ClockSkewThreshold) {
+		return ""
+	}
+	dir := "ahead"
+	if skew < 0 {
+		dir, skew = "behind", -skew
+	}
+	switch {
+	case skew >= time.Hour:
+		return fmt.Sprintf("Clock %dh %s", int(skew.Hours()), dir)
+	case skew >= time.Minute:
+		return fmt.Sprintf("Clock %dm %s", int(skew.Minutes()), dir)
+	}
+	return fmt.Sprintf("Clock %ds %s", int(skew.Seconds()), dir)
+}
+
+// NTP states a host reports in its heartbeats. An empty state means the
+// host runs neither chrony nor systemd-timesyncd, or an older NSM.
+const (
+	TimeSyncSynced   = "synced"
+	TimeSyncUnsynced = "unsynced"
+)
+
+// Throttle flags a Raspberry Pi's firmware reports through "vcgencmd
+// get_throttled". A throttled Pi still plays, but video stutters.
+const (
+	ThrottleUnderVoltage  = "under_voltage"   // The supply is below 4.63 V
+	ThrottleFreqCapped    = "freq_capped"     // The ARM frequency is capped to keep the SoC cool
+	ThrottleThrottled     = "throttled"       // The CPU is throttled
+	ThrottleSoftTempLimit = "soft_temp_limit" // The soft temperature limit (60 C by default) is reached
+)
+
+// throttleFlags are in the order of get_throttled's bits: bits 0-3 are set
+// while a condition holds and bits 16-19 once it has held since boot.
+var throttleFlags = [...]string{ThrottleUnderVoltage, ThrottleFreqCapped, ThrottleThrottled, ThrottleSoftTempLimit}
+
+// ThrottleFlags returns the flags set in the value of vcgencmd
+// get_throttled: those holding now and those that have held since boot.
+func ThrottleFlags(bits uint32) (now, sinceBoot []string) {
+	for i, flag := range throttleFlags {
+		if bits&(1<<i) != 0 {
+			now = append(now, flag)
+		}
+		if bits&(1<<(16+i)) != 0 {
+			sinceBoot = append(sinceBoot, flag)
+		}
+	}
+	return now, sinceBoot
+}
+
+// throttleLabels are the dashboard names of the throttle flags.
+var throttleLabels = map[string]string{
+	ThrottleUnderVoltage:  "under-voltage",
+	ThrottleFreqCapped:    "frequency capped",
+	ThrottleThrottled:     "CPU throttled",
+	ThrottleSoftTempLimit: "running hot",
+}
+
+// DescribeThrottle lists throttle flags by their dashboard names.
+func DescribeThrottle(flags []string) string {
+	labels := make([]string, len(flags))
+	for i, flag := range flags {
+		labels[i] = throttleLabels[flag]
+	}
+	return strings.Join(labels, ", ")
+}
+
+// ThrottleWarning describes the throttling the host reported in its last
+// heartbeat, or returns "" if there is none.
+func (h Host) ThrottleWarning() string {
+	if len(h.Throttled) == 0 {
+		return ""
+	}
+	return "Throttled: " + DescribeThrottle(h.Throttled)
+}
+
+// ThrottleHistory describes the throttling the host has had since it
+// booted, or returns "" if there has been none.
+func (h Host) ThrottleHistory() string {
+	return DescribeThrottle(h.ThrottledSince)
 }
@@ -0,0 +1,105 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Role controls what a user may do in the dashboard and API.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Read-only access
+	RoleOperator Role = "operator" // Manage hosts, run checks and actions
+	RoleAdmin    Role = "admin"    // Manage users, settings, and security
+)
+
+// Allows reports whether r grants at least the privileges of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := roleRank[r]
+	return ok
+}
+
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// UserPrefs holds per-user dashboard preferences.
+type UserPrefs struct {
+	Theme       string     `json:"theme,omitempty"`        // "dark" (default) or "light"
+	DefaultView string     `json:"default_view,omitempty"` // home, advanced, api, docs
+	SiteScope   []string   `json:"site_scope,omitempty"`   // Optional host subnets/sites shown by default
+	Table       TablePrefs `json:"table,omitzero"`         // How the host table is laid out and refreshed
+}
+
+// Host table densities.
+const (
+	DensityComfortable = "comfortable" // Default
+	DensityCompact     = "compact"     // Smaller text and padding, for laptops
+	DensityLarge       = "large"       // Larger text, for wall-mounted monitors
+)
+
+// HostColumns are the host table columns, in table order.
+var HostColumns = []string{"name", "lan_ip", "vpn_ip", "nsm_dash", "anthias_dash", "notes", "actions"}
+
+// MinRefreshSeconds is the shortest batching interval for host table
+// updates.
+const MinRefreshSeconds = 5
+
+// TablePrefs tailors the host table, e.g. for a NOC wall monitor versus a
+// laptop.
+type TablePrefs struct {
+	Columns        []string `json:"columns,omitempty"`         // Shown columns from HostColumns; empty shows all
+	Density        string   `json:"density,omitempty"`         // DensityComfortable by default
+	RefreshSeconds int      `json:"refresh_seconds,omitempty"` // 0 streams changes live; else at most one update per interval
+}
+
+// Validate rejects preferences the dashboard could not apply.
+func (t TablePrefs) Validate() error {
+	for _, c := range t.Columns {
+		if !slices.Contains(HostColumns, c) {
+			return fmt.Errorf("unknown column %q (use %s)", c, strings.Join(HostColumns, ", "))
+		}
+	}
+	switch t.Density {
+	case "", DensityComfortable, DensityCompact, DensityLarge:
+	default:
+		return fmt.Errorf("density must be %s, %s, or %s", DensityComfortable, DensityCompact, DensityLarge)
+	}
+	if t.RefreshSeconds != 0 && (t.RefreshSeconds < MinRefreshSeconds || t.RefreshSeconds > 3600) {
+		return fmt.Errorf("refresh_seconds must be 0 (live) or %d to 3600", MinRefreshSeconds)
+	}
+	return nil
+}
+
+// User is a dashboard account. Records replicate between peers, so deletes
+// are kept as tombstones and UpdatedAt decides which copy wins.
+type User struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email,omitempty"`
+	PasswordHash string    `json:"password_hash,omitempty"` // Never returned by user-facing endpoints
+	Role         Role      `json:"role"`
+	Prefs        UserPrefs `json:"prefs"`
+	Provider     string    `json:"provider,omitempty"`    // "" for local accounts, "oidc" for single sign-on
+	ExternalID   string    `json:"external_id,omitempty"` // Identity provider subject ("issuer|sub")
+	Disabled     bool      `json:"disabled,omitempty"`
+	Deleted      bool      `json:"deleted,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Public returns a copy without the password hash for API responses.
+func (u User) Public() User {
+	u.PasswordHash = ""
+	return u
+}
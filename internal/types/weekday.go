@@ -0,0 +1,29 @@
+package types
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// weekdays are the day names used by reboot schedules, quiet hours and
+// scripts, indexed by time.Weekday.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// DayName returns the name of d: "sun" ... "sat".
+func DayName(d time.Weekday) string {
+	return weekdays[d]
+}
+
+// ParseDay reads a day given as "Mon", "monday" or the like, ignoring case
+// and surrounding space, and returns its name as DayName does.
+func ParseDay(s string) (string, bool) {
+	d := strings.ToLower(strings.TrimSpace(s))
+	if len(d) > 3 {
+		d = d[:3]
+	}
+	if !slices.Contains(weekdays, d) {
+		return "", false
+	}
+	return d, true
+}
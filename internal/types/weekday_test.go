@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDay(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"mon", "mon", true},
+		{" Tuesday ", "tue", true},
+		{"SAT", "sat", true},
+		{"", "", false},
+		{"mo", "", false},
+		{"funday", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := ParseDay(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("ParseDay(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+	if got := DayName(time.Sunday); got != "sun" {
+		t.Errorf("DayName(Sunday) = %q", got)
+	}
+}
@@ -0,0 +1,154 @@
+// Package vault stores per-host credentials (Anthias basic auth, SSH
+// logins) encrypted with a key derived from the node identity. Secrets are
+// sealed with AES-256-GCM, bound to their host and kind, and are only
+// opened for outbound calls made by this node. They are never returned by
+// the API.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+// Credential kinds.
+const (
+	KindAnthiasBasic   = "anthias_basic"   // HTTP basic auth for the Anthias web UI/API
+	KindPiSignageBasic = "pisignage_basic" // HTTP basic auth for a piSignage player's web UI/API
+	KindSSHPassword    = "ssh_password"    // SSH login with a password
+	KindSSHKey         = "ssh_key"         // SSH login with a PEM private key
+)
+
+// ValidKind reports whether kind is a supported credential kind.
+func ValidKind(kind string) bool {
+	switch kind {
+	case KindAnthiasBasic, KindPiSignageBasic, KindSSHPassword, KindSSHKey:
+		return true
+	}
+	return false
+}
+
+var (
+	// ErrUnavailable is returned when the node identity could not be loaded.
+	ErrUnavailable = errors.New("credentials vault is unavailable without a node identity key")
+	// ErrCannotOpen is returned when a secret was sealed by another node's
+	// key, e.g. after restoring a backup from a different machine.
+	ErrCannotOpen = errors.New("credential was sealed by a different node; set it again")
+)
+
+// Vault seals and opens host credentials.
+type Vault struct {
+	store  *hosts.Store
+	sealer *Sealer
+}
+
+// New creates a vault using a key derived from id. A nil identity yields a
+// vault whose operations return ErrUnavailable.
+func New(store *hosts.Store, id *identity.Identity) (*Vault, error) {
+	v := &Vault{store: store}
+	if id == nil {
+		return v, nil
+	}
+	var err error
+	if v.sealer, err = NewSealer(id, "vault"); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Sealer seals values with AES-256-GCM under a key derived from the node
+// identity for one purpose. It implements hosts.Sealer, which encrypts
+// settings at rest.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer derives the key for purpose from id.
+func NewSealer(id *identity.Identity, purpose string) (*Sealer, error) {
+	key, err := id.DeriveKey(purpose)
+	if err != nil {
+		return nil, fmt.Errorf("derive %s key: %w", purpose, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Seal encrypts plain under a random nonce, which it prepends.
+func (s *Sealer) Seal(plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+// Open decrypts a value sealed by Seal with the same key and additional
+// data.
+func (s *Sealer) Open(sealed, additional []byte) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("sealed value too short")
+	}
+	return s.aead.Open(nil, sealed[:n], sealed[n:], additional)
+}
+
+// Put seals secret and attaches it to a host, replacing any credential of
+// the same kind.
+func (v *Vault) Put(hostID, kind, username, secret string) (hosts.Credential, error) {
+	if v.sealer == nil {
+		return hosts.Credential{}, ErrUnavailable
+	}
+	if !ValidKind(kind) {
+		return hosts.Credential{}, fmt.Errorf("unsupported credential kind %q", kind)
+	}
+	if secret == "" {
+		return hosts.Credential{}, errors.New("secret is required")
+	}
+
+	sealed, err := v.sealer.Seal([]byte(secret), additionalData(hostID, kind))
+	if err != nil {
+		return hosts.Credential{}, err
+	}
+
+	return v.store.PutCredential(hosts.Credential{
+		HostID:   hostID,
+		Kind:     kind,
+		Username: username,
+		Sealed:   sealed,
+	})
+}
+
+// Open returns the username and plaintext secret of a host credential.
+func (v *Vault) Open(hostID, kind string) (username, secret string, err error) {
+	if v.sealer == nil {
+		return "", "", ErrUnavailable
+	}
+	c, err := v.store.GetCredential(hostID, kind)
+	if err != nil {
+		return "", "", err
+	}
+
+	plain, err := v.sealer.Open(c.Sealed, additionalData(hostID, kind))
+	if err != nil {
+		return "", "", ErrCannotOpen
+	}
+	return c.Username, string(plain), nil
+}
+
+// additionalData binds a sealed secret to its host and kind, so a value
+// copied to another row fails to open.
+func additionalData(hostID, kind string) []byte {
+	return []byte("nsm-vault|" + hostID + "|" + kind)
+}
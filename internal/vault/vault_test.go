@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
+)
+
+func newTestVault(t *testing.T, store *hosts.Store) *Vault {
+	t.Helper()
+	id, err := identity.LoadOrCreate(filepath.Join(t.TempDir(), identity.DefaultKeyFile))
+	if err != nil {
+		t.Fatalf("LoadOrCreate: %v", err)
+	}
+	v, err := New(store, id)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return v
+}
+
+func TestSealAndOpen(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+	v := newTestVault(t, store)
+
+	if _, err := v.Put("host-1", KindAnthiasBasic, "admin", "hunter22"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	user, secret, err := v.Open("host-1", KindAnthiasBasic)
+	if err != nil || user != "admin" || secret != "hunter22" {
+		t.Fatalf("Open = %q, %q, %v", user, secret, err)
+	}
+
+	stored, _ := store.GetCredential("host-1", KindAnthiasBasic)
+	if bytes.Contains(stored.Sealed, []byte("hunter22")) {
+		t.Errorf("secret stored in plaintext")
+	}
+
+	// A sealed value moved to another host does not open.
+	moved := stored
+	moved.HostID = "host-2"
+	if _, err := store.PutCredential(moved); err != nil {
+		t.Fatalf("PutCredential: %v", err)
+	}
+	if _, _, err := v.Open("host-2", KindAnthiasBasic); err != ErrCannotOpen {
+		t.Errorf("expected ErrCannotOpen for moved secret, got %v", err)
+	}
+
+	// Another node's key cannot open it either.
+	other := newTestVault(t, store)
+	if _, _, err := other.Open("host-1", KindAnthiasBasic); err != ErrCannotOpen {
+		t.Errorf("expected ErrCannotOpen with another key, got %v", err)
+	}
+
+	if _, err := v.Put("host-1", "telnet", "root", "x"); err == nil {
+		t.Errorf("expected unsupported kind to be rejected")
+	}
+	if _, err := New(store, nil); err != nil {
+		t.Fatalf("New without identity: %v", err)
+	}
+	disabled, _ := New(store, nil)
+	if _, err := disabled.Put("host-1", KindSSHPassword, "pi", "raspberry"); err != ErrUnavailable {
+		t.Errorf("expected ErrUnavailable without identity, got %v", err)
+	}
+}
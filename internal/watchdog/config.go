@@ -0,0 +1,125 @@
+package watchdog
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// ConfigSettingKey holds this node's watchdog settings. Settings are not
+// replicated, as each node restarts only its own Anthias.
+const ConfigSettingKey = "watchdog"
+
+// Defaults for settings left empty.
+const (
+	DefaultCheckURL    = "http://127.0.0.1/api/v2/info"
+	DefaultCommand     = "docker compose -f /home/pi/screenly/docker-compose.yml restart"
+	DefaultFailures    = 3
+	DefaultCooldown    = 15
+	DefaultMaxRestarts = 3
+
+	DefaultViewer          = "anthias-viewer"
+	DefaultCrashLoop       = 3
+	DefaultCrashLoopWindow = 10
+	DefaultFallbackCommand = "mpv --fs --ontop --really-quiet --no-terminal --image-display-duration=inf"
+)
+
+// Config is when the watchdog restarts Anthias and how.
+type Config struct {
+	Enabled     bool   `json:"enabled"`
+	CheckURL    string `json:"check_url"`        // Asked every minute; the CMS is down while it does not answer or answers with a 5xx status
+	Failures    int    `json:"failures"`         // Failed checks in a row before a restart
+	Command     string `json:"command"`          // Restarts Anthias; split on spaces
+	Cooldown    int    `json:"cooldown_minutes"` // Least time between two restarts
+	MaxRestarts int    `json:"max_restarts"`     // Restarts without the CMS coming back before the watchdog waits for someone to fix it
+
+	Viewer          string `json:"viewer"`                   // Docker container of the Anthias viewer, matched by name; the built-in player's browser is watched instead while it runs
+	CrashLoop       int    `json:"crash_loop_restarts"`      // Viewer restarts within CrashLoopWindow that count as a crash loop
+	CrashLoopWindow int    `json:"crash_loop_minutes"`       // In minutes
+	FallbackImage   string `json:"fallback_image,omitempty"` // Path or URL of an image shown while the viewer crash-loops; empty shows none
+	FallbackCommand string `json:"fallback_command"`         // Shows the image, added as the last argument; split on spaces
+	Display         string `json:"display,omitempty"`        // DISPLAY for FallbackCommand, e.g. ":0"; empty keeps NSM's
+}
+
+// DefaultConfig is used until an operator saves watchdog settings.
+func DefaultConfig() Config {
+	return Config{
+		CheckURL:    DefaultCheckURL,
+		Failures:    DefaultFailures,
+		Command:     DefaultCommand,
+		Cooldown:    DefaultCooldown,
+		MaxRestarts: DefaultMaxRestarts,
+
+		Viewer:          DefaultViewer,
+		CrashLoop:       DefaultCrashLoop,
+		CrashLoopWindow: DefaultCrashLoopWindow,
+		FallbackCommand: DefaultFallbackCommand,
+	}
+}
+
+// Validate normalises c and rejects unusable values.
+func (c *Config) Validate() error {
+	c.CheckURL = strings.TrimSpace(c.CheckURL)
+	if c.CheckURL == "" {
+		c.CheckURL = DefaultCheckURL
+	}
+	if u, err := url.Parse(c.CheckURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("check_url must be an http or https URL")
+	}
+	c.Command = strings.TrimSpace(c.Command)
+	if c.Command == "" {
+		c.Command = DefaultCommand
+	}
+	if c.Failures == 0 {
+		c.Failures = DefaultFailures
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = DefaultCooldown
+	}
+	if c.MaxRestarts == 0 {
+		c.MaxRestarts = DefaultMaxRestarts
+	}
+	if c.Failures < 1 || c.Cooldown < 1 || c.MaxRestarts < 1 {
+		return errors.New("failures, cooldown_minutes and max_restarts must be positive")
+	}
+
+	c.Viewer = strings.TrimSpace(c.Viewer)
+	if c.Viewer == "" {
+		c.Viewer = DefaultViewer
+	}
+	if c.CrashLoop == 0 {
+		c.CrashLoop = DefaultCrashLoop
+	}
+	if c.CrashLoopWindow == 0 {
+		c.CrashLoopWindow = DefaultCrashLoopWindow
+	}
+	if c.CrashLoop < 2 || c.CrashLoopWindow < 1 {
+		return errors.New("crash_loop_restarts must be at least 2 and crash_loop_minutes positive")
+	}
+	c.FallbackImage = strings.TrimSpace(c.FallbackImage)
+	c.FallbackCommand = strings.TrimSpace(c.FallbackCommand)
+	if c.FallbackCommand == "" {
+		c.FallbackCommand = DefaultFallbackCommand
+	}
+	c.Display = strings.TrimSpace(c.Display)
+	return nil
+}
+
+// LoadConfig reads the watchdog settings, falling back to DefaultConfig.
+func LoadConfig(store hosts.SettingStore) (Config, error) {
+	cfg := DefaultConfig()
+	if _, err := store.GetSetting(ConfigSettingKey, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// SaveConfig validates and stores the watchdog settings.
+func SaveConfig(store hosts.SettingStore, cfg Config) (Config, error) {
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, store.PutSetting(ConfigSettingKey, cfg)
+}
@@ -0,0 +1,212 @@
+package watchdog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// AuditViewerCrashLoop is the audit action recorded when the watchdog finds
+// the viewer crash-looping.
+const AuditViewerCrashLoop = "host.viewer_crash_loop"
+
+// PlayerProcess is the viewer name used for the built-in player's browser.
+const PlayerProcess = "player"
+
+// Limits on the viewer output kept with a crash loop, which goes out in
+// heartbeats.
+const (
+	logLines = 20
+	logBytes = 2000
+)
+
+// PlayerProvider reports on the browser of the built-in player.
+type PlayerProvider interface {
+	// BrowserExits returns how often the browser has exited and its last
+	// output; ok is false while the player is off.
+	BrowserExits() (exits int, output string, ok bool)
+}
+
+// viewerState is what the watchdog tracks of the viewer.
+type viewerState struct {
+	process  string
+	count    int         // Restart count at the last check
+	restarts []time.Time // Restarts seen within the window
+	err      string      // Why the last count failed, so each error is logged once
+	report   *hosts.Viewer
+	fallback func() // Stops the fallback image; nil while none is shown
+}
+
+// SetPlayer makes the watchdog watch the browser of p, instead of the
+// Anthias viewer, while p runs.
+func (w *Watchdog) SetPlayer(p PlayerProvider) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.player = p
+}
+
+// playerRuns reports whether the built-in player is on. The caller holds
+// mu.
+func (w *Watchdog) playerRuns() bool {
+	if w.player == nil {
+		return false
+	}
+	_, _, ok := w.player.BrowserExits()
+	return ok
+}
+
+// watchViewer counts viewer restarts at now, and reports a crash loop once
+// cfg.CrashLoop of them fall within the window. The caller holds mu.
+func (w *Watchdog) watchViewer(cfg Config, nodeID string, now time.Time) {
+	process, count, logs, err := w.viewerRestarts(cfg)
+	v := &w.viewer
+	if err != nil {
+		if err.Error() != v.err {
+			w.logger.Warning(fmt.Sprintf("Watchdog: cannot count restarts of %s: %v", process, err))
+		}
+		v.err = err.Error()
+		return
+	}
+	v.err = ""
+
+	// The first count, and one from a recreated container, is a baseline.
+	if process != v.process || v.report == nil || count < v.count {
+		w.resetViewer()
+		v.process = process
+	} else {
+		for i := v.count; i < count && i-v.count < cfg.CrashLoop; i++ {
+			v.restarts = append(v.restarts, now)
+		}
+	}
+	v.count = count
+	window := time.Duration(cfg.CrashLoopWindow) * time.Minute
+	kept := v.restarts[:0]
+	for _, t := range v.restarts {
+		if now.Sub(t) < window {
+			kept = append(kept, t)
+		}
+	}
+	v.restarts = kept
+	var prev hosts.Viewer
+	if v.report != nil {
+		prev = *v.report
+	}
+
+	report := hosts.Viewer{State: hosts.ViewerOK, Process: process, Restarts: len(v.restarts), Window: cfg.CrashLoopWindow}
+	looping := len(v.restarts) >= cfg.CrashLoop
+	switch {
+	case looping && prev.State != hosts.ViewerCrashLoop:
+		report.State, report.Since, report.Logs = hosts.ViewerCrashLoop, now.UTC(), lastLines(logs(), logLines, logBytes)
+		detail := report.Summary()
+		if cfg.FallbackImage != "" && v.fallback == nil {
+			stop, err := w.show(append(strings.Fields(cfg.FallbackCommand), cfg.FallbackImage), cfg.Display)
+			if err != nil {
+				detail += fmt.Sprintf("; showing %s failed: %v", cfg.FallbackImage, err)
+			} else {
+				v.fallback = stop
+				detail += "; showing " + cfg.FallbackImage
+			}
+		}
+		w.logger.Error(fmt.Sprintf("Watchdog: %s. Its last output:\n%s", detail, report.Logs))
+		w.store.AppendAudit(hosts.AuditEntry{Time: now.UTC(), Actor: "nsm", ActorType: hosts.ActorSystem,
+			Action: AuditViewerCrashLoop, Target: nodeID, Detail: detail})
+	case looping:
+		report.State, report.Since, report.Logs = hosts.ViewerCrashLoop, prev.Since, prev.Logs
+	case prev.State == hosts.ViewerCrashLoop:
+		w.logger.Info(fmt.Sprintf("Watchdog: %s has stopped restarting", process))
+		w.hideFallback()
+	}
+	report.Fallback = v.fallback != nil
+	v.report = &report
+	w.store.RecordViewer(nodeID, report, now)
+}
+
+// viewerRestarts returns the viewer being watched, how often it has
+// restarted and a function reading its last output. The caller holds mu.
+func (w *Watchdog) viewerRestarts(cfg Config) (process string, count int, logs func() string, err error) {
+	if w.player != nil {
+		if exits, output, ok := w.player.BrowserExits(); ok {
+			return PlayerProcess, exits, func() string { return output }, nil
+		}
+	}
+	out, err := w.run([]string{"docker", "ps", "-a", "-q", "--filter", "name=" + cfg.Viewer})
+	if err != nil {
+		return cfg.Viewer, 0, nil, commandError(err, out)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return cfg.Viewer, 0, nil, fmt.Errorf("no container named %s", cfg.Viewer)
+	}
+	out, err = w.run([]string{"docker", "inspect", "--format", "{{.RestartCount}}", ids[0]})
+	if err != nil {
+		return cfg.Viewer, 0, nil, commandError(err, out)
+	}
+	count, err = strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil {
+		return cfg.Viewer, 0, nil, fmt.Errorf("unexpected restart count %q", strings.TrimSpace(string(out)))
+	}
+	logs = func() string {
+		out, _ := w.run([]string{"docker", "logs", "--tail", strconv.Itoa(logLines), ids[0]})
+		return string(out)
+	}
+	return cfg.Viewer, count, logs, nil
+}
+
+// resetViewer forgets the viewer's restarts and hides the fallback image.
+// The caller holds mu.
+func (w *Watchdog) resetViewer() {
+	w.hideFallback()
+	w.viewer = viewerState{}
+}
+
+func (w *Watchdog) hideFallback() {
+	if w.viewer.fallback != nil {
+		w.viewer.fallback()
+		w.viewer.fallback = nil
+	}
+}
+
+func commandError(err error, out []byte) error {
+	if line := lastLine(string(out)); line != "" {
+		return fmt.Errorf("%v: %s", err, line)
+	}
+	return err
+}
+
+// showImage starts args on display and returns a function that stops it.
+func showImage(args []string, display string) (func(), error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	if display != "" {
+		cmd.Env = append(os.Environ(), "DISPLAY="+display)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	return func() {
+		cmd.Process.Kill()
+		<-done
+	}, nil
+}
+
+// lastLines returns up to n of the last lines of s, and at most max bytes.
+func lastLines(s string, n, max int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	out := strings.Join(lines, "\n")
+	if len(out) > max {
+		out = out[len(out)-max:]
+	}
+	return out
+}
@@ -0,0 +1,223 @@
+// Package watchdog restarts Anthias on this node when its CMS stops
+// answering while the node itself is up, which otherwise leaves the screen
+// blank until someone reboots the device. It gives up after a few restarts
+// that did not help, and records each restart in the audit log. It also
+// counts restarts of the viewer that draws the screen, and reports it when
+// it crash-loops, optionally showing a fallback image over it.
+package watchdog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// AuditRestarted is the audit action recorded when the watchdog restarts
+// Anthias.
+const AuditRestarted = "host.anthias_restarted"
+
+// Interval is how often the CMS is checked.
+const Interval = time.Minute
+
+// startupGrace is how long after the node starts the CMS is left alone,
+// as Anthias takes a while to come up after a boot.
+const startupGrace = 5 * time.Minute
+
+// Watchdog states.
+const (
+	StateOff      = "off"
+	StateStarting = "starting" // Within the startup grace
+	StateOK       = "ok"
+	StateFailing  = "failing"
+	StateGaveUp   = "gave_up" // MaxRestarts did not help; checks go on and it resets once the CMS answers
+	StateSkipped  = "skipped" // This node runs another CMS or the built-in player
+)
+
+// LocalProvider identifies the node the watchdog runs on.
+type LocalProvider interface {
+	GetMetadata() (*types.Host, error)
+}
+
+// Status is what the watchdog last found.
+type Status struct {
+	State       string    `json:"state"`
+	Failures    int       `json:"failures"` // Failed checks in a row
+	Restarts    int       `json:"restarts"` // Restarts since the CMS last answered
+	LastCheck   time.Time `json:"last_check,omitzero"`
+	LastRestart time.Time `json:"last_restart,omitzero"`
+	Error       string    `json:"error,omitempty"` // Why the last check failed
+
+	Viewer *hosts.Viewer `json:"viewer,omitempty"` // The viewer's restarts; nil until counted
+}
+
+// Watchdog checks the local CMS and restarts it.
+type Watchdog struct {
+	store   *hosts.Store
+	local   LocalProvider
+	logger  *logger.Logger
+	started time.Time
+	check   func(url string) error
+	run     func(args []string) ([]byte, error)
+	show    func(args []string, display string) (func(), error)
+
+	mu     sync.Mutex
+	status Status
+	player PlayerProvider
+	viewer viewerState
+}
+
+// New creates a watchdog for the node local describes, started now.
+func New(store *hosts.Store, local LocalProvider, lg *logger.Logger) *Watchdog {
+	return &Watchdog{
+		store:   store,
+		local:   local,
+		logger:  lg,
+		started: time.Now(),
+		check:   checkURL,
+		run:     runCommand,
+		show:    showImage,
+		status:  Status{State: StateOff},
+	}
+}
+
+// Run checks the CMS every Interval until the process exits.
+func (w *Watchdog) Run() {
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		w.Step(now)
+	}
+}
+
+// Step checks the CMS at now and restarts it if it has been down for the
+// configured number of checks.
+func (w *Watchdog) Step(now time.Time) {
+	cfg, err := LoadConfig(w.store)
+	if err != nil {
+		w.logger.Error(fmt.Sprintf("Watchdog: %v", err))
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !cfg.Enabled {
+		w.status = Status{State: StateOff}
+		w.resetViewer()
+		return
+	}
+	if now.Sub(w.started) < startupGrace {
+		w.status.State = StateStarting
+		return
+	}
+	self, err := w.local.GetMetadata()
+	if err != nil {
+		return
+	}
+	player := w.playerRuns()
+	if h, err := w.store.GetByID(self.ID); err == nil && h.CMS != types.CMSAnthias && !player {
+		w.status = Status{State: StateSkipped}
+		w.resetViewer()
+		return
+	}
+	w.watchViewer(cfg, self.ID, now)
+	if player {
+		// A kiosk with the built-in player has no Anthias to restart.
+		w.status = Status{State: StateSkipped}
+		return
+	}
+
+	w.status.LastCheck = now
+	err = w.check(cfg.CheckURL)
+	if err == nil {
+		if w.status.Restarts > 0 {
+			w.logger.Info(fmt.Sprintf("Watchdog: Anthias is back after %d restarts", w.status.Restarts))
+		}
+		w.status = Status{State: StateOK, LastCheck: now, LastRestart: w.status.LastRestart}
+		return
+	}
+	w.status.Error = err.Error()
+	w.status.Failures++
+	if w.status.State == StateGaveUp {
+		return
+	}
+	w.status.State = StateFailing
+	if w.status.Failures < cfg.Failures {
+		return
+	}
+	if !w.status.LastRestart.IsZero() && now.Sub(w.status.LastRestart) < time.Duration(cfg.Cooldown)*time.Minute {
+		return
+	}
+	if w.status.Restarts >= cfg.MaxRestarts {
+		w.status.State = StateGaveUp
+		w.logger.Error(fmt.Sprintf("Watchdog: Anthias is still down after %d restarts; leaving it until it answers again", w.status.Restarts))
+		return
+	}
+	w.restart(cfg, self.ID, now)
+}
+
+// restart runs the restart command and records it. The caller holds mu.
+func (w *Watchdog) restart(cfg Config, nodeID string, now time.Time) {
+	detail := fmt.Sprintf("CMS down for %d checks (%s); ran %s", w.status.Failures, w.status.Error, cfg.Command)
+	out, err := w.run(strings.Fields(cfg.Command))
+	if err != nil {
+		detail += fmt.Sprintf(", which failed: %v", err)
+		if line := lastLine(string(out)); line != "" {
+			detail += ": " + line
+		}
+		w.logger.Error("Watchdog: restarting Anthias failed: " + detail)
+	} else {
+		w.logger.Warning("Watchdog: restarted Anthias: " + detail)
+	}
+	w.status.Restarts++
+	w.status.Failures = 0
+	w.status.LastRestart = now
+	w.store.AppendAudit(hosts.AuditEntry{Time: now.UTC(), Actor: "nsm", ActorType: hosts.ActorSystem,
+		Action: AuditRestarted, Target: nodeID, Detail: detail})
+}
+
+// Status returns what the watchdog last found.
+func (w *Watchdog) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := w.status
+	st.Viewer = w.viewer.report
+	return st
+}
+
+// checkURL fails if url does not answer or answers with a server error,
+// which Anthias's proxy gives while the server behind it is down. Other
+// answers, such as 401 from a CMS with a password, count as up.
+func checkURL(url string) error {
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// restartTimeout bounds the restart command, which runs with the status
+// locked.
+const restartTimeout = 2 * time.Minute
+
+func runCommand(args []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+}
+
+func lastLine(s string) string {
+	return strings.TrimSpace(lastLines(s, 1, len(s)))
+}
@@ -0,0 +1,201 @@
+package watchdog
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+type fakeLocal struct{}
+
+func (fakeLocal) GetMetadata() (*types.Host, error) { return &types.Host{ID: "kiosk"}, nil }
+
+func TestWatchdogRestartsAnthias(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	w := New(store, fakeLocal{}, logger.New(10))
+	w.started = start
+	down := true
+	w.check = func(url string) error {
+		if down {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	var ran []string
+	w.run = func(args []string) ([]byte, error) {
+		if args[1] == "ps" || args[1] == "inspect" {
+			return []byte("0\n"), nil
+		}
+		ran = append(ran, strings.Join(args, " "))
+		return nil, nil
+	}
+	step := func(minutes int) Status {
+		w.Step(start.Add(time.Duration(minutes) * time.Minute))
+		return w.Status()
+	}
+
+	if st := step(10); st.State != StateOff || len(ran) != 0 {
+		t.Fatalf("expected a disabled watchdog to do nothing, got %+v", st)
+	}
+	if _, err := SaveConfig(store, Config{Enabled: true, Failures: 2, Cooldown: 10, MaxRestarts: 2}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	if st := step(1); st.State != StateStarting {
+		t.Errorf("expected the CMS left alone while the node starts, got %+v", st)
+	}
+
+	// Two failed checks in a row restart it.
+	if st := step(10); st.State != StateFailing || st.Failures != 1 || len(ran) != 0 {
+		t.Fatalf("expected one failure and no restart, got %+v", st)
+	}
+	if st := step(11); st.Restarts != 1 || len(ran) != 1 || ran[0] != DefaultCommand {
+		t.Fatalf("expected %q run once, got %v (%+v)", DefaultCommand, ran, st)
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: AuditRestarted})
+	if len(entries) != 1 || entries[0].Target != "kiosk" || !strings.Contains(entries[0].Detail, "connection refused") {
+		t.Errorf("expected the restart in the audit log, got %+v", entries)
+	}
+
+	// Not again within the cooldown, then once more, then it gives up.
+	step(12)
+	step(13)
+	if len(ran) != 1 {
+		t.Fatalf("expected no restart within the cooldown, got %v", ran)
+	}
+	step(21)
+	step(40)
+	if st := step(41); st.State != StateGaveUp || len(ran) != 2 {
+		t.Fatalf("expected two restarts and then giving up, got %v (%+v)", ran, st)
+	}
+	step(60)
+	if len(ran) != 2 {
+		t.Errorf("expected no restarts after giving up, got %v", ran)
+	}
+
+	// The CMS answering resets it.
+	down = false
+	if st := step(61); st.State != StateOK || st.Restarts != 0 || st.Failures != 0 {
+		t.Errorf("expected the watchdog reset, got %+v", st)
+	}
+
+	// Nodes running piSignage are left alone.
+	store.Add(types.Host{ID: "kiosk", IPAddress: "192.168.1.20", CMS: types.CMSPiSignage})
+	if st := step(62); st.State != StateSkipped {
+		t.Errorf("expected a piSignage node skipped, got %+v", st)
+	}
+}
+
+// fakePlayer stands in for the built-in player.
+type fakePlayer struct {
+	exits int
+	on    bool
+}
+
+func (f *fakePlayer) BrowserExits() (int, string, bool) {
+	return f.exits, "Trace/breakpoint trap", f.on
+}
+
+func TestWatchdogFindsViewerCrashLoop(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	w := New(store, fakeLocal{}, logger.New(10))
+	w.started = start
+	w.check = func(url string) error { return nil }
+	restarts := 0
+	w.run = func(args []string) ([]byte, error) {
+		switch args[1] {
+		case "ps":
+			return []byte("c0ffee\n"), nil
+		case "inspect":
+			return []byte(strconv.Itoa(restarts) + "\n"), nil
+		case "logs":
+			return []byte("Starting viewer\nQt: failed to create EGL display\n"), nil
+		}
+		return nil, nil
+	}
+	var shown []string
+	stopped := 0
+	w.show = func(args []string, display string) (func(), error) {
+		shown = append(shown, args[len(args)-1]+" on "+display)
+		return func() { stopped++ }, nil
+	}
+	step := func(minutes int) *hosts.Viewer {
+		w.Step(start.Add(time.Duration(minutes) * time.Minute))
+		return w.Status().Viewer
+	}
+
+	if _, err := SaveConfig(store, Config{Enabled: true, CrashLoop: 3, CrashLoopWindow: 10, FallbackImage: "/srv/brb.png", Display: ":0"}); err != nil {
+		t.Fatalf("SaveConfig: %v", err)
+	}
+	restarts = 7 // Before the watchdog looked
+	if v := step(10); v == nil || v.State != hosts.ViewerOK || v.Restarts != 0 {
+		t.Fatalf("expected earlier restarts taken as a baseline, got %+v", v)
+	}
+	restarts = 9
+	step(11)
+	restarts = 10
+	v := step(12)
+	if v.State != hosts.ViewerCrashLoop || v.Restarts != 3 || !strings.Contains(v.Logs, "EGL display") || !v.Fallback {
+		t.Fatalf("expected a crash loop with the viewer's logs and the fallback shown, got %+v", v)
+	}
+	if len(shown) != 1 || shown[0] != "/srv/brb.png on :0" {
+		t.Errorf("expected the fallback image shown once, got %v", shown)
+	}
+	if got, ok := store.ViewerOf("kiosk", start.Add(12*time.Minute)); !ok || got.Summary() != "anthias-viewer restarted 3 times in 10 minutes" {
+		t.Errorf("expected the crash loop in this node's heartbeats, got %+v, %v", got, ok)
+	}
+	entries, _ := store.ListAudit(hosts.AuditQuery{Action: AuditViewerCrashLoop})
+	if len(entries) != 1 || !strings.Contains(entries[0].Detail, "/srv/brb.png") {
+		t.Errorf("expected the crash loop in the audit log, got %+v", entries)
+	}
+
+	// Once the restarts age out of the window, the fallback goes away.
+	step(15)
+	if v := step(22); v.State != hosts.ViewerOK || v.Fallback || stopped != 1 || len(shown) != 1 {
+		t.Errorf("expected the viewer ok and the fallback stopped, got %+v (stopped %d)", v, stopped)
+	}
+
+	// While the built-in player runs, its browser is watched, and there is
+	// no Anthias to restart.
+	p := &fakePlayer{on: true}
+	w.SetPlayer(p)
+	step(23)
+	p.exits = 3
+	st := func() Status { w.Step(start.Add(24 * time.Minute)); return w.Status() }()
+	if st.State != StateSkipped || st.Viewer.Process != PlayerProcess || st.Viewer.State != hosts.ViewerCrashLoop || st.Viewer.Logs != "Trace/breakpoint trap" {
+		t.Errorf("expected a crash loop of the player's browser, got %+v, %+v", st, st.Viewer)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := Config{CheckURL: "127.0.0.1/api/v2/info"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected a check URL without a scheme to be rejected")
+	}
+	cfg = Config{Failures: -1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected negative failures to be rejected")
+	}
+	cfg = Config{}
+	if err := cfg.Validate(); err != nil || cfg != DefaultConfig() {
+		t.Errorf("expected defaults, got %+v, %v", cfg, err)
+	}
+}
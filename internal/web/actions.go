@@ -0,0 +1,37 @@
+package web
+
+import "net/http"
+
+// actionPaths change the state of hosts rather than of the host list.
+// Nodes started with enable_actions off refuse them.
+var actionPaths = map[string]bool{
+	"/api/hosts/reboot":               true,
+	"/api/hosts/upgrade":              true,
+	"/api/hosts/display-power":        true,
+	"/api/hosts/time-sync":            true,
+	"/api/hosts/device-settings":      true,
+	"/api/hosts/device-settings/bulk": true,
+	"/api/hosts/assets/reapply":       true,
+	"/api/player":                     true,
+	"/api/watchdog":                   true,
+	"/api/patches/rollout":            true,
+}
+
+// DisableActions makes the server refuse reboots, upgrades and other
+// actions on hosts, for nodes that only watch the fleet. Call it before
+// Start.
+func (s *Server) DisableActions() {
+	s.noActions = true
+}
+
+// refuseActions answers action requests with 403 and passes the rest on.
+// Reads of the same paths, such as the rollout status, still go through.
+func refuseActions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actionPaths[r.URL.Path] && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Actions are disabled on this node (enable_actions in config.json)", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
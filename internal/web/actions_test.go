@@ -0,0 +1,28 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRefuseActions(t *testing.T) {
+	h := refuseActions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodPost, "/api/hosts/reboot", http.StatusForbidden},
+		{http.MethodPost, "/api/patches/rollout", http.StatusForbidden},
+		{http.MethodGet, "/api/patches/rollout", http.StatusNoContent},
+		{http.MethodPost, "/api/hosts/update", http.StatusNoContent},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package web
+
+import (
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// openIncidents returns the open incident of each host that has one, keyed
+// by host ID, for the host table.
+func (s *Server) openIncidents() map[string]*hosts.Incident {
+	open := make(map[string]*hosts.Incident)
+	list, err := s.store.ListIncidents(hosts.IncidentQuery{Status: hosts.IncidentOpen, Limit: 1000}, time.Now().UTC())
+	if err != nil {
+		return open
+	}
+	for i := range list {
+		open[list[i].HostID] = &list[i]
+	}
+	return open
+}
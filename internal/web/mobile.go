@@ -0,0 +1,74 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"nexsign.mini/nsm/internal/types"
+)
+
+// viewCookie remembers a view picked with ?view=mobile or ?view=desktop,
+// so the choice outlasts the link that made it.
+const viewCookie = "nsm_view"
+
+// isMobile reports whether r should get the phone view: the one picked
+// with ?view= or earlier with the cookie, else that of the device.
+func isMobile(r *http.Request) bool {
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		if c, err := r.Cookie(viewCookie); err == nil {
+			view = c.Value
+		}
+	}
+	switch view {
+	case "mobile":
+		return true
+	case "desktop":
+		return false
+	}
+	// Phones, but not tablets, put "Mobi" in their user agent.
+	return strings.Contains(r.UserAgent(), "Mobi")
+}
+
+// rememberView stores a view picked with ?view= in the cookie.
+func rememberView(w http.ResponseWriter, r *http.Request) {
+	view := r.URL.Query().Get("view")
+	if view != "mobile" && view != "desktop" {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     viewCookie,
+		Value:    view,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handleMobilePage serves the phone view: a card per host, those needing
+// attention first, with large check and reboot buttons.
+func (s *Server) handleMobilePage(w http.ResponseWriter, r *http.Request) {
+	b := s.statusBoard()
+	b.StreamURL = "/views/mobile/stream"
+	b.BuildTime = types.BuildTime
+	s.writePage(w, "mobile.html", b)
+}
+
+// renderMobileFragment creates the SSE-formatted fragment for phone view
+// updates.
+func (s *Server) renderMobileFragment() []byte {
+	var buf bytes.Buffer
+	if err := s.templates.Load().ExecuteTemplate(&buf, "mobile-host-cards", s.statusBoard()); err != nil {
+		s.renderFailed("Host cards", err)
+		buf.Reset()
+		buf.WriteString(`<div id="mobile_hosts">` + errorPanel("Host cards") + `</div>`)
+	}
+	return encodeEvent(mergeFragments(buf.String(), fragmentOptions{}))
+}
+
+// handleMobileStream streams phone view updates.
+func (s *Server) handleMobileStream(w http.ResponseWriter, r *http.Request) {
+	s.streamFragments(w, r, s.mobileBroker, s.renderMobileFragment)
+}
@@ -0,0 +1,89 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+const (
+	iPhoneAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1"
+	iPadAgent   = "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/604.1"
+	linuxAgent  = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0 Safari/537.36"
+)
+
+func TestIsMobile(t *testing.T) {
+	cases := []struct {
+		name   string
+		url    string
+		agent  string
+		cookie string
+		want   bool
+	}{
+		{"phone", "/", iPhoneAgent, "", true},
+		{"tablet", "/", iPadAgent, "", false},
+		{"desktop", "/", linuxAgent, "", false},
+		{"query on desktop", "/?view=mobile", linuxAgent, "", true},
+		{"query on phone", "/?view=desktop", iPhoneAgent, "", false},
+		{"cookie on phone", "/", iPhoneAgent, "desktop", false},
+		{"query beats cookie", "/?view=mobile", linuxAgent, "desktop", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, c.url, nil)
+		r.Header.Set("User-Agent", c.agent)
+		if c.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: viewCookie, Value: c.cookie})
+		}
+		if got := isMobile(r); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRememberView(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rememberView(rec, httptest.NewRequest(http.MethodGet, "/?view=desktop", nil))
+	if c := rec.Result().Cookies(); len(c) != 1 || c[0].Name != viewCookie || c[0].Value != "desktop" {
+		t.Errorf("expected the desktop view remembered, got %v", c)
+	}
+
+	rec = httptest.NewRecorder()
+	rememberView(rec, httptest.NewRequest(http.MethodGet, "/?view=other", nil))
+	if c := rec.Result().Cookies(); len(c) != 0 {
+		t.Errorf("expected an unknown view ignored, got %v", c)
+	}
+}
+
+func TestMobileHostCards(t *testing.T) {
+	s := &Server{logger: logger.New(10)}
+	tmpl, err := s.parseTemplates("*.html")
+	if err != nil {
+		t.Fatalf("parseTemplates: %v", err)
+	}
+	b := statusBoard{Hosts: []types.Host{{ID: "lobby", Nickname: "Lobby <1>", IPAddress: "192.168.1.20", Health: types.HealthOffline}}}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "mobile-host-cards", b); err != nil {
+		t.Fatalf("ExecuteTemplate: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`<div id="mobile_hosts" aria-live="polite">`,
+		`<article aria-labelledby="host-lobby-name"`,
+		`<h3 id="host-lobby-name"`,
+		`Lobby &lt;1&gt;</h3>`,
+		`aria-label="Check Lobby &lt;1&gt; now"`,
+		`aria-label="Reboot Lobby &lt;1&gt;"`,
+		`data-on-click="@post('/api/hosts/check-one?ip=192.168.1.20')"`,
+		`<span class="sr-only">Health: </span>offline`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the cards, got:\n%s", want, out)
+		}
+	}
+}
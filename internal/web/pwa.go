@@ -0,0 +1,29 @@
+package web
+
+import (
+	"mime"
+	"net/http"
+)
+
+// serviceWorkerFile is served at /sw.js rather than under /static/, since
+// a service worker only controls pages at or below its own path.
+const serviceWorkerFile = "internal/web/static/sw.js"
+
+func init() {
+	// The manifest is served by the static file server, which would
+	// otherwise call it text/plain.
+	mime.AddExtensionType(".webmanifest", "application/manifest+json")
+}
+
+// handleServiceWorker serves the service worker that lets the dashboard
+// install as an app and show the last host list when offline. Browsers
+// check it for updates on each visit, so it must not be cached.
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	s.setCacheHeaders(w)
+	http.ServeFile(w, r, serviceWorkerFile)
+}
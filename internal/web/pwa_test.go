@@ -0,0 +1,47 @@
+package web
+
+import (
+	"encoding/json"
+	"mime"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	data, err := os.ReadFile("static/manifest.webmanifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		StartURL string `json:"start_url"`
+		Scope    string `json:"scope"`
+		Display  string `json:"display"`
+		Icons    []struct {
+			Src   string `json:"src"`
+			Sizes string `json:"sizes"`
+		} `json:"icons"`
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("manifest is not valid JSON: %v", err)
+	}
+	if m.StartURL != "/" || m.Scope != "/" || m.Display != "standalone" {
+		t.Errorf("expected a standalone app at /, got %+v", m)
+	}
+
+	// Browsers want 192 and 512 pixel icons to offer installing.
+	sizes := make(map[string]bool)
+	for _, icon := range m.Icons {
+		sizes[icon.Sizes] = true
+		if _, err := os.Stat(strings.TrimPrefix(icon.Src, "/")); err != nil {
+			t.Errorf("icon %s: %v", icon.Src, err)
+		}
+	}
+	if !sizes["192x192"] || !sizes["512x512"] {
+		t.Errorf("expected 192 and 512 pixel icons, got %v", sizes)
+	}
+
+	if got := mime.TypeByExtension(".webmanifest"); got != "application/manifest+json" {
+		t.Errorf("expected the manifest served as application/manifest+json, got %q", got)
+	}
+}
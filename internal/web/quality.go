@@ -0,0 +1,55 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// qualityChartSamples is how many recent checks the host table charts.
+const qualityChartSamples = 40
+
+// qualityChart is a host's recent latency on the path in use, drawn as a
+// sparkline in a 100x20 SVG box in the host table.
+type qualityChart struct {
+	Network hosts.Network
+	Points  string    // Polyline points for the checks where a probe answered
+	Lost    []float64 // X positions of checks where every probe failed
+	Summary hosts.QualitySummary
+}
+
+// qualityCharts builds a chart for each host with at least two samples on
+// the path NSM uses to reach it, keyed by host ID.
+func qualityCharts(store *hosts.Store, list []types.Host) map[string]*qualityChart {
+	charts := make(map[string]*qualityChart)
+	for _, h := range list {
+		network := hosts.SelectPath(h).Network
+		samples := store.QualityHistory(h.ID, network)
+		if len(samples) > qualityChartSamples {
+			samples = samples[len(samples)-qualityChartSamples:]
+		}
+		if len(samples) < 2 {
+			continue
+		}
+
+		c := &qualityChart{Network: network, Summary: hosts.Summarize(samples)}
+		top := max(c.Summary.MaxLatencyMS, 1)
+		step := 100 / float64(len(samples)-1)
+		var points []string
+		for i, s := range samples {
+			x := float64(i) * step
+			if s.LossPercent == 100 {
+				c.Lost = append(c.Lost, x)
+				continue
+			}
+			// Leave a pixel top and bottom so the line is never clipped.
+			y := 19 - s.LatencyMS/top*18
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		c.Points = strings.Join(points, " ")
+		charts[h.ID] = c
+	}
+	return charts
+}
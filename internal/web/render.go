@@ -0,0 +1,107 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+
+	"nexsign.mini/nsm/internal/requestid"
+)
+
+// A template that fails to execute costs the user the part of the page it
+// draws, not the whole page or view: the error goes to the status console
+// and a short notice takes the part's place. Details stay in the console,
+// as the status board is shown to anyone with its link.
+
+const errorPanelClass = "p-3 rounded border border-desert-red bg-desert-darkgray text-desert-red"
+
+// errorPanel returns the notice shown in place of what failed to render.
+func errorPanel(what string) string {
+	return `<div class="` + errorPanelClass + `" role="alert">` + html.EscapeString(what) +
+		` could not be displayed. Details are in the status console.</div>`
+}
+
+// requestErrorPanel is errorPanel for a request, naming its ID so the
+// details can be found in the status console.
+func requestErrorPanel(what, id string) string {
+	if id == "" {
+		return errorPanel(what)
+	}
+	return `<div class="` + errorPanelClass + `" role="alert">` + html.EscapeString(what) +
+		` could not be displayed. Details are in the status console under request ` + html.EscapeString(id) + `.</div>`
+}
+
+// errorRow is errorPanel as a table row spanning cols columns.
+func errorRow(what string, cols int) string {
+	return fmt.Sprintf(`<tr><td colspan="%d" class="p-2">%s</td></tr>`, cols, errorPanel(what))
+}
+
+// errorPage is the page served when a whole page fails to render. It uses
+// no template, so it renders whatever state the templates are in.
+const errorPage = `<!DOCTYPE html>
+<html lang="en">
+<head><meta charset="UTF-8"><title>nexSign mini</title></head>
+<body style="background:#333;color:#cfbfad;font-family:sans-serif;padding:2rem">
+<h1 style="color:#cd5c5c;font-size:1.25rem">This page could not be displayed</h1>
+<p>The error has been logged to the status console. <a href="" style="color:#87ceeb">Reload</a></p>
+</body>
+</html>
+`
+
+func (s *Server) renderFailed(what string, err error) {
+	s.logger.Error(fmt.Sprintf("Render: %s failed: %v", what, err))
+}
+
+// parseTemplates parses the templates matching pattern, with the partial
+// functions bound to the resulting set. Templates use them in place of
+// {{template}} for parts that should fail on their own:
+//
+//	{{partial "name" .}}            an error panel on failure
+//	{{partialRows "name" 7 .}}      an error row spanning 7 columns
+func (s *Server) parseTemplates(pattern string) (*template.Template, error) {
+	t := template.New("")
+	t.Funcs(template.FuncMap{
+		"partial": func(name string, data any) template.HTML {
+			return s.renderPartial(t, name, data, errorPanel(name))
+		},
+		"partialRows": func(name string, cols int, data any) template.HTML {
+			return s.renderPartial(t, name, data, errorRow(name, cols))
+		},
+	})
+	return t.ParseGlob(pattern)
+}
+
+func (s *Server) renderPartial(t *template.Template, name string, data any, fallback string) template.HTML {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		s.renderFailed(name, err)
+		return template.HTML(fallback)
+	}
+	return template.HTML(buf.String()) // Escaped when the partial executed
+}
+
+// writePage renders a full page, or the error page if it fails. The page
+// is rendered before anything is written, so a failure midway leaves no
+// half page behind.
+func (s *Server) writePage(w http.ResponseWriter, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	s.setCacheHeaders(w)
+	var buf bytes.Buffer
+	if err := s.templates.Load().ExecuteTemplate(&buf, name, data); err != nil {
+		s.renderFailed(name, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(errorPage))
+		return
+	}
+	w.Write(buf.Bytes())
+}
+
+// writeViewError shows an error panel in the content area in place of a
+// view that failed to render. It is sent as a normal event, as datastar
+// merges nothing from an error response.
+func (s *Server) writeViewError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	s.logger.ErrorContext(r.Context(), fmt.Sprintf("Render: %s failed: %v", what, err))
+	s.writeView(w, requestErrorPanel(what, requestid.FromContext(r.Context())))
+}
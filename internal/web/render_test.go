@@ -0,0 +1,107 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/requestid"
+)
+
+// newRenderServer returns a server with the given templates, parsed as the
+// real ones are.
+func newRenderServer(t *testing.T, files map[string]string) *Server {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Server{logger: logger.New(10)}
+	tmpl, err := s.parseTemplates(filepath.Join(dir, "*.html"))
+	if err != nil {
+		t.Fatalf("parseTemplates: %v", err)
+	}
+	s.templates.Store(tmpl)
+	return s
+}
+
+func loggedErrors(s *Server) int {
+	n := 0
+	for _, m := range s.logger.GetAll() {
+		if m.Level == "error" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBrokenPartialFallsBack(t *testing.T) {
+	s := newRenderServer(t, map[string]string{
+		"view.html": `<h1>{{.Title}}</h1>{{partial "panel" .}}<table>{{partialRows "rows" 3 .}}</table><p>footer</p>`,
+		"parts.html": `{{define "panel"}}<div>{{index .Items 3}}</div>{{end}}` +
+			`{{define "rows"}}<tr><td>{{.Title}}</td></tr>{{end}}`,
+	})
+
+	var buf bytes.Buffer
+	if err := s.templates.Load().ExecuteTemplate(&buf, "view.html", map[string]any{"Title": "<Lobby>", "Items": []string{}}); err != nil {
+		t.Fatalf("expected the view to render around the broken partial, got %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{"<h1>&lt;Lobby&gt;</h1>", errorPanel("panel"), "<tr><td>&lt;Lobby&gt;</td></tr>", "<p>footer</p>"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+	if n := loggedErrors(s); n != 1 {
+		t.Errorf("expected the failure logged once, got %d", n)
+	}
+}
+
+func TestBrokenPageServesErrorPage(t *testing.T) {
+	s := newRenderServer(t, map[string]string{"page.html": `<p>half</p>{{index .Items 3}}`})
+
+	rec := httptest.NewRecorder()
+	s.writePage(rec, "page.html", map[string]any{"Items": []string{}})
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != errorPage {
+		t.Errorf("expected only the error page, got %q", body)
+	}
+	if n := loggedErrors(s); n != 1 {
+		t.Errorf("expected the failure logged once, got %d", n)
+	}
+}
+
+func TestBrokenViewShowsErrorPanel(t *testing.T) {
+	s := newRenderServer(t, map[string]string{"page.html": ``})
+
+	rec := httptest.NewRecorder()
+	s.writeViewError(rec, httptest.NewRequest(http.MethodGet, "/", nil), "Home view", os.ErrNotExist)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected the panel sent as a normal event, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "event: datastar-merge-fragments\n") ||
+		!strings.Contains(body, `<div id="content-area">`+errorPanel("Home view")+`</div>`) {
+		t.Errorf("expected the content area replaced by the panel, got %q", body)
+	}
+
+	// The panel names the request the error is logged under.
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	s.writeViewError(rec, req.WithContext(requestid.With(req.Context(), "3f2a9c")), "Home view", os.ErrNotExist)
+	if !strings.Contains(rec.Body.String(), "under request 3f2a9c.") {
+		t.Errorf("expected the request ID in the panel, got %q", rec.Body.String())
+	}
+	if msg := s.logger.GetRecent(1)[0]; msg.RequestID != "3f2a9c" {
+		t.Errorf("expected the failure logged under the request, got %+v", msg)
+	}
+}
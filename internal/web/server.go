@@ -5,7 +5,9 @@ package web
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
@@ -14,14 +16,29 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"nexsign.mini/nsm/internal/api"
+	"nexsign.mini/nsm/internal/announce"
 	"nexsign.mini/nsm/internal/anthias"
+	"nexsign.mini/nsm/internal/chaos"
+	"nexsign.mini/nsm/internal/auth"
+	"nexsign.mini/nsm/internal/buddy"
 	"nexsign.mini/nsm/internal/docs"
+	"nexsign.mini/nsm/internal/flags"
 	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/identity"
 	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/peerauth"
+	"nexsign.mini/nsm/internal/peerbus"
+	"nexsign.mini/nsm/internal/peerlog"
+	"nexsign.mini/nsm/internal/player"
+	"nexsign.mini/nsm/internal/requestid"
+	"nexsign.mini/nsm/internal/tracing"
 	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/watchdog"
 )
 
 // TemplateData holds the data to be passed to the HTML template.
@@ -33,8 +50,13 @@ type TemplateData struct {
 	BuildTime          string
 	Interfaces         []string
 	EnvVarSet          bool
-	DuplicateHostnames map[string]bool
-	EditLocks          map[string]string // hostID -> editorID
+	Conflicts          []hosts.Conflict
+	EditLocks          map[string]string        // hostID -> editorID
+	Quality            map[string]*qualityChart // hostID -> recent latency and loss
+	WiFi               map[string]*wifiChart    // hostID -> Wi-Fi signal over the last day
+	Uptime             map[string]*uptimeChart  // hostID -> uptime over the last week
+	Incidents          map[string]*hosts.Incident // hostID -> its open incident
+	Topology           *topologyGraph
 	DocList            []string
 	DocContent         template.HTML
 	CurrentDoc         string
@@ -65,6 +87,12 @@ func (b *sseBroker) unregister(client chan []byte) {
 	close(client)
 }
 
+func (b *sseBroker) count() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.clients)
+}
+
 func (b *sseBroker) broadcast(data []byte) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -79,46 +107,60 @@ func (b *sseBroker) broadcast(data []byte) {
 
 // Server is the web server for the dashboard and API.
 type Server struct {
-	store      *hosts.Store
-	anthias    *anthias.Client
-	port       int
-	templates  *template.Template
-	logger     *logger.Logger
-	sseBroker  *sseBroker
-	editLocks  map[string]string // hostID -> editorID
-	editMu     sync.RWMutex
-	apiService *api.Service
-	docService *docs.Service
+	store        *hosts.Store
+	anthias      *anthias.Client
+	port         int
+	templates    atomic.Pointer[template.Template] // Swapped on reload in development
+	logger       *logger.Logger
+	sseBroker    *sseBroker
+	boardBroker  *sseBroker        // Status board clients
+	mobileBroker *sseBroker        // Phone view clients
+	editLocks    map[string]string // hostID -> editorID
+	editMu       sync.RWMutex
+	peerQueue    *announce.Queue // Announcements peers missed
+	peerBus      *peerbus.Pool   // Connections requests to peers are posted over
+	apiService   *api.Service
+	docService   *docs.Service
+	chaos        *chaos.Injector // Faults injected for testing; nil in production
+	noActions    bool            // Refuse actions on hosts; see DisableActions
 }
 
 // NewServer creates a new web server.
 func NewServer(store *hosts.Store, anthiasClient *anthias.Client, port int) (*Server, error) {
-	templates, err := parseTemplates()
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse templates: %w", err)
-	}
-
 	logger := logger.New(200) // Keep last 200 messages
 	apiService := api.NewService(store, anthiasClient, logger)
 	docService := docs.NewService("internal/docs")
+	apiService.SetDocs(docService)
 
 	s := &Server{
-		store:      store,
-		anthias:    anthiasClient,
-		port:       port,
-		templates:  templates,
-		logger:     logger,
-		sseBroker:  newSSEBroker(),
-		editLocks:  make(map[string]string),
-		apiService: apiService,
-		docService: docService,
+		store:        store,
+		anthias:      anthiasClient,
+		port:         port,
+		logger:       logger,
+		sseBroker:    newSSEBroker(),
+		boardBroker:  newSSEBroker(),
+		mobileBroker: newSSEBroker(),
+		editLocks:    make(map[string]string),
+		peerQueue:    apiService.PeerQueue(),
+		peerBus:      apiService.PeerBus(),
+		apiService:   apiService,
+		docService:   docService,
 	}
 	
+	templates, err := s.parseTemplates(templateFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	s.templates.Store(templates)
+
 	// Log server initialization
 	s.logger.Info("NSM server initialized")
 	
 	// Start listening for host updates and broadcast them via SSE
 	go s.watchHostUpdates()
+
+	// Deliver announcements to peers that were offline
+	go s.retryPeerPushes(peerRetryInterval)
 	
 	return s, nil
 }
@@ -128,6 +170,49 @@ func (s *Server) Logger() *logger.Logger {
 	return s.logger
 }
 
+// PeerBus returns the connections requests to peers are posted over
+func (s *Server) PeerBus() *peerbus.Pool {
+	return s.peerBus
+}
+
+// Identity returns the node signing key, or nil if it could not be loaded
+func (s *Server) Identity() *identity.Identity {
+	return s.apiService.Auth().Identity()
+}
+
+// PeerSigner returns the signer for requests this node makes of its peers
+func (s *Server) PeerSigner() *peerauth.Signer {
+	return s.apiService.Auth().PeerSigner()
+}
+
+// EnableChaos injects the faults of in into peer requests, the peer bus and
+// host list changes, and serves /api/debug/faults to set them. Call it
+// before Start.
+func (s *Server) EnableChaos(in *chaos.Injector) {
+	s.chaos = in
+	s.apiService.SetChaos(in)
+	s.peerBus.SetFault(in.Bus)
+	s.store.SetWriteDelay(in.StoreDelay)
+}
+
+// SetFlags turns subsystems on or off for this node by the flags of f.
+// Call it before Start.
+func (s *Server) SetFlags(f *flags.Set) {
+	s.peerBus.SetEnabled(func() bool { return f.On(flags.PeerBus) })
+}
+
+// SetPlayer reports the state of the built-in player p through the API.
+// Call it before Start.
+func (s *Server) SetPlayer(p *player.Player) {
+	s.apiService.SetPlayer(p)
+}
+
+// SetWatchdog reports the state of the Anthias watchdog w through the API.
+// Call it before Start.
+func (s *Server) SetWatchdog(w *watchdog.Watchdog) {
+	s.apiService.SetWatchdog(w)
+}
+
 // Start initializes and runs the web server.
 func (s *Server) Start() <-chan error {
 	log.Printf("Web UI: Starting dashboard and API server on http://localhost:%d", s.port)
@@ -135,13 +220,19 @@ func (s *Server) Start() <-chan error {
 	fs := http.FileServer(http.Dir("internal/web/static"))
 	mux := http.NewServeMux()
 	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	mux.HandleFunc("/sw.js", s.handleServiceWorker)
 
 	// Page routes
 	mux.HandleFunc("/", s.handlePageLoad)
+	mux.HandleFunc("/login", s.handleLoginPage)
 	mux.HandleFunc("/views/home", s.handleHomeView)
 	mux.HandleFunc("/views/advanced", s.handleAdvancedView)
 	mux.HandleFunc("/views/api", s.handleAPIView)
 	mux.HandleFunc("/views/docs", s.handleDocsView)
+	mux.HandleFunc("/views/topology", s.handleTopologyView)
+	mux.HandleFunc("/status-board", s.handleStatusBoard)
+	mux.HandleFunc("/status-board/stream", s.handleStatusBoardStream)
+	mux.HandleFunc("/views/mobile/stream", s.handleMobileStream)
 
 	// API routes (delegated to apiService)
 	mux.HandleFunc("/api/health", s.apiService.HandleHealth)
@@ -150,25 +241,172 @@ func (s *Server) Start() <-chan error {
 	mux.HandleFunc("/api/hosts", s.apiService.HandleHosts)
 	mux.HandleFunc("/api/hosts/add", s.handleAddHost) // Kept local for pushToOnlinePeers
 	mux.HandleFunc("/api/hosts/update", s.handleUpdateHost) // Kept local for pushToOnlinePeers
+	mux.HandleFunc("/api/hosts/clone", s.apiService.HandleCloneHost)
+	mux.HandleFunc("/api/hosts/locate", s.apiService.HandleLocateHost)
+	mux.HandleFunc("/api/conflicts", s.apiService.HandleConflicts)
+	mux.HandleFunc("/api/conflicts/resolve", s.apiService.HandleResolveConflict)
 	mux.HandleFunc("/api/hosts/delete", s.apiService.HandleDeleteHost)
 	mux.HandleFunc("/api/hosts/set-primary", s.apiService.HandleSetPrimaryHost)
+	mux.HandleFunc("/api/hosts/path", s.apiService.HandleHostPath)
+	mux.HandleFunc("/api/hosts/timezone", s.apiService.HandleHostTimezone)
+	mux.HandleFunc("/api/hosts/cms", s.apiService.HandleHostCMS)
+	mux.HandleFunc("/api/flags", s.apiService.HandleFlags)
+	mux.HandleFunc("/api/player", s.apiService.HandlePlayer)
+	mux.HandleFunc("/api/player/now", s.apiService.HandlePlayerNow)
+	mux.HandleFunc("/player", s.apiService.HandlePlayerPage)
+	mux.HandleFunc("/api/watchdog", s.apiService.HandleWatchdog)
+	mux.HandleFunc("/api/hosts/quality", s.apiService.HandleHostQuality)
+	mux.HandleFunc("/api/hosts/card-health", s.apiService.HandleHostCardHealth)
+	mux.HandleFunc("/api/hosts/reboots", s.apiService.HandleHostReboots)
+	mux.HandleFunc("/api/incidents", s.apiService.HandleIncidents)
+	mux.HandleFunc("/api/incidents/", s.apiService.HandleIncident)
+	mux.HandleFunc("/api/hosts/metrics", s.apiService.HandleHostMetrics)
+	mux.HandleFunc("/api/grafana", s.apiService.HandleGrafana)
+	mux.HandleFunc("/api/grafana/search", s.apiService.HandleGrafanaSearch)
+	mux.HandleFunc("/api/grafana/query", s.apiService.HandleGrafanaQuery)
+	mux.HandleFunc("/api/grafana/annotations", s.apiService.HandleGrafanaAnnotations)
+	mux.HandleFunc("/api/hosts/wifi", s.apiService.HandleHostWiFi)
+	mux.HandleFunc("GET /api/hosts/{id}/label", s.apiService.HandleHostLabel)
+	mux.HandleFunc("/api/hosts/device-settings", s.apiService.HandleDeviceSettings)
+	mux.HandleFunc("/api/hosts/device-settings/bulk", s.apiService.HandleBulkDeviceSettings)
+	mux.HandleFunc("/api/hosts/assets/drift", s.apiService.HandleAssetDrift)
+	mux.HandleFunc("/api/hosts/assets/adopt", s.apiService.HandleAdoptAssets)
+	mux.HandleFunc("/api/hosts/assets/reapply", s.apiService.HandleReapplyAssets)
+	mux.HandleFunc("/api/playlists/validate", s.apiService.HandleValidatePlaylist)
+	mux.HandleFunc("/cache", s.apiService.HandleCacheFetch)
+	mux.HandleFunc("/api/cache", s.apiService.HandleCacheList)
+	mux.HandleFunc("/api/cache/purge", s.apiService.HandleCachePurge)
+	mux.HandleFunc("/api/settings/cache", s.apiService.HandleCacheSettings)
+	mux.HandleFunc("/api/settings/backup-buddies", s.apiService.HandleBackupBuddySettings)
+	mux.HandleFunc("/api/settings/git-export", s.apiService.HandleGitExportSettings)
+	mux.HandleFunc("/api/settings/git-export/run", s.apiService.HandleGitExportRun)
+	mux.HandleFunc("/api/settings/hooks", s.apiService.HandleHookSettings)
+	mux.HandleFunc("/api/settings/hooks/test", s.apiService.HandleHookTest)
+	mux.HandleFunc("/api/settings/bandwidth", s.apiService.HandleBandwidthSettings)
+	mux.HandleFunc("/api/settings/switch", s.apiService.HandleSwitchSettings)
+	mux.HandleFunc("/api/settings/snmp-agent", s.apiService.HandleSNMPAgentSettings)
+	mux.HandleFunc("/api/settings/health-checks", s.apiService.HandleCheckSettings)
+	mux.HandleFunc("/api/bandwidth", s.apiService.HandleBandwidthUsage)
+	mux.HandleFunc("/api/media/transcode", s.apiService.HandleMediaTranscode)
+	mux.HandleFunc("/api/media/jobs", s.apiService.HandleMediaJobs)
+	mux.HandleFunc("/api/media/jobs/get", s.apiService.HandleMediaJob)
+	mux.HandleFunc("/api/media/jobs/delete", s.apiService.HandleDeleteMediaJob)
+	mux.HandleFunc("/media/", s.apiService.HandleMediaFile)
+	mux.HandleFunc("/api/widgets", s.apiService.HandleWidgets)
+	mux.HandleFunc("/api/widgets/publish", s.apiService.HandleWidgetPublish)
+	mux.HandleFunc("/api/widgets/csv", s.apiService.HandleWidgetCSV)
+	mux.HandleFunc("/widgets/", s.apiService.HandleWidgetPage)
 	mux.HandleFunc("/api/hosts/check", s.apiService.HandleCheckHosts)
 	mux.HandleFunc("/api/hosts/check-one", s.apiService.HandleCheckHost)
 	mux.HandleFunc("/api/hosts/stream", s.handleHostsStream) // Kept in web for SSE logic
 	mux.HandleFunc("/api/hosts/announce", s.apiService.HandleAnnounceHost)
+	mux.HandleFunc("/api/hosts/quarantine", s.apiService.HandleQuarantine)
+	mux.HandleFunc("/api/hosts/quarantine/approve", s.apiService.HandleApproveQuarantined)
+	mux.HandleFunc("/api/hosts/quarantine/reject", s.apiService.HandleRejectQuarantined)
 	mux.HandleFunc("/api/hosts/lock", s.handleLockHost) // Kept local for editLocks
 	mux.HandleFunc("/api/hosts/unlock", s.handleUnlockHost) // Kept local for editLocks
 	mux.HandleFunc("/api/hosts/push", s.apiService.HandlePushHosts)
 	mux.HandleFunc("/api/hosts/receive", s.apiService.HandleReceiveHosts)
 	mux.HandleFunc("/api/hosts/reboot", s.apiService.HandleRebootHost)
 	mux.HandleFunc("/api/hosts/upgrade", s.apiService.HandleUpgradeHost)
+	mux.HandleFunc("/api/patches", s.apiService.HandlePatches)
+	mux.HandleFunc("/api/patches/rollout", s.apiService.HandlePatchRollout)
+	mux.HandleFunc("/api/patches/rollout/cancel", s.apiService.HandleCancelPatchRollout)
+	mux.HandleFunc("/api/reboots/schedules", s.apiService.HandleRebootSchedules)
+	mux.HandleFunc("/api/reboots/status", s.apiService.HandleRebootStatus)
+	mux.HandleFunc("/api/hosts/time-sync", s.apiService.HandleTimeSync)
+	mux.HandleFunc("/api/hosts/display-power", s.apiService.HandleDisplayPower)
 	mux.HandleFunc("/api/hosts/export/internal", s.apiService.HandleExportInternal)
 	mux.HandleFunc("/api/hosts/export/download", s.apiService.HandleExportDownload)
 	mux.HandleFunc("/api/hosts/import/internal", s.apiService.HandleImportInternal)
 	mux.HandleFunc("/api/hosts/import/upload", s.apiService.HandleImportUpload)
 	mux.HandleFunc("/api/backups/list", s.apiService.HandleBackupsList)
 	mux.HandleFunc("/api/backups/restore", s.apiService.HandleRestoreBackup)
+	mux.HandleFunc("/api/backups/preview", s.apiService.HandleBackupPreview)
+	mux.HandleFunc("/api/backups/download", s.apiService.HandleBackupDownload)
+	mux.HandleFunc("/api/backups/upload", s.apiService.HandleDatabaseUpload)
+	mux.HandleFunc("/api/backups/peers", s.apiService.HandlePeerBackups)
+	mux.HandleFunc("/api/backups/peers/download", s.apiService.HandlePeerBackupDownload)
+	mux.HandleFunc("/api/approvals", s.apiService.HandleApprovals)
+	mux.HandleFunc("/api/approvals/approve", s.apiService.HandleApprove)
+	mux.HandleFunc("/api/approvals/reject", s.apiService.HandleReject)
+	mux.HandleFunc("/api/search", s.apiService.HandleSearch)
+	mux.HandleFunc("/api/graphql", s.apiService.HandleGraphQL)
+	mux.Handle("/"+api.GRPCService+"/", s.apiService.GRPCHandler())
+	mux.HandleFunc("/api/views", s.apiService.HandleViews)
+	mux.HandleFunc("/api/views/delete", s.apiService.HandleDeleteView)
+	mux.HandleFunc("/api/views/hosts", s.apiService.HandleViewHosts)
+	mux.HandleFunc("/api/snapshots", s.apiService.HandleSnapshots)
+	mux.HandleFunc("/api/snapshots/get", s.apiService.HandleGetSnapshot)
+	mux.HandleFunc("/api/snapshots/diff", s.apiService.HandleDiffSnapshot)
+	mux.HandleFunc("/api/snapshots/restore", s.apiService.HandleRestoreSnapshot)
+	mux.HandleFunc("/api/snapshots/delete", s.apiService.HandleDeleteSnapshot)
+	mux.HandleFunc("/api/settings/smtp", s.apiService.HandleSMTPSettings)
+	mux.HandleFunc("/api/reports/config", s.apiService.HandleReportConfig)
+	mux.HandleFunc("/api/reports/download", s.apiService.HandleReportDownload)
+	mux.HandleFunc("/api/reports/send", s.apiService.HandleReportSend)
+	mux.HandleFunc("/api/inventory", s.apiService.HandleInventory)
+	mux.HandleFunc("/api/settings/webhook", s.apiService.HandleWebhookSettings)
+	mux.HandleFunc("/api/settings/mqtt", s.apiService.HandleMQTTSettings)
+	mux.HandleFunc("/api/settings/pagerduty", s.apiService.HandlePagerDutySettings)
+	mux.HandleFunc("/api/settings/opsgenie", s.apiService.HandleOpsgenieSettings)
+	mux.HandleFunc("/api/settings/home-assistant", s.apiService.HandleHomeAssistantSettings)
+	mux.HandleFunc("/api/settings/calendars", s.apiService.HandleCalendarSettings)
+	mux.HandleFunc("/api/calendars/status", s.apiService.HandleCalendarStatus)
+	mux.HandleFunc("/api/settings/triggers", s.apiService.HandleTriggers)
+	mux.HandleFunc("/api/settings/triggers/delete", s.apiService.HandleDeleteTrigger)
+	mux.HandleFunc("/api/triggers/", s.apiService.HandleFireTrigger)
+	mux.HandleFunc("/api/alerts", s.apiService.HandleAlerts)
+	mux.HandleFunc("/api/alerts/rules", s.apiService.HandleAlertRules)
+	mux.HandleFunc("/api/alerts/rules/test", s.apiService.HandleAlertScriptTest)
+	mux.HandleFunc("/api/alerts/quiet", s.apiService.HandleAlertQuiet)
+	mux.HandleFunc("/api/alerts/escalations", s.apiService.HandleAlertEscalations)
+	mux.HandleFunc("/api/alerts/", s.apiService.HandleAlertAck)
+	mux.HandleFunc("/api/auth/status", s.apiService.HandleAuthStatus)
+	mux.HandleFunc("/api/auth/bootstrap", s.apiService.HandleAuthBootstrap)
+	mux.HandleFunc("/api/auth/login", s.apiService.HandleLogin)
+	mux.HandleFunc("/api/auth/logout", s.apiService.HandleLogout)
+	mux.HandleFunc("/api/auth/me", s.apiService.HandleMe)
+	mux.HandleFunc("/api/auth/me/table", s.apiService.HandleMeTable)
+	mux.HandleFunc("/api/auth/password", s.apiService.HandleChangePassword)
+	mux.HandleFunc("/api/auth/invites", s.apiService.HandleInvites)
+	mux.HandleFunc("/api/auth/invite/accept", s.apiService.HandleAcceptInvite)
+	mux.HandleFunc("/api/auth/reset", s.apiService.HandleResetPassword)
+	mux.HandleFunc("/api/auth/oidc/login", s.apiService.HandleOIDCLogin)
+	mux.HandleFunc("/api/auth/oidc/callback", s.apiService.HandleOIDCCallback)
+	mux.HandleFunc("/api/settings/oidc", s.apiService.HandleOIDCSettings)
+	mux.HandleFunc("/api/settings/security", s.apiService.HandleSecuritySettings)
+	mux.HandleFunc("/api/settings/encryption", s.apiService.HandleEncryptionSettings)
+	mux.HandleFunc("/api/settings/approvals", s.apiService.HandleApprovalSettings)
+	mux.HandleFunc("/api/debug/faults", s.apiService.HandleFaults)
+	mux.HandleFunc("/api/settings/status-board", s.apiService.HandleStatusBoardSettings)
+	mux.HandleFunc("/api/settings/public-status", s.apiService.HandlePublicStatusSettings)
+	mux.HandleFunc("/api/public/status", s.apiService.HandlePublicStatus)
+	mux.HandleFunc("/api/users", s.apiService.HandleUsers)
+	mux.HandleFunc("/api/users/update", s.apiService.HandleUpdateUser)
+	mux.HandleFunc("/api/users/delete", s.apiService.HandleDeleteUser)
+	mux.HandleFunc("/api/users/reset", s.apiService.HandleCreateReset)
+	mux.HandleFunc("/api/users/sync", s.apiService.HandleSyncUsers)
+	mux.HandleFunc("/api/keys", s.apiService.HandleAPIKeys)
+	mux.HandleFunc("/api/keys/revoke", s.apiService.HandleRevokeAPIKey)
+	mux.HandleFunc("/api/audit", s.apiService.HandleAudit)
+	mux.HandleFunc("/api/audit/export", s.apiService.HandleAuditExport)
+	mux.HandleFunc("/api/audit/verify", s.apiService.HandleAuditVerify)
+	mux.HandleFunc("/api/credentials", s.apiService.HandleCredentials)
+	mux.HandleFunc("/api/credentials/delete", s.apiService.HandleDeleteCredential)
 	mux.HandleFunc("/api/discovery/scan", s.apiService.HandleDiscoveryScan)
+	mux.HandleFunc("/api/tailscale/status", s.apiService.HandleTailscaleStatus)
+	mux.HandleFunc("/api/heartbeat", s.apiService.HandleHeartbeat)
+	mux.HandleFunc("/api/peers", s.apiService.HandlePeers)
+	mux.HandleFunc("/api/peers/forget", s.apiService.HandleForgetPeer)
+	mux.HandleFunc("/api/peers/trust", s.apiService.HandleTrustPeer)
+	mux.HandleFunc("/api/peers/logs", s.apiService.HandlePeerLogs)
+	mux.HandleFunc(peerlog.Path, s.apiService.HandleReceivePeerLogs)
+	mux.HandleFunc(buddy.Path, s.apiService.HandleReceivePeerBackup)
+	mux.HandleFunc("/api/fleet/topology", s.apiService.HandleFleetTopology)
+	mux.HandleFunc("/api/fleet/sync-status", s.apiService.HandleSyncStatus)
+	mux.HandleFunc("/api/fleet/sync", s.apiService.HandleForceSync)
+	mux.HandleFunc("/api/maintenance", s.apiService.HandleMaintenance)
 	mux.HandleFunc("/api/proxy/anthias", s.apiService.HandleProxyAnthias)
 	
 	// WebSocket routes
@@ -178,8 +416,29 @@ func (s *Server) Start() <-chan error {
 	addr := fmt.Sprintf(":%d", s.port)
 	errCh := make(chan error, 1)
 
+	authn := s.apiService.Auth()
+	var handler http.Handler = mux
+	if s.noActions {
+		handler = refuseActions(handler)
+	}
+	handler = authn.SecurityHeaders(authn.Middleware(handler))
+	if s.chaos != nil {
+		handler = s.chaos.Middleware(handler)
+	}
+	// A span for each request, continuing the caller's trace
+	handler = tracing.Handler(handler)
+	// An ID for each request, the peer's for requests forwarded by one
+	handler = requestid.Middleware(handler)
+	// Requests from peers over the bus go through the same checks
+	mux.Handle(peerbus.Path, peerbus.NewServer(handler))
+
 	go func() {
-		err := http.ListenAndServe(addr, mux)
+		srv := &http.Server{Addr: addr, Handler: handler}
+		// gRPC clients need HTTP/2, which they speak without TLS here.
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+		err := srv.ListenAndServe()
 		errCh <- err
 		close(errCh)
 	}()
@@ -188,17 +447,23 @@ func (s *Server) Start() <-chan error {
 }
 
 func (s *Server) handlePageLoad(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	s.setCacheHeaders(w)
+	rememberView(w, r)
+	if isMobile(r) {
+		s.handleMobilePage(w, r)
+		return
+	}
 	// Pass current version so layout can display it in the header
-	err := s.templates.ExecuteTemplate(w, "layout.html", TemplateData{
+	s.writePage(w, "layout.html", TemplateData{
+		CurrentVersion: types.Version,
+		BuildTime:      types.BuildTime,
+	})
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	s.writePage(w, "login.html", TemplateData{
 		CurrentVersion: types.Version,
 		BuildTime:      types.BuildTime,
 	})
-	if err != nil {
-		log.Printf("Error executing layout template: %s", err)
-		http.Error(w, "Failed to render page", http.StatusInternalServerError)
-	}
 }
 
 func (s *Server) handleHomeView(w http.ResponseWriter, r *http.Request) {
@@ -237,19 +502,10 @@ func (s *Server) handleHomeView(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Identify duplicate hostnames
 	allHosts := s.store.GetAll()
-	hostnameCounts := make(map[string]int)
-	for _, h := range allHosts {
-		if h.Hostname != "" && h.Hostname != "localhost" && h.Hostname != "unknown" {
-			hostnameCounts[h.Hostname]++
-		}
-	}
-	duplicateHostnames := make(map[string]bool)
-	for name, count := range hostnameCounts {
-		if count > 1 {
-			duplicateHostnames[name] = true
-		}
+	conflicts, err := s.store.Conflicts()
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to check for host conflicts: %v", err))
 	}
 
 	s.editMu.RLock()
@@ -265,96 +521,77 @@ func (s *Server) handleHomeView(w http.ResponseWriter, r *http.Request) {
 		CurrentVersion:     types.Version,
 		Interfaces:         interfaces,
 		EnvVarSet:          os.Getenv("NSM_HOST_IP") != "",
-		DuplicateHostnames: duplicateHostnames,
+		Conflicts:          conflicts,
 		EditLocks:          editLocks,
+		Quality:            qualityCharts(s.store, allHosts),
+		WiFi:               s.wifiCharts(),
+		Uptime:             s.uptimeCharts(),
+		Incidents:          s.openIncidents(),
 	}
 
 	var buf bytes.Buffer
-	if err := s.templates.ExecuteTemplate(&buf, "home-view.html", data); err != nil {
-		log.Printf("Error executing home-view template: %s", err)
-		http.Error(w, "Failed to render view", http.StatusInternalServerError)
+	if err := s.templates.Load().ExecuteTemplate(&buf, "home-view.html", data); err != nil {
+		s.writeViewError(w, r, "Home view", err)
 		return
 	}
 
-	s.setCacheHeaders(w)
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	s.setCacheHeaders(w)
-
-	fmt.Fprintf(w, "event: datastar-merge-fragments\n")
-	fmt.Fprintf(w, "data: fragments <div id=\"content-area\">\n")
-
-	lines := strings.Split(buf.String(), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		fmt.Fprintf(w, "data: fragments %s\n", line)
-	}
-	fmt.Fprintf(w, "data: fragments </div>\n\n")
+	s.writeView(w, buf.String())
 }
 
 func (s *Server) handleAdvancedView(w http.ResponseWriter, r *http.Request) {
 	s.setCacheHeaders(w)
 
 	var buf bytes.Buffer
-	if err := s.templates.ExecuteTemplate(&buf, "advanced-view.html", TemplateData{
+	if err := s.templates.Load().ExecuteTemplate(&buf, "advanced-view.html", TemplateData{
 		CurrentVersion: types.Version,
 		BuildTime:      types.BuildTime,
 	}); err != nil {
-		log.Printf("Error executing advanced-view template: %s", err)
-		http.Error(w, "Failed to render view", http.StatusInternalServerError)
+		s.writeViewError(w, r, "Advanced view", err)
 		return
 	}
 
-	s.setCacheHeaders(w)
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	fmt.Fprintf(w, "event: datastar-merge-fragments\n")
-	fmt.Fprintf(w, "data: fragments <div id=\"content-area\">\n")
-
-	lines := strings.Split(buf.String(), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		fmt.Fprintf(w, "data: fragments %s\n", line)
-	}
-	fmt.Fprintf(w, "data: fragments </div>\n\n")
+	s.writeView(w, buf.String())
 }
 
 func (s *Server) handleAPIView(w http.ResponseWriter, r *http.Request) {
 	s.setCacheHeaders(w)
 
 	var buf bytes.Buffer
-	if err := s.templates.ExecuteTemplate(&buf, "api-view.html", TemplateData{
+	if err := s.templates.Load().ExecuteTemplate(&buf, "api-view.html", TemplateData{
 		CurrentVersion: types.Version,
 		BuildTime:      types.BuildTime,
 	}); err != nil {
-		log.Printf("Error executing api-view template: %s", err)
-		http.Error(w, "Failed to render view", http.StatusInternalServerError)
+		s.writeViewError(w, r, "API view", err)
 		return
 	}
 
+	s.writeView(w, buf.String())
+}
+
+func (s *Server) handleTopologyView(w http.ResponseWriter, r *http.Request) {
 	s.setCacheHeaders(w)
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
 
-	fmt.Fprintf(w, "event: datastar-merge-fragments\n")
-	fmt.Fprintf(w, "data: fragments <div id=\"content-area\">\n")
+	var selfID string
+	if local, err := s.anthias.GetMetadata(); err == nil {
+		selfID = local.ID
+	}
+	topo, err := s.store.Topology(selfID)
+	if err != nil {
+		s.writeViewError(w, r, "Topology view", err)
+		return
+	}
 
-	lines := strings.Split(buf.String(), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		fmt.Fprintf(w, "data: fragments %s\n", line)
+	var buf bytes.Buffer
+	if err := s.templates.Load().ExecuteTemplate(&buf, "topology-view.html", TemplateData{
+		CurrentVersion: types.Version,
+		BuildTime:      types.BuildTime,
+		Topology:       layoutTopology(topo),
+	}); err != nil {
+		s.writeViewError(w, r, "Topology view", err)
+		return
 	}
-	fmt.Fprintf(w, "data: fragments </div>\n\n")
+
+	s.writeView(w, buf.String())
 }
 
 func (s *Server) handleDocsView(w http.ResponseWriter, r *http.Request) {
@@ -369,7 +606,7 @@ func (s *Server) handleDocsView(w http.ResponseWriter, r *http.Request) {
 		if err == nil {
 			docContent = content
 		} else {
-			s.logger.Error(fmt.Sprintf("Failed to load doc %s: %v", docName, err))
+			s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to load doc %s: %v", docName, err))
 		}
 	} else if len(docList) > 0 {
 		// Default to first doc if none selected
@@ -379,34 +616,27 @@ func (s *Server) handleDocsView(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var buf bytes.Buffer
-	if err := s.templates.ExecuteTemplate(&buf, "docs-view.html", TemplateData{
+	if err := s.templates.Load().ExecuteTemplate(&buf, "docs-view.html", TemplateData{
 		CurrentVersion: types.Version,
 		BuildTime:      types.BuildTime,
 		DocList:        docList,
 		DocContent:     template.HTML(docContent),
 		CurrentDoc:     docName,
 	}); err != nil {
-		log.Printf("Error executing docs-view template: %s", err)
-		http.Error(w, "Failed to render view", http.StatusInternalServerError)
+		s.writeViewError(w, r, "Docs view", err)
 		return
 	}
 
-	s.setCacheHeaders(w)
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-
-	fmt.Fprintf(w, "event: datastar-merge-fragments\n")
-	fmt.Fprintf(w, "data: fragments <div id=\"content-area\">\n")
+	s.writeView(w, buf.String())
+}
 
-	lines := strings.Split(buf.String(), "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
-		}
-		fmt.Fprintf(w, "data: fragments %s\n", line)
+// writeView sends a rendered view as the new content area.
+func (s *Server) writeView(w http.ResponseWriter, html string) {
+	s.setCacheHeaders(w)
+	sw := newSSEWriter(w)
+	if err := sw.send(mergeFragments(`<div id="content-area">`+html+`</div>`, fragmentOptions{})); err != nil {
+		log.Printf("Error sending view: %v", err)
 	}
-	fmt.Fprintf(w, "data: fragments </div>\n\n")
 }
 
 // handleAddHost adds a new host to the list
@@ -433,13 +663,13 @@ func (s *Server) handleAddHost(w http.ResponseWriter, r *http.Request) {
 	nickname := strings.TrimSpace(req.Nickname)
 	notes := strings.TrimSpace(req.Notes)
 
-	if !isValidIPv4(ip) {
-		http.Error(w, "Valid LAN IP address is required", http.StatusBadRequest)
+	if !hosts.ValidAddress(ip) {
+		http.Error(w, "Valid LAN IP address or DNS name is required", http.StatusBadRequest)
 		return
 	}
 
-	if vpnIP != "" && !isValidIPv4(vpnIP) {
-		http.Error(w, "VPN IP address must be a valid IPv4 address", http.StatusBadRequest)
+	if vpnIP != "" && !hosts.ValidAddress(vpnIP) {
+		http.Error(w, "VPN address must be a valid IPv4 address or DNS name", http.StatusBadRequest)
 		return
 	}
 
@@ -467,23 +697,25 @@ func (s *Server) handleAddHost(w http.ResponseWriter, r *http.Request) {
 		host.DashboardURLVPN = fmt.Sprintf("http://%s:8080", vpnIP)
 	}
 
+	// Peers must file the host under the same ID
+	host.ID = uuid.New().String()
 	if err := s.store.Add(host); err != nil {
 		log.Printf("Error adding host: %s", err)
-		s.logger.Error(fmt.Sprintf("Failed to add host %s: %v", ip, err))
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to add host %s: %v", ip, err))
 		http.Error(w, "Failed to add host", http.StatusInternalServerError)
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Added new host: %s (%s)", ip, nickname))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Added new host: %s (%s)", ip, nickname))
 	log.Printf("Added new host: %s (%s)", ip, nickname)
 
 	// Auto-push to online peers
-	go s.pushToOnlinePeers(host)
+	go s.pushToOnlinePeers(r.Context(), host)
 
 	// Check health of new host
 	go func(base types.Host) {
 		updated := base
-		hosts.CheckHealth(&updated)
+		s.store.CheckHealth(&updated)
 		if err := s.store.Update(base.IPAddress, func(h *types.Host) {
 			copyNetworkState(h, &updated)
 			if updated.Hostname != "" {
@@ -523,29 +755,19 @@ func (s *Server) handleUpdateHost(w http.ResponseWriter, r *http.Request) {
 	newNickname := strings.TrimSpace(updateReq.Nickname)
 	newNotes := strings.TrimSpace(updateReq.Notes)
 
-	if !isValidIPv4(newIP) {
-		http.Error(w, "Valid LAN IP address is required", http.StatusBadRequest)
+	if !hosts.ValidAddress(newIP) {
+		http.Error(w, "Valid LAN IP address or DNS name is required", http.StatusBadRequest)
 		return
 	}
 
-	if newVPN != "" && !isValidIPv4(newVPN) {
-		http.Error(w, "VPN IP address must be a valid IPv4 address", http.StatusBadRequest)
+	if newVPN != "" && !hosts.ValidAddress(newVPN) {
+		http.Error(w, "VPN address must be a valid IPv4 address or DNS name", http.StatusBadRequest)
 		return
 	}
 
 	err := s.store.Update(updateReq.OldIP, func(h *types.Host) {
 		if newIP != "" {
-			ipChanged := newIP != h.IPAddress
-			h.IPAddress = newIP
-			h.DashboardURL = fmt.Sprintf("http://%s:8080", newIP)
-			if ipChanged {
-				h.Status = types.StatusUnreachable
-				h.NSMStatus = "NSM Offline"
-				h.NSMVersion = "unknown"
-				h.CMSStatus = types.CMSUnknown
-				h.AssetCount = 0
-				h.LastChecked = time.Time{}
-			}
+			h.MoveTo(newIP)
 		}
 
 		if newVPN == "" {
@@ -577,19 +799,19 @@ func (s *Server) handleUpdateHost(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Printf("Error updating host: %s", err)
-		s.logger.Error(fmt.Sprintf("Failed to update host %s: %v", updateReq.OldIP, err))
+		s.logger.ErrorContext(r.Context(), fmt.Sprintf("Failed to update host %s: %v", updateReq.OldIP, err))
 		http.Error(w, "Failed to update host", http.StatusInternalServerError)
 		return
 	}
 
-	s.logger.Info(fmt.Sprintf("API: Updated host: %s -> %s", updateReq.OldIP, newIP))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("API: Updated host: %s -> %s", updateReq.OldIP, newIP))
 
 	if updatedHost, getErr := s.store.GetByIP(newIP); getErr == nil {
 		// Auto-push to online peers
-		go s.pushToOnlinePeers(*updatedHost)
+		go s.pushToOnlinePeers(r.Context(), *updatedHost)
 		
 		go func(toRefresh *types.Host) {
-			hosts.CheckHealth(toRefresh)
+			s.store.CheckHealth(toRefresh)
 			if err := s.store.Update(toRefresh.IPAddress, func(h *types.Host) {
 				copyNetworkState(h, toRefresh)
 				if toRefresh.Hostname != "" {
@@ -614,66 +836,22 @@ func (s *Server) watchHostUpdates() {
 		if data != nil {
 			s.sseBroker.broadcast(data)
 		}
-	}
-}
-
-// bufferResponseWriter is a mock http.ResponseWriter that captures output to a buffer
-// It implements http.ResponseWriter and http.Flusher for compatibility with the datastar SDK
-type bufferResponseWriter struct {
-	header http.Header
-	buf    bytes.Buffer
-	status int
-}
-
-func newBufferResponseWriter() *bufferResponseWriter {
-	return &bufferResponseWriter{
-		header: make(http.Header),
-		status: http.StatusOK,
-	}
-}
-
-func (b *bufferResponseWriter) Header() http.Header {
-	return b.header
-}
-
-func (b *bufferResponseWriter) Write(data []byte) (int, error) {
-	return b.buf.Write(data)
-}
-
-func (b *bufferResponseWriter) WriteHeader(statusCode int) {
-	b.status = statusCode
-}
-
-func (b *bufferResponseWriter) Flush() {
-	// No-op for buffer writer
-}
-
-// formatSSEEvent formats an HTML element as a datastar SSE event
-// Uses datastar-merge-fragments format (client expects this format)
-func formatSSEEvent(htmlContent string, selectorID string) ([]byte, error) {
-
-	// Create a buffer-based response writer
-	bufWriter := newBufferResponseWriter()
-
-	// Use the SDK to send merge-fragments event
-	bufWriter.Header().Set("Content-Type", "text/event-stream")
-	bufWriter.Header().Set("Cache-Control", "no-cache")
-	bufWriter.Header().Set("Connection", "keep-alive")
-
-	fmt.Fprintf(bufWriter, "event: datastar-merge-fragments\n")
-
-	lines := strings.Split(htmlContent, "\n")
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "" {
-			continue
+		if s.boardBroker.count() > 0 {
+			if data := s.renderStatusBoardFragment(); data != nil {
+				s.boardBroker.broadcast(data)
+			}
+		}
+		if s.mobileBroker.count() > 0 {
+			if data := s.renderMobileFragment(); data != nil {
+				s.mobileBroker.broadcast(data)
+			}
 		}
-		fmt.Fprintf(bufWriter, "data: fragments %s\n", line)
 	}
-	fmt.Fprintf(bufWriter, "\n")
-
-	return bufWriter.buf.Bytes(), nil
 }
 
+// hostTableColumns is the number of columns in the host table.
+const hostTableColumns = 7
+
 // renderHostListFragment creates the SSE-formatted fragment for host list updates
 func (s *Server) renderHostListFragment() []byte {
 	// Get current host IP based on persistent ID
@@ -686,19 +864,10 @@ func (s *Server) renderHostListFragment() []byte {
 		}
 	}
 
-	// Identify duplicate hostnames
 	allHosts := s.store.GetAll()
-	hostnameCounts := make(map[string]int)
-	for _, h := range allHosts {
-		if h.Hostname != "" && h.Hostname != "localhost" && h.Hostname != "unknown" {
-			hostnameCounts[h.Hostname]++
-		}
-	}
-	duplicateHostnames := make(map[string]bool)
-	for name, count := range hostnameCounts {
-		if count > 1 {
-			duplicateHostnames[name] = true
-		}
+	conflicts, err := s.store.Conflicts()
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Failed to check for host conflicts: %v", err))
 	}
 
 	s.editMu.RLock()
@@ -712,38 +881,30 @@ func (s *Server) renderHostListFragment() []byte {
 		Hosts:              allHosts,
 		CurrentHostIP:      currentIP,
 		CurrentVersion:     types.Version,
-		DuplicateHostnames: duplicateHostnames,
+		Conflicts:          conflicts,
 		EditLocks:          editLocks,
+		Quality:            qualityCharts(s.store, allHosts),
+		WiFi:               s.wifiCharts(),
+		Uptime:             s.uptimeCharts(),
+		Incidents:          s.openIncidents(),
 	}
 
 	var buf bytes.Buffer
-	if err := s.templates.ExecuteTemplate(&buf, "host-rows-content", templateData); err != nil {
-		log.Printf("Error rendering host-rows-content template: %v", err)
-		return nil
+	if err := s.templates.Load().ExecuteTemplate(&buf, "host-rows-content", templateData); err != nil {
+		s.renderFailed("Host list", err)
+		buf.Reset()
+		buf.WriteString(errorRow("Host list", hostTableColumns))
 	}
 
 	// Wrap content in tbody with matching ID for datastar to target
 	content := "<tbody id=\"host_table_body\" class=\"divide-y divide-desert-gray\">" + buf.String() + "</tbody>"
-	
-	// Use SDK to format the SSE event
-	eventBytes, err := formatSSEEvent(content, "host_table_body")
-	if err != nil {
-		log.Printf("Error formatting SSE event: %v", err)
-		return nil
-	}
-	
-	return eventBytes
+	return encodeEvent(mergeFragments(content, fragmentOptions{}))
 }
 
 // handleHostsStream establishes an SSE connection and streams host list updates
 func (s *Server) handleHostsStream(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
+	sw := newSSEWriter(w)
+	if err := sw.flush(); err != nil {
 		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
 		return
 	}
@@ -753,63 +914,59 @@ func (s *Server) handleHostsStream(w http.ResponseWriter, r *http.Request) {
 	s.sseBroker.register(clientChan)
 	defer s.sseBroker.unregister(clientChan)
 
-	s.logger.Info("SSE client connected for host updates")
-	defer s.logger.Info("SSE client disconnected")
+	s.logger.InfoContext(r.Context(), "SSE client connected for host updates")
+	defer s.logger.InfoContext(r.Context(), "SSE client disconnected")
 
 	// Send initial state immediately
-	initialData := s.renderHostListFragment()
-	if initialData != nil {
-		w.Write(initialData)
-		flusher.Flush()
+	if initialData := s.renderHostListFragment(); initialData != nil {
+		sw.write(initialData)
 	}
 
 	// Set up keep-alive ticker
 	keepAlive := time.NewTicker(30 * time.Second)
 	defer keepAlive.Stop()
 
+	// Users who prefer a calmer table get the latest host list once per
+	// interval instead of every change. Lock state is still sent as it
+	// changes.
+	var refresh <-chan time.Time
+	var pending []byte
+	if u, ok := auth.UserFromContext(r.Context()); ok && u.Prefs.Table.RefreshSeconds > 0 {
+		ticker := time.NewTicker(time.Duration(u.Prefs.Table.RefreshSeconds) * time.Second)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
 	for {
 		select {
 		case <-r.Context().Done():
 			return
 		case data := <-clientChan:
+			if refresh != nil && !bytes.HasPrefix(data, []byte("event: "+lockStateEvent+"\n")) {
+				pending = data
+				continue
+			}
 			// Broadcast update received
-			w.Write(data)
-			flusher.Flush()
+			sw.write(data)
+		case <-refresh:
+			if pending != nil {
+				sw.write(pending)
+				pending = nil
+			}
 		case <-keepAlive.C:
 			// Send keep-alive comment to prevent timeout
-			fmt.Fprintf(w, ": keep-alive\n\n")
-			flusher.Flush()
+			sw.comment("keep-alive")
 		}
 	}
 }
 
-// handleAnnounceHost receives a single host announcement and upserts it
-func (s *Server) handleAnnounceHost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var host types.Host
-	if err := json.NewDecoder(r.Body).Decode(&host); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate that we have at least an ID and IP
-	if host.ID == "" || host.IPAddress == "" {
-		http.Error(w, "Host ID and IP address are required", http.StatusBadRequest)
-		return
-	}
-
-	if err := s.store.Upsert(host); err != nil {
-		log.Printf("Failed to upsert announced host: %v", err)
-		http.Error(w, "Failed to upsert host", http.StatusInternalServerError)
-		return
-	}
-
-	s.logger.Info(fmt.Sprintf("Received host announcement: %s (ID: %s)", host.IPAddress, host.ID))
-	w.WriteHeader(http.StatusNoContent)
+// Editing reports whether someone holds the edit lock on a host on this
+// node's dashboard.
+func (s *Server) Editing(hostID string) bool {
+	s.editMu.RLock()
+	defer s.editMu.RUnlock()
+	_, locked := s.editLocks[hostID]
+	return locked
 }
 
 // handleLockHost attempts to acquire an edit lock on a host
@@ -848,7 +1005,7 @@ func (s *Server) handleLockHost(w http.ResponseWriter, r *http.Request) {
 	s.editLocks[req.HostID] = req.EditorID
 	s.editMu.Unlock()
 
-	s.logger.Info(fmt.Sprintf("Lock acquired: host %s by %s", req.HostID, req.EditorID))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("Lock acquired: host %s by %s", req.HostID, req.EditorID))
 	
 	// Broadcast lock state via SSE
 	s.broadcastLockState()
@@ -895,7 +1052,7 @@ func (s *Server) handleUnlockHost(w http.ResponseWriter, r *http.Request) {
 	delete(s.editLocks, req.HostID)
 	s.editMu.Unlock()
 
-	s.logger.Info(fmt.Sprintf("Lock released: host %s", req.HostID))
+	s.logger.InfoContext(r.Context(), fmt.Sprintf("Lock released: host %s", req.HostID))
 	
 	// Broadcast lock state via SSE
 	s.broadcastLockState()
@@ -906,6 +1063,10 @@ func (s *Server) handleUnlockHost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// lockStateEvent carries the edit locks on the host stream, for clients
+// following lock changes. Datastar ignores events it does not know.
+const lockStateEvent = "lock-state"
+
 // broadcastLockState sends current lock state to all SSE clients
 func (s *Server) broadcastLockState() {
 	s.editMu.RLock()
@@ -923,67 +1084,228 @@ func (s *Server) broadcastLockState() {
 		return
 	}
 
-	msg := fmt.Sprintf("event: lock-state\ndata: %s\n\n", string(data))
-	s.sseBroker.broadcast([]byte(msg))
+	if msg := encodeEvent(sseEvent{Event: lockStateEvent, Data: []string{string(data)}}); msg != nil {
+		s.sseBroker.broadcast(msg)
+	}
 }
 
-// pushToOnlinePeers pushes a single host to all online peers on the same subnet
-func (s *Server) pushToOnlinePeers(host types.Host) {
+// peerRetryInterval is how often peers with queued announcements are
+// checked, so a peer gets them soon after it is healthy again.
+const peerRetryInterval = 15 * time.Second
+
+// pushToOnlinePeers pushes a single host to all online peers on the same
+// subnet. Peers that are offline or fail to take it get it queued, and
+// retryPeerPushes delivers it when they are healthy again. Peers handle the
+// announcements under the request ID in ctx.
+func (s *Server) pushToOnlinePeers(ctx context.Context, host types.Host) {
+	// Send the stored record, with the versions of its fields
+	if stored, err := s.store.GetByID(host.ID); err == nil {
+		host = *stored
+	}
 	allHosts := s.store.GetAll()
 	localSubnet := getSubnet(host.IPAddress)
 
 	if localSubnet == "" {
-		s.logger.Warning(fmt.Sprintf("Cannot determine subnet for %s, skipping peer push", host.IPAddress))
+		s.logger.WarningContext(ctx, fmt.Sprintf("Cannot determine subnet for %s, skipping peer push", host.IPAddress))
 		return
 	}
 
-	peerCount := 0
+	body, err := s.sealAnnouncement(host)
+	if err != nil {
+		s.logger.WarningContext(ctx, fmt.Sprintf("Skipping peer push of %s: %v", host.IPAddress, err))
+		return
+	}
+
+	peerCount, queued := 0, 0
 	for _, peer := range allHosts {
 		// Skip self
 		if peer.ID == host.ID {
 			continue
 		}
 
-		// Only push to healthy/online hosts
-		if peer.Status != types.StatusHealthy {
-			continue
-		}
-
 		// Only push to hosts on the same subnet
 		peerSubnet := getSubnet(peer.IPAddress)
 		if peerSubnet != localSubnet {
 			continue
 		}
 
+		// Hosts offline over the path we would use get it when they are back
+		path := hosts.SelectPath(peer)
+		if !path.Healthy() {
+			s.peerQueue.Add(peer.ID, host, fmt.Sprintf("peer %s", path.Status), time.Now())
+			queued++
+			continue
+		}
+
 		peerCount++
 		go func(targetIP, targetID string) {
-			body, err := json.Marshal(host)
-			if err != nil {
-				s.logger.Error(fmt.Sprintf("Failed to marshal host for peer push: %v", err))
+			if err := s.sendAnnouncement(ctx, targetID, targetIP, host, body); err != nil {
+				s.logger.WarningContext(ctx, fmt.Sprintf("Failed to announce to peer %s, will retry: %v", targetIP, err))
+				s.peerQueue.Add(targetID, host, err.Error(), time.Now())
 				return
 			}
+			s.peerQueue.Delivered(targetID, host.ID)
+		}(path.Address, peer.ID)
+	}
 
-			url := fmt.Sprintf("http://%s:8080/api/hosts/announce", targetIP)
-			client := &http.Client{Timeout: 3 * time.Second}
-			resp, err := client.Post(url, "application/json", bytes.NewBuffer(body))
+	if peerCount > 0 {
+		s.logger.InfoContext(ctx, fmt.Sprintf("Announcing host %s to %d online peers on subnet %s.0/24", host.IPAddress, peerCount, localSubnet))
+	} else {
+		s.logger.InfoContext(ctx, fmt.Sprintf("No online peers on subnet %s.0/24 to announce to", localSubnet))
+	}
+	if queued > 0 {
+		s.logger.InfoContext(ctx, fmt.Sprintf("Queued announcement of %s for %d offline peers", host.IPAddress, queued))
+	}
+}
+
+// sealAnnouncement signs an announcement of host. Peers only apply
+// announcements signed by a node they know.
+func (s *Server) sealAnnouncement(host types.Host) ([]byte, error) {
+	local, err := s.anthias.GetMetadata()
+	if err != nil || s.Identity() == nil {
+		return nil, errors.New("node identity unavailable")
+	}
+	body, err := announce.Seal(local.ID, host, s.Identity())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign announcement: %w", err)
+	}
+	return body, nil
+}
+
+// sendAnnouncement posts a signed announcement of host to peerID at
+// targetIP and records the outcome for the sync status. It returns an
+// error if the peer could not be reached or failed, which is worth
+// retrying; a peer that refuses the announcement is only logged, as it
+// would refuse it again.
+func (s *Server) sendAnnouncement(ctx context.Context, peerID, targetIP string, host types.Host, body []byte) error {
+	status, err := s.peerBus.PostContext(ctx, targetIP, announce.Path, body, 3*time.Second)
+	if err != nil {
+		s.store.RecordPush(peerID, time.Now(), err)
+		return err
+	}
+
+	switch {
+	case status == http.StatusNoContent:
+		s.logger.InfoContext(ctx, fmt.Sprintf("Announced host %s to peer %s", host.IPAddress, targetIP))
+		s.store.RecordPush(peerID, time.Now(), nil)
+	case status == http.StatusAccepted:
+		s.logger.WarningContext(ctx, fmt.Sprintf("Peer %s quarantined the announcement of %s until an admin there approves it", targetIP, host.IPAddress))
+		s.store.RecordPush(peerID, time.Now(), errors.New("quarantined by the peer"))
+	case status >= 500:
+		err := fmt.Errorf("status %d", status)
+		s.store.RecordPush(peerID, time.Now(), err)
+		return err
+	default:
+		s.logger.WarningContext(ctx, fmt.Sprintf("Peer %s returned status %d for announcement", targetIP, status))
+		s.store.RecordPush(peerID, time.Now(), fmt.Errorf("refused with status %d", status))
+	}
+	return nil
+}
+
+// retryPeerPushes delivers queued announcements to each peer once it is
+// healthy again, checking every interval. It also tracks whether the node
+// is isolated, and replays hosts edited meanwhile once it is not.
+func (s *Server) retryPeerPushes(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.checkIsolation()
+		for peerID := range s.peerQueue.Peers() {
+			peer, err := s.store.GetByID(peerID)
 			if err != nil {
-				s.logger.Warning(fmt.Sprintf("Failed to announce to peer %s: %v", targetIP, err))
-				return
+				if n := s.peerQueue.Drop(peerID); n > 0 {
+					s.logger.Info(fmt.Sprintf("Dropped %d queued announcements for removed peer %s", n, peerID))
+				}
+				continue
 			}
-			defer resp.Body.Close()
-
-			if resp.StatusCode == http.StatusNoContent {
-				s.logger.Info(fmt.Sprintf("Announced host %s to peer %s", host.IPAddress, targetIP))
-			} else {
-				s.logger.Warning(fmt.Sprintf("Peer %s returned status %d for announcement", targetIP, resp.StatusCode))
+			if path := hosts.SelectPath(*peer); path.Healthy() {
+				s.flushPeerQueue(peerID, path.Address)
 			}
-		}(peer.IPAddress, peer.ID)
+		}
 	}
+}
 
-	if peerCount > 0 {
-		s.logger.Info(fmt.Sprintf("Announcing host %s to %d online peers on subnet %s.0/24", host.IPAddress, peerCount, localSubnet))
-	} else {
-		s.logger.Info(fmt.Sprintf("No online peers on subnet %s.0/24 to announce to", localSubnet))
+// checkIsolation records whether any peer that sends heartbeats is
+// reachable. A node with peers but none reachable is isolated, and the
+// store buffers its host edits. Once a peer is reachable again, each host
+// edited meanwhile is announced; peers still offline get it queued.
+func (s *Server) checkIsolation() {
+	local, err := s.anthias.GetMetadata()
+	if err != nil {
+		return
+	}
+	peers, err := s.store.ListPeers()
+	if err != nil {
+		return
+	}
+	known, reachable := 0, false
+	for _, p := range peers {
+		peer, err := s.store.GetByID(p.NodeID)
+		if p.NodeID == local.ID || err != nil {
+			continue
+		}
+		known++
+		if hosts.SelectPath(*peer).Healthy() {
+			reachable = true
+			break
+		}
+	}
+
+	isolated := known > 0 && !reachable
+	if isolated != s.store.Isolated() {
+		if isolated {
+			s.logger.Warning("No peer is reachable; buffering host edits until one is")
+		} else {
+			s.logger.Info("A peer is reachable again")
+		}
+		s.store.SetIsolated(isolated)
+	}
+	if isolated {
+		return
+	}
+
+	edits, err := s.store.OfflineEdits()
+	if err != nil || len(edits) == 0 {
+		return
+	}
+	s.logger.Info(fmt.Sprintf("Replaying %d hosts edited while isolated", len(edits)))
+	for _, e := range edits {
+		if host, err := s.store.GetByID(e.HostID); err == nil {
+			s.pushToOnlinePeers(context.Background(), *host)
+		}
+		s.store.ClearOfflineEdit(e)
+	}
+}
+
+// flushPeerQueue sends the announcements queued for a peer, putting back
+// those that fail until they run out of attempts.
+func (s *Server) flushPeerQueue(peerID, targetIP string) {
+	now := time.Now()
+	due, expired := s.peerQueue.Take(peerID, now)
+	if expired > 0 {
+		s.logger.Warning(fmt.Sprintf("Gave up on %d announcements queued over %s for peer %s", expired, announce.MaxAge, targetIP))
+	}
+	if len(due) == 0 {
+		return
+	}
+	s.logger.Info(fmt.Sprintf("Peer %s is back, sending %d queued announcements", targetIP, len(due)))
+	for i, p := range due {
+		if stored, err := s.store.GetByID(p.Host.ID); err == nil {
+			p.Host = *stored // The latest edits, not those at the time it was queued
+		}
+		body, err := s.sealAnnouncement(p.Host)
+		if err == nil {
+			err = s.sendAnnouncement(context.Background(), peerID, targetIP, p.Host, body)
+		}
+		if err == nil {
+			continue
+		}
+		if !s.peerQueue.Retry(peerID, p, err.Error(), now) {
+			s.logger.Warning(fmt.Sprintf("Gave up announcing host %s to peer %s after %d attempts: %v", p.Host.IPAddress, targetIP, p.Attempts+1, err))
+		}
+		// The peer is unreachable again; keep the rest for next time.
+		s.peerQueue.Requeue(peerID, due[i+1:]...)
+		return
 	}
 }
 
@@ -1032,8 +1354,9 @@ func (s *Server) announceLockToPeers(hostID, editorID string, isLock bool) {
 			continue
 		}
 
-		// Only announce to healthy/online hosts
-		if peer.Status != types.StatusHealthy {
+		// Only announce to hosts that are online over the path we would use
+		path := hosts.SelectPath(peer)
+		if !path.Healthy() {
 			continue
 		}
 
@@ -1055,14 +1378,9 @@ func (s *Server) announceLockToPeers(hostID, editorID string, isLock bool) {
 				return
 			}
 
-			url := fmt.Sprintf("http://%s:8080%s", targetIP, endpoint)
-			resp, err := http.Post(url, "application/json", bytes.NewReader(body))
-			if err != nil {
-				// Silently ignore peer announcement failures
-				return
-			}
-			defer resp.Body.Close()
-		}(peer.IPAddress)
+			// Silently ignore peer announcement failures
+			s.peerBus.Post(targetIP, endpoint, body, 3*time.Second)
+		}(path.Address)
 	}
 
 	if peerCount > 0 {
@@ -1132,6 +1450,7 @@ func (s *Server) handleDiagnosticsWS(w http.ResponseWriter, r *http.Request) {
 				"node_id":     nodeID,
 				"hosts_count": hostCount,
 				"last_backup": lastBackup,
+				"bandwidth":   s.apiService.Bandwidth().Usage(),
 			}
 
 			if err := conn.WriteJSON(msg); err != nil {
@@ -1207,22 +1526,17 @@ func (s *Server) setCacheHeaders(w http.ResponseWriter) {
 	w.Header().Set("Expires", "0")
 }
 
-func isValidIPv4(ip string) bool {
-	if ip == "" {
-		return false
-	}
-	parsed := net.ParseIP(ip)
-	return parsed != nil && parsed.To4() != nil
-}
-
 func copyNetworkState(dst, src *types.Host) {
 	dst.Status = src.Status
 	dst.CMSStatus = src.CMSStatus
 	dst.AssetCount = src.AssetCount
+	dst.ContentExpiresAt = src.ContentExpiresAt
 	dst.NSMStatus = src.NSMStatus
 	dst.NSMVersion = src.NSMVersion
 	dst.DashboardURL = src.DashboardURL
 	dst.LastChecked = src.LastChecked
+	dst.ClockSkewMS = src.ClockSkewMS
+	dst.ClockCheckedAt = src.ClockCheckedAt
 
 	dst.StatusVPN = src.StatusVPN
 	dst.CMSStatusVPN = src.CMSStatusVPN
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseEvent is one server-sent event. Each entry of Data is sent as its own
+// data line; entries with line breaks are split over several, which the
+// client joins back with newlines.
+type sseEvent struct {
+	Event string
+	ID    string        // Sent back by the client as Last-Event-ID when it reconnects
+	Retry time.Duration // How long the client waits before reconnecting; zero leaves its default
+	Data  []string
+}
+
+var errSSEField = errors.New("sse: event name and id must be a single line")
+
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// encode returns the event in the text/event-stream wire format.
+func (e sseEvent) encode() ([]byte, error) {
+	if strings.ContainsAny(e.Event, "\r\n") || strings.ContainsAny(e.ID, "\r\n\x00") {
+		return nil, errSSEField
+	}
+	var b bytes.Buffer
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	for _, d := range e.Data {
+		for _, line := range strings.Split(lineBreaks.Replace(d), "\n") {
+			b.WriteString("data: " + line + "\n")
+		}
+	}
+	b.WriteString("\n")
+	return b.Bytes(), nil
+}
+
+// sseWriter writes server-sent events to a response, flushing after each.
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+// newSSEWriter sets the event stream headers on w and returns a writer for
+// it. Nothing is written until the first event or flush.
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	return &sseWriter{w: w, rc: http.NewResponseController(w)}
+}
+
+// send writes e and flushes it to the client.
+func (sw *sseWriter) send(e sseEvent) error {
+	data, err := e.encode()
+	if err != nil {
+		return err
+	}
+	return sw.write(data)
+}
+
+// write sends an event already encoded, as the brokers broadcast them.
+func (sw *sseWriter) write(data []byte) error {
+	if _, err := sw.w.Write(data); err != nil {
+		return err
+	}
+	return sw.flush()
+}
+
+// comment sends a comment line, which clients ignore; it keeps idle
+// connections from timing out.
+func (sw *sseWriter) comment(text string) error {
+	return sw.write([]byte(": " + strings.ReplaceAll(lineBreaks.Replace(text), "\n", " ") + "\n\n"))
+}
+
+// flush sends what has been written so far. It fails with
+// http.ErrNotSupported if the response cannot be streamed.
+func (sw *sseWriter) flush() error {
+	return sw.rc.Flush()
+}
+
+// Datastar events. The client applies these to the page; see
+// datastar.js for the keys each one reads from its data lines.
+const (
+	datastarMergeFragments  = "datastar-merge-fragments"
+	datastarRemoveFragments = "datastar-remove-fragments"
+)
+
+// mergeMode is how datastar merges a fragment into the element it targets.
+type mergeMode string
+
+const (
+	mergeMorph            mergeMode = "morph" // The default
+	mergeInner            mergeMode = "inner"
+	mergeOuter            mergeMode = "outer"
+	mergePrepend          mergeMode = "prepend"
+	mergeAppend           mergeMode = "append"
+	mergeBefore           mergeMode = "before"
+	mergeAfter            mergeMode = "after"
+	mergeUpsertAttributes mergeMode = "upsertAttributes"
+)
+
+// defaultSettleDuration is how long datastar keeps merged elements in
+// their settling state unless told otherwise.
+const defaultSettleDuration = 300 * time.Millisecond
+
+// fragmentOptions tune a datastar fragment event. Zero values leave the
+// client's defaults, and are not sent.
+type fragmentOptions struct {
+	Selector          string // Element to merge into; by default each fragment targets the element with its id
+	MergeMode         mergeMode
+	SettleDuration    time.Duration
+	UseViewTransition bool
+	ID                string
+	Retry             time.Duration
+}
+
+// mergeFragments returns the event that merges the HTML fragments into
+// the page. Blank lines are kept, so preformatted text survives.
+func mergeFragments(html string, opts fragmentOptions) sseEvent {
+	e := opts.event(datastarMergeFragments)
+	if opts.MergeMode != "" && opts.MergeMode != mergeMorph {
+		e.Data = append(e.Data, "mergeMode "+string(opts.MergeMode))
+	}
+	for _, line := range strings.Split(lineBreaks.Replace(strings.TrimSpace(html)), "\n") {
+		e.Data = append(e.Data, "fragments "+line)
+	}
+	return e
+}
+
+// removeFragments returns the event that removes the elements matching
+// selector from the page.
+func removeFragments(selector string, opts fragmentOptions) sseEvent {
+	opts.Selector = selector
+	return opts.event(datastarRemoveFragments)
+}
+
+func (opts fragmentOptions) event(name string) sseEvent {
+	e := sseEvent{Event: name, ID: opts.ID, Retry: opts.Retry}
+	if opts.Selector != "" {
+		e.Data = append(e.Data, "selector "+opts.Selector)
+	}
+	if opts.SettleDuration > 0 && opts.SettleDuration != defaultSettleDuration {
+		e.Data = append(e.Data, "settleDuration "+strconv.FormatInt(opts.SettleDuration.Milliseconds(), 10))
+	}
+	if opts.UseViewTransition {
+		e.Data = append(e.Data, "useViewTransition true")
+	}
+	return e
+}
+
+// encodeEvent encodes e for a broker to broadcast. It logs and returns nil
+// if e cannot be encoded.
+func encodeEvent(e sseEvent) []byte {
+	data, err := e.encode()
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", e.Event, err)
+		return nil
+	}
+	return data
+}
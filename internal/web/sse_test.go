@@ -0,0 +1,163 @@
+package web
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/anthias"
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/types"
+)
+
+func TestEncodeEvent(t *testing.T) {
+	data, err := sseEvent{Event: "update", ID: "7", Retry: 2 * time.Second, Data: []string{"one\r\ntwo", "three"}}.encode()
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	want := "event: update\nid: 7\nretry: 2000\ndata: one\ndata: two\ndata: three\n\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	if _, err := (sseEvent{Event: "a\nb"}).encode(); err == nil {
+		t.Error("expected an event name with a line break refused")
+	}
+	if _, err := (sseEvent{ID: "1\n2"}).encode(); err == nil {
+		t.Error("expected an id with a line break refused")
+	}
+}
+
+func TestMergeFragments(t *testing.T) {
+	data := encodeEvent(mergeFragments("\n<div id=\"a\">\n\n<pre>x</pre>\n</div>\n", fragmentOptions{}))
+	want := "event: datastar-merge-fragments\n" +
+		"data: fragments <div id=\"a\">\n" +
+		"data: fragments \n" +
+		"data: fragments <pre>x</pre>\n" +
+		"data: fragments </div>\n\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	// Defaults are left to the client; anything else is sent.
+	data = encodeEvent(mergeFragments("<p>x</p>", fragmentOptions{Selector: "#content-area", MergeMode: mergeMorph, SettleDuration: defaultSettleDuration}))
+	if strings.Contains(string(data), "mergeMode") || strings.Contains(string(data), "settleDuration") {
+		t.Errorf("expected default options left out, got %q", data)
+	}
+	data = encodeEvent(mergeFragments("<li>x</li>", fragmentOptions{
+		Selector:          "#list",
+		MergeMode:         mergeAppend,
+		SettleDuration:    time.Second,
+		UseViewTransition: true,
+		ID:                "42",
+	}))
+	want = "event: datastar-merge-fragments\nid: 42\n" +
+		"data: selector #list\ndata: settleDuration 1000\ndata: useViewTransition true\n" +
+		"data: mergeMode append\ndata: fragments <li>x</li>\n\n"
+	if string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+
+	data = encodeEvent(removeFragments("#toast", fragmentOptions{}))
+	if want := "event: datastar-remove-fragments\ndata: selector #toast\n\n"; string(data) != want {
+		t.Errorf("expected %q, got %q", want, data)
+	}
+}
+
+func TestSSEWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	sw := newSSEWriter(rec)
+	if err := sw.send(sseEvent{Event: "ping", Data: []string{"{}"}}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	sw.comment("keep-alive")
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("expected an event stream, got %q", got)
+	}
+	if !rec.Flushed {
+		t.Error("expected the event flushed")
+	}
+	if want := "event: ping\ndata: {}\n\n: keep-alive\n\n"; rec.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, rec.Body.String())
+	}
+}
+
+// newBenchServer returns a server with the real templates and a store of
+// n hosts, for timing the host list stream.
+func newBenchServer(b *testing.B, n int) *Server {
+	b.Helper()
+	store, err := hosts.NewStore(filepath.Join(b.TempDir(), "hosts.db"))
+	if err != nil {
+		b.Fatalf("NewStore: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	list := make([]types.Host, n)
+	for i := range list {
+		ip := fmt.Sprintf("10.%d.%d.%d", i/65536, i/256%256, i%256)
+		list[i] = types.Host{ID: fmt.Sprintf("host-%05d", i), Nickname: fmt.Sprintf("Screen %d", i), IPAddress: ip,
+			Status: types.StatusHealthy, NSMStatus: "NSM Online", NSMVersion: types.Version, CMSStatus: types.CMSOnline,
+			AssetCount: 12, DashboardURL: "http://" + ip + ":8080", LastChecked: time.Now()}
+	}
+	if err := store.ReplaceAll(list); err != nil {
+		b.Fatalf("ReplaceAll: %v", err)
+	}
+
+	s := &Server{store: store, anthias: new(anthias.Client), logger: logger.New(10),
+		sseBroker: newSSEBroker(), editLocks: make(map[string]string)}
+	tmpl, err := s.parseTemplates("*.html")
+	if err != nil {
+		b.Fatalf("parseTemplates: %v", err)
+	}
+	s.templates.Store(tmpl)
+	return s
+}
+
+// listen registers n SSE clients that read as fast as they can.
+func listen(b *testing.B, broker *sseBroker, n int) {
+	for range n {
+		client := make(chan []byte, 10)
+		broker.register(client)
+		go func() {
+			for range client {
+			}
+		}()
+		b.Cleanup(func() { broker.unregister(client) })
+	}
+}
+
+// BenchmarkHostListUpdate times what every host list change costs:
+// rendering the table and sending it to the connected dashboards.
+func BenchmarkHostListUpdate(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			s := newBenchServer(b, n)
+			listen(b, s.sseBroker, 10)
+			var size int
+			for b.Loop() {
+				data := s.renderHostListFragment()
+				size = len(data)
+				s.sseBroker.broadcast(data)
+			}
+			b.ReportMetric(float64(size), "bytes/event")
+		})
+	}
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	data := encodeEvent(mergeFragments(strings.Repeat("<tr><td>Screen</td></tr>\n", 1000), fragmentOptions{}))
+	for _, clients := range []int{1, 10, 100} {
+		b.Run(strconv.Itoa(clients), func(b *testing.B) {
+			broker := newSSEBroker()
+			listen(b, broker, clients)
+			for b.Loop() {
+				broker.broadcast(data)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@
 
 const HOST_TABLE_COLUMN_COUNT = 8;
 const ipv4Pattern = /^(25[0-5]|2[0-4]\d|1?\d?\d)(\.(25[0-5]|2[0-4]\d|1?\d?\d)){3}$/;
+// DNS names such as venue-display-03.lan; mirrors hosts.ValidAddress.
+const hostnamePattern = /^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*\.?$/i;
 
 // Generate unique editor ID for this browser session
 let EDITOR_ID = sessionStorage.getItem('nsm_editor_id');
@@ -10,6 +12,26 @@ if (!EDITOR_ID) {
   sessionStorage.setItem('nsm_editor_id', EDITOR_ID);
 }
 
+// Attach the session's CSRF token to every state-changing request to this
+// node. Datastar actions go through window.fetch too, so they are covered.
+(function () {
+  const nativeFetch = window.fetch.bind(window);
+  window.fetch = function (input, init) {
+    init = init || {};
+    const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+    const url = new URL(input instanceof Request ? input.url : input, location.href);
+    if (method !== 'GET' && method !== 'HEAD' && url.origin === location.origin) {
+      const match = document.cookie.match(/(?:^|;\s*)nsm_csrf=([^;]+)/);
+      if (match) {
+        const headers = new Headers(init.headers || (input instanceof Request ? input.headers : undefined));
+        headers.set('X-CSRF-Token', decodeURIComponent(match[1]));
+        init = Object.assign({}, init, { headers: headers });
+      }
+    }
+    return nativeFetch(input, init);
+  };
+})();
+
 function validateIPv4(value) {
   if (!value) {
     return false;
@@ -17,6 +39,18 @@ function validateIPv4(value) {
   return ipv4Pattern.test(value);
 }
 
+// validateAddress accepts an IPv4 address or a DNS name. All-numeric dotted
+// values must be valid IPv4, so a mistyped IP is not taken for a name.
+function validateAddress(value) {
+  if (!value) {
+    return false;
+  }
+  if (/^[\d.]+$/.test(value)) {
+    return validateIPv4(value);
+  }
+  return value.length <= 253 && hostnamePattern.test(value);
+}
+
 window.toggleSelectAll = function (cb) {
   document.querySelectorAll('.row-select').forEach(el => el.checked = cb.checked);
 }
@@ -207,13 +241,13 @@ window.saveEdit = function (button) {
   const newVPN = vpnInput ? vpnInput.value.trim() : '';
   const notes = notesInput ? notesInput.value.trim() : '';
 
-  if (!validateIPv4(newIP)) {
-    alert('Please enter a valid LAN IPv4 address.');
+  if (!validateAddress(newIP)) {
+    alert('Please enter a valid LAN IPv4 address or DNS name.');
     return;
   }
 
-  if (newVPN && !validateIPv4(newVPN)) {
-    alert('VPN IP address must be a valid IPv4 format.');
+  if (newVPN && !validateAddress(newVPN)) {
+    alert('VPN address must be a valid IPv4 address or DNS name.');
     return;
   }
 
@@ -263,13 +297,13 @@ window.addHost = function (event) {
   const vpnIP = vpnInput.value.trim();
   const notes = notesInput.value.trim();
 
-  if (!validateIPv4(lanIP)) {
-    alert('Please enter a valid LAN IPv4 address.');
+  if (!validateAddress(lanIP)) {
+    alert('Please enter a valid LAN IPv4 address or DNS name.');
     return;
   }
 
-  if (vpnIP && !validateIPv4(vpnIP)) {
-    alert('VPN IP address must be a valid IPv4 format.');
+  if (vpnIP && !validateAddress(vpnIP)) {
+    alert('VPN address must be a valid IPv4 address or DNS name.');
     return;
   }
 
@@ -405,14 +439,18 @@ window.toggleInfo = function (button, ip) {
 };
 
 // Advanced View Functions
-function downloadHostList() {
-  fetch('/api/hosts/export/download')
-    .then(resp => resp.blob())
+function downloadHostList(format) {
+  format = format || 'json';
+  fetch('/api/hosts/export/download?format=' + encodeURIComponent(format))
+    .then(resp => {
+      if (!resp.ok) throw new Error('Download failed');
+      return resp.blob();
+    })
     .then(blob => {
       const url = window.URL.createObjectURL(blob);
       const a = document.createElement('a');
       a.href = url;
-      a.download = 'nsm-hosts-' + new Date().toISOString().split('T')[0] + '.json';
+      a.download = 'nsm-hosts-' + new Date().toISOString().split('T')[0] + '.' + format;
       document.body.appendChild(a);
       a.click();
       document.body.removeChild(a);
@@ -423,34 +461,56 @@ function downloadHostList() {
     });
 }
 
+// heldForApproval tells the user when the two-person rule held a request
+// (202) rather than running it, and reports whether it did.
+function heldForApproval(resp) {
+  if (resp.status !== 202) return false;
+  resp.json().then(a => alert(`Waiting for another user to approve this request.\n\nIt expires at ${new Date(a.expires_at).toLocaleTimeString()}.`));
+  return true;
+}
+
 function uploadHostList(input) {
   const file = input.files[0];
   if (!file) return;
 
+  // Infer the format from the file extension; the server parses the raw text.
+  const ext = file.name.split('.').pop().toLowerCase();
+  const format = (ext === 'yaml' || ext === 'yml') ? 'yaml' : (ext === 'csv' ? 'csv' : 'json');
+
   const reader = new FileReader();
   reader.onload = function (e) {
-    try {
-      const hosts = JSON.parse(e.target.result);
-      fetch('/api/hosts/import/upload', {
-        method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(hosts)
+    fetch('/api/hosts/import/upload?format=' + format, {
+      method: 'POST',
+      body: e.target.result
+    })
+      .then(resp => {
+        if (!resp.ok) {
+          return resp.json().then(
+            data => { throw new Error(data.error || 'Upload failed'); },
+            () => { throw new Error('Upload failed'); });
+        }
+        input.value = ''; // Clear the file input
+        if (heldForApproval(resp)) return;
+        alert('Host list imported successfully!');
       })
-        .then(resp => {
-          if (!resp.ok) throw new Error('Upload failed');
-          alert('Host list imported successfully!');
-          input.value = ''; // Clear the file input
-        })
-        .catch(err => {
-          alert('Failed to import host list: ' + err.message);
-        });
-    } catch (err) {
-      alert('Invalid JSON file: ' + err.message);
-    }
+      .catch(err => {
+        alert('Failed to import host list: ' + err.message);
+      });
   };
   reader.readAsText(file);
 }
 
+// formatBandwidth summarises NSM-initiated traffic by operation, e.g.
+// "cache 1.2 Mbit/s of 8 Mbit/s · sync 0 kbit/s · total 1.2 Mbit/s"
+function formatBandwidth(usage) {
+  const rate = (kbps) => kbps >= 1000 ? (kbps / 1000).toFixed(1) + ' Mbit/s' : Math.round(kbps) + ' kbit/s';
+  return usage.map(u => {
+    let text = u.op + ' ' + rate(u.bytes_per_sec * 8 / 1000);
+    if (u.limit_kbps) text += ' of ' + rate(u.limit_kbps);
+    return text;
+  }).join(' · ');
+}
+
 // WebSocket connection for diagnostics (Advanced View)
 function initDiagnosticsWebSocket() {
   const wsIndicator = document.getElementById('diag-ws');
@@ -458,6 +518,7 @@ function initDiagnosticsWebSocket() {
   const idEl = document.getElementById('diag-nodeid');
   const hostsEl = document.getElementById('diag-hosts');
   const backupEl = document.getElementById('diag-backup');
+  const bandwidthEl = document.getElementById('diag-bandwidth');
   const consoleEl = document.getElementById('console-logs');
 
   // Only initialize if elements exist (we're on advanced page)
@@ -498,6 +559,7 @@ function initDiagnosticsWebSocket() {
         if (msg.time) tEl.textContent = msg.time;
         if (msg.node_id) idEl.textContent = msg.node_id;
         if (typeof msg.hosts_count === 'number') hostsEl.textContent = msg.hosts_count;
+        if (Array.isArray(msg.bandwidth) && bandwidthEl) bandwidthEl.textContent = formatBandwidth(msg.bandwidth);
 
         if (msg.last_backup) {
           const currentBackup = backupEl.textContent;
@@ -547,7 +609,7 @@ function initDiagnosticsWebSocket() {
               msg.level === 'warning' ? 'text-yellow-400' : 'text-desert-cyan';
             const logDiv = document.createElement('div');
             logDiv.className = levelClass;
-            logDiv.textContent = `[${ts}] ${msg.text}`;
+            logDiv.textContent = `[${ts}] ${msg.text}` + (msg.request_id ? ` [request ${msg.request_id}]` : '');
             consoleEl.appendChild(logDiv);
 
             // Keep only last 200 messages
@@ -597,8 +659,10 @@ function loadBackupHistory() {
 
       let html = '';
       backups.forEach(backup => {
-        html += `<div class="text-desert-cyan hover:text-desert-yellow cursor-pointer" onclick="restoreBackup('${backup.filename}')">`;
-        html += `[${backup.timestamp}] ${backup.filename} (${formatBytes(backup.size)})`;
+        const file = encodeURIComponent(backup.filename).replace(/'/g, '%27');
+        const count = backup.host_count === undefined ? '' : `, ${backup.host_count} hosts`;
+        html += `<div class="text-desert-cyan hover:text-desert-yellow cursor-pointer" onclick="previewBackup('${file}')">`;
+        html += `[${new Date(backup.timestamp).toLocaleString()}] ${escapeHTML(backup.filename)} (${formatBytes(backup.size)}${count})`;
         html += `</div>`;
       });
       backupList.innerHTML = html;
@@ -609,29 +673,451 @@ function loadBackupHistory() {
     });
 }
 
+// Show the hosts in a backup, with the option to restore it
+function previewBackup(file) {
+  const preview = document.getElementById('backup-preview');
+  if (!preview) return;
+
+  fetch(`/api/backups/preview?file=${file}`)
+    .then(resp => resp.ok ? resp.json() : resp.json().then(e => { throw new Error(e.error || resp.statusText); }))
+    .then(backup => {
+      let html = `<div class="flex justify-between items-center gap-2 mb-2">`;
+      html += `<span class="text-desert-yellow">${escapeHTML(backup.filename)}: ${backup.host_count} hosts, saved ${new Date(backup.timestamp).toLocaleString()}</span>`;
+      html += `<span class="whitespace-nowrap">`;
+      html += `<a class="text-desert-orange hover:text-desert-yellow cursor-pointer" onclick="restoreBackup('${file}')">restore</a> `;
+      html += `<a class="text-desert-tan hover:text-desert-yellow cursor-pointer" onclick="document.getElementById('backup-preview').classList.add('hidden')">close</a>`;
+      html += `</span></div>`;
+      backup.hosts.forEach(h => {
+        const checked = h.last_checked ? new Date(h.last_checked).toLocaleString() : 'never checked';
+        html += `<div>${escapeHTML(h.nickname || h.hostname || h.ip_address)} (${escapeHTML(h.ip_address)}) ${escapeHTML(h.status || '')}, ${checked}</div>`;
+      });
+      preview.innerHTML = html;
+      preview.classList.remove('hidden');
+    })
+    .catch(err => {
+      alert('Failed to open backup: ' + err.message);
+    });
+}
+
 // Restore from a specific backup
-function restoreBackup(filename) {
+function restoreBackup(file) {
+  const filename = decodeURIComponent(file);
   if (!confirm(`Restore from backup: ${filename}?\n\nThis will replace your current host list.`)) {
     return;
   }
 
-  fetch(`/api/backups/restore?file=${encodeURIComponent(filename)}`, {
+  fetch(`/api/backups/restore?file=${file}`, {
     method: 'POST'
   })
     .then(resp => {
       if (!resp.ok) throw new Error('Restore failed');
+      if (heldForApproval(resp)) return;
+      alert(`Successfully restored ${filename}`);
+      // Reload the page to show updated host list
+      window.location.reload();
+    })
+    .catch(err => {
+      alert('Failed to restore backup: ' + err.message);
+    });
+}
+
+// Load named configuration snapshots
+function loadSnapshots() {
+  const snapshotList = document.getElementById('snapshot-list');
+  if (!snapshotList) return;
+
+  fetch('/api/snapshots')
+    .then(resp => resp.json())
+    .then(snapshots => {
+      if (!snapshots || snapshots.length === 0) {
+        snapshotList.innerHTML = '<div class="text-desert-gray italic">No snapshots saved</div>';
+        return;
+      }
+
+      let html = '';
+      snapshots.forEach(snap => {
+        const name = encodeURIComponent(snap.name).replace(/'/g, '%27');
+        html += `<div class="flex justify-between items-center gap-2">`;
+        html += `<span class="text-desert-cyan" title="${escapeHTML(snap.description || '')}">${escapeHTML(snap.name)} (${snap.host_count} hosts, ${new Date(snap.created_at).toLocaleString()})</span>`;
+        html += `<span class="whitespace-nowrap">`;
+        html += `<a class="text-desert-tan hover:text-desert-yellow cursor-pointer" onclick="diffSnapshot('${name}')">diff</a> `;
+        html += `<a class="text-desert-orange hover:text-desert-yellow cursor-pointer" onclick="restoreSnapshot('${name}')">restore</a> `;
+        html += `<a class="text-red-400 hover:text-desert-yellow cursor-pointer" onclick="deleteSnapshot('${name}')">delete</a>`;
+        html += `</span></div>`;
+      });
+      snapshotList.innerHTML = html;
+    })
+    .catch(err => {
+      snapshotList.innerHTML = '<div class="text-red-400">Failed to load snapshots</div>';
+      console.error('Error loading snapshots:', err);
+    });
+}
+
+function saveSnapshot() {
+  const input = document.getElementById('snapshot-name');
+  const name = input ? input.value.trim() : '';
+  if (!name) {
+    alert('Enter a snapshot name first.');
+    return;
+  }
+
+  fetch('/api/snapshots', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({ name: name })
+  })
+    .then(resp => {
+      if (!resp.ok) throw new Error('Save failed');
+      input.value = '';
+      loadSnapshots();
+    })
+    .catch(err => {
+      alert('Failed to save snapshot: ' + err.message);
+    });
+}
+
+function diffSnapshot(name) {
+  fetch(`/api/snapshots/diff?name=${name}`)
+    .then(resp => {
+      if (!resp.ok) throw new Error('Diff failed');
+      return resp.json();
+    })
+    .then(diff => {
+      const lines = [];
+      diff.added.forEach(h => lines.push(`+ ${h.nickname || h.ip_address} (${h.ip_address})`));
+      diff.removed.forEach(h => lines.push(`- ${h.nickname || h.ip_address} (${h.ip_address})`));
+      diff.changed.forEach(c => {
+        c.fields.forEach(f => lines.push(`~ ${c.ip_address} ${f.field}: "${f.snapshot}" → "${f.current}"`));
+      });
+      alert(lines.length === 0
+        ? `Current configuration matches snapshot "${diff.snapshot}".`
+        : `Changes since snapshot "${diff.snapshot}":\n\n` + lines.join('\n'));
+    })
+    .catch(err => {
+      alert('Failed to diff snapshot: ' + err.message);
+    });
+}
+
+function restoreSnapshot(name) {
+  if (!confirm(`Restore snapshot: ${decodeURIComponent(name)}?\n\nThis will replace your current host list.`)) {
+    return;
+  }
+
+  fetch(`/api/snapshots/restore?name=${name}`, { method: 'POST' })
+    .then(resp => {
+      if (!resp.ok) throw new Error('Restore failed');
+      if (heldForApproval(resp)) return null;
       return resp.json();
     })
     .then(data => {
-      alert(`Successfully restored ${data.count} hosts from ${data.source}`);
-      // Reload the page to show updated host list
+      if (!data) return;
+      alert(`Restored ${data.host_count} hosts from snapshot ${data.snapshot}`);
       window.location.reload();
     })
     .catch(err => {
-      alert('Failed to restore backup: ' + err.message);
+      alert('Failed to restore snapshot: ' + err.message);
+    });
+}
+
+function deleteSnapshot(name) {
+  if (!confirm(`Delete snapshot: ${decodeURIComponent(name)}?`)) {
+    return;
+  }
+
+  fetch(`/api/snapshots/delete?name=${name}`, { method: 'POST' })
+    .then(resp => {
+      if (!resp.ok) throw new Error('Delete failed');
+      loadSnapshots();
+    })
+    .catch(err => {
+      alert('Failed to delete snapshot: ' + err.message);
+    });
+}
+
+function sendReportNow() {
+  fetch('/api/reports/send', { method: 'POST' })
+    .then(resp => resp.json().then(data => {
+      if (!resp.ok) throw new Error(data.error || 'Send failed');
+      alert(`Report sent to ${data.recipients} recipient(s)`);
+    }))
+    .catch(err => {
+      alert('Failed to send report: ' + err.message);
+    });
+}
+
+function loadAPIKeys() {
+  const keyList = document.getElementById('api-key-list');
+  if (!keyList) return;
+
+  fetch('/api/keys')
+    .then(resp => {
+      if (resp.status === 401 || resp.status === 403) throw new Error('Admin access required');
+      return resp.json();
+    })
+    .then(keys => {
+      if (!keys || keys.length === 0) {
+        keyList.innerHTML = '<div class="text-desert-gray italic">No API keys</div>';
+        return;
+      }
+
+      let html = '';
+      keys.forEach(key => {
+        const expired = key.expires_at && new Date(key.expires_at) < new Date();
+        const state = key.revoked ? 'revoked' : (expired ? 'expired' : '');
+        const lastUsed = key.last_used_at ? `used ${new Date(key.last_used_at).toLocaleString()} from ${escapeHTML(key.last_used_ip || '?')}` : 'never used';
+        const expires = key.expires_at ? `expires ${new Date(key.expires_at).toLocaleDateString()}` : 'no expiry';
+        html += `<div class="flex justify-between items-center gap-2 ${state ? 'opacity-50' : ''}">`;
+        html += `<span><span class="text-desert-cyan">${escapeHTML(key.name)}</span> <span class="text-desert-gray">${escapeHTML(key.prefix)}… ${key.role}, ${expires}, ${lastUsed}</span></span>`;
+        if (state) {
+          html += `<span class="text-desert-gray">${state}</span>`;
+        } else {
+          html += `<a class="text-red-400 hover:text-desert-yellow cursor-pointer" onclick="revokeAPIKey('${key.id}')">revoke</a>`;
+        }
+        html += `</div>`;
+      });
+      keyList.innerHTML = html;
+    })
+    .catch(err => {
+      keyList.innerHTML = `<div class="text-desert-gray italic">${escapeHTML(err.message)}</div>`;
+    });
+}
+
+function createAPIKey() {
+  const input = document.getElementById('api-key-name');
+  const name = input ? input.value.trim() : '';
+  if (!name) {
+    alert('Enter a key name first.');
+    return;
+  }
+
+  fetch('/api/keys', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify({
+      name: name,
+      role: document.getElementById('api-key-role').value,
+      expires_in_days: parseInt(document.getElementById('api-key-expiry').value, 10)
+    })
+  })
+    .then(resp => resp.json().then(data => {
+      if (!resp.ok) throw new Error(data.error || 'Create failed');
+      input.value = '';
+      prompt('Copy the API key now; it will not be shown again:', data.key);
+      loadAPIKeys();
+      loadAuditLog();
+    }))
+    .catch(err => {
+      alert('Failed to create API key: ' + err.message);
+    });
+}
+
+function revokeAPIKey(id) {
+  if (!confirm('Revoke this API key? Integrations using it will stop working.')) return;
+
+  fetch(`/api/keys/revoke?id=${encodeURIComponent(id)}`, { method: 'POST' })
+    .then(resp => {
+      if (!resp.ok) throw new Error('Revoke failed');
+      loadAPIKeys();
+      loadAuditLog();
+    })
+    .catch(err => {
+      alert('Failed to revoke API key: ' + err.message);
+    });
+}
+
+const SYNC_STATE_CLASSES = {
+  in_sync: 'text-green-400',
+  pending: 'text-desert-yellow',
+  diverged: 'text-red-400',
+  unknown: 'text-desert-gray',
+};
+
+function loadSyncStatus() {
+  const list = document.getElementById('sync-status');
+  if (!list) return;
+
+  fetch('/api/fleet/sync-status')
+    .then(resp => resp.json())
+    .then(status => {
+      if (!status.peers || status.peers.length === 0) {
+        list.innerHTML = '<div class="text-desert-gray italic">No peers</div>';
+        return;
+      }
+      let html = '';
+      if (status.isolated || status.offline_edits > 0) {
+        const note = status.isolated ? 'No peer reachable' : 'Replaying offline edits';
+        html += `<div class="text-yellow-400">${note}: ${status.offline_edits} hosts edited offline</div>`;
+      }
+      status.peers.forEach(peer => {
+        const details = [];
+        if (peer.divergence) details.push(peer.divergence);
+        if (peer.pending) details.push(`${peer.pending} queued`);
+        details.push(peer.bus ? 'connected over the peer bus' : 'posted over HTTP');
+        details.push('pushed ' + (peer.last_push_at ? new Date(peer.last_push_at).toLocaleString() : 'never'));
+        if (peer.last_push_error) details.push('last error: ' + peer.last_push_error);
+        html += `<div class="flex justify-between gap-2" title="${escapeHTML(details.join('; '))}">`;
+        html += `<span class="text-desert-cyan">${escapeHTML(peer.name || peer.address)}</span>`;
+        html += `<span class="${SYNC_STATE_CLASSES[peer.state] || ''}">${escapeHTML(peer.state.replace('_', ' '))}</span>`;
+        html += `</div>`;
+      });
+      list.innerHTML = html;
+    })
+    .catch(err => {
+      list.innerHTML = '<div class="text-red-400">Failed to load sync status</div>';
+      console.error('Error loading sync status:', err);
+    });
+}
+
+function forceSync() {
+  fetch('/api/fleet/sync', { method: 'POST' })
+    .then(resp => resp.json().then(data => {
+      if (!resp.ok) throw new Error(data.error || 'Sync failed');
+      const failed = (data.results || []).filter(r => !r.ok);
+      if (failed.length > 0) {
+        alert('Sync failed for: ' + failed.map(r => `${r.address} (${r.error})`).join(', '));
+      }
+      loadSyncStatus();
+    }))
+    .catch(err => {
+      alert('Failed to sync peers: ' + err.message);
     });
 }
 
+function loadTriggers() {
+  const triggerList = document.getElementById('trigger-list');
+  if (!triggerList) return;
+
+  fetch('/api/snapshots')
+    .then(resp => resp.ok ? resp.json() : [])
+    .then(snapshots => {
+      const select = document.getElementById('trigger-preset');
+      select.innerHTML = (snapshots || []).map(snap =>
+        `<option value="${escapeHTML(snap.name)}">${escapeHTML(snap.name)}</option>`).join('');
+      updateTriggerForm();
+    });
+
+  fetch('/api/settings/triggers')
+    .then(resp => {
+      if (resp.status === 401 || resp.status === 403) throw new Error('Admin access required');
+      return resp.json();
+    })
+    .then(triggers => {
+      if (!triggers || triggers.length === 0) {
+        triggerList.innerHTML = '<div class="text-desert-gray italic">No triggers</div>';
+        return;
+      }
+
+      let html = '';
+      triggers.forEach(t => {
+        const name = encodeURIComponent(t.name).replace(/'/g, '%27');
+        let action = t.action.replace('_', ' ');
+        if (t.action === 'restore_preset') action += ' ' + escapeHTML(t.preset);
+        if (t.action === 'display_power') action = 'displays ' + t.power;
+        if (t.hosts && t.hosts.length) action += ` (${t.hosts.length} hosts)`;
+        const fired = t.last_fired_at ? `fired ${new Date(t.last_fired_at).toLocaleString()}: ${escapeHTML(t.last_result || '')}` : 'never fired';
+        html += `<div class="flex justify-between items-center gap-2">`;
+        html += `<span><span class="text-desert-cyan">${escapeHTML(t.name)}</span> <span class="text-desert-gray">${action}, ${escapeHTML(t.token_prefix)}…, ${fired}</span></span>`;
+        html += `<a class="text-red-400 hover:text-desert-yellow cursor-pointer" onclick="deleteTrigger('${name}')">delete</a>`;
+        html += `</div>`;
+      });
+      triggerList.innerHTML = html;
+    })
+    .catch(err => {
+      triggerList.innerHTML = `<div class="text-desert-gray italic">${escapeHTML(err.message)}</div>`;
+    });
+}
+
+// Show the preset picker only for actions that use it
+function updateTriggerForm() {
+  const action = document.getElementById('trigger-action').value;
+  document.getElementById('trigger-preset').classList.toggle('hidden', action !== 'restore_preset');
+}
+
+function saveTrigger() {
+  const input = document.getElementById('trigger-name');
+  const name = input ? input.value.trim() : '';
+  if (!name) {
+    alert('Enter a trigger name first.');
+    return;
+  }
+
+  const trigger = { name: name, action: document.getElementById('trigger-action').value };
+  if (trigger.action === 'restore_preset') {
+    trigger.preset = document.getElementById('trigger-preset').value;
+  } else if (trigger.action.startsWith('display_')) {
+    trigger.power = trigger.action.slice('display_'.length);
+    trigger.action = 'display_power';
+  }
+
+  fetch('/api/settings/triggers', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(trigger)
+  })
+    .then(resp => resp.json().then(data => {
+      if (!resp.ok) throw new Error(data.error || 'Save failed');
+      input.value = '';
+      if (data.token) {
+        prompt('Copy the trigger URL now; its token will not be shown again:', `${data.url}?token=${data.token}`);
+      }
+      loadTriggers();
+    }))
+    .catch(err => {
+      alert('Failed to save trigger: ' + err.message);
+    });
+}
+
+function deleteTrigger(name) {
+  if (!confirm(`Delete trigger "${decodeURIComponent(name)}"? Services calling its URL will get errors.`)) return;
+
+  fetch(`/api/settings/triggers/delete?name=${name}`, { method: 'POST' })
+    .then(resp => {
+      if (!resp.ok) throw new Error('Delete failed');
+      loadTriggers();
+    })
+    .catch(err => {
+      alert('Failed to delete trigger: ' + err.message);
+    });
+}
+
+function loadAuditLog() {
+  const auditLog = document.getElementById('audit-log');
+  if (!auditLog) return;
+
+  fetch('/api/audit?limit=50')
+    .then(resp => {
+      if (resp.status === 401 || resp.status === 403) throw new Error('Admin access required');
+      return resp.json();
+    })
+    .then(entries => {
+      if (!entries || entries.length === 0) {
+        auditLog.innerHTML = '<div class="text-desert-gray italic">No audit entries</div>';
+        return;
+      }
+
+      let html = '';
+      entries.forEach(e => {
+        const actorClass = e.actor_type === 'api_key' ? 'text-desert-orange' : 'text-desert-cyan';
+        html += `<div><span class="text-desert-gray">${new Date(e.time).toLocaleString()}</span> `;
+        html += `<span class="${actorClass}">${escapeHTML(e.actor)}</span> ${escapeHTML(e.action)}`;
+        if (e.target) html += ` <span class="text-desert-tan">${escapeHTML(e.target)}</span>`;
+        if (e.detail) html += ` <span class="text-desert-gray">(${escapeHTML(e.detail)})</span>`;
+        html += `</div>`;
+      });
+      auditLog.innerHTML = html;
+    })
+    .catch(err => {
+      auditLog.innerHTML = `<div class="text-desert-gray italic">${escapeHTML(err.message)}</div>`;
+    });
+}
+
+// Escape user-provided text before inserting it into HTML
+function escapeHTML(text) {
+  const div = document.createElement('div');
+  div.textContent = text;
+  return div.innerHTML.replace(/"/g, '&quot;');
+}
+
 // Format bytes to human-readable format
 function formatBytes(bytes) {
   if (bytes < 1024) return bytes + ' B';
@@ -639,10 +1125,389 @@ function formatBytes(bytes) {
   return (bytes / (1024 * 1024)).toFixed(1) + ' MB';
 }
 
+// Show the signed-in user and apply their preferred start view
+function initUserMenu() {
+  fetch('/api/auth/status')
+    .then(resp => resp.json())
+    .then(status => {
+      if (!status.auth_enabled || !status.user) return;
+      const menu = document.getElementById('user-menu');
+      document.getElementById('user-name').textContent = `${status.user.username} (${status.user.role})`;
+      menu.classList.remove('hidden');
+
+      tablePrefs = (status.user.prefs && status.user.prefs.table) || {};
+      applyTablePrefs();
+
+      const view = status.user.prefs && status.user.prefs.default_view;
+      if (view && view !== 'home') {
+        const link = document.querySelector(`nav a[data-on-click="@get('/views/${view}')"]`);
+        if (link) link.click();
+      }
+    })
+    .catch(err => console.error('Failed to load auth status:', err));
+}
+
+// Host table preferences of the signed-in user: shown columns, density and
+// how often the host list refreshes. They are kept on the server, so a wall
+// monitor signed in as its own user keeps its layout.
+let tablePrefs = null;
+
+function applyTablePrefs() {
+  const toggle = document.getElementById('table-prefs-toggle');
+  if (!tablePrefs || !toggle) return;
+  toggle.classList.remove('hidden');
+
+  const columns = tablePrefs.columns || [];
+  document.querySelectorAll('input[name="table-col"]').forEach(cb => {
+    cb.checked = columns.length === 0 || columns.includes(cb.value);
+  });
+  document.getElementById('table-density').value = tablePrefs.density === 'comfortable' ? '' : (tablePrefs.density || '');
+  document.getElementById('table-refresh').value = String(tablePrefs.refresh_seconds || 0);
+
+  // One style element survives host list re-renders.
+  let style = document.getElementById('table-prefs-style');
+  if (!style) {
+    style = document.createElement('style');
+    style.id = 'table-prefs-style';
+    document.head.appendChild(style);
+  }
+  let css = '';
+  document.querySelectorAll('input[name="table-col"]').forEach(cb => {
+    if (!cb.checked) css += `#host-list-container [data-col="${cb.value}"] { display: none; }\n`;
+  });
+  if (tablePrefs.density === 'compact') {
+    css += '#host-list-container td, #host-list-container th { padding: 0 0.25rem; font-size: 0.75rem; line-height: 1rem; }\n';
+  } else if (tablePrefs.density === 'large') {
+    css += '#host-list-container td, #host-list-container th { padding: 0.5rem; font-size: 1.25rem; line-height: 1.75rem; }\n';
+  }
+  style.textContent = css;
+}
+
+function saveTablePrefs() {
+  const checked = Array.from(document.querySelectorAll('input[name="table-col"]:checked')).map(cb => cb.value);
+  const all = document.querySelectorAll('input[name="table-col"]').length;
+  const next = {
+    columns: checked.length === all ? [] : checked,
+    density: document.getElementById('table-density').value,
+    refresh_seconds: parseInt(document.getElementById('table-refresh').value, 10) || 0,
+  };
+  const refreshChanged = next.refresh_seconds !== (tablePrefs.refresh_seconds || 0);
+  fetch('/api/auth/me/table', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(next)
+  })
+    .then(resp => resp.ok ? resp.json() : resp.json().then(e => Promise.reject(new Error(e.error))))
+    .then(saved => {
+      tablePrefs = saved;
+      applyTablePrefs();
+      // The host list stream picks up the refresh interval when it connects.
+      if (refreshChanged) {
+        const home = document.querySelector(`nav a[data-on-click="@get('/views/home')"]`);
+        if (home) home.click();
+      }
+    })
+    .catch(err => alert('Failed to save table preferences: ' + err.message));
+}
+
+function signOut() {
+  fetch('/api/auth/logout', { method: 'POST' })
+    .finally(() => { window.location.href = '/login'; });
+}
+
+// Saved views. The host list is rendered once for every dashboard, so a
+// view is applied here: the server says which hosts it selects and in what
+// order, and the other rows are hidden. It is applied again whenever the
+// list is re-rendered.
+let savedViews = [];
+let viewTimer = null;
+let viewObserver = null;
+
+function initViewBar() {
+  waitFor(() => document.getElementById('view-bar'), () => {
+    loadViews();
+    applyTablePrefs();
+    const container = document.getElementById('host-list-container');
+    if (viewObserver) viewObserver.disconnect();
+    viewObserver = new MutationObserver(() => applyView());
+    viewObserver.observe(container, { childList: true, subtree: true });
+  });
+}
+
+function loadViews(selected) {
+  fetch('/api/views')
+    .then(resp => resp.ok ? resp.json() : [])
+    .then(views => {
+      savedViews = views || [];
+      const select = document.getElementById('view-select');
+      if (!select) return;
+      let html = '<option value="">All hosts</option>';
+      savedViews.forEach(v => {
+        html += `<option value="${escapeHTML(v.name)}">${escapeHTML(v.name)}</option>`;
+      });
+      select.innerHTML = html;
+      select.value = selected || '';
+      showViewButtons();
+    })
+    .catch(err => console.error('Failed to load views:', err));
+}
+
+function showViewButtons() {
+  const saved = document.getElementById('view-select').value !== '';
+  document.getElementById('view-delete').classList.toggle('hidden', !saved);
+  document.getElementById('view-check').classList.toggle('hidden', !saved);
+}
+
+// The view described by the bar's fields.
+function currentView() {
+  const list = id => document.getElementById(id).value.split(',').map(s => s.trim()).filter(s => s);
+  return {
+    name: document.getElementById('view-select').value,
+    filter: {
+      query: document.getElementById('view-query').value.trim(),
+      health: list('view-health'),
+      subnets: list('view-subnet'),
+    },
+    sort: document.getElementById('view-sort').value,
+    desc: document.getElementById('view-desc').checked,
+  };
+}
+
+function selectView(name) {
+  const v = savedViews.find(v => v.name === name) || { filter: {} };
+  document.getElementById('view-query').value = v.filter.query || '';
+  document.getElementById('view-health').value = (v.filter.health || []).join(',');
+  document.getElementById('view-subnet').value = (v.filter.subnets || []).join(', ');
+  document.getElementById('view-sort').value = v.sort || 'name';
+  document.getElementById('view-desc').checked = !!v.desc;
+  showViewButtons();
+  applyView();
+}
+
+function applyView() {
+  clearTimeout(viewTimer);
+  viewTimer = setTimeout(() => {
+    const v = currentView();
+    if (!v.filter.query && !v.filter.health.length && !v.filter.subnets.length && v.sort === 'name' && !v.desc) {
+      // Nothing to apply: keep the list as rendered.
+      document.querySelectorAll('#host_table_body tr[data-host-id].hidden').forEach(tr => tr.classList.remove('hidden'));
+      document.getElementById('view-count').textContent = '';
+      return;
+    }
+    const params = new URLSearchParams({
+      query: v.filter.query,
+      health: v.filter.health.join(','),
+      subnet: v.filter.subnets.join(','),
+      sort: v.sort,
+      desc: v.desc,
+    });
+    fetch('/api/views/hosts?' + params)
+      .then(resp => resp.ok ? resp.json() : Promise.reject(resp))
+      .then(showHosts)
+      .catch(() => { });
+  }, 200);
+}
+
+// Show the rows of hosts, in that order, and hide the rest.
+function showHosts(hosts) {
+  const tbody = document.getElementById('host_table_body');
+  if (!tbody) return;
+  if (viewObserver) viewObserver.disconnect();
+
+  const rows = new Map();
+  tbody.querySelectorAll('tr[data-host-id]').forEach(tr => {
+    rows.set(tr.getAttribute('data-host-id'), tr);
+    tr.classList.add('hidden');
+  });
+  (hosts || []).forEach(h => {
+    const tr = rows.get(h.id);
+    if (!tr) return;
+    tr.classList.remove('hidden');
+    tbody.appendChild(tr);
+  });
+  const count = document.getElementById('view-count');
+  if (count) count.textContent = `${(hosts || []).length} of ${rows.size} hosts`;
+
+  if (viewObserver) viewObserver.observe(document.getElementById('host-list-container'), { childList: true, subtree: true });
+}
+
+function saveView() {
+  const v = currentView();
+  const name = prompt('Name this view', v.name || '');
+  if (!name) return;
+  v.name = name;
+  fetch('/api/views', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(v)
+  })
+    .then(resp => resp.ok ? resp.json() : resp.json().then(e => Promise.reject(new Error(e.error))))
+    .then(saved => loadViews(saved.name))
+    .catch(err => alert('Failed to save view: ' + err.message));
+}
+
+function deleteView() {
+  const name = document.getElementById('view-select').value;
+  if (!name || !confirm(`Delete the view "${name}"?`)) return;
+  fetch('/api/views/delete?name=' + encodeURIComponent(name), { method: 'POST' })
+    .then(() => {
+      loadViews();
+      selectView('');
+    })
+    .catch(err => alert('Failed to delete view: ' + err.message));
+}
+
+// Check the hosts in the selected saved view, as the view stands on the
+// server.
+function checkView() {
+  const name = document.getElementById('view-select').value;
+  if (!name) return;
+  fetch('/api/hosts/check?view=' + encodeURIComponent(name), { method: 'POST' })
+    .then(() => updateStatusBar(`Checking the hosts in "${name}"...`))
+    .catch(() => { });
+}
+
+// Fleet search in the header. Results are fetched as the user types and
+// picked with the arrow keys and Enter, or the mouse.
+let searchTimer = null;
+let searchResults = [];
+let searchIndex = 0;
+
+const searchLabels = { host: 'Host', preset: 'Preset', event: 'Event', doc: 'Docs' };
+
+function searchFleet(query) {
+  clearTimeout(searchTimer);
+  const q = query.trim();
+  if (!q) {
+    hideSearch();
+    return;
+  }
+  searchTimer = setTimeout(() => {
+    fetch('/api/search?q=' + encodeURIComponent(q))
+      .then(resp => resp.ok ? resp.json() : [])
+      .then(results => {
+        searchResults = results || [];
+        searchIndex = 0;
+        renderSearch();
+      })
+      .catch(err => console.error('Search failed:', err));
+  }, 200);
+}
+
+function renderSearch() {
+  const box = document.getElementById('search-results');
+  if (searchResults.length === 0) {
+    box.innerHTML = '<div class="p-2 text-desert-gray italic">No matches</div>';
+  } else {
+    let html = '';
+    searchResults.forEach((r, i) => {
+      const active = i === searchIndex ? ' bg-desert-gray/40' : '';
+      html += `<div class="p-2 cursor-pointer hover:bg-desert-gray/40${active}" onmousedown="openSearchResult(${i})">`;
+      html += `<span class="mr-1 text-[0.6rem] uppercase tracking-widest text-desert-orange">${searchLabels[r.type] || escapeHTML(r.type)}</span>`;
+      html += `<span class="text-desert-yellow">${escapeHTML(r.title)}</span>`;
+      if (r.detail) html += `<div class="truncate text-desert-gray">${escapeHTML(r.detail)}</div>`;
+      html += '</div>';
+    });
+    box.innerHTML = html;
+  }
+  box.classList.remove('hidden');
+}
+
+function hideSearch() {
+  document.getElementById('search-results').classList.add('hidden');
+}
+
+function searchKey(e) {
+  if (e.key === 'Escape') {
+    e.target.value = '';
+    hideSearch();
+    e.target.blur();
+  } else if (searchResults.length === 0) {
+    return;
+  } else if (e.key === 'ArrowDown' || e.key === 'ArrowUp') {
+    e.preventDefault();
+    const step = e.key === 'ArrowDown' ? 1 : searchResults.length - 1;
+    searchIndex = (searchIndex + step) % searchResults.length;
+    renderSearch();
+  } else if (e.key === 'Enter') {
+    e.preventDefault();
+    openSearchResult(searchIndex);
+  }
+}
+
+// Go to what a result refers to: the host's row, the snapshots or audit
+// log on the Advanced view, or the section in the docs.
+function openSearchResult(i) {
+  const r = searchResults[i];
+  if (!r) return;
+  const box = document.getElementById('search-box');
+  box.value = '';
+  box.blur();
+  hideSearch();
+
+  const highlight = el => {
+    el.scrollIntoView({ behavior: 'smooth', block: 'center' });
+    el.classList.add('ring-2', 'ring-desert-cyan');
+    setTimeout(() => el.classList.remove('ring-2', 'ring-desert-cyan'), 2000);
+  };
+  switch (r.type) {
+    case 'host':
+      showView('home', () => document.querySelector(`tr[data-host-id="${CSS.escape(r.id)}"]`), highlight);
+      break;
+    case 'preset':
+      showView('advanced', () => document.getElementById('snapshots'), highlight);
+      break;
+    case 'event':
+      showView('advanced', () => document.getElementById('audit-log'), highlight);
+      break;
+    case 'doc':
+      showView('docs', () => document.querySelector(`[data-on-click="@get('/views/docs?doc=${r.id}')"]`), link => {
+        link.click();
+        waitFor(() => [...document.querySelectorAll('#content-area h2, #content-area h3, #content-area h4')]
+          .find(h => h.textContent.trim() === r.title), highlight);
+      });
+      break;
+  }
+}
+
+// Open a view from the navbar, then call then with the element find
+// returns once the view has rendered it.
+function showView(view, find, then) {
+  const link = document.querySelector(`nav a[data-on-click="@get('/views/${view}')"]`);
+  if (link) link.click();
+  waitFor(find, then);
+}
+
+function waitFor(find, then) {
+  let attempts = 0;
+  const check = setInterval(() => {
+    const el = find();
+    if (el) {
+      clearInterval(check);
+      then(el);
+    } else if (++attempts > 20) { // Give up after 2 seconds
+      clearInterval(check);
+    }
+  }, 100);
+}
+
+// "/" focuses the search box from anywhere but a text field
+document.addEventListener('keydown', e => {
+  const tag = document.activeElement && document.activeElement.tagName;
+  if (e.key === '/' && tag !== 'INPUT' && tag !== 'TEXTAREA') {
+    e.preventDefault();
+    document.getElementById('search-box').focus();
+  }
+});
+
 // Called when a view is loaded (triggered from navbar clicks)
 function onViewLoad(viewName) {
   console.log('View loaded:', viewName);
 
+  if (viewName === 'home') {
+    initViewBar();
+  }
+
   if (viewName === 'advanced') {
     // Initialize WebSocket for diagnostics
     // Use polling to wait for Datastar to update the DOM
@@ -654,6 +1519,11 @@ function onViewLoad(viewName) {
         console.log('Advanced view DOM ready, initializing...');
         initDiagnosticsWebSocket();
         loadBackupHistory();
+        loadSyncStatus();
+        loadSnapshots();
+        loadAPIKeys();
+        loadTriggers();
+        loadAuditLog();
       } else {
         attempts++;
         if (attempts > 20) { // Timeout after 2 seconds (20 * 100ms)
@@ -791,3 +1661,22 @@ window.performRequest = function (method, path, params, jsonBody) {
       newWindow.document.body.innerHTML = '<pre style="color:red">Error: ' + err.message + '</pre>';
     });
 };
+
+// Install support: the service worker caches the dashboard and keeps the
+// last host list for the offline shell. Service workers need HTTPS or
+// localhost, so nodes reached over plain HTTP simply go without. The host
+// list is fetched once a minute while the page is open; the worker keeps
+// each copy as the snapshot.
+const SNAPSHOT_INTERVAL_MS = 60 * 1000;
+
+if ('serviceWorker' in navigator && window.isSecureContext) {
+  navigator.serviceWorker.register('/sw.js').then(() => {
+    const snapshotFleet = () => {
+      if (navigator.onLine && !document.hidden) {
+        fetch('/api/hosts').catch(() => { });
+      }
+    };
+    snapshotFleet();
+    setInterval(snapshotFleet, SNAPSHOT_INTERVAL_MS);
+  }).catch(err => console.error('Service worker registration failed:', err));
+}
@@ -0,0 +1,93 @@
+// Service worker for the installed dashboard. It is served from /sw.js so
+// it controls the whole site.
+//
+// Pages and static files come from the network when it is reachable, and
+// are cached as they load. Without a connection to the node, pages fall
+// back to the offline shell, which shows the last host list snapshot.
+// Nothing is sent while offline; the snapshot is read-only.
+
+const SHELL_CACHE = 'nsm-shell-v1';
+const SNAPSHOT_CACHE = 'nsm-snapshot';
+const SNAPSHOT_URL = '/api/hosts';
+const OFFLINE_URL = '/static/offline.html';
+
+const SHELL = [
+  OFFLINE_URL,
+  '/static/tailwind.js',
+  '/static/manifest.webmanifest',
+  '/static/icon-192.png',
+];
+
+self.addEventListener('install', event => {
+  event.waitUntil(caches.open(SHELL_CACHE).then(cache => cache.addAll(SHELL)).then(() => self.skipWaiting()));
+});
+
+self.addEventListener('activate', event => {
+  const keep = [SHELL_CACHE, SNAPSHOT_CACHE];
+  event.waitUntil(
+    caches.keys()
+      .then(keys => Promise.all(keys.filter(k => !keep.includes(k)).map(k => caches.delete(k))))
+      .then(() => self.clients.claim())
+  );
+});
+
+self.addEventListener('fetch', event => {
+  const req = event.request;
+  const url = new URL(req.url);
+  if (url.origin !== location.origin) {
+    return;
+  }
+
+  // Signing out forgets the snapshot, so the device keeps no host list.
+  if (req.method === 'POST' && url.pathname === '/api/auth/logout') {
+    event.respondWith(caches.delete(SNAPSHOT_CACHE).then(() => fetch(req)));
+    return;
+  }
+  if (req.method !== 'GET') {
+    return;
+  }
+
+  if (req.mode === 'navigate') {
+    event.respondWith(fetch(req).catch(() => caches.match(OFFLINE_URL)));
+    return;
+  }
+  if (url.pathname === SNAPSHOT_URL && url.search === '') {
+    event.respondWith(snapshot(req));
+    return;
+  }
+  if (url.pathname.startsWith('/static/')) {
+    event.respondWith(
+      fetch(req)
+        .then(resp => {
+          if (resp.ok) {
+            const copy = resp.clone();
+            caches.open(SHELL_CACHE).then(cache => cache.put(req, copy));
+          }
+          return resp;
+        })
+        .catch(() => caches.match(req, { ignoreSearch: true }))
+    );
+  }
+});
+
+// snapshot fetches the host list and keeps a copy, stamped with the time
+// it was taken, for the offline shell.
+async function snapshot(req) {
+  try {
+    const resp = await fetch(req);
+    if (resp.ok) {
+      const body = await resp.clone().text();
+      const cache = await caches.open(SNAPSHOT_CACHE);
+      await cache.put(SNAPSHOT_URL, new Response(body, {
+        headers: { 'Content-Type': 'application/json', 'X-Snapshot-At': new Date().toISOString() },
+      }));
+    }
+    return resp;
+  } catch (err) {
+    const cached = await caches.match(SNAPSHOT_URL, { cacheName: SNAPSHOT_CACHE });
+    if (cached) {
+      return cached;
+    }
+    throw err;
+  }
+}
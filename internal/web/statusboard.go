@@ -0,0 +1,120 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+	"nexsign.mini/nsm/internal/types"
+)
+
+// statusBoard is the data for the read-only wall display: one tile per
+// host, those needing attention first, and a count per health.
+type statusBoard struct {
+	Hosts     []types.Host
+	Counts    []healthCount
+	UpdatedAt string
+	StreamURL string
+	BuildTime string
+}
+
+type healthCount struct {
+	Health types.HealthStatus
+	Count  int
+}
+
+// boardHealths are counted on the board, in this order.
+var boardHealths = []types.HealthStatus{
+	types.HealthOnline, types.HealthDegraded, types.HealthOffline, types.HealthStarting, types.HealthMaintenance,
+}
+
+func (s *Server) statusBoard() statusBoard {
+	list := hosts.View{Sort: hosts.SortHealth}.Apply(s.store.GetAll())
+	counts := make(map[types.HealthStatus]int)
+	for i, h := range list {
+		if h.Health == "" {
+			list[i].Health = types.HealthOffline
+		}
+		counts[list[i].Health]++
+	}
+	b := statusBoard{Hosts: list, UpdatedAt: time.Now().Format("15:04:05")}
+	for _, health := range boardHealths {
+		if counts[health] > 0 {
+			b.Counts = append(b.Counts, healthCount{health, counts[health]})
+		}
+	}
+	return b
+}
+
+// handleStatusBoard serves the status board page. Access is checked by the
+// auth middleware; the token, if any, is passed on to the update stream.
+func (s *Server) handleStatusBoard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b := s.statusBoard()
+	b.StreamURL = "/status-board/stream"
+	if token := r.URL.Query().Get("token"); token != "" {
+		b.StreamURL += "?token=" + url.QueryEscape(token)
+	}
+	b.BuildTime = types.BuildTime
+
+	s.writePage(w, "status-board.html", b)
+}
+
+// renderStatusBoardFragment creates the SSE-formatted fragment for status
+// board updates.
+func (s *Server) renderStatusBoardFragment() []byte {
+	var buf bytes.Buffer
+	if err := s.templates.Load().ExecuteTemplate(&buf, "status-board-tiles", s.statusBoard()); err != nil {
+		s.renderFailed("Status board", err)
+		buf.Reset()
+		buf.WriteString(`<div id="board_tiles">` + errorPanel("Status board") + `</div>`)
+	}
+	return encodeEvent(mergeFragments(buf.String(), fragmentOptions{}))
+}
+
+// handleStatusBoardStream streams status board updates.
+func (s *Server) handleStatusBoardStream(w http.ResponseWriter, r *http.Request) {
+	s.streamFragments(w, r, s.boardBroker, s.renderStatusBoardFragment)
+}
+
+// streamFragments sends the fragment render returns, then those broadcast
+// to broker. It is re-rendered every minute as well, so hosts that fall
+// silent turn offline without a change to the host list.
+func (s *Server) streamFragments(w http.ResponseWriter, r *http.Request, broker *sseBroker, render func() []byte) {
+	sw := newSSEWriter(w)
+	if err := sw.flush(); err != nil {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	clientChan := make(chan []byte, 10)
+	broker.register(clientChan)
+	defer broker.unregister(clientChan)
+
+	if data := render(); data != nil {
+		sw.write(data)
+	}
+
+	refresh := time.NewTicker(time.Minute)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-clientChan:
+			sw.write(data)
+		case <-refresh.C:
+			if data := render(); data != nil {
+				sw.write(data)
+			} else {
+				sw.comment("keep-alive")
+			}
+		}
+	}
+}
@@ -1,9 +1,60 @@
 package web
 
 import (
-	"html/template"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
-func parseTemplates() (*template.Template, error) {
-	return template.ParseGlob("internal/web/*.html")
+// templateFiles is where the templates are parsed from, relative to the
+// working directory.
+const templateFiles = "internal/web/*.html"
+
+// WatchTemplates re-parses the templates whenever one changes, so the UI
+// can be worked on without restarting. A template that fails to parse is
+// reported to the status console and the last good set keeps serving.
+func (s *Server) WatchTemplates(interval time.Duration) {
+	s.watchTemplates(templateFiles, interval, nil)
+}
+
+func (s *Server) watchTemplates(pattern string, interval time.Duration, stop <-chan struct{}) {
+	last := templateStamp(pattern)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		stamp := templateStamp(pattern)
+		if stamp == last {
+			continue
+		}
+		last = stamp
+		t, err := s.parseTemplates(pattern)
+		if err != nil {
+			s.logger.Error(fmt.Sprintf("Templates: reload failed, keeping the last good set: %v", err))
+			continue
+		}
+		s.templates.Store(t)
+		s.logger.Info("Templates: reloaded")
+	}
+}
+
+// templateStamp sums up the name, size and modification time of each
+// template, so any edit, addition or removal changes it.
+func templateStamp(pattern string) string {
+	files, _ := filepath.Glob(pattern)
+	var b strings.Builder
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return b.String()
 }
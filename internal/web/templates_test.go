@@ -0,0 +1,66 @@
+package web
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/logger"
+)
+
+func TestWatchTemplates(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "page.html")
+	pattern := filepath.Join(dir, "*.html")
+	write := func(text string, at time.Time) {
+		if err := os.WriteFile(file, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(file, at, at) // Coarse file system clocks may not see the edit otherwise
+	}
+	render := func(s *Server) string {
+		var buf bytes.Buffer
+		s.templates.Load().ExecuteTemplate(&buf, "page.html", nil)
+		return buf.String()
+	}
+	waitFor := func(what string, ok func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !ok() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("one", start)
+	s := &Server{logger: logger.New(10)}
+	s.templates.Store(template.Must(template.ParseGlob(pattern)))
+	stop := make(chan struct{})
+	defer close(stop)
+	go s.watchTemplates(pattern, 5*time.Millisecond, stop)
+	time.Sleep(20 * time.Millisecond) // Let the watcher note the starting files
+
+	write("two", start.Add(time.Minute))
+	waitFor("the edit", func() bool { return render(s) == "two" })
+
+	// A broken template is reported and the last good one keeps serving.
+	write("{{if}}", start.Add(2*time.Minute))
+	waitFor("the parse error", func() bool {
+		for _, m := range s.logger.GetAll() {
+			if m.Level == "error" && strings.Contains(m.Text, "reload failed") {
+				return true
+			}
+		}
+		return false
+	})
+	if got := render(s); got != "two" {
+		t.Errorf("expected the last good template kept, got %q", got)
+	}
+}
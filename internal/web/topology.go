@@ -0,0 +1,112 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// topologyGraph is the fleet topology laid out for a 400x400 SVG: nodes
+// on a circle, with one edge per pair of nodes.
+type topologyGraph struct {
+	Nodes    []topologyNode
+	Edges    []topologyEdge
+	Links    []topologyLink
+	Findings []string
+}
+
+type topologyNode struct {
+	hosts.TopologyNode
+	X, Y   float64
+	LabelY float64 // Below the node in the lower half, above it in the upper
+}
+
+// topologyEdge is a pair of nodes. State is "ok" when each reaches the
+// other, "oneway" when only one does, "down" when neither does, and
+// "unknown" when only one side has reported and it cannot reach the other.
+type topologyEdge struct {
+	X1, Y1, X2, Y2 float64
+	State          string
+	Title          string
+}
+
+// topologyLink is a link with node labels, for the table under the graph.
+type topologyLink struct {
+	hosts.Link
+	FromLabel, ToLabel string
+}
+
+// layoutTopology places the nodes of topo and pairs up its links.
+func layoutTopology(topo hosts.Topology) *topologyGraph {
+	g := &topologyGraph{Findings: topo.Findings}
+	index := make(map[string]int, len(topo.Nodes))
+	for i, n := range topo.Nodes {
+		angle := 2*math.Pi*float64(i)/float64(len(topo.Nodes)) - math.Pi/2
+		x, y := 200+150*math.Cos(angle), 200+150*math.Sin(angle)
+		labelY := y + 24
+		if y < 200 {
+			labelY = y - 16
+		}
+		g.Nodes = append(g.Nodes, topologyNode{TopologyNode: n, X: x, Y: y, LabelY: labelY})
+		index[n.ID] = i
+	}
+
+	byPair := make(map[[2]string]hosts.Link, len(topo.Links))
+	for _, l := range topo.Links {
+		byPair[[2]string{l.From, l.To}] = l
+		g.Links = append(g.Links, topologyLink{Link: l, FromLabel: g.Nodes[index[l.From]].Label, ToLabel: g.Nodes[index[l.To]].Label})
+	}
+
+	for i, a := range g.Nodes {
+		for _, b := range g.Nodes[i+1:] {
+			ab, okAB := byPair[[2]string{a.ID, b.ID}]
+			ba, okBA := byPair[[2]string{b.ID, a.ID}]
+			if !okAB && !okBA {
+				continue
+			}
+			e := topologyEdge{X1: a.X, Y1: a.Y, X2: b.X, Y2: b.Y}
+			var title []string
+			if okAB {
+				title = append(title, describeLink(a.Label, b.Label, ab))
+			}
+			if okBA {
+				title = append(title, describeLink(b.Label, a.Label, ba))
+			}
+			e.Title = strings.Join(title, "; ")
+			switch {
+			case okAB && okBA && ab.Reaches() && ba.Reaches():
+				e.State = "ok"
+			case ab.Reaches() || ba.Reaches():
+				e.State = "oneway"
+			case okAB && okBA:
+				e.State = "down"
+			default:
+				e.State = "unknown"
+			}
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	return g
+}
+
+// describeLink summarises one direction of an edge for its tooltip.
+func describeLink(from, to string, l hosts.Link) string {
+	heard := "no heartbeats"
+	if l.Heard != "" {
+		heard = fmt.Sprintf("heartbeats over %s", l.Heard)
+	}
+	vpn := ""
+	if l.VPN != "" {
+		vpn = fmt.Sprintf(", VPN %s", l.VPN)
+	}
+	return fmt.Sprintf("%s → %s: LAN %s%s, %s", from, to, orUnchecked(string(l.LAN)), vpn, heard)
+}
+
+func orUnchecked(status string) string {
+	if status == "" {
+		return "unchecked"
+	}
+	return status
+}
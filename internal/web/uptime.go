@@ -0,0 +1,54 @@
+package web
+
+import (
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// uptimeChartPeriod is how much uptime history the host table charts.
+const uptimeChartPeriod = 7 * 24 * time.Hour
+
+// uptimeChart is a host's uptime over the last week, drawn in a 100x20 SVG
+// box in the host table: a mark for each bucket the host was down in, as
+// tall as the share of it the host was down.
+type uptimeChart struct {
+	Down    []uptimeMark
+	Percent float64 // Share of the samples in the period the host was up
+}
+
+// uptimeMark is a bucket the host was down for part of.
+type uptimeMark struct {
+	X, Y float64 // X position, and the top of the mark
+}
+
+// uptimeCharts builds a chart for each host with at least two buckets of
+// samples in the period, keyed by host ID.
+func (s *Server) uptimeCharts() map[string]*uptimeChart {
+	charts := make(map[string]*uptimeChart)
+	now := time.Now()
+	since := now.Add(-uptimeChartPeriod)
+	history, err := s.store.MetricHistory(hosts.MetricUp, since, now)
+	if err != nil {
+		return charts
+	}
+	span := now.Sub(since).Seconds()
+	for id, points := range history {
+		if len(points) < 2 {
+			continue
+		}
+		c := &uptimeChart{}
+		up, count := 0.0, 0
+		for _, p := range points {
+			up += p.Avg * float64(p.Count)
+			count += p.Count
+			if p.Avg < 1 {
+				x := min(max(p.At.Sub(since).Seconds()/span*100, 0), 100)
+				c.Down = append(c.Down, uptimeMark{X: x, Y: 20 - (1-p.Avg)*20})
+			}
+		}
+		c.Percent = up / float64(count) * 100
+		charts[id] = c
+	}
+	return charts
+}
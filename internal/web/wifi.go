@@ -0,0 +1,62 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// wifiChartPeriod is how much Wi-Fi history the host table charts.
+const wifiChartPeriod = 24 * time.Hour
+
+// Signal range of the Wi-Fi chart: -90 dBm, about where links drop, at
+// the bottom and -30 dBm, next to the access point, at the top.
+const (
+	wifiChartFloor   = -90
+	wifiChartCeiling = -30
+)
+
+// wifiChart is a wireless host's signal over the last day, drawn as a
+// sparkline in a 100x20 SVG box in the host table.
+type wifiChart struct {
+	Points  string    // Polyline points for the samples taken while connected
+	Drops   []float64 // X positions of samples taken while disconnected
+	Summary hosts.WiFiSummary
+}
+
+// wifiCharts builds a chart for each host with at least two Wi-Fi samples
+// in the period, keyed by host ID.
+func (s *Server) wifiCharts() map[string]*wifiChart {
+	charts := make(map[string]*wifiChart)
+	history, err := s.store.WiFiHistory(time.Now().Add(-wifiChartPeriod))
+	if err != nil {
+		return charts
+	}
+	for id, samples := range history {
+		if len(samples) < 2 {
+			continue
+		}
+		c := &wifiChart{Summary: hosts.SummarizeWiFi(samples)}
+		start, span := samples[0].At, samples[len(samples)-1].At.Sub(samples[0].At).Seconds()
+		var points []string
+		for _, w := range samples {
+			x := 100.0
+			if span > 0 {
+				x = w.At.Sub(start).Seconds() / span * 100
+			}
+			if !w.Connected() {
+				c.Drops = append(c.Drops, x)
+				continue
+			}
+			dbm := min(max(w.SignalDBM, wifiChartFloor), wifiChartCeiling)
+			// Leave a pixel top and bottom so the line is never clipped.
+			y := 19 - float64(dbm-wifiChartFloor)/float64(wifiChartCeiling-wifiChartFloor)*18
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		c.Points = strings.Join(points, " ")
+		charts[id] = c
+	}
+	return charts
+}
@@ -0,0 +1,187 @@
+package widgets
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MenuItem is one row of a menu board.
+type MenuItem struct {
+	Name        string
+	Description string
+	Price       string
+	SoldOut     bool
+}
+
+// MenuSection is a heading and the items under it, in sheet order.
+type MenuSection struct {
+	Name  string
+	Items []MenuItem
+}
+
+// menuColumns maps accepted header names to the field they fill.
+var menuColumns = map[string]string{
+	"section":     "section",
+	"category":    "section",
+	"item":        "name",
+	"name":        "name",
+	"description": "description",
+	"details":     "description",
+	"price":       "price",
+	"available":   "available",
+	"sold out":    "sold_out",
+	"sold_out":    "sold_out",
+}
+
+// ParseMenu reads a menu from CSV. The first row is a header naming the
+// columns: name (or item) is required; section (or category), price,
+// description and available or sold out are optional, and others are
+// ignored. Rows without a name are skipped.
+func ParseMenu(data []byte) ([]MenuSection, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, errors.New("menu csv is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse menu csv: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		if field, ok := menuColumns[strings.ToLower(strings.TrimSpace(h))]; ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+	}
+	if _, ok := cols["name"]; !ok {
+		return nil, errors.New("menu csv needs a name or item column")
+	}
+
+	var sections []MenuSection
+	index := make(map[string]int)
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse menu csv: %w", err)
+		}
+		cell := func(field string) string {
+			if i, ok := cols[field]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		item := MenuItem{
+			Name:        cell("name"),
+			Description: cell("description"),
+			Price:       cell("price"),
+			SoldOut:     isNo(cell("available")) || isYes(cell("sold_out")),
+		}
+		if item.Name == "" {
+			continue
+		}
+		section := cell("section")
+		i, ok := index[section]
+		if !ok {
+			i = len(sections)
+			index[section] = i
+			sections = append(sections, MenuSection{Name: section})
+		}
+		sections[i].Items = append(sections[i].Items, item)
+	}
+	if len(sections) == 0 {
+		return nil, errors.New("menu csv has no items")
+	}
+	return sections, nil
+}
+
+func isYes(s string) bool {
+	switch strings.ToLower(s) {
+	case "yes", "y", "true", "1", "x":
+		return true
+	}
+	return false
+}
+
+func isNo(s string) bool {
+	switch strings.ToLower(s) {
+	case "no", "n", "false", "0":
+		return true
+	}
+	return false
+}
+
+// FormatPrice puts the currency symbol before plain numbers and shows them
+// with two decimals, or none for whole amounts. Anything else, like
+// "2 for 5" or "Market price", is shown as written.
+func FormatPrice(price, currency string) string {
+	f, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return price
+	}
+	if f == float64(int64(f)) {
+		return currency + strconv.FormatInt(int64(f), 10)
+	}
+	return currency + strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+var sheetPath = regexp.MustCompile(`^/spreadsheets/d/([A-Za-z0-9_-]+)`)
+
+// SheetCSVURL turns a Google Sheets link into its CSV export URL, keeping
+// the tab given by gid. Published ("/d/e/...") links and any other URL are
+// returned unchanged. The sheet must be shared so anyone with the link can
+// view it.
+func SheetCSVURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host != "docs.google.com" {
+		return raw
+	}
+	m := sheetPath.FindStringSubmatch(u.Path)
+	if m == nil || m[1] == "e" {
+		return raw
+	}
+
+	gid := u.Query().Get("gid")
+	if frag, err := url.ParseQuery(u.Fragment); err == nil && frag.Get("gid") != "" {
+		gid = frag.Get("gid")
+	}
+	q := url.Values{"format": {"csv"}}
+	if gid != "" {
+		q.Set("gid", gid)
+	}
+	return fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/export?%s", m[1], q.Encode())
+}
+
+// Menu returns the widget's menu, from its uploaded CSV or its source.
+func (s *Sources) Menu(w Widget) ([]MenuSection, error) {
+	if w.CSV != "" {
+		return ParseMenu([]byte(w.CSV))
+	}
+
+	src := SheetCSVURL(w.SourceURL)
+	maxAge := time.Duration(w.RefreshMinutes) * time.Minute
+	v, err := s.cached("menu "+src, maxAge, func() (any, error) {
+		data, err := s.get(src)
+		if err != nil {
+			return nil, fmt.Errorf("fetch menu: %w", err)
+		}
+		return ParseMenu(data)
+	})
+	sections, _ := v.([]MenuSection)
+	return sections, err
+}
@@ -0,0 +1,160 @@
+package widgets
+
+import (
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// page holds everything the page template needs for one widget.
+type page struct {
+	Widget
+	Paragraphs    []string
+	Headlines     []Headline
+	TickerSeconds int
+	Weather       *Weather
+	Now           time.Time
+	Menu          []MenuSection // Prices already formatted
+	Columns       int
+	Accent        string
+	Font          template.CSS
+	Refresh       int // Seconds, 0 for no reload
+}
+
+// pageTemplate is sized in viewport units so the same page fills any
+// screen Anthias shows it on.
+var pageTemplate = template.Must(template.New("widget").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>{{.Name}}</title>
+<style>
+html, body { margin: 0; height: 100%; overflow: hidden; }
+body {
+	background: {{.Background}}; color: {{.Foreground}};
+	font-family: {{.Font}};
+	display: flex; flex-direction: column; justify-content: center; align-items: center;
+	text-align: center; box-sizing: border-box; padding: 4vh 5vw;
+}
+h1 { font-size: 8vh; margin: 0 0 4vh; }
+p { font-size: 5vh; line-height: 1.3; margin: 0 0 2vh; white-space: pre-line; }
+.muted { opacity: 0.6; }
+.ticker { width: 100%; overflow: hidden; white-space: nowrap; font-size: 6vh; }
+.ticker span { display: inline-block; padding-left: 100%; animation: scroll linear infinite; }
+.ticker b { margin: 0 3vw; opacity: 0.5; }
+@keyframes scroll { from { transform: translateX(0); } to { transform: translateX(-100%); } }
+.temp { font-size: 24vh; font-weight: bold; line-height: 1; }
+.time { font-size: 26vh; font-weight: bold; line-height: 1; font-variant-numeric: tabular-nums; }
+.date { font-size: 7vh; margin-top: 3vh; }
+.menu { width: 100%; column-gap: 5vw; text-align: left; }
+.menu section { break-inside: avoid; margin-bottom: 4vh; }
+.menu h2 { color: {{.Accent}}; font-size: 5vh; margin: 0 0 1.5vh; border-bottom: 0.3vh solid {{.Accent}}; }
+.item { margin-bottom: 1.5vh; }
+.item div { display: flex; align-items: baseline; font-size: 3.6vh; }
+.item div span:nth-child(2) { flex: 1; border-bottom: 0.3vh dotted; opacity: 0.4; margin: 0 1vw; }
+.item small { display: block; font-size: 2.4vh; opacity: 0.7; }
+.soldout { opacity: 0.4; text-decoration: line-through; }
+</style>
+</head>
+<body>
+{{if .Title}}{{if ne .Kind "clock"}}<h1{{if .Accent}} style="color: {{.Accent}}"{{end}}>{{.Title}}</h1>{{end}}{{end}}
+{{- if eq .Kind "text"}}
+{{range .Paragraphs}}<p>{{.}}</p>
+{{end}}
+{{- else if eq .Kind "rss"}}
+{{if .Headlines}}<div class="ticker"><span style="animation-duration: {{.TickerSeconds}}s">
+{{- range $i, $h := .Headlines}}{{if $i}}<b>&bull;</b>{{end}}{{$h.Title}}{{end -}}
+</span></div>{{else}}<p class="muted">No headlines available</p>{{end}}
+{{- else if eq .Kind "weather"}}
+{{with .Weather}}<div class="temp">{{printf "%.0f" .Temperature}}{{.TempUnit}}</div>
+<p>{{.Summary}}</p>
+<p class="muted">Wind {{printf "%.0f" .WindSpeed}} {{.WindUnit}}</p>{{else}}<p class="muted">Weather unavailable</p>{{end}}
+{{- else if eq .Kind "clock"}}
+<div class="time" id="time">{{if .Hour12}}{{.Now.Format "3:04 PM"}}{{else}}{{.Now.Format "15:04"}}{{end}}</div>
+<div class="date" id="date">{{.Now.Format "Monday 2 January 2006"}}</div>
+<script>
+(function () {
+	var zone = {{.Timezone}} || undefined;
+	var time = new Intl.DateTimeFormat(undefined, {timeZone: zone, hour: "2-digit", minute: "2-digit", hour12: {{.Hour12}}});
+	var date = new Intl.DateTimeFormat(undefined, {timeZone: zone, weekday: "long", day: "numeric", month: "long", year: "numeric"});
+	function tick() {
+		var now = new Date();
+		document.getElementById("time").textContent = time.format(now);
+		document.getElementById("date").textContent = date.format(now);
+	}
+	tick();
+	setInterval(tick, 1000);
+})();
+</script>
+{{- else if eq .Kind "menu"}}
+{{if .Menu}}<div class="menu" style="column-count: {{.Columns}}">
+{{range .Menu}}<section>{{if .Name}}<h2>{{.Name}}</h2>{{end}}
+{{range .Items}}<div class="item{{if .SoldOut}} soldout{{end}}"><div><span>{{.Name}}</span><span></span><span>{{if .SoldOut}}Sold out{{else}}{{.Price}}{{end}}</span></div>
+{{- if .Description}}<small>{{.Description}}</small>{{end}}</div>
+{{end}}</section>
+{{end}}</div>{{else}}<p class="muted">Menu unavailable</p>{{end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// Render writes the widget's page. The page is written even when its feed
+// or weather source fails, saying the data is unavailable or showing the
+// last good copy, because a screen showing an error page is worse than one
+// showing less. The source error is returned so it can be logged; errors
+// writing to out only mean the player went away and are ignored.
+func (s *Sources) Render(out io.Writer, w Widget, now time.Time) error {
+	var sourceErr error
+	p := page{Widget: w, Font: `"DejaVu Sans", Arial, sans-serif`, Refresh: w.RefreshMinutes * 60}
+	switch w.Kind {
+	case KindText:
+		for _, para := range strings.Split(w.Text, "\n\n") {
+			if para = strings.TrimSpace(para); para != "" {
+				p.Paragraphs = append(p.Paragraphs, para)
+			}
+		}
+	case KindRSS:
+		p.Headlines, sourceErr = s.Headlines(w)
+		chars := 0
+		for _, h := range p.Headlines {
+			chars += len(h.Title) + 5
+		}
+		// Roughly ten characters a second reads comfortably from a
+		// distance.
+		p.TickerSeconds = max(chars/10, 15)
+	case KindWeather:
+		p.Weather, sourceErr = s.Weather(w)
+	case KindMenu:
+		theme, ok := Themes[w.Theme]
+		if !ok {
+			theme = Themes[DefaultTheme]
+		}
+		p.Accent, p.Font = theme.Accent, template.CSS(theme.Font)
+
+		var menu []MenuSection
+		menu, sourceErr = s.Menu(w)
+		for _, sec := range menu {
+			items := make([]MenuItem, len(sec.Items))
+			for i, it := range sec.Items {
+				it.Price = FormatPrice(it.Price, w.Currency)
+				items[i] = it
+			}
+			p.Menu = append(p.Menu, MenuSection{Name: sec.Name, Items: items})
+		}
+		p.Columns = min(max(len(p.Menu), 1), 3)
+	case KindClock:
+		// The script takes over on the player; this is only the first
+		// paint.
+		p.Now = now
+		if w.Timezone != "" {
+			if loc, err := time.LoadLocation(w.Timezone); err == nil {
+				p.Now = now.In(loc)
+			}
+		}
+	}
+	pageTemplate.Execute(out, p)
+	return sourceErr
+}
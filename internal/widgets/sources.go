@@ -0,0 +1,220 @@
+package widgets
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultWeatherURL is the Open-Meteo forecast endpoint, which needs no API
+// key.
+const DefaultWeatherURL = "https://api.open-meteo.com/v1/forecast"
+
+// maxSourceSize bounds a feed or weather response.
+const maxSourceSize = 2 << 20
+
+// Headline is one item from a feed.
+type Headline struct {
+	Title string
+	Link  string
+}
+
+// Weather is the current conditions at a location.
+type Weather struct {
+	Temperature float64
+	TempUnit    string // "°C" or "°F"
+	WindSpeed   float64
+	WindUnit    string // "km/h" or "mph"
+	Code        int    // WMO weather code
+}
+
+// Summary describes the WMO weather code in words.
+func (w Weather) Summary() string {
+	switch c := w.Code; {
+	case c == 0:
+		return "Clear"
+	case c <= 2:
+		return "Partly cloudy"
+	case c == 3:
+		return "Overcast"
+	case c == 45 || c == 48:
+		return "Fog"
+	case c >= 51 && c <= 57:
+		return "Drizzle"
+	case c >= 61 && c <= 67, c >= 80 && c <= 82:
+		return "Rain"
+	case c >= 71 && c <= 77, c == 85 || c == 86:
+		return "Snow"
+	case c >= 95:
+		return "Thunderstorm"
+	}
+	return "Unknown"
+}
+
+// Sources fetches feed and weather data for widgets. Results are kept for
+// the widget's refresh interval, so many screens showing one widget cause
+// one upstream request, and the last good result is reused if the source
+// is down.
+type Sources struct {
+	Client     *http.Client
+	WeatherURL string
+
+	mu      sync.Mutex
+	entries map[string]sourceEntry
+}
+
+type sourceEntry struct {
+	value   any
+	fetched time.Time
+}
+
+// NewSources creates a fetcher using Open-Meteo for weather.
+func NewSources() *Sources {
+	return &Sources{
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		WeatherURL: DefaultWeatherURL,
+		entries:    make(map[string]sourceEntry),
+	}
+}
+
+// cached returns the value for key, calling fetch when it is older than
+// maxAge. A failed fetch returns the stale value along with the error.
+func (s *Sources) cached(key string, maxAge time.Duration, fetch func() (any, error)) (any, error) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	s.mu.Unlock()
+	if ok && time.Since(e.fetched) < maxAge {
+		return e.value, nil
+	}
+
+	v, err := fetch()
+	if err != nil {
+		if ok {
+			return e.value, err
+		}
+		return nil, err
+	}
+	s.mu.Lock()
+	s.entries[key] = sourceEntry{value: v, fetched: time.Now()}
+	s.mu.Unlock()
+	return v, nil
+}
+
+func (s *Sources) get(rawURL string) ([]byte, error) {
+	resp, err := s.Client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxSourceSize))
+}
+
+// Headlines returns up to w.MaxItems items from the widget's feed.
+func (s *Sources) Headlines(w Widget) ([]Headline, error) {
+	maxAge := time.Duration(w.RefreshMinutes) * time.Minute
+	v, err := s.cached("rss "+w.FeedURL, maxAge, func() (any, error) {
+		data, err := s.get(w.FeedURL)
+		if err != nil {
+			return nil, fmt.Errorf("fetch feed: %w", err)
+		}
+		return parseFeed(data)
+	})
+	items, _ := v.([]Headline)
+	if len(items) > w.MaxItems {
+		items = items[:w.MaxItems]
+	}
+	return items, err
+}
+
+// parseFeed reads the items of an RSS 2.0 feed or the entries of an Atom
+// feed.
+func parseFeed(data []byte) ([]Headline, error) {
+	var doc struct {
+		XMLName xml.Name
+		Items   []struct {
+			Title string `xml:"title"`
+			Link  string `xml:"link"`
+		} `xml:"channel>item"`
+		Entries []struct {
+			Title string `xml:"title"`
+			Link  struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse feed: %w", err)
+	}
+
+	var out []Headline
+	for _, it := range doc.Items {
+		if t := strings.TrimSpace(it.Title); t != "" {
+			out = append(out, Headline{Title: t, Link: strings.TrimSpace(it.Link)})
+		}
+	}
+	for _, e := range doc.Entries {
+		if t := strings.TrimSpace(e.Title); t != "" {
+			out = append(out, Headline{Title: t, Link: e.Link.Href})
+		}
+	}
+	if out == nil && doc.XMLName.Local != "rss" && doc.XMLName.Local != "feed" {
+		return nil, fmt.Errorf("parse feed: <%s> is not an RSS or Atom feed", doc.XMLName.Local)
+	}
+	return out, nil
+}
+
+// Weather returns the current conditions at the widget's location, or nil
+// if they have never been fetched successfully.
+func (s *Sources) Weather(w Widget) (*Weather, error) {
+	q := url.Values{
+		"latitude":  {strconv.FormatFloat(w.Latitude, 'f', 4, 64)},
+		"longitude": {strconv.FormatFloat(w.Longitude, 'f', 4, 64)},
+		"current":   {"temperature_2m,weather_code,wind_speed_10m"},
+	}
+	if w.Units == UnitsImperial {
+		q.Set("temperature_unit", "fahrenheit")
+		q.Set("wind_speed_unit", "mph")
+	}
+	u := s.WeatherURL + "?" + q.Encode()
+
+	maxAge := time.Duration(w.RefreshMinutes) * time.Minute
+	v, err := s.cached("weather "+u, maxAge, func() (any, error) {
+		data, err := s.get(u)
+		if err != nil {
+			return nil, fmt.Errorf("fetch weather: %w", err)
+		}
+		var resp struct {
+			Current struct {
+				Temperature float64 `json:"temperature_2m"`
+				Code        int     `json:"weather_code"`
+				WindSpeed   float64 `json:"wind_speed_10m"`
+			} `json:"current"`
+			Units struct {
+				Temperature string `json:"temperature_2m"`
+				WindSpeed   string `json:"wind_speed_10m"`
+			} `json:"current_units"`
+		}
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("decode weather: %w", err)
+		}
+		return &Weather{
+			Temperature: resp.Current.Temperature,
+			TempUnit:    resp.Units.Temperature,
+			WindSpeed:   resp.Current.WindSpeed,
+			WindUnit:    resp.Units.WindSpeed,
+			Code:        resp.Current.Code,
+		}, nil
+	})
+	weather, _ := v.(*Weather)
+	return weather, err
+}
@@ -0,0 +1,254 @@
+// Package widgets renders simple signage pages on the NSM node:
+// announcements, an RSS ticker, current weather, a clock and menu boards
+// built from a spreadsheet. Anthias shows
+// them as web assets, so basic dynamic content needs no external CMS.
+// Widget definitions are stored as a setting.
+package widgets
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+// SettingKey is the settings key holding the widget list.
+const SettingKey = "widgets"
+
+// Widget kinds.
+const (
+	KindText    = "text"    // Announcement: a title and a message
+	KindRSS     = "rss"     // Scrolling headlines from an RSS or Atom feed
+	KindWeather = "weather" // Current conditions from Open-Meteo
+	KindClock   = "clock"   // Time and date in a timezone
+	KindMenu    = "menu"    // Menu board from CSV or a Google Sheet
+)
+
+// Limits and defaults for widget fields.
+const (
+	DefaultMaxItems       = 10
+	DefaultRefreshMinutes = 10
+	MaxTextLength         = 2000
+	MaxCSVLength          = 64 << 10
+)
+
+// Menu board themes. Each sets the colors unless the widget does.
+var Themes = map[string]Theme{
+	"classic":    {Background: "#111111", Foreground: "#f5f5f5", Accent: "#e0a800", Font: `Georgia, "DejaVu Serif", serif`},
+	"light":      {Background: "#ffffff", Foreground: "#222222", Accent: "#c0392b", Font: `"DejaVu Sans", Arial, sans-serif`},
+	"chalkboard": {Background: "#1f3a2b", Foreground: "#f0f0e8", Accent: "#f7d774", Font: `"Comic Neue", "Comic Sans MS", cursive`},
+}
+
+// DefaultTheme is the menu theme used when none is set.
+const DefaultTheme = "classic"
+
+// Theme is a color scheme and typeface for menu boards.
+type Theme struct {
+	Background string
+	Foreground string
+	Accent     string
+	Font       string
+}
+
+// Units for the weather widget.
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+var (
+	colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	idPattern    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+)
+
+// Widget is one page NSM renders at /widgets/<id>. Which fields are used
+// depends on Kind.
+type Widget struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Kind           string  `json:"kind"`
+	Title          string  `json:"title,omitempty"`           // Heading shown on every kind but clock
+	Text           string  `json:"text,omitempty"`            // text: the message; blank lines separate paragraphs
+	FeedURL        string  `json:"feed_url,omitempty"`        // rss: RSS 2.0 or Atom feed
+	MaxItems       int     `json:"max_items,omitempty"`       // rss: headlines to show
+	Latitude       float64 `json:"latitude,omitempty"`        // weather
+	Longitude      float64 `json:"longitude,omitempty"`       // weather
+	Units          string  `json:"units,omitempty"`           // weather: metric or imperial
+	Timezone       string  `json:"timezone,omitempty"`        // clock: IANA name; empty uses the player's own
+	Hour12         bool    `json:"hour12,omitempty"`          // clock: 12-hour format
+	SourceURL      string  `json:"source_url,omitempty"`      // menu: CSV URL or Google Sheet link
+	CSV            string  `json:"csv,omitempty"`             // menu: uploaded CSV, used instead of source_url
+	Theme          string  `json:"theme,omitempty"`           // menu: classic, light or chalkboard
+	Currency       string  `json:"currency,omitempty"`        // menu: symbol put before numeric prices
+	Background     string  `json:"background,omitempty"`      // CSS hex color
+	Foreground     string  `json:"foreground,omitempty"`      // CSS hex color
+	RefreshMinutes int     `json:"refresh_minutes,omitempty"` // rss, weather and menu: how often the page reloads
+}
+
+// Validate normalises w and rejects unusable values. Widgets without an ID
+// are given one.
+func (w *Widget) Validate() error {
+	w.Kind = strings.ToLower(strings.TrimSpace(w.Kind))
+	w.Title = strings.TrimSpace(w.Title)
+	w.Name = strings.TrimSpace(w.Name)
+
+	switch w.Kind {
+	case KindText:
+		w.Text = strings.TrimSpace(w.Text)
+		if w.Title == "" && w.Text == "" {
+			return errors.New("a text widget needs a title or text")
+		}
+		if len(w.Text) > MaxTextLength {
+			return fmt.Errorf("text is longer than %d characters", MaxTextLength)
+		}
+	case KindRSS:
+		u, err := url.Parse(strings.TrimSpace(w.FeedURL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("feed_url must be an http or https URL")
+		}
+		w.FeedURL = u.String()
+		if w.MaxItems == 0 {
+			w.MaxItems = DefaultMaxItems
+		}
+		if w.MaxItems < 1 || w.MaxItems > 50 {
+			return errors.New("max_items must be between 1 and 50")
+		}
+	case KindWeather:
+		if w.Latitude < -90 || w.Latitude > 90 || w.Longitude < -180 || w.Longitude > 180 {
+			return errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
+		}
+		if w.Latitude == 0 && w.Longitude == 0 {
+			return errors.New("a weather widget needs a latitude and longitude")
+		}
+		w.Units = strings.ToLower(strings.TrimSpace(w.Units))
+		if w.Units == "" {
+			w.Units = UnitsMetric
+		}
+		if w.Units != UnitsMetric && w.Units != UnitsImperial {
+			return errors.New("units must be metric or imperial")
+		}
+	case KindClock:
+		w.Timezone = strings.TrimSpace(w.Timezone)
+		if w.Timezone != "" {
+			if _, err := time.LoadLocation(w.Timezone); err != nil {
+				return fmt.Errorf("unknown timezone %q", w.Timezone)
+			}
+		}
+	case KindMenu:
+		w.SourceURL = strings.TrimSpace(w.SourceURL)
+		if w.CSV != "" {
+			if len(w.CSV) > MaxCSVLength {
+				return fmt.Errorf("csv is larger than %d KB", MaxCSVLength>>10)
+			}
+			if _, err := ParseMenu([]byte(w.CSV)); err != nil {
+				return err
+			}
+		} else {
+			u, err := url.Parse(w.SourceURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("a menu widget needs csv or an http or https source_url")
+			}
+		}
+		w.Theme = strings.ToLower(strings.TrimSpace(w.Theme))
+		if w.Theme == "" {
+			w.Theme = DefaultTheme
+		}
+		theme, ok := Themes[w.Theme]
+		if !ok {
+			return fmt.Errorf("unknown theme %q (use classic, light or chalkboard)", w.Theme)
+		}
+		if strings.TrimSpace(w.Background) == "" {
+			w.Background = theme.Background
+		}
+		if strings.TrimSpace(w.Foreground) == "" {
+			w.Foreground = theme.Foreground
+		}
+		w.Currency = strings.TrimSpace(w.Currency)
+		if len(w.Currency) > 8 {
+			return errors.New("currency must be a short symbol such as $ or EUR")
+		}
+	default:
+		return fmt.Errorf("unknown kind %q (use text, rss, weather, clock or menu)", w.Kind)
+	}
+
+	for _, c := range []*string{&w.Background, &w.Foreground} {
+		*c = strings.TrimSpace(*c)
+		if *c != "" && !colorPattern.MatchString(*c) {
+			return fmt.Errorf("invalid color %q (use #rgb or #rrggbb)", *c)
+		}
+	}
+	if w.Background == "" {
+		w.Background = "#000000"
+	}
+	if w.Foreground == "" {
+		w.Foreground = "#ffffff"
+	}
+
+	if w.Kind == KindRSS || w.Kind == KindWeather || w.Kind == KindMenu {
+		if w.RefreshMinutes == 0 {
+			w.RefreshMinutes = DefaultRefreshMinutes
+		}
+		if w.RefreshMinutes < 1 || w.RefreshMinutes > 24*60 {
+			return errors.New("refresh_minutes must be between 1 and 1440")
+		}
+	} else {
+		w.RefreshMinutes = 0
+	}
+
+	if w.Name == "" {
+		w.Name = w.Title
+	}
+	if w.Name == "" {
+		w.Name = w.Kind
+	}
+	if w.ID == "" {
+		w.ID = uuid.New().String()
+	}
+	if !idPattern.MatchString(w.ID) {
+		return fmt.Errorf("invalid id %q (use letters, digits, - and _)", w.ID)
+	}
+	return nil
+}
+
+// Load returns the configured widgets.
+func Load(store hosts.SettingStore) ([]Widget, error) {
+	list := []Widget{}
+	if _, err := store.GetSetting(SettingKey, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Get returns the widget with the given ID.
+func Get(store *hosts.Store, id string) (Widget, bool, error) {
+	list, err := Load(store)
+	if err != nil {
+		return Widget{}, false, err
+	}
+	for _, w := range list {
+		if w.ID == id {
+			return w, true, nil
+		}
+	}
+	return Widget{}, false, nil
+}
+
+// Save validates and stores the full widget list, replacing the old one.
+func Save(store hosts.SettingStore, list []Widget) ([]Widget, error) {
+	seen := make(map[string]bool)
+	for i := range list {
+		if err := list[i].Validate(); err != nil {
+			return nil, fmt.Errorf("widget %d: %w", i+1, err)
+		}
+		if seen[list[i].ID] {
+			return nil, fmt.Errorf("widget %d: duplicate id %q", i+1, list[i].ID)
+		}
+		seen[list[i].ID] = true
+	}
+	return list, store.PutSetting(SettingKey, list)
+}
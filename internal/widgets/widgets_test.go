@@ -0,0 +1,252 @@
+package widgets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nexsign.mini/nsm/internal/hosts"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		w    Widget
+		ok   bool
+	}{
+		{"text", Widget{Kind: "Text", Title: "Welcome"}, true},
+		{"empty text", Widget{Kind: KindText}, false},
+		{"rss", Widget{Kind: KindRSS, FeedURL: "https://example.com/feed.xml"}, true},
+		{"rss without url", Widget{Kind: KindRSS, FeedURL: "example.com/feed"}, false},
+		{"weather", Widget{Kind: KindWeather, Latitude: 51.5, Longitude: -0.12}, true},
+		{"weather without location", Widget{Kind: KindWeather}, false},
+		{"weather units", Widget{Kind: KindWeather, Latitude: 1, Longitude: 1, Units: "kelvin"}, false},
+		{"clock", Widget{Kind: KindClock, Timezone: "Europe/London"}, true},
+		{"bad timezone", Widget{Kind: KindClock, Timezone: "Mars/Olympus"}, false},
+		{"bad color", Widget{Kind: KindClock, Background: "red; x: y"}, false},
+		{"bad id", Widget{ID: "../x", Kind: KindClock}, false},
+		{"unknown kind", Widget{Kind: "video"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.w.Validate()
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+
+	w := Widget{Kind: KindRSS, FeedURL: "https://example.com/feed.xml"}
+	w.Validate()
+	if w.ID == "" || w.MaxItems != DefaultMaxItems || w.RefreshMinutes != DefaultRefreshMinutes || w.Background != "#000000" {
+		t.Errorf("defaults not applied: %+v", w)
+	}
+}
+
+func TestSaveAndGet(t *testing.T) {
+	store, err := hosts.NewStore(filepath.Join(t.TempDir(), "hosts.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := Save(store, []Widget{{ID: "a", Kind: KindClock}, {ID: "a", Kind: KindClock}}); err == nil {
+		t.Error("expected duplicate ids to be rejected")
+	}
+	saved, err := Save(store, []Widget{{ID: "lobby", Kind: KindText, Title: "Welcome"}})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	w, ok, err := Get(store, "lobby")
+	if err != nil || !ok || w.Title != "Welcome" || w.Name != saved[0].Name {
+		t.Errorf("Get: %+v %v %v", w, ok, err)
+	}
+	if _, ok, _ := Get(store, "missing"); ok {
+		t.Error("expected missing widget not to be found")
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	rss := `<?xml version="1.0"?><rss version="2.0"><channel><title>News</title>
+<item><title>First &amp; foremost</title><link>https://example.com/1</link></item>
+<item><title> </title></item>
+<item><title>Second</title></item></channel></rss>`
+	items, err := parseFeed([]byte(rss))
+	if err != nil || len(items) != 2 || items[0].Title != "First & foremost" || items[0].Link != "https://example.com/1" {
+		t.Errorf("rss: %+v %v", items, err)
+	}
+
+	atom := `<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><title>Post</title><link href="https://example.com/post"/></entry></feed>`
+	items, err = parseFeed([]byte(atom))
+	if err != nil || len(items) != 1 || items[0].Link != "https://example.com/post" {
+		t.Errorf("atom: %+v %v", items, err)
+	}
+
+	if _, err := parseFeed([]byte(`<html><body>not a feed</body></html>`)); err == nil {
+		t.Error("expected html to be rejected")
+	}
+}
+
+func TestRender(t *testing.T) {
+	var feedHits atomic.Int32
+	feedUp := atomic.Bool{}
+	feedUp.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			feedHits.Add(1)
+			if !feedUp.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`<rss><channel><item><title>Doors open at &lt;9&gt;</title></item></channel></rss>`))
+		case "/weather":
+			if r.URL.Query().Get("temperature_unit") != "fahrenheit" {
+				t.Errorf("expected imperial units in %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"current":{"temperature_2m":71.6,"weather_code":61,"wind_speed_10m":8.2},"current_units":{"temperature_2m":"°F","wind_speed_10m":"mph"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSources()
+	s.WeatherURL = srv.URL + "/weather"
+	now := time.Date(2026, 3, 1, 14, 5, 0, 0, time.UTC)
+
+	render := func(w Widget) (string, error) {
+		t.Helper()
+		if err := w.Validate(); err != nil {
+			t.Fatalf("Validate: %v", err)
+		}
+		var b strings.Builder
+		err := s.Render(&b, w, now)
+		return b.String(), err
+	}
+
+	page, err := render(Widget{Kind: KindText, Title: "<Welcome>", Text: "Line one\n\nLine two", Background: "#123"})
+	if err != nil || !strings.Contains(page, "&lt;Welcome&gt;") || strings.Count(page, "<p>") != 2 || !strings.Contains(page, "#123") {
+		t.Errorf("text page: %v\n%s", err, page)
+	}
+	if strings.Contains(page, "http-equiv") {
+		t.Error("text page should not reload")
+	}
+
+	rss := Widget{Kind: KindRSS, FeedURL: srv.URL + "/feed"}
+	page, err = render(rss)
+	if err != nil || !strings.Contains(page, "Doors open at &lt;9&gt;") || !strings.Contains(page, `content="600"`) {
+		t.Errorf("rss page: %v\n%s", err, page)
+	}
+	// Within the refresh interval the feed is not fetched again, and once
+	// it is stale a failing feed still shows the last headlines.
+	render(rss)
+	if feedHits.Load() != 1 {
+		t.Errorf("expected one feed fetch, got %d", feedHits.Load())
+	}
+	feedUp.Store(false)
+	s.entries["rss "+rss.FeedURL] = sourceEntry{value: s.entries["rss "+rss.FeedURL].value, fetched: now.Add(-time.Hour)}
+	page, err = render(rss)
+	if err == nil || !strings.Contains(page, "Doors open") {
+		t.Errorf("expected stale headlines and an error, got %v\n%s", err, page)
+	}
+
+	page, err = render(Widget{Kind: KindRSS, FeedURL: srv.URL + "/missing"})
+	if err == nil || !strings.Contains(page, "No headlines available") {
+		t.Errorf("expected placeholder for a broken feed, got %v\n%s", err, page)
+	}
+
+	page, err = render(Widget{Kind: KindWeather, Title: "Lobby", Latitude: 40.7, Longitude: -74, Units: UnitsImperial})
+	if err != nil || !strings.Contains(page, "72°F") || !strings.Contains(page, "Rain") || !strings.Contains(page, "8 mph") {
+		t.Errorf("weather page: %v\n%s", err, page)
+	}
+
+	page, _ = render(Widget{Kind: KindClock, Timezone: "America/New_York", Hour12: true})
+	if !strings.Contains(page, "9:05 AM") || !strings.Contains(page, `"America/New_York"`) {
+		t.Errorf("clock page:\n%s", page)
+	}
+}
+
+func TestParseMenu(t *testing.T) {
+	data := "\xef\xbb\xbfCategory,Item,Price,Description,Available,Notes\n" +
+		"Coffee,Espresso,2.5,,yes,\n" +
+		"Coffee,Latte,3,\"Oat, soy or dairy\",no\n" +
+		"Food,Croissant,Market price\n" +
+		",,\n"
+	menu, err := ParseMenu([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseMenu: %v", err)
+	}
+	if len(menu) != 2 || menu[0].Name != "Coffee" || len(menu[0].Items) != 2 || menu[1].Items[0].Price != "Market price" {
+		t.Fatalf("unexpected menu: %+v", menu)
+	}
+	if latte := menu[0].Items[1]; !latte.SoldOut || latte.Description != "Oat, soy or dairy" {
+		t.Errorf("latte: %+v", latte)
+	}
+
+	if _, err := ParseMenu([]byte("price\n3\n")); err == nil {
+		t.Error("expected a csv without a name column to be rejected")
+	}
+	if _, err := ParseMenu([]byte("name,price\n")); err == nil {
+		t.Error("expected a csv without items to be rejected")
+	}
+
+	for price, want := range map[string]string{"2.5": "$2.50", "3": "$3", "2 for 5": "2 for 5"} {
+		if got := FormatPrice(price, "$"); got != want {
+			t.Errorf("FormatPrice(%q): got %q, want %q", price, got, want)
+		}
+	}
+}
+
+func TestSheetCSVURL(t *testing.T) {
+	tests := map[string]string{
+		"https://docs.google.com/spreadsheets/d/abc123/edit#gid=42":       "https://docs.google.com/spreadsheets/d/abc123/export?format=csv&gid=42",
+		"https://docs.google.com/spreadsheets/d/abc123/edit?usp=sharing":  "https://docs.google.com/spreadsheets/d/abc123/export?format=csv",
+		"https://docs.google.com/spreadsheets/d/e/2PACX-1/pub?output=csv": "https://docs.google.com/spreadsheets/d/e/2PACX-1/pub?output=csv",
+		"https://example.com/menu.csv":                                    "https://example.com/menu.csv",
+	}
+	for in, want := range tests {
+		if got := SheetCSVURL(in); got != want {
+			t.Errorf("SheetCSVURL(%q): got %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderMenu(t *testing.T) {
+	csv := "section,name,price\nDrinks,Tea,2\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(csv))
+	}))
+	defer srv.Close()
+
+	w := Widget{Kind: KindMenu, Title: "Menu", SourceURL: srv.URL, Theme: "chalkboard", Currency: "€"}
+	if err := w.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if w.Background != Themes["chalkboard"].Background {
+		t.Errorf("expected theme background, got %s", w.Background)
+	}
+
+	var b strings.Builder
+	s := NewSources()
+	if err := s.Render(&b, w, time.Now()); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	page := b.String()
+	for _, want := range []string{"<h2>Drinks</h2>", "Tea", "€2", "Comic Neue", Themes["chalkboard"].Accent} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected page to contain %q:\n%s", want, page)
+		}
+	}
+
+	// An uploaded CSV is used instead of the source.
+	w.CSV = "name,price,sold out\nScone,3,x\n"
+	b.Reset()
+	s.Render(&b, w, time.Now())
+	if !strings.Contains(b.String(), "Scone") || !strings.Contains(b.String(), "Sold out") || strings.Contains(b.String(), "Tea") {
+		t.Errorf("expected uploaded menu:\n%s", b.String())
+	}
+}
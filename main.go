@@ -1,39 +1,100 @@
 // Package main is the entry point for nexSign mini (nsm).
-// It initializes the host store, Anthias client integration, and web dashboard.
+// nsm serve, the default, initializes the host store, Anthias client
+// integration, and web dashboard; the other commands in commands.go cover
+// the remaining roles, so one binary does everything on a device.
 package main
 
 import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"syscall"
 	"time"
 
+	"nexsign.mini/nsm/internal/alerts"
 	"nexsign.mini/nsm/internal/anthias"
+	"nexsign.mini/nsm/internal/buddy"
+	"nexsign.mini/nsm/internal/calendar"
+	"nexsign.mini/nsm/internal/chaos"
+	"nexsign.mini/nsm/internal/config"
+	"nexsign.mini/nsm/internal/flags"
+	"nexsign.mini/nsm/internal/gitexport"
+	"nexsign.mini/nsm/internal/heartbeat"
+	"nexsign.mini/nsm/internal/homeassistant"
+	"nexsign.mini/nsm/internal/hooks"
 	"nexsign.mini/nsm/internal/hosts"
 	"nexsign.mini/nsm/internal/logger"
+	"nexsign.mini/nsm/internal/patching"
+	"nexsign.mini/nsm/internal/peerlog"
+	"nexsign.mini/nsm/internal/player"
+	"nexsign.mini/nsm/internal/rebooting"
+	"nexsign.mini/nsm/internal/reports"
+	"nexsign.mini/nsm/internal/simulate"
+	"nexsign.mini/nsm/internal/snmp"
+	"nexsign.mini/nsm/internal/tailscale"
+	"nexsign.mini/nsm/internal/tracing"
 	"nexsign.mini/nsm/internal/types"
+	"nexsign.mini/nsm/internal/watchdog"
 	"nexsign.mini/nsm/internal/web"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if c, ok := commands()[os.Args[1]]; ok {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+	// Without a command, flags are for serve, as they were before nsm had
+	// commands
+	serve(os.Args[1:])
+}
+
+// serve runs the node until it is interrupted.
+func serve(args []string) {
+	fs := newFlagSet("serve", "[flags]")
+	dev := fs.Bool("dev", false, "Reload templates from internal/web when they change")
+	simulated := fs.Int("simulate", 0, "Add this many simulated hosts with fake health and random incidents, for demos")
+	faultInjection := fs.Bool("chaos", false, "Serve /api/debug/faults to inject faults into peer traffic, for testing only")
+	configFile := fs.String("config", config.DefaultFile, "Node settings: port, data_dir, enable_actions, otlp_endpoint and store. Optional unless named")
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "nsm: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+
 	log.Println("nexSign mini starting...")
 
+	cfg, err := config.Load(*configFile, *configFile == config.DefaultFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
 	// Initialize host store
-	store, err := hosts.NewStore("")
+	store, err := hosts.Open(cfg.Store, cfg.DBFile())
 	if err != nil {
 		log.Fatalf("Failed to initialize host store: %v", err)
 	}
-	log.Println("Host store initialized")
+	if cfg.Store == hosts.BackendMemory {
+		log.Println("Host store initialized in memory; nothing is kept across restarts")
+	} else {
+		log.Println("Host store initialized")
+	}
 
 	// Initialize Anthias client for local monitoring
 	anthiasClient := anthias.NewClient()
 	log.Println("Anthias client initialized")
 
-	port := resolvePort(8080)
+	// Stamp local host edits with this node's ID, for merging on peers
+	if local, err := anthiasClient.GetMetadata(); err == nil {
+		store.SetNodeID(local.ID)
+	}
+
+	port := resolvePort(cfg.Port)
 	if err := ensurePortAvailable(port); err != nil {
 		log.Fatalf("Port %d unavailable: %v", port, err)
 	}
@@ -47,6 +108,45 @@ func main() {
 	// Get logger from server for use in main
 	lg := server.Logger()
 
+	if !cfg.EnableActions {
+		server.DisableActions()
+		lg.Info("Actions disabled by config: this node will not reboot, upgrade or power hosts")
+	}
+
+	// Let tests drop, delay and partition peer traffic. Every client
+	// without its own transport goes through the injector.
+	if *faultInjection {
+		faults := chaos.New()
+		http.DefaultTransport = faults.Transport(http.DefaultTransport)
+		server.EnableChaos(faults)
+		lg.Warning("Fault injection enabled: faults set at /api/debug/faults apply to peer traffic")
+	}
+
+	// Export traces of API requests, host merges and peer calls. Every
+	// client without its own transport sends the trace context on.
+	if cfg.OTLPEndpoint != "" {
+		instance, _ := os.Hostname()
+		if local, err := anthiasClient.GetMetadata(); err == nil {
+			instance = local.ID
+		}
+		tracing.Enable(cfg.OTLPEndpoint, "nsm", instance, lg)
+		http.DefaultTransport = tracing.Transport(http.DefaultTransport)
+		lg.Info(fmt.Sprintf("Tracing enabled: exporting spans to %s", cfg.OTLPEndpoint))
+	}
+
+	// Subsystems rolled out to part of the fleet
+	server.SetFlags(flags.New(store, anthiasClient, lg))
+
+	// The built-in player, off until enabled in its settings
+	localPlayer := player.New(store, anthiasClient, lg, port)
+	server.SetPlayer(localPlayer)
+
+	// Restart Anthias when its CMS stops answering and report viewer crash
+	// loops, off until enabled
+	localWatchdog := watchdog.New(store, anthiasClient, lg)
+	localWatchdog.SetPlayer(localPlayer)
+	server.SetWatchdog(localWatchdog)
+
 	// Start web server
 	serverErrors := server.Start()
 	go func() {
@@ -56,15 +156,90 @@ func main() {
 	}()
 	lg.Info(fmt.Sprintf("Web dashboard available at http://localhost:%d", port))
 
+	// Pick up template edits without a restart
+	if *dev {
+		go server.WatchTemplates(time.Second)
+		lg.Info("Development mode: templates reload when they change")
+	}
+
+	// Report for simulated hosts, which stay in the list until deleted
+	if *simulated > 0 {
+		fleet, err := simulate.NewFleet(store, lg, *simulated)
+		if err != nil {
+			log.Fatalf("Failed to start simulation: %v", err)
+		}
+		go fleet.Run()
+	}
+
+	// Drive this node's display when the built-in player is enabled
+	go localPlayer.Run()
+
 	// Start background Anthias polling
 	go pollAnthias(store, anthiasClient, lg)
 
+	// Tell peers we are alive, every few seconds
+	go heartbeat.NewSender(store, server.Identity(), anthiasClient, lg, server.PeerBus()).Run()
+
+	// Forward warnings and errors to peers
+	go peerlog.NewForwarder(store, server.Identity(), anthiasClient, lg, server.PeerBus()).Run()
+
+	// Ship the nightly snapshot to backup buddies when enabled
+	go buddy.NewSender(store, server.Identity(), anthiasClient, lg).Run()
+
+	// Keep hosts listed by DNS name resolved
+	go store.RunResolver()
+
+	// Sample host metrics for charts and uptime reports
+	go store.RunMetrics()
+
+	// Pick up tailnet addresses from a local tailscaled, if any
+	go tailscale.NewMonitor(store, tailscale.NewClient(), lg).Run()
+
+	// Start scheduled report delivery
+	go reports.NewScheduler(store, lg).Run()
+
+	// Restore presets from booking calendars when enabled
+	go calendar.NewScheduler(store, lg).Run()
+
+	// Nodes with actions disabled leave scheduled upgrades and reboots to
+	// the others
+	if cfg.EnableActions {
+		// Advance staged OS upgrade rollouts
+		go patching.NewScheduler(store, lg, server.PeerSigner()).Run()
+
+		// Reboot hosts on their schedules, unless someone is editing them
+		go rebooting.NewScheduler(store, lg, server.PeerSigner(), server.Editing).Run()
+
+		// Restart this node's Anthias when its CMS is down
+		go localWatchdog.Run()
+	}
+
+	// Commit fleet state to a Git remote when enabled
+	go gitexport.NewExporter(store, lg).Run()
+
+	// Run hooks when hosts are added, go offline or finish upgrading
+	go hooks.NewWatcher(store, lg).Run()
+
+	// Evaluate alert rules and notify
+	go alerts.NewEngine(store, lg).Run()
+
+	// Publish displays to Home Assistant when enabled
+	go homeassistant.NewBridge(store, lg, server.PeerSigner()).Run()
+
+	// Serve fleet health over SNMP when enabled
+	go snmp.NewFleetAgent(store, lg).Run()
+
 	// Wait for interrupt signal
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
 
 	lg.Info("Shutting down...")
+
+	// Let the next boot know this one ended cleanly
+	if err := heartbeat.MarkStopped(store); err != nil {
+		lg.Warning(fmt.Sprintf("Failed to record clean shutdown: %v", err))
+	}
 }
 
 // pollAnthias periodically checks local Anthias status and updates localhost entry
@@ -81,7 +256,7 @@ func pollAnthias(store *hosts.Store, client *anthias.Client, lg *logger.Logger)
 }
 
 // updateLocalHost updates the localhost entry with current Anthias data
-func updateLocalHost(store *hosts.Store, client *anthias.Client, lg *logger.Logger) {
+func updateLocalHost(store hosts.HostStore, client *anthias.Client, lg *logger.Logger) {
 	metadata, err := client.GetMetadata()
 	if err != nil {
 		lg.Warning(fmt.Sprintf("Failed to get Anthias metadata: %v", err))
@@ -105,7 +280,27 @@ func updateLocalHost(store *hosts.Store, client *anthias.Client, lg *logger.Logg
 		if existing.Notes != "" {
 			metadata.Notes = existing.Notes
 		}
+		metadata.Timezone = existing.Timezone
+		metadata.CMS = existing.CMS
+		// Peers learn these from their ARP tables and switch; we can't
+		metadata.MACAddress = existing.MACAddress
+		metadata.SwitchPort = existing.SwitchPort
+		// Only the health check reads the asset list
+		metadata.ContentExpiresAt = existing.ContentExpiresAt
 		
+		// GetMetadata knows nothing about the VPN; keep what the operator
+		// or the Tailscale monitor has set
+		if existing.VPNIPAddress != "" {
+			metadata.VPNIPAddress = existing.VPNIPAddress
+			metadata.DashboardURLVPN = existing.DashboardURLVPN
+			metadata.StatusVPN = types.StatusHealthy
+			metadata.NSMStatusVPN = "NSM Online"
+			metadata.NSMVersionVPN = types.Version
+			metadata.CMSStatusVPN = existing.CMSStatusVPN
+			metadata.AssetCountVPN = existing.AssetCountVPN
+			metadata.LastCheckedVPN = metadata.LastChecked
+		}
+
 		// Respect existing IP if different (user manual override)
 		if existing.IPAddress != metadata.IPAddress {
 			metadata.IPAddress = existing.IPAddress
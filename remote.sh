@@ -54,7 +54,7 @@ case "$ACTION" in
 
     deploy)
         echo "=== Deploying NSM to all hosts ==="
-        go run cmd/deployer/main.go --hosts all --parallel 4
+        go run . deploy --hosts all --parallel 4
         ;;
     
     logs)
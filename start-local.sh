@@ -6,7 +6,7 @@ set -e
 cd "$(dirname "$0")"
 
 go mod tidy
-go run cmd/docgen/main.go
+go run . docgen
 go build
 
 echo "Starting nexSign mini..."
@@ -57,4 +57,4 @@ if lsof -Pi :$PORT -sTCP:LISTEN -t >/dev/null 2>&1 ; then
 fi
 
 # Run the application
-go run -ldflags="-X 'nexsign.mini/nsm/internal/types.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)'" main.go
+go run -ldflags="-X 'nexsign.mini/nsm/internal/types.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)'" .